@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -13,9 +14,11 @@ import (
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/flags"
+	netutil "github.com/square/p2/pkg/util/net"
 
 	"github.com/Sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"gopkg.in/yaml.v2"
 )
@@ -28,6 +31,22 @@ var (
 
 type config struct {
 	Port int `yaml:"port"`
+
+	// The TLS files are named as in the preparer config. When they are set,
+	// clients must present a certificate signed by the CA.
+	CAFile   string `yaml:"ca_file,omitempty"`
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+
+	// AuthorizedClients maps the common names of client certificates to the
+	// label types they may access. If it is unset, any client with a valid
+	// certificate may access every label type.
+	AuthorizedClients map[string][]string `yaml:"authorized_clients,omitempty"`
+
+	// IndexLabels keeps every label in memory, indexed by key and value, to
+	// answer GetMatches requests without reading all of a label type from
+	// Consul. Results lag behind writes by up to the label aggregation rate.
+	IndexLabels bool `yaml:"index_labels,omitempty"`
 }
 
 const defaultPort = 3000
@@ -43,25 +62,55 @@ func main() {
 	client := consul.NewConsulClient(opts)
 	applicator := labels.NewConsulApplicator(client, 1)
 
-	port := getPort()
+	config := getConfig()
+
+	var serverOpts []grpc.ServerOption
+	if config.CertFile != "" || config.KeyFile != "" || config.CAFile != "" {
+		if config.CAFile == "" {
+			logger.Fatal("ca_file is required to verify client certificates")
+		}
+		tlsConfig, err := netutil.GetTLSConfig(config.CertFile, config.KeyFile, config.CAFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else if config.AuthorizedClients != nil {
+		logger.Fatal("authorized_clients requires TLS to be configured")
+	}
+
+	var authorizer labelstore.Authorizer = labelstore.AllowAll()
+	if config.AuthorizedClients != nil {
+		cnAuthorizer, err := labelstore.NewCNAuthorizer(config.AuthorizedClients)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		authorizer = cnAuthorizer
+	}
+
+	var index *labels.Index
+	if config.IndexLabels {
+		index = labels.NewIndex(applicator, labels.AllTypes, labels.DefaultAggregationRate, logrusLogger, nil)
+	}
+	server := labelstore.NewIndexedServer(applicator, index, authorizer, logrusLogger)
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
 	if err != nil {
 		logger.Fatalf("failed to listen: %v", err)
 	}
 
-	logrusLogger.Infof("Listening tcp on port %d", port)
-	s := grpc.NewServer()
-	label_protos.RegisterP2LabelStoreServer(s, labelstore.NewServer(applicator, logrusLogger))
+	logrusLogger.Infof("Listening tcp on port %d", config.Port)
+	s := grpc.NewServer(serverOpts...)
+	label_protos.RegisterP2LabelStoreServer(s, server)
 	if err := s.Serve(lis); err != nil {
 		logger.Fatalf("failed to serve: %v", err)
 	}
 }
 
-func getPort() int {
+func getConfig() config {
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
-		return defaultPort
+		return config{Port: defaultPort}
 	}
 
 	configBytes, err := ioutil.ReadFile(configPath)
@@ -76,8 +125,8 @@ func getPort() int {
 	}
 
 	if config.Port == 0 {
-		return defaultPort
+		config.Port = defaultPort
 	}
 
-	return config.Port
+	return config
 }
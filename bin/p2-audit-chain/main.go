@@ -0,0 +1,93 @@
+// p2-audit-chain checkpoints and verifies the tamper-evident audit chain, in
+// which preparers and the replication controller farm record security-relevant
+// events. Each entry of the chain covers the hash of the one before it, and
+// checkpoints sign the chain's head, so that entries that are modified or
+// removed, and a chain that is truncated, are detected by verify.
+//
+// checkpoint should be run periodically by a single operator-controlled host,
+// with a key that is on the keyring that verify is given.
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	cmdCheckpointText = "checkpoint"
+	cmdVerifyText     = "verify"
+)
+
+var (
+	cmdCheckpoint      = kingpin.Command(cmdCheckpointText, "Sign a checkpoint of the chain's head")
+	checkpointKeyring  = cmdCheckpoint.Flag("keyring", "A keyring whose first key, which must not be encrypted, signs the checkpoints").Required().ExistingFile()
+	checkpointInterval = cmdCheckpoint.Flag("interval", "Keep checkpointing the chain at this interval, rather than checkpointing it once").Duration()
+
+	cmdVerify     = kingpin.Command(cmdVerifyText, "Verify the chain and its checkpoints, exiting non-zero if it was tampered with")
+	verifyKeyring = cmdVerify.Flag("keyring", "The keyring of the keys that sign checkpoints").Required().ExistingFile()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.Logger.Formatter = &logrus.TextFormatter{}
+	chain := auditlogstore.NewChainStore(consul.NewConsulClient(opts).KV())
+
+	switch cmd {
+	case cmdCheckpointText:
+		keyring, err := auth.LoadKeyring(*checkpointKeyring)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not load the checkpoint keyring")
+		}
+		if len(keyring) == 0 || keyring[0].PrivateKey == nil || keyring[0].PrivateKey.Encrypted {
+			logger.NoFields().Fatalf("%s must contain an unencrypted private key", *checkpointKeyring)
+		}
+		if *checkpointInterval > 0 {
+			chain.RunCheckpoints(keyring[0], *checkpointInterval, nil, logger)
+			return
+		}
+		checkpoint, err := chain.Checkpoint(keyring[0])
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not checkpoint the audit chain")
+		}
+		if checkpoint == nil {
+			fmt.Println("The audit chain's head is already checkpointed")
+			return
+		}
+		fmt.Printf("Checkpointed the audit chain at entry %d\n", checkpoint.Seq)
+	case cmdVerifyText:
+		keyring, err := auth.LoadKeyring(*verifyKeyring)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not load the checkpoint keyring")
+		}
+		verified, err := chain.Verify(keyring)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "The audit chain did not verify: %s\n", err)
+			os.Exit(1)
+		}
+		if verified.LastCheckpoint == nil {
+			fmt.Printf("Verified %d entries. The chain has no checkpoints, so it can be rewritten without detection.\n", verified.Head.Seq)
+			return
+		}
+		fmt.Printf(
+			"Verified %d entries, checkpointed at entry %d at %s. %d entries since the checkpoint are not protected by it.\n",
+			verified.Head.Seq,
+			verified.LastCheckpoint.Seq,
+			verified.LastCheckpoint.Timestamp.Format(time.RFC3339),
+			verified.Head.Seq-verified.LastCheckpoint.Seq,
+		)
+	}
+}
@@ -28,6 +28,7 @@ var (
 	agentManifestPath  = kingpin.Flag("agent-pod", "A path to the manifest that will used to boot the base agent.").ExistingFile()
 	timeout            = kingpin.Flag("consul-timeout", "How long to wait for consul to begin serving. 0 will skip the consul check altogether.").Default("10s").String()
 	consulToken        = kingpin.Flag("consul-token", "The ACL token to pass to consul when registering the bootstrapped pods").String()
+	namespace          = kingpin.Flag("namespace", "The namespace of the p2 installation to register the bootstrapped pods in, if the consul cluster is shared by several").String()
 	podRoot            = kingpin.Flag("pod-root", "The root of where pods will be installed").Default(pods.DefaultPath).String()
 	registryURL        = kingpin.Flag("registry", "The URL of the registry to download artifacts from").URL()
 	requireFile        = kingpin.Flag("require-file", "Check for the presence of a required file before execing its argument").String()
@@ -178,7 +179,8 @@ func verifyReality(waitTime time.Duration, consulID types.PodID, agentID types.P
 	quit := make(chan struct{})
 	defer close(quit)
 	store := consul.NewConsulStore(consul.NewConsulClient(consul.Options{
-		Token: *consulToken,
+		Token:     *consulToken,
+		Namespace: *namespace,
 	}))
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -215,7 +217,8 @@ func verifyReality(waitTime time.Duration, consulID types.PodID, agentID types.P
 
 func scheduleForThisHost(manifest manifest.Manifest, alsoReality bool) error {
 	store := consul.NewConsulStore(consul.NewConsulClient(consul.Options{
-		Token: *consulToken,
+		Token:     *consulToken,
+		Namespace: *namespace,
 	}))
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -0,0 +1,134 @@
+// p2-convergence answers whether the fleet has converged: whether the reality
+// of every node matches its intent. The report command runs the reporter that
+// publishes the divergence of each node to the store and to metrics, and the
+// list command lists the nodes that have diverged, exiting with status 1 if
+// there are any. See package convergence.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/convergence"
+	"github.com/square/p2/pkg/logging"
+	p2metrics "github.com/square/p2/pkg/metrics"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	cmdReportText = "report"
+	cmdListText   = "list"
+)
+
+var (
+	cmdReport      = kingpin.Command(cmdReportText, "Publish the divergence of each node to the store and to metrics until interrupted")
+	reportPause    = cmdReport.Flag("pause", "How long to pause between watches of the intent and reality trees").Default(convergence.DefaultPauseTime.String()).Duration()
+	reportMetrics  = cmdReport.Flag("metrics-addr", "Serve the metrics in the Prometheus text format at /metrics on this address, e.g. :8080").String()
+	reportLogLevel = cmdReport.Flag("log", "Logging level to display").String()
+	cmdList        = kingpin.Command(cmdListText, "List the divergence of each node that has not converged, exiting with status 1 if there are any")
+	listJSON       = cmdList.Flag("json", "Print each node's divergence as a line of JSON").Bool()
+	listMinAge     = cmdList.Flag("min-age", "Only list the nodes that have diverged for at least this long, so that deploys in progress are left out").Duration()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.Logger.Formatter = &logrus.TextFormatter{}
+	store := consul.NewConsulStore(consul.NewConsulClient(opts))
+
+	switch cmd {
+	case cmdReportText:
+		if *reportLogLevel != "" {
+			lv, err := logrus.ParseLevel(*reportLogLevel)
+			if err != nil {
+				logger.WithErrorAndFields(err, logrus.Fields{"level": *reportLogLevel}).Fatalln("Could not parse log level")
+			}
+			logger.Logger.Level = lv
+		}
+		if *reportMetrics != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", p2metrics.PrometheusHandler)
+			go func() {
+				err := http.ListenAndServe(*reportMetrics, mux)
+				logger.WithError(err).Fatalln("Could not serve metrics")
+			}()
+		}
+
+		quit := make(chan struct{})
+		go func() {
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			<-signals
+			close(quit)
+		}()
+		convergence.NewReporter(store, *reportPause, logger).Run(quit)
+	case cmdListText:
+		results, err := store.ListDivergences()
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not list divergences")
+		}
+		now := time.Now()
+		var diverged []consul.DivergenceResult
+		for _, result := range results {
+			if now.Sub(result.Divergence.Since) >= *listMinAge {
+				diverged = append(diverged, result)
+			}
+		}
+
+		if *listJSON {
+			for _, result := range diverged {
+				bytes, err := json.Marshal(map[string]interface{}{
+					"node":       result.Node,
+					"divergence": result.Divergence,
+				})
+				if err != nil {
+					logger.WithError(err).Fatalln("Could not marshal divergence")
+				}
+				fmt.Println(string(bytes))
+			}
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "NODE\tDIVERGED FOR\tMISSING\tEXTRA\tMISMATCHED")
+			for _, result := range diverged {
+				fmt.Fprintf(
+					w,
+					"%s\t%s\t%s\t%s\t%s\n",
+					result.Node,
+					now.Sub(result.Divergence.Since)/time.Second*time.Second,
+					podIDs(result.Divergence.Missing),
+					podIDs(result.Divergence.Extra),
+					podIDs(result.Divergence.Mismatched),
+				)
+			}
+			w.Flush()
+		}
+		if len(diverged) > 0 {
+			os.Exit(1)
+		}
+	}
+}
+
+func podIDs(pods []consul.PodDivergence) string {
+	if len(pods) == 0 {
+		return "-"
+	}
+	ids := make([]string, len(pods))
+	for i, pod := range pods {
+		ids[i] = pod.PodID.String()
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,230 @@
+// p2-cosign is a CLI tool for signing a pod manifest with one more key.
+//
+// Pods with a signer quorum only run once enough of the quorum's signers have
+// signed their manifest, e.g. a developer and then a release engineer. Each
+// signer runs p2-cosign on the manifest in turn, which adds their signature to
+// the signature block of the clearsigned manifest, or clearsigns the manifest
+// if it isn't signed yet.
+//
+// With --kms-url, p2-cosign signs with a key of a KMS instead of a keyring, so
+// the private key never leaves the KMS.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/auth/kms"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+const helpMessage = `
+Sign a pod manifest, keeping the signatures that it already has. With no
+filename, or when filename is -, read standard input.
+`
+
+var (
+	progName       = filepath.Base(os.Args[0])
+	app            = kingpin.New(progName, helpMessage)
+	filename       = app.Arg("filename", `Pod manifest file to sign. Use "-" for stdin.`).String()
+	keyringPath    = app.Flag("keyring", "Keyring with the secret key to sign with").ExistingFile()
+	kmsURL         = app.Flag("kms-url", "URL of the KMS gateway to sign with instead of a keyring").String()
+	keyID          = app.Flag("key", "Fingerprint or key ID of the key to sign with, if the keyring has several, or the ID of the KMS key").String()
+	passphraseFile = app.Flag("passphrase-file", "File with the passphrase of the key, if it is encrypted").ExistingFile()
+	write          = app.Flag("write", "write result to source file instead of stdout").Short('w').Bool()
+)
+
+func main() {
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+	logger := log.New(os.Stderr, progName+": ", 0)
+
+	var data []byte
+	var err error
+	if *filename == "" || *filename == "-" {
+		if *write {
+			logger.Fatalln("--write is incompatible with reading from stdin")
+		}
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(*filename)
+	}
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	// refuse to sign something that preparers won't be able to read
+	_, err = manifest.FromBytes(data)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	signer, err := loadSigner()
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	signed, err := cosign(data, signer)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	if *write {
+		err = ioutil.WriteFile(*filename, signed, 0644)
+	} else {
+		_, err = os.Stdout.Write(signed)
+	}
+	if err != nil {
+		logger.Fatalln(err)
+	}
+}
+
+// loadSigner returns the entity of the keyring to sign with, decrypted, or
+// the entity of the KMS key
+func loadSigner() (*openpgp.Entity, error) {
+	if *kmsURL != "" {
+		if *keyringPath != "" {
+			return nil, util.Errorf("Only one of --keyring and --kms-url can be given")
+		}
+		if *keyID == "" {
+			return nil, util.Errorf("--key must give the ID of the KMS key to sign with")
+		}
+		client, err := kms.NewHTTPClient(*kmsURL, &http.Client{Timeout: 30 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		key, err := kms.FindKey(client, *keyID)
+		if err != nil {
+			return nil, err
+		}
+		return kms.SigningEntity(client, key)
+	}
+	if *keyringPath == "" {
+		return nil, util.Errorf("One of --keyring and --kms-url must be given")
+	}
+
+	keyring, err := auth.LoadKeyring(*keyringPath)
+	if err != nil {
+		return nil, util.Errorf("Could not load keyring %s: %s", *keyringPath, err)
+	}
+
+	var candidates []*openpgp.Entity
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if *keyID == "" || strings.HasSuffix(entity.PrimaryKey.KeyIdString(), strings.ToUpper(*keyID)) ||
+			strings.EqualFold(strings.Replace(*keyID, " ", "", -1), fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)) {
+			candidates = append(candidates, entity)
+		}
+	}
+	switch {
+	case len(candidates) == 0:
+		return nil, util.Errorf("%s has no secret key matching %q", *keyringPath, *keyID)
+	case len(candidates) > 1:
+		return nil, util.Errorf("%s has %d secret keys, use --key to pick one", *keyringPath, len(candidates))
+	}
+
+	signer := candidates[0]
+	if signer.PrivateKey.Encrypted {
+		if *passphraseFile == "" {
+			return nil, util.Errorf("The key is encrypted, use --passphrase-file to decrypt it")
+		}
+		passphrase, err := ioutil.ReadFile(*passphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		err = signer.PrivateKey.Decrypt(bytes.TrimRight(passphrase, "\r\n"))
+		if err != nil {
+			return nil, util.Errorf("Could not decrypt the key: %s", err)
+		}
+	}
+	return signer, nil
+}
+
+// cosign returns the manifest clearsigned by signer, along with any signatures
+// it already has
+func cosign(data []byte, signer *openpgp.Entity) ([]byte, error) {
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		var buf bytes.Buffer
+		plaintext, err := clearsign.Encode(&buf, signer.PrivateKey, nil)
+		if err != nil {
+			return nil, err
+		}
+		_, err = plaintext.Write(data)
+		if err != nil {
+			return nil, err
+		}
+		err = plaintext.Close()
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+		return buf.Bytes(), nil
+	}
+
+	signatures, err := ioutil.ReadAll(block.ArmoredSignature.Body)
+	if err != nil {
+		return nil, util.Errorf("Could not read the manifest's signatures: %s", err)
+	}
+	// sign with the same hash as the existing signatures, which is
+	// declared in the clearsigned message's header
+	config := &packet.Config{}
+	reader := bytes.NewReader(signatures)
+	for reader.Len() > 0 {
+		p, err := packet.Read(reader)
+		if err != nil {
+			return nil, util.Errorf("Could not read the manifest's signatures: %s", err)
+		}
+		sig, ok := p.(*packet.Signature)
+		if !ok {
+			continue
+		}
+		if sig.IssuerKeyId != nil && *sig.IssuerKeyId == signer.PrimaryKey.KeyId {
+			return nil, util.Errorf("The manifest is already signed by %s", signer.PrimaryKey.KeyIdString())
+		}
+		config.DefaultHash = sig.Hash
+	}
+
+	var signature bytes.Buffer
+	err = openpgp.DetachSignText(&signature, signer, bytes.NewReader(block.Bytes), config)
+	if err != nil {
+		return nil, util.Errorf("Could not sign the manifest: %s", err)
+	}
+
+	// keep the signed message as it is, replacing only its signature block
+	end := bytes.Index(data, []byte("\n-----BEGIN PGP SIGNATURE-----"))
+	if end < 0 {
+		return nil, util.Errorf("Could not find the manifest's signature block")
+	}
+	var buf bytes.Buffer
+	buf.Write(data[:end+1])
+	armored, err := armor.Encode(&buf, "PGP SIGNATURE", nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = armored.Write(append(signatures, signature.Bytes()...))
+	if err != nil {
+		return nil, err
+	}
+	err = armored.Close()
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
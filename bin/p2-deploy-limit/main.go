@@ -0,0 +1,84 @@
+// p2-deploy-limit manages the deploy limits of pods, which limit how many
+// nodes may be installing a pod at once so that the artifact servers aren't
+// overwhelmed when a release is deployed to many nodes at the same time.
+// Preparers take one of a pod's slots before downloading its artifacts.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	cmdSetText    = "set"
+	cmdRemoveText = "rm"
+	cmdListText   = "list"
+)
+
+var (
+	cmdSet   = kingpin.Command(cmdSetText, "Limit how many nodes may install a pod at once")
+	setPodID = cmdSet.Arg("pod", "The pod ID to limit").Required().String()
+	setLimit = cmdSet.Arg("limit", "How many nodes may install the pod at once").Required().Int()
+
+	cmdRemove   = kingpin.Command(cmdRemoveText, "Remove the deploy limit of a pod, letting any number of nodes install it at once")
+	removePodID = cmdRemove.Arg("pod", "The pod ID whose limit to remove").Required().String()
+
+	cmdList = kingpin.Command(cmdListText, "List the deploy limits of pods and the nodes holding their slots")
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.Logger.Formatter = &logrus.TextFormatter{}
+	store := consul.NewConsulStore(consul.NewConsulClient(opts))
+
+	switch cmd {
+	case cmdSetText:
+		err := store.SetDeployLimit(types.PodID(*setPodID), *setLimit)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not set the deploy limit")
+		}
+	case cmdRemoveText:
+		err := store.DeleteDeployLimit(types.PodID(*removePodID))
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not remove the deploy limit")
+		}
+	case cmdListText:
+		limits, err := store.ListDeployLimits()
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not list deploy limits")
+		}
+		var podIDs []string
+		for podID := range limits {
+			podIDs = append(podIDs, podID.String())
+		}
+		sort.Strings(podIDs)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "POD\tLIMIT\tHELD\tHOLDERS")
+		for _, podID := range podIDs {
+			limit := limits[types.PodID(podID)]
+			var holders []string
+			for node := range limit.Holders {
+				holders = append(holders, node.String())
+			}
+			sort.Strings(holders)
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", podID, limit.Limit, len(holders), strings.Join(holders, ","))
+		}
+		w.Flush()
+	}
+}
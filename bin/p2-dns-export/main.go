@@ -0,0 +1,90 @@
+// p2-dns-export exports the health of the pods that p2 runs to standard
+// service discovery, as SRV records of a zone file that a DNS server serves,
+// or as services of consul's catalog that consul's DNS interface serves, or
+// both. See package dnsexport.
+package main
+
+import (
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/dnsexport"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/health/checker"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/version"
+)
+
+var (
+	interval          = kingpin.Flag("interval", "How often to export the pods' health").Default("10s").Duration()
+	nodeDomain        = kingpin.Flag("node-domain", "A domain to append to node names to make their host names, if node names aren't fully qualified").String()
+	zoneFile          = kingpin.Flag("zone-file", "Write SRV records of the healthy pods to this zone file").String()
+	domain            = kingpin.Flag("domain", "The domain of the SRV records of the zone file, e.g. p2.example.com").String()
+	ttl               = kingpin.Flag("ttl", "The TTL of the SRV records of the zone file").Default(dnsexport.DefaultTTL.String()).Duration()
+	minHealth         = kingpin.Flag("min-health", "The least health of the pods that have SRV records in the zone file").Default(string(health.Passing)).Enum(string(health.Passing), string(health.Warning), string(health.Unknown), string(health.Critical))
+	catalogNodePrefix = kingpin.Flag("catalog-node-prefix", "Register the pods as services of consul's catalog, on external nodes named this prefix followed by the node's name").String()
+	logLevel          = kingpin.Flag("log", "Logging level to display").String()
+)
+
+type sinks []dnsexport.Sink
+
+func (s sinks) Export(instances []dnsexport.Instance) error {
+	for _, sink := range s {
+		err := sink.Export(instances)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	kingpin.Version(version.VERSION)
+	_, opts, _ := flags.ParseWithConsulOptions()
+
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.Logger.Formatter = &logrus.TextFormatter{}
+	if *logLevel != "" {
+		lv, err := logrus.ParseLevel(*logLevel)
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{"level": *logLevel}).Fatalln("Could not parse log level")
+		}
+		logger.Logger.Level = lv
+	}
+
+	client := consul.NewConsulClient(opts)
+	var exportTo sinks
+	if *zoneFile != "" {
+		if *domain == "" {
+			logger.NoFields().Fatalln("--domain must be given with --zone-file")
+		}
+		exportTo = append(exportTo, dnsexport.ZoneFile{
+			Path:       *zoneFile,
+			Domain:     *domain,
+			NodeDomain: *nodeDomain,
+			TTL:        *ttl,
+			MinHealth:  health.HealthState(*minHealth),
+		})
+	}
+	if *catalogNodePrefix != "" {
+		catalog, err := dnsexport.NewCatalog(consul.NewCatalog(opts), *catalogNodePrefix, *nodeDomain)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not read the catalog")
+		}
+		exportTo = append(exportTo, catalog)
+	}
+	if len(exportTo) == 0 {
+		logger.NoFields().Fatalln("At least one of --zone-file and --catalog-node-prefix must be given")
+	}
+
+	dnsexport.Run(
+		consul.NewConsulStore(client),
+		checker.NewConsulHealthChecker(client),
+		exportTo,
+		*interval,
+		nil,
+		logger,
+	)
+}
@@ -0,0 +1,91 @@
+// p2-drain is a command line tool for taking nodes out of service. Cordoning a
+// node stops RCs from scheduling on it, and draining one also moves its
+// replicas to other nodes and removes the rest of its pods.
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/drain"
+	"github.com/square/p2/pkg/health/checker"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/store/consul/rollstore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	cmdCordonText   = "cordon"
+	cmdUncordonText = "uncordon"
+	cmdDrainText    = "drain"
+)
+
+var (
+	cmdCordon  = kingpin.Command(cmdCordonText, "Stop replication controllers from scheduling pods on a node. Its pods are left in place")
+	cordonNode = cmdCordon.Arg("node", "The node to cordon").Required().String()
+
+	cmdUncordon  = kingpin.Command(cmdUncordonText, "Let replication controllers schedule pods on a node again")
+	uncordonNode = cmdUncordon.Arg("node", "The node to uncordon").Required().String()
+
+	cmdDrain     = kingpin.Command(cmdDrainText, "Cordon a node, move its replicas to other nodes one at a time within their disruption budgets, then remove its remaining pods")
+	drainNode    = cmdDrain.Arg("node", "The node to drain").Required().String()
+	drainTimeout = cmdDrain.Flag("timeout", "How long moving each replica may take").Default(drain.DefaultTimeout.String()).Duration()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.Logger.Formatter = &logrus.TextFormatter{}
+	client := consul.NewConsulClient(opts)
+
+	// the RC and roll stores require transactions, which the labeler from
+	// flags.ParseWithConsulOptions() doesn't support
+	labeler := labels.NewConsulApplicator(client, 0)
+
+	switch cmd {
+	case cmdCordonText:
+		err := drain.Cordon(labeler, types.NodeName(*cordonNode))
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not cordon node")
+		}
+	case cmdUncordonText:
+		err := drain.Uncordon(labeler, types.NodeName(*uncordonNode))
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not uncordon node")
+		}
+	case cmdDrainText:
+		drainer := drain.NewDrainer(
+			rcstore.NewConsul(client, labeler, 3),
+			rollstore.NewConsul(client, labeler, nil),
+			labeler,
+			checker.NewConsulHealthChecker(client),
+			consul.NewConsulStore(client),
+			logger,
+			*drainTimeout,
+		)
+
+		quit := make(chan struct{})
+		signals := make(chan os.Signal, 2)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		go func() {
+			<-signals
+			close(quit)
+		}()
+
+		err := drainer.Drain(types.NodeName(*drainNode), quit)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not drain node")
+		}
+	}
+}
@@ -36,10 +36,15 @@ var (
 	cgroupName     = kingpin.Flag("cgroup", "The name of the cgroup that should be created.").Short('c').String()
 	nolim          = kingpin.Flag("nolimit", "Remove rlimits.").Short('n').Bool()
 	clearEnv       = kingpin.Flag("clearenv", "Clear all environment variables before loading envDir(s).").Bool()
+	keepEnv        = kingpin.Flag("keep-env", "An environment variable to keep when clearing the environment. May be specified more than once.").Strings()
+	unsetEnv       = kingpin.Flag("unset-env", "An environment variable to remove before loading envDir(s). May be specified more than once.").Strings()
 	workDir        = kingpin.Flag("workdir", "Set working directory.").Short('w').String()
 	umask          = kingpin.Flag("umask", "Set the process umask. Use octal notation ex. 0022").Short('m').Default(umaskDefault).String()
 	umaskDefault   = ""
 
+	selinuxContext  = kingpin.Flag("selinux-context", "The SELinux context to execute the command in.").String()
+	apparmorProfile = kingpin.Flag("apparmor-profile", "The AppArmor profile to execute the command in.").String()
+
 	cmd = kingpin.Arg("command", "the command to execute").Required().Strings()
 )
 
@@ -56,7 +61,26 @@ func main() {
 	}
 
 	if *clearEnv {
+		kept := make(map[string]string)
+		for _, name := range *keepEnv {
+			if value, ok := os.LookupEnv(name); ok {
+				kept[name] = value
+			}
+		}
 		os.Clearenv()
+		for name, value := range kept {
+			err := os.Setenv(name, value)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	for _, name := range *unsetEnv {
+		err := os.Unsetenv(name)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	for _, dir := range *envDir {
@@ -145,6 +169,13 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if *selinuxContext != "" || *apparmorProfile != "" {
+		err = applyConfinement(*selinuxContext, *apparmorProfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	err = syscall.Exec(binPath, *cmd, os.Environ())
 	// should never be reached
 	if err != nil {
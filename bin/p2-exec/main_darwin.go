@@ -9,6 +9,7 @@ import (
 	// #include <pwd.h>
 	// #include <grp.h>
 	"C"
+	"os"
 	"unsafe"
 
 	"github.com/square/p2/pkg/user"
@@ -35,6 +36,10 @@ func changeUser(username string) error {
 		return util.Errorf("Could not retrieve uid/gid for %q: %s", username, err)
 	}
 
+	if uid == os.Getuid() && gid == os.Getgid() {
+		return nil
+	}
+
 	userCstring := C.CString(username)
 	defer C.free(unsafe.Pointer(userCstring))
 
@@ -52,3 +57,7 @@ func changeUser(username string) error {
 	}
 	return nil
 }
+
+func applyConfinement(selinuxContext, apparmorProfile string) error {
+	return util.Errorf("SELinux and AppArmor are not supported on darwin")
+}
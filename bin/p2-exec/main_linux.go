@@ -8,12 +8,17 @@ import (
 	// #include <pwd.h>
 	// #include <grp.h>
 	"C"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"os/user"
+	"runtime"
 	"strconv"
 	"strings"
 	"unsafe"
 
+	"golang.org/x/sys/unix"
+
 	p2_user "github.com/square/p2/pkg/user"
 	"github.com/square/p2/pkg/util"
 )
@@ -78,3 +83,47 @@ func changeUser(username string) error {
 	}
 	return nil
 }
+
+// applyConfinement arranges for the next exec of the calling thread to enter
+// the given SELinux context and/or AppArmor profile. The attributes are per
+// thread, so the goroutine is locked to its thread, which must be the one that
+// execs the command.
+func applyConfinement(selinuxContext, apparmorProfile string) error {
+	runtime.LockOSThread()
+	attrDir := fmt.Sprintf("/proc/self/task/%d/attr", unix.Gettid())
+
+	if selinuxContext != "" {
+		err := writeAttr(attrDir+"/exec", selinuxContext)
+		if err != nil {
+			return util.Errorf("Could not set SELinux context %q: %s", selinuxContext, err)
+		}
+	}
+
+	if apparmorProfile != "" {
+		// newer kernels move AppArmor's attributes to their own directory,
+		// so that they can be stacked with other security modules
+		path := attrDir + "/apparmor/exec"
+		if _, err := os.Stat(path); err != nil {
+			path = attrDir + "/exec"
+		}
+		err := writeAttr(path, "exec "+apparmorProfile)
+		if err != nil {
+			return util.Errorf("Could not set AppArmor profile %q: %s", apparmorProfile, err)
+		}
+	}
+	return nil
+}
+
+// writeAttr writes a process attribute, which must be done in a single write
+func writeAttr(path string, value string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write([]byte(value))
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
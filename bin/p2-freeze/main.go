@@ -0,0 +1,137 @@
+// p2-freeze manages deploy freezes, which stop deploys during maintenance
+// windows and incidents. While a freeze is active, preparers don't install or
+// update the pods it covers and the roll farm holds rolling updates of them,
+// unless the manifest or rolling update is marked as an emergency.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/freeze/fields"
+	"github.com/square/p2/pkg/logging"
+	pc_fields "github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/freezestore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	cmdSetText    = "set"
+	cmdRemoveText = "rm"
+	cmdListText   = "list"
+)
+
+var (
+	cmdSet              = kingpin.Command(cmdSetText, "Create or replace a freeze. Exactly one of --global, --pod (with --availability-zone and --cluster-name) or --node-selector must be given.")
+	setID               = cmdSet.Arg("id", "The ID of the freeze").Required().String()
+	setGlobal           = cmdSet.Flag("global", "Freeze every pod").Bool()
+	setPodID            = cmdSet.Flag("pod", "Freeze the pod cluster of this pod ID").String()
+	setAvailabilityZone = cmdSet.Flag("availability-zone", "The availability zone of the pod cluster to freeze").String()
+	setClusterName      = cmdSet.Flag("cluster-name", "The name of the pod cluster to freeze").String()
+	setNodeSelector     = cmdSet.Flag("node-selector", "Freeze the pods of the nodes matching this label selector").String()
+	setWindows          = cmdSet.Flag("window", "When the freeze is active, as <start>/<end> in RFC3339. May be repeated. Without windows the freeze is active until removed.").Strings()
+	setReason           = cmdSet.Flag("reason", "Why deploys are frozen").String()
+
+	cmdRemove = kingpin.Command(cmdRemoveText, "Remove a freeze")
+	removeID  = cmdRemove.Arg("id", "The ID of the freeze to remove").Required().String()
+
+	cmdList = kingpin.Command(cmdListText, "List freezes and whether they are active")
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.Logger.Formatter = &logrus.TextFormatter{}
+	store := freezestore.NewConsul(consul.NewConsulClient(opts))
+
+	switch cmd {
+	case cmdSetText:
+		freeze := fields.Freeze{
+			ID:           fields.ID(*setID),
+			Global:       *setGlobal,
+			NodeSelector: *setNodeSelector,
+			Reason:       *setReason,
+		}
+		if *setPodID != "" || *setAvailabilityZone != "" || *setClusterName != "" {
+			freeze.PodCluster = &fields.PodCluster{
+				PodID:            types.PodID(*setPodID),
+				AvailabilityZone: pc_fields.AvailabilityZone(*setAvailabilityZone),
+				ClusterName:      pc_fields.ClusterName(*setClusterName),
+			}
+		}
+		for _, window := range *setWindows {
+			parsed, err := parseWindow(window)
+			if err != nil {
+				logger.WithError(err).Fatalln("Invalid freeze window")
+			}
+			freeze.Windows = append(freeze.Windows, parsed)
+		}
+		err := store.Set(freeze)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not set the freeze")
+		}
+	case cmdRemoveText:
+		err := store.Delete(fields.ID(*removeID))
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not remove the freeze")
+		}
+	case cmdListText:
+		freezes, err := store.List()
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not list freezes")
+		}
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSCOPE\tACTIVE\tWINDOWS\tREASON")
+		for _, freeze := range freezes {
+			var windows []string
+			for _, window := range freeze.Windows {
+				windows = append(windows, window.Start.Format(time.RFC3339)+"/"+window.End.Format(time.RFC3339))
+			}
+			if len(windows) == 0 {
+				windows = append(windows, "always")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\n", freeze.ID, scope(freeze), freeze.Active(now), strings.Join(windows, ","), freeze.Reason)
+		}
+		w.Flush()
+	}
+}
+
+func parseWindow(window string) (fields.Window, error) {
+	parts := strings.Split(window, "/")
+	if len(parts) != 2 {
+		return fields.Window{}, util.Errorf("%q is not of the form <start>/<end>", window)
+	}
+	start, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return fields.Window{}, util.Errorf("Invalid start of %q: %s", window, err)
+	}
+	end, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return fields.Window{}, util.Errorf("Invalid end of %q: %s", window, err)
+	}
+	return fields.Window{Start: start, End: end}, nil
+}
+
+func scope(freeze fields.Freeze) string {
+	switch {
+	case freeze.Global:
+		return "global"
+	case freeze.PodCluster != nil:
+		return fmt.Sprintf("pod cluster %s/%s/%s", freeze.PodCluster.PodID, freeze.PodCluster.AvailabilityZone, freeze.PodCluster.ClusterName)
+	default:
+		return "nodes " + freeze.NodeSelector
+	}
+}
@@ -0,0 +1,132 @@
+// p2-heartbeat lists the heartbeats that preparers write to the store, and the
+// nodes whose preparers have stopped writing them, so that operators and
+// schedulers can avoid nodes whose preparer is dead or stuck.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/version"
+)
+
+const (
+	cmdListText  = "list"
+	cmdStaleText = "stale"
+)
+
+var (
+	cmdList  = kingpin.Command(cmdListText, "List the heartbeat of every node's preparer")
+	listJSON = cmdList.Flag("json", "Print each heartbeat as a line of JSON").Bool()
+
+	cmdStale    = kingpin.Command(cmdStaleText, "List the nodes whose preparer has not written a heartbeat recently, including nodes with pods whose preparer never has")
+	staleMaxAge = cmdStale.Flag("max-age", "How old a heartbeat may be before its node is stale. Allow for clock skew and a few missed heartbeats.").Default("1m").Duration()
+	staleNames  = cmdStale.Flag("names", "Print only the names of the stale nodes").Bool()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	cmd, opts, _ := flags.ParseWithConsulOptions()
+
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.Logger.Formatter = &logrus.TextFormatter{}
+	store := consul.NewConsulStore(consul.NewConsulClient(opts))
+
+	switch cmd {
+	case cmdListText:
+		heartbeats, err := store.ListHeartbeats()
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not list heartbeats")
+		}
+		sort.Sort(heartbeatsByNode(heartbeats))
+		if *listJSON {
+			for _, result := range heartbeats {
+				bytes, err := json.Marshal(map[string]interface{}{
+					"node":      result.Node,
+					"heartbeat": result.Heartbeat,
+				})
+				if err != nil {
+					logger.WithError(err).Fatalln("Could not marshal heartbeat")
+				}
+				fmt.Println(string(bytes))
+			}
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NODE\tVERSION\tAGE\tUPTIME\tDISK AVAILABLE\tMEMORY AVAILABLE\tLOOPS")
+		for _, result := range heartbeats {
+			printHeartbeat(w, result.Node.String(), result.Heartbeat)
+		}
+		w.Flush()
+	case cmdStaleText:
+		stale, err := store.StaleNodes(time.Now(), *staleMaxAge)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not list stale nodes")
+		}
+		if *staleNames {
+			for _, node := range stale {
+				fmt.Println(node.Node)
+			}
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NODE\tVERSION\tAGE\tUPTIME\tDISK AVAILABLE\tMEMORY AVAILABLE\tLOOPS")
+		for _, node := range stale {
+			if node.Heartbeat == nil {
+				fmt.Fprintf(w, "%s\t-\tnever\t-\t-\t-\t-\n", node.Node)
+				continue
+			}
+			printHeartbeat(w, node.Node.String(), *node.Heartbeat)
+		}
+		w.Flush()
+	}
+}
+
+func printHeartbeat(w *tabwriter.Writer, node string, heartbeat consul.Heartbeat) {
+	now := time.Now()
+	var loops []string
+	for name, passed := range heartbeat.LoopTimes {
+		loops = append(loops, fmt.Sprintf("%s=%s", name, seconds(now.Sub(passed))))
+	}
+	sort.Strings(loops)
+	fmt.Fprintf(
+		w,
+		"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		node,
+		heartbeat.PreparerVersion,
+		seconds(now.Sub(heartbeat.Time)),
+		seconds(heartbeat.Uptime()),
+		megabytes(heartbeat.DiskAvailable),
+		megabytes(heartbeat.MemoryAvailable),
+		strings.Join(loops, ","),
+	)
+}
+
+// seconds truncates d to whole seconds for display
+func seconds(d time.Duration) time.Duration {
+	return d / time.Second * time.Second
+}
+
+func megabytes(bytes int64) string {
+	if bytes == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dM", bytes/(1024*1024))
+}
+
+type heartbeatsByNode []consul.HeartbeatResult
+
+func (h heartbeatsByNode) Len() int           { return len(h) }
+func (h heartbeatsByNode) Less(i, j int) bool { return h[i].Node < h[j].Node }
+func (h heartbeatsByNode) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
@@ -21,8 +21,84 @@ var (
 	nodeArg = kingpin.Flag("node", "The node to inspect. By default, all nodes are shown.").String()
 	podArg  = kingpin.Flag("pod", "The pod manifest ID to inspect. By default, all pods are shown.").String()
 	format  = kingpin.Flag("format", "Display format").Default("tree").Enum("tree", "list")
+	watch   = kingpin.Flag("watch", "Watch the pod given by --pod on the node given by --node, printing its status whenever its intent or reality changes").Bool()
 )
 
+type podPager interface {
+	ForEachPod(podPrefix consul.PodPrefix, opts consul.ListPodsOptions, f func(consul.ManifestResult) error) error
+}
+
+// allPods reads the pods of the tree a page of nodes at a time, only reading
+// those of podID if it is set
+func allPods(store podPager, podPrefix consul.PodPrefix, podID types.PodID) ([]consul.ManifestResult, error) {
+	var results []consul.ManifestResult
+	err := store.ForEachPod(podPrefix, consul.ListPodsOptions{PodIDPrefix: podID.String()}, func(result consul.ManifestResult) error {
+		results = append(results, result)
+		return nil
+	})
+	return results, err
+}
+
+type podPairWatcher interface {
+	WatchPodPair(
+		nodename types.NodeName,
+		podId types.PodID,
+		quitChan <-chan struct{},
+		errChan chan<- error,
+		pairChan chan<- consul.PodPair,
+	)
+}
+
+// watchPodPair prints the status of a single pod on a single node each time
+// its intent or reality changes. Only the two keys of the pod are watched, so
+// this is much cheaper than repeatedly listing the whole node.
+func watchPodPair(watcher podPairWatcher, hchecker checker.ConsulHealthChecker, node types.NodeName, podID types.PodID) {
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	errCh := make(chan error)
+	pairCh := make(chan consul.PodPair)
+	go watcher.WatchPodPair(node, podID, quitCh, errCh, pairCh)
+
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		select {
+		case err := <-errCh:
+			log.Printf("Error watching %s on %s: %s", podID, node, err)
+		case pair, ok := <-pairCh:
+			if !ok {
+				log.Fatalf("The watch of %s on %s terminated unexpectedly", podID, node)
+			}
+
+			statusMap := make(map[types.PodID]map[types.NodeName]inspect.NodePodStatus)
+			if pair.Intent != nil {
+				result := consul.ManifestResult{Manifest: pair.Intent, PodLocation: types.PodLocation{Node: node, PodID: podID}}
+				if err := inspect.AddKVPToMap(result, inspect.INTENT_SOURCE, node, podID, statusMap); err != nil {
+					log.Fatal(err)
+				}
+			}
+			if pair.Reality != nil {
+				result := consul.ManifestResult{Manifest: pair.Reality, PodLocation: types.PodLocation{Node: node, PodID: podID}}
+				if err := inspect.AddKVPToMap(result, inspect.REALITY_SOURCE, node, podID, statusMap); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			status := statusMap[podID][node]
+			status.PodId = podID
+			status.NodeName = node
+			healthResult, err := hchecker.Service(podID.String())
+			if err != nil {
+				log.Printf("Could not retrieve health checks for pod %s: %s", podID, err)
+			} else if result, ok := healthResult[node]; ok {
+				status.Health = result.Status
+			}
+			if err := enc.Encode(status); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
 func main() {
 	kingpin.Version(version.VERSION)
 	_, opts, _ := flags.ParseWithConsulOptions()
@@ -35,10 +111,18 @@ func main() {
 	filterNodeName := types.NodeName(*nodeArg)
 	filterPodID := types.PodID(*podArg)
 
+	if *watch {
+		if filterNodeName == "" || filterPodID == "" {
+			log.Fatalln("--watch requires both --node and --pod")
+		}
+		watchPodPair(store, checker.NewConsulHealthChecker(client), filterNodeName, filterPodID)
+		return
+	}
+
 	if filterNodeName != "" {
 		intents, _, err = store.ListPods(consul.INTENT_TREE, filterNodeName)
 	} else {
-		intents, _, err = store.AllPods(consul.INTENT_TREE)
+		intents, err = allPods(store, consul.INTENT_TREE, filterPodID)
 	}
 	if err != nil {
 		message := "Could not list intent kvpairs: %s"
@@ -52,7 +136,7 @@ func main() {
 	if filterNodeName != "" {
 		realities, _, err = store.ListPods(consul.REALITY_TREE, filterNodeName)
 	} else {
-		realities, _, err = store.AllPods(consul.REALITY_TREE)
+		realities, err = allPods(store, consul.REALITY_TREE, filterPodID)
 	}
 
 	if err != nil {
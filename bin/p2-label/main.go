@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/store/consul/flags"
@@ -32,13 +33,18 @@ Example:
 	showLabelType = cmdShow.Flag("labelType", "The type of label to adjust. Sometimes called the \"label tree\". Supported types can be found here:\n\thttps://godoc.org/github.com/square/p2/pkg/labels#pkg-constants").Short('t').Required().String()
 	showID        = cmdShow.Flag("id", "The ID of the entity to show labels for.").Short('i').Required().String()
 
+	cmdHistory       = kingpin.Command(CmdHistory, "Show the recent changes to the labels of a particular entity (type, ID) and what made them")
+	historyLabelType = cmdHistory.Flag("labelType", "The type of label to show history for. Sometimes called the \"label tree\". Supported types can be found here:\n\thttps://godoc.org/github.com/square/p2/pkg/labels#pkg-constants").Short('t').Required().String()
+	historyID        = cmdHistory.Flag("id", "The ID of the entity to show label history for.").Short('i').Required().String()
+
 	// autoConfirm captures the confirmation desire abstractly across commands
 	autoConfirm = false
 )
 
 const (
-	CmdApply = "apply"
-	CmdShow  = "show"
+	CmdApply   = "apply"
+	CmdShow    = "show"
+	CmdHistory = "history"
 )
 
 func main() {
@@ -62,6 +68,29 @@ func main() {
 		}
 		fmt.Printf("%s/%s: %s\n", labelType, *showID, labelsForEntity.Labels.String())
 		return
+	case CmdHistory:
+		labelType, err := labels.AsType(*historyLabelType)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error while parsing label type. Check the commandline.\n%v\n", err)
+			exitCode = 1
+			break
+		}
+
+		historyReader, ok := applicator.(labels.HistoryReader)
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Label history is only available when labels are read from Consul")
+			exitCode = 1
+			break
+		}
+		history, err := historyReader.GetLabelHistory(labelType, *historyID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Got error while querying label history. %v\n", err)
+			exitCode = 1
+			break
+		}
+		for _, entry := range history {
+			fmt.Printf("%s %s: %q -> %q\n", entry.Time.Format(time.RFC3339), entry.Actor, entry.Old.String(), entry.New.String())
+		}
 	case CmdApply:
 		// if xnor(selector, id)
 		if (*applySubjectSelector == "") == (*applySubjectID == "") {
@@ -131,6 +131,7 @@ func authorize(manifest manifest.Manifest) error {
 			map[types.PodID][]string{
 				constants.PreparerPodID: *allowedUsers,
 			},
+			nil,
 		)
 		if err != nil {
 			return err
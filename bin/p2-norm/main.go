@@ -14,7 +14,8 @@ import (
 
 const helpMessage = `
 Read a pod manifest and print it in a normalized format without any signature.
-With no filename, or when filename is -, read standard input.
+With no filename, or when filename is -, read standard input. The manifest may
+be YAML or JSON.
 `
 
 var (
@@ -22,6 +23,8 @@ var (
 	app      = kingpin.New(progName, helpMessage)
 	filename = app.Arg("filename", `Pod manifest file to normalize. Use "-" for stdin.`).String()
 	write    = app.Flag("write", "write result to source file instead of stdout").Short('w').Bool()
+	format   = app.Flag("format", "format to print the manifest in").Default(string(manifest.YAMLFormat)).Enum(string(manifest.YAMLFormat), string(manifest.JSONFormat))
+	strict   = app.Flag("strict", "refuse manifests with keys that aren't manifest fields").Bool()
 )
 
 func main() {
@@ -39,18 +42,30 @@ func main() {
 	} else {
 		data, err = ioutil.ReadFile(*filename)
 		if err == nil && *write {
-			output, err = os.OpenFile(*filename, os.O_RDWR, 0)
+			output, err = os.OpenFile(*filename, os.O_WRONLY|os.O_TRUNC, 0)
 		}
 	}
 	if err != nil {
 		logger.Fatalln(err)
 	}
 
-	m, err := manifest.FromBytes(data)
+	var m manifest.Manifest
+	if *strict {
+		m, err = manifest.FromBytesStrict(data)
+	} else {
+		m, err = manifest.FromBytes(data)
+	}
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	normalized, err := manifest.MarshalFormat(m.GetBuilder().GetManifest(), manifest.Format(*format))
 	if err != nil {
 		logger.Fatalln(err)
 	}
-	err = m.GetBuilder().GetManifest().Write(output)
+	if manifest.Format(*format) == manifest.JSONFormat {
+		normalized = append(normalized, '\n')
+	}
+	_, err = output.Write(normalized)
 	if err != nil {
 		logger.Fatalln(err)
 	}
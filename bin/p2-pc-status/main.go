@@ -0,0 +1,65 @@
+// p2-pc-status runs a controller that records the number of matched and
+// healthy pods for every pod cluster in the status tree.
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/health/checker"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pc/status"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/pcstatus"
+	"github.com/square/p2/pkg/version"
+)
+
+var (
+	logLevel          = kingpin.Flag("log", "Logging level to display").String()
+	reconcileInterval = kingpin.Flag("reconcile-interval", "How often to recompute pod cluster health when membership hasn't changed").Default(status.DefaultReconcileInterval.String()).Duration()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	_, opts, labeler := flags.ParseWithConsulOptions()
+
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.Logger.Formatter = new(logrus.TextFormatter)
+	if *logLevel != "" {
+		lv, err := logrus.ParseLevel(*logLevel)
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{"level": *logLevel}).
+				Fatalln("Could not parse log level")
+		}
+		logger.Logger.Level = lv
+	}
+
+	client := consul.NewConsulClient(opts)
+	pcStore := pcstore.NewConsul(client, labeler, labels.DefaultAggregationRate, labels.NewConsulApplicator(client, 0), &logger)
+	statusStore := pcstatus.NewConsul(statusstore.NewConsul(client), pcstatus.StatusControllerNamespace)
+	healthChecker := checker.NewConsulHealthChecker(client)
+
+	controller := status.NewController(pcStore, statusStore, healthChecker, logger, *reconcileInterval)
+
+	quitCh := make(chan struct{})
+	go func() {
+		signalCh := make(chan os.Signal, 2)
+		signal.Notify(signalCh, syscall.SIGTERM, os.Interrupt)
+		received := <-signalCh
+		logger.Warnf("Received %v, shutting down", received)
+		close(quitCh)
+	}()
+
+	logger.NoFields().Infoln("Starting pod cluster status controller")
+	if err := controller.Run(quitCh); err != nil {
+		logger.WithError(err).Fatalln("Pod cluster status controller exited with an error")
+	}
+}
@@ -12,13 +12,17 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/square/p2/pkg/cli"
+	disruption_fields "github.com/square/p2/pkg/disruption/fields"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/pc/control"
 	"github.com/square/p2/pkg/pc/fields"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/budgetstore"
 	"github.com/square/p2/pkg/store/consul/flags"
 	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/pcstatus"
 	"github.com/square/p2/pkg/types"
 	klabels "k8s.io/kubernetes/pkg/labels"
 	"k8s.io/kubernetes/pkg/util/sets"
@@ -29,8 +33,15 @@ const (
 	cmdGetText               = "get"
 	cmdDeleteText            = "delete"
 	cmdUpdateAnnotationsText = "update-annotations"
+	cmdPatchAnnotationsText  = "patch-annotations"
 	cmdUpdateSelectorText    = "update-selector"
 	cmdListText              = "list"
+	cmdMembersText           = "members"
+	cmdStatusText            = "status"
+	cmdSetBudgetText         = "set-budget"
+	cmdGetBudgetText         = "get-budget"
+	cmdDeleteBudgetText      = "delete-budget"
+	cmdListBudgetsText       = "list-budgets"
 )
 
 // "create" command and flags
@@ -74,6 +85,32 @@ var (
 	updateAnnotations = cmdUpdateAnnotations.Flag("annotations", "JSON string representing the complete annotations that should be applied to the pod cluster. Annotations will not be updated if this flag is unspecified.").Required().String()
 )
 
+// "patch-annotations" command and flags"
+var (
+	cmdPatchAnnotations = kingpin.Command(cmdPatchAnnotationsText, "Merge annotations into a pod cluster's existing annotations. Keys set to null are removed.")
+
+	// these flags identify the pod cluster to update
+	patchAnnotationsPodID = cmdPatchAnnotations.Flag("pod", "The pod ID on the pod cluster that should be updated.").String()
+	patchAnnotationsAZ    = cmdPatchAnnotations.Flag("az", "The availability zone of the pod cluster that should be updated").String()
+	patchAnnotationsName  = cmdPatchAnnotations.Flag("name", "The cluster name (ie. staging, production) for the pod cluster that should be updated.").String()
+	patchAnnotationsID    = cmdPatchAnnotations.Flag("id", "The UUID of the pod cluster that should be updated. This option is mutually exclusive with pod,az,name").String()
+
+	// this flag specifies the annotations to merge.
+	patchAnnotations = cmdPatchAnnotations.Flag("annotations", "JSON string representing the annotations that should be merged into the pod cluster's annotations. Keys with a null value are removed.").Required().String()
+
+	// this flag makes the patch conditional on the pod cluster not having changed
+	patchAnnotationsIndex = cmdPatchAnnotations.Flag("modify-index", "If set, the patch is only applied if the pod cluster's ModifyIndex matches this value").Uint64()
+)
+
+// "status" command and flags
+var (
+	cmdStatus   = kingpin.Command(cmdStatusText, "Show the observed status of a pod cluster as recorded by p2-pc-status. ")
+	statusPodID = cmdStatus.Flag("pod", "The pod ID on the pod cluster").String()
+	statusAZ    = cmdStatus.Flag("az", "The availability zone of the pod cluster").String()
+	statusName  = cmdStatus.Flag("name", "The cluster name (ie. staging, production)").String()
+	statusID    = cmdStatus.Flag("id", "The cluster UUID. This option is mutually exclusive with pod,az,name").String()
+)
+
 // "update-selector" command and flags
 var (
 	cmdUpdateSelector = kingpin.Command(cmdUpdateSelectorText, "Update a pod cluster's pod selector. A diff of pod cluster membership and a confirmation prompt will be shown before submitting the update")
@@ -93,6 +130,49 @@ var (
 	cmdList = kingpin.Command(cmdListText, "Lists pod clusters. ")
 )
 
+// "members" command and flags
+var (
+	cmdMembers   = kingpin.Command(cmdMembersText, "Show the pods matched by a pod cluster's pod selector. ")
+	membersPodID = cmdMembers.Flag("pod", "The pod ID on the pod cluster").String()
+	membersAZ    = cmdMembers.Flag("az", "The availability zone of the pod cluster").String()
+	membersName  = cmdMembers.Flag("name", "The cluster name (ie. staging, production)").String()
+	membersID    = cmdMembers.Flag("id", "The cluster UUID. This option is mutually exclusive with pod,az,name").String()
+)
+
+// "set-budget" command and flags
+var (
+	cmdSetBudget            = kingpin.Command(cmdSetBudgetText, "Set the disruption budget of a pod cluster, which limits how many of its pods rolling updates and replication controllers may remove while they are healthy")
+	setBudgetPodID          = cmdSetBudget.Flag("pod", "The pod ID on the pod cluster").String()
+	setBudgetAZ             = cmdSetBudget.Flag("az", "The availability zone of the pod cluster").String()
+	setBudgetName           = cmdSetBudget.Flag("name", "The cluster name (ie. staging, production)").String()
+	setBudgetID             = cmdSetBudget.Flag("id", "The cluster UUID. This option is mutually exclusive with pod,az,name").String()
+	setBudgetMinAvailable   = cmdSetBudget.Flag("min-available", "The least number of the pod cluster's pods that must stay healthy").Int()
+	setBudgetMaxUnavailable = cmdSetBudget.Flag("max-unavailable", "The most pods of the pod cluster that may be unhealthy or removed at once. Unset if negative").Default("-1").Int()
+)
+
+// "get-budget" command and flags
+var (
+	cmdGetBudget   = kingpin.Command(cmdGetBudgetText, "Show the disruption budget of a pod cluster. ")
+	getBudgetPodID = cmdGetBudget.Flag("pod", "The pod ID on the pod cluster").String()
+	getBudgetAZ    = cmdGetBudget.Flag("az", "The availability zone of the pod cluster").String()
+	getBudgetName  = cmdGetBudget.Flag("name", "The cluster name (ie. staging, production)").String()
+	getBudgetID    = cmdGetBudget.Flag("id", "The cluster UUID. This option is mutually exclusive with pod,az,name").String()
+)
+
+// "delete-budget" command and flags
+var (
+	cmdDeleteBudget   = kingpin.Command(cmdDeleteBudgetText, "Delete the disruption budget of a pod cluster. ")
+	deleteBudgetPodID = cmdDeleteBudget.Flag("pod", "The pod ID on the pod cluster").String()
+	deleteBudgetAZ    = cmdDeleteBudget.Flag("az", "The availability zone of the pod cluster").String()
+	deleteBudgetName  = cmdDeleteBudget.Flag("name", "The cluster name (ie. staging, production)").String()
+	deleteBudgetID    = cmdDeleteBudget.Flag("id", "The cluster UUID. This option is mutually exclusive with pod,az,name").String()
+)
+
+// "list-budgets" command
+var (
+	cmdListBudgets = kingpin.Command(cmdListBudgetsText, "Lists disruption budgets. ")
+)
+
 func main() {
 	cmd, consulOpts, labeler := flags.ParseWithConsulOptions()
 	client := consul.NewConsulClient(consulOpts)
@@ -100,6 +180,7 @@ func main() {
 	logger := logging.NewLogger(logrus.Fields{})
 	applicator := labels.NewConsulApplicator(client, 0)
 	pcstore := pcstore.NewConsul(client, labeler, labels.DefaultAggregationRate, applicator, &logger)
+	budgets := budgetstore.NewConsul(client)
 
 	switch cmd {
 	case cmdCreateText:
@@ -208,6 +289,43 @@ func main() {
 			os.Exit(1)
 		}
 		fmt.Printf("%s", bytes)
+	case cmdPatchAnnotationsText:
+		az := fields.AvailabilityZone(*patchAnnotationsAZ)
+		cn := fields.ClusterName(*patchAnnotationsName)
+		podID := types.PodID(*patchAnnotationsPodID)
+		pcID := fields.ID(*patchAnnotationsID)
+
+		var pccontrol *control.PodCluster
+		if pcID != "" {
+			pccontrol = control.NewPodClusterFromID(pcID, pcstore)
+		} else if az != "" && cn != "" && podID != "" {
+			selector := defaultSelector(az, cn, podID)
+			pccontrol = control.NewPodCluster(az, cn, podID, pcstore, selector)
+		} else {
+			log.Fatalf("Expected one of: pcID or (pod,az,name)")
+		}
+
+		var annotations fields.Annotations
+		err := json.Unmarshal([]byte(*patchAnnotations), &annotations)
+		if err != nil {
+			_, _ = os.Stderr.Write([]byte(fmt.Sprintf("Annotations are invalid JSON. Err follows:\n%v", err)))
+			os.Exit(1)
+		}
+
+		var pc fields.PodCluster
+		if *patchAnnotationsIndex != 0 {
+			pc, err = pccontrol.PatchAnnotationsCAS(annotations, *patchAnnotationsIndex)
+		} else {
+			pc, err = pccontrol.PatchAnnotations(annotations)
+		}
+		if err != nil {
+			log.Fatalf("Error during PodCluster update: %v\n%v", err, pc)
+		}
+		bytes, err := json.Marshal(pc)
+		if err != nil {
+			log.Fatalf("Update succeeded, but error during displaying PC: %v\n%+v", err, pc)
+		}
+		fmt.Printf("%s", bytes)
 	case cmdUpdateSelectorText:
 		az := fields.AvailabilityZone(*updateSelectorAZ)
 		cn := fields.ClusterName(*updateSelectorName)
@@ -274,16 +392,136 @@ func main() {
 			os.Exit(1)
 		}
 		fmt.Printf("%s", bytes)
+	case cmdMembersText:
+		az := fields.AvailabilityZone(*membersAZ)
+		cn := fields.ClusterName(*membersName)
+		podID := types.PodID(*membersPodID)
+		pcID := fields.ID(*membersID)
+
+		var pccontrol *control.PodCluster
+		if pcID != "" {
+			pccontrol = control.NewPodClusterFromID(pcID, pcstore)
+		} else if az != "" && cn != "" && podID != "" {
+			selector := defaultSelector(az, cn, podID)
+			pccontrol = control.NewPodCluster(az, cn, podID, pcstore, selector)
+		} else {
+			log.Fatalf("Expected one of: pcID or (pod,az,name)")
+		}
+
+		members, err := pccontrol.Members(applicator)
+		if err != nil {
+			log.Fatalf("Caught error while fetching pod cluster members: %v", err)
+		}
+
+		bytes, err := json.Marshal(members)
+		if err != nil {
+			logger.WithError(err).Fatalln("Unable to marshal members as JSON")
+		}
+		fmt.Printf("%s", bytes)
+	case cmdStatusText:
+		az := fields.AvailabilityZone(*statusAZ)
+		cn := fields.ClusterName(*statusName)
+		podID := types.PodID(*statusPodID)
+		pcID := fields.ID(*statusID)
+
+		var pccontrol *control.PodCluster
+		if pcID != "" {
+			pccontrol = control.NewPodClusterFromID(pcID, pcstore)
+		} else if az != "" && cn != "" && podID != "" {
+			selector := defaultSelector(az, cn, podID)
+			pccontrol = control.NewPodCluster(az, cn, podID, pcstore, selector)
+		} else {
+			log.Fatalf("Expected one of: pcID or (pod,az,name)")
+		}
+
+		pc, err := pccontrol.Get()
+		if err != nil {
+			log.Fatalf("Caught error while fetching pod cluster: %v", err)
+		}
+
+		statusStore := pcstatus.NewConsul(statusstore.NewConsul(client), pcstatus.StatusControllerNamespace)
+		status, _, err := statusStore.Get(pc.ID)
+		if err != nil {
+			log.Fatalf("Caught error while fetching pod cluster status: %v", err)
+		}
+
+		bytes, err := json.Marshal(status)
+		if err != nil {
+			logger.WithError(err).Fatalln("Unable to marshal status as JSON")
+		}
+		fmt.Printf("%s", bytes)
+	case cmdSetBudgetText:
+		pc := getPodCluster(fields.ID(*setBudgetID), types.PodID(*setBudgetPodID), fields.AvailabilityZone(*setBudgetAZ), fields.ClusterName(*setBudgetName), pcstore)
+
+		budget := disruption_fields.Budget{
+			PodSelector:  pc.PodSelector.String(),
+			MinAvailable: *setBudgetMinAvailable,
+		}
+		if *setBudgetMaxUnavailable >= 0 {
+			budget.MaxUnavailable = setBudgetMaxUnavailable
+		}
+		err := budgets.Set(budget)
+		if err != nil {
+			log.Fatalf("Could not set disruption budget: %s", err)
+		}
+	case cmdGetBudgetText:
+		pc := getPodCluster(fields.ID(*getBudgetID), types.PodID(*getBudgetPodID), fields.AvailabilityZone(*getBudgetAZ), fields.ClusterName(*getBudgetName), pcstore)
+
+		budget, err := budgets.Get(pc.PodSelector.String())
+		if err != nil {
+			log.Fatalf("Caught error while fetching disruption budget: %v", err)
+		}
+		bytes, err := json.Marshal(budget)
+		if err != nil {
+			logger.WithError(err).Fatalln("Unable to marshal disruption budget as JSON")
+		}
+		fmt.Printf("%s", bytes)
+	case cmdDeleteBudgetText:
+		pc := getPodCluster(fields.ID(*deleteBudgetID), types.PodID(*deleteBudgetPodID), fields.AvailabilityZone(*deleteBudgetAZ), fields.ClusterName(*deleteBudgetName), pcstore)
+
+		err := budgets.Delete(pc.PodSelector.String())
+		if err != nil {
+			log.Fatalf("Could not delete disruption budget: %s", err)
+		}
+	case cmdListBudgetsText:
+		listed, err := budgets.List()
+		if err != nil {
+			log.Fatalf("Could not list disruption budgets: %s", err)
+		}
+		bytes, err := json.Marshal(listed)
+		if err != nil {
+			logger.WithError(err).Fatalln("Unable to marshal disruption budgets as JSON")
+		}
+		fmt.Printf("%s", bytes)
 	default:
 		log.Fatalf("Unrecognized command %v", cmd)
 	}
 }
 
+// getPodCluster returns the pod cluster with the ID, or else with the pod ID,
+// availability zone and cluster name. Disruption budgets are keyed by the pod
+// cluster's pod selector, so a budget has to be set again after the selector
+// is updated.
+func getPodCluster(pcID fields.ID, podID types.PodID, az fields.AvailabilityZone, cn fields.ClusterName, store control.PodClusterStore) fields.PodCluster {
+	var pccontrol *control.PodCluster
+	if pcID != "" {
+		pccontrol = control.NewPodClusterFromID(pcID, store)
+	} else if az != "" && cn != "" && podID != "" {
+		selector := defaultSelector(az, cn, podID)
+		pccontrol = control.NewPodCluster(az, cn, podID, store, selector)
+	} else {
+		log.Fatalf("Expected one of: pcID or (pod,az,name)")
+	}
+
+	pc, err := pccontrol.Get()
+	if err != nil {
+		log.Fatalf("Caught error while fetching pod cluster: %v", err)
+	}
+	return pc
+}
+
 func defaultSelector(az fields.AvailabilityZone, cn fields.ClusterName, podID types.PodID) klabels.Selector {
-	return klabels.Everything().
-		Add(fields.PodIDLabel, klabels.EqualsOperator, []string{podID.String()}).
-		Add(fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{az.String()}).
-		Add(fields.ClusterNameLabel, klabels.EqualsOperator, []string{cn.String()})
+	return control.DefaultPodSelector(az, cn, podID)
 }
 
 func currentUserName() string {
@@ -3,7 +3,6 @@ package main
 import (
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 
 	"github.com/Sirupsen/logrus"
@@ -16,6 +15,11 @@ import (
 	"github.com/square/p2/pkg/watch"
 )
 
+var (
+	selfCheck   = kingpin.Flag(preparer.SelfCheckFlag, "Check that the preparer can load its config, then exit").Bool()
+	observeOnly = kingpin.Flag("observe-only", "Log what would be installed, launched and halted without changing the node, as if observe_only were set in the config").Bool()
+)
+
 func main() {
 	// Other packages define flags, and they need parsing here.
 	kingpin.Parse()
@@ -25,25 +29,29 @@ func main() {
 	if configPath == "" {
 		logger.NoFields().Fatalln("No CONFIG_PATH variable was given")
 	}
-	preparerConfig, err := preparer.LoadConfig(configPath)
+	preparerConfig, err := preparer.LoadConfigWithKey(configPath)
 	if err != nil {
 		logger.WithError(err).Fatalln("could not load preparer config")
 	}
+	if *observeOnly {
+		preparerConfig.ObserveOnly = true
+	}
 	err = param.Parse(preparerConfig.Params)
 	if err != nil {
 		logger.WithError(err).Fatalln("invalid parameter")
 	}
-
-	statusServer, err := preparer.NewStatusServer(preparerConfig.StatusPort, preparerConfig.StatusSocket, &logger)
-	if err == preparer.NoServerConfigured {
-		logger.NoFields().Warningln("No status port or socket provided, no status server configured")
-	} else if err != nil {
-		logger.WithError(err).Fatalln("Could not start status server")
-	} else {
-		go statusServer.Serve()
-		defer statusServer.Close()
+	if *selfCheck {
+		logger.WithField("version", version.VERSION).Infoln("Self-check passed")
+		return
 	}
 
+	// The health monitor and the other long-running components run under
+	// a supervisor so that a panic or failure in one is restarted rather
+	// than taking down intent processing. There is no separate hook
+	// listener to supervise: hooks are installed from the hooks manifest of
+	// the config when the preparer starts and when its config is reloaded.
+	supervisor := preparer.NewSupervisor(logger, preparer.DefaultRestartDelay)
+
 	if preparerConfig.RequireFile != "" {
 		_, err := os.Stat(preparerConfig.RequireFile)
 		if os.IsNotExist(err) {
@@ -60,19 +68,53 @@ func main() {
 	}
 	defer prep.Close()
 
+	// A preparer exec'd by a self-update rolls back if it can't do its job
+	prep.SelfCheck()
+
+	statusServer, err := preparer.NewStatusServer(preparerConfig.StatusPort, preparerConfig.StatusSocket, supervisor, prep.Propagation, prep.Observations, &logger)
+	if err == preparer.NoServerConfigured {
+		logger.NoFields().Warningln("No status port or socket provided, no status server configured")
+	} else if err != nil {
+		logger.WithError(err).Fatalln("Could not start status server")
+	} else {
+		go statusServer.Serve()
+		defer statusServer.Close()
+	}
+
+	if preparerConfig.PodEventsSocket != "" && prep.PodEvents != nil {
+		podEventServer, err := preparer.NewPodEventServer(preparerConfig.PodEventsSocket, prep.PodEvents, &logger)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not start pod event server")
+		}
+		go podEventServer.Serve()
+		defer podEventServer.Close()
+	}
+
+	if preparerConfig.AdminSocket != "" || preparerConfig.AdminPort != 0 {
+		adminServer, err := preparer.NewAdminServer(preparerConfig, configPath, prep, &logger)
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not start admin server")
+		}
+		adminServer.Serve()
+		defer adminServer.Close()
+	}
+
 	logger.WithFields(logrus.Fields{
-		"starting":    true,
-		"node_name":   preparerConfig.NodeName,
-		"consul":      preparerConfig.ConsulAddress,
-		"hooks_dir":   preparerConfig.HooksDirectory,
-		"status_port": preparerConfig.StatusPort,
-		"auth_type":   preparerConfig.Auth["type"],
-		"keyring":     preparerConfig.Auth["keyring"],
-		"version":     version.VERSION,
+		"starting":     true,
+		"node_name":    preparerConfig.NodeName,
+		"consul":       preparerConfig.ConsulAddress,
+		"store":        preparerConfig.StoreBackend,
+		"namespace":    preparerConfig.Namespace,
+		"hooks_dir":    preparerConfig.HooksDirectory,
+		"status_port":  preparerConfig.StatusPort,
+		"auth_type":    preparerConfig.Auth["type"],
+		"keyring":      preparerConfig.Auth["keyring"],
+		"version":      version.VERSION,
+		"observe_only": preparerConfig.ObserveOnly,
 	}).Infoln("Preparer started successfully")
 
 	quitMainUpdate := make(chan struct{})
-	var quitChans []chan struct{}
+	quitPodProcessReporter := make(chan struct{})
 
 	// Install the latest hooks before any pods are processed
 	err = prep.InstallHooks()
@@ -82,39 +124,78 @@ func main() {
 	go prep.WatchForPodManifestsForNode(quitMainUpdate)
 
 	if prep.PodProcessReporter != nil {
-		quitPodProcessReporter := make(chan struct{})
-		quitChans = append(quitChans, quitPodProcessReporter)
-		go prep.PodProcessReporter.Run(quitPodProcessReporter)
+		err = prep.PodProcessReporter.Init()
+		if err != nil {
+			logger.WithError(err).Errorln("Could not start pod process reporter")
+		} else {
+			defer prep.PodProcessReporter.Close()
+			supervisor.Supervise("pod_process_reporter", quitPodProcessReporter, prep.PodProcessReporter.Loop)
+		}
+	}
+
+	quitNodeLabels := make(chan struct{})
+	if prep.NodeLabels != nil {
+		supervisor.Supervise("node_labels", quitNodeLabels, prep.NodeLabels.Run)
+	}
+
+	quitCloudLabels := make(chan struct{})
+	if prep.CloudLabels != nil {
+		supervisor.Supervise("cloud_labels", quitCloudLabels, prep.CloudLabels.Run)
 	}
 
+	quitTermination := make(chan struct{})
+	if prep.Termination != nil {
+		supervisor.Supervise("termination_notices", quitTermination, prep.Termination.Run)
+	}
+
+	quitHeartbeat := make(chan struct{})
+	supervisor.Supervise("heartbeat", quitHeartbeat, prep.Heartbeats.Run)
+
+	quitSecrets := make(chan struct{})
+	supervisor.Supervise("secrets_refresh", quitSecrets, prep.RunSecretsRefresh)
+
+	quitLogShipping := make(chan struct{})
+	supervisor.Supervise("log_shipping", quitLogShipping, prep.RunLogShipping)
+
+	quitGC := make(chan struct{})
+	supervisor.Supervise("artifact_gc", quitGC, prep.RunGC)
+
+	quitConfigReload := make(chan struct{})
+	supervisor.Supervise("config_reload", quitConfigReload, func(quit <-chan struct{}) {
+		prep.ReloadConfigOnChange(configPath, quit)
+	})
+
 	// Launch health checking watch. This watch tracks health of
 	// all pods on this host and writes the information to consul
 	quitMonitorPodHealth := make(chan struct{})
-	var wgHealth sync.WaitGroup
-	wgHealth.Add(1)
-	go func() {
-		defer wgHealth.Done()
-		watch.MonitorPodHealth(preparerConfig, &logger, quitMonitorPodHealth)
-	}()
+	supervisor.SuperviseWithError("health_monitor", quitMonitorPodHealth, func(quit <-chan struct{}) error {
+		return watch.MonitorPodHealth(preparerConfig, prep.Propagation, prep.NodeLabels, prep.Termination, &logger, quit)
+	})
 
-	waitForTermination(logger, quitMainUpdate, quitChans)
+	waitForTermination(logger, quitMainUpdate, quitPodProcessReporter)
 
 	// The preparer should continue to report app health during a shutdown, so terminate
 	// the health monitor last.
 	close(quitMonitorPodHealth)
-	wgHealth.Wait()
+	close(quitNodeLabels)
+	close(quitCloudLabels)
+	close(quitTermination)
+	close(quitHeartbeat)
+	close(quitSecrets)
+	close(quitLogShipping)
+	close(quitGC)
+	close(quitConfigReload)
+	supervisor.Wait()
 
 	logger.NoFields().Infoln("Terminating")
 }
 
-func waitForTermination(logger logging.Logger, quitMainUpdate chan struct{}, quitChans []chan struct{}) {
+func waitForTermination(logger logging.Logger, quitMainUpdate chan struct{}, quitPodProcessReporter chan struct{}) {
 	signalCh := make(chan os.Signal, 2)
 	signal.Notify(signalCh, syscall.SIGTERM, os.Interrupt)
 	received := <-signalCh
 	logger.WithField("signal", received.String()).Infoln("Stopping work")
-	for _, quitCh := range quitChans {
-		quitCh <- struct{}{}
-	}
+	close(quitPodProcessReporter)
 	quitMainUpdate <- struct{}{}
 	<-quitMainUpdate // acknowledgement
 }
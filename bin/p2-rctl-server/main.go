@@ -1,5 +1,5 @@
-// p2-rctl-server contains the server code for running Farms for resource controllers and
-// rolling updates.
+// p2-rctl-server contains the server code for running Farms for resource controllers,
+// rolling updates and autoscaling.
 package main
 
 import (
@@ -15,6 +15,9 @@ import (
 	klabels "k8s.io/kubernetes/pkg/labels"
 
 	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/autoscale"
+	"github.com/square/p2/pkg/disruption"
+	"github.com/square/p2/pkg/freeze"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/rc"
@@ -22,8 +25,11 @@ import (
 	"github.com/square/p2/pkg/scheduler"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/autoscalestore"
+	"github.com/square/p2/pkg/store/consul/budgetstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/freezestore"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/rollstore"
 	"github.com/square/p2/pkg/util/stream"
@@ -34,6 +40,8 @@ import (
 var (
 	logLevel            = kingpin.Flag("log", "Logging level to display").String()
 	pagerdutyServiceKey = kingpin.Flag("pagerduty-service-key", "Pagerduty Service Key to use for alerting if provided").String()
+	autoscaleInterval   = kingpin.Flag("autoscale-interval", "How often to apply the autoscaling policy of each replication controller").Default(autoscale.DefaultInterval.String()).Duration()
+	auditChain          = kingpin.Flag("audit-chain", "Also record the replication controllers' mutations to the tamper-evident audit chain").Bool()
 )
 
 // RetryCount defines the number of retries to attempt when accessing some storage
@@ -77,6 +85,7 @@ func main() {
 	rollStore := rollstore.NewConsul(client, labeler, nil)
 	healthChecker := checker.NewConsulHealthChecker(client)
 	sched := scheduler.NewApplicatorScheduler(labeler)
+	budgets := disruption.NewEnforcer(budgetstore.NewConsul(client), labeler, healthChecker)
 
 	// Start acquiring sessions
 	sessions := make(chan string)
@@ -100,11 +109,15 @@ func main() {
 	}
 
 	auditLogStore := auditlogstore.NewConsulStore(client.KV())
+	var rcAuditLogStore rc.AuditLogStore = auditLogStore
+	if *auditChain {
+		rcAuditLogStore = auditlogstore.NewChainingStore(auditLogStore, auditlogstore.NewChainStore(client.KV()))
+	}
 
 	// Run the farms!
 	go rc.NewFarm(
 		consulStore,
-		auditLogStore,
+		rcAuditLogStore,
 		rcStore,
 		rcStore,
 		rcStore,
@@ -116,6 +129,19 @@ func main() {
 		klabels.Everything(),
 		alerter,
 		1*time.Second,
+		budgets,
+	).Start(nil)
+	go autoscale.NewFarm(
+		consulStore,
+		autoscalestore.NewConsul(client),
+		rcStore,
+		rollStore,
+		labeler,
+		healthChecker,
+		pub.Subscribe().Chan(),
+		logger,
+		klabels.Everything(),
+		*autoscaleInterval,
 	).Start(nil)
 	roll.NewFarm(
 		roll.UpdateFactory{
@@ -123,6 +149,9 @@ func main() {
 			RCStore:       rcStore,
 			HealthChecker: healthChecker,
 			Labeler:       labeler,
+			Controls:      rollStore,
+			Budgets:       budgets,
+			Freezes:       freeze.NewChecker(freezestore.NewConsul(client)),
 		},
 		consulStore,
 		rollStore,
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,8 +18,12 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 	klabels "k8s.io/kubernetes/pkg/labels"
 
+	"github.com/square/p2/pkg/admission"
 	"github.com/square/p2/pkg/alerting"
+	autoscale_fields "github.com/square/p2/pkg/autoscale/fields"
 	"github.com/square/p2/pkg/cli"
+	"github.com/square/p2/pkg/disruption"
+	"github.com/square/p2/pkg/freeze"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
@@ -29,11 +35,15 @@ import (
 	"github.com/square/p2/pkg/roll"
 	roll_fields "github.com/square/p2/pkg/roll/fields"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/autoscalestore"
+	"github.com/square/p2/pkg/store/consul/budgetstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/store/consul/freezestore"
 	"github.com/square/p2/pkg/store/consul/rcstore"
 	"github.com/square/p2/pkg/store/consul/rollstore"
 	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/version"
 )
 
@@ -48,7 +58,19 @@ const (
 	cmdRollText           = "rolling-update"
 	cmdDeleteRollText     = "delete-rolling-update"
 	cmdSchedupText        = "schedule-update"
+	cmdConfirmCanaryText  = "confirm-canary"
+	cmdPauseRollText      = "pause-update"
+	cmdResumeRollText     = "resume-update"
+	cmdAbortRollText      = "abort-update"
 	cmdUpdateManifestText = "update-manifest"
+	cmdSetStrategyText    = "set-strategy"
+	cmdHistoryText        = "history"
+	cmdGetRevisionText    = "get-revision"
+	cmdDiffRevisionsText  = "diff-revisions"
+	cmdRestoreText        = "restore-revision"
+	cmdSetAutoscaleText   = "set-autoscale"
+	cmdGetAutoscaleText   = "get-autoscale"
+	cmdStopAutoscaleText  = "stop-autoscale"
 )
 
 var (
@@ -57,6 +79,7 @@ var (
 
 	cmdCreate              = kingpin.Command(cmdCreateText, "Create a new replication controller")
 	createManifest         = cmdCreate.Flag("manifest", "manifest file to use for this replication controller").Short('m').Required().String()
+	createAdmission        = cmdCreate.Flag("admission-config", "A YAML file of admission checks that the manifest must pass before the replication controller is created. Its schema is always checked.").String()
 	createNodeSel          = cmdCreate.Flag("node-selector", "node selector that this replication controller should target").Short('n').Required().String()
 	createPodLabels        = cmdCreate.Flag("pod-label", "a pod label, in LABEL=VALUE form, to add to this replication controller. Can be specified multiple times.").Short('p').StringMap()
 	createRCLabels         = cmdCreate.Flag("rc-label", "an RC label, in LABEL=VALUE form, to be applied to this replication controller. Can be specified multiple times.").Short('r').StringMap()
@@ -85,24 +108,88 @@ var (
 	cmdDisable = kingpin.Command(cmdDisableText, "Disable replication controller")
 	disableID  = cmdDisable.Arg("id", "replication controller uuid to disable").Required().String()
 
-	cmdRoll   = kingpin.Command(cmdRollText, "Rolling update from one replication controller to another")
-	rollOldID = cmdRoll.Flag("old", "old replication controller uuid").Required().Short('o').String()
-	rollNewID = cmdRoll.Flag("new", "new replication controller uuid").Required().Short('n').String()
-	rollWant  = cmdRoll.Flag("desired", "number of replicas desired").Required().Short('d').Int()
-	rollNeed  = cmdRoll.Flag("minimum", "minimum number of healthy replicas during update").Required().Short('m').Int()
+	cmdRoll        = kingpin.Command(cmdRollText, "Rolling update from one replication controller to another")
+	rollOldID      = cmdRoll.Flag("old", "old replication controller uuid").Required().Short('o').String()
+	rollNewID      = cmdRoll.Flag("new", "new replication controller uuid").Required().Short('n').String()
+	rollWant       = cmdRoll.Flag("desired", "number of replicas desired").Required().Short('d').Int()
+	rollNeed       = cmdRoll.Flag("minimum", "minimum number of healthy replicas during update").Required().Short('m').Int()
+	rollMinHealthy = cmdRoll.Flag("min-healthy-duration", "how long a new node must stay healthy before it counts as updated. Defaults to the value in the new RC's manifest").Duration()
+	rollPacing     = pacingFlags(cmdRoll)
+	rollRollback   = autoRollbackFlags(cmdRoll)
+	rollEmergency  = cmdRoll.Flag("emergency", "proceed even while the new RC's pods are frozen").Bool()
 
 	cmdDeleteRoll = kingpin.Command(cmdDeleteRollText, "Delete a rolling update.")
 	deleteRollID  = cmdDeleteRoll.Flag("id", "rolling update uuid").Required().Short('i').String()
 
-	cmdSchedup   = kingpin.Command(cmdSchedupText, "Schedule new rolling update (will be run by farm)")
-	schedupOldID = cmdSchedup.Flag("old", "old replication controller uuid").Required().Short('o').String()
-	schedupNewID = cmdSchedup.Flag("new", "new replication controller uuid").Required().Short('n').String()
-	schedupWant  = cmdSchedup.Flag("desired", "number of replicas desired").Required().Short('d').Int()
-	schedupNeed  = cmdSchedup.Flag("minimum", "minimum number of healthy replicas during update").Required().Short('m').Int()
+	cmdSchedup        = kingpin.Command(cmdSchedupText, "Schedule new rolling update (will be run by farm)")
+	schedupOldID      = cmdSchedup.Flag("old", "old replication controller uuid").Required().Short('o').String()
+	schedupNewID      = cmdSchedup.Flag("new", "new replication controller uuid").Required().Short('n').String()
+	schedupWant       = cmdSchedup.Flag("desired", "number of replicas desired").Required().Short('d').Int()
+	schedupNeed       = cmdSchedup.Flag("minimum", "minimum number of healthy replicas during update").Required().Short('m').Int()
+	schedupMinHealthy = cmdSchedup.Flag("min-healthy-duration", "how long a new node must stay healthy before it counts as updated. Defaults to the value in the new RC's manifest").Duration()
+	schedupPacing     = pacingFlags(cmdSchedup)
+	schedupRollback   = autoRollbackFlags(cmdSchedup)
+	schedupCanary     = cmdSchedup.Flag("canary", "number of nodes to update first, before holding the update until they have soaked").Int()
+	schedupSoak       = cmdSchedup.Flag("canary-soak", "how long the canary nodes must stay healthy before the update continues").Duration()
+	schedupMetricURL  = cmdSchedup.Flag("canary-metric-url", "a URL that must keep returning a 2xx response while the canary soaks").String()
+	schedupConfirm    = cmdSchedup.Flag("canary-confirm", "hold the update after the canary soaks until it is confirmed with confirm-canary").Bool()
+	schedupEmergency  = cmdSchedup.Flag("emergency", "proceed even while the new RC's pods are frozen").Bool()
+
+	cmdConfirmCanary = kingpin.Command(cmdConfirmCanaryText, "Confirm that a scheduled rolling update may proceed past its canary")
+	confirmCanaryID  = cmdConfirmCanary.Flag("id", "rolling update uuid").Required().Short('i').String()
+
+	cmdPauseRoll = kingpin.Command(cmdPauseRollText, "Pause a scheduled rolling update before its next batch of nodes")
+	pauseRollID  = cmdPauseRoll.Flag("id", "rolling update uuid").Required().Short('i').String()
+
+	cmdResumeRoll = kingpin.Command(cmdResumeRollText, "Resume a paused rolling update")
+	resumeRollID  = cmdResumeRoll.Flag("id", "rolling update uuid").Required().Short('i').String()
+
+	cmdAbortRoll = kingpin.Command(cmdAbortRollText, "Abort a scheduled rolling update, moving the nodes it updated back to the old replication controller")
+	abortRollID  = cmdAbortRoll.Flag("id", "rolling update uuid").Required().Short('i').String()
 
 	cmdUpdateManifest  = kingpin.Command(cmdUpdateManifestText, "DANGEROUS. Forcefully update the manifest for the given RC. Consider disabling the RC before invoking this command.")
 	updateManifestRCID = cmdUpdateManifest.Arg("id", "replication controller uuid to update").Required().String()
 	updateManifestPath = cmdUpdateManifest.Arg("manifest-path", "Path to a signed manifest").Required().String()
+
+	cmdSetStrategy   = kingpin.Command(cmdSetStrategyText, "Set how a replication controller picks the nodes it schedules on")
+	setStrategyID    = cmdSetStrategy.Arg("id", "replication controller uuid to modify").Required().String()
+	setStrategyType  = cmdSetStrategy.Arg("strategy", "one of spread, pack or random. Omit to schedule on nodes in order of their names").Default("").Enum("", fields.SpreadStrategy, fields.PackStrategy, fields.RandomStrategy)
+	setStrategyLabel = cmdSetStrategy.Flag("label", "the node label whose values are the failure domains to spread or pack replicas across, e.g. rack").Short('l').String()
+
+	cmdHistory = kingpin.Command(cmdHistoryText, "List the recorded revisions of a replication controller and what changed in each")
+	historyID  = cmdHistory.Arg("id", "replication controller uuid").Required().String()
+
+	cmdGetRevision      = kingpin.Command(cmdGetRevisionText, "Get a replication controller as it was at one of its revisions")
+	getRevisionID       = cmdGetRevision.Arg("id", "replication controller uuid").Required().String()
+	getRevisionNumber   = cmdGetRevision.Arg("revision", "revision number, as listed by history").Required().Int()
+	getRevisionManifest = cmdGetRevision.Flag("manifest", "print just the manifest of the revision").Short('m').Bool()
+
+	cmdDiffRevisions = kingpin.Command(cmdDiffRevisionsText, "Show what changed in a replication controller between two of its revisions")
+	diffRevisionsID  = cmdDiffRevisions.Arg("id", "replication controller uuid").Required().String()
+	diffRevisionsOld = cmdDiffRevisions.Arg("from", "revision number to compare from").Required().Int()
+	diffRevisionsNew = cmdDiffRevisions.Arg("to", "revision number to compare to. Omit to compare to the replication controller as it is now").Int()
+
+	cmdRestore      = kingpin.Command(cmdRestoreText, "DANGEROUS. Set the manifest, node selector, pod labels, replica count and strategy of a replication controller back to those of one of its revisions.")
+	restoreID       = cmdRestore.Arg("id", "replication controller uuid").Required().String()
+	restoreRevision = cmdRestore.Arg("revision", "revision number to restore").Required().Int()
+	restoreYes      = cmdRestore.Flag("yes", "auto confirm the restore (i.e. no confirmation prompt)").Short('y').Bool()
+
+	cmdSetAutoscale            = kingpin.Command(cmdSetAutoscaleText, "Set the policy that the autoscaler adjusts the replica count of a replication controller with")
+	setAutoscaleID             = cmdSetAutoscale.Arg("id", "replication controller uuid to autoscale").Required().String()
+	setAutoscaleMin            = cmdSetAutoscale.Flag("min", "the fewest replicas to scale to").Required().Int()
+	setAutoscaleMax            = cmdSetAutoscale.Flag("max", "the most replicas to scale to").Required().Int()
+	setAutoscaleUpCooldown     = cmdSetAutoscale.Flag("scale-up-cooldown", "the least time after the replica count changes before it may be increased").Duration()
+	setAutoscaleDownCooldown   = cmdSetAutoscale.Flag("scale-down-cooldown", "the least time after the replica count changes before it may be decreased").Duration()
+	setAutoscaleHealthyPercent = cmdSetAutoscale.Flag("healthy-percent", "add replicas until at least this percentage of them are healthy").Int()
+	setAutoscaleMetricURL      = cmdSetAutoscale.Flag("metric-url", "a URL returning a number for each pod, with "+autoscale_fields.NodePlaceholder+" replaced by the pod's node").String()
+	setAutoscaleMetricTarget   = cmdSetAutoscale.Flag("metric-target", "the average of the metric to scale towards").Float64()
+	setAutoscaleSchedule       = cmdSetAutoscale.Flag("schedule", "a period of each day, in HH:MM-HH:MM=REPLICAS form and UTC, with at least REPLICAS replicas. Can be specified multiple times.").Strings()
+
+	cmdGetAutoscale = kingpin.Command(cmdGetAutoscaleText, "Get the autoscaling policy of a replication controller")
+	getAutoscaleID  = cmdGetAutoscale.Arg("id", "replication controller uuid").Required().String()
+
+	cmdStopAutoscale = kingpin.Command(cmdStopAutoscaleText, "Stop autoscaling a replication controller, leaving its replica count as it is")
+	stopAutoscaleID  = cmdStopAutoscale.Arg("id", "replication controller uuid").Required().String()
 )
 
 func main() {
@@ -138,6 +225,7 @@ func main() {
 	// transactions, so this might be different from labeler returned by
 	// flags.ParseWithConsulOptions()
 	rollLabeler := labels.NewConsulApplicator(client, 0)
+	hcheck := checker.NewConsulHealthChecker(client)
 	rctl := rctlParams{
 		httpClient: httpClient,
 		baseClient: client,
@@ -148,9 +236,12 @@ func main() {
 		rollRCStore: rcStore,
 		rcLocker:    rcStore,
 		rls:         rollstore.NewConsul(client, rollLabeler, nil),
+		autoscales:  autoscalestore.NewConsul(client),
 		consuls:     consul.NewConsulStore(client),
 		labeler:     labeler,
-		hcheck:      checker.NewConsulHealthChecker(client),
+		hcheck:      hcheck,
+		budgets:     disruption.NewEnforcer(budgetstore.NewConsul(client), labeler, hcheck),
+		freezes:     freeze.NewChecker(freezestore.NewConsul(client)),
 		logger:      logger,
 	}
 
@@ -158,6 +249,7 @@ func main() {
 	case cmdCreateText:
 		rctl.Create(
 			*createManifest,
+			*createAdmission,
 			*createNodeSel,
 			pc_fields.AvailabilityZone(*createAvailabilityZone),
 			pc_fields.ClusterName(*createClusterName),
@@ -177,14 +269,142 @@ func main() {
 	case cmdDisableText:
 		rctl.Disable(*disableID)
 	case cmdRollText:
-		rctl.RollingUpdate(*rollOldID, *rollNewID, *rollWant, *rollNeed)
+		rctl.RollingUpdate(*rollOldID, *rollNewID, *rollWant, *rollNeed, *rollMinHealthy, rollPacing.pacing(), rollRollback.autoRollback(logger), *rollEmergency)
 	case cmdSchedupText:
-		rctl.ScheduleUpdate(*schedupOldID, *schedupNewID, *schedupWant, *schedupNeed, client.KV())
+		var canary *roll_fields.Canary
+		if *schedupCanary > 0 {
+			canary = &roll_fields.Canary{
+				Replicas:            *schedupCanary,
+				Soak:                *schedupSoak,
+				MetricURL:           *schedupMetricURL,
+				RequireConfirmation: *schedupConfirm,
+			}
+		}
+		rctl.ScheduleUpdate(*schedupOldID, *schedupNewID, *schedupWant, *schedupNeed, *schedupMinHealthy, schedupPacing.pacing(), canary, schedupRollback.autoRollback(logger), *schedupEmergency, client.KV())
+	case cmdConfirmCanaryText:
+		rctl.ConfirmCanary(*confirmCanaryID)
+	case cmdPauseRollText:
+		rctl.SetRollControl(*pauseRollID, roll_fields.ControlPause)
+	case cmdResumeRollText:
+		rctl.SetRollControl(*resumeRollID, roll_fields.ControlNone)
+	case cmdAbortRollText:
+		rctl.SetRollControl(*abortRollID, roll_fields.ControlAbort)
 	case cmdDeleteRollText:
 		rctl.DeleteRollingUpdate(*deleteRollID, client.KV())
 	case cmdUpdateManifestText:
 		rctl.UpdateManifest(fields.ID(*updateManifestRCID), *updateManifestPath)
+	case cmdSetStrategyText:
+		rctl.SetStrategy(fields.ID(*setStrategyID), fields.Strategy{Type: *setStrategyType, Label: *setStrategyLabel})
+	case cmdHistoryText:
+		rctl.History(fields.ID(*historyID))
+	case cmdGetRevisionText:
+		rctl.GetRevision(fields.ID(*getRevisionID), *getRevisionNumber, *getRevisionManifest)
+	case cmdDiffRevisionsText:
+		rctl.DiffRevisions(fields.ID(*diffRevisionsID), *diffRevisionsOld, *diffRevisionsNew)
+	case cmdRestoreText:
+		rctl.Restore(fields.ID(*restoreID), *restoreRevision)
+	case cmdSetAutoscaleText:
+		policy := autoscale_fields.Policy{
+			RCID:              fields.ID(*setAutoscaleID),
+			MinReplicas:       *setAutoscaleMin,
+			MaxReplicas:       *setAutoscaleMax,
+			ScaleUpCooldown:   *setAutoscaleUpCooldown,
+			ScaleDownCooldown: *setAutoscaleDownCooldown,
+		}
+		if *setAutoscaleHealthyPercent != 0 {
+			policy.Health = &autoscale_fields.HealthTarget{HealthyPercent: *setAutoscaleHealthyPercent}
+		}
+		if *setAutoscaleMetricURL != "" {
+			policy.Metric = &autoscale_fields.MetricTarget{URL: *setAutoscaleMetricURL, Target: *setAutoscaleMetricTarget}
+		}
+		for _, period := range *setAutoscaleSchedule {
+			scheduled, err := parseSchedule(period)
+			if err != nil {
+				logger.WithError(err).Fatalln("Could not parse schedule")
+			}
+			policy.Schedule = append(policy.Schedule, scheduled)
+		}
+		rctl.SetAutoscale(policy)
+	case cmdGetAutoscaleText:
+		rctl.GetAutoscale(fields.ID(*getAutoscaleID))
+	case cmdStopAutoscaleText:
+		rctl.StopAutoscale(fields.ID(*stopAutoscaleID))
+	}
+}
+
+// pacingFlagValues are the flags that set the Pacing of a rolling update
+type pacingFlagValues struct {
+	maxUnavailable *int
+	batchSize      *int
+	nodesPerMinute *int
+}
+
+func pacingFlags(cmd *kingpin.CmdClause) pacingFlagValues {
+	return pacingFlagValues{
+		maxUnavailable: cmd.Flag("max-unavailable", "the most of the desired replicas that may be unhealthy at once. Can only be stricter than --minimum").Int(),
+		batchSize:      cmd.Flag("batch-size", "the most nodes to update at once, waiting for each batch to become healthy before starting the next").Int(),
+		nodesPerMinute: cmd.Flag("nodes-per-minute", "the most nodes to update in any minute").Int(),
+	}
+}
+
+func (p pacingFlagValues) pacing() roll_fields.Pacing {
+	return roll_fields.Pacing{
+		MaxUnavailable: *p.maxUnavailable,
+		BatchSize:      *p.batchSize,
+		NodesPerMinute: *p.nodesPerMinute,
+	}
+}
+
+// autoRollbackFlagValues are the flags that set the AutoRollback of a rolling
+// update
+type autoRollbackFlagValues struct {
+	minHealthyFraction *float64
+	gracePeriod        *time.Duration
+}
+
+func autoRollbackFlags(cmd *kingpin.CmdClause) autoRollbackFlagValues {
+	return autoRollbackFlagValues{
+		minHealthyFraction: cmd.Flag("rollback-below", "abort the update and roll back to the old replication controller if fewer than this fraction (0-1) of the updated nodes are healthy").Float64(),
+		gracePeriod:        cmd.Flag("rollback-grace", "how long the updated nodes may be less healthy than --rollback-below before the update is rolled back").Duration(),
+	}
+}
+
+func (a autoRollbackFlagValues) autoRollback(logger logging.Logger) *roll_fields.AutoRollback {
+	if *a.minHealthyFraction == 0 {
+		return nil
+	}
+	if *a.minHealthyFraction < 0 || *a.minHealthyFraction > 1 {
+		logger.WithField("rollback_below", *a.minHealthyFraction).Fatalln("The fraction of healthy nodes to roll back below must be between 0 and 1")
+	}
+	return &roll_fields.AutoRollback{
+		MinHealthyFraction: *a.minHealthyFraction,
+		GracePeriod:        *a.gracePeriod,
+	}
+}
+
+// parseSchedule parses a period of the day in HH:MM-HH:MM=REPLICAS form
+func parseSchedule(period string) (autoscale_fields.ScheduledReplicas, error) {
+	times, replicas, ok := cut(period, "=")
+	if !ok {
+		return autoscale_fields.ScheduledReplicas{}, util.Errorf("%q is not in HH:MM-HH:MM=REPLICAS form", period)
+	}
+	start, end, ok := cut(times, "-")
+	if !ok {
+		return autoscale_fields.ScheduledReplicas{}, util.Errorf("%q is not in HH:MM-HH:MM=REPLICAS form", period)
+	}
+	n, err := strconv.Atoi(replicas)
+	if err != nil {
+		return autoscale_fields.ScheduledReplicas{}, util.Errorf("%q does not end with a number of replicas", period)
+	}
+	return autoscale_fields.ScheduledReplicas{Start: start, End: end, Replicas: n}, nil
+}
+
+func cut(s string, sep string) (string, string, bool) {
+	i := strings.Index(s, sep)
+	if i < 0 {
+		return s, "", false
 	}
+	return s[:i], s[i+len(sep):], true
 }
 
 // SessionName returns a node identifier for use when creating Consul sessions.
@@ -219,10 +439,23 @@ type ReplicationControllerStore interface {
 	Delete(id fields.ID, force bool) error
 	Get(id fields.ID) (fields.RC, error)
 	UpdateManifest(id fields.ID, man manifest.Manifest) error
+	SetStrategy(id fields.ID, strategy fields.Strategy) error
+	Revisions(id fields.ID) ([]rcstore.Revision, error)
+	GetRevision(id fields.ID, number int) (rcstore.Revision, error)
+	Restore(id fields.ID, number int) error
+}
+
+type AutoscaleStore interface {
+	Set(policy autoscale_fields.Policy) error
+	Get(id fields.ID) (autoscale_fields.Policy, error)
+	Delete(id fields.ID) error
 }
 
 type RollingUpdateStore interface {
+	roll.Controls
 	Delete(ctx context.Context, id roll_fields.ID) error
+	ConfirmCanary(id roll_fields.ID) error
+	SetControl(id roll_fields.ID, control roll_fields.Control) error
 	CreateRollingUpdateFromExistingRCs(ctx context.Context, u roll_fields.Update, newRCLabels klabels.Set, rollLabels klabels.Set) (roll_fields.Update, error)
 }
 
@@ -237,14 +470,18 @@ type rctlParams struct {
 	rcLocker    roll.ReplicationControllerLocker
 	rcWatcher   rc.ReplicationControllerWatcher
 	rls         RollingUpdateStore
+	autoscales  AutoscaleStore
 	labeler     labels.ApplicatorWithoutWatches
 	consuls     Store
 	hcheck      checker.ConsulHealthChecker
+	budgets     disruption.Enforcer
+	freezes     freeze.Checker
 	logger      logging.Logger
 }
 
 func (r rctlParams) Create(
 	manifestPath string,
+	admissionConfig string,
 	nodeSelector string,
 	availabilityZone pc_fields.AvailabilityZone,
 	clusterName pc_fields.ClusterName,
@@ -257,6 +494,14 @@ func (r rctlParams) Create(
 			"manifest": manifestPath,
 		}).Fatalln("Could not read pod manifest")
 	}
+	admitter, err := admission.FromFile(admissionConfig)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not configure admission checks")
+	}
+	err = admitter.Admit(manifest)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Pod manifest was not admitted")
+	}
 
 	nodeSel, err := klabels.Parse(nodeSelector)
 	if err != nil {
@@ -294,6 +539,29 @@ func (r rctlParams) DeleteRollingUpdate(id string, txner transaction.Txner) {
 	}
 }
 
+func (r rctlParams) ConfirmCanary(id string) {
+	err := r.rls.ConfirmCanary(roll_fields.ID(id))
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not confirm canary")
+	}
+	r.logger.WithField("id", id).Infoln("Confirmed canary, the update will continue")
+}
+
+func (r rctlParams) SetRollControl(id string, control roll_fields.Control) {
+	err := r.rls.SetControl(roll_fields.ID(id), control)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not set rolling update control")
+	}
+	switch control {
+	case roll_fields.ControlPause:
+		r.logger.WithField("id", id).Infoln("Paused rolling update, it will stop before its next batch of nodes")
+	case roll_fields.ControlAbort:
+		r.logger.WithField("id", id).Infoln("Aborted rolling update, its nodes will be moved back to the old replication controller")
+	default:
+		r.logger.WithField("id", id).Infoln("Resumed rolling update")
+	}
+}
+
 func (r rctlParams) SetReplicas(id string, replicas int) {
 	if replicas < 0 {
 		r.logger.NoFields().Fatalln("Cannot set negative replica count")
@@ -369,7 +637,7 @@ func (r rctlParams) Disable(id string) {
 	r.logger.WithField("id", id).Infoln("Disabled replication controller")
 }
 
-func (r rctlParams) RollingUpdate(oldID, newID string, want, need int) {
+func (r rctlParams) RollingUpdate(oldID, newID string, want, need int, minHealthyDuration time.Duration, pacing roll_fields.Pacing, autoRollback *roll_fields.AutoRollback, emergency bool) {
 	if want < need {
 		r.logger.WithFields(logrus.Fields{
 			"want": want,
@@ -397,10 +665,14 @@ func (r rctlParams) RollingUpdate(oldID, newID string, want, need int) {
 		watchDelay := 1 * time.Second
 		result <- roll.NewUpdate(
 			roll_fields.Update{
-				OldRC:           rc_fields.ID(oldID),
-				NewRC:           rc_fields.ID(newID),
-				DesiredReplicas: want,
-				MinimumReplicas: need,
+				OldRC:              rc_fields.ID(oldID),
+				NewRC:              rc_fields.ID(newID),
+				DesiredReplicas:    want,
+				MinimumReplicas:    need,
+				MinHealthyDuration: minHealthyDuration,
+				Pacing:             pacing,
+				AutoRollback:       autoRollback,
+				Emergency:          emergency,
 			},
 			r.consuls,
 			r.rcLocker,
@@ -411,6 +683,9 @@ func (r rctlParams) RollingUpdate(oldID, newID string, want, need int) {
 			session,
 			watchDelay,
 			alerting.NewNop(),
+			r.rls,
+			r.budgets,
+			r.freezes,
 		).Run(quit)
 		close(result)
 	}()
@@ -441,16 +716,27 @@ LOOP:
 	}
 }
 
-func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, txner transaction.Txner) {
+func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, minHealthyDuration time.Duration, pacing roll_fields.Pacing, canary *roll_fields.Canary, autoRollback *roll_fields.AutoRollback, emergency bool, txner transaction.Txner) {
+	if canary != nil && canary.Replicas >= want {
+		r.logger.WithFields(logrus.Fields{
+			"canary": canary.Replicas,
+			"want":   want,
+		}).Fatalln("Cannot run update with a canary of at least the desired replicas")
+	}
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
 	_, err := r.rls.CreateRollingUpdateFromExistingRCs(
 		ctx,
 		roll_fields.Update{
-			OldRC:           rc_fields.ID(oldID),
-			NewRC:           rc_fields.ID(newID),
-			DesiredReplicas: want,
-			MinimumReplicas: need,
+			OldRC:              rc_fields.ID(oldID),
+			NewRC:              rc_fields.ID(newID),
+			DesiredReplicas:    want,
+			MinimumReplicas:    need,
+			MinHealthyDuration: minHealthyDuration,
+			Pacing:             pacing,
+			Canary:             canary,
+			AutoRollback:       autoRollback,
+			Emergency:          emergency,
 		}, nil, nil)
 	if err != nil {
 		r.logger.WithError(err).Fatalln("Could not create rolling update")
@@ -464,6 +750,149 @@ func (r rctlParams) ScheduleUpdate(oldID, newID string, want, need int, txner tr
 	r.logger.WithField("id", newID).Infoln("Created new rolling update")
 }
 
+func (r rctlParams) SetStrategy(id fields.ID, strategy fields.Strategy) {
+	err := r.rcs.SetStrategy(id, strategy)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not set the strategy of the replication controller")
+	}
+	r.logger.WithFields(logrus.Fields{
+		"id":       id,
+		"strategy": strategy.Type,
+		"label":    strategy.Label,
+	}).Infoln("Set replication controller strategy")
+}
+
+func (r rctlParams) History(id fields.ID) {
+	revisions, err := r.rcs.Revisions(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not read the history of the replication controller")
+	}
+
+	var previous *rcstore.Revision
+	for i, revision := range revisions {
+		changes := []string{"created"}
+		if previous != nil {
+			changes, err = previous.RC.Diff(revision.RC)
+			if err != nil {
+				r.logger.WithError(err).Fatalln("Could not compare revisions")
+			}
+		} else if revision.Number != 1 {
+			// the revisions before this one were discarded
+			changes = []string{"(earlier revisions discarded)"}
+		}
+		if revision.Deleted {
+			changes = []string{"deleted"}
+		}
+		fmt.Printf("%d %s %s\n", revision.Number, revision.Time.Format(time.RFC3339), revision.Actor)
+		for _, change := range changes {
+			fmt.Printf("    %s\n", change)
+		}
+		previous = &revisions[i]
+	}
+}
+
+func (r rctlParams) GetRevision(id fields.ID, number int, manifest bool) {
+	revision, err := r.rcs.GetRevision(id, number)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get revision of the replication controller")
+	}
+
+	if manifest {
+		out, err := revision.RC.Manifest.Marshal()
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not marshal revision manifest")
+		}
+		fmt.Printf("%s", out)
+	} else {
+		out, err := json.MarshalIndent(revision, "", "    ")
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not marshal revision to JSON")
+		}
+		fmt.Printf("%s\n", out)
+	}
+}
+
+// DiffRevisions prints the changes from one revision of an RC to another, or
+// to the RC as it is now if to is 0
+func (r rctlParams) DiffRevisions(id fields.ID, from int, to int) {
+	fromRevision, err := r.rcs.GetRevision(id, from)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get revision of the replication controller")
+	}
+	var toRC fields.RC
+	if to == 0 {
+		toRC, err = r.rcs.Get(id)
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not get replication controller in Consul")
+		}
+	} else {
+		toRevision, err := r.rcs.GetRevision(id, to)
+		if err != nil {
+			r.logger.WithError(err).Fatalln("Could not get revision of the replication controller")
+		}
+		toRC = toRevision.RC
+	}
+
+	changes, err := fromRevision.RC.Diff(toRC)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not compare revisions")
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+}
+
+func (r rctlParams) Restore(id fields.ID, number int) {
+	fmt.Printf("restoring replication controller %s to revision %d\n", id, number)
+	if !*restoreYes && !cli.Confirm() {
+		r.logger.Fatal("user aborted")
+	}
+	err := r.rcs.Restore(id, number)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not restore the replication controller")
+	}
+	r.logger.WithFields(logrus.Fields{
+		"id":       id,
+		"revision": number,
+	}).Infoln("Restored replication controller")
+}
+
+func (r rctlParams) SetAutoscale(policy autoscale_fields.Policy) {
+	_, err := r.rcs.Get(policy.RCID)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get replication controller in Consul")
+	}
+	err = r.autoscales.Set(policy)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not set autoscaling policy")
+	}
+	r.logger.WithFields(logrus.Fields{
+		"id":  policy.RCID,
+		"min": policy.MinReplicas,
+		"max": policy.MaxReplicas,
+	}).Infoln("Set autoscaling policy of replication controller")
+}
+
+func (r rctlParams) GetAutoscale(id fields.ID) {
+	policy, err := r.autoscales.Get(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not get autoscaling policy")
+	}
+	out, err := json.MarshalIndent(policy, "", "    ")
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not marshal autoscaling policy to JSON")
+	}
+	fmt.Printf("%s\n", out)
+}
+
+func (r rctlParams) StopAutoscale(id fields.ID) {
+	err := r.autoscales.Delete(id)
+	if err != nil {
+		r.logger.WithError(err).Fatalln("Could not delete autoscaling policy")
+	}
+	r.logger.WithField("id", id).Infoln("Stopped autoscaling replication controller")
+}
+
 func (r rctlParams) UpdateManifest(id fields.ID, manifestPath string) {
 	man, err := manifest.FromPath(manifestPath)
 
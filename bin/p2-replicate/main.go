@@ -11,6 +11,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/square/p2/pkg/admission"
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/logging"
@@ -29,6 +30,7 @@ var (
 	threshold               = kingpin.Flag("threshold", "The minimum health level to treat as healthy. One of (in order) passing, warning, unknown, critical.").String()
 	overrideLock            = kingpin.Flag("override-lock", "Override any lock holders").Bool()
 	ignoreControllers       = kingpin.Flag("ignore-controllers", "Deploy even if there are controllers managing some of the hosts").Bool()
+	admissionConfig         = kingpin.Flag("admission-config", "A YAML file of admission checks that the manifest must pass before it is replicated. Its schema is always checked.").String()
 	concurrentRealityChecks = kingpin.Flag("concurrent-reality-checks", "The number of concurrent requests to check for reality state (this is one area where p2-replicate does not use long-lived watches)").Default(fmt.Sprintf("%v", replication.DefaultConcurrentReality)).Int()
 )
 
@@ -56,6 +58,14 @@ func main() {
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
+	admitter, err := admission.FromFile(*admissionConfig)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = admitter.Admit(manifest)
+	if err != nil {
+		log.Fatalf("Not replicating %s: %s", manifest.ID(), err)
+	}
 
 	logger := logging.NewLogger(logrus.Fields{
 		"pod": manifest.ID(),
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	nodeName = kingpin.Flag("node-name", "The name of this node (default: hostname)").String()
+	podDir   = kingpin.Flag("pod-dir", "The directory where the pod to be rolled back is located.").String()
+	sha      = kingpin.Flag("sha", "The SHA of the retained manifest to roll back to (default: the manifest launched before the current one)").String()
+	list     = kingpin.Flag("list", "List the retained manifests of the pod instead of rolling back").Bool()
+	podName  = kingpin.Arg("pod-name", fmt.Sprintf("The name of the pod to be rolled back. Looks in the default pod home '%s' for the pod", pods.DefaultPath)).String()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	kingpin.CommandLine.Help = `Roll back a pod on this node to a manifest it previously launched.
+
+The pod's current services are halted and the previous manifest is launched
+from its retained installs, without downloading its artifacts. The manifest is
+then written to the intent and reality stores for this node, so that the
+preparer does not reinstall the manifest that was rolled back.
+
+EXAMPLES
+
+$ p2-rollback mypod
+
+$ p2-rollback --list mypod
+
+$ p2-rollback --sha 4c4b6d... --pod-dir /custom/pod/home
+`
+	_, opts, _ := flags.ParseWithConsulOptions()
+
+	pods.Log.Logger.Formatter = &logrus.TextFormatter{
+		DisableTimestamp: false,
+		FullTimestamp:    true,
+		TimestampFormat:  "15:04:05.000",
+	}
+	logger := pods.Log
+
+	if *nodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.WithError(err).Fatal("Error getting node name")
+		}
+		*nodeName = hostname
+	}
+
+	if *podName == "" && *podDir == "" {
+		logger.NoFields().Fatalln("Must pass a pod name or pod home directory")
+	}
+
+	var path string
+	if *podName != "" {
+		path = filepath.Join(pods.DefaultPath, *podName)
+	} else {
+		path = *podDir
+	}
+
+	pod, err := pods.PodFromPodHome(types.NodeName(*nodeName), path)
+	if err != nil {
+		logger.NoFields().Fatalln(err)
+	}
+	logger = logger.SubLogger(logrus.Fields{"pod": pod.Id})
+
+	if *list {
+		history, err := pod.ManifestHistory()
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not read manifest history")
+		}
+		for _, retained := range history {
+			retainedSHA, err := retained.SHA()
+			if err != nil {
+				logger.WithError(err).Fatalln("Could not compute manifest SHA")
+			}
+			fmt.Println(retainedSHA)
+		}
+		return
+	}
+
+	if pod.UniqueKey() != "" {
+		logger.NoFields().Fatalln("Rolling back uuid pods is not supported")
+	}
+
+	var target manifest.Manifest
+	if *sha == "" {
+		target, err = pod.PreviousManifest()
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not find a manifest to roll back to")
+		}
+		*sha, err = target.SHA()
+		if err != nil {
+			logger.WithError(err).Fatalln("Could not compute manifest SHA")
+		}
+	}
+
+	logger.WithField("sha", *sha).Infoln("Rolling back pod")
+	ok, err := pod.RollbackTo(*sha)
+	if err != nil {
+		logger.WithError(err).Fatalln("Could not roll back pod")
+	} else if !ok {
+		logger.NoFields().Warningln("Some services did not come up - check output for details")
+	}
+
+	target, err = pod.CurrentManifest()
+	if err != nil {
+		logger.WithError(err).Fatalln("Could not read the rolled back manifest")
+	}
+	store := consul.NewConsulStore(consul.NewConsulClient(opts))
+	for _, tree := range []consul.PodPrefix{consul.INTENT_TREE, consul.REALITY_TREE} {
+		_, err = store.SetPod(tree, types.NodeName(*nodeName), target)
+		if err != nil {
+			logger.WithError(err).Fatalf("Rolled back pod but could not write it to the %s tree", tree)
+		}
+	}
+
+	logger.NoFields().Infoln("Rollback successful.")
+}
@@ -5,23 +5,35 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/square/p2/pkg/admission"
+	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/schedule"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/flags"
 	"github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/version"
 
 	"gopkg.in/alecthomas/kingpin.v2"
+	klabels "k8s.io/kubernetes/pkg/labels"
 )
 
 var (
-	manifestPath = kingpin.Arg("manifest", "a manifest file to schedule in the intent store").String()
-	nodeName     = kingpin.Flag("node", "The node to do the scheduling on. Uses the hostname by default.").String()
-	hookGlobal   = kingpin.Flag("hook", "Schedule as a global hook.").Bool()
-	uuidPod      = kingpin.Flag("uuid-pod", "Schedule the pod using the new UUID scheme").Bool()
+	manifestPath    = kingpin.Arg("manifest", "a manifest file to schedule in the intent store").String()
+	nodeName        = kingpin.Flag("node", "The node to do the scheduling on. Uses the hostname by default.").String()
+	hookGlobal      = kingpin.Flag("hook", "Schedule as a global hook.").Bool()
+	uuidPod         = kingpin.Flag("uuid-pod", "Schedule the pod using the new UUID scheme").Bool()
+	wait            = kingpin.Flag("wait", "Wait for the scheduled manifest to appear in the reality store before exiting").Bool()
+	waitTimeout     = kingpin.Flag("wait-timeout", "How long to wait for the pod to be launched when --wait is passed").Default("10m").Duration()
+	podLabels       = kingpin.Flag("label", "A label to set on the pod in the same transaction as its intent, as key=value. Can be repeated.").StringMap()
+	auditLog        = kingpin.Flag("audit", "Write an audit record of the schedule in the same transaction as the pod's intent").Bool()
+	admissionConfig = kingpin.Flag("admission-config", "A YAML file of admission checks that the manifest must pass before it is scheduled. Its schema is always checked.").String()
+	nodeSelector    = kingpin.Flag("node-selector", "Schedule on every node whose labels match this selector instead of a single node. Each node is scheduled in its own transaction and the outcome on each is reported.").String()
 )
 
 func main() {
@@ -31,6 +43,31 @@ func main() {
 	store := consul.NewConsulStore(client)
 	podStore := podstore.NewConsul(client.KV())
 
+	if *manifestPath == "" {
+		kingpin.Usage()
+		log.Fatalln("No manifest given")
+	}
+	podManifest, err := manifest.FromPath(*manifestPath)
+	if err != nil {
+		log.Fatalf("Could not read manifest at %s: %s\n", *manifestPath, err)
+	}
+	admitter, err := admission.FromFile(*admissionConfig)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = admitter.Admit(podManifest)
+	if err != nil {
+		log.Fatalf("Not scheduling %s: %s", *manifestPath, err)
+	}
+
+	if *nodeSelector != "" {
+		if *nodeName != "" || *uuidPod || *hookGlobal {
+			log.Fatalln("--node-selector is only supported for legacy, non-hook pods and can't be combined with --node")
+		}
+		scheduleOnSelector(client, store, podManifest)
+		return
+	}
+
 	if *nodeName == "" {
 		hostname, err := os.Hostname()
 		if err != nil {
@@ -39,14 +76,12 @@ func main() {
 		*nodeName = hostname
 	}
 
-	if *manifestPath == "" {
-		kingpin.Usage()
-		log.Fatalln("No manifest given")
+	if *wait && (*uuidPod || *hookGlobal) {
+		log.Fatalln("--wait is only supported for legacy, non-hook pods")
 	}
-
-	podManifest, err := manifest.FromPath(*manifestPath)
-	if err != nil {
-		log.Fatalf("Could not read manifest at %s: %s\n", *manifestPath, err)
+	transactional := len(*podLabels) > 0 || *auditLog
+	if transactional && (*uuidPod || *hookGlobal) {
+		log.Fatalln("--label and --audit are only supported for legacy, non-hook pods")
 	}
 
 	out := schedule.Output{
@@ -57,6 +92,22 @@ func main() {
 		if err != nil {
 			log.Fatalf("Could not schedule pod: %s", err)
 		}
+	} else if transactional {
+		var auditLogger consul.AuditLogger
+		if *auditLog {
+			auditLogger = auditlogstore.NewConsulStore(client.KV())
+		}
+		err = store.SchedulePod(
+			labels.NewConsulApplicator(client, 0),
+			auditLogger,
+			types.NodeName(*nodeName),
+			podManifest,
+			*podLabels,
+			labels.DefaultActor(),
+		)
+		if err != nil {
+			log.Fatalf("Could not schedule pod: %s", err)
+		}
 	} else {
 
 		// Legacy pod
@@ -70,6 +121,13 @@ func main() {
 		}
 	}
 
+	if *wait {
+		err = waitForReality(store, types.NodeName(*nodeName), podManifest.ID(), *waitTimeout)
+		if err != nil {
+			log.Fatalf("Scheduled manifest %s but %s", podManifest.ID(), err)
+		}
+	}
+
 	outBytes, err := json.Marshal(out)
 	if err != nil {
 		log.Fatalf("Successfully scheduled manifest but couldn't marshal JSON output")
@@ -77,3 +135,99 @@ func main() {
 
 	fmt.Println(string(outBytes))
 }
+
+type bulkScheduler interface {
+	schedule.PodScheduler
+	podPairWatcher
+}
+
+// scheduleOnSelector schedules podManifest on every node matching
+// --node-selector and prints the outcome on each, exiting with an error if it
+// couldn't be scheduled on all of them
+func scheduleOnSelector(client consulutil.ConsulClient, store bulkScheduler, podManifest manifest.Manifest) {
+	selector, err := klabels.Parse(*nodeSelector)
+	if err != nil {
+		log.Fatalf("Malformed node selector: %s", err)
+	}
+	applicator := labels.NewConsulApplicator(client, 0)
+	nodes, err := schedule.SelectNodes(applicator, selector)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(nodes) == 0 {
+		log.Fatalf("No nodes match %s", selector)
+	}
+
+	var auditLogger consul.AuditLogger
+	if *auditLog {
+		auditLogger = auditlogstore.NewConsulStore(client.KV())
+	}
+	out := schedule.BulkOutput{
+		PodID:    podManifest.ID(),
+		Selector: selector.String(),
+		Nodes:    schedule.ScheduleOnNodes(store, applicator, auditLogger, nodes, podManifest, *podLabels, labels.DefaultActor()),
+	}
+	if *wait {
+		for i, outcome := range out.Nodes {
+			if outcome.Error != "" {
+				continue
+			}
+			err = waitForReality(store, outcome.Node, podManifest.ID(), *waitTimeout)
+			if err != nil {
+				out.Nodes[i].Error = fmt.Sprintf("scheduled but %s", err)
+			}
+		}
+	}
+
+	outBytes, err := json.Marshal(out)
+	if err != nil {
+		log.Fatalf("Scheduled manifest but couldn't marshal JSON output")
+	}
+	fmt.Println(string(outBytes))
+
+	if failed := out.Failed(); len(failed) > 0 {
+		log.Fatalf("Could not schedule %s on %d of %d nodes", podManifest.ID(), len(failed), len(out.Nodes))
+	}
+}
+
+type podPairWatcher interface {
+	WatchPodPair(
+		nodename types.NodeName,
+		podId types.PodID,
+		quitChan <-chan struct{},
+		errChan chan<- error,
+		pairChan chan<- consul.PodPair,
+	)
+}
+
+// waitForReality blocks until the reality manifest for the given pod matches
+// its intent manifest, or the timeout elapses
+func waitForReality(watcher podPairWatcher, node types.NodeName, podID types.PodID, timeout time.Duration) error {
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	errCh := make(chan error)
+	pairCh := make(chan consul.PodPair)
+	go watcher.WatchPodPair(node, podID, quitCh, errCh, pairCh)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return fmt.Errorf("timed out after %s waiting for it to be launched on %s", timeout, node)
+		case err := <-errCh:
+			log.Printf("Error watching %s on %s: %s", podID, node, err)
+		case pair, ok := <-pairCh:
+			if !ok {
+				return fmt.Errorf("the watch on %s terminated unexpectedly", node)
+			}
+			converged, err := pair.Converged()
+			if err != nil {
+				return err
+			}
+			if converged {
+				return nil
+			}
+		}
+	}
+}
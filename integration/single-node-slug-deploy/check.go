@@ -21,6 +21,7 @@ import (
 
 	label_grpc_client "github.com/square/p2/pkg/grpc/labelstore/client"
 	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
@@ -39,6 +40,7 @@ import (
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/waitfor"
 
 	"github.com/Sirupsen/logrus"
 	"google.golang.org/grpc"
@@ -298,22 +300,17 @@ func verifyProcessExit(errCh chan error, tempDir string, logger logging.Logger)
 
 	logger.Infoln("Waiting for hello instance to listen on 43772")
 	// now wait for the hello server to start running
-	timeout := time.After(30 * time.Second)
-	for {
+	err = waitfor.WaitTimeout(30*time.Second, waitfor.Poll("hello listening on 43772", 1*time.Second, func() bool {
 		resp, err := http.Get("http://localhost:43772/")
-		if err == nil {
-			resp.Body.Close()
-			break
-		}
-
-		select {
-		case <-timeout:
-			errCh <- fmt.Errorf("Hello didn't come up listening on 43772: %s", err)
-			return
-		default:
+		if err != nil {
+			return false
 		}
-
-		time.Sleep(1 * time.Second)
+		resp.Body.Close()
+		return true
+	}))
+	if err != nil {
+		errCh <- fmt.Errorf("Hello didn't come up listening on 43772: %s", err)
+		return
 	}
 
 	exitCode := rand.Intn(100) + 1
@@ -344,7 +341,7 @@ func verifyProcessExit(errCh chan error, tempDir string, logger logging.Logger)
 	}
 
 	var finishResult podprocess.FinishOutput
-	timeout = time.After(30 * time.Second)
+	timeout := time.After(30 * time.Second)
 	for {
 		finishResult, err = finishService.LastFinishForPodUniqueKey(podUniqueKey)
 		if err == nil {
@@ -616,26 +613,9 @@ func checkStatus(statusPort int, pod string) error {
 }
 
 func waitForStatus(statusPort int, pod string, waitTime time.Duration) error {
-	successCh := make(chan struct{})
-
-	var err error
-
-	go func() {
-		for range time.Tick(1 * time.Second) {
-			err = checkStatus(statusPort, pod)
-			if err == nil {
-				close(successCh)
-				break
-			}
-		}
-	}()
-
-	select {
-	case <-time.After(waitTime):
-		return err
-	case <-successCh:
-		return nil
-	}
+	return waitfor.WaitTimeout(waitTime, waitfor.Poll(pod+" status OK", 1*time.Second, func() bool {
+		return checkStatus(statusPort, pod) == nil
+	}))
 }
 
 func userCreationHookManifest(tmpdir string) (manifest.Manifest, error) {
@@ -954,72 +934,27 @@ func waitForPodLabeledWithRC(selector klabels.Selector, rcID fields.ID) error {
 }
 
 func verifyHelloRunning(podUniqueKey types.PodUniqueKey, logger logging.Logger) error {
-	helloPidAppeared := make(chan struct{})
-	quit := make(chan struct{})
-	defer close(quit)
-
 	serviceDir := "/var/service/hello__hello__launch"
 	if podUniqueKey != "" {
 		serviceDir = fmt.Sprintf("/var/service/hello-%s__hello__bin__launch", podUniqueKey)
 	}
-	go func() {
-		for {
-			time.Sleep(100 * time.Millisecond)
-			res := exec.Command("sudo", "sv", "stat", serviceDir).Run()
-			if res == nil {
-				select {
-				case <-quit:
-					logger.Infoln("got a valid stat after timeout")
-				case helloPidAppeared <- struct{}{}:
-				}
-				return
-			} else {
-				select {
-				case <-quit:
-					return
-				default:
-				}
-			}
-		}
-	}()
-	select {
-	case <-time.After(30 * time.Second):
+	err := waitfor.WaitTimeout(30*time.Second, waitfor.Poll(serviceDir+" running", 100*time.Millisecond, func() bool {
+		return exec.Command("sudo", "sv", "stat", serviceDir).Run() == nil
+	}))
+	if err != nil {
 		return fmt.Errorf("Couldn't start hello after 30 seconds:\n\n %s%s", targetLogs("hello"), targetLogs("p2-preparer"))
-	case <-helloPidAppeared:
-		return nil
 	}
+	return nil
 }
 
 func verifyHelloUUIDRunning(podUniqueKey types.PodUniqueKey) error {
-	helloUUIDAppeared := make(chan struct{})
-	quit := make(chan struct{})
-	defer close(quit)
-	go func() {
-		for {
-			time.Sleep(100 * time.Millisecond)
-			err := exec.Command("curl", "localhost:43771").Run()
-			if err == nil {
-				select {
-				case <-quit:
-					fmt.Println("got a valid curl after timeout")
-				case helloUUIDAppeared <- struct{}{}:
-				}
-				return
-			} else {
-				select {
-				case <-quit:
-					return
-				default:
-				}
-			}
-		}
-	}()
-	select {
-	case <-time.After(1 * time.Minute):
+	err := waitfor.WaitTimeout(1*time.Minute, waitfor.Poll("hello responding on 43771", 100*time.Millisecond, func() bool {
+		return exec.Command("curl", "localhost:43771").Run() == nil
+	}))
+	if err != nil {
 		return fmt.Errorf("hello-%s didn't respond healthy on port 43771 after 60 seconds:\n\n %s", podUniqueKey, targetUUIDLogs(podUniqueKey))
-	case <-helloUUIDAppeared:
-		return nil
 	}
+	return nil
 }
 
 func targetUUIDLogs(podUniqueKey types.PodUniqueKey) string {
@@ -1045,7 +980,6 @@ func verifyHealthChecks(config *preparer.PreparerConfig, services []string) erro
 	}
 	store := consul.NewConsulStore(client)
 
-	time.Sleep(30 * time.Second)
 	// check consul for health information for each app
 	name, err := os.Hostname()
 	if err != nil {
@@ -1053,6 +987,15 @@ func verifyHealthChecks(config *preparer.PreparerConfig, services []string) erro
 	}
 
 	node := types.NodeName(name)
+	healthChecker := checker.NewConsulHealthChecker(client)
+	var passing []waitfor.Condition
+	for _, sv := range services {
+		passing = append(passing, waitfor.HealthPassing(healthChecker, node, types.PodID(sv)))
+	}
+	err = waitfor.WaitTimeout(30*time.Second, waitfor.All(passing...))
+	if err != nil {
+		return fmt.Errorf("%s: \n\n %s%s", err, targetLogs("hello"), targetLogs("p2-preparer"))
+	}
 	for _, sv := range services {
 		res, err := store.GetHealth(sv, node)
 		if err != nil {
@@ -0,0 +1,262 @@
+// Package admission checks pod manifests before they are written to the
+// intent tree, so that a malformed manifest is rejected by whoever schedules
+// it instead of failing later in the logs of every node it was scheduled on.
+// Schedulers run an Admitter's checks before writing intent, and preparers
+// can be configured to refuse manifests that fail the same checks.
+package admission
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// A Check is one admission check. Check returns an error describing why the
+// manifest is not admitted, or nil if it is.
+type Check interface {
+	Name() string
+	Check(podManifest manifest.Manifest) error
+}
+
+// Config selects the checks that manifests must pass, in addition to the
+// schema check that every manifest must pass. Schedulers read it from the
+// file given to their --admission-config flag and preparers from the
+// "admission" key of their config.
+type Config struct {
+	// RequiredConfigKeys are keys that must be set in the config of every
+	// manifest. Keys of nested maps are separated by dots, e.g.
+	// "service.owner".
+	RequiredConfigKeys []string `yaml:"required_config_keys,omitempty"`
+
+	// RequireResourceLimits requires every launchable to set the cpus and
+	// memory of its cgroup
+	RequireResourceLimits bool `yaml:"require_resource_limits,omitempty"`
+
+	// SignatureKeyring, if set, is the path of a keyring that must have
+	// signed every manifest, for checking manifests against the keyring
+	// auth policy of the preparers before they are scheduled
+	SignatureKeyring string `yaml:"signature_keyring,omitempty"`
+
+	// SignerQuorums lists the pods whose manifests must be signed by
+	// several of the keys on SignatureKeyring, like the preparers'
+	// signer_quorums
+	SignerQuorums map[types.PodID]auth.SignerQuorum `yaml:"signer_quorums,omitempty"`
+
+	// Exempt lists pods that are admitted without any checks besides the
+	// schema check
+	Exempt []types.PodID `yaml:"exempt,omitempty"`
+}
+
+// LoadConfig reads a Config from a YAML file
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, util.Errorf("Could not read admission config %s: %s", path, err)
+	}
+	err = yaml.Unmarshal(contents, &config)
+	if err != nil {
+		return Config{}, util.Errorf("Could not parse admission config %s: %s", path, err)
+	}
+	return config, nil
+}
+
+// An Admitter runs admission checks on manifests
+type Admitter struct {
+	checks []Check
+	exempt []types.PodID
+}
+
+// New returns an Admitter running the schema check and the checks selected by
+// config
+func New(config Config) (Admitter, error) {
+	admitter := Admitter{
+		checks: []Check{SchemaCheck{}},
+		exempt: config.Exempt,
+	}
+	if len(config.RequiredConfigKeys) > 0 {
+		admitter.checks = append(admitter.checks, RequiredConfigKeysCheck{Keys: config.RequiredConfigKeys})
+	}
+	if config.RequireResourceLimits {
+		admitter.checks = append(admitter.checks, ResourceLimitsCheck{})
+	}
+	if config.SignatureKeyring != "" {
+		for podID, quorum := range config.SignerQuorums {
+			if err := quorum.Validate(); err != nil {
+				return Admitter{}, util.Errorf("Invalid admission signer quorum of %s: %s", podID, err)
+			}
+		}
+		policy, err := auth.LoadKeyringPolicy(config.SignatureKeyring, nil, config.SignerQuorums)
+		if err != nil {
+			return Admitter{}, util.Errorf("Could not load admission signature keyring: %s", err)
+		}
+		admitter.checks = append(admitter.checks, SignatureCheck{Policy: policy})
+	}
+	return admitter, nil
+}
+
+// FromFile returns an Admitter configured by the YAML file at path, or one
+// running only the schema check if path is empty
+func FromFile(path string) (Admitter, error) {
+	if path == "" {
+		return New(Config{})
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		return Admitter{}, err
+	}
+	return New(config)
+}
+
+// With returns a copy of the Admitter that also runs checks, for checks that
+// can't be configured with a Config
+func (a Admitter) With(checks ...Check) Admitter {
+	withChecks := a
+	withChecks.checks = append(append([]Check(nil), a.checks...), checks...)
+	return withChecks
+}
+
+// Admit runs every check on the manifest, returning a *Rejection listing the
+// checks that it failed, if any
+func (a Admitter) Admit(podManifest manifest.Manifest) error {
+	exempt := false
+	for _, podID := range a.exempt {
+		if podID == podManifest.ID() {
+			exempt = true
+			break
+		}
+	}
+
+	var failures []Failure
+	for _, check := range a.checks {
+		if _, schema := check.(SchemaCheck); exempt && !schema {
+			continue
+		}
+		err := check.Check(podManifest)
+		if err != nil {
+			failures = append(failures, Failure{Check: check.Name(), Err: err})
+		}
+	}
+	if len(failures) > 0 {
+		return &Rejection{PodID: podManifest.ID(), Failures: failures}
+	}
+	return nil
+}
+
+// Failure is a check that a manifest failed
+type Failure struct {
+	Check string
+	Err   error
+}
+
+// A Rejection is returned by Admitter.Admit for a manifest that failed checks
+type Rejection struct {
+	PodID    types.PodID
+	Failures []Failure
+}
+
+func (r *Rejection) Error() string {
+	var failures []string
+	for _, failure := range r.Failures {
+		failures = append(failures, fmt.Sprintf("%s: %s", failure.Check, failure.Err))
+	}
+	return fmt.Sprintf("manifest for %s was not admitted: %s", r.PodID, strings.Join(failures, "; "))
+}
+
+// IsRejection returns true if err was returned for a manifest that failed
+// admission checks, as opposed to one that couldn't be checked
+func IsRejection(err error) bool {
+	_, ok := err.(*Rejection)
+	return ok
+}
+
+// SchemaCheck checks that the manifest is internally consistent, as manifests
+// parsed from YAML are. Manifests built in code are only checked here.
+type SchemaCheck struct{}
+
+func (SchemaCheck) Name() string {
+	return "schema"
+}
+
+func (SchemaCheck) Check(podManifest manifest.Manifest) error {
+	return manifest.ValidManifest(podManifest)
+}
+
+// RequiredConfigKeysCheck checks that the manifest's config sets Keys
+type RequiredConfigKeysCheck struct {
+	Keys []string
+}
+
+func (RequiredConfigKeysCheck) Name() string {
+	return "required_config_keys"
+}
+
+func (c RequiredConfigKeysCheck) Check(podManifest manifest.Manifest) error {
+	var missing []string
+	for _, key := range c.Keys {
+		if !hasConfigKey(podManifest.GetConfig(), strings.Split(key, ".")) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return util.Errorf("config must set %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func hasConfigKey(config map[interface{}]interface{}, path []string) bool {
+	value, ok := config[path[0]]
+	if !ok || value == nil {
+		return false
+	}
+	if len(path) == 1 {
+		return true
+	}
+	nested, ok := value.(map[interface{}]interface{})
+	return ok && hasConfigKey(nested, path[1:])
+}
+
+// ResourceLimitsCheck checks that every launchable sets the cpus and memory
+// of its cgroup
+type ResourceLimitsCheck struct{}
+
+func (ResourceLimitsCheck) Name() string {
+	return "resource_limits"
+}
+
+func (ResourceLimitsCheck) Check(podManifest manifest.Manifest) error {
+	var unlimited []string
+	for launchableID, stanza := range podManifest.GetLaunchableStanzas() {
+		if stanza.CgroupConfig.CPUs <= 0 || stanza.CgroupConfig.Memory <= 0 {
+			unlimited = append(unlimited, launchableID.String())
+		}
+	}
+	if len(unlimited) > 0 {
+		sort.Strings(unlimited)
+		return util.Errorf("launchables %s must set cgroup cpus and memory", strings.Join(unlimited, ", "))
+	}
+	return nil
+}
+
+// SignatureCheck checks that the manifest would be authorized by Policy, such
+// as the keyring auth policy of the preparers it will be deployed to
+type SignatureCheck struct {
+	Policy auth.Policy
+}
+
+func (SignatureCheck) Name() string {
+	return "signature"
+}
+
+func (c SignatureCheck) Check(podManifest manifest.Manifest) error {
+	return c.Policy.AuthorizeApp(podManifest, logging.DefaultLogger)
+}
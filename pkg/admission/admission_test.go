@@ -0,0 +1,107 @@
+package admission
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+func testManifest(t *testing.T, yaml string) manifest.Manifest {
+	podManifest, err := manifest.FromBytes([]byte(yaml))
+	Assert(t).IsNil(err, "test setup: could not parse manifest")
+	return podManifest
+}
+
+func TestSchemaCheck(t *testing.T) {
+	admitter, err := New(Config{})
+	Assert(t).IsNil(err, "should have configured admission")
+
+	builder := manifest.NewBuilder()
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {LaunchableType: "hoist"},
+	})
+	err = admitter.Admit(builder.GetManifest())
+	Assert(t).IsTrue(IsRejection(err), "should have rejected a manifest without an id or location")
+
+	builder.SetID("web")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {LaunchableType: "hoist", Location: "https://artifacts/web.tar.gz"},
+	})
+	Assert(t).IsNil(admitter.Admit(builder.GetManifest()), "should have admitted a valid manifest")
+}
+
+func TestRequiredConfigKeys(t *testing.T) {
+	check := RequiredConfigKeysCheck{Keys: []string{"owner", "service.tier"}}
+	Assert(t).IsNil(check.Check(testManifest(t, `{ id: web, config: { owner: a, service: { tier: 1 } } }`)), "should have found the keys")
+
+	err := check.Check(testManifest(t, `{ id: web, config: { owner: a, service: 1 } }`))
+	Assert(t).IsNotNil(err, "should have required the nested key")
+	Assert(t).IsTrue(strings.HasSuffix(err.Error(), "config must set service.tier"), "unexpected error: "+err.Error())
+}
+
+func TestResourceLimits(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"limited":   {LaunchableType: "hoist", Location: "a.tar.gz", CgroupConfig: cgroups.Config{CPUs: 1, Memory: 1024}},
+		"unlimited": {LaunchableType: "hoist", Location: "b.tar.gz", CgroupConfig: cgroups.Config{CPUs: 1}},
+	})
+	err := ResourceLimitsCheck{}.Check(builder.GetManifest())
+	Assert(t).IsNotNil(err, "should have required memory")
+	Assert(t).IsTrue(strings.HasSuffix(err.Error(), "launchables unlimited must set cgroup cpus and memory"), "unexpected error: "+err.Error())
+}
+
+func TestSignatureCheck(t *testing.T) {
+	podManifest := testManifest(t, `{ id: web }`)
+	Assert(t).IsNil(SignatureCheck{Policy: auth.NullPolicy{}}.Check(podManifest), "the null policy should authorize anything")
+	Assert(t).IsNotNil(SignatureCheck{Policy: auth.FixedKeyringPolicy{}}.Check(podManifest), "should have required a signature")
+}
+
+type failingCheck struct{}
+
+func (failingCheck) Name() string { return "custom" }
+
+func (failingCheck) Check(manifest.Manifest) error { return util.Errorf("always fails") }
+
+func TestAdmitReportsEveryFailureAndExemptions(t *testing.T) {
+	admitter, err := New(Config{RequiredConfigKeys: []string{"owner"}, Exempt: []types.PodID{"legacy"}})
+	Assert(t).IsNil(err, "should have configured admission")
+	admitter = admitter.With(failingCheck{})
+
+	err = admitter.Admit(testManifest(t, `{ id: web }`))
+	rejection, ok := err.(*Rejection)
+	Assert(t).IsTrue(ok, "should have rejected the manifest")
+	Assert(t).AreEqual(len(rejection.Failures), 2, "should have reported both failed checks")
+	Assert(t).AreEqual(rejection.Failures[0].Check, "required_config_keys", "unexpected failed check")
+	Assert(t).AreEqual(rejection.Failures[1].Check, "custom", "unexpected failed check")
+
+	Assert(t).IsNil(admitter.Admit(testManifest(t, `{ id: legacy }`)), "should only have checked the schema of an exempt pod")
+}
+
+func TestFromFile(t *testing.T) {
+	admitter, err := FromFile("")
+	Assert(t).IsNil(err, "should have configured the schema check without a file")
+	Assert(t).AreEqual(len(admitter.checks), 1, "should only have run the schema check")
+
+	dir, err := ioutil.TempDir("", "admission")
+	Assert(t).IsNil(err, "test setup: could not create temporary directory")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "admission.yaml")
+	err = ioutil.WriteFile(path, []byte("required_config_keys: [owner]\nrequire_resource_limits: true\n"), 0644)
+	Assert(t).IsNil(err, "test setup: could not write config")
+
+	admitter, err = FromFile(path)
+	Assert(t).IsNil(err, "should have read the config")
+	Assert(t).AreEqual(len(admitter.checks), 3, "should have configured the selected checks")
+}
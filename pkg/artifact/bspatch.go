@@ -0,0 +1,125 @@
+package artifact
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"encoding/binary"
+	"io"
+
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	bsdiffMagic      = "BSDIFF40"
+	bsdiffHeaderSize = 32
+)
+
+// applyBSDiff writes to out the file that patch, a bsdiff patch of size
+// patchSize, builds from old, of size oldSize. The output is written in
+// order, so it needn't fit in memory.
+//
+// A bsdiff patch is a header of the magic "BSDIFF40" and the lengths of the
+// compressed control block, the compressed diff block and the output,
+// followed by the three bzip2 compressed control, diff and extra blocks. The
+// control block is a list of triples (x, y, z): x bytes of the diff block are
+// added to as many bytes of old and written out, then y bytes of the extra
+// block are copied out, and the position in old is moved by z.
+func applyBSDiff(old io.ReaderAt, oldSize int64, patch io.ReaderAt, patchSize int64, out io.Writer) error {
+	header := make([]byte, bsdiffHeaderSize)
+	_, err := patch.ReadAt(header, 0)
+	if err != nil {
+		return util.Errorf("Could not read patch header: %s", err)
+	}
+	if string(header[:8]) != bsdiffMagic {
+		return util.Errorf("Patch is not in the bsdiff format")
+	}
+	ctrlLen, diffLen, newSize := offtin(header[8:16]), offtin(header[16:24]), offtin(header[24:32])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 || bsdiffHeaderSize+ctrlLen+diffLen > patchSize {
+		return util.Errorf("Corrupt patch header")
+	}
+	extraStart := bsdiffHeaderSize + ctrlLen + diffLen
+	ctrl := bufio.NewReader(bzip2.NewReader(io.NewSectionReader(patch, bsdiffHeaderSize, ctrlLen)))
+	diff := bufio.NewReader(bzip2.NewReader(io.NewSectionReader(patch, bsdiffHeaderSize+ctrlLen, diffLen)))
+	extra := bufio.NewReader(bzip2.NewReader(io.NewSectionReader(patch, extraStart, patchSize-extraStart)))
+
+	w := bufio.NewWriter(out)
+	triple := make([]byte, 24)
+	diffBuf := make([]byte, 32*1024)
+	oldBuf := make([]byte, len(diffBuf))
+	var oldPos, newPos int64
+	for newPos < newSize {
+		_, err = io.ReadFull(ctrl, triple)
+		if err != nil {
+			return util.Errorf("Could not read patch control block: %s", err)
+		}
+		diffCount, extraCount, seek := offtin(triple[0:8]), offtin(triple[8:16]), offtin(triple[16:24])
+		if diffCount < 0 || extraCount < 0 || newPos+diffCount+extraCount > newSize {
+			return util.Errorf("Corrupt patch control block")
+		}
+
+		for remaining := diffCount; remaining > 0; {
+			n := int64(len(diffBuf))
+			if remaining < n {
+				n = remaining
+			}
+			_, err = io.ReadFull(diff, diffBuf[:n])
+			if err != nil {
+				return util.Errorf("Could not read patch diff block: %s", err)
+			}
+			err = readOld(old, oldSize, oldPos, oldBuf[:n])
+			if err != nil {
+				return err
+			}
+			for i := range diffBuf[:n] {
+				diffBuf[i] += oldBuf[i]
+			}
+			_, err = w.Write(diffBuf[:n])
+			if err != nil {
+				return err
+			}
+			oldPos += n
+			newPos += n
+			remaining -= n
+		}
+
+		_, err = io.CopyN(w, extra, extraCount)
+		if err != nil {
+			return util.Errorf("Could not read patch extra block: %s", err)
+		}
+		newPos += extraCount
+		oldPos += seek
+	}
+	return w.Flush()
+}
+
+// readOld fills buf with the bytes of old starting at pos. Bytes outside of
+// old are read as 0, as bsdiff expects.
+func readOld(old io.ReaderAt, oldSize int64, pos int64, buf []byte) error {
+	for i := range buf {
+		buf[i] = 0
+	}
+	start, end := pos, pos+int64(len(buf))
+	if start < 0 {
+		start = 0
+	}
+	if end > oldSize {
+		end = oldSize
+	}
+	if start >= end {
+		return nil
+	}
+	_, err := old.ReadAt(buf[start-pos:end-pos], start)
+	if err != nil {
+		return util.Errorf("Could not read the artifact being patched: %s", err)
+	}
+	return nil
+}
+
+// offtin decodes bsdiff's 8 byte sign and magnitude little endian integers
+func offtin(buf []byte) int64 {
+	y := int64(binary.LittleEndian.Uint64(buf) &^ (1 << 63))
+	if buf[7]&0x80 != 0 {
+		y = -y
+	}
+	return y
+}
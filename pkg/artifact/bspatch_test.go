@@ -0,0 +1,32 @@
+package artifact
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+func readPatchTestdata(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "patch", name))
+	Assert(t).IsNil(err, "test setup: could not read "+name)
+	return data
+}
+
+func TestApplyBSDiff(t *testing.T) {
+	old, patch, expected := readPatchTestdata(t, "old"), readPatchTestdata(t, "old_to_new.bsdiff"), readPatchTestdata(t, "new")
+
+	var out bytes.Buffer
+	err := applyBSDiff(bytes.NewReader(old), int64(len(old)), bytes.NewReader(patch), int64(len(patch)), &out)
+	Assert(t).IsNil(err, "should have applied the patch")
+	Assert(t).IsTrue(bytes.Equal(out.Bytes(), expected), "the patched file should have matched the new version")
+
+	err = applyBSDiff(bytes.NewReader(old), int64(len(old)), bytes.NewReader(patch[:100]), 100, ioutil.Discard)
+	Assert(t).IsNotNil(err, "should have rejected a truncated patch")
+
+	notPatch := []byte("BSDIFF39" + string(patch[8:]))
+	err = applyBSDiff(bytes.NewReader(old), int64(len(old)), bytes.NewReader(notPatch), int64(len(notPatch)), ioutil.Discard)
+	Assert(t).IsNotNil(err, "should have rejected a file that isn't a bsdiff patch")
+}
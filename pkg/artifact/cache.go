@@ -0,0 +1,446 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/gzip"
+	"github.com/square/p2/pkg/tracing"
+	"github.com/square/p2/pkg/uri"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+)
+
+// Cache is a node-local store of fetched artifacts shared by the pods of a
+// node, so that an artifact installed by several pods is only downloaded
+// once. Artifacts are stored by the sha256 digest of their contents, and the
+// location each was fetched from is recorded so that it isn't fetched again.
+// Artifact locations are assumed not to change contents, as is the case for
+// the versioned locations of the artifact registry.
+//
+// When the cached artifacts exceed the cache's maximum size, the least
+// recently used ones are removed.
+type Cache struct {
+	root    string
+	maxSize size.ByteCount
+
+	// serializes changes to the cache's contents. Fetches happen outside of
+	// it, so an artifact fetched concurrently by two pods may be fetched
+	// twice.
+	mu sync.Mutex
+	// the number of open copies of each artifact, which are not evicted
+	inUse map[string]int
+}
+
+// CachedArtifact is an open artifact of a Cache, which is kept in the cache
+// until it is closed.
+type CachedArtifact struct {
+	*os.File
+
+	cache  *Cache
+	digest string
+}
+
+// Close closes the artifact and lets it be evicted from the cache.
+func (a *CachedArtifact) Close() error {
+	a.cache.mu.Lock()
+	a.cache.inUse[a.digest]--
+	if a.cache.inUse[a.digest] == 0 {
+		delete(a.cache.inUse, a.digest)
+	}
+	a.cache.mu.Unlock()
+	return a.File.Close()
+}
+
+// NewCache returns a Cache storing at most maxSize bytes of artifacts under
+// root, which is created if needed.
+func NewCache(root string, maxSize size.ByteCount) (*Cache, error) {
+	for _, dir := range []string{root, filepath.Join(root, "blobs"), filepath.Join(root, "locations"), filepath.Join(root, "tmp")} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, util.Errorf("Could not create artifact cache directory %s: %s", dir, err)
+		}
+	}
+	return &Cache{
+		root:    root,
+		maxSize: maxSize,
+		inUse:   make(map[string]int),
+	}, nil
+}
+
+func (c *Cache) blobPath(digest string) string {
+	return filepath.Join(c.root, "blobs", digest+".tar.gz")
+}
+
+func (c *Cache) locationPath(location *url.URL) string {
+	hash := sha256.Sum256([]byte(location.String()))
+	return filepath.Join(c.root, "locations", hex.EncodeToString(hash[:]))
+}
+
+// Open returns the cached copy of the artifact at location, fetching it with
+// fetcher if it isn't cached yet. The caller must close the returned artifact.
+func (c *Cache) Open(location *url.URL, fetcher uri.Fetcher) (*CachedArtifact, error) {
+	if artifact, ok := c.openCached(location); ok {
+		return artifact, nil
+	}
+
+	tmpFile, digest, err := c.fetch(location, fetcher)
+	if err != nil {
+		return nil, err
+	}
+	return c.add(location, tmpFile, digest)
+}
+
+// OpenPatched returns the artifact at location, which has the hex sha256
+// digest digest, by applying one of patches to a cached artifact, so that
+// only the patch has to be fetched. An error is returned if none of the
+// patches apply to a cached artifact or if patching fails, in which case the
+// artifact should be opened with Open instead.
+func (c *Cache) OpenPatched(location *url.URL, digest string, patches []auth.ArtifactPatch, fetcher uri.Fetcher) (*CachedArtifact, error) {
+	digest = strings.ToLower(digest)
+	err := util.Errorf("No patch applies to a cached artifact")
+	for _, patch := range patches {
+		base, ok := c.openDigest(strings.ToLower(patch.BaseDigest))
+		if !ok {
+			continue
+		}
+		var tmpFile string
+		tmpFile, err = c.applyPatch(base, patch.Location, digest, fetcher)
+		_ = base.Close()
+		if err == nil {
+			return c.add(location, tmpFile, digest)
+		}
+	}
+	return nil, err
+}
+
+// add moves the artifact at tmpFile, fetched from location, into the cache
+// and opens it
+func (c *Cache) add(location *url.URL, tmpFile string, digest string) (*CachedArtifact, error) {
+	defer os.Remove(tmpFile)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := os.Rename(tmpFile, c.blobPath(digest))
+	if err != nil {
+		return nil, util.Errorf("Could not add artifact to the cache: %s", err)
+	}
+	err = ioutil.WriteFile(c.locationPath(location), []byte(digest), 0644)
+	if err != nil {
+		return nil, util.Errorf("Could not record artifact location in the cache: %s", err)
+	}
+	artifact, err := c.open(digest)
+	if err != nil {
+		return nil, err
+	}
+	err = c.evict()
+	if err != nil {
+		_ = artifact.Close()
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// open opens a cached artifact. It must be called with mu held.
+func (c *Cache) open(digest string) (*CachedArtifact, error) {
+	file, err := os.Open(c.blobPath(digest))
+	if err != nil {
+		return nil, err
+	}
+	c.inUse[digest]++
+	return &CachedArtifact{
+		File:   file,
+		cache:  c,
+		digest: digest,
+	}, nil
+}
+
+// openCached opens the cached artifact fetched from location, if there is one,
+// and marks it as recently used
+func (c *Cache) openCached(location *url.URL) (*CachedArtifact, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	contents, err := ioutil.ReadFile(c.locationPath(location))
+	if err != nil {
+		return nil, false
+	}
+	digest := strings.TrimSpace(string(contents))
+	artifact, err := c.open(digest)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(c.blobPath(digest), now, now)
+	return artifact, true
+}
+
+// openDigest opens the cached artifact with digest, if there is one, and
+// marks it as recently used
+func (c *Cache) openDigest(digest string) (*CachedArtifact, bool) {
+	if _, err := hex.DecodeString(digest); err != nil || digest == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	artifact, err := c.open(digest)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(c.blobPath(digest), now, now)
+	return artifact, true
+}
+
+// applyPatch fetches the bsdiff patch at patchLocation and applies it to base,
+// returning the path of a temporary file in the cache holding the result,
+// which must have the hex sha256 digest digest
+func (c *Cache) applyPatch(base *CachedArtifact, patchLocation *url.URL, digest string, fetcher uri.Fetcher) (string, error) {
+	patchPath, _, err := c.fetch(patchLocation, fetcher)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(patchPath)
+	patch, err := os.Open(patchPath)
+	if err != nil {
+		return "", err
+	}
+	defer patch.Close()
+	patchInfo, err := patch.Stat()
+	if err != nil {
+		return "", err
+	}
+	baseInfo, err := base.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Join(c.root, "tmp"), "patched")
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+	// the artifact is extracted as the pod's user
+	err = tmpFile.Chmod(0644)
+	if err == nil {
+		hash := sha256.New()
+		err = applyBSDiff(base.File, baseInfo.Size(), patch, patchInfo.Size(), io.MultiWriter(tmpFile, hash))
+		if err == nil && hex.EncodeToString(hash.Sum(nil)) != digest {
+			err = util.Errorf("Patched artifact did not match the registry's digest %s", digest)
+		}
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return "", err
+	}
+	return tmpFile.Name(), nil
+}
+
+// fetch copies the artifact at location to a temporary file in the cache,
+// returning its path and the digest of its contents
+func (c *Cache) fetch(location *url.URL, fetcher uri.Fetcher) (string, string, error) {
+	remoteData, err := fetcher.Open(location)
+	if err != nil {
+		return "", "", err
+	}
+	defer remoteData.Close()
+
+	tmpFile, err := ioutil.TempFile(filepath.Join(c.root, "tmp"), filepath.Base(location.Path))
+	if err != nil {
+		return "", "", err
+	}
+	defer tmpFile.Close()
+	// the artifact is extracted as the pod's user
+	err = tmpFile.Chmod(0644)
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return "", "", err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmpFile, hash), remoteData)
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return "", "", util.Errorf("Could not copy artifact locally: %v", err)
+	}
+	return tmpFile.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CachedArtifactInfo describes an artifact stored in a Cache
+type CachedArtifactInfo struct {
+	Digest   string
+	Size     size.ByteCount
+	LastUsed time.Time
+}
+
+// Artifacts lists the cached artifacts that aren't open, least recently used
+// first
+func (c *Cache) Artifacts() ([]CachedArtifactInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	blobs, err := ioutil.ReadDir(filepath.Join(c.root, "blobs"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byModTime(blobs))
+
+	var artifacts []CachedArtifactInfo
+	for _, blob := range blobs {
+		digest := strings.TrimSuffix(blob.Name(), ".tar.gz")
+		if c.inUse[digest] > 0 {
+			continue
+		}
+		artifacts = append(artifacts, CachedArtifactInfo{
+			Digest:   digest,
+			Size:     size.ByteCount(blob.Size()),
+			LastUsed: blob.ModTime(),
+		})
+	}
+	return artifacts, nil
+}
+
+// Remove removes the cached artifact with digest. Artifacts that are open
+// aren't removed.
+func (c *Cache) Remove(digest string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inUse[digest] > 0 {
+		return util.Errorf("Cached artifact %s is in use", digest)
+	}
+	err := os.Remove(c.blobPath(digest))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// evict removes the least recently used artifacts that aren't open until the
+// cache fits in its maximum size. It must be called with mu held.
+func (c *Cache) evict() error {
+	blobs, err := ioutil.ReadDir(filepath.Join(c.root, "blobs"))
+	if err != nil {
+		return err
+	}
+	var total size.ByteCount
+	for _, blob := range blobs {
+		total += size.ByteCount(blob.Size())
+	}
+	if total <= c.maxSize {
+		return nil
+	}
+
+	sort.Sort(byModTime(blobs))
+	for _, blob := range blobs {
+		if total <= c.maxSize {
+			break
+		}
+		if c.inUse[strings.TrimSuffix(blob.Name(), ".tar.gz")] > 0 {
+			continue
+		}
+		err = os.Remove(filepath.Join(c.root, "blobs", blob.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= size.ByteCount(blob.Size())
+	}
+	// locations of evicted artifacts are left behind, and are fetched again
+	// when they are next used
+	return nil
+}
+
+type byModTime []os.FileInfo
+
+func (b byModTime) Len() int           { return len(b) }
+func (b byModTime) Less(i, j int) bool { return b[i].ModTime().Before(b[j].ModTime()) }
+func (b byModTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// Implements the Downloader interface like the location downloader, but
+// reads artifacts from a Cache
+type cachingDownloader struct {
+	fetcher    uri.Fetcher
+	verifier   auth.ArtifactVerifier
+	cache      *Cache
+	extraction gzip.Options
+	span       *tracing.Span
+}
+
+// NewCachingDownloader returns a Downloader that fetches artifacts with
+// fetcher through cache and extracts them according to extraction. Every
+// artifact is checked with verifier, including cached ones, since the
+// verification policy of each pod may differ. Fetches and extractions are
+// recorded as spans under span, which may be nil.
+func NewCachingDownloader(fetcher uri.Fetcher, verifier auth.ArtifactVerifier, cache *Cache, extraction gzip.Options, span *tracing.Span) Downloader {
+	return &cachingDownloader{
+		fetcher:    fetcher,
+		verifier:   verifier,
+		cache:      cache,
+		extraction: extraction,
+		span:       span,
+	}
+}
+
+func (d *cachingDownloader) Download(location *url.URL, verificationData auth.VerificationData, dst string, owner string) error {
+	artifactFile, err := d.openAndVerify(location, verificationData)
+	if err != nil {
+		return err
+	}
+	defer artifactFile.Close()
+
+	span := d.span.Child("extract_artifact")
+	err = gzip.ExtractTarGzWithOptions(owner, artifactFile.Name(), dst, d.extraction)
+	span.End(err)
+	if err != nil {
+		_ = os.RemoveAll(dst)
+		return util.Errorf("error while extracting artifact: %s", err)
+	}
+	return nil
+}
+
+func (d *cachingDownloader) Verify(location *url.URL, verificationData auth.VerificationData) error {
+	artifactFile, err := d.openAndVerify(location, verificationData)
+	if err != nil {
+		return err
+	}
+	return artifactFile.Close()
+}
+
+func (d *cachingDownloader) openAndVerify(location *url.URL, verificationData auth.VerificationData) (*CachedArtifact, error) {
+	artifactFile, ok := d.cache.openCached(location)
+	if !ok && verificationData.ArtifactDigest != "" && len(verificationData.Patches) > 0 {
+		// a failed patch falls back to fetching the whole artifact
+		span := d.span.Child("patch_artifact")
+		span.SetAttribute("artifact_url", traceableURL(location))
+		var err error
+		artifactFile, err = d.cache.OpenPatched(location, verificationData.ArtifactDigest, verificationData.Patches, d.fetcher)
+		span.End(err)
+		ok = err == nil
+	}
+	if !ok {
+		span := d.span.Child("fetch_artifact")
+		span.SetAttribute("artifact_url", traceableURL(location))
+		var err error
+		artifactFile, err = d.cache.Open(location, d.fetcher)
+		span.End(err)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := auth.CheckArtifactDigest(artifactFile.File, verificationData)
+	if err == nil {
+		err = d.verifier.VerifyHoistArtifact(artifactFile.File, verificationData)
+	}
+	if err != nil {
+		_ = artifactFile.Close()
+		return nil, err
+	}
+	return artifactFile, nil
+}
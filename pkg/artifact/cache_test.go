@@ -0,0 +1,172 @@
+package artifact
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/gzip"
+	"github.com/square/p2/pkg/uri"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+)
+
+// countingFetcher counts the artifacts it opens
+type countingFetcher struct {
+	uri.Fetcher
+	opened int
+}
+
+func (f *countingFetcher) Open(u *url.URL) (io.ReadCloser, error) {
+	f.opened++
+	return f.Fetcher.Open(u)
+}
+
+func TestCachingDownloaderFetchesOnce(t *testing.T) {
+	root, err := ioutil.TempDir("", "artifact_cache")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	defer os.RemoveAll(root)
+	cache, err := NewCache(filepath.Join(root, "cache"), size.Gibibyte)
+	Assert(t).IsNil(err, "could not create cache")
+	curUser, err := user.Current()
+	Assert(t).IsNil(err, "could not get the current user")
+
+	fetcher := &countingFetcher{Fetcher: uri.DefaultFetcher}
+	downloader := NewCachingDownloader(fetcher, auth.NopVerifier(), cache, gzip.Options{}, nil)
+	location := &url.URL{Path: util.From(runtime.Caller(0)).ExpandPath("../auth/testdata/test_artifact/hello-server_3881c78ed47ae8be4a4080178f2d46cc174a5a95.tar.gz")}
+
+	for _, dst := range []string{"pod1", "pod2"} {
+		err = downloader.Download(location, auth.VerificationData{}, filepath.Join(root, dst), curUser.Username)
+		Assert(t).IsNil(err, "download should have succeeded")
+		_, err = os.Stat(filepath.Join(root, dst, "app-manifest.yaml"))
+		Assert(t).IsNil(err, "the artifact should have been extracted")
+	}
+	Assert(t).AreEqual(fetcher.opened, 1, "the artifact should have been fetched once")
+}
+
+func TestDownloadersCheckArtifactDigest(t *testing.T) {
+	root, err := ioutil.TempDir("", "artifact_cache")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	defer os.RemoveAll(root)
+	cache, err := NewCache(filepath.Join(root, "cache"), size.Gibibyte)
+	Assert(t).IsNil(err, "could not create cache")
+
+	location := &url.URL{Path: util.From(runtime.Caller(0)).ExpandPath("../auth/testdata/test_artifact/hello-server_3881c78ed47ae8be4a4080178f2d46cc174a5a95.tar.gz")}
+	for _, downloader := range []Downloader{
+		NewLocationDownloader(uri.DefaultFetcher, auth.NopVerifier(), gzip.Options{}, nil),
+		NewCachingDownloader(uri.DefaultFetcher, auth.NopVerifier(), cache, gzip.Options{}, nil),
+	} {
+		err = downloader.Verify(location, auth.VerificationData{ArtifactDigest: "0123abcd"})
+		Assert(t).IsNotNil(err, "should have rejected an artifact that doesn't match the registry's digest")
+		err = downloader.Verify(location, auth.VerificationData{})
+		Assert(t).IsNil(err, "should have accepted an artifact when the registry gave no digest")
+	}
+}
+
+func TestCachingDownloaderAppliesPatches(t *testing.T) {
+	root, err := ioutil.TempDir("", "artifact_cache")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	defer os.RemoveAll(root)
+	cache, err := NewCache(filepath.Join(root, "cache"), size.Gibibyte)
+	Assert(t).IsNil(err, "could not create cache")
+
+	testdata := util.From(runtime.Caller(0)).ExpandPath("testdata/patch")
+	oldLocation := &url.URL{Path: filepath.Join(testdata, "old")}
+	patch := auth.ArtifactPatch{
+		BaseDigest: "a9c648ab7e6b20f9b86621af367c906b94b21b00fda4a39272a5099c623fb28f",
+		Location:   &url.URL{Path: filepath.Join(testdata, "old_to_new.bsdiff")},
+	}
+	newDigest := "20bc71074ad2b02a2a90b941d648194934bc46fb9df0b41ac259d099e4c94aa9"
+	// the new version can only be built from the patch
+	newLocation := &url.URL{Path: filepath.Join(root, "missing", "new")}
+
+	fetcher := &countingFetcher{Fetcher: uri.DefaultFetcher}
+	downloader := NewCachingDownloader(fetcher, auth.NopVerifier(), cache, gzip.Options{}, nil)
+	err = downloader.Verify(newLocation, auth.VerificationData{ArtifactDigest: newDigest, Patches: []auth.ArtifactPatch{patch}})
+	Assert(t).IsNotNil(err, "should have fallen back to fetching the artifact when its patch's base isn't cached")
+
+	err = downloader.Verify(oldLocation, auth.VerificationData{})
+	Assert(t).IsNil(err, "test setup: could not cache the previous version")
+	err = downloader.Verify(newLocation, auth.VerificationData{ArtifactDigest: "0123abcd", Patches: []auth.ArtifactPatch{patch}})
+	Assert(t).IsNotNil(err, "should not have used a patch whose result doesn't match the artifact's digest")
+
+	err = downloader.Verify(newLocation, auth.VerificationData{ArtifactDigest: newDigest, Patches: []auth.ArtifactPatch{patch}})
+	Assert(t).IsNil(err, "should have built the artifact from the cached previous version")
+	opened := fetcher.opened
+	err = downloader.Verify(newLocation, auth.VerificationData{ArtifactDigest: newDigest})
+	Assert(t).IsNil(err, "the patched artifact should have been cached")
+	Assert(t).AreEqual(fetcher.opened, opened, "the patched artifact should not have been fetched again")
+}
+
+func TestCacheRemovesArtifactsNotInUse(t *testing.T) {
+	root, err := ioutil.TempDir("", "artifact_cache")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	defer os.RemoveAll(root)
+	cache, err := NewCache(filepath.Join(root, "cache"), size.Gibibyte)
+	Assert(t).IsNil(err, "could not create cache")
+
+	location := &url.URL{Path: util.From(runtime.Caller(0)).ExpandPath("testdata/patch/old")}
+	artifact, err := cache.Open(location, uri.DefaultFetcher)
+	Assert(t).IsNil(err, "could not cache artifact")
+	artifacts, err := cache.Artifacts()
+	Assert(t).IsNil(err, "could not list artifacts")
+	Assert(t).AreEqual(len(artifacts), 0, "should not have listed an open artifact")
+	Assert(t).IsNotNil(cache.Remove(artifact.digest), "should not have removed an open artifact")
+
+	Assert(t).IsNil(artifact.Close(), "could not close artifact")
+	artifacts, err = cache.Artifacts()
+	Assert(t).IsNil(err, "could not list artifacts")
+	Assert(t).AreEqual(len(artifacts), 1, "should have listed the closed artifact")
+	Assert(t).AreEqual(artifacts[0].Size, size.ByteCount(6600), "should have listed the artifact's size")
+	Assert(t).IsNil(cache.Remove(artifacts[0].Digest), "should have removed the artifact")
+	artifacts, err = cache.Artifacts()
+	Assert(t).IsNil(err, "could not list artifacts")
+	Assert(t).AreEqual(len(artifacts), 0, "should have removed the artifact")
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	root, err := ioutil.TempDir("", "artifact_cache")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	defer os.RemoveAll(root)
+
+	var locations []*url.URL
+	for _, name := range []string{"a", "b"} {
+		path := filepath.Join(root, name+".tar.gz")
+		Assert(t).IsNil(ioutil.WriteFile(path, []byte(name+" contents"), 0644), "could not write artifact")
+		locations = append(locations, &url.URL{Path: path})
+	}
+	// room for one artifact at a time
+	cache, err := NewCache(filepath.Join(root, "cache"), 12)
+	Assert(t).IsNil(err, "could not create cache")
+	fetcher := &countingFetcher{Fetcher: uri.DefaultFetcher}
+
+	open := func(location *url.URL) {
+		artifact, err := cache.Open(location, fetcher)
+		Assert(t).IsNil(err, "should have opened the artifact")
+		Assert(t).IsNil(artifact.Close(), "should have closed the artifact")
+	}
+	open(locations[0])
+	open(locations[0])
+	Assert(t).AreEqual(fetcher.opened, 1, "a should have been cached")
+	open(locations[1])
+	Assert(t).AreEqual(fetcher.opened, 2, "b should have been fetched")
+	open(locations[0])
+	Assert(t).AreEqual(fetcher.opened, 3, "a should have been evicted when b was added")
+
+	// artifacts that are open are not evicted
+	artifact, err := cache.Open(locations[0], fetcher)
+	Assert(t).IsNil(err, "should have opened the artifact")
+	open(locations[1])
+	Assert(t).AreEqual(fetcher.opened, 4, "b should have been evicted when a was added")
+	contents, err := ioutil.ReadFile(artifact.Name())
+	Assert(t).IsNil(err, "the open artifact should have been kept")
+	Assert(t).AreEqual(string(contents), "a contents", "unexpected artifact contents")
+	Assert(t).IsNil(artifact.Close(), "should have closed the artifact")
+}
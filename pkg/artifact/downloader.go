@@ -9,6 +9,7 @@ import (
 
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/gzip"
+	"github.com/square/p2/pkg/tracing"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
 )
@@ -18,41 +19,93 @@ type Downloader interface {
 	// Downloads the artifact represented by the Downloader to the
 	// specified path and transfers file ownership to the specified user
 	Download(location *url.URL, verificationData auth.VerificationData, destination string, owner string) error
+
+	// Fetches the artifact and checks it with the verifier without
+	// extracting it anywhere. The fetched copy is removed afterward.
+	Verify(location *url.URL, verificationData auth.VerificationData) error
 }
 
 // Implements the Downloader interface. Simply fetches a .tar.gz file from a
 // configured URL and extracts it to the location passed to DownloadTo
 type downloader struct {
-	fetcher  uri.Fetcher
-	verifier auth.ArtifactVerifier
+	fetcher    uri.Fetcher
+	verifier   auth.ArtifactVerifier
+	extraction gzip.Options
+	span       *tracing.Span
 }
 
-func NewLocationDownloader(fetcher uri.Fetcher, verifier auth.ArtifactVerifier) Downloader {
+// NewLocationDownloader returns a Downloader that fetches artifacts with
+// fetcher and extracts them according to extraction. Fetches and extractions
+// are recorded as spans under span, which may be nil.
+func NewLocationDownloader(fetcher uri.Fetcher, verifier auth.ArtifactVerifier, extraction gzip.Options, span *tracing.Span) Downloader {
 	return &downloader{
-		fetcher:  fetcher,
-		verifier: verifier,
+		fetcher:    fetcher,
+		verifier:   verifier,
+		extraction: extraction,
+		span:       span,
 	}
 }
 
 func (l *downloader) Download(location *url.URL, verificationData auth.VerificationData, dst string, owner string) error {
-	// Write to a temporary file for easy cleanup if the network transfer fails
-	// TODO: the end of the artifact URL may not always be suitable as a directory
-	// name
-	artifactFile, err := ioutil.TempFile("", filepath.Base(location.Path))
+	artifactFile, err := l.fetchAndVerify(location, verificationData)
 	if err != nil {
 		return err
 	}
 	defer os.Remove(artifactFile.Name())
 	defer artifactFile.Close()
 
-	remoteData, err := l.fetcher.Open(location)
+	err = artifactFile.Chmod(0644)
 	if err != nil {
 		return err
 	}
-	defer remoteData.Close()
-	_, err = io.Copy(artifactFile, remoteData)
+
+	span := l.span.Child("extract_artifact")
+	err = gzip.ExtractTarGzWithOptions(owner, artifactFile.Name(), dst, l.extraction)
+	span.End(err)
 	if err != nil {
-		return util.Errorf("Could not copy artifact locally: %v", err)
+		_ = os.RemoveAll(dst)
+		return util.Errorf("error while extracting artifact: %s", err)
+	}
+	return err
+}
+
+func (l *downloader) Verify(location *url.URL, verificationData auth.VerificationData) error {
+	artifactFile, err := l.fetchAndVerify(location, verificationData)
+	if err != nil {
+		return err
+	}
+	_ = artifactFile.Close()
+	return os.Remove(artifactFile.Name())
+}
+
+// fetchAndVerify copies the artifact to a temporary file and runs the verifier
+// on it. On success the caller is responsible for closing and removing the
+// returned file; on failure it has already been removed.
+func (l *downloader) fetchAndVerify(location *url.URL, verificationData auth.VerificationData) (*os.File, error) {
+	// Write to a temporary file for easy cleanup if the network transfer fails
+	// TODO: the end of the artifact URL may not always be suitable as a directory
+	// name
+	artifactFile, err := ioutil.TempFile("", filepath.Base(location.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.fetchTo(artifactFile, location, verificationData)
+	if err != nil {
+		_ = artifactFile.Close()
+		_ = os.Remove(artifactFile.Name())
+		return nil, err
+	}
+	return artifactFile, nil
+}
+
+func (l *downloader) fetchTo(artifactFile *os.File, location *url.URL, verificationData auth.VerificationData) error {
+	span := l.span.Child("fetch_artifact")
+	span.SetAttribute("artifact_url", traceableURL(location))
+	err := l.fetch(artifactFile, location)
+	span.End(err)
+	if err != nil {
+		return err
 	}
 	// rewind once so we can ask the verifier
 	_, err = artifactFile.Seek(0, os.SEEK_SET)
@@ -60,20 +113,31 @@ func (l *downloader) Download(location *url.URL, verificationData auth.Verificat
 		return util.Errorf("Could not reset artifact file position for verification: %v", err)
 	}
 
-	err = l.verifier.VerifyHoistArtifact(artifactFile, verificationData)
+	err = auth.CheckArtifactDigest(artifactFile, verificationData)
 	if err != nil {
 		return err
 	}
+	return l.verifier.VerifyHoistArtifact(artifactFile, verificationData)
+}
 
-	err = artifactFile.Chmod(0644)
+func (l *downloader) fetch(artifactFile *os.File, location *url.URL) error {
+	remoteData, err := l.fetcher.Open(location)
 	if err != nil {
 		return err
 	}
-
-	err = gzip.ExtractTarGz(owner, artifactFile.Name(), dst)
+	defer remoteData.Close()
+	_, err = io.Copy(artifactFile, remoteData)
 	if err != nil {
-		_ = os.RemoveAll(dst)
-		return util.Errorf("error while extracting artifact: %s", err)
+		return util.Errorf("Could not copy artifact locally: %v", err)
 	}
-	return err
+	return nil
+}
+
+// traceableURL returns location without the credentials or query parameters
+// it might carry, which shouldn't be exported with traces
+func traceableURL(location *url.URL) string {
+	traced := *location
+	traced.User = nil
+	traced.RawQuery = ""
+	return traced.String()
 }
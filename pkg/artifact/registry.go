@@ -8,6 +8,7 @@ import (
 
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/osversion"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
@@ -20,6 +21,7 @@ const (
 	osTag            = "os"
 	osVersionTag     = "os_version"
 	versionTag       = "version"
+	channelTag       = "channel"
 )
 
 // interface for running operations against an artifact registry.
@@ -28,22 +30,57 @@ type Registry interface {
 	// artifact can be fetched an a struct containing the locations of files that
 	// can be used to verify artifact integrity
 	LocationDataForLaunchable(podID types.PodID, launchableID launch.LaunchableID, stanza launch.LaunchableStanza) (*url.URL, auth.VerificationData, error)
+
+	// Returns the version of the artifact that a launchable's version
+	// stanza refers to: its ID, or the version its channel currently points
+	// to
+	ResolveVersion(podID types.PodID, launchableID launch.LaunchableID, version launch.LaunchableVersion) (launch.LaunchableVersionID, error)
+}
+
+// RegistryQuery is what a RegistryBackend is asked to resolve: a version or
+// channel of an artifact, for a node running OS at OSVersion
+type RegistryQuery struct {
+	PodID        types.PodID
+	ArtifactName launch.ArtifactName
+	// Exactly one of Version and Channel is set
+	Version   launch.LaunchableVersionID
+	Channel   string
+	OS        osversion.OS
+	OSVersion osversion.OSVersion
+	Tags      map[string]string
+}
+
+// A RegistryBackend answers queries for artifacts with where they can be
+// downloaded from. The response to a query for a channel must include the
+// version the channel points to.
+type RegistryBackend interface {
+	Resolve(query RegistryQuery) (RegistryResponse, error)
 }
 
 type registry struct {
-	registryURL       *url.URL
-	fetcher           uri.Fetcher
+	backend           RegistryBackend
 	osVersionDetector osversion.Detector
 }
 
+// NewRegistry returns a registry that queries the HTTP API at registryURL. If
+// registryURL is nil, only launchables with a location are supported.
 func NewRegistry(registryURL *url.URL, fetcher uri.Fetcher, osVersionDetector osversion.Detector) Registry {
+	var backend RegistryBackend
+	if registryURL != nil {
+		backend = NewHTTPRegistryBackend(registryURL, fetcher)
+	}
+	return NewRegistryWithBackend(backend, osVersionDetector)
+}
+
+// NewRegistryWithBackend returns a registry that resolves versions with
+// backend. If backend is nil, only launchables with a location are supported.
+func NewRegistryWithBackend(backend RegistryBackend, osVersionDetector osversion.Detector) Registry {
 	if osVersionDetector == nil {
 		osVersionDetector = osversion.DefaultDetector
 	}
 
 	return &registry{
-		registryURL:       registryURL,
-		fetcher:           fetcher,
+		backend:           backend,
 		osVersionDetector: osVersionDetector,
 	}
 }
@@ -62,11 +99,11 @@ func NewRegistry(registryURL *url.URL, fetcher uri.Fetcher, osVersionDetector os
 // manifest signature: ".manifest.sig"
 // build signature: ".sig"
 func (a registry) LocationDataForLaunchable(podID types.PodID, launchableID launch.LaunchableID, stanza launch.LaunchableStanza) (*url.URL, auth.VerificationData, error) {
-	if stanza.Location == "" && stanza.Version.ID == "" {
+	if stanza.Location == "" && !stanza.Version.IsSet() {
 		return nil, auth.VerificationData{}, util.Errorf("Launchable must provide either \"location\" or \"version\" fields")
 	}
 
-	if stanza.Location != "" && stanza.Version.ID != "" {
+	if stanza.Location != "" && stanza.Version.IsSet() {
 		return nil, auth.VerificationData{}, util.Errorf("Launchable must not provide both \"location\" and \"version\" fields")
 	}
 
@@ -81,54 +118,140 @@ func (a registry) LocationDataForLaunchable(podID types.PodID, launchableID laun
 		return location, verificationData, nil
 	}
 
-	if a.registryURL == nil {
-		return nil, auth.VerificationData{}, util.Errorf("No artifact registry configured and location field not present on launchable %s", launchableID)
+	registryResponse, err := a.resolve(podID, launchableID, stanza.Version)
+	if err != nil {
+		return nil, auth.VerificationData{}, err
+	}
+
+	// Require artifact URL to be present, other fields are optional but returned
+	if registryResponse.ArtifactLocation == "" {
+		return nil, auth.VerificationData{}, util.Errorf("No artifact url returned in registry response")
+	}
+	artifactURL, err := url.Parse(registryResponse.ArtifactLocation)
+	if err != nil {
+		return nil, auth.VerificationData{}, util.Errorf("Could not parse artifact url in registry response: %s", err)
+	}
+
+	authData, err := a.authDataFromRegistryResponse(registryResponse)
+	if err != nil {
+		return nil, auth.VerificationData{}, err
 	}
 
-	return a.fetchRegistryData(podID, launchableID, stanza.Version)
+	return artifactURL, authData, nil
 }
 
-type RegistryResponse struct {
-	ArtifactLocation          string `json:"location"`
-	ManifestLocation          string `json:"manifest_location"`
-	ManifestSignatureLocation string `json:"manifest_signature_location"`
-	BuildSignatureLocation    string `json:"signature_location"`
+func (a registry) ResolveVersion(podID types.PodID, launchableID launch.LaunchableID, version launch.LaunchableVersion) (launch.LaunchableVersionID, error) {
+	if version.Channel == "" {
+		return version.ID, nil
+	}
+
+	registryResponse, err := a.resolve(podID, launchableID, version)
+	if err != nil {
+		return "", err
+	}
+	if registryResponse.Version == "" {
+		return "", util.Errorf("No version returned in registry response for channel %q of %s", version.Channel, launchableID)
+	}
+	return launch.LaunchableVersionID(registryResponse.Version), nil
 }
 
-func (a registry) fetchRegistryData(podID types.PodID, launchableID launch.LaunchableID, version launch.LaunchableVersion) (*url.URL, auth.VerificationData, error) {
-	requestURL := &url.URL{
-		Path: fmt.Sprintf("%s/%s", discoverBasePath, podID),
+// resolve asks the backend about the artifact version refers to
+func (a registry) resolve(podID types.PodID, launchableID launch.LaunchableID, version launch.LaunchableVersion) (RegistryResponse, error) {
+	if version.ID != "" && version.Channel != "" {
+		return RegistryResponse{}, util.Errorf("Launchable %s must not provide both a version \"id\" and \"channel\"", launchableID)
 	}
-	query := url.Values{}
-	for key, val := range version.Tags {
-		query.Add(key, val)
+	if a.backend == nil {
+		return RegistryResponse{}, util.Errorf("No artifact registry configured and location field not present on launchable %s", launchableID)
 	}
 
 	os, osVersion, err := a.osVersionDetector.Version()
 	if err != nil {
-		return nil, auth.VerificationData{}, err
+		return RegistryResponse{}, err
+	}
+
+	artifactName := version.ArtifactOverride
+	if artifactName == "" {
+		artifactName = launch.ArtifactName(launchableID.String())
+	}
+	return a.backend.Resolve(RegistryQuery{
+		PodID:        podID,
+		ArtifactName: artifactName,
+		Version:      version.ID,
+		Channel:      version.Channel,
+		OS:           os,
+		OSVersion:    osVersion,
+		Tags:         version.Tags,
+	})
+}
+
+type RegistryResponse struct {
+	ArtifactLocation          string `json:"location" yaml:"location"`
+	ManifestLocation          string `json:"manifest_location" yaml:"manifest_location"`
+	ManifestSignatureLocation string `json:"manifest_signature_location" yaml:"manifest_signature_location"`
+	BuildSignatureLocation    string `json:"signature_location" yaml:"signature_location"`
+	// The version of the artifact, required in responses to queries for a
+	// channel
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// The hex sha256 digest of the artifact. If set, downloaded artifacts
+	// that don't match it are rejected.
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// Binary diffs that build the artifact from previous versions of it.
+	// They are only used if Digest is set.
+	Patches []RegistryPatch `json:"patches,omitempty" yaml:"patches,omitempty"`
+}
+
+// RegistryPatch is where a bsdiff patch that builds an artifact from the
+// artifact with the hex sha256 digest From can be downloaded
+type RegistryPatch struct {
+	From     string `json:"from" yaml:"from"`
+	Location string `json:"location" yaml:"location"`
+}
+
+type httpRegistryBackend struct {
+	registryURL *url.URL
+	fetcher     uri.Fetcher
+}
+
+// NewHTTPRegistryBackend returns a backend that queries the HTTP API at
+// registryURL with GET /discover/<pod>, passing the artifact name, OS and
+// version or channel of the query, as well as the query's tags, as URL
+// parameters. The response is a JSON RegistryResponse.
+func NewHTTPRegistryBackend(registryURL *url.URL, fetcher uri.Fetcher) RegistryBackend {
+	return httpRegistryBackend{
+		registryURL: registryURL,
+		fetcher:     fetcher,
+	}
+}
+
+func (h httpRegistryBackend) Resolve(registryQuery RegistryQuery) (RegistryResponse, error) {
+	requestURL := &url.URL{
+		Path: fmt.Sprintf("%s/%s", discoverBasePath, registryQuery.PodID),
+	}
+	query := url.Values{}
+	for key, val := range registryQuery.Tags {
+		query.Add(key, val)
 	}
 
-	if version.ArtifactOverride.String() != "" {
-		query.Add(artifactNameTag, version.ArtifactOverride.String())
+	query.Add(artifactNameTag, registryQuery.ArtifactName.String())
+	query.Add(osTag, registryQuery.OS.String())
+	query.Add(osVersionTag, registryQuery.OSVersion.String())
+	if registryQuery.Channel != "" {
+		query.Add(channelTag, registryQuery.Channel)
 	} else {
-		query.Add(artifactNameTag, launchableID.String())
+		query.Add(versionTag, registryQuery.Version.String())
 	}
-	query.Add(osTag, os.String())
-	query.Add(osVersionTag, osVersion.String())
-	query.Add(versionTag, version.ID.String())
 
 	requestURL.RawQuery = query.Encode()
 
-	data, err := a.fetcher.Open(a.registryURL.ResolveReference(requestURL))
+	data, err := h.fetcher.Open(h.registryURL.ResolveReference(requestURL))
 	if err != nil {
-		return nil, auth.VerificationData{}, err
+		return RegistryResponse{}, err
 	}
 	defer data.Close()
 
 	respBytes, err := ioutil.ReadAll(data)
 	if err != nil {
-		return nil, auth.VerificationData{}, util.Errorf("Could not read response from artifact registry: %s", err)
+		return RegistryResponse{}, util.Errorf("Could not read response from artifact registry: %s", err)
 	}
 
 	var registryResponse RegistryResponse
@@ -138,34 +261,19 @@ func (a registry) fetchRegistryData(podID types.PodID, launchableID launch.Launc
 		if l > 80 {
 			l = 80
 		}
-		return nil, auth.VerificationData{}, util.Errorf(
+		return RegistryResponse{}, util.Errorf(
 			"bad response from artifact registry: %s: %q",
 			err,
 			string(respBytes[:l]),
 		)
 	}
-
-	// Require artifact URL to be present, other fields are optional but returned
-	var artifactURL *url.URL
-	if registryResponse.ArtifactLocation == "" {
-		return nil, auth.VerificationData{}, util.Errorf("No artifact url returned in registry response")
-	} else {
-		artifactURL, err = url.Parse(registryResponse.ArtifactLocation)
-		if err != nil {
-			return nil, auth.VerificationData{}, util.Errorf("Could not parse artifact url in registry response: %s", err)
-		}
-	}
-
-	authData, err := a.authDataFromRegistryResponse(registryResponse)
-	if err != nil {
-		return nil, auth.VerificationData{}, err
-	}
-
-	return artifactURL, authData, nil
+	return registryResponse, nil
 }
 
 func (a registry) authDataFromRegistryResponse(registryResponse RegistryResponse) (auth.VerificationData, error) {
-	verificationData := auth.VerificationData{}
+	verificationData := auth.VerificationData{
+		ArtifactDigest: registryResponse.Digest,
+	}
 	if registryResponse.ManifestLocation != "" {
 		manifestURL, err := url.Parse(registryResponse.ManifestLocation)
 		if err != nil {
@@ -190,6 +298,20 @@ func (a registry) authDataFromRegistryResponse(registryResponse RegistryResponse
 		verificationData.BuildSignatureLocation = buildSignatureURL
 	}
 
+	for _, patch := range registryResponse.Patches {
+		if patch.From == "" {
+			return verificationData, util.Errorf("Patch in registry response has no base digest")
+		}
+		patchURL, err := url.Parse(patch.Location)
+		if err != nil {
+			return verificationData, util.Errorf("Couldn't parse patch URL from registry response: %s", err)
+		}
+		verificationData.Patches = append(verificationData.Patches, auth.ArtifactPatch{
+			BaseDigest: patch.From,
+			Location:   patchURL,
+		})
+	}
+
 	return verificationData, nil
 }
 
@@ -211,3 +333,33 @@ func VerificationDataForLocation(location *url.URL) auth.VerificationData {
 		BuildSignatureLocation:    buildSignatureLocation,
 	}
 }
+
+// ResolveChannels returns podManifest with the channel of each of its
+// launchables replaced by the version registry says the channel points to, so
+// that a deploy installs and launches a fixed version even if the channel
+// moves while it runs. podManifest itself is returned if none of its
+// launchables name a channel.
+func ResolveChannels(registry Registry, podManifest manifest.Manifest) (manifest.Manifest, error) {
+	stanzas := podManifest.GetLaunchableStanzas()
+	resolved := make(map[launch.LaunchableID]launch.LaunchableStanza, len(stanzas))
+	changed := false
+	for launchableID, stanza := range stanzas {
+		if stanza.Version.Channel != "" {
+			version, err := registry.ResolveVersion(podManifest.ID(), launchableID, stanza.Version)
+			if err != nil {
+				return nil, err
+			}
+			stanza.Version.ID = version
+			stanza.Version.Channel = ""
+			changed = true
+		}
+		resolved[launchableID] = stanza
+	}
+	if !changed {
+		return podManifest, nil
+	}
+
+	builder := podManifest.GetBuilder()
+	builder.SetLaunchables(resolved)
+	return builder.GetManifest(), nil
+}
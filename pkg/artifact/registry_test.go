@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/osversion"
 	"github.com/square/p2/pkg/uri"
 )
@@ -285,3 +286,118 @@ func TestDiscoveryArtifactOverride(t *testing.T) {
 		}
 	}
 }
+
+const testRegistryFile = `artifacts:
+  myapp:
+    channels:
+      stable: 1.2.3
+    versions:
+      1.2.3:
+        location: https://fileserver.com/myapp_1.2.3.tar.gz
+        digest: 0123abcd
+        patches:
+        - from: 4567cdef
+          location: https://fileserver.com/myapp_1.2.2_to_1.2.3.bsdiff
+`
+
+func staticRegistry(t *testing.T) (Registry, func()) {
+	f, err := ioutil.TempFile("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte(testRegistryFile))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRegistryWithBackend(NewStaticRegistryBackend(f.Name()), &fixedDetector{}), func() { os.Remove(f.Name()) }
+}
+
+func TestStaticRegistry(t *testing.T) {
+	registry, cleanup := staticRegistry(t)
+	defer cleanup()
+
+	for _, version := range []launch.LaunchableVersion{{ID: "1.2.3"}, {Channel: "stable"}} {
+		location, verificationData, err := registry.LocationDataForLaunchable("pod_id", "myapp", launch.LaunchableStanza{Version: version})
+		if err != nil {
+			t.Fatalf("Unexpected error getting location data for %+v: %s", version, err)
+		}
+		if location.String() != "https://fileserver.com/myapp_1.2.3.tar.gz" {
+			t.Errorf("Wrong location for %+v: %s", version, location)
+		}
+		if verificationData.ArtifactDigest != "0123abcd" {
+			t.Errorf("Wrong digest for %+v: %q", version, verificationData.ArtifactDigest)
+		}
+		if len(verificationData.Patches) != 1 || verificationData.Patches[0].BaseDigest != "4567cdef" || verificationData.Patches[0].Location.String() != "https://fileserver.com/myapp_1.2.2_to_1.2.3.bsdiff" {
+			t.Errorf("Wrong patches for %+v: %+v", version, verificationData.Patches)
+		}
+	}
+
+	resolved, err := registry.ResolveVersion("pod_id", "myapp", launch.LaunchableVersion{Channel: "stable"})
+	if err != nil {
+		t.Fatalf("Unexpected error resolving channel: %s", err)
+	}
+	if resolved != "1.2.3" {
+		t.Errorf("Expected the channel to resolve to 1.2.3, was %q", resolved)
+	}
+
+	for _, version := range []launch.LaunchableVersion{{ID: "9.9.9"}, {Channel: "beta"}, {ID: "1.2.3", ArtifactOverride: "otherapp"}} {
+		_, _, err = registry.LocationDataForLaunchable("pod_id", "myapp", launch.LaunchableStanza{Version: version})
+		if err == nil {
+			t.Errorf("Expected an error for %+v, which is not in the registry file", version)
+		}
+	}
+}
+
+func TestResolveChannels(t *testing.T) {
+	registry, cleanup := staticRegistry(t)
+	defer cleanup()
+
+	builder := manifest.NewBuilder()
+	builder.SetID("pod_id")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"myapp": {LaunchableType: "hoist", Version: launch.LaunchableVersion{Channel: "stable"}},
+		"other": locationLaunchable(),
+	})
+	podManifest := builder.GetManifest()
+
+	resolved, err := ResolveChannels(registry, podManifest)
+	if err != nil {
+		t.Fatalf("Unexpected error resolving channels: %s", err)
+	}
+	stanza := resolved.GetLaunchableStanzas()["myapp"]
+	if stanza.Version.ID != "1.2.3" || stanza.Version.Channel != "" {
+		t.Errorf("Expected the channel to be replaced by its version, got %+v", stanza.Version)
+	}
+	if resolved.GetLaunchableStanzas()["other"].Location != testLocation {
+		t.Error("Expected the launchable without a channel to be unchanged")
+	}
+	if podManifest.GetLaunchableStanzas()["myapp"].Version.Channel != "stable" {
+		t.Error("Expected the original manifest to be unchanged")
+	}
+
+	unchanged, err := ResolveChannels(registry, resolved)
+	if err != nil {
+		t.Fatalf("Unexpected error resolving channels: %s", err)
+	}
+	if unchanged != resolved {
+		t.Error("Expected a manifest without channels to be returned as is")
+	}
+}
+
+func TestDiscoveryChannel(t *testing.T) {
+	fakeFetcher := &FakeFetcher{Data: []byte(`{"location": "/path/to/artifact", "version": "1.2.3"}`)}
+	registry := NewRegistry(&url.URL{Scheme: "https", Host: "registryhost.com"}, fakeFetcher, &fixedDetector{})
+
+	resolved, err := registry.ResolveVersion("pod_id", "launchable_id", launch.LaunchableVersion{Channel: "stable"})
+	if err != nil {
+		t.Fatalf("Unexpected error resolving channel: %s", err)
+	}
+	if resolved != "1.2.3" {
+		t.Errorf("Expected the channel to resolve to 1.2.3, was %q", resolved)
+	}
+	query := fakeFetcher.FetchedURL.Query()
+	if query.Get("channel") != "stable" || query.Get("version") != "" {
+		t.Errorf("Expected the channel and no version to be passed, got %s", fakeFetcher.FetchedURL.RawQuery)
+	}
+}
@@ -0,0 +1,76 @@
+package artifact
+
+import (
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/util"
+)
+
+// StaticRegistryFile is the format of the file read by a static registry
+// backend, e.g.
+//
+//	artifacts:
+//	  myapp:
+//	    channels:
+//	      stable: 1.2.3
+//	    versions:
+//	      1.2.3:
+//	        location: https://artifacts.example.com/myapp_1.2.3.tar.gz
+//	        digest: <hex sha256>
+type StaticRegistryFile struct {
+	Artifacts map[launch.ArtifactName]StaticArtifact `yaml:"artifacts"`
+}
+
+// StaticArtifact lists the versions of an artifact in a static registry file
+type StaticArtifact struct {
+	// The version each channel points to
+	Channels map[string]launch.LaunchableVersionID `yaml:"channels,omitempty"`
+	// Where each version can be downloaded from. The responses' version
+	// field is filled in from the version they are listed under.
+	Versions map[launch.LaunchableVersionID]RegistryResponse `yaml:"versions"`
+}
+
+type staticRegistryBackend struct {
+	path string
+}
+
+// NewStaticRegistryBackend returns a backend that looks artifacts up in the
+// StaticRegistryFile at path. The file is read again for every query, so
+// that promoting a version to a channel only requires editing it. Queries'
+// OS and tags are ignored.
+func NewStaticRegistryBackend(path string) RegistryBackend {
+	return staticRegistryBackend{path: path}
+}
+
+func (s staticRegistryBackend) Resolve(query RegistryQuery) (RegistryResponse, error) {
+	contents, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return RegistryResponse{}, util.Errorf("Could not read artifact registry file: %s", err)
+	}
+	var registryFile StaticRegistryFile
+	err = yaml.Unmarshal(contents, &registryFile)
+	if err != nil {
+		return RegistryResponse{}, util.Errorf("Could not parse artifact registry file %s: %s", s.path, err)
+	}
+
+	artifact, ok := registryFile.Artifacts[query.ArtifactName]
+	if !ok {
+		return RegistryResponse{}, util.Errorf("Artifact %s is not in the artifact registry file %s", query.ArtifactName, s.path)
+	}
+	version := query.Version
+	if query.Channel != "" {
+		version, ok = artifact.Channels[query.Channel]
+		if !ok {
+			return RegistryResponse{}, util.Errorf("Artifact %s has no channel %q in the artifact registry file %s", query.ArtifactName, query.Channel, s.path)
+		}
+	}
+	response, ok := artifact.Versions[version]
+	if !ok {
+		return RegistryResponse{}, util.Errorf("Artifact %s has no version %q in the artifact registry file %s", query.ArtifactName, version, s.path)
+	}
+	response.Version = version.String()
+	return response, nil
+}
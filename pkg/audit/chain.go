@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// A Recorder records audit events, such as to a Chain
+type Recorder interface {
+	Record(eventType EventType, eventDetails json.RawMessage) error
+}
+
+// A ChainEntry is an audit record of a hash chain. Each entry's hash covers the
+// hash of the entry before it, so an entry can't be modified, removed or
+// inserted without changing the hashes of every entry after it, which the
+// chain's signed Checkpoints detect.
+type ChainEntry struct {
+	Seq          uint64          `json:"seq"`
+	PrevHash     string          `json:"prev_hash"`
+	EventType    EventType       `json:"event_type"`
+	EventDetails json.RawMessage `json:"event_details"`
+	Timestamp    time.Time       `json:"timestamp"`
+	Hash         string          `json:"hash"`
+}
+
+// ChainHead identifies the last entry of a chain. The head of an empty chain
+// is the zero ChainHead.
+type ChainHead struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// NewChainEntry returns the entry of an event that follows head
+func NewChainEntry(head ChainHead, eventType EventType, eventDetails json.RawMessage, timestamp time.Time) (ChainEntry, error) {
+	// details are hashed as they will be stored, which is compacted
+	var details bytes.Buffer
+	err := json.Compact(&details, eventDetails)
+	if err != nil {
+		return ChainEntry{}, util.Errorf("invalid details of %s audit event: %s", eventType, err)
+	}
+	entry := ChainEntry{
+		Seq:          head.Seq + 1,
+		PrevHash:     head.Hash,
+		EventType:    eventType,
+		EventDetails: json.RawMessage(details.Bytes()),
+		Timestamp:    timestamp.UTC(),
+	}
+	entry.Hash = entry.computeHash()
+	return entry, nil
+}
+
+// Head returns the head of the chain that ends with the entry
+func (e ChainEntry) Head() ChainHead {
+	return ChainHead{Seq: e.Seq, Hash: e.Hash}
+}
+
+func (e ChainEntry) computeHash() string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d\n%s\n%s\n%s\n", e.Seq, e.PrevHash, e.EventType, e.Timestamp.UTC().Format(time.RFC3339Nano))
+	_, _ = hash.Write(e.EventDetails)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// A Checkpoint is a signature of a chain's head. An entry at or before a
+// checkpoint can't be modified or removed, and the chain can't be truncated
+// before it, without the verifier noticing, unless the checkpoint is removed
+// too. Entries after the latest checkpoint are only as safe as the store.
+type Checkpoint struct {
+	ChainHead
+	Timestamp time.Time `json:"timestamp"`
+	// Signature is a detached signature of SignedBytes()
+	Signature []byte `json:"signature"`
+}
+
+// NewCheckpoint returns the checkpoint of head, signed by signer, whose
+// private key must be decrypted
+func NewCheckpoint(head ChainHead, signer *openpgp.Entity) (Checkpoint, error) {
+	checkpoint := Checkpoint{ChainHead: head, Timestamp: time.Now().UTC()}
+	var signature bytes.Buffer
+	err := openpgp.DetachSign(&signature, signer, bytes.NewReader(checkpoint.SignedBytes()), nil)
+	if err != nil {
+		return Checkpoint{}, util.Errorf("could not sign audit checkpoint %d: %s", head.Seq, err)
+	}
+	checkpoint.Signature = signature.Bytes()
+	return checkpoint, nil
+}
+
+// SignedBytes returns what the checkpoint's signature is of
+func (c Checkpoint) SignedBytes() []byte {
+	return []byte(fmt.Sprintf("p2 audit checkpoint\nseq: %d\nhash: %s\ntimestamp: %s\n", c.Seq, c.Hash, c.Timestamp.UTC().Format(time.RFC3339Nano)))
+}
+
+// A Chain is the stored state of an audit chain
+type Chain struct {
+	// Head is the head recorded by the store, which is moved each time an
+	// entry is appended
+	Head ChainHead
+	// Entries are in order of Seq
+	Entries []ChainEntry
+	// Checkpoints are in order of Seq
+	Checkpoints []Checkpoint
+}
+
+// VerifiedChain describes a chain that verified
+type VerifiedChain struct {
+	Head ChainHead
+	// LastCheckpoint is the latest checkpoint, nil if there is none
+	LastCheckpoint *Checkpoint
+}
+
+// VerifyChain returns an error if an entry of chain was modified, inserted or
+// removed, if the chain was truncated, or if a checkpoint isn't signed by a
+// key of keyring or doesn't match the chain.
+func VerifyChain(chain Chain, keyring openpgp.KeyRing) (VerifiedChain, error) {
+	head := ChainHead{}
+	for _, entry := range chain.Entries {
+		if entry.Seq != head.Seq+1 {
+			return VerifiedChain{}, util.Errorf("audit chain has entry %d after entry %d: entries were removed or inserted", entry.Seq, head.Seq)
+		}
+		if entry.PrevHash != head.Hash || entry.computeHash() != entry.Hash {
+			return VerifiedChain{}, util.Errorf("audit chain entry %d was modified", entry.Seq)
+		}
+		head = entry.Head()
+	}
+	if chain.Head.Seq > head.Seq {
+		return VerifiedChain{}, util.Errorf("audit chain was truncated: its head is entry %d, but its last entry is %d", chain.Head.Seq, head.Seq)
+	}
+	if chain.Head != head {
+		return VerifiedChain{}, util.Errorf("audit chain's head %d doesn't match its last entry %d", chain.Head.Seq, head.Seq)
+	}
+
+	var last *Checkpoint
+	for i, checkpoint := range chain.Checkpoints {
+		_, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(checkpoint.SignedBytes()), bytes.NewReader(checkpoint.Signature))
+		if err != nil {
+			return VerifiedChain{}, util.Errorf("audit checkpoint %d is not signed by a checkpoint key: %s", checkpoint.Seq, err)
+		}
+		if checkpoint.Seq > head.Seq {
+			return VerifiedChain{}, util.Errorf("audit chain was truncated: it was checkpointed at entry %d, but its last entry is %d", checkpoint.Seq, head.Seq)
+		}
+		if checkpoint.Seq > 0 && chain.Entries[checkpoint.Seq-1].Hash != checkpoint.Hash {
+			return VerifiedChain{}, util.Errorf("audit chain entry %d doesn't match its checkpoint: entries were modified", checkpoint.Seq)
+		}
+		last = &chain.Checkpoints[i]
+	}
+	return VerifiedChain{Head: head, LastCheckpoint: last}, nil
+}
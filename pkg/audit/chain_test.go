@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func testChain(t *testing.T, events int, signer *openpgp.Entity) Chain {
+	var chain Chain
+	for i := 0; i < events; i++ {
+		entry, err := NewChainEntry(chain.Head, "some_event", json.RawMessage(`{ "some": "details" }`), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain.Entries = append(chain.Entries, entry)
+		chain.Head = entry.Head()
+		if i == 2 {
+			checkpoint, err := NewCheckpoint(chain.Head, signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain.Checkpoints = append(chain.Checkpoints, checkpoint)
+		}
+	}
+	return chain
+}
+
+func TestVerifyChain(t *testing.T) {
+	signer, err := openpgp.NewEntity("checkpointer", "", "checkpointer@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := openpgp.EntityList{signer}
+
+	verified, err := VerifyChain(testChain(t, 5, signer), keyring)
+	if err != nil {
+		t.Fatalf("untouched chain should verify: %s", err)
+	}
+	if verified.Head.Seq != 5 || verified.LastCheckpoint == nil || verified.LastCheckpoint.Seq != 3 {
+		t.Errorf("expected a chain of 5 entries checkpointed at 3, got %+v", verified)
+	}
+
+	for _, c := range []struct {
+		desc   string
+		tamper func(chain *Chain)
+		err    string
+	}{
+		{"modified entry", func(chain *Chain) {
+			chain.Entries[1].EventDetails = json.RawMessage(`{"some":"other details"}`)
+		}, "modified"},
+		{"rehashed modified entry", func(chain *Chain) {
+			chain.Entries[1].EventType = "other_event"
+			chain.Entries[1].Hash = chain.Entries[1].computeHash()
+		}, "modified"},
+		{"removed entry", func(chain *Chain) {
+			chain.Entries = append(chain.Entries[:1], chain.Entries[2:]...)
+		}, "removed or inserted"},
+		{"truncated entries", func(chain *Chain) {
+			chain.Entries = chain.Entries[:4]
+		}, "truncated"},
+		{"truncated entries and head", func(chain *Chain) {
+			chain.Entries = chain.Entries[:2]
+			chain.Head = chain.Entries[1].Head()
+		}, "truncated"},
+		{"rewritten checkpointed entries", func(chain *Chain) {
+			rewritten := testChain(t, 5, signer)
+			chain.Entries, chain.Head = rewritten.Entries, rewritten.Head
+		}, "doesn't match its checkpoint"},
+		{"checkpoint of another key", func(chain *Chain) {
+			checkpoint, err := NewCheckpoint(chain.Head, other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain.Checkpoints = append(chain.Checkpoints, checkpoint)
+		}, "not signed by a checkpoint key"},
+	} {
+		chain := testChain(t, 5, signer)
+		c.tamper(&chain)
+		_, err = VerifyChain(chain, keyring)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.desc, c.err, err)
+		}
+	}
+}
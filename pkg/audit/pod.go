@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"encoding/json"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// PodScheduledEvent represents a pod manifest being written to the
+	// intent tree of a node along with the pod's labels
+	PodScheduledEvent EventType = "POD_SCHEDULED"
+
+	// PodUnscheduledEvent represents a pod being removed from the intent
+	// tree of a node along with the pod's labels
+	PodUnscheduledEvent EventType = "POD_UNSCHEDULED"
+)
+
+type PodScheduleDetails struct {
+	PodID    types.PodID       `json:"pod_id"`
+	Node     types.NodeName    `json:"node"`
+	User     string            `json:"user"`
+	Manifest string            `json:"manifest,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+func NewPodScheduledEventDetails(
+	node types.NodeName,
+	manifest manifest.Manifest,
+	podLabels map[string]string,
+	user string,
+) (json.RawMessage, error) {
+	manifestBytes, err := manifest.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalPodScheduleDetails(PodScheduleDetails{
+		PodID:    manifest.ID(),
+		Node:     node,
+		User:     user,
+		Manifest: string(manifestBytes),
+		Labels:   podLabels,
+	})
+}
+
+func NewPodUnscheduledEventDetails(
+	node types.NodeName,
+	podID types.PodID,
+	user string,
+) (json.RawMessage, error) {
+	return marshalPodScheduleDetails(PodScheduleDetails{
+		PodID: podID,
+		Node:  node,
+		User:  user,
+	})
+}
+
+func marshalPodScheduleDetails(details PodScheduleDetails) (json.RawMessage, error) {
+	bytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal pod schedule details as json: %s", err)
+	}
+
+	return json.RawMessage(bytes), nil
+}
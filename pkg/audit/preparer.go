@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"encoding/json"
+
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// ManifestAuthorizedEvent represents a preparer authorizing a manifest
+	// of its intent to be deployed
+	ManifestAuthorizedEvent EventType = "MANIFEST_AUTHORIZED"
+
+	// ManifestRefusedEvent represents a preparer refusing to deploy a
+	// manifest of its intent
+	ManifestRefusedEvent EventType = "MANIFEST_REFUSED"
+
+	// ArtifactVerificationFailedEvent represents an artifact of a pod
+	// failing verification, whether or not the verification policy let it
+	// be installed anyway
+	ArtifactVerificationFailedEvent EventType = "ARTIFACT_VERIFICATION_FAILED"
+
+	// PolicyReloadEvent represents a preparer reloading its config, which
+	// includes its auth policies
+	PolicyReloadEvent EventType = "POLICY_RELOAD"
+)
+
+type ManifestAuthorizationDetails struct {
+	Node        types.NodeName `json:"node"`
+	PodID       types.PodID    `json:"pod_id"`
+	ManifestSHA string         `json:"manifest_sha"`
+	// Reason is why the manifest was refused
+	Reason string `json:"reason,omitempty"`
+}
+
+func NewManifestAuthorizationEventDetails(
+	node types.NodeName,
+	podID types.PodID,
+	manifestSHA string,
+	reason string,
+) (json.RawMessage, error) {
+	return marshalDetails("manifest authorization", ManifestAuthorizationDetails{
+		Node:        node,
+		PodID:       podID,
+		ManifestSHA: manifestSHA,
+		Reason:      reason,
+	})
+}
+
+type ArtifactVerificationFailureDetails struct {
+	Node   types.NodeName `json:"node"`
+	PodID  types.PodID    `json:"pod_id"`
+	Policy string         `json:"policy"`
+	Error  string         `json:"error"`
+}
+
+func NewArtifactVerificationFailureEventDetails(
+	node types.NodeName,
+	podID types.PodID,
+	policy string,
+	verificationErr string,
+) (json.RawMessage, error) {
+	return marshalDetails("artifact verification failure", ArtifactVerificationFailureDetails{
+		Node:   node,
+		PodID:  podID,
+		Policy: policy,
+		Error:  verificationErr,
+	})
+}
+
+type PolicyReloadDetails struct {
+	Node types.NodeName `json:"node"`
+	// Applied are the config fields that changed and were applied. The
+	// keyrings of the auth policies are read again even if none were.
+	Applied []string `json:"applied"`
+}
+
+func NewPolicyReloadEventDetails(node types.NodeName, applied []string) (json.RawMessage, error) {
+	return marshalDetails("policy reload", PolicyReloadDetails{
+		Node:    node,
+		Applied: applied,
+	})
+}
+
+func marshalDetails(event string, details interface{}) (json.RawMessage, error) {
+	bytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal %s details as json: %s", event, err)
+	}
+	return json.RawMessage(bytes), nil
+}
@@ -32,6 +32,25 @@ type VerificationData struct {
 
 	// Used by BuildVerifier
 	BuildSignatureLocation *url.URL
+
+	// The hex sha256 digest the artifact must have, if the artifact
+	// registry provided one. Checked by CheckArtifactDigest.
+	ArtifactDigest string
+
+	// Binary diffs that build the artifact from previous versions of it,
+	// if the artifact registry provided any. They are only used along with
+	// ArtifactDigest, so that an artifact built from a patch is known to
+	// be the one that would have been downloaded.
+	Patches []ArtifactPatch
+}
+
+// ArtifactPatch is a binary diff in the bsdiff format that builds an
+// artifact from a previous version of it, so that only what changed between
+// the versions needs to be downloaded
+type ArtifactPatch struct {
+	// The hex sha256 digest of the artifact the patch applies to
+	BaseDigest string
+	Location   *url.URL
 }
 
 // The artifact verifier is responsible for checking that the artifact
@@ -72,6 +91,15 @@ func NewCompositeVerifier(keyringPath string, fetcher uri.Fetcher, logger *loggi
 	}, nil
 }
 
+// NewKeyringCompositeVerifier returns a CompositeVerifier of signatures by
+// the keys of keyring, such as the keys of a KMS
+func NewKeyringCompositeVerifier(keyring openpgp.KeyRing, fetcher uri.Fetcher, logger *logging.Logger) *CompositeVerifier {
+	return &CompositeVerifier{
+		manVerifier:   NewKeyringBuildManifestVerifier(keyring, fetcher, logger),
+		buildVerifier: NewKeyringBuildVerifier(keyring, fetcher, logger),
+	}
+}
+
 // Attempt manifest verification. If it fails, fallback to the build verifier.
 func (b *CompositeVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
 	err := b.manVerifier.VerifyHoistArtifact(localCopy, verificationData)
@@ -117,11 +145,17 @@ func NewBuildManifestVerifier(keyringPath string, fetcher uri.Fetcher, logger *l
 	if err != nil {
 		return nil, util.Errorf("Could not load artifact verification keyring from %v: %v", keyringPath, err)
 	}
+	return NewKeyringBuildManifestVerifier(keyring, fetcher, logger), nil
+}
+
+// NewKeyringBuildManifestVerifier returns a BuildManifestVerifier of signatures by the keys of
+// keyring, such as the keys of a KMS
+func NewKeyringBuildManifestVerifier(keyring openpgp.KeyRing, fetcher uri.Fetcher, logger *logging.Logger) *BuildManifestVerifier {
 	return &BuildManifestVerifier{
 		keyring: keyring,
 		fetcher: fetcher,
 		logger:  logger,
-	}, nil
+	}
 }
 
 // Returns an error if the stanza's artifact is not signed appropriately. Note that this
@@ -229,11 +263,17 @@ func NewBuildVerifier(keyringPath string, fetcher uri.Fetcher, logger *logging.L
 	if err != nil {
 		return nil, util.Errorf("Could not load artifact verification keyring from %v: %v", keyringPath, err)
 	}
+	return NewKeyringBuildVerifier(keyring, fetcher, logger), nil
+}
+
+// NewKeyringBuildVerifier returns a BuildVerifier of signatures by the keys of
+// keyring, such as the keys of a KMS
+func NewKeyringBuildVerifier(keyring openpgp.KeyRing, fetcher uri.Fetcher, logger *logging.Logger) *BuildVerifier {
 	return &BuildVerifier{
 		keyring: keyring,
 		fetcher: fetcher,
 		logger:  logger,
-	}, nil
+	}
 }
 
 // Verifies the artifact against a signature. If signatureLocation is nil, it is inferred by adding a ".sig"
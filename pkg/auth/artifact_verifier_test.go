@@ -162,3 +162,45 @@ func TestCompositeVerifierFailsBuildWithoutSigs(t *testing.T) {
 	}
 	testNotVerifiedWithFiles(t, []testFile{testArtifact, testManifest}, verifier)
 }
+
+func TestMemoizingVerifierVerifiesOncePerDigest(t *testing.T) {
+	buildVerifier, err := NewBuildVerifier(testKeyringPath(), uri.DefaultFetcher, &logging.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error getting public key: %v", err)
+	}
+	verifier := NewMemoizingVerifier(buildVerifier)
+
+	testDir := buildTestFileTree(t, []testFile{testArtifact, testBuildSig})
+	defer os.RemoveAll(testDir)
+	filePath := filepath.Join(testDir, string(testArtifact))
+	verificationData := VerificationDataForLocation(&url.URL{Scheme: "file", Path: filePath})
+	verify := func() error {
+		localCopy, err := os.Open(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localCopy.Close()
+		return verifier.VerifyHoistArtifact(localCopy, verificationData)
+	}
+
+	if err = verify(); err != nil {
+		t.Fatalf("Expected the artifact to pass verification, got: %v", err)
+	}
+	// the signature is not fetched again for the same artifact
+	if err = os.Remove(filepath.Join(testDir, string(testBuildSig))); err != nil {
+		t.Fatal(err)
+	}
+	if err = verify(); err != nil {
+		t.Fatalf("Expected the artifact's verification to be remembered, got: %v", err)
+	}
+
+	otherData := VerificationDataForLocation(&url.URL{Scheme: "file", Path: filePath + ".other"})
+	localCopy, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localCopy.Close()
+	if err = verifier.VerifyHoistArtifact(localCopy, otherData); err == nil {
+		t.Fatal("Expected the artifact to be verified again with different verification data")
+	}
+}
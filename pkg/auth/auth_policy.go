@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/errors"
@@ -22,6 +23,11 @@ const (
 	Null    = "none"
 	Keyring = "keyring"
 	User    = "user"
+	// KMS is the keyring policy with the keys of a KMS, see package
+	// auth/kms
+	KMS = "kms"
+	// Rules is the policy of a rule document, see RulePolicy
+	Rules = "rules"
 )
 
 // A Policy encapsulates the behavior a p2 node needs to authorize
@@ -97,11 +103,38 @@ func (p NullPolicy) Close() {
 // Assert that NullPolicy is a Policy
 var _ Policy = NullPolicy{}
 
+// A SignerQuorum requires a pod's manifest to be signed by at least Required
+// of Signers, which are key fingerprints, e.g. by both a developer and a
+// release engineer of a production pod. A manifest signed by several keys
+// carries each of their signatures in its signature block.
+type SignerQuorum struct {
+	Required int      `yaml:"required"`
+	Signers  []string `yaml:"signers"`
+}
+
+// Validate returns an error if the quorum can never or always be met, or
+// lists a signer more than once. Fingerprints are compared case-insensitively.
+func (q SignerQuorum) Validate() error {
+	seen := make(map[string]bool, len(q.Signers))
+	for _, signer := range q.Signers {
+		if seen[strings.ToUpper(signer)] {
+			return util.Errorf("signer %s is listed more than once in a signer quorum", signer)
+		}
+		seen[strings.ToUpper(signer)] = true
+	}
+	if q.Required < 1 || q.Required > len(q.Signers) {
+		return util.Errorf("a signer quorum must require between 1 and its %d signers, not %d", len(q.Signers), q.Required)
+	}
+	return nil
+}
+
 // The FixedKeyring policy holds one keyring. A pod is authorized to be
 // deployed iff:
-// 1. The manifest is signed by a key on the keyring, and
-// 2. If the pod ID has an authorization list, the signing key is on
-//    the list.
+// 1. The manifest is signed by a key on the keyring,
+// 2. If the pod ID has an authorization list, a signing key is on
+//    the list, and
+// 3. If the pod ID has a signer quorum, enough of its signers signed
+//    the manifest.
 //
 // Artifacts can optionally sign their contents. If no digest
 // signature is provided, the deployment is authorized. If a signature
@@ -109,17 +142,19 @@ var _ Policy = NullPolicy{}
 type FixedKeyringPolicy struct {
 	Keyring             openpgp.KeyRing
 	AuthorizedDeployers map[types.PodID][]string
+	SignerQuorums       map[types.PodID]SignerQuorum
 }
 
 func LoadKeyringPolicy(
 	keyringPath string,
 	authorizedDeployers map[types.PodID][]string,
+	signerQuorums map[types.PodID]SignerQuorum,
 ) (Policy, error) {
 	keyring, err := LoadKeyring(keyringPath)
 	if err != nil {
 		return nil, err
 	}
-	return FixedKeyringPolicy{keyring, authorizedDeployers}, nil
+	return FixedKeyringPolicy{keyring, authorizedDeployers, signerQuorums}, nil
 }
 
 func (p FixedKeyringPolicy) AuthorizeApp(manifest Manifest, logger logging.Logger) error {
@@ -127,28 +162,34 @@ func (p FixedKeyringPolicy) AuthorizeApp(manifest Manifest, logger logging.Logge
 	if signature == nil {
 		return Error{util.Errorf("received unsigned manifest (expected signature)"), nil}
 	}
-	signer, err := checkDetachedSignature(p.Keyring, plaintext, signature)
+	signers, err := checkDetachedSignatures(p.Keyring, plaintext, signature)
 	if err != nil {
 		return err
 	}
 
-	signerID := fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
-	logger.WithField("signer_key", signerID).Debugln("resolved manifest signature")
+	var signerIDs []string
+	for _, signer := range signers {
+		signerIDs = append(signerIDs, fingerprint(signer))
+	}
+	logger.WithField("signer_keys", signerIDs).Debugln("resolved manifest signatures")
 
 	// Check authorization for this package to be deployed by this
 	// key, if configured.
 	if len(p.AuthorizedDeployers[manifest.ID()]) > 0 {
-		found := false
-		for _, deployerID := range p.AuthorizedDeployers[manifest.ID()] {
-			if deployerID == signerID {
-				found = true
-				break
+		if countSigned(signerIDs, p.AuthorizedDeployers[manifest.ID()]) == 0 {
+			return Error{
+				util.Errorf("manifest signer not authorized to deploy " + string(manifest.ID())),
+				map[string]interface{}{"signer_keys": signerIDs},
 			}
 		}
-		if !found {
+	}
+
+	if quorum, ok := p.SignerQuorums[manifest.ID()]; ok {
+		signed := countSigned(signerIDs, quorum.Signers)
+		if signed < quorum.Required {
 			return Error{
-				util.Errorf("manifest signer not authorized to deploy " + string(manifest.ID())),
-				map[string]interface{}{"signer_key": signerID},
+				util.Errorf("manifest of %s is signed by %d of the %d required signers", manifest.ID(), signed, quorum.Required),
+				map[string]interface{}{"signer_keys": signerIDs},
 			}
 		}
 	}
@@ -156,6 +197,30 @@ func (p FixedKeyringPolicy) AuthorizeApp(manifest Manifest, logger logging.Logge
 	return nil
 }
 
+// countSigned returns how many distinct keyIDs are among signerIDs, comparing
+// fingerprints case-insensitively
+func countSigned(signerIDs []string, keyIDs []string) int {
+	count := 0
+	counted := make(map[string]bool, len(keyIDs))
+	for _, keyID := range keyIDs {
+		if counted[strings.ToUpper(keyID)] {
+			continue
+		}
+		for _, signerID := range signerIDs {
+			if strings.EqualFold(signerID, keyID) {
+				counted[strings.ToUpper(keyID)] = true
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+func fingerprint(entity *openpgp.Entity) string {
+	return fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+}
+
 func (p FixedKeyringPolicy) CheckDigest(digest Digest) error {
 	plaintext, signature := digest.SignatureData()
 	if signature == nil {
@@ -189,6 +254,50 @@ func signerKeyID(signature []byte) (uint64, error) {
 	}
 }
 
+// checkDetachedSignatures checks each signature packet of signature, which
+// may hold the signatures of several keys, returning the distinct keys whose
+// signatures are valid. Signatures that aren't valid, such as those of keys
+// not on the keyring, are ignored unless none are valid, in which case the
+// error of the first is returned.
+func checkDetachedSignatures(
+	keyring openpgp.KeyRing,
+	signed []byte,
+	signature []byte,
+) ([]*openpgp.Entity, error) {
+	var signers []*openpgp.Entity
+	var firstErr error
+	seen := make(map[string]bool)
+	reader := bytes.NewReader(signature)
+	for reader.Len() > 0 {
+		start := len(signature) - reader.Len()
+		_, err := packet.Read(reader)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = Error{util.Errorf("error validating signature: %s", err), nil}
+			}
+			break
+		}
+		signer, err := checkDetachedSignature(keyring, signed, signature[start:len(signature)-reader.Len()])
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if !seen[fingerprint(signer)] {
+			seen[fingerprint(signer)] = true
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) == 0 {
+		if firstErr == nil {
+			firstErr = Error{util.Errorf("error validating signature: no signatures found"), nil}
+		}
+		return nil, firstErr
+	}
+	return signers, nil
+}
+
 // Wrapper around openpgp.CheckDetachedSignature() that standardizes
 // the error messages.
 func checkDetachedSignature(
@@ -252,12 +361,14 @@ var _ Policy = FixedKeyringPolicy{}
 type FileKeyringPolicy struct {
 	KeyringFilename     string
 	AuthorizedDeployers map[types.PodID][]string
+	SignerQuorums       map[types.PodID]SignerQuorum
 	keyringWatcher      util.FileWatcher
 }
 
 func NewFileKeyringPolicy(
 	keyringPath string,
 	authorizedDeployers map[types.PodID][]string,
+	signerQuorums map[types.PodID]SignerQuorum,
 ) (Policy, error) {
 	watcher, err := util.NewFileWatcher(
 		func(path string) (interface{}, error) {
@@ -268,13 +379,14 @@ func NewFileKeyringPolicy(
 	if err != nil {
 		return nil, err
 	}
-	return FileKeyringPolicy{keyringPath, authorizedDeployers, watcher}, nil
+	return FileKeyringPolicy{keyringPath, authorizedDeployers, signerQuorums, watcher}, nil
 }
 
 func (p FileKeyringPolicy) AuthorizeApp(manifest Manifest, logger logging.Logger) error {
 	return FixedKeyringPolicy{
 		(<-p.keyringWatcher.GetAsync()).(openpgp.EntityList),
 		p.AuthorizedDeployers,
+		p.SignerQuorums,
 	}.AuthorizeApp(manifest, logger)
 }
 
@@ -282,6 +394,7 @@ func (p FileKeyringPolicy) CheckDigest(digest Digest) error {
 	return FixedKeyringPolicy{
 		(<-p.keyringWatcher.GetAsync()).(openpgp.EntityList),
 		p.AuthorizedDeployers,
+		p.SignerQuorums,
 	}.CheckDigest(digest)
 }
 
@@ -459,18 +572,20 @@ func (p UserPolicy) AuthorizePod(podUser string, manifest Signed, logger logging
 	keyring := (<-keyringChan).(openpgp.EntityList)
 	dpol := (<-dpolChan).(DeployPol)
 
-	signer, err := checkDetachedSignature(keyring, plaintext, signature)
+	signers, err := checkDetachedSignatures(keyring, plaintext, signature)
 	if err != nil {
 		return err
 	}
 
-	// Check if any of the signer's identities is authorized
+	// Check if any of the signers' identities is authorized
 	lastIDName := "(unknown)"
-	for name, id := range signer.Identities {
-		if dpol.Authorized(podUser, id.UserId.Email) {
-			return nil
+	for _, signer := range signers {
+		for name, id := range signer.Identities {
+			if dpol.Authorized(podUser, id.UserId.Email) {
+				return nil
+			}
+			lastIDName = name
 		}
-		lastIDName = name
 	}
 	return Error{util.Errorf("user %s is not authorized to deploy app as pod user: %s", lastIDName, podUser), nil}
 }
@@ -487,6 +602,7 @@ func (p UserPolicy) CheckDigest(digest Digest) error {
 	return FixedKeyringPolicy{
 		(<-p.keyringWatcher.GetAsync()).(openpgp.EntityList),
 		nil,
+		nil,
 	}.CheckDigest(digest)
 }
 
@@ -171,6 +171,7 @@ func TestKeyring(t *testing.T) {
 		map[types.PodID][]string{
 			"restricted": {fmt.Sprintf("%X", ents[1].PrimaryKey.Fingerprint)},
 		},
+		nil,
 	)
 	if err != nil {
 		t.Error("creating keyring policy:", err)
@@ -201,6 +202,87 @@ func TestKeyring(t *testing.T) {
 	}
 }
 
+// Test that a signer quorum requires enough of its signers to have
+// signed the manifest
+func TestSignerQuorum(t *testing.T) {
+	h := testHarness{}
+	msg := []byte("Sign here, and here")
+	ents := h.loadEntities()
+	sigs := h.signMessage(msg, ents)
+	if h.Err != nil {
+		t.Error(h.Err)
+		return
+	}
+	fingerprints := make([]string, len(ents))
+	for i, ent := range ents {
+		fingerprints[i] = fmt.Sprintf("%X", ent.PrimaryKey.Fingerprint)
+	}
+
+	policy := FixedKeyringPolicy{
+		Keyring: openpgp.EntityList(ents[:2]),
+		SignerQuorums: map[types.PodID]SignerQuorum{
+			"production": {Required: 2, Signers: fingerprints},
+		},
+	}
+	logger := logging.TestLogger()
+	cosigned := func(sigs ...[]byte) []byte {
+		return bytes.Join(sigs, nil)
+	}
+
+	err := policy.AuthorizeApp(TestSigned{"production", "production", msg, sigs[0]}, logger)
+	if err == nil {
+		t.Error("accepted a manifest signed by 1 of 2 required signers")
+	}
+	err = policy.AuthorizeApp(TestSigned{"production", "production", msg, cosigned(sigs[0], sigs[0])}, logger)
+	if err == nil {
+		t.Error("accepted a manifest signed twice by the same signer")
+	}
+	// ents[2] isn't on the keyring
+	err = policy.AuthorizeApp(TestSigned{"production", "production", msg, cosigned(sigs[0], sigs[2])}, logger)
+	if err == nil {
+		t.Error("accepted a signature of a key not on the keyring")
+	}
+	err = policy.AuthorizeApp(TestSigned{"production", "production", msg, cosigned(sigs[0], sigs[1])}, logger)
+	if err != nil {
+		t.Error("error authorizing manifest signed by both signers:", err)
+	}
+	err = policy.AuthorizeApp(TestSigned{"production", "production", msg, cosigned(sigs[2], sigs[1], sigs[0])}, logger)
+	if err != nil {
+		t.Error("error authorizing manifest signed by both signers and an unknown key:", err)
+	}
+
+	// pods without a quorum need only one signature
+	err = policy.AuthorizeApp(TestSigned{"staging", "staging", msg, cosigned(sigs[2], sigs[1])}, logger)
+	if err != nil {
+		t.Error("error authorizing manifest without a quorum:", err)
+	}
+
+	if (SignerQuorum{Required: 3, Signers: fingerprints[:2]}).Validate() == nil {
+		t.Error("accepted a quorum requiring more signers than it has")
+	}
+	if (SignerQuorum{Required: 0, Signers: fingerprints}).Validate() == nil {
+		t.Error("accepted a quorum requiring no signers")
+	}
+	duplicated := []string{fingerprints[0], strings.ToLower(fingerprints[0])}
+	if (SignerQuorum{Required: 2, Signers: duplicated}).Validate() == nil {
+		t.Error("accepted a quorum listing the same signer twice")
+	}
+
+	lower := []string{strings.ToLower(fingerprints[0]), strings.ToLower(fingerprints[1])}
+	policy.SignerQuorums["production"] = SignerQuorum{Required: 2, Signers: lower}
+	err = policy.AuthorizeApp(TestSigned{"production", "production", msg, cosigned(sigs[0], sigs[1])}, logger)
+	if err != nil {
+		t.Error("error authorizing manifest signed by both signers of a lower case quorum:", err)
+	}
+
+	// a duplicated signer counts once even if the quorum is not validated
+	policy.SignerQuorums["production"] = SignerQuorum{Required: 2, Signers: duplicated}
+	err = policy.AuthorizeApp(TestSigned{"production", "production", msg, sigs[0]}, logger)
+	if err == nil {
+		t.Error("accepted a manifest signed by a signer listed twice in its quorum")
+	}
+}
+
 // Test that FileKeyringPolicy can reload a keyring file when it
 // changes.
 func TestKeyAddition(t *testing.T) {
@@ -220,7 +302,7 @@ func TestKeyAddition(t *testing.T) {
 		return
 	}
 
-	policy, err := NewFileKeyringPolicy(keyfile, nil)
+	policy, err := NewFileKeyringPolicy(keyfile, nil, nil)
 	if err != nil {
 		t.Errorf("%s: error loading keyring: %s", keyfile, err)
 		return
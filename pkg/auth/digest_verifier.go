@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/square/p2/pkg/util"
+)
+
+type digestRecordingVerifier struct {
+	verifier ArtifactVerifier
+	onDigest func(string)
+}
+
+// NewDigestRecordingVerifier wraps verifier so that the hex sha256 digest of
+// every artifact it accepts is passed to onDigest, which makes it possible to
+// record which artifacts were actually installed.
+func NewDigestRecordingVerifier(verifier ArtifactVerifier, onDigest func(digest string)) ArtifactVerifier {
+	return &digestRecordingVerifier{
+		verifier: verifier,
+		onDigest: onDigest,
+	}
+}
+
+func (d *digestRecordingVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
+	digest, err := fileDigest(localCopy)
+	if err != nil {
+		return err
+	}
+
+	err = d.verifier.VerifyHoistArtifact(localCopy, verificationData)
+	if err != nil {
+		return err
+	}
+	d.onDigest(digest)
+	return nil
+}
+
+// CheckArtifactDigest returns an error if verificationData has an artifact
+// digest and localCopy's digest doesn't match it. localCopy is left at its
+// start.
+func CheckArtifactDigest(localCopy *os.File, verificationData VerificationData) error {
+	if verificationData.ArtifactDigest == "" {
+		return nil
+	}
+	digest, err := fileDigest(localCopy)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(digest, verificationData.ArtifactDigest) {
+		return util.Errorf("Artifact digest did not match the registry's: expected %s, was actually %s", verificationData.ArtifactDigest, digest)
+	}
+	return nil
+}
+
+// fileDigest returns the hex sha256 digest of localCopy, leaving it at its
+// start
+func fileDigest(localCopy *os.File) (string, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, localCopy)
+	if err != nil {
+		return "", util.Errorf("Could not read artifact to compute its digest: %s", err)
+	}
+	_, err = localCopy.Seek(0, os.SEEK_SET)
+	if err != nil {
+		return "", util.Errorf("Could not reset artifact file position after computing its digest: %s", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+type memoizingVerifier struct {
+	verifier ArtifactVerifier
+
+	mu       sync.Mutex
+	verified map[verifiedArtifact]bool
+}
+
+type verifiedArtifact struct {
+	digest                                 string
+	manifest, manifestSignature, signature string
+}
+
+// NewMemoizingVerifier wraps verifier so that an artifact is only verified
+// once per digest and verification data. Failures aren't remembered, so an
+// artifact that failed verification is verified again the next time.
+func NewMemoizingVerifier(verifier ArtifactVerifier) ArtifactVerifier {
+	return &memoizingVerifier{
+		verifier: verifier,
+		verified: make(map[verifiedArtifact]bool),
+	}
+}
+
+func (m *memoizingVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
+	digest, err := fileDigest(localCopy)
+	if err != nil {
+		return err
+	}
+	key := verifiedArtifact{
+		digest:            digest,
+		manifest:          urlString(verificationData.ManifestLocation),
+		manifestSignature: urlString(verificationData.ManifestSignatureLocation),
+		signature:         urlString(verificationData.BuildSignatureLocation),
+	}
+
+	m.mu.Lock()
+	verified := m.verified[key]
+	m.mu.Unlock()
+	if verified {
+		return nil
+	}
+
+	err = m.verifier.VerifyHoistArtifact(localCopy, verificationData)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.verified[key] = true
+	m.mu.Unlock()
+	return nil
+}
+
+func urlString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"golang.org/x/crypto/openpgp"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// IntentWriterPolicy authorizes the writer of a pod's intent to schedule the
+// pod on the node, so that the credentials of the scheduler of one service
+// can't be used to schedule arbitrary pods fleet-wide. Writers sign an
+// envelope around the intent they write, and Rules, whose signers are the
+// writers, list which pods each writer may schedule on which nodes.
+type IntentWriterPolicy struct {
+	// Keyring holds the keys of the writers
+	Keyring openpgp.KeyRing
+	Rules   RuleDocument
+	// Environment is the node's environment
+	Environment string
+	// NodeLabels returns the node's labels, for the rules' node selectors
+	NodeLabels func() (klabels.Labels, error)
+}
+
+// AuthorizeWriter returns an error unless envelope, the signed envelope of
+// the intent of podID, was signed by a writer that the rules allow to
+// schedule the pod on the node. The caller must check that the envelope is of
+// the intent, on the node.
+func (p IntentWriterPolicy) AuthorizeWriter(podID types.PodID, envelope Signed) error {
+	plaintext, signature := envelope.SignatureData()
+	if signature == nil {
+		return Error{util.Errorf("intent of %s is not signed by its writer", podID), nil}
+	}
+	writers, err := checkDetachedSignatures(p.Keyring, plaintext, signature)
+	if err != nil {
+		return err
+	}
+	var writerIDs []string
+	for _, writer := range writers {
+		writerIDs = append(writerIDs, fingerprint(writer))
+	}
+
+	allowed, err := p.Rules.Allows(writers, podID, p.Environment, p.NodeLabels)
+	if err != nil {
+		return Error{util.Errorf("could not check intent writer rules: %s", err), map[string]interface{}{"writer_keys": writerIDs}}
+	}
+	if !allowed {
+		return Error{
+			util.Errorf("no rule allows the intent's writer to schedule %s on this node", podID),
+			map[string]interface{}{"writer_keys": writerIDs},
+		}
+	}
+	return nil
+}
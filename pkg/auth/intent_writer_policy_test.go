@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/types"
+)
+
+func TestIntentWriterPolicy(t *testing.T) {
+	h := testHarness{}
+	ents := h.loadEntities()
+	envelope := []byte("p2 intent\nnode: node1\npod_id: teamx-web\n")
+	sigs := h.signMessage(envelope, ents[:2])
+	if h.Err != nil {
+		t.Fatal(h.Err)
+	}
+	policy := IntentWriterPolicy{
+		Keyring: openpgp.EntityList(ents[:2]),
+		Rules: RuleDocument{Rules: []Rule{
+			{Signers: []string{email(ents[0])}, Pods: []string{"teamx-*"}, NodeSelector: "team=x"},
+		}},
+		NodeLabels: nodeLabels(klabels.Set{"team": "x"}),
+	}
+
+	for _, c := range []struct {
+		desc       string
+		podID      types.PodID
+		plaintext  []byte
+		signature  []byte
+		authorized bool
+	}{
+		{"allowed writer", "teamx-web", envelope, sigs[0], true},
+		{"writer not allowed the pod", "teamy-web", envelope, sigs[0], false},
+		{"writer without a rule", "teamx-web", envelope, sigs[1], false},
+		{"unsigned intent", "teamx-web", envelope, nil, false},
+		{"signature of other data", "teamx-web", []byte("p2 intent\nnode: node2\n"), sigs[0], false},
+	} {
+		err := policy.AuthorizeWriter(c.podID, TestSigned{Plaintext: c.plaintext, Signature: c.signature})
+		if c.authorized && err != nil {
+			t.Errorf("%s: should have been authorized: %s", c.desc, err)
+		} else if !c.authorized && err == nil {
+			t.Errorf("%s: should not have been authorized", c.desc)
+		}
+	}
+
+	policy.NodeLabels = nodeLabels(klabels.Set{"team": "y"})
+	if policy.AuthorizeWriter("teamx-web", TestSigned{Plaintext: envelope, Signature: sigs[0]}) == nil {
+		t.Errorf("writer should not be authorized on a node its rule doesn't select")
+	}
+}
@@ -0,0 +1,121 @@
+package kms
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// hashNames are the names of the hashes that digests are signed with, in
+// requests to the KMS gateway
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA1:   "SHA1",
+	crypto.SHA224: "SHA224",
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
+}
+
+// HTTPClient is the Client of a KMS gateway, which fronts a cloud KMS or an
+// HSM with a JSON API:
+//
+//	GET  <url>/v1/keys   returns {"keys": [<Key>, ...]}
+//	POST <url>/v1/sign   with {"key_id": "...", "digest": "<base64>", "hash": "SHA256"}
+//	                     returns {"signature": "<base64>"}
+type HTTPClient struct {
+	url    *url.URL
+	client *http.Client
+}
+
+var _ Client = HTTPClient{}
+
+// NewHTTPClient returns the Client of the KMS gateway at gatewayURL, which it
+// makes requests to with client
+func NewHTTPClient(gatewayURL string, client *http.Client) (HTTPClient, error) {
+	parsed, err := url.Parse(gatewayURL)
+	if err != nil {
+		return HTTPClient{}, util.Errorf("invalid KMS URL %q: %s", gatewayURL, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return HTTPClient{}, util.Errorf("KMS URL %q must be http or https", gatewayURL)
+	}
+	return HTTPClient{url: parsed, client: client}, nil
+}
+
+func (c HTTPClient) endpoint(path string) string {
+	endpoint := *c.url
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + path
+	return endpoint.String()
+}
+
+func (c HTTPClient) Keys() ([]Key, error) {
+	var keys struct {
+		Keys []Key `json:"keys"`
+	}
+	resp, err := c.client.Get(c.endpoint("/v1/keys"))
+	if err != nil {
+		return nil, util.Errorf("could not list KMS keys: %s", err)
+	}
+	err = decodeResponse(resp, &keys)
+	if err != nil {
+		return nil, util.Errorf("could not list KMS keys: %s", err)
+	}
+	return keys.Keys, nil
+}
+
+func (c HTTPClient) Sign(keyID string, digest []byte, hash crypto.Hash) ([]byte, error) {
+	request := struct {
+		KeyID  string `json:"key_id"`
+		Digest []byte `json:"digest"`
+		Hash   string `json:"hash"`
+	}{
+		KeyID:  keyID,
+		Digest: digest,
+		Hash:   hashNames[hash],
+	}
+	if request.Hash == "" {
+		return nil, util.Errorf("the KMS can't sign digests of hash %d", hash)
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature struct {
+		Signature []byte `json:"signature"`
+	}
+	resp, err := c.client.Post(c.endpoint("/v1/sign"), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	err = decodeResponse(resp, &signature)
+	if err != nil {
+		return nil, err
+	}
+	if len(signature.Signature) == 0 {
+		return nil, util.Errorf("the KMS returned an empty signature")
+	}
+	return signature.Signature, nil
+}
+
+func decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return util.Errorf("KMS responded %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return util.Errorf("could not parse KMS response: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package kms
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultCacheTTL is how long the keys of a KMS are cached if Config doesn't
+// set CacheTTL
+const DefaultCacheTTL = 5 * time.Minute
+
+// refetchInterval is the least time between fetches of the keys of a KMS,
+// which are refetched before their TTL when a signature is of an unknown key,
+// in case it was just created, or when fetching them failed
+const refetchInterval = 30 * time.Second
+
+// Config configures the KMS that signing keys are read from, in the "kms" key
+// of the preparer's auth and artifact_auth
+type Config struct {
+	// URL of the KMS gateway, see HTTPClient
+	URL string `yaml:"url"`
+
+	// CacheTTL is how long the keys of the KMS are used before they are
+	// fetched again, 5m if unset. If they can't be fetched, the keys
+	// fetched last are used until they can.
+	CacheTTL time.Duration `yaml:"cache_ttl,omitempty"`
+
+	// CachePath, if set, is a file that the keys are saved to whenever they
+	// are fetched, so that signatures can be verified when the KMS is
+	// unreachable after a restart
+	CachePath string `yaml:"cache_path,omitempty"`
+}
+
+// A Keyring is an openpgp.KeyRing of the keys of a KMS, which are fetched
+// when the keyring is created and again whenever they are needed after the
+// CacheTTL.
+type Keyring struct {
+	client    Client
+	ttl       time.Duration
+	cachePath string
+	logger    logging.Logger
+
+	mu sync.Mutex
+	// keys were fetched at fetched, or read from the cache file
+	keys    openpgp.EntityList
+	fetched time.Time
+	// lastFetch is when the keys were last fetched, successfully or not
+	lastFetch time.Time
+	// refetchInterval is refetchInterval, but can be shortened by tests
+	refetchInterval time.Duration
+}
+
+var _ openpgp.KeyRing = &Keyring{}
+
+// NewKeyring returns the Keyring of client's keys. Its keys are read from
+// config.CachePath, if there is a file there, and fetched from the KMS. The
+// keyring is still returned if they can't be fetched, since they will be
+// fetched again when they are needed.
+func NewKeyring(client Client, config Config, logger logging.Logger) *Keyring {
+	k := &Keyring{
+		client:          client,
+		ttl:             config.CacheTTL,
+		cachePath:       config.CachePath,
+		logger:          logger.SubLogger(map[string]interface{}{"kms": config.URL}),
+		refetchInterval: refetchInterval,
+	}
+	if k.ttl <= 0 {
+		k.ttl = DefaultCacheTTL
+	}
+	if k.cachePath != "" {
+		err := k.readCache()
+		if err != nil && !os.IsNotExist(err) {
+			k.logger.WithError(err).Warnln("Could not read cached KMS keys")
+		}
+	}
+	k.mu.Lock()
+	k.fetch()
+	k.mu.Unlock()
+	return k
+}
+
+// Keys returns the keys of the KMS, fetching them if they are older than the
+// cache TTL
+func (k *Keyring) Keys() openpgp.EntityList {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if time.Since(k.fetched) >= k.ttl && time.Since(k.lastFetch) >= k.refetchInterval {
+		k.fetch()
+	}
+	return k.keys
+}
+
+func (k *Keyring) KeysById(id uint64) []openpgp.Key {
+	keys := k.Keys().KeysById(id)
+	if len(keys) == 0 && k.refetch() {
+		keys = k.Keys().KeysById(id)
+	}
+	return keys
+}
+
+func (k *Keyring) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.Key {
+	keys := k.Keys().KeysByIdUsage(id, requiredUsage)
+	if len(keys) == 0 && k.refetch() {
+		keys = k.Keys().KeysByIdUsage(id, requiredUsage)
+	}
+	return keys
+}
+
+// DecryptionKeys returns nothing, since the private keys of the KMS never
+// leave it
+func (k *Keyring) DecryptionKeys() []openpgp.Key {
+	return nil
+}
+
+// refetch fetches the keys, unless they were fetched within the refetch
+// interval, returning true if they were fetched
+func (k *Keyring) refetch() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if time.Since(k.lastFetch) < k.refetchInterval {
+		return false
+	}
+	return k.fetch()
+}
+
+// fetch replaces the keys with those of the KMS, keeping the keys it has if
+// they can't be fetched. It must be called with mu held.
+func (k *Keyring) fetch() bool {
+	k.lastFetch = time.Now()
+	keys, err := k.client.Keys()
+	if err != nil {
+		k.logger.WithError(err).Warnf("Could not fetch KMS keys, using the %d keys fetched at %s", len(k.keys), k.fetched)
+		return false
+	}
+	entities, err := entities(keys)
+	if err != nil {
+		k.logger.WithError(err).Warnf("Could not read KMS keys, using the %d keys fetched at %s", len(k.keys), k.fetched)
+		return false
+	}
+	k.keys = entities
+	k.fetched = k.lastFetch
+
+	if k.cachePath != "" {
+		err = k.writeCache(keys)
+		if err != nil {
+			k.logger.WithError(err).Warnln("Could not cache KMS keys")
+		}
+	}
+	return true
+}
+
+func entities(keys []Key) (openpgp.EntityList, error) {
+	var entities openpgp.EntityList
+	for _, key := range keys {
+		entity, err := key.Entity()
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
+
+type cachedKeys struct {
+	Fetched time.Time `json:"fetched"`
+	Keys    []Key     `json:"keys"`
+}
+
+func (k *Keyring) readCache() error {
+	data, err := ioutil.ReadFile(k.cachePath)
+	if err != nil {
+		return err
+	}
+	var cached cachedKeys
+	err = json.Unmarshal(data, &cached)
+	if err != nil {
+		return util.Errorf("could not parse %s: %s", k.cachePath, err)
+	}
+	entities, err := entities(cached.Keys)
+	if err != nil {
+		return err
+	}
+	k.keys = entities
+	k.fetched = cached.Fetched
+	return nil
+}
+
+// writeCache writes the keys to the cache file through a temporary file, so
+// that the cache file is never partly written
+func (k *Keyring) writeCache(keys []Key) error {
+	data, err := json.Marshal(cachedKeys{Fetched: k.fetched, Keys: keys})
+	if err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(k.cachePath), filepath.Base(k.cachePath))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if err != nil {
+		temp.Close()
+		return err
+	}
+	err = temp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), k.cachePath)
+}
@@ -0,0 +1,221 @@
+// Package kms verifies and makes the OpenPGP signatures of manifests and
+// artifacts with keys that are kept in a key management service or HSM, so
+// that private keys never live on disk in keyring files.
+//
+// Preparers verify signatures with a Keyring of the public keys that the KMS
+// lists, which are cached so that signatures can still be verified while the
+// KMS is unreachable. Build pipelines sign with a SigningEntity, whose
+// signatures are made by the KMS, using the usual openpgp functions.
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// A Key is a signing key of the KMS. Its OpenPGP fingerprint is derived from
+// its public key and creation time, so it is the same for everyone that reads
+// it from the KMS and can be listed in authorized_deployers and signer
+// quorums like the fingerprints of keys on keyrings.
+type Key struct {
+	// ID names the key in the KMS
+	ID string `json:"id"`
+	// PublicKey is the PEM encoded PKIX public key, which is RSA or ECDSA
+	PublicKey string `json:"public_key"`
+	// Created is when the key was created. It must not change, since it is
+	// part of the key's fingerprint.
+	Created time.Time `json:"created"`
+	// Email, if set, is the email address of the key's owner
+	Email string `json:"email,omitempty"`
+}
+
+// Client is the API of a KMS
+type Client interface {
+	// Keys returns the keys whose signatures are trusted
+	Keys() ([]Key, error)
+
+	// Sign signs digest, the hash of the signed data made with hash, with
+	// the private key of keyID. RSA signatures are PKCS #1 v1.5 and ECDSA
+	// ones are ASN.1 encoded.
+	Sign(keyID string, digest []byte, hash crypto.Hash) ([]byte, error)
+}
+
+func (k Key) cryptoPublicKey() (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(k.PublicKey))
+	if block == nil {
+		return nil, util.Errorf("public key of KMS key %s is not PEM encoded", k.ID)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, util.Errorf("could not parse public key of KMS key %s: %s", k.ID, err)
+	}
+	return publicKey, nil
+}
+
+func (k Key) openpgpPublicKey() (*packet.PublicKey, error) {
+	if k.Created.IsZero() {
+		return nil, util.Errorf("KMS key %s has no creation time", k.ID)
+	}
+	publicKey, err := k.cryptoPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return packet.NewRSAPublicKey(k.Created, publicKey), nil
+	case *ecdsa.PublicKey:
+		return packet.NewECDSAPublicKey(k.Created, publicKey), nil
+	default:
+		return nil, util.Errorf("KMS key %s is a %T, only RSA and ECDSA keys can sign", k.ID, publicKey)
+	}
+}
+
+// Entity returns the OpenPGP entity of the key, which can verify its
+// signatures. Its identity is named by the key's ID and has its email.
+func (k Key) Entity() (*openpgp.Entity, error) {
+	publicKey, err := k.openpgpPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	userID := packet.NewUserId(k.ID, "", k.Email)
+	if userID == nil {
+		return nil, util.Errorf("KMS key ID %q or email %q can't be an OpenPGP user ID", k.ID, k.Email)
+	}
+	isPrimary := true
+	return &openpgp.Entity{
+		PrimaryKey: publicKey,
+		Identities: map[string]*openpgp.Identity{
+			userID.Id: {
+				Name:   userID.Id,
+				UserId: userID,
+				// The key is trusted because the KMS lists it, so
+				// the self signature is never checked, but openpgp
+				// reads the key's usage from it.
+				SelfSignature: &packet.Signature{
+					SigType:      packet.SigTypePositiveCert,
+					PubKeyAlgo:   publicKey.PubKeyAlgo,
+					Hash:         crypto.SHA256,
+					CreationTime: k.Created,
+					IssuerKeyId:  &publicKey.KeyId,
+					IsPrimaryId:  &isPrimary,
+					FlagsValid:   true,
+					FlagSign:     true,
+				},
+			},
+		},
+	}, nil
+}
+
+// Fingerprint returns the key's OpenPGP fingerprint, in hex
+func (k Key) Fingerprint() (string, error) {
+	publicKey, err := k.openpgpPublicKey()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%X", publicKey.Fingerprint), nil
+}
+
+// FindKey returns the key of the KMS with the ID keyID
+func FindKey(client Client, keyID string) (Key, error) {
+	keys, err := client.Keys()
+	if err != nil {
+		return Key{}, err
+	}
+	for _, key := range keys {
+		if key.ID == keyID {
+			return key, nil
+		}
+	}
+	return Key{}, util.Errorf("the KMS has no key %s", keyID)
+}
+
+// SigningEntity returns an entity that signs with the private key of key,
+// which stays in the KMS. It can be passed to openpgp.DetachSign,
+// clearsign.Encode and the like, which sign by asking the KMS to sign.
+func SigningEntity(client Client, key Key) (*openpgp.Entity, error) {
+	entity, err := key.Entity()
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := key.cryptoPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	// packet.NewSignerPrivateKey would mark RSA keys sign only, which
+	// changes the algorithm of their signatures, so that they wouldn't
+	// verify against the public key that the KMS lists
+	entity.PrivateKey = &packet.PrivateKey{
+		PublicKey: *entity.PrimaryKey,
+		PrivateKey: signer{
+			client:    client,
+			keyID:     key.ID,
+			publicKey: publicKey,
+		},
+	}
+	return entity, nil
+}
+
+// DetachSign writes an armored detached signature of message, made with the
+// KMS key keyID, to w, such as the signature of an artifact or of its build
+// manifest
+func DetachSign(w io.Writer, client Client, keyID string, message io.Reader) error {
+	key, err := FindKey(client, keyID)
+	if err != nil {
+		return err
+	}
+	entity, err := SigningEntity(client, key)
+	if err != nil {
+		return err
+	}
+	return openpgp.ArmoredDetachSign(w, entity, message, nil)
+}
+
+// digestHashes are the hashes whose digests have each length
+var digestHashes = map[int]crypto.Hash{
+	crypto.SHA1.Size():   crypto.SHA1,
+	crypto.SHA224.Size(): crypto.SHA224,
+	crypto.SHA256.Size(): crypto.SHA256,
+	crypto.SHA384.Size(): crypto.SHA384,
+	crypto.SHA512.Size(): crypto.SHA512,
+}
+
+// signer is a crypto.Signer whose private key is in the KMS
+type signer struct {
+	client    Client
+	keyID     string
+	publicKey crypto.PublicKey
+}
+
+func (s signer) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+func (s signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var hash crypto.Hash
+	if opts != nil {
+		hash = opts.HashFunc()
+	} else {
+		// openpgp doesn't say which hash ECDSA signs, but KMSs need to
+		// know, and the length of the digest tells
+		hash = digestHashes[len(digest)]
+		if hash == 0 {
+			return nil, util.Errorf("can't tell the hash of a %d byte digest", len(digest))
+		}
+	}
+	signature, err := s.client.Sign(s.keyID, digest, hash)
+	if err != nil {
+		return nil, util.Errorf("the KMS could not sign with %s: %s", s.keyID, err)
+	}
+	return signature, nil
+}
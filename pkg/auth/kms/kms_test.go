@@ -0,0 +1,283 @@
+package kms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp/armor"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+)
+
+// fakeKMS is a KMS gateway that keeps its private keys in memory
+type fakeKMS struct {
+	mu      sync.Mutex
+	keys    []Key
+	signers map[string]crypto.Signer
+	down    bool
+}
+
+func newFakeKMS() *fakeKMS {
+	return &fakeKMS{signers: make(map[string]crypto.Signer)}
+}
+
+func (f *fakeKMS) addKey(t *testing.T, id string, signer crypto.Signer) Key {
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key{
+		ID:        id,
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		Created:   time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC),
+		Email:     id + "@example.com",
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = append(f.keys, key)
+	f.signers[id] = signer
+	return key
+}
+
+func (f *fakeKMS) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *fakeKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/keys":
+		_ = json.NewEncoder(w).Encode(map[string][]Key{"keys": f.keys})
+	case "/v1/sign":
+		var request struct {
+			KeyID  string `json:"key_id"`
+			Digest []byte `json:"digest"`
+			Hash   string `json:"hash"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		signer, ok := f.signers[request.KeyID]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		var hash crypto.Hash
+		for h, name := range hashNames {
+			if name == request.Hash {
+				hash = h
+			}
+		}
+		if hash == 0 {
+			http.Error(w, "unknown hash", http.StatusBadRequest)
+			return
+		}
+		signature, err := signer.Sign(rand.Reader, request.Digest, hash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]byte{"signature": signature})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func startFakeKMS(t *testing.T) (*fakeKMS, *httptest.Server, Client) {
+	fake := newFakeKMS()
+	server := httptest.NewServer(fake)
+	client, err := NewHTTPClient(server.URL, http.DefaultClient)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return fake, server, client
+}
+
+type signed struct {
+	plaintext []byte
+	signature []byte
+}
+
+func (s signed) ID() types.PodID                 { return "thepod" }
+func (s signed) RunAsUser() string               { return "thepod" }
+func (s signed) SignatureData() ([]byte, []byte) { return s.plaintext, s.signature }
+
+func detachSign(t *testing.T, client Client, keyID string, message []byte) signed {
+	var armored bytes.Buffer
+	err := DetachSign(&armored, client, keyID, bytes.NewReader(message))
+	if err != nil {
+		t.Fatalf("could not sign with %s: %s", keyID, err)
+	}
+	block, err := armor.Decode(&armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed{plaintext: message, signature: signature}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake, server, client := startFakeKMS(t)
+	defer server.Close()
+	fake.addKey(t, "release-rsa", rsaKey)
+	ecdsaFingerprint, err := fake.addKey(t, "release-ecdsa", ecdsaKey).Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := auth.FixedKeyringPolicy{
+		Keyring:             NewKeyring(client, Config{URL: server.URL}, logging.TestLogger()),
+		AuthorizedDeployers: map[types.PodID][]string{"thepod": {ecdsaFingerprint}},
+	}
+	message := []byte("id: thepod\n")
+
+	for _, keyID := range []string{"release-rsa", "release-ecdsa"} {
+		err = policy.CheckDigest(detachSign(t, client, keyID, message))
+		if err != nil {
+			t.Errorf("signature of %s didn't verify: %s", keyID, err)
+		}
+	}
+
+	err = policy.AuthorizeApp(detachSign(t, client, "release-ecdsa", message), logging.TestLogger())
+	if err != nil {
+		t.Errorf("signature of an authorized deployer should be authorized: %s", err)
+	}
+	err = policy.AuthorizeApp(detachSign(t, client, "release-rsa", message), logging.TestLogger())
+	if err == nil {
+		t.Errorf("signature of a key that isn't an authorized deployer should not be authorized")
+	}
+
+	forged := detachSign(t, client, "release-rsa", message)
+	forged.plaintext = []byte("id: otherpod\n")
+	if policy.CheckDigest(forged) == nil {
+		t.Errorf("signature of other data should not verify")
+	}
+
+	var signature bytes.Buffer
+	err = DetachSign(&signature, client, "missing", bytes.NewReader(message))
+	if err == nil {
+		t.Errorf("signing with a key the KMS doesn't have should fail")
+	}
+}
+
+func TestSigningEntityIdentity(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake, server, client := startFakeKMS(t)
+	defer server.Close()
+	key := fake.addKey(t, "release", ecdsaKey)
+
+	entity, err := SigningEntity(client, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifying, err := key.Entity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.PrimaryKey.KeyId != verifying.PrimaryKey.KeyId {
+		t.Errorf("signing and verifying entities should have the same key ID, were %X and %X", entity.PrimaryKey.KeyId, verifying.PrimaryKey.KeyId)
+	}
+	for _, identity := range verifying.Identities {
+		if identity.UserId.Email != "release@example.com" {
+			t.Errorf("identity should have the key's email, was %q", identity.UserId.Email)
+		}
+	}
+}
+
+func TestKeyringCache(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake, server, client := startFakeKMS(t)
+	defer server.Close()
+	fake.addKey(t, "release", ecdsaKey)
+
+	dir, err := ioutil.TempDir("", "kms_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := Config{
+		URL:       server.URL,
+		CacheTTL:  time.Hour,
+		CachePath: filepath.Join(dir, "keys.json"),
+	}
+	message := []byte("artifact_sha: abc123\n")
+	release := detachSign(t, client, "release", message)
+
+	keyring := NewKeyring(client, config, logging.TestLogger())
+	keyring.refetchInterval = 0
+	policy := auth.FixedKeyringPolicy{Keyring: keyring}
+	if err = policy.CheckDigest(release); err != nil {
+		t.Fatalf("signature should verify: %s", err)
+	}
+
+	// keys created after the keyring's keys were fetched are fetched
+	// before their TTL when they sign
+	fake.addKey(t, "new-release", newKey)
+	if err = policy.CheckDigest(detachSign(t, client, "new-release", message)); err != nil {
+		t.Errorf("signature of a new key should verify: %s", err)
+	}
+
+	fake.setDown(true)
+	keyring.ttl = time.Nanosecond
+	if err = policy.CheckDigest(release); err != nil {
+		t.Errorf("signature should verify with the cached keys while the KMS is down: %s", err)
+	}
+
+	restarted := auth.FixedKeyringPolicy{Keyring: NewKeyring(client, config, logging.TestLogger())}
+	if err = restarted.CheckDigest(release); err != nil {
+		t.Errorf("signature should verify with the keys of the cache file while the KMS is down: %s", err)
+	}
+
+	uncached := auth.FixedKeyringPolicy{Keyring: NewKeyring(client, Config{URL: server.URL}, logging.TestLogger())}
+	if uncached.CheckDigest(release) == nil {
+		t.Errorf("signature should not verify without any keys")
+	}
+}
@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"gopkg.in/yaml.v2"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// A RuleDocument lists who may deploy which pods to which nodes. A manifest
+// may be deployed if any of the rules allows one of its signers to deploy it.
+// Manifests that no rule allows are refused.
+//
+// Signers are identified by the email address of their key, the key's
+// fingerprint, or the name of a group of them. For example, to let team X
+// deploy only its own pods, only to its own nodes:
+//
+//	---
+//	groups:
+//	  teamx:
+//	  - alice@my.org
+//	  - 8F0C6BD5A5A31F1E9A5BE6B1D1F9A3E0C3F6D7E8
+//	rules:
+//	- signers: [teamx]
+//	  pods: ["teamx-*"]
+//	  node_selector: team=x
+//	- signers: [carol@my.org]
+//	  pods: ["*"]
+//	  environments: [staging]
+type RuleDocument struct {
+	Groups map[string][]string `yaml:"groups,omitempty"`
+	Rules  []Rule              `yaml:"rules"`
+}
+
+// A Rule allows Signers to deploy Pods to the nodes selected by NodeSelector
+// in Environments
+type Rule struct {
+	// Signers are emails, key fingerprints or group names
+	Signers []string `yaml:"signers"`
+	// Pods are the IDs of the pods, which may be patterns like "teamx-*"
+	// (see path.Match)
+	Pods []string `yaml:"pods"`
+	// NodeSelector, if set, selects the nodes that the pods may be deployed
+	// to by their labels
+	NodeSelector string `yaml:"node_selector,omitempty"`
+	// Environments, if set, are the environments that the pods may be
+	// deployed in, which each preparer is configured with
+	Environments []string `yaml:"environments,omitempty"`
+}
+
+var fingerprintRegexp = regexp.MustCompile("^[0-9A-Fa-f]{40}$")
+
+// ParseRuleDocument reads a rule document, which must be clearsigned by a
+// key of keyring
+func ParseRuleDocument(signedDocument []byte, keyring openpgp.KeyRing) (RuleDocument, error) {
+	block, _ := clearsign.Decode(signedDocument)
+	if block == nil {
+		return RuleDocument{}, util.Errorf("rule document is not clearsigned")
+	}
+	signature, err := ioutil.ReadAll(block.ArmoredSignature.Body)
+	if err != nil {
+		return RuleDocument{}, util.Errorf("could not read rule document signature: %s", err)
+	}
+	_, err = checkDetachedSignatures(keyring, block.Bytes, signature)
+	if err != nil {
+		return RuleDocument{}, util.Errorf("rule document is not signed by a rule key: %s", err)
+	}
+
+	var document RuleDocument
+	err = yaml.Unmarshal(block.Plaintext, &document)
+	if err != nil {
+		return RuleDocument{}, util.Errorf("could not parse rule document: %s", err)
+	}
+	err = document.Validate()
+	if err != nil {
+		return RuleDocument{}, err
+	}
+	return document, nil
+}
+
+// Validate returns an error if a rule of the document can't be checked
+func (d RuleDocument) Validate() error {
+	for i, rule := range d.Rules {
+		if len(rule.Signers) == 0 || len(rule.Pods) == 0 {
+			return util.Errorf("rule %d must list signers and pods", i)
+		}
+		for _, signer := range rule.Signers {
+			if _, ok := d.Groups[signer]; !ok && !strings.Contains(signer, "@") && !fingerprintRegexp.MatchString(signer) {
+				return util.Errorf("rule %d: signer %q is not an email, a key fingerprint or a group", i, signer)
+			}
+		}
+		for _, pattern := range rule.Pods {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return util.Errorf("rule %d: invalid pod pattern %q", i, pattern)
+			}
+		}
+		if _, err := klabels.Parse(rule.NodeSelector); err != nil {
+			return util.Errorf("rule %d: invalid node selector %q: %s", i, rule.NodeSelector, err)
+		}
+	}
+	return nil
+}
+
+// Allows returns true if a rule allows one of signers to deploy podID in
+// environment to a node with the labels returned by nodeLabels, which is only
+// called if a rule has a node selector
+func (d RuleDocument) Allows(
+	signers []*openpgp.Entity,
+	podID types.PodID,
+	environment string,
+	nodeLabels func() (klabels.Labels, error),
+) (bool, error) {
+	var identities []string
+	for _, signer := range signers {
+		identities = append(identities, fingerprint(signer))
+		for _, id := range signer.Identities {
+			if id.UserId != nil && id.UserId.Email != "" {
+				identities = append(identities, id.UserId.Email)
+			}
+		}
+	}
+
+	var labels klabels.Labels = klabels.Set{}
+	fetchedLabels := false
+	for _, rule := range d.Rules {
+		if !d.hasSigner(rule, identities) || !matchesPod(rule.Pods, podID) {
+			continue
+		}
+		if len(rule.Environments) > 0 && !contains(rule.Environments, environment) {
+			continue
+		}
+		if rule.NodeSelector != "" {
+			if !fetchedLabels {
+				nodeLabels, err := nodeLabels()
+				if err != nil {
+					return false, util.Errorf("could not read the node's labels: %s", err)
+				}
+				if nodeLabels != nil {
+					labels = nodeLabels
+				}
+				fetchedLabels = true
+			}
+			selector, err := klabels.Parse(rule.NodeSelector)
+			if err != nil {
+				return false, err
+			}
+			if !selector.Matches(labels) {
+				continue
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// hasSigner returns true if one of identities is a signer of rule or in a
+// group of its signers
+func (d RuleDocument) hasSigner(rule Rule, identities []string) bool {
+	for _, signer := range rule.Signers {
+		members, isGroup := d.Groups[signer]
+		if !isGroup {
+			members = []string{signer}
+		}
+		for _, member := range members {
+			for _, identity := range identities {
+				if strings.EqualFold(member, identity) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func matchesPod(patterns []string, podID types.PodID) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, podID.String()); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// A RuleDocumentWatcher sends the signed rule document on documents when it
+// starts and each time the document changes, or nil if there is none, until
+// quit is closed
+type RuleDocumentWatcher func(documents chan<- []byte, quit <-chan struct{})
+
+// RulePolicy authorizes manifests signed by a key on its keyring that a rule
+// of its RuleDocument allows. The document is read from a watcher, such as
+// one of a consul key, and replaced each time it changes. A document that
+// isn't signed by a key of the rule keyring, or that is invalid, is logged
+// and the previous one is kept.
+//
+// Digests are authorized like by the FixedKeyringPolicy.
+type RulePolicy struct {
+	keyringWatcher     util.FileWatcher
+	ruleKeyringWatcher util.FileWatcher
+	environment        string
+	nodeLabels         func() (klabels.Labels, error)
+	logger             logging.Logger
+	quit               chan struct{}
+
+	mu       sync.RWMutex
+	document *RuleDocument
+	// loadErr is why the last document that was watched isn't the
+	// document, if it isn't
+	loadErr error
+}
+
+var _ Policy = &RulePolicy{}
+
+// NewRulePolicy returns a RulePolicy of the manifests signed by keys on the
+// keyring at keyringPath, with the rule documents sent by watch that are
+// signed by keys on the keyring at ruleKeyringPath. environment is the node's
+// environment and nodeLabels returns its labels.
+func NewRulePolicy(
+	keyringPath string,
+	ruleKeyringPath string,
+	watch RuleDocumentWatcher,
+	environment string,
+	nodeLabels func() (klabels.Labels, error),
+	logger logging.Logger,
+) (p *RulePolicy, err error) {
+	keyringWatcher, err := util.NewFileWatcher(
+		func(path string) (interface{}, error) {
+			return LoadKeyring(path)
+		},
+		keyringPath,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			keyringWatcher.Close()
+		}
+	}()
+	ruleKeyringWatcher, err := util.NewFileWatcher(
+		func(path string) (interface{}, error) {
+			return LoadKeyring(path)
+		},
+		ruleKeyringPath,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	p = &RulePolicy{
+		keyringWatcher:     keyringWatcher,
+		ruleKeyringWatcher: ruleKeyringWatcher,
+		environment:        environment,
+		nodeLabels:         nodeLabels,
+		logger:             logger,
+		quit:               make(chan struct{}),
+		loadErr:            util.Errorf("no rule document has been read yet"),
+	}
+	documents := make(chan []byte)
+	go watch(documents, p.quit)
+	go p.load(documents)
+	return p, nil
+}
+
+func (p *RulePolicy) load(documents <-chan []byte) {
+	for {
+		var signedDocument []byte
+		select {
+		case <-p.quit:
+			return
+		case signedDocument = <-documents:
+		}
+
+		var document RuleDocument
+		var err error
+		if signedDocument == nil {
+			err = util.Errorf("there is no rule document")
+		} else {
+			ruleKeyring := (<-p.ruleKeyringWatcher.GetAsync()).(openpgp.EntityList)
+			document, err = ParseRuleDocument(signedDocument, ruleKeyring)
+		}
+
+		p.mu.Lock()
+		if err != nil {
+			p.loadErr = err
+			if p.document != nil {
+				p.logger.WithError(err).Errorln("Could not load new rule document, keeping the current one")
+			} else {
+				p.logger.WithError(err).Errorln("Could not load a rule document, no manifests will be authorized")
+			}
+		} else {
+			p.document = &document
+			p.loadErr = nil
+			p.logger.WithField("rules", len(document.Rules)).Infoln("Loaded rule document")
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *RulePolicy) AuthorizeApp(manifest Manifest, logger logging.Logger) error {
+	plaintext, signature := manifest.SignatureData()
+	if signature == nil {
+		return Error{util.Errorf("received unsigned manifest (expected signature)"), nil}
+	}
+	keyring := (<-p.keyringWatcher.GetAsync()).(openpgp.EntityList)
+	signers, err := checkDetachedSignatures(keyring, plaintext, signature)
+	if err != nil {
+		return err
+	}
+	var signerIDs []string
+	for _, signer := range signers {
+		signerIDs = append(signerIDs, fingerprint(signer))
+	}
+
+	p.mu.RLock()
+	document, loadErr := p.document, p.loadErr
+	p.mu.RUnlock()
+	if document == nil {
+		return Error{util.Errorf("no rules authorize manifests: %s", loadErr), nil}
+	}
+
+	allowed, err := document.Allows(signers, manifest.ID(), p.environment, p.nodeLabels)
+	if err != nil {
+		return Error{util.Errorf("could not check rules: %s", err), map[string]interface{}{"signer_keys": signerIDs}}
+	}
+	if !allowed {
+		return Error{
+			util.Errorf("no rule allows the manifest's signers to deploy %s to this node", manifest.ID()),
+			map[string]interface{}{"signer_keys": signerIDs},
+		}
+	}
+	return nil
+}
+
+func (p *RulePolicy) CheckDigest(digest Digest) error {
+	return FixedKeyringPolicy{
+		(<-p.keyringWatcher.GetAsync()).(openpgp.EntityList),
+		nil,
+		nil,
+	}.CheckDigest(digest)
+}
+
+func (p *RulePolicy) Close() {
+	close(p.quit)
+	p.keyringWatcher.Close()
+	p.ruleKeyringWatcher.Close()
+}
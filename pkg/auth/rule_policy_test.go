@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+)
+
+func email(ent *openpgp.Entity) string {
+	for _, id := range ent.Identities {
+		return id.UserId.Email
+	}
+	return ""
+}
+
+func (h *testHarness) clearsign(msg []byte, ent *openpgp.Entity) []byte {
+	if h.Err != nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	plaintext, err := clearsign.Encode(&buf, ent.PrivateKey, nil)
+	if err == nil {
+		_, err = plaintext.Write(msg)
+	}
+	if err == nil {
+		err = plaintext.Close()
+	}
+	if err != nil {
+		h.Err = fmt.Errorf("clearsigning: %s", err)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func nodeLabels(set klabels.Set) func() (klabels.Labels, error) {
+	return func() (klabels.Labels, error) {
+		return set, nil
+	}
+}
+
+func TestRuleDocument(t *testing.T) {
+	h := testHarness{}
+	ents := h.loadEntities()
+	if h.Err != nil {
+		t.Fatal(h.Err)
+	}
+	document := RuleDocument{
+		Groups: map[string][]string{"teamx": {email(ents[0])}},
+		Rules: []Rule{
+			{Signers: []string{"teamx"}, Pods: []string{"teamx-*"}, NodeSelector: "team=x"},
+			{Signers: []string{fmt.Sprintf("%X", ents[1].PrimaryKey.Fingerprint)}, Pods: []string{"*"}, Environments: []string{"staging"}},
+		},
+	}
+	if err := document.Validate(); err != nil {
+		t.Fatalf("document should be valid: %s", err)
+	}
+
+	teamNode := nodeLabels(klabels.Set{"team": "x"})
+	otherNode := nodeLabels(klabels.Set{"team": "y"})
+	for _, c := range []struct {
+		signer      *openpgp.Entity
+		podID       types.PodID
+		environment string
+		nodeLabels  func() (klabels.Labels, error)
+		allowed     bool
+	}{
+		{ents[0], "teamx-web", "production", teamNode, true},
+		{ents[0], "teamx-web", "production", otherNode, false},
+		{ents[0], "teamy-web", "production", teamNode, false},
+		{ents[1], "teamy-web", "staging", otherNode, true},
+		{ents[1], "teamy-web", "production", otherNode, false},
+		{ents[2], "teamx-web", "staging", teamNode, false},
+	} {
+		allowed, err := document.Allows([]*openpgp.Entity{c.signer}, c.podID, c.environment, c.nodeLabels)
+		if err != nil {
+			t.Errorf("could not check rules: %s", err)
+		}
+		if allowed != c.allowed {
+			t.Errorf("%s deploying %s in %s: expected allowed to be %t", email(c.signer), c.podID, c.environment, c.allowed)
+		}
+	}
+
+	for _, invalid := range []Rule{
+		{Signers: []string{"nogroup"}, Pods: []string{"*"}},
+		{Signers: []string{"teamx"}},
+		{Signers: []string{"teamx"}, Pods: []string{"["}},
+		{Signers: []string{"teamx"}, Pods: []string{"*"}, NodeSelector: "team in ("},
+	} {
+		document.Rules = []Rule{invalid}
+		if document.Validate() == nil {
+			t.Errorf("rule %+v should be invalid", invalid)
+		}
+	}
+}
+
+func TestRulePolicy(t *testing.T) {
+	h := testHarness{}
+	msg := []byte("id: teamx-web")
+	ents := h.loadEntities()
+	sigs := h.signMessage(msg, ents)
+	keyfile := h.tempFile()
+	defer rm(t, keyfile)
+	h.saveKeys(ents[:2], keyfile)
+	ruleKeyfile := h.tempFile()
+	defer rm(t, ruleKeyfile)
+	h.saveKeys(ents[2:], ruleKeyfile)
+	teamRules := h.clearsign([]byte(fmt.Sprintf("rules:\n- signers: [%s]\n  pods: [teamx-*]\n", email(ents[0]))), ents[2])
+	forgedRules := h.clearsign([]byte(fmt.Sprintf("rules:\n- signers: [%s]\n  pods: [\"*\"]\n", email(ents[1]))), ents[1])
+	otherRules := h.clearsign([]byte(fmt.Sprintf("rules:\n- signers: [%s]\n  pods: [\"*\"]\n", email(ents[1]))), ents[2])
+	if h.Err != nil {
+		t.Fatal(h.Err)
+	}
+
+	documents := make(chan []byte)
+	watch := func(out chan<- []byte, quit <-chan struct{}) {
+		for {
+			select {
+			case <-quit:
+				return
+			case document := <-documents:
+				out <- document
+			}
+		}
+	}
+	policy, err := NewRulePolicy(keyfile, ruleKeyfile, watch, "production", nodeLabels(nil), logging.TestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer policy.Close()
+	logger := logging.TestLogger()
+	teamSigned := TestSigned{"teamx-web", "teamx-web", msg, sigs[0]}
+	otherSigned := TestSigned{"teamx-web", "teamx-web", msg, sigs[1]}
+
+	if policy.AuthorizeApp(teamSigned, logger) == nil {
+		t.Error("authorized a manifest before any rules were read")
+	}
+
+	// waitFor waits until document is loaded: the watch only takes the
+	// second nil once the policy has taken the first, which it only
+	// does after loading document. Missing documents don't replace the
+	// rules.
+	waitFor := func(document []byte) {
+		documents <- document
+		documents <- nil
+		documents <- nil
+	}
+
+	waitFor(teamRules)
+	if err := policy.AuthorizeApp(teamSigned, logger); err != nil {
+		t.Errorf("error authorizing a manifest that a rule allows: %s", err)
+	}
+	if policy.AuthorizeApp(otherSigned, logger) == nil {
+		t.Error("authorized a manifest that no rule allows")
+	}
+
+	waitFor(forgedRules)
+	if err := policy.AuthorizeApp(teamSigned, logger); err != nil {
+		t.Errorf("a document not signed by a rule key should not replace the rules: %s", err)
+	}
+
+	waitFor(otherRules)
+	if policy.AuthorizeApp(teamSigned, logger) == nil {
+		t.Error("rules should be replaced when the document changes")
+	}
+	if err := policy.AuthorizeApp(otherSigned, logger); err != nil {
+		t.Errorf("error authorizing a manifest that a new rule allows: %s", err)
+	}
+
+	if policy.AuthorizeApp(TestSigned{"teamx-web", "teamx-web", msg, sigs[2]}, logger) == nil {
+		t.Error("authorized a manifest signed by a key not on the keyring")
+	}
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"os"
+
+	"github.com/square/p2/pkg/tracing"
+)
+
+type tracingVerifier struct {
+	verifier ArtifactVerifier
+	span     *tracing.Span
+}
+
+// NewTracingVerifier wraps verifier so that each verification is recorded as
+// a "verify_artifact" span under span, which may be nil.
+func NewTracingVerifier(verifier ArtifactVerifier, span *tracing.Span) ArtifactVerifier {
+	if span == nil {
+		return verifier
+	}
+	return &tracingVerifier{
+		verifier: verifier,
+		span:     span,
+	}
+}
+
+func (t *tracingVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
+	span := t.span.Child("verify_artifact")
+	err := t.verifier.VerifyHoistArtifact(localCopy, verificationData)
+	span.End(err)
+	return err
+}
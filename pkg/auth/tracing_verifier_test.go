@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/tracing"
+)
+
+type spanRecorder struct {
+	spans []tracing.SpanData
+}
+
+func (s *spanRecorder) Export(span tracing.SpanData) { s.spans = append(s.spans, span) }
+func (s *spanRecorder) Close()                       {}
+
+func TestTracingVerifierRecordsVerifications(t *testing.T) {
+	recorder := &spanRecorder{}
+	parent := tracing.NewTracer(recorder).Start("install_launchable")
+	verifier := NewTracingVerifier(failingVerifier{}, parent)
+
+	err := verifier.VerifyHoistArtifact(nil, VerificationData{})
+	Assert(t).IsNotNil(err, "should have returned the verifier's error")
+	Assert(t).AreEqual(len(recorder.spans), 1, "should have recorded the verification")
+	Assert(t).AreEqual(recorder.spans[0].Name, "verify_artifact", "unexpected span name")
+	Assert(t).AreEqual(recorder.spans[0].Error, err.Error(), "should have recorded the failure")
+}
+
+func TestTracingVerifierWithoutSpan(t *testing.T) {
+	verifier := NopVerifier()
+	Assert(t).AreEqual(NewTracingVerifier(verifier, nil), verifier, "should not have wrapped the verifier without a span")
+}
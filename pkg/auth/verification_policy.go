@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"os"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// VerificationFailurePolicy controls what happens when an artifact fails
+// verification. It exists so that signature enforcement can be rolled out
+// gradually across a fleet that has unsigned artifacts.
+type VerificationFailurePolicy string
+
+const (
+	// The artifact is rejected and the install fails. This is the default.
+	EnforceVerification VerificationFailurePolicy = "enforce"
+
+	// The failure is logged at warning level and reported, but the
+	// install proceeds.
+	WarnVerification VerificationFailurePolicy = "warn"
+
+	// The failure is quietly recorded for later auditing and the install
+	// proceeds.
+	AuditVerification VerificationFailurePolicy = "audit"
+)
+
+func (p VerificationFailurePolicy) String() string { return string(p) }
+
+// AsVerificationFailurePolicy parses a policy name. The empty string is
+// treated as EnforceVerification.
+func AsVerificationFailurePolicy(value string) (VerificationFailurePolicy, error) {
+	switch VerificationFailurePolicy(value) {
+	case "", EnforceVerification:
+		return EnforceVerification, nil
+	case WarnVerification:
+		return WarnVerification, nil
+	case AuditVerification:
+		return AuditVerification, nil
+	default:
+		return "", util.Errorf("%q is not a valid artifact verification failure policy", value)
+	}
+}
+
+// VerificationFailure describes a verification failure that a non-enforcing
+// policy allowed through.
+type VerificationFailure struct {
+	Policy VerificationFailurePolicy
+	Err    error
+}
+
+type policyVerifier struct {
+	verifier  ArtifactVerifier
+	policy    VerificationFailurePolicy
+	onFailure func(VerificationFailure)
+}
+
+// NewPolicyVerifier wraps verifier so that verification failures are handled
+// according to policy. Under EnforceVerification the failure is returned as
+// usual. Under the other policies the failure is passed to onFailure (if
+// non-nil) and the artifact is accepted.
+func NewPolicyVerifier(verifier ArtifactVerifier, policy VerificationFailurePolicy, onFailure func(VerificationFailure)) ArtifactVerifier {
+	return &policyVerifier{
+		verifier:  verifier,
+		policy:    policy,
+		onFailure: onFailure,
+	}
+}
+
+func (p *policyVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
+	err := p.verifier.VerifyHoistArtifact(localCopy, verificationData)
+	if err == nil || p.policy == EnforceVerification {
+		return err
+	}
+
+	if p.onFailure != nil {
+		p.onFailure(VerificationFailure{
+			Policy: p.policy,
+			Err:    err,
+		})
+	}
+	return nil
+}
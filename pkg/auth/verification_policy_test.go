@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"os"
+	"testing"
+
+	"github.com/square/p2/pkg/util"
+)
+
+type failingVerifier struct{}
+
+func (failingVerifier) VerifyHoistArtifact(_ *os.File, _ VerificationData) error {
+	return util.Errorf("bad signature")
+}
+
+func TestPolicyVerifier(t *testing.T) {
+	for _, policy := range []VerificationFailurePolicy{EnforceVerification, WarnVerification, AuditVerification} {
+		var failures []VerificationFailure
+		verifier := NewPolicyVerifier(failingVerifier{}, policy, func(failure VerificationFailure) {
+			failures = append(failures, failure)
+		})
+
+		err := verifier.VerifyHoistArtifact(nil, VerificationData{})
+		if policy == EnforceVerification {
+			if err == nil {
+				t.Errorf("%s: expected verification failure to be returned", policy)
+			}
+			if len(failures) != 0 {
+				t.Errorf("%s: expected no failures to be reported, got %d", policy, len(failures))
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: expected verification failure to be ignored, got %s", policy, err)
+		}
+		if len(failures) != 1 || failures[0].Policy != policy {
+			t.Errorf("%s: expected one reported failure with the policy, got %+v", policy, failures)
+		}
+	}
+}
+
+func TestPolicyVerifierPassesSuccess(t *testing.T) {
+	called := false
+	verifier := NewPolicyVerifier(NopVerifier(), WarnVerification, func(VerificationFailure) {
+		called = true
+	})
+	if err := verifier.VerifyHoistArtifact(nil, VerificationData{}); err != nil {
+		t.Fatalf("expected successful verification, got %s", err)
+	}
+	if called {
+		t.Error("did not expect a failure to be reported for a successful verification")
+	}
+}
+
+func TestAsVerificationFailurePolicy(t *testing.T) {
+	policy, err := AsVerificationFailurePolicy("")
+	if err != nil || policy != EnforceVerification {
+		t.Errorf("expected empty policy to mean enforce, got %q, %v", policy, err)
+	}
+
+	policy, err = AsVerificationFailurePolicy("audit")
+	if err != nil || policy != AuditVerification {
+		t.Errorf("expected audit policy, got %q, %v", policy, err)
+	}
+
+	_, err = AsVerificationFailurePolicy("ignore")
+	if err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
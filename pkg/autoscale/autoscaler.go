@@ -0,0 +1,283 @@
+// Package autoscale adjusts the replica counts of RCs according to their
+// autoscaling policies
+package autoscale
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/autoscale/fields"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/rc"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul/autoscalestore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// metricTimeout bounds how long a request to a pod's metric URL may take
+const metricTimeout = 5 * time.Second
+
+// metricTolerance is how far the average metric may be from its target, as a
+// fraction of the target, before the replica count is changed. It keeps small
+// fluctuations from rescaling the RC.
+const metricTolerance = 0.1
+
+type PolicyStore interface {
+	Get(id rc_fields.ID) (fields.Policy, error)
+}
+
+type ReplicationControllerStore interface {
+	Get(id rc_fields.ID) (rc_fields.RC, error)
+	CASDesiredReplicas(id rc_fields.ID, expected int, n int) error
+}
+
+type RollingUpdateLister interface {
+	List() ([]roll_fields.Update, error)
+}
+
+type HealthChecker interface {
+	Service(serviceID string) (map[types.NodeName]health.Result, error)
+}
+
+// autoscaler periodically applies the policy of one RC
+type autoscaler struct {
+	id       rc_fields.ID
+	policies PolicyStore
+	rcs      ReplicationControllerStore
+	rolls    RollingUpdateLister
+	labeler  rc.LabelMatcher
+	hcheck   HealthChecker
+	logger   logging.Logger
+
+	metricClient *http.Client
+
+	// when the autoscaler last changed the replica count. The replica
+	// count is treated as having just changed when the autoscaler starts,
+	// since the last change made by another farm isn't known
+	lastScaled time.Time
+}
+
+// run scales the RC every interval until quit is closed
+func (a *autoscaler) run(interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			err := a.scale(time.Now())
+			if err != nil {
+				a.logger.WithError(err).Errorln("Could not autoscale replication controller")
+			}
+		}
+	}
+}
+
+// scale sets the RC's replica count to the one its policy recommends, unless
+// the RC is in a rolling update or the change would be within a cooldown
+func (a *autoscaler) scale(now time.Time) error {
+	policy, err := a.policies.Get(a.id)
+	if autoscalestore.IsNotExist(err) {
+		// the farm will release this RC
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	rcFields, err := a.rcs.Get(a.id)
+	if err != nil {
+		return err
+	}
+	if rcFields.Disabled {
+		a.logger.NoFields().Debugln("Replication controller is disabled, not autoscaling it")
+		return nil
+	}
+	updates, err := a.rolls.List()
+	if err != nil {
+		return err
+	}
+	for _, update := range updates {
+		if update.OldRC == a.id || update.NewRC == a.id {
+			// the update owns the replica count until it completes
+			a.logger.WithField("ru", update.ID()).Debugln("Replication controller is in a rolling update, not autoscaling it")
+			return nil
+		}
+	}
+
+	current := rcFields.ReplicasDesired
+	desired, err := a.recommend(policy, rcFields, now)
+	if err != nil {
+		return err
+	}
+	if desired == current {
+		return nil
+	}
+
+	logger := a.logger.SubLogger(logrus.Fields{
+		"current_replicas": current,
+		"desired_replicas": desired,
+	})
+	cooldown := policy.ScaleUpCooldown
+	if desired < current {
+		cooldown = policy.ScaleDownCooldown
+	}
+	if now.Sub(a.lastScaled) < cooldown {
+		logger.WithField("cooldown", cooldown).Debugln("Waiting for cooldown before autoscaling")
+		return nil
+	}
+
+	err = a.rcs.CASDesiredReplicas(a.id, current, desired)
+	if err != nil {
+		return err
+	}
+	a.lastScaled = now
+	logger.NoFields().Infoln("Autoscaled replication controller")
+	return nil
+}
+
+// recommend returns the replica count that the policy recommends for the RC.
+// It is the largest of the targets' recommendations, bounded by the policy's
+// minimum and maximum.
+func (a *autoscaler) recommend(policy fields.Policy, rcFields rc_fields.RC, now time.Time) (int, error) {
+	current := rcFields.ReplicasDesired
+	recommended := -1
+	recommend := func(n int) {
+		if n > recommended {
+			recommended = n
+		}
+	}
+
+	if policy.Health != nil || policy.Metric != nil {
+		pods, err := rc.CurrentPods(a.id, a.labeler)
+		if err != nil {
+			return 0, err
+		}
+		nodes := pods.Nodes()
+
+		if policy.Health != nil {
+			results, err := a.hcheck.Service(rcFields.Manifest.ID().String())
+			if err != nil {
+				return 0, err
+			}
+			unhealthy := 0
+			for _, node := range nodes {
+				if result, ok := results[node]; !ok || result.Status != health.Passing {
+					unhealthy++
+				}
+			}
+			recommend(healthRecommendation(unhealthy, policy.Health.HealthyPercent))
+		}
+
+		if policy.Metric != nil {
+			average, ok := a.averageMetric(policy.Metric.URL, nodes)
+			if ok {
+				recommend(metricRecommendation(current, average, policy.Metric.Target))
+			}
+		}
+	}
+
+	for _, scheduled := range policy.Schedule {
+		active, err := scheduled.Active(now)
+		if err != nil {
+			return 0, err
+		}
+		if active {
+			recommend(scheduled.Replicas)
+		}
+	}
+
+	if recommended < 0 {
+		recommended = current
+	}
+	if recommended < policy.MinReplicas {
+		recommended = policy.MinReplicas
+	}
+	if recommended > policy.MaxReplicas {
+		recommended = policy.MaxReplicas
+	}
+	return recommended, nil
+}
+
+// healthRecommendation returns the fewest replicas of which healthyPercent
+// would be healthy if unhealthy of them aren't
+func healthRecommendation(unhealthy int, healthyPercent int) int {
+	unhealthyPercent := 100 - healthyPercent
+	return (unhealthy*100 + unhealthyPercent - 1) / unhealthyPercent
+}
+
+// metricRecommendation returns the replica count at which the average metric
+// would be the target, assuming it is proportional to the load on each pod
+func metricRecommendation(current int, average float64, target float64) int {
+	ratio := average / target
+	if math.Abs(ratio-1) <= metricTolerance {
+		return current
+	}
+	return int(math.Ceil(float64(current) * ratio))
+}
+
+// averageMetric reads the metric of each node, and returns their average.
+// Nodes whose metric can't be read are left out. Returns false if none of them
+// could be read.
+func (a *autoscaler) averageMetric(url string, nodes []types.NodeName) (float64, bool) {
+	client := a.metricClient
+	if client == nil {
+		client = &http.Client{Timeout: metricTimeout}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sum := 0.0
+	count := 0
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node types.NodeName) {
+			defer wg.Done()
+			value, err := readMetric(client, strings.Replace(url, fields.NodePlaceholder, node.String(), -1))
+			if err != nil {
+				a.logger.WithErrorAndFields(err, logrus.Fields{"node": node}).Warnln("Could not read autoscaling metric")
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			sum += value
+			count++
+		}(node)
+	}
+	wg.Wait()
+
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+func readMetric(client *http.Client, url string) (float64, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, util.Errorf("%s returned %s", url, resp.Status)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(body)), 64)
+	if err != nil {
+		return 0, util.Errorf("%s did not return a number: %s", url, err)
+	}
+	return value, nil
+}
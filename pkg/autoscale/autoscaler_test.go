@@ -0,0 +1,166 @@
+package autoscale
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/autoscale/fields"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/rc"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul/autoscalestore"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakePolicies map[rc_fields.ID]fields.Policy
+
+func (p fakePolicies) Get(id rc_fields.ID) (fields.Policy, error) {
+	policy, ok := p[id]
+	if !ok {
+		return fields.Policy{}, autoscalestore.NoPolicy
+	}
+	return policy, nil
+}
+
+type fakeRolls []roll_fields.Update
+
+func (r fakeRolls) List() ([]roll_fields.Update, error) {
+	return r, nil
+}
+
+type fakeHealth map[types.NodeName]health.Result
+
+func (h fakeHealth) Service(serviceID string) (map[types.NodeName]health.Result, error) {
+	return h, nil
+}
+
+// setupAutoscaler returns an autoscaler for an RC with 2 desired replicas,
+// which are on node1 and node2
+func setupAutoscaler(t *testing.T, policy fields.Policy) (*autoscaler, rc_fields.ID, ReplicationControllerStore) {
+	builder := manifest.NewBuilder()
+	builder.SetID("some_pod")
+	rcStore := rcstore.NewFake()
+	rcFields, err := rcStore.Create(builder.GetManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil)
+	Assert(t).IsNil(err, "test setup: could not create RC")
+	Assert(t).IsNil(rcStore.SetDesiredReplicas(rcFields.ID, 2), "test setup: could not set replicas")
+
+	applicator := labels.NewFakeApplicator()
+	for _, node := range []string{"node1", "node2"} {
+		err = applicator.SetLabel(labels.POD, node+"/some_pod", rc.RCIDLabel, rcFields.ID.String())
+		Assert(t).IsNil(err, "test setup: could not label pod")
+	}
+
+	policy.RCID = rcFields.ID
+	a := &autoscaler{
+		id:       rcFields.ID,
+		policies: fakePolicies{rcFields.ID: policy},
+		rcs:      rcStore,
+		rolls:    fakeRolls{},
+		labeler:  applicator,
+		hcheck: fakeHealth{
+			"node1": {Status: health.Passing},
+			"node2": {Status: health.Critical},
+		},
+		logger: logging.TestLogger(),
+	}
+	return a, rcFields.ID, rcStore
+}
+
+func desiredReplicas(t *testing.T, rcs ReplicationControllerStore, id rc_fields.ID) int {
+	rcFields, err := rcs.Get(id)
+	Assert(t).IsNil(err, "could not get RC")
+	return rcFields.ReplicasDesired
+}
+
+func TestScaleForHealth(t *testing.T) {
+	a, id, rcs := setupAutoscaler(t, fields.Policy{
+		MinReplicas:     2,
+		MaxReplicas:     10,
+		ScaleUpCooldown: time.Minute,
+		Health:          &fields.HealthTarget{HealthyPercent: 75},
+	})
+	now := time.Now()
+
+	a.lastScaled = now
+	Assert(t).IsNil(a.scale(now), "should have autoscaled")
+	Assert(t).AreEqual(desiredReplicas(t, rcs, id), 2, "should not have scaled during the cooldown")
+
+	a.rolls = fakeRolls{{OldRC: "other", NewRC: id}}
+	Assert(t).IsNil(a.scale(now.Add(2*time.Minute)), "should have autoscaled")
+	Assert(t).AreEqual(desiredReplicas(t, rcs, id), 2, "should not have scaled during a rolling update")
+
+	a.rolls = fakeRolls{}
+	Assert(t).IsNil(a.scale(now.Add(2*time.Minute)), "should have autoscaled")
+	// one of the replicas is unhealthy, so 4 are needed for 75% to be healthy
+	Assert(t).AreEqual(desiredReplicas(t, rcs, id), 4, "should have added replicas for the unhealthy one")
+}
+
+func TestScaleForMetric(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "node2") {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "30")
+	}))
+	defer server.Close()
+
+	a, id, rcs := setupAutoscaler(t, fields.Policy{
+		MinReplicas: 1,
+		MaxReplicas: 5,
+		Metric:      &fields.MetricTarget{URL: server.URL + "/" + fields.NodePlaceholder, Target: 10},
+	})
+	Assert(t).IsNil(a.scale(time.Now()), "should have autoscaled")
+	// the metric is 3 times the target, but the maximum is 5
+	Assert(t).AreEqual(desiredReplicas(t, rcs, id), 5, "should have scaled up to the maximum")
+}
+
+func TestScaleForSchedule(t *testing.T) {
+	a, id, rcs := setupAutoscaler(t, fields.Policy{
+		MinReplicas: 0,
+		MaxReplicas: 10,
+		Schedule: []fields.ScheduledReplicas{
+			{Start: "09:00", End: "17:00", Replicas: 6},
+			{Start: "22:00", End: "02:00", Replicas: 3},
+		},
+	})
+	day := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	Assert(t).IsNil(a.scale(day.Add(12*time.Hour)), "should have autoscaled")
+	Assert(t).AreEqual(desiredReplicas(t, rcs, id), 6, "should have scaled up during the day")
+
+	Assert(t).IsNil(a.scale(day.Add(25*time.Hour)), "should have autoscaled")
+	Assert(t).AreEqual(desiredReplicas(t, rcs, id), 3, "should have scaled down for the period spanning midnight")
+
+	Assert(t).IsNil(a.scale(day.Add(29*time.Hour)), "should have autoscaled")
+	Assert(t).AreEqual(desiredReplicas(t, rcs, id), 3, "should have kept the replica count without a recommendation")
+}
+
+func TestPolicyValidate(t *testing.T) {
+	valid := fields.Policy{RCID: "some_rc", MinReplicas: 1, MaxReplicas: 3}
+	Assert(t).IsNil(valid.Validate(), "should have been valid")
+
+	invalid := valid
+	invalid.MaxReplicas = 0
+	Assert(t).IsNotNil(invalid.Validate(), "should require max replicas to be at least min replicas")
+
+	invalid = valid
+	invalid.Metric = &fields.MetricTarget{URL: "http://example.com/metric", Target: 1}
+	Assert(t).IsNotNil(invalid.Validate(), "should require the metric URL to include the node")
+
+	invalid = valid
+	invalid.Schedule = []fields.ScheduledReplicas{{Start: "9am", End: "17:00"}}
+	Assert(t).IsNotNil(invalid.Validate(), "should require schedule times to be HH:MM")
+}
@@ -0,0 +1,266 @@
+package autoscale
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/autoscale/fields"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/rc"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/autoscalestore"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultInterval is how often each RC is autoscaled if the farm isn't given
+// an interval
+const DefaultInterval = time.Minute
+
+type WatchingPolicyStore interface {
+	PolicyStore
+	Watch(quit <-chan struct{}) (<-chan []fields.Policy, <-chan error)
+}
+
+type Labeler interface {
+	rc.LabelMatcher
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+}
+
+type sessionStore interface {
+	NewUnmanagedSession(session, name string) consul.Session
+}
+
+// The Farm is responsible for autoscaling the RCs that have autoscaling
+// policies. Like the RC and roll farms, multiple farms can exist
+// simultaneously, each holding a different Consul session, and each policy is
+// locked by the farm applying it.
+type Farm struct {
+	store    sessionStore
+	policies WatchingPolicyStore
+	rcs      ReplicationControllerStore
+	rolls    RollingUpdateLister
+	labeler  Labeler
+	hcheck   HealthChecker
+	sessions <-chan string
+	interval time.Duration
+
+	children map[rc_fields.ID]childAutoscaler
+	childMu  sync.Mutex
+	session  consul.Session
+
+	logger     logging.Logger
+	rcSelector klabels.Selector
+}
+
+type childAutoscaler struct {
+	unlocker consulutil.Unlocker
+	quit     chan<- struct{}
+}
+
+func NewFarm(
+	store sessionStore,
+	policies WatchingPolicyStore,
+	rcs ReplicationControllerStore,
+	rolls RollingUpdateLister,
+	labeler Labeler,
+	hcheck HealthChecker,
+	sessions <-chan string,
+	logger logging.Logger,
+	rcSelector klabels.Selector,
+	interval time.Duration,
+) *Farm {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Farm{
+		store:      store,
+		policies:   policies,
+		rcs:        rcs,
+		rolls:      rolls,
+		labeler:    labeler,
+		hcheck:     hcheck,
+		sessions:   sessions,
+		interval:   interval,
+		children:   make(map[rc_fields.ID]childAutoscaler),
+		logger:     logger,
+		rcSelector: rcSelector,
+	}
+}
+
+// Start is a blocking function that monitors Consul for autoscaling policies.
+// The Farm will attempt to claim policies as they appear and, if successful,
+// will start goroutines that apply them. Closing the quit channel will cause
+// this function to return, releasing all locks it holds.
+//
+// Start is not safe for concurrent execution. Do not execute multiple
+// concurrent instances of Start.
+func (f *Farm) Start(quit <-chan struct{}) {
+	consulutil.WithSession(quit, f.sessions, func(sessionQuit <-chan struct{}, session string) {
+		f.logger.WithField("session", session).Infoln("Acquired new session")
+		f.session = f.store.NewUnmanagedSession(session, "")
+		f.mainLoop(sessionQuit)
+	})
+}
+
+func (f *Farm) mainLoop(quit <-chan struct{}) {
+	subQuit := make(chan struct{})
+	defer close(subQuit)
+	policyWatch, policyErr := f.policies.Watch(subQuit)
+
+START_LOOP:
+	for {
+		select {
+		case <-quit:
+			f.logger.NoFields().Infoln("Session expired, releasing autoscaling policies")
+			f.session = nil
+			f.releaseChildren()
+			return
+		case err := <-policyErr:
+			f.logger.WithError(err).Errorln("Could not read autoscaling policies")
+		case policies := <-policyWatch:
+			f.logger.WithField("n", len(policies)).Debugln("Received autoscaling policy update")
+
+			// track which children were found in the returned set
+			foundChildren := make(map[rc_fields.ID]struct{})
+			for _, policy := range policies {
+				logger := f.logger.SubLogger(logrus.Fields{
+					"rc": policy.RCID,
+				})
+				if _, ok := f.children[policy.RCID]; ok {
+					// this one is already ours, skip
+					foundChildren[policy.RCID] = struct{}{}
+					continue
+				}
+
+				shouldWorkOn, err := f.shouldWorkOn(policy.RCID)
+				if err != nil {
+					logger.WithError(err).Errorf("Could not determine if should work on RC %s, skipping", policy.RCID)
+					continue
+				}
+				if !shouldWorkOn {
+					logger.Infof("Ignoring autoscaling policy for RC %s, not meant for this farm", policy.RCID)
+					continue
+				}
+
+				lockPath, err := autoscalestore.PolicyLockPath(policy.RCID)
+				if err != nil {
+					logger.WithError(err).Errorln("Unable to compute autoscaling policy lock path")
+					continue
+				}
+				unlocker, err := f.session.Lock(lockPath)
+				if _, ok := err.(consulutil.AlreadyLockedError); ok {
+					// someone else must have gotten it first - log and
+					// move to the next one
+					logger.NoFields().Debugln("Lock on autoscaling policy was denied")
+					continue
+				} else if err != nil {
+					logger.WithError(err).Errorln("Got error while locking autoscaling policy - session may be expired")
+					// chances are this error is a network problem or
+					// session expiry, and all the others in this
+					// update would also fail
+					continue START_LOOP
+				}
+
+				logger.NoFields().Infoln("Acquired lock on autoscaling policy, spawning")
+				child := &autoscaler{
+					id:         policy.RCID,
+					policies:   f.policies,
+					rcs:        f.rcs,
+					rolls:      f.rolls,
+					labeler:    f.labeler,
+					hcheck:     f.hcheck,
+					logger:     logger,
+					lastScaled: time.Now(),
+				}
+				childQuit := make(chan struct{})
+				f.children[policy.RCID] = childAutoscaler{
+					unlocker: unlocker,
+					quit:     childQuit,
+				}
+				foundChildren[policy.RCID] = struct{}{}
+
+				go func(id rc_fields.ID) {
+					defer func() {
+						if r := recover(); r != nil {
+							err := util.Errorf("Caught panic in autoscale farm: %s", r)
+
+							stackErr, ok := err.(util.StackError)
+							msg := "Caught panic in autoscale farm"
+							if ok {
+								msg = fmt.Sprintf("%s:\n%s", msg, stackErr.Stack())
+							}
+							logger.WithError(err).Errorln(msg)
+
+							// Release the child so that another farm can reattempt
+							f.childMu.Lock()
+							defer f.childMu.Unlock()
+							if _, ok := f.children[id]; ok {
+								f.releaseChild(id)
+							}
+						}
+					}()
+					child.run(f.interval, childQuit)
+				}(policy.RCID)
+			}
+
+			// now remove any children that were not found in the result set
+			f.releaseDeletedChildren(foundChildren)
+		}
+	}
+}
+
+// test if the farm should work on the given replication controller ID
+func (f *Farm) shouldWorkOn(rcID rc_fields.ID) (bool, error) {
+	if f.rcSelector.Empty() {
+		return true, nil
+	}
+	labels, err := f.labeler.GetLabels(labels.RC, rcID.String())
+	if err != nil {
+		return false, err
+	}
+	return f.rcSelector.Matches(labels.Labels), nil
+}
+
+func (f *Farm) releaseDeletedChildren(foundChildren map[rc_fields.ID]struct{}) {
+	f.childMu.Lock()
+	defer f.childMu.Unlock()
+	for id := range f.children {
+		if _, ok := foundChildren[id]; !ok {
+			f.releaseChild(id)
+		}
+	}
+}
+
+// close one child
+// should only be called with f.childMu locked
+func (f *Farm) releaseChild(id rc_fields.ID) {
+	f.logger.WithField("rc", id).Infoln("Releasing autoscaling policy")
+	close(f.children[id].quit)
+
+	// if our lock is active, attempt to gracefully release it
+	if f.session != nil {
+		err := f.children[id].unlocker.Unlock()
+		if err != nil {
+			f.logger.WithField("rc", id).Warnln("Could not release autoscaling policy lock")
+		}
+	}
+	delete(f.children, id)
+}
+
+// close all children
+func (f *Farm) releaseChildren() {
+	f.childMu.Lock()
+	defer f.childMu.Unlock()
+	for id := range f.children {
+		// it's safe to delete this element during iteration,
+		// because we have already iterated over it
+		f.releaseChild(id)
+	}
+}
@@ -0,0 +1,124 @@
+package fields
+
+import (
+	"strings"
+	"time"
+
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/util"
+)
+
+// NodePlaceholder is replaced by the name of each node in a MetricTarget's URL
+const NodePlaceholder = "{node}"
+
+// ScheduleTimeFormat is the format of the start and end of a ScheduledReplicas
+const ScheduleTimeFormat = "15:04"
+
+// A Policy is how the autoscaler adjusts the replica count of an RC. Each RC
+// has at most one policy, which is identified by the RC's ID.
+//
+// Every target that is set recommends a replica count, and the RC is scaled to
+// the largest of them, bounded by MinReplicas and MaxReplicas. If no target
+// makes a recommendation, the replica count is only brought within the bounds.
+type Policy struct {
+	RCID rc_fields.ID `json:"rc_id"`
+
+	MinReplicas int `json:"min_replicas"`
+	MaxReplicas int `json:"max_replicas"`
+
+	// ScaleUpCooldown and ScaleDownCooldown are the least time after the
+	// replica count was changed before it may be increased or decreased
+	// again
+	ScaleUpCooldown   time.Duration `json:"scale_up_cooldown"`
+	ScaleDownCooldown time.Duration `json:"scale_down_cooldown"`
+
+	// Health, if set, adds replicas while some of them are unhealthy
+	Health *HealthTarget `json:"health,omitempty"`
+
+	// Metric, if set, scales the RC to keep a metric reported by each of
+	// its pods near a target
+	Metric *MetricTarget `json:"metric,omitempty"`
+
+	// Schedule sets the least number of replicas at times of day
+	Schedule []ScheduledReplicas `json:"schedule,omitempty"`
+}
+
+// A HealthTarget recommends the fewest replicas of which at least
+// HealthyPercent would be healthy, assuming that the replicas that are
+// currently unhealthy stay that way and any new ones are healthy
+type HealthTarget struct {
+	HealthyPercent int `json:"healthy_percent"`
+}
+
+// A MetricTarget recommends the replica count at which the average of a metric
+// over the RC's pods would be Target, assuming that the metric is proportional
+// to the load on each pod. The metric is read from URL, with NodePlaceholder
+// replaced by the pod's node, which must respond with just a number.
+type MetricTarget struct {
+	URL    string  `json:"url"`
+	Target float64 `json:"target"`
+}
+
+// ScheduledReplicas recommends at least Replicas between Start and End each
+// day, which are in ScheduleTimeFormat and UTC. If End is before Start, the
+// period spans midnight.
+type ScheduledReplicas struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Replicas int    `json:"replicas"`
+}
+
+// Validate returns an error if the policy can't be applied
+func (p Policy) Validate() error {
+	if p.RCID == "" {
+		return util.Errorf("Autoscaling policy has no RC ID")
+	}
+	if p.MinReplicas < 0 || p.MaxReplicas < p.MinReplicas {
+		return util.Errorf("Autoscaling policy must have 0 <= min replicas (%d) <= max replicas (%d)", p.MinReplicas, p.MaxReplicas)
+	}
+	if p.ScaleUpCooldown < 0 || p.ScaleDownCooldown < 0 {
+		return util.Errorf("Autoscaling cooldowns must not be negative")
+	}
+	if p.Health != nil && (p.Health.HealthyPercent <= 0 || p.Health.HealthyPercent >= 100) {
+		return util.Errorf("Healthy percent must be between 0 and 100, was %d", p.Health.HealthyPercent)
+	}
+	if p.Metric != nil {
+		if !strings.Contains(p.Metric.URL, NodePlaceholder) {
+			return util.Errorf("Metric URL %q must contain %s to be replaced by each pod's node", p.Metric.URL, NodePlaceholder)
+		}
+		if p.Metric.Target <= 0 {
+			return util.Errorf("Metric target must be positive, was %v", p.Metric.Target)
+		}
+	}
+	for _, scheduled := range p.Schedule {
+		_, err := scheduled.Active(time.Time{})
+		if err != nil {
+			return err
+		}
+		if scheduled.Replicas < 0 {
+			return util.Errorf("Scheduled replicas must not be negative, was %d", scheduled.Replicas)
+		}
+	}
+	return nil
+}
+
+// Active returns whether now is within the scheduled period
+func (s ScheduledReplicas) Active(now time.Time) (bool, error) {
+	start, err := time.Parse(ScheduleTimeFormat, s.Start)
+	if err != nil {
+		return false, util.Errorf("Invalid schedule start %q, expected HH:MM", s.Start)
+	}
+	end, err := time.Parse(ScheduleTimeFormat, s.End)
+	if err != nil {
+		return false, util.Errorf("Invalid schedule end %q, expected HH:MM", s.End)
+	}
+
+	utc := now.UTC()
+	minute := utc.Hour()*60 + utc.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+	if startMinute <= endMinute {
+		return startMinute <= minute && minute < endMinute, nil
+	}
+	return minute >= startMinute || minute < endMinute, nil
+}
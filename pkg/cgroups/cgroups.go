@@ -3,6 +3,7 @@ package cgroups
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -16,6 +17,11 @@ import (
 type Subsystems struct {
 	CPU    string
 	Memory string
+
+	// Unified is the mount point of the cgroup v2 hierarchy when the host
+	// uses it for the cpu and memory controllers instead of v1 hierarchies.
+	// CPU and Memory are then the same path.
+	Unified string
 }
 
 var Default Subsystems = Subsystems{
@@ -33,6 +39,10 @@ func (err UnsupportedError) Error() string {
 
 // Find retrieves the mount points for all cgroup subsystems on the host. The
 // result of this operation should be cached if possible.
+//
+// The v1 hierarchies of the cpu and memory controllers are used if they are
+// mounted. Otherwise, the host is assumed to use the v2 (unified) hierarchy,
+// which is also mounted alongside v1 in "hybrid" mode but without controllers.
 func Find() (Subsystems, error) {
 	// For details about how this file is structured, refer to `man proc` or
 	// https://www.kernel.org/doc/Documentation/filesystems/proc.txt section 3.5
@@ -42,7 +52,12 @@ func Find() (Subsystems, error) {
 	}
 	defer mountInfo.Close()
 
+	return findInMountInfo(mountInfo)
+}
+
+func findInMountInfo(mountInfo io.Reader) (Subsystems, error) {
 	var ret Subsystems
+	var unified string
 	scanner := bufio.NewScanner(mountInfo)
 	for scanner.Scan() {
 		lineSegs := strings.Fields(scanner.Text())
@@ -54,6 +69,10 @@ func Find() (Subsystems, error) {
 		fsType := lineSegs[nSegs-3]
 		superOptions := strings.Split(lineSegs[nSegs-1], ",")
 
+		if fsType == "cgroup2" {
+			unified = mountPoint
+			continue
+		}
 		if fsType != "cgroup" {
 			// filesystem type is not "cgroup", skip
 			continue
@@ -68,13 +87,26 @@ func Find() (Subsystems, error) {
 			}
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return Subsystems{}, err
+	}
 
+	if ret.CPU == "" && ret.Memory == "" && unified != "" {
+		return Subsystems{
+			CPU:     unified,
+			Memory:  unified,
+			Unified: unified,
+		}, nil
+	}
 	return ret, nil
 }
 
 // set the number of logical CPUs in a given cgroup, 0 to unrestrict
 // https://www.kernel.org/doc/Documentation/scheduler/sched-bwc.txt
 func (subsys Subsystems) SetCPU(name string, cpus int) error {
+	if subsys.Unified != "" {
+		return subsys.setUnifiedCPU(name, cpus)
+	}
 	if subsys.CPU == "" {
 		return UnsupportedError("cpu")
 	}
@@ -117,20 +149,14 @@ func (subsys Subsystems) SetCPU(name string, cpus int) error {
 // set the memory limit on a cgroup, 0 to unrestrict
 // https://www.kernel.org/doc/Documentation/cgroups/memory.txt
 func (subsys Subsystems) SetMemory(name string, bytes int) error {
+	if subsys.Unified != "" {
+		return subsys.setUnifiedMemory(name, bytes)
+	}
 	if subsys.Memory == "" {
 		return UnsupportedError("memory")
 	}
 
-	softLimit := bytes
-	hardLimit := 2 * bytes
-	if hardLimit < softLimit {
-		// Deal with overflow
-		hardLimit = softLimit
-	}
-	if bytes == 0 {
-		softLimit = -1
-		hardLimit = -1
-	}
+	softLimit, hardLimit := memoryLimits(bytes)
 
 	err := os.MkdirAll(filepath.Join(subsys.Memory, name), 0755)
 	if err != nil && !os.IsExist(err) {
@@ -162,6 +188,23 @@ func (subsys Subsystems) SetMemory(name string, bytes int) error {
 	return nil
 }
 
+// memoryLimits returns the soft and hard limits of a cgroup limited to bytes,
+// or -1 to unrestrict. The soft limit is reclaimed down to when the host is
+// short of memory, and the hard limit can never be exceeded.
+func memoryLimits(bytes int) (int, int) {
+	softLimit := bytes
+	hardLimit := 2 * bytes
+	if hardLimit < softLimit {
+		// Deal with overflow
+		hardLimit = softLimit
+	}
+	if bytes == 0 {
+		softLimit = -1
+		hardLimit = -1
+	}
+	return softLimit, hardLimit
+}
+
 func (subsys Subsystems) Write(config Config) error {
 	err := subsys.SetCPU(config.Name, config.CPUs)
 	if err != nil {
@@ -171,6 +214,9 @@ func (subsys Subsystems) Write(config Config) error {
 }
 
 func (subsys Subsystems) AddPID(name string, pid int) error {
+	if subsys.Unified != "" {
+		return appendIntToFile(filepath.Join(subsys.Unified, name, "cgroup.procs"), pid)
+	}
 	err := appendIntToFile(filepath.Join(subsys.Memory, name, "cgroup.procs"), pid)
 	if err != nil {
 		return err
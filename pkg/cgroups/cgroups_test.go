@@ -0,0 +1,72 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+const (
+	procMount    = "20 1 0:4 / /proc rw,nosuid,nodev,noexec,relatime shared:5 - proc proc rw\n"
+	v1CPUMount   = "31 25 0:27 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:9 - cgroup cgroup rw,cpu,cpuacct\n"
+	v1MemMount   = "32 25 0:28 / /sys/fs/cgroup/memory rw,nosuid,nodev,noexec,relatime shared:10 - cgroup cgroup rw,memory\n"
+	hybridMount  = "30 25 0:26 / /sys/fs/cgroup/unified rw,nosuid,nodev,noexec,relatime shared:8 - cgroup2 cgroup2 rw\n"
+	unifiedMount = "30 25 0:26 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:8 - cgroup2 cgroup2 rw,nsdelegate\n"
+)
+
+func TestFindDetectsCgroupMode(t *testing.T) {
+	subsys, err := findInMountInfo(strings.NewReader(procMount + v1CPUMount + v1MemMount))
+	Assert(t).IsNil(err, "should have parsed v1 mounts")
+	Assert(t).AreEqual(subsys, Subsystems{CPU: "/sys/fs/cgroup/cpu,cpuacct", Memory: "/sys/fs/cgroup/memory"}, "should have used the v1 hierarchies")
+
+	subsys, err = findInMountInfo(strings.NewReader(procMount + hybridMount + v1CPUMount + v1MemMount))
+	Assert(t).IsNil(err, "should have parsed hybrid mounts")
+	Assert(t).AreEqual(subsys.Unified, "", "should have used the v1 controllers in hybrid mode")
+	Assert(t).AreEqual(subsys.CPU, "/sys/fs/cgroup/cpu,cpuacct", "should have used the v1 controllers in hybrid mode")
+
+	subsys, err = findInMountInfo(strings.NewReader(procMount + unifiedMount))
+	Assert(t).IsNil(err, "should have parsed unified mounts")
+	Assert(t).AreEqual(subsys, Subsystems{CPU: "/sys/fs/cgroup", Memory: "/sys/fs/cgroup", Unified: "/sys/fs/cgroup"}, "should have used the unified hierarchy")
+}
+
+func readCgroupFile(t *testing.T, path string) string {
+	contents, err := ioutil.ReadFile(path)
+	Assert(t).IsNil(err, "could not read "+path)
+	return strings.TrimSpace(string(contents))
+}
+
+func TestUnifiedLimits(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup2")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	defer os.RemoveAll(root)
+	subsys := Subsystems{CPU: root, Memory: root, Unified: root}
+
+	err = ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("pids\n"), 0644)
+	Assert(t).IsNil(err, "could not write controllers")
+	err = subsys.Write(Config{Name: "pod__app", CPUs: 2, Memory: 1024})
+	Assert(t).IsNotNil(err, "should have erred without the cpu controller")
+	_, ok := err.(UnsupportedError)
+	Assert(t).IsTrue(ok, "should have reported the controller as unsupported")
+
+	err = ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpuset cpu io memory pids\n"), 0644)
+	Assert(t).IsNil(err, "could not write controllers")
+	err = subsys.Write(Config{Name: "pod__app", CPUs: 2, Memory: 1024})
+	Assert(t).IsNil(err, "should have set limits")
+	Assert(t).AreEqual(readCgroupFile(t, filepath.Join(root, "cgroup.subtree_control")), "+memory", "should have enabled the controllers for the cgroup")
+	Assert(t).AreEqual(readCgroupFile(t, filepath.Join(root, "pod__app", "cpu.max")), "2000000 1000000", "unexpected cpu limit")
+	Assert(t).AreEqual(readCgroupFile(t, filepath.Join(root, "pod__app", "memory.low")), "1024", "unexpected soft memory limit")
+	Assert(t).AreEqual(readCgroupFile(t, filepath.Join(root, "pod__app", "memory.max")), "2048", "unexpected hard memory limit")
+
+	err = subsys.Write(Config{Name: "pod__app"})
+	Assert(t).IsNil(err, "should have removed limits")
+	Assert(t).AreEqual(readCgroupFile(t, filepath.Join(root, "pod__app", "cpu.max")), "max 100000", "cpu should have been unrestricted")
+	Assert(t).AreEqual(readCgroupFile(t, filepath.Join(root, "pod__app", "memory.max")), "max", "memory should have been unrestricted")
+
+	err = subsys.AddPID("pod__app", 0)
+	Assert(t).IsNil(err, "should have added the process")
+	Assert(t).AreEqual(readCgroupFile(t, filepath.Join(root, "pod__app", "cgroup.procs")), "0", "should have added the process to the cgroup")
+}
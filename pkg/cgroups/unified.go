@@ -0,0 +1,99 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// The limits of the cgroup v2 hierarchy, documented in
+// https://www.kernel.org/doc/Documentation/cgroup-v2.txt, are set to match the
+// v1 limits: the same CPU bandwidth, memory.low in place of the soft limit,
+// memory.max in place of the hard limit and no swap beyond the hard limit.
+
+const unlimited = "max"
+
+// enableController makes controller available to the cgroup name and its
+// ancestors. cgroup v2 only lets a cgroup use the controllers that its parent
+// enables for its children.
+func (subsys Subsystems) enableController(name string, controller string) error {
+	controllers, err := ioutil.ReadFile(filepath.Join(subsys.Unified, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+	available := false
+	for _, c := range strings.Fields(string(controllers)) {
+		if c == controller {
+			available = true
+		}
+	}
+	if !available {
+		return UnsupportedError(controller)
+	}
+
+	dir := subsys.Unified
+	for _, part := range strings.Split(filepath.Clean(name), string(filepath.Separator)) {
+		err = ioutil.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+"+controller+"\n"), 0644)
+		if err != nil {
+			return util.Errorf("Could not enable the %s controller in %s: %s", controller, dir, err)
+		}
+		dir = filepath.Join(dir, part)
+		err = os.Mkdir(dir, 0755)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// set the number of logical CPUs in a given cgroup v2, 0 to unrestrict
+func (subsys Subsystems) setUnifiedCPU(name string, cpus int) error {
+	err := subsys.enableController(name, "cpu")
+	if err != nil {
+		return err
+	}
+
+	period := 1000000 // one million microseconds
+	max := strconv.Itoa(cpus*period) + " " + strconv.Itoa(period)
+	if cpus == 0 {
+		// the kernel's default period
+		max = unlimited + " 100000"
+	}
+	_, err = util.WriteIfChanged(filepath.Join(subsys.Unified, name, "cpu.max"), []byte(max+"\n"), 0644)
+	return err
+}
+
+// set the memory limit on a cgroup v2, 0 to unrestrict
+func (subsys Subsystems) setUnifiedMemory(name string, bytes int) error {
+	err := subsys.enableController(name, "memory")
+	if err != nil {
+		return err
+	}
+
+	low, max, swapMax := "0", unlimited, unlimited
+	if bytes != 0 {
+		softLimit, hardLimit := memoryLimits(bytes)
+		low, max, swapMax = strconv.Itoa(softLimit), strconv.Itoa(hardLimit), "0"
+	}
+
+	_, err = util.WriteIfChanged(filepath.Join(subsys.Unified, name, "memory.low"), []byte(low+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	_, err = util.WriteIfChanged(filepath.Join(subsys.Unified, name, "memory.max"), []byte(max+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+
+	// memory.swap.max only exists if the kernel accounts for swap
+	swapFile := filepath.Join(subsys.Unified, name, "memory.swap.max")
+	if _, err = os.Stat(swapFile); os.IsNotExist(err) {
+		return nil
+	}
+	_, err = util.WriteIfChanged(swapFile, []byte(swapMax+"\n"), 0644)
+	return err
+}
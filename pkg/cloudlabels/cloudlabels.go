@@ -0,0 +1,201 @@
+// Package cloudlabels syncs a node's attributes from its cloud provider, such
+// as its availability zone and instance type, into its node labels, so that
+// schedulers can select nodes by them without the labels being maintained by
+// hand.
+package cloudlabels
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// The providers that attributes can be read from
+const (
+	EC2Provider = "ec2"
+	GCEProvider = "gce"
+)
+
+// The values of the instance_lifecycle label
+const (
+	OnDemandLifecycle = "on-demand"
+	SpotLifecycle     = "spot"
+)
+
+// The values of the instance_state label
+const (
+	RunningState = "running"
+	// TerminatingState is set once the provider has announced that the
+	// instance will be terminated or preempted
+	TerminatingState = "terminating"
+)
+
+// DefaultInterval is how often attributes are synced if Config doesn't set
+// Interval
+const DefaultInterval = 5 * time.Minute
+
+// metadataTimeout bounds each request to the metadata service, which is
+// local to the instance
+const metadataTimeout = 5 * time.Second
+
+// Config configures where a node's attributes are read from
+type Config struct {
+	// Provider is EC2Provider or GCEProvider
+	Provider string `yaml:"provider"`
+
+	// MetadataURL overrides the address of the provider's instance
+	// metadata service, e.g. for a proxy
+	MetadataURL string `yaml:"metadata_url,omitempty"`
+
+	// Interval is how often attributes are synced. Defaults to
+	// DefaultInterval. They are synced often so that instance_state
+	// changes soon after a termination is announced.
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// Attributes are a node's attributes as read from its provider. Attributes
+// that the provider doesn't report are empty.
+type Attributes struct {
+	AvailabilityZone string
+	InstanceType     string
+	// Lifecycle is OnDemandLifecycle or SpotLifecycle
+	Lifecycle string
+	// State is RunningState or TerminatingState
+	State string
+}
+
+// Labels returns the node labels of the attributes that are set
+func (a Attributes) Labels() map[string]string {
+	ret := make(map[string]string)
+	for key, value := range map[string]string{
+		types.AvailabilityZoneLabel:  a.AvailabilityZone,
+		types.InstanceTypeLabel:      a.InstanceType,
+		types.InstanceLifecycleLabel: a.Lifecycle,
+		types.InstanceStateLabel:     a.State,
+	} {
+		if value != "" {
+			ret[key] = value
+		}
+	}
+	return ret
+}
+
+// A Provider reads the attributes of the instance it runs on
+type Provider interface {
+	Attributes() (Attributes, error)
+}
+
+// A TerminationNotifier reports whether the instance it runs on has been
+// given notice that it will be terminated, such as a spot interruption or a
+// preemption
+type TerminationNotifier interface {
+	TerminationNotice() (bool, error)
+}
+
+// provider is implemented by each of the providers
+type provider interface {
+	Provider
+	TerminationNotifier
+}
+
+// NewProvider returns the provider of the config
+func NewProvider(config Config) (Provider, error) {
+	return newProvider(config)
+}
+
+// NewTerminationNotifier returns the termination notifier of the config's
+// provider
+func NewTerminationNotifier(config Config) (TerminationNotifier, error) {
+	return newProvider(config)
+}
+
+func newProvider(config Config) (provider, error) {
+	client := &http.Client{Timeout: metadataTimeout}
+	switch config.Provider {
+	case EC2Provider:
+		return NewEC2(config.MetadataURL, client), nil
+	case GCEProvider:
+		return NewGCE(config.MetadataURL, client), nil
+	default:
+		return nil, util.Errorf("cloud provider must be %q or %q, not %q", EC2Provider, GCEProvider, config.Provider)
+	}
+}
+
+type Labeler interface {
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+	SetLabels(labelType labels.Type, id string, labels map[string]string) error
+}
+
+// Syncer syncs the attributes of the node it runs on into its labels. Only
+// the labels whose attributes changed are written, and labels of attributes
+// that the provider stops reporting are left as they are.
+type Syncer struct {
+	node     types.NodeName
+	provider Provider
+	labeler  Labeler
+	interval time.Duration
+	logger   logging.Logger
+}
+
+func NewSyncer(node types.NodeName, provider Provider, labeler Labeler, interval time.Duration, logger logging.Logger) *Syncer {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Syncer{
+		node:     node,
+		provider: provider,
+		labeler:  labeler,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Sync reads the node's attributes and writes the labels that changed. It
+// returns the labels that were written.
+func (s *Syncer) Sync() (map[string]string, error) {
+	attributes, err := s.provider.Attributes()
+	if err != nil {
+		return nil, util.Errorf("could not read the node's cloud attributes: %s", err)
+	}
+	current, err := s.labeler.GetLabels(labels.NODE, s.node.String())
+	if err != nil {
+		return nil, util.Errorf("could not read the node's labels: %s", err)
+	}
+
+	changed := make(map[string]string)
+	for key, value := range attributes.Labels() {
+		if !current.Labels.Has(key) || current.Labels.Get(key) != value {
+			changed[key] = value
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	err = s.labeler.SetLabels(labels.NODE, s.node.String(), changed)
+	if err != nil {
+		return nil, util.Errorf("could not label the node: %s", err)
+	}
+	return changed, nil
+}
+
+// Run syncs the node's labels every interval until quit is closed
+func (s *Syncer) Run(quit <-chan struct{}) {
+	for {
+		changed, err := s.Sync()
+		if err != nil {
+			s.logger.WithError(err).Warnln("Could not sync the node's cloud labels")
+		} else if len(changed) > 0 {
+			s.logger.WithField("labels", changed).Infoln("Synced the node's cloud labels")
+		}
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(s.interval):
+		}
+	}
+}
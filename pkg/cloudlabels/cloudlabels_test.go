@@ -0,0 +1,159 @@
+package cloudlabels
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestEC2Attributes(t *testing.T) {
+	metadata := map[string]string{
+		"/latest/meta-data/placement/availability-zone": "us-west-2a",
+		"/latest/meta-data/instance-type":               "m5.large",
+		"/latest/meta-data/instance-life-cycle":         "spot",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != "PUT" || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte("token"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		value, ok := metadata[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(value + "\n"))
+	}))
+	defer server.Close()
+
+	provider := NewEC2(server.URL, http.DefaultClient)
+	attributes, err := provider.Attributes()
+	Assert(t).IsNil(err, "should have read attributes")
+	Assert(t).AreEqual(attributes, Attributes{
+		AvailabilityZone: "us-west-2a",
+		InstanceType:     "m5.large",
+		Lifecycle:        SpotLifecycle,
+		State:            RunningState,
+	}, "unexpected attributes")
+
+	metadata["/latest/meta-data/spot/instance-action"] = `{"action": "terminate", "time": "2017-09-18T08:22:00Z"}`
+	attributes, err = provider.Attributes()
+	Assert(t).IsNil(err, "should have read attributes")
+	Assert(t).AreEqual(attributes.State, TerminatingState, "should be terminating with an interruption notice")
+	notice, err := provider.TerminationNotice()
+	Assert(t).IsNil(err, "should have read the termination notice")
+	Assert(t).IsTrue(notice, "should have a termination notice with an interruption notice")
+}
+
+func TestGCEAttributes(t *testing.T) {
+	metadata := map[string]string{
+		"/computeMetadata/v1/instance/zone":                   "projects/123/zones/us-central1-a",
+		"/computeMetadata/v1/instance/machine-type":           "projects/123/machineTypes/n1-standard-4",
+		"/computeMetadata/v1/instance/scheduling/preemptible": "FALSE",
+		"/computeMetadata/v1/instance/preempted":              "FALSE",
+		"/computeMetadata/v1/instance/maintenance-event":      "NONE",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		value, ok := metadata[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(value))
+	}))
+	defer server.Close()
+
+	provider := NewGCE(server.URL, http.DefaultClient)
+	attributes, err := provider.Attributes()
+	Assert(t).IsNil(err, "should have read attributes")
+	Assert(t).AreEqual(attributes, Attributes{
+		AvailabilityZone: "us-central1-a",
+		InstanceType:     "n1-standard-4",
+		Lifecycle:        OnDemandLifecycle,
+		State:            RunningState,
+	}, "unexpected attributes")
+
+	notice, err := provider.TerminationNotice()
+	Assert(t).IsNil(err, "should have read the termination notice")
+	Assert(t).IsFalse(notice, "should not have a termination notice before being preempted")
+
+	metadata["/computeMetadata/v1/instance/preempted"] = "TRUE"
+	attributes, err = provider.Attributes()
+	Assert(t).IsNil(err, "should have read attributes")
+	Assert(t).AreEqual(attributes.State, TerminatingState, "should be terminating once preempted")
+}
+
+type fakeProvider struct {
+	attributes Attributes
+}
+
+func (f *fakeProvider) Attributes() (Attributes, error) {
+	return f.attributes, nil
+}
+
+type countingLabeler struct {
+	labels.Applicator
+	sets int
+}
+
+func (c *countingLabeler) SetLabels(labelType labels.Type, id string, values map[string]string) error {
+	c.sets++
+	return c.Applicator.SetLabels(labelType, id, values)
+}
+
+func TestSyncOnlyWritesChangedLabels(t *testing.T) {
+	applicator := &countingLabeler{Applicator: labels.NewFakeApplicator()}
+	err := applicator.Applicator.SetLabel(labels.NODE, "node1", "rack", "r12")
+	Assert(t).IsNil(err, "test setup: could not label node")
+	provider := &fakeProvider{Attributes{AvailabilityZone: "us-west-2a", InstanceType: "m5.large", Lifecycle: OnDemandLifecycle, State: RunningState}}
+	syncer := NewSyncer("node1", provider, applicator, 0, logging.TestLogger())
+
+	changed, err := syncer.Sync()
+	Assert(t).IsNil(err, "should have synced")
+	Assert(t).AreEqual(len(changed), 4, "should have written every attribute")
+	labeled, err := applicator.GetLabels(labels.NODE, "node1")
+	Assert(t).IsNil(err, "should have read the node's labels")
+	Assert(t).AreEqual(labeled.Labels.Get(types.AvailabilityZoneLabel), "us-west-2a", "should have labeled the node's zone")
+	Assert(t).AreEqual(labeled.Labels.Get(types.InstanceTypeLabel), "m5.large", "should have labeled the node's instance type")
+	Assert(t).AreEqual(labeled.Labels.Get("rack"), "r12", "should have kept the node's other labels")
+
+	changed, err = syncer.Sync()
+	Assert(t).IsNil(err, "should have synced")
+	Assert(t).AreEqual(len(changed), 0, "should not have written unchanged labels")
+	Assert(t).AreEqual(applicator.sets, 1, "should not have written to the labels again")
+
+	provider.attributes.State = TerminatingState
+	provider.attributes.InstanceType = ""
+	changed, err = syncer.Sync()
+	Assert(t).IsNil(err, "should have synced")
+	Assert(t).AreEqual(len(changed), 1, "should have only written the changed label")
+	Assert(t).AreEqual(changed[types.InstanceStateLabel], TerminatingState, "should have written the node's new state")
+	labeled, err = applicator.GetLabels(labels.NODE, "node1")
+	Assert(t).IsNil(err, "should have read the node's labels")
+	Assert(t).AreEqual(labeled.Labels.Get(types.InstanceTypeLabel), "m5.large", "should have kept the label of an attribute that isn't reported")
+}
+
+func TestNewProvider(t *testing.T) {
+	_, err := NewProvider(Config{Provider: EC2Provider})
+	Assert(t).IsNil(err, "should have made an ec2 provider")
+	_, err = NewProvider(Config{Provider: "azure"})
+	Assert(t).IsNotNil(err, "should not make an unknown provider")
+}
@@ -0,0 +1,144 @@
+package cloudlabels
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultEC2MetadataURL is the address of EC2's instance metadata service
+const DefaultEC2MetadataURL = "http://169.254.169.254"
+
+// ec2TokenTTL is how long, in seconds, the session tokens that metadata is
+// read with last. A token is requested for each sync.
+const ec2TokenTTL = "300"
+
+// EC2 reads attributes from EC2's instance metadata service, using IMDSv2
+// session tokens
+type EC2 struct {
+	baseURL string
+	client  *http.Client
+}
+
+var _ Provider = EC2{}
+var _ TerminationNotifier = EC2{}
+
+func NewEC2(baseURL string, client *http.Client) EC2 {
+	if baseURL == "" {
+		baseURL = DefaultEC2MetadataURL
+	}
+	return EC2{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  client,
+	}
+}
+
+// Attributes reads the instance's availability zone and type. Its lifecycle
+// is spot if it is a spot instance, and its state is terminating once it has
+// a spot interruption notice or its auto scaling group is terminating it.
+func (e EC2) Attributes() (Attributes, error) {
+	token, err := e.token()
+	if err != nil {
+		return Attributes{}, err
+	}
+
+	var attributes Attributes
+	attributes.AvailabilityZone, _, err = e.get(token, "placement/availability-zone")
+	if err != nil {
+		return Attributes{}, err
+	}
+	attributes.InstanceType, _, err = e.get(token, "instance-type")
+	if err != nil {
+		return Attributes{}, err
+	}
+
+	lifecycle, _, err := e.get(token, "instance-life-cycle")
+	if err != nil {
+		return Attributes{}, err
+	}
+	attributes.Lifecycle = OnDemandLifecycle
+	if lifecycle == SpotLifecycle {
+		attributes.Lifecycle = SpotLifecycle
+	}
+
+	attributes.State = RunningState
+	terminating, err := e.terminating(token)
+	if err != nil {
+		return Attributes{}, err
+	}
+	if terminating {
+		attributes.State = TerminatingState
+	}
+	return attributes, nil
+}
+
+// TerminationNotice returns true once the instance has a spot interruption
+// notice or its auto scaling group is terminating it
+func (e EC2) TerminationNotice() (bool, error) {
+	token, err := e.token()
+	if err != nil {
+		return false, err
+	}
+	return e.terminating(token)
+}
+
+func (e EC2) terminating(token string) (bool, error) {
+	_, interrupted, err := e.get(token, "spot/instance-action")
+	if err != nil {
+		return false, err
+	}
+	targetState, _, err := e.get(token, "autoscaling/target-lifecycle-state")
+	if err != nil {
+		return false, err
+	}
+	return interrupted || targetState == "Terminated", nil
+}
+
+func (e EC2) token() (string, error) {
+	req, err := http.NewRequest("PUT", e.baseURL+"/latest/api/token", nil)
+	if err != nil {
+		return "", util.Errorf("could not build EC2 metadata token request: %s", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", ec2TokenTTL)
+	body, found, err := do(e.client, req)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", util.Errorf("EC2 metadata service has no token endpoint")
+	}
+	return body, nil
+}
+
+// get returns the metadata at path and whether it exists
+func (e EC2) get(token string, path string) (string, bool, error) {
+	req, err := http.NewRequest("GET", e.baseURL+"/latest/meta-data/"+path, nil)
+	if err != nil {
+		return "", false, util.Errorf("could not build EC2 metadata request: %s", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	return do(e.client, req)
+}
+
+// do returns the trimmed body of the response to req, and false if its
+// resource doesn't exist
+func do(client *http.Client, req *http.Request) (string, bool, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", false, util.Errorf("could not read %s: %s", req.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, util.Errorf("could not read %s: %s", req.URL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", false, util.Errorf("could not read %s: %s: %s", req.URL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return strings.TrimSpace(string(body)), true, nil
+}
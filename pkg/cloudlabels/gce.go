@@ -0,0 +1,98 @@
+package cloudlabels
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultGCEMetadataURL is the address of GCE's instance metadata server
+const DefaultGCEMetadataURL = "http://metadata.google.internal"
+
+// GCE reads attributes from GCE's instance metadata server
+type GCE struct {
+	baseURL string
+	client  *http.Client
+}
+
+var _ Provider = GCE{}
+var _ TerminationNotifier = GCE{}
+
+func NewGCE(baseURL string, client *http.Client) GCE {
+	if baseURL == "" {
+		baseURL = DefaultGCEMetadataURL
+	}
+	return GCE{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  client,
+	}
+}
+
+// Attributes reads the instance's zone and machine type. Its lifecycle is
+// spot if it is preemptible, and its state is terminating once it has been
+// preempted or is about to be stopped for host maintenance.
+func (g GCE) Attributes() (Attributes, error) {
+	var attributes Attributes
+	// the zone and machine type are paths, e.g.
+	// projects/123/zones/us-central1-a
+	zone, err := g.get("zone")
+	if err != nil {
+		return Attributes{}, err
+	}
+	if zone != "" {
+		attributes.AvailabilityZone = path.Base(zone)
+	}
+	machineType, err := g.get("machine-type")
+	if err != nil {
+		return Attributes{}, err
+	}
+	if machineType != "" {
+		attributes.InstanceType = path.Base(machineType)
+	}
+
+	preemptible, err := g.get("scheduling/preemptible")
+	if err != nil {
+		return Attributes{}, err
+	}
+	attributes.Lifecycle = OnDemandLifecycle
+	if preemptible == "TRUE" {
+		attributes.Lifecycle = SpotLifecycle
+	}
+
+	terminating, err := g.TerminationNotice()
+	if err != nil {
+		return Attributes{}, err
+	}
+	attributes.State = RunningState
+	if terminating {
+		attributes.State = TerminatingState
+	}
+	return attributes, nil
+}
+
+// TerminationNotice returns true once the instance has been preempted or is
+// about to be stopped for host maintenance
+func (g GCE) TerminationNotice() (bool, error) {
+	preempted, err := g.get("preempted")
+	if err != nil {
+		return false, err
+	}
+	maintenance, err := g.get("maintenance-event")
+	if err != nil {
+		return false, err
+	}
+	return preempted == "TRUE" || maintenance == "TERMINATE_ON_HOST_MAINTENANCE", nil
+}
+
+// get returns the instance metadata at key, or "" if it doesn't exist
+func (g GCE) get(key string) (string, error) {
+	req, err := http.NewRequest("GET", g.baseURL+"/computeMetadata/v1/instance/"+key, nil)
+	if err != nil {
+		return "", util.Errorf("could not build GCE metadata request: %s", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	body, _, err := do(g.client, req)
+	return body, err
+}
@@ -0,0 +1,268 @@
+// Package convergence reports how the reality of each node differs from its
+// intent: the pods it should be running but isn't, the pods it is running but
+// shouldn't be, and the pods it is running a different manifest of. A Reporter
+// watches both trees and publishes the divergence of each node to the
+// convergence tree of the store, where tooling can read it with
+// ListDivergences to answer whether the fleet has converged, and to metrics.
+package convergence
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/logging"
+	p2metrics "github.com/square/p2/pkg/metrics"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// The gauges a Reporter updates each time it publishes the divergence of the
+// fleet
+const (
+	DivergedNodesMetric  = "convergence_diverged_nodes"
+	MissingPodsMetric    = "convergence_missing_pods"
+	ExtraPodsMetric      = "convergence_extra_pods"
+	MismatchedPodsMetric = "convergence_mismatched_pods"
+)
+
+// DefaultPauseTime is how long a Reporter pauses between watches of each tree
+// if it isn't given a pause time
+const DefaultPauseTime = 1 * time.Second
+
+// Diff returns the divergence of each node whose reality differs from its
+// intent. Nodes that have converged are left out, and the divergences' Since
+// is not set. The pods of each divergence are sorted by pod ID.
+func Diff(intent []consul.ManifestResult, reality []consul.ManifestResult) (map[types.NodeName]consul.Divergence, error) {
+	intentSHAs, err := shasByNode(intent)
+	if err != nil {
+		return nil, err
+	}
+	realitySHAs, err := shasByNode(reality)
+	if err != nil {
+		return nil, err
+	}
+
+	divergences := make(map[types.NodeName]consul.Divergence)
+	for node, pods := range intentSHAs {
+		divergence := divergences[node]
+		for podID, intentSHA := range pods {
+			realitySHA, ok := realitySHAs[node][podID]
+			switch {
+			case !ok:
+				divergence.Missing = append(divergence.Missing, consul.PodDivergence{PodID: podID, IntentSHA: intentSHA})
+			case realitySHA != intentSHA:
+				divergence.Mismatched = append(divergence.Mismatched, consul.PodDivergence{PodID: podID, IntentSHA: intentSHA, RealitySHA: realitySHA})
+			}
+		}
+		divergences[node] = divergence
+	}
+	for node, pods := range realitySHAs {
+		divergence := divergences[node]
+		for podID, realitySHA := range pods {
+			if _, ok := intentSHAs[node][podID]; !ok {
+				divergence.Extra = append(divergence.Extra, consul.PodDivergence{PodID: podID, RealitySHA: realitySHA})
+			}
+		}
+		divergences[node] = divergence
+	}
+
+	for node, divergence := range divergences {
+		if divergence.Converged() {
+			delete(divergences, node)
+			continue
+		}
+		sort.Sort(podsByID(divergence.Missing))
+		sort.Sort(podsByID(divergence.Extra))
+		sort.Sort(podsByID(divergence.Mismatched))
+	}
+	return divergences, nil
+}
+
+func shasByNode(results []consul.ManifestResult) (map[types.NodeName]map[types.PodID]string, error) {
+	shas := make(map[types.NodeName]map[types.PodID]string)
+	for _, result := range results {
+		sha, err := result.Manifest.SHA()
+		if err != nil {
+			return nil, util.Errorf("could not hash the manifest of %s on %s: %s", result.Manifest.ID(), result.PodLocation.Node, err)
+		}
+		node := result.PodLocation.Node
+		if shas[node] == nil {
+			shas[node] = make(map[types.PodID]string)
+		}
+		shas[node][result.Manifest.ID()] = sha
+	}
+	return shas, nil
+}
+
+type podsByID []consul.PodDivergence
+
+func (p podsByID) Len() int           { return len(p) }
+func (p podsByID) Less(i, j int) bool { return p[i].PodID < p[j].PodID }
+func (p podsByID) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// Subset of consul.Store
+type Store interface {
+	WatchAllPods(
+		podPrefix consul.PodPrefix,
+		quitChan <-chan struct{},
+		errChan chan<- error,
+		podChan chan<- []consul.ManifestResult,
+		pauseTime time.Duration,
+	)
+	SetDivergence(node types.NodeName, divergence consul.Divergence) error
+	DeleteDivergence(node types.NodeName) error
+	ListDivergences() ([]consul.DivergenceResult, error)
+}
+
+// Reporter publishes the divergence of each node, as computed by Diff, each
+// time the intent or reality tree changes. Only the nodes whose divergence
+// changed are written, and a node's key is deleted once it has converged, so
+// a node's Since is when it first diverged, even across restarts of the
+// reporter.
+type Reporter struct {
+	store     Store
+	logger    logging.Logger
+	pauseTime time.Duration
+
+	// published is the divergence of each node as last written to the
+	// store
+	published map[types.NodeName]consul.Divergence
+}
+
+// NewReporter returns a Reporter that watches the store's trees, pausing
+// pauseTime between watches
+func NewReporter(store Store, pauseTime time.Duration, logger logging.Logger) *Reporter {
+	if pauseTime <= 0 {
+		pauseTime = DefaultPauseTime
+	}
+	return &Reporter{
+		store:     store,
+		logger:    logger,
+		pauseTime: pauseTime,
+	}
+}
+
+// Run publishes the divergence of the fleet until quit is closed. The
+// divergences already in the store are read first, so that their Since is
+// kept and those of nodes that converged meanwhile are deleted.
+func (r *Reporter) Run(quit <-chan struct{}) {
+	for r.published == nil {
+		results, err := r.store.ListDivergences()
+		if err == nil {
+			r.published = make(map[types.NodeName]consul.Divergence)
+			for _, result := range results {
+				r.published[result.Node] = result.Divergence
+			}
+			break
+		}
+		r.logger.WithError(err).Errorln("Could not list the divergences already published")
+		select {
+		case <-quit:
+			return
+		case <-time.After(r.pauseTime):
+		}
+	}
+
+	errCh := make(chan error)
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case err := <-errCh:
+				r.logger.WithError(err).Errorln("Could not watch pods")
+			}
+		}
+	}()
+	intentCh := make(chan []consul.ManifestResult)
+	realityCh := make(chan []consul.ManifestResult)
+	go r.store.WatchAllPods(consul.INTENT_TREE, quit, errCh, intentCh, r.pauseTime)
+	go r.store.WatchAllPods(consul.REALITY_TREE, quit, errCh, realityCh, r.pauseTime)
+
+	var intent, reality []consul.ManifestResult
+	var haveIntent, haveReality bool
+	for {
+		select {
+		case <-quit:
+			return
+		case intent = <-intentCh:
+			haveIntent = true
+		case reality = <-realityCh:
+			haveReality = true
+		}
+		if !haveIntent || !haveReality {
+			continue
+		}
+		divergences, err := Diff(intent, reality)
+		if err != nil {
+			r.logger.WithError(err).Errorln("Could not compute the divergence of the fleet")
+			continue
+		}
+		r.publish(divergences, time.Now())
+	}
+}
+
+// publish writes the divergences that changed since they were last written,
+// and deletes those of the nodes that converged. Failed writes are logged and
+// retried at the next change.
+func (r *Reporter) publish(divergences map[types.NodeName]consul.Divergence, now time.Time) {
+	for node, divergence := range divergences {
+		previous, ok := r.published[node]
+		if ok && samePods(previous, divergence) {
+			continue
+		}
+		divergence.Since = now
+		if ok {
+			divergence.Since = previous.Since
+		}
+		err := r.store.SetDivergence(node, divergence)
+		if err != nil {
+			r.logger.WithErrorAndFields(err, logrus.Fields{"node": node}).Errorln("Could not publish the node's divergence")
+			continue
+		}
+		r.published[node] = divergence
+	}
+	for node := range r.published {
+		if _, ok := divergences[node]; ok {
+			continue
+		}
+		err := r.store.DeleteDivergence(node)
+		if err != nil {
+			r.logger.WithErrorAndFields(err, logrus.Fields{"node": node}).Errorln("Could not delete the converged node's divergence")
+			continue
+		}
+		delete(r.published, node)
+	}
+
+	var missing, extra, mismatched int64
+	for _, divergence := range divergences {
+		missing += int64(len(divergence.Missing))
+		extra += int64(len(divergence.Extra))
+		mismatched += int64(len(divergence.Mismatched))
+	}
+	metrics.GetOrRegisterGauge(DivergedNodesMetric, p2metrics.Registry).Update(int64(len(divergences)))
+	metrics.GetOrRegisterGauge(MissingPodsMetric, p2metrics.Registry).Update(missing)
+	metrics.GetOrRegisterGauge(ExtraPodsMetric, p2metrics.Registry).Update(extra)
+	metrics.GetOrRegisterGauge(MismatchedPodsMetric, p2metrics.Registry).Update(mismatched)
+	r.logger.WithField("diverged_nodes", len(divergences)).Debugln("Published the divergence of the fleet")
+}
+
+func samePods(a consul.Divergence, b consul.Divergence) bool {
+	return samePodList(a.Missing, b.Missing) && samePodList(a.Extra, b.Extra) && samePodList(a.Mismatched, b.Mismatched)
+}
+
+func samePodList(a []consul.PodDivergence, b []consul.PodDivergence) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package convergence
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+func resultOf(node types.NodeName, podID types.PodID, statusPort int) consul.ManifestResult {
+	builder := manifest.NewBuilder()
+	builder.SetID(podID)
+	builder.SetStatusPort(statusPort)
+	return consul.ManifestResult{
+		Manifest:    builder.GetManifest(),
+		PodLocation: types.PodLocation{Node: node, PodID: podID},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	intent := []consul.ManifestResult{
+		resultOf("node1", "web", 8080),
+		resultOf("node1", "api", 8081),
+		resultOf("node1", "batch", 0),
+		resultOf("node2", "web", 8080),
+	}
+	reality := []consul.ManifestResult{
+		resultOf("node1", "web", 8080),
+		resultOf("node1", "api", 9000),
+		resultOf("node1", "old", 0),
+		resultOf("node2", "web", 8080),
+		resultOf("node3", "web", 8080),
+	}
+
+	divergences, err := Diff(intent, reality)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(divergences) != 2 {
+		t.Fatalf("expected only node1 and node3 to diverge, got %+v", divergences)
+	}
+
+	node1 := divergences["node1"]
+	if len(node1.Missing) != 1 || node1.Missing[0].PodID != "batch" || node1.Missing[0].IntentSHA == "" || node1.Missing[0].RealitySHA != "" {
+		t.Errorf("expected batch to be missing from node1, got %+v", node1.Missing)
+	}
+	if len(node1.Extra) != 1 || node1.Extra[0].PodID != "old" || node1.Extra[0].RealitySHA == "" {
+		t.Errorf("expected old to be extra on node1, got %+v", node1.Extra)
+	}
+	if len(node1.Mismatched) != 1 || node1.Mismatched[0].PodID != "api" || node1.Mismatched[0].IntentSHA == node1.Mismatched[0].RealitySHA {
+		t.Errorf("expected api to be mismatched on node1, got %+v", node1.Mismatched)
+	}
+
+	node3 := divergences["node3"]
+	if len(node3.Extra) != 1 || len(node3.Missing) != 0 || len(node3.Mismatched) != 0 {
+		t.Errorf("expected web to be extra on node3, got %+v", node3)
+	}
+}
+
+// fakeStore sends the pods written to its intent and reality channels to the
+// watches of each tree
+type fakeStore struct {
+	intent  chan []consul.ManifestResult
+	reality chan []consul.ManifestResult
+
+	mu          sync.Mutex
+	divergences map[types.NodeName]consul.Divergence
+	writes      int
+}
+
+func newFakeStore(divergences map[types.NodeName]consul.Divergence) *fakeStore {
+	return &fakeStore{
+		intent:      make(chan []consul.ManifestResult),
+		reality:     make(chan []consul.ManifestResult),
+		divergences: divergences,
+	}
+}
+
+func (f *fakeStore) WatchAllPods(podPrefix consul.PodPrefix, quit <-chan struct{}, _ chan<- error, podChan chan<- []consul.ManifestResult, _ time.Duration) {
+	defer close(podChan)
+	in := f.intent
+	if podPrefix == consul.REALITY_TREE {
+		in = f.reality
+	}
+	for {
+		select {
+		case <-quit:
+			return
+		case pods := <-in:
+			select {
+			case <-quit:
+				return
+			case podChan <- pods:
+			}
+		}
+	}
+}
+
+func (f *fakeStore) SetDivergence(node types.NodeName, divergence consul.Divergence) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	f.divergences[node] = divergence
+	return nil
+}
+
+func (f *fakeStore) DeleteDivergence(node types.NodeName) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.divergences, node)
+	return nil
+}
+
+func (f *fakeStore) ListDivergences() ([]consul.DivergenceResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ret []consul.DivergenceResult
+	for node, divergence := range f.divergences {
+		ret = append(ret, consul.DivergenceResult{Node: node, Divergence: divergence})
+	}
+	return ret, nil
+}
+
+// waitFor waits for condition to hold of the store's divergences
+func (f *fakeStore) waitFor(t *testing.T, description string, condition func(map[types.NodeName]consul.Divergence) bool) {
+	timeout := time.After(5 * time.Second)
+	for {
+		f.mu.Lock()
+		held := condition(f.divergences)
+		f.mu.Unlock()
+		if held {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", description)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestReporterPublishesChangedDivergences(t *testing.T) {
+	web := resultOf("node1", "web", 8080)
+	sha, err := web.Manifest.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Now().Add(-time.Hour)
+	store := newFakeStore(map[types.NodeName]consul.Divergence{
+		// published by a previous reporter: node1 still diverges and
+		// node2 has converged since
+		"node1": {Since: since, Missing: []consul.PodDivergence{{PodID: "web", IntentSHA: sha}}},
+		"node2": {Since: since, Missing: []consul.PodDivergence{{PodID: "web", IntentSHA: sha}}},
+	})
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		NewReporter(store, 0, logging.TestLogger()).Run(quit)
+		close(done)
+	}()
+
+	store.intent <- []consul.ManifestResult{web, resultOf("node2", "web", 8080)}
+	store.reality <- []consul.ManifestResult{resultOf("node2", "web", 8080)}
+	store.waitFor(t, "node2's divergence to be deleted", func(d map[types.NodeName]consul.Divergence) bool {
+		_, ok := d["node2"]
+		return !ok
+	})
+	store.mu.Lock()
+	if store.writes != 0 || !store.divergences["node1"].Since.Equal(since) {
+		t.Errorf("expected node1's unchanged divergence to be kept, got %d writes and %+v", store.writes, store.divergences["node1"])
+	}
+	store.mu.Unlock()
+
+	// node1 gets the pod, but it isn't the manifest of its intent
+	store.reality <- []consul.ManifestResult{resultOf("node1", "web", 9000), resultOf("node2", "web", 8080)}
+	store.waitFor(t, "node1 to be mismatched", func(d map[types.NodeName]consul.Divergence) bool {
+		return len(d["node1"].Mismatched) == 1
+	})
+	store.mu.Lock()
+	if !store.divergences["node1"].Since.Equal(since) || len(store.divergences["node1"].Missing) != 0 {
+		t.Errorf("expected node1 to have diverged since it first did, got %+v", store.divergences["node1"])
+	}
+	store.mu.Unlock()
+
+	store.reality <- []consul.ManifestResult{web, resultOf("node2", "web", 8080)}
+	store.waitFor(t, "the fleet to converge", func(d map[types.NodeName]consul.Divergence) bool {
+		return len(d) == 0
+	})
+
+	close(quit)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reporter did not quit")
+	}
+}
@@ -0,0 +1,154 @@
+// Package disruption enforces disruption budgets. Every controller that
+// removes replicas on purpose asks the Enforcer which of them it may remove,
+// so that budgets are honored the same way everywhere.
+package disruption
+
+import (
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/disruption/fields"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/types"
+)
+
+type BudgetLister interface {
+	List() ([]fields.Budget, error)
+}
+
+type Labeler interface {
+	GetMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error)
+}
+
+type HealthChecker interface {
+	Service(serviceID string) (map[types.NodeName]health.Result, error)
+}
+
+type Enforcer interface {
+	// Removable returns up to max of the candidate pods that may be
+	// removed together without leaving any budget with fewer healthy pods
+	// than it requires. Candidates are considered in order, so callers
+	// should list the pods they would rather remove first.
+	Removable(candidates types.PodLocations, max int) (types.PodLocations, error)
+}
+
+type enforcer struct {
+	budgets BudgetLister
+	labeler Labeler
+	hcheck  HealthChecker
+}
+
+func NewEnforcer(budgets BudgetLister, labeler Labeler, hcheck HealthChecker) Enforcer {
+	return enforcer{
+		budgets: budgets,
+		labeler: labeler,
+		hcheck:  hcheck,
+	}
+}
+
+// budgetState tracks how many more of a budget's pods may be removed
+type budgetState struct {
+	selected map[string]struct{}
+	// headroom is how many more healthy pods may be removed
+	headroom int
+}
+
+func (e enforcer) Removable(candidates types.PodLocations, max int) (types.PodLocations, error) {
+	if max > len(candidates) {
+		max = len(candidates)
+	}
+	if max <= 0 {
+		return nil, nil
+	}
+
+	budgets, err := e.budgets.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(budgets) == 0 {
+		return candidates[:max], nil
+	}
+
+	results := make(map[types.PodID]map[types.NodeName]health.Result)
+	healthy := func(pod types.PodLocation) (bool, error) {
+		podResults, ok := results[pod.PodID]
+		if !ok {
+			podResults, err = e.hcheck.Service(pod.PodID.String())
+			if err != nil {
+				return false, err
+			}
+			results[pod.PodID] = podResults
+		}
+		result, ok := podResults[pod.Node]
+		return ok && result.Status == health.Passing, nil
+	}
+
+	states := make([]*budgetState, 0, len(budgets))
+	for _, budget := range budgets {
+		selector, err := budget.Selector()
+		if err != nil {
+			return nil, err
+		}
+		matches, err := e.labeler.GetMatches(selector, labels.POD)
+		if err != nil {
+			return nil, err
+		}
+		state := &budgetState{selected: make(map[string]struct{}, len(matches))}
+		healthyCount := 0
+		for _, match := range matches {
+			node, podID, err := labels.NodeAndPodIDFromPodLabel(match)
+			if err != nil {
+				return nil, err
+			}
+			state.selected[match.ID] = struct{}{}
+			isHealthy, err := healthy(types.PodLocation{Node: node, PodID: podID})
+			if err != nil {
+				return nil, err
+			}
+			if isHealthy {
+				healthyCount++
+			}
+		}
+		state.headroom = healthyCount - budget.MinHealthy(len(matches))
+		states = append(states, state)
+	}
+
+	removable := make(types.PodLocations, 0, max)
+	for _, candidate := range candidates {
+		if len(removable) == max {
+			break
+		}
+		isHealthy, err := healthy(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if !isHealthy {
+			// removing a pod that isn't healthy doesn't make any
+			// budget worse off
+			removable = append(removable, candidate)
+			continue
+		}
+
+		key := labels.MakePodLabelKey(candidate.Node, candidate.PodID)
+		var covering []*budgetState
+		allowed := true
+		for _, state := range states {
+			if _, ok := state.selected[key]; !ok {
+				continue
+			}
+			if state.headroom <= 0 {
+				allowed = false
+				break
+			}
+			covering = append(covering, state)
+		}
+		if !allowed {
+			continue
+		}
+		for _, state := range covering {
+			state.headroom--
+		}
+		removable = append(removable, candidate)
+	}
+	return removable, nil
+}
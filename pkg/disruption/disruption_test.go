@@ -0,0 +1,103 @@
+package disruption
+
+import (
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/disruption/fields"
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeBudgets []fields.Budget
+
+func (b fakeBudgets) List() ([]fields.Budget, error) {
+	return b, nil
+}
+
+type fakeHealth map[types.NodeName]health.Result
+
+func (h fakeHealth) Service(serviceID string) (map[types.NodeName]health.Result, error) {
+	return h, nil
+}
+
+// setupEnforcer labels some_pod on node1 through node4 as part of a cluster.
+// node4 is unhealthy.
+func setupEnforcer(t *testing.T, budgets ...fields.Budget) Enforcer {
+	applicator := labels.NewFakeApplicator()
+	for _, node := range []string{"node1", "node2", "node3", "node4"} {
+		err := applicator.SetLabel(labels.POD, node+"/some_pod", "cluster", "some_cluster")
+		Assert(t).IsNil(err, "test setup: could not label pod")
+	}
+	return NewEnforcer(fakeBudgets(budgets), applicator, fakeHealth{
+		"node1": {Status: health.Passing},
+		"node2": {Status: health.Passing},
+		"node3": {Status: health.Passing},
+		"node4": {Status: health.Critical},
+	})
+}
+
+func candidates(nodes ...types.NodeName) types.PodLocations {
+	pods := make(types.PodLocations, len(nodes))
+	for i, node := range nodes {
+		pods[i] = types.PodLocation{Node: node, PodID: "some_pod"}
+	}
+	return pods
+}
+
+func TestRemovableWithoutBudgets(t *testing.T) {
+	enforcer := setupEnforcer(t)
+	removable, err := enforcer.Removable(candidates("node1", "node2", "node3"), 2)
+	Assert(t).IsNil(err, "should have checked budgets")
+	Assert(t).AreEqual(len(removable), 2, "should have allowed removing as many pods as asked")
+}
+
+func TestRemovableWithinMinAvailable(t *testing.T) {
+	enforcer := setupEnforcer(t, fields.Budget{PodSelector: "cluster=some_cluster", MinAvailable: 2})
+
+	removable, err := enforcer.Removable(candidates("node1", "node2", "node3"), 3)
+	Assert(t).IsNil(err, "should have checked budgets")
+	Assert(t).AreEqual(len(removable), 1, "should have kept two healthy pods")
+	Assert(t).AreEqual(removable[0].Node, types.NodeName("node1"), "should have preferred the first candidate")
+
+	removable, err = enforcer.Removable(candidates("node1", "node4", "node2"), 3)
+	Assert(t).IsNil(err, "should have checked budgets")
+	Assert(t).AreEqual(len(removable), 2, "should have allowed removing the unhealthy pod as well")
+	Assert(t).AreEqual(removable[1].Node, types.NodeName("node4"), "should have allowed removing the unhealthy pod")
+}
+
+func TestRemovableWithinMaxUnavailable(t *testing.T) {
+	maxUnavailable := 1
+	enforcer := setupEnforcer(t, fields.Budget{PodSelector: "cluster=some_cluster", MaxUnavailable: &maxUnavailable})
+
+	removable, err := enforcer.Removable(candidates("node1", "node2"), 2)
+	Assert(t).IsNil(err, "should have checked budgets")
+	Assert(t).AreEqual(len(removable), 0, "should not have removed a healthy pod while one is already unavailable")
+}
+
+func TestRemovableIgnoresOtherBudgets(t *testing.T) {
+	enforcer := setupEnforcer(t, fields.Budget{PodSelector: "cluster=other_cluster", MinAvailable: 10})
+
+	removable, err := enforcer.Removable(candidates("node1", "node2"), 2)
+	Assert(t).IsNil(err, "should have checked budgets")
+	Assert(t).AreEqual(len(removable), 2, "should not have applied a budget that doesn't select the pods")
+}
+
+func TestBudgetValidate(t *testing.T) {
+	valid := fields.Budget{PodSelector: "cluster=some_cluster", MinAvailable: 1}
+	Assert(t).IsNil(valid.Validate(), "should have been valid")
+
+	invalid := valid
+	invalid.PodSelector = ""
+	Assert(t).IsNotNil(invalid.Validate(), "should require a pod selector")
+
+	invalid = valid
+	invalid.MinAvailable = 0
+	Assert(t).IsNotNil(invalid.Validate(), "should require min available or max unavailable")
+
+	noDisruptions := 0
+	invalid.MaxUnavailable = &noDisruptions
+	Assert(t).IsNil(invalid.Validate(), "should allow a budget without disruptions")
+}
@@ -0,0 +1,68 @@
+package fields
+
+import (
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// A Budget limits how many of the pods selected by PodSelector may be
+// removed on purpose while they are running. Rolling updates, RC scale-downs
+// and anything else that removes replicas check every budget that selects a
+// pod before removing it, and leave it in place if that would leave a budget
+// with fewer healthy pods than it requires. Pods that aren't healthy can always
+// be removed.
+//
+// Each budget is identified by its pod selector, which is usually that of a
+// pod cluster.
+type Budget struct {
+	PodSelector string `json:"pod_selector"`
+
+	// MinAvailable is the least number of selected pods that must be
+	// healthy
+	MinAvailable int `json:"min_available,omitempty"`
+
+	// MaxUnavailable, if set, is the most selected pods that may be
+	// unhealthy or removed at once
+	MaxUnavailable *int `json:"max_unavailable,omitempty"`
+}
+
+// Selector returns the parsed pod selector
+func (b Budget) Selector() (klabels.Selector, error) {
+	selector, err := klabels.Parse(b.PodSelector)
+	if err != nil {
+		return nil, util.Errorf("Invalid disruption budget pod selector %q: %s", b.PodSelector, err)
+	}
+	return selector, nil
+}
+
+// MinHealthy returns the least number of selected pods that must stay healthy,
+// when selected is the number of pods the budget selects
+func (b Budget) MinHealthy(selected int) int {
+	minHealthy := b.MinAvailable
+	if b.MaxUnavailable != nil && selected-*b.MaxUnavailable > minHealthy {
+		minHealthy = selected - *b.MaxUnavailable
+	}
+	return minHealthy
+}
+
+// Validate returns an error if the budget can't be enforced
+func (b Budget) Validate() error {
+	selector, err := b.Selector()
+	if err != nil {
+		return err
+	}
+	if selector.Empty() {
+		return util.Errorf("Disruption budget must select pods with a non-empty pod selector")
+	}
+	if b.MinAvailable < 0 {
+		return util.Errorf("Disruption budget min available must not be negative, was %d", b.MinAvailable)
+	}
+	if b.MaxUnavailable != nil && *b.MaxUnavailable < 0 {
+		return util.Errorf("Disruption budget max unavailable must not be negative, was %d", *b.MaxUnavailable)
+	}
+	if b.MinAvailable == 0 && b.MaxUnavailable == nil {
+		return util.Errorf("Disruption budget must set min available or max unavailable")
+	}
+	return nil
+}
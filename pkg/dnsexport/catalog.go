@@ -0,0 +1,164 @@
+package dnsexport
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// ExportTag tags the catalog services registered by a Catalog
+const ExportTag = "p2-export"
+
+type CatalogAPI interface {
+	Register(reg *api.CatalogRegistration, q *api.WriteOptions) (*api.WriteMeta, error)
+	Deregister(dereg *api.CatalogDeregistration, q *api.WriteOptions) (*api.WriteMeta, error)
+	Services(q *api.QueryOptions) (map[string][]string, *api.QueryMeta, error)
+	Service(service, tag string, q *api.QueryOptions) ([]*api.CatalogService, *api.QueryMeta, error)
+}
+
+// Catalog registers each instance as a service of consul's catalog, named
+// after the pod's label (see Label) and tagged ExportTag, with a check of the
+// instance's health, so that consul's DNS interface serves the healthy
+// instances as <label>.service.consul. Consul agents remove the services of
+// their own node that they weren't told of, so instances are registered on
+// external nodes of their own, named NodePrefix followed by the node's name,
+// whose address is the node's host name.
+//
+// Instances are only registered again when their port or health changes, and
+// are deregistered when they are no longer running.
+type Catalog struct {
+	catalog    CatalogAPI
+	nodePrefix string
+	nodeDomain string
+
+	mu         sync.Mutex
+	registered map[instanceKey]Instance
+}
+
+var _ Sink = &Catalog{}
+
+type instanceKey struct {
+	podID types.PodID
+	node  types.NodeName
+}
+
+// NewCatalog returns the Catalog that registers instances on nodes named
+// nodePrefix followed by their node's name, at the host name of the node with
+// nodeDomain appended if it is set. The instances registered by a previous
+// Catalog are read so that those that stopped running are deregistered.
+func NewCatalog(catalog CatalogAPI, nodePrefix string, nodeDomain string) (*Catalog, error) {
+	if nodePrefix == "" {
+		return nil, util.Errorf("the catalog's node prefix must be set, so that consul agents don't remove the instances")
+	}
+	c := &Catalog{
+		catalog:    catalog,
+		nodePrefix: nodePrefix,
+		nodeDomain: nodeDomain,
+		registered: make(map[instanceKey]Instance),
+	}
+
+	services, _, err := catalog.Services(nil)
+	if err != nil {
+		return nil, util.Errorf("could not list catalog services: %s", err)
+	}
+	for name, tags := range services {
+		if !hasTag(tags, ExportTag) {
+			continue
+		}
+		registrations, _, err := catalog.Service(name, ExportTag, nil)
+		if err != nil {
+			return nil, util.Errorf("could not list the instances of %s: %s", name, err)
+		}
+		for _, registration := range registrations {
+			if !strings.HasPrefix(registration.Node, nodePrefix) {
+				continue
+			}
+			key := instanceKey{
+				podID: types.PodID(registration.ServiceID),
+				node:  types.NodeName(strings.TrimPrefix(registration.Node, nodePrefix)),
+			}
+			// the health isn't known, so the instance is registered
+			// again if it is still running
+			c.registered[key] = Instance{PodID: key.podID, Node: key.node, Port: registration.ServicePort}
+		}
+	}
+	return c, nil
+}
+
+func (c *Catalog) Export(instances []Instance) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	running := make(map[instanceKey]bool)
+	for _, instance := range instances {
+		key := instanceKey{podID: instance.PodID, node: instance.Node}
+		running[key] = true
+		if c.registered[key] == instance || Label(instance.PodID) == "" {
+			continue
+		}
+		err := c.register(instance)
+		if err != nil {
+			return err
+		}
+		c.registered[key] = instance
+	}
+
+	for key := range c.registered {
+		if running[key] {
+			continue
+		}
+		_, err := c.catalog.Deregister(&api.CatalogDeregistration{
+			Node:      c.nodePrefix + key.node.String(),
+			ServiceID: key.podID.String(),
+		}, nil)
+		if err != nil {
+			return util.Errorf("could not deregister %s on %s: %s", key.podID, key.node, err)
+		}
+		delete(c.registered, key)
+	}
+	return nil
+}
+
+func (c *Catalog) register(instance Instance) error {
+	node := c.nodePrefix + instance.Node.String()
+	status := instance.Health
+	if status != health.Passing && status != health.Warning {
+		// consul only knows passing, warning and critical
+		status = health.Critical
+	}
+	_, err := c.catalog.Register(&api.CatalogRegistration{
+		Node:    node,
+		Address: target(instance.Node, c.nodeDomain),
+		Service: &api.AgentService{
+			ID:      instance.PodID.String(),
+			Service: Label(instance.PodID),
+			Tags:    []string{ExportTag},
+			Port:    instance.Port,
+		},
+		Check: &api.AgentCheck{
+			Node:      node,
+			CheckID:   "p2-health:" + instance.PodID.String(),
+			Name:      "p2 health of " + instance.PodID.String(),
+			Status:    string(status),
+			ServiceID: instance.PodID.String(),
+		},
+	}, nil)
+	if err != nil {
+		return util.Errorf("could not register %s on %s: %s", instance.PodID, instance.Node, err)
+	}
+	return nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
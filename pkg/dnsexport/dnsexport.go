@@ -0,0 +1,159 @@
+// Package dnsexport exports the health of the pods that p2 runs to standard
+// service discovery, so that clients can find healthy instances without
+// reading p2's trees. Each pod ID is a service whose instances are the nodes
+// that run the pod, at the pod's status port, and it can be exported as SRV
+// records of a DNS zone (see ZoneFile) or as services of consul's catalog,
+// which consul's DNS interface serves (see Catalog).
+package dnsexport
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// An Instance is a pod running on a node
+type Instance struct {
+	PodID  types.PodID
+	Node   types.NodeName
+	Port   int
+	Health health.HealthState
+}
+
+// A Sink publishes the instances of p2's pods to service discovery
+type Sink interface {
+	Export(instances []Instance) error
+}
+
+type RealityStore interface {
+	AllPods(podPrefix consul.PodPrefix) ([]consul.ManifestResult, time.Duration, error)
+	AllRealityMetadata() ([]consul.RealityMetadataResult, error)
+}
+
+type HealthChecker interface {
+	Service(serviceID string) (map[types.NodeName]health.Result, error)
+}
+
+// Instances returns the instances of the pods of the reality tree, with their
+// health. Pods that don't have a status port are left out, since their
+// instances can't be addressed. If the status port is that of an auto port
+// launchable, the port it was allocated on each node is used.
+func Instances(store RealityStore, checker HealthChecker) ([]Instance, error) {
+	reality, _, err := store.AllPods(consul.REALITY_TREE)
+	if err != nil {
+		return nil, util.Errorf("could not list reality: %s", err)
+	}
+	metadata, err := store.AllRealityMetadata()
+	if err != nil {
+		return nil, util.Errorf("could not list reality metadata: %s", err)
+	}
+	metadataByPod := make(map[types.NodeName]map[types.PodID]consul.RealityMetadata)
+	for _, result := range metadata {
+		if metadataByPod[result.Node] == nil {
+			metadataByPod[result.Node] = make(map[types.PodID]consul.RealityMetadata)
+		}
+		metadataByPod[result.Node][result.PodID] = result.Metadata
+	}
+
+	healthByPod := make(map[types.PodID]map[types.NodeName]health.Result)
+	var instances []Instance
+	for _, result := range reality {
+		podID := result.Manifest.ID()
+		port := result.Manifest.GetStatusPort()
+		if launchable := result.Manifest.GetStatusPortLaunchable(); launchable != "" {
+			port = metadataByPod[result.PodLocation.Node][podID].Ports[launchable]
+		}
+		if port == 0 {
+			continue
+		}
+
+		results, ok := healthByPod[podID]
+		if !ok {
+			results, err = checker.Service(podID.String())
+			if err != nil {
+				return nil, util.Errorf("could not read the health of %s: %s", podID, err)
+			}
+			healthByPod[podID] = results
+		}
+		state := health.Unknown
+		if result, ok := results[result.PodLocation.Node]; ok {
+			state = result.Status
+		}
+		instances = append(instances, Instance{
+			PodID:  podID,
+			Node:   result.PodLocation.Node,
+			Port:   port,
+			Health: state,
+		})
+	}
+	sort.Sort(byPodAndNode(instances))
+	return instances, nil
+}
+
+type byPodAndNode []Instance
+
+func (b byPodAndNode) Len() int      { return len(b) }
+func (b byPodAndNode) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byPodAndNode) Less(i, j int) bool {
+	if b[i].PodID != b[j].PodID {
+		return b[i].PodID < b[j].PodID
+	}
+	return b[i].Node < b[j].Node
+}
+
+// Run exports the instances to sink every interval until quit is closed.
+// Failures are logged and retried at the next interval.
+func Run(store RealityStore, checker HealthChecker, sink Sink, interval time.Duration, quit <-chan struct{}, logger logging.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		instances, err := Instances(store, checker)
+		if err == nil {
+			err = sink.Export(instances)
+		}
+		if err != nil {
+			logger.WithError(err).Errorln("Could not export pod health")
+		} else {
+			logger.WithField("instances", len(instances)).Debugln("Exported pod health")
+		}
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Label returns podID as a DNS label: lowercased, with characters that a
+// label can't have replaced by "-"
+func Label(podID types.PodID) string {
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, podID.String())
+	label = strings.Trim(label, "-")
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	return label
+}
+
+// target returns the host name of node, with nodeDomain appended if it is set
+func target(node types.NodeName, nodeDomain string) string {
+	if nodeDomain == "" {
+		return node.String()
+	}
+	return node.String() + "." + strings.Trim(nodeDomain, ".")
+}
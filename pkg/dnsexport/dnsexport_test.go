@@ -0,0 +1,180 @@
+package dnsexport
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeReality struct {
+	pods     []consul.ManifestResult
+	metadata []consul.RealityMetadataResult
+}
+
+func (f fakeReality) AllPods(consul.PodPrefix) ([]consul.ManifestResult, time.Duration, error) {
+	return f.pods, 0, nil
+}
+
+func (f fakeReality) AllRealityMetadata() ([]consul.RealityMetadataResult, error) {
+	return f.metadata, nil
+}
+
+type fakeHealth map[types.PodID]map[types.NodeName]health.Result
+
+func (f fakeHealth) Service(serviceID string) (map[types.NodeName]health.Result, error) {
+	return f[types.PodID(serviceID)], nil
+}
+
+func realityOf(node types.NodeName, podID types.PodID, configure func(manifest.Builder)) consul.ManifestResult {
+	builder := manifest.NewBuilder()
+	builder.SetID(podID)
+	configure(builder)
+	return consul.ManifestResult{
+		Manifest:    builder.GetManifest(),
+		PodLocation: types.PodLocation{Node: node, PodID: podID},
+	}
+}
+
+func testInstances(t *testing.T) []Instance {
+	withPort := func(port int) func(manifest.Builder) {
+		return func(b manifest.Builder) { b.SetStatusPort(port) }
+	}
+	store := fakeReality{
+		pods: []consul.ManifestResult{
+			realityOf("node2", "Web_Server", withPort(8080)),
+			realityOf("node1", "Web_Server", withPort(8080)),
+			realityOf("node1", "batch", func(manifest.Builder) {}),
+			realityOf("node1", "api", func(b manifest.Builder) { b.SetStatusPortLaunchable("app") }),
+		},
+		metadata: []consul.RealityMetadataResult{
+			{Node: "node1", PodID: "api", Metadata: consul.RealityMetadata{Ports: map[launch.LaunchableID]int{"app": 31001}}},
+		},
+	}
+	checker := fakeHealth{
+		"Web_Server": {
+			"node1": {Status: health.Passing},
+			"node2": {Status: health.Critical},
+		},
+		"api": {"node1": {Status: health.Warning}},
+	}
+	instances, err := Instances(store, checker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return instances
+}
+
+func TestInstances(t *testing.T) {
+	expected := []Instance{
+		{PodID: "Web_Server", Node: "node1", Port: 8080, Health: health.Passing},
+		{PodID: "Web_Server", Node: "node2", Port: 8080, Health: health.Critical},
+		{PodID: "api", Node: "node1", Port: 31001, Health: health.Warning},
+	}
+	instances := testInstances(t)
+	if len(instances) != len(expected) {
+		t.Fatalf("expected instances %v, got %v", expected, instances)
+	}
+	for i := range expected {
+		if instances[i] != expected[i] {
+			t.Errorf("expected instance %d to be %v, got %v", i, expected[i], instances[i])
+		}
+	}
+}
+
+func TestZoneFileRender(t *testing.T) {
+	zone := ZoneFile{Domain: "p2.example.com.", NodeDomain: "example.com"}
+	rendered := string(zone.Render(testInstances(t)))
+	records := strings.Split(strings.TrimSpace(rendered), "\n")[1:]
+	expected := []string{"_web-server._tcp.p2.example.com. 30 IN SRV 10 10 8080 node1.example.com."}
+	if len(records) != len(expected) || records[0] != expected[0] {
+		t.Errorf("expected only the passing instance's record %v, got %v", expected, records)
+	}
+
+	zone.MinHealth = health.Warning
+	records = strings.Split(strings.TrimSpace(string(zone.Render(testInstances(t)))), "\n")[1:]
+	if len(records) != 2 || !strings.HasPrefix(records[1], "_api._tcp.") {
+		t.Errorf("expected the warning instance to have a record too, got %v", records)
+	}
+}
+
+type fakeCatalog struct {
+	services map[string]*api.CatalogService
+	// registrations counts the calls to Register
+	registrations int
+}
+
+func (f *fakeCatalog) Register(reg *api.CatalogRegistration, _ *api.WriteOptions) (*api.WriteMeta, error) {
+	f.registrations++
+	f.services[reg.Node+"/"+reg.Service.ID] = &api.CatalogService{
+		Node:        reg.Node,
+		ServiceID:   reg.Service.ID,
+		ServiceName: reg.Service.Service,
+		ServiceTags: reg.Service.Tags,
+		ServicePort: reg.Service.Port,
+	}
+	return nil, nil
+}
+
+func (f *fakeCatalog) Deregister(dereg *api.CatalogDeregistration, _ *api.WriteOptions) (*api.WriteMeta, error) {
+	delete(f.services, dereg.Node+"/"+dereg.ServiceID)
+	return nil, nil
+}
+
+func (f *fakeCatalog) Services(*api.QueryOptions) (map[string][]string, *api.QueryMeta, error) {
+	services := make(map[string][]string)
+	for _, service := range f.services {
+		services[service.ServiceName] = service.ServiceTags
+	}
+	return services, nil, nil
+}
+
+func (f *fakeCatalog) Service(name, tag string, _ *api.QueryOptions) ([]*api.CatalogService, *api.QueryMeta, error) {
+	var services []*api.CatalogService
+	for _, service := range f.services {
+		if service.ServiceName == name && hasTag(service.ServiceTags, tag) {
+			services = append(services, service)
+		}
+	}
+	return services, nil, nil
+}
+
+func TestCatalogExport(t *testing.T) {
+	fake := &fakeCatalog{services: make(map[string]*api.CatalogService)}
+	catalog, err := NewCatalog(fake, "p2-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := testInstances(t)
+	if err = catalog.Export(instances); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.services) != 3 || fake.services["p2-node1/Web_Server"].ServiceName != "web-server" {
+		t.Fatalf("expected the instances to be registered, got %v", fake.services)
+	}
+	if err = catalog.Export(instances); err != nil {
+		t.Fatal(err)
+	}
+	if fake.registrations != 3 {
+		t.Errorf("expected unchanged instances not to be registered again, got %d registrations", fake.registrations)
+	}
+
+	// a restarted exporter deregisters the instances that stopped
+	restarted, err := NewCatalog(fake, "p2-", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = restarted.Export(instances[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.services) != 1 || fake.services["p2-node1/Web_Server"] == nil {
+		t.Errorf("expected only the running instance to stay registered, got %v", fake.services)
+	}
+}
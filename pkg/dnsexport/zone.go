@@ -0,0 +1,88 @@
+package dnsexport
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+)
+
+// DefaultTTL is the TTL of the records of a ZoneFile that doesn't set one
+const DefaultTTL = 30 * time.Second
+
+// ZoneFile writes SRV records of the healthy instances to a file in the zone
+// file format, which can be included in a zone ($INCLUDE) or served by a DNS
+// server's file backend. Each pod's instances are the records of
+// _<pod label>._tcp.<Domain>, see Label:
+//
+//	_web._tcp.p2.example.com. 30 IN SRV 10 10 31001 node1.example.com.
+//
+// The file is written through a temporary file, so that it is never partly
+// written.
+type ZoneFile struct {
+	Path string
+	// Domain is the domain the records are under, e.g. "p2.example.com"
+	Domain string
+	// NodeDomain, if set, is appended to node names to make the records'
+	// targets, for node names that aren't fully qualified
+	NodeDomain string
+	// TTL is DefaultTTL if unset
+	TTL time.Duration
+	// MinHealth is the least health of the instances that have records,
+	// health.Passing if unset
+	MinHealth health.HealthState
+}
+
+var _ Sink = ZoneFile{}
+
+// Render returns the records of the instances
+func (z ZoneFile) Render(instances []Instance) []byte {
+	ttl := z.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	minHealth := z.MinHealth
+	if minHealth == "" {
+		minHealth = health.Passing
+	}
+	domain := strings.Trim(z.Domain, ".")
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "; SRV records of the healthy pods of p2, generated by p2-dns-export at %s\n", time.Now().UTC().Format(time.RFC3339))
+	for _, instance := range instances {
+		label := Label(instance.PodID)
+		if label == "" || health.Compare(instance.Health, minHealth) < 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "_%s._tcp.%s. %d IN SRV 10 10 %d %s.\n", label, domain, int(ttl.Seconds()), instance.Port, target(instance.Node, z.NodeDomain))
+	}
+	return buf.Bytes()
+}
+
+func (z ZoneFile) Export(instances []Instance) error {
+	temp, err := ioutil.TempFile(filepath.Dir(z.Path), filepath.Base(z.Path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(z.Render(instances))
+	if err != nil {
+		temp.Close()
+		return err
+	}
+	err = temp.Chmod(0644)
+	if err != nil {
+		temp.Close()
+		return err
+	}
+	err = temp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), z.Path)
+}
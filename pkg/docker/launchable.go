@@ -0,0 +1,350 @@
+// Package docker implements support for launching services packaged as docker images.
+// Containers can be used by specifying "launchable_type: docker" and an "image" pinned
+// by digest in a launchable's configuration in a pod manifest, e.g.
+//
+//	launchables:
+//	  app:
+//	    launchable_type: docker
+//	    image: registry.example.com/team/app@sha256:<hex digest>
+//
+// The container is run in the foreground under runit like any other launchable, as the
+// pod's user and with the launchable's cgroup limits.
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/p2exec"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/user"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+	"github.com/square/p2/pkg/util/size"
+)
+
+var (
+	// DockerPath is the full path of the "docker" binary.
+	DockerPath = param.String("docker_path", "/usr/bin/docker")
+
+	// DockerConfigDir, if set, is the docker client configuration directory passed to
+	// every docker command. The credentials in its config.json are used to pull images
+	// from private registries.
+	DockerConfigDir = param.String("docker_config_dir", "")
+)
+
+// The name of the file in a launchable's install directory recording the image that
+// was pulled for it.
+const ImageFilename = "image"
+
+var imageRegex = regexp.MustCompile(`^([a-z0-9][a-z0-9._:/-]*)@sha256:([a-f0-9]{64})$`)
+
+// ParseImage splits an image reference pinned by digest, of the form
+// <repository>@sha256:<hex digest>, into its repository and digest. Images referred to
+// by tag are rejected, since a tag can be moved to a different image.
+func ParseImage(image string) (repository string, digest string, err error) {
+	parts := imageRegex.FindStringSubmatch(image)
+	if parts == nil {
+		return "", "", util.Errorf("Image %q must be of the form <repository>@sha256:<digest>", image)
+	}
+	return parts[1], parts[2], nil
+}
+
+// Launchable represents a docker image and the container run from it.
+type Launchable struct {
+	Image           string              // The image to run, pinned by digest
+	ID_             launch.LaunchableID // A (pod-wise) unique identifier for this launchable, used to distinguish it from other launchables in the pod
+	ServiceID_      string              // A (host-wise) unique identifier for this launchable, used when creating runit services and naming the container
+	RunAs           string              // The user to run the container as
+	RootDir         string              // The root directory of the launchable, containing N:N>=1 installs.
+	P2Exec          string              // The path to p2-exec
+	RestartTimeout  time.Duration       // How long to wait when restarting the services in this launchable.
+	RestartPolicy_  runit.RestartPolicy // Dictates whether the container should be automatically restarted upon exit.
+	CgroupConfig    cgroups.Config      // The CPU and memory limits of the container
+	SuppliedEnvVars map[string]string   // User-supplied env variables, set in the container
+	SecurityOpts    []string            // Values of docker run's --security-opt, e.g. the container's AppArmor profile
+}
+
+var _ launch.Launchable = &Launchable{}
+var _ launch.Installer = &Launchable{}
+
+// ID implements the launch.Launchable interface. It returns the name of this launchable.
+func (l *Launchable) ID() launch.LaunchableID {
+	return l.ID_
+}
+
+func (l *Launchable) ServiceID() string {
+	return l.ServiceID_
+}
+
+func (l *Launchable) EnvVars() map[string]string {
+	return l.SuppliedEnvVars
+}
+
+// Version returns the digest of the launchable's image.
+func (l *Launchable) Version() string {
+	_, digest, err := ParseImage(l.Image)
+	if err != nil {
+		return ""
+	}
+	return digest
+}
+
+func (*Launchable) Type() string {
+	return "docker"
+}
+
+func (l *Launchable) EnvDir() string {
+	return filepath.Join(l.RootDir, "env")
+}
+
+// InstallDir is the directory recording that this launchable's image was pulled.
+func (l *Launchable) InstallDir() string {
+	return filepath.Join(l.RootDir, "installs", l.Version())
+}
+
+// containerName is the name of the launchable's container, so that it can be stopped and
+// removed without tracking its ID
+func (l *Launchable) containerName() string {
+	return l.ServiceID_
+}
+
+// dockerCommand returns the command line of a docker command, using the configured
+// docker client configuration.
+func dockerCommand(args ...string) []string {
+	cmd := []string{*DockerPath}
+	if *DockerConfigDir != "" {
+		cmd = append(cmd, "--config", *DockerConfigDir)
+	}
+	return append(cmd, args...)
+}
+
+func runDocker(args ...string) error {
+	cmdLine := dockerCommand(args...)
+	output, err := exec.Command(cmdLine[0], cmdLine[1:]...).CombinedOutput()
+	if err != nil {
+		return util.Errorf("docker %s failed: %s: %s", args[0], err, output)
+	}
+	return nil
+}
+
+// Executables gets the runit service that runs this launchable's container.
+func (l *Launchable) Executables(serviceBuilder *runit.ServiceBuilder) ([]launch.Executable, error) {
+	if !l.Installed() {
+		return []launch.Executable{}, util.Errorf("%s is not installed", l.ServiceID_)
+	}
+
+	uid, gid, err := user.IDs(l.RunAs)
+	if err != nil {
+		return nil, util.Errorf("%s: unknown runas user: %s", l.ServiceID_, l.RunAs)
+	}
+
+	// The container is removed when it exits so that the next start can reuse its name.
+	// docker run stays in the foreground and forwards the signals runit sends it to the
+	// container.
+	args := []string{
+		"run", "--rm",
+		"--name", l.containerName(),
+		"--user", fmt.Sprintf("%d:%d", uid, gid),
+	}
+	if l.CgroupConfig.CPUs > 0 {
+		args = append(args, "--cpus", strconv.Itoa(l.CgroupConfig.CPUs))
+	}
+	if l.CgroupConfig.Memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt(int64(l.CgroupConfig.Memory), 10))
+	}
+	for _, opt := range l.SecurityOpts {
+		args = append(args, "--security-opt", opt)
+	}
+	var envKeys []string
+	for key := range l.SuppliedEnvVars {
+		envKeys = append(envKeys, key)
+	}
+	sort.Strings(envKeys)
+	for _, key := range envKeys {
+		args = append(args, "--env", fmt.Sprintf("%s=%s", key, l.SuppliedEnvVars[key]))
+	}
+	args = append(args, l.Image)
+
+	serviceName := l.ServiceID_ + "__container"
+	return []launch.Executable{{
+		Service: runit.Service{
+			Path: filepath.Join(serviceBuilder.RunitRoot, serviceName),
+			Name: serviceName,
+		},
+		Exec: append(
+			[]string{l.P2Exec},
+			p2exec.P2ExecArgs{
+				// the docker client needs the privileges to talk to the docker
+				// daemon, and the daemon applies the container's limits
+				NoLimits: true,
+				WorkDir:  l.InstallDir(),
+				Command:  dockerCommand(args...),
+			}.CommandLine()...,
+		),
+	}}, nil
+}
+
+// Installed returns true if this launchable's image has been pulled.
+func (l *Launchable) Installed() bool {
+	_, err := os.Stat(l.InstallDir())
+	return err == nil
+}
+
+// Install pulls the launchable's image, which is verified against its digest by docker,
+// and records it in the install directory.
+func (l *Launchable) Install() error {
+	if _, _, err := ParseImage(l.Image); err != nil {
+		return err
+	}
+	err := runDocker("pull", l.Image)
+	if err != nil {
+		return err
+	}
+
+	uid, gid, err := user.IDs(l.RunAs)
+	if err != nil {
+		return util.Errorf("%s: unknown runas user: %s", l.ServiceID_, l.RunAs)
+	}
+	err = util.MkdirChownAll(l.InstallDir(), uid, gid, 0755)
+	if err != nil {
+		return util.Errorf("Could not create install directory for %s: %s", l.ServiceID_, err)
+	}
+	return ioutil.WriteFile(filepath.Join(l.InstallDir(), ImageFilename), []byte(l.Image), 0444)
+}
+
+// PostInstall has nothing to do, since the image is ready once it has been pulled.
+func (l *Launchable) PostInstall() error {
+	return nil
+}
+
+// PostActive runs a Hoist-specific "post-activate" script in the launchable.
+func (l *Launchable) PostActivate() (string, error) {
+	// Not supported for docker images
+	return "", nil
+}
+
+// Preflight runs a Hoist-specific "preflight" script in the launchable.
+func (l *Launchable) Preflight(_ time.Duration) (string, error) {
+	// Not supported for docker images
+	return "", nil
+}
+
+func (l *Launchable) flipSymlink(newLinkPath string) error {
+	dir, err := ioutil.TempDir(l.RootDir, l.ServiceID_)
+	if err != nil {
+		return util.Errorf("Couldn't create temporary directory for symlink: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	tempLinkPath := filepath.Join(dir, l.ServiceID_)
+	err = os.Symlink(l.InstallDir(), tempLinkPath)
+	if err != nil {
+		return util.Errorf("Couldn't create symlink for docker launchable %s: %s", l.ServiceID_, err)
+	}
+
+	uid, gid, err := user.IDs(l.RunAs)
+	if err != nil {
+		return util.Errorf("Couldn't retrieve UID/GID for docker launchable %s user %s: %s", l.ServiceID_, l.RunAs, err)
+	}
+	err = os.Lchown(tempLinkPath, uid, gid)
+	if err != nil {
+		return util.Errorf("Couldn't lchown symlink for docker launchable %s: %s", l.ServiceID_, err)
+	}
+
+	return os.Rename(tempLinkPath, newLinkPath)
+}
+
+// MakeCurrent adjusts a "current" symlink for this launchable name to point to this
+// launchable's version.
+func (l *Launchable) MakeCurrent() error {
+	return l.flipSymlink(filepath.Join(l.RootDir, "current"))
+}
+
+func (l *Launchable) makeLast() error {
+	return l.flipSymlink(filepath.Join(l.RootDir, "last"))
+}
+
+// Launch allows the launchable to begin execution.
+func (l *Launchable) Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+	err := l.start(serviceBuilder, sv)
+	if err != nil {
+		return launch.StartError{Inner: err}
+	}
+	return nil
+}
+
+func (l *Launchable) start(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+	executables, err := l.Executables(serviceBuilder)
+	if err != nil {
+		return err
+	}
+
+	// A container left behind by a docker daemon restart would keep the new one from
+	// starting under the same name. It is fine if there is none to remove.
+	_ = runDocker("rm", "--force", l.containerName())
+
+	for _, executable := range executables {
+		var err error
+		if l.RestartPolicy_ == runit.RestartPolicyAlways {
+			_, err = sv.Restart(&executable.Service, l.RestartTimeout)
+		} else {
+			_, err = sv.Once(&executable.Service)
+		}
+		if err != nil && err != runit.SuperviseOkMissing {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *Launchable) stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+	executables, err := l.Executables(serviceBuilder)
+	if err != nil {
+		return err
+	}
+
+	for _, executable := range executables {
+		_, err := sv.Stop(&executable.Service, l.RestartTimeout)
+		if err != nil {
+			err = runDocker("kill", l.containerName())
+			if err != nil {
+				return util.Errorf("%s: error stopping container: %s", l.ServiceID_, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Launchable) Disable() error {
+	// "disable" script not supported for containers
+	return nil
+}
+
+// Stop causes the launchable to halt execution if it is running.
+func (l *Launchable) Stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+	err := l.stop(serviceBuilder, sv)
+	if err != nil {
+		return launch.StopError{Inner: err}
+	}
+
+	return l.makeLast()
+}
+
+func (l *Launchable) Prune(max size.ByteCount) error {
+	// Images are left to the docker daemon's own garbage collection
+	return nil
+}
+
+func (l *Launchable) RestartPolicy() runit.RestartPolicy {
+	return l.RestartPolicy_
+}
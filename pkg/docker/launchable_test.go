@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util/size"
+)
+
+const testDigest = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestParseImage(t *testing.T) {
+	repository, digest, err := ParseImage("registry.example.com:5000/team/app@sha256:" + testDigest)
+	Assert(t).IsNil(err, "should have parsed an image pinned by digest")
+	Assert(t).AreEqual(repository, "registry.example.com:5000/team/app", "unexpected repository")
+	Assert(t).AreEqual(digest, testDigest, "unexpected digest")
+
+	_, _, err = ParseImage("registry.example.com/team/app:latest")
+	Assert(t).IsNotNil(err, "should have rejected an image referred to by tag")
+}
+
+// testLaunchable returns a launchable whose docker commands are run by a
+// script that records their arguments in the returned file
+func testLaunchable(t *testing.T) (*Launchable, string, func()) {
+	root, err := ioutil.TempDir("", "docker_launchable")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	argsFile := filepath.Join(root, "docker_args")
+	script := filepath.Join(root, "docker")
+	err = ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> "+argsFile+"\n"), 0755)
+	Assert(t).IsNil(err, "could not write fake docker")
+
+	curUser, err := user.Current()
+	Assert(t).IsNil(err, "could not get the current user")
+
+	oldDockerPath, oldConfigDir := *DockerPath, *DockerConfigDir
+	*DockerPath, *DockerConfigDir = script, "/etc/p2/docker"
+	cleanup := func() {
+		*DockerPath, *DockerConfigDir = oldDockerPath, oldConfigDir
+		os.RemoveAll(root)
+	}
+
+	return &Launchable{
+		Image:          "registry.example.com/team/app@sha256:" + testDigest,
+		ID_:            "app",
+		ServiceID_:     "pod__app",
+		RunAs:          curUser.Username,
+		RootDir:        filepath.Join(root, "app"),
+		P2Exec:         "/usr/local/bin/p2-exec",
+		RestartPolicy_: runit.RestartPolicyAlways,
+		CgroupConfig: cgroups.Config{
+			CPUs:   2,
+			Memory: 512 * size.Mebibyte,
+		},
+		SuppliedEnvVars: map[string]string{"FOO": "bar"},
+	}, argsFile, cleanup
+}
+
+func TestInstallPullsImage(t *testing.T) {
+	launchable, argsFile, cleanup := testLaunchable(t)
+	defer cleanup()
+
+	Assert(t).IsFalse(launchable.Installed(), "should not have been installed yet")
+	err := launchable.Install()
+	Assert(t).IsNil(err, "install should have succeeded")
+	Assert(t).IsTrue(launchable.Installed(), "should have been installed")
+
+	args, err := ioutil.ReadFile(argsFile)
+	Assert(t).IsNil(err, "docker should have been run")
+	Assert(t).AreEqual(strings.TrimSpace(string(args)), "--config /etc/p2/docker pull "+launchable.Image, "should have pulled the image by digest")
+	image, err := ioutil.ReadFile(filepath.Join(launchable.InstallDir(), ImageFilename))
+	Assert(t).IsNil(err, "should have recorded the image")
+	Assert(t).AreEqual(string(image), launchable.Image, "should have recorded the image")
+}
+
+func TestExecutablesRunContainer(t *testing.T) {
+	launchable, _, cleanup := testLaunchable(t)
+	defer cleanup()
+
+	_, err := launchable.Executables(runit.DefaultBuilder)
+	Assert(t).IsNotNil(err, "should not list the executables of an image that wasn't pulled")
+
+	err = launchable.Install()
+	Assert(t).IsNil(err, "install should have succeeded")
+	executables, err := launchable.Executables(runit.DefaultBuilder)
+	Assert(t).IsNil(err, "should have listed executables")
+	Assert(t).AreEqual(len(executables), 1, "should have one executable for the container")
+	Assert(t).AreEqual(executables[0].Service.Name, "pod__app__container", "unexpected service name")
+
+	exec := strings.Join(executables[0].Exec, " ")
+	for _, expected := range []string{
+		"run --rm --name pod__app --user ",
+		"--cpus 2",
+		"--memory 536870912",
+		"--env FOO=bar",
+		"--config /etc/p2/docker",
+	} {
+		Assert(t).IsTrue(strings.Contains(exec, expected), "expected the executable to contain "+expected+": "+exec)
+	}
+	Assert(t).IsTrue(strings.HasSuffix(exec, launchable.Image), "the container should run the pinned image: "+exec)
+}
@@ -0,0 +1,268 @@
+// Package drain takes nodes out of service. A drained node is cordoned, so
+// that RCs stop scheduling on it, its RC-managed replicas are moved to other
+// nodes, and then any pods left in its intent tree are removed.
+package drain
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/rc"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultTimeout is how long moving one replica off a drained node may take
+const DefaultTimeout = 10 * time.Minute
+
+// pollInterval is how often a drain checks whether a replica has been moved
+const pollInterval = 5 * time.Second
+
+type Labeler interface {
+	rc.LabelMatcher
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+	SetLabel(labelType labels.Type, id, name, value string) error
+	RemoveLabel(labelType labels.Type, id, name string) error
+	RemoveAllLabels(labelType labels.Type, id string) error
+}
+
+type ReplicationControllerStore interface {
+	Get(id rc_fields.ID) (rc_fields.RC, error)
+	CASDesiredReplicas(id rc_fields.ID, expected int, n int) error
+}
+
+type RollingUpdateLister interface {
+	List() ([]roll_fields.Update, error)
+}
+
+type HealthChecker interface {
+	Service(serviceID string) (map[types.NodeName]health.Result, error)
+}
+
+type IntentStore interface {
+	ListPods(podPrefix consul.PodPrefix, nodename types.NodeName) ([]consul.ManifestResult, time.Duration, error)
+	DeletePod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error)
+}
+
+// Cordon stops RCs from scheduling pods on a node. Pods already on the node are
+// left alone until it is drained.
+func Cordon(labeler Labeler, node types.NodeName) error {
+	return labeler.SetLabel(labels.NODE, node.String(), rc.CordonLabel, "true")
+}
+
+// Uncordon lets RCs schedule pods on a node again
+func Uncordon(labeler Labeler, node types.NodeName) error {
+	return labeler.RemoveLabel(labels.NODE, node.String(), rc.CordonLabel)
+}
+
+type Drainer struct {
+	rcs     ReplicationControllerStore
+	rolls   RollingUpdateLister
+	labeler Labeler
+	hcheck  HealthChecker
+	intents IntentStore
+	logger  logging.Logger
+
+	// timeout bounds how long moving each replica may take
+	timeout time.Duration
+	// pollInterval is how often progress is checked
+	pollInterval time.Duration
+}
+
+func NewDrainer(
+	rcs ReplicationControllerStore,
+	rolls RollingUpdateLister,
+	labeler Labeler,
+	hcheck HealthChecker,
+	intents IntentStore,
+	logger logging.Logger,
+	timeout time.Duration,
+) Drainer {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return Drainer{
+		rcs:          rcs,
+		rolls:        rolls,
+		labeler:      labeler,
+		hcheck:       hcheck,
+		intents:      intents,
+		logger:       logger,
+		timeout:      timeout,
+		pollInterval: pollInterval,
+	}
+}
+
+// Drain cordons the node and moves each of its RC-managed replicas elsewhere,
+// one at a time. A replica is moved by adding one to its RC's replica count,
+// waiting for the replacement to be healthy, and then taking it away again, so
+// that the RC unschedules from the cordoned node within its disruption budgets.
+// Once no RC manages a pod on the node, every pod left in its intent tree is
+// removed.
+//
+// Drain stops with an error if a replica can't be moved, for example because
+// its RC is disabled or in a rolling update, and leaves the node's remaining
+// pods in place. It can be run again once the problem is fixed.
+func (d Drainer) Drain(node types.NodeName, quit <-chan struct{}) error {
+	logger := d.logger.SubLogger(logrus.Fields{"node": node})
+	err := Cordon(d.labeler, node)
+	if err != nil {
+		return util.Errorf("Could not cordon %s: %s", node, err)
+	}
+	logger.NoFields().Infoln("Cordoned node")
+
+	intents, _, err := d.intents.ListPods(consul.INTENT_TREE, node)
+	if err != nil {
+		return err
+	}
+	for _, intent := range intents {
+		podID := intent.Manifest.ID()
+		podLabels, err := d.labeler.GetLabels(labels.POD, labels.MakePodLabelKey(node, podID))
+		if err != nil {
+			return err
+		}
+		rcID := rc_fields.ID(podLabels.Labels.Get(rc.RCIDLabel))
+		if rcID == "" {
+			continue
+		}
+		err = d.moveReplica(rcID, types.PodLocation{Node: node, PodID: podID}, logger, quit)
+		if err != nil {
+			return util.Errorf("Could not move %s off %s: %s", podID, node, err)
+		}
+	}
+
+	// RCs unschedule by deleting intent, so only pods that no RC manages
+	// are left
+	intents, _, err = d.intents.ListPods(consul.INTENT_TREE, node)
+	if err != nil {
+		return err
+	}
+	for _, intent := range intents {
+		podID := intent.Manifest.ID()
+		_, err = d.intents.DeletePod(consul.INTENT_TREE, node, podID)
+		if err != nil {
+			return util.Errorf("Could not remove %s from %s: %s", podID, node, err)
+		}
+		err = d.labeler.RemoveAllLabels(labels.POD, labels.MakePodLabelKey(node, podID))
+		if err != nil {
+			return util.Errorf("Could not remove labels of %s on %s: %s", podID, node, err)
+		}
+		logger.WithField("pod", podID).Infoln("Removed pod")
+	}
+	logger.NoFields().Infoln("Drained node")
+	return nil
+}
+
+// moveReplica replaces the RC's pod on a cordoned node with one on another node
+func (d Drainer) moveReplica(rcID rc_fields.ID, pod types.PodLocation, logger logging.Logger, quit <-chan struct{}) error {
+	logger = logger.SubLogger(logrus.Fields{"rc": rcID, "pod": pod.PodID})
+
+	rcFields, err := d.rcs.Get(rcID)
+	if err != nil {
+		return err
+	}
+	if rcFields.Disabled {
+		return util.Errorf("replication controller %s is disabled", rcID)
+	}
+	updates, err := d.rolls.List()
+	if err != nil {
+		return err
+	}
+	for _, update := range updates {
+		if update.OldRC == rcID || update.NewRC == rcID {
+			// the update owns the replica count until it completes
+			return util.Errorf("replication controller %s is in rolling update %s", rcID, update.ID())
+		}
+	}
+
+	before, err := rc.CurrentPods(rcID, d.labeler)
+	if err != nil {
+		return err
+	}
+	desired := rcFields.ReplicasDesired
+	err = d.rcs.CASDesiredReplicas(rcID, desired, desired+1)
+	if err != nil {
+		return err
+	}
+	logger.NoFields().Infoln("Scheduling a replacement replica")
+
+	err = d.waitFor(quit, func() (bool, error) {
+		return d.replacementHealthy(rcID, pod.PodID, before)
+	})
+	if err != nil {
+		return util.Errorf("replacement didn't become healthy, leaving %d desired replicas: %s", desired+1, err)
+	}
+
+	// the cordoned node is no longer eligible, so the RC prefers to
+	// unschedule from it
+	err = d.rcs.CASDesiredReplicas(rcID, desired+1, desired)
+	if err != nil {
+		return err
+	}
+	logger.NoFields().Infoln("Replacement is healthy, unscheduling from drained node")
+
+	return d.waitFor(quit, func() (bool, error) {
+		current, err := rc.CurrentPods(rcID, d.labeler)
+		if err != nil {
+			return false, err
+		}
+		for _, location := range current {
+			if location == pod {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+// replacementHealthy returns whether any of the RC's pods on nodes that it
+// didn't have before is healthy
+func (d Drainer) replacementHealthy(rcID rc_fields.ID, podID types.PodID, before types.PodLocations) (bool, error) {
+	current, err := rc.CurrentPods(rcID, d.labeler)
+	if err != nil {
+		return false, err
+	}
+	added := types.NewNodeSet(current.Nodes()...).Difference(types.NewNodeSet(before.Nodes()...)).ListNodes()
+	if len(added) == 0 {
+		return false, nil
+	}
+	results, err := d.hcheck.Service(podID.String())
+	if err != nil {
+		return false, err
+	}
+	for _, node := range added {
+		if result, ok := results[node]; ok && result.Status == health.Passing {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// waitFor polls done until it returns true, quit is closed or the drainer's
+// timeout passes
+func (d Drainer) waitFor(quit <-chan struct{}, done func() (bool, error)) error {
+	timeout := time.After(d.timeout)
+	for {
+		ok, err := done()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-quit:
+			return util.Errorf("drain was canceled")
+		case <-timeout:
+			return util.Errorf("timed out after %s", d.timeout)
+		case <-time.After(d.pollInterval):
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package drain
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/rc"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeRolls []roll_fields.Update
+
+func (r fakeRolls) List() ([]roll_fields.Update, error) {
+	return r, nil
+}
+
+type fakeHealth map[types.NodeName]health.Result
+
+func (h fakeHealth) Service(serviceID string) (map[types.NodeName]health.Result, error) {
+	return h, nil
+}
+
+type fakeIntents map[types.NodeName][]types.PodID
+
+func (i fakeIntents) ListPods(podPrefix consul.PodPrefix, nodename types.NodeName) ([]consul.ManifestResult, time.Duration, error) {
+	var results []consul.ManifestResult
+	for _, podID := range i[nodename] {
+		builder := manifest.NewBuilder()
+		builder.SetID(podID)
+		results = append(results, consul.ManifestResult{
+			Manifest:    builder.GetManifest(),
+			PodLocation: types.PodLocation{Node: nodename, PodID: podID},
+		})
+	}
+	return results, 0, nil
+}
+
+func (i fakeIntents) DeletePod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error) {
+	remaining := []types.PodID{}
+	for _, podID := range i[nodename] {
+		if podID != podId {
+			remaining = append(remaining, podID)
+		}
+	}
+	i[nodename] = remaining
+	return 0, nil
+}
+
+// schedulingRCs acts like the RC farm does when the replica count of an RC
+// changes: it schedules on node2 when the count goes up, and unschedules from
+// node1 when it goes down
+type schedulingRCs struct {
+	ReplicationControllerStore
+	labeler labels.Applicator
+	intents fakeIntents
+}
+
+func (s schedulingRCs) CASDesiredReplicas(id rc_fields.ID, expected int, n int) error {
+	err := s.ReplicationControllerStore.CASDesiredReplicas(id, expected, n)
+	if err != nil {
+		return err
+	}
+	if n > expected {
+		s.intents["node2"] = append(s.intents["node2"], "some_pod")
+		return s.labeler.SetLabel(labels.POD, "node2/some_pod", rc.RCIDLabel, id.String())
+	}
+	_, err = s.intents.DeletePod(consul.INTENT_TREE, "node1", "some_pod")
+	if err != nil {
+		return err
+	}
+	return s.labeler.RemoveAllLabels(labels.POD, "node1/some_pod")
+}
+
+// setupDrainer returns a drainer for node1, which has an RC's pod and another
+// pod that no RC manages
+func setupDrainer(t *testing.T) (Drainer, rc_fields.ID, labels.Applicator, fakeIntents) {
+	builder := manifest.NewBuilder()
+	builder.SetID("some_pod")
+	rcStore := rcstore.NewFake()
+	rcFields, err := rcStore.Create(builder.GetManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil)
+	Assert(t).IsNil(err, "test setup: could not create RC")
+	Assert(t).IsNil(rcStore.SetDesiredReplicas(rcFields.ID, 1), "test setup: could not set replicas")
+
+	applicator := labels.NewFakeApplicator()
+	err = applicator.SetLabel(labels.POD, "node1/some_pod", rc.RCIDLabel, rcFields.ID.String())
+	Assert(t).IsNil(err, "test setup: could not label pod")
+	err = applicator.SetLabel(labels.POD, "node1/other_pod", "some_key", "some_value")
+	Assert(t).IsNil(err, "test setup: could not label pod")
+	intents := fakeIntents{"node1": {"some_pod", "other_pod"}}
+
+	drainer := NewDrainer(
+		schedulingRCs{ReplicationControllerStore: rcStore, labeler: applicator, intents: intents},
+		fakeRolls{},
+		applicator,
+		fakeHealth{"node2": {Status: health.Passing}},
+		intents,
+		logging.TestLogger(),
+		time.Second,
+	)
+	drainer.pollInterval = time.Millisecond
+	return drainer, rcFields.ID, applicator, intents
+}
+
+func TestDrain(t *testing.T) {
+	drainer, id, applicator, intents := setupDrainer(t)
+
+	err := drainer.Drain("node1", nil)
+	Assert(t).IsNil(err, "should have drained the node")
+
+	nodeLabels, err := applicator.GetLabels(labels.NODE, "node1")
+	Assert(t).IsNil(err, "could not get node labels")
+	Assert(t).IsTrue(nodeLabels.Labels.Has(rc.CordonLabel), "should have cordoned the node")
+	Assert(t).AreEqual(len(intents["node1"]), 0, "should have removed every pod from the node")
+
+	current, err := rc.CurrentPods(id, applicator)
+	Assert(t).IsNil(err, "could not get RC's pods")
+	Assert(t).AreEqual(len(current), 1, "should have kept the RC's replica count")
+	Assert(t).AreEqual(current[0].Node, types.NodeName("node2"), "should have moved the replica to another node")
+
+	rcFields, err := drainer.rcs.Get(id)
+	Assert(t).IsNil(err, "could not get RC")
+	Assert(t).AreEqual(rcFields.ReplicasDesired, 1, "should have restored the replica count")
+}
+
+func TestDrainWaitsForRollingUpdates(t *testing.T) {
+	drainer, id, _, intents := setupDrainer(t)
+	drainer.rolls = fakeRolls{{OldRC: id, NewRC: "other"}}
+
+	err := drainer.Drain("node1", nil)
+	Assert(t).IsNotNil(err, "should not have moved a replica of an RC in a rolling update")
+	Assert(t).AreEqual(len(intents["node1"]), 2, "should not have removed any pods")
+}
+
+func TestDrainWaitsForHealthyReplacement(t *testing.T) {
+	drainer, id, _, intents := setupDrainer(t)
+	drainer.hcheck = fakeHealth{"node2": {Status: health.Critical}}
+
+	err := drainer.Drain("node1", nil)
+	Assert(t).IsNotNil(err, "should have timed out waiting for the replacement")
+	Assert(t).AreEqual(len(intents["node1"]), 2, "should not have removed any pods")
+	rcFields, err := drainer.rcs.Get(id)
+	Assert(t).IsNil(err, "could not get RC")
+	Assert(t).AreEqual(rcFields.ReplicasDesired, 2, "should have left the replacement scheduled")
+}
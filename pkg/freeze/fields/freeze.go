@@ -0,0 +1,161 @@
+package fields
+
+import (
+	"strings"
+	"time"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	pc_fields "github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type ID string
+
+func (id ID) String() string {
+	return string(id)
+}
+
+// A Freeze stops deploys during maintenance windows and incidents. While a
+// freeze is active, preparers don't install or update the pods it covers and
+// rolling updates of them are held, unless the change is marked as an
+// emergency.
+//
+// Each freeze covers exactly one of: every pod (Global), the pods of one pod
+// cluster, or the pods of the nodes selected by NodeSelector.
+type Freeze struct {
+	ID ID `json:"id"`
+
+	Global bool `json:"global,omitempty"`
+
+	// PodCluster identifies a pod cluster by the pod ID, availability zone
+	// and cluster name that it labels its pods with
+	PodCluster *PodCluster `json:"pod_cluster,omitempty"`
+
+	// NodeSelector selects the nodes whose pods are frozen. Only preparers
+	// know the labels of their node, so node freezes don't hold rolling
+	// updates, but the preparers of the selected nodes hold the deploys.
+	NodeSelector string `json:"node_selector,omitempty"`
+
+	// Windows are when the freeze is active. A freeze without windows is
+	// active until it is deleted.
+	Windows []Window `json:"windows,omitempty"`
+
+	// Reason is shown to whoever is held by the freeze
+	Reason string `json:"reason,omitempty"`
+}
+
+type PodCluster struct {
+	PodID            types.PodID                `json:"pod_id"`
+	AvailabilityZone pc_fields.AvailabilityZone `json:"availability_zone"`
+	ClusterName      pc_fields.ClusterName      `json:"cluster_name"`
+}
+
+// A Window is the time from Start until End
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Contains returns true if t is within the window
+func (w Window) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// Target is a pod that a deploy would change
+type Target struct {
+	PodID types.PodID
+	// PodLabels are the labels of the pod, which include the availability
+	// zone and cluster name of its pod cluster, if any
+	PodLabels klabels.Labels
+	// NodeLabels are the labels of the pod's node. They are nil when the
+	// node isn't known, such as for the pods of a rolling update, in which
+	// case node freezes don't apply.
+	NodeLabels klabels.Labels
+}
+
+// Active returns true if the freeze is active at now
+func (f Freeze) Active(now time.Time) bool {
+	if len(f.Windows) == 0 {
+		return true
+	}
+	for _, window := range f.Windows {
+		if window.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeSelectorParsed returns the parsed node selector
+func (f Freeze) NodeSelectorParsed() (klabels.Selector, error) {
+	selector, err := klabels.Parse(f.NodeSelector)
+	if err != nil {
+		return nil, util.Errorf("Invalid freeze node selector %q: %s", f.NodeSelector, err)
+	}
+	return selector, nil
+}
+
+// Covers returns true if target is within the freeze's scope, regardless of
+// whether the freeze is active
+func (f Freeze) Covers(target Target) (bool, error) {
+	switch {
+	case f.Global:
+		return true, nil
+	case f.PodCluster != nil:
+		if target.PodLabels == nil {
+			return false, nil
+		}
+		return target.PodID == f.PodCluster.PodID &&
+			target.PodLabels.Get(types.AvailabilityZoneLabel) == f.PodCluster.AvailabilityZone.String() &&
+			target.PodLabels.Get(types.ClusterNameLabel) == f.PodCluster.ClusterName.String(), nil
+	default:
+		if target.NodeLabels == nil {
+			return false, nil
+		}
+		selector, err := f.NodeSelectorParsed()
+		if err != nil {
+			return false, err
+		}
+		return selector.Matches(target.NodeLabels), nil
+	}
+}
+
+// Validate returns an error if the freeze can't be enforced
+func (f Freeze) Validate() error {
+	if f.ID == "" || strings.Contains(f.ID.String(), "/") {
+		return util.Errorf("Freeze must have an ID without slashes, was %q", f.ID)
+	}
+
+	scopes := 0
+	if f.Global {
+		scopes++
+	}
+	if f.PodCluster != nil {
+		scopes++
+		if f.PodCluster.PodID == "" || f.PodCluster.AvailabilityZone == "" || f.PodCluster.ClusterName == "" {
+			return util.Errorf("Freeze of a pod cluster must set its pod ID, availability zone and cluster name")
+		}
+	}
+	if f.NodeSelector != "" {
+		scopes++
+		selector, err := f.NodeSelectorParsed()
+		if err != nil {
+			return err
+		}
+		if selector.Empty() {
+			return util.Errorf("Freeze node selector must select nodes, use a global freeze to freeze every node")
+		}
+	}
+	if scopes != 1 {
+		return util.Errorf("Freeze must be exactly one of global, of a pod cluster, or of a node selector")
+	}
+
+	for _, window := range f.Windows {
+		if !window.End.After(window.Start) {
+			return util.Errorf("Freeze window must end after it starts, %s is not after %s", window.End, window.Start)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package fields
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/types"
+)
+
+func TestActive(t *testing.T) {
+	now := time.Now()
+	Assert(t).IsTrue(Freeze{ID: "f", Global: true}.Active(now), "a freeze without windows should always be active")
+
+	freeze := Freeze{ID: "f", Global: true, Windows: []Window{
+		{Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)},
+		{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)},
+	}}
+	Assert(t).IsFalse(freeze.Active(now), "should not be active between windows")
+	Assert(t).IsTrue(freeze.Active(now.Add(time.Hour)), "should be active at the start of a window")
+	Assert(t).IsFalse(freeze.Active(now.Add(2*time.Hour)), "should not be active at the end of a window")
+}
+
+func TestCovers(t *testing.T) {
+	target := Target{
+		PodID: "web",
+		PodLabels: klabels.Set{
+			types.AvailabilityZoneLabel: "az1",
+			types.ClusterNameLabel:      "prod",
+		},
+		NodeLabels: klabels.Set{"rack": "r1"},
+	}
+	tests := []struct {
+		freeze   Freeze
+		expected bool
+	}{
+		{Freeze{Global: true}, true},
+		{Freeze{PodCluster: &PodCluster{PodID: "web", AvailabilityZone: "az1", ClusterName: "prod"}}, true},
+		{Freeze{PodCluster: &PodCluster{PodID: "web", AvailabilityZone: "az2", ClusterName: "prod"}}, false},
+		{Freeze{PodCluster: &PodCluster{PodID: "db", AvailabilityZone: "az1", ClusterName: "prod"}}, false},
+		{Freeze{NodeSelector: "rack=r1"}, true},
+		{Freeze{NodeSelector: "rack=r2"}, false},
+	}
+	for _, test := range tests {
+		covered, err := test.freeze.Covers(target)
+		Assert(t).IsNil(err, "should not have erred checking coverage")
+		Assert(t).AreEqual(covered, test.expected, "unexpected coverage")
+	}
+
+	covered, err := Freeze{NodeSelector: "rack=r1"}.Covers(Target{PodID: "web"})
+	Assert(t).IsNil(err, "should not have erred checking coverage")
+	Assert(t).IsFalse(covered, "node freezes should not cover pods of unknown nodes")
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+	valid := []Freeze{
+		{ID: "f", Global: true},
+		{ID: "f", PodCluster: &PodCluster{PodID: "web", AvailabilityZone: "az1", ClusterName: "prod"}},
+		{ID: "f", NodeSelector: "rack=r1", Windows: []Window{{Start: now, End: now.Add(time.Hour)}}},
+	}
+	for _, freeze := range valid {
+		Assert(t).IsNil(freeze.Validate(), "freeze should have been valid")
+	}
+
+	invalid := []Freeze{
+		{Global: true},
+		{ID: "a/b", Global: true},
+		{ID: "f"},
+		{ID: "f", Global: true, NodeSelector: "rack=r1"},
+		{ID: "f", PodCluster: &PodCluster{PodID: "web"}},
+		{ID: "f", NodeSelector: "rack in ("},
+		{ID: "f", Global: true, Windows: []Window{{Start: now, End: now}}},
+	}
+	for _, freeze := range invalid {
+		Assert(t).IsNotNil(freeze.Validate(), "freeze should have been invalid")
+	}
+}
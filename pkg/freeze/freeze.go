@@ -0,0 +1,49 @@
+// Package freeze enforces deploy freezes. The preparers and the rolling update
+// farm ask the Checker whether a change is frozen before making it, so that
+// freezes are honored the same way everywhere.
+package freeze
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/freeze/fields"
+)
+
+type FreezeLister interface {
+	List() ([]fields.Freeze, error)
+}
+
+type Checker interface {
+	// Frozen returns the first freeze that is active at now and covers
+	// target, or nil if target may be changed
+	Frozen(target fields.Target, now time.Time) (*fields.Freeze, error)
+}
+
+type checker struct {
+	freezes FreezeLister
+}
+
+func NewChecker(freezes FreezeLister) Checker {
+	return checker{freezes: freezes}
+}
+
+func (c checker) Frozen(target fields.Target, now time.Time) (*fields.Freeze, error) {
+	freezes, err := c.freezes.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, freeze := range freezes {
+		if !freeze.Active(now) {
+			continue
+		}
+		covered, err := freeze.Covers(target)
+		if err != nil {
+			return nil, err
+		}
+		if covered {
+			frozen := freeze
+			return &frozen, nil
+		}
+	}
+	return nil, nil
+}
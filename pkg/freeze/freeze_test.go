@@ -0,0 +1,38 @@
+package freeze
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/freeze/fields"
+)
+
+type fakeFreezes []fields.Freeze
+
+func (f fakeFreezes) List() ([]fields.Freeze, error) {
+	return f, nil
+}
+
+func TestFrozen(t *testing.T) {
+	now := time.Now()
+	checker := NewChecker(fakeFreezes{
+		{ID: "over", Global: true, Windows: []fields.Window{{Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)}}},
+		{ID: "db", PodCluster: &fields.PodCluster{PodID: "db", AvailabilityZone: "az1", ClusterName: "prod"}},
+		{ID: "rack", NodeSelector: "rack=r1"},
+	})
+
+	frozen, err := checker.Frozen(fields.Target{PodID: "web"}, now)
+	Assert(t).IsNil(err, "should not have erred checking freezes")
+	Assert(t).IsTrue(frozen == nil, "an ended freeze should not freeze the pod")
+
+	frozen, err = checker.Frozen(fields.Target{PodID: "web", NodeLabels: klabels.Set{"rack": "r2"}}, now)
+	Assert(t).IsNil(err, "should not have erred checking freezes")
+	Assert(t).IsTrue(frozen == nil, "should not freeze a pod no freeze covers")
+
+	frozen, err = checker.Frozen(fields.Target{PodID: "web", NodeLabels: klabels.Set{"rack": "r1"}}, now)
+	Assert(t).IsNil(err, "should not have erred checking freezes")
+	Assert(t).IsTrue(frozen != nil && frozen.ID == "rack", "should have been frozen by the node freeze")
+}
@@ -0,0 +1,198 @@
+// Package admin serves the P2Admin gRPC service, with which operators can see
+// what a running preparer is doing and nudge it without restarting it.
+package admin
+
+import (
+	"errors"
+	"time"
+
+	admin_protos "github.com/square/p2/pkg/grpc/admin/protos"
+	"github.com/square/p2/pkg/types"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// PodNotFound is returned by a Preparer asked to act on a pod that is not
+// scheduled on or installed on the node
+var PodNotFound = errors.New("No such pod on this node")
+
+// PodStatus is an installed pod and the status of its services
+type PodStatus struct {
+	PodID        types.PodID
+	PodUniqueKey types.PodUniqueKey
+	SHA          string
+	Services     []ServiceStatus
+	// Set if the pod's services could not be listed
+	Err error
+}
+
+type ServiceStatus struct {
+	Name   string
+	Status string
+	PID    uint64
+	// How long the service has had its status
+	Time time.Duration
+	// Set if the status could not be read
+	Err error
+}
+
+// Work is work on a pod that the preparer is doing or has yet to do
+type Work struct {
+	PodID        types.PodID
+	PodUniqueKey types.PodUniqueKey
+	SHA          string
+	State        string
+	Reinstall    bool
+	Observed     time.Time
+}
+
+// Verification is the result of verifying an installed pod
+type Verification struct {
+	PodID        types.PodID
+	PodUniqueKey types.PodUniqueKey
+	Err          error
+}
+
+// ConfigReload is what changed when the preparer's config was reloaded
+type ConfigReload struct {
+	// The fields that were changed and applied
+	Applied []string
+	// The fields that were changed but only take effect after a restart
+	RequiresRestart []string
+}
+
+// Preparer is what the service asks of the preparer it administers
+type Preparer interface {
+	PodStatuses() []PodStatus
+	PendingWork() []Work
+	// Verifies the installed pods, or if podID is set, the one pod
+	Reverify(podID types.PodID, podUniqueKey types.PodUniqueKey) ([]Verification, error)
+	ForceReinstall(podID types.PodID, podUniqueKey types.PodUniqueKey) error
+	ReloadConfig() (ConfigReload, error)
+	SetLogLevel(level string) error
+	LogLevel() string
+}
+
+type Server struct {
+	preparer Preparer
+}
+
+var _ admin_protos.P2AdminServer = Server{}
+
+func NewServer(preparer Preparer) Server {
+	return Server{
+		preparer: preparer,
+	}
+}
+
+func (s Server) ListPods(_ context.Context, _ *admin_protos.ListPodsRequest) (*admin_protos.ListPodsResponse, error) {
+	resp := &admin_protos.ListPodsResponse{}
+	for _, status := range s.preparer.PodStatuses() {
+		pod := &admin_protos.PodStatus{
+			PodId:        status.PodID.String(),
+			PodUniqueKey: status.PodUniqueKey.String(),
+			Sha:          status.SHA,
+			Error:        errorString(status.Err),
+		}
+		for _, service := range status.Services {
+			pod.Services = append(pod.Services, &admin_protos.ServiceStatus{
+				Name:   service.Name,
+				Status: service.Status,
+				Pid:    service.PID,
+				Time:   int64(service.Time / time.Second),
+				Error:  errorString(service.Err),
+			})
+		}
+		resp.Pods = append(resp.Pods, pod)
+	}
+	return resp, nil
+}
+
+func (s Server) ListPendingWork(_ context.Context, _ *admin_protos.ListPendingWorkRequest) (*admin_protos.ListPendingWorkResponse, error) {
+	resp := &admin_protos.ListPendingWorkResponse{}
+	for _, work := range s.preparer.PendingWork() {
+		resp.Work = append(resp.Work, &admin_protos.Work{
+			PodId:        work.PodID.String(),
+			PodUniqueKey: work.PodUniqueKey.String(),
+			Sha:          work.SHA,
+			State:        work.State,
+			Reinstall:    work.Reinstall,
+			Observed:     work.Observed.UnixNano(),
+		})
+	}
+	return resp, nil
+}
+
+func (s Server) Reverify(_ context.Context, req *admin_protos.ReverifyRequest) (*admin_protos.ReverifyResponse, error) {
+	if req.PodId == "" && req.PodUniqueKey != "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "pod_id must be provided with pod_unique_key")
+	}
+	verifications, err := s.preparer.Reverify(types.PodID(req.PodId), types.PodUniqueKey(req.PodUniqueKey))
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	resp := &admin_protos.ReverifyResponse{}
+	for _, verification := range verifications {
+		resp.Verifications = append(resp.Verifications, &admin_protos.Verification{
+			PodId:        verification.PodID.String(),
+			PodUniqueKey: verification.PodUniqueKey.String(),
+			Error:        errorString(verification.Err),
+		})
+	}
+	return resp, nil
+}
+
+func (s Server) ForceReinstall(_ context.Context, req *admin_protos.ForceReinstallRequest) (*admin_protos.ForceReinstallResponse, error) {
+	if req.PodId == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "pod_id must be provided")
+	}
+	err := s.preparer.ForceReinstall(types.PodID(req.PodId), types.PodUniqueKey(req.PodUniqueKey))
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+	return &admin_protos.ForceReinstallResponse{}, nil
+}
+
+func (s Server) ReloadConfig(_ context.Context, _ *admin_protos.ReloadConfigRequest) (*admin_protos.ReloadConfigResponse, error) {
+	reload, err := s.preparer.ReloadConfig()
+	if err != nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "could not reload config: %s", err)
+	}
+	return &admin_protos.ReloadConfigResponse{
+		LogLevel:        s.preparer.LogLevel(),
+		Applied:         reload.Applied,
+		RequiresRestart: reload.RequiresRestart,
+	}, nil
+}
+
+func (s Server) SetLogLevel(_ context.Context, req *admin_protos.SetLogLevelRequest) (*admin_protos.SetLogLevelResponse, error) {
+	if req.Level == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "level must be provided")
+	}
+	previous := s.preparer.LogLevel()
+	err := s.preparer.SetLogLevel(req.Level)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	return &admin_protos.SetLogLevelResponse{
+		PreviousLevel: previous,
+		Level:         s.preparer.LogLevel(),
+	}, nil
+}
+
+func toGRPCError(err error) error {
+	if err == PodNotFound {
+		return grpc.Errorf(codes.NotFound, "%s", err)
+	}
+	return grpc.Errorf(codes.FailedPrecondition, "%s", err)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,212 @@
+package admin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	admin_protos "github.com/square/p2/pkg/grpc/admin/protos"
+	"github.com/square/p2/pkg/types"
+
+	context "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+type fakePreparer struct {
+	statuses      []PodStatus
+	work          []Work
+	verifications []Verification
+	level         string
+
+	reinstalled []types.PodID
+	reinstall   error
+	reloaded    bool
+}
+
+func (f *fakePreparer) PodStatuses() []PodStatus { return f.statuses }
+func (f *fakePreparer) PendingWork() []Work      { return f.work }
+func (f *fakePreparer) LogLevel() string         { return f.level }
+
+func (f *fakePreparer) Reverify(podID types.PodID, podUniqueKey types.PodUniqueKey) ([]Verification, error) {
+	if podID == "" {
+		return f.verifications, nil
+	}
+	for _, verification := range f.verifications {
+		if verification.PodID == podID {
+			return []Verification{verification}, nil
+		}
+	}
+	return nil, PodNotFound
+}
+
+func (f *fakePreparer) ForceReinstall(podID types.PodID, podUniqueKey types.PodUniqueKey) error {
+	if f.reinstall != nil {
+		return f.reinstall
+	}
+	f.reinstalled = append(f.reinstalled, podID)
+	return nil
+}
+
+func (f *fakePreparer) ReloadConfig() (ConfigReload, error) {
+	f.reloaded = true
+	f.level = "info"
+	return ConfigReload{Applied: []string{"log_level"}, RequiresRestart: []string{"pod_root"}}, nil
+}
+
+func (f *fakePreparer) SetLogLevel(level string) error {
+	if level != "debug" && level != "info" {
+		return errors.New("invalid level")
+	}
+	f.level = level
+	return nil
+}
+
+func TestListPods(t *testing.T) {
+	server := NewServer(&fakePreparer{statuses: []PodStatus{
+		{
+			PodID: "web",
+			SHA:   "abc123",
+			Services: []ServiceStatus{
+				{Name: "web__web__launch", Status: "run", PID: 42, Time: 90 * time.Second},
+				{Name: "web__web__worker", Err: errors.New("no status")},
+			},
+		},
+		{PodID: "db", PodUniqueKey: "a1b2", Err: errors.New("no services")},
+	}})
+
+	resp, err := server.ListPods(context.Background(), &admin_protos.ListPodsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Pods) != 2 {
+		t.Fatalf("expected 2 pods but got %d", len(resp.Pods))
+	}
+	web := resp.Pods[0]
+	if web.PodId != "web" || web.Sha != "abc123" || len(web.Services) != 2 {
+		t.Fatalf("unexpected pod status %+v", web)
+	}
+	if service := web.Services[0]; service.Status != "run" || service.Pid != 42 || service.Time != 90 {
+		t.Errorf("unexpected service status %+v", service)
+	}
+	if service := web.Services[1]; service.Error != "no status" {
+		t.Errorf("expected the service's error to be reported but got %+v", service)
+	}
+	if db := resp.Pods[1]; db.PodUniqueKey != "a1b2" || db.Error != "no services" {
+		t.Errorf("unexpected pod status %+v", db)
+	}
+}
+
+func TestListPendingWork(t *testing.T) {
+	observed := time.Unix(1500000000, 0)
+	server := NewServer(&fakePreparer{work: []Work{
+		{PodID: "web", SHA: "abc123", State: "retrying", Reinstall: true, Observed: observed},
+	}})
+
+	resp, err := server.ListPendingWork(context.Background(), &admin_protos.ListPendingWorkRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Work) != 1 {
+		t.Fatalf("expected 1 piece of work but got %d", len(resp.Work))
+	}
+	work := resp.Work[0]
+	if work.PodId != "web" || work.State != "retrying" || !work.Reinstall || work.Observed != observed.UnixNano() {
+		t.Errorf("unexpected work %+v", work)
+	}
+}
+
+func TestReverify(t *testing.T) {
+	server := NewServer(&fakePreparer{verifications: []Verification{
+		{PodID: "web"},
+		{PodID: "db", Err: errors.New("digest mismatch")},
+	}})
+
+	resp, err := server.Reverify(context.Background(), &admin_protos.ReverifyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Verifications) != 2 || resp.Verifications[0].Error != "" || resp.Verifications[1].Error != "digest mismatch" {
+		t.Errorf("unexpected verifications %+v", resp.Verifications)
+	}
+
+	resp, err = server.Reverify(context.Background(), &admin_protos.ReverifyRequest{PodId: "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Verifications) != 1 || resp.Verifications[0].PodId != "db" {
+		t.Errorf("expected only db to be verified but got %+v", resp.Verifications)
+	}
+
+	_, err = server.Reverify(context.Background(), &admin_protos.ReverifyRequest{PodId: "other"})
+	if grpc.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a pod that isn't installed but got %v", err)
+	}
+
+	_, err = server.Reverify(context.Background(), &admin_protos.ReverifyRequest{PodUniqueKey: "a1b2"})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a unique key without a pod ID but got %v", err)
+	}
+}
+
+func TestForceReinstall(t *testing.T) {
+	preparer := &fakePreparer{}
+	server := NewServer(preparer)
+
+	_, err := server.ForceReinstall(context.Background(), &admin_protos.ForceReinstallRequest{})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument without a pod ID but got %v", err)
+	}
+
+	_, err = server.ForceReinstall(context.Background(), &admin_protos.ForceReinstallRequest{PodId: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preparer.reinstalled) != 1 || preparer.reinstalled[0] != "web" {
+		t.Errorf("expected web to be reinstalled but got %v", preparer.reinstalled)
+	}
+
+	preparer.reinstall = PodNotFound
+	_, err = server.ForceReinstall(context.Background(), &admin_protos.ForceReinstallRequest{PodId: "other"})
+	if grpc.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound but got %v", err)
+	}
+
+	preparer.reinstall = errors.New("the preparer can't reinstall itself")
+	_, err = server.ForceReinstall(context.Background(), &admin_protos.ForceReinstallRequest{PodId: "p2-preparer"})
+	if grpc.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition but got %v", err)
+	}
+}
+
+func TestSetLogLevelAndReloadConfig(t *testing.T) {
+	preparer := &fakePreparer{level: "info"}
+	server := NewServer(preparer)
+
+	resp, err := server.SetLogLevel(context.Background(), &admin_protos.SetLogLevelRequest{Level: "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.PreviousLevel != "info" || resp.Level != "debug" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	_, err = server.SetLogLevel(context.Background(), &admin_protos.SetLogLevelRequest{Level: "loud"})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for an invalid level but got %v", err)
+	}
+	if preparer.level != "debug" {
+		t.Errorf("an invalid level should not change the level, but it is now %s", preparer.level)
+	}
+
+	reloaded, err := server.ReloadConfig(context.Background(), &admin_protos.ReloadConfigRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !preparer.reloaded || reloaded.LogLevel != "info" {
+		t.Errorf("expected the config to be reloaded but got %+v", reloaded)
+	}
+	if len(reloaded.Applied) != 1 || reloaded.Applied[0] != "log_level" || len(reloaded.RequiresRestart) != 1 || reloaded.RequiresRestart[0] != "pod_root" {
+		t.Errorf("expected the applied and restart-requiring fields to be reported but got %+v", reloaded)
+	}
+}
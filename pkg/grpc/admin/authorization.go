@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"crypto/x509"
+
+	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// AuthorizeClients returns an interceptor that only lets through requests
+// from clients whose certificates have one of the given common names. The
+// server must be configured to require client certificates.
+func AuthorizeClients(commonNames []string) grpc.UnaryServerInterceptor {
+	allowed := make(map[string]bool, len(commonNames))
+	for _, cn := range commonNames {
+		allowed[cn] = true
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		cert, err := clientCertificate(ctx)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Unauthenticated, "%s", err)
+		}
+		if !allowed[cert.Subject.CommonName] {
+			return nil, grpc.Errorf(codes.PermissionDenied, "%s is not authorized to administer the preparer", cert.Subject.CommonName)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// clientCertificate returns the verified certificate the client presented
+// when establishing the connection the request arrived on
+func clientCertificate(ctx context.Context) (*x509.Certificate, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, util.Errorf("no peer information for request")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, util.Errorf("request was not made over TLS")
+	}
+	chains := tlsInfo.State.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil, util.Errorf("no verified client certificate")
+	}
+	return chains[0][0], nil
+}
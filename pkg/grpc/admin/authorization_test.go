@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	admin_protos "github.com/square/p2/pkg/grpc/admin/protos"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func contextWithClientCN(cn string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{cert}},
+			},
+		},
+	})
+}
+
+func TestAuthorizeClients(t *testing.T) {
+	interceptor := AuthorizeClients([]string{"operator"})
+	info := &grpc.UnaryServerInfo{FullMethod: "/admin.P2Admin/ForceReinstall"}
+	handled := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled = true
+		return &admin_protos.ForceReinstallResponse{}, nil
+	}
+	req := &admin_protos.ForceReinstallRequest{PodId: "web"}
+
+	_, err := interceptor(contextWithClientCN("operator"), req, info, handler)
+	if err != nil || !handled {
+		t.Errorf("expected operator to be authorized, got %v", err)
+	}
+
+	handled = false
+	_, err = interceptor(contextWithClientCN("someone-else"), req, info, handler)
+	if grpc.Code(err) != codes.PermissionDenied || handled {
+		t.Errorf("expected %s for an unknown client, got %v", codes.PermissionDenied, err)
+	}
+
+	_, err = interceptor(context.Background(), req, info, handler)
+	if grpc.Code(err) != codes.Unauthenticated || handled {
+		t.Errorf("expected %s for a client without a certificate, got %v", codes.Unauthenticated, err)
+	}
+}
@@ -0,0 +1,762 @@
+// Code generated by protoc-gen-go.
+// source: pkg/grpc/admin/protos/admin.proto
+// DO NOT EDIT!
+
+/*
+Package admin is a generated protocol buffer package.
+
+It is generated from these files:
+
+	pkg/grpc/admin/protos/admin.proto
+
+It has these top-level messages:
+
+	ListPodsRequest
+	ListPodsResponse
+	PodStatus
+	ServiceStatus
+	ListPendingWorkRequest
+	ListPendingWorkResponse
+	Work
+	ReverifyRequest
+	ReverifyResponse
+	Verification
+	ForceReinstallRequest
+	ForceReinstallResponse
+	ReloadConfigRequest
+	ReloadConfigResponse
+	SetLogLevelRequest
+	SetLogLevelResponse
+*/
+package admin
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type ListPodsRequest struct {
+}
+
+func (m *ListPodsRequest) Reset()                    { *m = ListPodsRequest{} }
+func (m *ListPodsRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListPodsRequest) ProtoMessage()               {}
+func (*ListPodsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+type ListPodsResponse struct {
+	Pods []*PodStatus `protobuf:"bytes,1,rep,name=pods" json:"pods,omitempty"`
+}
+
+func (m *ListPodsResponse) Reset()                    { *m = ListPodsResponse{} }
+func (m *ListPodsResponse) String() string            { return proto.CompactTextString(m) }
+func (*ListPodsResponse) ProtoMessage()               {}
+func (*ListPodsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *ListPodsResponse) GetPods() []*PodStatus {
+	if m != nil {
+		return m.Pods
+	}
+	return nil
+}
+
+// an installed pod and the runit status of its services
+type PodStatus struct {
+	PodId        string `protobuf:"bytes,1,opt,name=pod_id,json=podId" json:"pod_id,omitempty"`
+	PodUniqueKey string `protobuf:"bytes,2,opt,name=pod_unique_key,json=podUniqueKey" json:"pod_unique_key,omitempty"`
+	// the SHA of the manifest the pod was last launched with
+	Sha      string           `protobuf:"bytes,3,opt,name=sha" json:"sha,omitempty"`
+	Services []*ServiceStatus `protobuf:"bytes,4,rep,name=services" json:"services,omitempty"`
+	// set if the services of the pod could not be listed
+	Error string `protobuf:"bytes,5,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *PodStatus) Reset()                    { *m = PodStatus{} }
+func (m *PodStatus) String() string            { return proto.CompactTextString(m) }
+func (*PodStatus) ProtoMessage()               {}
+func (*PodStatus) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *PodStatus) GetPodId() string {
+	if m != nil {
+		return m.PodId
+	}
+	return ""
+}
+
+func (m *PodStatus) GetPodUniqueKey() string {
+	if m != nil {
+		return m.PodUniqueKey
+	}
+	return ""
+}
+
+func (m *PodStatus) GetSha() string {
+	if m != nil {
+		return m.Sha
+	}
+	return ""
+}
+
+func (m *PodStatus) GetServices() []*ServiceStatus {
+	if m != nil {
+		return m.Services
+	}
+	return nil
+}
+
+func (m *PodStatus) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type ServiceStatus struct {
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	// as reported by runit, e.g. "run" or "down"
+	Status string `protobuf:"bytes,2,opt,name=status" json:"status,omitempty"`
+	Pid    uint64 `protobuf:"varint,3,opt,name=pid" json:"pid,omitempty"`
+	// how long the service has had its status, in seconds
+	Time int64 `protobuf:"varint,4,opt,name=time" json:"time,omitempty"`
+	// set if the status could not be read
+	Error string `protobuf:"bytes,5,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *ServiceStatus) Reset()                    { *m = ServiceStatus{} }
+func (m *ServiceStatus) String() string            { return proto.CompactTextString(m) }
+func (*ServiceStatus) ProtoMessage()               {}
+func (*ServiceStatus) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *ServiceStatus) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ServiceStatus) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *ServiceStatus) GetPid() uint64 {
+	if m != nil {
+		return m.Pid
+	}
+	return 0
+}
+
+func (m *ServiceStatus) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *ServiceStatus) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type ListPendingWorkRequest struct {
+}
+
+func (m *ListPendingWorkRequest) Reset()                    { *m = ListPendingWorkRequest{} }
+func (m *ListPendingWorkRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListPendingWorkRequest) ProtoMessage()               {}
+func (*ListPendingWorkRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+type ListPendingWorkResponse struct {
+	Work []*Work `protobuf:"bytes,1,rep,name=work" json:"work,omitempty"`
+}
+
+func (m *ListPendingWorkResponse) Reset()                    { *m = ListPendingWorkResponse{} }
+func (m *ListPendingWorkResponse) String() string            { return proto.CompactTextString(m) }
+func (*ListPendingWorkResponse) ProtoMessage()               {}
+func (*ListPendingWorkResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *ListPendingWorkResponse) GetWork() []*Work {
+	if m != nil {
+		return m.Work
+	}
+	return nil
+}
+
+type Work struct {
+	PodId        string `protobuf:"bytes,1,opt,name=pod_id,json=podId" json:"pod_id,omitempty"`
+	PodUniqueKey string `protobuf:"bytes,2,opt,name=pod_unique_key,json=podUniqueKey" json:"pod_unique_key,omitempty"`
+	// the SHA of the manifest the work deploys, or of the one it removes
+	Sha string `protobuf:"bytes,3,opt,name=sha" json:"sha,omitempty"`
+	// "in_progress", "ready" (waiting for a worker), "waiting" (for the work
+	// in progress on the same pod) or "retrying" (after a failure)
+	State     string `protobuf:"bytes,4,opt,name=state" json:"state,omitempty"`
+	Reinstall bool   `protobuf:"varint,5,opt,name=reinstall" json:"reinstall,omitempty"`
+	// when the manifest was first seen, in nanoseconds since the unix epoch
+	Observed int64 `protobuf:"varint,6,opt,name=observed" json:"observed,omitempty"`
+}
+
+func (m *Work) Reset()                    { *m = Work{} }
+func (m *Work) String() string            { return proto.CompactTextString(m) }
+func (*Work) ProtoMessage()               {}
+func (*Work) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *Work) GetPodId() string {
+	if m != nil {
+		return m.PodId
+	}
+	return ""
+}
+
+func (m *Work) GetPodUniqueKey() string {
+	if m != nil {
+		return m.PodUniqueKey
+	}
+	return ""
+}
+
+func (m *Work) GetSha() string {
+	if m != nil {
+		return m.Sha
+	}
+	return ""
+}
+
+func (m *Work) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *Work) GetReinstall() bool {
+	if m != nil {
+		return m.Reinstall
+	}
+	return false
+}
+
+func (m *Work) GetObserved() int64 {
+	if m != nil {
+		return m.Observed
+	}
+	return 0
+}
+
+type ReverifyRequest struct {
+	// if set, only this pod is verified
+	PodId        string `protobuf:"bytes,1,opt,name=pod_id,json=podId" json:"pod_id,omitempty"`
+	PodUniqueKey string `protobuf:"bytes,2,opt,name=pod_unique_key,json=podUniqueKey" json:"pod_unique_key,omitempty"`
+}
+
+func (m *ReverifyRequest) Reset()                    { *m = ReverifyRequest{} }
+func (m *ReverifyRequest) String() string            { return proto.CompactTextString(m) }
+func (*ReverifyRequest) ProtoMessage()               {}
+func (*ReverifyRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *ReverifyRequest) GetPodId() string {
+	if m != nil {
+		return m.PodId
+	}
+	return ""
+}
+
+func (m *ReverifyRequest) GetPodUniqueKey() string {
+	if m != nil {
+		return m.PodUniqueKey
+	}
+	return ""
+}
+
+type ReverifyResponse struct {
+	Verifications []*Verification `protobuf:"bytes,1,rep,name=verifications" json:"verifications,omitempty"`
+}
+
+func (m *ReverifyResponse) Reset()                    { *m = ReverifyResponse{} }
+func (m *ReverifyResponse) String() string            { return proto.CompactTextString(m) }
+func (*ReverifyResponse) ProtoMessage()               {}
+func (*ReverifyResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *ReverifyResponse) GetVerifications() []*Verification {
+	if m != nil {
+		return m.Verifications
+	}
+	return nil
+}
+
+type Verification struct {
+	PodId        string `protobuf:"bytes,1,opt,name=pod_id,json=podId" json:"pod_id,omitempty"`
+	PodUniqueKey string `protobuf:"bytes,2,opt,name=pod_unique_key,json=podUniqueKey" json:"pod_unique_key,omitempty"`
+	// set if the pod failed verification
+	Error string `protobuf:"bytes,3,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *Verification) Reset()                    { *m = Verification{} }
+func (m *Verification) String() string            { return proto.CompactTextString(m) }
+func (*Verification) ProtoMessage()               {}
+func (*Verification) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *Verification) GetPodId() string {
+	if m != nil {
+		return m.PodId
+	}
+	return ""
+}
+
+func (m *Verification) GetPodUniqueKey() string {
+	if m != nil {
+		return m.PodUniqueKey
+	}
+	return ""
+}
+
+func (m *Verification) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type ForceReinstallRequest struct {
+	PodId string `protobuf:"bytes,1,opt,name=pod_id,json=podId" json:"pod_id,omitempty"`
+	// required for uuid pods
+	PodUniqueKey string `protobuf:"bytes,2,opt,name=pod_unique_key,json=podUniqueKey" json:"pod_unique_key,omitempty"`
+}
+
+func (m *ForceReinstallRequest) Reset()                    { *m = ForceReinstallRequest{} }
+func (m *ForceReinstallRequest) String() string            { return proto.CompactTextString(m) }
+func (*ForceReinstallRequest) ProtoMessage()               {}
+func (*ForceReinstallRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *ForceReinstallRequest) GetPodId() string {
+	if m != nil {
+		return m.PodId
+	}
+	return ""
+}
+
+func (m *ForceReinstallRequest) GetPodUniqueKey() string {
+	if m != nil {
+		return m.PodUniqueKey
+	}
+	return ""
+}
+
+type ForceReinstallResponse struct {
+}
+
+func (m *ForceReinstallResponse) Reset()                    { *m = ForceReinstallResponse{} }
+func (m *ForceReinstallResponse) String() string            { return proto.CompactTextString(m) }
+func (*ForceReinstallResponse) ProtoMessage()               {}
+func (*ForceReinstallResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+type ReloadConfigRequest struct {
+}
+
+func (m *ReloadConfigRequest) Reset()                    { *m = ReloadConfigRequest{} }
+func (m *ReloadConfigRequest) String() string            { return proto.CompactTextString(m) }
+func (*ReloadConfigRequest) ProtoMessage()               {}
+func (*ReloadConfigRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+type ReloadConfigResponse struct {
+	// the log level after the reload
+	LogLevel string `protobuf:"bytes,1,opt,name=log_level,json=logLevel" json:"log_level,omitempty"`
+	// the reloadable fields that were changed and applied
+	Applied []string `protobuf:"bytes,2,rep,name=applied" json:"applied,omitempty"`
+	// the fields that were changed but only take effect after a restart
+	RequiresRestart []string `protobuf:"bytes,3,rep,name=requires_restart,json=requiresRestart" json:"requires_restart,omitempty"`
+}
+
+func (m *ReloadConfigResponse) Reset()                    { *m = ReloadConfigResponse{} }
+func (m *ReloadConfigResponse) String() string            { return proto.CompactTextString(m) }
+func (*ReloadConfigResponse) ProtoMessage()               {}
+func (*ReloadConfigResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *ReloadConfigResponse) GetLogLevel() string {
+	if m != nil {
+		return m.LogLevel
+	}
+	return ""
+}
+
+func (m *ReloadConfigResponse) GetApplied() []string {
+	if m != nil {
+		return m.Applied
+	}
+	return nil
+}
+
+func (m *ReloadConfigResponse) GetRequiresRestart() []string {
+	if m != nil {
+		return m.RequiresRestart
+	}
+	return nil
+}
+
+type SetLogLevelRequest struct {
+	Level string `protobuf:"bytes,1,opt,name=level" json:"level,omitempty"`
+}
+
+func (m *SetLogLevelRequest) Reset()                    { *m = SetLogLevelRequest{} }
+func (m *SetLogLevelRequest) String() string            { return proto.CompactTextString(m) }
+func (*SetLogLevelRequest) ProtoMessage()               {}
+func (*SetLogLevelRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *SetLogLevelRequest) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+type SetLogLevelResponse struct {
+	PreviousLevel string `protobuf:"bytes,1,opt,name=previous_level,json=previousLevel" json:"previous_level,omitempty"`
+	Level         string `protobuf:"bytes,2,opt,name=level" json:"level,omitempty"`
+}
+
+func (m *SetLogLevelResponse) Reset()                    { *m = SetLogLevelResponse{} }
+func (m *SetLogLevelResponse) String() string            { return proto.CompactTextString(m) }
+func (*SetLogLevelResponse) ProtoMessage()               {}
+func (*SetLogLevelResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *SetLogLevelResponse) GetPreviousLevel() string {
+	if m != nil {
+		return m.PreviousLevel
+	}
+	return ""
+}
+
+func (m *SetLogLevelResponse) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*ListPodsRequest)(nil), "admin.ListPodsRequest")
+	proto.RegisterType((*ListPodsResponse)(nil), "admin.ListPodsResponse")
+	proto.RegisterType((*PodStatus)(nil), "admin.PodStatus")
+	proto.RegisterType((*ServiceStatus)(nil), "admin.ServiceStatus")
+	proto.RegisterType((*ListPendingWorkRequest)(nil), "admin.ListPendingWorkRequest")
+	proto.RegisterType((*ListPendingWorkResponse)(nil), "admin.ListPendingWorkResponse")
+	proto.RegisterType((*Work)(nil), "admin.Work")
+	proto.RegisterType((*ReverifyRequest)(nil), "admin.ReverifyRequest")
+	proto.RegisterType((*ReverifyResponse)(nil), "admin.ReverifyResponse")
+	proto.RegisterType((*Verification)(nil), "admin.Verification")
+	proto.RegisterType((*ForceReinstallRequest)(nil), "admin.ForceReinstallRequest")
+	proto.RegisterType((*ForceReinstallResponse)(nil), "admin.ForceReinstallResponse")
+	proto.RegisterType((*ReloadConfigRequest)(nil), "admin.ReloadConfigRequest")
+	proto.RegisterType((*ReloadConfigResponse)(nil), "admin.ReloadConfigResponse")
+	proto.RegisterType((*SetLogLevelRequest)(nil), "admin.SetLogLevelRequest")
+	proto.RegisterType((*SetLogLevelResponse)(nil), "admin.SetLogLevelResponse")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for P2Admin service
+
+type P2AdminClient interface {
+	ListPods(ctx context.Context, in *ListPodsRequest, opts ...grpc.CallOption) (*ListPodsResponse, error)
+	ListPendingWork(ctx context.Context, in *ListPendingWorkRequest, opts ...grpc.CallOption) (*ListPendingWorkResponse, error)
+	// Checks the installed launchables of pods against the digests their
+	// artifacts were verified with
+	Reverify(ctx context.Context, in *ReverifyRequest, opts ...grpc.CallOption) (*ReverifyResponse, error)
+	// Downloads and installs the launchables of a pod again, then relaunches it
+	ForceReinstall(ctx context.Context, in *ForceReinstallRequest, opts ...grpc.CallOption) (*ForceReinstallResponse, error)
+	ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error)
+	SetLogLevel(ctx context.Context, in *SetLogLevelRequest, opts ...grpc.CallOption) (*SetLogLevelResponse, error)
+}
+
+type p2AdminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewP2AdminClient(cc *grpc.ClientConn) P2AdminClient {
+	return &p2AdminClient{cc}
+}
+
+func (c *p2AdminClient) ListPods(ctx context.Context, in *ListPodsRequest, opts ...grpc.CallOption) (*ListPodsResponse, error) {
+	out := new(ListPodsResponse)
+	err := grpc.Invoke(ctx, "/admin.P2Admin/ListPods", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2AdminClient) ListPendingWork(ctx context.Context, in *ListPendingWorkRequest, opts ...grpc.CallOption) (*ListPendingWorkResponse, error) {
+	out := new(ListPendingWorkResponse)
+	err := grpc.Invoke(ctx, "/admin.P2Admin/ListPendingWork", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2AdminClient) Reverify(ctx context.Context, in *ReverifyRequest, opts ...grpc.CallOption) (*ReverifyResponse, error) {
+	out := new(ReverifyResponse)
+	err := grpc.Invoke(ctx, "/admin.P2Admin/Reverify", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2AdminClient) ForceReinstall(ctx context.Context, in *ForceReinstallRequest, opts ...grpc.CallOption) (*ForceReinstallResponse, error) {
+	out := new(ForceReinstallResponse)
+	err := grpc.Invoke(ctx, "/admin.P2Admin/ForceReinstall", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2AdminClient) ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error) {
+	out := new(ReloadConfigResponse)
+	err := grpc.Invoke(ctx, "/admin.P2Admin/ReloadConfig", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2AdminClient) SetLogLevel(ctx context.Context, in *SetLogLevelRequest, opts ...grpc.CallOption) (*SetLogLevelResponse, error) {
+	out := new(SetLogLevelResponse)
+	err := grpc.Invoke(ctx, "/admin.P2Admin/SetLogLevel", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for P2Admin service
+
+type P2AdminServer interface {
+	ListPods(context.Context, *ListPodsRequest) (*ListPodsResponse, error)
+	ListPendingWork(context.Context, *ListPendingWorkRequest) (*ListPendingWorkResponse, error)
+	// Checks the installed launchables of pods against the digests their
+	// artifacts were verified with
+	Reverify(context.Context, *ReverifyRequest) (*ReverifyResponse, error)
+	// Downloads and installs the launchables of a pod again, then relaunches it
+	ForceReinstall(context.Context, *ForceReinstallRequest) (*ForceReinstallResponse, error)
+	ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error)
+	SetLogLevel(context.Context, *SetLogLevelRequest) (*SetLogLevelResponse, error)
+}
+
+func RegisterP2AdminServer(s *grpc.Server, srv P2AdminServer) {
+	s.RegisterService(&_P2Admin_serviceDesc, srv)
+}
+
+func _P2Admin_ListPods_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPodsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2AdminServer).ListPods(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.P2Admin/ListPods",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2AdminServer).ListPods(ctx, req.(*ListPodsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2Admin_ListPendingWork_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPendingWorkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2AdminServer).ListPendingWork(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.P2Admin/ListPendingWork",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2AdminServer).ListPendingWork(ctx, req.(*ListPendingWorkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2Admin_Reverify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReverifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2AdminServer).Reverify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.P2Admin/Reverify",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2AdminServer).Reverify(ctx, req.(*ReverifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2Admin_ForceReinstall_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ForceReinstallRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2AdminServer).ForceReinstall(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.P2Admin/ForceReinstall",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2AdminServer).ForceReinstall(ctx, req.(*ForceReinstallRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2Admin_ReloadConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2AdminServer).ReloadConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.P2Admin/ReloadConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2AdminServer).ReloadConfig(ctx, req.(*ReloadConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2Admin_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLogLevelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2AdminServer).SetLogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.P2Admin/SetLogLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2AdminServer).SetLogLevel(ctx, req.(*SetLogLevelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _P2Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.P2Admin",
+	HandlerType: (*P2AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListPods",
+			Handler:    _P2Admin_ListPods_Handler,
+		},
+		{
+			MethodName: "ListPendingWork",
+			Handler:    _P2Admin_ListPendingWork_Handler,
+		},
+		{
+			MethodName: "Reverify",
+			Handler:    _P2Admin_Reverify_Handler,
+		},
+		{
+			MethodName: "ForceReinstall",
+			Handler:    _P2Admin_ForceReinstall_Handler,
+		},
+		{
+			MethodName: "ReloadConfig",
+			Handler:    _P2Admin_ReloadConfig_Handler,
+		},
+		{
+			MethodName: "SetLogLevel",
+			Handler:    _P2Admin_SetLogLevel_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pkg/grpc/admin/protos/admin.proto",
+}
+
+func init() { proto.RegisterFile("pkg/grpc/admin/protos/admin.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 673 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x55, 0x5d, 0x4f, 0xdb, 0x30,
+	0x14, 0x5d, 0x49, 0x5a, 0xda, 0xcb, 0x47, 0x3b, 0x53, 0x8a, 0x17, 0x60, 0xeb, 0x22, 0x26, 0x75,
+	0x7b, 0x80, 0x89, 0xbd, 0x6c, 0x93, 0x78, 0x98, 0x26, 0x21, 0xa1, 0xb1, 0x0d, 0x99, 0x7d, 0x3c,
+	0x56, 0xa1, 0xbe, 0x74, 0x56, 0x43, 0x1c, 0xec, 0xb4, 0x8c, 0xbf, 0x33, 0x69, 0xbf, 0x63, 0x7f,
+	0x6d, 0x8a, 0xe3, 0x84, 0xb4, 0x85, 0x27, 0x78, 0xf3, 0x3d, 0xe7, 0xe6, 0xfa, 0xdc, 0xe3, 0x6b,
+	0x07, 0x9e, 0xc7, 0xa3, 0xe1, 0xde, 0x50, 0xc5, 0x83, 0xbd, 0x80, 0x5f, 0x88, 0x68, 0x2f, 0x56,
+	0x32, 0x91, 0x3a, 0x0b, 0x76, 0x4d, 0x40, 0xaa, 0x26, 0xf0, 0x1f, 0x43, 0xf3, 0x58, 0xe8, 0xe4,
+	0x44, 0x72, 0xcd, 0xf0, 0x72, 0x8c, 0x3a, 0xf1, 0xdf, 0x42, 0xeb, 0x06, 0xd2, 0xb1, 0x8c, 0x34,
+	0x92, 0x1d, 0x70, 0x63, 0xc9, 0x35, 0xad, 0x74, 0x9d, 0xde, 0xd2, 0x7e, 0x6b, 0x37, 0xab, 0x74,
+	0x22, 0xf9, 0x69, 0x12, 0x24, 0x63, 0xcd, 0x0c, 0xeb, 0xff, 0xa9, 0x40, 0xa3, 0xc0, 0xc8, 0x3a,
+	0xd4, 0x62, 0xc9, 0xfb, 0x82, 0xd3, 0x4a, 0xb7, 0xd2, 0x6b, 0xb0, 0x6a, 0x2c, 0xf9, 0x11, 0x27,
+	0x3b, 0xb0, 0x9a, 0xc2, 0xe3, 0x48, 0x5c, 0x8e, 0xb1, 0x3f, 0xc2, 0x6b, 0xba, 0x60, 0xe8, 0xe5,
+	0x58, 0xf2, 0xef, 0x06, 0xfc, 0x84, 0xd7, 0xa4, 0x05, 0x8e, 0xfe, 0x15, 0x50, 0xc7, 0x50, 0xe9,
+	0x92, 0xbc, 0x86, 0xba, 0x46, 0x35, 0x11, 0x03, 0xd4, 0xd4, 0x35, 0x32, 0xda, 0x56, 0xc6, 0x69,
+	0x06, 0x5b, 0x29, 0x45, 0x16, 0x69, 0x43, 0x15, 0x95, 0x92, 0x8a, 0x56, 0xb3, 0xfd, 0x4d, 0xe0,
+	0x5f, 0xc1, 0xca, 0xd4, 0x07, 0x84, 0x80, 0x1b, 0x05, 0x17, 0x68, 0x55, 0x9a, 0x35, 0xe9, 0x40,
+	0x4d, 0x1b, 0xd6, 0x8a, 0xb3, 0x51, 0x2a, 0x2b, 0x16, 0xdc, 0xc8, 0x72, 0x59, 0xba, 0x4c, 0xbf,
+	0x4e, 0xc4, 0x05, 0x52, 0xb7, 0x5b, 0xe9, 0x39, 0xcc, 0xac, 0xef, 0xd8, 0x98, 0x42, 0xc7, 0xf8,
+	0x8a, 0x11, 0x17, 0xd1, 0xf0, 0xa7, 0x54, 0xa3, 0xdc, 0xf1, 0xf7, 0xb0, 0x31, 0xc7, 0x58, 0xe3,
+	0x9f, 0x81, 0x7b, 0x25, 0xd5, 0xc8, 0x1a, 0xbf, 0x64, 0x3b, 0x36, 0x29, 0x86, 0xf0, 0xff, 0x56,
+	0xc0, 0x4d, 0xc3, 0x87, 0xb6, 0xbb, 0x0d, 0xd5, 0xb4, 0xe7, 0xac, 0xb1, 0x06, 0xcb, 0x02, 0xb2,
+	0x05, 0x0d, 0x85, 0x22, 0xd2, 0x49, 0x10, 0x86, 0xa6, 0xbb, 0x3a, 0xbb, 0x01, 0x88, 0x07, 0x75,
+	0x79, 0x96, 0xda, 0x8f, 0x9c, 0xd6, 0x8c, 0x1f, 0x45, 0xec, 0x7f, 0x81, 0x26, 0xc3, 0x09, 0x2a,
+	0x71, 0x7e, 0x6d, 0xdb, 0xbe, 0x97, 0x62, 0xff, 0x33, 0xb4, 0x6e, 0xea, 0x59, 0xb3, 0xde, 0xc1,
+	0x8a, 0x41, 0xc4, 0x20, 0x48, 0x84, 0x8c, 0xf2, 0x71, 0x5d, 0xb3, 0xae, 0xfd, 0x28, 0x71, 0x6c,
+	0x3a, 0xd3, 0x0f, 0x60, 0xb9, 0x4c, 0xdf, 0xcf, 0xcd, 0xe2, 0xfc, 0x9d, 0xf2, 0xf9, 0x7f, 0x83,
+	0xf5, 0x43, 0xa9, 0x06, 0xc8, 0x72, 0xbf, 0x1e, 0xc4, 0x07, 0x0a, 0x9d, 0xd9, 0xaa, 0x99, 0x1b,
+	0xfe, 0x3a, 0xac, 0x31, 0x0c, 0x65, 0xc0, 0x3f, 0xca, 0xe8, 0x5c, 0x0c, 0xf3, 0x61, 0xfb, 0x0d,
+	0xed, 0x69, 0xd8, 0x9a, 0xb7, 0x09, 0x8d, 0x50, 0x0e, 0xfb, 0x21, 0x4e, 0x30, 0xb4, 0x42, 0xea,
+	0xa1, 0x1c, 0x1e, 0xa7, 0x31, 0xa1, 0xb0, 0x18, 0xc4, 0x71, 0x28, 0x90, 0xd3, 0x85, 0xae, 0xd3,
+	0x6b, 0xb0, 0x3c, 0x24, 0x2f, 0xa1, 0xa5, 0xf0, 0x72, 0x2c, 0x14, 0xea, 0xbe, 0x42, 0x9d, 0x04,
+	0x2a, 0xa1, 0x8e, 0x49, 0x69, 0xe6, 0x38, 0xcb, 0x60, 0xff, 0x15, 0x90, 0x53, 0x4c, 0x8e, 0x6d,
+	0xcd, 0xbc, 0xfb, 0x36, 0x54, 0xcb, 0x7b, 0x66, 0x81, 0xcf, 0x60, 0x6d, 0x2a, 0xd7, 0x8a, 0x7c,
+	0x01, 0xab, 0xb1, 0xc2, 0x89, 0x90, 0x63, 0x3d, 0xa5, 0x74, 0x25, 0x47, 0x33, 0xb9, 0x45, 0xcd,
+	0x85, 0x52, 0xcd, 0xfd, 0x7f, 0x0e, 0x2c, 0x9e, 0xec, 0x7f, 0x48, 0x67, 0x81, 0x1c, 0x40, 0x3d,
+	0x7f, 0xe4, 0x48, 0xc7, 0xce, 0xc7, 0xcc, 0x43, 0xe8, 0x6d, 0xcc, 0xe1, 0xd6, 0xd9, 0x47, 0x84,
+	0x41, 0x73, 0xe6, 0xc6, 0x92, 0xed, 0x72, 0xf6, 0xdc, 0x1d, 0xf7, 0x9e, 0xde, 0x45, 0x17, 0x35,
+	0x0f, 0xa0, 0x9e, 0x4f, 0x74, 0x21, 0x69, 0xe6, 0xca, 0x78, 0x1b, 0x73, 0x78, 0xf1, 0xf9, 0x57,
+	0x58, 0x9d, 0x1e, 0x04, 0xb2, 0x65, 0x93, 0x6f, 0x9d, 0x3a, 0x6f, 0xfb, 0x0e, 0xb6, 0x28, 0x78,
+	0x04, 0xcb, 0xe5, 0x41, 0x21, 0x5e, 0xb1, 0xf7, 0xdc, 0x50, 0x79, 0x9b, 0xb7, 0x72, 0x45, 0xa9,
+	0x43, 0x58, 0x2a, 0x9d, 0x26, 0x79, 0x52, 0x3c, 0xdc, 0xb3, 0xd3, 0xe0, 0x79, 0xb7, 0x51, 0x79,
+	0x9d, 0xb3, 0x9a, 0xf9, 0x77, 0xbd, 0xf9, 0x3f, 0x00, 0x8b, 0x13, 0x11, 0x62, 0xe0, 0x06, 0x00,
+	0x00,
+}
@@ -0,0 +1,91 @@
+package labelstore
+
+import (
+	"crypto/x509"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Authorizer decides whether the client making a request may read or write
+// labels of a label type. Returned errors are sent to the client, so they
+// should be grpc errors.
+type Authorizer interface {
+	Authorize(ctx context.Context, labelType labels.Type) error
+}
+
+type allowAll struct{}
+
+// AllowAll returns an Authorizer that authorizes every request
+func AllowAll() Authorizer {
+	return allowAll{}
+}
+
+func (allowAll) Authorize(context.Context, labels.Type) error {
+	return nil
+}
+
+// CNAuthorizer authorizes clients by the common name of the certificate they
+// presented, mapping each common name to the label types it may access.
+// Clients that connected without a verified certificate are never authorized,
+// so the server must be configured to require client certificates.
+type CNAuthorizer map[string][]labels.Type
+
+var _ Authorizer = CNAuthorizer{}
+
+// NewCNAuthorizer builds a CNAuthorizer from a map of common names to label
+// type names, as read from a config file.
+func NewCNAuthorizer(policy map[string][]string) (CNAuthorizer, error) {
+	authorizer := make(CNAuthorizer, len(policy))
+	for cn, typeNames := range policy {
+		types := make([]labels.Type, 0, len(typeNames))
+		for _, typeName := range typeNames {
+			labelType, err := labels.AsType(typeName)
+			if err != nil {
+				return nil, util.Errorf("invalid label type for %s: %s", cn, err)
+			}
+			types = append(types, labelType)
+		}
+		authorizer[cn] = types
+	}
+	return authorizer, nil
+}
+
+func (a CNAuthorizer) Authorize(ctx context.Context, labelType labels.Type) error {
+	cert, err := clientCertificate(ctx)
+	if err != nil {
+		return grpc.Errorf(codes.Unauthenticated, "%s", err)
+	}
+
+	cn := cert.Subject.CommonName
+	for _, allowed := range a[cn] {
+		if allowed == labelType {
+			return nil
+		}
+	}
+	return grpc.Errorf(codes.PermissionDenied, "%s is not authorized to access %s labels", cn, labelType)
+}
+
+// clientCertificate returns the verified certificate the client presented
+// when establishing the connection the request arrived on
+func clientCertificate(ctx context.Context) (*x509.Certificate, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, util.Errorf("no peer information for request")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, util.Errorf("request was not made over TLS")
+	}
+	chains := tlsInfo.State.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil, util.Errorf("no verified client certificate")
+	}
+	return chains[0][0], nil
+}
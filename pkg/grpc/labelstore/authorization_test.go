@@ -0,0 +1,78 @@
+package labelstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	label_protos "github.com/square/p2/pkg/grpc/labelstore/protos"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func contextWithClientCN(cn string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{cert}},
+			},
+		},
+	})
+}
+
+func TestCNAuthorizer(t *testing.T) {
+	authorizer, err := NewCNAuthorizer(map[string][]string{
+		"node-labeler": {"node"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building authorizer: %s", err)
+	}
+	server := NewAuthorizedServer(labels.NewFakeApplicator(), authorizer, logging.DefaultLogger)
+
+	req := &label_protos.SetLabelRequest{
+		LabelType: label_protos.LabelType_node,
+		Id:        "node1",
+		Name:      "color",
+		Value:     "red",
+	}
+	_, err = server.SetLabel(contextWithClientCN("node-labeler"), req)
+	if err != nil {
+		t.Errorf("expected node-labeler to be allowed to set node labels, got %s", err)
+	}
+
+	_, err = server.SetLabel(contextWithClientCN("someone-else"), req)
+	if grpc.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected %s for an unknown client, got %s", codes.PermissionDenied, err)
+	}
+
+	req.LabelType = label_protos.LabelType_pod
+	_, err = server.SetLabel(contextWithClientCN("node-labeler"), req)
+	if grpc.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected %s for a label type the client may not access, got %s", codes.PermissionDenied, err)
+	}
+
+	_, err = server.GetLabels(context.Background(), &label_protos.GetLabelsRequest{
+		LabelType: label_protos.LabelType_node,
+		Id:        "node1",
+	})
+	if grpc.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected %s for a client without a certificate, got %s", codes.Unauthenticated, err)
+	}
+}
+
+func TestNewCNAuthorizerRejectsInvalidLabelTypes(t *testing.T) {
+	_, err := NewCNAuthorizer(map[string][]string{
+		"node-labeler": {"not_a_type"},
+	})
+	if err == nil {
+		t.Error("expected an error for an invalid label type")
+	}
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	label_protos "github.com/square/p2/pkg/grpc/labelstore/protos"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util/param"
+
+	"github.com/Sirupsen/logrus"
+	"google.golang.org/grpc"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+var (
+	// CacheResyncSec is how often a caching client replaces each cached
+	// match set with a fresh GetMatches call, in case the watch that keeps
+	// it up to date has missed something.
+	CacheResyncSec = param.Int("labelstore_cache_resync_sec", 300)
+
+	// CacheIdleSec is how long a cached match set is kept without being
+	// read before its watch is stopped. Idleness is checked when resyncing.
+	CacheIdleSec = param.Int("labelstore_cache_idle_sec", 600)
+)
+
+// NewCachingClient returns a Client that serves GetMatches and
+// GetCachedMatches from a local cache. The first read of a selector starts a
+// WatchMatches stream that keeps its cached match set up to date, so any
+// number of callers reading the same selector share one stream. Cached sets
+// are resynced every CacheResyncSec and dropped once they have been idle for
+// CacheIdleSec. All streams are stopped when quitCh is closed.
+func NewCachingClient(conn *grpc.ClientConn, logger logging.Logger, quitCh <-chan struct{}) Client {
+	return newCachingClient(label_protos.NewP2LabelStoreClient(conn), logger, quitCh)
+}
+
+func newCachingClient(labelStoreClient label_protos.P2LabelStoreClient, logger logging.Logger, quitCh <-chan struct{}) Client {
+	uncached := Client{
+		labelStoreClient: labelStoreClient,
+		logger:           logger,
+	}
+	return Client{
+		labelStoreClient: labelStoreClient,
+		logger:           logger,
+		cache: &matchCache{
+			client:  uncached,
+			logger:  logger,
+			quitCh:  quitCh,
+			entries: make(map[cacheKey]*cacheEntry),
+		},
+	}
+}
+
+type cacheKey struct {
+	labelType labels.Type
+	selector  string
+}
+
+type matchCache struct {
+	// client is used to watch and resync cached match sets. It does not
+	// have a cache itself.
+	client Client
+	logger logging.Logger
+	quitCh <-chan struct{}
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+type cacheEntry struct {
+	// ready is closed once the first match set has been stored
+	ready chan struct{}
+	// done is closed once the entry is no longer being kept up to date
+	done chan struct{}
+
+	mu       sync.Mutex
+	matches  []labels.Labeled
+	lastRead time.Time
+}
+
+// getMatches returns the cached match set for the selector, starting a watch
+// for it if there isn't one. If the watch ends before a match set is
+// received, the server is asked directly.
+func (m *matchCache) getMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error) {
+	entry := m.entry(selector, labelType)
+	select {
+	case <-entry.ready:
+		return entry.get(), nil
+	case <-entry.done:
+		return m.client.GetMatches(selector, labelType)
+	}
+}
+
+func (m *matchCache) entry(selector klabels.Selector, labelType labels.Type) *cacheEntry {
+	key := cacheKey{labelType: labelType, selector: selector.String()}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &cacheEntry{
+			ready:    make(chan struct{}),
+			done:     make(chan struct{}),
+			lastRead: time.Now(),
+		}
+		m.entries[key] = entry
+		go m.maintain(key, selector, entry)
+	}
+	return entry
+}
+
+func (m *matchCache) remove(key cacheKey, entry *cacheEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries[key] == entry {
+		delete(m.entries, key)
+	}
+}
+
+// maintain keeps entry up to date until the cache is closed, the entry goes
+// idle or its watch fails, after which the entry is removed so that the next
+// read starts over.
+func (m *matchCache) maintain(key cacheKey, selector klabels.Selector, entry *cacheEntry) {
+	defer close(entry.done)
+	defer m.remove(key, entry)
+
+	logger := m.logger.SubLogger(logrus.Fields{
+		"label_type": key.labelType,
+		"selector":   key.selector,
+	})
+
+	watchQuitCh := make(chan struct{})
+	defer close(watchQuitCh)
+	matchCh, err := m.client.WatchMatches(selector, key.labelType, 0, watchQuitCh)
+	if err != nil {
+		logger.WithError(err).Errorln("label store client: could not start watch for cached matches")
+		return
+	}
+
+	resync := time.NewTicker(time.Duration(*CacheResyncSec) * time.Second)
+	defer resync.Stop()
+	for {
+		select {
+		case <-m.quitCh:
+			return
+		case matches, ok := <-matchCh:
+			if !ok {
+				logger.NoFields().Warnln("label store client: watch for cached matches ended")
+				return
+			}
+			entry.set(matches)
+		case <-resync.C:
+			if entry.idleFor() > time.Duration(*CacheIdleSec)*time.Second {
+				logger.NoFields().Infoln("label store client: dropping idle cached matches")
+				return
+			}
+
+			matches, err := m.client.GetMatches(selector, key.labelType)
+			if err != nil {
+				logger.WithError(err).Warnln("label store client: could not resync cached matches")
+				continue
+			}
+			entry.set(matches)
+		}
+	}
+}
+
+func (e *cacheEntry) set(matches []labels.Labeled) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	first := e.matches == nil
+	if matches == nil {
+		// distinguish an empty match set from not having one yet
+		matches = []labels.Labeled{}
+	}
+	e.matches = matches
+	if first {
+		close(e.ready)
+	}
+}
+
+// get returns a copy of the cached match set. The labels of each match are
+// shared with the cache and must not be modified.
+func (e *cacheEntry) get() []labels.Labeled {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastRead = time.Now()
+	ret := make([]labels.Labeled, len(e.matches))
+	copy(ret, e.matches)
+	return ret
+}
+
+func (e *cacheEntry) idleFor() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Since(e.lastRead)
+}
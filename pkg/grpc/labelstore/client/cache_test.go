@@ -0,0 +1,60 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	label_protos "github.com/square/p2/pkg/grpc/labelstore/protos"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+func TestCachingClientSharesOneWatch(t *testing.T) {
+	fake := &fakeLabelStoreClient{
+		streams: [][]streamEvent{
+			{{resp: snapshot("a", "b")}},
+		},
+	}
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	c := newCachingClient(fake, logging.DefaultLogger, quitCh)
+
+	selector := klabels.Everything().Add("color", klabels.EqualsOperator, []string{"red"})
+	for i := 0; i < 3; i++ {
+		matches, err := c.GetMatches(selector, labels.POD)
+		if err != nil {
+			t.Fatalf("unexpected error getting matches: %s", err)
+		}
+		if len(matches) != 2 {
+			t.Errorf("expected two cached matches, got %v", matches)
+		}
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.watchCalls != 1 {
+		t.Errorf("expected all reads to share one watch, but %d were started", fake.watchCalls)
+	}
+}
+
+func TestCachingClientFallsBackWhenWatchFails(t *testing.T) {
+	fake := &fakeLabelStoreClient{
+		watchErr: errors.New("unavailable"),
+		getMatches: []*label_protos.Labeled{
+			{LabelType: label_protos.LabelType_pod, Id: "a"},
+		},
+	}
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	c := newCachingClient(fake, logging.DefaultLogger, quitCh)
+
+	matches, err := c.GetMatches(klabels.Everything(), labels.POD)
+	if err != nil {
+		t.Fatalf("unexpected error getting matches: %s", err)
+	}
+	if len(matches) != 1 || matches[0].ID != "a" {
+		t.Errorf("expected matches from the server, got %v", matches)
+	}
+}
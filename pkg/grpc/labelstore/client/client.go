@@ -11,15 +11,57 @@ import (
 	label_protos "github.com/square/p2/pkg/grpc/labelstore/protos"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+	"github.com/square/p2/pkg/util/randseed"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	klabels "k8s.io/kubernetes/pkg/labels"
 )
 
+var (
+	// WatchRetryMillis is the base time to wait before re-establishing a
+	// broken WatchMatches stream. Consecutive failures back off
+	// exponentially from it, with jitter.
+	WatchRetryMillis = param.Int("labelstore_watch_retry_millis", 2000)
+
+	// WatchMaxRetryMillis is the longest time to wait between attempts to
+	// re-establish a WatchMatches stream.
+	WatchMaxRetryMillis = param.Int("labelstore_watch_max_retry_millis", 60000)
+
+	// WatchMaxRetries is the number of failed attempts to re-establish a
+	// broken WatchMatches stream after which the watch gives up and closes
+	// its output channel. 0 means retry forever.
+	WatchMaxRetries = param.Int("labelstore_watch_max_retries", 0)
+)
+
+// WatchStatus reports whether the matches sent by a watch are current. A
+// status is sent each time the stream fails, and once more when it is
+// re-established.
+type WatchStatus struct {
+	// Healthy is false from the time the stream breaks until a response is
+	// received on a new one. Matches sent in the meantime may be stale.
+	Healthy bool
+
+	// Err is the error that broke the stream or that prevented it from being
+	// re-established
+	Err error
+
+	// Failures is the number of consecutive failures so far
+	Failures int
+
+	// GaveUp is true if WatchMaxRetries was reached, in which case the
+	// output channel will be closed
+	GaveUp bool
+}
+
 type Client struct {
 	labelStoreClient label_protos.P2LabelStoreClient
 	logger           logging.Logger
+
+	// Set by NewCachingClient
+	cache *matchCache
 }
 
 func NewClient(conn *grpc.ClientConn, logger logging.Logger) Client {
@@ -29,23 +71,187 @@ func NewClient(conn *grpc.ClientConn, logger logging.Logger) Client {
 	}
 }
 
-// this interface is just to make the compiler assert that our functions match
-// those in the direct consul applicator
-type client interface {
-	WatchMatches(selector klabels.Selector, labelType labels.Type, _ time.Duration, quitCh <-chan struct{}) (chan []labels.Labeled, error)
+// assert that the client can be used in place of the consul applicator
+var _ labels.Applicator = Client{}
+var _ labels.BatchApplicator = Client{}
+var _ labels.HistoryReader = Client{}
+
+func (c Client) SetLabel(labelType labels.Type, id, name, value string) error {
+	_, err := c.labelStoreClient.SetLabel(context.Background(), &label_protos.SetLabelRequest{
+		LabelType: labelTypeToProtoLabelType(labelType),
+		Id:        id,
+		Name:      name,
+		Value:     value,
+	})
+	return err
+}
+
+func (c Client) SetLabels(labelType labels.Type, id string, labelSet map[string]string) error {
+	_, err := c.labelStoreClient.SetLabels(context.Background(), &label_protos.SetLabelsRequest{
+		LabelType: labelTypeToProtoLabelType(labelType),
+		Id:        id,
+		Labels:    labelSet,
+	})
+	return err
+}
+
+func (c Client) RemoveLabel(labelType labels.Type, id, name string) error {
+	_, err := c.labelStoreClient.RemoveLabel(context.Background(), &label_protos.RemoveLabelRequest{
+		LabelType: labelTypeToProtoLabelType(labelType),
+		Id:        id,
+		Name:      name,
+	})
+	return err
+}
+
+func (c Client) RemoveAllLabels(labelType labels.Type, id string) error {
+	_, err := c.labelStoreClient.RemoveAllLabels(context.Background(), &label_protos.RemoveAllLabelsRequest{
+		LabelType: labelTypeToProtoLabelType(labelType),
+		Id:        id,
+	})
+	return err
+}
+
+func (c Client) ListLabels(labelType labels.Type) ([]labels.Labeled, error) {
+	resp, err := c.labelStoreClient.ListLabels(context.Background(), &label_protos.ListLabelsRequest{
+		LabelType: labelTypeToProtoLabelType(labelType),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return protoLabeledSliceToLabeled(resp.Labeled)
+}
+
+func (c Client) GetLabels(labelType labels.Type, id string) (labels.Labeled, error) {
+	resp, err := c.labelStoreClient.GetLabels(context.Background(), &label_protos.GetLabelsRequest{
+		LabelType: labelTypeToProtoLabelType(labelType),
+		Id:        id,
+	})
+	if err != nil {
+		return labels.Labeled{}, err
+	}
+
+	return protoLabeledToLabeled(resp.Labeled)
+}
+
+// GetMatches returns the labeled objects that match the selector. If the
+// client was created by NewCachingClient, the matches are read from the cache.
+func (c Client) GetMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error) {
+	if c.cache != nil {
+		return c.cache.getMatches(selector, labelType)
+	}
+
+	resp, err := c.labelStoreClient.GetMatches(context.Background(), &label_protos.GetMatchesRequest{
+		LabelType: labelTypeToProtoLabelType(labelType),
+		Selector:  selector.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return protoLabeledSliceToLabeled(resp.Labeled)
 }
 
-// assert that the labels applicator functions match the ones exposed here
-var _ client = labels.Applicator(nil)
-var _ client = Client{}
+// BatchApply applies the mutations atomically. It returns an error with code
+// Aborted if one of the objects was changed concurrently, in which case the
+// batch can be retried.
+func (c Client) BatchApply(mutations []labels.Mutation) error {
+	req := &label_protos.BatchApplyRequest{}
+	for _, mutation := range mutations {
+		req.Mutations = append(req.Mutations, &label_protos.LabelMutation{
+			LabelType: labelTypeToProtoLabelType(mutation.LabelType),
+			Id:        mutation.ID,
+			RemoveAll: mutation.RemoveAll,
+			Remove:    mutation.Remove,
+			Set:       mutation.Set,
+		})
+	}
+
+	_, err := c.labelStoreClient.BatchApply(context.Background(), req)
+	return err
+}
+
+// GetLabelHistory returns the recent changes to an object's labels, oldest
+// first
+func (c Client) GetLabelHistory(labelType labels.Type, id string) ([]labels.HistoryEntry, error) {
+	resp, err := c.labelStoreClient.GetLabelHistory(context.Background(), &label_protos.GetLabelHistoryRequest{
+		LabelType: labelTypeToProtoLabelType(labelType),
+		Id:        id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]labels.HistoryEntry, 0, len(resp.Entries))
+	for _, entry := range resp.Entries {
+		timestamp, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+		if err != nil {
+			return nil, util.Errorf("invalid timestamp in label history: %s", err)
+		}
+		history = append(history, labels.HistoryEntry{
+			Time:  timestamp,
+			Actor: entry.Actor,
+			Old:   entry.OldLabels,
+			New:   entry.NewLabels,
+		})
+	}
+	return history, nil
+}
+
+// ValidateSelector asks the server to check a selector before it is used, for
+// example in a replication controller or pod cluster. Problems with the
+// selector are reported in the response rather than as an error.
+func (c Client) ValidateSelector(selector string, labelType labels.Type) (*label_protos.ValidateSelectorResponse, error) {
+	return c.labelStoreClient.ValidateSelector(context.Background(), &label_protos.ValidateSelectorRequest{
+		LabelType: labelTypeToProtoLabelType(labelType),
+		Selector:  selector,
+	})
+}
+
+// GetCachedMatches is the same as GetMatches. aggregationRate is unused
+// because caching is up to the server, or to the client's own cache if it was
+// created by NewCachingClient
+func (c Client) GetCachedMatches(selector klabels.Selector, labelType labels.Type, _ time.Duration) ([]labels.Labeled, error) {
+	return c.GetMatches(selector, labelType)
+}
+
+// WatchMatchDiff diffs consecutive results of WatchMatches(). If the initial
+// gRPC call fails, the output channel is closed without any changes being
+// sent.
+func (c Client) WatchMatchDiff(selector klabels.Selector, labelType labels.Type, aggregationRate time.Duration, quitCh <-chan struct{}) <-chan *labels.LabeledChanges {
+	inCh, err := c.WatchMatches(selector, labelType, aggregationRate, quitCh)
+	if err != nil {
+		c.logger.WithError(err).Errorln("label store client: could not start WatchMatches() for WatchMatchDiff()")
+		outCh := make(chan *labels.LabeledChanges)
+		close(outCh)
+		return outCh
+	}
+	return labels.WatchDiffLabels(inCh, quitCh, c.logger)
+}
 
 // WatchMatches uses streaming gRPC to subscribe to updates to a label selector
 // and passes each update on the output channel. Returns an error if the
 // initial gRPC call fails. Any further connection breakages will attempt to be
-// re-established in a loop.
+// re-established, see WatchMatchesWithStatus.
+//
+// The watch is run in incremental mode, so the server only sends what changed
+// between updates. The full matched set is reassembled here, so each value
+// sent on the output channel is the complete set as before.
 //
 // aggregationRate is unused because aggregation is handled by the server
 func (c Client) WatchMatches(selector klabels.Selector, labelType labels.Type, _ time.Duration, quitCh <-chan struct{}) (chan []labels.Labeled, error) {
+	return c.WatchMatchesWithStatus(selector, labelType, quitCh, nil)
+}
+
+// WatchMatchesWithStatus is like WatchMatches, but also reports the health of
+// the watch on statusCh if it is not nil. The caller must keep reading from
+// statusCh until quitCh is closed or the output channel is closed.
+//
+// When the stream breaks it is re-established with exponential backoff and
+// jitter, starting from WatchRetryMillis. If WatchMaxRetries attempts in a
+// row fail, the output channel is closed.
+func (c Client) WatchMatchesWithStatus(selector klabels.Selector, labelType labels.Type, quitCh <-chan struct{}, statusCh chan<- WatchStatus) (chan []labels.Labeled, error) {
 	ctx, cancelFunc := context.WithCancel(context.Background())
 
 	go func() {
@@ -56,10 +262,12 @@ func (c Client) WatchMatches(selector klabels.Selector, labelType labels.Type, _
 		cancelFunc()
 	}()
 
-	watchClient, err := c.labelStoreClient.WatchMatches(ctx, &label_protos.WatchMatchesRequest{
-		LabelType: labelTypeToProtoLabelType(labelType),
-		Selector:  selector.String(),
-	})
+	req := &label_protos.WatchMatchesRequest{
+		LabelType:   labelTypeToProtoLabelType(labelType),
+		Selector:    selector.String(),
+		Incremental: true,
+	}
+	watchClient, err := c.labelStoreClient.WatchMatches(ctx, req)
 	if err != nil {
 		cancelFunc()
 		return nil, err
@@ -68,62 +276,123 @@ func (c Client) WatchMatches(selector klabels.Selector, labelType labels.Type, _
 	outCh := make(chan []labels.Labeled)
 	go func() {
 		defer close(outCh)
+		// The first response on a new stream is a snapshot that
+		// replaces whatever was assembled from the last one
+		matches := newMatchSet()
+		prng := randseed.NewRand()
+		failures := 0
 		for {
 			labeled, err := watchClient.Recv()
-			if grpc.Code(err) == codes.Canceled {
-				c.logger.Infoln("label store client: terminating WatchMatches()")
-				// This just means quitCh fired and the RPC was canceled as expected
-				return
-			}
-
-			if err != nil {
-				c.logger.WithError(err).Errorln("unexpected error reading from WatchMatches stream, starting another RPC")
+			for err != nil {
+				if grpc.Code(err) == codes.Canceled {
+					c.logger.Infoln("label store client: terminating WatchMatches()")
+					// This just means quitCh fired and the RPC was canceled as expected
+					return
+				}
 
-				watchClient = nil
+				failures++
+				if *WatchMaxRetries > 0 && failures > *WatchMaxRetries {
+					c.logger.WithError(err).Errorf("label store client: giving up on WatchMatches after %d failures", failures)
+					c.sendStatus(statusCh, WatchStatus{Err: err, Failures: failures, GaveUp: true}, quitCh)
+					return
+				}
+				c.logger.WithError(err).Errorln("unexpected error from WatchMatches stream, starting another RPC")
+				c.sendStatus(statusCh, WatchStatus{Err: err, Failures: failures}, quitCh)
 
-				for watchClient == nil {
+				select {
+				case <-time.After(reconnectDelay(failures, prng.Int63n)):
+				case <-ctx.Done():
+					return
+				}
 
-					time.Sleep(2 * time.Second)
-					watchClient, err = c.labelStoreClient.WatchMatches(ctx, &label_protos.WatchMatchesRequest{
-						LabelType: labelTypeToProtoLabelType(labelType),
-						Selector:  selector.String(),
-					}, grpc.FailFast(false))
-					if err != nil {
-						c.logger.WithError(err).Errorln("could not restart WatchMatches RPC, will retry")
-					}
+				watchClient, err = c.labelStoreClient.WatchMatches(ctx, req, grpc.FailFast(false))
+				if err == nil {
+					labeled, err = watchClient.Recv()
 				}
-				continue
 			}
 
-			c.sendOnChannel(outCh, labeled, quitCh)
+			if failures > 0 {
+				c.logger.Infof("label store client: WatchMatches stream re-established after %d failures", failures)
+				failures = 0
+				c.sendStatus(statusCh, WatchStatus{Healthy: true}, quitCh)
+			}
+
+			c.sendOnChannel(outCh, matches, labeled, quitCh)
 		}
 	}()
 
 	return outCh, nil
 }
 
+// reconnectDelay returns how long to wait before the next attempt to
+// re-establish a stream after the given number of consecutive failures. The
+// delay doubles with each failure up to WatchMaxRetryMillis, and a uniformly
+// random fraction of it is used so that clients which lost their streams at
+// the same time don't reconnect together.
+func reconnectDelay(failures int, int63n func(int64) int64) time.Duration {
+	delay := time.Duration(*WatchRetryMillis) * time.Millisecond
+	maxDelay := time.Duration(*WatchMaxRetryMillis) * time.Millisecond
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay = delay * 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(int63n(int64(delay)))
+}
+
+func (c Client) sendStatus(statusCh chan<- WatchStatus, status WatchStatus, quitCh <-chan struct{}) {
+	if statusCh == nil {
+		return
+	}
+
+	select {
+	case statusCh <- status:
+	case <-quitCh:
+	}
+}
+
 // Converts a labels.LabelType to the proto label type.
 func labelTypeToProtoLabelType(labelType labels.Type) label_protos.LabelType {
 	return label_protos.LabelType(label_protos.LabelType_value[labelType.String()])
 }
 
-func (c Client) sendOnChannel(outCh chan<- []labels.Labeled, serverResp *label_protos.WatchMatchesResponse, quitCh <-chan struct{}) {
+func protoLabeledToLabeled(protoLabeled *label_protos.Labeled) (labels.Labeled, error) {
+	labelType, err := labels.AsType(protoLabeled.GetLabelType().String())
+	if err != nil {
+		return labels.Labeled{}, err
+	}
+
+	return labels.Labeled{
+		LabelType: labelType,
+		Labels:    protoLabeled.GetLabels(),
+		ID:        protoLabeled.GetId(),
+	}, nil
+}
+
+func protoLabeledSliceToLabeled(protoLabeled []*label_protos.Labeled) ([]labels.Labeled, error) {
 	// need to cast from []*label_protos.Labeled to []labels.Labeled
-	ret := make([]labels.Labeled, len(serverResp.Labeled))
-	for i, match := range serverResp.Labeled {
-		labelType, err := labels.AsType(match.LabelType.String())
+	ret := make([]labels.Labeled, len(protoLabeled))
+	for i, match := range protoLabeled {
+		labeled, err := protoLabeledToLabeled(match)
 		if err != nil {
-			// It's potentially really dangerous to omit matches, so we're just going to throw out the whole
-			// response. Theoretically this should be impossible
-			c.logger.WithError(err).Errorf("Unrecognized label type %s", match.LabelType.String())
-			return
+			return nil, err
 		}
+		ret[i] = labeled
+	}
+	return ret, nil
+}
 
-		ret[i] = labels.Labeled{
-			LabelType: labelType,
-			Labels:    match.Labels,
-			ID:        match.Id,
-		}
+func (c Client) sendOnChannel(outCh chan<- []labels.Labeled, matches *matchSet, serverResp *label_protos.WatchMatchesResponse, quitCh <-chan struct{}) {
+	ret, err := matches.apply(serverResp)
+	if err != nil {
+		// It's potentially really dangerous to omit matches, so we're just going to throw out the whole
+		// response. Theoretically this should be impossible
+		c.logger.WithError(err).Errorln("Unrecognized label type in WatchMatches response")
+		return
 	}
 
 	select {
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	label_protos "github.com/square/p2/pkg/grpc/labelstore/protos"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+type streamEvent struct {
+	resp *label_protos.WatchMatchesResponse
+	err  error
+}
+
+// fakeStream replays its events and then blocks until its context is
+// canceled
+type fakeStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	events []streamEvent
+}
+
+func (s *fakeStream) Recv() (*label_protos.WatchMatchesResponse, error) {
+	if len(s.events) == 0 {
+		<-s.ctx.Done()
+		return nil, grpc.Errorf(codes.Canceled, "canceled")
+	}
+	event := s.events[0]
+	s.events = s.events[1:]
+	return event.resp, event.err
+}
+
+// fakeLabelStoreClient returns one stream per WatchMatches call, in order,
+// and answers GetMatches with getMatches
+type fakeLabelStoreClient struct {
+	label_protos.P2LabelStoreClient
+
+	mu         sync.Mutex
+	streams    [][]streamEvent
+	watchErr   error
+	watchCalls int
+	getMatches []*label_protos.Labeled
+}
+
+func (c *fakeLabelStoreClient) GetMatches(context.Context, *label_protos.GetMatchesRequest, ...grpc.CallOption) (*label_protos.GetMatchesResponse, error) {
+	return &label_protos.GetMatchesResponse{Labeled: c.getMatches}, nil
+}
+
+func (c *fakeLabelStoreClient) WatchMatches(ctx context.Context, _ *label_protos.WatchMatchesRequest, _ ...grpc.CallOption) (label_protos.P2LabelStore_WatchMatchesClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.watchCalls++
+	if c.watchErr != nil {
+		return nil, c.watchErr
+	}
+
+	var events []streamEvent
+	if len(c.streams) > 0 {
+		events = c.streams[0]
+		c.streams = c.streams[1:]
+	}
+	return &fakeStream{ctx: ctx, events: events}, nil
+}
+
+func setFastRetries(maxRetries int) func() {
+	oldRetry, oldMaxRetry, oldMaxRetries := *WatchRetryMillis, *WatchMaxRetryMillis, *WatchMaxRetries
+	*WatchRetryMillis = 1
+	*WatchMaxRetryMillis = 2
+	*WatchMaxRetries = maxRetries
+	return func() {
+		*WatchRetryMillis, *WatchMaxRetryMillis, *WatchMaxRetries = oldRetry, oldMaxRetry, oldMaxRetries
+	}
+}
+
+func snapshot(ids ...string) *label_protos.WatchMatchesResponse {
+	resp := &label_protos.WatchMatchesResponse{Incremental: true, Snapshot: true}
+	for _, id := range ids {
+		resp.Labeled = append(resp.Labeled, &label_protos.Labeled{LabelType: label_protos.LabelType_pod, Id: id})
+	}
+	return resp
+}
+
+func receiveStatus(t *testing.T, statusCh <-chan WatchStatus) WatchStatus {
+	select {
+	case status := <-statusCh:
+		return status
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a watch status")
+	}
+	return WatchStatus{}
+}
+
+func receiveMatches(t *testing.T, outCh <-chan []labels.Labeled) []labels.Labeled {
+	select {
+	case matches := <-outCh:
+		return matches
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for matches")
+	}
+	return nil
+}
+
+func TestWatchMatchesReportsRecovery(t *testing.T) {
+	defer setFastRetries(0)()
+
+	streamErr := errors.New("connection reset")
+	fake := &fakeLabelStoreClient{
+		streams: [][]streamEvent{
+			{{resp: snapshot("a")}, {err: streamErr}},
+			{{err: streamErr}},
+			{{resp: snapshot("a", "b")}},
+		},
+	}
+	c := Client{labelStoreClient: fake, logger: logging.DefaultLogger}
+
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	statusCh := make(chan WatchStatus)
+	outCh, err := c.WatchMatchesWithStatus(klabels.Everything(), labels.POD, quitCh, statusCh)
+	if err != nil {
+		t.Fatalf("unexpected error starting watch: %s", err)
+	}
+
+	if matches := receiveMatches(t, outCh); len(matches) != 1 {
+		t.Errorf("expected one match from the first stream, got %v", matches)
+	}
+
+	for i := 1; i <= 2; i++ {
+		status := receiveStatus(t, statusCh)
+		if status.Healthy || status.Err != streamErr || status.Failures != i {
+			t.Errorf("expected unhealthy status with %d failures, got %+v", i, status)
+		}
+	}
+
+	if status := receiveStatus(t, statusCh); !status.Healthy {
+		t.Errorf("expected the watch to report that it recovered, got %+v", status)
+	}
+	if matches := receiveMatches(t, outCh); len(matches) != 2 {
+		t.Errorf("expected two matches from the new stream, got %v", matches)
+	}
+}
+
+func TestWatchMatchesGivesUpAfterMaxRetries(t *testing.T) {
+	defer setFastRetries(2)()
+
+	streamErr := errors.New("connection reset")
+	fake := &fakeLabelStoreClient{
+		streams: [][]streamEvent{
+			{{err: streamErr}},
+			{{err: streamErr}},
+			{{err: streamErr}},
+		},
+	}
+	c := Client{labelStoreClient: fake, logger: logging.DefaultLogger}
+
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	statusCh := make(chan WatchStatus)
+	outCh, err := c.WatchMatchesWithStatus(klabels.Everything(), labels.POD, quitCh, statusCh)
+	if err != nil {
+		t.Fatalf("unexpected error starting watch: %s", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if status := receiveStatus(t, statusCh); status.GaveUp || status.Failures != i {
+			t.Errorf("expected a retry after %d failures, got %+v", i, status)
+		}
+	}
+	if status := receiveStatus(t, statusCh); !status.GaveUp || status.Failures != 3 {
+		t.Errorf("expected the watch to give up after 3 failures, got %+v", status)
+	}
+
+	select {
+	case _, ok := <-outCh:
+		if ok {
+			t.Error("expected the output channel to be closed without further matches")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the output channel to be closed")
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	defer setFastRetries(0)()
+	*WatchRetryMillis = 100
+	*WatchMaxRetryMillis = 1000
+
+	max := func(n int64) int64 { return n - 1 }
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, ms := range expected {
+		delay := reconnectDelay(i+1, max)
+		if delay != ms*time.Millisecond-1 {
+			t.Errorf("expected at most %s after %d failures, got %s", ms*time.Millisecond, i+1, delay)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"sort"
+
+	label_protos "github.com/square/p2/pkg/grpc/labelstore/protos"
+	"github.com/square/p2/pkg/labels"
+)
+
+// matchSet reassembles the full matched set of a WatchMatches() stream from
+// the snapshot and deltas sent by a server in incremental mode
+type matchSet struct {
+	matches map[string]labels.Labeled
+}
+
+func newMatchSet() *matchSet {
+	return &matchSet{
+		matches: make(map[string]labels.Labeled),
+	}
+}
+
+// apply updates the set with a response from the server and returns the full
+// set, ordered by ID. Responses from servers that don't support incremental
+// mode always contain the full set. If an error is returned the set is left
+// unchanged.
+func (m *matchSet) apply(resp *label_protos.WatchMatchesResponse) ([]labels.Labeled, error) {
+	if !resp.Incremental || resp.Snapshot {
+		full, err := protoLabeledSliceToLabeled(resp.Labeled)
+		if err != nil {
+			return nil, err
+		}
+
+		m.matches = make(map[string]labels.Labeled, len(full))
+		for _, labeled := range full {
+			m.matches[labeled.ID] = labeled
+		}
+		return m.sorted(), nil
+	}
+
+	added, err := protoLabeledSliceToLabeled(resp.Added)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := protoLabeledSliceToLabeled(resp.Changed)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, labeled := range added {
+		m.matches[labeled.ID] = labeled
+	}
+	for _, labeled := range changed {
+		m.matches[labeled.ID] = labeled
+	}
+	for _, removed := range resp.Removed {
+		delete(m.matches, removed.GetId())
+	}
+	return m.sorted(), nil
+}
+
+func (m *matchSet) sorted() []labels.Labeled {
+	ret := make([]labels.Labeled, 0, len(m.matches))
+	for _, labeled := range m.matches {
+		ret = append(ret, labeled)
+	}
+	sort.Sort(labeledByID(ret))
+	return ret
+}
+
+type labeledByID []labels.Labeled
+
+func (l labeledByID) Len() int           { return len(l) }
+func (l labeledByID) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l labeledByID) Less(i, j int) bool { return l[i].ID < l[j].ID }
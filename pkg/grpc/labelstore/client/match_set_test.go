@@ -0,0 +1,74 @@
+package client
+
+import (
+	"testing"
+
+	label_protos "github.com/square/p2/pkg/grpc/labelstore/protos"
+)
+
+func TestMatchSetApply(t *testing.T) {
+	matches := newMatchSet()
+
+	full, err := matches.apply(&label_protos.WatchMatchesResponse{
+		Incremental: true,
+		Snapshot:    true,
+		Labeled: []*label_protos.Labeled{
+			{LabelType: label_protos.LabelType_pod, Id: "b", Labels: map[string]string{"color": "red"}},
+			{LabelType: label_protos.LabelType_pod, Id: "a", Labels: map[string]string{"color": "red"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error applying snapshot: %s", err)
+	}
+	if len(full) != 2 || full[0].ID != "a" || full[1].ID != "b" {
+		t.Fatalf("expected the snapshot to be returned ordered by ID, got %+v", full)
+	}
+
+	full, err = matches.apply(&label_protos.WatchMatchesResponse{
+		Incremental: true,
+		Added: []*label_protos.Labeled{
+			{LabelType: label_protos.LabelType_pod, Id: "c", Labels: map[string]string{"color": "red"}},
+		},
+		Changed: []*label_protos.Labeled{
+			{LabelType: label_protos.LabelType_pod, Id: "b", Labels: map[string]string{"color": "red", "size": "large"}},
+		},
+		Removed: []*label_protos.Labeled{
+			{LabelType: label_protos.LabelType_pod, Id: "a"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error applying deltas: %s", err)
+	}
+	if len(full) != 2 || full[0].ID != "b" || full[1].ID != "c" {
+		t.Fatalf("expected b and c to be matched, got %+v", full)
+	}
+	if full[0].Labels["size"] != "large" {
+		t.Errorf("expected the labels of b to be updated, got %v", full[0].Labels)
+	}
+
+	// servers that don't support incremental mode send the full set every time
+	full, err = matches.apply(&label_protos.WatchMatchesResponse{
+		Labeled: []*label_protos.Labeled{
+			{LabelType: label_protos.LabelType_pod, Id: "d", Labels: map[string]string{"color": "red"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error applying full set: %s", err)
+	}
+	if len(full) != 1 || full[0].ID != "d" {
+		t.Fatalf("expected a full set to replace the matches, got %+v", full)
+	}
+
+	_, err = matches.apply(&label_protos.WatchMatchesResponse{
+		Incremental: true,
+		Added: []*label_protos.Labeled{
+			{LabelType: label_protos.LabelType_unknown, Id: "e"},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error for an unknown label type")
+	}
+	if len(matches.sorted()) != 1 {
+		t.Errorf("expected a bad response to leave the matches alone, got %+v", matches.sorted())
+	}
+}
@@ -1,12 +1,16 @@
 package labelstore
 
 import (
+	"fmt"
+	"sort"
 	"time"
 
 	label_protos "github.com/square/p2/pkg/grpc/labelstore/protos"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/transaction"
 
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	klabels "k8s.io/kubernetes/pkg/labels"
@@ -16,25 +20,69 @@ type MatchWatcher interface {
 	WatchMatches(selector klabels.Selector, labelType labels.Type, aggregationRate time.Duration, quitCh <-chan struct{}) (chan []labels.Labeled, error)
 }
 
+// Store is the subset of labels.Applicator served over gRPC
+type Store interface {
+	MatchWatcher
+	SetLabel(labelType labels.Type, id, name, value string) error
+	SetLabels(labelType labels.Type, id string, labelSet map[string]string) error
+	RemoveLabel(labelType labels.Type, id, name string) error
+	RemoveAllLabels(labelType labels.Type, id string) error
+	ListLabels(labelType labels.Type) ([]labels.Labeled, error)
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+	GetMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error)
+	labels.BatchApplicator
+	labels.HistoryReader
+}
+
+// ActorStore is implemented by stores that can attribute the changes they
+// make to someone else in label history. When the store is one, changes are
+// attributed to the common name of the client's certificate.
+type ActorStore interface {
+	WithActor(actor string) labels.Mutator
+}
+
 type labelStore struct {
-	matchWatcher MatchWatcher
-	logger       logging.Logger
+	store      Store
+	authorizer Authorizer
+	logger     logging.Logger
+	// answers GetMatches() for the label types it has indexed, may be nil
+	index *labels.Index
 }
 
 var _ label_protos.P2LabelStoreServer = &labelStore{}
 
-func NewServer(matchWatcher MatchWatcher, logger logging.Logger) label_protos.P2LabelStoreServer {
+// NewServer returns a server that lets every client access every label type
+func NewServer(store Store, logger logging.Logger) label_protos.P2LabelStoreServer {
+	return NewAuthorizedServer(store, allowAll{}, logger)
+}
+
+// NewAuthorizedServer returns a server that checks each request against
+// authorizer before accessing the label type it names
+func NewAuthorizedServer(store Store, authorizer Authorizer, logger logging.Logger) label_protos.P2LabelStoreServer {
+	return NewIndexedServer(store, nil, authorizer, logger)
+}
+
+// NewIndexedServer returns a server like NewAuthorizedServer that answers
+// GetMatches requests from index whenever it has indexed the label type,
+// which is much faster for equality selectors over large label types but
+// lags behind writes. A nil index is never used.
+func NewIndexedServer(store Store, index *labels.Index, authorizer Authorizer, logger logging.Logger) label_protos.P2LabelStoreServer {
 	return labelStore{
-		matchWatcher: matchWatcher,
-		logger:       logger,
+		store:      store,
+		authorizer: authorizer,
+		logger:     logger,
+		index:      index,
 	}
 }
 
-// Streams responses back to the client until cancellation is received via stream.Context().Done()
+// Streams responses back to the client until cancellation is received via
+// stream.Context().Done(). If the request is incremental, the first response is
+// a snapshot of the matched set and later responses only contain the objects
+// that were added, changed or removed since the previous response.
 func (l labelStore) WatchMatches(req *label_protos.WatchMatchesRequest, stream label_protos.P2LabelStore_WatchMatchesServer) error {
-	labelType, err := labels.AsType(req.LabelType.String())
+	labelType, err := l.authorizedLabelType(stream.Context(), req.LabelType)
 	if err != nil {
-		return grpc.Errorf(codes.InvalidArgument, "Unrecognized label type %s", req.LabelType.String())
+		return err
 	}
 
 	selector, err := klabels.Parse(req.Selector)
@@ -44,9 +92,14 @@ func (l labelStore) WatchMatches(req *label_protos.WatchMatchesRequest, stream l
 
 	clientCancel := stream.Context().Done()
 
+	var incremental *incrementalResponder
+	if req.Incremental {
+		incremental = &incrementalResponder{}
+	}
+
 	quitCh := make(chan struct{})
 	defer close(quitCh)
-	matchCh, err := l.matchWatcher.WatchMatches(selector, labelType, labels.DefaultAggregationRate, quitCh)
+	matchCh, err := l.store.WatchMatches(selector, labelType, labels.DefaultAggregationRate, quitCh)
 	if err != nil {
 		return err
 	}
@@ -64,14 +117,22 @@ func (l labelStore) WatchMatches(req *label_protos.WatchMatchesRequest, stream l
 			return nil
 		case matches, ok := <-matchCh:
 			if ok {
-				err = stream.Send(getResponse(matches))
+				resp := getResponse(matches)
+				if incremental != nil {
+					resp = incremental.response(matches)
+					if resp == nil {
+						// nothing changed since the last response
+						continue
+					}
+				}
+				err = stream.Send(resp)
 				if err != nil {
 					return err
 				}
 			} else {
 				// WatchMatches() can terminate without the quit
 				// channel being signaled, just start again
-				matchCh, err = l.matchWatcher.WatchMatches(selector, labelType, labels.DefaultAggregationRate, quitCh)
+				matchCh, err = l.store.WatchMatches(selector, labelType, labels.DefaultAggregationRate, quitCh)
 				if err != nil {
 					return err
 				}
@@ -80,18 +141,374 @@ func (l labelStore) WatchMatches(req *label_protos.WatchMatchesRequest, stream l
 	}
 }
 
+func (l labelStore) SetLabel(ctx context.Context, req *label_protos.SetLabelRequest) (*label_protos.SetLabelResponse, error) {
+	labelType, err := l.authorizedLabelType(ctx, req.LabelType)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.mutator(ctx).SetLabel(labelType, req.Id, req.Name, req.Value)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not set label: %s", err)
+	}
+
+	return &label_protos.SetLabelResponse{}, nil
+}
+
+func (l labelStore) SetLabels(ctx context.Context, req *label_protos.SetLabelsRequest) (*label_protos.SetLabelsResponse, error) {
+	labelType, err := l.authorizedLabelType(ctx, req.LabelType)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.mutator(ctx).SetLabels(labelType, req.Id, req.Labels)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not set labels: %s", err)
+	}
+
+	return &label_protos.SetLabelsResponse{}, nil
+}
+
+func (l labelStore) RemoveLabel(ctx context.Context, req *label_protos.RemoveLabelRequest) (*label_protos.RemoveLabelResponse, error) {
+	labelType, err := l.authorizedLabelType(ctx, req.LabelType)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.mutator(ctx).RemoveLabel(labelType, req.Id, req.Name)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not remove label: %s", err)
+	}
+
+	return &label_protos.RemoveLabelResponse{}, nil
+}
+
+func (l labelStore) RemoveAllLabels(ctx context.Context, req *label_protos.RemoveAllLabelsRequest) (*label_protos.RemoveAllLabelsResponse, error) {
+	labelType, err := l.authorizedLabelType(ctx, req.LabelType)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.mutator(ctx).RemoveAllLabels(labelType, req.Id)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not remove labels: %s", err)
+	}
+
+	return &label_protos.RemoveAllLabelsResponse{}, nil
+}
+
+func (l labelStore) GetLabels(ctx context.Context, req *label_protos.GetLabelsRequest) (*label_protos.GetLabelsResponse, error) {
+	labelType, err := l.authorizedLabelType(ctx, req.LabelType)
+	if err != nil {
+		return nil, err
+	}
+
+	labeled, err := l.store.GetLabels(labelType, req.Id)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not get labels: %s", err)
+	}
+
+	return &label_protos.GetLabelsResponse{
+		Labeled: labeledToProtoLabeled(labeled),
+	}, nil
+}
+
+func (l labelStore) ListLabels(ctx context.Context, req *label_protos.ListLabelsRequest) (*label_protos.ListLabelsResponse, error) {
+	labelType, err := l.authorizedLabelType(ctx, req.LabelType)
+	if err != nil {
+		return nil, err
+	}
+
+	labeled, err := l.store.ListLabels(labelType)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not list labels: %s", err)
+	}
+
+	return &label_protos.ListLabelsResponse{
+		Labeled: labeledSliceToProto(labeled),
+	}, nil
+}
+
+func (l labelStore) GetMatches(ctx context.Context, req *label_protos.GetMatchesRequest) (*label_protos.GetMatchesResponse, error) {
+	labelType, err := l.authorizedLabelType(ctx, req.LabelType)
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := klabels.Parse(req.Selector)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "Invalid label selector %s", req.Selector)
+	}
+
+	if l.index != nil {
+		if matches, ok := l.index.GetMatches(selector, labelType); ok {
+			return &label_protos.GetMatchesResponse{
+				Labeled: labeledSliceToProto(matches),
+			}, nil
+		}
+	}
+
+	matches, err := l.store.GetMatches(selector, labelType)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not get matches: %s", err)
+	}
+
+	return &label_protos.GetMatchesResponse{
+		Labeled: labeledSliceToProto(matches),
+	}, nil
+}
+
+// BatchApply applies every mutation in the request or none of them. The client
+// must be authorized for the label type of each mutation.
+func (l labelStore) BatchApply(ctx context.Context, req *label_protos.BatchApplyRequest) (*label_protos.BatchApplyResponse, error) {
+	mutations := make([]labels.Mutation, 0, len(req.Mutations))
+	for _, protoMutation := range req.Mutations {
+		labelType, err := l.authorizedLabelType(ctx, protoMutation.LabelType)
+		if err != nil {
+			return nil, err
+		}
+
+		mutations = append(mutations, labels.Mutation{
+			LabelType: labelType,
+			ID:        protoMutation.Id,
+			RemoveAll: protoMutation.RemoveAll,
+			Remove:    protoMutation.Remove,
+			Set:       protoMutation.Set,
+		})
+	}
+
+	err := l.mutator(ctx).BatchApply(mutations)
+	if _, ok := err.(labels.CASError); ok {
+		// another client changed one of the objects, so this is safe to retry
+		return nil, grpc.Errorf(codes.Aborted, "could not apply labels: %s", err)
+	} else if err == transaction.ErrTooManyOperations {
+		return nil, grpc.Errorf(codes.InvalidArgument, "could not apply labels: %s", err)
+	} else if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not apply labels: %s", err)
+	}
+
+	return &label_protos.BatchApplyResponse{}, nil
+}
+
+// ValidateSelector parses a selector without running it and reports what is
+// likely wrong with it. Problems with the selector itself are returned in the
+// response rather than as an error so that clients can show all of them.
+func (l labelStore) ValidateSelector(ctx context.Context, req *label_protos.ValidateSelectorRequest) (*label_protos.ValidateSelectorResponse, error) {
+	labelType, err := l.authorizedLabelType(ctx, req.LabelType)
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := klabels.Parse(req.Selector)
+	if err != nil {
+		return &label_protos.ValidateSelectorResponse{
+			Errors: []*label_protos.SelectorProblem{{Message: err.Error()}},
+		}, nil
+	}
+
+	labeled, err := l.store.ListLabels(labelType)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not list labels: %s", err)
+	}
+
+	return &label_protos.ValidateSelectorResponse{
+		Valid:      true,
+		Normalized: selector.String(),
+		Warnings:   selectorWarnings(selector, labelType, labeled),
+	}, nil
+}
+
+// selectorWarnings returns the problems with a parsed selector that make it
+// likely to match nothing or far more than intended
+func selectorWarnings(selector klabels.Selector, labelType labels.Type, labeled []labels.Labeled) []*label_protos.SelectorProblem {
+	requirements, _ := selector.(klabels.LabelSelector)
+	if len(requirements) == 0 {
+		return []*label_protos.SelectorProblem{{
+			Message: fmt.Sprintf("selector is empty and matches every %s", labelType),
+		}}
+	}
+
+	knownKeys := make(map[string]bool)
+	for _, l := range labeled {
+		for key := range l.Labels {
+			knownKeys[key] = true
+		}
+	}
+
+	var warnings []*label_protos.SelectorProblem
+	requirementsPerKey := make(map[string]int)
+	positive := false
+	for _, requirement := range requirements {
+		key := requirement.Key()
+		requirementsPerKey[key]++
+		if requirementsPerKey[key] == 2 {
+			warnings = append(warnings, &label_protos.SelectorProblem{
+				Key:     key,
+				Message: fmt.Sprintf("%q has more than one requirement, all of which must hold", key),
+			})
+		}
+		if !knownKeys[key] {
+			warnings = append(warnings, &label_protos.SelectorProblem{
+				Key:     key,
+				Message: fmt.Sprintf("no %s has a %q label", labelType, key),
+			})
+		}
+
+		switch requirement.Operator() {
+		case klabels.NotEqualsOperator, klabels.NotInOperator, klabels.DoesNotExistOperator:
+		default:
+			positive = true
+		}
+	}
+
+	if !positive {
+		warnings = append(warnings, &label_protos.SelectorProblem{
+			Message: fmt.Sprintf("selector only has negative requirements, so it matches every %s that lacks the excluded labels", labelType),
+		})
+	}
+	return warnings
+}
+
+// GetLabelHistory returns the recent changes to an object's labels, oldest
+// first
+func (l labelStore) GetLabelHistory(ctx context.Context, req *label_protos.GetLabelHistoryRequest) (*label_protos.GetLabelHistoryResponse, error) {
+	labelType, err := l.authorizedLabelType(ctx, req.LabelType)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := l.store.GetLabelHistory(labelType, req.Id)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not get label history: %s", err)
+	}
+
+	resp := &label_protos.GetLabelHistoryResponse{}
+	for _, entry := range history {
+		resp.Entries = append(resp.Entries, &label_protos.LabelHistoryEntry{
+			Timestamp: entry.Time.Format(time.RFC3339Nano),
+			Actor:     entry.Actor,
+			OldLabels: entry.Old,
+			NewLabels: entry.New,
+		})
+	}
+	return resp, nil
+}
+
+// mutator returns what to make the changes requested by the client with
+func (l labelStore) mutator(ctx context.Context) labels.Mutator {
+	actorStore, ok := l.store.(ActorStore)
+	if !ok {
+		return l.store
+	}
+	cert, err := clientCertificate(ctx)
+	if err != nil {
+		// the server isn't using TLS, so the client is unknown
+		return l.store
+	}
+	return actorStore.WithActor(cert.Subject.CommonName)
+}
+
+// authorizedLabelType converts the label type of a request and checks that
+// the client may access it
+func (l labelStore) authorizedLabelType(ctx context.Context, protoLabelType label_protos.LabelType) (labels.Type, error) {
+	labelType, err := protoLabelTypeToLabelType(protoLabelType)
+	if err != nil {
+		return "", err
+	}
+
+	err = l.authorizer.Authorize(ctx, labelType)
+	if err != nil {
+		l.logger.WithError(err).Warnln("Rejected unauthorized labelstore request")
+		return "", err
+	}
+	return labelType, nil
+}
+
+func protoLabelTypeToLabelType(protoLabelType label_protos.LabelType) (labels.Type, error) {
+	labelType, err := labels.AsType(protoLabelType.String())
+	if err != nil {
+		return labels.Type(""), grpc.Errorf(codes.InvalidArgument, "Unrecognized label type %s", protoLabelType.String())
+	}
+	return labelType, nil
+}
+
 func getResponse(matches []labels.Labeled) *label_protos.WatchMatchesResponse {
+	return &label_protos.WatchMatchesResponse{
+		Labeled: labeledSliceToProto(matches),
+	}
+}
+
+// incrementalResponder tracks the matched set last sent to an incremental
+// WatchMatches() client. The state outlives restarts of the underlying watch
+// so that the client keeps receiving changes relative to what it has.
+type incrementalResponder struct {
+	// nil until the snapshot has been sent
+	sent map[string]labels.Labeled
+}
+
+// response returns the response to send for a new matched set, or nil if
+// nothing changed since the last one
+func (r *incrementalResponder) response(matches []labels.Labeled) *label_protos.WatchMatchesResponse {
+	current := make(map[string]labels.Labeled, len(matches))
+	for _, match := range matches {
+		current[match.ID] = match
+	}
+
+	if r.sent == nil {
+		r.sent = current
+		return &label_protos.WatchMatchesResponse{
+			Labeled:     labeledSliceToProto(matches),
+			Incremental: true,
+			Snapshot:    true,
+		}
+	}
+
+	resp := &label_protos.WatchMatchesResponse{
+		Incremental: true,
+	}
+	for _, match := range matches {
+		old, ok := r.sent[match.ID]
+		if !ok {
+			resp.Added = append(resp.Added, labeledToProtoLabeled(match))
+		} else if old.Labels.String() != match.Labels.String() {
+			resp.Changed = append(resp.Changed, labeledToProtoLabeled(match))
+		}
+	}
+
+	var removedIDs []string
+	for id := range r.sent {
+		if _, ok := current[id]; !ok {
+			removedIDs = append(removedIDs, id)
+		}
+	}
+	sort.Strings(removedIDs)
+	for _, id := range removedIDs {
+		resp.Removed = append(resp.Removed, labeledToProtoLabeled(labels.Labeled{
+			ID:        id,
+			LabelType: r.sent[id].LabelType,
+		}))
+	}
+
+	r.sent = current
+	if len(resp.Added) == 0 && len(resp.Changed) == 0 && len(resp.Removed) == 0 {
+		return nil
+	}
+	return resp
+}
+
+func labeledSliceToProto(matches []labels.Labeled) []*label_protos.Labeled {
 	// need to cast from []labels.Labeled to []*label_protos.Labeled
 	ret := make([]*label_protos.Labeled, len(matches))
 	for i, match := range matches {
-		ret[i] = &label_protos.Labeled{
-			LabelType: label_protos.LabelType(label_protos.LabelType_value[match.LabelType.String()]),
-			Id:        match.ID,
-			Labels:    map[string]string(match.Labels),
-		}
+		ret[i] = labeledToProtoLabeled(match)
 	}
+	return ret
+}
 
-	return &label_protos.WatchMatchesResponse{
-		Labeled: ret,
+func labeledToProtoLabeled(labeled labels.Labeled) *label_protos.Labeled {
+	return &label_protos.Labeled{
+		LabelType: label_protos.LabelType(label_protos.LabelType_value[labeled.LabelType.String()]),
+		Id:        labeled.ID,
+		Labels:    map[string]string(labeled.Labels),
 	}
 }
@@ -0,0 +1,331 @@
+package labelstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	label_protos "github.com/square/p2/pkg/grpc/labelstore/protos"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+func TestSetAndRemoveLabels(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	server := NewServer(applicator, logging.DefaultLogger)
+
+	_, err := server.SetLabels(context.Background(), &label_protos.SetLabelsRequest{
+		LabelType: label_protos.LabelType_node,
+		Id:        "node1",
+		Labels:    map[string]string{"color": "red", "size": "large"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error setting labels: %s", err)
+	}
+
+	_, err = server.SetLabel(context.Background(), &label_protos.SetLabelRequest{
+		LabelType: label_protos.LabelType_node,
+		Id:        "node1",
+		Name:      "shape",
+		Value:     "round",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error setting label: %s", err)
+	}
+
+	_, err = server.RemoveLabel(context.Background(), &label_protos.RemoveLabelRequest{
+		LabelType: label_protos.LabelType_node,
+		Id:        "node1",
+		Name:      "size",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error removing label: %s", err)
+	}
+
+	resp, err := server.GetLabels(context.Background(), &label_protos.GetLabelsRequest{
+		LabelType: label_protos.LabelType_node,
+		Id:        "node1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error getting labels: %s", err)
+	}
+	if resp.Labeled.Id != "node1" || resp.Labeled.LabelType != label_protos.LabelType_node {
+		t.Errorf("unexpected labeled %+v", resp.Labeled)
+	}
+	expected := map[string]string{"color": "red", "shape": "round"}
+	if len(resp.Labeled.Labels) != len(expected) {
+		t.Fatalf("expected labels %v but got %v", expected, resp.Labeled.Labels)
+	}
+	for k, v := range expected {
+		if resp.Labeled.Labels[k] != v {
+			t.Errorf("expected label %s to be %q but was %q", k, v, resp.Labeled.Labels[k])
+		}
+	}
+
+	matchesResp, err := server.GetMatches(context.Background(), &label_protos.GetMatchesRequest{
+		LabelType: label_protos.LabelType_node,
+		Selector:  "color=red",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error getting matches: %s", err)
+	}
+	if len(matchesResp.Labeled) != 1 || matchesResp.Labeled[0].Id != "node1" {
+		t.Errorf("expected node1 to match, got %+v", matchesResp.Labeled)
+	}
+
+	_, err = server.RemoveAllLabels(context.Background(), &label_protos.RemoveAllLabelsRequest{
+		LabelType: label_protos.LabelType_node,
+		Id:        "node1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error removing all labels: %s", err)
+	}
+
+	listResp, err := server.ListLabels(context.Background(), &label_protos.ListLabelsRequest{
+		LabelType: label_protos.LabelType_node,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error listing labels: %s", err)
+	}
+	for _, labeled := range listResp.Labeled {
+		if len(labeled.Labels) != 0 {
+			t.Errorf("expected all labels to be removed, but %s still has %v", labeled.Id, labeled.Labels)
+		}
+	}
+}
+
+func TestInvalidLabelType(t *testing.T) {
+	server := NewServer(labels.NewFakeApplicator(), logging.DefaultLogger)
+
+	_, err := server.SetLabel(context.Background(), &label_protos.SetLabelRequest{
+		LabelType: label_protos.LabelType_unknown,
+		Id:        "node1",
+		Name:      "color",
+		Value:     "red",
+	})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected %s for an unknown label type, got %s", codes.InvalidArgument, err)
+	}
+}
+
+func TestValidateSelector(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	err := applicator.SetLabels(labels.NODE, "node1", map[string]string{"color": "red", "size": "large"})
+	if err != nil {
+		t.Fatalf("test setup: could not set labels: %s", err)
+	}
+	server := NewServer(applicator, logging.DefaultLogger)
+
+	validate := func(selector string) *label_protos.ValidateSelectorResponse {
+		resp, err := server.ValidateSelector(context.Background(), &label_protos.ValidateSelectorRequest{
+			LabelType: label_protos.LabelType_node,
+			Selector:  selector,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error validating %q: %s", selector, err)
+		}
+		return resp
+	}
+
+	resp := validate("size = large, color in (red)")
+	if !resp.Valid || len(resp.Errors) != 0 || len(resp.Warnings) != 0 {
+		t.Errorf("expected a valid selector without problems, got %+v", resp)
+	}
+	if resp.Normalized != "color in (red),size=large" {
+		t.Errorf("expected the selector to be normalized, got %q", resp.Normalized)
+	}
+
+	resp = validate("color in (red")
+	if resp.Valid || len(resp.Errors) != 1 || resp.Normalized != "" {
+		t.Errorf("expected an invalid selector with one error, got %+v", resp)
+	}
+
+	tests := map[string][]string{
+		"":                     {""},
+		"colour=red":           {"colour"},
+		"color!=red":           {""},
+		"color=red,color=blue": {"color"},
+		"!shape":               {"shape", ""},
+	}
+	for selector, expectedKeys := range tests {
+		resp := validate(selector)
+		if !resp.Valid {
+			t.Errorf("expected %q to be valid, got %+v", selector, resp)
+			continue
+		}
+		if len(resp.Warnings) != len(expectedKeys) {
+			t.Errorf("expected %d warnings for %q, got %+v", len(expectedKeys), selector, resp.Warnings)
+			continue
+		}
+		for i, key := range expectedKeys {
+			if resp.Warnings[i].Key != key {
+				t.Errorf("expected warning %d for %q to be about %q, got %+v", i, selector, key, resp.Warnings[i])
+			}
+		}
+	}
+}
+
+func TestBatchApply(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	err := applicator.SetLabels(labels.RC, "rc1", map[string]string{"old": "yes"})
+	if err != nil {
+		t.Fatalf("test setup: could not set labels: %s", err)
+	}
+	server := NewServer(applicator, logging.DefaultLogger)
+
+	_, err = server.BatchApply(context.Background(), &label_protos.BatchApplyRequest{
+		Mutations: []*label_protos.LabelMutation{
+			{LabelType: label_protos.LabelType_node, Id: "node1", Set: map[string]string{"cluster": "a"}},
+			{LabelType: label_protos.LabelType_replication_controller, Id: "rc1", RemoveAll: true, Set: map[string]string{"cluster": "a"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error applying labels: %s", err)
+	}
+
+	for _, labelType := range []labels.Type{labels.NODE, labels.RC} {
+		matches, err := applicator.GetMatches(klabels.Everything().Add("cluster", klabels.EqualsOperator, []string{"a"}), labelType)
+		if err != nil {
+			t.Fatalf("unexpected error getting matches: %s", err)
+		}
+		if len(matches) != 1 || len(matches[0].Labels) != 1 {
+			t.Errorf("expected one %s with only the cluster label, got %+v", labelType, matches)
+		}
+	}
+
+	_, err = server.BatchApply(context.Background(), &label_protos.BatchApplyRequest{
+		Mutations: []*label_protos.LabelMutation{
+			{LabelType: label_protos.LabelType_node, Id: "node2", Set: map[string]string{"cluster": "a"}},
+			{LabelType: label_protos.LabelType_unknown, Id: "node2", Set: map[string]string{"cluster": "a"}},
+		},
+	})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected %s for an unknown label type, got %s", codes.InvalidArgument, err)
+	}
+	labeled, err := applicator.GetLabels(labels.NODE, "node2")
+	if err != nil {
+		t.Fatalf("unexpected error getting labels: %s", err)
+	}
+	if len(labeled.Labels) != 0 {
+		t.Errorf("expected none of a rejected batch to be applied, got %v", labeled.Labels)
+	}
+}
+
+func TestGetLabelHistory(t *testing.T) {
+	server := NewServer(labels.NewFakeApplicator(), logging.DefaultLogger)
+	for _, color := range []string{"red", "blue"} {
+		_, err := server.SetLabel(context.Background(), &label_protos.SetLabelRequest{
+			LabelType: label_protos.LabelType_node,
+			Id:        "node1",
+			Name:      "color",
+			Value:     color,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error setting label: %s", err)
+		}
+	}
+
+	resp, err := server.GetLabelHistory(context.Background(), &label_protos.GetLabelHistoryRequest{
+		LabelType: label_protos.LabelType_node,
+		Id:        "node1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error getting label history: %s", err)
+	}
+	if len(resp.Entries) != 2 {
+		t.Fatalf("expected two history entries, got %+v", resp.Entries)
+	}
+	last := resp.Entries[1]
+	if last.OldLabels["color"] != "red" || last.NewLabels["color"] != "blue" {
+		t.Errorf("expected the last entry to change color from red to blue, got %+v", last)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, last.Timestamp); err != nil {
+		t.Errorf("expected an RFC3339 timestamp, got %q: %s", last.Timestamp, err)
+	}
+	if last.Actor == "" {
+		t.Error("expected the entry to have an actor")
+	}
+}
+
+func TestIndexedGetMatches(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	err := applicator.SetLabel(labels.NODE, "node1", "color", "red")
+	if err != nil {
+		t.Fatalf("test setup: could not set labels: %s", err)
+	}
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	index := labels.NewIndex(applicator, []labels.Type{labels.NODE}, time.Millisecond, logging.DefaultLogger, quitCh)
+	server := NewIndexedServer(applicator, index, AllowAll(), logging.DefaultLogger)
+
+	selector := klabels.Everything().Add("color", klabels.EqualsOperator, []string{"red"})
+	timeout := time.After(5 * time.Second)
+	for {
+		if _, ok := index.GetMatches(selector, labels.NODE); ok {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatal("timed out waiting for the index")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	resp, err := server.GetMatches(context.Background(), &label_protos.GetMatchesRequest{
+		LabelType: label_protos.LabelType_node,
+		Selector:  selector.String(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error getting matches: %s", err)
+	}
+	if len(resp.Labeled) != 1 || resp.Labeled[0].Id != "node1" {
+		t.Errorf("expected node1 to match, got %+v", resp.Labeled)
+	}
+}
+
+func TestIncrementalWatchResponses(t *testing.T) {
+	responder := &incrementalResponder{}
+
+	resp := responder.response([]labels.Labeled{
+		{LabelType: labels.POD, ID: "a", Labels: klabels.Set{"color": "red"}},
+		{LabelType: labels.POD, ID: "b", Labels: klabels.Set{"color": "red"}},
+	})
+	if resp == nil || !resp.Incremental || !resp.Snapshot {
+		t.Fatalf("expected the first response to be a snapshot, got %+v", resp)
+	}
+	if len(resp.Labeled) != 2 {
+		t.Errorf("expected the snapshot to contain both matches, got %+v", resp.Labeled)
+	}
+
+	resp = responder.response([]labels.Labeled{
+		{LabelType: labels.POD, ID: "a", Labels: klabels.Set{"color": "red"}},
+		{LabelType: labels.POD, ID: "b", Labels: klabels.Set{"color": "red"}},
+	})
+	if resp != nil {
+		t.Errorf("expected no response when nothing changed, got %+v", resp)
+	}
+
+	resp = responder.response([]labels.Labeled{
+		{LabelType: labels.POD, ID: "b", Labels: klabels.Set{"color": "red", "size": "large"}},
+		{LabelType: labels.POD, ID: "c", Labels: klabels.Set{"color": "red"}},
+	})
+	if resp == nil {
+		t.Fatal("expected a response with changes")
+	}
+	if !resp.Incremental || resp.Snapshot || len(resp.Labeled) != 0 {
+		t.Errorf("expected a delta response, got %+v", resp)
+	}
+	if len(resp.Added) != 1 || resp.Added[0].Id != "c" {
+		t.Errorf("expected c to be added, got %+v", resp.Added)
+	}
+	if len(resp.Changed) != 1 || resp.Changed[0].Id != "b" || resp.Changed[0].Labels["size"] != "large" {
+		t.Errorf("expected b to be changed, got %+v", resp.Changed)
+	}
+	if len(resp.Removed) != 1 || resp.Removed[0].Id != "a" || resp.Removed[0].LabelType != label_protos.LabelType_pod {
+		t.Errorf("expected a to be removed, got %+v", resp.Removed)
+	}
+}
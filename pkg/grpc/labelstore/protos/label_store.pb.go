@@ -6,12 +6,37 @@
 Package label_store_protos is a generated protocol buffer package.
 
 It is generated from these files:
+
 	pkg/grpc/labelstore/protos/label_store.proto
 
 It has these top-level messages:
+
 	WatchMatchesRequest
 	Labeled
 	WatchMatchesResponse
+	SetLabelRequest
+	SetLabelResponse
+	SetLabelsRequest
+	SetLabelsResponse
+	RemoveLabelRequest
+	RemoveLabelResponse
+	RemoveAllLabelsRequest
+	RemoveAllLabelsResponse
+	GetLabelsRequest
+	GetLabelsResponse
+	ListLabelsRequest
+	ListLabelsResponse
+	GetMatchesRequest
+	GetMatchesResponse
+	ValidateSelectorRequest
+	SelectorProblem
+	ValidateSelectorResponse
+	LabelMutation
+	BatchApplyRequest
+	BatchApplyResponse
+	GetLabelHistoryRequest
+	LabelHistoryEntry
+	GetLabelHistoryResponse
 */
 package label_store_protos
 
@@ -71,6 +96,9 @@ func (LabelType) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []in
 type WatchMatchesRequest struct {
 	Selector  string    `protobuf:"bytes,1,opt,name=selector" json:"selector,omitempty"`
 	LabelType LabelType `protobuf:"varint,2,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+	// If set, the server sends the full matched set once and then only the
+	// changes to it
+	Incremental bool `protobuf:"varint,3,opt,name=incremental" json:"incremental,omitempty"`
 }
 
 func (m *WatchMatchesRequest) Reset()                    { *m = WatchMatchesRequest{} }
@@ -92,6 +120,13 @@ func (m *WatchMatchesRequest) GetLabelType() LabelType {
 	return LabelType_unknown
 }
 
+func (m *WatchMatchesRequest) GetIncremental() bool {
+	if m != nil {
+		return m.Incremental
+	}
+	return false
+}
+
 type Labeled struct {
 	LabelType LabelType         `protobuf:"varint,1,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
 	Id        string            `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
@@ -125,7 +160,17 @@ func (m *Labeled) GetLabels() map[string]string {
 }
 
 type WatchMatchesResponse struct {
+	// The full matched set. In incremental mode this is only set on the
+	// snapshot response
 	Labeled []*Labeled `protobuf:"bytes,1,rep,name=labeled" json:"labeled,omitempty"`
+	// Set on every response of a watch the server is running in incremental
+	// mode. Servers that don't support incremental mode always send full sets
+	Incremental bool       `protobuf:"varint,2,opt,name=incremental" json:"incremental,omitempty"`
+	Snapshot    bool       `protobuf:"varint,3,opt,name=snapshot" json:"snapshot,omitempty"`
+	Added       []*Labeled `protobuf:"bytes,4,rep,name=added" json:"added,omitempty"`
+	Changed     []*Labeled `protobuf:"bytes,5,rep,name=changed" json:"changed,omitempty"`
+	// Only the label type and ID of removed objects are set
+	Removed []*Labeled `protobuf:"bytes,6,rep,name=removed" json:"removed,omitempty"`
 }
 
 func (m *WatchMatchesResponse) Reset()                    { *m = WatchMatchesResponse{} }
@@ -140,10 +185,587 @@ func (m *WatchMatchesResponse) GetLabeled() []*Labeled {
 	return nil
 }
 
+func (m *WatchMatchesResponse) GetIncremental() bool {
+	if m != nil {
+		return m.Incremental
+	}
+	return false
+}
+
+func (m *WatchMatchesResponse) GetSnapshot() bool {
+	if m != nil {
+		return m.Snapshot
+	}
+	return false
+}
+
+func (m *WatchMatchesResponse) GetAdded() []*Labeled {
+	if m != nil {
+		return m.Added
+	}
+	return nil
+}
+
+func (m *WatchMatchesResponse) GetChanged() []*Labeled {
+	if m != nil {
+		return m.Changed
+	}
+	return nil
+}
+
+func (m *WatchMatchesResponse) GetRemoved() []*Labeled {
+	if m != nil {
+		return m.Removed
+	}
+	return nil
+}
+
+type SetLabelRequest struct {
+	LabelType LabelType `protobuf:"varint,1,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+	Id        string    `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	Name      string    `protobuf:"bytes,3,opt,name=name" json:"name,omitempty"`
+	Value     string    `protobuf:"bytes,4,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *SetLabelRequest) Reset()                    { *m = SetLabelRequest{} }
+func (m *SetLabelRequest) String() string            { return proto.CompactTextString(m) }
+func (*SetLabelRequest) ProtoMessage()               {}
+func (*SetLabelRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *SetLabelRequest) GetLabelType() LabelType {
+	if m != nil {
+		return m.LabelType
+	}
+	return LabelType_unknown
+}
+
+func (m *SetLabelRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *SetLabelRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *SetLabelRequest) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+type SetLabelResponse struct {
+}
+
+func (m *SetLabelResponse) Reset()                    { *m = SetLabelResponse{} }
+func (m *SetLabelResponse) String() string            { return proto.CompactTextString(m) }
+func (*SetLabelResponse) ProtoMessage()               {}
+func (*SetLabelResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+type SetLabelsRequest struct {
+	LabelType LabelType         `protobuf:"varint,1,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+	Id        string            `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	Labels    map[string]string `protobuf:"bytes,3,rep,name=labels" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *SetLabelsRequest) Reset()                    { *m = SetLabelsRequest{} }
+func (m *SetLabelsRequest) String() string            { return proto.CompactTextString(m) }
+func (*SetLabelsRequest) ProtoMessage()               {}
+func (*SetLabelsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *SetLabelsRequest) GetLabelType() LabelType {
+	if m != nil {
+		return m.LabelType
+	}
+	return LabelType_unknown
+}
+
+func (m *SetLabelsRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *SetLabelsRequest) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+type SetLabelsResponse struct {
+}
+
+func (m *SetLabelsResponse) Reset()                    { *m = SetLabelsResponse{} }
+func (m *SetLabelsResponse) String() string            { return proto.CompactTextString(m) }
+func (*SetLabelsResponse) ProtoMessage()               {}
+func (*SetLabelsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+type RemoveLabelRequest struct {
+	LabelType LabelType `protobuf:"varint,1,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+	Id        string    `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	Name      string    `protobuf:"bytes,3,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *RemoveLabelRequest) Reset()                    { *m = RemoveLabelRequest{} }
+func (m *RemoveLabelRequest) String() string            { return proto.CompactTextString(m) }
+func (*RemoveLabelRequest) ProtoMessage()               {}
+func (*RemoveLabelRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *RemoveLabelRequest) GetLabelType() LabelType {
+	if m != nil {
+		return m.LabelType
+	}
+	return LabelType_unknown
+}
+
+func (m *RemoveLabelRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *RemoveLabelRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type RemoveLabelResponse struct {
+}
+
+func (m *RemoveLabelResponse) Reset()                    { *m = RemoveLabelResponse{} }
+func (m *RemoveLabelResponse) String() string            { return proto.CompactTextString(m) }
+func (*RemoveLabelResponse) ProtoMessage()               {}
+func (*RemoveLabelResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+type RemoveAllLabelsRequest struct {
+	LabelType LabelType `protobuf:"varint,1,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+	Id        string    `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *RemoveAllLabelsRequest) Reset()                    { *m = RemoveAllLabelsRequest{} }
+func (m *RemoveAllLabelsRequest) String() string            { return proto.CompactTextString(m) }
+func (*RemoveAllLabelsRequest) ProtoMessage()               {}
+func (*RemoveAllLabelsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *RemoveAllLabelsRequest) GetLabelType() LabelType {
+	if m != nil {
+		return m.LabelType
+	}
+	return LabelType_unknown
+}
+
+func (m *RemoveAllLabelsRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type RemoveAllLabelsResponse struct {
+}
+
+func (m *RemoveAllLabelsResponse) Reset()                    { *m = RemoveAllLabelsResponse{} }
+func (m *RemoveAllLabelsResponse) String() string            { return proto.CompactTextString(m) }
+func (*RemoveAllLabelsResponse) ProtoMessage()               {}
+func (*RemoveAllLabelsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+type GetLabelsRequest struct {
+	LabelType LabelType `protobuf:"varint,1,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+	Id        string    `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *GetLabelsRequest) Reset()                    { *m = GetLabelsRequest{} }
+func (m *GetLabelsRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetLabelsRequest) ProtoMessage()               {}
+func (*GetLabelsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *GetLabelsRequest) GetLabelType() LabelType {
+	if m != nil {
+		return m.LabelType
+	}
+	return LabelType_unknown
+}
+
+func (m *GetLabelsRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type GetLabelsResponse struct {
+	Labeled *Labeled `protobuf:"bytes,1,opt,name=labeled" json:"labeled,omitempty"`
+}
+
+func (m *GetLabelsResponse) Reset()                    { *m = GetLabelsResponse{} }
+func (m *GetLabelsResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetLabelsResponse) ProtoMessage()               {}
+func (*GetLabelsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *GetLabelsResponse) GetLabeled() *Labeled {
+	if m != nil {
+		return m.Labeled
+	}
+	return nil
+}
+
+type ListLabelsRequest struct {
+	LabelType LabelType `protobuf:"varint,1,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+}
+
+func (m *ListLabelsRequest) Reset()                    { *m = ListLabelsRequest{} }
+func (m *ListLabelsRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListLabelsRequest) ProtoMessage()               {}
+func (*ListLabelsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *ListLabelsRequest) GetLabelType() LabelType {
+	if m != nil {
+		return m.LabelType
+	}
+	return LabelType_unknown
+}
+
+type ListLabelsResponse struct {
+	Labeled []*Labeled `protobuf:"bytes,1,rep,name=labeled" json:"labeled,omitempty"`
+}
+
+func (m *ListLabelsResponse) Reset()                    { *m = ListLabelsResponse{} }
+func (m *ListLabelsResponse) String() string            { return proto.CompactTextString(m) }
+func (*ListLabelsResponse) ProtoMessage()               {}
+func (*ListLabelsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *ListLabelsResponse) GetLabeled() []*Labeled {
+	if m != nil {
+		return m.Labeled
+	}
+	return nil
+}
+
+type GetMatchesRequest struct {
+	Selector  string    `protobuf:"bytes,1,opt,name=selector" json:"selector,omitempty"`
+	LabelType LabelType `protobuf:"varint,2,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+}
+
+func (m *GetMatchesRequest) Reset()                    { *m = GetMatchesRequest{} }
+func (m *GetMatchesRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetMatchesRequest) ProtoMessage()               {}
+func (*GetMatchesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *GetMatchesRequest) GetSelector() string {
+	if m != nil {
+		return m.Selector
+	}
+	return ""
+}
+
+func (m *GetMatchesRequest) GetLabelType() LabelType {
+	if m != nil {
+		return m.LabelType
+	}
+	return LabelType_unknown
+}
+
+type GetMatchesResponse struct {
+	Labeled []*Labeled `protobuf:"bytes,1,rep,name=labeled" json:"labeled,omitempty"`
+}
+
+func (m *GetMatchesResponse) Reset()                    { *m = GetMatchesResponse{} }
+func (m *GetMatchesResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetMatchesResponse) ProtoMessage()               {}
+func (*GetMatchesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+func (m *GetMatchesResponse) GetLabeled() []*Labeled {
+	if m != nil {
+		return m.Labeled
+	}
+	return nil
+}
+
+type ValidateSelectorRequest struct {
+	Selector  string    `protobuf:"bytes,1,opt,name=selector" json:"selector,omitempty"`
+	LabelType LabelType `protobuf:"varint,2,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+}
+
+func (m *ValidateSelectorRequest) Reset()                    { *m = ValidateSelectorRequest{} }
+func (m *ValidateSelectorRequest) String() string            { return proto.CompactTextString(m) }
+func (*ValidateSelectorRequest) ProtoMessage()               {}
+func (*ValidateSelectorRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+
+func (m *ValidateSelectorRequest) GetSelector() string {
+	if m != nil {
+		return m.Selector
+	}
+	return ""
+}
+
+func (m *ValidateSelectorRequest) GetLabelType() LabelType {
+	if m != nil {
+		return m.LabelType
+	}
+	return LabelType_unknown
+}
+
+type SelectorProblem struct {
+	// The label key the problem is about. Empty if it is about the whole
+	// selector
+	Key     string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Message string `protobuf:"bytes,2,opt,name=message" json:"message,omitempty"`
+}
+
+func (m *SelectorProblem) Reset()                    { *m = SelectorProblem{} }
+func (m *SelectorProblem) String() string            { return proto.CompactTextString(m) }
+func (*SelectorProblem) ProtoMessage()               {}
+func (*SelectorProblem) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
+
+func (m *SelectorProblem) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *SelectorProblem) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+type ValidateSelectorResponse struct {
+	// Set if the selector parses. A valid selector can still have warnings
+	Valid bool `protobuf:"varint,1,opt,name=valid" json:"valid,omitempty"`
+	// The canonical form of a valid selector, with requirements sorted by key
+	Normalized string             `protobuf:"bytes,2,opt,name=normalized" json:"normalized,omitempty"`
+	Errors     []*SelectorProblem `protobuf:"bytes,3,rep,name=errors" json:"errors,omitempty"`
+	Warnings   []*SelectorProblem `protobuf:"bytes,4,rep,name=warnings" json:"warnings,omitempty"`
+}
+
+func (m *ValidateSelectorResponse) Reset()                    { *m = ValidateSelectorResponse{} }
+func (m *ValidateSelectorResponse) String() string            { return proto.CompactTextString(m) }
+func (*ValidateSelectorResponse) ProtoMessage()               {}
+func (*ValidateSelectorResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
+
+func (m *ValidateSelectorResponse) GetValid() bool {
+	if m != nil {
+		return m.Valid
+	}
+	return false
+}
+
+func (m *ValidateSelectorResponse) GetNormalized() string {
+	if m != nil {
+		return m.Normalized
+	}
+	return ""
+}
+
+func (m *ValidateSelectorResponse) GetErrors() []*SelectorProblem {
+	if m != nil {
+		return m.Errors
+	}
+	return nil
+}
+
+func (m *ValidateSelectorResponse) GetWarnings() []*SelectorProblem {
+	if m != nil {
+		return m.Warnings
+	}
+	return nil
+}
+
+type LabelMutation struct {
+	LabelType LabelType `protobuf:"varint,1,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+	Id        string    `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	// Applied first, then remove, then set
+	RemoveAll bool              `protobuf:"varint,3,opt,name=remove_all,json=removeAll" json:"remove_all,omitempty"`
+	Remove    []string          `protobuf:"bytes,4,rep,name=remove" json:"remove,omitempty"`
+	Set       map[string]string `protobuf:"bytes,5,rep,name=set" json:"set,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *LabelMutation) Reset()                    { *m = LabelMutation{} }
+func (m *LabelMutation) String() string            { return proto.CompactTextString(m) }
+func (*LabelMutation) ProtoMessage()               {}
+func (*LabelMutation) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{20} }
+
+func (m *LabelMutation) GetLabelType() LabelType {
+	if m != nil {
+		return m.LabelType
+	}
+	return LabelType_unknown
+}
+
+func (m *LabelMutation) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *LabelMutation) GetRemoveAll() bool {
+	if m != nil {
+		return m.RemoveAll
+	}
+	return false
+}
+
+func (m *LabelMutation) GetRemove() []string {
+	if m != nil {
+		return m.Remove
+	}
+	return nil
+}
+
+func (m *LabelMutation) GetSet() map[string]string {
+	if m != nil {
+		return m.Set
+	}
+	return nil
+}
+
+type BatchApplyRequest struct {
+	Mutations []*LabelMutation `protobuf:"bytes,1,rep,name=mutations" json:"mutations,omitempty"`
+}
+
+func (m *BatchApplyRequest) Reset()                    { *m = BatchApplyRequest{} }
+func (m *BatchApplyRequest) String() string            { return proto.CompactTextString(m) }
+func (*BatchApplyRequest) ProtoMessage()               {}
+func (*BatchApplyRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
+
+func (m *BatchApplyRequest) GetMutations() []*LabelMutation {
+	if m != nil {
+		return m.Mutations
+	}
+	return nil
+}
+
+type BatchApplyResponse struct {
+}
+
+func (m *BatchApplyResponse) Reset()                    { *m = BatchApplyResponse{} }
+func (m *BatchApplyResponse) String() string            { return proto.CompactTextString(m) }
+func (*BatchApplyResponse) ProtoMessage()               {}
+func (*BatchApplyResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{22} }
+
+type GetLabelHistoryRequest struct {
+	LabelType LabelType `protobuf:"varint,1,opt,name=label_type,json=labelType,enum=label_store_protos.LabelType" json:"label_type,omitempty"`
+	Id        string    `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *GetLabelHistoryRequest) Reset()                    { *m = GetLabelHistoryRequest{} }
+func (m *GetLabelHistoryRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetLabelHistoryRequest) ProtoMessage()               {}
+func (*GetLabelHistoryRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+
+func (m *GetLabelHistoryRequest) GetLabelType() LabelType {
+	if m != nil {
+		return m.LabelType
+	}
+	return LabelType_unknown
+}
+
+func (m *GetLabelHistoryRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type LabelHistoryEntry struct {
+	// RFC3339 with nanoseconds
+	Timestamp string            `protobuf:"bytes,1,opt,name=timestamp" json:"timestamp,omitempty"`
+	Actor     string            `protobuf:"bytes,2,opt,name=actor" json:"actor,omitempty"`
+	OldLabels map[string]string `protobuf:"bytes,3,rep,name=old_labels,json=oldLabels" json:"old_labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	NewLabels map[string]string `protobuf:"bytes,4,rep,name=new_labels,json=newLabels" json:"new_labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *LabelHistoryEntry) Reset()                    { *m = LabelHistoryEntry{} }
+func (m *LabelHistoryEntry) String() string            { return proto.CompactTextString(m) }
+func (*LabelHistoryEntry) ProtoMessage()               {}
+func (*LabelHistoryEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+
+func (m *LabelHistoryEntry) GetTimestamp() string {
+	if m != nil {
+		return m.Timestamp
+	}
+	return ""
+}
+
+func (m *LabelHistoryEntry) GetActor() string {
+	if m != nil {
+		return m.Actor
+	}
+	return ""
+}
+
+func (m *LabelHistoryEntry) GetOldLabels() map[string]string {
+	if m != nil {
+		return m.OldLabels
+	}
+	return nil
+}
+
+func (m *LabelHistoryEntry) GetNewLabels() map[string]string {
+	if m != nil {
+		return m.NewLabels
+	}
+	return nil
+}
+
+type GetLabelHistoryResponse struct {
+	// Oldest first
+	Entries []*LabelHistoryEntry `protobuf:"bytes,1,rep,name=entries" json:"entries,omitempty"`
+}
+
+func (m *GetLabelHistoryResponse) Reset()                    { *m = GetLabelHistoryResponse{} }
+func (m *GetLabelHistoryResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetLabelHistoryResponse) ProtoMessage()               {}
+func (*GetLabelHistoryResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
+
+func (m *GetLabelHistoryResponse) GetEntries() []*LabelHistoryEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*WatchMatchesRequest)(nil), "label_store_protos.WatchMatchesRequest")
 	proto.RegisterType((*Labeled)(nil), "label_store_protos.Labeled")
 	proto.RegisterType((*WatchMatchesResponse)(nil), "label_store_protos.WatchMatchesResponse")
+	proto.RegisterType((*SetLabelRequest)(nil), "label_store_protos.SetLabelRequest")
+	proto.RegisterType((*SetLabelResponse)(nil), "label_store_protos.SetLabelResponse")
+	proto.RegisterType((*SetLabelsRequest)(nil), "label_store_protos.SetLabelsRequest")
+	proto.RegisterType((*SetLabelsResponse)(nil), "label_store_protos.SetLabelsResponse")
+	proto.RegisterType((*RemoveLabelRequest)(nil), "label_store_protos.RemoveLabelRequest")
+	proto.RegisterType((*RemoveLabelResponse)(nil), "label_store_protos.RemoveLabelResponse")
+	proto.RegisterType((*RemoveAllLabelsRequest)(nil), "label_store_protos.RemoveAllLabelsRequest")
+	proto.RegisterType((*RemoveAllLabelsResponse)(nil), "label_store_protos.RemoveAllLabelsResponse")
+	proto.RegisterType((*GetLabelsRequest)(nil), "label_store_protos.GetLabelsRequest")
+	proto.RegisterType((*GetLabelsResponse)(nil), "label_store_protos.GetLabelsResponse")
+	proto.RegisterType((*ListLabelsRequest)(nil), "label_store_protos.ListLabelsRequest")
+	proto.RegisterType((*ListLabelsResponse)(nil), "label_store_protos.ListLabelsResponse")
+	proto.RegisterType((*GetMatchesRequest)(nil), "label_store_protos.GetMatchesRequest")
+	proto.RegisterType((*GetMatchesResponse)(nil), "label_store_protos.GetMatchesResponse")
+	proto.RegisterType((*ValidateSelectorRequest)(nil), "label_store_protos.ValidateSelectorRequest")
+	proto.RegisterType((*SelectorProblem)(nil), "label_store_protos.SelectorProblem")
+	proto.RegisterType((*ValidateSelectorResponse)(nil), "label_store_protos.ValidateSelectorResponse")
+	proto.RegisterType((*LabelMutation)(nil), "label_store_protos.LabelMutation")
+	proto.RegisterType((*BatchApplyRequest)(nil), "label_store_protos.BatchApplyRequest")
+	proto.RegisterType((*BatchApplyResponse)(nil), "label_store_protos.BatchApplyResponse")
+	proto.RegisterType((*GetLabelHistoryRequest)(nil), "label_store_protos.GetLabelHistoryRequest")
+	proto.RegisterType((*LabelHistoryEntry)(nil), "label_store_protos.LabelHistoryEntry")
+	proto.RegisterType((*GetLabelHistoryResponse)(nil), "label_store_protos.GetLabelHistoryResponse")
 	proto.RegisterEnum("label_store_protos.LabelType", LabelType_name, LabelType_value)
 }
 
@@ -159,6 +781,16 @@ const _ = grpc.SupportPackageIsVersion4
 
 type P2LabelStoreClient interface {
 	WatchMatches(ctx context.Context, in *WatchMatchesRequest, opts ...grpc.CallOption) (P2LabelStore_WatchMatchesClient, error)
+	SetLabel(ctx context.Context, in *SetLabelRequest, opts ...grpc.CallOption) (*SetLabelResponse, error)
+	SetLabels(ctx context.Context, in *SetLabelsRequest, opts ...grpc.CallOption) (*SetLabelsResponse, error)
+	RemoveLabel(ctx context.Context, in *RemoveLabelRequest, opts ...grpc.CallOption) (*RemoveLabelResponse, error)
+	RemoveAllLabels(ctx context.Context, in *RemoveAllLabelsRequest, opts ...grpc.CallOption) (*RemoveAllLabelsResponse, error)
+	GetLabels(ctx context.Context, in *GetLabelsRequest, opts ...grpc.CallOption) (*GetLabelsResponse, error)
+	ListLabels(ctx context.Context, in *ListLabelsRequest, opts ...grpc.CallOption) (*ListLabelsResponse, error)
+	GetMatches(ctx context.Context, in *GetMatchesRequest, opts ...grpc.CallOption) (*GetMatchesResponse, error)
+	ValidateSelector(ctx context.Context, in *ValidateSelectorRequest, opts ...grpc.CallOption) (*ValidateSelectorResponse, error)
+	BatchApply(ctx context.Context, in *BatchApplyRequest, opts ...grpc.CallOption) (*BatchApplyResponse, error)
+	GetLabelHistory(ctx context.Context, in *GetLabelHistoryRequest, opts ...grpc.CallOption) (*GetLabelHistoryResponse, error)
 }
 
 type p2LabelStoreClient struct {
@@ -201,10 +833,110 @@ func (x *p2LabelStoreWatchMatchesClient) Recv() (*WatchMatchesResponse, error) {
 	return m, nil
 }
 
+func (c *p2LabelStoreClient) SetLabel(ctx context.Context, in *SetLabelRequest, opts ...grpc.CallOption) (*SetLabelResponse, error) {
+	out := new(SetLabelResponse)
+	err := grpc.Invoke(ctx, "/label_store_protos.P2LabelStore/SetLabel", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2LabelStoreClient) SetLabels(ctx context.Context, in *SetLabelsRequest, opts ...grpc.CallOption) (*SetLabelsResponse, error) {
+	out := new(SetLabelsResponse)
+	err := grpc.Invoke(ctx, "/label_store_protos.P2LabelStore/SetLabels", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2LabelStoreClient) RemoveLabel(ctx context.Context, in *RemoveLabelRequest, opts ...grpc.CallOption) (*RemoveLabelResponse, error) {
+	out := new(RemoveLabelResponse)
+	err := grpc.Invoke(ctx, "/label_store_protos.P2LabelStore/RemoveLabel", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2LabelStoreClient) RemoveAllLabels(ctx context.Context, in *RemoveAllLabelsRequest, opts ...grpc.CallOption) (*RemoveAllLabelsResponse, error) {
+	out := new(RemoveAllLabelsResponse)
+	err := grpc.Invoke(ctx, "/label_store_protos.P2LabelStore/RemoveAllLabels", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2LabelStoreClient) GetLabels(ctx context.Context, in *GetLabelsRequest, opts ...grpc.CallOption) (*GetLabelsResponse, error) {
+	out := new(GetLabelsResponse)
+	err := grpc.Invoke(ctx, "/label_store_protos.P2LabelStore/GetLabels", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2LabelStoreClient) ListLabels(ctx context.Context, in *ListLabelsRequest, opts ...grpc.CallOption) (*ListLabelsResponse, error) {
+	out := new(ListLabelsResponse)
+	err := grpc.Invoke(ctx, "/label_store_protos.P2LabelStore/ListLabels", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2LabelStoreClient) GetMatches(ctx context.Context, in *GetMatchesRequest, opts ...grpc.CallOption) (*GetMatchesResponse, error) {
+	out := new(GetMatchesResponse)
+	err := grpc.Invoke(ctx, "/label_store_protos.P2LabelStore/GetMatches", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2LabelStoreClient) ValidateSelector(ctx context.Context, in *ValidateSelectorRequest, opts ...grpc.CallOption) (*ValidateSelectorResponse, error) {
+	out := new(ValidateSelectorResponse)
+	err := grpc.Invoke(ctx, "/label_store_protos.P2LabelStore/ValidateSelector", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2LabelStoreClient) BatchApply(ctx context.Context, in *BatchApplyRequest, opts ...grpc.CallOption) (*BatchApplyResponse, error) {
+	out := new(BatchApplyResponse)
+	err := grpc.Invoke(ctx, "/label_store_protos.P2LabelStore/BatchApply", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2LabelStoreClient) GetLabelHistory(ctx context.Context, in *GetLabelHistoryRequest, opts ...grpc.CallOption) (*GetLabelHistoryResponse, error) {
+	out := new(GetLabelHistoryResponse)
+	err := grpc.Invoke(ctx, "/label_store_protos.P2LabelStore/GetLabelHistory", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for P2LabelStore service
 
 type P2LabelStoreServer interface {
 	WatchMatches(*WatchMatchesRequest, P2LabelStore_WatchMatchesServer) error
+	SetLabel(context.Context, *SetLabelRequest) (*SetLabelResponse, error)
+	SetLabels(context.Context, *SetLabelsRequest) (*SetLabelsResponse, error)
+	RemoveLabel(context.Context, *RemoveLabelRequest) (*RemoveLabelResponse, error)
+	RemoveAllLabels(context.Context, *RemoveAllLabelsRequest) (*RemoveAllLabelsResponse, error)
+	GetLabels(context.Context, *GetLabelsRequest) (*GetLabelsResponse, error)
+	ListLabels(context.Context, *ListLabelsRequest) (*ListLabelsResponse, error)
+	GetMatches(context.Context, *GetMatchesRequest) (*GetMatchesResponse, error)
+	ValidateSelector(context.Context, *ValidateSelectorRequest) (*ValidateSelectorResponse, error)
+	BatchApply(context.Context, *BatchApplyRequest) (*BatchApplyResponse, error)
+	GetLabelHistory(context.Context, *GetLabelHistoryRequest) (*GetLabelHistoryResponse, error)
 }
 
 func RegisterP2LabelStoreServer(s *grpc.Server, srv P2LabelStoreServer) {
@@ -232,10 +964,231 @@ func (x *p2LabelStoreWatchMatchesServer) Send(m *WatchMatchesResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _P2LabelStore_SetLabel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLabelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2LabelStoreServer).SetLabel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/label_store_protos.P2LabelStore/SetLabel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2LabelStoreServer).SetLabel(ctx, req.(*SetLabelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2LabelStore_SetLabels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLabelsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2LabelStoreServer).SetLabels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/label_store_protos.P2LabelStore/SetLabels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2LabelStoreServer).SetLabels(ctx, req.(*SetLabelsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2LabelStore_RemoveLabel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveLabelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2LabelStoreServer).RemoveLabel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/label_store_protos.P2LabelStore/RemoveLabel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2LabelStoreServer).RemoveLabel(ctx, req.(*RemoveLabelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2LabelStore_RemoveAllLabels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveAllLabelsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2LabelStoreServer).RemoveAllLabels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/label_store_protos.P2LabelStore/RemoveAllLabels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2LabelStoreServer).RemoveAllLabels(ctx, req.(*RemoveAllLabelsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2LabelStore_GetLabels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLabelsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2LabelStoreServer).GetLabels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/label_store_protos.P2LabelStore/GetLabels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2LabelStoreServer).GetLabels(ctx, req.(*GetLabelsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2LabelStore_ListLabels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLabelsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2LabelStoreServer).ListLabels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/label_store_protos.P2LabelStore/ListLabels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2LabelStoreServer).ListLabels(ctx, req.(*ListLabelsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2LabelStore_GetMatches_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMatchesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2LabelStoreServer).GetMatches(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/label_store_protos.P2LabelStore/GetMatches",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2LabelStoreServer).GetMatches(ctx, req.(*GetMatchesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2LabelStore_ValidateSelector_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateSelectorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2LabelStoreServer).ValidateSelector(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/label_store_protos.P2LabelStore/ValidateSelector",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2LabelStoreServer).ValidateSelector(ctx, req.(*ValidateSelectorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2LabelStore_BatchApply_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchApplyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2LabelStoreServer).BatchApply(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/label_store_protos.P2LabelStore/BatchApply",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2LabelStoreServer).BatchApply(ctx, req.(*BatchApplyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2LabelStore_GetLabelHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLabelHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2LabelStoreServer).GetLabelHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/label_store_protos.P2LabelStore/GetLabelHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2LabelStoreServer).GetLabelHistory(ctx, req.(*GetLabelHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _P2LabelStore_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "label_store_protos.P2LabelStore",
 	HandlerType: (*P2LabelStoreServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetLabel",
+			Handler:    _P2LabelStore_SetLabel_Handler,
+		},
+		{
+			MethodName: "SetLabels",
+			Handler:    _P2LabelStore_SetLabels_Handler,
+		},
+		{
+			MethodName: "RemoveLabel",
+			Handler:    _P2LabelStore_RemoveLabel_Handler,
+		},
+		{
+			MethodName: "RemoveAllLabels",
+			Handler:    _P2LabelStore_RemoveAllLabels_Handler,
+		},
+		{
+			MethodName: "GetLabels",
+			Handler:    _P2LabelStore_GetLabels_Handler,
+		},
+		{
+			MethodName: "ListLabels",
+			Handler:    _P2LabelStore_ListLabels_Handler,
+		},
+		{
+			MethodName: "GetMatches",
+			Handler:    _P2LabelStore_GetMatches_Handler,
+		},
+		{
+			MethodName: "ValidateSelector",
+			Handler:    _P2LabelStore_ValidateSelector_Handler,
+		},
+		{
+			MethodName: "BatchApply",
+			Handler:    _P2LabelStore_BatchApply_Handler,
+		},
+		{
+			MethodName: "GetLabelHistory",
+			Handler:    _P2LabelStore_GetLabelHistory_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "WatchMatches",
@@ -249,29 +1202,73 @@ var _P2LabelStore_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("pkg/grpc/labelstore/protos/label_store.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 369 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x52, 0x51, 0x8b, 0xd4, 0x30,
-	0x10, 0xbe, 0xb4, 0xb7, 0xd7, 0xeb, 0xec, 0x72, 0x84, 0xf1, 0x90, 0x52, 0x11, 0x96, 0xbe, 0x58,
-	0x44, 0x76, 0xa5, 0x22, 0xa8, 0x08, 0x3e, 0xf9, 0xe6, 0x81, 0x54, 0xc1, 0xc7, 0xd2, 0x6b, 0x86,
-	0xb3, 0x6c, 0x48, 0x62, 0x92, 0x2a, 0xfd, 0x9d, 0xfe, 0x21, 0x69, 0xb3, 0x77, 0xac, 0xba, 0x2a,
-	0xbe, 0xb4, 0x33, 0x5f, 0xbe, 0x7c, 0xdf, 0xcc, 0x47, 0xe0, 0x89, 0xd9, 0xdd, 0x6c, 0x6f, 0xac,
-	0xe9, 0xb6, 0xb2, 0xbd, 0x26, 0xe9, 0xbc, 0xb6, 0xb4, 0x35, 0x56, 0x7b, 0xed, 0x02, 0xd2, 0xcc,
-	0xd0, 0x66, 0x86, 0x10, 0x0f, 0xa0, 0x26, 0xb0, 0x0a, 0x0d, 0xf7, 0x3e, 0xb5, 0xbe, 0xfb, 0x7c,
-	0x35, 0x7d, 0xc8, 0xd5, 0xf4, 0x65, 0x20, 0xe7, 0x31, 0x87, 0x73, 0x47, 0x92, 0x3a, 0xaf, 0x6d,
-	0xc6, 0xd6, 0xac, 0x4c, 0xeb, 0xbb, 0x1e, 0x5f, 0x03, 0x04, 0x21, 0x3f, 0x1a, 0xca, 0xa2, 0x35,
-	0x2b, 0x2f, 0xaa, 0x87, 0x9b, 0xdf, 0xb5, 0x37, 0xef, 0x26, 0xe8, 0xe3, 0x68, 0xa8, 0x4e, 0xe5,
-	0x6d, 0x59, 0x7c, 0x67, 0x90, 0xcc, 0x07, 0x24, 0x7e, 0x51, 0x62, 0xff, 0xa7, 0x84, 0x17, 0x10,
-	0xf5, 0x62, 0xf6, 0x4f, 0xeb, 0xa8, 0x17, 0xf8, 0x06, 0xce, 0x42, 0x0a, 0x59, 0xbc, 0x8e, 0xcb,
-	0x65, 0xf5, 0xe8, 0x8f, 0x4a, 0x24, 0xc2, 0xdf, 0xbd, 0x55, 0xde, 0x8e, 0xf5, 0xfe, 0x5a, 0xfe,
-	0x12, 0x96, 0x07, 0x30, 0x72, 0x88, 0x77, 0x34, 0xee, 0xd7, 0x9f, 0x4a, 0xbc, 0x84, 0xc5, 0xd7,
-	0x56, 0x0e, 0xb4, 0x37, 0x0d, 0xcd, 0xab, 0xe8, 0x05, 0x2b, 0xae, 0xe0, 0xf2, 0xe7, 0x18, 0x9d,
-	0xd1, 0xca, 0x11, 0x3e, 0x87, 0x44, 0x06, 0xc7, 0x8c, 0xcd, 0x43, 0x3d, 0xf8, 0xcb, 0x50, 0xf5,
-	0x2d, 0xf7, 0xb1, 0x80, 0xf4, 0x6e, 0x65, 0x5c, 0x42, 0x32, 0xa8, 0x9d, 0xd2, 0xdf, 0x14, 0x3f,
-	0xc1, 0x04, 0x62, 0xa3, 0x05, 0x67, 0x78, 0x0e, 0xa7, 0x4a, 0x0b, 0xe2, 0x11, 0x72, 0x58, 0x19,
-	0x2d, 0x9a, 0x4e, 0x0e, 0xce, 0x93, 0x75, 0x3c, 0xc6, 0x1c, 0xee, 0x5b, 0x32, 0xb2, 0xef, 0x5a,
-	0xdf, 0x6b, 0xd5, 0x74, 0x5a, 0x79, 0xab, 0xa5, 0x24, 0xcb, 0x4f, 0x31, 0x85, 0xc5, 0x54, 0x3b,
-	0xbe, 0xa8, 0x06, 0x58, 0xbd, 0xaf, 0x66, 0x9f, 0x0f, 0xd3, 0x34, 0x48, 0xb0, 0x3a, 0x5c, 0x02,
-	0x8f, 0x06, 0x78, 0xe4, 0xb5, 0xe4, 0xe5, 0xbf, 0x89, 0x21, 0x8f, 0xe2, 0xe4, 0x29, 0xbb, 0x3e,
-	0x9b, 0x09, 0xcf, 0x7e, 0x04, 0x00, 0x00, 0xff, 0xff, 0x62, 0xad, 0x5e, 0xbd, 0xbd, 0x02, 0x00,
-	0x00,
+	// 1087 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xbc, 0x57, 0xdb, 0x6e, 0xdb, 0x46,
+	0x10, 0x0d, 0x75, 0xe7, 0xc8, 0x75, 0xa8, 0xb5, 0x6b, 0xb3, 0x6c, 0x53, 0xa8, 0x4c, 0xe2, 0x08,
+	0x4e, 0x60, 0xa7, 0xee, 0x05, 0xbd, 0xb8, 0x30, 0x52, 0xa0, 0x50, 0xd0, 0x26, 0x6d, 0x4a, 0x07,
+	0x0d, 0x10, 0xa0, 0x50, 0x68, 0x71, 0x2b, 0x13, 0x5e, 0x72, 0x59, 0x2e, 0x65, 0x43, 0xfd, 0x83,
+	0xf6, 0xad, 0xff, 0xd1, 0x6f, 0xe9, 0x43, 0xfb, 0x0d, 0x7d, 0xec, 0x3f, 0x04, 0x5c, 0xee, 0x4a,
+	0x14, 0x45, 0x59, 0x14, 0x62, 0xf9, 0x25, 0xe1, 0x8c, 0xe7, 0x72, 0x76, 0xe6, 0xec, 0xec, 0x08,
+	0x1e, 0x04, 0x67, 0x83, 0xfd, 0x41, 0x18, 0xf4, 0xf7, 0x89, 0x7d, 0x82, 0x09, 0x8b, 0x68, 0x88,
+	0xf7, 0x83, 0x90, 0x46, 0x94, 0x25, 0x9a, 0x1e, 0x57, 0xed, 0x71, 0x15, 0x42, 0x29, 0x55, 0x2f,
+	0xb1, 0x32, 0xff, 0x54, 0x60, 0xe3, 0x85, 0x1d, 0xf5, 0x4f, 0x9f, 0xc6, 0xff, 0x60, 0x66, 0xe1,
+	0x5f, 0x87, 0x98, 0x45, 0xc8, 0x80, 0x06, 0xc3, 0x04, 0xf7, 0x23, 0x1a, 0xea, 0x4a, 0x5b, 0xe9,
+	0xa8, 0xd6, 0x58, 0x46, 0x87, 0x00, 0x49, 0xa4, 0x68, 0x14, 0x60, 0xbd, 0xd4, 0x56, 0x3a, 0xeb,
+	0x07, 0xb7, 0xf6, 0x66, 0x83, 0xef, 0x3d, 0x89, 0x55, 0xcf, 0x47, 0x01, 0xb6, 0x54, 0x22, 0x3f,
+	0x51, 0x1b, 0x9a, 0xae, 0xdf, 0x0f, 0xb1, 0x87, 0xfd, 0xc8, 0x26, 0x7a, 0xb9, 0xad, 0x74, 0x1a,
+	0x56, 0x5a, 0x65, 0xfe, 0xab, 0x40, 0x9d, 0xbb, 0x62, 0x27, 0x93, 0x4b, 0x59, 0x32, 0xd7, 0x3a,
+	0x94, 0x5c, 0x87, 0x23, 0x54, 0xad, 0x92, 0xeb, 0xa0, 0x23, 0xa8, 0xf1, 0x3f, 0x32, 0xbd, 0xdc,
+	0x2e, 0x77, 0x9a, 0x07, 0xf7, 0xe6, 0x46, 0xc2, 0x4e, 0xf2, 0x3f, 0xfb, 0xc6, 0x8f, 0xc2, 0x91,
+	0x25, 0xdc, 0x8c, 0xcf, 0xa1, 0x99, 0x52, 0x23, 0x0d, 0xca, 0x67, 0x78, 0x24, 0x0a, 0x14, 0x7f,
+	0xa2, 0x4d, 0xa8, 0x9e, 0xdb, 0x64, 0x88, 0x45, 0xd2, 0x44, 0xf8, 0xa2, 0xf4, 0x99, 0x62, 0xfe,
+	0x55, 0x82, 0xcd, 0xe9, 0x4a, 0xb3, 0x80, 0xfa, 0x0c, 0xa3, 0x4f, 0xa0, 0x4e, 0x92, 0x94, 0xba,
+	0xc2, 0x51, 0xbd, 0x7b, 0x09, 0x2a, 0x4b, 0xda, 0x66, 0xeb, 0x58, 0x9a, 0xa9, 0x23, 0xef, 0xa1,
+	0x6f, 0x07, 0xec, 0x94, 0x46, 0xa2, 0xcc, 0x63, 0x19, 0x7d, 0x08, 0x55, 0xdb, 0x71, 0xb0, 0xa3,
+	0x57, 0x16, 0xa7, 0x4c, 0x2c, 0x63, 0x9c, 0xfd, 0x53, 0xdb, 0x1f, 0x60, 0x47, 0xaf, 0x16, 0xc0,
+	0x29, 0x6c, 0x63, 0xb7, 0x10, 0x7b, 0xf4, 0x1c, 0x3b, 0x7a, 0xad, 0x80, 0x9b, 0xb0, 0x35, 0x7f,
+	0x57, 0xe0, 0xe6, 0x31, 0x8e, 0xb8, 0x5e, 0x92, 0xf2, 0x6a, 0xc9, 0x80, 0xa0, 0xe2, 0xdb, 0x1e,
+	0xe6, 0xa5, 0x51, 0x2d, 0xfe, 0x3d, 0x69, 0x5f, 0x25, 0xd5, 0x3e, 0x13, 0x81, 0x36, 0x81, 0x92,
+	0x74, 0xcd, 0xfc, 0x4f, 0x99, 0x28, 0xd9, 0x6a, 0x00, 0x3e, 0xce, 0xb0, 0xf5, 0x61, 0x5e, 0xa4,
+	0x2c, 0x86, 0xab, 0xa6, 0xed, 0x06, 0xb4, 0x52, 0x29, 0xc4, 0xe1, 0xcf, 0x01, 0x59, 0xbc, 0x4f,
+	0xd7, 0xdb, 0x1e, 0xf3, 0x6d, 0xd8, 0x98, 0xca, 0x2b, 0xe0, 0xfc, 0x02, 0x5b, 0x89, 0xfa, 0x11,
+	0x21, 0x2b, 0x6c, 0x88, 0xf9, 0x0e, 0x6c, 0xcf, 0xe4, 0x11, 0x10, 0x5e, 0x81, 0xd6, 0x5d, 0x29,
+	0x1b, 0xcc, 0x6f, 0xa1, 0xd5, 0xcd, 0x36, 0x62, 0x7a, 0x76, 0x28, 0x45, 0x67, 0x87, 0xf9, 0x23,
+	0xb4, 0x9e, 0xb8, 0xec, 0x2a, 0xe1, 0x9a, 0xdf, 0x01, 0x4a, 0x87, 0x7c, 0xa3, 0xd9, 0x66, 0x7a,
+	0xfc, 0xac, 0xd7, 0xf5, 0x24, 0xc5, 0xd8, 0xd3, 0xe9, 0xde, 0x0c, 0x3b, 0x83, 0xed, 0x9f, 0x6c,
+	0xe2, 0x3a, 0x76, 0x84, 0x8f, 0x05, 0xbc, 0xd5, 0x9f, 0xe0, 0xab, 0x78, 0x58, 0x26, 0x91, 0x9e,
+	0x85, 0xf4, 0x84, 0x60, 0x2f, 0xe7, 0x92, 0xeb, 0x50, 0xf7, 0x30, 0x63, 0xf6, 0x40, 0x5e, 0x73,
+	0x29, 0x9a, 0x7f, 0x2b, 0xa0, 0xcf, 0x82, 0x16, 0x75, 0x48, 0x66, 0x83, 0x9b, 0x30, 0xac, 0x61,
+	0x25, 0x02, 0x7a, 0x1f, 0xc0, 0xa7, 0xa1, 0x67, 0x13, 0xf7, 0x37, 0x2c, 0x69, 0x9a, 0xd2, 0xa0,
+	0x2f, 0xa1, 0x86, 0xc3, 0x90, 0x86, 0x72, 0x78, 0xdd, 0xce, 0x1f, 0x5e, 0x53, 0x98, 0x2d, 0xe1,
+	0x82, 0x8e, 0xa0, 0x71, 0x61, 0x87, 0xbe, 0xeb, 0x0f, 0x98, 0x5e, 0x29, 0xee, 0x3e, 0x76, 0x32,
+	0xff, 0x28, 0xc1, 0x5b, 0xbc, 0x50, 0x4f, 0x87, 0x91, 0x1d, 0xb9, 0xd4, 0xbf, 0xe2, 0xe1, 0x74,
+	0x0b, 0x20, 0x79, 0xa8, 0x7a, 0x36, 0x91, 0x3b, 0x8c, 0x1a, 0xca, 0xd9, 0x80, 0xb6, 0xa0, 0x96,
+	0x08, 0x1c, 0xbd, 0x6a, 0x09, 0x09, 0x1d, 0x42, 0x99, 0xe1, 0x48, 0x3c, 0x9f, 0xbb, 0x73, 0xb3,
+	0x4b, 0xd0, 0xf1, 0x70, 0x4f, 0x06, 0x79, 0xec, 0x66, 0x7c, 0x0a, 0x0d, 0xa9, 0x58, 0x6a, 0x84,
+	0x3f, 0x87, 0xd6, 0xd7, 0x31, 0xb7, 0x1f, 0x05, 0x01, 0x19, 0x49, 0x2e, 0x1e, 0x81, 0xea, 0x89,
+	0x34, 0x4c, 0xf0, 0xfb, 0x83, 0x85, 0x80, 0xac, 0x89, 0x8f, 0xb9, 0x09, 0x28, 0x1d, 0x75, 0x32,
+	0x8a, 0xe5, 0x94, 0x7a, 0xec, 0xc6, 0x81, 0x46, 0xab, 0x99, 0x86, 0xff, 0x97, 0xa0, 0x95, 0xce,
+	0x92, 0x54, 0xe5, 0x3d, 0x50, 0x23, 0xd7, 0xc3, 0x2c, 0xb2, 0xbd, 0x40, 0xd4, 0x66, 0xa2, 0x88,
+	0x2b, 0x64, 0xf3, 0xbb, 0x27, 0x2a, 0xc4, 0x05, 0x74, 0x0c, 0x40, 0x89, 0xd3, 0x9b, 0x7a, 0x69,
+	0x3f, 0x9e, 0x8b, 0x2b, 0x9d, 0x6e, 0xef, 0x07, 0xe2, 0xa4, 0x5f, 0x5b, 0x95, 0x4a, 0x39, 0x0e,
+	0xea, 0xe3, 0x0b, 0x19, 0xb4, 0xb2, 0x4c, 0xd0, 0xef, 0xf1, 0xc5, 0x54, 0x50, 0x5f, 0xca, 0xc6,
+	0x21, 0xac, 0x4f, 0x67, 0x5c, 0x86, 0x05, 0xb1, 0xf7, 0x74, 0xe8, 0xa5, 0x38, 0xf4, 0x12, 0xb6,
+	0x67, 0xfa, 0x2a, 0xe6, 0xc3, 0x11, 0xd4, 0xb1, 0x1f, 0x85, 0x2e, 0x96, 0x3c, 0xba, 0x5b, 0xe8,
+	0xa0, 0x96, 0xf4, 0xda, 0x75, 0x40, 0x1d, 0xf7, 0x1c, 0x35, 0xa1, 0x3e, 0xf4, 0xcf, 0x7c, 0x7a,
+	0xe1, 0x6b, 0x37, 0x50, 0x1d, 0xca, 0x01, 0x75, 0x34, 0x05, 0x35, 0xa0, 0xe2, 0x53, 0x07, 0x6b,
+	0x25, 0xa4, 0xc1, 0x5a, 0x40, 0x9d, 0x5e, 0x9f, 0x0c, 0x59, 0x84, 0x43, 0xa6, 0x95, 0x91, 0x01,
+	0x5b, 0x21, 0x0e, 0x88, 0xdb, 0xe7, 0xc4, 0xec, 0xf5, 0xa9, 0x1f, 0x85, 0x94, 0x10, 0x1c, 0x6a,
+	0x15, 0xa4, 0x42, 0x35, 0xfe, 0x66, 0x5a, 0xf5, 0xe0, 0x9f, 0x06, 0xac, 0x3d, 0x3b, 0xe0, 0x89,
+	0x8e, 0x63, 0x60, 0x08, 0xc3, 0x5a, 0x7a, 0x1f, 0x47, 0xb9, 0x3f, 0x06, 0x72, 0x7e, 0x1b, 0x19,
+	0x9d, 0xc5, 0x86, 0xe2, 0x36, 0xdc, 0x78, 0xa8, 0xa0, 0x17, 0xfc, 0xd6, 0xf2, 0xbc, 0xe8, 0xf6,
+	0x65, 0x1b, 0x9c, 0x0c, 0x7f, 0xe7, 0x72, 0x23, 0x19, 0x1a, 0xbd, 0x04, 0x55, 0x6a, 0x19, 0xba,
+	0x53, 0x64, 0x37, 0x34, 0xee, 0x2e, 0xb0, 0x1a, 0xc7, 0x7e, 0x05, 0xcd, 0xd4, 0xa2, 0x85, 0x76,
+	0xf2, 0xfc, 0x66, 0x37, 0x40, 0xe3, 0xde, 0x42, 0xbb, 0x71, 0x06, 0x02, 0x37, 0x33, 0xbb, 0x14,
+	0xda, 0x9d, 0xef, 0x9d, 0x5d, 0xec, 0x8c, 0xfb, 0x85, 0x6c, 0xd3, 0xb5, 0xea, 0x5e, 0x5e, 0xab,
+	0x6e, 0xa1, 0x5a, 0x75, 0x73, 0x6a, 0xf5, 0x33, 0xc0, 0x64, 0xf3, 0x41, 0xf9, 0xe4, 0xcf, 0x2e,
+	0x5b, 0xc6, 0xce, 0x22, 0xb3, 0x74, 0xf8, 0xc9, 0x72, 0x82, 0xe6, 0xa1, 0xca, 0x50, 0x74, 0x67,
+	0x91, 0xd9, 0x38, 0x3c, 0x05, 0x2d, 0xfb, 0xf2, 0xa3, 0xdc, 0xe2, 0xce, 0x59, 0x6a, 0x8c, 0x07,
+	0xc5, 0x8c, 0xd3, 0xe7, 0x99, 0xbc, 0x1b, 0xf9, 0xe7, 0x99, 0x79, 0xad, 0x8c, 0x9d, 0x45, 0x66,
+	0x69, 0x5e, 0x65, 0x06, 0x55, 0x3e, 0xaf, 0xf2, 0x5f, 0x29, 0xe3, 0x7e, 0x21, 0x5b, 0x99, 0xed,
+	0xa4, 0xc6, 0x2d, 0x3e, 0x7a, 0x3d, 0x00, 0x51, 0xbf, 0xd5, 0x01, 0x89, 0x11, 0x00, 0x00,
 }
@@ -0,0 +1,201 @@
+/*
+package client implements pod cluster store operations on top of the pod
+cluster gRPC service, for tools that should not need direct access to the
+pod cluster tree in consul
+*/
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/square/p2/pkg/grpc/podclusterstore"
+	podclusterstore_protos "github.com/square/p2/pkg/grpc/podclusterstore/protos"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pc/control"
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+type Client struct {
+	client podclusterstore_protos.P2PodClusterStoreClient
+	logger logging.Logger
+}
+
+var _ control.PodClusterWatcher = Client{}
+
+func NewClient(conn *grpc.ClientConn, logger logging.Logger) Client {
+	return Client{
+		client: podclusterstore_protos.NewP2PodClusterStoreClient(conn),
+		logger: logger,
+	}
+}
+
+func (c Client) Create(
+	podID types.PodID,
+	availabilityZone fields.AvailabilityZone,
+	clusterName fields.ClusterName,
+	podSelector klabels.Selector,
+	annotations fields.Annotations,
+) (fields.PodCluster, error) {
+	annotationsJSON, err := json.Marshal(annotations)
+	if err != nil {
+		return fields.PodCluster{}, util.Errorf("could not marshal annotations: %s", err)
+	}
+
+	resp, err := c.client.CreatePodCluster(context.Background(), &podclusterstore_protos.CreatePodClusterRequest{
+		PodId:            podID.String(),
+		AvailabilityZone: availabilityZone.String(),
+		Name:             clusterName.String(),
+		PodSelector:      podSelector.String(),
+		Annotations:      string(annotationsJSON),
+	})
+	if err != nil {
+		return fields.PodCluster{}, err
+	}
+
+	return podclusterstore.ProtoPCToRawPC(resp.GetPodCluster())
+}
+
+func (c Client) Get(id fields.ID) (fields.PodCluster, error) {
+	resp, err := c.client.GetPodCluster(context.Background(), &podclusterstore_protos.GetPodClusterRequest{
+		PodClusterId: id.String(),
+	})
+	if err != nil {
+		return fields.PodCluster{}, err
+	}
+
+	return podclusterstore.ProtoPCToRawPC(resp.GetPodCluster())
+}
+
+// Update replaces the annotations of the pod cluster with the given ID. The
+// pod selector is also replaced unless podSelector is nil.
+func (c Client) Update(id fields.ID, podSelector klabels.Selector, annotations fields.Annotations) (fields.PodCluster, error) {
+	annotationsJSON, err := json.Marshal(annotations)
+	if err != nil {
+		return fields.PodCluster{}, util.Errorf("could not marshal annotations: %s", err)
+	}
+
+	var selector string
+	if podSelector != nil {
+		selector = podSelector.String()
+	}
+
+	resp, err := c.client.UpdatePodCluster(context.Background(), &podclusterstore_protos.UpdatePodClusterRequest{
+		PodClusterId: id.String(),
+		PodSelector:  selector,
+		Annotations:  string(annotationsJSON),
+	})
+	if err != nil {
+		return fields.PodCluster{}, err
+	}
+
+	return podclusterstore.ProtoPCToRawPC(resp.GetPodCluster())
+}
+
+func (c Client) Delete(id fields.ID) error {
+	_, err := c.client.DeletePodCluster(context.Background(), &podclusterstore_protos.DeletePodClusterRequest{
+		PodClusterId: id.String(),
+	})
+	return err
+}
+
+// Watch streams the full set of pod clusters from the server whenever it
+// changes, with the same semantics as the consul pcstore's Watch. If the
+// stream breaks it is re-established in a loop, and the returned channel is
+// closed once quit is closed.
+func (c Client) Watch(quit <-chan struct{}) <-chan pcstore.WatchedPodClusters {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	outCh := make(chan pcstore.WatchedPodClusters)
+
+	go func() {
+		defer close(outCh)
+		defer cancelFunc()
+
+		go func() {
+			select {
+			case <-quit:
+			case <-ctx.Done():
+			}
+			cancelFunc()
+		}()
+
+		var watchClient podclusterstore_protos.P2PodClusterStore_WatchPodClustersClient
+		for {
+			if watchClient == nil {
+				var err error
+				watchClient, err = c.client.WatchPodClusters(ctx, &podclusterstore_protos.WatchPodClustersRequest{}, grpc.FailFast(false))
+				if err != nil {
+					if grpc.Code(err) == codes.Canceled {
+						return
+					}
+					c.logger.WithError(err).Errorln("could not start WatchPodClusters RPC, will retry")
+					watchClient = nil
+					if !waitToRetry(quit) {
+						return
+					}
+					continue
+				}
+			}
+
+			resp, err := watchClient.Recv()
+			if grpc.Code(err) == codes.Canceled {
+				c.logger.Infoln("pod cluster store client: terminating Watch()")
+				return
+			}
+			if err != nil {
+				c.logger.WithError(err).Errorln("unexpected error reading from WatchPodClusters stream, starting another RPC")
+				watchClient = nil
+				if !waitToRetry(quit) {
+					return
+				}
+				continue
+			}
+
+			select {
+			case outCh <- respToWatchedPodClusters(resp):
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	return outCh
+}
+
+// waitToRetry sleeps before an RPC is restarted, returning false if quit was
+// closed in the meantime
+func waitToRetry(quit <-chan struct{}) bool {
+	select {
+	case <-quit:
+		return false
+	case <-time.After(2 * time.Second):
+		return true
+	}
+}
+
+func respToWatchedPodClusters(resp *podclusterstore_protos.WatchPodClustersResponse) pcstore.WatchedPodClusters {
+	if resp.GetError() != "" {
+		return pcstore.WatchedPodClusters{Err: errors.New(resp.GetError())}
+	}
+
+	clusters := make([]*fields.PodCluster, 0, len(resp.GetPodClusters()))
+	for _, protoPC := range resp.GetPodClusters() {
+		pc, err := podclusterstore.ProtoPCToRawPC(protoPC)
+		if err != nil {
+			// Dropping a single pod cluster would make it look deleted
+			// to watchers, so the whole response is reported as an error
+			return pcstore.WatchedPodClusters{Err: err}
+		}
+		clusters = append(clusters, &pc)
+	}
+	return pcstore.WatchedPodClusters{Clusters: clusters}
+}
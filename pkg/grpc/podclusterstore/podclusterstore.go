@@ -0,0 +1,285 @@
+package podclusterstore
+
+import (
+	"encoding/json"
+	"time"
+
+	podclusterstore_protos "github.com/square/p2/pkg/grpc/podclusterstore/protos"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+type PodClusterStore interface {
+	Create(
+		podID types.PodID,
+		availabilityZone fields.AvailabilityZone,
+		clusterName fields.ClusterName,
+		podSelector klabels.Selector,
+		annotations fields.Annotations,
+		session pcstore.Session,
+	) (fields.PodCluster, error)
+	Get(id fields.ID) (fields.PodCluster, error)
+	MutatePC(id fields.ID, mutator func(fields.PodCluster) (fields.PodCluster, error)) (fields.PodCluster, error)
+	Delete(id fields.ID) error
+	Watch(quit <-chan struct{}) <-chan pcstore.WatchedPodClusters
+}
+
+// SessionCreator is used to obtain the consul session that holds the pod
+// cluster creation lock while a pod cluster is created
+type SessionCreator interface {
+	NewSession(name string, renewalCh <-chan time.Time) (consul.Session, chan error, error)
+}
+
+type Store struct {
+	pcStore        PodClusterStore
+	sessionCreator SessionCreator
+	logger         logging.Logger
+}
+
+func NewServer(pcStore PodClusterStore, sessionCreator SessionCreator, logger logging.Logger) Store {
+	return Store{
+		pcStore:        pcStore,
+		sessionCreator: sessionCreator,
+		logger:         logger,
+	}
+}
+
+var _ podclusterstore_protos.P2PodClusterStoreServer = Store{}
+
+func (s Store) CreatePodCluster(_ context.Context, req *podclusterstore_protos.CreatePodClusterRequest) (*podclusterstore_protos.CreatePodClusterResponse, error) {
+	if req.PodId == "" || req.AvailabilityZone == "" || req.Name == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "pod_id, availability_zone and name must all be specified")
+	}
+
+	selector, err := klabels.Parse(req.PodSelector)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid pod selector %q: %s", req.PodSelector, err)
+	}
+
+	annotations, err := parseAnnotations(req.Annotations)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	session, _, err := s.sessionCreator.NewSession("grpc-pcstore-create", nil)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "could not create session to lock pod cluster creation: %s", err)
+	}
+	defer func() {
+		if err := session.Destroy(); err != nil {
+			s.logger.WithError(err).Errorln("could not destroy pod cluster creation session")
+		}
+	}()
+
+	pc, err := s.pcStore.Create(
+		types.PodID(req.PodId),
+		fields.AvailabilityZone(req.AvailabilityZone),
+		fields.ClusterName(req.Name),
+		selector,
+		annotations,
+		session,
+	)
+	if err != nil {
+		return nil, storeErrToGRPCErr(err, "could not create pod cluster")
+	}
+
+	pcProto, err := RawPCToProtoPC(pc)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "create succeeded, but could not convert pod cluster to proto type: %s", err)
+	}
+
+	return &podclusterstore_protos.CreatePodClusterResponse{
+		PodCluster: pcProto,
+	}, nil
+}
+
+func (s Store) GetPodCluster(_ context.Context, req *podclusterstore_protos.GetPodClusterRequest) (*podclusterstore_protos.GetPodClusterResponse, error) {
+	pc, err := s.pcStore.Get(fields.ID(req.PodClusterId))
+	if err != nil {
+		return nil, storeErrToGRPCErr(err, "could not get pod cluster")
+	}
+
+	pcProto, err := RawPCToProtoPC(pc)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "%s", err)
+	}
+
+	return &podclusterstore_protos.GetPodClusterResponse{
+		PodCluster: pcProto,
+	}, nil
+}
+
+func (s Store) UpdatePodCluster(_ context.Context, req *podclusterstore_protos.UpdatePodClusterRequest) (*podclusterstore_protos.UpdatePodClusterResponse, error) {
+	var selector klabels.Selector
+	if req.PodSelector != "" {
+		var err error
+		selector, err = klabels.Parse(req.PodSelector)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid pod selector %q: %s", req.PodSelector, err)
+		}
+	}
+
+	annotations, err := parseAnnotations(req.Annotations)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
+	pc, err := s.pcStore.MutatePC(fields.ID(req.PodClusterId), func(pc fields.PodCluster) (fields.PodCluster, error) {
+		if selector != nil {
+			pc.PodSelector = selector
+		}
+		pc.Annotations = annotations
+		return pc, nil
+	})
+	if err != nil {
+		return nil, storeErrToGRPCErr(err, "could not update pod cluster")
+	}
+
+	pcProto, err := RawPCToProtoPC(pc)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "update succeeded, but could not convert pod cluster to proto type: %s", err)
+	}
+
+	return &podclusterstore_protos.UpdatePodClusterResponse{
+		PodCluster: pcProto,
+	}, nil
+}
+
+func (s Store) DeletePodCluster(_ context.Context, req *podclusterstore_protos.DeletePodClusterRequest) (*podclusterstore_protos.DeletePodClusterResponse, error) {
+	err := s.pcStore.Delete(fields.ID(req.PodClusterId))
+	if err != nil {
+		return nil, storeErrToGRPCErr(err, "could not delete pod cluster")
+	}
+
+	return &podclusterstore_protos.DeletePodClusterResponse{}, nil
+}
+
+func (s Store) WatchPodClusters(_ *podclusterstore_protos.WatchPodClustersRequest, stream podclusterstore_protos.P2PodClusterStore_WatchPodClustersServer) error {
+	clientCancel := stream.Context().Done()
+
+	// The pcstore's Watch() does not close its output channel when the quit
+	// channel is closed, so cancellation has to be checked here
+	out := s.pcStore.Watch(clientCancel)
+
+	for {
+		var watchedPodClusters pcstore.WatchedPodClusters
+		var ok bool
+		select {
+		case <-clientCancel:
+			return nil
+		case watchedPodClusters, ok = <-out:
+			if !ok {
+				return nil
+			}
+		}
+
+		resp, err := watchedPodClustersToResp(watchedPodClusters)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(resp)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func RawPCToProtoPC(rawPC fields.PodCluster) (*podclusterstore_protos.PodCluster, error) {
+	annotations, err := json.Marshal(rawPC.Annotations)
+	if err != nil {
+		return nil, util.Errorf("could not convert pod cluster %s's annotations to string for pod cluster proto: %s", rawPC.ID, err)
+	}
+
+	var selector string
+	if rawPC.PodSelector != nil {
+		selector = rawPC.PodSelector.String()
+	}
+
+	return &podclusterstore_protos.PodCluster{
+		Id:               rawPC.ID.String(),
+		PodId:            rawPC.PodID.String(),
+		AvailabilityZone: rawPC.AvailabilityZone.String(),
+		Name:             rawPC.Name.String(),
+		PodSelector:      selector,
+		Annotations:      string(annotations),
+	}, nil
+}
+
+func ProtoPCToRawPC(protoPC *podclusterstore_protos.PodCluster) (fields.PodCluster, error) {
+	selector, err := klabels.Parse(protoPC.GetPodSelector())
+	if err != nil {
+		return fields.PodCluster{}, util.Errorf("could not convert pod cluster proto to raw pod cluster: %s", err)
+	}
+
+	annotations, err := parseAnnotations(protoPC.GetAnnotations())
+	if err != nil {
+		return fields.PodCluster{}, util.Errorf("could not convert pod cluster proto to raw pod cluster: %s", err)
+	}
+
+	return fields.PodCluster{
+		ID:               fields.ID(protoPC.GetId()),
+		PodID:            types.PodID(protoPC.GetPodId()),
+		AvailabilityZone: fields.AvailabilityZone(protoPC.GetAvailabilityZone()),
+		Name:             fields.ClusterName(protoPC.GetName()),
+		PodSelector:      selector,
+		Annotations:      annotations,
+	}, nil
+}
+
+// parseAnnotations decodes JSON encoded annotations. An empty string is
+// treated as no annotations.
+func parseAnnotations(annotationsJSON string) (fields.Annotations, error) {
+	annotations := fields.Annotations{}
+	if annotationsJSON == "" {
+		return annotations, nil
+	}
+
+	err := json.Unmarshal([]byte(annotationsJSON), &annotations)
+	if err != nil {
+		return nil, util.Errorf("could not parse annotations as a JSON object: %s", err)
+	}
+	return annotations, nil
+}
+
+func storeErrToGRPCErr(err error, msg string) error {
+	switch {
+	case pcstore.IsNotExist(err):
+		return grpc.Errorf(codes.NotFound, "%s: %s", msg, err)
+	case pcstore.IsAlreadyExists(err):
+		return grpc.Errorf(codes.AlreadyExists, "%s: %s", msg, err)
+	case fields.IsAnnotationError(err):
+		return grpc.Errorf(codes.InvalidArgument, "%s: %s", msg, err)
+	default:
+		return grpc.Errorf(codes.Unavailable, "%s: %s", msg, err)
+	}
+}
+
+func watchedPodClustersToResp(watchedPodClusters pcstore.WatchedPodClusters) (*podclusterstore_protos.WatchPodClustersResponse, error) {
+	podClusters := make([]*podclusterstore_protos.PodCluster, len(watchedPodClusters.Clusters))
+	for i, pc := range watchedPodClusters.Clusters {
+		proto, err := RawPCToProtoPC(*pc)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Unavailable, "%s", err)
+		}
+		podClusters[i] = proto
+	}
+
+	var errStr string
+	if watchedPodClusters.Err != nil {
+		errStr = watchedPodClusters.Err.Error()
+	}
+	return &podclusterstore_protos.WatchPodClustersResponse{
+		PodClusters: podClusters,
+		Error:       errStr,
+	}, nil
+}
@@ -0,0 +1,258 @@
+// +build !race
+
+package podclusterstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	podclusterstore_protos "github.com/square/p2/pkg/grpc/podclusterstore/protos"
+	"github.com/square/p2/pkg/grpc/testutil"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consultest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/pcstore/pcstoretest"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+type fakeSessionCreator struct{}
+
+func (fakeSessionCreator) NewSession(_ string, _ <-chan time.Time) (consul.Session, chan error, error) {
+	return consultest.NewSession(), make(chan error), nil
+}
+
+func TestCreateAndGetPodCluster(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	applicator := labels.NewFakeApplicator()
+	pcStore := pcstore.NewConsul(fixture.Client, applicator, labels.DefaultAggregationRate, applicator, &logging.DefaultLogger)
+	server := NewServer(pcStore, consul.NewConsulStore(fixture.Client), logging.DefaultLogger)
+
+	createResp, err := server.CreatePodCluster(context.Background(), &podclusterstore_protos.CreatePodClusterRequest{
+		PodId:            "some_pod",
+		AvailabilityZone: "west",
+		Name:             "prod",
+		PodSelector:      "pod_id=some_pod",
+		Annotations:      `{"deployer":"someone"}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating pod cluster: %s", err)
+	}
+
+	created := createResp.GetPodCluster()
+	if created.Id == "" {
+		t.Fatal("expected created pod cluster to have an ID")
+	}
+
+	getResp, err := server.GetPodCluster(context.Background(), &podclusterstore_protos.GetPodClusterRequest{
+		PodClusterId: created.Id,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error getting pod cluster: %s", err)
+	}
+
+	pc, err := ProtoPCToRawPC(getResp.GetPodCluster())
+	if err != nil {
+		t.Fatalf("could not convert pod cluster proto: %s", err)
+	}
+	if pc.PodID != "some_pod" || pc.AvailabilityZone != "west" || pc.Name != "prod" {
+		t.Errorf("unexpected pod cluster %+v", pc)
+	}
+	if pc.PodSelector.String() != "pod_id=some_pod" {
+		t.Errorf("expected pod selector %q but was %q", "pod_id=some_pod", pc.PodSelector.String())
+	}
+	if pc.Annotations["deployer"] != "someone" {
+		t.Errorf("expected annotations to round trip, got %v", pc.Annotations)
+	}
+
+	_, err = server.CreatePodCluster(context.Background(), &podclusterstore_protos.CreatePodClusterRequest{
+		PodId:            "some_pod",
+		AvailabilityZone: "west",
+		Name:             "prod",
+	})
+	if grpc.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected %s creating a duplicate pod cluster, got %s", codes.AlreadyExists, err)
+	}
+
+	_, err = server.CreatePodCluster(context.Background(), &podclusterstore_protos.CreatePodClusterRequest{
+		PodId:            "some_pod",
+		AvailabilityZone: "east",
+		Name:             "prod",
+		Annotations:      "not json",
+	})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected %s for malformed annotations, got %s", codes.InvalidArgument, err)
+	}
+}
+
+func TestUpdateAndDeletePodCluster(t *testing.T) {
+	server := NewServer(pcstoretest.NewFake(), fakeSessionCreator{}, logging.DefaultLogger)
+
+	createResp, err := server.CreatePodCluster(context.Background(), &podclusterstore_protos.CreatePodClusterRequest{
+		PodId:            "some_pod",
+		AvailabilityZone: "west",
+		Name:             "prod",
+		PodSelector:      "pod_id=some_pod",
+		Annotations:      `{"deployer":"someone"}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating pod cluster: %s", err)
+	}
+	id := createResp.GetPodCluster().Id
+
+	updateResp, err := server.UpdatePodCluster(context.Background(), &podclusterstore_protos.UpdatePodClusterRequest{
+		PodClusterId: id,
+		Annotations:  `{"deployer":"someone_else"}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error updating pod cluster: %s", err)
+	}
+	updated, err := ProtoPCToRawPC(updateResp.GetPodCluster())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Annotations["deployer"] != "someone_else" {
+		t.Errorf("expected annotations to be replaced, got %v", updated.Annotations)
+	}
+	if updated.PodSelector.String() != "pod_id=some_pod" {
+		t.Errorf("expected an empty pod selector in the request to leave the selector alone, got %q", updated.PodSelector.String())
+	}
+
+	_, err = server.DeletePodCluster(context.Background(), &podclusterstore_protos.DeletePodClusterRequest{
+		PodClusterId: id,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error deleting pod cluster: %s", err)
+	}
+
+	_, err = server.GetPodCluster(context.Background(), &podclusterstore_protos.GetPodClusterRequest{
+		PodClusterId: id,
+	})
+	if grpc.Code(err) != codes.NotFound {
+		t.Errorf("expected %s getting a deleted pod cluster, got %s", codes.NotFound, err)
+	}
+
+	_, err = server.UpdatePodCluster(context.Background(), &podclusterstore_protos.UpdatePodClusterRequest{
+		PodClusterId: id,
+	})
+	if grpc.Code(err) != codes.NotFound {
+		t.Errorf("expected %s updating a deleted pod cluster, got %s", codes.NotFound, err)
+	}
+}
+
+type TestWatchPodClustersStream struct {
+	*testutil.FakeServerStream
+
+	responseCh chan<- *podclusterstore_protos.WatchPodClustersResponse
+}
+
+func (w TestWatchPodClustersStream) Send(resp *podclusterstore_protos.WatchPodClustersResponse) error {
+	w.responseCh <- resp
+	return nil
+}
+
+// fakePCWatcher passes through whatever is sent on resultCh as the result of
+// Watch(). Like the consul pcstore, it never closes its output channel.
+type fakePCWatcher struct {
+	PodClusterStore
+
+	resultCh <-chan pcstore.WatchedPodClusters
+}
+
+func (f fakePCWatcher) Watch(quitCh <-chan struct{}) <-chan pcstore.WatchedPodClusters {
+	out := make(chan pcstore.WatchedPodClusters)
+	go func() {
+		for {
+			select {
+			case <-quitCh:
+				return
+			case val := <-f.resultCh:
+				select {
+				case <-quitCh:
+					return
+				case out <- val:
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+func TestWatchPodClusters(t *testing.T) {
+	resultCh := make(chan pcstore.WatchedPodClusters)
+	server := NewServer(fakePCWatcher{resultCh: resultCh}, fakeSessionCreator{}, logging.DefaultLogger)
+
+	respCh := make(chan *podclusterstore_protos.WatchPodClustersResponse)
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	serverExit := make(chan struct{})
+	go func() {
+		defer close(serverExit)
+		err := server.WatchPodClusters(new(podclusterstore_protos.WatchPodClustersRequest), TestWatchPodClustersStream{
+			FakeServerStream: testutil.NewFakeServerStream(ctx),
+			responseCh:       respCh,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	pc := &fields.PodCluster{
+		ID:               "abc",
+		PodID:            "some_pod",
+		AvailabilityZone: "west",
+		Name:             "prod",
+		Annotations:      fields.Annotations{"deployer": "someone"},
+	}
+	select {
+	case resultCh <- pcstore.WatchedPodClusters{Clusters: []*fields.PodCluster{pc}}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out sending watch result")
+	}
+
+	select {
+	case resp := <-respCh:
+		if resp.Error != "" {
+			t.Errorf("unexpected error in watch response: %s", resp.Error)
+		}
+		if len(resp.PodClusters) != 1 || resp.PodClusters[0].Id != "abc" {
+			t.Fatalf("expected a single pod cluster with ID abc, got %+v", resp.PodClusters)
+		}
+		if resp.PodClusters[0].Annotations != `{"deployer":"someone"}` {
+			t.Errorf("unexpected annotations %q", resp.PodClusters[0].Annotations)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for watch response")
+	}
+
+	select {
+	case resultCh <- pcstore.WatchedPodClusters{Err: pcstore.NoPodCluster}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out sending watch error")
+	}
+
+	select {
+	case resp := <-respCh:
+		if resp.Error != pcstore.NoPodCluster.Error() {
+			t.Errorf("expected watch error %q to be passed through, got %q", pcstore.NoPodCluster, resp.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for watch error response")
+	}
+
+	cancelFunc()
+	select {
+	case <-serverExit:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not exit after the client canceled")
+	}
+}
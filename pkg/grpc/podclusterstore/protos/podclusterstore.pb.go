@@ -0,0 +1,590 @@
+// Code generated by protoc-gen-go.
+// source: pkg/grpc/podclusterstore/protos/podclusterstore.proto
+// DO NOT EDIT!
+
+/*
+Package podclusterstore is a generated protocol buffer package.
+
+It is generated from these files:
+	pkg/grpc/podclusterstore/protos/podclusterstore.proto
+
+It has these top-level messages:
+	PodCluster
+	CreatePodClusterRequest
+	CreatePodClusterResponse
+	GetPodClusterRequest
+	GetPodClusterResponse
+	UpdatePodClusterRequest
+	UpdatePodClusterResponse
+	DeletePodClusterRequest
+	DeletePodClusterResponse
+	WatchPodClustersRequest
+	WatchPodClustersResponse
+*/
+package podclusterstore
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+// models fields.PodCluster
+type PodCluster struct {
+	Id               string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	PodId            string `protobuf:"bytes,2,opt,name=pod_id,json=podId" json:"pod_id,omitempty"`
+	AvailabilityZone string `protobuf:"bytes,3,opt,name=availability_zone,json=availabilityZone" json:"availability_zone,omitempty"`
+	Name             string `protobuf:"bytes,4,opt,name=name" json:"name,omitempty"`
+	PodSelector      string `protobuf:"bytes,5,opt,name=pod_selector,json=podSelector" json:"pod_selector,omitempty"`
+	// JSON encoded fields.Annotations
+	Annotations string `protobuf:"bytes,6,opt,name=annotations" json:"annotations,omitempty"`
+}
+
+func (m *PodCluster) Reset()                    { *m = PodCluster{} }
+func (m *PodCluster) String() string            { return proto.CompactTextString(m) }
+func (*PodCluster) ProtoMessage()               {}
+func (*PodCluster) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *PodCluster) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *PodCluster) GetPodId() string {
+	if m != nil {
+		return m.PodId
+	}
+	return ""
+}
+
+func (m *PodCluster) GetAvailabilityZone() string {
+	if m != nil {
+		return m.AvailabilityZone
+	}
+	return ""
+}
+
+func (m *PodCluster) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *PodCluster) GetPodSelector() string {
+	if m != nil {
+		return m.PodSelector
+	}
+	return ""
+}
+
+func (m *PodCluster) GetAnnotations() string {
+	if m != nil {
+		return m.Annotations
+	}
+	return ""
+}
+
+type CreatePodClusterRequest struct {
+	PodId            string `protobuf:"bytes,1,opt,name=pod_id,json=podId" json:"pod_id,omitempty"`
+	AvailabilityZone string `protobuf:"bytes,2,opt,name=availability_zone,json=availabilityZone" json:"availability_zone,omitempty"`
+	Name             string `protobuf:"bytes,3,opt,name=name" json:"name,omitempty"`
+	PodSelector      string `protobuf:"bytes,4,opt,name=pod_selector,json=podSelector" json:"pod_selector,omitempty"`
+	Annotations      string `protobuf:"bytes,5,opt,name=annotations" json:"annotations,omitempty"`
+}
+
+func (m *CreatePodClusterRequest) Reset()                    { *m = CreatePodClusterRequest{} }
+func (m *CreatePodClusterRequest) String() string            { return proto.CompactTextString(m) }
+func (*CreatePodClusterRequest) ProtoMessage()               {}
+func (*CreatePodClusterRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *CreatePodClusterRequest) GetPodId() string {
+	if m != nil {
+		return m.PodId
+	}
+	return ""
+}
+
+func (m *CreatePodClusterRequest) GetAvailabilityZone() string {
+	if m != nil {
+		return m.AvailabilityZone
+	}
+	return ""
+}
+
+func (m *CreatePodClusterRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *CreatePodClusterRequest) GetPodSelector() string {
+	if m != nil {
+		return m.PodSelector
+	}
+	return ""
+}
+
+func (m *CreatePodClusterRequest) GetAnnotations() string {
+	if m != nil {
+		return m.Annotations
+	}
+	return ""
+}
+
+type CreatePodClusterResponse struct {
+	PodCluster *PodCluster `protobuf:"bytes,1,opt,name=pod_cluster,json=podCluster" json:"pod_cluster,omitempty"`
+}
+
+func (m *CreatePodClusterResponse) Reset()                    { *m = CreatePodClusterResponse{} }
+func (m *CreatePodClusterResponse) String() string            { return proto.CompactTextString(m) }
+func (*CreatePodClusterResponse) ProtoMessage()               {}
+func (*CreatePodClusterResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *CreatePodClusterResponse) GetPodCluster() *PodCluster {
+	if m != nil {
+		return m.PodCluster
+	}
+	return nil
+}
+
+type GetPodClusterRequest struct {
+	PodClusterId string `protobuf:"bytes,1,opt,name=pod_cluster_id,json=podClusterId" json:"pod_cluster_id,omitempty"`
+}
+
+func (m *GetPodClusterRequest) Reset()                    { *m = GetPodClusterRequest{} }
+func (m *GetPodClusterRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetPodClusterRequest) ProtoMessage()               {}
+func (*GetPodClusterRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *GetPodClusterRequest) GetPodClusterId() string {
+	if m != nil {
+		return m.PodClusterId
+	}
+	return ""
+}
+
+type GetPodClusterResponse struct {
+	PodCluster *PodCluster `protobuf:"bytes,1,opt,name=pod_cluster,json=podCluster" json:"pod_cluster,omitempty"`
+}
+
+func (m *GetPodClusterResponse) Reset()                    { *m = GetPodClusterResponse{} }
+func (m *GetPodClusterResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetPodClusterResponse) ProtoMessage()               {}
+func (*GetPodClusterResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *GetPodClusterResponse) GetPodCluster() *PodCluster {
+	if m != nil {
+		return m.PodCluster
+	}
+	return nil
+}
+
+// Replaces the annotations of the pod cluster, and its pod selector if
+// pod_selector is non-empty
+type UpdatePodClusterRequest struct {
+	PodClusterId string `protobuf:"bytes,1,opt,name=pod_cluster_id,json=podClusterId" json:"pod_cluster_id,omitempty"`
+	PodSelector  string `protobuf:"bytes,2,opt,name=pod_selector,json=podSelector" json:"pod_selector,omitempty"`
+	Annotations  string `protobuf:"bytes,3,opt,name=annotations" json:"annotations,omitempty"`
+}
+
+func (m *UpdatePodClusterRequest) Reset()                    { *m = UpdatePodClusterRequest{} }
+func (m *UpdatePodClusterRequest) String() string            { return proto.CompactTextString(m) }
+func (*UpdatePodClusterRequest) ProtoMessage()               {}
+func (*UpdatePodClusterRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *UpdatePodClusterRequest) GetPodClusterId() string {
+	if m != nil {
+		return m.PodClusterId
+	}
+	return ""
+}
+
+func (m *UpdatePodClusterRequest) GetPodSelector() string {
+	if m != nil {
+		return m.PodSelector
+	}
+	return ""
+}
+
+func (m *UpdatePodClusterRequest) GetAnnotations() string {
+	if m != nil {
+		return m.Annotations
+	}
+	return ""
+}
+
+type UpdatePodClusterResponse struct {
+	PodCluster *PodCluster `protobuf:"bytes,1,opt,name=pod_cluster,json=podCluster" json:"pod_cluster,omitempty"`
+}
+
+func (m *UpdatePodClusterResponse) Reset()                    { *m = UpdatePodClusterResponse{} }
+func (m *UpdatePodClusterResponse) String() string            { return proto.CompactTextString(m) }
+func (*UpdatePodClusterResponse) ProtoMessage()               {}
+func (*UpdatePodClusterResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *UpdatePodClusterResponse) GetPodCluster() *PodCluster {
+	if m != nil {
+		return m.PodCluster
+	}
+	return nil
+}
+
+type DeletePodClusterRequest struct {
+	PodClusterId string `protobuf:"bytes,1,opt,name=pod_cluster_id,json=podClusterId" json:"pod_cluster_id,omitempty"`
+}
+
+func (m *DeletePodClusterRequest) Reset()                    { *m = DeletePodClusterRequest{} }
+func (m *DeletePodClusterRequest) String() string            { return proto.CompactTextString(m) }
+func (*DeletePodClusterRequest) ProtoMessage()               {}
+func (*DeletePodClusterRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *DeletePodClusterRequest) GetPodClusterId() string {
+	if m != nil {
+		return m.PodClusterId
+	}
+	return ""
+}
+
+type DeletePodClusterResponse struct {
+}
+
+func (m *DeletePodClusterResponse) Reset()                    { *m = DeletePodClusterResponse{} }
+func (m *DeletePodClusterResponse) String() string            { return proto.CompactTextString(m) }
+func (*DeletePodClusterResponse) ProtoMessage()               {}
+func (*DeletePodClusterResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+type WatchPodClustersRequest struct {
+}
+
+func (m *WatchPodClustersRequest) Reset()                    { *m = WatchPodClustersRequest{} }
+func (m *WatchPodClustersRequest) String() string            { return proto.CompactTextString(m) }
+func (*WatchPodClustersRequest) ProtoMessage()               {}
+func (*WatchPodClustersRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+// models pcstore.WatchedPodClusters
+type WatchPodClustersResponse struct {
+	PodClusters []*PodCluster `protobuf:"bytes,1,rep,name=pod_clusters,json=podClusters" json:"pod_clusters,omitempty"`
+	Error       string        `protobuf:"bytes,2,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *WatchPodClustersResponse) Reset()                    { *m = WatchPodClustersResponse{} }
+func (m *WatchPodClustersResponse) String() string            { return proto.CompactTextString(m) }
+func (*WatchPodClustersResponse) ProtoMessage()               {}
+func (*WatchPodClustersResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *WatchPodClustersResponse) GetPodClusters() []*PodCluster {
+	if m != nil {
+		return m.PodClusters
+	}
+	return nil
+}
+
+func (m *WatchPodClustersResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*PodCluster)(nil), "podclusterstore.PodCluster")
+	proto.RegisterType((*CreatePodClusterRequest)(nil), "podclusterstore.CreatePodClusterRequest")
+	proto.RegisterType((*CreatePodClusterResponse)(nil), "podclusterstore.CreatePodClusterResponse")
+	proto.RegisterType((*GetPodClusterRequest)(nil), "podclusterstore.GetPodClusterRequest")
+	proto.RegisterType((*GetPodClusterResponse)(nil), "podclusterstore.GetPodClusterResponse")
+	proto.RegisterType((*UpdatePodClusterRequest)(nil), "podclusterstore.UpdatePodClusterRequest")
+	proto.RegisterType((*UpdatePodClusterResponse)(nil), "podclusterstore.UpdatePodClusterResponse")
+	proto.RegisterType((*DeletePodClusterRequest)(nil), "podclusterstore.DeletePodClusterRequest")
+	proto.RegisterType((*DeletePodClusterResponse)(nil), "podclusterstore.DeletePodClusterResponse")
+	proto.RegisterType((*WatchPodClustersRequest)(nil), "podclusterstore.WatchPodClustersRequest")
+	proto.RegisterType((*WatchPodClustersResponse)(nil), "podclusterstore.WatchPodClustersResponse")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for P2PodClusterStore service
+
+type P2PodClusterStoreClient interface {
+	CreatePodCluster(ctx context.Context, in *CreatePodClusterRequest, opts ...grpc.CallOption) (*CreatePodClusterResponse, error)
+	GetPodCluster(ctx context.Context, in *GetPodClusterRequest, opts ...grpc.CallOption) (*GetPodClusterResponse, error)
+	UpdatePodCluster(ctx context.Context, in *UpdatePodClusterRequest, opts ...grpc.CallOption) (*UpdatePodClusterResponse, error)
+	DeletePodCluster(ctx context.Context, in *DeletePodClusterRequest, opts ...grpc.CallOption) (*DeletePodClusterResponse, error)
+	WatchPodClusters(ctx context.Context, in *WatchPodClustersRequest, opts ...grpc.CallOption) (P2PodClusterStore_WatchPodClustersClient, error)
+}
+
+type p2PodClusterStoreClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewP2PodClusterStoreClient(cc *grpc.ClientConn) P2PodClusterStoreClient {
+	return &p2PodClusterStoreClient{cc}
+}
+
+func (c *p2PodClusterStoreClient) CreatePodCluster(ctx context.Context, in *CreatePodClusterRequest, opts ...grpc.CallOption) (*CreatePodClusterResponse, error) {
+	out := new(CreatePodClusterResponse)
+	err := grpc.Invoke(ctx, "/podclusterstore.P2PodClusterStore/CreatePodCluster", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2PodClusterStoreClient) GetPodCluster(ctx context.Context, in *GetPodClusterRequest, opts ...grpc.CallOption) (*GetPodClusterResponse, error) {
+	out := new(GetPodClusterResponse)
+	err := grpc.Invoke(ctx, "/podclusterstore.P2PodClusterStore/GetPodCluster", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2PodClusterStoreClient) UpdatePodCluster(ctx context.Context, in *UpdatePodClusterRequest, opts ...grpc.CallOption) (*UpdatePodClusterResponse, error) {
+	out := new(UpdatePodClusterResponse)
+	err := grpc.Invoke(ctx, "/podclusterstore.P2PodClusterStore/UpdatePodCluster", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2PodClusterStoreClient) DeletePodCluster(ctx context.Context, in *DeletePodClusterRequest, opts ...grpc.CallOption) (*DeletePodClusterResponse, error) {
+	out := new(DeletePodClusterResponse)
+	err := grpc.Invoke(ctx, "/podclusterstore.P2PodClusterStore/DeletePodCluster", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *p2PodClusterStoreClient) WatchPodClusters(ctx context.Context, in *WatchPodClustersRequest, opts ...grpc.CallOption) (P2PodClusterStore_WatchPodClustersClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_P2PodClusterStore_serviceDesc.Streams[0], c.cc, "/podclusterstore.P2PodClusterStore/WatchPodClusters", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &p2PodClusterStoreWatchPodClustersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type P2PodClusterStore_WatchPodClustersClient interface {
+	Recv() (*WatchPodClustersResponse, error)
+	grpc.ClientStream
+}
+
+type p2PodClusterStoreWatchPodClustersClient struct {
+	grpc.ClientStream
+}
+
+func (x *p2PodClusterStoreWatchPodClustersClient) Recv() (*WatchPodClustersResponse, error) {
+	m := new(WatchPodClustersResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for P2PodClusterStore service
+
+type P2PodClusterStoreServer interface {
+	CreatePodCluster(context.Context, *CreatePodClusterRequest) (*CreatePodClusterResponse, error)
+	GetPodCluster(context.Context, *GetPodClusterRequest) (*GetPodClusterResponse, error)
+	UpdatePodCluster(context.Context, *UpdatePodClusterRequest) (*UpdatePodClusterResponse, error)
+	DeletePodCluster(context.Context, *DeletePodClusterRequest) (*DeletePodClusterResponse, error)
+	WatchPodClusters(*WatchPodClustersRequest, P2PodClusterStore_WatchPodClustersServer) error
+}
+
+func RegisterP2PodClusterStoreServer(s *grpc.Server, srv P2PodClusterStoreServer) {
+	s.RegisterService(&_P2PodClusterStore_serviceDesc, srv)
+}
+
+func _P2PodClusterStore_CreatePodCluster_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreatePodClusterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2PodClusterStoreServer).CreatePodCluster(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/podclusterstore.P2PodClusterStore/CreatePodCluster",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2PodClusterStoreServer).CreatePodCluster(ctx, req.(*CreatePodClusterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2PodClusterStore_GetPodCluster_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPodClusterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2PodClusterStoreServer).GetPodCluster(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/podclusterstore.P2PodClusterStore/GetPodCluster",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2PodClusterStoreServer).GetPodCluster(ctx, req.(*GetPodClusterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2PodClusterStore_UpdatePodCluster_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdatePodClusterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2PodClusterStoreServer).UpdatePodCluster(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/podclusterstore.P2PodClusterStore/UpdatePodCluster",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2PodClusterStoreServer).UpdatePodCluster(ctx, req.(*UpdatePodClusterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2PodClusterStore_DeletePodCluster_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeletePodClusterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2PodClusterStoreServer).DeletePodCluster(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/podclusterstore.P2PodClusterStore/DeletePodCluster",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2PodClusterStoreServer).DeletePodCluster(ctx, req.(*DeletePodClusterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _P2PodClusterStore_WatchPodClusters_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchPodClustersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(P2PodClusterStoreServer).WatchPodClusters(m, &p2PodClusterStoreWatchPodClustersServer{stream})
+}
+
+type P2PodClusterStore_WatchPodClustersServer interface {
+	Send(*WatchPodClustersResponse) error
+	grpc.ServerStream
+}
+
+type p2PodClusterStoreWatchPodClustersServer struct {
+	grpc.ServerStream
+}
+
+func (x *p2PodClusterStoreWatchPodClustersServer) Send(m *WatchPodClustersResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _P2PodClusterStore_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "podclusterstore.P2PodClusterStore",
+	HandlerType: (*P2PodClusterStoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreatePodCluster",
+			Handler:    _P2PodClusterStore_CreatePodCluster_Handler,
+		},
+		{
+			MethodName: "GetPodCluster",
+			Handler:    _P2PodClusterStore_GetPodCluster_Handler,
+		},
+		{
+			MethodName: "UpdatePodCluster",
+			Handler:    _P2PodClusterStore_UpdatePodCluster_Handler,
+		},
+		{
+			MethodName: "DeletePodCluster",
+			Handler:    _P2PodClusterStore_DeletePodCluster_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchPodClusters",
+			Handler:       _P2PodClusterStore_WatchPodClusters_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pkg/grpc/podclusterstore/protos/podclusterstore.proto",
+}
+
+func init() {
+	proto.RegisterFile("pkg/grpc/podclusterstore/protos/podclusterstore.proto", fileDescriptor0)
+}
+
+var fileDescriptor0 = []byte{
+	// 486 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x55, 0x5d, 0x6b, 0x13, 0x41,
+	0x14, 0x75, 0x37, 0x1f, 0xe0, 0x4d, 0xac, 0xe9, 0xd0, 0x92, 0x71, 0x7d, 0x89, 0x8b, 0x4a, 0x83,
+	0xd0, 0x48, 0xc4, 0xb7, 0xa2, 0x0f, 0x15, 0xa4, 0x6f, 0xa5, 0xa5, 0x28, 0xbe, 0xc4, 0x6d, 0xe6,
+	0x52, 0x87, 0xae, 0x3b, 0xe3, 0xcc, 0x54, 0xd0, 0x67, 0xff, 0x89, 0xff, 0x41, 0xf0, 0xdf, 0x49,
+	0x26, 0x6b, 0x76, 0x9d, 0xd9, 0x75, 0x97, 0x92, 0xb7, 0xcd, 0xfd, 0x3a, 0xe7, 0x9e, 0x7b, 0x86,
+	0xc0, 0x4b, 0x79, 0x7d, 0x35, 0xbb, 0x52, 0x72, 0x39, 0x93, 0x82, 0x2d, 0xd3, 0x1b, 0x6d, 0x50,
+	0x69, 0x23, 0x14, 0xce, 0xa4, 0x12, 0x46, 0x68, 0x37, 0x7c, 0x68, 0xc3, 0xe4, 0xbe, 0x13, 0x8e,
+	0x7f, 0x07, 0x00, 0xa7, 0x82, 0x1d, 0xaf, 0x63, 0x64, 0x07, 0x42, 0xce, 0x68, 0x30, 0x09, 0x0e,
+	0xee, 0x9e, 0x85, 0x9c, 0x91, 0x7d, 0xe8, 0x4b, 0xc1, 0x16, 0x9c, 0xd1, 0xd0, 0xc6, 0x7a, 0x52,
+	0xb0, 0x13, 0x46, 0x9e, 0xc1, 0x6e, 0xf2, 0x35, 0xe1, 0x69, 0x72, 0xc9, 0x53, 0x6e, 0xbe, 0x2d,
+	0xbe, 0x8b, 0x0c, 0x69, 0xc7, 0x56, 0x8c, 0xca, 0x89, 0x0f, 0x22, 0x43, 0x42, 0xa0, 0x9b, 0x25,
+	0x9f, 0x91, 0x76, 0x6d, 0xde, 0x7e, 0x93, 0x47, 0x30, 0x5c, 0xcd, 0xd5, 0x98, 0xe2, 0xd2, 0x08,
+	0x45, 0x7b, 0x36, 0x37, 0x90, 0x82, 0x9d, 0xe7, 0x21, 0x32, 0x81, 0x41, 0x92, 0x65, 0xc2, 0x24,
+	0x86, 0x8b, 0x4c, 0xd3, 0xfe, 0xba, 0xa2, 0x14, 0x8a, 0x7f, 0x05, 0x30, 0x3e, 0x56, 0x98, 0x18,
+	0x2c, 0x36, 0x38, 0xc3, 0x2f, 0x37, 0xa8, 0x4d, 0x89, 0x78, 0xd0, 0x48, 0x3c, 0x6c, 0x20, 0xde,
+	0xf9, 0x0f, 0xf1, 0x6e, 0x23, 0xf1, 0x9e, 0x4f, 0xfc, 0x3d, 0x50, 0x9f, 0xb7, 0x96, 0x22, 0xd3,
+	0x48, 0x8e, 0x60, 0x35, 0x6c, 0x91, 0x1f, 0xc9, 0xb2, 0x1f, 0xcc, 0x1f, 0x1e, 0xba, 0xe7, 0x2c,
+	0x75, 0x82, 0xdc, 0x7c, 0xc7, 0x47, 0xb0, 0xf7, 0x16, 0x8d, 0x2f, 0xc7, 0x63, 0xd8, 0x29, 0x4d,
+	0x2d, 0x64, 0x19, 0x16, 0xbd, 0x27, 0x2c, 0xbe, 0x80, 0x7d, 0xa7, 0x7b, 0x2b, 0xa4, 0x7e, 0x04,
+	0x30, 0xbe, 0x90, 0xac, 0xf2, 0x4e, 0xad, 0x88, 0x79, 0xaa, 0x87, 0x8d, 0xaa, 0x77, 0x2a, 0x55,
+	0xf7, 0x59, 0x6c, 0x65, 0xc1, 0xd7, 0x30, 0x7e, 0x83, 0x29, 0xde, 0x7a, 0xbf, 0x38, 0x02, 0xea,
+	0x0f, 0x58, 0x53, 0x8b, 0x1f, 0xc0, 0xf8, 0x5d, 0x62, 0x96, 0x9f, 0x8a, 0x94, 0xce, 0x87, 0xc7,
+	0x12, 0xa8, 0x9f, 0xca, 0x37, 0x7a, 0x05, 0xc3, 0x12, 0xb0, 0xa6, 0xc1, 0xa4, 0xd3, 0xb4, 0xd2,
+	0xa0, 0xe0, 0xa4, 0xc9, 0x1e, 0xf4, 0x50, 0xa9, 0x8d, 0xd6, 0xeb, 0x1f, 0xf3, 0x9f, 0x5d, 0xd8,
+	0x3d, 0x9d, 0x17, 0x3d, 0xe7, 0xab, 0x19, 0x84, 0xc3, 0xc8, 0xf5, 0x33, 0x39, 0xf0, 0x90, 0x6a,
+	0x9e, 0x6a, 0x34, 0x6d, 0x51, 0x99, 0x6b, 0x71, 0x87, 0x7c, 0x84, 0x7b, 0xff, 0x58, 0x94, 0x3c,
+	0xf1, 0xba, 0xab, 0x1e, 0x40, 0xf4, 0xb4, 0xa9, 0x6c, 0x83, 0xc0, 0x61, 0xe4, 0xda, 0xa4, 0x62,
+	0x99, 0x1a, 0x3f, 0x47, 0xd3, 0x16, 0x95, 0x65, 0x28, 0xf7, 0xec, 0x15, 0x50, 0x35, 0xd6, 0x8a,
+	0xa6, 0x2d, 0x2a, 0x37, 0x50, 0xd7, 0x30, 0x72, 0xad, 0x52, 0x01, 0x55, 0x63, 0xb4, 0x68, 0xda,
+	0xa2, 0xf2, 0x2f, 0xd4, 0xf3, 0xe0, 0xb2, 0x6f, 0xff, 0x6c, 0x5e, 0xfc, 0x19, 0x00, 0x89, 0x09,
+	0x87, 0x8a, 0xa5, 0x06, 0x00, 0x00,
+}
@@ -0,0 +1,58 @@
+package podeventstream
+
+import (
+	podeventstream_protos "github.com/square/p2/pkg/grpc/podeventstream/protos"
+	"github.com/square/p2/pkg/podevents"
+	"github.com/square/p2/pkg/types"
+)
+
+type Subscriber interface {
+	Subscribe() (<-chan podevents.Event, func())
+}
+
+type Server struct {
+	events Subscriber
+}
+
+func NewServer(events Subscriber) Server {
+	return Server{
+		events: events,
+	}
+}
+
+var _ podeventstream_protos.P2PodEventsServer = Server{}
+
+// WatchPodEvents sends each pod event published from the time of the request
+// until the client hangs up
+func (s Server) WatchPodEvents(req *podeventstream_protos.WatchPodEventsRequest, stream podeventstream_protos.P2PodEvents_WatchPodEventsServer) error {
+	events, unsubscribe := s.events.Subscribe()
+	defer unsubscribe()
+
+	podID := types.PodID(req.PodId)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-events:
+			if podID != "" && event.PodID != podID {
+				continue
+			}
+			err := stream.Send(EventToProto(event))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func EventToProto(event podevents.Event) *podeventstream_protos.PodEvent {
+	return &podeventstream_protos.PodEvent{
+		Node:         event.Node.String(),
+		PodId:        event.PodID.String(),
+		PodUniqueKey: event.PodUniqueKey.String(),
+		Type:         string(event.Type),
+		Sha:          event.SHA,
+		Time:         event.Time.UnixNano(),
+		Error:        event.Error,
+	}
+}
@@ -0,0 +1,84 @@
+package podeventstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	podeventstream_protos "github.com/square/p2/pkg/grpc/podeventstream/protos"
+	"github.com/square/p2/pkg/grpc/testutil"
+	"github.com/square/p2/pkg/podevents"
+)
+
+type TestWatchPodEventsStream struct {
+	*testutil.FakeServerStream
+
+	responseCh chan<- *podeventstream_protos.PodEvent
+}
+
+func (w TestWatchPodEventsStream) Send(resp *podeventstream_protos.PodEvent) error {
+	w.responseCh <- resp
+	return nil
+}
+
+// subscribeNotifier lets the test wait for the server to subscribe before
+// publishing, since events published before then aren't sent
+type subscribeNotifier struct {
+	*podevents.Broadcaster
+	subscribed chan struct{}
+}
+
+func (s subscribeNotifier) Subscribe() (<-chan podevents.Event, func()) {
+	events, unsubscribe := s.Broadcaster.Subscribe()
+	close(s.subscribed)
+	return events, unsubscribe
+}
+
+func TestWatchPodEvents(t *testing.T) {
+	broadcaster := podevents.NewBroadcaster()
+	subscribed := make(chan struct{})
+	server := NewServer(subscribeNotifier{Broadcaster: broadcaster, subscribed: subscribed})
+
+	respCh := make(chan *podeventstream_protos.PodEvent)
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	serverExit := make(chan struct{})
+	go func() {
+		defer close(serverExit)
+		err := server.WatchPodEvents(&podeventstream_protos.WatchPodEventsRequest{PodId: "web"}, TestWatchPodEventsStream{
+			FakeServerStream: testutil.NewFakeServerStream(ctx),
+			responseCh:       respCh,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	<-subscribed
+
+	now := time.Now()
+	broadcaster.Publish(podevents.Event{Node: "node1", PodID: "other", Type: podevents.InstallStarted, Time: now})
+	broadcaster.Publish(podevents.Event{Node: "node1", PodID: "web", Type: podevents.LaunchFailed, SHA: "abc123", Time: now, Error: "boom"})
+
+	select {
+	case resp := <-respCh:
+		if resp.PodId != "web" {
+			t.Errorf("expected only events of the requested pod to be sent, got one for %s", resp.PodId)
+		}
+		if resp.Type != string(podevents.LaunchFailed) || resp.Sha != "abc123" || resp.Error != "boom" {
+			t.Errorf("event was not converted correctly: %s", resp)
+		}
+		if resp.Time != now.UnixNano() {
+			t.Errorf("expected time %d, got %d", now.UnixNano(), resp.Time)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+
+	cancelFunc()
+	select {
+	case <-serverExit:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't exit after the client hung up")
+	}
+}
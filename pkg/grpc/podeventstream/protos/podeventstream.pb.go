@@ -0,0 +1,246 @@
+// Code generated by protoc-gen-go.
+// source: pkg/grpc/podeventstream/protos/podeventstream.proto
+// DO NOT EDIT!
+
+/*
+Package podeventstream is a generated protocol buffer package.
+
+It is generated from these files:
+	pkg/grpc/podeventstream/protos/podeventstream.proto
+
+It has these top-level messages:
+	WatchPodEventsRequest
+	PodEvent
+*/
+package podeventstream
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type WatchPodEventsRequest struct {
+	// if set, only the events of this pod are sent
+	PodId string `protobuf:"bytes,1,opt,name=pod_id,json=podId" json:"pod_id,omitempty"`
+}
+
+func (m *WatchPodEventsRequest) Reset()                    { *m = WatchPodEventsRequest{} }
+func (m *WatchPodEventsRequest) String() string            { return proto.CompactTextString(m) }
+func (*WatchPodEventsRequest) ProtoMessage()               {}
+func (*WatchPodEventsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *WatchPodEventsRequest) GetPodId() string {
+	if m != nil {
+		return m.PodId
+	}
+	return ""
+}
+
+// models podevents.Event
+type PodEvent struct {
+	Node         string `protobuf:"bytes,1,opt,name=node" json:"node,omitempty"`
+	PodId        string `protobuf:"bytes,2,opt,name=pod_id,json=podId" json:"pod_id,omitempty"`
+	PodUniqueKey string `protobuf:"bytes,3,opt,name=pod_unique_key,json=podUniqueKey" json:"pod_unique_key,omitempty"`
+	Type         string `protobuf:"bytes,4,opt,name=type" json:"type,omitempty"`
+	Sha          string `protobuf:"bytes,5,opt,name=sha" json:"sha,omitempty"`
+	// expressed in nanoseconds since the unix epoch
+	Time  int64  `protobuf:"varint,6,opt,name=time" json:"time,omitempty"`
+	Error string `protobuf:"bytes,7,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *PodEvent) Reset()                    { *m = PodEvent{} }
+func (m *PodEvent) String() string            { return proto.CompactTextString(m) }
+func (*PodEvent) ProtoMessage()               {}
+func (*PodEvent) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *PodEvent) GetNode() string {
+	if m != nil {
+		return m.Node
+	}
+	return ""
+}
+
+func (m *PodEvent) GetPodId() string {
+	if m != nil {
+		return m.PodId
+	}
+	return ""
+}
+
+func (m *PodEvent) GetPodUniqueKey() string {
+	if m != nil {
+		return m.PodUniqueKey
+	}
+	return ""
+}
+
+func (m *PodEvent) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *PodEvent) GetSha() string {
+	if m != nil {
+		return m.Sha
+	}
+	return ""
+}
+
+func (m *PodEvent) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *PodEvent) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*WatchPodEventsRequest)(nil), "podeventstream.WatchPodEventsRequest")
+	proto.RegisterType((*PodEvent)(nil), "podeventstream.PodEvent")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for P2PodEvents service
+
+type P2PodEventsClient interface {
+	WatchPodEvents(ctx context.Context, in *WatchPodEventsRequest, opts ...grpc.CallOption) (P2PodEvents_WatchPodEventsClient, error)
+}
+
+type p2PodEventsClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewP2PodEventsClient(cc *grpc.ClientConn) P2PodEventsClient {
+	return &p2PodEventsClient{cc}
+}
+
+func (c *p2PodEventsClient) WatchPodEvents(ctx context.Context, in *WatchPodEventsRequest, opts ...grpc.CallOption) (P2PodEvents_WatchPodEventsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_P2PodEvents_serviceDesc.Streams[0], c.cc, "/podeventstream.P2PodEvents/WatchPodEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &p2PodEventsWatchPodEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type P2PodEvents_WatchPodEventsClient interface {
+	Recv() (*PodEvent, error)
+	grpc.ClientStream
+}
+
+type p2PodEventsWatchPodEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *p2PodEventsWatchPodEventsClient) Recv() (*PodEvent, error) {
+	m := new(PodEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for P2PodEvents service
+
+type P2PodEventsServer interface {
+	WatchPodEvents(*WatchPodEventsRequest, P2PodEvents_WatchPodEventsServer) error
+}
+
+func RegisterP2PodEventsServer(s *grpc.Server, srv P2PodEventsServer) {
+	s.RegisterService(&_P2PodEvents_serviceDesc, srv)
+}
+
+func _P2PodEvents_WatchPodEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchPodEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(P2PodEventsServer).WatchPodEvents(m, &p2PodEventsWatchPodEventsServer{stream})
+}
+
+type P2PodEvents_WatchPodEventsServer interface {
+	Send(*PodEvent) error
+	grpc.ServerStream
+}
+
+type p2PodEventsWatchPodEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *p2PodEventsWatchPodEventsServer) Send(m *PodEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _P2PodEvents_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "podeventstream.P2PodEvents",
+	HandlerType: (*P2PodEventsServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchPodEvents",
+			Handler:       _P2PodEvents_WatchPodEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pkg/grpc/podeventstream/protos/podeventstream.proto",
+}
+
+func init() {
+	proto.RegisterFile("pkg/grpc/podeventstream/protos/podeventstream.proto", fileDescriptor0)
+}
+
+var fileDescriptor0 = []byte{
+	// 246 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x6c, 0x90, 0xc1, 0x4a, 0xc3, 0x40,
+	0x10, 0x86, 0x5d, 0xd3, 0x44, 0x1d, 0xa5, 0xc8, 0x62, 0x61, 0xf1, 0x54, 0x82, 0x42, 0x4f, 0x89,
+	0xb4, 0xcf, 0xe0, 0x41, 0xbc, 0x94, 0x40, 0xf1, 0x18, 0x62, 0x67, 0x68, 0x43, 0x69, 0x66, 0xbb,
+	0xd9, 0x08, 0x79, 0x26, 0x5f, 0x52, 0x32, 0xb5, 0xd2, 0x04, 0x6f, 0xff, 0x7e, 0xfb, 0xcd, 0x0c,
+	0x33, 0xb0, 0xb0, 0xbb, 0x4d, 0xba, 0x71, 0x76, 0x9d, 0x5a, 0x46, 0xfa, 0xa2, 0xca, 0xd7, 0xde,
+	0x51, 0xb1, 0x4f, 0xad, 0x63, 0xcf, 0xf5, 0x80, 0x26, 0x42, 0xf5, 0xb8, 0x4f, 0xe3, 0x04, 0x26,
+	0x1f, 0x85, 0x5f, 0x6f, 0x97, 0x8c, 0xaf, 0x82, 0x33, 0x3a, 0x34, 0x54, 0x7b, 0x3d, 0x81, 0xc8,
+	0x32, 0xe6, 0x25, 0x1a, 0x35, 0x55, 0xb3, 0x9b, 0x2c, 0xb4, 0x8c, 0x6f, 0x18, 0x7f, 0x2b, 0xb8,
+	0x3e, 0xb9, 0x5a, 0xc3, 0xa8, 0x62, 0xa4, 0x5f, 0x43, 0xf2, 0x59, 0xdd, 0xe5, 0x59, 0x9d, 0x7e,
+	0x82, 0x6e, 0x72, 0xde, 0x54, 0xe5, 0xa1, 0xa1, 0x7c, 0x47, 0xad, 0x09, 0xe4, 0xfb, 0xce, 0x32,
+	0xae, 0x04, 0xbe, 0x53, 0xdb, 0x35, 0xf4, 0xad, 0x25, 0x33, 0x3a, 0x36, 0xec, 0xb2, 0xbe, 0x87,
+	0xa0, 0xde, 0x16, 0x26, 0x14, 0xd4, 0x45, 0xb1, 0xca, 0x3d, 0x99, 0x68, 0xaa, 0x66, 0x41, 0x26,
+	0x59, 0x3f, 0x40, 0x48, 0xce, 0xb1, 0x33, 0x57, 0xc7, 0xa9, 0xf2, 0x98, 0x23, 0xdc, 0x2e, 0xe7,
+	0x7f, 0xab, 0xe9, 0x15, 0x8c, 0xfb, 0xcb, 0xea, 0xe7, 0x64, 0x70, 0xa5, 0x7f, 0x8f, 0xf1, 0x68,
+	0x86, 0xda, 0xc9, 0x88, 0x2f, 0x5e, 0xd4, 0x67, 0x24, 0xa7, 0x5d, 0xfc, 0x0c, 0x00, 0x39, 0x5a,
+	0x54, 0xf9, 0x91, 0x01, 0x00, 0x00,
+}
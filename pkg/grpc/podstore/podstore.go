@@ -115,6 +115,11 @@ func (s store) WatchPodStatus(req *podstore_protos.WatchPodStatusRequest, stream
 		return grpc.Errorf(codes.Unavailable, err.Error())
 	}
 
+	manifestFormat, err := manifest.ParseFormat(req.ManifestFormat)
+	if err != nil {
+		return grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
 	clientCancel := stream.Context().Done()
 
 	var waitIndex uint64
@@ -138,7 +143,10 @@ func (s store) WatchPodStatus(req *podstore_protos.WatchPodStatusRequest, stream
 			if err != nil {
 				return convertStatusStoreError(err)
 			}
-			resp := PodStatusToResp(status)
+			resp, err := formattedPodStatusResp(status, manifestFormat)
+			if err != nil {
+				return err
+			}
 
 			err = stream.Send(resp)
 			if err != nil {
@@ -191,7 +199,10 @@ func (s store) WatchPodStatus(req *podstore_protos.WatchPodStatusRequest, stream
 				return convertStatusStoreError(result.err)
 			}
 
-			resp := PodStatusToResp(result.status)
+			resp, err := formattedPodStatusResp(result.status, manifestFormat)
+			if err != nil {
+				return err
+			}
 
 			err = stream.Send(resp)
 			if err != nil {
@@ -207,6 +218,11 @@ func (s store) ListPodStatus(_ context.Context, req *podstore_protos.ListPodStat
 		return nil, grpc.Errorf(codes.InvalidArgument, "%q is not an understood namespace, must be %q", req.StatusNamespace, consul.PreparerPodStatusNamespace)
 	}
 
+	manifestFormat, err := manifest.ParseFormat(req.ManifestFormat)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%s", err)
+	}
+
 	statusMap, err := s.podStatusStore.List()
 	if err != nil {
 		return nil, grpc.Errorf(codes.Unavailable, "error listing pod status: %s", err)
@@ -214,7 +230,11 @@ func (s store) ListPodStatus(_ context.Context, req *podstore_protos.ListPodStat
 
 	ret := make(map[string]*podstore_protos.PodStatusResponse)
 	for podUniqueKey, status := range statusMap {
-		ret[podUniqueKey.String()] = PodStatusToResp(status)
+		resp, err := formattedPodStatusResp(status, manifestFormat)
+		if err != nil {
+			return nil, err
+		}
+		ret[podUniqueKey.String()] = resp
 	}
 
 	return &podstore_protos.ListPodStatusResponse{
@@ -297,6 +317,27 @@ func PodStatusToResp(podStatus podstatus.PodStatus) *podstore_protos.PodStatusRe
 	}
 }
 
+// formattedPodStatusResp converts a pod status to a response whose manifest is
+// in the format the client asked for. Manifests are stored as YAML, so only
+// JSON needs converting.
+func formattedPodStatusResp(podStatus podstatus.PodStatus, format manifest.Format) (*podstore_protos.PodStatusResponse, error) {
+	resp := PodStatusToResp(podStatus)
+	if format == manifest.YAMLFormat || resp.Manifest == "" {
+		return resp, nil
+	}
+
+	podManifest, err := manifest.FromBytes([]byte(resp.Manifest))
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "could not parse the stored manifest: %s", err)
+	}
+	manifestBytes, err := manifest.MarshalFormat(podManifest, format)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "could not marshal the manifest as %s: %s", format, err)
+	}
+	resp.Manifest = string(manifestBytes)
+	return resp, nil
+}
+
 func PodStatusResponseToPodStatus(resp podstore_protos.PodStatusResponse) podstatus.PodStatus {
 	var ret podstatus.PodStatus
 	ret.PodStatus = podstatus.PodState(resp.PodState)
@@ -1,6 +1,7 @@
 package podstore
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -318,6 +319,47 @@ func TestListPodStatus(t *testing.T) {
 	}
 }
 
+func TestListPodStatusAsJSON(t *testing.T) {
+	statusStore, server := setupServerWithFakePodStatusStore()
+	key := types.NewPodUUID()
+	err := statusStore.Set(key, podstatus.PodStatus{
+		PodStatus: podstatus.PodLaunched,
+		Manifest:  "id: some_pod\nstatus:\n  port: 8080\n",
+	})
+	if err != nil {
+		t.Fatalf("unable to seed status store with a pod status: %s", err)
+	}
+
+	_, err = server.ListPodStatus(context.Background(), &podstore_protos.ListPodStatusRequest{
+		StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+		ManifestFormat:  "xml",
+	})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected an unknown manifest format to be an invalid argument but got %v", err)
+	}
+
+	results, err := server.ListPodStatus(context.Background(), &podstore_protos.ListPodStatusRequest{
+		StatusNamespace: consul.PreparerPodStatusNamespace.String(),
+		ManifestFormat:  "json",
+	})
+	if err != nil {
+		t.Fatalf("error listing pod status: %s", err)
+	}
+
+	val, ok := results.PodStatuses[key.String()]
+	if !ok {
+		t.Fatalf("expected a record for pod %s but there wasn't", key)
+	}
+	var decoded map[string]interface{}
+	err = json.Unmarshal([]byte(val.Manifest), &decoded)
+	if err != nil {
+		t.Fatalf("expected the manifest to be JSON but it was %q: %s", val.Manifest, err)
+	}
+	if decoded["id"] != "some_pod" {
+		t.Errorf("expected the JSON manifest to have id %q but it was %v", "some_pod", decoded["id"])
+	}
+}
+
 func TestDeletePodStatus(t *testing.T) {
 	statusStore, server := setupServerWithFakePodStatusStore()
 	key := types.NewPodUUID()
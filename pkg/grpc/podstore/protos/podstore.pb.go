@@ -90,6 +90,7 @@ type WatchPodStatusRequest struct {
 	PodUniqueKey    string `protobuf:"bytes,1,opt,name=pod_unique_key,json=podUniqueKey" json:"pod_unique_key,omitempty"`
 	StatusNamespace string `protobuf:"bytes,3,opt,name=status_namespace,json=statusNamespace" json:"status_namespace,omitempty"`
 	WaitForExists   bool   `protobuf:"varint,4,opt,name=wait_for_exists,json=waitForExists" json:"wait_for_exists,omitempty"`
+	ManifestFormat  string `protobuf:"bytes,5,opt,name=manifest_format,json=manifestFormat" json:"manifest_format,omitempty"`
 }
 
 func (m *WatchPodStatusRequest) Reset()                    { *m = WatchPodStatusRequest{} }
@@ -118,6 +119,13 @@ func (m *WatchPodStatusRequest) GetWaitForExists() bool {
 	return false
 }
 
+func (m *WatchPodStatusRequest) GetManifestFormat() string {
+	if m != nil {
+		return m.ManifestFormat
+	}
+	return ""
+}
+
 type PodStatusResponse struct {
 	Manifest        string           `protobuf:"bytes,1,opt,name=manifest" json:"manifest,omitempty"`
 	PodState        string           `protobuf:"bytes,2,opt,name=pod_state,json=podState" json:"pod_state,omitempty"`
@@ -240,6 +248,7 @@ func (*UnschedulePodResponse) Descriptor() ([]byte, []int) { return fileDescript
 
 type ListPodStatusRequest struct {
 	StatusNamespace string `protobuf:"bytes,1,opt,name=status_namespace,json=statusNamespace" json:"status_namespace,omitempty"`
+	ManifestFormat  string `protobuf:"bytes,2,opt,name=manifest_format,json=manifestFormat" json:"manifest_format,omitempty"`
 }
 
 func (m *ListPodStatusRequest) Reset()                    { *m = ListPodStatusRequest{} }
@@ -254,6 +263,13 @@ func (m *ListPodStatusRequest) GetStatusNamespace() string {
 	return ""
 }
 
+func (m *ListPodStatusRequest) GetManifestFormat() string {
+	if m != nil {
+		return m.ManifestFormat
+	}
+	return ""
+}
+
 type ListPodStatusResponse struct {
 	PodStatuses map[string]*PodStatusResponse `protobuf:"bytes,1,rep,name=pod_statuses,json=podStatuses" json:"pod_statuses,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 }
@@ -605,48 +621,49 @@ var _P2PodStore_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("pkg/grpc/podstore/protos/podstore.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 675 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x9c, 0x55, 0x4d, 0x6f, 0xd3, 0x4a,
-	0x14, 0x8d, 0x9b, 0xbe, 0xa7, 0xf4, 0xa6, 0x69, 0xf2, 0xe6, 0xa5, 0x34, 0xa4, 0x40, 0xc3, 0x80,
-	0xa0, 0x6c, 0xfa, 0x11, 0x36, 0x08, 0x2a, 0x24, 0x3e, 0x5a, 0x09, 0xd1, 0x56, 0x91, 0x4b, 0x05,
-	0x12, 0x0b, 0x6b, 0x6a, 0xdf, 0xb6, 0x56, 0x1d, 0xcf, 0xd4, 0x33, 0x86, 0x76, 0xcf, 0x82, 0x25,
-	0x7f, 0x8b, 0x7f, 0x85, 0x66, 0xec, 0xd8, 0x4e, 0xe2, 0x96, 0xc2, 0x2e, 0xf7, 0xdc, 0x8f, 0x39,
-	0x73, 0xee, 0xc9, 0x18, 0x1e, 0x8b, 0xb3, 0x93, 0xf5, 0x93, 0x48, 0xb8, 0xeb, 0x82, 0x7b, 0x52,
-	0xf1, 0x08, 0xd7, 0x45, 0xc4, 0x15, 0x97, 0x59, 0xbc, 0x66, 0x62, 0x52, 0x1b, 0xc5, 0x74, 0x0f,
-	0xc8, 0x81, 0x7b, 0x8a, 0x5e, 0x1c, 0xe0, 0x80, 0x7b, 0x36, 0x9e, 0xc7, 0x28, 0x15, 0xe9, 0x42,
-	0x6d, 0xc8, 0x42, 0xff, 0x18, 0xa5, 0xea, 0x58, 0x3d, 0x6b, 0x75, 0xce, 0xce, 0x62, 0xb2, 0x0c,
-	0x73, 0x21, 0xf7, 0xd0, 0x09, 0xd9, 0x10, 0x3b, 0x33, 0x49, 0x52, 0x03, 0xfb, 0x6c, 0x88, 0xf4,
-	0x05, 0xfc, 0x3f, 0x36, 0x4e, 0x0a, 0x1e, 0x4a, 0x24, 0x0f, 0x61, 0x41, 0x70, 0xcf, 0x89, 0x43,
-	0xff, 0x3c, 0x46, 0xe7, 0x0c, 0x2f, 0xd3, 0xa9, 0xf3, 0x82, 0x7b, 0x87, 0x06, 0x7c, 0x8f, 0x97,
-	0xf4, 0x87, 0x05, 0x8b, 0x1f, 0x99, 0x72, 0x4f, 0x07, 0xdc, 0x3b, 0x50, 0x4c, 0xc5, 0x72, 0xc4,
-	0xe7, 0x46, 0xfd, 0xe4, 0x09, 0xb4, 0xa4, 0x69, 0x33, 0xdc, 0xa4, 0x60, 0x2e, 0x76, 0xaa, 0xa6,
-	0xae, 0x99, 0xe0, 0xfb, 0x23, 0x98, 0x3c, 0x82, 0xe6, 0x57, 0xe6, 0x2b, 0xe7, 0x98, 0x47, 0x0e,
-	0x5e, 0xf8, 0x52, 0xc9, 0xce, 0x6c, 0xcf, 0x5a, 0xad, 0xd9, 0x0d, 0x0d, 0xef, 0xf0, 0x68, 0xdb,
-	0x80, 0x9a, 0xd2, 0x7f, 0x05, 0x36, 0xe9, 0x75, 0x7e, 0x23, 0x8f, 0xa6, 0xaa, 0x0f, 0xcc, 0xe4,
-	0x11, 0xc9, 0x04, 0x24, 0xaf, 0xa1, 0x25, 0x22, 0xee, 0xa2, 0x94, 0x4e, 0xc2, 0x08, 0x65, 0xa7,
-	0xda, 0xab, 0xae, 0xd6, 0xfb, 0x4b, 0x6b, 0xd9, 0x8a, 0x06, 0x49, 0x45, 0x7a, 0x66, 0x53, 0x14,
-	0x43, 0x94, 0xf4, 0xbb, 0x05, 0x8d, 0xb1, 0x12, 0xf2, 0x00, 0x1a, 0x01, 0x8b, 0x43, 0xf7, 0x94,
-	0x1d, 0x05, 0xe8, 0xf8, 0xde, 0x48, 0x9c, 0x1c, 0x7c, 0xe7, 0x91, 0x15, 0xa8, 0x63, 0xa8, 0xa2,
-	0x4b, 0x47, 0x70, 0x3f, 0x54, 0x29, 0x33, 0x30, 0xd0, 0x40, 0x23, 0x64, 0x13, 0xe6, 0x02, 0x26,
-	0x95, 0x96, 0x43, 0x19, 0xd9, 0xea, 0xfd, 0x76, 0x4e, 0x6a, 0xfb, 0xc2, 0x57, 0x29, 0xa3, 0x9a,
-	0x2e, 0xd3, 0x31, 0x3d, 0x01, 0xc8, 0x71, 0x7d, 0x73, 0xdd, 0xeb, 0x28, 0x7f, 0x88, 0x86, 0x42,
-	0xd5, 0xae, 0x69, 0xe0, 0x83, 0x3f, 0xc4, 0x2c, 0xe9, 0x72, 0x2f, 0x91, 0x25, 0x4d, 0xbe, 0xe1,
-	0x1e, 0x1a, 0x6e, 0x3a, 0x99, 0x68, 0x62, 0x0e, 0xaf, 0xda, 0x80, 0xd9, 0x68, 0xba, 0x05, 0xed,
-	0xc3, 0x50, 0x4e, 0xfb, 0xf4, 0x66, 0xbe, 0x5a, 0x82, 0xc5, 0x89, 0xee, 0x64, 0x8f, 0xf4, 0x15,
-	0xb4, 0x77, 0x7d, 0xa9, 0xa6, 0xec, 0x56, 0x66, 0x24, 0xab, 0xd4, 0x48, 0xf4, 0xa7, 0x05, 0x8b,
-	0x13, 0x33, 0x52, 0x93, 0x1c, 0xc0, 0xfc, 0xc8, 0x08, 0x66, 0xcf, 0x96, 0xd9, 0xf3, 0x46, 0x2e,
-	0x69, 0x69, 0xdb, 0x5a, 0x86, 0xa0, 0xdc, 0xd6, 0xcb, 0xb1, 0xeb, 0x22, 0x47, 0xba, 0x9f, 0xa1,
-	0x35, 0x59, 0x40, 0x5a, 0x50, 0xcd, 0x6f, 0xae, 0x7f, 0x92, 0x4d, 0xf8, 0xe7, 0x0b, 0x0b, 0xe2,
-	0x44, 0xe8, 0x7a, 0x7f, 0xb9, 0xe0, 0xad, 0xc9, 0xf3, 0xec, 0xa4, 0xf2, 0xf9, 0xcc, 0x33, 0x8b,
-	0xbe, 0x84, 0x5b, 0x6f, 0x31, 0x40, 0x85, 0x7f, 0xf7, 0xff, 0xa3, 0xb7, 0x61, 0x69, 0xaa, 0x3f,
-	0x55, 0x7a, 0x0b, 0xda, 0x7b, 0x2c, 0x3a, 0x1b, 0x70, 0x6f, 0x87, 0xf9, 0x01, 0xfe, 0xf9, 0x02,
-	0x27, 0xba, 0x93, 0xb1, 0xfd, 0x6f, 0xb3, 0x00, 0x83, 0xbe, 0x39, 0x8e, 0x47, 0x48, 0x76, 0xa1,
-	0x5e, 0x78, 0x7d, 0xc8, 0x9d, 0xfc, 0xde, 0xd3, 0x6f, 0x5c, 0xf7, 0xee, 0x15, 0xd9, 0x94, 0x71,
-	0x85, 0xd8, 0xb0, 0x30, 0xfe, 0x1a, 0x91, 0x95, 0xbc, 0xa5, 0xf4, 0x9d, 0xea, 0x5e, 0xa7, 0x34,
-	0xad, 0x6c, 0x58, 0xc4, 0x86, 0xc6, 0x98, 0x15, 0xc9, 0xbd, 0xbc, 0xa3, 0xcc, 0xe1, 0xdd, 0x95,
-	0x2b, 0xf3, 0x05, 0x9e, 0x8d, 0x31, 0x2b, 0x15, 0x67, 0x96, 0xd9, 0xbb, 0x38, 0xb3, 0xd4, 0x83,
-	0xb4, 0x42, 0x3e, 0x41, 0x73, 0x62, 0x95, 0xa4, 0x97, 0x77, 0x95, 0xbb, 0xa4, 0x7b, 0xff, 0x9a,
-	0x8a, 0x22, 0xdb, 0xb1, 0x5d, 0x16, 0xd9, 0x96, 0x59, 0xa4, 0xc8, 0xb6, 0xd4, 0x04, 0xb4, 0x72,
-	0xf4, 0xaf, 0xf9, 0xaa, 0x3d, 0xfd, 0x15, 0x00, 0x00, 0xff, 0xff, 0xde, 0x69, 0x60, 0xc2, 0x00,
-	0x07, 0x00, 0x00,
+	// 696 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x9c, 0x55, 0x5d, 0x53, 0xd3, 0x4c,
+	0x14, 0x26, 0x14, 0xde, 0x29, 0xa7, 0x94, 0xf6, 0x5d, 0x8b, 0xd4, 0xa0, 0xb6, 0x46, 0x47, 0xf0,
+	0x86, 0x8f, 0x7a, 0xe3, 0x28, 0xe3, 0x85, 0x0a, 0x33, 0x8e, 0xc0, 0x74, 0x82, 0x8c, 0xce, 0x78,
+	0x91, 0x59, 0x92, 0x03, 0x44, 0xd2, 0x6c, 0xc8, 0x6e, 0x94, 0xde, 0x7b, 0xe1, 0xa5, 0x7f, 0xc7,
+	0x9f, 0xe0, 0xbf, 0x72, 0x76, 0xf3, 0xd9, 0x36, 0x45, 0xf4, 0xae, 0xe7, 0x39, 0x1f, 0xfb, 0xec,
+	0x73, 0x9e, 0x6c, 0x61, 0x2d, 0xb8, 0x38, 0xdb, 0x3c, 0x0b, 0x03, 0x7b, 0x33, 0x60, 0x0e, 0x17,
+	0x2c, 0xc4, 0xcd, 0x20, 0x64, 0x82, 0xf1, 0x2c, 0xde, 0x50, 0x31, 0xa9, 0xa6, 0xb1, 0x71, 0x00,
+	0xe4, 0xc8, 0x3e, 0x47, 0x27, 0xf2, 0xb0, 0xcf, 0x1c, 0x13, 0x2f, 0x23, 0xe4, 0x82, 0xe8, 0x50,
+	0x1d, 0x50, 0xdf, 0x3d, 0x45, 0x2e, 0xda, 0x5a, 0x57, 0x5b, 0x5f, 0x30, 0xb3, 0x98, 0xac, 0xc2,
+	0x82, 0xcf, 0x1c, 0xb4, 0x7c, 0x3a, 0xc0, 0xf6, 0x6c, 0x9c, 0x94, 0xc0, 0x21, 0x1d, 0xa0, 0xf1,
+	0x02, 0x6e, 0x8d, 0x8c, 0xe3, 0x01, 0xf3, 0x39, 0x92, 0x47, 0xb0, 0x14, 0x30, 0xc7, 0x8a, 0x7c,
+	0xf7, 0x32, 0x42, 0xeb, 0x02, 0x87, 0xc9, 0xd4, 0xc5, 0x80, 0x39, 0xc7, 0x0a, 0x7c, 0x87, 0x43,
+	0xe3, 0xa7, 0x06, 0xcb, 0x1f, 0xa8, 0xb0, 0xcf, 0xfb, 0xcc, 0x39, 0x12, 0x54, 0x44, 0x3c, 0xe5,
+	0x73, 0xa3, 0x7e, 0xf2, 0x04, 0x9a, 0x5c, 0xb5, 0x29, 0x6e, 0x3c, 0xa0, 0x36, 0xb6, 0x2b, 0xaa,
+	0xae, 0x11, 0xe3, 0x87, 0x29, 0x4c, 0x1e, 0x43, 0xe3, 0x2b, 0x75, 0x85, 0x75, 0xca, 0x42, 0x0b,
+	0xaf, 0x5c, 0x2e, 0x78, 0x7b, 0xae, 0xab, 0xad, 0x57, 0xcd, 0xba, 0x84, 0xf7, 0x58, 0xb8, 0xab,
+	0x40, 0xb2, 0x06, 0x8d, 0xf4, 0xe2, 0xb2, 0x76, 0x40, 0x45, 0x7b, 0x5e, 0x4d, 0x5c, 0x4a, 0xe1,
+	0x3d, 0x85, 0x1a, 0x3f, 0x34, 0xf8, 0xbf, 0x40, 0x3b, 0xb9, 0xf7, 0x1f, 0x74, 0x94, 0x77, 0x92,
+	0xcc, 0x32, 0x1d, 0x83, 0x78, 0x02, 0x92, 0x57, 0xd0, 0x0c, 0x42, 0x66, 0x23, 0xe7, 0x56, 0x4c,
+	0x1d, 0x79, 0xbb, 0xd2, 0xad, 0xac, 0xd7, 0x7a, 0x2b, 0x1b, 0xd9, 0x2e, 0xfb, 0x71, 0x45, 0x72,
+	0x66, 0x23, 0x28, 0x86, 0xc8, 0x8d, 0xef, 0x1a, 0xd4, 0x47, 0x4a, 0xc8, 0x43, 0xa8, 0x7b, 0x34,
+	0xf2, 0xed, 0x73, 0x7a, 0xe2, 0xa1, 0xe5, 0x3a, 0xa9, 0x8a, 0x39, 0xf8, 0xd6, 0x21, 0x1d, 0xa8,
+	0xa1, 0x2f, 0xc2, 0xa1, 0x15, 0x30, 0xd7, 0x17, 0x09, 0x33, 0x50, 0x50, 0x5f, 0x22, 0x64, 0x1b,
+	0x16, 0x3c, 0xca, 0x85, 0xd4, 0x4d, 0x28, 0x7d, 0x6b, 0xbd, 0x56, 0x4e, 0x6a, 0xf7, 0xca, 0x15,
+	0x09, 0xa3, 0xaa, 0x2c, 0x93, 0xb1, 0x71, 0x06, 0x90, 0xe3, 0xf2, 0xe6, 0xb2, 0xd7, 0x12, 0xee,
+	0x00, 0x15, 0x85, 0x8a, 0x59, 0x95, 0xc0, 0x7b, 0x77, 0x80, 0x59, 0xd2, 0x66, 0x4e, 0x2c, 0x4b,
+	0x92, 0x7c, 0xcd, 0x1c, 0x54, 0xdc, 0x64, 0x32, 0xd6, 0x44, 0x1d, 0x5e, 0x31, 0x01, 0xb3, 0xd1,
+	0xc6, 0x0e, 0xb4, 0x8e, 0x7d, 0x3e, 0x69, 0xe8, 0x9b, 0x19, 0x70, 0x05, 0x96, 0xc7, 0xba, 0xe3,
+	0x3d, 0x1a, 0x9f, 0xa1, 0xb5, 0xef, 0x72, 0x31, 0xe1, 0xcb, 0x32, 0xc7, 0x69, 0xe5, 0x8e, 0x2b,
+	0x71, 0xd2, 0x6c, 0xa9, 0x93, 0x7e, 0x69, 0xb0, 0x3c, 0x76, 0x58, 0xe2, 0xa6, 0x23, 0x58, 0x4c,
+	0x1d, 0xa3, 0x0c, 0xa1, 0x29, 0x43, 0x6c, 0xe5, 0xda, 0x97, 0xb6, 0x6d, 0x64, 0x08, 0xf2, 0x5d,
+	0xb9, 0x45, 0xb3, 0x16, 0xe4, 0x88, 0xfe, 0x09, 0x9a, 0xe3, 0x05, 0xa4, 0x09, 0x95, 0x5c, 0x22,
+	0xf9, 0x93, 0x6c, 0xc3, 0xfc, 0x17, 0xea, 0x45, 0xf1, 0x46, 0x6a, 0xbd, 0xd5, 0x82, 0x09, 0xc7,
+	0xcf, 0x33, 0xe3, 0xca, 0xe7, 0xb3, 0xcf, 0x34, 0xe3, 0x25, 0xdc, 0x7e, 0x83, 0x1e, 0x0a, 0xfc,
+	0xb7, 0x2f, 0xda, 0xb8, 0x03, 0x2b, 0x13, 0xfd, 0xc9, 0x4a, 0x76, 0xa0, 0x75, 0x40, 0xc3, 0x8b,
+	0x3e, 0x73, 0xf6, 0xa8, 0xeb, 0xe1, 0xdf, 0x6f, 0x7a, 0xac, 0x3b, 0x1e, 0xdb, 0xfb, 0x36, 0x07,
+	0xd0, 0xef, 0xa9, 0xe3, 0x58, 0x88, 0x64, 0x1f, 0x6a, 0x85, 0xf7, 0x8c, 0xdc, 0xcd, 0xef, 0x3d,
+	0xf9, 0x6a, 0xea, 0xf7, 0xa6, 0x64, 0x13, 0xc6, 0x33, 0xc4, 0x84, 0xa5, 0xd1, 0xf7, 0x8d, 0x74,
+	0xf2, 0x96, 0xd2, 0x97, 0x4f, 0xbf, 0x4e, 0x69, 0x63, 0x66, 0x4b, 0x23, 0x26, 0xd4, 0x47, 0x3c,
+	0x4b, 0xee, 0xe7, 0x1d, 0x65, 0x9f, 0x82, 0xde, 0x99, 0x9a, 0x2f, 0xf0, 0xac, 0x8f, 0x58, 0xa9,
+	0x38, 0xb3, 0xec, 0x3b, 0xd0, 0x3b, 0x53, 0xf3, 0xd9, 0xcc, 0x8f, 0xd0, 0x18, 0x5b, 0x25, 0xe9,
+	0xe6, 0x5d, 0xe5, 0x2e, 0xd1, 0x1f, 0x5c, 0x53, 0x51, 0x64, 0x3b, 0xb2, 0xcb, 0x22, 0xdb, 0x32,
+	0x8b, 0xe8, 0x9d, 0xa9, 0xf9, 0x74, 0xe6, 0xc9, 0x7f, 0xea, 0x7f, 0xf2, 0xe9, 0xef, 0x01, 0x00,
+	0xfd, 0xcd, 0xf1, 0xa7, 0x52, 0x07, 0x00, 0x00,
 }
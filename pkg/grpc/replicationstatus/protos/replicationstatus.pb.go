@@ -0,0 +1,289 @@
+// Code generated by protoc-gen-go.
+// source: pkg/grpc/replicationstatus/protos/replicationstatus.proto
+// DO NOT EDIT!
+
+/*
+Package replicationstatus is a generated protocol buffer package.
+
+It is generated from these files:
+
+	pkg/grpc/replicationstatus/protos/replicationstatus.proto
+
+It has these top-level messages:
+
+	GetReplicationStatusRequest
+	GetReplicationStatusResponse
+	Replica
+*/
+package replicationstatus
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+// exactly one of rc_id and pod_cluster_id must be set
+type GetReplicationStatusRequest struct {
+	RcId         string `protobuf:"bytes,1,opt,name=rc_id,json=rcId" json:"rc_id,omitempty"`
+	PodClusterId string `protobuf:"bytes,2,opt,name=pod_cluster_id,json=podClusterId" json:"pod_cluster_id,omitempty"`
+}
+
+func (m *GetReplicationStatusRequest) Reset()                    { *m = GetReplicationStatusRequest{} }
+func (m *GetReplicationStatusRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetReplicationStatusRequest) ProtoMessage()               {}
+func (*GetReplicationStatusRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *GetReplicationStatusRequest) GetRcId() string {
+	if m != nil {
+		return m.RcId
+	}
+	return ""
+}
+
+func (m *GetReplicationStatusRequest) GetPodClusterId() string {
+	if m != nil {
+		return m.PodClusterId
+	}
+	return ""
+}
+
+// models rc.ReplicationStatus
+type GetReplicationStatusResponse struct {
+	PodId string `protobuf:"bytes,1,opt,name=pod_id,json=podId" json:"pod_id,omitempty"`
+	// that of the RC, or the sum of those of the pod cluster's RCs
+	ReplicasDesired int64 `protobuf:"varint,2,opt,name=replicas_desired,json=replicasDesired" json:"replicas_desired,omitempty"`
+	// one for each node the pod is scheduled on, sorted by node
+	Replicas []*Replica `protobuf:"bytes,3,rep,name=replicas" json:"replicas,omitempty"`
+	// the nodes of the replicas
+	Scheduled []string `protobuf:"bytes,4,rep,name=scheduled" json:"scheduled,omitempty"`
+	// the nodes of the replicas that are in reality
+	Installed []string `protobuf:"bytes,5,rep,name=installed" json:"installed,omitempty"`
+	// the nodes of the replicas that are installed and passing
+	Healthy []string `protobuf:"bytes,6,rep,name=healthy" json:"healthy,omitempty"`
+}
+
+func (m *GetReplicationStatusResponse) Reset()                    { *m = GetReplicationStatusResponse{} }
+func (m *GetReplicationStatusResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetReplicationStatusResponse) ProtoMessage()               {}
+func (*GetReplicationStatusResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *GetReplicationStatusResponse) GetPodId() string {
+	if m != nil {
+		return m.PodId
+	}
+	return ""
+}
+
+func (m *GetReplicationStatusResponse) GetReplicasDesired() int64 {
+	if m != nil {
+		return m.ReplicasDesired
+	}
+	return 0
+}
+
+func (m *GetReplicationStatusResponse) GetReplicas() []*Replica {
+	if m != nil {
+		return m.Replicas
+	}
+	return nil
+}
+
+func (m *GetReplicationStatusResponse) GetScheduled() []string {
+	if m != nil {
+		return m.Scheduled
+	}
+	return nil
+}
+
+func (m *GetReplicationStatusResponse) GetInstalled() []string {
+	if m != nil {
+		return m.Installed
+	}
+	return nil
+}
+
+func (m *GetReplicationStatusResponse) GetHealthy() []string {
+	if m != nil {
+		return m.Healthy
+	}
+	return nil
+}
+
+// models rc.ReplicaStatus
+type Replica struct {
+	Node string `protobuf:"bytes,1,opt,name=node" json:"node,omitempty"`
+	// the RC that scheduled the replica, if any
+	RcId      string `protobuf:"bytes,2,opt,name=rc_id,json=rcId" json:"rc_id,omitempty"`
+	Installed bool   `protobuf:"varint,3,opt,name=installed" json:"installed,omitempty"`
+	// true if the pod in reality is the one in intent
+	Current bool `protobuf:"varint,4,opt,name=current" json:"current,omitempty"`
+	// the replica's health state, or empty if it has none
+	Health string `protobuf:"bytes,5,opt,name=health" json:"health,omitempty"`
+}
+
+func (m *Replica) Reset()                    { *m = Replica{} }
+func (m *Replica) String() string            { return proto.CompactTextString(m) }
+func (*Replica) ProtoMessage()               {}
+func (*Replica) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Replica) GetNode() string {
+	if m != nil {
+		return m.Node
+	}
+	return ""
+}
+
+func (m *Replica) GetRcId() string {
+	if m != nil {
+		return m.RcId
+	}
+	return ""
+}
+
+func (m *Replica) GetInstalled() bool {
+	if m != nil {
+		return m.Installed
+	}
+	return false
+}
+
+func (m *Replica) GetCurrent() bool {
+	if m != nil {
+		return m.Current
+	}
+	return false
+}
+
+func (m *Replica) GetHealth() string {
+	if m != nil {
+		return m.Health
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*GetReplicationStatusRequest)(nil), "replicationstatus.GetReplicationStatusRequest")
+	proto.RegisterType((*GetReplicationStatusResponse)(nil), "replicationstatus.GetReplicationStatusResponse")
+	proto.RegisterType((*Replica)(nil), "replicationstatus.Replica")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for P2ReplicationStatus service
+
+type P2ReplicationStatusClient interface {
+	// Reports the desired, scheduled, installed and healthy replicas of an RC or
+	// pod cluster
+	GetReplicationStatus(ctx context.Context, in *GetReplicationStatusRequest, opts ...grpc.CallOption) (*GetReplicationStatusResponse, error)
+}
+
+type p2ReplicationStatusClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewP2ReplicationStatusClient(cc *grpc.ClientConn) P2ReplicationStatusClient {
+	return &p2ReplicationStatusClient{cc}
+}
+
+func (c *p2ReplicationStatusClient) GetReplicationStatus(ctx context.Context, in *GetReplicationStatusRequest, opts ...grpc.CallOption) (*GetReplicationStatusResponse, error) {
+	out := new(GetReplicationStatusResponse)
+	err := grpc.Invoke(ctx, "/replicationstatus.P2ReplicationStatus/GetReplicationStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for P2ReplicationStatus service
+
+type P2ReplicationStatusServer interface {
+	// Reports the desired, scheduled, installed and healthy replicas of an RC or
+	// pod cluster
+	GetReplicationStatus(context.Context, *GetReplicationStatusRequest) (*GetReplicationStatusResponse, error)
+}
+
+func RegisterP2ReplicationStatusServer(s *grpc.Server, srv P2ReplicationStatusServer) {
+	s.RegisterService(&_P2ReplicationStatus_serviceDesc, srv)
+}
+
+func _P2ReplicationStatus_GetReplicationStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReplicationStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(P2ReplicationStatusServer).GetReplicationStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/replicationstatus.P2ReplicationStatus/GetReplicationStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(P2ReplicationStatusServer).GetReplicationStatus(ctx, req.(*GetReplicationStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _P2ReplicationStatus_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "replicationstatus.P2ReplicationStatus",
+	HandlerType: (*P2ReplicationStatusServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetReplicationStatus",
+			Handler:    _P2ReplicationStatus_GetReplicationStatus_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pkg/grpc/replicationstatus/protos/replicationstatus.proto",
+}
+
+func init() {
+	proto.RegisterFile("pkg/grpc/replicationstatus/protos/replicationstatus.proto", fileDescriptor0)
+}
+
+var fileDescriptor0 = []byte{
+	// 342 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x8c, 0x92, 0xbf, 0x4e, 0xeb, 0x30,
+	0x18, 0xc5, 0x6f, 0x9a, 0x3f, 0x6d, 0xbf, 0x7b, 0x75, 0x01, 0x17, 0x90, 0x55, 0x3a, 0x44, 0x11,
+	0x43, 0x58, 0x1a, 0xa9, 0x48, 0x48, 0xcc, 0x20, 0xa1, 0x6e, 0x28, 0x2c, 0x6c, 0x55, 0xb1, 0x3f,
+	0xb5, 0x11, 0x51, 0x6c, 0x6c, 0x67, 0xe8, 0xca, 0x13, 0xf0, 0xa4, 0x3c, 0x03, 0x8a, 0x93, 0xb4,
+	0x40, 0x2a, 0xc4, 0x96, 0xef, 0xfc, 0x9c, 0x73, 0xec, 0x63, 0xc3, 0xb5, 0x7c, 0x5e, 0x25, 0x2b,
+	0x25, 0x59, 0xa2, 0x50, 0xe6, 0x19, 0x5b, 0x9a, 0x4c, 0x14, 0xda, 0x2c, 0x4d, 0xa9, 0x13, 0xa9,
+	0x84, 0x11, 0xba, 0x0b, 0xa6, 0x16, 0x90, 0xa3, 0x0e, 0x88, 0x1e, 0xe1, 0xec, 0x0e, 0x4d, 0xba,
+	0xd3, 0x1f, 0xac, 0x9e, 0xe2, 0x4b, 0x89, 0xda, 0x90, 0x11, 0xf8, 0x8a, 0x2d, 0x32, 0x4e, 0x9d,
+	0xd0, 0x89, 0x87, 0xa9, 0xa7, 0xd8, 0x9c, 0x93, 0x73, 0xf8, 0x2f, 0x05, 0x5f, 0xb0, 0xbc, 0xd4,
+	0x06, 0x55, 0x45, 0x7b, 0x96, 0xfe, 0x93, 0x82, 0xdf, 0xd4, 0xe2, 0x9c, 0x47, 0xef, 0x0e, 0x4c,
+	0xf6, 0x5b, 0x6b, 0x29, 0x0a, 0x8d, 0xe4, 0x04, 0x82, 0xca, 0x66, 0x6b, 0xee, 0x4b, 0xc1, 0xe7,
+	0x9c, 0x5c, 0xc0, 0x61, 0xb3, 0x4d, 0xbd, 0xe0, 0xa8, 0x33, 0x85, 0xb5, 0xbf, 0x9b, 0x1e, 0xb4,
+	0xfa, 0x6d, 0x2d, 0x93, 0x2b, 0x18, 0xb4, 0x12, 0x75, 0x43, 0x37, 0xfe, 0x3b, 0x1b, 0x4f, 0xbb,
+	0x67, 0x6f, 0x76, 0x90, 0x6e, 0xd7, 0x92, 0x09, 0x0c, 0x35, 0x5b, 0x23, 0x2f, 0x73, 0xe4, 0xd4,
+	0x0b, 0xdd, 0x78, 0x98, 0xee, 0x84, 0x8a, 0x66, 0xd5, 0xbf, 0x79, 0x45, 0xfd, 0x9a, 0x6e, 0x05,
+	0x42, 0xa1, 0xbf, 0xc6, 0x65, 0x6e, 0xd6, 0x1b, 0x1a, 0x58, 0xd6, 0x8e, 0xd1, 0xab, 0x03, 0xfd,
+	0x26, 0x8b, 0x10, 0xf0, 0x0a, 0xc1, 0xb1, 0xad, 0xad, 0xfa, 0xde, 0x75, 0xd9, 0xfb, 0xd4, 0xe5,
+	0x97, 0x30, 0x37, 0x74, 0xe2, 0xc1, 0xb7, 0x30, 0x56, 0x2a, 0x85, 0x85, 0xa1, 0x9e, 0x65, 0xed,
+	0x48, 0x4e, 0x21, 0xa8, 0x73, 0xa9, 0x6f, 0xdd, 0x9a, 0x69, 0xf6, 0xe6, 0xc0, 0xe8, 0x7e, 0xd6,
+	0x29, 0x9d, 0x6c, 0xe0, 0x78, 0xdf, 0x65, 0x90, 0xe9, 0x9e, 0xc2, 0x7e, 0x78, 0x10, 0xe3, 0xe4,
+	0xd7, 0xeb, 0xeb, 0x5b, 0x8e, 0xfe, 0x3c, 0x05, 0xf6, 0xf1, 0x5d, 0x7e, 0x0c, 0x00, 0x52, 0xbd,
+	0x08, 0xdd, 0xb9, 0x02, 0x00, 0x00,
+}
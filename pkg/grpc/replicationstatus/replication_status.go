@@ -0,0 +1,84 @@
+package replicationstatus
+
+import (
+	replicationstatus_protos "github.com/square/p2/pkg/grpc/replicationstatus/protos"
+	pc_fields "github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/rc"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/types"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+type Aggregator interface {
+	RCStatus(rcID fields.ID) (rc.ReplicationStatus, error)
+	PodClusterStatus(pcID pc_fields.ID) (rc.ReplicationStatus, error)
+}
+
+type Server struct {
+	aggregator Aggregator
+}
+
+func NewServer(aggregator Aggregator) Server {
+	return Server{
+		aggregator: aggregator,
+	}
+}
+
+var _ replicationstatus_protos.P2ReplicationStatusServer = Server{}
+
+func (s Server) GetReplicationStatus(_ context.Context, req *replicationstatus_protos.GetReplicationStatusRequest) (*replicationstatus_protos.GetReplicationStatusResponse, error) {
+	var status rc.ReplicationStatus
+	var err error
+	switch {
+	case req.RcId != "" && req.PodClusterId != "":
+		return nil, grpc.Errorf(codes.InvalidArgument, "only one of rc_id and pod_cluster_id may be specified")
+	case req.RcId != "":
+		status, err = s.aggregator.RCStatus(fields.ID(req.RcId))
+	case req.PodClusterId != "":
+		status, err = s.aggregator.PodClusterStatus(pc_fields.ID(req.PodClusterId))
+	default:
+		return nil, grpc.Errorf(codes.InvalidArgument, "one of rc_id and pod_cluster_id must be specified")
+	}
+	switch {
+	case rcstore.IsNotExist(err) || pcstore.IsNotExist(err):
+		return nil, grpc.Errorf(codes.NotFound, "%s", err)
+	case err != nil:
+		return nil, grpc.Errorf(codes.Unavailable, "could not aggregate replication status: %s", err)
+	}
+
+	return StatusToProto(status), nil
+}
+
+func StatusToProto(status rc.ReplicationStatus) *replicationstatus_protos.GetReplicationStatusResponse {
+	replicas := make([]*replicationstatus_protos.Replica, len(status.Replicas))
+	for i, replica := range status.Replicas {
+		replicas[i] = &replicationstatus_protos.Replica{
+			Node:      replica.Node.String(),
+			RcId:      replica.RCID.String(),
+			Installed: replica.Installed,
+			Current:   replica.Current,
+			Health:    string(replica.Health),
+		}
+	}
+	return &replicationstatus_protos.GetReplicationStatusResponse{
+		PodId:           status.PodID.String(),
+		ReplicasDesired: int64(status.ReplicasDesired),
+		Replicas:        replicas,
+		Scheduled:       nodeStrings(status.Scheduled()),
+		Installed:       nodeStrings(status.Installed()),
+		Healthy:         nodeStrings(status.Healthy()),
+	}
+}
+
+func nodeStrings(nodes []types.NodeName) []string {
+	ret := make([]string, len(nodes))
+	for i, node := range nodes {
+		ret[i] = node.String()
+	}
+	return ret
+}
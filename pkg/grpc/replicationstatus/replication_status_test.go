@@ -0,0 +1,79 @@
+package replicationstatus
+
+import (
+	"context"
+	"testing"
+
+	replicationstatus_protos "github.com/square/p2/pkg/grpc/replicationstatus/protos"
+	"github.com/square/p2/pkg/health"
+	pc_fields "github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/rc"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+type fakeAggregator struct {
+	status rc.ReplicationStatus
+}
+
+func (f fakeAggregator) RCStatus(rcID fields.ID) (rc.ReplicationStatus, error) {
+	if rcID != "some_rc" {
+		return rc.ReplicationStatus{}, rcstore.NoReplicationController
+	}
+	return f.status, nil
+}
+
+func (f fakeAggregator) PodClusterStatus(pcID pc_fields.ID) (rc.ReplicationStatus, error) {
+	return f.status, nil
+}
+
+func TestGetReplicationStatus(t *testing.T) {
+	server := NewServer(fakeAggregator{status: rc.ReplicationStatus{
+		PodID:           "some_pod",
+		ReplicasDesired: 3,
+		Replicas: []rc.ReplicaStatus{
+			{Node: "node1", RCID: "some_rc", Installed: true, Current: true, Health: health.Passing},
+			{Node: "node2", RCID: "some_rc", Installed: true, Health: health.Critical},
+			{Node: "node3", RCID: "some_rc"},
+		},
+	}})
+
+	resp, err := server.GetReplicationStatus(context.Background(), &replicationstatus_protos.GetReplicationStatusRequest{
+		RcId: "some_rc",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error getting replication status: %s", err)
+	}
+	if resp.PodId != "some_pod" || resp.ReplicasDesired != 3 {
+		t.Errorf("expected 3 replicas of some_pod desired but got %d of %s", resp.ReplicasDesired, resp.PodId)
+	}
+	if len(resp.Replicas) != 3 || resp.Replicas[1].Node != "node2" || resp.Replicas[1].Health != "critical" || resp.Replicas[1].Current {
+		t.Errorf("unexpected replicas %v", resp.Replicas)
+	}
+	if len(resp.Scheduled) != 3 || len(resp.Installed) != 2 || len(resp.Healthy) != 1 || resp.Healthy[0] != "node1" {
+		t.Errorf("expected 3 scheduled, 2 installed and only node1 healthy but got %v, %v and %v", resp.Scheduled, resp.Installed, resp.Healthy)
+	}
+
+	_, err = server.GetReplicationStatus(context.Background(), &replicationstatus_protos.GetReplicationStatusRequest{
+		RcId: "other_rc",
+	})
+	if grpc.Code(err) != codes.NotFound {
+		t.Errorf("expected a not found error for a missing RC but got %s", err)
+	}
+
+	_, err = server.GetReplicationStatus(context.Background(), &replicationstatus_protos.GetReplicationStatusRequest{})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected an invalid argument error without an RC or pod cluster but got %s", err)
+	}
+
+	_, err = server.GetReplicationStatus(context.Background(), &replicationstatus_protos.GetReplicationStatusRequest{
+		RcId:         "some_rc",
+		PodClusterId: "some_pc",
+	})
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected an invalid argument error with both an RC and a pod cluster but got %s", err)
+	}
+}
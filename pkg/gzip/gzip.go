@@ -1,24 +1,50 @@
 package gzip
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
 	"os"
-	"os/exec"
-	"os/user"
-	"syscall"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	p2user "github.com/square/p2/pkg/user"
 	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
 )
 
+// DefaultMaxSize is the most that a tarball may extract to if Options doesn't
+// set a MaxSize
+const DefaultMaxSize = 20 * size.Gibibyte
+
+// Options control how tarballs are checked as they are extracted. Whatever the
+// options, entries with absolute paths or paths outside of the destination,
+// device nodes, FIFOs, entries inside of symlinks and hardlinks to files that
+// weren't extracted from the same tarball are rejected, and setuid, setgid and
+// sticky bits are never extracted.
+type Options struct {
+	// Strict also rejects symlinks pointing outside of the destination,
+	// modes with setuid, setgid or sticky bits, entries that replace an
+	// earlier entry, and entry types that would otherwise be skipped.
+	Strict bool
+
+	// MaxSize is the most bytes the tarball's files may add up to.
+	// Defaults to DefaultMaxSize.
+	MaxSize size.ByteCount
+}
+
 // ExtractTarGz extracts the specified tarball to the specified destination,
 // as the specified user.
 func ExtractTarGz(owner string, filename string, dest string) (err error) {
-	ownerUID, ownerGID, err := p2user.IDs(owner)
-	if err != nil {
-		return err
-	}
+	return ExtractTarGzWithOptions(owner, filename, dest, Options{})
+}
 
-	currentUser, err := user.Current()
+// ExtractTarGzWithOptions extracts the specified tarball to the specified
+// destination, owned by the specified user, checking its entries according to
+// opts.
+func ExtractTarGzWithOptions(owner string, filename string, dest string, opts Options) error {
+	ownerUID, ownerGID, err := p2user.IDs(owner)
 	if err != nil {
 		return err
 	}
@@ -32,22 +58,323 @@ func ExtractTarGz(owner string, filename string, dest string) (err error) {
 		return util.Errorf("error setting ownership of root directory %s: %s", dest, err)
 	}
 
-	// Always pass --no-same-owner:
-	// this is default if extracting as non-root, but --same-owner is default if root.
-	// For run_as root apps, we DO want the files to end up owned by root,
-	// instead of an unknown user dictated by the build system that produced the artifact.
-	cmd := exec.Command("tar", "xpzf", filename, "--no-same-owner", "-C", dest)
-	if currentUser.Username != owner {
-		// If we are running as a non-root user (e.g. in tests), don't change user.
-		// Non-root users are understandably not allowed to change to other users...
-		// not even themselves.
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Credential: &syscall.Credential{Uid: uint32(ownerUID), Gid: uint32(ownerGID)},
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return util.Errorf("error extracting: %s", err)
+	}
+	defer gz.Close()
+
+	e := &extractor{
+		dest:      filepath.Clean(dest),
+		uid:       ownerUID,
+		gid:       ownerGID,
+		opts:      opts,
+		maxSize:   opts.MaxSize,
+		extracted: make(map[string]byte),
+		dirs:      make(map[string]*tar.Header),
+	}
+	if e.maxSize <= 0 {
+		e.maxSize = DefaultMaxSize
+	}
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return util.Errorf("error extracting: %s", err)
+		}
+		err = e.extract(header, reader)
+		if err != nil {
+			return util.Errorf("error extracting %q: %s", header.Name, err)
+		}
+	}
+	return e.finishDirs()
+}
+
+// extractor extracts the entries of one tarball
+type extractor struct {
+	dest     string
+	uid, gid int
+	opts     Options
+	maxSize  size.ByteCount
+	total    size.ByteCount
+
+	// the type of each entry extracted so far, by its cleaned name
+	extracted map[string]byte
+	// the headers of directories, whose modes and times are set once all
+	// of their contents have been extracted
+	dirs map[string]*tar.Header
+}
+
+func (e *extractor) extract(header *tar.Header, contents io.Reader) error {
+	name, err := e.entryName(header.Name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		// the destination itself
+		return nil
+	}
+
+	mode, err := e.mode(header)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := e.extracted[name]; ok && e.opts.Strict {
+		return util.Errorf("entry appears more than once")
+	}
+
+	switch header.Typeflag {
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return util.Errorf("device nodes and FIFOs are not allowed")
+	case tar.TypeReg, tar.TypeRegA, tar.TypeDir, tar.TypeSymlink, tar.TypeLink:
+	default:
+		if e.opts.Strict {
+			return util.Errorf("unsupported entry type %q", header.Typeflag)
+		}
+		return nil
+	}
+
+	path := filepath.Join(e.dest, name)
+	err = e.makeParents(name)
+	if err != nil {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		err = e.makeDir(path)
+		if err != nil {
+			return err
+		}
+		e.dirs[name] = header
+	case tar.TypeSymlink:
+		if e.opts.Strict && !e.within(filepath.Dir(name), header.Linkname) {
+			return util.Errorf("symlink to %q points outside of the destination", header.Linkname)
+		}
+		err = e.replace(path)
+		if err != nil {
+			return err
+		}
+		err = os.Symlink(header.Linkname, path)
+		if err != nil {
+			return err
+		}
+		err = os.Lchown(path, e.uid, e.gid)
+		if err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		target, err := e.entryName(header.Linkname)
+		if err != nil {
+			return util.Errorf("hardlink to %q: %s", header.Linkname, err)
+		}
+		if e.extracted[target] != tar.TypeReg {
+			return util.Errorf("hardlink to %q, which is not a file extracted earlier", header.Linkname)
+		}
+		if target == name {
+			return nil
+		}
+		err = e.replace(path)
+		if err != nil {
+			return err
+		}
+		err = os.Link(filepath.Join(e.dest, target), path)
+		if err != nil {
+			return err
+		}
+	default:
+		e.total += size.ByteCount(header.Size)
+		if e.total > e.maxSize {
+			return util.Errorf("the tarball extracts to more than the limit of %s", e.maxSize)
+		}
+		err = e.writeFile(path, mode, header, contents)
+		if err != nil {
+			return err
+		}
+	}
+
+	typ := header.Typeflag
+	if typ == tar.TypeRegA || typ == tar.TypeLink {
+		typ = tar.TypeReg
+	}
+	e.extracted[name] = typ
+	return nil
+}
+
+// entryName returns the cleaned path of an entry relative to the destination,
+// or an error if it is absolute or outside of the destination
+func (e *extractor) entryName(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", util.Errorf("absolute paths are not allowed")
+	}
+	cleaned := filepath.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", util.Errorf("paths outside of the destination are not allowed")
+	}
+	return cleaned, nil
+}
+
+// within returns whether a symlink in dir (relative to the destination) to
+// target stays within the destination
+func (e *extractor) within(dir string, target string) bool {
+	if filepath.IsAbs(target) {
+		return false
+	}
+	_, err := e.entryName(filepath.Join(dir, target))
+	return err == nil
+}
+
+// mode returns the permissions to extract an entry with
+func (e *extractor) mode(header *tar.Header) (os.FileMode, error) {
+	mode := header.FileInfo().Mode()
+	special := mode & (os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if special != 0 && e.opts.Strict {
+		return 0, util.Errorf("setuid, setgid and sticky bits are not allowed")
+	}
+	return mode.Perm(), nil
+}
+
+// makeParents creates the directories that an entry is extracted into,
+// refusing to extract anything through a symlink
+func (e *extractor) makeParents(name string) error {
+	dir := filepath.Dir(name)
+	if dir == "." {
+		return nil
+	}
+	path := e.dest
+	for _, part := range strings.Split(dir, string(filepath.Separator)) {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			err = e.makeDir(path)
+			if err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return util.Errorf("%s is a symlink, entries may not be extracted through it", path)
+		}
+		if !info.IsDir() {
+			return util.Errorf("%s is not a directory", path)
+		}
+	}
+	return nil
+}
+
+func (e *extractor) makeDir(path string) error {
+	info, err := os.Lstat(path)
+	if err == nil {
+		if !info.IsDir() {
+			return util.Errorf("%s already exists and is not a directory", path)
+		}
+		return nil
+	}
+	err = os.Mkdir(path, 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Lchown(path, e.uid, e.gid)
+	if err != nil {
+		return err
+	}
+	// directories that are entries of the tarball get their own mode once
+	// their contents are extracted
+	return setMode(path, 0755)
+}
+
+// replace removes an earlier entry at path, so that a new one is created in
+// its place rather than written through it
+func (e *extractor) replace(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return util.Errorf("%s already exists and is a directory", path)
+	}
+	return os.Remove(path)
+}
+
+func (e *extractor) writeFile(path string, mode os.FileMode, header *tar.Header, contents io.Reader) error {
+	err := e.replace(path)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, io.LimitReader(contents, header.Size))
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	err = os.Lchown(path, e.uid, e.gid)
+	if err != nil {
+		return err
+	}
+	err = setMode(path, mode)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(path, header.ModTime, header.ModTime)
+}
+
+// finishDirs sets the modes and times of the extracted directories, deepest
+// first so that setting a directory's time isn't undone by changes to its
+// contents
+func (e *extractor) finishDirs() error {
+	var names []string
+	for name := range e.dirs {
+		names = append(names, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	for _, name := range names {
+		header := e.dirs[name]
+		path := filepath.Join(e.dest, name)
+		mode, _ := e.mode(header)
+		err := setMode(path, mode)
+		if err != nil {
+			return util.Errorf("error extracting %q: %s", header.Name, err)
+		}
+		err = os.Chtimes(path, header.ModTime, header.ModTime)
+		if err != nil {
+			return util.Errorf("error extracting %q: %s", header.Name, err)
 		}
 	}
-	output, err := cmd.CombinedOutput()
+	return nil
+}
+
+// setMode sets the permissions of path regardless of the umask, and verifies
+// that they were applied
+func setMode(path string, mode os.FileMode) error {
+	err := os.Chmod(path, mode)
 	if err != nil {
-		return util.Errorf("error extracting: %v %s", err, string(output))
+		return err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm() != mode {
+		return util.Errorf("%s has mode %s after setting it to %s", path, info.Mode().Perm(), mode)
 	}
 	return nil
 }
@@ -1,12 +1,15 @@
 package gzip
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"io/ioutil"
 	"os"
 	"os/user"
 	"path"
 	"path/filepath"
 	"runtime"
+	"syscall"
 	"testing"
 
 	. "github.com/anthonybishopric/gotcha"
@@ -74,3 +77,113 @@ func TestEscapingSymlink(t *testing.T) {
 		Assert(t).IsTrue(os.IsNotExist(err), "expected extracted file not to exist")
 	})
 }
+
+type tarEntry struct {
+	header   tar.Header
+	contents string
+}
+
+// extractEntries writes a tarball of entries and extracts it with opts
+func extractEntries(t *testing.T, opts Options, entries ...tarEntry) (string, error) {
+	tmpdir, err := ioutil.TempDir("", "gziptest")
+	Assert(t).IsNil(err, "expected no error creating tempdir")
+
+	tarball, err := os.Create(filepath.Join(tmpdir, "test.tar.gz"))
+	Assert(t).IsNil(err, "expected no error creating tarball")
+	gz := gzip.NewWriter(tarball)
+	writer := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := entry.header
+		header.Size = int64(len(entry.contents))
+		if header.Typeflag == 0 {
+			header.Typeflag = tar.TypeReg
+		}
+		Assert(t).IsNil(writer.WriteHeader(&header), "expected no error writing tar header")
+		_, err = writer.Write([]byte(entry.contents))
+		Assert(t).IsNil(err, "expected no error writing tar entry")
+	}
+	Assert(t).IsNil(writer.Close(), "expected no error closing tar writer")
+	Assert(t).IsNil(gz.Close(), "expected no error closing gzip writer")
+	Assert(t).IsNil(tarball.Close(), "expected no error closing tarball")
+
+	user, err := user.Current()
+	Assert(t).IsNil(err, "expected no error getting current user")
+	dest := filepath.Join(tmpdir, "dest")
+	return dest, ExtractTarGzWithOptions(user.Username, tarball.Name(), dest, opts)
+}
+
+func TestRejectsUnsafeEntries(t *testing.T) {
+	tests := map[string][]tarEntry{
+		"absolute path":           {{header: tar.Header{Name: "/etc/passwd", Mode: 0644}}},
+		"device node":             {{header: tar.Header{Name: "null", Typeflag: tar.TypeChar, Mode: 0666}}},
+		"escaping hardlink":       {{header: tar.Header{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"}}},
+		"hardlink to a non-entry": {{header: tar.Header{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "shadow"}}},
+		"write through symlink": {
+			{header: tar.Header{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: "/etc"}},
+			{header: tar.Header{Name: "etc/p2-test", Mode: 0644}, contents: "pwned"},
+		},
+	}
+	for name, entries := range tests {
+		dest, err := extractEntries(t, Options{}, entries...)
+		os.RemoveAll(filepath.Dir(dest))
+		Assert(t).IsNotNil(err, "expected an error extracting a tarball with "+name)
+	}
+	_, err := os.Stat("/etc/p2-test")
+	Assert(t).IsTrue(os.IsNotExist(err), "should not have written through the symlink")
+}
+
+func TestEnforcesMaxSize(t *testing.T) {
+	entries := []tarEntry{
+		{header: tar.Header{Name: "a", Mode: 0644}, contents: "12345"},
+		{header: tar.Header{Name: "b", Mode: 0644}, contents: "67890"},
+	}
+	dest, err := extractEntries(t, Options{MaxSize: 8}, entries...)
+	defer os.RemoveAll(filepath.Dir(dest))
+	Assert(t).IsNotNil(err, "expected an error extracting more than the max size")
+
+	dest, err = extractEntries(t, Options{MaxSize: 10}, entries...)
+	defer os.RemoveAll(filepath.Dir(dest))
+	Assert(t).IsNil(err, "expected no error extracting up to the max size")
+}
+
+func TestStrictModeRejectsEscapingSymlinksAndSetuid(t *testing.T) {
+	symlink := tarEntry{header: tar.Header{Name: "java", Typeflag: tar.TypeSymlink, Linkname: "/usr/bin/java"}}
+	setuid := tarEntry{header: tar.Header{Name: "bin/launch", Mode: 04755}, contents: "#!/bin/sh"}
+
+	dest, err := extractEntries(t, Options{}, symlink, setuid)
+	defer os.RemoveAll(filepath.Dir(dest))
+	Assert(t).IsNil(err, "expected no error extracting outside symlinks and setuid bits outside strict mode")
+	info, err := os.Stat(filepath.Join(dest, "bin", "launch"))
+	Assert(t).IsNil(err, "expected no error statting extracted file")
+	Assert(t).AreEqual(info.Mode(), os.FileMode(0755), "should have stripped the setuid bit")
+
+	for _, entry := range []tarEntry{symlink, setuid} {
+		dest, err = extractEntries(t, Options{Strict: true}, entry)
+		defer os.RemoveAll(filepath.Dir(dest))
+		Assert(t).IsNotNil(err, "expected strict mode to reject "+entry.header.Name)
+	}
+}
+
+func TestExtractsModesRegardlessOfUmask(t *testing.T) {
+	oldUmask := syscall.Umask(077)
+	defer syscall.Umask(oldUmask)
+
+	dest, err := extractEntries(t, Options{Strict: true},
+		tarEntry{header: tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0750}},
+		tarEntry{header: tar.Header{Name: "dir/file", Mode: 0644}, contents: "x"},
+		tarEntry{header: tar.Header{Name: "implicit/file", Mode: 0755}, contents: "x"},
+	)
+	defer os.RemoveAll(filepath.Dir(dest))
+	Assert(t).IsNil(err, "expected no error extracting tarball")
+
+	for path, mode := range map[string]os.FileMode{
+		"dir":           os.ModeDir | 0750,
+		"dir/file":      0644,
+		"implicit":      os.ModeDir | 0755,
+		"implicit/file": 0755,
+	} {
+		info, err := os.Lstat(filepath.Join(dest, path))
+		Assert(t).IsNil(err, "expected no error statting "+path)
+		Assert(t).AreEqual(info.Mode(), mode, "unexpected mode of "+path)
+	}
+}
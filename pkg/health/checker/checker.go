@@ -208,7 +208,7 @@ func (c consulHealthChecker) WatchService(
 				out := make(map[types.NodeName]health.Result)
 				for _, result := range results {
 					var next consul.WatchResult
-					err = json.Unmarshal(result.Value, &next)
+					err = consul.UnmarshalHealth(result.Value, &next)
 					if err != nil {
 						errCh <- err
 					} else {
@@ -239,10 +239,11 @@ func (c consulHealthChecker) Service(serviceID string) (map[types.NodeName]healt
 
 func consulWatchToResult(w consul.WatchResult) health.Result {
 	return health.Result{
-		ID:      w.Id,
-		Node:    w.Node,
-		Service: w.Service,
-		Status:  health.ToHealthState(w.Status),
+		ID:         w.Id,
+		Node:       w.Node,
+		Service:    w.Service,
+		Status:     health.ToHealthState(w.Status),
+		NodeLabels: w.NodeLabels,
 	}
 }
 
@@ -253,7 +254,12 @@ func kvpsToResult(kvs api.KVPairs) ([]*health.Result, error) {
 	var err error
 	for i, kv := range kvs {
 		tmp := &health.Result{}
-		err = json.Unmarshal(kv.Value, &tmp)
+		var value []byte
+		value, err = consulutil.DecompressValue(kv.Value)
+		if err != nil {
+			return nil, util.Errorf("Could not decompress health at %s: %v", kv.Key, err)
+		}
+		err = json.Unmarshal(value, &tmp)
 		if err != nil {
 			return nil, util.Errorf("Could not unmarshal health at %s: %v", kv.Key, err)
 		}
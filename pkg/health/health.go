@@ -10,6 +10,10 @@ type Result struct {
 	Node    types.NodeName
 	Service string
 	Status  HealthState
+
+	// NodeLabels is the snapshot of node labels written with the result, if
+	// any. See consul.WatchResult.
+	NodeLabels string
 }
 
 // ResultList is a type alias that adds some extra methods that operate on the list.
@@ -2,6 +2,7 @@ package hoist
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/url"
@@ -16,8 +17,8 @@ import (
 	"github.com/square/p2/pkg/cgroups"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/p2exec"
+	"github.com/square/p2/pkg/platform"
 	"github.com/square/p2/pkg/runit"
-	"github.com/square/p2/pkg/user"
 	"github.com/square/p2/pkg/util"
 )
 
@@ -46,6 +47,9 @@ type Launchable struct {
 	CgroupConfigName string                     // The string in PLATFORM_CONFIG to pass to p2-exec
 	CgroupName       string                     // The name of the cgroup to run this launchable in
 	RequireFile      string                     // Do not run this launchable until this file exists
+	SELinuxContext   string                     // The SELinux context to run the executables and scripts in
+	AppArmorProfile  string                     // The AppArmor profile to run the executables and scripts in
+	EnvFilter        p2exec.EnvFilter           // Limits the variables that the executables and scripts inherit
 	RestartTimeout   time.Duration              // How long to wait when restarting the services in this launchable.
 	RestartPolicy_   runit.RestartPolicy        // Dictates whether the launchable should be automatically restarted upon exit.
 	SuppliedEnvVars  map[string]string          // A map of user-supplied environment variables to be exported for this launchable
@@ -162,6 +166,17 @@ func (hl *Launchable) PostActivate() (string, error) {
 	return output, nil
 }
 
+func (hl *Launchable) Preflight(timeout time.Duration) (string, error) {
+	output, err := hl.invokeBinScript("preflight", timeout)
+
+	// providing a preflight script is optional, ignore those errors
+	if err != nil && !os.IsNotExist(err) {
+		return output, err
+	}
+
+	return output, nil
+}
+
 func (hl *Launchable) disable() (string, error) {
 	output, err := hl.InvokeBinScript("disable")
 
@@ -191,6 +206,12 @@ func (hl *Launchable) enable() (string, error) {
 }
 
 func (hl *Launchable) InvokeBinScript(script string) (string, error) {
+	return hl.invokeBinScript(script, 0)
+}
+
+// invokeBinScript runs bin/<script> from the launchable's install dir under
+// p2-exec. If timeout is nonzero the script is killed after that long.
+func (hl *Launchable) invokeBinScript(script string, timeout time.Duration) (string, error) {
 	cmdPath := filepath.Join(hl.InstallDir(), "bin", script)
 	_, err := os.Stat(cmdPath)
 	if err != nil {
@@ -209,12 +230,24 @@ func (hl *Launchable) InvokeBinScript(script string) (string, error) {
 		CgroupConfigName: hl.CgroupConfigName,
 		CgroupName:       cgroupName,
 		RequireFile:      hl.RequireFile,
+		SELinuxContext:   hl.SELinuxContext,
+		AppArmorProfile:  hl.AppArmorProfile,
+		EnvFilter:        hl.EnvFilter,
+	}
+	ctx := context.Background()
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
-	cmd := exec.Command(hl.P2Exec, p2ExecArgs.CommandLine()...)
+	cmd := exec.CommandContext(ctx, hl.P2Exec, p2ExecArgs.CommandLine()...)
 	buffer := bytes.Buffer{}
 	cmd.Stdout = &buffer
 	cmd.Stderr = &buffer
 	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return buffer.String(), util.Errorf("%s timed out after %s", script, timeout)
+	}
 	if err != nil {
 		return buffer.String(), err
 	}
@@ -371,6 +404,9 @@ func (hl *Launchable) Executables(
 				CgroupConfigName: hl.CgroupConfigName,
 				CgroupName:       hl.CgroupName,
 				RequireFile:      hl.RequireFile,
+				SELinuxContext:   hl.SELinuxContext,
+				AppArmorProfile:  hl.AppArmorProfile,
+				EnvFilter:        hl.EnvFilter,
 			}
 			execCmd := append([]string{hl.P2Exec}, p2ExecArgs.CommandLine()...)
 
@@ -456,27 +492,11 @@ func (hl *Launchable) makeLast() error {
 }
 
 func (hl *Launchable) flipSymlink(newLinkPath string) error {
-	dir, err := ioutil.TempDir(hl.RootDir, hl.ServiceId)
-	if err != nil {
-		return util.Errorf("Couldn't create temporary directory for symlink: %s", err)
-	}
-	defer os.RemoveAll(dir)
-	tempLinkPath := filepath.Join(dir, hl.ServiceId)
-	err = os.Symlink(hl.InstallDir(), tempLinkPath)
-	if err != nil {
-		return util.Errorf("Couldn't create symlink for hoist launchable %s: %s", hl.ServiceId, err)
-	}
-
-	uid, gid, err := user.IDs(hl.RunAs)
-	if err != nil {
-		return util.Errorf("Couldn't retrieve UID/GID for hoist launchable %s user %s: %s", hl.ServiceId, hl.RunAs, err)
-	}
-	err = os.Lchown(tempLinkPath, uid, gid)
+	err := platform.Current.ReplaceLink(hl.InstallDir(), newLinkPath, hl.RunAs)
 	if err != nil {
-		return util.Errorf("Couldn't lchown symlink for hoist launchable %s: %s", hl.ServiceId, err)
+		return util.Errorf("Couldn't link hoist launchable %s: %s", hl.ServiceId, err)
 	}
-
-	return os.Rename(tempLinkPath, newLinkPath)
+	return nil
 }
 
 func (hl *Launchable) EnvDir() string {
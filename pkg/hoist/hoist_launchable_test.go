@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/runit"
@@ -279,6 +280,43 @@ func TestEnable(t *testing.T) {
 	Assert(t).AreEqual(enableOutput, expectedEnableOutput, "Did not get expected output from test enable script")
 }
 
+func TestPreflight(t *testing.T) {
+	// This test's behavior is not dependent on whether the pod is a legacy or uuid pod
+	hl, sb := FakeHoistLaunchableForDirLegacyPod("successful_scripts_test_hoist_launchable")
+	defer CleanupFakeLaunchable(hl, sb)
+
+	preflightOutput, err := hl.Preflight(time.Minute)
+	Assert(t).IsNil(err, "Got an unexpected error when calling preflight on the test hoist launchable")
+
+	expectedPreflightOutput := "preflight invoked\n"
+
+	Assert(t).AreEqual(preflightOutput, expectedPreflightOutput, "Did not get expected output from test preflight script")
+}
+
+func TestFailingPreflight(t *testing.T) {
+	// This test's behavior is not dependent on whether the pod is a legacy or uuid pod
+	hl, sb := FakeHoistLaunchableForDirLegacyPod("failing_scripts_test_hoist_launchable")
+	defer CleanupFakeLaunchable(hl, sb)
+
+	preflightOutput, err := hl.Preflight(time.Minute)
+	Assert(t).IsNotNil(err, "Expected preflight to fail for this test, but it didn't")
+
+	expectedPreflightOutput := "Error: this script failed\n"
+
+	Assert(t).AreEqual(preflightOutput, expectedPreflightOutput, "Did not get expected output from test preflight script")
+}
+
+// providing a preflight script is optional, make sure we don't error
+func TestNonexistentPreflight(t *testing.T) {
+	// This test's behavior is not dependent on whether the pod is a legacy or uuid pod
+	hl, sb := FakeHoistLaunchableForDirLegacyPod("nonexistent_scripts_test_hoist_launchable")
+	defer CleanupFakeLaunchable(hl, sb)
+
+	preflightOutput, err := hl.Preflight(time.Minute)
+	Assert(t).IsNil(err, "Got an unexpected error when calling preflight on the test hoist launchable")
+	Assert(t).AreEqual(preflightOutput, "", "Did not get expected output from test preflight script")
+}
+
 func TestNoEnableForUUIDPods(t *testing.T) {
 	hl, sb := FakeHoistLaunchableForDirUUIDPod("failing_scripts_test_hoist_launchable")
 	defer CleanupFakeLaunchable(hl, sb)
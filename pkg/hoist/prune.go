@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"time"
 
 	"github.com/square/p2/pkg/util/size"
 )
@@ -15,21 +16,10 @@ import (
 // by the `current` or `last` symlinks. Installations will be removed from
 // oldest to newest.
 func (hl *Launchable) Prune(maxSize size.ByteCount) error {
-	curTarget, err := os.Readlink(hl.CurrentDir())
-	if os.IsNotExist(err) {
-		curTarget = ""
-	} else if err != nil {
-		return err
-	}
-	curTarget = filepath.Base(curTarget)
-
-	lastTarget, err := os.Readlink(hl.LastDir())
-	if os.IsNotExist(err) {
-		lastTarget = ""
-	} else if err != nil {
+	curTarget, lastTarget, err := hl.keptInstalls()
+	if err != nil {
 		return err
 	}
-	lastTarget = filepath.Base(lastTarget)
 
 	installs, err := ioutil.ReadDir(hl.AllInstallsDir())
 	if os.IsNotExist(err) {
@@ -74,6 +64,65 @@ func (hl *Launchable) Prune(maxSize size.ByteCount) error {
 	return nil
 }
 
+// Install is one of a launchable's installs
+type Install struct {
+	Path    string
+	Size    size.ByteCount
+	ModTime time.Time
+	// Set if the install is pointed to by the `current` or `last` symlinks,
+	// in which case it must not be removed
+	Kept bool
+}
+
+// Installs returns the launchable's installs, newest first
+func (hl *Launchable) Installs() ([]Install, error) {
+	curTarget, lastTarget, err := hl.keptInstalls()
+	if err != nil {
+		return nil, err
+	}
+	installs, err := ioutil.ReadDir(hl.AllInstallsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(installsByAge(installs)))
+
+	var ret []Install
+	for _, i := range installs {
+		installSize, err := hl.sizeOfInstall(i.Name())
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, Install{
+			Path:    filepath.Join(hl.AllInstallsDir(), i.Name()),
+			Size:    installSize,
+			ModTime: i.ModTime(),
+			Kept:    i.Name() == curTarget || i.Name() == lastTarget,
+		})
+	}
+	return ret, nil
+}
+
+// keptInstalls returns the names of the installs the `current` and `last`
+// symlinks point to, which are empty if the symlinks don't exist
+func (hl *Launchable) keptInstalls() (string, string, error) {
+	curTarget, err := os.Readlink(hl.CurrentDir())
+	if os.IsNotExist(err) {
+		curTarget = ""
+	} else if err != nil {
+		return "", "", err
+	}
+
+	lastTarget, err := os.Readlink(hl.LastDir())
+	if os.IsNotExist(err) {
+		lastTarget = ""
+	} else if err != nil {
+		return "", "", err
+	}
+	return filepath.Base(curTarget), filepath.Base(lastTarget), nil
+}
+
 func (hl *Launchable) sizeOfInstall(name string) (size.ByteCount, error) {
 	var total int64
 	err := filepath.Walk(filepath.Join(hl.AllInstallsDir(), name), func(_ string, info os.FileInfo, err error) error {
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -144,3 +145,26 @@ func TestPruneIgnoresCurrentAndLast(t *testing.T) {
 		assertShouldBePruned(t, hl, "third")
 	})
 }
+
+func TestInstalls(t *testing.T) {
+	launchableWithInstallations(t, []testInstall{
+		{"current", time.Now().Add(-1000 * time.Hour), 10 * size.Kibibyte},
+		{"second", time.Now().Add(-800 * time.Hour), 10 * size.Kibibyte},
+		{"last", time.Now().Add(-700 * time.Hour), 10 * size.Kibibyte},
+		{"fourth", time.Now().Add(-600 * time.Hour), 20 * size.Kibibyte},
+	}, func(hl *Launchable) {
+		installs, err := hl.Installs()
+		Assert(t).IsNil(err, "Should not have erred listing installs")
+		var names []string
+		var kept []string
+		for _, install := range installs {
+			names = append(names, filepath.Base(install.Path))
+			if install.Kept {
+				kept = append(kept, filepath.Base(install.Path))
+			}
+		}
+		Assert(t).AreEqual(strings.Join(names, ","), "fourth,last,second,current", "Should have listed the installs newest first")
+		Assert(t).AreEqual(strings.Join(kept, ","), "last,current", "Should have marked the installs current and last point to as kept")
+		Assert(t).AreEqual(installs[0].Size, 20*size.Kibibyte, "Should have measured the install")
+	})
+}
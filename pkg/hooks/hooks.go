@@ -12,6 +12,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util/redact"
 )
 
 func NewContext(dirpath string, podRoot string, logger *logging.Logger, auditLogger AuditLogger) *hookContext {
@@ -23,8 +24,14 @@ func NewContext(dirpath string, podRoot string, logger *logging.Logger, auditLog
 	}
 }
 
+// SetRedaction sets a filter that is applied to the output of every hook,
+// in addition to the hooked pod's own log_redaction.
+func (h *hookContext) SetRedaction(redaction *redact.Filter) {
+	h.redaction = redaction
+}
+
 // runDirectory executes all executable files in a given directory path.
-func (h *hookContext) runDirectory(hookEnv *HookExecutionEnvironment) error {
+func (h *hookContext) runDirectory(hookEnv *HookExecutionEnvironment, redaction *redact.Filter) error {
 	entries, err := ioutil.ReadDir(h.dirpath)
 	if os.IsNotExist(err) {
 		h.logger.WithField("dir", h.dirpath).Debugln("Hooks not set up")
@@ -37,6 +44,7 @@ func (h *hookContext) runDirectory(hookEnv *HookExecutionEnvironment) error {
 	for _, f := range entries {
 		fullpath := path.Join(h.dirpath, f.Name())
 		hec := NewHookExecContext(fullpath, f.Name(), DefaultTimeout, *hookEnv, h.logger)
+		hec.redaction = redaction
 		executable := (f.Mode() & 0111) != 0
 		if !executable {
 			h.auditLogger.LogFailure(hec, nil)
@@ -105,15 +113,16 @@ func (h *HookExecContext) Run() {
 	cmd.Stderr = hookOut
 	cmd.Env = h.env.Env()
 	err := cmd.Run()
+	output := h.redaction.Redact(hookOut.String())
 	if err != nil {
 		h.logger.WithErrorAndFields(err, logrus.Fields{
 			"path":   h.Path,
-			"output": hookOut.String(),
+			"output": output,
 		}).Warnf("Could not execute hook %s", h.Name)
 	} else {
 		h.logger.WithFields(logrus.Fields{
 			"path":   h.Path,
-			"output": hookOut.String(),
+			"output": output,
 		}).Infof("Executed hook")
 	}
 }
@@ -155,7 +164,15 @@ func (h *hookContext) runHooks(dirpath string, hType HookType, pod Pod, podManif
 		HookedSystemPodRootEnvVar: h.podRoot,
 		HookedPodUniqueKeyEnvVar:  pod.UniqueKey().String(),
 	}
-	return h.runDirectory(hec)
+
+	redaction := h.redaction
+	podRedaction, err := redact.New(podManifest.GetLogRedaction())
+	if err != nil {
+		logger.WithError(err).Warnln("Invalid log_redaction in manifest, only applying the preparer's filters to hook output")
+	} else {
+		redaction = redaction.Merge(podRedaction)
+	}
+	return h.runDirectory(hec, redaction)
 }
 
 func (h *hookContext) RunHookType(hookType HookType, pod Pod, manifest manifest.Manifest) error {
@@ -6,6 +6,7 @@ import (
 
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/redact"
 )
 
 // HookType represents the stage in the Hook lifecycle
@@ -28,6 +29,9 @@ var (
 	AfterLaunch = HookType("after_launch")
 	// AfterAuth occurs conditionally when artifact authorization fails
 	AfterAuthFail = HookType("after_auth_fail")
+	// AfterVerificationWarn occurs when artifact verification fails but the
+	// pod's verification failure policy is "warn", so the install proceeds
+	AfterVerificationWarn = HookType("after_verification_warn")
 )
 
 func AsHookType(value string) (HookType, error) {
@@ -44,6 +48,8 @@ func AsHookType(value string) (HookType, error) {
 		return AfterLaunch, nil
 	case AfterAuthFail.String():
 		return AfterAuthFail, nil
+	case AfterVerificationWarn.String():
+		return AfterVerificationWarn, nil
 	default:
 		return HookType(""), fmt.Errorf("%s is not a valid hook type", value)
 	}
@@ -82,6 +88,9 @@ type hookContext struct {
 	podRoot     string
 	logger      *logging.Logger
 	auditLogger AuditLogger
+
+	// applied, along with the hooked pod's log_redaction, to hook output
+	redaction *redact.Filter
 }
 
 // The set of environment variables exposed to the hook as it runs
@@ -135,6 +144,7 @@ type HookExecContext struct {
 	env         HookExecutionEnvironment // This will be used as the set of UNIX environment variables for the hook's execution
 	logger      *logging.Logger
 	auditLogger AuditLogger
+	redaction   *redact.Filter
 }
 
 func NewHookExecContext(path string, name string, timeout time.Duration, env HookExecutionEnvironment, logger *logging.Logger) *HookExecContext {
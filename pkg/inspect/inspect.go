@@ -67,7 +67,7 @@ func AddKVPToMap(result consul.ManifestResult, source int, filterNode types.Node
 		old.IntentManifestSHA = manifestSHA
 		for launchableID, launchable := range result.Manifest.GetLaunchableStanzas() {
 			var version *launch.LaunchableVersion
-			if launchable.Version.ID != "" {
+			if launchable.Version.IsSet() {
 				version = &launchable.Version
 			}
 
@@ -86,7 +86,7 @@ func AddKVPToMap(result consul.ManifestResult, source int, filterNode types.Node
 		for launchableID, launchable := range result.Manifest.GetLaunchableStanzas() {
 			var version *launch.LaunchableVersion
 
-			if launchable.Version.ID != "" {
+			if launchable.Version.IsSet() {
 				version = &launchable.Version
 			}
 			old.RealityVersions[launchableID] = LaunchableVersion{
@@ -29,6 +29,9 @@ const (
 	RU   = Type("rolls")
 )
 
+// AllTypes is every label type
+var AllTypes = []Type{POD, NODE, PC, RC, RU}
+
 var InvalidType error = errors.New("Invalid type provided")
 
 func AsType(v string) (Type, error) {
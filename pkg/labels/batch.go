@@ -0,0 +1,94 @@
+package labels
+
+import (
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// Mutation is a change to the labels of one object. RemoveAll is applied
+// first, then Remove, then Set.
+type Mutation struct {
+	LabelType Type
+	ID        string
+
+	// RemoveAll removes every existing label, so that Set replaces them
+	RemoveAll bool
+	Remove    []string
+	Set       map[string]string
+}
+
+// BatchApplicator applies mutations to any number of objects, of any label
+// types, atomically: either all of them are applied or none are. This is for
+// workflows whose labels must appear together, like creating a pod cluster
+// along with the labels of its pods, nodes and replication controller.
+type BatchApplicator interface {
+	BatchApply(mutations []Mutation) error
+}
+
+// objectMutation is every Mutation in a batch for one object combined into
+// one
+type objectMutation struct {
+	labelType Type
+	id        string
+	replace   bool
+	// labels with nil values are removed
+	labels map[string]*string
+}
+
+// combineMutations merges the mutations of each object, in order. A consul
+// transaction can only check-and-set each object once, and the result of
+// applying the combined mutation is the same as applying each in turn.
+func combineMutations(mutations []Mutation) []*objectMutation {
+	type objectKey struct {
+		labelType Type
+		id        string
+	}
+
+	byObject := make(map[objectKey]*objectMutation)
+	var combined []*objectMutation
+	for _, mutation := range mutations {
+		key := objectKey{labelType: mutation.LabelType, id: mutation.ID}
+		object, ok := byObject[key]
+		if !ok {
+			object = &objectMutation{
+				labelType: mutation.LabelType,
+				id:        mutation.ID,
+				labels:    make(map[string]*string),
+			}
+			byObject[key] = object
+			combined = append(combined, object)
+		}
+
+		if mutation.RemoveAll {
+			object.replace = true
+			object.labels = make(map[string]*string)
+		}
+		for _, name := range mutation.Remove {
+			object.labels[name] = nil
+		}
+		for name, value := range mutation.Set {
+			// We can't just use &value because that would be a pointer to
+			// the iteration variable
+			valPtr := value
+			object.labels[name] = &valPtr
+		}
+	}
+	return combined
+}
+
+// apply returns the result of applying the mutation to set
+func (m *objectMutation) apply(set labels.Set) labels.Set {
+	result := labels.Set{}
+	if !m.replace {
+		for name, value := range set {
+			result[name] = value
+		}
+	}
+	for name, value := range m.labels {
+		if value == nil {
+			delete(result, name)
+		} else {
+			result[name] = *value
+		}
+	}
+	return result
+}
@@ -44,12 +44,18 @@ func (e CASError) Error() string {
 	return fmt.Sprintf("Could not check-and-set key %q", e.Key)
 }
 
+// CASConflict lets consulutil.IsCASConflict recognize the error
+func (e CASError) CASConflict() bool {
+	return true
+}
+
 type consulKV interface {
 	List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
 	CAS(pair *api.KVPair, opts *api.WriteOptions) (bool, *api.WriteMeta, error)
 	Delete(key string, opts *api.WriteOptions) (*api.WriteMeta, error)
 	DeleteCAS(pair *api.KVPair, opts *api.WriteOptions) (bool, *api.WriteMeta, error)
 	Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error)
 }
 
 type consulApplicator struct {
@@ -60,6 +66,8 @@ type consulApplicator struct {
 	aggregatorMux sync.Mutex
 	metReg        MetricsRegistry
 	retryMetric   metrics.Gauge
+	// recorded in the history of the labels it changes
+	actor string
 }
 
 func NewConsulApplicator(client consulutil.ConsulClient, retries int) *consulApplicator {
@@ -69,9 +77,23 @@ func NewConsulApplicator(client consulutil.ConsulClient, retries int) *consulApp
 		retries:     retries,
 		aggregators: map[Type]*consulAggregator{},
 		retryMetric: metrics.NewGauge(),
+		actor:       DefaultActor(),
 	}
 }
 
+// SetActor sets how the changes made by the applicator are attributed in
+// label history. It defaults to DefaultActor().
+func (c *consulApplicator) SetActor(actor string) {
+	c.actor = actor
+}
+
+// WithActor returns a Mutator that makes changes with the applicator but
+// attributes them to actor in label history, e.g. to record the client a
+// server is acting for
+func (c *consulApplicator) WithActor(actor string) Mutator {
+	return actorApplicator{consulApplicator: c, actor: actor}
+}
+
 func (c *consulApplicator) SetMetricsRegistry(metReg MetricsRegistry) {
 	c.metReg = metReg
 	c.retryMetric = metrics.NewGauge()
@@ -169,42 +191,29 @@ func (c *consulApplicator) ListLabels(labelType Type) ([]Labeled, error) {
 	return allLabeled, nil
 }
 
-// generalized label mutator function - pass nil value for any label to delete it
-func (c *consulApplicator) mutateLabels(labelType Type, id string, labels map[string]*string) error {
-	l, index, err := c.GetLabelsWithIndex(labelType, id)
-	if err != nil {
-		return err
-	}
-
-	for key, value := range labels {
-		if value == nil {
-			delete(l.Labels, key)
-		} else {
-			l.Labels[key] = *value
-		}
-	}
+// applyMutations applies the mutations in a single transaction built from
+// labels and history read from f
+func (c *consulApplicator) applyMutations(mutations []*objectMutation, f LabelFetcher) error {
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
 
-	setkvp, err := convertLabeledToKVP(l)
+	keys, err := mutationsTxn(ctx, mutations, f)
 	if err != nil {
 		return err
 	}
-	setkvp.ModifyIndex = index
 
-	var success bool
-	if len(l.Labels) == 0 {
-		// still have to use CAS when deleting, to avoid discarding someone
-		// else's concurrent modification
-		// DeleteCAS ignores the value on the KVPair, so it doesn't matter if
-		// we set it earlier
-		success, _, err = c.kv.DeleteCAS(setkvp, nil)
-	} else {
-		success, _, err = c.kv.CAS(setkvp, nil)
-	}
+	ok, resp, err := transaction.Commit(ctx, c.kv)
 	if err != nil {
 		return err
 	}
-	if !success {
-		return CASError{setkvp.Key}
+	if !ok {
+		// every operation is a check-and-set, so the transaction was
+		// rolled back because one of the objects changed since it was read
+		var key string
+		if len(resp.Errors) > 0 && resp.Errors[0].OpIndex < len(keys) {
+			key = keys[resp.Errors[0].OpIndex]
+		}
+		return CASError{key}
 	}
 	return nil
 }
@@ -213,6 +222,13 @@ type LabelFetcher interface {
 	GetLabelsWithIndex(labelType Type, id string) (Labeled, uint64, error)
 }
 
+// historian is implemented by LabelFetchers that keep label history, so that
+// the transactions built from their labels record the changes they make
+type historian interface {
+	getHistoryWithIndex(labelType Type, id string) ([]HistoryEntry, uint64, error)
+	historyActor() string
+}
+
 // mutateLabelsTxn adds operations to the transaction within the passed context
 // to safely make the label mutations requested. It's written as a package
 // global function to avoid obligating all "applicator" interface types from
@@ -225,47 +241,168 @@ func mutateLabelsTxn(
 	labels map[string]*string,
 	f LabelFetcher,
 ) error {
-	l, index, err := f.GetLabelsWithIndex(labelType, id)
-	if err != nil {
-		return err
-	}
+	_, err := mutationsTxn(ctx, []*objectMutation{{
+		labelType: labelType,
+		id:        id,
+		labels:    labels,
+	}}, f)
+	return err
+}
 
-	for key, value := range labels {
-		if value == nil {
-			delete(l.Labels, key)
-		} else {
-			l.Labels[key] = *value
+// mutationsTxn adds the operations that make the mutations to the
+// transaction, and returns the keys of the operations it added, in order.
+// Each object that is changed uses one of the transaction's operations, or
+// two if f keeps history.
+func mutationsTxn(ctx context.Context, mutations []*objectMutation, f LabelFetcher) ([]string, error) {
+	h, keepsHistory := f.(historian)
+
+	var keys []string
+	for _, mutation := range mutations {
+		// history is read first so that a change committed between the
+		// two reads fails the check-and-set of the labels
+		var history []HistoryEntry
+		var historyIndex uint64
+		if keepsHistory {
+			var err error
+			history, historyIndex, err = h.getHistoryWithIndex(mutation.labelType, mutation.id)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		l, index, err := f.GetLabelsWithIndex(mutation.labelType, mutation.id)
+		if err != nil {
+			return nil, err
+		}
+		old := l.Labels
+		l.Labels = mutation.apply(old)
+		if len(old) == 0 && len(l.Labels) == 0 {
+			// the object had no labels and still doesn't
+			continue
+		}
+
+		if keepsHistory && old.String() != l.Labels.String() {
+			history = appendHistory(history, HistoryEntry{
+				Time:  time.Now(),
+				Actor: h.historyActor(),
+				Old:   old,
+				New:   l.Labels,
+			})
+			op, err := historyTxnOp(mutation.labelType, mutation.id, history, historyIndex)
+			if err != nil {
+				return nil, err
+			}
+			err = transaction.Add(ctx, op)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, op.Key)
 		}
+
+		op, err := labeledTxnOp(l, index)
+		if err != nil {
+			return nil, err
+		}
+		err = transaction.Add(ctx, op)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, op.Key)
 	}
+	return keys, nil
+}
 
+// labeledTxnOp returns the transaction operation that check-and-sets the
+// labels of l, which were read at index
+func labeledTxnOp(l Labeled, index uint64) (api.KVTxnOp, error) {
 	// TODO: we don't need convertLabeledToKVP to return an api.KVPair anymore
 	// because we deconstruct it to put it in a transaction
 	setkvp, err := convertLabeledToKVP(l)
 	if err != nil {
-		return err
+		return api.KVTxnOp{}, err
 	}
 
-	var op api.KVTxnOp
 	if len(l.Labels) == 0 {
 		// still have to use CAS when deleting, to avoid discarding someone
 		// else's concurrent modification
 		// DeleteCAS ignores the value on the KVPair, so it doesn't matter if
 		// we set it earlier
-		op = api.KVTxnOp{
+		return api.KVTxnOp{
 			Verb:  api.KVDeleteCAS,
 			Key:   setkvp.Key,
 			Index: index,
-		}
-	} else {
-		op = api.KVTxnOp{
-			Verb:  api.KVCAS,
-			Key:   setkvp.Key,
-			Value: setkvp.Value,
-			Index: index,
-		}
+		}, nil
+	}
+	return api.KVTxnOp{
+		Verb:  api.KVCAS,
+		Key:   setkvp.Key,
+		Value: setkvp.Value,
+		Index: index,
+	}, nil
+}
+
+// historyTxnOp returns the transaction operation that check-and-sets an
+// object's label history, which was read at index
+func historyTxnOp(labelType Type, id string, history []HistoryEntry, index uint64) (api.KVTxnOp, error) {
+	key, err := historyPath(labelType, id)
+	if err != nil {
+		return api.KVTxnOp{}, err
+	}
+	value, err := json.Marshal(history)
+	if err != nil {
+		return api.KVTxnOp{}, err
+	}
+	return api.KVTxnOp{
+		Verb:  api.KVCAS,
+		Key:   key,
+		Value: value,
+		Index: index,
+	}, nil
+}
+
+func (c *consulApplicator) getHistoryWithIndex(labelType Type, id string) ([]HistoryEntry, uint64, error) {
+	key, err := historyPath(labelType, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	kvp, _, err := c.kv.Get(key, nil)
+	if err != nil || kvp == nil {
+		return nil, 0, err
 	}
 
-	return transaction.Add(ctx, op)
+	var history []HistoryEntry
+	err = json.Unmarshal(kvp.Value, &history)
+	if err != nil {
+		return nil, 0, util.Errorf("Malformed label history at %s: %s", key, err)
+	}
+	return history, kvp.ModifyIndex, nil
+}
+
+func (c *consulApplicator) historyActor() string {
+	return c.actor
+}
+
+// GetLabelHistory returns the last MaxHistoryEntries changes to the object's
+// labels, oldest first
+func (c *consulApplicator) GetLabelHistory(labelType Type, id string) ([]HistoryEntry, error) {
+	history, _, err := c.getHistoryWithIndex(labelType, id)
+	return history, err
+}
+
+// BatchApply applies the mutations in a single consul transaction. If any of
+// the objects is modified concurrently, the whole batch is retried up to the
+// number of attempts specified in c.retries.
+func (c *consulApplicator) BatchApply(mutations []Mutation) error {
+	return c.retryApply(combineMutations(mutations), c)
+}
+
+// BatchApplyTxn is the same as BatchApply but adds the operations to the
+// passed transaction rather than committing them itself. Each object that is
+// changed uses two of the transaction's operations, one for its labels and
+// one for its history.
+func (c *consulApplicator) BatchApplyTxn(ctx context.Context, mutations []Mutation) error {
+	_, err := mutationsTxn(ctx, combineMutations(mutations), c)
+	return err
 }
 
 func labelsFromKeyValue(label string, value *string) map[string]*string {
@@ -277,10 +414,18 @@ func labelsFromKeyValue(label string, value *string) map[string]*string {
 // this function will attempt to mutateLabel. if it gets a CAS error, then it
 // will retry up to the number of attempts specified in c.Retries
 func (c *consulApplicator) retryMutate(labelType Type, id string, labels map[string]*string) error {
-	err := c.mutateLabels(labelType, id, labels)
+	return c.retryApply([]*objectMutation{{
+		labelType: labelType,
+		id:        id,
+		labels:    labels,
+	}}, c)
+}
+
+func (c *consulApplicator) retryApply(mutations []*objectMutation, f LabelFetcher) error {
+	err := c.applyMutations(mutations, f)
 	for i := 0; i < c.retries; i++ {
 		if _, ok := err.(CASError); ok {
-			err = c.mutateLabels(labelType, id, labels)
+			err = c.applyMutations(mutations, f)
 		} else {
 			c.updateRetryCount(i)
 			break
@@ -353,19 +498,23 @@ func removeLabelsTxn(ctx context.Context, labelType Type, id string, keysToRemov
 }
 
 func (c *consulApplicator) RemoveAllLabels(labelType Type, id string) error {
-	path, err := objectPath(labelType, id)
-	if err != nil {
-		return err
-	}
-	_, err = c.kv.Delete(path, nil)
-	return err
+	return c.retryApply(removeAllMutation(labelType, id), c)
 }
 
 // RemoveAllLabelsTxn is the same as RemoveAllLabels but adds the operation to
 // the passed transaction rather than synchronously making the requisite consul
 // call
 func (c *consulApplicator) RemoveAllLabelsTxn(ctx context.Context, labelType Type, id string) error {
-	return removeAllLabelsTxn(ctx, labelType, id)
+	_, err := mutationsTxn(ctx, removeAllMutation(labelType, id), c)
+	return err
+}
+
+func removeAllMutation(labelType Type, id string) []*objectMutation {
+	return []*objectMutation{{
+		labelType: labelType,
+		id:        id,
+		replace:   true,
+	}}
 }
 
 func removeAllLabelsTxn(ctx context.Context, labelType Type, id string) error {
@@ -459,10 +608,13 @@ func (c *consulApplicator) WatchMatchDiff(
 	quitCh <-chan struct{},
 ) <-chan *LabeledChanges {
 	inCh, _ := c.WatchMatches(selector, labelType, aggregationRate, quitCh)
-	return watchDiffLabels(inCh, quitCh, c.logger)
+	return WatchDiffLabels(inCh, quitCh, c.logger)
 }
 
-func watchDiffLabels(inCh <-chan []Labeled, quitCh <-chan struct{}, logger logging.Logger) <-chan *LabeledChanges {
+// WatchDiffLabels converts a stream of label matches, such as the output of
+// WatchMatches(), into the changes between consecutive results. The output
+// channel is closed when quitCh is closed or inCh is closed.
+func WatchDiffLabels(inCh <-chan []Labeled, quitCh <-chan struct{}, logger logging.Logger) <-chan *LabeledChanges {
 	outCh := make(chan *LabeledChanges)
 
 	go func() {
@@ -542,4 +694,38 @@ func NodeAndPodIDFromPodLabel(labeled Labeled) (types.NodeName, types.PodID, err
 }
 
 // confirm at compile time that consulApplicator is an implementation of the Applicator interface
+// actorApplicator makes changes with a consulApplicator on behalf of actor
+type actorApplicator struct {
+	*consulApplicator
+	actor string
+}
+
+var _ Mutator = actorApplicator{}
+
+func (a actorApplicator) historyActor() string {
+	return a.actor
+}
+
+func (a actorApplicator) SetLabel(labelType Type, id, label, value string) error {
+	return a.SetLabels(labelType, id, map[string]string{label: value})
+}
+
+func (a actorApplicator) SetLabels(labelType Type, id string, labels map[string]string) error {
+	return a.BatchApply([]Mutation{{LabelType: labelType, ID: id, Set: labels}})
+}
+
+func (a actorApplicator) RemoveLabel(labelType Type, id, label string) error {
+	return a.BatchApply([]Mutation{{LabelType: labelType, ID: id, Remove: []string{label}}})
+}
+
+func (a actorApplicator) RemoveAllLabels(labelType Type, id string) error {
+	return a.retryApply(removeAllMutation(labelType, id), a)
+}
+
+func (a actorApplicator) BatchApply(mutations []Mutation) error {
+	return a.retryApply(combineMutations(mutations), a)
+}
+
 var _ Applicator = &consulApplicator{}
+var _ BatchApplicator = &consulApplicator{}
+var _ HistoryReader = &consulApplicator{}
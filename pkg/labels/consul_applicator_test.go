@@ -1,6 +1,7 @@
 package labels
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"sync"
@@ -66,6 +67,21 @@ func (f *fakeLabelStore) CAS(pair *api.KVPair, opts *api.WriteOptions) (bool, *a
 	return true, &api.WriteMeta{}, nil
 }
 
+// Txn applies CAS and delete operations without checking indexes
+func (f *fakeLabelStore) Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	f.dataMu.Lock()
+	defer f.dataMu.Unlock()
+	for _, op := range txn {
+		switch api.KVOp(op.Verb) {
+		case api.KVCAS, api.KVSet:
+			f.data[op.Key] = op.Value
+		case api.KVDeleteCAS, api.KVDelete:
+			delete(f.data, op.Key)
+		}
+	}
+	return true, &api.KVTxnResponse{}, &api.QueryMeta{}, nil
+}
+
 func (f *fakeLabelStore) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
 	f.dataMu.Lock()
 	defer f.dataMu.Unlock()
@@ -228,6 +244,16 @@ func (f *failOnceLabelStore) Get(key string, q *api.QueryOptions) (*api.KVPair,
 	return f.inner.Get(key, q)
 }
 
+func (f *failOnceLabelStore) Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	if !f.succeedCAS {
+		f.succeedCAS = true
+		return false, &api.KVTxnResponse{
+			Errors: api.TxnErrors{{OpIndex: len(txn) - 1, What: "index is stale"}},
+		}, &api.QueryMeta{}, nil
+	}
+	return f.inner.Txn(txn, q)
+}
+
 func TestCASRetries(t *testing.T) {
 	c := &consulApplicator{
 		kv:          &failOnceLabelStore{inner: &fakeLabelStore{data: map[string][]byte{}}},
@@ -253,6 +279,94 @@ func TestCASNoRetries(t *testing.T) {
 	Assert(t).IsTrue(ok, "should have returned a CASError")
 }
 
+func TestBatchApply(t *testing.T) {
+	c := &consulApplicator{
+		kv:          &fakeLabelStore{data: map[string][]byte{}},
+		logger:      logging.DefaultLogger,
+		retryMetric: metrics.NewGauge(),
+	}
+	Assert(t).IsNil(c.SetLabels(NODE, "node1", map[string]string{"old": "yes", "keep": "yes"}), "test setup: could not set labels")
+	Assert(t).IsNil(c.SetLabel(RC, "rc1", "old", "yes"), "test setup: could not set labels")
+
+	err := c.BatchApply([]Mutation{
+		{LabelType: POD, ID: "node1/pod", Set: map[string]string{"cluster": "a"}},
+		{LabelType: NODE, ID: "node1", Remove: []string{"old"}},
+		{LabelType: NODE, ID: "node1", Set: map[string]string{"cluster": "a"}},
+		{LabelType: RC, ID: "rc1", RemoveAll: true, Set: map[string]string{"cluster": "a"}},
+	})
+	Assert(t).IsNil(err, "should not have erred applying the batch")
+
+	pod, err := c.GetLabels(POD, "node1/pod")
+	Assert(t).IsNil(err, "should not have erred getting labels")
+	Assert(t).AreEqual(pod.Labels.String(), "cluster=a", "should have set the pod's labels")
+
+	node, err := c.GetLabels(NODE, "node1")
+	Assert(t).IsNil(err, "should not have erred getting labels")
+	Assert(t).AreEqual(node.Labels.String(), "cluster=a,keep=yes", "should have applied both of the node's mutations")
+
+	rc, err := c.GetLabels(RC, "rc1")
+	Assert(t).IsNil(err, "should not have erred getting labels")
+	Assert(t).AreEqual(rc.Labels.String(), "cluster=a", "should have replaced the rc's labels")
+}
+
+func TestBatchApplyRetriesRollbacks(t *testing.T) {
+	c := &consulApplicator{
+		kv:          &failOnceLabelStore{inner: &fakeLabelStore{data: map[string][]byte{}}},
+		logger:      logging.DefaultLogger,
+		retries:     0,
+		retryMetric: metrics.NewGauge(),
+	}
+
+	mutations := []Mutation{
+		{LabelType: POD, ID: "node1/pod", Set: map[string]string{"cluster": "a"}},
+		{LabelType: NODE, ID: "node1", Set: map[string]string{"cluster": "a"}},
+	}
+	err := c.BatchApply(mutations)
+	Assert(t).IsNotNil(err, "should have failed on first try")
+	casErr, ok := err.(CASError)
+	Assert(t).IsTrue(ok, "should have returned a CASError")
+	Assert(t).AreEqual(casErr.Key, "labels/node/node1", "should have named the key that failed")
+
+	c.retries = 3
+	c.kv = &failOnceLabelStore{inner: &fakeLabelStore{data: map[string][]byte{}}}
+	Assert(t).IsNil(c.BatchApply(mutations), "should have retried despite failing once")
+}
+
+func TestLabelHistory(t *testing.T) {
+	c := &consulApplicator{
+		kv:          &fakeLabelStore{data: map[string][]byte{}},
+		logger:      logging.DefaultLogger,
+		retryMetric: metrics.NewGauge(),
+		actor:       "tester",
+	}
+
+	Assert(t).IsNil(c.SetLabel(NODE, "node1", "cluster", "a"), "should not have erred setting label")
+	Assert(t).IsNil(c.SetLabel(NODE, "node1", "cluster", "a"), "should not have erred setting label")
+	Assert(t).IsNil(c.WithActor("other").RemoveAllLabels(NODE, "node1"), "should not have erred removing labels")
+
+	history, err := c.GetLabelHistory(NODE, "node1")
+	Assert(t).IsNil(err, "should not have erred getting history")
+	Assert(t).AreEqual(len(history), 2, "should not have recorded setting a label to its current value")
+	Assert(t).AreEqual(history[0].Actor, "tester", "should have recorded the applicator's actor")
+	Assert(t).AreEqual(history[0].Old.String(), "", "should have recorded the old labels")
+	Assert(t).AreEqual(history[0].New.String(), "cluster=a", "should have recorded the new labels")
+	Assert(t).AreEqual(history[1].Actor, "other", "should have recorded the actor passed to WithActor")
+	Assert(t).AreEqual(history[1].Old.String(), "cluster=a", "should have recorded the old labels")
+	Assert(t).AreEqual(history[1].New.String(), "", "should have recorded the new labels")
+
+	for i := 0; i < MaxHistoryEntries+5; i++ {
+		Assert(t).IsNil(c.SetLabel(NODE, "node1", "count", fmt.Sprint(i)), "should not have erred setting label")
+	}
+	history, err = c.GetLabelHistory(NODE, "node1")
+	Assert(t).IsNil(err, "should not have erred getting history")
+	Assert(t).AreEqual(len(history), MaxHistoryEntries, "should have discarded the oldest changes")
+	Assert(t).AreEqual(history[len(history)-1].New["count"], fmt.Sprint(MaxHistoryEntries+4), "should have kept the latest change")
+
+	history, err = c.GetLabelHistory(NODE, "node2")
+	Assert(t).IsNil(err, "should not have erred getting history of an object that was never labeled")
+	Assert(t).AreEqual(len(history), 0, "should not have had history for an object that was never labeled")
+}
+
 func TestWatchMatchDiff(t *testing.T) {
 	DefaultAggregationRate = 0
 	c := &consulApplicator{
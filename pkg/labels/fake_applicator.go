@@ -18,15 +18,50 @@ type fakeApplicatorData map[Type]map[string]labels.Set
 type fakeApplicator struct {
 	// KV data that will be returned by queries
 	data fakeApplicatorData
+	// type -> id -> changes, oldest first
+	history map[Type]map[string][]HistoryEntry
 	// since entry() may mutate the map, every read can potentially trigger a
 	// write. no point using rwmutex here
 	mutex sync.Mutex
 }
 
 var _ Applicator = &fakeApplicator{}
+var _ BatchApplicator = &fakeApplicator{}
+var _ HistoryReader = &fakeApplicator{}
+
+// fakeActor is the actor of every change in the fake applicator's history
+const fakeActor = "fake applicator"
 
 func NewFakeApplicator() *fakeApplicator {
-	return &fakeApplicator{data: make(fakeApplicatorData)}
+	return &fakeApplicator{
+		data:    make(fakeApplicatorData),
+		history: make(map[Type]map[string][]HistoryEntry),
+	}
+}
+
+// record adds a change from old to the current labels of the object to its
+// history, unless nothing changed
+func (app *fakeApplicator) record(labelType Type, id string, old labels.Set) {
+	current := app.data[labelType][id]
+	if old.String() == labels.Set(current).String() {
+		return
+	}
+	if _, ok := app.history[labelType]; !ok {
+		app.history[labelType] = make(map[string][]HistoryEntry)
+	}
+	app.history[labelType][id] = appendHistory(app.history[labelType][id], HistoryEntry{
+		Time:  time.Now(),
+		Actor: fakeActor,
+		Old:   old,
+		New:   copySet(current),
+	})
+}
+
+func (app *fakeApplicator) GetLabelHistory(labelType Type, id string) ([]HistoryEntry, error) {
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+	history := app.history[labelType][id]
+	return append([]HistoryEntry(nil), history...), nil
 }
 
 func (app *fakeApplicator) entry(labelType Type, id string) map[string]string {
@@ -44,7 +79,9 @@ func (app *fakeApplicator) SetLabel(labelType Type, id, name, value string) erro
 	app.mutex.Lock()
 	defer app.mutex.Unlock()
 	entry := app.entry(labelType, id)
+	old := copySet(entry)
 	entry[name] = value
+	app.record(labelType, id, old)
 	return nil
 }
 
@@ -52,9 +89,11 @@ func (app *fakeApplicator) SetLabels(labelType Type, id string, labels map[strin
 	app.mutex.Lock()
 	defer app.mutex.Unlock()
 	entry := app.entry(labelType, id)
+	old := copySet(entry)
 	for k, v := range labels {
 		entry[k] = v
 	}
+	app.record(labelType, id, old)
 	return nil
 }
 
@@ -65,7 +104,9 @@ func (app *fakeApplicator) SetLabelsTxn(ctx context.Context, labelType Type, id
 func (app *fakeApplicator) RemoveAllLabels(labelType Type, id string) error {
 	app.mutex.Lock()
 	defer app.mutex.Unlock()
+	old := copySet(app.data[labelType][id])
 	delete(app.data[labelType], id)
+	app.record(labelType, id, old)
 	return nil
 }
 
@@ -79,7 +120,9 @@ func (app *fakeApplicator) RemoveLabel(labelType Type, id, name string) error {
 	app.mutex.Lock()
 	defer app.mutex.Unlock()
 	entry := app.entry(labelType, id)
+	old := copySet(entry)
 	delete(entry, name)
+	app.record(labelType, id, old)
 	return nil
 }
 
@@ -87,6 +130,22 @@ func (app *fakeApplicator) RemoveLabelsTxn(ctx context.Context, labelType Type,
 	panic("not implemented")
 }
 
+func (app *fakeApplicator) BatchApply(mutations []Mutation) error {
+	app.mutex.Lock()
+	defer app.mutex.Unlock()
+	for _, mutation := range combineMutations(mutations) {
+		old := copySet(app.entry(mutation.labelType, mutation.id))
+		set := mutation.apply(old)
+		if len(set) == 0 {
+			delete(app.data[mutation.labelType], mutation.id)
+		} else {
+			app.data[mutation.labelType][mutation.id] = set
+		}
+		app.record(mutation.labelType, mutation.id, old)
+	}
+	return nil
+}
+
 func (app *fakeApplicator) ListLabels(labelType Type) ([]Labeled, error) {
 	res := []Labeled{}
 	for id, set := range app.data[labelType] {
@@ -174,7 +233,7 @@ func (app *fakeApplicator) WatchMatchDiff(
 	quitCh <-chan struct{},
 ) <-chan *LabeledChanges {
 	inCh, _ := app.WatchMatches(selector, labelType, aggregationRate, quitCh)
-	return watchDiffLabels(inCh, quitCh, logging.DefaultLogger)
+	return WatchDiffLabels(inCh, quitCh, logging.DefaultLogger)
 }
 
 // avoid returning elements of the inner data map, otherwise concurrent callers
@@ -0,0 +1,79 @@
+package labels
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// The history of each object's labels is stored at
+// /label_history/<type>/<id>, outside of labelRoot so that it isn't read by
+// label queries
+const labelHistoryRoot = "label_history"
+
+// MaxHistoryEntries is the number of changes kept in each object's label
+// history. Older changes are discarded.
+const MaxHistoryEntries = 20
+
+// HistoryEntry records one change to the labels of an object
+type HistoryEntry struct {
+	Time time.Time `json:"time"`
+	// Actor identifies what made the change, see DefaultActor()
+	Actor string     `json:"actor"`
+	Old   labels.Set `json:"old"`
+	New   labels.Set `json:"new"`
+}
+
+// HistoryReader returns the recent changes to an object's labels, oldest
+// first. Changes made by applicators that don't keep history, like the
+// transactions built by the HTTP applicator, are not included.
+type HistoryReader interface {
+	GetLabelHistory(labelType Type, id string) ([]HistoryEntry, error)
+}
+
+// Mutator is the part of Applicator that changes labels
+type Mutator interface {
+	SetLabel(labelType Type, id, name, value string) error
+	SetLabels(labelType Type, id string, labels map[string]string) error
+	RemoveLabel(labelType Type, id, name string) error
+	RemoveAllLabels(labelType Type, id string) error
+	BatchApplicator
+}
+
+// DefaultActor identifies the current process in label history as
+// "<user>@<host> (<binary>)"
+func DefaultActor() string {
+	username := "unknown"
+	if currentUser, err := user.Current(); err == nil {
+		username = currentUser.Username
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s@%s (%s)", username, hostname, filepath.Base(os.Args[0]))
+}
+
+func historyPath(labelType Type, id string) (string, error) {
+	if id == "" {
+		return "", util.Errorf("Empty ID in label history path")
+	}
+	return path.Join(labelHistoryRoot, labelType.String(), id), nil
+}
+
+// appendHistory adds entry to history, discarding the oldest entries beyond
+// MaxHistoryEntries
+func appendHistory(history []HistoryEntry, entry HistoryEntry) []HistoryEntry {
+	history = append(history, entry)
+	if len(history) > MaxHistoryEntries {
+		history = history[len(history)-MaxHistoryEntries:]
+	}
+	return history
+}
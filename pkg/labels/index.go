@@ -0,0 +1,246 @@
+package labels
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+
+	"github.com/Sirupsen/logrus"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// MatchWatcher is the part of Applicator that an Index is kept up to date
+// with
+type MatchWatcher interface {
+	WatchMatches(selector labels.Selector, labelType Type, aggregationRate time.Duration, quitCh <-chan struct{}) (chan []Labeled, error)
+}
+
+// Index keeps every object of some label types in memory along with an
+// inverted index from each label key and value to the objects that have it.
+// Selectors with an equality or set-based "in" requirement are resolved by
+// only evaluating the objects the index returns for that requirement, rather
+// than every object of the type.
+//
+// The index is kept up to date by watching every object of each type, so its
+// results lag behind writes by up to the aggregation rate of the watch, the
+// same as GetCachedMatches().
+type Index struct {
+	mu      sync.RWMutex
+	indexes map[Type]*typeIndex
+}
+
+// typeIndex is the index of one label type
+type typeIndex struct {
+	objects map[string]labels.Set
+	// label key -> label value -> IDs of the objects with that label
+	postings map[string]map[string]map[string]struct{}
+}
+
+// NewIndex starts watching every object of each of labelTypes with watcher
+// and indexing them, until quitCh is closed
+func NewIndex(watcher MatchWatcher, labelTypes []Type, aggregationRate time.Duration, logger logging.Logger, quitCh <-chan struct{}) *Index {
+	index := &Index{indexes: make(map[Type]*typeIndex)}
+	for _, labelType := range labelTypes {
+		go index.watch(watcher, labelType, aggregationRate, logger, quitCh)
+	}
+	return index
+}
+
+func (i *Index) watch(watcher MatchWatcher, labelType Type, aggregationRate time.Duration, logger logging.Logger, quitCh <-chan struct{}) {
+	logger = logger.SubLogger(logrus.Fields{"label_type": labelType})
+	for {
+		matchCh, err := watcher.WatchMatches(labels.Everything(), labelType, aggregationRate, quitCh)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not watch labels to index")
+			select {
+			case <-quitCh:
+				return
+			case <-time.After(aggregationRate + time.Second):
+				continue
+			}
+		}
+
+		for matches := range matchCh {
+			i.update(labelType, matches)
+		}
+
+		select {
+		case <-quitCh:
+			return
+		default:
+			// WatchMatches() can terminate without the quit channel being
+			// signaled, just start again
+		}
+	}
+}
+
+// update replaces the indexed objects of labelType with matches
+func (i *Index) update(labelType Type, matches []Labeled) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	index, ok := i.indexes[labelType]
+	if !ok {
+		index = &typeIndex{
+			objects:  make(map[string]labels.Set),
+			postings: make(map[string]map[string]map[string]struct{}),
+		}
+		i.indexes[labelType] = index
+	}
+
+	current := make(map[string]struct{}, len(matches))
+	for _, match := range matches {
+		current[match.ID] = struct{}{}
+		old, ok := index.objects[match.ID]
+		if ok && old.String() == match.Labels.String() {
+			continue
+		}
+		index.remove(match.ID)
+		index.add(match.ID, match.Labels)
+	}
+	for id := range index.objects {
+		if _, ok := current[id]; !ok {
+			index.remove(id)
+		}
+	}
+}
+
+func (t *typeIndex) add(id string, set labels.Set) {
+	t.objects[id] = set
+	for key, value := range set {
+		values, ok := t.postings[key]
+		if !ok {
+			values = make(map[string]map[string]struct{})
+			t.postings[key] = values
+		}
+		ids, ok := values[value]
+		if !ok {
+			ids = make(map[string]struct{})
+			values[value] = ids
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+func (t *typeIndex) remove(id string) {
+	for key, value := range t.objects[id] {
+		ids := t.postings[key][value]
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(t.postings[key], value)
+		}
+		if len(t.postings[key]) == 0 {
+			delete(t.postings, key)
+		}
+	}
+	delete(t.objects, id)
+}
+
+// candidates returns the IDs of the objects that can match selector, or nil
+// if every object can. It uses the requirement that narrows the objects down
+// the most.
+func (t *typeIndex) candidates(selector labels.Selector) map[string]struct{} {
+	requirements, ok := selector.(labels.LabelSelector)
+	if !ok {
+		return nil
+	}
+
+	var best map[string]struct{}
+	for _, requirement := range requirements {
+		switch requirement.Operator() {
+		case labels.EqualsOperator, labels.DoubleEqualsOperator, labels.InOperator:
+		default:
+			continue
+		}
+
+		values := t.postings[requirement.Key()]
+		ids := make(map[string]struct{})
+		for value := range requirement.Values() {
+			for id := range values[value] {
+				ids[id] = struct{}{}
+			}
+		}
+		if best == nil || len(ids) < len(best) {
+			best = ids
+		}
+	}
+	return best
+}
+
+// GetMatches returns the indexed objects of labelType that match selector,
+// sorted by ID. It returns false if labelType isn't indexed yet, either
+// because it isn't being watched, the watch hasn't returned yet, or there are
+// no objects of the type.
+func (i *Index) GetMatches(selector labels.Selector, labelType Type) ([]Labeled, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	index, ok := i.indexes[labelType]
+	if !ok || len(index.objects) == 0 {
+		return nil, false
+	}
+
+	var ids []string
+	if candidates := index.candidates(selector); candidates != nil {
+		ids = make([]string, 0, len(candidates))
+		for id := range candidates {
+			ids = append(ids, id)
+		}
+	} else {
+		ids = make([]string, 0, len(index.objects))
+		for id := range index.objects {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	matches := []Labeled{}
+	for _, id := range ids {
+		set := index.objects[id]
+		if selector.Matches(set) {
+			matches = append(matches, Labeled{
+				ID:        id,
+				LabelType: labelType,
+				Labels:    copySet(set),
+			})
+		}
+	}
+	return matches, true
+}
+
+// indexedApplicator is an Applicator whose queries are answered by an Index
+// whenever it has indexed the label type
+type indexedApplicator struct {
+	Applicator
+	index *Index
+}
+
+// NewIndexedApplicator returns an Applicator that indexes every label type
+// by watching inner, and answers GetMatches() and GetCachedMatches() from
+// the index. Queries fall back to inner until a label type is indexed. Since
+// the index lags behind writes, GetMatches() doesn't necessarily reflect
+// changes that were just made, even ones made with the returned applicator.
+func NewIndexedApplicator(inner Applicator, aggregationRate time.Duration, logger logging.Logger, quitCh <-chan struct{}) *indexedApplicator {
+	return &indexedApplicator{
+		Applicator: inner,
+		index:      NewIndex(inner, AllTypes, aggregationRate, logger, quitCh),
+	}
+}
+
+var _ Applicator = &indexedApplicator{}
+
+func (a *indexedApplicator) GetMatches(selector labels.Selector, labelType Type) ([]Labeled, error) {
+	if matches, ok := a.index.GetMatches(selector, labelType); ok {
+		return matches, nil
+	}
+	return a.Applicator.GetMatches(selector, labelType)
+}
+
+func (a *indexedApplicator) GetCachedMatches(selector labels.Selector, labelType Type, aggregationRate time.Duration) ([]Labeled, error) {
+	if matches, ok := a.index.GetMatches(selector, labelType); ok {
+		return matches, nil
+	}
+	return a.Applicator.GetCachedMatches(selector, labelType, aggregationRate)
+}
@@ -0,0 +1,80 @@
+package labels
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+
+	. "github.com/anthonybishopric/gotcha"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// waitForIndexedMatches polls the index until the matches of selector have
+// the expected IDs
+func waitForIndexedMatches(t *testing.T, index *Index, selector string, expected ...string) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		t.Fatalf("could not parse %q: %s", selector, err)
+	}
+
+	var ids []string
+	timeout := time.After(5 * time.Second)
+	for {
+		matches, ok := index.GetMatches(sel, NODE)
+		if ok {
+			ids = nil
+			for _, match := range matches {
+				ids = append(ids, match.ID)
+			}
+			if fmt.Sprint(ids) == fmt.Sprint(expected) {
+				return
+			}
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("expected %q to match %v, last matched %v", selector, expected, ids)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestIndexGetMatches(t *testing.T) {
+	app := NewFakeApplicator()
+	Assert(t).IsNil(app.SetLabels(NODE, "node1", map[string]string{"color": "red", "size": "large"}), "test setup: could not set labels")
+	Assert(t).IsNil(app.SetLabels(NODE, "node2", map[string]string{"color": "blue", "size": "large"}), "test setup: could not set labels")
+	Assert(t).IsNil(app.SetLabels(NODE, "node3", map[string]string{"color": "green"}), "test setup: could not set labels")
+
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	index := NewIndex(app, []Type{NODE}, time.Millisecond, logging.DefaultLogger, quitCh)
+
+	waitForIndexedMatches(t, index, "color=red", "node1")
+	waitForIndexedMatches(t, index, "color in (red,blue),size=large", "node1", "node2")
+	waitForIndexedMatches(t, index, "color=red,size=small")
+	waitForIndexedMatches(t, index, "size!=large", "node3")
+	waitForIndexedMatches(t, index, "", "node1", "node2", "node3")
+
+	Assert(t).IsNil(app.SetLabel(NODE, "node2", "color", "red"), "could not set label")
+	Assert(t).IsNil(app.RemoveAllLabels(NODE, "node1"), "could not remove labels")
+	waitForIndexedMatches(t, index, "color=red", "node2")
+	waitForIndexedMatches(t, index, "color=blue")
+
+	_, ok := index.GetMatches(labels.Everything(), POD)
+	Assert(t).IsFalse(ok, "should not have had matches for a type that isn't indexed")
+}
+
+func TestIndexedApplicatorFallsBack(t *testing.T) {
+	app := NewFakeApplicator()
+	Assert(t).IsNil(app.SetLabel(POD, "node1/pod", "color", "red"), "test setup: could not set labels")
+
+	indexed := &indexedApplicator{
+		Applicator: app,
+		index:      &Index{indexes: make(map[Type]*typeIndex)},
+	}
+	matches, err := indexed.GetMatches(labels.Everything().Add("color", labels.EqualsOperator, []string{"red"}), POD)
+	Assert(t).IsNil(err, "should not have erred getting matches")
+	Assert(t).AreEqual(len(matches), 1, "should have gotten matches from the inner applicator before indexing")
+}
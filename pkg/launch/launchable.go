@@ -6,6 +6,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/square/p2/pkg/cgroups"
 	"github.com/square/p2/pkg/runit"
@@ -33,6 +34,17 @@ type LaunchableVersion struct {
 	ArtifactOverride ArtifactName        `json:"artifact_name,omitempty" yaml:"artifact_name,omitempty"`
 	ID               LaunchableVersionID `json:"id" yaml:"id"`
 	Tags             map[string]string   `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// An alternative to ID naming a channel of the artifact (e.g. "stable")
+	// that the artifact registry resolves to a version when the pod is
+	// deployed. The version a channel points to is only picked up by
+	// deploys, so promoting a version to the channel doesn't change pods
+	// that are already running. May not be used in conjunction with ID.
+	Channel string `json:"channel,omitempty" yaml:"channel,omitempty"`
+}
+
+// IsSet returns whether the version names either a version or a channel
+func (v LaunchableVersion) IsSet() bool {
+	return v.ID != "" || v.Channel != ""
 }
 
 type LaunchableStanza struct {
@@ -62,12 +74,49 @@ type LaunchableStanza struct {
 	// can be used to query a configured artifact registry which will provide the artifact
 	// URL. Version may not be used in conjunction with Location
 	Version LaunchableVersion `yaml:"version,omitempty"`
+
+	// The image of a launchable of type "docker", pinned by digest (e.g.
+	// "registry.example.com/app@sha256:<digest>"). Docker launchables are
+	// pulled from their image's registry instead of using Location or
+	// Version.
+	Image string `yaml:"image,omitempty"`
+
+	// ArtifactSize, if set, is the size of the launchable's artifact (e.g.
+	// "2G"), used to check that there is room to install it. Otherwise the
+	// size is asked of the artifact's server.
+	ArtifactSize size.ByteCount `yaml:"artifact_size,omitempty"`
+
+	// Port, if set to AutoPort, has the preparer allocate a port to the
+	// launchable that is exported to it as PORT, and to the whole pod as
+	// PORT_<LAUNCHABLE_ID>. The port is kept across deploys of the pod.
+	Port string `yaml:"port,omitempty"`
+}
+
+// AutoPort is the value of a launchable's port that requests an allocated port
+const AutoPort = "auto"
+
+// PortEnvVar is the variable a launchable's allocated port is exported as
+const PortEnvVar = "PORT"
+
+// PodPortEnvVar is the variable the port allocated to a launchable is exported
+// to the rest of its pod as
+func PodPortEnvVar(launchableID LaunchableID) string {
+	name := strings.ToUpper(nonEnvChars.ReplaceAllString(launchableID.String(), "_"))
+	return PortEnvVar + "_" + name
 }
 
+var nonEnvChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
 func (l LaunchableStanza) LaunchableVersion() (LaunchableVersionID, error) {
 	if l.Version.ID != "" {
 		return l.Version.ID, nil
 	}
+	if l.Version.Channel != "" {
+		return "", util.Errorf("Channel %q has not been resolved to a version", l.Version.Channel)
+	}
+	if l.Image != "" {
+		return versionFromImage(l.Image)
+	}
 
 	return versionFromLocation(l.Location)
 }
@@ -98,6 +147,18 @@ func versionFromLocation(location string) (LaunchableVersionID, error) {
 	return LaunchableVersionID(parts[1]), nil
 }
 
+var imageDigestRegex = regexp.MustCompile(`@sha256:([a-f0-9]{64})$`)
+
+// The version of an image pinned by digest is its digest
+func versionFromImage(image string) (LaunchableVersionID, error) {
+	parts := imageDigestRegex.FindStringSubmatch(image)
+	if parts == nil {
+		return "", util.Errorf("Image is not pinned by digest: %s", image)
+	}
+
+	return LaunchableVersionID(parts[1]), nil
+}
+
 const DefaultAllowableDiskUsage = 10 * size.Gibibyte
 
 type DisableError struct{ Inner error }
@@ -116,6 +177,18 @@ type StopError struct{ Inner error }
 
 func (e StopError) Error() string { return e.Inner.Error() }
 
+// PreflightError is returned when a launchable's preflight check fails.
+// Output holds whatever the preflight script wrote.
+type PreflightError struct {
+	LaunchableID LaunchableID
+	Output       string
+	Inner        error
+}
+
+func (e PreflightError) Error() string {
+	return fmt.Sprintf("preflight for %s failed: %s", e.LaunchableID, e.Inner)
+}
+
 // Launchable describes a type of app that can be downloaded and launched.
 type Launchable interface {
 	// Type returns a text description of the type of launchable.
@@ -143,6 +216,11 @@ type Launchable interface {
 
 	// PostActive runs a Hoist-specific "post-activate" script in the launchable.
 	PostActivate() (string, error)
+	// Preflight runs a Hoist-specific "preflight" script in the newly
+	// installed launchable before it is made current, killing it if it
+	// runs longer than timeout. A non-nil error means the launchable
+	// should not be launched.
+	Preflight(timeout time.Duration) (string, error)
 	// Launch begins execution.
 	Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error
 	// Disable allows a launchable to stop work and do cleanup prior to Stop
@@ -163,6 +241,14 @@ type Launchable interface {
 	RestartPolicy() runit.RestartPolicy
 }
 
+// Installer is implemented by launchables that install themselves instead of
+// being downloaded from an artifact location, such as docker images pulled
+// from a registry. Install is called in place of downloading the artifact,
+// before PostInstall.
+type Installer interface {
+	Install() error
+}
+
 // Executable describes a command and its arguments that should be executed to start a
 // service running.
 type Executable struct {
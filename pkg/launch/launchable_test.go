@@ -54,3 +54,19 @@ func TestVersionFromLocation(t *testing.T) {
 		}
 	}
 }
+
+func TestVersionFromImage(t *testing.T) {
+	digest := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	version, err := LaunchableStanza{Image: "registry.example.com/app@sha256:" + digest}.LaunchableVersion()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing version from image: %s", err)
+	}
+	if version != LaunchableVersionID(digest) {
+		t.Errorf("Expected the version of the image to be its digest, was '%s'", version)
+	}
+
+	_, err = LaunchableStanza{Image: "registry.example.com/app:latest"}.LaunchableVersion()
+	if err == nil {
+		t.Error("Expected an error parsing version from an image that isn't pinned by digest")
+	}
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// The fields that logs parsed by a log pipeline can rely on, when they apply
+// to a message
+const (
+	NodeField      = "node"
+	PodField       = "pod"
+	OperationField = "operation"
+	// In seconds
+	DurationField = "duration"
+)
+
+// Other names that the standard fields were logged under, which the JSON
+// formatter renames
+var standardFieldAliases = map[string]string{
+	"node_name": NodeField,
+	"pod_id":    PodField,
+}
+
+// Recognized log formats
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// JSONFormatter formats each entry as a single line JSON object with its
+// message, level and time, and its fields with the standard ones under the
+// same names whatever the code logging them called them. Durations are
+// written as seconds.
+type JSONFormatter struct {
+	// If set, added to each entry that has no node field
+	Node string
+}
+
+func (f *JSONFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(map[string]interface{}, len(entry.Data)+4)
+	for key, value := range entry.Data {
+		if standard, ok := standardFieldAliases[key]; ok {
+			if _, set := entry.Data[standard]; !set {
+				key = standard
+			}
+		}
+		switch value := value.(type) {
+		case error:
+			// errors have no exported fields to marshal
+			data[key] = value.Error()
+		case time.Duration:
+			data[key] = value.Seconds()
+		default:
+			data[key] = value
+		}
+	}
+	if _, ok := data[NodeField]; !ok && f.Node != "" {
+		data[NodeField] = f.Node
+	}
+
+	// the entry's own fields win over fields of the same names, which are
+	// kept with a prefix
+	for _, key := range []string{"time", "msg", "level"} {
+		if value, ok := data[key]; ok {
+			data["fields."+key] = value
+		}
+	}
+	data["time"] = entry.Time.Format(time.RFC3339Nano)
+	data["msg"] = entry.Message
+	data["level"] = entry.Level.String()
+
+	serialized, err := json.Marshal(data)
+	if err != nil {
+		return nil, util.Errorf("Could not marshal log entry as JSON: %s", err)
+	}
+	return append(serialized, '\n'), nil
+}
+
+// SetFormat sets how the logger's entries are written: with TextFormat, as
+// logrus' key=value text, or with JSONFormat, with a JSONFormatter that adds
+// node to each entry. The empty string is TextFormat.
+func (l Logger) SetFormat(format string, node string) error {
+	switch format {
+	case "", TextFormat:
+		l.Logger.Formatter = new(logrus.TextFormatter)
+	case JSONFormat:
+		l.Logger.Formatter = &JSONFormatter{Node: node}
+	default:
+		return util.Errorf("Unsupported log format %q, expected %q or %q", format, TextFormat, JSONFormat)
+	}
+	return nil
+}
+
+// WithOperation returns a logger that logs under the name of the operation it
+// logs about
+func (l Logger) WithOperation(operation string) Logger {
+	return l.WithField(OperationField, operation)
+}
+
+// WithDuration returns a logger that logs how long the operation it logs
+// about took
+func (l Logger) WithDuration(duration time.Duration) Logger {
+	return l.WithField(DurationField, duration)
+}
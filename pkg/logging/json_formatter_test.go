@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/anthonybishopric/gotcha"
+)
+
+func logJSON(t *testing.T, logger Logger, log func(Logger)) map[string]interface{} {
+	var out bytes.Buffer
+	logger.SetLogOut(&out)
+	log(logger)
+	var entry map[string]interface{}
+	err := json.Unmarshal(out.Bytes(), &entry)
+	Assert(t).IsNil(err, "should have logged a JSON object")
+	return entry
+}
+
+func TestJSONFormatterStandardizesFields(t *testing.T) {
+	logger := NewLogger(logrus.Fields{})
+	err := logger.SetFormat(JSONFormat, "node1")
+	Assert(t).IsNil(err, "should have set the JSON format")
+
+	entry := logJSON(t, logger, func(logger Logger) {
+		logger.WithFields(logrus.Fields{
+			"pod_id": "web",
+			"msg":    "clashes",
+		}).WithOperation("install").WithDuration(1500 * time.Millisecond).WithError(errors.New("failed")).Infoln("Installed")
+	})
+	Assert(t).AreEqual(entry["msg"], "Installed", "should have logged the message")
+	Assert(t).AreEqual(entry["level"], "info", "should have logged the level")
+	Assert(t).AreEqual(entry[NodeField], "node1", "should have added the node")
+	Assert(t).AreEqual(entry[PodField], "web", "should have renamed pod_id to pod")
+	Assert(t).AreEqual(entry[OperationField], "install", "should have logged the operation")
+	Assert(t).AreEqual(entry[DurationField], 1.5, "should have logged the duration in seconds")
+	Assert(t).AreEqual(entry["err"], "failed", "should have logged the error")
+	Assert(t).AreEqual(entry["fields.msg"], "clashes", "should have kept the clashing field")
+	_, err = time.Parse(time.RFC3339Nano, entry["time"].(string))
+	Assert(t).IsNil(err, "should have logged the time")
+}
+
+func TestJSONFormatterKeepsStandardFieldsOverAliases(t *testing.T) {
+	logger := NewLogger(logrus.Fields{})
+	err := logger.SetFormat(JSONFormat, "node1")
+	Assert(t).IsNil(err, "should have set the JSON format")
+
+	entry := logJSON(t, logger, func(logger Logger) {
+		logger.WithFields(logrus.Fields{
+			"pod":       "web",
+			"pod_id":    "other",
+			"node_name": "node2",
+		}).Infoln("Logged")
+	})
+	Assert(t).AreEqual(entry[PodField], "web", "should have kept the pod field")
+	Assert(t).AreEqual(entry["pod_id"], "other", "should have left the alias alone")
+	Assert(t).AreEqual(entry[NodeField], "node2", "the entry's node should take precedence")
+}
+
+func TestSetFormat(t *testing.T) {
+	logger := NewLogger(logrus.Fields{})
+	Assert(t).IsNil(logger.SetFormat("", ""), "the empty format should be text")
+	_, ok := logger.Logger.Formatter.(*logrus.TextFormatter)
+	Assert(t).IsTrue(ok, "should have used the text formatter")
+	Assert(t).IsNotNil(logger.SetFormat("xml", ""), "should have rejected an unknown format")
+}
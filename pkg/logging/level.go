@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// SetLevel sets the least severe level that the logger and every logger
+// derived from it write, e.g. "info" or "debug". It can be called while the
+// logger is in use, so that the level of a running process can be changed
+// without restarting it.
+func (l Logger) SetLevel(level string) error {
+	lv, err := logrus.ParseLevel(level)
+	if err != nil {
+		return util.Errorf("Received invalid log level %q", level)
+	}
+	// logrus reads the level without locking; it fits in a word, so
+	// loggers in use see either the old level or the new one
+	l.Logger.Level = lv
+	return nil
+}
+
+// GetLevel returns the least severe level that the logger writes
+func (l Logger) GetLevel() string {
+	return l.Logger.Level.String()
+}
+
+type levelResponse struct {
+	Level string `json:"level"`
+}
+
+// LevelHandler returns an http handler that reports the logger's level as
+// JSON on GET, and if settable, sets it to the "level" form value on PUT or
+// POST.
+func LevelHandler(logger Logger, settable bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+		case "PUT", "POST":
+			if !settable {
+				http.Error(w, "The log level can't be changed here", http.StatusForbidden)
+				return
+			}
+			previous := logger.GetLevel()
+			err := logger.SetLevel(r.FormValue("level"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			logger.WithFields(logrus.Fields{
+				"previous_level": previous,
+				"level":          logger.GetLevel(),
+			}).Warnln("Changed log level")
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		bytes, err := json.Marshal(levelResponse{Level: logger.GetLevel()})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(bytes)
+	})
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/anthonybishopric/gotcha"
+)
+
+func TestSetLevelAppliesToDerivedLoggers(t *testing.T) {
+	logger := NewLogger(logrus.Fields{})
+	sub := logger.SubLogger(logrus.Fields{"pod": "web"})
+
+	err := logger.SetLevel("debug")
+	Assert(t).IsNil(err, "should have set the level")
+	Assert(t).AreEqual(sub.GetLevel(), "debug", "derived loggers should share the level")
+	Assert(t).IsNotNil(logger.SetLevel("loud"), "should have rejected an unknown level")
+	Assert(t).AreEqual(logger.GetLevel(), "debug", "an invalid level should not have changed the level")
+}
+
+func TestLevelHandler(t *testing.T) {
+	logger := NewLogger(logrus.Fields{})
+	logger.SetLogOut(ioutil.Discard)
+	handler := LevelHandler(logger, true)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/_status/log_level", nil))
+	Assert(t).AreEqual(recorder.Code, 200, "should have reported the level")
+	Assert(t).AreEqual(strings.TrimSpace(recorder.Body.String()), `{"level":"info"}`, "should have reported the default level")
+
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest("PUT", "/_status/log_level", strings.NewReader(url.Values{"level": {"debug"}}.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(recorder, request)
+	Assert(t).AreEqual(recorder.Code, 200, "should have set the level")
+	Assert(t).AreEqual(logger.GetLevel(), "debug", "should have changed the level")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/_status/log_level?level=loud", nil))
+	Assert(t).AreEqual(recorder.Code, 400, "should have rejected an unknown level")
+	Assert(t).AreEqual(logger.GetLevel(), "debug", "should not have changed the level")
+}
+
+func TestLevelHandlerNotSettable(t *testing.T) {
+	logger := NewLogger(logrus.Fields{})
+	recorder := httptest.NewRecorder()
+	LevelHandler(logger, false).ServeHTTP(recorder, httptest.NewRequest("PUT", "/_status/log_level?level=debug", nil))
+	Assert(t).AreEqual(recorder.Code, 403, "should not have allowed the level to be changed")
+	Assert(t).AreEqual(logger.GetLevel(), "info", "should not have changed the level")
+}
@@ -0,0 +1,161 @@
+// Package logship forwards the output of pods' services, as written to their
+// svlogd log directories, to a central log destination with metadata about the
+// pod and node attached to each line.
+package logship
+
+import (
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/redact"
+)
+
+// The types of log destinations
+const (
+	SyslogSink = "syslog"
+	HTTPSink   = "http"
+	KafkaSink  = "kafka"
+)
+
+// DefaultMaxPending is how many entries are kept for retrying while the
+// destination is unreachable, if Config doesn't set MaxPending. Older entries
+// are dropped first.
+const DefaultMaxPending = 10000
+
+// svlogdTimeFormat is the format of the timestamps that "svlogd -tt" prefixes
+// lines with
+const svlogdTimeFormat = "2006-01-02_15:04:05.00000"
+
+// Config configures where logs are shipped to.
+type Config struct {
+	// Type is one of SyslogSink, HTTPSink or KafkaSink
+	Type string `yaml:"type"`
+
+	// Network and Address of the syslog server, e.g. "udp" and
+	// "logs.example.com:514". An empty Address logs to the local syslog
+	// daemon. Tag defaults to "p2".
+	Network string `yaml:"network,omitempty"`
+	Address string `yaml:"address,omitempty"`
+	Tag     string `yaml:"tag,omitempty"`
+
+	// URL that batches of entries are POSTed to for the http type, or of
+	// the Kafka REST proxy that entries are produced to Topic through for
+	// the kafka type
+	URL   string `yaml:"url,omitempty"`
+	Topic string `yaml:"topic,omitempty"`
+
+	// Fields are attached to every entry, in addition to the pod's
+	Fields map[string]string `yaml:"fields,omitempty"`
+
+	// MaxPending is how many entries are kept while the destination is
+	// unreachable. Defaults to DefaultMaxPending.
+	MaxPending int `yaml:"max_pending,omitempty"`
+}
+
+// Entry is a line of a service's output
+type Entry struct {
+	Time    time.Time         `json:"time"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// Sink ships entries to a log destination
+type Sink interface {
+	Ship(entries []Entry) error
+}
+
+// Source is a svlogd "current" file to ship, and the fields describing the
+// service that writes it
+type Source struct {
+	Path   string
+	Fields map[string]string
+	// Redaction is applied to the lines of the file before they are
+	// shipped. May be nil.
+	Redaction *redact.Filter
+}
+
+// Forwarder ships the lines appended to its sources since it last ran.
+// Entries that couldn't be shipped are retried the next time it runs.
+type Forwarder struct {
+	sink       Sink
+	tailer     *Tailer
+	fields     map[string]string
+	maxPending int
+	pending    []Entry
+	logger     logging.Logger
+}
+
+// NewForwarder returns a Forwarder that ships to sink, attaching fields to
+// every entry. Files are read from their end the first time they are seen, so
+// that existing output isn't shipped again when the preparer restarts.
+func NewForwarder(sink Sink, fields map[string]string, maxPending int, logger logging.Logger) *Forwarder {
+	if maxPending <= 0 {
+		maxPending = DefaultMaxPending
+	}
+	return &Forwarder{
+		sink:       sink,
+		tailer:     NewTailer(false),
+		fields:     fields,
+		maxPending: maxPending,
+		logger:     logger,
+	}
+}
+
+// Forward reads the new lines of sources and ships them. Files that are no
+// longer sources are closed.
+func (f *Forwarder) Forward(sources []Source) error {
+	var paths []string
+	for _, source := range sources {
+		paths = append(paths, source.Path)
+		lines, err := f.tailer.Read(source.Path)
+		if err != nil {
+			f.logger.WithError(err).WithField("path", source.Path).Warnln("Could not read log file")
+		}
+		for _, line := range lines {
+			f.pending = append(f.pending, f.entry(source.Redaction.Redact(line), source.Fields))
+		}
+	}
+	f.tailer.Retain(paths)
+
+	if dropped := len(f.pending) - f.maxPending; dropped > 0 {
+		f.logger.WithField("dropped", dropped).Warnln("Dropping log entries that could not be shipped")
+		f.pending = f.pending[dropped:]
+	}
+	if len(f.pending) == 0 {
+		return nil
+	}
+	err := f.sink.Ship(f.pending)
+	if err != nil {
+		return util.Errorf("Could not ship %d log entries: %s", len(f.pending), err)
+	}
+	f.pending = nil
+	return nil
+}
+
+// Close closes the files being tailed
+func (f *Forwarder) Close() {
+	f.tailer.Retain(nil)
+}
+
+func (f *Forwarder) entry(line string, sourceFields map[string]string) Entry {
+	entry := Entry{
+		Time:    time.Now().UTC(),
+		Message: line,
+		Fields:  make(map[string]string, len(f.fields)+len(sourceFields)),
+	}
+	if len(line) > len(svlogdTimeFormat) && line[len(svlogdTimeFormat)] == ' ' {
+		if t, err := time.Parse(svlogdTimeFormat, line[:len(svlogdTimeFormat)]); err == nil {
+			entry.Time = t
+			entry.Message = strings.TrimPrefix(line[len(svlogdTimeFormat):], " ")
+		}
+	}
+	for key, value := range f.fields {
+		entry.Fields[key] = value
+	}
+	for key, value := range sourceFields {
+		entry.Fields[key] = value
+	}
+	return entry
+}
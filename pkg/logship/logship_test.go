@@ -0,0 +1,114 @@
+package logship
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/logging"
+)
+
+func appendLines(t *testing.T, path string, lines string) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	Assert(t).IsNil(err, "test setup: could not open log file")
+	_, err = file.WriteString(lines)
+	Assert(t).IsNil(err, "test setup: could not write log file")
+	Assert(t).IsNil(file.Close(), "test setup: could not close log file")
+}
+
+func TestTailerFollowsRotatedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logship")
+	Assert(t).IsNil(err, "test setup: could not create temp dir")
+	defer os.RemoveAll(dir)
+	current := filepath.Join(dir, "current")
+
+	tailer := NewTailer(false)
+	lines, err := tailer.Read(current)
+	Assert(t).IsNil(err, "a missing file should have no lines")
+	Assert(t).AreEqual(len(lines), 0, "a missing file should have no lines")
+
+	appendLines(t, current, "one\ntw")
+	lines, err = tailer.Read(current)
+	Assert(t).IsNil(err, "should have read the file")
+	Assert(t).AreEqual(fmt.Sprint(lines), "[one]", "should have read a file created after it was missing from its start")
+
+	appendLines(t, current, "o\nthree\n")
+	Assert(t).IsNil(os.Rename(current, filepath.Join(dir, "@400000000000000000000000.s")), "test setup: could not rotate")
+	appendLines(t, current, "four\n")
+	lines, err = tailer.Read(current)
+	Assert(t).IsNil(err, "should have read the rotated file")
+	Assert(t).AreEqual(fmt.Sprint(lines), "[two three four]", "should have finished the old file and read the new one")
+
+	existing := NewTailer(false)
+	lines, err = existing.Read(current)
+	Assert(t).IsNil(err, "should have read the file")
+	Assert(t).AreEqual(len(lines), 0, "should have started at the end of a file that already existed")
+}
+
+type fakeSink struct {
+	err     error
+	shipped []Entry
+}
+
+func (f *fakeSink) Ship(entries []Entry) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.shipped = append(f.shipped, entries...)
+	return nil
+}
+
+func TestForwarderRetriesAndAttachesFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logship")
+	Assert(t).IsNil(err, "test setup: could not create temp dir")
+	defer os.RemoveAll(dir)
+	current := filepath.Join(dir, "current")
+	appendLines(t, current, "")
+
+	sink := &fakeSink{err: fmt.Errorf("unreachable")}
+	forwarder := NewForwarder(sink, map[string]string{"dc": "east"}, 2, logging.DefaultLogger)
+	defer forwarder.Close()
+	sources := []Source{{Path: current, Fields: map[string]string{"pod_id": "app"}}}
+	Assert(t).IsNil(forwarder.Forward(sources), "should have started tailing")
+
+	appendLines(t, current, "2017-03-04_05:06:07.12345 first\nsecond\nthird\n")
+	Assert(t).IsNotNil(forwarder.Forward(sources), "should have failed to ship")
+
+	sink.err = nil
+	Assert(t).IsNil(forwarder.Forward(sources), "should have shipped once the sink recovered")
+	Assert(t).AreEqual(len(sink.shipped), 2, "should have kept only the newest pending entries")
+	Assert(t).AreEqual(sink.shipped[0].Message, "second", "should have dropped the oldest entry")
+	Assert(t).AreEqual(sink.shipped[1].Fields["dc"], "east", "should have attached the forwarder's fields")
+	Assert(t).AreEqual(sink.shipped[1].Fields["pod_id"], "app", "should have attached the source's fields")
+
+	entry := forwarder.entry("2017-03-04_05:06:07.12345 first", nil)
+	Assert(t).AreEqual(entry.Message, "first", "should have stripped the svlogd timestamp")
+	Assert(t).AreEqual(entry.Time.Year(), 2017, "should have parsed the svlogd timestamp")
+}
+
+func TestKafkaRESTProducer(t *testing.T) {
+	var records map[string][]kafkaRecord
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/logs" || r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&records)
+	}))
+	defer ts.Close()
+
+	sink, err := NewSink(Config{Type: KafkaSink, URL: ts.URL, Topic: "logs"}, http.DefaultClient)
+	Assert(t).IsNil(err, "should have created the sink")
+	err = sink.Ship([]Entry{{Message: "hello"}})
+	Assert(t).IsNil(err, "should have produced the entries")
+	Assert(t).AreEqual(records["records"][0].Value.Message, "hello", "should have produced the entry")
+
+	_, err = NewSink(Config{Type: KafkaSink, URL: ts.URL}, http.DefaultClient)
+	Assert(t).IsNotNil(err, "should require a topic")
+}
@@ -0,0 +1,134 @@
+package logship
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// NewSink returns the Sink that config describes. client is used by the http
+// and kafka types.
+func NewSink(config Config, client *http.Client) (Sink, error) {
+	switch config.Type {
+	case SyslogSink:
+		tag := config.Tag
+		if tag == "" {
+			tag = "p2"
+		}
+		writer, err := syslog.Dial(config.Network, config.Address, syslog.LOG_INFO|syslog.LOG_USER, tag)
+		if err != nil {
+			return nil, util.Errorf("Could not connect to syslog: %s", err)
+		}
+		return SyslogWriter{Writer: writer}, nil
+	case HTTPSink:
+		if config.URL == "" {
+			return nil, util.Errorf("The http log destination requires a url")
+		}
+		return HTTPPoster{Client: client, URL: config.URL}, nil
+	case KafkaSink:
+		if config.URL == "" || config.Topic == "" {
+			return nil, util.Errorf("The kafka log destination requires the url of a REST proxy and a topic")
+		}
+		return KafkaRESTProducer{Client: client, URL: config.URL, Topic: config.Topic}, nil
+	default:
+		return nil, util.Errorf("Unknown log destination type %q, expected one of %q, %q or %q", config.Type, SyslogSink, HTTPSink, KafkaSink)
+	}
+}
+
+// SyslogWriter writes each entry as a syslog message, prefixed by its fields
+// as sorted key=value pairs.
+type SyslogWriter struct {
+	Writer *syslog.Writer
+}
+
+func (s SyslogWriter) Ship(entries []Entry) error {
+	for _, entry := range entries {
+		_, err := s.Writer.Write([]byte(formatFields(entry.Fields) + entry.Message))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatFields(fields map[string]string) string {
+	var keys []string
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var formatted []string
+	for _, key := range keys {
+		formatted = append(formatted, fmt.Sprintf("%s=%q", key, fields[key]))
+	}
+	if len(formatted) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(formatted, " ") + "] "
+}
+
+// HTTPPoster POSTs each batch of entries to URL as a JSON array.
+type HTTPPoster struct {
+	Client *http.Client
+	URL    string
+}
+
+func (h HTTPPoster) Ship(entries []Entry) error {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return post(h.Client, h.URL, "application/json", body)
+}
+
+// KafkaRESTProducer produces entries to Topic through the Kafka REST proxy at
+// URL, with the proxy's v2 JSON API.
+type KafkaRESTProducer struct {
+	Client *http.Client
+	URL    string
+	Topic  string
+}
+
+type kafkaRecord struct {
+	Value Entry `json:"value"`
+}
+
+func (k KafkaRESTProducer) Ship(entries []Entry) error {
+	records := make([]kafkaRecord, 0, len(entries))
+	for _, entry := range entries {
+		records = append(records, kafkaRecord{Value: entry})
+	}
+	body, err := json.Marshal(map[string][]kafkaRecord{"records": records})
+	if err != nil {
+		return err
+	}
+	proxyURL, err := url.Parse(k.URL)
+	if err != nil {
+		return util.Errorf("Invalid kafka REST proxy url %q: %s", k.URL, err)
+	}
+	proxyURL.Path = path.Join(proxyURL.Path, "topics", k.Topic)
+	return post(k.Client, proxyURL.String(), "application/vnd.kafka.json.v2+json", body)
+}
+
+func post(client *http.Client, url string, contentType string, body []byte) error {
+	resp, err := client.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return util.Errorf("%s returned %s: %s", url, resp.Status, respBody)
+	}
+	_, _ = ioutil.ReadAll(resp.Body)
+	return nil
+}
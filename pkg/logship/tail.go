@@ -0,0 +1,164 @@
+package logship
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// maxLineLength is how long a line can get before it is shipped without
+// waiting for its end
+const maxLineLength = 64 * 1024
+
+// Tailer reads the lines appended to files, following them when svlogd
+// rotates them by renaming them and starting a new file.
+type Tailer struct {
+	fromStart bool
+	files     map[string]*tailedFile
+	// files that didn't exist when they were first read, which are read
+	// from their start once they are created
+	missing map[string]bool
+}
+
+type tailedFile struct {
+	file *os.File
+	info os.FileInfo
+	// the start of a line that hasn't been terminated yet
+	partial []byte
+}
+
+// NewTailer returns a Tailer. If fromStart is false, files are read from their
+// end the first time they are seen.
+func NewTailer(fromStart bool) *Tailer {
+	return &Tailer{
+		fromStart: fromStart,
+		files:     make(map[string]*tailedFile),
+		missing:   make(map[string]bool),
+	}
+}
+
+// Read returns the complete lines appended to the file at path since it was
+// last read. A file that doesn't exist has no lines.
+func (t *Tailer) Read(path string) ([]string, error) {
+	tailed, ok := t.files[path]
+	if !ok {
+		var err error
+		tailed, err = t.open(path, t.fromStart || t.missing[path])
+		if os.IsNotExist(err) {
+			t.missing[path] = true
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		delete(t.missing, path)
+		t.files[path] = tailed
+	}
+
+	lines, err := tailed.readLines()
+	if err != nil {
+		return lines, err
+	}
+
+	// if the file was rotated, the rest of it was just read from the old
+	// file, and the new file is read from its start
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return lines, nil
+	} else if err != nil {
+		return lines, err
+	}
+	if os.SameFile(info, tailed.info) {
+		if info.Size() < tailed.offset() {
+			// truncated in place
+			_, err = tailed.file.Seek(0, os.SEEK_SET)
+			tailed.partial = nil
+		}
+		return lines, err
+	}
+	if len(tailed.partial) > 0 {
+		lines = append(lines, string(tailed.partial))
+	}
+	_ = tailed.file.Close()
+	delete(t.files, path)
+	rotated, err := t.open(path, true)
+	if err != nil {
+		return lines, err
+	}
+	t.files[path] = rotated
+	more, err := rotated.readLines()
+	return append(lines, more...), err
+}
+
+// Retain closes every file that isn't one of paths
+func (t *Tailer) Retain(paths []string) {
+	keep := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		keep[path] = true
+	}
+	for path, tailed := range t.files {
+		if !keep[path] {
+			_ = tailed.file.Close()
+			delete(t.files, path)
+		}
+	}
+	for path := range t.missing {
+		if !keep[path] {
+			delete(t.missing, path)
+		}
+	}
+}
+
+func (t *Tailer) open(path string, fromStart bool) (*tailedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if !fromStart {
+		_, err = file.Seek(0, os.SEEK_END)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+	return &tailedFile{file: file, info: info}, nil
+}
+
+func (f *tailedFile) offset() int64 {
+	offset, err := f.file.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return 0
+	}
+	return offset
+}
+
+func (f *tailedFile) readLines() ([]string, error) {
+	var lines []string
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.file.Read(buf)
+		data := append(f.partial, buf[:n]...)
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			lines = append(lines, string(data[:i]))
+			data = data[i+1:]
+		}
+		if len(data) > maxLineLength {
+			lines = append(lines, string(data))
+			data = nil
+		}
+		f.partial = append([]byte(nil), data...)
+		if err == io.EOF {
+			return lines, nil
+		} else if err != nil {
+			return lines, err
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// Format is a serialization of pod manifests. Manifests of either format have
+// the same fields and the same SHA.
+type Format string
+
+const (
+	YAMLFormat Format = "yaml"
+	JSONFormat Format = "json"
+)
+
+// ParseFormat returns the Format named by format, which is YAMLFormat if
+// format is empty
+func ParseFormat(format string) (Format, error) {
+	switch Format(format) {
+	case "", YAMLFormat:
+		return YAMLFormat, nil
+	case JSONFormat:
+		return JSONFormat, nil
+	default:
+		return "", util.Errorf("%q is not a manifest format, must be %q or %q", format, YAMLFormat, JSONFormat)
+	}
+}
+
+// MarshalFormat serializes the manifest in format. YAML is the manifest's own
+// bytes, as returned by Marshal(), and JSON is its canonical JSON, as returned
+// by MarshalJSON().
+func MarshalFormat(m Manifest, format Format) ([]byte, error) {
+	switch format {
+	case YAMLFormat:
+		return m.Marshal()
+	case JSONFormat:
+		return m.MarshalJSON()
+	default:
+		return nil, util.Errorf("%q is not a manifest format", format)
+	}
+}
+
+// MarshalJSON returns the canonical JSON of the manifest: its fields as they
+// would be marshaled to YAML, with the keys of every object sorted, so that
+// equivalent manifests have byte-for-byte identical JSON. Signatures are not
+// included, since they sign the YAML that the manifest was read from.
+func (manifest *manifest) MarshalJSON() ([]byte, error) {
+	yamlBytes, err := yaml.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	err = yaml.Unmarshal(yamlBytes, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonValue(doc))
+}
+
+// jsonValue converts a value decoded from YAML, whose maps have interface{}
+// keys, to one that encoding/json can marshal
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(value))
+		for key, elem := range value {
+			object[fmt.Sprint(key)] = jsonValue(elem)
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(value))
+		for i, elem := range value {
+			array[i] = jsonValue(elem)
+		}
+		return array
+	default:
+		return value
+	}
+}
+
+// jsonToYAML returns the manifest YAML equivalent to manifestJSON, or false
+// if manifestJSON isn't a JSON object. Since JSON is mostly YAML, manifests
+// could be read as YAML either way, but YAML refuses some JSON, such as JSON
+// indented with tabs.
+func jsonToYAML(manifestJSON []byte) ([]byte, bool, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(manifestJSON), []byte("{")) {
+		return nil, false, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(manifestJSON))
+	// decoding numbers as float64 would lose the precision of large
+	// integers in the manifest's config
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		// probably a YAML flow mapping, e.g. "{ id: thepod }"
+		return nil, false, nil
+	}
+	yamlBytes, err := yaml.Marshal(yamlValue(doc))
+	if err != nil {
+		return nil, false, err
+	}
+	return yamlBytes, true, nil
+}
+
+// yamlValue converts a value decoded from JSON to one that marshals to the
+// equivalent YAML
+func yamlValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		mapping := make(map[interface{}]interface{}, len(value))
+		for key, elem := range value {
+			mapping[key] = yamlValue(elem)
+		}
+		return mapping
+	case []interface{}:
+		sequence := make([]interface{}, len(value))
+		for i, elem := range value {
+			sequence[i] = yamlValue(elem)
+		}
+		return sequence
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	default:
+		return value
+	}
+}
+
+// FromBytesStrict constructs a Manifest like FromBytes, but refuses manifests
+// that set keys that aren't manifest fields, such as misspelled ones, which
+// FromBytes ignores. Keys within config are not checked.
+func FromBytesStrict(manifestBytes []byte) (Manifest, error) {
+	return fromBytes(manifestBytes, true)
+}
+
+// checkStrict returns an error if the YAML of a manifest of the current schema
+// version sets keys that aren't manifest fields
+func checkStrict(manifestYAML []byte) error {
+	var doc interface{}
+	err := yaml.Unmarshal(manifestYAML, &doc)
+	if err != nil {
+		return err
+	}
+	return checkKnownKeys(doc, reflect.TypeOf(manifest{}), "")
+}
+
+var yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// checkKnownKeys returns an error if doc, decoded from YAML, sets keys that
+// don't correspond to the yaml fields of typ
+func checkKnownKeys(doc interface{}, typ reflect.Type, path string) error {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if reflect.PtrTo(typ).Implements(yamlUnmarshalerType) {
+		// unmarshals itself from whatever it likes
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.Struct:
+		mapping, ok := doc.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		fields := yamlFields(typ)
+		for key, value := range mapping {
+			name := fmt.Sprint(key)
+			field, ok := fields[name]
+			if !ok {
+				return util.Errorf("'%s' is not a manifest field", path+name)
+			}
+			err := checkKnownKeys(value, field.Type, path+name+".")
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		mapping, ok := doc.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range mapping {
+			err := checkKnownKeys(value, typ.Elem(), path+fmt.Sprint(key)+".")
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		sequence, ok := doc.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, value := range sequence {
+			err := checkKnownKeys(value, typ.Elem(), fmt.Sprintf("%s%d.", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// yamlFields maps the yaml keys of a struct type to its fields, following the
+// rules of gopkg.in/yaml.v2
+func yamlFields(typ reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		inline := false
+		for _, flag := range parts[1:] {
+			if flag == "inline" {
+				inline = true
+			}
+		}
+		if inline {
+			for name, inlined := range yamlFields(field.Type) {
+				fields[name] = inlined
+			}
+			continue
+		}
+		name := parts[0]
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
@@ -1,7 +1,7 @@
 // Package pods borrows heavily from the Kubernetes definition of pods to provide
 // p2 with a convenient way to colocate several related launchable artifacts, as well
-// as basic shared runtime configuration. Pod manifests are written as YAML files
-// that describe what to launch.
+// as basic shared runtime configuration. Pod manifests are written as YAML or
+// JSON files that describe what to launch.
 package manifest
 
 import (
@@ -13,11 +13,16 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/runit"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/redact"
+	"github.com/square/p2/pkg/util/size"
 	"golang.org/x/crypto/openpgp/clearsign"
 	"gopkg.in/yaml.v2"
 )
@@ -27,6 +32,129 @@ type StatusStanza struct {
 	Path          string `yaml:"path,omitempty"`
 	Port          int    `yaml:"port,omitempty"`
 	LocalhostOnly bool   `yaml:"localhost_only,omitempty"`
+
+	// PortLaunchable, if set, names a launchable with an auto port whose
+	// allocated port is status checked instead of Port
+	PortLaunchable launch.LaunchableID `yaml:"port_launchable,omitempty"`
+
+	// MinHealthyDuration is how long a node must be continuously healthy
+	// before a rolling update counts it as updated
+	MinHealthyDuration time.Duration `yaml:"min_healthy_duration,omitempty"`
+}
+
+// SecretStanza references a secret that the preparer fetches from its
+// secrets source when the pod is installed, so that it doesn't have to be
+// written into the pod's config.
+type SecretStanza struct {
+	// Name is the environment variable the secret is exported as, or the
+	// name of its file in the pod's secrets directory
+	Name string `yaml:"name"`
+	// Path locates the secret in the preparer's secrets source
+	Path string `yaml:"path"`
+	// File writes the secret to a file in the pod's secrets directory,
+	// exported as SECRETS_DIR, instead of to an environment variable
+	File bool `yaml:"file,omitempty"`
+}
+
+// ReadinessStanza configures the check that must pass after a pod is launched
+// before the preparer records it in the reality store, so that rolling
+// updates don't proceed past nodes whose pods never became ready.
+type ReadinessStanza struct {
+	// Command, if set, is run as the pod's user with the pod's environment
+	// until it exits 0. Otherwise the pod's status check must pass, if it
+	// has one.
+	Command []string `yaml:"command,omitempty"`
+	// Timeout is how long the pod may take to become ready before the
+	// launch is considered failed. Defaults to the preparer's
+	// readiness_timeout_sec param.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// DrainStanza configures how a pod's services are stopped: the drain step is
+// given up to GracePeriod to let in-flight work finish, then the services are
+// sent SIGTERM, and those still running after TermTimeout are sent SIGKILL.
+type DrainStanza struct {
+	// HTTPPath, if set, is POSTed to on the pod's status port on localhost
+	// to start draining. The request should return once the pod has
+	// drained or the grace period has passed.
+	HTTPPath string `yaml:"http_path,omitempty"`
+	// Command, if set, is run as the pod's user with the pod's environment
+	// to drain it, and should exit once the pod has drained.
+	Command []string `yaml:"command,omitempty"`
+	// GracePeriod is how long the drain step may take. Defaults to the
+	// drain_grace_period_sec param.
+	GracePeriod time.Duration `yaml:"grace_period,omitempty"`
+	// TermTimeout is how long services have to exit after SIGTERM before
+	// they are killed. Overrides the restart_timeout of the launchables when
+	// halting.
+	TermTimeout time.Duration `yaml:"term_timeout,omitempty"`
+}
+
+// LogShippingStanza configures how the preparer ships the output of a pod's
+// services to the log destination configured for the node.
+type LogShippingStanza struct {
+	// Disabled opts the pod out of log shipping
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Fields are attached to every line shipped for the pod
+	Fields map[string]string `yaml:"fields,omitempty"`
+}
+
+// ConfinementStanza sets the mandatory access control policy that a pod's
+// services and scripts are run under. At most one of its fields may be set.
+type ConfinementStanza struct {
+	// SELinuxContext is the SELinux context to run in, e.g.
+	// "system_u:system_r:httpd_t:s0"
+	SELinuxContext string `yaml:"selinux_context,omitempty"`
+	// AppArmorProfile is the name of a loaded AppArmor profile to run in
+	AppArmorProfile string `yaml:"apparmor_profile,omitempty"`
+}
+
+// Confined returns whether the stanza sets a policy. It may be called on nil.
+func (c *ConfinementStanza) Confined() bool {
+	return c != nil && (c.SELinuxContext != "" || c.AppArmorProfile != "")
+}
+
+// The values of EnvironmentStanza.Inherit
+const (
+	InheritAllEnv  = "all"
+	InheritNoneEnv = "none"
+)
+
+// EnvironmentStanza controls which variables of the environment that the
+// preparer and runit run a pod's processes in are passed on to those
+// processes. The pod's own environment is always set.
+type EnvironmentStanza struct {
+	// Inherit is InheritAllEnv (the default) to pass on every variable
+	// other than those in Deny, or InheritNoneEnv to pass on only those in
+	// Allow
+	Inherit string   `yaml:"inherit,omitempty"`
+	Allow   []string `yaml:"allow,omitempty"`
+	Deny    []string `yaml:"deny,omitempty"`
+}
+
+// Toleration lets a pod be scheduled on nodes with a matching taint
+type Toleration struct {
+	// Key is the name of the taint, e.g. "dedicated"
+	Key string `yaml:"key"`
+	// Value is the value the taint must have. If empty, any value is
+	// tolerated.
+	Value string `yaml:"value,omitempty"`
+}
+
+// SidecarStanza opts a pod into a sidecar launchable, such as a service mesh
+// proxy, that the preparer adds to the pod from its own config
+type SidecarStanza struct {
+	// Name is that of the sidecar in the preparer's config, which is also
+	// the ID of the launchable it is added as
+	Name string `yaml:"name"`
+	// Launchable is the pod's main launchable, which the sidecar is
+	// launched before and halted after
+	Launchable launch.LaunchableID `yaml:"launchable"`
+}
+
+// Tolerates returns whether the toleration matches a taint
+func (t Toleration) Tolerates(key string, value string) bool {
+	return t.Key == key && (t.Value == "" || t.Value == value)
 }
 
 type Builder interface {
@@ -37,6 +165,21 @@ type Builder interface {
 	SetStatusHTTP(statusHTTP bool)
 	SetStatusPath(statusPath string)
 	SetStatusPort(port int)
+	SetStatusPortLaunchable(launchableID launch.LaunchableID)
+	SetMinHealthyDuration(duration time.Duration)
+	SetConfigReload(command string)
+	SetLogRedaction(config redact.Config)
+	SetDiskQuota(quota size.ByteCount)
+	SetSecrets(secrets []SecretStanza)
+	SetConfigTemplates(templates map[string]string)
+	SetReadiness(readiness *ReadinessStanza)
+	SetDrain(drain *DrainStanza)
+	SetLogShipping(logShipping *LogShippingStanza)
+	SetConfinement(confinement *ConfinementStanza)
+	SetEnvironment(environment *EnvironmentStanza)
+	SetTolerations(tolerations []Toleration)
+	SetEmergency(emergency bool)
+	SetSidecar(sidecar *SidecarStanza)
 	SetLaunchables(launchableStanzas map[launch.LaunchableID]launch.LaunchableStanza)
 }
 
@@ -70,8 +213,24 @@ type Manifest interface {
 	GetStatusHTTP() bool
 	GetStatusPath() string
 	GetStatusPort() int
+	GetStatusPortLaunchable() launch.LaunchableID
 	GetStatusLocalhostOnly() bool
+	GetMinHealthyDuration() time.Duration
+	GetConfigReload() string
+	GetLogRedaction() redact.Config
+	GetDiskQuota() size.ByteCount
+	GetSecrets() []SecretStanza
+	GetConfigTemplates() map[string]string
+	GetReadiness() *ReadinessStanza
+	GetDrain() *DrainStanza
+	GetLogShipping() *LogShippingStanza
+	GetConfinement() *ConfinementStanza
+	GetEnvironment() *EnvironmentStanza
+	GetTolerations() []Toleration
+	GetEmergency() bool
+	GetSidecar() *SidecarStanza
 	Marshal() ([]byte, error)
+	MarshalJSON() ([]byte, error)
 	SignatureData() (plaintext, signature []byte)
 
 	GetBuilder() Builder
@@ -85,10 +244,68 @@ type manifest struct {
 	RunAs             string                                          `yaml:"run_as,omitempty"`
 	LaunchableStanzas map[launch.LaunchableID]launch.LaunchableStanza `yaml:"launchables"`
 	Config            map[interface{}]interface{}                     `yaml:"config"`
-	StatusPort        int                                             `yaml:"status_port,omitempty"`
-	StatusHTTP        bool                                            `yaml:"status_http,omitempty"`
 	Status            StatusStanza                                    `yaml:"status,omitempty"`
 
+	// SchemaVersion is the schema version that the manifest was written
+	// in, which is 1 if unset. Manifests are migrated to
+	// CurrentSchemaVersion when read, so the other fields always follow
+	// it.
+	SchemaVersion int `yaml:"schema_version,omitempty"`
+
+	// ConfigReload is the runit control command (e.g. "hup") sent to the
+	// pod's services when a deploy only changes the pod's config. If
+	// empty, config changes restart the pod like any other change.
+	ConfigReload string `yaml:"config_reload,omitempty"`
+
+	// LogRedaction is applied, along with the preparer's own filters, to
+	// output captured from the pod's launchables and from hooks run for it.
+	LogRedaction *redact.Config `yaml:"log_redaction,omitempty"`
+
+	// DiskQuota, if set, is the most disk space (e.g. "20G") that the pod's
+	// home directory may use. Installs that would exceed it are refused.
+	DiskQuota size.ByteCount `yaml:"disk_quota,omitempty"`
+
+	// Secrets are fetched by the preparer and given to the pod's
+	// launchables with restricted permissions.
+	Secrets []SecretStanza `yaml:"secrets,omitempty"`
+
+	// ConfigTemplates maps the names of config files to Go templates that
+	// the preparer renders into the pod's config directory when installing
+	// it, for config that depends on the node the pod runs on.
+	ConfigTemplates map[string]string `yaml:"config_templates,omitempty"`
+
+	// Readiness, if set, makes the preparer wait for the pod to be ready
+	// after launching it. May be nil.
+	Readiness *ReadinessStanza `yaml:"readiness,omitempty"`
+
+	// Drain, if set, configures how the pod is drained and stopped when it
+	// is halted. May be nil.
+	Drain *DrainStanza `yaml:"drain,omitempty"`
+
+	// LogShipping, if set, configures how the pod's output is shipped.
+	// May be nil.
+	LogShipping *LogShippingStanza `yaml:"log_shipping,omitempty"`
+
+	// Confinement, if set, is the SELinux context or AppArmor profile that
+	// the pod's processes run in. May be nil.
+	Confinement *ConfinementStanza `yaml:"confinement,omitempty"`
+
+	// Environment, if set, limits the variables that the pod's processes
+	// inherit. May be nil.
+	Environment *EnvironmentStanza `yaml:"environment,omitempty"`
+
+	// Tolerations let the pod be scheduled on nodes with matching
+	// taints, which otherwise keep it off of them.
+	Tolerations []Toleration `yaml:"tolerations,omitempty"`
+
+	// Emergency marks the manifest as an emergency change, which is
+	// deployed even while a freeze covers the pod.
+	Emergency bool `yaml:"emergency,omitempty"`
+
+	// Sidecar, if set, has the preparer add a sidecar launchable to the
+	// pod. May be nil.
+	Sidecar *SidecarStanza `yaml:"sidecar,omitempty"`
+
 	// Used to track the original bytes so that we don't reorder them when
 	// doing a yaml.Unmarshal and a yaml.Marshal in succession
 	raw []byte
@@ -168,14 +385,10 @@ func (m builder) SetConfig(config map[interface{}]interface{}) error {
 }
 
 func (manifest *manifest) GetStatusHTTP() bool {
-	if manifest.StatusHTTP {
-		return true
-	}
 	return manifest.Status.HTTP
 }
 
 func (manifest *manifest) SetStatusHTTP(statusHTTP bool) {
-	manifest.StatusHTTP = false
 	manifest.Status.HTTP = statusHTTP
 }
 
@@ -191,17 +404,21 @@ func (manifest *manifest) SetStatusPath(statusPath string) {
 }
 
 func (manifest *manifest) GetStatusPort() int {
-	if manifest.StatusPort != 0 {
-		return manifest.StatusPort
-	}
 	return manifest.Status.Port
 }
 
 func (manifest *manifest) SetStatusPort(port int) {
-	manifest.StatusPort = 0
 	manifest.Status.Port = port
 }
 
+func (manifest *manifest) GetStatusPortLaunchable() launch.LaunchableID {
+	return manifest.Status.PortLaunchable
+}
+
+func (manifest *manifest) SetStatusPortLaunchable(launchableID launch.LaunchableID) {
+	manifest.Status.PortLaunchable = launchableID
+}
+
 func (manifest *manifest) GetStatusLocalhostOnly() bool {
 	return manifest.Status.LocalhostOnly
 }
@@ -210,6 +427,125 @@ func (manifest *manifest) SetStatusLocalhostOnly(localhostOnly bool) {
 	manifest.Status.LocalhostOnly = localhostOnly
 }
 
+func (manifest *manifest) GetMinHealthyDuration() time.Duration {
+	return manifest.Status.MinHealthyDuration
+}
+
+func (manifest *manifest) SetMinHealthyDuration(duration time.Duration) {
+	manifest.Status.MinHealthyDuration = duration
+}
+
+func (manifest *manifest) GetConfigReload() string {
+	return manifest.ConfigReload
+}
+
+func (manifest *manifest) SetConfigReload(command string) {
+	manifest.ConfigReload = command
+}
+
+func (manifest *manifest) GetDiskQuota() size.ByteCount {
+	return manifest.DiskQuota
+}
+
+func (manifest *manifest) SetDiskQuota(quota size.ByteCount) {
+	manifest.DiskQuota = quota
+}
+
+func (manifest *manifest) GetSecrets() []SecretStanza {
+	return manifest.Secrets
+}
+
+func (manifest *manifest) SetSecrets(secrets []SecretStanza) {
+	manifest.Secrets = secrets
+}
+
+func (manifest *manifest) GetConfigTemplates() map[string]string {
+	return manifest.ConfigTemplates
+}
+
+func (manifest *manifest) SetConfigTemplates(templates map[string]string) {
+	manifest.ConfigTemplates = templates
+}
+
+func (manifest *manifest) GetReadiness() *ReadinessStanza {
+	return manifest.Readiness
+}
+
+func (manifest *manifest) SetReadiness(readiness *ReadinessStanza) {
+	manifest.Readiness = readiness
+}
+
+func (manifest *manifest) GetDrain() *DrainStanza {
+	return manifest.Drain
+}
+
+func (manifest *manifest) SetDrain(drain *DrainStanza) {
+	manifest.Drain = drain
+}
+
+func (manifest *manifest) GetLogShipping() *LogShippingStanza {
+	return manifest.LogShipping
+}
+
+func (manifest *manifest) SetLogShipping(logShipping *LogShippingStanza) {
+	manifest.LogShipping = logShipping
+}
+
+func (manifest *manifest) GetConfinement() *ConfinementStanza {
+	return manifest.Confinement
+}
+
+func (manifest *manifest) SetConfinement(confinement *ConfinementStanza) {
+	manifest.Confinement = confinement
+}
+
+func (manifest *manifest) GetEnvironment() *EnvironmentStanza {
+	return manifest.Environment
+}
+
+func (manifest *manifest) SetEnvironment(environment *EnvironmentStanza) {
+	manifest.Environment = environment
+}
+
+func (manifest *manifest) GetTolerations() []Toleration {
+	return manifest.Tolerations
+}
+
+func (manifest *manifest) SetTolerations(tolerations []Toleration) {
+	manifest.Tolerations = tolerations
+}
+
+func (manifest *manifest) GetEmergency() bool {
+	return manifest.Emergency
+}
+
+func (manifest *manifest) SetEmergency(emergency bool) {
+	manifest.Emergency = emergency
+}
+
+func (manifest *manifest) GetSidecar() *SidecarStanza {
+	return manifest.Sidecar
+}
+
+func (manifest *manifest) SetSidecar(sidecar *SidecarStanza) {
+	manifest.Sidecar = sidecar
+}
+
+func (manifest *manifest) GetLogRedaction() redact.Config {
+	if manifest.LogRedaction == nil {
+		return redact.Config{}
+	}
+	return *manifest.LogRedaction
+}
+
+func (manifest *manifest) SetLogRedaction(config redact.Config) {
+	if len(config.Patterns) == 0 && len(config.Keys) == 0 {
+		manifest.LogRedaction = nil
+		return
+	}
+	manifest.LogRedaction = &config
+}
+
 func (manifest *manifest) RunAsUser() string {
 	if manifest.RunAs != "" {
 		return manifest.RunAs
@@ -255,9 +591,13 @@ func FromReader(reader io.Reader) (Manifest, error) {
 }
 
 // FromBytes constructs a Manifest by parsing its serialized representation. The
-// manifest can be a raw YAML document or a PGP clearsigned YAML document. If signed, the
+// manifest can be a raw YAML or JSON document or a PGP clearsigned one. If signed, the
 // signature components will be stored inside the Manifest instance.
 func FromBytes(bytes []byte) (Manifest, error) {
+	return fromBytes(bytes, false)
+}
+
+func fromBytes(bytes []byte, strict bool) (Manifest, error) {
 	manifest := &manifest{}
 
 	// Preserve the raw manifest so that manifest.Bytes() returns bytes in
@@ -281,6 +621,22 @@ func FromBytes(bytes []byte) (Manifest, error) {
 		bytes = signed.Plaintext
 	}
 
+	yamlBytes, isJSON, err := jsonToYAML(bytes)
+	if err != nil {
+		return nil, util.Errorf("Could not read pod manifest: %s", err)
+	}
+	if isJSON {
+		bytes = yamlBytes
+	}
+	bytes, err = migrateSchema(bytes)
+	if err != nil {
+		return nil, util.Errorf("Could not read pod manifest: %s", err)
+	}
+	if strict {
+		if err := checkStrict(bytes); err != nil {
+			return nil, util.Errorf("invalid manifest: %s", err)
+		}
+	}
 	if err := yaml.Unmarshal(bytes, manifest); err != nil {
 		return nil, util.Errorf("Could not read pod manifest: %s", err)
 	}
@@ -383,6 +739,41 @@ func (manifest *manifest) PlatformConfigFileName() (string, error) {
 	return string(manifest.Id) + "_" + sha + ".platform.yaml", nil
 }
 
+// OnlyConfigChanged returns true if oldManifest and newManifest differ, but
+// only in their config
+func OnlyConfigChanged(oldManifest, newManifest Manifest) (bool, error) {
+	oldSHA, err := oldManifest.SHA()
+	if err != nil {
+		return false, err
+	}
+	newSHA, err := newManifest.SHA()
+	if err != nil {
+		return false, err
+	}
+	if oldSHA == newSHA {
+		return false, nil
+	}
+
+	oldWithoutConfig, err := shaWithoutConfig(oldManifest)
+	if err != nil {
+		return false, err
+	}
+	newWithoutConfig, err := shaWithoutConfig(newManifest)
+	if err != nil {
+		return false, err
+	}
+	return oldWithoutConfig == newWithoutConfig, nil
+}
+
+func shaWithoutConfig(m Manifest) (string, error) {
+	builder := m.GetBuilder()
+	err := builder.SetConfig(nil)
+	if err != nil {
+		return "", err
+	}
+	return builder.GetManifest().SHA()
+}
+
 // Returns readers needed to verify the signature on the
 // manifest. These readers do not need closing.
 func (m manifest) SignatureData() (plaintext, signature []byte) {
@@ -402,10 +793,103 @@ func ValidManifest(m Manifest) error {
 		switch {
 		case stanza.LaunchableType == "":
 			return fmt.Errorf("'%s': launchable must contain a 'launchable_type'", launchableID)
-		case stanza.Location == "" && stanza.Version.ID == "":
+		case stanza.LaunchableType == "docker":
+			if stanza.Image == "" {
+				return fmt.Errorf("'%s': docker launchable must contain an 'image'", launchableID)
+			}
+			if stanza.Location != "" || stanza.Version.IsSet() {
+				return fmt.Errorf("'%s': docker launchable must not contain a 'location' or 'version'", launchableID)
+			}
+			if _, err := stanza.LaunchableVersion(); err != nil {
+				return fmt.Errorf("'%s': %s", launchableID, err)
+			}
+		case stanza.Image != "":
+			return fmt.Errorf("'%s': only docker launchables may contain an 'image'", launchableID)
+		case stanza.Location == "" && !stanza.Version.IsSet():
 			return fmt.Errorf("'%s': launchable must contain a 'location' or 'version'", launchableID)
-		case stanza.Location != "" && stanza.Version.ID != "":
+		case stanza.Location != "" && stanza.Version.IsSet():
 			return fmt.Errorf("'%s': launchable must not contain both 'location' and 'version'", launchableID)
+		case stanza.Version.ID != "" && stanza.Version.Channel != "":
+			return fmt.Errorf("'%s': launchable version must not contain both an 'id' and a 'channel'", launchableID)
+		}
+		if stanza.Port != "" && stanza.Port != launch.AutoPort {
+			return fmt.Errorf("'%s': 'port' must be %q if set", launchableID, launch.AutoPort)
+		}
+	}
+	if portLaunchable := m.GetStatusPortLaunchable(); portLaunchable != "" {
+		if m.GetStatusPort() != 0 {
+			return fmt.Errorf("'status': must not contain both 'port' and 'port_launchable'")
+		}
+		if m.GetLaunchableStanzas()[portLaunchable].Port != launch.AutoPort {
+			return fmt.Errorf("'status': 'port_launchable' %q must be a launchable with an auto port", portLaunchable)
+		}
+	}
+	if m.GetConfigReload() != "" && !runit.IsReloadCommand(m.GetConfigReload()) {
+		return fmt.Errorf("'config_reload' must be one of %v", runit.ReloadCommands)
+	}
+	if _, err := redact.New(m.GetLogRedaction()); err != nil {
+		return fmt.Errorf("'log_redaction': %s", err)
+	}
+	secretNames := make(map[string]bool)
+	for _, secret := range m.GetSecrets() {
+		switch {
+		case secret.Name == "" || secret.Path == "":
+			return fmt.Errorf("'secrets': each secret must contain a 'name' and a 'path'")
+		case strings.ContainsAny(secret.Name, "/=") || secret.Name == "." || secret.Name == "..":
+			return fmt.Errorf("'secrets': invalid secret name %q", secret.Name)
+		case secretNames[secret.Name]:
+			return fmt.Errorf("'secrets': secret %q is defined more than once", secret.Name)
+		}
+		secretNames[secret.Name] = true
+	}
+	if readiness := m.GetReadiness(); readiness != nil && readiness.Timeout < 0 {
+		return fmt.Errorf("'readiness': 'timeout' must not be negative")
+	}
+	if drain := m.GetDrain(); drain != nil {
+		switch {
+		case drain.HTTPPath != "" && len(drain.Command) > 0:
+			return fmt.Errorf("'drain': must not contain both 'http_path' and 'command'")
+		case drain.HTTPPath != "" && !strings.HasPrefix(drain.HTTPPath, "/"):
+			return fmt.Errorf("'drain': 'http_path' must start with /")
+		case drain.HTTPPath != "" && m.GetStatusPort() == 0 && m.GetStatusPortLaunchable() == "":
+			return fmt.Errorf("'drain': 'http_path' requires a status port")
+		case drain.GracePeriod < 0 || drain.TermTimeout < 0:
+			return fmt.Errorf("'drain': 'grace_period' and 'term_timeout' must not be negative")
+		}
+	}
+	if confinement := m.GetConfinement(); confinement != nil && confinement.SELinuxContext != "" && confinement.AppArmorProfile != "" {
+		return fmt.Errorf("'confinement': must not contain both 'selinux_context' and 'apparmor_profile'")
+	}
+	if environment := m.GetEnvironment(); environment != nil {
+		switch environment.Inherit {
+		case "", InheritAllEnv:
+			if len(environment.Allow) > 0 {
+				return fmt.Errorf("'environment': 'allow' requires 'inherit' to be %q", InheritNoneEnv)
+			}
+		case InheritNoneEnv:
+		default:
+			return fmt.Errorf("'environment': 'inherit' must be %q or %q", InheritAllEnv, InheritNoneEnv)
+		}
+	}
+	for _, toleration := range m.GetTolerations() {
+		if toleration.Key == "" {
+			return fmt.Errorf("'tolerations': every toleration must have a 'key'")
+		}
+	}
+	for name := range m.GetConfigTemplates() {
+		if name == "" || strings.Contains(name, "/") || name == "." || name == ".." {
+			return fmt.Errorf("'config_templates': invalid file name %q", name)
+		}
+	}
+	if sidecar := m.GetSidecar(); sidecar != nil {
+		switch {
+		case sidecar.Name == "" || sidecar.Launchable == "":
+			return fmt.Errorf("'sidecar': must contain a 'name' and a 'launchable'")
+		case launch.LaunchableID(sidecar.Name) == sidecar.Launchable:
+			return fmt.Errorf("'sidecar': 'name' must not be the main launchable")
+		}
+		if _, ok := m.GetLaunchableStanzas()[sidecar.Launchable]; !ok {
+			return fmt.Errorf("'sidecar': 'launchable' %q is not a launchable of the pod", sidecar.Launchable)
 		}
 	}
 	return nil
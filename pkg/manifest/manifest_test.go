@@ -2,10 +2,15 @@ package manifest
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/square/p2/pkg/cgroups"
 	"github.com/square/p2/pkg/launch"
@@ -137,7 +142,7 @@ func TestPodManifestCanReportItsSHA(t *testing.T) {
 	Assert(t).IsNil(err, "should not have erred when building manifest")
 	val, err := manifest.SHA()
 	Assert(t).IsNil(err, "should not have erred when getting SHA")
-	expected := "f7fdad6e2362c9345a83196701dafb989fa8229b8d671642976cb35b5166c6f0"
+	expected := "087e9c096af72140d21048fcedcc51a49de73f7c616730324a9ef53c4541474c"
 	if val != expected {
 		t.Errorf("Expected manifest sha to be %s but was %s. If this was expected, change the assertion value", expected, val)
 	}
@@ -217,6 +222,179 @@ func TestStatusPort(t *testing.T) {
 	}
 }
 
+func TestMinHealthyDuration(t *testing.T) {
+	tests := []struct {
+		config   string
+		expected time.Duration
+	}{
+		{`{ id: thepod }`, 0},
+		{`{ id: thepod, status: { min_healthy_duration: 5m } }`, 5 * time.Minute},
+		{`{ id: thepod, status: { port: 5, min_healthy_duration: 90s } }`, 90 * time.Second},
+	}
+	for _, test := range tests {
+		manifest, err := FromBytes([]byte(test.config))
+		Assert(t).IsNil(err, "should not have erred when building manifest")
+
+		Assert(t).AreEqual(test.expected, manifest.GetMinHealthyDuration(), "uses the correct min healthy duration")
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, config_reload: hup }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetConfigReload(), "hup", "uses the configured reload command")
+
+	_, err = FromBytes([]byte(`{ id: thepod, config_reload: kill }`))
+	Assert(t).IsNotNil(err, "should not allow a reload command that stops the pod")
+}
+
+func TestSecrets(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, secrets: [ { name: DB_PASSWORD, path: thepod/db }, { name: tls.key, path: thepod/tls, file: true } ] }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(len(manifest.GetSecrets()), 2, "should have read both secrets")
+	Assert(t).IsTrue(manifest.GetSecrets()[1].File, "should have read the secret's file option")
+
+	_, err = FromBytes([]byte(`{ id: thepod, secrets: [ { name: ../key, path: thepod/tls } ] }`))
+	Assert(t).IsNotNil(err, "should not allow a secret name that escapes its directory")
+
+	_, err = FromBytes([]byte(`{ id: thepod, secrets: [ { name: KEY, path: a }, { name: KEY, path: b } ] }`))
+	Assert(t).IsNotNil(err, "should not allow two secrets with the same name")
+}
+
+func TestConfigTemplates(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, config_templates: { app.conf: "port {{port \"http\"}}" } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetConfigTemplates()["app.conf"], `port {{port "http"}}`, "should have read the template")
+
+	_, err = FromBytes([]byte(`{ id: thepod, config_templates: { ../app.conf: "" } }`))
+	Assert(t).IsNotNil(err, "should not allow a template name that escapes the config dir")
+}
+
+func TestReadiness(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, readiness: { command: [bin/ready], timeout: 2m } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetReadiness().Command[0], "bin/ready", "should have read the readiness command")
+	Assert(t).AreEqual(manifest.GetReadiness().Timeout, 2*time.Minute, "should have read the readiness timeout")
+
+	_, err = FromBytes([]byte(`{ id: thepod, readiness: { timeout: -1s } }`))
+	Assert(t).IsNotNil(err, "should not allow a negative readiness timeout")
+}
+
+func TestDrain(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, status_port: 8080, drain: { http_path: /drain, grace_period: 1m, term_timeout: 10s } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetDrain().HTTPPath, "/drain", "should have read the drain path")
+	Assert(t).AreEqual(manifest.GetDrain().GracePeriod, time.Minute, "should have read the grace period")
+	Assert(t).AreEqual(manifest.GetDrain().TermTimeout, 10*time.Second, "should have read the term timeout")
+
+	_, err = FromBytes([]byte(`{ id: thepod, drain: { http_path: /drain } }`))
+	Assert(t).IsNotNil(err, "should not allow a drain path without a status port")
+
+	_, err = FromBytes([]byte(`{ id: thepod, status_port: 8080, drain: { http_path: /drain, command: [bin/drain] } }`))
+	Assert(t).IsNotNil(err, "should not allow both a drain path and command")
+}
+
+func TestAutoPorts(t *testing.T) {
+	launchables := `launchables: { web: { launchable_type: hoist, location: "https://localhost/web_abc.tar.gz", port: auto } }`
+	manifest, err := FromBytes([]byte(`{ id: thepod, status: { port_launchable: web }, ` + launchables + ` }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetStatusPortLaunchable(), launch.LaunchableID("web"), "should have read the status port launchable")
+
+	_, err = FromBytes([]byte(`{ id: thepod, status: { port_launchable: other }, ` + launchables + ` }`))
+	Assert(t).IsNotNil(err, "should not allow a status port launchable without an auto port")
+
+	_, err = FromBytes([]byte(`{ id: thepod, launchables: { web: { launchable_type: hoist, location: "https://localhost/web_abc.tar.gz", port: "8080" } } }`))
+	Assert(t).IsNotNil(err, "should only allow auto ports")
+}
+
+func TestVersionChannel(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, launchables: { web: { launchable_type: hoist, version: { channel: stable } } } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetLaunchableStanzas()["web"].Version.Channel, "stable", "should have read the channel")
+
+	_, err = FromBytes([]byte(`{ id: thepod, launchables: { web: { launchable_type: hoist, version: { id: "1.2.3", channel: stable } } } }`))
+	Assert(t).IsNotNil(err, "should not allow both a version id and a channel")
+
+	_, err = FromBytes([]byte(`{ id: thepod, launchables: { web: { launchable_type: hoist, location: "https://localhost/web_abc.tar.gz", version: { channel: stable } } } }`))
+	Assert(t).IsNotNil(err, "should not allow both a location and a channel")
+}
+
+func TestConfinement(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, confinement: { selinux_context: "system_u:system_r:p2_pod_t:s0" } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsTrue(manifest.GetConfinement().Confined(), "should have read the confinement")
+	Assert(t).AreEqual(manifest.GetConfinement().SELinuxContext, "system_u:system_r:p2_pod_t:s0", "should have read the SELinux context")
+
+	manifest, err = FromBytes([]byte(`{ id: thepod }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).IsFalse(manifest.GetConfinement().Confined(), "should not be confined without a confinement")
+
+	_, err = FromBytes([]byte(`{ id: thepod, confinement: { selinux_context: "system_u:system_r:p2_pod_t:s0", apparmor_profile: p2-pod } }`))
+	Assert(t).IsNotNil(err, "should not allow both an SELinux context and an AppArmor profile")
+}
+
+func TestEnvironment(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, environment: { inherit: none, allow: [PATH], deny: [HOME] } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetEnvironment().Inherit, InheritNoneEnv, "should have read the inherit setting")
+	Assert(t).AreEqual(manifest.GetEnvironment().Allow[0], "PATH", "should have read the allowed variables")
+
+	_, err = FromBytes([]byte(`{ id: thepod, environment: { inherit: some } }`))
+	Assert(t).IsNotNil(err, "should not allow an unknown inherit setting")
+
+	_, err = FromBytes([]byte(`{ id: thepod, environment: { inherit: all, allow: [PATH] } }`))
+	Assert(t).IsNotNil(err, "should only allow variables when inheriting none")
+}
+
+func TestTolerations(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, tolerations: [ { key: dedicated, value: db }, { key: maintenance } ] }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	tolerations := manifest.GetTolerations()
+	Assert(t).AreEqual(len(tolerations), 2, "should have read both tolerations")
+	Assert(t).IsTrue(tolerations[0].Tolerates("dedicated", "db"), "should tolerate the matching taint")
+	Assert(t).IsFalse(tolerations[0].Tolerates("dedicated", "web"), "should not tolerate a different value")
+	Assert(t).IsTrue(tolerations[1].Tolerates("maintenance", "true"), "should tolerate any value without one")
+
+	_, err = FromBytes([]byte(`{ id: thepod, tolerations: [ { value: db } ] }`))
+	Assert(t).IsNotNil(err, "should require a toleration key")
+}
+
+func TestSidecar(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, launchables: { app: { launchable_type: hoist, location: "https://localhost/app.tar.gz" } }, sidecar: { name: envoy, launchable: app } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	Assert(t).AreEqual(manifest.GetSidecar().Name, "envoy", "should have read the sidecar's name")
+	Assert(t).AreEqual(manifest.GetSidecar().Launchable, launch.LaunchableID("app"), "should have read the sidecar's main launchable")
+
+	_, err = FromBytes([]byte(`{ id: thepod, sidecar: { name: envoy } }`))
+	Assert(t).IsNotNil(err, "should require the main launchable")
+
+	_, err = FromBytes([]byte(`{ id: thepod, launchables: { app: { launchable_type: hoist, location: "https://localhost/app.tar.gz" } }, sidecar: { name: envoy, launchable: web } }`))
+	Assert(t).IsNotNil(err, "should require the main launchable to be in the pod")
+}
+
+func TestOnlyConfigChanged(t *testing.T) {
+	tests := []struct {
+		oldManifest string
+		newManifest string
+		expected    bool
+	}{
+		{`{ id: thepod, config: { a: 1 } }`, `{ id: thepod, config: { a: 2 } }`, true},
+		{`{ id: thepod, config: { a: 1 } }`, `{ id: thepod, config: { a: 1 } }`, false},
+		{`{ id: thepod, config: { a: 1 } }`, `{ id: thepod, run_as: other, config: { a: 2 } }`, false},
+		{`{ id: thepod }`, `{ id: thepod, config: { a: 1 } }`, true},
+	}
+	for _, test := range tests {
+		oldManifest, err := FromBytes([]byte(test.oldManifest))
+		Assert(t).IsNil(err, "should not have erred when building manifest")
+		newManifest, err := FromBytes([]byte(test.newManifest))
+		Assert(t).IsNil(err, "should not have erred when building manifest")
+
+		onlyConfig, err := OnlyConfigChanged(oldManifest, newManifest)
+		Assert(t).IsNil(err, "should not have erred comparing manifests")
+		Assert(t).AreEqual(onlyConfig, test.expected, fmt.Sprintf("wrong result comparing %s to %s", test.oldManifest, test.newManifest))
+	}
+}
+
 func TestRunAs(t *testing.T) {
 	config := testPod()
 	manifest, err := FromBytes([]byte(config))
@@ -339,3 +517,103 @@ func TestSetConfigCopies(t *testing.T) {
 	config["foo"] = "baz"
 	Assert(t).AreEqual(manifestConfig["foo"], "bar", "Config values shouldn't have changed when mutating the original input due to deep copy")
 }
+
+func TestLogRedaction(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, log_redaction: { keys: [password] } }`))
+	Assert(t).IsNil(err, "should not have erred when building manifest")
+	keys := manifest.GetLogRedaction().Keys
+	Assert(t).AreEqual(len(keys), 1, "should have one redaction key")
+	Assert(t).AreEqual(keys[0], "password", "uses the configured redaction key")
+
+	_, err = FromBytes([]byte(`{ id: thepod, log_redaction: { patterns: ["("] } }`))
+	Assert(t).IsNotNil(err, "should not allow an invalid redaction pattern")
+}
+
+func TestSchemaVersions(t *testing.T) {
+	manifest, err := FromBytes([]byte(`{ id: thepod, status_port: 456, status_http: true, status: { port: 123, path: /health } }`))
+	Assert(t).IsNil(err, "should have migrated a version 1 manifest")
+	Assert(t).AreEqual(manifest.GetStatusPort(), 456, "the top level status port should have been migrated")
+	Assert(t).IsTrue(manifest.GetStatusHTTP(), "the top level status http should have been migrated")
+	Assert(t).AreEqual(manifest.GetStatusPath(), "/health", "the rest of the status stanza should have been kept")
+
+	manifest, err = FromBytes([]byte(`{ id: thepod, schema_version: 2, status: { port: 123 } }`))
+	Assert(t).IsNil(err, "should have read a current manifest")
+	Assert(t).AreEqual(manifest.GetStatusPort(), 123, "unexpected status port")
+
+	_, err = FromBytes([]byte(`{ id: thepod, schema_version: 2, status_port: 123 }`))
+	Assert(t).IsNotNil(err, "should have refused a key removed by the manifest's schema version")
+
+	_, err = FromBytes([]byte(fmt.Sprintf(`{ id: thepod, schema_version: %d }`, CurrentSchemaVersion+1)))
+	Assert(t).IsNotNil(err, "should have refused a manifest of a future schema version")
+	Assert(t).IsTrue(strings.Contains(err.Error(), "must be upgraded"), "should have explained the refusal, was: "+err.Error())
+
+	_, err = FromBytes([]byte(`{ id: thepod, schema_version: latest }`))
+	Assert(t).IsNotNil(err, "should have refused a schema version that isn't a number")
+}
+
+func TestJSONManifests(t *testing.T) {
+	fromYAML, err := FromBytes([]byte(`
+id: thepod
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost:4444/app.tar.gz
+    restart_timeout: 60s
+config:
+  big: 9007199254740993
+  nested:
+    list: [a, b]
+status:
+  port: 8080
+`))
+	Assert(t).IsNil(err, "should have read the YAML manifest")
+
+	jsonBytes, err := fromYAML.MarshalJSON()
+	Assert(t).IsNil(err, "should have marshaled the manifest to JSON")
+	again, err := fromYAML.GetBuilder().GetManifest().MarshalJSON()
+	Assert(t).IsNil(err, "should have marshaled the manifest to JSON")
+	Assert(t).AreEqual(string(again), string(jsonBytes), "canonical JSON should be stable")
+
+	// tabs can't indent YAML
+	indented := bytes.Buffer{}
+	err = json.Indent(&indented, jsonBytes, "", "\t")
+	Assert(t).IsNil(err, "should have indented the JSON")
+	fromJSON, err := FromBytes(indented.Bytes())
+	Assert(t).IsNil(err, "should have read the JSON manifest: "+indented.String())
+
+	Assert(t).AreEqual(fromJSON.GetStatusPort(), 8080, "unexpected status port")
+	Assert(t).AreEqual(fromJSON.GetConfig()["big"], 9007199254740993, "large integers should keep their precision")
+	yamlSHA, _ := fromYAML.SHA()
+	jsonSHA, _ := fromJSON.SHA()
+	Assert(t).AreEqual(jsonSHA, yamlSHA, "the manifest should have the same SHA in either format")
+
+	roundTripped, err := fromJSON.MarshalJSON()
+	Assert(t).IsNil(err, "should have marshaled the manifest to JSON")
+	Assert(t).AreEqual(string(roundTripped), string(jsonBytes), "JSON should round trip")
+
+	marshaled, err := MarshalFormat(fromJSON, JSONFormat)
+	Assert(t).IsNil(err, "should have marshaled the manifest to JSON")
+	Assert(t).AreEqual(string(marshaled), string(jsonBytes), "unexpected JSON format")
+	_, err = ParseFormat("xml")
+	Assert(t).IsNotNil(err, "should have refused an unknown format")
+}
+
+func TestFromBytesStrict(t *testing.T) {
+	_, err := FromBytesStrict([]byte(`{ id: thepod, status: { port: 123 }, config: { anything: goes } }`))
+	Assert(t).IsNil(err, "should have read a manifest with only known keys")
+
+	_, err = FromBytesStrict([]byte(`{ id: thepod, stauts: { port: 123 } }`))
+	Assert(t).IsNotNil(err, "should have refused a misspelled key")
+
+	_, err = FromBytesStrict([]byte(`{ "id": "thepod", "status": { "prot": 123 } }`))
+	Assert(t).IsNotNil(err, "should have refused a misspelled key of a stanza")
+
+	_, filename, _, _ := runtime.Caller(0)
+	contents, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filename), "test_manifest.yaml"))
+	Assert(t).IsNil(err, "should have read the test manifest")
+	_, err = FromBytes(contents)
+	Assert(t).IsNil(err, "FromBytes should ignore unknown keys")
+	_, err = FromBytesStrict(contents)
+	Assert(t).IsNotNil(err, "should have refused the launchable_id of a launchable")
+	Assert(t).IsTrue(strings.Contains(err.Error(), "launchables.app.launchable_id"), "should have named the unknown key, was: "+err.Error())
+}
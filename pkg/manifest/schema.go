@@ -0,0 +1,121 @@
+package manifest
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// CurrentSchemaVersion is the newest schema version of pod manifests that this
+// version of p2 understands. Manifests of older versions are migrated to it
+// when they are read, and manifests of newer versions are refused, since they
+// may use fields whose meaning this version doesn't know.
+//
+// Manifests that don't set a schema_version are of version 1.
+const CurrentSchemaVersion = 2
+
+// A migration upgrades a manifest, decoded as generic YAML, from the schema
+// version before version to version
+type migration struct {
+	version int
+	// removed are the top level keys that the migration moves elsewhere,
+	// which manifests of version or newer must not set
+	removed []string
+	migrate func(doc map[interface{}]interface{}) error
+}
+
+// migrations are ordered by version, with one for each version after 1
+var migrations = []migration{
+	{
+		// version 2 only configures status checks with the status stanza
+		version: 2,
+		removed: []string{"status_port", "status_http"},
+		migrate: migrateTopLevelStatus,
+	},
+}
+
+// migrateSchema returns the YAML of a manifest migrated to
+// CurrentSchemaVersion, which is manifestYAML itself if it already is of
+// CurrentSchemaVersion
+func migrateSchema(manifestYAML []byte) ([]byte, error) {
+	var doc map[interface{}]interface{}
+	err := yaml.Unmarshal(manifestYAML, &doc)
+	if err != nil {
+		return nil, err
+	}
+	version, err := schemaVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+	if version > CurrentSchemaVersion {
+		return nil, util.Errorf("manifest has schema_version %d, but this version of p2 only understands versions up to %d and must be upgraded to read it", version, CurrentSchemaVersion)
+	}
+
+	for _, migration := range migrations {
+		if version >= migration.version {
+			for _, key := range migration.removed {
+				if _, ok := doc[key]; ok {
+					return nil, util.Errorf("'%s' is not supported by schema_version %d", key, version)
+				}
+			}
+		}
+	}
+	if version == CurrentSchemaVersion {
+		return manifestYAML, nil
+	}
+
+	for _, migration := range migrations {
+		if version >= migration.version {
+			continue
+		}
+		err = migration.migrate(doc)
+		if err != nil {
+			return nil, util.Errorf("could not migrate manifest to schema_version %d: %s", migration.version, err)
+		}
+	}
+	return yaml.Marshal(doc)
+}
+
+func schemaVersion(doc map[interface{}]interface{}) (int, error) {
+	value, ok := doc["schema_version"]
+	if !ok || value == nil {
+		return 1, nil
+	}
+	version, ok := value.(int)
+	if !ok || version < 1 {
+		return 0, util.Errorf("'schema_version' must be a positive integer, was %v", value)
+	}
+	return version, nil
+}
+
+// migrateTopLevelStatus moves the status_port and status_http keys of version
+// 1 into the status stanza. They took precedence over the stanza's port and
+// http.
+func migrateTopLevelStatus(doc map[interface{}]interface{}) error {
+	port, hasPort := doc["status_port"]
+	http, hasHTTP := doc["status_http"]
+	if !hasPort && !hasHTTP {
+		return nil
+	}
+
+	status := make(map[interface{}]interface{})
+	if existing, ok := doc["status"]; ok && existing != nil {
+		existing, ok := existing.(map[interface{}]interface{})
+		if !ok {
+			return fmt.Errorf("'status' must be a map")
+		}
+		status = existing
+	}
+	if port != nil && port != 0 {
+		status["port"] = port
+	}
+	if http == true {
+		status["http"] = true
+	}
+	delete(doc, "status_port")
+	delete(doc, "status_http")
+	doc["status"] = status
+	return nil
+}
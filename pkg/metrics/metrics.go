@@ -14,6 +14,10 @@ var Registry metrics.Registry
 // ExpHandler is an http handler that will publish the contents of its composed registry as JSON
 var ExpHandler http.Handler
 
+// PrometheusHandler is an http handler that will publish the contents of its
+// composed registry in the Prometheus text format
+var PrometheusHandler http.Handler
+
 var m sync.Mutex
 
 // Those who import this package get a default metrics.Registry
@@ -22,6 +26,9 @@ func init() {
 	if ExpHandler == nil {
 		ExpHandler = exp.ExpHandler(Registry)
 	}
+	if PrometheusHandler == nil {
+		PrometheusHandler = NewPrometheusHandler(Registry)
+	}
 }
 
 func SetMetricsRegistry(registry metrics.Registry) {
@@ -29,4 +36,5 @@ func SetMetricsRegistry(registry metrics.Registry) {
 	defer m.Unlock()
 	Registry = registry
 	ExpHandler = exp.ExpHandler(Registry)
+	PrometheusHandler = NewPrometheusHandler(Registry)
 }
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// The quantiles reported for histograms and timers
+var prometheusQuantiles = []float64{0.5, 0.9, 0.99}
+
+// NewPrometheusHandler returns an http handler that publishes the contents of
+// registry in the Prometheus text exposition format, so that it can be
+// scraped without a Prometheus client in each binary. Counters and meters are
+// exported as counters, gauges as gauges, and histograms and timers as
+// summaries. Timers are converted to seconds and get a "_seconds" suffix.
+// Characters that aren't valid in Prometheus metric names are replaced with
+// underscores.
+func NewPrometheusHandler(registry metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		err := WritePrometheus(w, registry)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// WritePrometheus writes the contents of registry to w in the Prometheus text
+// exposition format, sorted by metric name
+func WritePrometheus(w io.Writer, registry metrics.Registry) error {
+	all := make(map[string]interface{})
+	registry.Each(func(name string, metric interface{}) {
+		all[name] = metric
+	})
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := bufio.NewWriter(w)
+	for _, name := range names {
+		promName := prometheusName(name)
+		switch metric := all[name].(type) {
+		case metrics.Counter:
+			writeSample(buf, promName, "counter", float64(metric.Count()))
+		case metrics.Meter:
+			writeSample(buf, promName, "counter", float64(metric.Snapshot().Count()))
+		case metrics.Gauge:
+			writeSample(buf, promName, "gauge", float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			writeSample(buf, promName, "gauge", metric.Value())
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			writeSummary(buf, promName, h.Percentiles(prometheusQuantiles), float64(h.Sum()), h.Count(), 1)
+		case metrics.Timer:
+			t := metric.Snapshot()
+			writeSummary(buf, promName+"_seconds", t.Percentiles(prometheusQuantiles), float64(t.Sum()), t.Count(), float64(time.Second))
+		}
+	}
+	return buf.Flush()
+}
+
+func writeSample(w io.Writer, name string, metricType string, value float64) {
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+	fmt.Fprintf(w, "%s %s\n", name, formatValue(value))
+}
+
+// writeSummary writes a summary of the percentiles, sum and count of a sample,
+// with values divided by unit
+func writeSummary(w io.Writer, name string, percentiles []float64, sum float64, count int64, unit float64) {
+	fmt.Fprintf(w, "# TYPE %s summary\n", name)
+	for i, quantile := range prometheusQuantiles {
+		fmt.Fprintf(w, "%s{quantile=\"%s\"} %s\n", name, formatValue(quantile), formatValue(percentiles[i]/unit))
+	}
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatValue(sum/unit))
+	fmt.Fprintf(w, "%s_count %d\n", name, count)
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// prometheusName replaces the characters of name that aren't allowed in
+// Prometheus metric names
+func prometheusName(name string) string {
+	out := []byte(name)
+	for i, c := range out {
+		valid := c == '_' || c == ':' ||
+			(c >= 'a' && c <= 'z') ||
+			(c >= 'A' && c <= 'Z') ||
+			(i > 0 && c >= '0' && c <= '9')
+		if !valid {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
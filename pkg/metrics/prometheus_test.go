@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("preparer_installs", registry).Inc(3)
+	metrics.GetOrRegisterGauge("pods.running", registry).Update(2)
+	histogram := metrics.GetOrRegisterHistogram("output_pairs_bytes", registry, metrics.NewUniformSample(10))
+	histogram.Update(10)
+	histogram.Update(20)
+	metrics.GetOrRegisterTimer("hook_run", registry).Update(2 * time.Second)
+
+	var out bytes.Buffer
+	err := WritePrometheus(&out, registry)
+	Assert(t).IsNil(err, "should have written the registry")
+
+	expected := strings.Join([]string{
+		"# TYPE hook_run_seconds summary",
+		`hook_run_seconds{quantile="0.5"} 2`,
+		`hook_run_seconds{quantile="0.9"} 2`,
+		`hook_run_seconds{quantile="0.99"} 2`,
+		"hook_run_seconds_sum 2",
+		"hook_run_seconds_count 1",
+		"# TYPE output_pairs_bytes summary",
+		`output_pairs_bytes{quantile="0.5"} 15`,
+		`output_pairs_bytes{quantile="0.9"} 20`,
+		`output_pairs_bytes{quantile="0.99"} 20`,
+		"output_pairs_bytes_sum 30",
+		"output_pairs_bytes_count 2",
+		"# TYPE pods_running gauge",
+		"pods_running 2",
+		"# TYPE preparer_installs counter",
+		"preparer_installs 3",
+		"",
+	}, "\n")
+	Assert(t).AreEqual(out.String(), expected, "unexpected exposition")
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("preparer_installs", registry).Inc(1)
+
+	recorder := httptest.NewRecorder()
+	NewPrometheusHandler(registry).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	Assert(t).AreEqual(recorder.Code, 200, "should have served the metrics")
+	Assert(t).IsTrue(strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain"), "should have served the text format")
+	Assert(t).IsTrue(strings.Contains(recorder.Body.String(), "preparer_installs 1\n"), "should have served the counter")
+}
+
+func TestPrometheusName(t *testing.T) {
+	Assert(t).AreEqual(prometheusName("consul_kv_get"), "consul_kv_get", "valid names should be kept")
+	Assert(t).AreEqual(prometheusName("list-latency.prefix"), "list_latency_prefix", "invalid characters should be replaced")
+	Assert(t).AreEqual(prometheusName("1xx"), "_xx", "names can't start with a digit")
+}
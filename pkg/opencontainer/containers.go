@@ -195,6 +195,12 @@ func (l *Launchable) PostActivate() (string, error) {
 	return "", nil
 }
 
+// Preflight runs a Hoist-specific "preflight" script in the launchable.
+func (l *Launchable) Preflight(_ time.Duration) (string, error) {
+	// Not supported in OpenContainer
+	return "", nil
+}
+
 func (l *Launchable) flipSymlink(newLinkPath string) error {
 	dir, err := ioutil.TempDir(l.RootDir, l.ServiceID_)
 	if err != nil {
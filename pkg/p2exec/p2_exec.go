@@ -20,6 +20,25 @@ type P2ExecArgs struct {
 	Command          []string
 	WorkDir          string
 	RequireFile      string
+
+	// The SELinux context or AppArmor profile to exec the command in
+	SELinuxContext  string
+	AppArmorProfile string
+
+	// EnvFilter limits the variables that the command inherits from the
+	// environment p2-exec is run in
+	EnvFilter EnvFilter
+}
+
+// EnvFilter limits the variables that a command inherits. Variables from
+// EnvDirs and ExtraEnv are always set.
+type EnvFilter struct {
+	// Clear starts the command from an empty environment, other than the
+	// variables in Keep
+	Clear bool
+	Keep  []string
+	// Unset lists variables the command never inherits
+	Unset []string
 }
 
 func (args P2ExecArgs) CommandLine() []string {
@@ -32,6 +51,17 @@ func (args P2ExecArgs) CommandLine() []string {
 		cmd = append(cmd, "-u", args.User)
 	}
 
+	if args.EnvFilter.Clear {
+		cmd = append(cmd, "--clearenv")
+		for _, name := range args.EnvFilter.Keep {
+			cmd = append(cmd, "--keep-env", name)
+		}
+	}
+
+	for _, name := range args.EnvFilter.Unset {
+		cmd = append(cmd, "--unset-env", name)
+	}
+
 	for _, envDir := range args.EnvDirs {
 		cmd = append(cmd, "-e", envDir)
 	}
@@ -56,6 +86,14 @@ func (args P2ExecArgs) CommandLine() []string {
 		cmd = append(cmd, "--require-file", args.RequireFile)
 	}
 
+	if args.SELinuxContext != "" {
+		cmd = append(cmd, "--selinux-context", args.SELinuxContext)
+	}
+
+	if args.AppArmorProfile != "" {
+		cmd = append(cmd, "--apparmor-profile", args.AppArmorProfile)
+	}
+
 	if len(cmd) > 0 {
 		cmd = append(cmd, "--")
 	}
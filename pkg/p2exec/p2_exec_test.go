@@ -25,9 +25,11 @@ func TestBuildWithArgs(t *testing.T) {
 		CgroupConfigName: "some_cgroup_config_name",
 		CgroupName:       "cgroup_name",
 		RequireFile:      "require_file",
+		AppArmorProfile:  "some_profile",
+		EnvFilter:        EnvFilter{Clear: true, Keep: []string{"PATH"}, Unset: []string{"HOME"}},
 	}
 
-	expected = "-n -u some_user -e some_dir -e other_dir --extra-env FOO=BAR -l some_cgroup_config_name -c cgroup_name --require-file require_file -- script"
+	expected = "-n -u some_user --clearenv --keep-env PATH --unset-env HOME -e some_dir -e other_dir --extra-env FOO=BAR -l some_cgroup_config_name -c cgroup_name --require-file require_file --apparmor-profile some_profile -- script"
 	actual = strings.Join(args.CommandLine(), " ")
 	if actual != expected {
 		t.Errorf("Expected args.BuildWithArgs() to return '%s', was '%s'", expected, actual)
@@ -0,0 +1,186 @@
+package control
+
+import (
+	"context"
+
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// ClusterGroupStore is the subset of the pcstore interface needed to manage a
+// ClusterGroup
+type ClusterGroupStore interface {
+	PodClusterStore
+	MutatePCTxn(
+		ctx context.Context,
+		id fields.ID,
+		mutator func(fields.PodCluster) (fields.PodCluster, error),
+	) (fields.PodCluster, error)
+}
+
+// ClusterGroup manages the pod clusters that make up the same logical cluster
+// (a pod ID and cluster name) across several availability zones.
+type ClusterGroup struct {
+	pcStore ClusterGroupStore
+	txner   transaction.Txner
+
+	podID types.PodID
+	cn    fields.ClusterName
+	azs   []fields.AvailabilityZone
+}
+
+// NewClusterGroup returns a ClusterGroup for the pod clusters of podID named
+// cn in each of azs. The order of azs is the order in which
+// RolloutAnnotations visits the availability zones.
+func NewClusterGroup(
+	podID types.PodID,
+	cn fields.ClusterName,
+	azs []fields.AvailabilityZone,
+	pcStore ClusterGroupStore,
+	txner transaction.Txner,
+) *ClusterGroup {
+	return &ClusterGroup{
+		pcStore: pcStore,
+		txner:   txner,
+		podID:   podID,
+		cn:      cn,
+		azs:     azs,
+	}
+}
+
+// DefaultPodSelector returns the pod selector conventionally used for the pod
+// cluster of podID named cn in az
+func DefaultPodSelector(az fields.AvailabilityZone, cn fields.ClusterName, podID types.PodID) klabels.Selector {
+	return klabels.Everything().
+		Add(fields.PodIDLabel, klabels.EqualsOperator, []string{podID.String()}).
+		Add(fields.AvailabilityZoneLabel, klabels.EqualsOperator, []string{az.String()}).
+		Add(fields.ClusterNameLabel, klabels.EqualsOperator, []string{cn.String()})
+}
+
+func (group *ClusterGroup) podCluster(az fields.AvailabilityZone) *PodCluster {
+	return NewPodCluster(az, group.cn, group.podID, group.pcStore, DefaultPodSelector(az, group.cn, group.podID))
+}
+
+// Create creates the pod cluster in every availability zone of the group with
+// the given annotations. If any of the creations fails, the pod clusters
+// created by this call are deleted again before the error is returned.
+func (group *ClusterGroup) Create(annotations fields.Annotations, session pcstore.Session) (map[fields.AvailabilityZone]fields.PodCluster, error) {
+	created := make(map[fields.AvailabilityZone]fields.PodCluster, len(group.azs))
+	for _, az := range group.azs {
+		pc, err := group.podCluster(az).Create(annotations, session)
+		if err != nil {
+			for _, createdPC := range created {
+				if deleteErr := group.pcStore.Delete(createdPC.ID); deleteErr != nil {
+					err = util.Errorf("%s\n%s", err, deleteErr)
+				}
+			}
+			return nil, util.Errorf("Could not create pod cluster in %s: %s", az, err)
+		}
+		created[az] = pc
+	}
+	return created, nil
+}
+
+// Get returns the pod cluster in each availability zone of the group. It is an
+// error for any of them to be missing.
+func (group *ClusterGroup) Get() (map[fields.AvailabilityZone]fields.PodCluster, error) {
+	pcs := make(map[fields.AvailabilityZone]fields.PodCluster, len(group.azs))
+	for _, az := range group.azs {
+		pc, err := group.podCluster(az).Get()
+		if err != nil {
+			return nil, util.Errorf("Could not get pod cluster in %s: %s", az, err)
+		}
+		pcs[az] = pc
+	}
+	return pcs, nil
+}
+
+// UpdateAnnotations replaces the annotations on the pod cluster in every
+// availability zone of the group. The updates are applied in a single
+// transaction, so either all of the pod clusters are updated or none are.
+func (group *ClusterGroup) UpdateAnnotations(annotations fields.Annotations) (map[fields.AvailabilityZone]fields.PodCluster, error) {
+	return group.mutateAll(func(pc fields.PodCluster) (fields.PodCluster, error) {
+		pc.Annotations = annotations
+		return pc, nil
+	})
+}
+
+// PatchAnnotations merges the patch into the annotations on the pod cluster in
+// every availability zone of the group, with the same semantics as
+// PodCluster.PatchAnnotations. Like UpdateAnnotations, the patch is applied to
+// all of the pod clusters or none of them.
+func (group *ClusterGroup) PatchAnnotations(patch fields.Annotations) (map[fields.AvailabilityZone]fields.PodCluster, error) {
+	return group.mutateAll(annotationsPatcher(patch))
+}
+
+func (group *ClusterGroup) mutateAll(mutator func(fields.PodCluster) (fields.PodCluster, error)) (map[fields.AvailabilityZone]fields.PodCluster, error) {
+	current, err := group.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+
+	mutated := make(map[fields.AvailabilityZone]fields.PodCluster, len(current))
+	for az, pc := range current {
+		mutatedPC, err := group.pcStore.MutatePCTxn(ctx, pc.ID, mutator)
+		if err != nil {
+			return nil, util.Errorf("Could not update pod cluster in %s: %s", az, err)
+		}
+		mutated[az] = mutatedPC
+	}
+
+	err = transaction.MustCommit(ctx, group.txner)
+	if err != nil {
+		return nil, err
+	}
+	return mutated, nil
+}
+
+// Members returns the pods that currently belong to the pod cluster in each
+// availability zone of the group.
+func (group *ClusterGroup) Members(labeler MembershipLabeler) (map[fields.AvailabilityZone][]Member, error) {
+	members := make(map[fields.AvailabilityZone][]Member, len(group.azs))
+	for _, az := range group.azs {
+		azMembers, err := group.podCluster(az).Members(labeler)
+		if err != nil {
+			return nil, util.Errorf("Could not get members of pod cluster in %s: %s", az, err)
+		}
+		members[az] = azMembers
+	}
+	return members, nil
+}
+
+// RolloutAnnotations applies the patch to the pod cluster in one availability
+// zone at a time, in the order the group was constructed with. After each
+// availability zone is patched, afterEach (if non-nil) is called with the
+// updated pod cluster, and it can return an error to halt the rollout, for
+// example if the change made the availability zone unhealthy. The availability
+// zones that were patched are returned, along with the error that stopped the
+// rollout, if any. Availability zones that were already patched are not
+// reverted.
+func (group *ClusterGroup) RolloutAnnotations(
+	patch fields.Annotations,
+	afterEach func(fields.AvailabilityZone, fields.PodCluster) error,
+) ([]fields.AvailabilityZone, error) {
+	var patched []fields.AvailabilityZone
+	for _, az := range group.azs {
+		pc, err := group.podCluster(az).PatchAnnotations(patch)
+		if err != nil {
+			return patched, util.Errorf("Could not patch pod cluster in %s: %s", az, err)
+		}
+		patched = append(patched, az)
+
+		if afterEach != nil {
+			if err := afterEach(az, pc); err != nil {
+				return patched, util.Errorf("Halting rollout after %s: %s", az, err)
+			}
+		}
+	}
+	return patched, nil
+}
@@ -0,0 +1,203 @@
+package control
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	p2labels "github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul/consultest"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/pcstore/pcstoretest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// The fake pcstore applies transactional mutations immediately, so the txner
+// is only consulted if something adds real operations to the transaction
+type failingTxner struct{}
+
+func (failingTxner) Txn(api.KVTxnOps, *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	return false, nil, nil, util.Errorf("unexpected transaction")
+}
+
+var testAZs = []fields.AvailabilityZone{"west", "east", "central"}
+
+func newTestClusterGroup(t *testing.T) (*ClusterGroup, *pcstoretest.FakePCStore) {
+	fakePCStore := pcstoretest.NewFake()
+	group := NewClusterGroup("pod", "prod", testAZs, fakePCStore, failingTxner{})
+	_, err := group.Create(fields.Annotations{"deployer": "someone"}, consultest.NewSession())
+	if err != nil {
+		t.Fatalf("Unexpected error creating cluster group: %s", err)
+	}
+	return group, fakePCStore
+}
+
+func TestClusterGroupCreate(t *testing.T) {
+	group, fakePCStore := newTestClusterGroup(t)
+
+	pcs, err := group.Get()
+	if err != nil {
+		t.Fatalf("Unexpected error getting cluster group: %s", err)
+	}
+	if len(pcs) != len(testAZs) {
+		t.Fatalf("Expected a pod cluster in each of %d availability zones, got %d", len(testAZs), len(pcs))
+	}
+	for _, az := range testAZs {
+		pc := pcs[az]
+		if pc.AvailabilityZone != az || pc.PodID != "pod" || pc.Name != "prod" {
+			t.Errorf("Unexpected pod cluster for %s: %+v", az, pc)
+		}
+		if !pc.PodSelector.Matches(podClusterLabels(pc)) {
+			t.Errorf("Expected default pod selector for %s, got %s", az, pc.PodSelector)
+		}
+	}
+
+	// Creating a group with invalid annotations fails in the first zone,
+	// and must not touch the pod clusters that already exist
+	_, err = NewClusterGroup("pod", "staging", testAZs, fakePCStore, failingTxner{}).Create(fields.Annotations{"owner": map[string]interface{}{"pager": "nobody"}}, consultest.NewSession())
+	if err == nil {
+		t.Fatal("Expected creating a cluster group with an invalid owner to fail")
+	}
+	all, _ := fakePCStore.List()
+	if len(all) != len(testAZs) {
+		t.Errorf("Expected failed creation to leave %d pod clusters, found %d", len(testAZs), len(all))
+	}
+}
+
+// failingAZStore refuses to create pod clusters in a single availability zone
+type failingAZStore struct {
+	*pcstoretest.FakePCStore
+	failAZ fields.AvailabilityZone
+}
+
+func (s failingAZStore) Create(
+	podID types.PodID,
+	az fields.AvailabilityZone,
+	cn fields.ClusterName,
+	podSelector labels.Selector,
+	annotations fields.Annotations,
+	session pcstore.Session,
+) (fields.PodCluster, error) {
+	if az == s.failAZ {
+		return fields.PodCluster{}, util.Errorf("cannot create pod clusters in %s", az)
+	}
+	return s.FakePCStore.Create(podID, az, cn, podSelector, annotations, session)
+}
+
+func TestClusterGroupCreateRollsBack(t *testing.T) {
+	fakePCStore := pcstoretest.NewFake()
+	store := failingAZStore{FakePCStore: fakePCStore, failAZ: testAZs[2]}
+
+	group := NewClusterGroup("pod", "prod", testAZs, store, failingTxner{})
+	_, err := group.Create(nil, consultest.NewSession())
+	if err == nil {
+		t.Fatalf("Expected creation to fail in %s", testAZs[2])
+	}
+	all, _ := fakePCStore.List()
+	if len(all) != 0 {
+		t.Errorf("Expected failed creation to be rolled back, found %d pod clusters", len(all))
+	}
+}
+
+func TestClusterGroupPatchAnnotations(t *testing.T) {
+	group, _ := newTestClusterGroup(t)
+
+	pcs, err := group.PatchAnnotations(fields.Annotations{"slo_tier": "tier_1"})
+	if err != nil {
+		t.Fatalf("Unexpected error patching annotations: %s", err)
+	}
+	if len(pcs) != len(testAZs) {
+		t.Fatalf("Expected %d patched pod clusters, got %d", len(testAZs), len(pcs))
+	}
+
+	pcs, err = group.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for az, pc := range pcs {
+		if pc.Annotations["slo_tier"] != "tier_1" || pc.Annotations["deployer"] != "someone" {
+			t.Errorf("Expected patched annotations in %s, got %v", az, pc.Annotations)
+		}
+	}
+
+	_, err = group.UpdateAnnotations(fields.Annotations{"slo_tier": "tier_9"})
+	if err == nil {
+		t.Fatal("Expected invalid annotation update to fail")
+	}
+	pcs, err = group.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for az, pc := range pcs {
+		if pc.Annotations["slo_tier"] != "tier_1" {
+			t.Errorf("Expected annotations in %s to be unchanged, got %v", az, pc.Annotations)
+		}
+	}
+}
+
+func TestClusterGroupMembers(t *testing.T) {
+	group, _ := newTestClusterGroup(t)
+	applicator := p2labels.NewFakeApplicator()
+
+	for i, az := range testAZs[:2] {
+		podLabels := map[string]string{
+			fields.PodIDLabel:            "pod",
+			fields.AvailabilityZoneLabel: az.String(),
+			fields.ClusterNameLabel:      "prod",
+		}
+		node := types.NodeName([]string{"node1", "node2"}[i])
+		err := applicator.SetLabels(p2labels.POD, p2labels.MakePodLabelKey(node, "pod"), podLabels)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	members, err := group.Members(applicator)
+	if err != nil {
+		t.Fatalf("Unexpected error fetching members: %s", err)
+	}
+	if len(members["west"]) != 1 || members["west"][0].NodeName != "node1" {
+		t.Errorf("Expected node1 to be the only member in west, got %v", members["west"])
+	}
+	if len(members["east"]) != 1 || members["east"][0].NodeName != "node2" {
+		t.Errorf("Expected node2 to be the only member in east, got %v", members["east"])
+	}
+	if len(members["central"]) != 0 {
+		t.Errorf("Expected no members in central, got %v", members["central"])
+	}
+}
+
+func TestClusterGroupRolloutAnnotations(t *testing.T) {
+	group, _ := newTestClusterGroup(t)
+
+	var visited []fields.AvailabilityZone
+	patched, err := group.RolloutAnnotations(fields.Annotations{"slo_tier": "tier_2"}, func(az fields.AvailabilityZone, pc fields.PodCluster) error {
+		visited = append(visited, az)
+		if pc.Annotations["slo_tier"] != "tier_2" {
+			t.Errorf("Expected %s to be patched before the callback, got %v", az, pc.Annotations)
+		}
+		if az == "east" {
+			return util.Errorf("east is unhealthy")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Expected rollout to halt")
+	}
+	if len(patched) != 2 || patched[0] != "west" || patched[1] != "east" || len(visited) != 2 {
+		t.Fatalf("Expected rollout to patch west then east, patched %v", patched)
+	}
+
+	pcs, err := group.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pcs["central"].Annotations["slo_tier"]; ok {
+		t.Errorf("Expected central not to be patched after the rollout halted, got %v", pcs["central"].Annotations)
+	}
+	if pcs["west"].Annotations["slo_tier"] != "tier_2" {
+		t.Errorf("Expected west to stay patched, got %v", pcs["west"].Annotations)
+	}
+}
@@ -4,11 +4,14 @@ Package control wraps a pcstore with convenience functions suitable for operatio
 package control
 
 import (
+	"time"
+
+	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/pc/fields"
 	"github.com/square/p2/pkg/store/consul/pcstore"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
-	"k8s.io/kubernetes/pkg/labels"
+	klabels "k8s.io/kubernetes/pkg/labels"
 )
 
 type PodClusterStore interface {
@@ -23,7 +26,7 @@ type PodClusterStore interface {
 		podID types.PodID,
 		availabilityZone fields.AvailabilityZone,
 		clusterName fields.ClusterName,
-		podSelector labels.Selector,
+		podSelector klabels.Selector,
 		annotations fields.Annotations,
 		session pcstore.Session,
 	) (fields.PodCluster, error)
@@ -31,6 +34,37 @@ type PodClusterStore interface {
 		id fields.ID,
 		mutator func(fields.PodCluster) (fields.PodCluster, error),
 	) (fields.PodCluster, error)
+	GetWithIndex(id fields.ID) (fields.PodCluster, uint64, error)
+	CASPC(
+		id fields.ID,
+		modifyIndex uint64,
+		mutator func(fields.PodCluster) (fields.PodCluster, error),
+	) (fields.PodCluster, error)
+}
+
+// MembershipLabeler is the subset of the labels.Applicator interface needed
+// to evaluate a pod cluster's pod selector.
+type MembershipLabeler interface {
+	GetMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error)
+	WatchMatches(
+		selector klabels.Selector,
+		labelType labels.Type,
+		aggregationRate time.Duration,
+		quitCh <-chan struct{},
+	) (chan []labels.Labeled, error)
+}
+
+// Member is a single pod that is matched by a pod cluster's pod selector
+type Member struct {
+	NodeName types.NodeName
+	PodID    types.PodID
+	Labels   klabels.Set
+}
+
+// WatchedMembers is an Either type: it will have 1 one of members xor err
+type WatchedMembers struct {
+	Members []Member
+	Err     error
 }
 
 type PodCluster struct {
@@ -41,7 +75,7 @@ type PodCluster struct {
 	az       fields.AvailabilityZone
 	cn       fields.ClusterName
 	podID    types.PodID
-	selector labels.Selector
+	selector klabels.Selector
 }
 
 func NewPodCluster(
@@ -49,7 +83,7 @@ func NewPodCluster(
 	cn fields.ClusterName,
 	podID types.PodID,
 	pcstore PodClusterStore,
-	selector labels.Selector,
+	selector klabels.Selector,
 ) *PodCluster {
 
 	pc := &PodCluster{}
@@ -126,6 +160,143 @@ func (pccontrol *PodCluster) UpdateAnnotations(annotations fields.Annotations) (
 	return pccontrol.pcStore.MutatePC(pc.ID, annotationsUpdater)
 }
 
+// GetWithIndex is like Get but also returns the ModifyIndex of the pod
+// cluster, which can be passed to PatchAnnotationsCAS
+func (pccontrol *PodCluster) GetWithIndex() (fields.PodCluster, uint64, error) {
+	pc, err := pccontrol.getExactlyOne()
+	if err != nil {
+		return fields.PodCluster{}, 0, err
+	}
+	return pccontrol.pcStore.GetWithIndex(pc.ID)
+}
+
+// PatchAnnotations merges the passed annotations into the annotations on the
+// pod cluster configured for the pod cluster control structure. Keys in the
+// patch overwrite existing keys, keys with a nil value (JSON null) are
+// removed, and all other existing keys are left untouched.
+func (pccontrol *PodCluster) PatchAnnotations(patch fields.Annotations) (fields.PodCluster, error) {
+	pc, err := pccontrol.getExactlyOne()
+	if err != nil {
+		return fields.PodCluster{}, err
+	}
+
+	return pccontrol.pcStore.MutatePC(pc.ID, annotationsPatcher(patch))
+}
+
+// PatchAnnotationsCAS is like PatchAnnotations, but the patch is only applied
+// if the pod cluster's ModifyIndex still matches modifyIndex (as returned by
+// GetWithIndex). If the pod cluster was modified in the meantime a
+// pcstore.CASError is returned and the caller should re-read the pod cluster
+// before retrying.
+func (pccontrol *PodCluster) PatchAnnotationsCAS(patch fields.Annotations, modifyIndex uint64) (fields.PodCluster, error) {
+	pc, err := pccontrol.getExactlyOne()
+	if err != nil {
+		return fields.PodCluster{}, err
+	}
+
+	return pccontrol.pcStore.CASPC(pc.ID, modifyIndex, annotationsPatcher(patch))
+}
+
+func annotationsPatcher(patch fields.Annotations) func(fields.PodCluster) (fields.PodCluster, error) {
+	return func(pc fields.PodCluster) (fields.PodCluster, error) {
+		merged := make(fields.Annotations, len(pc.Annotations)+len(patch))
+		for k, v := range pc.Annotations {
+			merged[k] = v
+		}
+		for k, v := range patch {
+			if v == nil {
+				delete(merged, k)
+			} else {
+				merged[k] = v
+			}
+		}
+		pc.Annotations = merged
+		return pc, nil
+	}
+}
+
+// Members evaluates the pod selector of the pod cluster configured for the pod
+// cluster control structure against the label store and returns the pods that
+// currently belong to the pod cluster.
+func (pccontrol *PodCluster) Members(labeler MembershipLabeler) ([]Member, error) {
+	pc, err := pccontrol.getExactlyOne()
+	if err != nil {
+		return nil, err
+	}
+
+	labeled, err := labeler.GetMatches(pc.PodSelector, labels.POD)
+	if err != nil {
+		return nil, err
+	}
+
+	return membersFromLabeled(labeled)
+}
+
+// WatchMembers streams the membership of the pod cluster configured for the
+// pod cluster control structure. The pod selector is resolved once when the
+// watch is started, so a change to the pod cluster's selector requires a new
+// watch. The returned channel is closed when quit is closed or when the
+// underlying label watch terminates.
+func (pccontrol *PodCluster) WatchMembers(
+	labeler MembershipLabeler,
+	aggregationRate time.Duration,
+	quit <-chan struct{},
+) (<-chan WatchedMembers, error) {
+	pc, err := pccontrol.getExactlyOne()
+	if err != nil {
+		return nil, err
+	}
+
+	labeledCh, err := labeler.WatchMatches(pc.PodSelector, labels.POD, aggregationRate, quit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan WatchedMembers)
+	go func() {
+		defer close(out)
+		for {
+			var labeled []labels.Labeled
+			var ok bool
+			select {
+			case <-quit:
+				return
+			case labeled, ok = <-labeledCh:
+				if !ok {
+					return
+				}
+			}
+
+			var watched WatchedMembers
+			watched.Members, watched.Err = membersFromLabeled(labeled)
+
+			select {
+			case <-quit:
+				return
+			case out <- watched:
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func membersFromLabeled(labeled []labels.Labeled) ([]Member, error) {
+	members := make([]Member, 0, len(labeled))
+	for _, l := range labeled {
+		nodeName, podID, err := labels.NodeAndPodIDFromPodLabel(l)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, Member{
+			NodeName: nodeName,
+			PodID:    podID,
+			Labels:   l.Labels,
+		})
+	}
+	return members, nil
+}
+
 func (pccontrol *PodCluster) getExactlyOne() (fields.PodCluster, error) {
 	labeledPCs, err := pccontrol.All()
 	if err != nil {
@@ -3,7 +3,9 @@ package control
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
+	p2labels "github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/pc/fields"
 	"github.com/square/p2/pkg/store/consul/consultest"
 	"github.com/square/p2/pkg/store/consul/pcstore"
@@ -180,3 +182,191 @@ func TestPodClusterFromID(t *testing.T) {
 		t.Errorf("Expected to not find PC but found %v", notFoundPC)
 	}
 }
+
+func TestMembers(t *testing.T) {
+	testAZ := fields.AvailabilityZone("west-coast")
+	testCN := fields.ClusterName("test")
+	testPodID := types.PodID("pod")
+	selector := labels.Everything().
+		Add(fields.PodIDLabel, labels.EqualsOperator, []string{testPodID.String()}).
+		Add(fields.AvailabilityZoneLabel, labels.EqualsOperator, []string{testAZ.String()}).
+		Add(fields.ClusterNameLabel, labels.EqualsOperator, []string{testCN.String()})
+	session := consultest.NewSession()
+	fakePCStore := pcstoretest.NewFake()
+	applicator := p2labels.NewFakeApplicator()
+
+	pcController := NewPodCluster(testAZ, testCN, testPodID, fakePCStore, selector)
+	_, err := pcController.Create(fields.Annotations{}, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matchingLabels := map[string]string{
+		fields.PodIDLabel:            testPodID.String(),
+		fields.AvailabilityZoneLabel: testAZ.String(),
+		fields.ClusterNameLabel:      testCN.String(),
+	}
+	err = applicator.SetLabels(p2labels.POD, p2labels.MakePodLabelKey("node1", testPodID), matchingLabels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = applicator.SetLabels(p2labels.POD, p2labels.MakePodLabelKey("node2", "other_pod"), map[string]string{
+		fields.PodIDLabel: "other_pod",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	members, err := pcController.Members(applicator)
+	if err != nil {
+		t.Fatalf("Unexpected error fetching members: %s", err)
+	}
+
+	if len(members) != 1 {
+		t.Fatalf("Expected 1 member but got %d: %v", len(members), members)
+	}
+
+	if members[0].NodeName != "node1" {
+		t.Errorf("Expected member on node1 but got %s", members[0].NodeName)
+	}
+
+	if members[0].PodID != testPodID {
+		t.Errorf("Expected member with pod ID %s but got %s", testPodID, members[0].PodID)
+	}
+
+	if members[0].Labels[fields.ClusterNameLabel] != testCN.String() {
+		t.Errorf("Expected member labels to include %s=%s but got %v", fields.ClusterNameLabel, testCN, members[0].Labels)
+	}
+}
+
+func TestWatchMembers(t *testing.T) {
+	testAZ := fields.AvailabilityZone("west-coast")
+	testCN := fields.ClusterName("test")
+	testPodID := types.PodID("pod")
+	selector := labels.Everything().
+		Add(fields.PodIDLabel, labels.EqualsOperator, []string{testPodID.String()})
+	session := consultest.NewSession()
+	fakePCStore := pcstoretest.NewFake()
+	applicator := p2labels.NewFakeApplicator()
+
+	pcController := NewPodCluster(testAZ, testCN, testPodID, fakePCStore, selector)
+	_, err := pcController.Create(fields.Annotations{}, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quit := make(chan struct{})
+	defer close(quit)
+	watchCh, err := pcController.WatchMembers(applicator, 0, quit)
+	if err != nil {
+		t.Fatalf("Unexpected error starting members watch: %s", err)
+	}
+
+	err = applicator.SetLabel(p2labels.POD, p2labels.MakePodLabelKey("node1", testPodID), fields.PodIDLabel, testPodID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case <-timeout:
+			t.Fatal("Timed out waiting for node1 to appear in the members watch")
+		case watched, ok := <-watchCh:
+			if !ok {
+				t.Fatal("Members watch closed unexpectedly")
+			}
+			if watched.Err != nil {
+				t.Fatalf("Unexpected error from members watch: %s", watched.Err)
+			}
+			if len(watched.Members) == 1 && watched.Members[0].NodeName == "node1" {
+				return
+			}
+		}
+	}
+}
+
+func TestPatchAnnotations(t *testing.T) {
+	testAZ := fields.AvailabilityZone("west-coast")
+	testCN := fields.ClusterName("test")
+	testPodID := types.PodID("pod")
+	selector := labels.Everything().
+		Add(fields.PodIDLabel, labels.EqualsOperator, []string{testPodID.String()})
+	session := consultest.NewSession()
+	fakePCStore := pcstoretest.NewFake()
+
+	pcController := NewPodCluster(testAZ, testCN, testPodID, fakePCStore, selector)
+	_, err := pcController.Create(fields.Annotations{
+		"load_balancer_info": "totally",
+		"pager_information":  "555-111-2222",
+	}, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var patch fields.Annotations
+	err = json.Unmarshal([]byte(`{"pager_information": null, "priority": "1001"}`), &patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := pcController.PatchAnnotations(patch)
+	if err != nil {
+		t.Fatalf("Got error patching PC annotations: %v", err)
+	}
+
+	if pc.Annotations["load_balancer_info"] != "totally" {
+		t.Errorf("Expected untouched annotation to be preserved, got %v", pc.Annotations)
+	}
+
+	if _, ok := pc.Annotations["pager_information"]; ok {
+		t.Errorf("Expected null annotation to be removed, got %v", pc.Annotations)
+	}
+
+	if pc.Annotations["priority"] != "1001" {
+		t.Errorf("Expected new annotation to be added, got %v", pc.Annotations)
+	}
+}
+
+func TestPatchAnnotationsCAS(t *testing.T) {
+	testAZ := fields.AvailabilityZone("west-coast")
+	testCN := fields.ClusterName("test")
+	testPodID := types.PodID("pod")
+	selector := labels.Everything().
+		Add(fields.PodIDLabel, labels.EqualsOperator, []string{testPodID.String()})
+	session := consultest.NewSession()
+	fakePCStore := pcstoretest.NewFake()
+
+	pcController := NewPodCluster(testAZ, testCN, testPodID, fakePCStore, selector)
+	_, err := pcController.Create(fields.Annotations{}, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, index, err := pcController.GetWithIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := pcController.PatchAnnotationsCAS(fields.Annotations{"owner": "a"}, index)
+	if err != nil {
+		t.Fatalf("Expected CAS patch with current index to succeed: %v", err)
+	}
+	if pc.Annotations["owner"] != "a" {
+		t.Errorf("Expected owner annotation to be set, got %v", pc.Annotations)
+	}
+
+	// index is now stale
+	_, err = pcController.PatchAnnotationsCAS(fields.Annotations{"owner": "b"}, index)
+	if !pcstore.IsCASError(err) {
+		t.Fatalf("Expected a CAS error when patching with a stale index, got %v", err)
+	}
+
+	pc, err = pcController.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.Annotations["owner"] != "a" {
+		t.Errorf("Expected stale CAS patch to not be applied, got %v", pc.Annotations)
+	}
+}
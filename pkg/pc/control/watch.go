@@ -0,0 +1,150 @@
+package control
+
+import (
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// PodClusterWatcher is the subset of the pcstore interface needed to watch
+// pod clusters
+type PodClusterWatcher interface {
+	Watch(quit <-chan struct{}) <-chan pcstore.WatchedPodClusters
+}
+
+type PodClusterEventType string
+
+const (
+	PodClusterCreated PodClusterEventType = "created"
+	PodClusterUpdated PodClusterEventType = "updated"
+	PodClusterDeleted PodClusterEventType = "deleted"
+)
+
+// PodClusterEvent describes a single change to a watched pod cluster. For
+// updates Previous holds the pod cluster as it was before the change. For
+// deletions PodCluster holds the last observed value of the deleted cluster.
+type PodClusterEvent struct {
+	Type       PodClusterEventType
+	PodCluster fields.PodCluster
+	Previous   *fields.PodCluster
+}
+
+// WatchedPodClusterEvents is an Either type: it will have 1 one of events xor
+// err
+type WatchedPodClusterEvents struct {
+	Events []PodClusterEvent
+	Err    error
+}
+
+// WatchPodCluster streams changes to the pod clusters configured for the pod
+// cluster control structure (either by ID or by pod ID, availability zone and
+// cluster name). Clusters that already exist when the watch starts are
+// reported as created. Unlike the other methods on PodCluster, it is not an
+// error for there to be no matching pod cluster, which allows callers to wait
+// for one to be created. The returned channel is closed when quit is closed.
+func (pccontrol *PodCluster) WatchPodCluster(watcher PodClusterWatcher, quit <-chan struct{}) <-chan WatchedPodClusterEvents {
+	return watchPodClusterEvents(watcher, pccontrol.matches, quit)
+}
+
+// WatchPodClusters streams changes to every pod cluster whose pod cluster
+// labels (pod ID, availability zone and cluster name) match selector. Like
+// WatchPodCluster, clusters that already exist are reported as created, and
+// the returned channel is closed when quit is closed.
+func WatchPodClusters(watcher PodClusterWatcher, selector klabels.Selector, quit <-chan struct{}) <-chan WatchedPodClusterEvents {
+	return watchPodClusterEvents(watcher, func(pc fields.PodCluster) bool {
+		return selector.Matches(podClusterLabels(pc))
+	}, quit)
+}
+
+func (pccontrol *PodCluster) matches(pc fields.PodCluster) bool {
+	if pccontrol.ID != "" {
+		return pc.ID == pccontrol.ID
+	}
+	return pc.PodID == pccontrol.podID &&
+		pc.AvailabilityZone == pccontrol.az &&
+		pc.Name == pccontrol.cn
+}
+
+// podClusterLabels returns the labels that the pcstore applies to a pod
+// cluster
+func podClusterLabels(pc fields.PodCluster) klabels.Set {
+	return klabels.Set{
+		fields.PodIDLabel:            pc.PodID.String(),
+		fields.AvailabilityZoneLabel: pc.AvailabilityZone.String(),
+		fields.ClusterNameLabel:      pc.Name.String(),
+	}
+}
+
+func watchPodClusterEvents(watcher PodClusterWatcher, matches func(fields.PodCluster) bool, quit <-chan struct{}) <-chan WatchedPodClusterEvents {
+	watched := watcher.Watch(quit)
+	out := make(chan WatchedPodClusterEvents)
+
+	go func() {
+		defer close(out)
+		known := make(map[fields.ID]fields.PodCluster)
+		for {
+			var result pcstore.WatchedPodClusters
+			var ok bool
+			select {
+			case <-quit:
+				return
+			case result, ok = <-watched:
+				if !ok {
+					return
+				}
+			}
+
+			var events WatchedPodClusterEvents
+			if result.Err != nil {
+				events.Err = result.Err
+			} else {
+				events.Events = diffPodClusters(known, result.Clusters, matches)
+				if len(events.Events) == 0 {
+					continue
+				}
+			}
+
+			select {
+			case <-quit:
+				return
+			case out <- events:
+			}
+		}
+	}()
+
+	return out
+}
+
+// diffPodClusters compares the current set of pod clusters with the known
+// ones, returning the events that transform known into current. known is
+// updated in place.
+func diffPodClusters(known map[fields.ID]fields.PodCluster, current []*fields.PodCluster, matches func(fields.PodCluster) bool) []PodClusterEvent {
+	var events []PodClusterEvent
+	seen := make(map[fields.ID]bool)
+	for _, pc := range current {
+		if pc == nil || !matches(*pc) {
+			continue
+		}
+		seen[pc.ID] = true
+
+		previous, ok := known[pc.ID]
+		switch {
+		case !ok:
+			events = append(events, PodClusterEvent{Type: PodClusterCreated, PodCluster: *pc})
+		case !previous.Equals(pc):
+			prev := previous
+			events = append(events, PodClusterEvent{Type: PodClusterUpdated, PodCluster: *pc, Previous: &prev})
+		default:
+			continue
+		}
+		known[pc.ID] = *pc
+	}
+
+	for id, pc := range known {
+		if !seen[id] {
+			events = append(events, PodClusterEvent{Type: PodClusterDeleted, PodCluster: pc})
+			delete(known, id)
+		}
+	}
+	return events
+}
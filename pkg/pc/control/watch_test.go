@@ -0,0 +1,100 @@
+package control
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+type fakeWatcher struct {
+	results chan pcstore.WatchedPodClusters
+}
+
+func (f fakeWatcher) Watch(_ <-chan struct{}) <-chan pcstore.WatchedPodClusters {
+	return f.results
+}
+
+func nextEvents(t *testing.T, ch <-chan WatchedPodClusterEvents) WatchedPodClusterEvents {
+	select {
+	case events := <-ch:
+		return events
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for pod cluster events")
+	}
+	return WatchedPodClusterEvents{}
+}
+
+func TestWatchPodCluster(t *testing.T) {
+	watcher := fakeWatcher{results: make(chan pcstore.WatchedPodClusters)}
+	quit := make(chan struct{})
+	defer close(quit)
+
+	pcController := NewPodCluster("west", "prod", "pod", nil, labels.Everything())
+	eventsCh := pcController.WatchPodCluster(watcher, quit)
+
+	watched := &fields.PodCluster{ID: "abc", PodID: "pod", AvailabilityZone: "west", Name: "prod"}
+	other := &fields.PodCluster{ID: "def", PodID: "pod", AvailabilityZone: "east", Name: "prod"}
+
+	watcher.results <- pcstore.WatchedPodClusters{Clusters: []*fields.PodCluster{watched, other}}
+	events := nextEvents(t, eventsCh)
+	if len(events.Events) != 1 || events.Events[0].Type != PodClusterCreated || events.Events[0].PodCluster.ID != "abc" {
+		t.Fatalf("expected a single creation of the watched cluster, got %+v", events)
+	}
+
+	// An unchanged result doesn't produce events, so the annotation change
+	// below is the next thing received
+	watcher.results <- pcstore.WatchedPodClusters{Clusters: []*fields.PodCluster{watched, other}}
+
+	updated := *watched
+	updated.Annotations = fields.Annotations{"deployer": "someone"}
+	watcher.results <- pcstore.WatchedPodClusters{Clusters: []*fields.PodCluster{&updated, other}}
+	events = nextEvents(t, eventsCh)
+	if len(events.Events) != 1 || events.Events[0].Type != PodClusterUpdated {
+		t.Fatalf("expected a single update, got %+v", events)
+	}
+	if events.Events[0].Previous == nil || events.Events[0].Previous.Annotations != nil {
+		t.Errorf("expected update to carry the previous pod cluster, got %+v", events.Events[0].Previous)
+	}
+	if events.Events[0].PodCluster.Annotations["deployer"] != "someone" {
+		t.Errorf("expected update to carry the new annotations, got %+v", events.Events[0].PodCluster)
+	}
+
+	watcher.results <- pcstore.WatchedPodClusters{Clusters: []*fields.PodCluster{other}}
+	events = nextEvents(t, eventsCh)
+	if len(events.Events) != 1 || events.Events[0].Type != PodClusterDeleted || events.Events[0].PodCluster.ID != "abc" {
+		t.Fatalf("expected a single deletion of the watched cluster, got %+v", events)
+	}
+}
+
+func TestWatchPodClustersBySelector(t *testing.T) {
+	watcher := fakeWatcher{results: make(chan pcstore.WatchedPodClusters)}
+	quit := make(chan struct{})
+	defer close(quit)
+
+	selector := labels.Everything().Add(fields.AvailabilityZoneLabel, labels.EqualsOperator, []string{"west"})
+	eventsCh := WatchPodClusters(watcher, selector, quit)
+
+	west1 := &fields.PodCluster{ID: "a", PodID: "pod1", AvailabilityZone: "west", Name: "prod"}
+	west2 := &fields.PodCluster{ID: "b", PodID: "pod2", AvailabilityZone: "west", Name: "prod"}
+	east := &fields.PodCluster{ID: "c", PodID: "pod1", AvailabilityZone: "east", Name: "prod"}
+
+	watcher.results <- pcstore.WatchedPodClusters{Clusters: []*fields.PodCluster{west1, west2, east}}
+	events := nextEvents(t, eventsCh)
+	if len(events.Events) != 2 {
+		t.Fatalf("expected creation of both west clusters, got %+v", events)
+	}
+	for _, event := range events.Events {
+		if event.Type != PodClusterCreated || event.PodCluster.AvailabilityZone != "west" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+
+	watcher.results <- pcstore.WatchedPodClusters{Err: pcstore.NoPodCluster}
+	events = nextEvents(t, eventsCh)
+	if events.Err == nil {
+		t.Errorf("expected watch error to be passed through")
+	}
+}
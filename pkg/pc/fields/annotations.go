@@ -0,0 +1,231 @@
+package fields
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Well-known annotation keys. The values stored under these keys have a
+// registered schema and are validated whenever a pod cluster is created or
+// they are changed. Other keys remain free-form.
+//
+// Schemas are Go types that annotations are strictly decoded into rather than
+// JSON schema documents: no JSON schema implementation is vendored, and this
+// way the typed accessors and validation share a single definition.
+const (
+	LoadBalancerAnnotation = "load_balancer"
+	OwnerAnnotation        = "owner"
+	SLOTierAnnotation      = "slo_tier"
+)
+
+// LoadBalancerInfo describes the load balancer fronting a pod cluster.
+type LoadBalancerInfo struct {
+	Name            string `json:"name"`
+	Port            int    `json:"port"`
+	HealthCheckPath string `json:"health_check_path,omitempty"`
+}
+
+func (lb LoadBalancerInfo) Validate() error {
+	if lb.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if lb.Port <= 0 || lb.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", lb.Port)
+	}
+	return nil
+}
+
+// OwnerInfo identifies who is responsible for a pod cluster. For
+// compatibility with pod clusters that predate the schema, the owner
+// annotation may also be a plain string, which is taken to be the team.
+type OwnerInfo struct {
+	Team  string `json:"team"`
+	Pager string `json:"pager,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+func (o *OwnerInfo) UnmarshalJSON(b []byte) error {
+	var team string
+	if err := json.Unmarshal(b, &team); err == nil {
+		*o = OwnerInfo{Team: team}
+		return nil
+	}
+
+	// the decoder's DisallowUnknownFields does not carry over to a custom
+	// unmarshaler, so it is set again here
+	type ownerInfo OwnerInfo
+	var info ownerInfo
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&info); err != nil {
+		return err
+	}
+	*o = OwnerInfo(info)
+	return nil
+}
+
+func (o OwnerInfo) Validate() error {
+	if o.Team == "" {
+		return fmt.Errorf("team is required")
+	}
+	return nil
+}
+
+type SLOTier string
+
+const (
+	SLOTier1 SLOTier = "tier_1"
+	SLOTier2 SLOTier = "tier_2"
+	SLOTier3 SLOTier = "tier_3"
+)
+
+func (t SLOTier) Validate() error {
+	switch t {
+	case SLOTier1, SLOTier2, SLOTier3:
+		return nil
+	}
+	return fmt.Errorf("%q is not a valid SLO tier", string(t))
+}
+
+// AnnotationSchema describes the expected structure of the value stored under
+// an annotation key. New must return a pointer to a zero value that the
+// annotation is decoded into. Decoding fails on unknown fields, and if the
+// decoded value has a Validate() error method it is called as well.
+type AnnotationSchema struct {
+	New func() interface{}
+}
+
+type annotationValidator interface {
+	Validate() error
+}
+
+// AnnotationError is returned when an annotation does not match its
+// registered schema.
+type AnnotationError struct {
+	Key string
+	Err error
+}
+
+func (e AnnotationError) Error() string {
+	return fmt.Sprintf("invalid %q annotation: %s", e.Key, e.Err)
+}
+
+func IsAnnotationError(err error) bool {
+	_, ok := err.(AnnotationError)
+	return ok
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   = map[string]AnnotationSchema{
+		LoadBalancerAnnotation: {New: func() interface{} { return &LoadBalancerInfo{} }},
+		OwnerAnnotation:        {New: func() interface{} { return &OwnerInfo{} }},
+		SLOTierAnnotation:      {New: func() interface{} { return new(SLOTier) }},
+	}
+)
+
+// RegisterAnnotationSchema registers a schema for an org-specific annotation
+// key. It is meant to be called during program initialization, and returns
+// an error if the key already has a schema.
+func RegisterAnnotationSchema(key string, schema AnnotationSchema) error {
+	if schema.New == nil {
+		return fmt.Errorf("schema for annotation %q has no New function", key)
+	}
+
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	if _, ok := schemas[key]; ok {
+		return fmt.Errorf("a schema for annotation %q is already registered", key)
+	}
+	schemas[key] = schema
+	return nil
+}
+
+// Validate checks every annotation that has a registered schema, returning an
+// AnnotationError for the first (by key) that does not match.
+func (a Annotations) Validate() error {
+	return a.ValidateChanges(nil)
+}
+
+// ValidateChanges is like Validate, but only checks the annotations whose
+// values differ from those in old. Updates of a pod cluster use it so that a
+// value that was stored before its key's schema was registered does not
+// prevent changes to the pod cluster's other annotations.
+func (a Annotations) ValidateChanges(old Annotations) error {
+	keys := make([]string, 0, len(a))
+	for key, value := range a {
+		if oldValue, ok := old[key]; ok && reflect.DeepEqual(value, oldValue) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		schemasMu.RLock()
+		schema, ok := schemas[key]
+		schemasMu.RUnlock()
+		if !ok {
+			continue
+		}
+		if err := decodeAnnotation(a[key], schema.New()); err != nil {
+			return AnnotationError{Key: key, Err: err}
+		}
+	}
+	return nil
+}
+
+// Decode strictly decodes the annotation stored under key into out, which
+// must be a pointer. ok is false if the annotation is not set.
+func (a Annotations) Decode(key string, out interface{}) (ok bool, err error) {
+	value, ok := a[key]
+	if !ok {
+		return false, nil
+	}
+	if err := decodeAnnotation(value, out); err != nil {
+		return true, AnnotationError{Key: key, Err: err}
+	}
+	return true, nil
+}
+
+func (a Annotations) LoadBalancer() (LoadBalancerInfo, bool, error) {
+	var lb LoadBalancerInfo
+	ok, err := a.Decode(LoadBalancerAnnotation, &lb)
+	return lb, ok, err
+}
+
+func (a Annotations) Owner() (OwnerInfo, bool, error) {
+	var owner OwnerInfo
+	ok, err := a.Decode(OwnerAnnotation, &owner)
+	return owner, ok, err
+}
+
+func (a Annotations) SLOTier() (SLOTier, bool, error) {
+	var tier SLOTier
+	ok, err := a.Decode(SLOTierAnnotation, &tier)
+	return tier, ok, err
+}
+
+func decodeAnnotation(value interface{}, out interface{}) error {
+	// Annotations are held as generic JSON values, so round-trip them
+	// through JSON rather than walking the structure by hand
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		return err
+	}
+
+	if v, ok := out.(annotationValidator); ok {
+		return v.Validate()
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package fields
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTypedAnnotationAccessors(t *testing.T) {
+	// Round trip through JSON so the values look like they would coming
+	// out of the store
+	var annotations Annotations
+	err := json.Unmarshal([]byte(`{
+		"load_balancer": {"name": "lb1", "port": 443},
+		"owner": {"team": "deploys", "pager": "deploys-oncall"},
+		"slo_tier": "tier_1",
+		"freeform": {"anything": "goes"}
+	}`), &annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := annotations.Validate(); err != nil {
+		t.Fatalf("expected annotations to be valid: %s", err)
+	}
+
+	lb, ok, err := annotations.LoadBalancer()
+	if err != nil || !ok {
+		t.Fatalf("expected load balancer annotation, got ok=%t err=%v", ok, err)
+	}
+	if lb.Name != "lb1" || lb.Port != 443 {
+		t.Errorf("unexpected load balancer info: %+v", lb)
+	}
+
+	owner, ok, err := annotations.Owner()
+	if err != nil || !ok {
+		t.Fatalf("expected owner annotation, got ok=%t err=%v", ok, err)
+	}
+	if owner.Team != "deploys" || owner.Pager != "deploys-oncall" {
+		t.Errorf("unexpected owner info: %+v", owner)
+	}
+
+	tier, ok, err := annotations.SLOTier()
+	if err != nil || !ok {
+		t.Fatalf("expected slo tier annotation, got ok=%t err=%v", ok, err)
+	}
+	if tier != SLOTier1 {
+		t.Errorf("expected %s, got %s", SLOTier1, tier)
+	}
+
+	_, ok, err = Annotations{}.Owner()
+	if ok || err != nil {
+		t.Errorf("expected missing owner annotation to not be ok, got ok=%t err=%v", ok, err)
+	}
+
+	owner, ok, err = Annotations{OwnerAnnotation: "deploys"}.Owner()
+	if err != nil || !ok || owner.Team != "deploys" {
+		t.Errorf("expected a plain string owner to be the team, got %+v ok=%t err=%v", owner, ok, err)
+	}
+}
+
+func TestAnnotationValidationFailures(t *testing.T) {
+	invalid := []Annotations{
+		{LoadBalancerAnnotation: map[string]interface{}{"name": "lb1"}},
+		{LoadBalancerAnnotation: map[string]interface{}{"name": "lb1", "port": 80, "prot": "tcp"}},
+		{OwnerAnnotation: ""},
+		{OwnerAnnotation: map[string]interface{}{"pager": "deploys-oncall"}},
+		{OwnerAnnotation: map[string]interface{}{"team": "deploys", "pagr": "deploys-oncall"}},
+		{SLOTierAnnotation: "tier_9"},
+	}
+	for _, annotations := range invalid {
+		err := annotations.Validate()
+		if !IsAnnotationError(err) {
+			t.Errorf("expected an annotation error for %v, got %v", annotations, err)
+		}
+	}
+}
+
+func TestValidateChangesOnlyChecksChangedKeys(t *testing.T) {
+	old := Annotations{
+		SLOTierAnnotation: "platinum",
+		"freeform":        "value",
+	}
+
+	updated := Annotations{
+		SLOTierAnnotation: "platinum",
+		"freeform":        "other value",
+	}
+	if err := updated.ValidateChanges(old); err != nil {
+		t.Errorf("expected an unchanged invalid annotation to be ignored: %s", err)
+	}
+
+	updated[SLOTierAnnotation] = "gold"
+	if err := updated.ValidateChanges(old); !IsAnnotationError(err) {
+		t.Errorf("expected an annotation error for a changed slo tier, got %v", err)
+	}
+
+	added := Annotations{LoadBalancerAnnotation: map[string]interface{}{"name": "lb1"}}
+	if err := added.ValidateChanges(old); !IsAnnotationError(err) {
+		t.Errorf("expected an annotation error for an added load balancer, got %v", err)
+	}
+}
+
+type costCenter struct {
+	Code string `json:"code"`
+}
+
+func TestRegisterAnnotationSchema(t *testing.T) {
+	key := "test_cost_center"
+	err := RegisterAnnotationSchema(key, AnnotationSchema{
+		New: func() interface{} { return &costCenter{} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RegisterAnnotationSchema(key, AnnotationSchema{
+		New: func() interface{} { return &costCenter{} },
+	})
+	if err == nil {
+		t.Error("expected registering a duplicate schema to fail")
+	}
+
+	err = Annotations{key: map[string]interface{}{"code": "1234"}}.Validate()
+	if err != nil {
+		t.Errorf("expected valid cost center annotation: %s", err)
+	}
+
+	err = Annotations{key: map[string]interface{}{"cost": "1234"}}.Validate()
+	if !IsAnnotationError(err) {
+		t.Errorf("expected an annotation error for unknown field, got %v", err)
+	}
+}
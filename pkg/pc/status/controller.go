@@ -0,0 +1,195 @@
+/*
+Package status implements a controller that records the observed state of
+every pod cluster (how many pods it matches and how many of them are healthy)
+in the status tree, so that consumers of pod clusters such as load balancer
+provisioning tooling can act on actual state rather than just the declared
+pod selector.
+*/
+package status
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/pcstatus"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const SyncerType pcstore.ConcreteSyncerType = "pc_status_controller"
+
+// DefaultReconcileInterval is how often pod cluster status is recomputed when
+// pod cluster membership has not changed, so that health counts stay fresh
+const DefaultReconcileInterval = 30 * time.Second
+
+type PodClusterWatcher interface {
+	WatchAndSync(concrete pcstore.ConcreteSyncer, quit <-chan struct{}) error
+}
+
+type StatusStore interface {
+	Set(id fields.ID, status pcstatus.PodClusterStatus) error
+	List() (map[fields.ID]pcstatus.PodClusterStatus, error)
+	Delete(id fields.ID) error
+}
+
+// Subset of checker.ConsulHealthChecker
+type HealthChecker interface {
+	Service(serviceID string) (map[types.NodeName]health.Result, error)
+}
+
+type trackedCluster struct {
+	pc   fields.PodCluster
+	pods []labels.Labeled
+}
+
+// Controller is a pcstore.ConcreteSyncer that writes a
+// pcstatus.PodClusterStatus for every pod cluster.
+type Controller struct {
+	pcWatcher     PodClusterWatcher
+	statusStore   StatusStore
+	healthChecker HealthChecker
+	logger        logging.Logger
+
+	reconcileInterval time.Duration
+
+	// clusters holds the latest membership observed for each pod cluster
+	// so that health can be re-evaluated without a membership change
+	mu       sync.Mutex
+	clusters map[fields.ID]trackedCluster
+}
+
+var _ pcstore.ConcreteSyncer = &Controller{}
+
+func NewController(
+	pcWatcher PodClusterWatcher,
+	statusStore StatusStore,
+	healthChecker HealthChecker,
+	logger logging.Logger,
+	reconcileInterval time.Duration,
+) *Controller {
+	if reconcileInterval <= 0 {
+		reconcileInterval = DefaultReconcileInterval
+	}
+
+	return &Controller{
+		pcWatcher:         pcWatcher,
+		statusStore:       statusStore,
+		healthChecker:     healthChecker,
+		logger:            logger,
+		reconcileInterval: reconcileInterval,
+		clusters:          make(map[fields.ID]trackedCluster),
+	}
+}
+
+// Run blocks until quit is closed, keeping pod cluster statuses up to date.
+func (c *Controller) Run(quit <-chan struct{}) error {
+	go c.reconcileLoop(quit)
+	return c.pcWatcher.WatchAndSync(c, quit)
+}
+
+func (c *Controller) reconcileLoop(quit <-chan struct{}) {
+	ticker := time.NewTicker(c.reconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			clusters := make([]trackedCluster, 0, len(c.clusters))
+			for _, cluster := range c.clusters {
+				clusters = append(clusters, cluster)
+			}
+			c.mu.Unlock()
+
+			for _, cluster := range clusters {
+				err := c.reconcile(cluster.pc, cluster.pods)
+				if err != nil {
+					c.logger.WithErrorAndFields(err, logrus.Fields{
+						"pc_id": cluster.pc.ID,
+					}).Errorln("Could not reconcile pod cluster status")
+				}
+			}
+		}
+	}
+}
+
+func (c *Controller) SyncCluster(pc *fields.PodCluster, pods []labels.Labeled) error {
+	c.mu.Lock()
+	c.clusters[pc.ID] = trackedCluster{pc: *pc, pods: pods}
+	c.mu.Unlock()
+
+	return c.reconcile(*pc, pods)
+}
+
+func (c *Controller) DeleteCluster(id fields.ID) error {
+	// the lock is held across the delete so that a reconcile that read the
+	// cluster before it was deleted cannot write its status back afterwards
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clusters, id)
+
+	return c.statusStore.Delete(id)
+}
+
+func (c *Controller) GetInitialClusters() ([]fields.ID, error) {
+	statuses, err := c.statusStore.List()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]fields.ID, 0, len(statuses))
+	for id := range statuses {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (c *Controller) Type() pcstore.ConcreteSyncerType {
+	return SyncerType
+}
+
+func (c *Controller) reconcile(pc fields.PodCluster, pods []labels.Labeled) error {
+	status := pcstatus.PodClusterStatus{
+		MatchedNodes:  len(pods),
+		LastReconcile: time.Now(),
+	}
+
+	// the pod selector may match pods with different pod IDs, so fetch
+	// health once per pod ID
+	healthByPodID := make(map[types.PodID]map[types.NodeName]health.Result)
+	for _, pod := range pods {
+		node, podID, err := labels.NodeAndPodIDFromPodLabel(pod)
+		if err != nil {
+			return err
+		}
+
+		results, ok := healthByPodID[podID]
+		if !ok {
+			results, err = c.healthChecker.Service(podID.String())
+			if err != nil {
+				return util.Errorf("Could not fetch health for %s: %s", podID, err)
+			}
+			healthByPodID[podID] = results
+		}
+
+		if result, ok := results[node]; ok && result.Status == health.Passing {
+			status.HealthyNodes++
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.clusters[pc.ID]; !ok {
+		// the cluster was deleted while its health was being fetched
+		return nil
+	}
+	return c.statusStore.Set(pc.ID, status)
+}
@@ -0,0 +1,109 @@
+package status
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/pcstatus"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeHealthChecker map[types.PodID]map[types.NodeName]health.Result
+
+func (f fakeHealthChecker) Service(serviceID string) (map[types.NodeName]health.Result, error) {
+	return f[types.PodID(serviceID)], nil
+}
+
+func newTestController(checker HealthChecker) (*Controller, pcstatus.ConsulStore) {
+	statusStore := pcstatus.NewConsul(statusstoretest.NewFake(), pcstatus.StatusControllerNamespace)
+	return NewController(nil, statusStore, checker, logging.TestLogger(), 0), statusStore
+}
+
+func podLabel(node types.NodeName, podID types.PodID) labels.Labeled {
+	return labels.Labeled{
+		LabelType: labels.POD,
+		ID:        labels.MakePodLabelKey(node, podID),
+	}
+}
+
+func TestSyncClusterRecordsCounts(t *testing.T) {
+	checker := fakeHealthChecker{
+		"pod": {
+			"node1": {Status: health.Passing},
+			"node2": {Status: health.Critical},
+		},
+	}
+	controller, statusStore := newTestController(checker)
+
+	pc := &fields.PodCluster{ID: "pc_id", PodID: "pod"}
+	pods := []labels.Labeled{
+		podLabel("node1", "pod"),
+		podLabel("node2", "pod"),
+		podLabel("node3", "pod"),
+	}
+
+	err := controller.SyncCluster(pc, pods)
+	if err != nil {
+		t.Fatalf("Unexpected error syncing cluster: %s", err)
+	}
+
+	status, _, err := statusStore.Get(pc.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error getting status: %s", err)
+	}
+
+	if status.MatchedNodes != 3 {
+		t.Errorf("Expected 3 matched nodes but got %d", status.MatchedNodes)
+	}
+
+	if status.HealthyNodes != 1 {
+		t.Errorf("Expected 1 healthy node but got %d", status.HealthyNodes)
+	}
+
+	if status.LastReconcile.IsZero() {
+		t.Error("Expected last reconcile time to be set")
+	}
+}
+
+func TestDeleteClusterRemovesStatus(t *testing.T) {
+	controller, statusStore := newTestController(fakeHealthChecker{})
+
+	pc := &fields.PodCluster{ID: "pc_id", PodID: "pod"}
+	err := controller.SyncCluster(pc, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error syncing cluster: %s", err)
+	}
+
+	initial, err := controller.GetInitialClusters()
+	if err != nil {
+		t.Fatalf("Unexpected error getting initial clusters: %s", err)
+	}
+	if len(initial) != 1 || initial[0] != pc.ID {
+		t.Fatalf("Expected initial clusters to be [%s] but got %v", pc.ID, initial)
+	}
+
+	err = controller.DeleteCluster(pc.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error deleting cluster: %s", err)
+	}
+
+	_, _, err = statusStore.Get(pc.ID)
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("Expected status to be deleted but got %v", err)
+	}
+
+	// a reconcile that started before the delete must not recreate the status
+	err = controller.reconcile(*pc, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error reconciling deleted cluster: %s", err)
+	}
+	_, _, err = statusStore.Get(pc.ID)
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("Expected status of deleted cluster to not be recreated but got %v", err)
+	}
+}
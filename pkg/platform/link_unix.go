@@ -0,0 +1,40 @@
+// +build !windows
+
+package platform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/square/p2/pkg/user"
+	"github.com/square/p2/pkg/util"
+)
+
+// current links with symlinks, which are replaced by renaming a new symlink
+// over the old one so that link always points to one of the two
+type current struct{}
+
+func (current) ReplaceLink(target string, link string, owner string) error {
+	dir, err := ioutil.TempDir(filepath.Dir(link), filepath.Base(link))
+	if err != nil {
+		return util.Errorf("Couldn't create temporary directory for symlink: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	tempLinkPath := filepath.Join(dir, filepath.Base(link))
+	err = os.Symlink(target, tempLinkPath)
+	if err != nil {
+		return util.Errorf("Couldn't create symlink to %s: %s", target, err)
+	}
+
+	uid, gid, err := user.IDs(owner)
+	if err != nil {
+		return util.Errorf("Couldn't retrieve UID/GID for user %s: %s", owner, err)
+	}
+	err = os.Lchown(tempLinkPath, uid, gid)
+	if err != nil {
+		return util.Errorf("Couldn't lchown symlink to %s: %s", target, err)
+	}
+
+	return os.Rename(tempLinkPath, link)
+}
@@ -0,0 +1,27 @@
+package platform
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// current links with NTFS junctions, since creating symlinks needs a
+// privilege that services don't have by default. A junction can't be renamed
+// over another, so the old one is removed before the new one is created and
+// there is a moment when link doesn't exist. Junctions have no owner of their
+// own: access to the target is decided by its ACLs, so owner is not used.
+type current struct{}
+
+func (current) ReplaceLink(target string, link string, owner string) error {
+	err := os.Remove(link)
+	if err != nil && !os.IsNotExist(err) {
+		return util.Errorf("Couldn't remove the old junction %s: %s", link, err)
+	}
+	output, err := exec.Command("cmd", "/c", "mklink", "/J", link, target).CombinedOutput()
+	if err != nil {
+		return util.Errorf("Couldn't create junction to %s: %s, Output: %s", target, err, output)
+	}
+	return nil
+}
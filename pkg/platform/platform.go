@@ -0,0 +1,17 @@
+// Package platform hides the operating system specifics of installing and
+// switching between the versions of a launchable, so that the same launchables
+// can be managed by preparers on Linux, OS X and Windows. Each operating system
+// has its own Provider, and Current is the one for the operating system the
+// preparer was built for.
+package platform
+
+// Provider does what launchables need done differently on each operating
+// system
+type Provider interface {
+	// ReplaceLink makes link point to the directory target, replacing what
+	// link pointed to before, and gives link to the user owner
+	ReplaceLink(target string, link string, owner string) error
+}
+
+// Current is the Provider of the operating system the preparer was built for
+var Current Provider = current{}
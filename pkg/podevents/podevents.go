@@ -0,0 +1,87 @@
+// Package podevents describes the lifecycle transitions that the preparer
+// goes through with each pod, so that deploy tooling can follow a deploy's
+// progress without diffing the reality tree.
+package podevents
+
+import (
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/types"
+)
+
+type Type string
+
+const (
+	InstallStarted     Type = "install_started"
+	InstallSucceeded   Type = "install_succeeded"
+	InstallFailed      Type = "install_failed"
+	VerificationFailed Type = "verification_failed"
+	Halted             Type = "halted"
+	Launched           Type = "launched"
+	LaunchFailed       Type = "launch_failed"
+	Removed            Type = "removed"
+)
+
+// Event is one lifecycle transition of a pod on a node. SHA is that of the
+// manifest being deployed, or of the one being removed for Halted and Removed
+// events of a pod that was deleted from intent.
+type Event struct {
+	Node         types.NodeName     `json:"node"`
+	PodID        types.PodID        `json:"pod_id"`
+	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key,omitempty"`
+	Type         Type               `json:"type"`
+	SHA          string             `json:"sha,omitempty"`
+	Time         time.Time          `json:"time"`
+
+	// Set for the failure events
+	Error string `json:"error,omitempty"`
+}
+
+// subscriberBuffer is how many events a subscriber can fall behind by before
+// events are dropped for it
+const subscriberBuffer = 64
+
+// Broadcaster sends each published event to every subscriber. Publishing
+// never blocks: a subscriber that falls too far behind misses events, and can
+// catch up by listing them from the store.
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+func (b *Broadcaster) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of the events published from now on. Call the
+// returned function to unsubscribe, which closes the channel.
+func (b *Broadcaster) Subscribe() (<-chan Event, func()) {
+	subscriber := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[subscriber] = struct{}{}
+
+	var once sync.Once
+	return subscriber, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, subscriber)
+			close(subscriber)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package pods
+
+import (
+	"strings"
+
+	"github.com/square/p2/pkg/manifest"
+)
+
+// dockerSecurityOpts returns the --security-opt values that run a docker
+// container under confinement. Docker takes the parts of an SELinux context
+// as separate labels.
+func dockerSecurityOpts(confinement *manifest.ConfinementStanza) []string {
+	if !confinement.Confined() {
+		return nil
+	}
+	if confinement.AppArmorProfile != "" {
+		return []string{"apparmor=" + confinement.AppArmorProfile}
+	}
+
+	// the level may itself contain colons, e.g. "s0:c0,c1"
+	parts := strings.SplitN(confinement.SELinuxContext, ":", 4)
+	var opts []string
+	for i, label := range []string{"user", "role", "type", "level"} {
+		if i < len(parts) && parts[i] != "" {
+			opts = append(opts, "label="+label+":"+parts[i])
+		}
+	}
+	return opts
+}
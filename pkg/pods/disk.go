@@ -0,0 +1,155 @@
+package pods
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/square/p2/pkg/artifact"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/uri"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+	"github.com/square/p2/pkg/util/size"
+)
+
+var (
+	// ExtractedSizeFactor is how many times the size of an artifact it is
+	// assumed to take once extracted, when checking for disk space before
+	// installing it.
+	ExtractedSizeFactor = param.Float64("extracted_size_factor", 3)
+
+	// MinFreeDiskSpace is the disk space (e.g. "1G") that must remain free
+	// on the filesystem of the pod home after installing a pod's artifacts.
+	MinFreeDiskSpace = param.String("min_free_disk_space", "1G")
+)
+
+// InsufficientDiskSpaceError is returned by Install when the filesystem of the
+// pod home doesn't have room for the pod's artifacts.
+type InsufficientDiskSpaceError struct {
+	Path      string
+	Required  size.ByteCount
+	Available size.ByteCount
+}
+
+func (e InsufficientDiskSpaceError) Error() string {
+	return fmt.Sprintf("%s: installing requires %s of disk space but only %s is available", e.Path, e.Required, e.Available)
+}
+
+// DiskQuotaExceededError is returned by Install when installing the pod's
+// artifacts would make its home exceed the manifest's disk_quota.
+type DiskQuotaExceededError struct {
+	Path     string
+	Quota    size.ByteCount
+	Required size.ByteCount
+}
+
+func (e DiskQuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: installing requires %s of disk space, more than the pod's disk quota of %s", e.Path, e.Required, e.Quota)
+}
+
+// checkDiskSpace checks that the pod home's filesystem has room for the
+// artifacts of the launchables that aren't installed yet, and that they fit
+// in the manifest's disk quota. The space an artifact takes is estimated from
+// its size, which is taken from its stanza or asked of its server. Artifacts
+// of unknown size are not counted.
+func (pod *Pod) checkDiskSpace(manifest manifest.Manifest, artifactRegistry artifact.Registry) error {
+	var artifactsSize size.ByteCount
+	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
+		launchable, err := pod.getLaunchable(launchableID, stanza, manifest)
+		if err != nil {
+			return err
+		}
+		if _, ok := launchable.(launch.Installer); ok || launchable.Installed() {
+			continue
+		}
+		artifactSize, err := pod.artifactSize(artifactRegistry, launchableID, stanza)
+		if err != nil {
+			return err
+		}
+		artifactsSize += artifactSize
+	}
+	if artifactsSize == 0 {
+		return nil
+	}
+	required := size.ByteCount(float64(artifactsSize) * *ExtractedSizeFactor)
+
+	if quota := manifest.GetDiskQuota(); quota > 0 {
+		used, err := diskUsage(pod.home)
+		if err != nil {
+			return util.Errorf("Could not determine disk usage of %s: %s", pod.home, err)
+		}
+		if used+required > quota {
+			return DiskQuotaExceededError{
+				Path:     pod.home,
+				Quota:    quota,
+				Required: used + required,
+			}
+		}
+	}
+
+	minFree, err := size.Parse(*MinFreeDiskSpace)
+	if err != nil {
+		return util.Errorf("Unparseable value for min_free_disk_space %v, %v", *MinFreeDiskSpace, err)
+	}
+	available, err := availableDiskSpace(pod.home)
+	if err != nil {
+		return util.Errorf("Could not determine available disk space of %s: %s", pod.home, err)
+	}
+	if required+minFree > available {
+		return InsufficientDiskSpaceError{
+			Path:      pod.home,
+			Required:  required + minFree,
+			Available: available,
+		}
+	}
+	return nil
+}
+
+func (pod *Pod) artifactSize(artifactRegistry artifact.Registry, launchableID launch.LaunchableID, stanza launch.LaunchableStanza) (size.ByteCount, error) {
+	if stanza.ArtifactSize > 0 {
+		return stanza.ArtifactSize, nil
+	}
+	sizer, ok := pod.Fetcher.(uri.Sizer)
+	if !ok {
+		return 0, nil
+	}
+	location, _, err := artifactRegistry.LocationDataForLaunchable(pod.Id, launchableID, stanza)
+	if err != nil {
+		return 0, err
+	}
+	artifactSize, err := sizer.Size(location)
+	if err != nil || artifactSize < 0 {
+		// the download reports the error, if it fails too
+		return 0, nil
+	}
+	return size.ByteCount(artifactSize), nil
+}
+
+// availableDiskSpace returns the space available to unprivileged users on the
+// filesystem of path
+func availableDiskSpace(path string) (size.ByteCount, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return size.ByteCount(int64(stat.Bavail) * int64(stat.Bsize)), nil
+}
+
+// diskUsage returns the total size of the files under path
+func diskUsage(path string) (size.ByteCount, error) {
+	var total size.ByteCount
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += size.ByteCount(info.Size())
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,96 @@
+package pods
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// DrainGracePeriodSec is how long the drain step of a pod may take, in
+// seconds, if its manifest doesn't set a grace_period.
+var DrainGracePeriodSec = param.Int64("drain_grace_period_sec", 30)
+
+// drain runs the drain step of the manifest's stop sequence, if it has one.
+// Failures are only logged, so that a pod that can't drain is still stopped.
+func (pod *Pod) drain(manifest manifest.Manifest) {
+	drain := manifest.GetDrain()
+	if drain == nil || (drain.HTTPPath == "" && len(drain.Command) == 0) {
+		return
+	}
+
+	gracePeriod := time.Duration(*DrainGracePeriodSec) * time.Second
+	if drain.GracePeriod > 0 {
+		gracePeriod = drain.GracePeriod
+	}
+	logger := pod.logger.SubLogger(logrus.Fields{"grace_period": gracePeriod})
+	logger.NoFields().Infoln("Draining pod")
+
+	start := time.Now()
+	var err error
+	if drain.HTTPPath != "" {
+		err = drainHTTP(manifest, pod.statusPort(manifest), drain.HTTPPath, gracePeriod)
+	} else {
+		var out string
+		out, err = pod.runCommand(manifest, "drain", drain.Command, gracePeriod)
+		if err != nil {
+			err = util.Errorf("%s: %s", err, out)
+		}
+	}
+	if err != nil {
+		logger.WithError(err).Warnln("Could not drain pod, stopping it anyway")
+		return
+	}
+	logger.WithField("duration", time.Since(start)).Infoln("Drained pod")
+}
+
+// drainHTTP POSTs to path on the pod's status port. Certificates aren't
+// verified, since they won't be for localhost.
+func drainHTTP(manifest manifest.Manifest, port int, path string, timeout time.Duration) error {
+	scheme := "https"
+	if manifest.GetStatusHTTP() {
+		scheme = "http"
+	}
+	uri := fmt.Sprintf("%s://localhost:%d%s", scheme, port, path)
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Post(uri, "text/plain", nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return util.Errorf("%s returned %s", uri, resp.Status)
+	}
+	return nil
+}
+
+// stopTimeoutSV stops services with the manifest's term_timeout between
+// SIGTERM and SIGKILL instead of their launchable's restart_timeout.
+type stopTimeoutSV struct {
+	runit.SV
+	timeout time.Duration
+}
+
+func (sv stopTimeoutSV) Stop(service *runit.Service, _ time.Duration) (string, error) {
+	return sv.SV.Stop(service, sv.timeout)
+}
+
+// stopSV returns the SV to stop the manifest's services with.
+func (pod *Pod) stopSV(manifest manifest.Manifest) runit.SV {
+	drain := manifest.GetDrain()
+	if drain == nil || drain.TermTimeout == 0 {
+		return pod.SV
+	}
+	return stopTimeoutSV{SV: pod.SV, timeout: drain.TermTimeout}
+}
@@ -0,0 +1,50 @@
+package pods
+
+import (
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/p2exec"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// Placement looks up where a pod runs, for its environment. Either value may
+// be empty if it isn't known.
+type Placement interface {
+	PodPlacement(node types.NodeName, podID types.PodID) (availabilityZone string, clusterName string, err error)
+}
+
+// envFilter returns the filter of the variables that the processes of a pod
+// with the given environment stanza inherit
+func envFilter(environment *manifest.EnvironmentStanza) p2exec.EnvFilter {
+	if environment == nil {
+		return p2exec.EnvFilter{}
+	}
+	return p2exec.EnvFilter{
+		Clear: environment.Inherit == manifest.InheritNoneEnv,
+		Keep:  environment.Allow,
+		Unset: environment.Deny,
+	}
+}
+
+// writePlacementEnv exports the node that the pod runs on and, if Placement
+// is set, its availability zone and pod cluster to the pod's environment
+func (pod *Pod) writePlacementEnv(manifest manifest.Manifest, uid, gid int) error {
+	var availabilityZone, clusterName string
+	if pod.Placement != nil {
+		var err error
+		availabilityZone, clusterName, err = pod.Placement.PodPlacement(pod.node, manifest.ID())
+		if err != nil {
+			return util.Errorf("Could not determine the placement of pod %s: %s", manifest.ID(), err)
+		}
+	}
+
+	err := writeEnvFile(pod.EnvDir(), NodeNameEnvVar, pod.node.String(), uid, gid)
+	if err != nil {
+		return err
+	}
+	err = writeEnvFile(pod.EnvDir(), AvailabilityZoneEnvVar, availabilityZone, uid, gid)
+	if err != nil {
+		return err
+	}
+	return writeEnvFile(pod.EnvDir(), PodClusterNameEnvVar, clusterName, uid, gid)
+}
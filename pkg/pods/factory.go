@@ -44,6 +44,10 @@ type factory struct {
 
 	fetcher     uri.Fetcher
 	requireFile string
+
+	sv             runit.SV
+	serviceBuilder *runit.ServiceBuilder
+	unprivileged   bool
 }
 
 type hookFactory struct {
@@ -52,18 +56,37 @@ type hookFactory struct {
 }
 
 func NewFactory(podRoot string, node types.NodeName, fetcher uri.Fetcher, requireFile string) Factory {
+	return NewFactoryWithServices(podRoot, node, fetcher, requireFile, runit.DefaultSV, runit.DefaultBuilder)
+}
+
+// NewFactoryWithServices returns a Factory of pods whose launchables' services
+// are built by serviceBuilder and controlled by sv, rather than by runit's
+// defaults.
+func NewFactoryWithServices(podRoot string, node types.NodeName, fetcher uri.Fetcher, requireFile string, sv runit.SV, serviceBuilder *runit.ServiceBuilder) Factory {
 	if podRoot == "" {
 		podRoot = DefaultPath
 	}
 
 	return &factory{
-		podRoot:     podRoot,
-		node:        node,
-		fetcher:     fetcher,
-		requireFile: requireFile,
+		podRoot:        podRoot,
+		node:           node,
+		fetcher:        fetcher,
+		requireFile:    requireFile,
+		sv:             sv,
+		serviceBuilder: serviceBuilder,
 	}
 }
 
+// NewUnprivilegedFactory returns a Factory of pods that are installed and
+// launched by the user running it, without root: see Pod.Unprivileged. Their
+// services are built by serviceBuilder, usually a runit.UserBuilder for a
+// runsvdir run by the same user.
+func NewUnprivilegedFactory(podRoot string, node types.NodeName, fetcher uri.Fetcher, requireFile string, serviceBuilder *runit.ServiceBuilder) Factory {
+	f := NewFactoryWithServices(podRoot, node, fetcher, requireFile, runit.DefaultSV, serviceBuilder).(*factory)
+	f.unprivileged = true
+	return f
+}
+
 func NewHookFactory(hookRoot string, node types.NodeName) HookFactory {
 	if hookRoot == "" {
 		hookRoot = filepath.Join(DefaultPath, "hooks")
@@ -92,12 +115,26 @@ func (f *factory) NewUUIDPod(id types.PodID, uniqueKey types.PodUniqueKey) (*Pod
 		return nil, util.Errorf("uniqueKey cannot be empty")
 	}
 	home := filepath.Join(f.podRoot, computeUniqueName(id, uniqueKey))
-	return newPodWithHome(id, uniqueKey, home, f.node, f.requireFile), nil
+	return f.configure(newPodWithHome(id, uniqueKey, home, f.node, f.requireFile)), nil
 }
 
 func (f *factory) NewLegacyPod(id types.PodID) *Pod {
 	home := filepath.Join(f.podRoot, id.String())
-	return newPodWithHome(id, "", home, f.node, f.requireFile)
+	return f.configure(newPodWithHome(id, "", home, f.node, f.requireFile))
+}
+
+// configure applies the factory's services and fetcher to a new pod
+func (f *factory) configure(pod *Pod) *Pod {
+	pod.SV = f.sv
+	pod.ServiceBuilder = f.serviceBuilder
+	if f.unprivileged {
+		pod.Unprivileged = true
+		pod.LogExec = runit.UnprivilegedLogExec()
+	}
+	if f.fetcher != nil {
+		pod.Fetcher = f.fetcher
+	}
+	return pod
 }
 
 func (f *hookFactory) NewHookPod(id types.PodID) *Pod {
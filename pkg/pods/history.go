@@ -0,0 +1,242 @@
+package pods
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+)
+
+var (
+	// InstallRetention is the number of launched manifests of a pod whose
+	// installs are kept, including the current one, so that the pod can be
+	// rolled back to them without downloading their artifacts again. The
+	// installs of older manifests are removed when a pod is launched.
+	InstallRetention = param.Int("pod_install_retention", 3)
+)
+
+// NoPreviousManifest is returned by PreviousManifest when no manifest other
+// than the current one has been launched.
+var NoPreviousManifest error = noPreviousManifestError{}
+
+type noPreviousManifestError struct{}
+
+func (noPreviousManifestError) Error() string {
+	return "No previous manifest for this pod"
+}
+
+func (noPreviousManifestError) NotFound() bool {
+	return true
+}
+
+// manifestHistoryDir holds a copy of each of the pod's retained manifests,
+// named by their SHA and last modified when they were last launched.
+func (pod *Pod) manifestHistoryDir() string {
+	return filepath.Join(pod.home, "manifest_history")
+}
+
+func (pod *Pod) historyManifestPath(sha string) string {
+	return filepath.Join(pod.manifestHistoryDir(), sha+".yaml")
+}
+
+// ManifestHistory returns the retained manifests of the pod, most recently
+// launched first.
+func (pod *Pod) ManifestHistory() ([]manifest.Manifest, error) {
+	entries, err := ioutil.ReadDir(pod.manifestHistoryDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(installsByLaunch(entries)))
+
+	var history []manifest.Manifest
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".yaml") {
+			continue
+		}
+		historyManifest, err := manifest.FromPath(filepath.Join(pod.manifestHistoryDir(), entry.Name()))
+		if err != nil {
+			return nil, util.Errorf("Could not read manifest history of pod %s: %s", pod.Id, err)
+		}
+		history = append(history, historyManifest)
+	}
+	return history, nil
+}
+
+// PreviousManifest returns the most recently launched manifest of the pod
+// that differs from the current one.
+func (pod *Pod) PreviousManifest() (manifest.Manifest, error) {
+	currentSHA := ""
+	current, err := pod.CurrentManifest()
+	if err == nil {
+		currentSHA, err = current.SHA()
+		if err != nil {
+			return nil, err
+		}
+	} else if err != NoCurrentManifest {
+		return nil, err
+	}
+
+	history, err := pod.ManifestHistory()
+	if err != nil {
+		return nil, err
+	}
+	for _, historyManifest := range history {
+		sha, err := historyManifest.SHA()
+		if err != nil {
+			return nil, err
+		}
+		if sha != currentSHA {
+			return historyManifest, nil
+		}
+	}
+	return nil, NoPreviousManifest
+}
+
+// RollbackTo halts the current manifest of the pod and launches the retained
+// manifest with the given SHA in its place. The manifest's launchables must
+// still be installed, since nothing is downloaded; see InstallRetention. As
+// with Launch, the first return bool is false if any service failed to start.
+func (pod *Pod) RollbackTo(previousSHA string) (bool, error) {
+	previous, err := manifest.FromPath(pod.historyManifestPath(previousSHA))
+	if os.IsNotExist(err) {
+		return false, util.Errorf("Pod %s has no retained manifest with SHA %s", pod.Id, previousSHA)
+	} else if err != nil {
+		return false, err
+	}
+
+	launchables, err := pod.Launchables(previous)
+	if err != nil {
+		return false, err
+	}
+	for _, launchable := range launchables {
+		if !launchable.Installed() {
+			return false, util.Errorf("Cannot roll back pod %s to %s: launchable %s is no longer installed", pod.Id, previousSHA, launchable.ID())
+		}
+	}
+
+	err = pod.setupConfig(previous, launchables)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := pod.CurrentManifest()
+	if err == nil {
+		ok, err := pod.Halt(current)
+		if err != nil {
+			return false, err
+		} else if !ok {
+			pod.logInfo("Some services did not stop cleanly before rolling back")
+		}
+	} else if err != NoCurrentManifest {
+		return false, err
+	}
+
+	return pod.Launch(previous)
+}
+
+// recordManifest adds a launched manifest to the pod's history, and removes
+// the installs of the manifests that are no longer retained.
+func (pod *Pod) recordManifest(launched manifest.Manifest) error {
+	sha, err := launched.SHA()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(pod.manifestHistoryDir(), 0755)
+	if err != nil {
+		return util.Errorf("Could not create manifest history directory: %s", err)
+	}
+	f, err := os.OpenFile(pod.historyManifestPath(sha), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	err = launched.Write(f)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	// a manifest launched again is as recent as a new one
+	now := time.Now()
+	err = os.Chtimes(pod.historyManifestPath(sha), now, now)
+	if err != nil {
+		return err
+	}
+
+	return pod.pruneHistory()
+}
+
+// pruneHistory removes all but the InstallRetention most recently launched
+// manifests from the pod's history, along with the installs that only they
+// use.
+func (pod *Pod) pruneHistory() error {
+	history, err := pod.ManifestHistory()
+	if err != nil {
+		return err
+	}
+	retention := *InstallRetention
+	if retention < 1 {
+		retention = 1
+	}
+	if len(history) <= retention {
+		return nil
+	}
+
+	retainedDirs := make(map[string]bool)
+	for _, retained := range history[:retention] {
+		launchables, err := pod.Launchables(retained)
+		if err != nil {
+			return err
+		}
+		for _, launchable := range launchables {
+			retainedDirs[launchable.InstallDir()] = true
+		}
+	}
+
+	for _, expired := range history[retention:] {
+		launchables, err := pod.Launchables(expired)
+		if err != nil {
+			return err
+		}
+		for _, launchable := range launchables {
+			installDir := launchable.InstallDir()
+			if retainedDirs[installDir] || !strings.HasPrefix(installDir, pod.home+string(filepath.Separator)) {
+				continue
+			}
+			err = os.RemoveAll(installDir)
+			if err != nil {
+				return util.Errorf("Could not remove install %s: %s", installDir, err)
+			}
+		}
+
+		sha, err := expired.SHA()
+		if err != nil {
+			return err
+		}
+		err = os.Remove(pod.historyManifestPath(sha))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+type installsByLaunch []os.FileInfo
+
+func (in installsByLaunch) Less(i, j int) bool {
+	return in[i].ModTime().Before(in[j].ModTime())
+}
+
+func (in installsByLaunch) Swap(i, j int) {
+	in[i], in[j] = in[j], in[i]
+}
+
+func (in installsByLaunch) Len() int {
+	return len(in)
+}
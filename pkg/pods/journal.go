@@ -0,0 +1,168 @@
+package pods
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+// The install journal is a write-ahead record of the operation in progress on
+// a pod. Each step of an install or launch is journaled before it starts, and
+// the journal is cleared once the operation is done, so an entry found when
+// the preparer starts working on a pod means that a previous preparer stopped
+// in the middle of that step. See Recover.
+type JournalStep string
+
+const (
+	// A launchable's artifact is being downloaded and extracted into its
+	// install dir, or post-installed
+	JournalDownload JournalStep = "download"
+
+	// The current symlinks of the launchables, the pod's current manifest
+	// and its config are being switched to the new manifest
+	JournalSwitchSymlinks JournalStep = "switch_symlinks"
+
+	// The services of the new manifest are being written and started
+	JournalLaunch JournalStep = "launch"
+)
+
+type JournalEntry struct {
+	Step JournalStep `json:"step"`
+
+	// The manifest being installed or launched
+	SHA string `json:"sha"`
+
+	// Set for download steps
+	LaunchableID launch.LaunchableID `json:"launchable_id,omitempty"`
+	InstallDir   string              `json:"install_dir,omitempty"`
+
+	Started time.Time `json:"started"`
+}
+
+// Downloads are journaled apart from launches, so that installing a new
+// manifest doesn't lose track of a launch that was interrupted
+func (pod *Pod) journalPath(step JournalStep) string {
+	if step == JournalDownload {
+		return filepath.Join(pod.home, "install_journal.json")
+	}
+	return filepath.Join(pod.home, "launch_journal.json")
+}
+
+// journal records the step that an operation on manifest is about to take
+func (pod *Pod) journal(step JournalStep, manifest manifest.Manifest, launchable launch.Launchable) error {
+	sha, err := manifest.SHA()
+	if err != nil {
+		return err
+	}
+	entry := JournalEntry{
+		Step:    step,
+		SHA:     sha,
+		Started: time.Now(),
+	}
+	if launchable != nil {
+		entry.LaunchableID = launchable.ID()
+		entry.InstallDir = launchable.InstallDir()
+	}
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return util.Errorf("Could not marshal install journal: %s", err)
+	}
+
+	// written to a temporary file and renamed, so that a crash never leaves a
+	// torn entry
+	tmp, err := ioutil.TempFile(pod.home, ".journal")
+	if err != nil {
+		return util.Errorf("Could not write install journal: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(bytes)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return util.Errorf("Could not write install journal: %s", err)
+	}
+	err = os.Rename(tmp.Name(), pod.journalPath(step))
+	if err != nil {
+		return util.Errorf("Could not write install journal: %s", err)
+	}
+	return nil
+}
+
+// clearJournal records that the operation the step is part of is done
+func (pod *Pod) clearJournal(step JournalStep) error {
+	err := os.Remove(pod.journalPath(step))
+	if err != nil && !os.IsNotExist(err) {
+		return util.Errorf("Could not clear install journal: %s", err)
+	}
+	return nil
+}
+
+func (pod *Pod) readJournal(step JournalStep) (JournalEntry, bool, error) {
+	bytes, err := ioutil.ReadFile(pod.journalPath(step))
+	if os.IsNotExist(err) {
+		return JournalEntry{}, false, nil
+	} else if err != nil {
+		return JournalEntry{}, false, util.Errorf("Could not read install journal: %s", err)
+	}
+	var entry JournalEntry
+	err = json.Unmarshal(bytes, &entry)
+	if err != nil {
+		return JournalEntry{}, false, util.Errorf("Could not parse install journal %s: %s", pod.journalPath(step), err)
+	}
+	return entry, true, nil
+}
+
+// Recover cleans up after operations that were interrupted on the pod by a
+// restart. A partial install is removed, so that it is downloaded again
+// rather than taken for a complete one. An interrupted launch can't be
+// finished or undone without knowing which manifest should be running, so it
+// is returned, and kept in the journal until the caller launches the pod
+// again.
+func (pod *Pod) Recover() (JournalEntry, bool, error) {
+	install, interrupted, err := pod.readJournal(JournalDownload)
+	if err != nil {
+		return JournalEntry{}, false, err
+	}
+	if interrupted {
+		if !pod.isInstallDir(install.InstallDir, install.LaunchableID) {
+			return JournalEntry{}, false, util.Errorf("Install journal of pod %s names %q, which is not an install dir of launchable %s", pod.Id, install.InstallDir, install.LaunchableID)
+		}
+		pod.logger.WithField("install_dir", install.InstallDir).Warnln("Removing install that was interrupted by a restart")
+		err = os.RemoveAll(install.InstallDir)
+		if err != nil {
+			return JournalEntry{}, false, util.Errorf("Could not remove interrupted install %s: %s", install.InstallDir, err)
+		}
+		err = pod.clearJournal(JournalDownload)
+		if err != nil {
+			return JournalEntry{}, false, err
+		}
+	}
+
+	return pod.readJournal(JournalLaunch)
+}
+
+// isInstallDir returns whether dir is where the pod installs a version of the
+// launchable. The journal is in the pod's home, which the pod's user can
+// write to, so nothing else is removed on its say-so.
+func (pod *Pod) isInstallDir(dir string, launchableID launch.LaunchableID) bool {
+	id := launchableID.String()
+	if id == "" || id != filepath.Base(id) || id == ".." {
+		return false
+	}
+	name := filepath.Base(dir)
+	if name == ".." || name == "." || name == string(filepath.Separator) {
+		return false
+	}
+	return filepath.Clean(dir) == filepath.Join(pod.home, id, "installs", name)
+}
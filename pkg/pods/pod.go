@@ -8,12 +8,15 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/digest"
+	"github.com/square/p2/pkg/docker"
+	"github.com/square/p2/pkg/gzip"
 	"github.com/square/p2/pkg/hoist"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
@@ -21,11 +24,14 @@ import (
 	"github.com/square/p2/pkg/opencontainer"
 	"github.com/square/p2/pkg/p2exec"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/secrets"
+	"github.com/square/p2/pkg/tracing"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/user"
 	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/util/param"
+	"github.com/square/p2/pkg/util/redact"
 	"github.com/square/p2/pkg/util/size"
 
 	"github.com/Sirupsen/logrus"
@@ -39,16 +45,26 @@ var (
 	// NestedCgroups causes the p2-preparer to use a hierarchical cgroup naming scheme when
 	// creating new launchables.
 	NestedCgroups = param.Bool("nested_cgroups", false)
+
+	// PreflightTimeout is the maximum number of seconds a launchable's
+	// preflight script may run before it is killed and considered failed.
+	PreflightTimeout = param.Int64("preflight_timeout", 300)
 )
 
 const (
 	ConfigPathEnvVar         = "CONFIG_PATH"
+	CurrentConfigPathEnvVar  = "CURRENT_CONFIG_PATH"
 	LaunchableIDEnvVar       = "LAUNCHABLE_ID"
 	LaunchableRootEnvVar     = "LAUNCHABLE_ROOT"
 	PodIDEnvVar              = "POD_ID"
 	PodHomeEnvVar            = "POD_HOME"
 	PodUniqueKeyEnvVar       = "POD_UNIQUE_KEY"
 	PlatformConfigPathEnvVar = "PLATFORM_CONFIG_PATH"
+	SecretsDirEnvVar         = "SECRETS_DIR"
+	ConfigTemplatesDirEnvVar = "CONFIG_TEMPLATES_DIR"
+	NodeNameEnvVar           = "NODE_NAME"
+	AvailabilityZoneEnvVar   = "AVAILABILITY_ZONE"
+	PodClusterNameEnvVar     = "POD_CLUSTER_NAME"
 )
 
 type Pod struct {
@@ -75,9 +91,61 @@ type Pod struct {
 
 	// Pod will not start if file is not present
 	RequireFile string
+
+	// Unprivileged is set for pods installed and launched by a user without
+	// root. They must run as that user, and their launchables run without
+	// cgroups or raised rlimits, which p2-exec can't set up without root.
+	Unprivileged bool
+
+	// Redaction is applied, along with the manifest's own log_redaction, to
+	// launchable output before it is logged or returned. May be nil.
+	Redaction *redact.Filter
+
+	// ArtifactCache, if set, is the node's artifact cache, which artifacts
+	// are fetched through so that pods sharing an artifact download it once
+	ArtifactCache *artifact.Cache
+
+	// Extraction controls how strictly the artifacts of launchables are
+	// checked when they are extracted
+	Extraction gzip.Options
+
+	// Secrets, if set, is where the secrets referenced by the manifest are
+	// fetched from when the pod is installed
+	Secrets secrets.Source
+
+	// ClusterAnnotator, if set, provides the pod cluster annotations that
+	// config templates are rendered with
+	ClusterAnnotator ClusterAnnotator
+
+	// Placement, if set, provides the availability zone and pod cluster
+	// that are exported to the pod's environment
+	Placement Placement
+
+	// The ports allocated to the launchables of the manifest being installed
+	allocatedPorts map[launch.LaunchableID]int
+
+	// The span of the deploy of the manifest being installed. May be nil.
+	span *tracing.Span
+}
+
+// SetTraceSpan sets the span of the deploy that the manifest about to be
+// installed is part of. The install of each launchable is recorded under it.
+func (pod *Pod) SetTraceSpan(span *tracing.Span) {
+	pod.span = span
 }
 
-var NoCurrentManifest error = fmt.Errorf("No current manifest for this pod")
+var NoCurrentManifest error = noCurrentManifestError{}
+
+type noCurrentManifestError struct{}
+
+func (noCurrentManifestError) Error() string {
+	return "No current manifest for this pod"
+}
+
+// NotFound lets consulutil.IsNotFound recognize the error
+func (noCurrentManifestError) NotFound() bool {
+	return true
+}
 
 func (pod *Pod) Node() types.NodeName {
 	return pod.node
@@ -114,6 +182,7 @@ func (pod *Pod) Halt(manifest manifest.Manifest) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	launchables = haltOrder(launchables)
 
 	success := true
 	for _, launchable := range launchables {
@@ -127,8 +196,10 @@ func (pod *Pod) Halt(manifest manifest.Manifest) (bool, error) {
 			pod.logLaunchableWarning(launchable.ServiceID(), err, "Could not disable launchable")
 		}
 	}
+	pod.drain(manifest)
+	sv := pod.stopSV(manifest)
 	for _, launchable := range launchables {
-		err = launchable.Stop(runit.DefaultBuilder, runit.DefaultSV) // TODO: make these configurable
+		err = launchable.Stop(pod.ServiceBuilder, sv)
 		if err != nil {
 			pod.logLaunchableError(launchable.ServiceID(), err, "Could not stop launchable")
 			success = false
@@ -153,6 +224,10 @@ func (pod *Pod) Launch(manifest manifest.Manifest) (bool, error) {
 		return false, err
 	}
 
+	err = pod.journal(JournalSwitchSymlinks, manifest, nil)
+	if err != nil {
+		return false, err
+	}
 	oldManifestTemp, err := pod.WriteCurrentManifest(manifest)
 	defer os.RemoveAll(oldManifestTemp)
 
@@ -160,6 +235,12 @@ func (pod *Pod) Launch(manifest manifest.Manifest) (bool, error) {
 		return false, err
 	}
 
+	err = pod.linkCurrentConfig(manifest)
+	if err != nil {
+		return false, err
+	}
+
+	redaction := pod.RedactionFor(manifest)
 	for _, launchable := range launchables {
 		err := launchable.MakeCurrent()
 		if err != nil {
@@ -172,6 +253,7 @@ func (pod *Pod) Launch(manifest manifest.Manifest) (bool, error) {
 			out, err = launchable.PostActivate()
 		}
 		pod.withTimeWarnings("post-activate", launchable.ServiceID(), postActivateFunc)
+		out = redaction.Redact(out)
 		if err != nil {
 			// if a launchable's post-activate fails, we probably can't
 			// launch it, but this does not break the entire pod
@@ -183,6 +265,10 @@ func (pod *Pod) Launch(manifest manifest.Manifest) (bool, error) {
 		}
 	}
 
+	err = pod.journal(JournalLaunch, manifest, nil)
+	if err != nil {
+		return false, err
+	}
 	err = pod.buildRunitServices(launchables, manifest)
 	if err != nil {
 		pod.logger.WithError(err).Errorln("unable to write servicebuilder files for pod")
@@ -205,6 +291,17 @@ func (pod *Pod) Launch(manifest manifest.Manifest) (bool, error) {
 		}
 	}
 
+	err = pod.recordManifest(manifest)
+	if err != nil {
+		// the pod is running, it just may not be possible to roll back
+		pod.logError(err, "Could not record manifest history")
+	}
+	err = pod.clearJournal(JournalLaunch)
+	if err != nil {
+		// the pod will be launched again after a restart
+		pod.logError(err, "Could not clear install journal")
+	}
+
 	if success {
 		pod.logInfo("Successfully launched")
 	} else {
@@ -214,6 +311,130 @@ func (pod *Pod) Launch(manifest manifest.Manifest) (bool, error) {
 	return success, nil
 }
 
+// Reload makes the manifest current and sends its config_reload command to
+// every service in the pod, so that the services can pick up the new config
+// without being restarted. It must only be used when nothing but the config
+// changed, since the running services keep their code, environment and runit
+// setup. Errors signaling a service are logged and reported by the first
+// return bool, as with Launch.
+func (pod *Pod) Reload(manifest manifest.Manifest) (bool, error) {
+	command := manifest.GetConfigReload()
+	if command == "" {
+		return false, util.Errorf("Pod %s does not specify a config_reload command", manifest.ID())
+	}
+
+	launchables, err := pod.Launchables(manifest)
+	if err != nil {
+		return false, err
+	}
+
+	oldManifestTemp, err := pod.WriteCurrentManifest(manifest)
+	defer os.RemoveAll(oldManifestTemp)
+
+	if err != nil {
+		return false, err
+	}
+
+	err = pod.linkCurrentConfig(manifest)
+	if err != nil {
+		return false, err
+	}
+
+	success := pod.signalReload(launchables, command)
+	if success {
+		pod.logInfo("Successfully reloaded")
+	} else {
+		pod.logInfo("Reloaded pod but one or more services could not be signaled")
+	}
+
+	return success, nil
+}
+
+// MakeCurrent makes the manifest current and rewrites the pod's runit services
+// for it without restarting them, so the new version only runs once each
+// service next starts. The preparer uses it to replace itself, since it can't
+// halt its own service and then launch the new version.
+func (pod *Pod) MakeCurrent(manifest manifest.Manifest) error {
+	launchables, err := pod.Launchables(manifest)
+	if err != nil {
+		return err
+	}
+
+	err = pod.journal(JournalSwitchSymlinks, manifest, nil)
+	if err != nil {
+		return err
+	}
+	oldManifestTemp, err := pod.WriteCurrentManifest(manifest)
+	defer os.RemoveAll(oldManifestTemp)
+
+	if err != nil {
+		return err
+	}
+
+	err = pod.linkCurrentConfig(manifest)
+	if err != nil {
+		return err
+	}
+
+	for _, launchable := range launchables {
+		err = launchable.MakeCurrent()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = pod.journal(JournalLaunch, manifest, nil)
+	if err != nil {
+		return err
+	}
+	err = pod.buildRunitServices(launchables, manifest)
+	if err != nil {
+		return err
+	}
+
+	err = pod.recordManifest(manifest)
+	if err != nil {
+		pod.logError(err, "Could not record manifest history")
+	}
+	return pod.clearJournal(JournalLaunch)
+}
+
+// SignalReload sends the manifest's config_reload command to every service in
+// the pod without changing its current manifest, e.g. so that the services
+// reread secrets that were rotated. It returns false if any service could not
+// be signaled.
+func (pod *Pod) SignalReload(manifest manifest.Manifest) (bool, error) {
+	command := manifest.GetConfigReload()
+	if command == "" {
+		return false, util.Errorf("Pod %s does not specify a config_reload command", manifest.ID())
+	}
+	launchables, err := pod.Launchables(manifest)
+	if err != nil {
+		return false, err
+	}
+	return pod.signalReload(launchables, command), nil
+}
+
+func (pod *Pod) signalReload(launchables []launch.Launchable, command string) bool {
+	success := true
+	for _, launchable := range launchables {
+		executables, err := launchable.Executables(pod.ServiceBuilder)
+		if err != nil {
+			pod.logLaunchableError(launchable.ServiceID(), err, "Could not list executables to reload")
+			success = false
+			continue
+		}
+		for _, executable := range executables {
+			_, err = pod.SV.Signal(&executable.Service, command)
+			if err != nil {
+				pod.logLaunchableError(launchable.ServiceID(), err, "Could not signal service to reload")
+				success = false
+			}
+		}
+	}
+	return success
+}
+
 func (pod *Pod) Prune(max size.ByteCount, manifest manifest.Manifest) {
 	launchables, err := pod.Launchables(manifest)
 	if err != nil {
@@ -349,6 +570,49 @@ func (pod *Pod) currentPodManifestPath() string {
 	return filepath.Join(pod.home, "current_manifest.yaml")
 }
 
+// currentConfigPath is a symlink to the config file of the current manifest.
+// Unlike CONFIG_PATH, which names a file specific to one version of the
+// config, it stays the same across deploys, so services that are reloaded
+// rather than restarted can find the new config.
+func (pod *Pod) currentConfigPath() string {
+	return filepath.Join(pod.ConfigDir(), "current_config.yaml")
+}
+
+// linkCurrentConfig atomically points currentConfigPath at the config file
+// written by Install for the manifest.
+func (pod *Pod) linkCurrentConfig(manifest manifest.Manifest) error {
+	configFileName, err := manifest.ConfigFileName()
+	if err != nil {
+		return err
+	}
+	tempLink := pod.currentConfigPath() + ".tmp"
+	err = os.Remove(tempLink)
+	if err != nil && !os.IsNotExist(err) {
+		return util.Errorf("Could not remove stale config link for pod %s: %s", manifest.ID(), err)
+	}
+	err = os.Symlink(configFileName, tempLink)
+	if err != nil {
+		return util.Errorf("Could not link current config for pod %s: %s", manifest.ID(), err)
+	}
+	err = os.Rename(tempLink, pod.currentConfigPath())
+	if err != nil {
+		return util.Errorf("Could not link current config for pod %s: %s", manifest.ID(), err)
+	}
+	return nil
+}
+
+// RedactionFor combines the pod's redaction filter with the one configured in
+// the manifest. An invalid manifest filter is logged and ignored, since
+// ValidManifest rejects it before the pod is deployed.
+func (pod *Pod) RedactionFor(manifest manifest.Manifest) *redact.Filter {
+	manifestRedaction, err := redact.New(manifest.GetLogRedaction())
+	if err != nil {
+		pod.logError(err, "Invalid log_redaction in manifest, only applying the preparer's filters")
+		return pod.Redaction
+	}
+	return pod.Redaction.Merge(manifestRedaction)
+}
+
 func (pod *Pod) ConfigDir() string {
 	return filepath.Join(pod.home, "config")
 }
@@ -392,10 +656,32 @@ func (pod *Pod) Uninstall() error {
 	return nil
 }
 
+// RemoveInstalls removes the installed launchables of the manifest, so that
+// the next Install downloads and extracts them again. The pod's services
+// should be halted first.
+func (pod *Pod) RemoveInstalls(manifest manifest.Manifest) error {
+	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
+		launchable, err := pod.getLaunchable(launchableID, stanza, manifest)
+		if err != nil {
+			return err
+		}
+		err = os.RemoveAll(launchable.InstallDir())
+		if err != nil {
+			return util.Errorf("Could not remove the install of %s: %s", launchableID, err)
+		}
+	}
+	return nil
+}
+
 // Install will ensure that executables for all required services are present on the host
 // machine and are set up to run. In the case of Hoist artifacts (which is the only format
 // supported currently, this will set up runit services.).
 func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifier, artifactRegistry artifact.Registry) error {
+	err := pod.checkUnprivileged(manifest)
+	if err != nil {
+		return err
+	}
+
 	podHome := pod.home
 	uid, gid, err := user.IDs(manifest.RunAsUser())
 	if err != nil {
@@ -407,15 +693,20 @@ func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifi
 		return util.Errorf("Could not create pod home: %s", err)
 	}
 
+	err = pod.checkDiskSpace(manifest, artifactRegistry)
+	if err != nil {
+		pod.logError(err, "Unable to install pod")
+		return err
+	}
+
 	launchables, err := pod.Launchables(manifest)
 	if err != nil {
 		return err
 	}
 
-	downloader := artifact.NewLocationDownloader(pod.Fetcher, verifier)
 	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
 		// TODO: investigate passing in necessary fields to InstallDir()
-		launchable, err := pod.getLaunchable(launchableID, stanza, manifest.RunAsUser())
+		launchable, err := pod.getLaunchable(launchableID, stanza, manifest)
 		if err != nil {
 			pod.logLaunchableError(launchable.ServiceID(), err, "Unable to install launchable")
 			return err
@@ -425,23 +716,11 @@ func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifi
 			continue
 		}
 
-		launchableURL, verificationData, err := artifactRegistry.LocationDataForLaunchable(pod.Id, launchableID, stanza)
-		if err != nil {
-			pod.logLaunchableError(launchable.ServiceID(), err, "Unable to install launchable")
-			return err
-		}
-
-		err = downloader.Download(launchableURL, verificationData, launchable.InstallDir(), manifest.RunAsUser())
+		span := pod.span.Child("install_launchable")
+		span.SetAttribute("launchable_id", launchableID.String())
+		err = pod.installLaunchable(manifest, launchableID, stanza, launchable, verifier, artifactRegistry, span)
+		span.End(err)
 		if err != nil {
-			pod.logLaunchableError(launchable.ServiceID(), err, "Unable to install launchable")
-			_ = os.Remove(launchable.InstallDir())
-			return err
-		}
-
-		err = launchable.PostInstall()
-		if err != nil {
-			pod.logLaunchableError(launchable.ServiceID(), err, "Unable to install launchable")
-			_ = os.Remove(launchable.InstallDir())
 			return err
 		}
 	}
@@ -459,12 +738,112 @@ func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifi
 	return nil
 }
 
+// installLaunchable downloads or installs a launchable that isn't installed,
+// recording the steps under span
+func (pod *Pod) installLaunchable(
+	manifest manifest.Manifest,
+	launchableID launch.LaunchableID,
+	stanza launch.LaunchableStanza,
+	launchable launch.Launchable,
+	verifier auth.ArtifactVerifier,
+	artifactRegistry artifact.Registry,
+	span *tracing.Span,
+) error {
+	// If the install fails, the entry is kept so that Recover removes
+	// whatever was partially extracted
+	err := pod.journal(JournalDownload, manifest, launchable)
+	if err != nil {
+		return err
+	}
+	if installer, ok := launchable.(launch.Installer); ok {
+		err = installer.Install()
+	} else {
+		downloader := pod.downloader(verifier, span)
+		err = pod.downloadLaunchable(downloader, artifactRegistry, launchableID, stanza, launchable, manifest.RunAsUser())
+	}
+	if err != nil {
+		pod.logLaunchableError(launchable.ServiceID(), err, "Unable to install launchable")
+		_ = os.Remove(launchable.InstallDir())
+		return err
+	}
+
+	postInstall := span.Child("post_install")
+	err = launchable.PostInstall()
+	postInstall.End(err)
+	if err != nil {
+		pod.logLaunchableError(launchable.ServiceID(), err, "Unable to install launchable")
+		_ = os.Remove(launchable.InstallDir())
+		return err
+	}
+	return pod.clearJournal(JournalDownload)
+}
+
+// downloader returns a downloader that checks artifacts with verifier and
+// records its steps under span, which may be nil
+func (pod *Pod) downloader(verifier auth.ArtifactVerifier, span *tracing.Span) artifact.Downloader {
+	verifier = auth.NewTracingVerifier(verifier, span)
+	if pod.ArtifactCache != nil {
+		return artifact.NewCachingDownloader(pod.Fetcher, verifier, pod.ArtifactCache, pod.Extraction, span)
+	}
+	return artifact.NewLocationDownloader(pod.Fetcher, verifier, pod.Extraction, span)
+}
+
+func (pod *Pod) downloadLaunchable(
+	downloader artifact.Downloader,
+	artifactRegistry artifact.Registry,
+	launchableID launch.LaunchableID,
+	stanza launch.LaunchableStanza,
+	launchable launch.Launchable,
+	runAsUser string,
+) error {
+	launchableURL, verificationData, err := artifactRegistry.LocationDataForLaunchable(pod.Id, launchableID, stanza)
+	if err != nil {
+		return err
+	}
+	return downloader.Download(launchableURL, verificationData, launchable.InstallDir(), runAsUser)
+}
+
+// Preflight runs the preflight check of each of the manifest's launchables,
+// which must already be installed. It is meant to be called after Install
+// and before the currently running version of the pod is halted, so that a
+// version that can't run (e.g. because of a missing dependency) doesn't
+// replace one that can. The first failure is returned as a
+// launch.PreflightError.
+func (pod *Pod) Preflight(manifest manifest.Manifest) error {
+	launchables, err := pod.Launchables(manifest)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(*PreflightTimeout) * time.Second
+	redaction := pod.RedactionFor(manifest)
+	for _, launchable := range launchables {
+		var out string
+		preflightFunc := func() {
+			out, err = launchable.Preflight(timeout)
+		}
+		pod.withTimeWarnings("preflight", launchable.ServiceID(), preflightFunc)
+		if err != nil {
+			// the output is recorded in the pod's status in Consul
+			out = redaction.Redact(out)
+			pod.logLaunchableError(launchable.ServiceID(), err, out)
+			return launch.PreflightError{
+				LaunchableID: launchable.ID(),
+				Output:       out,
+				Inner:        err,
+			}
+		}
+	}
+
+	return nil
+}
+
 func (pod *Pod) Verify(manifest manifest.Manifest, authPolicy auth.Policy) error {
 	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
 		if stanza.DigestLocation == "" {
 			continue
 		}
-		launchable, err := pod.getLaunchable(launchableID, stanza, manifest.RunAsUser())
+		launchable, err := pod.getLaunchable(launchableID, stanza, manifest)
 		if err != nil {
 			return err
 		}
@@ -504,6 +883,65 @@ func (pod *Pod) Verify(manifest manifest.Manifest, authPolicy auth.Policy) error
 	return nil
 }
 
+// VerifyArtifacts fetches the artifact of each launchable in the manifest that
+// is not already installed and checks it with verifier, without installing
+// anything. The result for each launchable is keyed by launchable ID, with a
+// nil error if the artifact passed verification. Installed launchables are
+// skipped, since their artifacts were verified when they were installed.
+func (pod *Pod) VerifyArtifacts(manifest manifest.Manifest, verifier auth.ArtifactVerifier, artifactRegistry artifact.Registry) map[launch.LaunchableID]error {
+	results := make(map[launch.LaunchableID]error)
+	downloader := pod.downloader(verifier, nil)
+	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
+		launchable, err := pod.getLaunchable(launchableID, stanza, manifest)
+		if err != nil {
+			results[launchableID] = err
+			continue
+		}
+
+		if launchable.Installed() {
+			continue
+		}
+		if _, ok := launchable.(launch.Installer); ok {
+			// there is no artifact to fetch: the launchable is
+			// verified as it installs itself
+			continue
+		}
+
+		launchableURL, verificationData, err := artifactRegistry.LocationDataForLaunchable(pod.Id, launchableID, stanza)
+		if err != nil {
+			results[launchableID] = err
+			continue
+		}
+
+		results[launchableID] = downloader.Verify(launchableURL, verificationData)
+	}
+	return results
+}
+
+// ServiceStatus is the runit status of one of a pod's services. Err is set
+// instead if the status could not be read.
+type ServiceStatus struct {
+	Stat *runit.StatResult
+	Err  error
+}
+
+// ServiceStatuses reads the runit status of each service belonging to the
+// launchables in the manifest, keyed by service name.
+func (pod *Pod) ServiceStatuses(manifest manifest.Manifest) (map[string]ServiceStatus, error) {
+	services, err := pod.Services(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]ServiceStatus, len(services))
+	for _, service := range services {
+		service := service
+		stat, err := pod.SV.Stat(&service)
+		statuses[service.Name] = ServiceStatus{Stat: stat, Err: err}
+	}
+	return statuses, nil
+}
+
 // setupConfig does the following:
 //
 // 1) creates a directory in the pod's home directory called "config" which
@@ -521,6 +959,10 @@ func (pod *Pod) Verify(manifest manifest.Manifest, authPolicy auth.Policy) error
 // contains environment files specific to a launchable (such as
 // LAUNCHABLE_ROOT)
 //
+// 4) renders the manifest's config templates, see renderConfigTemplates
+//
+// 5) writes the secrets referenced by the manifest, see writeSecrets
+//
 // We may wish to provide a "config" directory per launchable at some point as
 // well, so that launchables can have different config namespaces
 func (pod *Pod) setupConfig(manifest manifest.Manifest, launchables []launch.Launchable) error {
@@ -570,6 +1012,10 @@ func (pod *Pod) setupConfig(manifest manifest.Manifest, launchables []launch.Lau
 	if err != nil {
 		return err
 	}
+	err = writeEnvFile(pod.EnvDir(), CurrentConfigPathEnvVar, pod.currentConfigPath(), uid, gid)
+	if err != nil {
+		return err
+	}
 	err = writeEnvFile(pod.EnvDir(), PlatformConfigPathEnvVar, platConfigPath, uid, gid)
 	if err != nil {
 		return err
@@ -586,6 +1032,10 @@ func (pod *Pod) setupConfig(manifest manifest.Manifest, launchables []launch.Lau
 	if err != nil {
 		return err
 	}
+	err = pod.writePlacementEnv(manifest, uid, gid)
+	if err != nil {
+		return err
+	}
 
 	for _, launchable := range launchables {
 		// we need to remove any unset env vars from a previous pod
@@ -615,7 +1065,18 @@ func (pod *Pod) setupConfig(manifest manifest.Manifest, launchables []launch.Lau
 		}
 	}
 
-	return nil
+	err = pod.writePorts(uid, gid)
+	if err != nil {
+		return err
+	}
+
+	err = pod.renderConfigTemplates(manifest, uid, gid)
+	if err != nil {
+		return err
+	}
+
+	_, err = pod.writeSecrets(manifest, uid, gid)
+	return err
 }
 
 // writeEnvFile takes an environment directory (as described in http://smarden.org/runit/chpst.8.html, with the -e option)
@@ -643,21 +1104,42 @@ func writeFileChown(filename string, data []byte, uid, gid int) error {
 	return file.Close()
 }
 
+// Launchables returns the manifest's launchables in the order they are
+// launched, which puts the pod's sidecar, if it has one, first so that it is
+// up for the main launchable.
 func (pod *Pod) Launchables(manifest manifest.Manifest) ([]launch.Launchable, error) {
 	launchableStanzas := manifest.GetLaunchableStanzas()
 	launchables := make([]launch.Launchable, 0, len(launchableStanzas))
 
+	var sidecarID launch.LaunchableID
+	if sidecar := manifest.GetSidecar(); sidecar != nil {
+		sidecarID = launch.LaunchableID(sidecar.Name)
+	}
 	for launchableID, launchableStanza := range launchableStanzas {
-		launchable, err := pod.getLaunchable(launchableID, launchableStanza, manifest.RunAsUser())
+		launchable, err := pod.getLaunchable(launchableID, launchableStanza, manifest)
 		if err != nil {
 			return nil, err
 		}
-		launchables = append(launchables, launchable)
+		if launchableID == sidecarID {
+			launchables = append([]launch.Launchable{launchable}, launchables...)
+		} else {
+			launchables = append(launchables, launchable)
+		}
 	}
 
 	return launchables, nil
 }
 
+// haltOrder returns launchables in the reverse of their launch order, so that
+// a sidecar is halted after the main launchable that uses it
+func haltOrder(launchables []launch.Launchable) []launch.Launchable {
+	reversed := make([]launch.Launchable, 0, len(launchables))
+	for i := len(launchables) - 1; i >= 0; i-- {
+		reversed = append(reversed, launchables[i])
+	}
+	return reversed
+}
+
 func (pod *Pod) SetFinishExec(finishExec []string) {
 	pod.FinishExec = finishExec
 }
@@ -665,7 +1147,7 @@ func (pod *Pod) SetFinishExec(finishExec []string) {
 func (pod *Pod) FinishExecForExecutable(launchable launch.Launchable, executable launch.Executable) runit.Exec {
 	p2ExecArgs := p2exec.P2ExecArgs{
 		Command:  pod.FinishExec,
-		User:     "nobody",
+		User:     pod.helperUser(),
 		EnvDirs:  []string{pod.EnvDir(), launchable.EnvDir()},
 		ExtraEnv: map[string]string{launch.EntryPointEnvVar: executable.RelativePath},
 	}
@@ -676,14 +1158,18 @@ func (pod *Pod) FinishExecForExecutable(launchable launch.Launchable, executable
 func (pod *Pod) SetLogBridgeExec(logExec []string) {
 	p2ExecArgs := p2exec.P2ExecArgs{
 		Command: logExec,
-		User:    "nobody",
+		User:    pod.helperUser(),
 		EnvDirs: []string{pod.EnvDir()},
 	}
 
 	pod.LogExec = append([]string{pod.P2Exec}, p2ExecArgs.CommandLine()...)
 }
 
-func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza launch.LaunchableStanza, runAsUser string) (launch.Launchable, error) {
+// getLaunchable returns the launchable of one of the stanzas of podManifest,
+// which runs as the manifest's user, in its confinement and environment
+func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza launch.LaunchableStanza, podManifest manifest.Manifest) (launch.Launchable, error) {
+	runAsUser := podManifest.RunAsUser()
+	confinement := podManifest.GetConfinement()
 	launchableRootDir := filepath.Join(pod.home, launchableID.String())
 	serviceId := strings.Join(
 		[]string{
@@ -703,6 +1189,15 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 		}
 	}
 
+	env := launchableStanza.Env
+	if port, ok := pod.ports()[launchableID]; ok {
+		env = make(map[string]string, len(launchableStanza.Env)+1)
+		for name, value := range launchableStanza.Env {
+			env[name] = value
+		}
+		env[launch.PortEnvVar] = strconv.Itoa(port)
+	}
+
 	version, err := launchableStanza.LaunchableVersion()
 	if err != nil {
 		pod.logger.WithError(err).Warnf("Could not parse version from launchable %s.", launchableID)
@@ -724,6 +1219,11 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 				launchableID.String(),
 			)
 		}
+		cgroupConfigName := launchableID.String()
+		if pod.Unprivileged {
+			cgroupName = ""
+			cgroupConfigName = ""
+		}
 
 		entryPoints := hoist.EntryPoints{
 			Paths:    entryPointPaths,
@@ -738,20 +1238,30 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 			PodEnvDir:        pod.EnvDir(),
 			RootDir:          launchableRootDir,
 			P2Exec:           pod.P2Exec,
-			ExecNoLimit:      true,
+			ExecNoLimit:      !pod.Unprivileged,
 			RestartTimeout:   restartTimeout,
 			RestartPolicy_:   launchableStanza.RestartPolicy(),
 			CgroupConfig:     launchableStanza.CgroupConfig,
-			CgroupConfigName: launchableID.String(),
+			CgroupConfigName: cgroupConfigName,
 			CgroupName:       cgroupName,
-			SuppliedEnvVars:  launchableStanza.Env,
+			SuppliedEnvVars:  env,
 			EntryPoints:      entryPoints,
 			IsUUIDPod:        pod.uniqueKey != "",
 			RequireFile:      pod.RequireFile,
 		}
+		if confinement != nil {
+			ret.SELinuxContext = confinement.SELinuxContext
+			ret.AppArmorProfile = confinement.AppArmorProfile
+		}
+		ret.EnvFilter = envFilter(podManifest.GetEnvironment())
 		ret.CgroupConfig.Name = ret.ServiceId
 		return ret.If(), nil
 	} else if *ExperimentalOpencontainer && launchableStanza.LaunchableType == "opencontainer" {
+		if confinement.Confined() {
+			err := util.Errorf("confinement is not supported for opencontainer launchables")
+			pod.logLaunchableError(launchableID.String(), err, "Unsupported confinement")
+			return nil, err
+		}
 		ret := &opencontainer.Launchable{
 			ID_:             launchableID,
 			ServiceID_:      serviceId,
@@ -761,7 +1271,23 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 			RestartTimeout:  restartTimeout,
 			RestartPolicy_:  launchableStanza.RestartPolicy(),
 			CgroupConfig:    launchableStanza.CgroupConfig,
-			SuppliedEnvVars: launchableStanza.Env,
+			SuppliedEnvVars: env,
+		}
+		ret.CgroupConfig.Name = serviceId
+		return ret, nil
+	} else if launchableStanza.LaunchableType == "docker" {
+		ret := &docker.Launchable{
+			Image:           launchableStanza.Image,
+			SecurityOpts:    dockerSecurityOpts(confinement),
+			ID_:             launchableID,
+			ServiceID_:      serviceId,
+			RunAs:           runAsUser,
+			RootDir:         launchableRootDir,
+			P2Exec:          pod.P2Exec,
+			RestartTimeout:  restartTimeout,
+			RestartPolicy_:  launchableStanza.RestartPolicy(),
+			CgroupConfig:    launchableStanza.CgroupConfig,
+			SuppliedEnvVars: env,
 		}
 		ret.CgroupConfig.Name = serviceId
 		return ret, nil
@@ -777,6 +1303,7 @@ func (pod *Pod) disableAndHaltLaunchables(currentManifest manifest.Manifest) err
 	if err != nil {
 		return err
 	}
+	launchables = haltOrder(launchables)
 
 	// halt launchables
 	for _, launchable := range launchables {
@@ -789,9 +1316,12 @@ func (pod *Pod) disableAndHaltLaunchables(currentManifest manifest.Manifest) err
 		}
 	}
 
+	pod.drain(currentManifest)
+	sv := pod.stopSV(currentManifest)
+
 	// halt launchables
 	for _, launchable := range launchables {
-		err = launchable.Stop(runit.DefaultBuilder, runit.DefaultSV) // TODO: make these configurable
+		err = launchable.Stop(pod.ServiceBuilder, sv)
 		if err != nil {
 			pod.logLaunchableWarning(launchable.ServiceID(), err, "Could not stop launchable during uninstallation")
 		}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -11,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/auth"
@@ -20,8 +23,11 @@ import (
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/osversion"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/secrets"
+	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
 	"gopkg.in/yaml.v2"
 
 	"github.com/Sirupsen/logrus"
@@ -51,12 +57,19 @@ func getLaunchableStanzasFromTestManifest(t *testing.T) map[launch.LaunchableID]
 	return getTestPodManifest(t).GetLaunchableStanzas()
 }
 
+// getFooUserManifest returns the test manifest, run as foouser
+func getFooUserManifest(t *testing.T) manifest.Manifest {
+	builder := getTestPodManifest(t).GetBuilder()
+	builder.SetRunAsUser("foouser")
+	return builder.GetManifest()
+}
+
 func TestGetLaunchable(t *testing.T) {
 	launchableStanzas := getLaunchableStanzasFromTestManifest(t)
 	pod := getTestPod()
 	Assert(t).AreNotEqual(0, len(launchableStanzas), "Expected there to be at least one launchable stanza in the test manifest")
 	for launchableID, stanza := range launchableStanzas {
-		l, _ := pod.getLaunchable(launchableID, stanza, "foouser")
+		l, _ := pod.getLaunchable(launchableID, stanza, getFooUserManifest(t))
 		launchable := l.(hoist.LaunchAdapter).Launchable
 		if launchable.Id != "app" {
 			t.Errorf("Launchable Id did not have expected value: wanted '%s' was '%s'", "app", launchable.Id)
@@ -79,7 +92,7 @@ func TestGetLaunchableNoVersion(t *testing.T) {
 		LaunchableType: "hoist",
 	}
 	pod := getTestPod()
-	l, _ := pod.getLaunchable("somelaunchable", launchableStanza, "foouser")
+	l, _ := pod.getLaunchable("somelaunchable", launchableStanza, getFooUserManifest(t))
 	launchable := l.(hoist.LaunchAdapter).Launchable
 
 	if launchable.Id != "somelaunchable" {
@@ -95,6 +108,65 @@ func TestGetLaunchableNoVersion(t *testing.T) {
 	Assert(t).AreEqual(launchable.RestartPolicy(), runit.RestartPolicyAlways, "Default RestartPolicy for a launchable should be 'always'")
 }
 
+func TestUnprivilegedPodLaunchablesRunWithoutCgroupsOrLimits(t *testing.T) {
+	launchableStanzas := getLaunchableStanzasFromTestManifest(t)
+	pod := getTestPod()
+	pod.Unprivileged = true
+	for launchableID, stanza := range launchableStanzas {
+		l, _ := pod.getLaunchable(launchableID, stanza, getFooUserManifest(t))
+		launchable := l.(hoist.LaunchAdapter).Launchable
+		Assert(t).IsFalse(launchable.ExecNoLimit, "unprivileged launchables can't raise their rlimits")
+		Assert(t).AreEqual(launchable.CgroupConfigName, "", "unprivileged launchables can't enter cgroups")
+		Assert(t).AreEqual(launchable.CgroupName, "", "unprivileged launchables can't enter cgroups")
+	}
+
+	builder := getTestPodManifest(t).GetBuilder()
+	builder.SetRunAsUser("root")
+	if os.Getuid() == 0 {
+		builder.SetRunAsUser("nobody")
+	}
+	err := pod.checkUnprivileged(builder.GetManifest())
+	Assert(t).IsNotNil(err, "unprivileged pods can't run as another user")
+}
+
+func TestGetLaunchableAppliesConfinement(t *testing.T) {
+	launchableStanzas := getLaunchableStanzasFromTestManifest(t)
+	pod := getTestPod()
+	builder := getFooUserManifest(t).GetBuilder()
+	builder.SetConfinement(&manifest.ConfinementStanza{AppArmorProfile: "p2-pod"})
+	for launchableID, stanza := range launchableStanzas {
+		l, _ := pod.getLaunchable(launchableID, stanza, builder.GetManifest())
+		launchable := l.(hoist.LaunchAdapter).Launchable
+		Assert(t).AreEqual(launchable.AppArmorProfile, "p2-pod", "should have run the launchable under the AppArmor profile")
+	}
+
+	opts := dockerSecurityOpts(&manifest.ConfinementStanza{SELinuxContext: "system_u:system_r:p2_pod_t:s0:c1,c2"})
+	Assert(t).AreEqual(
+		strings.Join(opts, " "),
+		"label=user:system_u label=role:system_r label=type:p2_pod_t label=level:s0:c1,c2",
+		"should have split the SELinux context into docker labels",
+	)
+}
+
+func TestGetLaunchableFiltersEnvironment(t *testing.T) {
+	launchableStanzas := getLaunchableStanzasFromTestManifest(t)
+	pod := getTestPod()
+	builder := getFooUserManifest(t).GetBuilder()
+	builder.SetEnvironment(&manifest.EnvironmentStanza{Inherit: manifest.InheritNoneEnv, Allow: []string{"PATH"}})
+	for launchableID, stanza := range launchableStanzas {
+		l, _ := pod.getLaunchable(launchableID, stanza, builder.GetManifest())
+		launchable := l.(hoist.LaunchAdapter).Launchable
+		Assert(t).IsTrue(launchable.EnvFilter.Clear, "should have cleared the inherited environment")
+		Assert(t).AreEqual(strings.Join(launchable.EnvFilter.Keep, " "), "PATH", "should have kept the allowed variables")
+	}
+}
+
+type fakePlacement struct{}
+
+func (fakePlacement) PodPlacement(node types.NodeName, podID types.PodID) (string, string, error) {
+	return "us-east-1a", "blue", nil
+}
+
 func TestPodCanWriteEnvFile(t *testing.T) {
 	envDir, err := ioutil.TempDir("", "envdir")
 	Assert(t).IsNil(err, "Should not have been an error writing the env dir")
@@ -143,10 +215,11 @@ config:
 
 	podFactory := NewFactory(podTemp, "testNode", uri.DefaultFetcher, "")
 	pod := podFactory.NewLegacyPod(manifest.ID())
+	pod.Placement = fakePlacement{}
 
 	launchables := make([]launch.Launchable, 0)
 	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
-		launchable, err := pod.getLaunchable(launchableID, stanza, manifest.RunAsUser())
+		launchable, err := pod.getLaunchable(launchableID, stanza, manifest)
 		Assert(t).IsNil(err, "There shouldn't have been an error getting launchable")
 		launchables = append(launchables, launchable)
 	}
@@ -166,6 +239,20 @@ config:
 	Assert(t).IsNil(err, "should not have erred reading the env file")
 	Assert(t).AreEqual(configPath, string(env), "The env path to config didn't match")
 
+	for name, expected := range map[string]string{NodeNameEnvVar: "testNode", AvailabilityZoneEnvVar: "us-east-1a", PodClusterNameEnvVar: "blue"} {
+		value, err := ioutil.ReadFile(filepath.Join(pod.EnvDir(), name))
+		Assert(t).IsNil(err, "should not have erred reading the placement env file")
+		Assert(t).AreEqual(expected, string(value), "the placement env var didn't match")
+	}
+
+	currentConfigEnv, err := ioutil.ReadFile(filepath.Join(pod.EnvDir(), "CURRENT_CONFIG_PATH"))
+	Assert(t).IsNil(err, "should not have erred reading the current config env file")
+	err = pod.linkCurrentConfig(manifest)
+	Assert(t).IsNil(err, "should not have erred linking the current config")
+	currentConfig, err := ioutil.ReadFile(string(currentConfigEnv))
+	Assert(t).IsNil(err, "should not have erred reading the current config")
+	Assert(t).AreEqual("ENVIRONMENT: staging\n", string(currentConfig), "the current config didn't match")
+
 	platformConfigFileName, err := manifest.PlatformConfigFileName()
 	Assert(t).IsNil(err, "Couldn't generate platform config filename")
 	platformConfigPath := filepath.Join(pod.ConfigDir(), platformConfigFileName)
@@ -387,6 +474,479 @@ func TestInstall(t *testing.T) {
 	if info, err := os.Stat(helloLaunch); err != nil || info.IsDir() {
 		t.Fatalf("Expected %s to be a the launch script for hello", helloLaunch)
 	}
+	if _, err := os.Stat(pod.journalPath(JournalDownload)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the install journal to be cleared once the install finished, got %v", err)
+	}
+}
+
+func TestInstallChecksDiskSpace(t *testing.T) {
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "test setup: couldn't get current user")
+	testLocation := util.From(runtime.Caller(0)).ExpandPath("testdata/hoisted-hello_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz")
+
+	testPodDir, err := ioutil.TempDir("", "testPodDir")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(testPodDir)
+	pod := Pod{
+		Id:      "testPod",
+		home:    testPodDir,
+		logger:  Log.SubLogger(logrus.Fields{"pod": "testPod"}),
+		Fetcher: uri.DefaultFetcher,
+	}
+	registry := artifact.NewRegistry(nil, uri.DefaultFetcher, osversion.DefaultDetector)
+
+	install := func(artifactSize size.ByteCount, quota size.ByteCount) error {
+		builder := manifest.NewBuilder()
+		builder.SetID("hello")
+		builder.SetRunAsUser(currentUser.Username)
+		builder.SetDiskQuota(quota)
+		builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+			"hello": {
+				Location:       testLocation,
+				LaunchableType: "hoist",
+				ArtifactSize:   artifactSize,
+			},
+		})
+		return pod.Install(builder.GetManifest(), auth.NopVerifier(), registry)
+	}
+
+	err = install(1024*1024*size.Tebibyte, 0)
+	_, ok := err.(InsufficientDiskSpaceError)
+	Assert(t).IsTrue(ok, fmt.Sprintf("should have refused to install an artifact larger than the disk, got %v", err))
+
+	err = install(0, size.Kibibyte)
+	_, ok = err.(DiskQuotaExceededError)
+	Assert(t).IsTrue(ok, fmt.Sprintf("should have measured the artifact's size and refused to exceed the quota, got %v", err))
+
+	err = install(0, 10*size.Mebibyte)
+	Assert(t).IsNil(err, "should have installed an artifact within the quota")
+}
+
+func TestRecoverRemovesInterruptedInstall(t *testing.T) {
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "test setup: couldn't get current user")
+	testPodDir, err := ioutil.TempDir("", "testPodDir")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(testPodDir)
+	pod := Pod{
+		Id:     "testPod",
+		home:   testPodDir,
+		logger: Log.SubLogger(logrus.Fields{"pod": "testPod"}),
+	}
+
+	builder := manifest.NewBuilder()
+	builder.SetID("testPod")
+	builder.SetRunAsUser(currentUser.Username)
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"hello": {
+			Location:       fmt.Sprintf("file:///tmp/hello_%s.tar.gz", strings.Repeat("a", 40)),
+			LaunchableType: "hoist",
+		},
+	})
+	testManifest := builder.GetManifest()
+	launchables, err := pod.Launchables(testManifest)
+	Assert(t).IsNil(err, "should have built the launchables")
+	installDir := launchables[0].InstallDir()
+
+	// the preparer stopped halfway through extracting the artifact
+	Assert(t).IsNil(pod.journal(JournalDownload, testManifest, launchables[0]), "should have journaled the download")
+	Assert(t).IsNil(os.MkdirAll(filepath.Join(installDir, "bin"), 0755), "test setup: could not create partial install")
+	Assert(t).IsTrue(launchables[0].Installed(), "test setup: the partial install should look installed")
+
+	_, interrupted, err := pod.Recover()
+	Assert(t).IsNil(err, "should have recovered")
+	Assert(t).IsFalse(interrupted, "no launch was interrupted")
+	Assert(t).IsFalse(launchables[0].Installed(), "should have removed the partial install")
+	_, err = os.Stat(pod.journalPath(JournalDownload))
+	Assert(t).IsTrue(os.IsNotExist(err), "should have cleared the journal")
+
+	// an interrupted launch is kept until the pod is launched again
+	Assert(t).IsNil(pod.journal(JournalSwitchSymlinks, testManifest, nil), "should have journaled the launch")
+	for i := 0; i < 2; i++ {
+		entry, interrupted, err := pod.Recover()
+		Assert(t).IsNil(err, "should have recovered")
+		Assert(t).IsTrue(interrupted, "should have returned the interrupted launch")
+		Assert(t).AreEqual(entry.Step, JournalSwitchSymlinks, "should have returned the interrupted step")
+	}
+}
+
+func TestRecoverOnlyRemovesInstallDirs(t *testing.T) {
+	testPodDir, err := ioutil.TempDir("", "testPodDir")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(testPodDir)
+	pod := Pod{
+		Id:     "testPod",
+		home:   testPodDir,
+		logger: Log.SubLogger(logrus.Fields{"pod": "testPod"}),
+	}
+
+	// the journal is in the pod's home, so the pod's user could rewrite it
+	precious := filepath.Join(testPodDir, "precious")
+	Assert(t).IsNil(os.MkdirAll(precious, 0755), "test setup: could not create dir")
+	for _, dir := range []string{precious, filepath.Join(testPodDir, "hello", "installs", ".."), "/"} {
+		entry := fmt.Sprintf(`{"step": "download", "launchable_id": "hello", "install_dir": %q}`, dir)
+		Assert(t).IsNil(ioutil.WriteFile(pod.journalPath(JournalDownload), []byte(entry), 0644), "test setup: could not write journal")
+		_, _, err = pod.Recover()
+		Assert(t).IsNotNil(err, fmt.Sprintf("should have refused to remove %s", dir))
+	}
+	_, err = os.Stat(precious)
+	Assert(t).IsNil(err, "should not have removed a dir that isn't an install")
+}
+
+func TestRemoveInstalls(t *testing.T) {
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "test setup: couldn't get current user")
+	testPodDir, err := ioutil.TempDir("", "testPodDir")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(testPodDir)
+	pod := Pod{
+		Id:     "testPod",
+		home:   testPodDir,
+		logger: Log.SubLogger(logrus.Fields{"pod": "testPod"}),
+	}
+
+	builder := manifest.NewBuilder()
+	builder.SetID("testPod")
+	builder.SetRunAsUser(currentUser.Username)
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"hello": {
+			Location:       fmt.Sprintf("file:///tmp/hello_%s.tar.gz", strings.Repeat("a", 40)),
+			LaunchableType: "hoist",
+		},
+	})
+	testManifest := builder.GetManifest()
+	launchables, err := pod.Launchables(testManifest)
+	Assert(t).IsNil(err, "should have built the launchables")
+	Assert(t).IsNil(os.MkdirAll(filepath.Join(launchables[0].InstallDir(), "bin"), 0755), "test setup: could not create install")
+	other := filepath.Join(testPodDir, "other")
+	Assert(t).IsNil(os.MkdirAll(other, 0755), "test setup: could not create dir")
+
+	Assert(t).IsNil(pod.RemoveInstalls(testManifest), "should have removed the installs")
+	Assert(t).IsFalse(launchables[0].Installed(), "should have removed the install")
+	_, err = os.Stat(other)
+	Assert(t).IsNil(err, "should not have removed the rest of the pod's home")
+}
+
+func TestRecordManifestPrunesHistory(t *testing.T) {
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "test setup: couldn't get current user")
+	testPodDir, err := ioutil.TempDir("", "testPodDir")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(testPodDir)
+	pod := Pod{
+		Id:     "testPod",
+		home:   testPodDir,
+		logger: Log.SubLogger(logrus.Fields{"pod": "testPod"}),
+	}
+	oldRetention := *InstallRetention
+	*InstallRetention = 2
+	defer func() { *InstallRetention = oldRetention }()
+
+	var manifests []manifest.Manifest
+	var installDirs []string
+	for _, version := range []string{"a", "b", "c"} {
+		builder := manifest.NewBuilder()
+		builder.SetID("testPod")
+		builder.SetRunAsUser(currentUser.Username)
+		builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+			"hello": {
+				Location:       fmt.Sprintf("file:///tmp/hello_%s.tar.gz", strings.Repeat(version, 40)),
+				LaunchableType: "hoist",
+			},
+		})
+		launchables, err := pod.Launchables(builder.GetManifest())
+		Assert(t).IsNil(err, "should have built the launchables")
+		Assert(t).IsNil(os.MkdirAll(launchables[0].InstallDir(), 0755), "should have created the install")
+		manifests = append(manifests, builder.GetManifest())
+		installDirs = append(installDirs, launchables[0].InstallDir())
+
+		oldManifestTemp, err := pod.WriteCurrentManifest(builder.GetManifest())
+		Assert(t).IsNil(err, "should have written the current manifest")
+		os.RemoveAll(oldManifestTemp)
+		Assert(t).IsNil(pod.recordManifest(builder.GetManifest()), "should have recorded the manifest")
+	}
+
+	history, err := pod.ManifestHistory()
+	Assert(t).IsNil(err, "should have read the manifest history")
+	Assert(t).AreEqual(len(history), 2, "should have retained two manifests")
+	_, err = os.Stat(installDirs[0])
+	Assert(t).IsTrue(os.IsNotExist(err), "should have removed the install of the expired manifest")
+	for _, installDir := range installDirs[1:] {
+		_, err = os.Stat(installDir)
+		Assert(t).IsNil(err, "should have kept the installs of the retained manifests")
+	}
+
+	previous, err := pod.PreviousManifest()
+	Assert(t).IsNil(err, "should have found the previous manifest")
+	previousSHA, _ := previous.SHA()
+	expectedSHA, _ := manifests[1].SHA()
+	Assert(t).AreEqual(previousSHA, expectedSHA, "the previous manifest should be the one launched before the current one")
+
+	expiredSHA, _ := manifests[0].SHA()
+	_, err = pod.RollbackTo(expiredSHA)
+	Assert(t).IsNotNil(err, "should not roll back to a manifest that is no longer retained")
+}
+
+// mapSecrets is a secrets.Source of fixed secrets
+type mapSecrets map[string]string
+
+func (m mapSecrets) Secret(path string) ([]byte, error) {
+	value, ok := m[path]
+	if !ok {
+		return nil, secrets.NotFoundError{Path: path}
+	}
+	return []byte(value), nil
+}
+
+func TestRefreshSecretsWritesRestrictedFiles(t *testing.T) {
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "test setup: couldn't get current user")
+	testPodDir, err := ioutil.TempDir("", "testPodDir")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(testPodDir)
+	source := mapSecrets{"db": "hunter2", "tls": "key data"}
+	pod := Pod{
+		Id:      "testPod",
+		home:    testPodDir,
+		logger:  Log.SubLogger(logrus.Fields{"pod": "testPod"}),
+		Secrets: source,
+	}
+	Assert(t).IsNil(os.MkdirAll(pod.EnvDir(), 0755), "could not create env dir")
+
+	builder := manifest.NewBuilder()
+	builder.SetID("testPod")
+	builder.SetRunAsUser(currentUser.Username)
+	builder.SetSecrets([]manifest.SecretStanza{
+		{Name: "DB_PASSWORD", Path: "db"},
+		{Name: "tls.key", Path: "tls", File: true},
+	})
+
+	changed, err := pod.RefreshSecrets(builder.GetManifest())
+	Assert(t).IsNil(err, "should have written secrets")
+	Assert(t).IsTrue(changed, "should have reported the new secrets as changed")
+	for path, expected := range map[string]string{
+		filepath.Join(pod.EnvDir(), "DB_PASSWORD"):    "hunter2",
+		filepath.Join(pod.SecretsDir(), "tls.key"):    "key data",
+		filepath.Join(pod.EnvDir(), SecretsDirEnvVar): pod.SecretsDir(),
+	} {
+		contents, err := ioutil.ReadFile(path)
+		Assert(t).IsNil(err, "should have written "+path)
+		Assert(t).AreEqual(string(contents), expected, "unexpected contents of "+path)
+	}
+	info, err := os.Stat(filepath.Join(pod.SecretsDir(), "tls.key"))
+	Assert(t).IsNil(err, "should have written the file secret")
+	Assert(t).AreEqual(info.Mode().Perm(), os.FileMode(0400), "secrets should only be readable by the pod's user")
+
+	changed, err = pod.RefreshSecrets(builder.GetManifest())
+	Assert(t).IsNil(err, "should have refreshed secrets")
+	Assert(t).IsFalse(changed, "unchanged secrets should not be reported as changed")
+
+	source["db"] = "rotated"
+	builder.SetSecrets([]manifest.SecretStanza{{Name: "DB_PASSWORD", Path: "db"}})
+	changed, err = pod.RefreshSecrets(builder.GetManifest())
+	Assert(t).IsNil(err, "should have refreshed secrets")
+	Assert(t).IsTrue(changed, "rotated secrets should be reported as changed")
+	contents, err := ioutil.ReadFile(filepath.Join(pod.EnvDir(), "DB_PASSWORD"))
+	Assert(t).IsNil(err, "should have kept the env secret")
+	Assert(t).AreEqual(string(contents), "rotated", "should have written the rotated secret")
+	_, err = os.Stat(filepath.Join(pod.SecretsDir(), "tls.key"))
+	Assert(t).IsTrue(os.IsNotExist(err), "should have removed the secret dropped from the manifest")
+
+	pod.Secrets = nil
+	_, err = pod.RefreshSecrets(builder.GetManifest())
+	Assert(t).IsNotNil(err, "should have failed without a secrets source")
+}
+
+type fakeAnnotator map[string]interface{}
+
+func (f fakeAnnotator) PodClusterAnnotations(node types.NodeName, podID types.PodID) (map[string]interface{}, error) {
+	return f, nil
+}
+
+func TestSetupConfigRendersConfigTemplates(t *testing.T) {
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "test setup: couldn't get current user")
+	testPodDir, err := ioutil.TempDir("", "testPodDir")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(testPodDir)
+	pod := Pod{
+		Id:               "testPod",
+		node:             "node1.example.com",
+		home:             testPodDir,
+		logger:           Log.SubLogger(logrus.Fields{"pod": "testPod"}),
+		ClusterAnnotator: fakeAnnotator{"tier": "gold"},
+	}
+
+	builder := manifest.NewBuilder()
+	builder.SetID("testPod")
+	builder.SetRunAsUser(currentUser.Username)
+	err = builder.SetConfig(map[interface{}]interface{}{"greeting": "hello"})
+	Assert(t).IsNil(err, "should have set config")
+	builder.SetConfigTemplates(map[string]string{
+		"app.conf": `{{.Config.greeting}} from {{.NodeName}} in {{.Annotations.tier}} on port {{port "http"}}`,
+	})
+	podManifest := builder.GetManifest()
+
+	render := func() string {
+		Assert(t).IsNil(pod.setupConfig(podManifest, nil), "should have set up config")
+		dir, err := ioutil.ReadFile(filepath.Join(pod.EnvDir(), ConfigTemplatesDirEnvVar))
+		Assert(t).IsNil(err, "should have exported the templates dir")
+		rendered, err := ioutil.ReadFile(filepath.Join(string(dir), "app.conf"))
+		Assert(t).IsNil(err, "should have rendered the template")
+		return string(rendered)
+	}
+	first := render()
+	Assert(t).IsTrue(strings.HasPrefix(first, "hello from node1.example.com in gold on port "), "unexpected rendered template: "+first)
+	Assert(t).AreEqual(render(), first, "should have kept the allocated port")
+
+	builder.SetConfigTemplates(map[string]string{"app.conf": `{{.Missing}}`})
+	err = pod.setupConfig(builder.GetManifest(), nil)
+	Assert(t).IsNotNil(err, "should have failed to render a template with unknown inputs")
+}
+
+func TestSetupConfigRendersSidecarPorts(t *testing.T) {
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "test setup: couldn't get current user")
+	testPodDir, err := ioutil.TempDir("", "testPodDir")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(testPodDir)
+	pod := Pod{
+		Id:     "testPod",
+		node:   "node1.example.com",
+		home:   testPodDir,
+		logger: Log.SubLogger(logrus.Fields{"pod": "testPod"}),
+	}
+
+	builder := manifest.NewBuilder()
+	builder.SetID("testPod")
+	builder.SetRunAsUser(currentUser.Username)
+	builder.SetSidecar(&manifest.SidecarStanza{Name: "envoy", Launchable: "app"})
+	builder.SetConfigTemplates(map[string]string{
+		"envoy.bootstrap": `{{.Sidecar.AdminPort}} {{.Sidecar.ListenerPort}}`,
+		"app.conf":        `{{port "envoy_listener"}}`,
+	})
+	Assert(t).IsNil(pod.setupConfig(builder.GetManifest(), nil), "should have set up config")
+
+	dir, err := ioutil.ReadFile(filepath.Join(pod.EnvDir(), ConfigTemplatesDirEnvVar))
+	Assert(t).IsNil(err, "should have exported the templates dir")
+	bootstrap, err := ioutil.ReadFile(filepath.Join(string(dir), "envoy.bootstrap"))
+	Assert(t).IsNil(err, "should have rendered the bootstrap")
+	appConf, err := ioutil.ReadFile(filepath.Join(string(dir), "app.conf"))
+	Assert(t).IsNil(err, "should have rendered the app's config")
+	ports := strings.Split(string(bootstrap), " ")
+	Assert(t).AreEqual(len(ports), 2, "unexpected rendered bootstrap: "+string(bootstrap))
+	Assert(t).AreNotEqual(ports[0], ports[1], "should have allocated different admin and listener ports")
+	Assert(t).AreEqual(string(appConf), ports[1], "should have given the app the sidecar's listener port")
+}
+
+func TestLaunchablesLaunchSidecarFirst(t *testing.T) {
+	podTemp, err := ioutil.TempDir("", "pod")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(podTemp)
+
+	stanza := launch.LaunchableStanza{
+		LaunchableType: "hoist",
+		Location:       "https://localhost:4444/foo/bar/baz_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz",
+	}
+	builder := manifest.NewBuilder()
+	builder.SetID("thepod")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"a-app":   stanza,
+		"b-app":   stanza,
+		"envoy":   stanza,
+		"z-other": stanza,
+	})
+	builder.SetSidecar(&manifest.SidecarStanza{Name: "envoy", Launchable: "b-app"})
+	podManifest := builder.GetManifest()
+
+	pod := NewFactory(podTemp, "testNode", uri.DefaultFetcher, "").NewLegacyPod(podManifest.ID())
+	launchables, err := pod.Launchables(podManifest)
+	Assert(t).IsNil(err, "should have gotten launchables")
+	Assert(t).AreEqual(launchables[0].ID(), launch.LaunchableID("envoy"), "should launch the sidecar first")
+	halted := haltOrder(launchables)
+	Assert(t).AreEqual(halted[len(halted)-1].ID(), launch.LaunchableID("envoy"), "should halt the sidecar last")
+}
+
+func TestSetupConfigExportsAllocatedPorts(t *testing.T) {
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "test setup: couldn't get current user")
+	podTemp, err := ioutil.TempDir("", "pod")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(podTemp)
+
+	builder := manifest.NewBuilder()
+	builder.SetID("thepod")
+	builder.SetRunAsUser(currentUser.Username)
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"my-app": {
+			LaunchableType: "hoist",
+			Location:       "https://localhost:4444/foo/bar/baz_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz",
+			Port:           launch.AutoPort,
+		},
+	})
+	podManifest := builder.GetManifest()
+
+	pod := NewFactory(podTemp, "testNode", uri.DefaultFetcher, "").NewLegacyPod(podManifest.ID())
+	pod.SetAllocatedPorts(map[launch.LaunchableID]int{"my-app": 31000})
+	launchables, err := pod.Launchables(podManifest)
+	Assert(t).IsNil(err, "should have gotten launchables")
+	Assert(t).IsNil(pod.setupConfig(podManifest, launchables), "should have set up config")
+
+	port, err := ioutil.ReadFile(filepath.Join(launchables[0].EnvDir(), launch.PortEnvVar))
+	Assert(t).IsNil(err, "should have exported the port to the launchable")
+	Assert(t).AreEqual(string(port), "31000", "wrong launchable port")
+	port, err = ioutil.ReadFile(filepath.Join(pod.EnvDir(), "PORT_MY_APP"))
+	Assert(t).IsNil(err, "should have exported the port to the pod")
+	Assert(t).AreEqual(string(port), "31000", "wrong pod port")
+
+	// a later pod, e.g. one halting the pod, sees the recorded ports
+	pod = NewFactory(podTemp, "testNode", uri.DefaultFetcher, "").NewLegacyPod(podManifest.ID())
+	Assert(t).AreEqual(pod.ports()["my-app"], 31000, "should have recorded the allocated port")
+
+	pod.SetAllocatedPorts(map[launch.LaunchableID]int{})
+	Assert(t).IsNil(pod.setupConfig(podManifest, launchables), "should have set up config")
+	_, err = os.Stat(filepath.Join(pod.EnvDir(), "PORT_MY_APP"))
+	Assert(t).IsTrue(os.IsNotExist(err), "should have removed the port that is no longer allocated")
+}
+
+type stopTimeoutRecorder struct {
+	runit.SV
+	timeout time.Duration
+}
+
+func (r *stopTimeoutRecorder) Stop(service *runit.Service, timeout time.Duration) (string, error) {
+	r.timeout = timeout
+	return "", nil
+}
+
+func TestDrainRunsBeforeStopping(t *testing.T) {
+	drained := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		drained = r.Method == "POST" && r.URL.Path == "/drain"
+	}))
+	defer ts.Close()
+	port, err := strconv.Atoi(ts.URL[strings.LastIndex(ts.URL, ":")+1:])
+	Assert(t).IsNil(err, "test setup: couldn't get test server port")
+
+	builder := manifest.NewBuilder()
+	builder.SetID("testPod")
+	builder.SetStatusPort(port)
+	builder.SetStatusHTTP(true)
+	builder.SetDrain(&manifest.DrainStanza{HTTPPath: "/drain", TermTimeout: 20 * time.Second})
+	podManifest := builder.GetManifest()
+
+	recorder := &stopTimeoutRecorder{SV: runit.NewRecordingSV()}
+	pod := Pod{
+		Id:     "testPod",
+		logger: Log.SubLogger(logrus.Fields{"pod": "testPod"}),
+		SV:     recorder,
+	}
+	pod.drain(podManifest)
+	Assert(t).IsTrue(drained, "should have posted to the drain endpoint")
+
+	_, err = pod.stopSV(podManifest).Stop(&runit.Service{}, time.Second)
+	Assert(t).IsNil(err, "should have stopped the service")
+	Assert(t).AreEqual(recorder.timeout, 20*time.Second, "should have used the term timeout")
 }
 
 func TestUninstall(t *testing.T) {
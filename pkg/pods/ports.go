@@ -0,0 +1,98 @@
+package pods
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+	"gopkg.in/yaml.v2"
+)
+
+// launchablePortsFile records the ports allocated to the pod's launchables
+// when it was last installed
+const launchablePortsFile = "launchable_ports.yaml"
+
+// SetAllocatedPorts sets the ports allocated by the preparer to the
+// launchables of the manifest that is about to be installed. If they aren't
+// set, the ports recorded by the last install are used.
+func (pod *Pod) SetAllocatedPorts(ports map[launch.LaunchableID]int) {
+	pod.allocatedPorts = ports
+}
+
+// AllocatedPorts returns the ports allocated to the launchables of the pod
+// when it was last installed
+func (pod *Pod) AllocatedPorts() (map[launch.LaunchableID]int, error) {
+	ports := make(map[launch.LaunchableID]int)
+	contents, err := ioutil.ReadFile(filepath.Join(pod.home, launchablePortsFile))
+	if os.IsNotExist(err) {
+		return ports, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(contents, &ports)
+	if err != nil {
+		return nil, util.Errorf("Could not parse the allocated ports of pod %s: %s", pod.Id, err)
+	}
+	return ports, nil
+}
+
+func (pod *Pod) ports() map[launch.LaunchableID]int {
+	if pod.allocatedPorts != nil {
+		return pod.allocatedPorts
+	}
+	ports, err := pod.AllocatedPorts()
+	if err != nil {
+		pod.logError(err, "Could not read allocated ports")
+	}
+	return ports
+}
+
+// writePorts exports the ports allocated to the pod's launchables to the whole
+// pod, and records them for later installs and halts.
+func (pod *Pod) writePorts(uid, gid int) error {
+	ports := pod.ports()
+	recorded, err := pod.AllocatedPorts()
+	if err != nil {
+		return err
+	}
+	for launchableID := range recorded {
+		if _, ok := ports[launchableID]; !ok {
+			err = os.Remove(filepath.Join(pod.EnvDir(), launch.PodPortEnvVar(launchableID)))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	for launchableID, port := range ports {
+		err = writeEnvFile(pod.EnvDir(), launch.PodPortEnvVar(launchableID), strconv.Itoa(port), uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(ports) == 0 {
+		err = os.Remove(filepath.Join(pod.home, launchablePortsFile))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	contents, err := yaml.Marshal(ports)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(pod.home, launchablePortsFile), contents, 0644)
+}
+
+// statusPort returns the port that the manifest's status endpoint is served
+// on, or 0 if it has none
+func (pod *Pod) statusPort(manifest manifest.Manifest) int {
+	if launchableID := manifest.GetStatusPortLaunchable(); launchableID != "" {
+		return pod.ports()[launchableID]
+	}
+	return manifest.GetStatusPort()
+}
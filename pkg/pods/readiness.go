@@ -0,0 +1,60 @@
+package pods
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/p2exec"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// ReadinessCommandTimeout is the maximum number of seconds a single run of a
+// pod's readiness command may take before it is killed and considered to
+// have failed.
+var ReadinessCommandTimeout = param.Int64("readiness_command_timeout", 10)
+
+// CheckReadiness runs the manifest's readiness command once, as the pod's user
+// with the pod's environment, returning its output. A nil error means that
+// the pod is ready. Manifests without a readiness command are always ready.
+func (pod *Pod) CheckReadiness(manifest manifest.Manifest) (string, error) {
+	readiness := manifest.GetReadiness()
+	if readiness == nil || len(readiness.Command) == 0 {
+		return "", nil
+	}
+
+	timeout := time.Duration(*ReadinessCommandTimeout) * time.Second
+	return pod.runCommand(manifest, "readiness", readiness.Command, timeout)
+}
+
+// runCommand runs command as the pod's user with the pod's environment,
+// killing it if it runs longer than timeout, and returns its redacted output.
+func (pod *Pod) runCommand(manifest manifest.Manifest, name string, command []string, timeout time.Duration) (string, error) {
+	p2ExecArgs := p2exec.P2ExecArgs{
+		Command:     command,
+		User:        manifest.RunAsUser(),
+		EnvDirs:     []string{pod.EnvDir()},
+		WorkDir:     pod.home,
+		RequireFile: pod.RequireFile,
+		EnvFilter:   envFilter(manifest.GetEnvironment()),
+	}
+	if confinement := manifest.GetConfinement(); confinement != nil {
+		p2ExecArgs.SELinuxContext = confinement.SELinuxContext
+		p2ExecArgs.AppArmorProfile = confinement.AppArmorProfile
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, pod.P2Exec, p2ExecArgs.CommandLine()...)
+	var buffer bytes.Buffer
+	cmd.Stdout = &buffer
+	cmd.Stderr = &buffer
+	err := cmd.Run()
+	out := pod.RedactionFor(manifest).Redact(buffer.String())
+	if ctx.Err() == context.DeadlineExceeded {
+		return out, util.Errorf("%s command timed out after %s", name, timeout)
+	}
+	return out, err
+}
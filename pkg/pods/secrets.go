@@ -0,0 +1,164 @@
+package pods
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/user"
+	"github.com/square/p2/pkg/util"
+)
+
+// envSecretsFile lists the environment secrets last written to the pod's env
+// directory, so that they can be removed once the manifest drops them
+const envSecretsFile = ".env_secrets"
+
+// SecretsDir is the directory, readable only by the pod's user, that file
+// secrets are written to.
+func (pod *Pod) SecretsDir() string {
+	return filepath.Join(pod.home, "secrets")
+}
+
+// RefreshSecrets fetches the manifest's secrets again and rewrites the ones
+// that changed, e.g. because they were rotated. It returns whether any
+// changed. Services see changed file secrets the next time they read them,
+// and changed environment secrets when they are next restarted.
+func (pod *Pod) RefreshSecrets(manifest manifest.Manifest) (bool, error) {
+	uid, gid, err := user.IDs(manifest.RunAsUser())
+	if err != nil {
+		return false, util.Errorf("Could not determine pod UID/GID: %s", err)
+	}
+	return pod.writeSecrets(manifest, uid, gid)
+}
+
+// writeSecrets fetches the manifest's secrets from the pod's secrets source
+// and writes environment secrets to the pod's env directory and file secrets
+// to its secrets directory, readable only by the pod's user. Secrets that the
+// manifest no longer references are removed. All of the secrets are fetched
+// before any are written, so that a pod doesn't get some of a rotation.
+func (pod *Pod) writeSecrets(manifest manifest.Manifest, uid, gid int) (bool, error) {
+	if len(manifest.GetSecrets()) == 0 {
+		if _, err := os.Stat(pod.SecretsDir()); os.IsNotExist(err) {
+			return false, nil
+		}
+	}
+
+	values := make(map[string][]byte)
+	for _, secret := range manifest.GetSecrets() {
+		if pod.Secrets == nil {
+			return false, util.Errorf("Pod %s references secrets but no secrets source is configured", manifest.ID())
+		}
+		value, err := pod.Secrets.Secret(secret.Path)
+		if err != nil {
+			return false, util.Errorf("Could not fetch secret %s for pod %s: %s", secret.Name, manifest.ID(), err)
+		}
+		values[secret.Name] = value
+	}
+
+	err := util.MkdirChownAll(pod.SecretsDir(), uid, gid, 0700)
+	if err != nil {
+		return false, util.Errorf("Could not create the secrets dir for pod %s: %s", manifest.ID(), err)
+	}
+	err = os.Chmod(pod.SecretsDir(), 0700)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	var envNames []string
+	fileNames := map[string]bool{envSecretsFile: true}
+	for _, secret := range manifest.GetSecrets() {
+		dir := pod.EnvDir()
+		if secret.File {
+			dir = pod.SecretsDir()
+			fileNames[secret.Name] = true
+		} else {
+			envNames = append(envNames, secret.Name)
+		}
+		secretChanged, err := writeSecretFile(filepath.Join(dir, secret.Name), values[secret.Name], uid, gid)
+		if err != nil {
+			return false, util.Errorf("Could not write secret %s for pod %s: %s", secret.Name, manifest.ID(), err)
+		}
+		changed = changed || secretChanged
+	}
+
+	// remove the secrets of a previous manifest
+	oldEnvNames, err := ioutil.ReadFile(filepath.Join(pod.SecretsDir(), envSecretsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	for _, name := range strings.Fields(string(oldEnvNames)) {
+		if !contains(envNames, name) {
+			err = os.Remove(filepath.Join(pod.EnvDir(), name))
+			if err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+			changed = true
+		}
+	}
+	entries, err := ioutil.ReadDir(pod.SecretsDir())
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if !fileNames[entry.Name()] {
+			err = os.Remove(filepath.Join(pod.SecretsDir(), entry.Name()))
+			if err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+
+	err = ioutil.WriteFile(filepath.Join(pod.SecretsDir(), envSecretsFile), []byte(strings.Join(envNames, "\n")), 0600)
+	if err != nil {
+		return false, err
+	}
+	err = writeEnvFile(pod.EnvDir(), SecretsDirEnvVar, pod.SecretsDir(), uid, gid)
+	if err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+// writeSecretFile atomically replaces filename with a file readable only by
+// uid, unless it already holds data. It returns whether it was replaced.
+func writeSecretFile(filename string, data []byte, uid, gid int) (bool, error) {
+	existing, err := ioutil.ReadFile(filename)
+	if err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Chmod(0400)
+	}
+	if err == nil {
+		err = tmpFile.Chown(uid, gid)
+	}
+	closeErr := tmpFile.Close()
+	if err != nil {
+		return false, err
+	}
+	if closeErr != nil {
+		return false, closeErr
+	}
+	return true, os.Rename(tmpFile.Name(), filename)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
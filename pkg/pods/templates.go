@@ -0,0 +1,221 @@
+package pods
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"gopkg.in/yaml.v2"
+)
+
+// ClusterAnnotator looks up the annotations of the pod cluster that a pod on a
+// node belongs to, for rendering config templates. It returns nil if the pod
+// isn't part of a pod cluster.
+type ClusterAnnotator interface {
+	PodClusterAnnotations(node types.NodeName, podID types.PodID) (map[string]interface{}, error)
+}
+
+// TemplateInputs are what config templates are rendered with. Templates can
+// also call {{port "name"}}, which allocates a free port to the pod the
+// first time a name is used and returns the same port on every later install.
+type TemplateInputs struct {
+	NodeName     types.NodeName
+	Hostname     string
+	PodID        types.PodID
+	PodUniqueKey types.PodUniqueKey
+	// Config is the manifest's config section
+	Config map[interface{}]interface{}
+	// Annotations are those of the pod's pod cluster, if it has one
+	Annotations map[string]interface{}
+	// Sidecar is set if the pod has a sidecar
+	Sidecar *SidecarInputs
+}
+
+// SidecarInputs describe a pod's sidecar to its config templates, such as
+// the sidecar's bootstrap and the main launchable's config that points at the
+// sidecar's listener. Its ports are allocated like {{port "name"}} ports,
+// named <sidecar>_admin and <sidecar>_listener.
+type SidecarInputs struct {
+	Name         string
+	AdminPort    int
+	ListenerPort int
+}
+
+// templatesDir is where the config templates of a manifest are rendered. Like
+// the config file, it is specific to the manifest so that installing a new
+// one doesn't change the config of the running one.
+func (pod *Pod) templatesDir(manifest manifest.Manifest) (string, error) {
+	sha, err := manifest.SHA()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(pod.ConfigDir(), manifest.ID().String()+"_"+sha+"_templates"), nil
+}
+
+// renderConfigTemplates renders the manifest's config templates into its
+// templates directory, and points CONFIG_TEMPLATES_DIR at it.
+func (pod *Pod) renderConfigTemplates(manifest manifest.Manifest, uid, gid int) error {
+	templates := manifest.GetConfigTemplates()
+	if len(templates) == 0 {
+		// a previous manifest may have had templates
+		err := os.Remove(filepath.Join(pod.EnvDir(), ConfigTemplatesDirEnvVar))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	inputs, err := pod.templateInputs(manifest)
+	if err != nil {
+		return err
+	}
+	ports, err := pod.loadPorts()
+	if err != nil {
+		return err
+	}
+	if sidecar := manifest.GetSidecar(); sidecar != nil {
+		inputs.Sidecar, err = ports.sidecarInputs(sidecar.Name)
+		if err != nil {
+			return err
+		}
+	}
+	funcs := template.FuncMap{
+		"port": ports.port,
+	}
+
+	dir, err := pod.templatesDir(manifest)
+	if err != nil {
+		return err
+	}
+	err = util.MkdirChownAll(dir, uid, gid, 0755)
+	if err != nil {
+		return util.Errorf("Could not create the config templates dir for pod %s: %s", manifest.ID(), err)
+	}
+
+	// render in a stable order so that ports are allocated in one
+	var names []string
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(templates[name])
+		if err != nil {
+			return util.Errorf("Could not parse config template %s of pod %s: %s", name, manifest.ID(), err)
+		}
+		var rendered bytes.Buffer
+		err = tmpl.Execute(&rendered, inputs)
+		if err != nil {
+			return util.Errorf("Could not render config template %s of pod %s: %s", name, manifest.ID(), err)
+		}
+		err = writeFileChown(filepath.Join(dir, name), rendered.Bytes(), uid, gid)
+		if err != nil {
+			return util.Errorf("Could not write config template %s of pod %s: %s", name, manifest.ID(), err)
+		}
+	}
+
+	err = ports.save()
+	if err != nil {
+		return util.Errorf("Could not record the ports allocated to pod %s: %s", manifest.ID(), err)
+	}
+	return writeEnvFile(pod.EnvDir(), ConfigTemplatesDirEnvVar, dir, uid, gid)
+}
+
+func (pod *Pod) templateInputs(manifest manifest.Manifest) (TemplateInputs, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return TemplateInputs{}, util.Errorf("Could not get hostname: %s", err)
+	}
+	inputs := TemplateInputs{
+		NodeName:     pod.node,
+		Hostname:     hostname,
+		PodID:        manifest.ID(),
+		PodUniqueKey: pod.uniqueKey,
+		Config:       manifest.GetConfig(),
+	}
+	if pod.ClusterAnnotator != nil {
+		inputs.Annotations, err = pod.ClusterAnnotator.PodClusterAnnotations(pod.node, manifest.ID())
+		if err != nil {
+			return TemplateInputs{}, util.Errorf("Could not get pod cluster annotations of pod %s: %s", manifest.ID(), err)
+		}
+	}
+	return inputs, nil
+}
+
+// portAllocations are the named ports allocated to a pod by its config
+// templates, which are kept in its home so that they don't change between
+// installs
+type portAllocations struct {
+	path    string
+	ports   map[string]int
+	changed bool
+}
+
+func (pod *Pod) loadPorts() (*portAllocations, error) {
+	allocations := &portAllocations{
+		path:  filepath.Join(pod.home, "allocated_ports.yaml"),
+		ports: make(map[string]int),
+	}
+	contents, err := ioutil.ReadFile(allocations.path)
+	if os.IsNotExist(err) {
+		return allocations, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(contents, &allocations.ports)
+	if err != nil {
+		return nil, util.Errorf("Could not parse %s: %s", allocations.path, err)
+	}
+	return allocations, nil
+}
+
+// port returns the port allocated to name, allocating a port that is free on
+// the node if there isn't one yet.
+func (p *portAllocations) port(name string) (int, error) {
+	if port, ok := p.ports[name]; ok {
+		return port, nil
+	}
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, util.Errorf("Could not allocate port %s: %s", name, err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+	p.ports[name] = port
+	p.changed = true
+	return port, nil
+}
+
+func (p *portAllocations) sidecarInputs(name string) (*SidecarInputs, error) {
+	adminPort, err := p.port(name + "_admin")
+	if err != nil {
+		return nil, err
+	}
+	listenerPort, err := p.port(name + "_listener")
+	if err != nil {
+		return nil, err
+	}
+	return &SidecarInputs{
+		Name:         name,
+		AdminPort:    adminPort,
+		ListenerPort: listenerPort,
+	}, nil
+}
+
+func (p *portAllocations) save() error {
+	if !p.changed {
+		return nil
+	}
+	contents, err := yaml.Marshal(p.ports)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.path, contents, 0644)
+}
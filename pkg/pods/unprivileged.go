@@ -0,0 +1,43 @@
+package pods
+
+import (
+	"os"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/user"
+	"github.com/square/p2/pkg/util"
+)
+
+// checkUnprivileged returns an error if the pod is unprivileged and the
+// manifest can't be installed without root: it must run as the current user,
+// and opencontainer launchables need root to run.
+func (pod *Pod) checkUnprivileged(manifest manifest.Manifest) error {
+	if !pod.Unprivileged {
+		return nil
+	}
+
+	uid, _, err := user.IDs(manifest.RunAsUser())
+	if err != nil {
+		return util.Errorf("Could not determine pod UID/GID for %s: %s", manifest.RunAsUser(), err)
+	}
+	if uid != os.Getuid() {
+		return util.Errorf("Unprivileged pods must run as the current user, but %s runs as %s", manifest.ID(), manifest.RunAsUser())
+	}
+
+	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
+		if stanza.LaunchableType == "opencontainer" {
+			return util.Errorf("Launchable %s of unprivileged pod %s is an opencontainer, which requires root", launchableID, manifest.ID())
+		}
+	}
+	return nil
+}
+
+// helperUser is the user that the log and finish execs of the pod's services
+// run as. Unprivileged pods can't switch users, so they run as the current
+// user.
+func (pod *Pod) helperUser() string {
+	if pod.Unprivileged {
+		return ""
+	}
+	return "nobody"
+}
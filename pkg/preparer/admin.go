@@ -0,0 +1,309 @@
+package preparer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/grpc/admin"
+	admin_protos "github.com/square/p2/pkg/grpc/admin/protos"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	netutil "github.com/square/p2/pkg/util/net"
+)
+
+// setWorkQueue records the queue that the node's pods are being worked on
+// from, or nil once they no longer are, for the admin service
+func (p *Preparer) setWorkQueue(queue *podWorkQueue) {
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+	p.queue = queue
+}
+
+func (p *Preparer) workQueue() *podWorkQueue {
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+	return p.queue
+}
+
+// PodStatuses returns the pods under the pod root that have been launched and
+// the runit status of their services
+func (p *Preparer) PodStatuses() []admin.PodStatus {
+	var statuses []admin.PodStatus
+	for _, installed := range p.installedPods() {
+		status := admin.PodStatus{
+			PodID:        installed.pod.Id,
+			PodUniqueKey: installed.pod.UniqueKey(),
+		}
+		status.SHA, _ = installed.manifest.SHA()
+		services, err := installed.pod.ServiceStatuses(installed.manifest)
+		if err != nil {
+			status.Err = err
+			statuses = append(statuses, status)
+			continue
+		}
+		names := make([]string, 0, len(services))
+		for name := range services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			service := admin.ServiceStatus{Name: name, Err: services[name].Err}
+			if stat := services[name].Stat; stat != nil {
+				service.Status = stat.ChildStatus
+				service.PID = stat.ChildPID
+				service.Time = stat.ChildTime
+			}
+			status.Services = append(status.Services, service)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// PendingWork returns the work on pods that is in progress or waiting to be
+// done
+func (p *Preparer) PendingWork() []admin.Work {
+	queue := p.workQueue()
+	if queue == nil {
+		return nil
+	}
+	var pending []admin.Work
+	for _, work := range queue.Snapshot() {
+		pending = append(pending, admin.Work{
+			PodID:        work.pair.ID,
+			PodUniqueKey: work.pair.PodUniqueKey,
+			SHA:          pairSHA(work.pair),
+			State:        work.state,
+			Reinstall:    work.pair.Reinstall,
+			Observed:     work.pair.Observed,
+		})
+	}
+	return pending
+}
+
+// Reverify checks the installed launchables of the pods under the pod root
+// against the digests recorded when their artifacts were verified, or if
+// podID is set, of that pod only. A pod that is being deployed may fail
+// verification while its launchables are being replaced.
+func (p *Preparer) Reverify(podID types.PodID, podUniqueKey types.PodUniqueKey) ([]admin.Verification, error) {
+	var verifications []admin.Verification
+	for _, installed := range p.installedPods() {
+		if podID != "" && (installed.pod.Id != podID || installed.pod.UniqueKey() != podUniqueKey) {
+			continue
+		}
+		err := installed.pod.Verify(installed.manifest, p.reloadable().authPolicy)
+		p.metrics.verification(err)
+		if err != nil {
+			installed.logger.WithError(err).Errorln("Pod failed verification requested by an operator")
+		} else {
+			installed.logger.NoFields().Infoln("Pod passed verification requested by an operator")
+		}
+		verifications = append(verifications, admin.Verification{
+			PodID:        installed.pod.Id,
+			PodUniqueKey: installed.pod.UniqueKey(),
+			Err:          err,
+		})
+	}
+	if podID != "" && len(verifications) == 0 {
+		return nil, admin.PodNotFound
+	}
+	return verifications, nil
+}
+
+// ForceReinstall queues a deploy of the pod's intent that halts the pod,
+// removes its launchables, and installs and launches them again, whether or
+// not reality matches the intent
+func (p *Preparer) ForceReinstall(podID types.PodID, podUniqueKey types.PodUniqueKey) error {
+	if p.Observations != nil {
+		return util.Errorf("The preparer is observe-only and does not install pods")
+	}
+	if podID == constants.PreparerPodID {
+		return util.Errorf("The preparer can't reinstall itself")
+	}
+	queue := p.workQueue()
+	if queue == nil {
+		return util.Errorf("The preparer is not working on pods")
+	}
+
+	intent, _, err := p.store.ListPods(consul.INTENT_TREE, p.node)
+	if err != nil {
+		return util.Errorf("Could not read the intent of %s: %s", p.node, err)
+	}
+	for _, result := range intent {
+		if result.Manifest.ID() != podID || result.PodUniqueKey != podUniqueKey {
+			continue
+		}
+		// reality is read again when the pair is worked on
+		pair := p.ZipResultSets([]consul.ManifestResult{result}, nil)[0]
+		pair.Reinstall = true
+		p.Logger.WithFields(logrus.Fields{
+			"pod":            podID,
+			"pod_unique_key": podUniqueKey,
+		}).Warnln("Reinstall requested by an operator")
+		queue.Add(pair)
+		return nil
+	}
+	return admin.PodNotFound
+}
+
+// adminPreparer is the preparer as the admin service sees it
+type adminPreparer struct {
+	*Preparer
+	configPath string
+}
+
+// ReloadConfig reloads the config as if the preparer had received SIGHUP
+func (a adminPreparer) ReloadConfig() (admin.ConfigReload, error) {
+	reload, err := a.reloadConfig(a.configPath)
+	if err != nil {
+		return admin.ConfigReload{}, err
+	}
+	return admin.ConfigReload{
+		Applied:         reload.Applied,
+		RequiresRestart: reload.RequiresRestart,
+	}, nil
+}
+
+func (a adminPreparer) SetLogLevel(level string) error {
+	previous := a.Logger.GetLevel()
+	err := a.Logger.SetLevel(level)
+	if err != nil {
+		return err
+	}
+	a.Logger.WithFields(logrus.Fields{
+		"previous_level": previous,
+		"level":          a.Logger.GetLevel(),
+	}).Warnln("Changed log level")
+	return nil
+}
+
+func (a adminPreparer) LogLevel() string {
+	return a.Logger.GetLevel()
+}
+
+// AdminServer serves the admin service (see the admin package) on a unix
+// socket, and if configured, on a TCP port to clients with a certificate
+// signed by the preparer's CA
+type AdminServer struct {
+	servers   []*grpc.Server
+	listeners []net.Listener
+	logger    *logging.Logger
+}
+
+func NewAdminServer(preparerConfig *PreparerConfig, configPath string, preparer *Preparer, logger *logging.Logger) (*AdminServer, error) {
+	service := admin.NewServer(adminPreparer{Preparer: preparer, configPath: configPath})
+	s := &AdminServer{logger: logger}
+
+	if preparerConfig.AdminSocket != "" {
+		logger.WithField("socket", preparerConfig.AdminSocket).Infof("Serving the admin service on socket %s", preparerConfig.AdminSocket)
+		listener, err := listenOnAdminSocket(preparerConfig.AdminSocket, preparerConfig.AdminSocketGroup, logger)
+		if err != nil {
+			return nil, err
+		}
+		server := grpc.NewServer()
+		admin_protos.RegisterP2AdminServer(server, service)
+		s.servers = append(s.servers, server)
+		s.listeners = append(s.listeners, listener)
+	}
+
+	if preparerConfig.AdminPort != 0 {
+		serverOpts, err := preparerConfig.adminServerOptions()
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		logger.WithField("port", preparerConfig.AdminPort).Infof("Serving the admin service on port %d", preparerConfig.AdminPort)
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", preparerConfig.AdminPort))
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		server := grpc.NewServer(serverOpts...)
+		admin_protos.RegisterP2AdminServer(server, service)
+		s.servers = append(s.servers, server)
+		s.listeners = append(s.listeners, listener)
+	}
+	return s, nil
+}
+
+// listenOnAdminSocket listens on the admin socket, which only the preparer's
+// user, and the members of group if it is set, can connect to
+func listenOnAdminSocket(socket string, group string, logger *logging.Logger) (net.Listener, error) {
+	if group == "" {
+		return listenOnSocketWithMode(socket, 0600, logger)
+	}
+
+	adminGroup, err := user.LookupGroup(group)
+	if err != nil {
+		return nil, util.Errorf("Could not look up admin socket group %s: %s", group, err)
+	}
+	gid, err := strconv.Atoi(adminGroup.Gid)
+	if err != nil {
+		return nil, util.Errorf("Unexpected gid %s of admin socket group %s", adminGroup.Gid, group)
+	}
+
+	// the socket is only opened up to the group once it belongs to it
+	listener, err := listenOnSocketWithMode(socket, 0600, logger)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chown(socket, -1, gid)
+	if err == nil {
+		err = os.Chmod(socket, 0660)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, util.Errorf("Could not give admin socket group %s access to %s: %s", group, socket, err)
+	}
+	return listener, nil
+}
+
+// adminServerOptions configures the admin service on the TCP port to require
+// client certificates signed by the CA, and if admin_clients is set, to only
+// serve the clients named in it
+func (c *PreparerConfig) adminServerOptions() ([]grpc.ServerOption, error) {
+	if c.CAFile == "" || c.CertFile == "" || c.KeyFile == "" {
+		return nil, util.Errorf("admin_port requires ca_file, cert_file and key_file to be configured")
+	}
+	tlsConfig, err := netutil.GetTLSConfig(c.CertFile, c.KeyFile, c.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	serverOpts := []grpc.ServerOption{grpc.Creds(credentials.NewTLS(tlsConfig))}
+	if len(c.AdminClients) > 0 {
+		serverOpts = append(serverOpts, grpc.UnaryInterceptor(admin.AuthorizeClients(c.AdminClients)))
+	}
+	return serverOpts, nil
+}
+
+func (s *AdminServer) Serve() {
+	for i := range s.servers {
+		server, listener := s.servers[i], s.listeners[i]
+		go func() {
+			err := server.Serve(listener)
+			s.logger.WithError(err).Warnln("Admin server exited")
+		}()
+	}
+}
+
+func (s *AdminServer) Close() {
+	for _, server := range s.servers {
+		server.Stop()
+	}
+	for _, listener := range s.listeners {
+		_ = listener.Close()
+	}
+}
@@ -0,0 +1,74 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/grpc/admin"
+	"github.com/square/p2/pkg/logging"
+)
+
+func TestForceReinstallQueuesReinstall(t *testing.T) {
+	testManifest := testManifest(t)
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{currentManifest: testManifest})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	err := p.ForceReinstall(testManifest.ID(), "")
+	Assert(t).IsNotNil(err, "should not have reinstalled while the preparer isn't working on pods")
+
+	queue := newPodWorkQueue()
+	defer queue.Close()
+	p.setWorkQueue(queue)
+
+	err = p.ForceReinstall(testManifest.ID(), "")
+	Assert(t).IsNil(err, "should have queued the reinstall")
+	work := p.PendingWork()
+	Assert(t).AreEqual(len(work), 1, "should have queued work for the pod")
+	Assert(t).AreEqual(work[0].PodID, testManifest.ID(), "should have queued work for the pod")
+	Assert(t).IsTrue(work[0].Reinstall, "the work should be a reinstall")
+	Assert(t).AreEqual(work[0].State, WorkReady, "the work should be waiting for a worker")
+
+	err = p.ForceReinstall("other", "")
+	Assert(t).AreEqual(err, admin.PodNotFound, "should not have reinstalled a pod without an intent")
+
+	err = p.ForceReinstall(constants.PreparerPodID, "")
+	Assert(t).IsNotNil(err, "should not have reinstalled the preparer")
+}
+
+func TestAdminSocketIsPrivate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin_socket")
+	Assert(t).IsNil(err, "should have made a temp dir")
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "admin.sock")
+	logger := logging.TestLogger()
+
+	listener, err := listenOnAdminSocket(socket, "", &logger)
+	Assert(t).IsNil(err, "should have listened on the admin socket")
+	info, err := os.Stat(socket)
+	Assert(t).IsNil(err, "should have created the admin socket")
+	Assert(t).AreEqual(info.Mode().Perm(), os.FileMode(0600), "only the preparer's user should be able to connect")
+	listener.Close()
+
+	current, err := user.Current()
+	Assert(t).IsNil(err, "should have looked up the current user")
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Skipf("could not look up the current user's group: %s", err)
+	}
+	listener, err = listenOnAdminSocket(socket, group.Name, &logger)
+	Assert(t).IsNil(err, "should have listened on the admin socket with a group")
+	info, err = os.Stat(socket)
+	Assert(t).IsNil(err, "should have created the admin socket")
+	Assert(t).AreEqual(info.Mode().Perm(), os.FileMode(0660), "the admin group should be able to connect")
+	listener.Close()
+
+	_, err = listenOnAdminSocket(socket, "no_such_admin_group", &logger)
+	Assert(t).IsNotNil(err, "should not have listened with an unknown group")
+}
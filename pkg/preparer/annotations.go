@@ -0,0 +1,63 @@
+package preparer
+
+import (
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type podClusterFinder interface {
+	FindWhereLabeled(podID types.PodID, availabilityZone fields.AvailabilityZone, clusterName fields.ClusterName) ([]fields.PodCluster, error)
+}
+
+// podClusterAnnotator finds the pod cluster of a pod by the availability zone
+// and cluster name labels that pod clusters set on their pods
+type podClusterAnnotator struct {
+	labeler nodeLabelGetter
+	pcStore podClusterFinder
+}
+
+func (a podClusterAnnotator) PodClusterAnnotations(node types.NodeName, podID types.PodID) (map[string]interface{}, error) {
+	podLabels, err := a.labeler.GetLabels(labels.POD, labels.MakePodLabelKey(node, podID))
+	if err != nil {
+		return nil, err
+	}
+	availabilityZone := podLabels.Labels.Get(types.AvailabilityZoneLabel)
+	clusterName := podLabels.Labels.Get(types.ClusterNameLabel)
+	if availabilityZone == "" || clusterName == "" {
+		return nil, nil
+	}
+
+	podClusters, err := a.pcStore.FindWhereLabeled(podID, fields.AvailabilityZone(availabilityZone), fields.ClusterName(clusterName))
+	if err != nil {
+		return nil, err
+	}
+	switch len(podClusters) {
+	case 0:
+		return nil, nil
+	case 1:
+		return podClusters[0].Annotations, nil
+	default:
+		return nil, util.Errorf("Found %d pod clusters for pod %s in %s/%s", len(podClusters), podID, availabilityZone, clusterName)
+	}
+}
+
+// PodPlacement returns the availability zone of the node, or of the pod's pod
+// cluster if the node isn't labeled with one, and the name of the pod's pod
+// cluster
+func (a podClusterAnnotator) PodPlacement(node types.NodeName, podID types.PodID) (string, string, error) {
+	nodeLabels, err := a.labeler.GetLabels(labels.NODE, node.String())
+	if err != nil {
+		return "", "", err
+	}
+	podLabels, err := a.labeler.GetLabels(labels.POD, labels.MakePodLabelKey(node, podID))
+	if err != nil {
+		return "", "", err
+	}
+	availabilityZone := nodeLabels.Labels.Get(types.AvailabilityZoneLabel)
+	if availabilityZone == "" {
+		availabilityZone = podLabels.Labels.Get(types.AvailabilityZoneLabel)
+	}
+	return availabilityZone, podLabels.Labels.Get(types.ClusterNameLabel), nil
+}
@@ -0,0 +1,96 @@
+package preparer
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/types"
+)
+
+// AuditRecorder records the node's security-relevant events, such as manifest
+// authorizations, artifact verification failures and policy reloads, to an
+// audit chain. Like pod events, failing to record one is logged and never
+// fails the deploy.
+//
+// A nil *AuditRecorder is valid and records nothing.
+type AuditRecorder struct {
+	node  types.NodeName
+	chain audit.Recorder
+
+	mu sync.Mutex
+	// authorizations has the last authorization recorded of each pod, since
+	// a refused manifest is checked again on every loop
+	authorizations map[types.PodID]string
+}
+
+func NewAuditRecorder(node types.NodeName, chain audit.Recorder) *AuditRecorder {
+	return &AuditRecorder{
+		node:           node,
+		chain:          chain,
+		authorizations: make(map[types.PodID]string),
+	}
+}
+
+// RecordAuthorization records that the manifest was authorized if refusal is
+// nil, and refused because of refusal otherwise. It is only recorded once
+// until the manifest or the outcome changes.
+func (r *AuditRecorder) RecordAuthorization(m manifest.Manifest, refusal error, logger logging.Logger) {
+	if r == nil {
+		return
+	}
+	sha, _ := m.SHA()
+	eventType := audit.ManifestAuthorizedEvent
+	var reason string
+	if refusal != nil {
+		eventType = audit.ManifestRefusedEvent
+		reason = refusal.Error()
+	}
+
+	outcome := eventType.String() + " " + sha + " " + reason
+	r.mu.Lock()
+	recorded := r.authorizations[m.ID()] == outcome
+	r.authorizations[m.ID()] = outcome
+	r.mu.Unlock()
+	if recorded {
+		return
+	}
+
+	details, err := audit.NewManifestAuthorizationEventDetails(r.node, m.ID(), sha, reason)
+	r.record(eventType, details, err, logger)
+}
+
+// RecordVerificationFailures records the artifact verification failures of
+// an install of the pod
+func (r *AuditRecorder) RecordVerificationFailures(podID types.PodID, failures []podstatus.ArtifactVerificationFailure, logger logging.Logger) {
+	if r == nil {
+		return
+	}
+	for _, failure := range failures {
+		details, err := audit.NewArtifactVerificationFailureEventDetails(r.node, podID, failure.Policy, failure.Error)
+		r.record(audit.ArtifactVerificationFailedEvent, details, err, logger)
+	}
+}
+
+// RecordReload records a config reload that applied the fields. Reloads that
+// applied none are still recorded, since they read the keyrings of the auth
+// policies again.
+func (r *AuditRecorder) RecordReload(applied []string, logger logging.Logger) {
+	if r == nil {
+		return
+	}
+	details, err := audit.NewPolicyReloadEventDetails(r.node, applied)
+	r.record(audit.PolicyReloadEvent, details, err, logger)
+}
+
+func (r *AuditRecorder) record(eventType audit.EventType, details json.RawMessage, err error, logger logging.Logger) {
+	if err == nil {
+		err = r.chain.Record(eventType, details)
+	}
+	if err != nil {
+		logger.WithError(err).Warnf("Could not record %s audit event", eventType)
+	}
+}
@@ -0,0 +1,52 @@
+package preparer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/util"
+)
+
+type fakeAuditChain struct {
+	events []audit.EventType
+}
+
+func (f *fakeAuditChain) Record(eventType audit.EventType, _ json.RawMessage) error {
+	f.events = append(f.events, eventType)
+	return nil
+}
+
+func TestAuditRecorderRecordsAuthorizationsOnce(t *testing.T) {
+	chain := &fakeAuditChain{}
+	recorder := NewAuditRecorder("node", chain)
+	podManifest := testManifest(t)
+	refusal := util.Errorf("received unsigned manifest")
+
+	recorder.RecordAuthorization(podManifest, refusal, logging.TestLogger())
+	recorder.RecordAuthorization(podManifest, refusal, logging.TestLogger())
+	recorder.RecordAuthorization(podManifest, nil, logging.TestLogger())
+	recorder.RecordVerificationFailures(podManifest.ID(), []podstatus.ArtifactVerificationFailure{{Policy: "warn", Error: "no signature"}}, logging.TestLogger())
+	recorder.RecordReload(nil, logging.TestLogger())
+
+	expected := []audit.EventType{
+		audit.ManifestRefusedEvent,
+		audit.ManifestAuthorizedEvent,
+		audit.ArtifactVerificationFailedEvent,
+		audit.PolicyReloadEvent,
+	}
+	if len(chain.events) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, chain.events)
+	}
+	for i := range expected {
+		if chain.events[i] != expected[i] {
+			t.Errorf("expected events %v, got %v", expected, chain.events)
+			break
+		}
+	}
+
+	var nilRecorder *AuditRecorder
+	nilRecorder.RecordAuthorization(podManifest, nil, logging.TestLogger())
+}
@@ -0,0 +1,30 @@
+package preparer
+
+import (
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// ConfinementConfig controls whether pods may run without an SELinux context
+// or AppArmor profile.
+type ConfinementConfig struct {
+	// Required refuses pods whose manifests don't set a confinement
+	Required bool `yaml:"required,omitempty"`
+	// Exempt lists the pods that may run unconfined even if confinement is
+	// required
+	Exempt []types.PodID `yaml:"exempt,omitempty"`
+}
+
+// check returns an error if the manifest isn't allowed to run unconfined
+func (c ConfinementConfig) check(podManifest manifest.Manifest) error {
+	if !c.Required || podManifest.GetConfinement().Confined() {
+		return nil
+	}
+	for _, podID := range c.Exempt {
+		if podID == podManifest.ID() {
+			return nil
+		}
+	}
+	return util.Errorf("pod %s must set a confinement to run on this node", podManifest.ID())
+}
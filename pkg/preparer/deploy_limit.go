@@ -0,0 +1,108 @@
+package preparer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+)
+
+type deploySlotStore interface {
+	DeployLimit(podID types.PodID) (consul.DeployLimit, error)
+	AcquireDeploySlot(podID types.PodID, node types.NodeName, session string) (bool, error)
+	ReleaseDeploySlot(podID types.PodID, node types.NodeName) error
+	NewSession(name string, renewalCh <-chan time.Time) (consul.Session, chan error, error)
+}
+
+// deploySlots takes a slot of a pod's consul.DeployLimit before the pod is
+// installed, so that only so many nodes download the pod's artifacts at once.
+// The slots are taken with a session of the preparer's, so that the slot of a
+// preparer that dies while installing is reclaimed once the session expires.
+// Limits only protect the artifact servers, so if the store can't be reached
+// the pod is installed as if it had none.
+//
+// A nil *deploySlots takes no slots.
+type deploySlots struct {
+	store deploySlotStore
+	node  types.NodeName
+
+	mu      sync.Mutex
+	session consul.Session
+}
+
+func newDeploySlots(store deploySlotStore, node types.NodeName) *deploySlots {
+	return &deploySlots{
+		store: store,
+		node:  node,
+	}
+}
+
+// currentSession returns the session slots are taken with, creating a new one
+// if there is none yet or the last one was lost
+func (d *deploySlots) currentSession() (consul.Session, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.session != nil {
+		select {
+		case <-d.session.Lost():
+			d.session = nil
+		default:
+			return d.session, nil
+		}
+	}
+	session, _, err := d.store.NewSession("preparer-deploy-slots-"+d.node.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	d.session = session
+	return session, nil
+}
+
+// acquire takes a slot of podID's deploy limit, if it has one, returning false
+// if they are all held by other nodes
+func (d *deploySlots) acquire(podID types.PodID, logger logging.Logger) bool {
+	if d == nil {
+		return true
+	}
+	limit, err := d.store.DeployLimit(podID)
+	if consulutil.IsNotFound(err) {
+		return true
+	}
+	if err != nil {
+		logger.WithError(err).Warnln("Could not read the pod's deploy limit, installing without a deploy slot")
+		return true
+	}
+
+	session, err := d.currentSession()
+	if err != nil {
+		logger.WithError(err).Warnln("Could not create a session to take a deploy slot with, installing without one")
+		return true
+	}
+	acquired, err := d.store.AcquireDeploySlot(podID, d.node, session.Session())
+	if err != nil {
+		logger.WithError(err).Warnln("Could not take a deploy slot, installing without one")
+		return true
+	}
+	if !acquired {
+		logger.WithFields(logrus.Fields{
+			"deploy_limit": limit.Limit,
+		}).Infoln("Every deploy slot of the pod is held by other nodes, will retry")
+	}
+	return acquired
+}
+
+// release gives back the slot of podID's deploy limit taken by acquire, if any
+func (d *deploySlots) release(podID types.PodID, logger logging.Logger) {
+	if d == nil {
+		return
+	}
+	err := d.store.ReleaseDeploySlot(podID, d.node)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not give back the deploy slot, it stays held until the pod is next installed")
+	}
+}
@@ -0,0 +1,79 @@
+package preparer
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consultest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type fakeDeploySlotStore struct {
+	limits   map[types.PodID]int
+	holders  map[types.PodID]map[types.NodeName]bool
+	sessions int
+	failing  bool
+}
+
+func (f *fakeDeploySlotStore) DeployLimit(podID types.PodID) (consul.DeployLimit, error) {
+	if f.failing {
+		return consul.DeployLimit{}, util.Errorf("consul is down")
+	}
+	limit, ok := f.limits[podID]
+	if !ok {
+		return consul.DeployLimit{}, consulutil.NotFoundError{Key: podID.String()}
+	}
+	return consul.DeployLimit{Limit: limit}, nil
+}
+
+func (f *fakeDeploySlotStore) AcquireDeploySlot(podID types.PodID, node types.NodeName, session string) (bool, error) {
+	if f.holders[podID] == nil {
+		f.holders[podID] = make(map[types.NodeName]bool)
+	}
+	if !f.holders[podID][node] && len(f.holders[podID]) >= f.limits[podID] {
+		return false, nil
+	}
+	f.holders[podID][node] = true
+	return true, nil
+}
+
+func (f *fakeDeploySlotStore) ReleaseDeploySlot(podID types.PodID, node types.NodeName) error {
+	delete(f.holders[podID], node)
+	return nil
+}
+
+func (f *fakeDeploySlotStore) NewSession(name string, renewalCh <-chan time.Time) (consul.Session, chan error, error) {
+	f.sessions++
+	return consultest.NewSession(), nil, nil
+}
+
+func TestDeploySlots(t *testing.T) {
+	store := &fakeDeploySlotStore{
+		limits:  map[types.PodID]int{"web": 1},
+		holders: map[types.PodID]map[types.NodeName]bool{"web": {"other_node": true}},
+	}
+	slots := newDeploySlots(store, "node")
+
+	Assert(t).IsTrue(slots.acquire("unlimited", logging.DefaultLogger), "should have installed a pod without a deploy limit")
+	Assert(t).AreEqual(store.sessions, 0, "should not have needed a session for a pod without a deploy limit")
+	Assert(t).IsFalse(slots.acquire("web", logging.DefaultLogger), "should have waited for the slot held by another node")
+
+	slots.release("web", logging.DefaultLogger)
+	store.ReleaseDeploySlot("web", "other_node")
+	Assert(t).IsTrue(slots.acquire("web", logging.DefaultLogger), "should have taken the free slot")
+	Assert(t).IsTrue(store.holders["web"]["node"], "should have held the slot")
+	Assert(t).AreEqual(store.sessions, 1, "should have reused the session")
+	slots.release("web", logging.DefaultLogger)
+	Assert(t).IsFalse(store.holders["web"]["node"], "should have given back the slot")
+
+	store.failing = true
+	Assert(t).IsTrue(slots.acquire("web", logging.DefaultLogger), "should have installed without a slot when the store is down")
+
+	var none *deploySlots
+	Assert(t).IsTrue(none.acquire("web", logging.DefaultLogger), "no deploy slots should have allowed every install")
+}
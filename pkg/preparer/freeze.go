@@ -0,0 +1,77 @@
+package preparer
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/freeze"
+	"github.com/square/p2/pkg/freeze/fields"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// deployFreezes holds the deploys of pods covered by an active freeze, by
+// global freezes, those of the pod's pod cluster and those selecting the node.
+// Only installs and updates of intents are held: a pod removed from the intent
+// is still removed, and an intent marked as an emergency is deployed anyway.
+//
+// A nil *deployFreezes holds nothing.
+type deployFreezes struct {
+	checker freeze.Checker
+	labeler nodeLabelGetter
+	node    types.NodeName
+}
+
+func newDeployFreezes(checker freeze.Checker, labeler nodeLabelGetter, node types.NodeName) *deployFreezes {
+	return &deployFreezes{
+		checker: checker,
+		labeler: labeler,
+		node:    node,
+	}
+}
+
+// holds returns true if intent may not be deployed yet because of a freeze.
+// Freezes exist to stop deploys, so one that can't be checked holds the deploy
+// until it can.
+func (d *deployFreezes) holds(podID types.PodID, intent manifest.Manifest, logger logging.Logger) bool {
+	if d == nil || intent == nil {
+		return false
+	}
+
+	nodeLabels, err := d.labeler.GetLabels(labels.NODE, d.node.String())
+	if err != nil {
+		logger.WithError(err).Errorln("Could not read the node's labels to check for freezes, holding the deploy")
+		return true
+	}
+	podLabels, err := d.labeler.GetLabels(labels.POD, labels.MakePodLabelKey(d.node, podID))
+	if err != nil {
+		logger.WithError(err).Errorln("Could not read the pod's labels to check for freezes, holding the deploy")
+		return true
+	}
+	frozen, err := d.checker.Frozen(fields.Target{
+		PodID:      podID,
+		PodLabels:  podLabels.Labels,
+		NodeLabels: nodeLabels.Labels,
+	}, time.Now())
+	if err != nil {
+		logger.WithError(err).Errorln("Could not check for freezes, holding the deploy")
+		return true
+	}
+	if frozen == nil {
+		return false
+	}
+
+	freezeLogger := logger.SubLogger(logrus.Fields{
+		"freeze":        frozen.ID,
+		"freeze_reason": frozen.Reason,
+	})
+	if intent.GetEmergency() {
+		freezeLogger.NoFields().Warnln("Deploying an emergency manifest despite a freeze")
+		return false
+	}
+	freezeLogger.NoFields().Infoln("The pod is frozen, will deploy it once the freeze ends")
+	return true
+}
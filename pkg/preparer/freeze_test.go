@@ -0,0 +1,64 @@
+package preparer
+
+import (
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/freeze"
+	"github.com/square/p2/pkg/freeze/fields"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type fakeFreezes struct {
+	freezes []fields.Freeze
+	failing bool
+}
+
+func (f fakeFreezes) List() ([]fields.Freeze, error) {
+	if f.failing {
+		return nil, util.Errorf("consul is down")
+	}
+	return f.freezes, nil
+}
+
+func TestDeployFreezes(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	err := applicator.SetLabel(labels.NODE, "node", "rack", "r1")
+	Assert(t).IsNil(err, "test setup: could not label node")
+	err = applicator.SetLabel(labels.POD, "node/web", types.AvailabilityZoneLabel, "az1")
+	Assert(t).IsNil(err, "test setup: could not label pod")
+	err = applicator.SetLabel(labels.POD, "node/web", types.ClusterNameLabel, "prod")
+	Assert(t).IsNil(err, "test setup: could not label pod")
+
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	intent := builder.GetManifest()
+	builder = intent.GetBuilder()
+	builder.SetEmergency(true)
+	emergency := builder.GetManifest()
+
+	var nilFreezes *deployFreezes
+	Assert(t).IsFalse(nilFreezes.holds("web", intent, logging.DefaultLogger), "nil freezes should hold nothing")
+
+	freezes := newDeployFreezes(freeze.NewChecker(fakeFreezes{freezes: []fields.Freeze{
+		{ID: "web", PodCluster: &fields.PodCluster{PodID: "web", AvailabilityZone: "az1", ClusterName: "prod"}},
+		{ID: "rack", NodeSelector: "rack=r2"},
+	}}), applicator, "node")
+	Assert(t).IsTrue(freezes.holds("web", intent, logging.DefaultLogger), "should have held the frozen pod cluster")
+	Assert(t).IsFalse(freezes.holds("web", emergency, logging.DefaultLogger), "should not have held an emergency manifest")
+	Assert(t).IsFalse(freezes.holds("web", nil, logging.DefaultLogger), "should not have held the removal of the pod")
+	Assert(t).IsFalse(freezes.holds("db", intent, logging.DefaultLogger), "should not have held a pod no freeze covers")
+
+	freezes = newDeployFreezes(freeze.NewChecker(fakeFreezes{freezes: []fields.Freeze{
+		{ID: "rack", NodeSelector: "rack=r1"},
+	}}), applicator, "node")
+	Assert(t).IsTrue(freezes.holds("db", intent, logging.DefaultLogger), "should have held the pods of a frozen node")
+
+	freezes = newDeployFreezes(freeze.NewChecker(fakeFreezes{failing: true}), applicator, "node")
+	Assert(t).IsTrue(freezes.holds("web", intent, logging.DefaultLogger), "should have held the deploy when freezes can't be read")
+}
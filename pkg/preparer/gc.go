@@ -0,0 +1,297 @@
+package preparer
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/hoist"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+)
+
+const (
+	// How often garbage is collected when artifact_gc's interval isn't set
+	DefaultGCInterval = time.Hour
+	// How old installs and cached artifacts must be to be collected when
+	// artifact_gc's min_age isn't set
+	DefaultGCMinAge = time.Hour
+)
+
+// Why an install or cached artifact was collected
+const (
+	// The install was older than the launchable's keep_installs most recent
+	// ones
+	GCReasonKeepInstalls = "keep_installs"
+	// The installs and cached artifacts took up more than max_size
+	GCReasonMaxSize = "max_size"
+)
+
+// GCConfig configures the preparer's garbage collector, which removes the
+// old installs of the node's launchables and the cached artifacts that are no
+// longer needed, so that years of old releases don't fill the node's disk.
+type GCConfig struct {
+	// Interval is how often garbage is collected, by default
+	// DefaultGCInterval
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// KeepInstalls is how many of the most recent installs of each
+	// launchable are kept besides the ones its current and last symlinks
+	// point to, which are never removed. Older installs are removed.
+	KeepInstalls int `yaml:"keep_installs,omitempty"`
+
+	// MaxSize, if set, is how much space the node's installs and cached
+	// artifacts may take up in total. While they take up more, the oldest
+	// installs and least recently used cached artifacts are removed, even
+	// ones KeepInstalls would keep.
+	MaxSize size.ByteCount `yaml:"max_size,omitempty"`
+
+	// MinAge is how long ago an install must have been made, or a cached
+	// artifact used, for it to be removed, by default DefaultGCMinAge. It
+	// keeps garbage collection away from what a deploy has just installed.
+	MinAge time.Duration `yaml:"min_age,omitempty"`
+
+	// DryRun, if set, has the garbage collector only log what it would
+	// remove
+	DryRun bool `yaml:"dry_run,omitempty"`
+}
+
+func (c GCConfig) interval() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultGCInterval
+	}
+	return c.Interval
+}
+
+func (c GCConfig) minAge() time.Duration {
+	if c.MinAge <= 0 {
+		return DefaultGCMinAge
+	}
+	return c.MinAge
+}
+
+func (c GCConfig) validate() error {
+	if c.KeepInstalls < 0 {
+		return util.Errorf("artifact_gc's keep_installs must not be negative")
+	}
+	return nil
+}
+
+// GCItem is an install or cached artifact that was collected
+type GCItem struct {
+	// The path of an install, empty for a cached artifact
+	Path string
+	// The pod and launchable of an install
+	PodID        types.PodID
+	LaunchableID launch.LaunchableID
+	// The digest of a cached artifact, empty for an install
+	CachedDigest string
+
+	Size size.ByteCount
+	// When the install was made or the cached artifact last used
+	ModTime time.Time
+	// One of the GCReason constants
+	Reason string
+}
+
+// GCReport is what a garbage collection removed, or would have removed if it
+// was a dry run
+type GCReport struct {
+	DryRun    bool
+	Removed   []GCItem
+	Reclaimed size.ByteCount
+}
+
+type installLister interface {
+	Installs() ([]hoist.Install, error)
+}
+
+// gcCandidates lists the node's installs, grouped by launchable and newest
+// first, and the cached artifacts that aren't in use, along with the total
+// space they take up
+func (p *Preparer) gcCandidates() ([][]GCItem, []GCItem, size.ByteCount) {
+	var installs [][]GCItem
+	var total size.ByteCount
+	for _, installed := range p.installedPods() {
+		launchables, err := installed.pod.Launchables(installed.manifest)
+		if err != nil {
+			installed.logger.WithError(err).Warnln("Could not find the pod's installs to collect")
+			continue
+		}
+		for _, l := range launchables {
+			lister, ok := l.(installLister)
+			if !ok {
+				// launchables other than hoist ones prune themselves
+				continue
+			}
+			launchableInstalls, err := lister.Installs()
+			if err != nil {
+				installed.logger.WithError(err).Warnln("Could not list the launchable's installs")
+				continue
+			}
+			var removable []GCItem
+			for _, install := range launchableInstalls {
+				total += install.Size
+				if install.Kept {
+					continue
+				}
+				removable = append(removable, GCItem{
+					Path:         install.Path,
+					PodID:        installed.pod.Id,
+					LaunchableID: l.ID(),
+					Size:         install.Size,
+					ModTime:      install.ModTime,
+				})
+			}
+			installs = append(installs, removable)
+		}
+	}
+
+	var cached []GCItem
+	if p.artifactCache != nil {
+		artifacts, err := p.artifactCache.Artifacts()
+		if err != nil {
+			p.Logger.WithError(err).Warnln("Could not list the cached artifacts to collect")
+		}
+		for _, artifact := range artifacts {
+			total += artifact.Size
+			cached = append(cached, GCItem{
+				CachedDigest: artifact.Digest,
+				Size:         artifact.Size,
+				ModTime:      artifact.LastUsed,
+			})
+		}
+	}
+	return installs, cached, total
+}
+
+// planGC returns which of the removable installs of each launchable (newest
+// first) and cached artifacts config has collected at now, given the total
+// space taken up by every install and cached artifact
+func planGC(config GCConfig, now time.Time, installs [][]GCItem, cached []GCItem, total size.ByteCount) []GCItem {
+	minAge := config.minAge()
+	var remove []GCItem
+	var overSize []GCItem
+	for _, launchableInstalls := range installs {
+		for i, install := range launchableInstalls {
+			if now.Sub(install.ModTime) < minAge {
+				continue
+			}
+			if i >= config.KeepInstalls {
+				install.Reason = GCReasonKeepInstalls
+				remove = append(remove, install)
+				total -= install.Size
+			} else {
+				overSize = append(overSize, install)
+			}
+		}
+	}
+	for _, artifact := range cached {
+		if now.Sub(artifact.ModTime) >= minAge {
+			overSize = append(overSize, artifact)
+		}
+	}
+
+	if config.MaxSize <= 0 || total <= config.MaxSize {
+		return remove
+	}
+	sort.Sort(gcItemsByAge(overSize))
+	for _, item := range overSize {
+		if total <= config.MaxSize {
+			break
+		}
+		item.Reason = GCReasonMaxSize
+		remove = append(remove, item)
+		total -= item.Size
+	}
+	return remove
+}
+
+type gcItemsByAge []GCItem
+
+func (g gcItemsByAge) Len() int           { return len(g) }
+func (g gcItemsByAge) Less(i, j int) bool { return g[i].ModTime.Before(g[j].ModTime) }
+func (g gcItemsByAge) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
+
+// CollectGarbage removes the installs and cached artifacts that the garbage
+// collector's config doesn't keep, or only logs them in a dry run. Work on
+// pods waits for the collection, so that an install isn't removed while a
+// deploy is switching back to it.
+func (p *Preparer) CollectGarbage() (GCReport, error) {
+	if p.gc == nil {
+		return GCReport{}, util.Errorf("No garbage collector configured")
+	}
+	config := *p.gc
+
+	p.workMu.Lock()
+	defer p.workMu.Unlock()
+
+	installs, cached, total := p.gcCandidates()
+	report := GCReport{DryRun: config.DryRun}
+	for _, item := range planGC(config, time.Now(), installs, cached, total) {
+		fields := logrus.Fields{
+			"size":    item.Size.String(),
+			"reason":  item.Reason,
+			"dry_run": config.DryRun,
+		}
+		if item.CachedDigest != "" {
+			fields["cached_digest"] = item.CachedDigest
+		} else {
+			fields["pod"] = item.PodID
+			fields["launchable"] = item.LaunchableID
+			fields["path"] = item.Path
+		}
+		logger := p.Logger.SubLogger(fields)
+
+		if !config.DryRun {
+			var err error
+			if item.CachedDigest != "" {
+				err = p.artifactCache.Remove(item.CachedDigest)
+			} else {
+				err = os.RemoveAll(item.Path)
+			}
+			if err != nil {
+				logger.WithError(err).Warnln("Could not remove garbage")
+				continue
+			}
+		}
+		logger.NoFields().Infoln("Collected garbage")
+		report.Removed = append(report.Removed, item)
+		report.Reclaimed += item.Size
+	}
+
+	if !config.DryRun {
+		p.metrics.gcReclaimed(report.Reclaimed)
+	}
+	p.Logger.WithFields(logrus.Fields{
+		"removed":   len(report.Removed),
+		"reclaimed": report.Reclaimed.String(),
+		"dry_run":   config.DryRun,
+	}).Infoln("Finished collecting garbage")
+	return report, nil
+}
+
+// RunGC collects garbage every artifact_gc interval until quit is closed. It
+// does nothing if the garbage collector isn't configured or in observe-only
+// mode.
+func (p *Preparer) RunGC(quit <-chan struct{}) {
+	if p.gc == nil || p.Observations != nil {
+		<-quit
+		return
+	}
+	for {
+		select {
+		case <-quit:
+			return
+		case <-time.After(p.gc.interval()):
+		}
+		_, err := p.CollectGarbage()
+		if err != nil {
+			p.Logger.WithError(err).Warnln("Could not collect garbage")
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/util/size"
+)
+
+func gcItemNames(items []GCItem) string {
+	var names []string
+	for _, item := range items {
+		name := filepath.Base(item.Path)
+		if item.CachedDigest != "" {
+			name = item.CachedDigest
+		}
+		names = append(names, name+":"+item.Reason)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestPlanGC(t *testing.T) {
+	now := time.Now()
+	item := func(name string, age time.Duration) GCItem {
+		return GCItem{Path: "/data/pods/hello/app/installs/" + name, Size: size.Kibibyte, ModTime: now.Add(-age)}
+	}
+	installs := [][]GCItem{
+		{item("v5", time.Minute), item("v4", 2*time.Hour), item("v3", 3*time.Hour), item("v2", 4*time.Hour)},
+		{item("other1", 10*time.Hour)},
+	}
+	cached := []GCItem{{CachedDigest: "abc", Size: size.Kibibyte, ModTime: now.Add(-5 * time.Hour)}}
+
+	remove := planGC(GCConfig{KeepInstalls: 2}, now, installs, cached, 10*size.Kibibyte)
+	Assert(t).AreEqual(gcItemNames(remove), "v3:keep_installs,v2:keep_installs", "should have kept the most recent installs of each launchable")
+
+	remove = planGC(GCConfig{KeepInstalls: 1, MinAge: 5 * time.Hour}, now, installs, cached, 10*size.Kibibyte)
+	Assert(t).AreEqual(gcItemNames(remove), "", "should not have removed anything younger than the min age")
+
+	remove = planGC(GCConfig{KeepInstalls: 2, MaxSize: 6 * size.Kibibyte}, now, installs, cached, 10*size.Kibibyte)
+	Assert(t).AreEqual(gcItemNames(remove), "v3:keep_installs,v2:keep_installs,other1:max_size,abc:max_size", "should have removed the oldest until under the max size")
+}
+
+func TestCollectGarbage(t *testing.T) {
+	p, _, podRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(podRoot)
+	registry := metrics.NewRegistry()
+	p.metrics = newPreparerMetrics(registry)
+
+	podManifest := testManifest(t)
+	pod, err := p.newPod(podManifest.ID(), "")
+	Assert(t).IsNil(err, "test setup: could not make pod")
+	err = os.MkdirAll(pod.Home(), 0755)
+	Assert(t).IsNil(err, "test setup: could not make pod home")
+	manifestBytes, err := podManifest.Marshal()
+	Assert(t).IsNil(err, "test setup: could not marshal manifest")
+	err = ioutil.WriteFile(filepath.Join(pod.Home(), "current_manifest.yaml"), manifestBytes, 0644)
+	Assert(t).IsNil(err, "test setup: could not write the pod's manifest")
+	launchableDir := filepath.Join(podRoot, podManifest.ID().String(), "app")
+	for i, name := range []string{"v1", "v2", "v3"} {
+		install := filepath.Join(launchableDir, "installs", name)
+		err = os.MkdirAll(install, 0755)
+		Assert(t).IsNil(err, "test setup: could not make install")
+		err = ioutil.WriteFile(filepath.Join(install, "payload"), make([]byte, 1024), 0644)
+		Assert(t).IsNil(err, "test setup: could not write install")
+		installed := time.Now().Add(time.Duration(i-10) * time.Hour)
+		err = os.Chtimes(install, installed, installed)
+		Assert(t).IsNil(err, "test setup: could not age install")
+	}
+	err = os.Symlink(filepath.Join(launchableDir, "installs", "v1"), filepath.Join(launchableDir, "current"))
+	Assert(t).IsNil(err, "test setup: could not link current install")
+
+	p.gc = &GCConfig{DryRun: true}
+	report, err := p.CollectGarbage()
+	Assert(t).IsNil(err, "should have collected garbage")
+	Assert(t).AreEqual(gcItemNames(report.Removed), "v3:keep_installs,v2:keep_installs", "should have reported the installs that would be removed")
+	_, err = os.Stat(filepath.Join(launchableDir, "installs", "v2"))
+	Assert(t).IsNil(err, "should not have removed anything in a dry run")
+
+	p.gc = &GCConfig{}
+	report, err = p.CollectGarbage()
+	Assert(t).IsNil(err, "should have collected garbage")
+	Assert(t).AreEqual(report.Reclaimed, 2*size.Kibibyte, "should have reclaimed the removed installs")
+	for _, name := range []string{"v2", "v3"} {
+		_, err = os.Stat(filepath.Join(launchableDir, "installs", name))
+		Assert(t).IsTrue(os.IsNotExist(err), "should have removed "+name)
+	}
+	_, err = os.Stat(filepath.Join(launchableDir, "installs", "v1"))
+	Assert(t).IsNil(err, "should not have removed the current install")
+	Assert(t).AreEqual(metrics.GetOrRegisterCounter(GCReclaimedBytesMetric, registry).Count(), int64(2*size.Kibibyte), "should have counted the reclaimed bytes")
+}
@@ -0,0 +1,167 @@
+package preparer
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/param"
+	"github.com/square/p2/pkg/version"
+)
+
+// HeartbeatIntervalSec is how often the preparer writes its heartbeat.
+// Readers of heartbeats should allow for several intervals before treating a
+// node as stale.
+var HeartbeatIntervalSec = param.Int("heartbeat_interval_sec", 15)
+
+// The names of the loops whose last pass is recorded in the heartbeat
+const (
+	// An intent watch result was received
+	PodWatchLoop = "pod_watch"
+	// A pod was worked on
+	PodWorkLoop = "pod_work"
+)
+
+type heartbeatStore interface {
+	SetHeartbeat(node types.NodeName, heartbeat consul.Heartbeat) error
+}
+
+// HeartbeatWriter periodically records in the store that the preparer is
+// alive, when its loops last made a pass, and how much disk and memory the
+// node has left, so that schedulers can avoid nodes whose preparer is dead or
+// stuck.
+//
+// A nil *HeartbeatWriter is valid and records nothing.
+type HeartbeatWriter struct {
+	node        types.NodeName
+	store       heartbeatStore
+	podRoot     string
+	observeOnly bool
+	started     time.Time
+	logger      logging.Logger
+
+	mu    sync.Mutex
+	loops map[string]time.Time
+}
+
+func NewHeartbeatWriter(node types.NodeName, store heartbeatStore, podRoot string, observeOnly bool, logger logging.Logger) *HeartbeatWriter {
+	return &HeartbeatWriter{
+		node:        node,
+		store:       store,
+		podRoot:     podRoot,
+		observeOnly: observeOnly,
+		started:     time.Now(),
+		logger:      logger,
+		loops:       make(map[string]time.Time),
+	}
+}
+
+// LoopPassed records that the named loop has made a pass
+func (h *HeartbeatWriter) LoopPassed(name string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.loops[name] = time.Now()
+}
+
+// Heartbeat returns the heartbeat that would be written now
+func (h *HeartbeatWriter) Heartbeat() consul.Heartbeat {
+	h.mu.Lock()
+	loops := make(map[string]time.Time, len(h.loops))
+	for name, passed := range h.loops {
+		loops[name] = passed
+	}
+	h.mu.Unlock()
+
+	heartbeat := consul.Heartbeat{
+		Time:            time.Now(),
+		StartTime:       h.started,
+		PreparerVersion: version.VERSION,
+		ObserveOnly:     h.observeOnly,
+		LoopTimes:       loops,
+	}
+	disk, err := availableDisk(h.podRoot)
+	if err != nil {
+		h.logger.WithError(err).Warnln("Could not check the disk space available for the heartbeat")
+	}
+	heartbeat.DiskAvailable = disk
+	heartbeat.MemoryAvailable = availableMemory()
+	return heartbeat
+}
+
+// Write writes the current heartbeat to the store
+func (h *HeartbeatWriter) Write() error {
+	if h == nil {
+		return nil
+	}
+	return h.store.SetHeartbeat(h.node, h.Heartbeat())
+}
+
+// Run writes the heartbeat every HeartbeatIntervalSec until quit is closed.
+func (h *HeartbeatWriter) Run(quit <-chan struct{}) {
+	if h == nil {
+		return
+	}
+	for {
+		err := h.Write()
+		if err != nil {
+			h.logger.WithError(err).Warnln("Could not write heartbeat")
+		}
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(time.Duration(*HeartbeatIntervalSec) * time.Second):
+		}
+	}
+}
+
+// availableDisk returns the space available to unprivileged users on the
+// filesystem of path
+func availableDisk(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// availableMemory returns the MemAvailable of /proc/meminfo in bytes, or 0 if
+// it can't be read, as on platforms other than linux
+func availableMemory() int64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	return parseMemAvailable(f)
+}
+
+// parseMemAvailable reads MemAvailable from the contents of /proc/meminfo,
+// where it is given in kB
+func parseMemAvailable(meminfo io.Reader) int64 {
+	scanner := bufio.NewScanner(meminfo)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
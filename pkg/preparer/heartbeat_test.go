@@ -0,0 +1,60 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+type fakeHeartbeatStore struct {
+	written map[types.NodeName]consul.Heartbeat
+}
+
+func (f *fakeHeartbeatStore) SetHeartbeat(node types.NodeName, heartbeat consul.Heartbeat) error {
+	f.written[node] = heartbeat
+	return nil
+}
+
+func TestHeartbeatWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heartbeat")
+	Assert(t).IsNil(err, "test setup: could not create temp dir")
+	defer os.RemoveAll(dir)
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.SetLogOut(ioutil.Discard)
+	store := &fakeHeartbeatStore{written: make(map[types.NodeName]consul.Heartbeat)}
+
+	writer := NewHeartbeatWriter("node1", store, dir, true, logger)
+	writer.LoopPassed(PodWatchLoop)
+	err = writer.Write()
+	Assert(t).IsNil(err, "should have written the heartbeat")
+
+	heartbeat, ok := store.written["node1"]
+	Assert(t).IsTrue(ok, "should have written the node's heartbeat")
+	Assert(t).AreEqual(heartbeat.PreparerVersion, version.VERSION, "should have recorded the preparer's version")
+	Assert(t).IsTrue(heartbeat.ObserveOnly, "should have recorded observe-only mode")
+	Assert(t).IsTrue(heartbeat.Uptime() >= 0, "should have recorded the start time")
+	Assert(t).IsTrue(heartbeat.DiskAvailable > 0, "should have recorded the available disk")
+	_, ok = heartbeat.LoopTimes[PodWatchLoop]
+	Assert(t).IsTrue(ok, "should have recorded the pod watch's last pass")
+	_, ok = heartbeat.LoopTimes[PodWorkLoop]
+	Assert(t).IsFalse(ok, "should not have recorded a loop that never made a pass")
+
+	var nilWriter *HeartbeatWriter
+	nilWriter.LoopPassed(PodWorkLoop)
+	Assert(t).IsNil(nilWriter.Write(), "a nil writer should write nothing")
+}
+
+func TestParseMemAvailable(t *testing.T) {
+	meminfo := "MemTotal:       16318460 kB\nMemFree:         1166540 kB\nMemAvailable:    9442312 kB\n"
+	Assert(t).AreEqual(parseMemAvailable(strings.NewReader(meminfo)), int64(9442312*1024), "wrong available memory")
+	Assert(t).AreEqual(parseMemAvailable(strings.NewReader("MemTotal: 16318460 kB\n")), int64(0), "should be 0 without MemAvailable")
+}
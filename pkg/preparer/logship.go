@@ -0,0 +1,108 @@
+package preparer
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/logship"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// LogShippingIntervalMs is how often the new output of the node's pods is
+// shipped
+var LogShippingIntervalMs = param.Int("log_shipping_interval_ms", 1000)
+
+// LogShippingRescanSec is how often the pod root is scanned for the services
+// whose output is shipped
+var LogShippingRescanSec = param.Int("log_shipping_rescan_sec", 30)
+
+func (c *PreparerConfig) logForwarder(logger logging.Logger) (*logship.Forwarder, error) {
+	if c.LogShipping == nil {
+		return nil, nil
+	}
+	client, err := c.GetClient(30 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := logship.NewSink(*c.LogShipping, client)
+	if err != nil {
+		return nil, err
+	}
+	return logship.NewForwarder(sink, c.LogShipping.Fields, c.LogShipping.MaxPending, logger), nil
+}
+
+// logSources returns the log files of the services of every pod under the pod
+// root that hasn't opted out of log shipping
+func (p *Preparer) logSources() []logship.Source {
+	var sources []logship.Source
+	for _, installed := range p.installedPods() {
+		logShipping := installed.manifest.GetLogShipping()
+		if logShipping != nil && logShipping.Disabled {
+			continue
+		}
+		launchables, err := installed.pod.Launchables(installed.manifest)
+		if err != nil {
+			installed.logger.WithError(err).Warnln("Could not find the services to ship logs of")
+			continue
+		}
+		redaction := installed.pod.RedactionFor(installed.manifest)
+		for _, launchable := range launchables {
+			executables, err := launchable.Executables(installed.pod.ServiceBuilder)
+			if err != nil {
+				installed.logger.WithError(err).Warnln("Could not find the services to ship logs of")
+				continue
+			}
+			for _, executable := range executables {
+				fields := map[string]string{
+					"node":       p.node.String(),
+					"pod_id":     installed.pod.Id.String(),
+					"launchable": launchable.ID().String(),
+					"service":    executable.ServiceName,
+				}
+				if installed.pod.UniqueKey() != "" {
+					fields["pod_unique_key"] = installed.pod.UniqueKey().String()
+				}
+				if logShipping != nil {
+					for key, value := range logShipping.Fields {
+						fields[key] = value
+					}
+				}
+				sources = append(sources, logship.Source{
+					Path:      filepath.Join(executable.LogAgent.Path, "main", "current"),
+					Fields:    fields,
+					Redaction: redaction,
+				})
+			}
+		}
+	}
+	return sources
+}
+
+// RunLogShipping ships the output of the node's pods every
+// LogShippingIntervalMs until quit is closed. It does nothing if log shipping
+// isn't configured or in observe-only mode.
+func (p *Preparer) RunLogShipping(quit <-chan struct{}) {
+	if p.logForwarder == nil || p.Observations != nil {
+		<-quit
+		return
+	}
+
+	var sources []logship.Source
+	var scanned time.Time
+	for {
+		select {
+		case <-quit:
+			return
+		case <-time.After(time.Duration(*LogShippingIntervalMs) * time.Millisecond):
+		}
+		if time.Since(scanned) > time.Duration(*LogShippingRescanSec)*time.Second {
+			sources = p.logSources()
+			scanned = time.Now()
+		}
+		err := p.logForwarder.Forward(sources)
+		if err != nil {
+			p.Logger.WithError(err).Warnln("Could not ship pod logs")
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package preparer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/util/size"
+)
+
+const (
+	InstallsMetric        = "preparer_installs"
+	InstallFailuresMetric = "preparer_install_failures"
+	InstallDurationMetric = "preparer_install_duration"
+
+	// Outcomes of verifying the digests of an installed pod
+	VerificationPassedMetric = "preparer_verification_passed"
+	VerificationFailedMetric = "preparer_verification_failed"
+
+	// How long work on a pod waits for a worker once the watch has handed
+	// it over
+	WatchLoopLagMetric = "preparer_watch_loop_lag"
+
+	// The bytes of installs and cached artifacts removed by the garbage
+	// collector
+	GCReclaimedBytesMetric = "preparer_gc_reclaimed_bytes"
+)
+
+// preparerMetrics records what the preparer does with the node's pods in a
+// metrics registry, for the status server's /metrics endpoint.
+//
+// A nil *preparerMetrics is valid and records nothing.
+type preparerMetrics struct {
+	registry metrics.Registry
+}
+
+func newPreparerMetrics(registry metrics.Registry) *preparerMetrics {
+	return &preparerMetrics{registry: registry}
+}
+
+// install records an install of a pod that started at start
+func (m *preparerMetrics) install(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	metrics.GetOrRegisterTimer(InstallDurationMetric, m.registry).UpdateSince(start)
+	if err != nil {
+		metrics.GetOrRegisterCounter(InstallFailuresMetric, m.registry).Inc(1)
+	} else {
+		metrics.GetOrRegisterCounter(InstallsMetric, m.registry).Inc(1)
+	}
+}
+
+// gcReclaimed records that the garbage collector removed reclaimed bytes
+func (m *preparerMetrics) gcReclaimed(reclaimed size.ByteCount) {
+	if m == nil {
+		return
+	}
+	metrics.GetOrRegisterCounter(GCReclaimedBytesMetric, m.registry).Inc(int64(reclaimed))
+}
+
+// verification records the outcome of verifying an installed pod
+func (m *preparerMetrics) verification(err error) {
+	if m == nil {
+		return
+	}
+	name := VerificationPassedMetric
+	if err != nil {
+		name = VerificationFailedMetric
+	}
+	metrics.GetOrRegisterCounter(name, m.registry).Inc(1)
+}
+
+// artifactVerificationAllowed records an artifact that failed verification
+// and was installed anyway because of the verification policy
+func (m *preparerMetrics) artifactVerificationAllowed(policy string) {
+	if m == nil {
+		return
+	}
+	metrics.GetOrRegisterCounter(fmt.Sprintf("preparer_verification_allowed_%s", policy), m.registry).Inc(1)
+}
+
+// hookRun records a run of the hooks of a type that started at start
+func (m *preparerMetrics) hookRun(hookType hooks.HookType, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	metrics.GetOrRegisterTimer(fmt.Sprintf("preparer_hooks_%s", hookType), m.registry).UpdateSince(start)
+	if err != nil {
+		metrics.GetOrRegisterCounter(fmt.Sprintf("preparer_hooks_%s_failures", hookType), m.registry).Inc(1)
+	}
+}
+
+func (m *preparerMetrics) watchLoopLag() metrics.Timer {
+	if m == nil {
+		return metrics.NilTimer{}
+	}
+	return metrics.GetOrRegisterTimer(WatchLoopLagMetric, m.registry)
+}
@@ -0,0 +1,73 @@
+package preparer
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+func TestPreparerRecordsInstallMetrics(t *testing.T) {
+	testPod := &TestPod{
+		launchSuccess: true,
+	}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, hooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	registry := metrics.NewRegistry()
+	p.metrics = newPreparerMetrics(registry)
+	hooks.afterLaunchErr = fmt.Errorf("hook failed")
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "should have succeeded")
+
+	Assert(t).AreEqual(metrics.GetOrRegisterCounter(InstallsMetric, registry).Count(), int64(1), "should have counted the install")
+	Assert(t).AreEqual(metrics.GetOrRegisterCounter(InstallFailuresMetric, registry).Count(), int64(0), "should not have counted a failed install")
+	Assert(t).AreEqual(metrics.GetOrRegisterTimer(InstallDurationMetric, registry).Count(), int64(1), "should have timed the install")
+	Assert(t).AreEqual(metrics.GetOrRegisterCounter(VerificationPassedMetric, registry).Count(), int64(1), "should have counted the verification")
+	Assert(t).AreEqual(metrics.GetOrRegisterTimer("preparer_hooks_after_launch", registry).Count(), int64(1), "should have timed the after launch hooks")
+	Assert(t).AreEqual(metrics.GetOrRegisterCounter("preparer_hooks_after_launch_failures", registry).Count(), int64(1), "should have counted the hook failure")
+}
+
+func TestPreparerRecordsInstallFailureMetrics(t *testing.T) {
+	testPod := &TestPod{
+		installErr: fmt.Errorf("There was an error installing"),
+	}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	registry := metrics.NewRegistry()
+	p.metrics = newPreparerMetrics(registry)
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "should have failed")
+
+	Assert(t).AreEqual(metrics.GetOrRegisterCounter(InstallFailuresMetric, registry).Count(), int64(1), "should have counted the failed install")
+	Assert(t).AreEqual(metrics.GetOrRegisterCounter(InstallsMetric, registry).Count(), int64(0), "should not have counted an install")
+	Assert(t).AreEqual(metrics.GetOrRegisterCounter(VerificationPassedMetric, registry).Count(), int64(0), "should not have verified a failed install")
+}
+
+func TestNilPreparerMetrics(t *testing.T) {
+	var m *preparerMetrics
+	m.install(time.Now(), nil)
+	m.verification(nil)
+	m.hookRun("after_launch", time.Now(), nil)
+	m.watchLoopLag().Update(time.Second)
+}
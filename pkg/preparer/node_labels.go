@@ -0,0 +1,108 @@
+package preparer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/param"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// NodeLabelRefreshSec is how often the node label snapshot is re-read.
+var NodeLabelRefreshSec = param.Int("node_label_refresh_sec", 60)
+
+type nodeLabelGetter interface {
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+}
+
+// NodeLabelSnapshot keeps a copy of a configured subset of the node's labels
+// (e.g. availability zone, rack and hardware class) to attach to the health
+// and pod status records the preparer writes. Aggregators can then group
+// those records without looking up the labels of every node.
+//
+// A nil *NodeLabelSnapshot is valid and has no labels.
+type NodeLabelSnapshot struct {
+	node   types.NodeName
+	keys   []string
+	getter nodeLabelGetter
+	logger logging.Logger
+
+	mu     sync.RWMutex
+	labels map[string]string
+}
+
+func NewNodeLabelSnapshot(node types.NodeName, keys []string, getter nodeLabelGetter, logger logging.Logger) *NodeLabelSnapshot {
+	return &NodeLabelSnapshot{
+		node:   node,
+		keys:   keys,
+		getter: getter,
+		logger: logger,
+	}
+}
+
+// Labels returns the most recently read snapshot, or nil if none of the
+// configured labels are set on the node. The caller may modify the returned
+// map.
+func (s *NodeLabelSnapshot) Labels() map[string]string {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.labels) == 0 {
+		return nil
+	}
+	ret := make(map[string]string, len(s.labels))
+	for k, v := range s.labels {
+		ret[k] = v
+	}
+	return ret
+}
+
+// String returns the most recently read snapshot formatted like a label
+// selector, e.g. "az=us-west-2a,rack=r12"
+func (s *NodeLabelSnapshot) String() string {
+	return klabels.Set(s.Labels()).String()
+}
+
+// Refresh re-reads the node's labels. If they can't be read, the previous
+// snapshot is kept.
+func (s *NodeLabelSnapshot) Refresh() error {
+	labeled, err := s.getter.GetLabels(labels.NODE, s.node.String())
+	if err != nil {
+		return err
+	}
+
+	snapshot := make(map[string]string)
+	for _, key := range s.keys {
+		if labeled.Labels.Has(key) {
+			snapshot[key] = labeled.Labels.Get(key)
+		}
+	}
+
+	s.mu.Lock()
+	s.labels = snapshot
+	s.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the snapshot every NodeLabelRefreshSec until quit is closed.
+func (s *NodeLabelSnapshot) Run(quit <-chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+		case <-time.After(time.Duration(*NodeLabelRefreshSec) * time.Second):
+		}
+
+		err := s.Refresh()
+		if err != nil {
+			s.logger.WithError(err).Warnln("Could not refresh node label snapshot, keeping the previous one")
+		}
+	}
+}
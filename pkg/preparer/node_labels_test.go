@@ -0,0 +1,39 @@
+package preparer
+
+import (
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+)
+
+func TestNodeLabelSnapshotKeepsConfiguredKeys(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	err := applicator.SetLabels(labels.NODE, "node1", map[string]string{
+		"az":      "us-west-2a",
+		"rack":    "r12",
+		"unused":  "value",
+		"another": "value",
+	})
+	Assert(t).IsNil(err, "test setup: could not set node labels")
+
+	snapshot := NewNodeLabelSnapshot("node1", []string{"az", "rack", "hardware_class"}, applicator, logging.DefaultLogger)
+	Assert(t).AreEqual(len(snapshot.Labels()), 0, "should not have labels before the first refresh")
+
+	err = snapshot.Refresh()
+	Assert(t).IsNil(err, "should not have erred refreshing the snapshot")
+	Assert(t).AreEqual(len(snapshot.Labels()), 2, "should only have kept the configured labels that are set")
+	Assert(t).AreEqual(snapshot.Labels()["az"], "us-west-2a", "should have kept the az label")
+	Assert(t).AreEqual(snapshot.Labels()["rack"], "r12", "should have kept the rack label")
+	Assert(t).AreEqual(snapshot.String(), "az=us-west-2a,rack=r12", "should have formatted the labels as a selector")
+
+	snapshot.Labels()["az"] = "modified"
+	Assert(t).AreEqual(snapshot.Labels()["az"], "us-west-2a", "modifying the returned labels should not change the snapshot")
+}
+
+func TestNilNodeLabelSnapshotHasNoLabels(t *testing.T) {
+	var snapshot *NodeLabelSnapshot
+	Assert(t).AreEqual(len(snapshot.Labels()), 0, "a nil snapshot should not have labels")
+	Assert(t).AreEqual(snapshot.String(), "", "a nil snapshot should format as an empty string")
+}
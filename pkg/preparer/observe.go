@@ -0,0 +1,316 @@
+package preparer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/types"
+)
+
+// ObservedAction is what a preparer would have done with an intent/reality
+// pair if it were not in observe-only mode
+type ObservedAction string
+
+const (
+	ObservedInstall ObservedAction = "install"
+	ObservedUpdate  ObservedAction = "update"
+	ObservedRemove  ObservedAction = "remove"
+	ObservedNone    ObservedAction = "none"
+)
+
+// ArtifactObservation is the outcome of verifying the artifact of a single
+// launchable in an intent manifest
+type ArtifactObservation struct {
+	LaunchableID launch.LaunchableID `json:"launchable_id"`
+	Verified     bool                `json:"verified"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// ServiceObservation is the runit status of a single service of a pod that
+// is already on the node
+type ServiceObservation struct {
+	Name   string `json:"name"`
+	Status string `json:"status,omitempty"`
+	PID    uint64 `json:"pid,omitempty"`
+	Uptime string `json:"uptime,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Observation is what an observe-only preparer found the last time it
+// processed a pod: the action it would have taken, whether the intent passed
+// authorization and artifact verification, and the state of the services of
+// the version of the pod already on the node.
+type Observation struct {
+	PodID        types.PodID        `json:"pod_id"`
+	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key,omitempty"`
+	Action       ObservedAction     `json:"action"`
+	IntentSHA    string             `json:"intent_sha,omitempty"`
+	RealitySHA   string             `json:"reality_sha,omitempty"`
+
+	// Set if the intent manifest was rejected by the deployer auth policy
+	AuthorizationError string `json:"authorization_error,omitempty"`
+
+	// The verification failure policy that would be applied to the
+	// artifacts below, and the results of verifying them. Launchables that
+	// are already installed are not verified again.
+	VerificationPolicy string                `json:"verification_policy,omitempty"`
+	Artifacts          []ArtifactObservation `json:"artifacts,omitempty"`
+
+	Services      []ServiceObservation `json:"services,omitempty"`
+	ServicesError string               `json:"services_error,omitempty"`
+
+	// The steps the preparer would take: the launchables it would install
+	// and launch, whether it would only reload the pod's config, and the
+	// services of the existing pod that it would halt
+	Install []launch.LaunchableID `json:"install,omitempty"`
+	Launch  []launch.LaunchableID `json:"launch,omitempty"`
+	Reload  bool                  `json:"reload,omitempty"`
+	Halt    []string              `json:"halt,omitempty"`
+
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+// ObservationLog holds the most recent Observation of each pod on the node
+type ObservationLog struct {
+	mu           sync.Mutex
+	observations map[podWorkerID]Observation
+}
+
+func NewObservationLog() *ObservationLog {
+	return &ObservationLog{
+		observations: make(map[podWorkerID]Observation),
+	}
+}
+
+func (l *ObservationLog) record(observation Observation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.observations[observationID(observation)] = observation
+}
+
+func (l *ObservationLog) last(id podWorkerID) (Observation, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	observation, ok := l.observations[id]
+	return observation, ok
+}
+
+// Observations returns the most recent observation of each pod, ordered by
+// pod ID and then unique key
+func (l *ObservationLog) Observations() []Observation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	observations := make([]Observation, 0, len(l.observations))
+	for _, observation := range l.observations {
+		observations = append(observations, observation)
+	}
+	sort.Sort(observationsByPod(observations))
+	return observations
+}
+
+type observationsByPod []Observation
+
+func (o observationsByPod) Len() int      { return len(o) }
+func (o observationsByPod) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+func (o observationsByPod) Less(i, j int) bool {
+	if o[i].PodID != o[j].PodID {
+		return o[i].PodID < o[j].PodID
+	}
+	return o[i].PodUniqueKey < o[j].PodUniqueKey
+}
+
+type servicesByName []ServiceObservation
+
+func (s servicesByName) Len() int           { return len(s) }
+func (s servicesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s servicesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+type artifactsByLaunchable []ArtifactObservation
+
+func (a artifactsByLaunchable) Len() int           { return len(a) }
+func (a artifactsByLaunchable) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a artifactsByLaunchable) Less(i, j int) bool { return a[i].LaunchableID < a[j].LaunchableID }
+
+func observationID(observation Observation) podWorkerID {
+	return podWorkerID{podID: observation.PodID, podUniqueKey: observation.PodUniqueKey}
+}
+
+// observePair is resolvePair for observe-only mode. It works out what
+// resolvePair would do with the pair and runs the checks that don't require
+// changing the node, then logs and records the result. Artifacts are only
+// fetched when the intent changes, since the same intent is processed on
+// every watch.
+func (p *Preparer) observePair(pair ManifestPair, pod Pod, logger logging.Logger) {
+	observation := Observation{
+		PodID:        pair.ID,
+		PodUniqueKey: pair.PodUniqueKey,
+		ObservedAt:   time.Now(),
+	}
+	if pair.Reality != nil {
+		observation.RealitySHA, _ = pair.Reality.SHA()
+	}
+	if pair.Intent != nil {
+		observation.IntentSHA, _ = pair.Intent.SHA()
+	}
+
+	switch {
+	case observation.IntentSHA == "":
+		observation.Action = ObservedRemove
+	case observation.RealitySHA == "":
+		observation.Action = ObservedInstall
+	case observation.RealitySHA == observation.IntentSHA:
+		observation.Action = ObservedNone
+	default:
+		observation.Action = ObservedUpdate
+	}
+
+	if observation.Action == ObservedInstall || observation.Action == ObservedUpdate {
+		reloadable := p.reloadable()
+		err := reloadable.authPolicy.AuthorizeApp(pair.Intent, logger)
+		if err != nil {
+			observation.AuthorizationError = err.Error()
+		}
+
+		observation.VerificationPolicy = reloadable.verificationPolicy.forPod(pair.ID).String()
+		last, ok := p.Observations.last(observationID(observation))
+		if ok && last.IntentSHA == observation.IntentSHA && last.Artifacts != nil {
+			observation.Artifacts = last.Artifacts
+		} else {
+			observation.Artifacts = observeArtifacts(pod.VerifyArtifacts(pair.Intent, reloadable.artifactVerifier, reloadable.artifactRegistry))
+		}
+	}
+
+	if pair.Reality != nil {
+		statuses, err := pod.ServiceStatuses(pair.Reality)
+		if err != nil {
+			observation.ServicesError = err.Error()
+		}
+		for name, status := range statuses {
+			service := ServiceObservation{Name: name}
+			if status.Err != nil {
+				service.Error = status.Err.Error()
+			} else if status.Stat != nil {
+				service.Status = status.Stat.ChildStatus
+				service.PID = status.Stat.ChildPID
+				service.Uptime = status.Stat.ChildTime.String()
+			}
+			observation.Services = append(observation.Services, service)
+		}
+		sort.Sort(servicesByName(observation.Services))
+	}
+
+	planSteps(&observation, pair, logger)
+	p.Observations.record(observation)
+	logObservation(observation, logger)
+}
+
+// planSteps fills in the steps resolvePair would take for the observed pair.
+// Only launchables that aren't installed yet have their artifacts verified, so
+// those are the ones that would be installed.
+func planSteps(observation *Observation, pair ManifestPair, logger logging.Logger) {
+	switch observation.Action {
+	case ObservedRemove:
+		observation.Halt = serviceNames(observation.Services)
+	case ObservedInstall, ObservedUpdate:
+		for _, artifact := range observation.Artifacts {
+			observation.Install = append(observation.Install, artifact.LaunchableID)
+		}
+		if shouldReload(pair, logger) {
+			observation.Reload = true
+			return
+		}
+		for launchableID := range pair.Intent.GetLaunchableStanzas() {
+			observation.Launch = append(observation.Launch, launchableID)
+		}
+		sort.Sort(launchableIDs(observation.Launch))
+		observation.Halt = serviceNames(observation.Services)
+	}
+}
+
+func serviceNames(services []ServiceObservation) []string {
+	var names []string
+	for _, service := range services {
+		names = append(names, service.Name)
+	}
+	return names
+}
+
+type launchableIDs []launch.LaunchableID
+
+func (l launchableIDs) Len() int           { return len(l) }
+func (l launchableIDs) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l launchableIDs) Less(i, j int) bool { return l[i] < l[j] }
+
+func observeArtifacts(results map[launch.LaunchableID]error) []ArtifactObservation {
+	artifacts := make([]ArtifactObservation, 0, len(results))
+	for launchableID, err := range results {
+		artifact := ArtifactObservation{
+			LaunchableID: launchableID,
+			Verified:     err == nil,
+		}
+		if err != nil {
+			artifact.Error = err.Error()
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	sort.Sort(artifactsByLaunchable(artifacts))
+	return artifacts
+}
+
+func logObservation(observation Observation, logger logging.Logger) {
+	fields := logrus.Fields{
+		"observed_action": observation.Action,
+		"old_sha":         observation.RealitySHA,
+	}
+	if observation.AuthorizationError != "" {
+		fields["authorization_error"] = observation.AuthorizationError
+	}
+	if len(observation.Install) > 0 {
+		fields["would_install"] = observation.Install
+	}
+	if len(observation.Launch) > 0 {
+		fields["would_launch"] = observation.Launch
+	}
+	if observation.Reload {
+		fields["would_reload"] = true
+	}
+	if len(observation.Halt) > 0 {
+		fields["would_halt"] = observation.Halt
+	}
+
+	var failedArtifacts []string
+	for _, artifact := range observation.Artifacts {
+		if !artifact.Verified {
+			failedArtifacts = append(failedArtifacts, artifact.LaunchableID.String())
+		}
+	}
+	if len(failedArtifacts) > 0 {
+		fields["failed_artifacts"] = failedArtifacts
+		fields["verification_policy"] = observation.VerificationPolicy
+	}
+
+	var unhealthyServices []string
+	for _, service := range observation.Services {
+		if service.Error != "" || service.Status != runit.STATUS_RUN {
+			unhealthyServices = append(unhealthyServices, service.Name)
+		}
+	}
+	if len(unhealthyServices) > 0 {
+		fields["unhealthy_services"] = unhealthyServices
+	}
+
+	entry := logger.WithFields(fields)
+	if observation.AuthorizationError != "" || len(failedArtifacts) > 0 || len(unhealthyServices) > 0 {
+		entry.Warnln("Observe-only mode, found problems with pod")
+	} else if observation.Action != ObservedNone {
+		entry.Infoln("Observe-only mode, not acting on pod")
+	} else {
+		entry.Debugln("Observe-only mode, pod is unchanged")
+	}
+}
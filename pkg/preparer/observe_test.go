@@ -0,0 +1,138 @@
+package preparer
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+)
+
+func TestObserveOnlyDoesNotInstallNewPods(t *testing.T) {
+	verificationErr := util.Errorf("bad signature")
+	testPod := &TestPod{
+		launchSuccess: true,
+		artifactResults: map[launch.LaunchableID]error{
+			"app":    nil,
+			"worker": verificationErr,
+		},
+	}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, hooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	p.Observations = NewObservationLog()
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "observing should always succeed")
+	Assert(t).IsFalse(testPod.installed, "should not have installed in observe-only mode")
+	Assert(t).IsFalse(testPod.launched, "should not have launched in observe-only mode")
+	Assert(t).IsFalse(hooks.ranBeforeInstall, "should not have run hooks in observe-only mode")
+
+	observations := p.Observations.Observations()
+	Assert(t).AreEqual(len(observations), 1, "should have recorded an observation of the pod")
+	observation := observations[0]
+	Assert(t).AreEqual(observation.Action, ObservedInstall, "should have observed that the pod would be installed")
+	Assert(t).AreEqual(observation.AuthorizationError, "", "the pod should have been authorized")
+	Assert(t).AreEqual(observation.VerificationPolicy, "enforce", "should have reported the default verification policy")
+	Assert(t).AreEqual(len(observation.Artifacts), 2, "should have reported both artifacts")
+	Assert(t).IsTrue(observation.Artifacts[0].Verified, "app artifact should have been verified")
+	Assert(t).IsFalse(observation.Artifacts[1].Verified, "worker artifact should have failed verification")
+	Assert(t).AreEqual(observation.Artifacts[1].Error, verificationErr.Error(), "should have reported the verification error")
+	Assert(t).AreEqual(len(observation.Install), 2, "should have planned to install both launchables")
+	Assert(t).AreEqual(len(observation.Launch), 1, "should have planned to launch the manifest's launchable")
+	Assert(t).AreEqual(observation.Launch[0], launch.LaunchableID("app"), "should have planned to launch the manifest's launchable")
+	Assert(t).AreEqual(len(observation.Halt), 0, "should not have planned to halt anything for a new pod")
+
+	// The same intent is seen on every watch, but its artifacts are only
+	// fetched once
+	p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).AreEqual(testPod.verifiedArtifacts, 1, "should not have verified unchanged artifacts again")
+}
+
+func TestObserveOnlyReportsExistingServicesWithoutRemoving(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	existing := builder.GetManifest()
+
+	statErr := util.Errorf("no such service")
+	testPod := &TestPod{
+		serviceStatuses: map[string]pods.ServiceStatus{
+			"hello__web":    {Stat: &runit.StatResult{ChildStatus: runit.STATUS_RUN, ChildPID: 123}},
+			"hello__worker": {Err: statErr},
+		},
+	}
+	pair := ManifestPair{
+		ID:      existing.ID(),
+		Reality: existing,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	p.Observations = NewObservationLog()
+
+	success := p.resolvePair(pair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "observing should always succeed")
+	Assert(t).IsFalse(testPod.halted, "should not have halted in observe-only mode")
+	Assert(t).IsFalse(testPod.uninstalled, "should not have uninstalled in observe-only mode")
+	Assert(t).AreEqual(testPod.verifiedArtifacts, 0, "should not verify artifacts of a pod being removed")
+
+	observation := p.Observations.Observations()[0]
+	Assert(t).AreEqual(observation.Action, ObservedRemove, "should have observed that the pod would be removed")
+	Assert(t).AreEqual(len(observation.Services), 2, "should have reported both services")
+	Assert(t).AreEqual(observation.Services[0].Name, "hello__web", "services should be ordered by name")
+	Assert(t).AreEqual(observation.Services[0].Status, runit.STATUS_RUN, "should have reported the running service")
+	Assert(t).AreEqual(observation.Services[0].PID, uint64(123), "should have reported the service's PID")
+	Assert(t).AreEqual(observation.Services[1].Error, statErr.Error(), "should have reported the status error")
+	Assert(t).AreEqual(len(observation.Halt), 2, "should have planned to halt both services")
+	Assert(t).AreEqual(len(observation.Launch), 0, "should not have planned to launch anything for a removed pod")
+}
+
+func TestObserveOnlyPlansUpdates(t *testing.T) {
+	builder := testManifest(t).GetBuilder()
+	builder.SetConfigReload("kill -HUP $PID")
+	existing := builder.GetManifest()
+	builder = existing.GetBuilder()
+	builder.SetConfig(map[interface{}]interface{}{"ENVIRONMENT": "production"})
+	reloadable := builder.GetManifest()
+	builder = existing.GetBuilder()
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app":    existing.GetLaunchableStanzas()["app"],
+		"worker": existing.GetLaunchableStanzas()["app"],
+	})
+	updated := builder.GetManifest()
+
+	testPod := &TestPod{
+		serviceStatuses: map[string]pods.ServiceStatus{
+			"hello__app": {Stat: &runit.StatResult{ChildStatus: runit.STATUS_RUN}},
+		},
+	}
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	p.Observations = NewObservationLog()
+
+	p.resolvePair(ManifestPair{ID: existing.ID(), Intent: reloadable, Reality: existing}, testPod, logging.DefaultLogger)
+	observation := p.Observations.Observations()[0]
+	Assert(t).AreEqual(observation.Action, ObservedUpdate, "should have observed that the pod would be updated")
+	Assert(t).IsTrue(observation.Reload, "should have planned to reload a config-only change")
+	Assert(t).AreEqual(len(observation.Halt), 0, "should not have planned to halt a pod that would be reloaded")
+
+	p.resolvePair(ManifestPair{ID: existing.ID(), Intent: updated, Reality: existing}, testPod, logging.DefaultLogger)
+	observation = p.Observations.Observations()[0]
+	Assert(t).IsFalse(observation.Reload, "should not have planned to reload when the launchables changed")
+	Assert(t).AreEqual(len(observation.Launch), 2, "should have planned to launch both launchables")
+	Assert(t).AreEqual(len(observation.Halt), 1, "should have planned to halt the existing service")
+	Assert(t).AreEqual(observation.Halt[0], "hello__app", "should have planned to halt the existing service")
+}
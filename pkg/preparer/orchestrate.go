@@ -3,6 +3,9 @@ package preparer
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -10,16 +13,21 @@ import (
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/constants"
 	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/podevents"
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/tracing"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/util/size"
+	"github.com/square/p2/pkg/version"
 )
 
 // The Pod ID of the preparer.
@@ -28,17 +36,36 @@ const (
 	minimumBackoffTime = 1 * time.Second
 )
 
+// The status of a uuid pod must be recorded before the preparer moves on,
+// so writing it is retried until it succeeds, whatever the error
+var statusRetryPolicy = consulutil.RetryPolicy{
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     time.Minute,
+	Retryable:      consulutil.RetryAll,
+}
+
 // slice literals are not const
 var svlogdExec = []string{"svlogd", "-tt", "./main"}
 
 type Pod interface {
 	hooks.Pod
 	Launch(manifest.Manifest) (bool, error)
+	Reload(manifest.Manifest) (bool, error)
 	Install(manifest.Manifest, auth.ArtifactVerifier, artifact.Registry) error
 	Uninstall() error
+	RemoveInstalls(manifest.Manifest) error
 	Verify(manifest.Manifest, auth.Policy) error
+	Preflight(manifest.Manifest) error
+	CheckReadiness(manifest.Manifest) (string, error)
+	SetAllocatedPorts(map[launch.LaunchableID]int)
+	SetTraceSpan(*tracing.Span)
 	Halt(manifest.Manifest) (bool, error)
+	MakeCurrent(manifest.Manifest) error
+	Launchables(manifest.Manifest) ([]launch.Launchable, error)
+	Recover() (pods.JournalEntry, bool, error)
 	Prune(size.ByteCount, manifest.Manifest)
+	VerifyArtifacts(manifest.Manifest, auth.ArtifactVerifier, artifact.Registry) map[launch.LaunchableID]error
+	ServiceStatuses(manifest.Manifest) (map[string]pods.ServiceStatus, error)
 }
 
 type Hooks interface {
@@ -51,6 +78,9 @@ type Store interface {
 	SetPod(podPrefix consul.PodPrefix, nodeName types.NodeName, podManifest manifest.Manifest) (time.Duration, error)
 	Pod(podPrefix consul.PodPrefix, nodeName types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
 	DeletePod(podPrefix consul.PodPrefix, nodeName types.NodeName, podId types.PodID) (time.Duration, error)
+	SetRealityWithMetadata(nodeName types.NodeName, podManifest manifest.Manifest, metadata consul.RealityMetadata) error
+	RealityMetadata(nodeName types.NodeName, podId types.PodID) (consul.RealityMetadata, error)
+	ListRealityMetadata(nodeName types.NodeName) ([]consul.RealityMetadataResult, error)
 	WatchPods(
 		podPrefix consul.PodPrefix,
 		nodeName types.NodeName,
@@ -60,9 +90,9 @@ type Store interface {
 	)
 }
 
-// Identifies a pod which will be serviced by a goroutine. This struct is used
-// in maps that store goroutine-specific resources such as channels for
-// interaction
+// Identifies a pod which will be worked on by the preparer. This struct is
+// used as the key of the work queue and of maps that store per-pod resources
+// such as allocated ports
 type podWorkerID struct {
 	// Expected to be "" for legacy pods
 	podUniqueKey types.PodUniqueKey
@@ -89,8 +119,17 @@ func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 
 	go p.store.WatchPods(consul.INTENT_TREE, p.node, quitChan, errChan, podChan)
 
-	podChanMap := make(map[podWorkerID]chan ManifestPair)
-	quitChanMap := make(map[podWorkerID]chan struct{})
+	queue := newPodWorkQueue()
+	queue.lag = p.metrics.watchLoopLag()
+	p.setWorkQueue(queue)
+	var workers sync.WaitGroup
+	for i := 0; i < *PodWorkConcurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			p.handlePods(queue)
+		}()
+	}
 
 	for {
 		select {
@@ -98,6 +137,7 @@ func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 			p.Logger.WithError(err).
 				Errorln("there was an error reading the manifest")
 		case intentResults := <-podChan:
+			p.Heartbeats.LoopPassed(PodWatchLoop)
 			realityResults, _, err := p.store.ListPods(consul.REALITY_TREE, p.node)
 			if err != nil {
 				p.Logger.WithError(err).Errorln("Could not check reality")
@@ -109,38 +149,18 @@ func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 				} else {
 					pairs := p.ZipResultSets(intentResults, realityResults)
 
+					// A pod that is mid-deploy has the pair queued until
+					// the deploy is done, so this never blocks
 					for _, pair := range pairs {
-						workerID := podWorkerID{
-							podID:        pair.ID,
-							podUniqueKey: pair.PodUniqueKey,
-						}
-						if _, ok := podChanMap[workerID]; !ok {
-							// spin goroutine for this pod
-							podChanMap[workerID] = make(chan ManifestPair)
-							quitChanMap[workerID] = make(chan struct{})
-							go p.handlePods(podChanMap[workerID], quitChanMap[workerID])
-						}
-						// It is possible for the goroutine responsible for performing the installation
-						// of a particular pod ID to be stalled or mid-deploy. This should not cause
-						// this loop to block. Intent results will be re-sent within the watch expiration
-						// loop time.
-						select {
-						case podChanMap[workerID] <- pair:
-						case <-time.After(5 * time.Second):
-							p.Logger.WithField("pod", pair.ID).Warnln("Missed possible manifest update, will wait for next watch.")
-						}
+						queue.Add(pair)
 					}
-
 				}
 			}
 		case <-quitAndAck:
-			for podToQuit, quitCh := range quitChanMap {
-				p.Logger.WithFields(logrus.Fields{
-					"pod":        podToQuit.podID,
-					"unique_key": podToQuit.podUniqueKey,
-				}).Infof("p2-preparer quitting, ceasing to watch for updates to %s", podToQuit.String())
-				quitCh <- struct{}{}
-			}
+			p.Logger.NoFields().Infoln("p2-preparer quitting, waiting for work in progress to finish")
+			p.setWorkQueue(nil)
+			queue.Close()
+			workers.Wait()
 			close(quitChan)
 			p.Logger.NoFields().Infoln("Done, acknowledging quit")
 			quitAndAck <- struct{}{} // acknowledge quit
@@ -150,166 +170,263 @@ func (p *Preparer) WatchForPodManifestsForNode(quitAndAck chan struct{}) {
 	}
 }
 
-func (p *Preparer) tryRunHooks(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest, logger logging.Logger) {
+// tryRunHooks runs the hooks of a type, recording the run under span, which
+// may be nil
+func (p *Preparer) tryRunHooks(hookType hooks.HookType, pod hooks.Pod, manifest manifest.Manifest, span *tracing.Span, logger logging.Logger) {
+	start := time.Now()
+	hookSpan := span.Child(fmt.Sprintf("hooks_%s", hookType))
 	err := p.hooks.RunHookType(hookType, pod, manifest)
+	hookSpan.End(err)
+	p.metrics.hookRun(hookType, start, err)
 	if err != nil {
 		logger.WithErrorAndFields(err, logrus.Fields{
 			"hooks": hookType}).Warnln("Could not run hooks")
 	}
 }
 
-// no return value, no output channels. This should do everything it needs to do
-// without outside intervention (other than being signalled to quit)
-func (p *Preparer) handlePods(podChan <-chan ManifestPair, quit <-chan struct{}) {
-	// install new launchables
-	var nextLaunch ManifestPair
-
-	// used to track if we have work to do (i.e. pod manifest came through channel
-	// and we have yet to operate on it)
-	working := false
-	var manifestLogger logging.Logger
-
-	// The design of p2-preparer is to continuously retry installation
-	// failures, for example downloading of the launchable. An exponential
-	// backoff is important to avoid putting undue load on the artifact
-	// server, for example.
-	backoffTime := minimumBackoffTime
+// handlePods works on the pods handed out by the queue until it is closed.
+// This should do everything it needs to do without outside intervention.
+func (p *Preparer) handlePods(queue *podWorkQueue) {
 	for {
-		select {
-		case <-quit:
+		pair, ok := queue.Get()
+		if !ok {
 			return
-		case nextLaunch = <-podChan:
-			backoffTime = minimumBackoffTime
-			var sha string
+		}
+		// The design of p2-preparer is to continuously retry installation
+		// failures, for example downloading of the launchable. The queue
+		// backs off exponentially to avoid putting undue load on the
+		// artifact server, for example.
+		queue.Done(pair, p.handlePod(pair))
+		p.Heartbeats.LoopPassed(PodWorkLoop)
+	}
+}
 
-			// TODO: handle errors appropriately from SHA().
-			if nextLaunch.Intent != nil {
-				sha, _ = nextLaunch.Intent.SHA()
-			} else {
-				sha, _ = nextLaunch.Reality.SHA()
+func (p *Preparer) handlePod(nextLaunch ManifestPair) bool {
+	manifestLogger := p.Logger.SubLogger(logrus.Fields{
+		"pod":            nextLaunch.ID,
+		"sha":            pairSHA(nextLaunch),
+		"pod_unique_key": nextLaunch.PodUniqueKey,
+	})
+	manifestLogger.NoFields().Debugln("New manifest received")
+
+	pod, err := p.newPod(nextLaunch.ID, nextLaunch.PodUniqueKey)
+	if err != nil {
+		manifestLogger.WithError(err).Errorln("Could not initialize pod")
+		return false
+	}
+
+	// The queue is being fed values gathered from a consul.Watch() in
+	// WatchForPodManifestsForNode(). If the watch returns a new pair of
+	// intent/reality values before the previous change has finished
+	// processing in resolvePair(), the reality value will be stale. This
+	// leads to a bug where the preparer will appear to update a package
+	// and when that is finished, "update" it again.
+	//
+	// Example ordering of bad events:
+	// 1) update to /intent for pod A comes in, /reality is read and
+	// resolvePair() handles it
+	// 2) before resolvePair() finishes, another /intent update comes in,
+	// and /reality is read but hasn't been changed. This update cannot
+	// be processed until the previous resolvePair() call finishes, and
+	// updates /reality. Now the reality value used here is stale. We
+	// want to refresh our /reality read so we don't restart the pod if
+	// intent didn't change between updates.
+	//
+	// The correct solution probably involves watching reality and intent
+	// and feeding updated pairs to a control loop.
+	//
+	// This is a quick fix to ensure that the reality value being used is
+	// up-to-date. The work queue only keeps the latest pair of each pod,
+	// which should ensure that the intent value is fresh (to the extent that
+	// Consul is timely). Fetching the reality value again ensures its
+	// freshness too.
+	if nextLaunch.PodUniqueKey == "" {
+		// legacy pod, get reality manifest from reality tree
+		reality, _, err := p.store.Pod(consul.REALITY_TREE, p.node, nextLaunch.ID)
+		if err == pods.NoCurrentManifest {
+			nextLaunch.Reality = nil
+		} else if err != nil {
+			manifestLogger.WithError(err).Errorln("Error getting reality manifest")
+			return false
+		} else {
+			nextLaunch.Reality = reality
+		}
+	} else {
+		// uuid pod, get reality manifest from pod status
+		status, _, err := p.podStatusStore.Get(nextLaunch.PodUniqueKey)
+		switch {
+		case err != nil && !statusstore.IsNoStatus(err):
+			manifestLogger.WithError(err).Errorln("Error getting reality manifest from pod status")
+			return false
+		case statusstore.IsNoStatus(err):
+			nextLaunch.Reality = nil
+		default:
+			manifest, err := manifest.FromBytes([]byte(status.Manifest))
+			if err != nil {
+				manifestLogger.WithError(err).Errorln("Error parsing reality manifest from pod status")
+				return false
 			}
-			manifestLogger = p.Logger.SubLogger(logrus.Fields{
-				"pod":            nextLaunch.ID,
-				"sha":            sha,
-				"pod_unique_key": nextLaunch.PodUniqueKey,
-			})
-			manifestLogger.NoFields().Debugln("New manifest received")
-
-			working = true
-		case <-time.After(backoffTime):
-			if working {
-				var pod *pods.Pod
-				var err error
-				if nextLaunch.PodUniqueKey == "" {
-					pod = p.podFactory.NewLegacyPod(nextLaunch.ID)
-				} else {
-					pod, err = p.podFactory.NewUUIDPod(nextLaunch.ID, nextLaunch.PodUniqueKey)
-					if err != nil {
-						manifestLogger.WithError(err).Errorln("Could not initialize pod")
-						break
-					}
-				}
+			nextLaunch.Reality = manifest
+		}
+	}
 
-				// TODO better solution: force the preparer to have a 0s default timeout, prevent KILLs
-				if pod.Id == constants.PreparerPodID {
-					pod.DefaultTimeout = time.Duration(0)
-				}
+	if nextLaunch.ID != constants.PreparerPodID {
+		p.workMu.RLock()
+		defer p.workMu.RUnlock()
 
-				effectiveLogBridgeExec := p.logExec
-				// pods that are in the blacklist for this preparer shall not use the
-				// preparer's log exec. Instead, they will use the default svlogd logexec.
-				for _, podID := range p.logBridgeBlacklist {
-					if pod.Id.String() == podID {
-						effectiveLogBridgeExec = svlogdExec
-						break
-					}
-				}
-				pod.SetLogBridgeExec(effectiveLogBridgeExec)
-
-				pod.SetFinishExec(p.finishExec)
-
-				// podChan is being fed values gathered from a consul.Watch() in
-				// WatchForPodManifestsForNode(). If the watch returns a new pair of
-				// intent/reality values before the previous change has finished
-				// processing in resolvePair(), the reality value will be stale. This
-				// leads to a bug where the preparer will appear to update a package
-				// and when that is finished, "update" it again.
-				//
-				// Example ordering of bad events:
-				// 1) update to /intent for pod A comes in, /reality is read and
-				// resolvePair() handles it
-				// 2) before resolvePair() finishes, another /intent update comes in,
-				// and /reality is read but hasn't been changed. This update cannot
-				// be processed until the previous resolvePair() call finishes, and
-				// updates /reality. Now the reality value used here is stale. We
-				// want to refresh our /reality read so we don't restart the pod if
-				// intent didn't change between updates.
-				//
-				// The correct solution probably involves watching reality and intent
-				// and feeding updated pairs to a control loop.
-				//
-				// This is a quick fix to ensure that the reality value being used is
-				// up-to-date. The de-bouncing logic in this method should ensure that the
-				// intent value is fresh (to the extent that Consul is timely). Fetching
-				// the reality value again ensures its freshness too.
-				if nextLaunch.PodUniqueKey == "" {
-					// legacy pod, get reality manifest from reality tree
-					reality, _, err := p.store.Pod(consul.REALITY_TREE, p.node, nextLaunch.ID)
-					if err == pods.NoCurrentManifest {
-						nextLaunch.Reality = nil
-					} else if err != nil {
-						manifestLogger.WithError(err).Errorln("Error getting reality manifest")
-						break
-					} else {
-						nextLaunch.Reality = reality
-					}
-				} else {
-					// uuid pod, get reality manifest from pod status
-					status, _, err := p.podStatusStore.Get(nextLaunch.PodUniqueKey)
-					switch {
-					case err != nil && !statusstore.IsNoStatus(err):
-						manifestLogger.WithError(err).Errorln("Error getting reality manifest from pod status")
-						break
-					case statusstore.IsNoStatus(err):
-						nextLaunch.Reality = nil
-					default:
-						manifest, err := manifest.FromBytes([]byte(status.Manifest))
-						if err != nil {
-							manifestLogger.WithError(err).Errorln("Error parsing reality manifest from pod status")
-							break
-						}
-						nextLaunch.Reality = manifest
-					}
-				}
+		// the leaving node's pods have been or are about to be halted
+		// and replaced elsewhere, so they aren't worked on
+		if p.Termination.Leaving() {
+			manifestLogger.NoFields().Infoln("Not working on pod, the node is leaving")
+			return true
+		}
+	}
+	return p.resolvePair(nextLaunch, pod, manifestLogger)
+}
 
-				ok := p.resolvePair(nextLaunch, pod, manifestLogger)
-				if ok {
-					nextLaunch = ManifestPair{}
-					working = false
+// newPod returns the pod with the given ID and unique key, configured to be
+// installed and launched by the preparer
+func (p *Preparer) newPod(podID types.PodID, uniqueKey types.PodUniqueKey) (*pods.Pod, error) {
+	var pod *pods.Pod
+	if uniqueKey == "" {
+		pod = p.podFactory.NewLegacyPod(podID)
+	} else {
+		var err error
+		pod, err = p.podFactory.NewUUIDPod(podID, uniqueKey)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-					// Reset the backoff time
-					backoffTime = minimumBackoffTime
-				} else {
-					// Double the backoff time with a maximum of 1 minute
-					backoffTime = backoffTime * 2
-					if backoffTime > 1*time.Minute {
-						backoffTime = 1 * time.Minute
-					}
-				}
-			}
+	// TODO better solution: force the preparer to have a 0s default timeout, prevent KILLs
+	if pod.Id == constants.PreparerPodID {
+		pod.DefaultTimeout = time.Duration(0)
+	}
+
+	effectiveLogBridgeExec := p.logExec
+	// pods that are in the blacklist for this preparer shall not use the
+	// preparer's log exec. Instead, they will use the default svlogd logexec.
+	for _, blacklisted := range p.logBridgeBlacklist {
+		if pod.Id.String() == blacklisted {
+			effectiveLogBridgeExec = svlogdExec
+			break
 		}
 	}
+	pod.SetLogBridgeExec(effectiveLogBridgeExec)
+
+	pod.SetFinishExec(p.finishExec)
+	pod.Redaction = p.redaction
+	pod.ArtifactCache = p.artifactCache
+	pod.Extraction = p.extraction
+	pod.Secrets = p.secrets
+	pod.ClusterAnnotator = p.clusterAnnotator
+	pod.Placement = p.placement
+	return pod, nil
 }
 
 // check if a manifest satisfies the authorization requirement of this preparer
+// installedPod is a pod under the pod root and the manifest it was last
+// launched with
+type installedPod struct {
+	pod      *pods.Pod
+	manifest manifest.Manifest
+	logger   logging.Logger
+}
+
+// installedPods returns the pods under the pod root that have been launched,
+// configured like the pods the preparer installs
+func (p *Preparer) installedPods() []installedPod {
+	homes, err := ioutil.ReadDir(p.podRoot)
+	if err != nil {
+		p.Logger.WithError(err).Errorln("Could not list installed pods")
+		return nil
+	}
+	var installed []installedPod
+	for _, home := range homes {
+		if !home.IsDir() {
+			continue
+		}
+		existing, err := pods.PodFromPodHome(p.node, filepath.Join(p.podRoot, home.Name()))
+		if err != nil {
+			// not a pod, or one that was never launched
+			continue
+		}
+		manifest, err := existing.CurrentManifest()
+		if err != nil {
+			continue
+		}
+
+		logger := p.Logger.SubLogger(logrus.Fields{
+			"pod":            existing.Id,
+			"pod_unique_key": existing.UniqueKey(),
+		})
+		pod, err := p.newPod(existing.Id, existing.UniqueKey())
+		if err != nil {
+			logger.WithError(err).Errorln("Could not initialize installed pod")
+			continue
+		}
+		installed = append(installed, installedPod{pod: pod, manifest: manifest, logger: logger})
+	}
+	return installed
+}
+
 func (p *Preparer) authorize(manifest manifest.Manifest, logger logging.Logger) bool {
-	err := p.authPolicy.AuthorizeApp(manifest, logger)
+	err := p.reloadable().authPolicy.AuthorizeApp(manifest, logger)
 	if err != nil {
 		if err, ok := err.(auth.Error); ok {
 			logger.WithFields(err.Fields).Errorln(err)
 		} else {
 			logger.NoFields().Errorln(err)
 		}
+		p.auditRecorder.RecordAuthorization(manifest, err, logger)
+		return false
+	}
+	err = p.confinement.check(manifest)
+	if err != nil {
+		logger.WithError(err).Errorln("Pod is not allowed to run unconfined")
+		p.auditRecorder.RecordAuthorization(manifest, err, logger)
+		return false
+	}
+	if p.admitter != nil {
+		err = p.admitter.Admit(manifest)
+		if err != nil {
+			logger.WithError(err).Errorln("Manifest failed admission checks")
+			p.auditRecorder.RecordAuthorization(manifest, err, logger)
+			return false
+		}
+	}
+	p.auditRecorder.RecordAuthorization(manifest, nil, logger)
+	return true
+}
+
+// authorizeIntentWriter returns true unless intent_auth is configured and the
+// intent of pair wasn't signed, for this node, by a writer allowed to schedule
+// the pod here
+func (p *Preparer) authorizeIntentWriter(pair ManifestPair, logger logging.Logger) bool {
+	if p.intentWriterPolicy == nil {
+		return true
+	}
+	if pair.IntentEnvelope == nil {
+		logger.NoFields().Errorln("Intent was not signed by its writer")
+		p.auditRecorder.RecordAuthorization(pair.Intent, util.Errorf("intent was not signed by its writer"), logger)
+		return false
+	}
+	// the writer signed the intent as it was written, before its channels
+	// were resolved
+	err := pair.IntentEnvelope.Check(p.node, pair.writtenIntent())
+	if err != nil {
+		logger.WithError(err).Errorln("Intent writer's signature is not of this intent")
+		p.auditRecorder.RecordAuthorization(pair.Intent, err, logger)
+		return false
+	}
+	err = p.intentWriterPolicy.AuthorizeWriter(pair.ID, pair.IntentEnvelope)
+	if err != nil {
+		if err, ok := err.(auth.Error); ok {
+			logger.WithFields(err.Fields).Errorln(err)
+		} else {
+			logger.NoFields().Errorln(err)
+		}
+		p.auditRecorder.RecordAuthorization(pair.Intent, err, logger)
 		return false
 	}
 	return true
@@ -317,6 +434,20 @@ func (p *Preparer) authorize(manifest manifest.Manifest, logger logging.Logger)
 
 func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger) bool {
 	// do not remove the logger argument, it's not the same as p.Logger
+	if p.Observations != nil {
+		p.observePair(pair, pod, logger)
+		return true
+	}
+
+	// A previous preparer may have stopped in the middle of working on the
+	// pod. Partial installs are cleaned up here, and an interrupted launch
+	// is redone below.
+	interrupted, wasInterrupted, err := pod.Recover()
+	if err != nil {
+		logger.WithError(err).Errorln("Could not recover from an interrupted install")
+		return false
+	}
+
 	var oldSHA, newSHA string
 	if pair.Reality != nil {
 		oldSHA, _ = pair.Reality.SHA()
@@ -325,14 +456,20 @@ func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger
 		newSHA, _ = pair.Intent.SHA()
 	}
 
+	// unchanged pods are never held, so that interrupted launches finish
+	if (oldSHA != newSHA || pair.Reinstall) && p.freezes.holds(pair.ID, pair.Intent, logger) {
+		return false
+	}
+
 	if oldSHA == "" && newSHA != "" {
 		logger.NoFields().Infoln("manifest is new, will update")
-		authorized := p.authorize(pair.Intent, logger)
+		authorized := p.authorizeIntentWriter(pair, logger) && p.authorize(pair.Intent, logger)
 		if !authorized {
 			p.tryRunHooks(
 				hooks.AfterAuthFail,
 				pod,
 				pair.Intent,
+				pair.Span,
 				logger,
 			)
 			// prevent future unnecessary loops, we don't need to check again.
@@ -346,97 +483,371 @@ func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger
 		return p.stopAndUninstallPod(pair, pod, logger)
 	}
 
-	if oldSHA == newSHA {
-		logger.NoFields().Debugln("manifest is unchanged, no action required")
-		return true
+	if oldSHA == newSHA && !pair.Reinstall {
+		if !wasInterrupted {
+			logger.NoFields().Debugln("manifest is unchanged, no action required")
+			return true
+		}
+		logger.WithFields(logrus.Fields{
+			"interrupted_step": interrupted.Step,
+			"interrupted_sha":  interrupted.SHA,
+		}).Warnln("A launch was interrupted by a restart, will launch the manifest again")
+		if pair.ID == constants.PreparerPodID {
+			// The preparer can't halt and launch itself, but it can
+			// finish switching over to the manifest it runs
+			err = pod.MakeCurrent(pair.Intent)
+			if err != nil {
+				logger.WithError(err).Errorln("Could not make the running preparer current")
+				return false
+			}
+			return true
+		}
 	}
 
-	authorized := p.authorize(pair.Intent, logger)
+	authorized := p.authorizeIntentWriter(pair, logger) && p.authorize(pair.Intent, logger)
 	if !authorized {
 		p.tryRunHooks(
 			hooks.AfterAuthFail,
 			pod,
 			pair.Intent,
+			pair.Span,
 			logger,
 		)
 		// prevent future unnecessary loops, we don't need to check again.
 		return true
 	}
 
+	if pair.Reinstall {
+		logger.WithField("old_sha", oldSHA).Warnln("A reinstall was requested, will halt the pod and install it again")
+		if !p.removeInstalls(pair, pod, logger) {
+			return false
+		}
+		// the pod is no longer running, so it is launched as if it were new
+		pair.Reality = nil
+		return p.installAndLaunchPod(pair, pod, logger)
+	}
+
 	logger.WithField("old_sha", oldSHA).Infoln("manifest SHA has changed, will update")
 	return p.installAndLaunchPod(pair, pod, logger)
 
 }
 
+// removeInstalls halts the pair's pod and removes the installed launchables of
+// its intent, so that they are downloaded and extracted again
+func (p *Preparer) removeInstalls(pair ManifestPair, pod Pod, logger logging.Logger) bool {
+	if pair.Reality != nil {
+		success, err := pod.Halt(p.haltManifest(pair.Reality, logger))
+		if err != nil {
+			logger.WithError(err).Errorln("Pod halt failed")
+			return false
+		} else if !success {
+			logger.NoFields().Warnln("One or more launchables did not halt successfully")
+		}
+		p.PodEvents.Record(pair, pair.Reality, podevents.Halted, nil, logger)
+	}
+	err := pod.RemoveInstalls(pair.Intent)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not remove the pod's installed launchables")
+		return false
+	}
+	return true
+}
+
+// installAndLaunchPod deploys the pair's intent, recording the deploy as a
+// trace that starts when the intent was first observed
 func (p *Preparer) installAndLaunchPod(pair ManifestPair, pod Pod, logger logging.Logger) bool {
-	p.tryRunHooks(hooks.BeforeInstall, pod, pair.Intent, logger)
+	start := pair.Observed
+	if start.IsZero() {
+		start = time.Now()
+	}
+	pair.Span = p.tracer.StartAt("deploy", start)
+	pair.Span.SetAttribute("pod_id", pair.ID.String())
+	pair.Span.SetAttribute("pod_unique_key", pair.PodUniqueKey.String())
+	pair.Span.SetAttribute("sha", pairSHA(pair))
+	if !pair.IntentWriteTime.IsZero() && !pair.Observed.IsZero() {
+		// how long the intent took to reach the preparer
+		receipt := pair.Span.ChildAt("intent_receipt", pair.IntentWriteTime)
+		receipt.EndAt(pair.Observed, nil)
+	}
+	pod.SetTraceSpan(pair.Span)
+
+	withSidecar, err := p.withSidecar(pair.Intent)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not add the pod's sidecar")
+		pair.Span.End(err)
+		return false
+	}
+	resolved, err := artifact.ResolveChannels(p.reloadable().artifactRegistry, withSidecar)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not resolve the channels of the pod's launchables")
+		pair.Span.End(err)
+		return false
+	}
+	if resolved != pair.Intent {
+		pair.WrittenIntent = pair.Intent
+		pair.Intent = resolved
+	}
+
+	ok := p.deployPod(pair, pod, logger)
+	if !ok {
+		err = util.Errorf("deploy of %s did not complete", pair.ID)
+	}
+	pair.Span.End(err)
+	return ok
+}
+
+func (p *Preparer) deployPod(pair ManifestPair, pod Pod, logger logging.Logger) bool {
+	p.tryRunHooks(hooks.BeforeInstall, pod, pair.Intent, pair.Span, logger)
+
+	ports, err := p.ports.allocate(p.store, pair)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not allocate ports")
+		return false
+	}
+	pod.SetAllocatedPorts(ports)
 
+	// the slot is only held while the pod's artifacts are downloaded
+	if !p.deploySlots.acquire(pair.ID, logger) {
+		return false
+	}
 	logger.NoFields().Infoln("Installing pod and launchables")
+	p.PodEvents.Record(pair, pair.Intent, podevents.InstallStarted, nil, logger)
 
-	err := pod.Install(pair.Intent, p.artifactVerifier, p.artifactRegistry)
+	var verificationFailures []podstatus.ArtifactVerificationFailure
+	var installedDigests []string
+	verifier := auth.NewDigestRecordingVerifier(p.verifierForPod(pair.ID, logger, &verificationFailures), func(digest string) {
+		installedDigests = append(installedDigests, digest)
+	})
+	installStart := time.Now()
+	installSpan := pair.Span.Child("install")
+	err = pod.Install(pair.Intent, verifier, p.reloadable().artifactRegistry)
+	installSpan.End(err)
+	p.deploySlots.release(pair.ID, logger)
+	p.metrics.install(installStart, err)
+	p.auditRecorder.RecordVerificationFailures(pair.ID, verificationFailures, logger)
 	if err != nil {
 		// install failed, abort and retry
 		logger.WithError(err).Errorln("Install failed")
+		p.PodEvents.Record(pair, pair.Intent, podevents.InstallFailed, err, logger)
 		return false
 	}
 
-	err = pod.Verify(pair.Intent, p.authPolicy)
+	for _, failure := range verificationFailures {
+		if failure.Policy == auth.WarnVerification.String() {
+			p.tryRunHooks(hooks.AfterVerificationWarn, pod, pair.Intent, pair.Span, logger)
+			break
+		}
+	}
+
+	verifySpan := pair.Span.Child("verify_pod")
+	err = pod.Verify(pair.Intent, p.reloadable().authPolicy)
+	verifySpan.End(err)
+	p.metrics.verification(err)
 	if err != nil {
 		logger.WithError(err).
 			Errorln("Pod digest verification failed")
-		p.tryRunHooks(hooks.AfterAuthFail, pod, pair.Intent, logger)
+		p.PodEvents.Record(pair, pair.Intent, podevents.VerificationFailed, err, logger)
+		p.tryRunHooks(hooks.AfterAuthFail, pod, pair.Intent, pair.Span, logger)
 		return false
 	}
+	p.PodEvents.Record(pair, pair.Intent, podevents.InstallSucceeded, nil, logger)
+
+	p.tryRunHooks(hooks.AfterInstall, pod, pair.Intent, pair.Span, logger)
+
+	// A deploy that only changes the config of a pod with a config_reload
+	// command is applied by signaling the running services, so there is
+	// nothing to preflight or halt.
+	reload := shouldReload(pair, logger)
+	if !reload && pair.ID == constants.PreparerPodID && pair.Reality != nil {
+		// The preparer can't halt itself and then launch the new
+		// version, so it replaces itself in place if it can
+		handled, ok := p.updateSelf(pair, pod, ports, installedDigests, logger)
+		if handled {
+			return ok
+		}
+	}
+	if !reload {
+		// Run preflight checks before halting the old version, so that a new
+		// version that can't run doesn't take down one that can.
+		preflightSpan := pair.Span.Child("preflight")
+		err = pod.Preflight(pair.Intent)
+		preflightSpan.End(err)
+		if err != nil {
+			logger.WithError(err).Errorln("Preflight failed, not launching")
+			if pair.PodUniqueKey != "" {
+				p.writePreflightFailure(pair, err, logger)
+			}
+			return false
+		}
 
-	p.tryRunHooks(hooks.AfterInstall, pod, pair.Intent, logger)
+		if pair.Reality != nil {
+			logger.NoFields().Infoln("Invoking the disable hook and halting runit services")
+			haltSpan := pair.Span.Child("halt")
+			success, err := pod.Halt(p.haltManifest(pair.Reality, logger))
+			haltSpan.End(err)
+			if err != nil {
+				logger.WithError(err).
+					Errorln("Pod halt failed")
+			} else if !success {
+				logger.NoFields().Warnln("One or more launchables did not halt successfully")
+			}
+			p.PodEvents.Record(pair, pair.Reality, podevents.Halted, err, logger)
+		}
+	}
 
-	if pair.Reality != nil {
-		logger.NoFields().Infoln("Invoking the disable hook and halting runit services")
-		success, err := pod.Halt(pair.Reality)
+	p.tryRunHooks(hooks.BeforeLaunch, pod, pair.Intent, pair.Span, logger)
+
+	var ok bool
+	if reload {
+		logger.WithField("config_reload", pair.Intent.GetConfigReload()).Infoln("Only the config changed, signaling runit services to reload")
+		reloadSpan := pair.Span.Child("reload")
+		ok, err = pod.Reload(pair.Intent)
+		reloadSpan.End(err)
 		if err != nil {
 			logger.WithError(err).
-				Errorln("Pod halt failed")
-		} else if !success {
-			logger.NoFields().Warnln("One or more launchables did not halt successfully")
+				Errorln("Reload failed")
+		}
+	} else {
+		logger.NoFields().Infoln("Setting up new runit services and running the enable hook")
+		launchSpan := pair.Span.Child("launch")
+		ok, err = pod.Launch(pair.Intent)
+		launchSpan.End(err)
+		if err != nil {
+			logger.WithError(err).
+				Errorln("Launch failed")
 		}
 	}
+	if err == nil {
+		// Don't record the pod until it is ready, so that whatever is
+		// waiting on the deploy doesn't move on past a pod that never
+		// became healthy.
+		readySpan := pair.Span.Child("wait_until_ready")
+		err = p.waitUntilReady(pod, pair.Intent, ports, logger)
+		readySpan.End(err)
+		if err != nil {
+			logger.WithError(err).Errorln("Pod did not become ready")
+			p.PodEvents.Record(pair, pair.Intent, podevents.LaunchFailed, err, logger)
+			return false
+		}
 
-	p.tryRunHooks(hooks.BeforeLaunch, pod, pair.Intent, logger)
-
-	logger.NoFields().Infoln("Setting up new runit services and running the enable hook")
-
-	ok, err := pod.Launch(pair.Intent)
-	if err != nil {
-		logger.WithError(err).
-			Errorln("Launch failed")
-	} else {
+		realitySpan := pair.Span.Child("reality_write")
 		if pair.PodUniqueKey == "" {
 			// legacy pod, write the manifest back to reality tree
-			duration, err := p.store.SetPod(consul.REALITY_TREE, p.node, pair.Intent)
+			metadata := p.realityMetadata(pair, reload, installedDigests, logger)
+			metadata.Ports = ports
+			err := p.store.SetRealityWithMetadata(p.node, pair.writtenIntent(), metadata)
 			if err != nil {
-				logger.WithErrorAndFields(err, logrus.Fields{
-					"duration": duration}).
-					Errorln("Could not set pod in reality store")
+				logger.WithError(err).Errorln("Could not set pod in reality store")
 			}
+			realitySpan.End(err)
 		} else {
-			backoff := 100 * time.Millisecond
-			for err := p.writeStatusRecord(pair, logger); err != nil; err = p.writeStatusRecord(pair, logger) {
-				time.Sleep(backoff)
-				backoff = 2 * backoff
-				if backoff > time.Minute {
-					backoff = time.Minute
-				}
-			}
+			err := consulutil.Retry(nil, statusRetryPolicy, func() error {
+				return p.writeStatusRecord(pair, verificationFailures, logger)
+			})
+			realitySpan.End(err)
+		}
+
+		if p.Propagation != nil && ok {
+			p.Propagation.Launched(pair, time.Now())
 		}
 
-		p.tryRunHooks(hooks.AfterLaunch, pod, pair.Intent, logger)
+		p.tryRunHooks(hooks.AfterLaunch, pod, pair.Intent, pair.Span, logger)
 
 		pod.Prune(p.maxLaunchableDiskUsage, pair.Intent) // errors are logged internally
 	}
+	if err != nil || !ok {
+		p.PodEvents.Record(pair, pair.Intent, podevents.LaunchFailed, err, logger)
+	} else {
+		p.PodEvents.Record(pair, pair.Intent, podevents.Launched, nil, logger)
+	}
 	return err == nil && ok
 }
 
-func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) error {
+// realityMetadata describes the deploy of pair's intent for its reality
+// record. Artifacts that are already installed aren't downloaded (and
+// verified) again, so if no digests were recorded, those of the previous
+// deploy are kept. The previous restart time is kept if the deploy only
+// reloaded the pod's config.
+func (p *Preparer) realityMetadata(pair ManifestPair, reloaded bool, digests []string, logger logging.Logger) consul.RealityMetadata {
+	now := time.Now()
+	metadata := consul.RealityMetadata{
+		InstallTime:     now,
+		LastRestart:     now,
+		ArtifactDigests: digests,
+		PreparerVersion: version.VERSION,
+	}
+	if pair.Reality == nil {
+		return metadata
+	}
+
+	previous, err := p.store.RealityMetadata(p.node, pair.ID)
+	if err != nil {
+		if !consulutil.IsNotFound(err) {
+			logger.WithError(err).Warnln("Could not read the reality metadata of the previous deploy")
+		}
+		return metadata
+	}
+	if len(digests) == 0 {
+		metadata.ArtifactDigests = previous.ArtifactDigests
+	}
+	if reloaded {
+		metadata.LastRestart = previous.LastRestart
+	}
+	return metadata
+}
+
+// shouldReload returns whether the pair can be deployed by reloading the
+// running pod rather than restarting it, which is only the case when the
+// intent specifies a config_reload command and nothing but the config
+// differs from reality.
+func shouldReload(pair ManifestPair, logger logging.Logger) bool {
+	if pair.Reality == nil || pair.Intent.GetConfigReload() == "" {
+		return false
+	}
+	// reality records the intent as written, before its channels were
+	// resolved and its sidecar was added
+	intent := pair.writtenIntent()
+	// An unchanged manifest is only deployed again to redo an interrupted
+	// launch, which reloading wouldn't do
+	oldSHA, _ := pair.Reality.SHA()
+	if newSHA, _ := intent.SHA(); oldSHA == newSHA {
+		return false
+	}
+	onlyConfig, err := manifest.OnlyConfigChanged(pair.Reality, intent)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not compare manifests, will restart instead of reloading")
+		return false
+	}
+	return onlyConfig
+}
+
+// verifierForPod wraps the preparer's artifact verifier with the verification
+// failure policy configured for podID. Failures that the policy lets through
+// are logged and appended to failures so they can be recorded in the pod's
+// status.
+func (p *Preparer) verifierForPod(podID types.PodID, logger logging.Logger, failures *[]podstatus.ArtifactVerificationFailure) auth.ArtifactVerifier {
+	reloadable := p.reloadable()
+	policy := reloadable.verificationPolicy.forPod(podID)
+	return auth.NewPolicyVerifier(reloadable.artifactVerifier, policy, func(failure auth.VerificationFailure) {
+		entry := logger.WithErrorAndFields(failure.Err, logrus.Fields{
+			"verification_policy": failure.Policy,
+		})
+		if failure.Policy == auth.WarnVerification {
+			entry.Warnln("Artifact verification failed, installing anyway due to verification policy")
+		} else {
+			entry.Infoln("Artifact verification failed, installing anyway due to verification policy")
+		}
+
+		p.metrics.artifactVerificationAllowed(failure.Policy.String())
+		*failures = append(*failures, podstatus.ArtifactVerificationFailure{
+			Policy: failure.Policy.String(),
+			Error:  failure.Err.Error(),
+			Time:   time.Now(),
+		})
+	})
+}
+
+func (p *Preparer) writeStatusRecord(pair ManifestPair, verificationFailures []podstatus.ArtifactVerificationFailure, logger logging.Logger) error {
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
 	err := p.podStore.WriteRealityIndex(ctx, pair.PodUniqueKey, p.node)
@@ -448,13 +859,16 @@ func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) e
 
 	// uuid pod, write the manifest to the pod status tree.
 	mutator := func(ps podstatus.PodStatus) (podstatus.PodStatus, error) {
-		manifestBytes, err := pair.Intent.Marshal()
+		manifestBytes, err := pair.writtenIntent().Marshal()
 		if err != nil {
 			return ps, util.Errorf("Could not convert manifest to string to update pod status")
 		}
 
 		ps.PodStatus = podstatus.PodLaunched
 		ps.Manifest = string(manifestBytes)
+		ps.ArtifactVerificationFailures = verificationFailures
+		ps.PreflightFailure = nil
+		ps.NodeLabels = p.NodeLabels.Labels()
 		return ps, nil
 	}
 	err = p.podStatusStore.MutateStatus(ctx, pair.PodUniqueKey, mutator)
@@ -479,15 +893,51 @@ func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) e
 	return nil
 }
 
+// writePreflightFailure records a failed preflight check in the pod's status.
+// Errors are logged rather than retried, since the preflight will be run (and
+// the status written) again on the next attempt to launch the pod.
+func (p *Preparer) writePreflightFailure(pair ManifestPair, preflightErr error, logger logging.Logger) {
+	failure := &podstatus.PreflightFailure{
+		Error: preflightErr.Error(),
+		Time:  time.Now(),
+	}
+	if launchErr, ok := preflightErr.(launch.PreflightError); ok {
+		failure.LaunchableID = launchErr.LaunchableID
+		failure.Output = launchErr.Output
+	}
+
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err := p.podStatusStore.MutateStatus(ctx, pair.PodUniqueKey, func(ps podstatus.PodStatus) (podstatus.PodStatus, error) {
+		ps.PreflightFailure = failure
+		return ps, nil
+	})
+	if err != nil {
+		logger.WithError(err).Errorln("Could not add 'record preflight failure in pod status' to transaction")
+		return
+	}
+
+	ok, resp, err := transaction.Commit(ctx, p.client.KV())
+	if err != nil {
+		logger.WithError(err).Errorln("Could not record preflight failure in pod status")
+		return
+	}
+	if !ok {
+		err := util.Errorf("status record transaction rolled back: %s", transaction.TxnErrorsToString(resp.Errors))
+		logger.WithError(err).Errorln("Could not record preflight failure in pod status")
+	}
+}
+
 func (p *Preparer) stopAndUninstallPod(pair ManifestPair, pod Pod, logger logging.Logger) bool {
-	success, err := pod.Halt(pair.Reality)
+	success, err := pod.Halt(p.haltManifest(pair.Reality, logger))
 	if err != nil {
 		logger.WithError(err).Errorln("Pod halt failed")
 	} else if !success {
 		logger.NoFields().Warnln("One or more launchables did not halt successfully")
 	}
+	p.PodEvents.Record(pair, pair.Reality, podevents.Halted, err, logger)
 
-	p.tryRunHooks(hooks.BeforeUninstall, pod, pair.Reality, logger)
+	p.tryRunHooks(hooks.BeforeUninstall, pod, pair.Reality, pair.Span, logger)
 
 	err = pod.Uninstall()
 	if err != nil {
@@ -495,6 +945,8 @@ func (p *Preparer) stopAndUninstallPod(pair ManifestPair, pod Pod, logger loggin
 		return false
 	}
 	logger.NoFields().Infoln("Successfully uninstalled")
+	p.PodEvents.Record(pair, pair.Reality, podevents.Removed, nil, logger)
+	p.ports.release(podWorkerID{podID: pair.ID, podUniqueKey: pair.PodUniqueKey})
 
 	if pair.PodUniqueKey == "" {
 		dur, err := p.store.DeletePod(consul.REALITY_TREE, p.node, pair.ID)
@@ -503,14 +955,9 @@ func (p *Preparer) stopAndUninstallPod(pair ManifestPair, pod Pod, logger loggin
 				Errorln("Could not delete pod from reality store")
 		}
 	} else {
-		backoff := 100 * time.Millisecond
-		for err := p.markUninstalled(pair, pod, logger); err != nil; err = p.markUninstalled(pair, pod, logger) {
-			time.Sleep(backoff)
-			backoff = 2 * backoff
-			if backoff > time.Minute {
-				backoff = time.Minute
-			}
-		}
+		_ = consulutil.Retry(nil, statusRetryPolicy, func() error {
+			return p.markUninstalled(pair, pod, logger)
+		})
 	}
 	return true
 }
@@ -561,6 +1008,9 @@ func (p *Preparer) Close() {
 	if err != nil {
 		p.Logger.WithError(err).Errorln("Unable to close audit logger. Proceeding.")
 	}
+	p.configMu.Lock()
 	p.authPolicy.Close()
 	p.authPolicy = nil
+	p.configMu.Unlock()
+	p.tracer.Close()
 }
@@ -10,16 +10,24 @@ import (
 	"time"
 
 	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/admission"
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/freeze"
 	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/tracing"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/util/size"
+	"github.com/square/p2/pkg/version"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/clearsign"
 	"golang.org/x/crypto/openpgp/packet"
@@ -28,8 +36,17 @@ import (
 type TestPod struct {
 	currentManifest                                                      manifest.Manifest
 	installed, uninstalled, launched, launchSuccess, halted, haltSuccess bool
+	reloaded, removedInstalls                                            bool
 	installErr, uninstallErr, launchErr, haltError, currentManifestError error
+	preflightErr, readinessErr                                           error
+	readinessChecks                                                      int
+	allocatedPorts                                                       map[launch.LaunchableID]int
+	traceSpan                                                            *tracing.Span
 	configDir, envDir                                                    string
+	artifactResults                                                      map[launch.LaunchableID]error
+	serviceStatuses                                                      map[string]pods.ServiceStatus
+	verifiedArtifacts                                                    int
+	interruptedLaunch                                                    *pods.JournalEntry
 }
 
 func (t *TestPod) Prune(_ size.ByteCount, _ manifest.Manifest) {
@@ -49,6 +66,12 @@ func (t *TestPod) Launch(manifest manifest.Manifest) (bool, error) {
 	return t.launchSuccess, nil
 }
 
+func (t *TestPod) Reload(manifest manifest.Manifest) (bool, error) {
+	t.currentManifest = manifest
+	t.reloaded = true
+	return t.launchSuccess, nil
+}
+
 func (t *TestPod) Install(manifest manifest.Manifest, _ auth.ArtifactVerifier, _ artifact.Registry) error {
 	t.installed = true
 	return t.installErr
@@ -59,15 +82,62 @@ func (t *TestPod) Uninstall() error {
 	return t.uninstallErr
 }
 
+func (t *TestPod) RemoveInstalls(manifest manifest.Manifest) error {
+	t.removedInstalls = true
+	return nil
+}
+
 func (t *TestPod) Verify(manifest manifest.Manifest, authPolicy auth.Policy) error {
 	return nil
 }
 
+func (t *TestPod) Preflight(manifest manifest.Manifest) error {
+	return t.preflightErr
+}
+
+func (t *TestPod) SetAllocatedPorts(ports map[launch.LaunchableID]int) {
+	t.allocatedPorts = ports
+}
+
+func (t *TestPod) SetTraceSpan(span *tracing.Span) {
+	t.traceSpan = span
+}
+
+func (t *TestPod) CheckReadiness(manifest manifest.Manifest) (string, error) {
+	t.readinessChecks++
+	return "", t.readinessErr
+}
+
+func (t *TestPod) VerifyArtifacts(_ manifest.Manifest, _ auth.ArtifactVerifier, _ artifact.Registry) map[launch.LaunchableID]error {
+	t.verifiedArtifacts++
+	return t.artifactResults
+}
+
+func (t *TestPod) ServiceStatuses(_ manifest.Manifest) (map[string]pods.ServiceStatus, error) {
+	return t.serviceStatuses, nil
+}
+
 func (t *TestPod) Halt(manifest manifest.Manifest) (bool, error) {
 	t.halted = true
 	return t.haltSuccess, t.haltError
 }
 
+func (t *TestPod) MakeCurrent(manifest manifest.Manifest) error {
+	t.currentManifest = manifest
+	return nil
+}
+
+func (t *TestPod) Launchables(manifest manifest.Manifest) ([]launch.Launchable, error) {
+	return nil, nil
+}
+
+func (t *TestPod) Recover() (pods.JournalEntry, bool, error) {
+	if t.interruptedLaunch == nil {
+		return pods.JournalEntry{}, false, nil
+	}
+	return *t.interruptedLaunch, true, nil
+}
+
 func (t *TestPod) ConfigDir() string {
 	if t.configDir != "" {
 		return t.configDir
@@ -119,6 +189,8 @@ func (f *fakeHooks) RunHookType(hookType hooks.HookType, pod hooks.Pod, manifest
 	case hooks.AfterAuthFail:
 		f.ranAfterAuthFail = true
 		return f.afterAuthFailErr
+	case hooks.AfterVerificationWarn:
+		return nil
 	}
 	return util.Errorf("Invalid hook type configured in test: %s", hookType)
 }
@@ -169,6 +241,8 @@ func testSignedManifest(t *testing.T, modify func(manifest.Builder, *openpgp.Ent
 type FakeStore struct {
 	currentManifest      manifest.Manifest
 	currentManifestError error
+	realityMetadata      *consul.RealityMetadata
+	allRealityMetadata   []consul.RealityMetadataResult
 }
 
 func (f *FakeStore) ListPods(consul.PodPrefix, types.NodeName) ([]consul.ManifestResult, time.Duration, error) {
@@ -195,6 +269,22 @@ func (f *FakeStore) DeletePod(consul.PodPrefix, types.NodeName, types.PodID) (ti
 	return 0, nil
 }
 
+func (f *FakeStore) SetRealityWithMetadata(_ types.NodeName, _ manifest.Manifest, metadata consul.RealityMetadata) error {
+	f.realityMetadata = &metadata
+	return nil
+}
+
+func (f *FakeStore) ListRealityMetadata(types.NodeName) ([]consul.RealityMetadataResult, error) {
+	return f.allRealityMetadata, nil
+}
+
+func (f *FakeStore) RealityMetadata(types.NodeName, types.PodID) (consul.RealityMetadata, error) {
+	if f.realityMetadata == nil {
+		return consul.RealityMetadata{}, consulutil.NotFoundError{Key: "reality_metadata"}
+	}
+	return *f.realityMetadata, nil
+}
+
 func (f *FakeStore) WatchPods(consul.PodPrefix, types.NodeName, <-chan struct{}, chan<- error, chan<- []consul.ManifestResult) {
 }
 
@@ -213,6 +303,8 @@ func testPreparer(t *testing.T, f *FakeStore) (*Preparer, *fakeHooks, string) {
 	hooks := &fakeHooks{}
 	p.hooks = hooks
 	p.store = f
+	p.PodEvents = NewPodEventRecorder(cfg.NodeName, &fakePodEventStore{})
+	p.freezes = newDeployFreezes(freeze.NewChecker(fakeFreezes{}), labels.NewFakeApplicator(), cfg.NodeName)
 	return p, hooks, podRoot
 }
 
@@ -268,6 +360,42 @@ func TestPreparerLaunchesPodsThatHaveDifferentSHAs(t *testing.T) {
 	Assert(t).AreEqual(newManifest, testPod.currentManifest, "the current manifest should now be the new manifest")
 }
 
+func TestPreparerRecordsRealityMetadata(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	existing := builder.GetManifest()
+
+	testPod := &TestPod{
+		launchSuccess:   true,
+		haltSuccess:     true,
+		currentManifest: existing,
+	}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Reality: existing,
+		Intent:  newManifest,
+	}
+
+	lastRestart := time.Now().Add(-time.Hour)
+	store := &FakeStore{
+		realityMetadata: &consul.RealityMetadata{
+			LastRestart:     lastRestart,
+			ArtifactDigests: []string{"abc"},
+			PreparerVersion: "old",
+		},
+	}
+	p, _, fakePodRoot := testPreparer(t, store)
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).AreEqual(store.realityMetadata.PreparerVersion, version.VERSION, "should have recorded the preparer's version")
+	Assert(t).IsTrue(store.realityMetadata.HasArtifact("abc"), "should have kept the digests of artifacts that weren't downloaded again")
+	Assert(t).IsTrue(store.realityMetadata.LastRestart.After(lastRestart), "should have recorded the restart")
+}
+
 func TestPreparerFailsIfInstallFails(t *testing.T) {
 	testPod := &TestPod{
 		installErr: fmt.Errorf("There was an error installing"),
@@ -290,6 +418,111 @@ func TestPreparerFailsIfInstallFails(t *testing.T) {
 	Assert(t).IsFalse(hooks.ranAfterLaunch, "should not have run after_launch hooks")
 }
 
+func TestPreparerDoesNotHaltOrLaunchIfPreflightFails(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	existing := builder.GetManifest()
+
+	testPod := &TestPod{
+		launchSuccess:   true,
+		haltSuccess:     true,
+		currentManifest: existing,
+		preflightErr:    fmt.Errorf("missing libfoo"),
+	}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Reality: existing,
+		Intent:  newManifest,
+	}
+
+	p, hooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsFalse(success, "The deploy should have failed")
+	Assert(t).IsTrue(testPod.installed, "Install should have happened")
+	Assert(t).IsFalse(testPod.halted, "The old version should not have been halted")
+	Assert(t).IsFalse(testPod.launched, "Launch should not have happened")
+	Assert(t).IsFalse(hooks.ranBeforeLaunch, "should not have run before_launch hooks")
+	Assert(t).AreEqual(existing, testPod.currentManifest, "the current manifest should still be the old manifest")
+}
+
+func TestPreparerDoesNotRecordRealityUntilPodIsReady(t *testing.T) {
+	oldTimeout := *ReadinessTimeoutSec
+	defer func() { *ReadinessTimeoutSec = oldTimeout }()
+	*ReadinessTimeoutSec = 0
+
+	builder := testManifest(t).GetBuilder()
+	builder.SetReadiness(&manifest.ReadinessStanza{Command: []string{"/bin/false"}})
+	newManifest := builder.GetManifest()
+
+	testPod := &TestPod{
+		launchSuccess: true,
+		haltSuccess:   true,
+		readinessErr:  fmt.Errorf("exit status 1"),
+	}
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	store := &FakeStore{}
+	p, hooks, fakePodRoot := testPreparer(t, store)
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsFalse(success, "The deploy should have failed")
+	Assert(t).IsTrue(testPod.launched, "Launch should have happened")
+	Assert(t).IsTrue(testPod.readinessChecks > 0, "Readiness should have been checked")
+	Assert(t).IsTrue(store.realityMetadata == nil, "Reality should not have been written")
+	Assert(t).IsFalse(hooks.ranAfterLaunch, "should not have run after_launch hooks")
+
+	testPod.readinessErr = nil
+	success = p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "The deploy should have succeeded once the pod was ready")
+	Assert(t).IsTrue(store.realityMetadata != nil, "Reality should have been written")
+}
+
+func TestPreparerReloadsPodsWhenOnlyConfigChanged(t *testing.T) {
+	existing := testManifest(t)
+	builder := existing.GetBuilder()
+	builder.SetConfigReload("hup")
+	existing = builder.GetManifest()
+
+	builder = existing.GetBuilder()
+	err := builder.SetConfig(map[interface{}]interface{}{"color": "blue"})
+	Assert(t).IsNil(err, "should not have erred setting the config")
+	newManifest := builder.GetManifest()
+
+	testPod := &TestPod{
+		launchSuccess:   true,
+		haltSuccess:     true,
+		currentManifest: existing,
+		preflightErr:    fmt.Errorf("preflight should not run on reload"),
+	}
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Reality: existing,
+		Intent:  newManifest,
+	}
+
+	p, hooks, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "The deploy should have succeeded")
+	Assert(t).IsTrue(testPod.installed, "Install should have happened to write the new config")
+	Assert(t).IsTrue(testPod.reloaded, "The pod should have been reloaded")
+	Assert(t).IsFalse(testPod.halted, "The old version should not have been halted")
+	Assert(t).IsFalse(testPod.launched, "Launch should not have happened")
+	Assert(t).IsTrue(hooks.ranAfterLaunch, "should have run after_launch hooks")
+	Assert(t).AreEqual(newManifest, testPod.currentManifest, "the current manifest should be the new manifest")
+}
+
 func TestPreparerWillLaunchPreparerAsRoot(t *testing.T) {
 	builder := manifest.NewBuilder()
 	builder.SetID(constants.PreparerPodID)
@@ -341,6 +574,61 @@ func TestPreparerWillNotInstallOrLaunchIfSHAIsTheSame(t *testing.T) {
 	Assert(t).IsFalse(hooks.ranAfterLaunch, "Should not have run after_launch hooks")
 }
 
+func TestPreparerRelaunchesInterruptedLaunch(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	builder.SetConfigReload("kill -HUP $PID")
+	testManifest := builder.GetManifest()
+	sha, _ := testManifest.SHA()
+	pair := ManifestPair{
+		ID:      testManifest.ID(),
+		Intent:  testManifest,
+		Reality: testManifest,
+	}
+	testPod := &TestPod{
+		launchSuccess:     true,
+		haltSuccess:       true,
+		currentManifest:   testManifest,
+		interruptedLaunch: &pods.JournalEntry{Step: pods.JournalSwitchSymlinks, SHA: sha},
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(pair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsTrue(testPod.halted, "should have halted the half-launched pod")
+	Assert(t).IsTrue(testPod.launched, "should have launched the pod again")
+	Assert(t).IsFalse(testPod.reloaded, "should not have reloaded instead of launching")
+}
+
+func TestPreparerReinstallsWhenRequested(t *testing.T) {
+	testManifest := testManifest(t)
+	pair := ManifestPair{
+		ID:        testManifest.ID(),
+		Intent:    testManifest,
+		Reality:   testManifest,
+		Reinstall: true,
+	}
+	testPod := &TestPod{
+		launchSuccess:   true,
+		haltSuccess:     true,
+		currentManifest: testManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(pair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsTrue(testPod.halted, "should have halted the pod before removing its launchables")
+	Assert(t).IsTrue(testPod.removedInstalls, "should have removed the installed launchables")
+	Assert(t).IsTrue(testPod.installed, "should have installed the pod again")
+	Assert(t).IsTrue(testPod.launched, "should have launched the pod again")
+}
+
 func TestPreparerWillRemoveIfManifestDisappears(t *testing.T) {
 	testManifest := testManifest(t)
 	newPair := ManifestPair{
@@ -376,6 +664,79 @@ func TestPreparerWillRequireSignatureWithKeyring(t *testing.T) {
 	)
 }
 
+func TestPreparerRequiresConfinement(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	p.confinement = ConfinementConfig{Required: true}
+
+	builder := testManifest(t).GetBuilder()
+	Assert(t).IsFalse(p.authorize(builder.GetManifest(), logging.DefaultLogger), "should have refused an unconfined pod")
+
+	builder.SetConfinement(&manifest.ConfinementStanza{AppArmorProfile: "p2-pod"})
+	Assert(t).IsTrue(p.authorize(builder.GetManifest(), logging.DefaultLogger), "should have accepted a confined pod")
+
+	builder.SetConfinement(nil)
+	p.confinement.Exempt = []types.PodID{builder.GetManifest().ID()}
+	Assert(t).IsTrue(p.authorize(builder.GetManifest(), logging.DefaultLogger), "should have accepted an exempt pod")
+}
+
+func TestPreparerEnforcesAdmission(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	admitter, err := admission.New(admission.Config{RequiredConfigKeys: []string{"owner"}})
+	Assert(t).IsNil(err, "test setup: could not configure admission")
+	p.admitter = &admitter
+
+	builder := testManifest(t).GetBuilder()
+	Assert(t).IsFalse(p.authorize(builder.GetManifest(), logging.DefaultLogger), "should have refused a manifest without the required config")
+
+	err = builder.SetConfig(map[interface{}]interface{}{"owner": "web-team"})
+	Assert(t).IsNil(err, "test setup: could not set config")
+	Assert(t).IsTrue(p.authorize(builder.GetManifest(), logging.DefaultLogger), "should have accepted an admitted manifest")
+}
+
+func TestPreparerAuthorizesIntentWriters(t *testing.T) {
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	writer, err := openpgp.NewEntity("scheduler", "", "scheduler@example.com", nil)
+	Assert(t).IsNil(err, "test setup: could not create a writer key")
+	podManifest := testManifest(t)
+	sha, err := podManifest.SHA()
+	Assert(t).IsNil(err, "test setup: could not hash the manifest")
+
+	sign := func(node types.NodeName) *consul.IntentEnvelope {
+		envelope := &consul.IntentEnvelope{Node: node, PodID: podManifest.ID(), ManifestSHA: sha}
+		var signature bytes.Buffer
+		err := openpgp.DetachSign(&signature, writer, bytes.NewReader(envelope.SignedBytes()), nil)
+		Assert(t).IsNil(err, "test setup: could not sign the envelope")
+		envelope.Signature = signature.Bytes()
+		return envelope
+	}
+	pair := ManifestPair{ID: podManifest.ID(), Intent: podManifest, IntentEnvelope: sign(p.node)}
+	Assert(t).IsTrue(p.authorizeIntentWriter(pair, logging.DefaultLogger), "should accept any intent without intent_auth")
+
+	p.intentWriterPolicy = &auth.IntentWriterPolicy{
+		Keyring: openpgp.EntityList{writer},
+		Rules: auth.RuleDocument{Rules: []auth.Rule{
+			{Signers: []string{"scheduler@example.com"}, Pods: []string{podManifest.ID().String()}},
+		}},
+	}
+	Assert(t).IsTrue(p.authorizeIntentWriter(pair, logging.DefaultLogger), "should have accepted intent of an allowed writer")
+
+	pair.IntentEnvelope = sign("other_node")
+	Assert(t).IsFalse(p.authorizeIntentWriter(pair, logging.DefaultLogger), "should have refused intent signed for another node")
+
+	pair.IntentEnvelope = nil
+	Assert(t).IsFalse(p.authorizeIntentWriter(pair, logging.DefaultLogger), "should have refused unsigned intent")
+
+	p.intentWriterPolicy.Rules.Rules[0].Pods = []string{"other_pod"}
+	pair.IntentEnvelope = sign(p.node)
+	Assert(t).IsFalse(p.authorizeIntentWriter(pair, logging.DefaultLogger), "should have refused intent of a writer not allowed the pod")
+}
+
 func TestPreparerWillAcceptSignatureFromKeyring(t *testing.T) {
 	manifest, fakeSigner := testSignedManifest(t, nil)
 
@@ -0,0 +1,137 @@
+package preparer
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/square/p2/pkg/grpc/podeventstream"
+	podeventstream_protos "github.com/square/p2/pkg/grpc/podeventstream/protos"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/podevents"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// PodEventRetentionSec is how long the pod events of a node are kept in the
+// store
+var PodEventRetentionSec = param.Int("pod_event_retention_sec", 86400)
+
+// podEventPruneInterval is how often expired events are deleted. Pruning is
+// done while recording, so a node without deploys keeps its last events.
+const podEventPruneInterval = 10 * time.Minute
+
+type PodEventStore interface {
+	Record(event podevents.Event) error
+	DeleteBefore(node types.NodeName, before time.Time) error
+}
+
+// PodEventRecorder records each lifecycle transition of the node's pods in the
+// store and publishes it to the subscribers of the local event stream, so
+// that deploy tooling can follow a deploy without diffing the reality tree.
+// Events are best effort: failing to record one is logged and never fails the
+// deploy.
+//
+// A nil *PodEventRecorder is valid and records nothing.
+type PodEventRecorder struct {
+	node        types.NodeName
+	store       PodEventStore
+	broadcaster *podevents.Broadcaster
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+func NewPodEventRecorder(node types.NodeName, store PodEventStore) *PodEventRecorder {
+	return &PodEventRecorder{
+		node:        node,
+		store:       store,
+		broadcaster: podevents.NewBroadcaster(),
+	}
+}
+
+// Record records an event of the type for the manifest of the pair. err is
+// the cause of failure events.
+func (r *PodEventRecorder) Record(pair ManifestPair, m manifest.Manifest, eventType podevents.Type, err error, logger logging.Logger) {
+	if r == nil {
+		return
+	}
+
+	event := podevents.Event{
+		Node:         r.node,
+		PodID:        pair.ID,
+		PodUniqueKey: pair.PodUniqueKey,
+		Type:         eventType,
+		Time:         time.Now(),
+	}
+	if m != nil {
+		event.SHA, _ = m.SHA()
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	r.broadcaster.Publish(event)
+
+	recordErr := r.store.Record(event)
+	if recordErr != nil {
+		logger.WithError(recordErr).Warnf("Could not record %s pod event", eventType)
+	}
+	r.prune(event.Time, logger)
+}
+
+func (r *PodEventRecorder) prune(now time.Time, logger logging.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.lastPruned) < podEventPruneInterval {
+		return
+	}
+	r.lastPruned = now
+
+	retention := time.Duration(*PodEventRetentionSec) * time.Second
+	err := r.store.DeleteBefore(r.node, now.Add(-retention))
+	if err != nil {
+		logger.WithError(err).Warnln("Could not delete expired pod events")
+	}
+}
+
+// Subscribe returns a channel of the events recorded from now on, and a
+// function to call to unsubscribe
+func (r *PodEventRecorder) Subscribe() (<-chan podevents.Event, func()) {
+	return r.broadcaster.Subscribe()
+}
+
+// PodEventServer streams the events of a PodEventRecorder over gRPC on a unix
+// socket
+type PodEventServer struct {
+	server   *grpc.Server
+	listener net.Listener
+	logger   *logging.Logger
+}
+
+func NewPodEventServer(socket string, recorder *PodEventRecorder, logger *logging.Logger) (*PodEventServer, error) {
+	logger.WithField("socket", socket).Infof("Streaming pod events on socket %s", socket)
+	listener, err := listenOnSocket(socket, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	server := grpc.NewServer()
+	podeventstream_protos.RegisterP2PodEventsServer(server, podeventstream.NewServer(recorder))
+	return &PodEventServer{
+		server:   server,
+		listener: listener,
+		logger:   logger,
+	}, nil
+}
+
+func (s *PodEventServer) Serve() {
+	err := s.server.Serve(s.listener)
+	s.logger.WithError(err).Warnln("Pod event server exited")
+}
+
+func (s *PodEventServer) Close() {
+	s.server.Stop()
+}
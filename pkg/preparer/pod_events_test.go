@@ -0,0 +1,131 @@
+package preparer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/podevents"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakePodEventStore struct {
+	mu      sync.Mutex
+	events  []podevents.Event
+	deleted []time.Time
+}
+
+func (f *fakePodEventStore) Record(event podevents.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakePodEventStore) DeleteBefore(node types.NodeName, before time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, before)
+	return nil
+}
+
+func (f *fakePodEventStore) types() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var recorded []string
+	for _, event := range f.events {
+		recorded = append(recorded, string(event.Type))
+	}
+	return strings.Join(recorded, " ")
+}
+
+func TestPreparerRecordsPodEventsOfDeploy(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	existing := builder.GetManifest()
+	testPod := &TestPod{
+		launchSuccess:   true,
+		haltSuccess:     true,
+		currentManifest: existing,
+	}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Reality: existing,
+		Intent:  newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	events, unsubscribe := p.PodEvents.Subscribe()
+	defer unsubscribe()
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "should have succeeded")
+
+	store := p.PodEvents.store.(*fakePodEventStore)
+	Assert(t).AreEqual(store.types(), "install_started install_succeeded halted launched", "should have recorded each step of the deploy")
+	newSHA, _ := newManifest.SHA()
+	oldSHA, _ := existing.SHA()
+	Assert(t).AreEqual(store.events[2].SHA, oldSHA, "the halt should have been recorded for the old manifest")
+	Assert(t).AreEqual(store.events[3].SHA, newSHA, "the launch should have been recorded for the new manifest")
+	Assert(t).AreEqual(store.events[3].Node, types.NodeName("hostname"), "should have recorded the node")
+	Assert(t).AreEqual(len(store.deleted), 1, "should have pruned expired events once")
+
+	streamed := <-events
+	Assert(t).AreEqual(streamed.Type, podevents.InstallStarted, "should have published the events to subscribers")
+}
+
+func TestPreparerRecordsPodEventsOfFailedInstall(t *testing.T) {
+	testPod := &TestPod{
+		installErr: fmt.Errorf("There was an error installing"),
+	}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "The deploy should have failed")
+
+	store := p.PodEvents.store.(*fakePodEventStore)
+	Assert(t).AreEqual(store.types(), "install_started install_failed", "should have recorded the failed install")
+	Assert(t).AreEqual(store.events[1].Error, "There was an error installing", "should have recorded the cause of the failure")
+}
+
+func TestPreparerRecordsPodEventsOfRemoval(t *testing.T) {
+	testManifest := testManifest(t)
+	pair := ManifestPair{
+		ID:      testManifest.ID(),
+		Reality: testManifest,
+	}
+	testPod := &TestPod{
+		currentManifest: testManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(pair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "Should have successfully removed pod")
+
+	store := p.PodEvents.store.(*fakePodEventStore)
+	Assert(t).AreEqual(store.types(), "halted removed", "should have recorded the removal")
+}
+
+func TestNilPodEventRecorderRecordsNothing(t *testing.T) {
+	var recorder *PodEventRecorder
+	recorder.Record(ManifestPair{ID: "hello"}, nil, podevents.Launched, nil, logging.DefaultLogger)
+}
@@ -10,7 +10,6 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/square/p2/pkg/launch"
@@ -208,6 +207,19 @@ func New(config ReporterConfig, logger logging.Logger, podStatusStore PodStatusS
 
 // Starts the reporter. Quickly returns an error if a startup issue occurs.
 func (r *Reporter) Run(quitCh <-chan struct{}) error {
+	err := r.Init()
+	if err != nil {
+		return err
+	}
+
+	go r.mainLoop(quitCh)
+	return nil
+}
+
+// Init prepares the reporter's workspace and finish database. It is split
+// from Run so that callers wishing to supervise the reporter can run Loop
+// themselves. The finish database is closed if initialization fails.
+func (r *Reporter) Init() error {
 	err := r.initWorkspaceDir()
 	if err != nil {
 		_ = r.finishService.Close()
@@ -225,11 +237,35 @@ func (r *Reporter) Run(quitCh <-chan struct{}) error {
 	if err != nil {
 		return util.Errorf("Could not chmod finish database %s to 0666 to allow finish to write to it: %s", r.databasePath, err)
 	}
-
-	go r.mainLoop(quitCh)
 	return nil
 }
 
+// Loop publishes process exits and prunes old finish rows until quitCh is
+// closed. It must only be called after a successful Init, and unlike Run it
+// does not close the finish database when it returns, so it may be safely
+// restarted after a panic. Call Close once the loop will no longer be run.
+func (r *Reporter) Loop(quitCh <-chan struct{}) {
+	publishTimer := time.NewTimer(0)
+	pruneTimer := time.NewTimer(0)
+	for {
+		select {
+		case <-quitCh:
+			return
+		case <-publishTimer.C:
+			r.reportLatestExits()
+			publishTimer.Reset(r.pollInterval)
+		case <-pruneTimer.C:
+			r.pruneRows()
+			pruneTimer.Reset(r.pruneInterval)
+		}
+	}
+}
+
+// Close releases the reporter's finish database.
+func (r *Reporter) Close() error {
+	return r.finishService.Close()
+}
+
 // Initializes the workspace dir:
 // 1) create it if it doesn't exist with perms 0600
 // 2) create the workspace file inside of the directory if it doesn't exist (and write 0 value to it)
@@ -284,53 +320,16 @@ func (r *Reporter) initWorkspaceDir() error {
 
 func (r *Reporter) mainLoop(quitCh <-chan struct{}) {
 	defer r.finishService.Close()
-
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		r.publishProcessExits(quitCh)
-	}()
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		r.pruneRows(quitCh)
-	}()
-
-	wg.Wait()
-}
-
-func (r *Reporter) pruneRows(quitCh <-chan struct{}) {
-	subLogger := r.logger.SubLogger(logrus.Fields{
-		"prune_interval": r.pruneInterval,
-		"prune_after":    r.pruneAfter,
-	})
-	timer := time.NewTimer(0)
-	for {
-		select {
-		case <-quitCh:
-			return
-		case <-timer.C:
-			err := r.finishService.PruneRowsBefore(time.Now().Add(-r.pruneAfter))
-			if err != nil {
-				subLogger.WithError(err).Errorln("Could not prune finish rows")
-			}
-			timer.Reset(r.pruneInterval)
-		}
-	}
+	r.Loop(quitCh)
 }
 
-func (r *Reporter) publishProcessExits(quitCh <-chan struct{}) {
-	timer := time.NewTimer(0)
-	for {
-		select {
-		case <-quitCh:
-			return
-		case <-timer.C:
-			r.reportLatestExits()
-			timer.Reset(r.pollInterval)
-		}
+func (r *Reporter) pruneRows() {
+	err := r.finishService.PruneRowsBefore(time.Now().Add(-r.pruneAfter))
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"prune_interval": r.pruneInterval,
+			"prune_after":    r.pruneAfter,
+		}).WithError(err).Errorln("Could not prune finish rows")
 	}
 }
 
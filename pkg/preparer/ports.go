@@ -0,0 +1,152 @@
+package preparer
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultAutoPortRange is the range that auto ports are allocated from if
+// auto_port_range isn't configured. It ends below Linux's default ephemeral
+// port range.
+var DefaultAutoPortRange = PortRange{Min: 31000, Max: 32767}
+
+// PortRange is an inclusive range of ports
+type PortRange struct {
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+}
+
+type portStore interface {
+	ListRealityMetadata(nodeName types.NodeName) ([]consul.RealityMetadataResult, error)
+}
+
+// portAllocator allocates ports to the launchables on the node that request
+// an auto port. A pod keeps the ports it was allocated across deploys, which
+// are recorded in its reality metadata. The ports of uuid pods are only known
+// to the preparer that allocated them, but are still avoided after a restart
+// because they are in use.
+type portAllocator struct {
+	node      types.NodeName
+	portRange PortRange
+	// Replaced in tests
+	portFree func(port int) bool
+
+	mu sync.Mutex
+	// The ports allocated since the preparer started, which may not be in
+	// the reality tree yet
+	allocated map[podWorkerID]map[launch.LaunchableID]int
+}
+
+func newPortAllocator(node types.NodeName, portRange PortRange) *portAllocator {
+	if portRange.Min == 0 && portRange.Max == 0 {
+		portRange = DefaultAutoPortRange
+	}
+	return &portAllocator{
+		node:      node,
+		portRange: portRange,
+		portFree:  portFree,
+		allocated: make(map[podWorkerID]map[launch.LaunchableID]int),
+	}
+}
+
+// allocate returns the ports of the launchables of pair's intent that request
+// an auto port, allocating ports that aren't used by any other pod on the
+// node, according to store and earlier allocations, to those that don't have
+// one yet.
+func (a *portAllocator) allocate(store portStore, pair ManifestPair) (map[launch.LaunchableID]int, error) {
+	workerID := podWorkerID{podID: pair.ID, podUniqueKey: pair.PodUniqueKey}
+	var requested []string
+	for launchableID, stanza := range pair.Intent.GetLaunchableStanzas() {
+		if stanza.Port == launch.AutoPort {
+			requested = append(requested, launchableID.String())
+		}
+	}
+	// allocate in a stable order, so that retries get the same ports
+	sort.Strings(requested)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ports := make(map[launch.LaunchableID]int)
+	if len(requested) == 0 {
+		delete(a.allocated, workerID)
+		return ports, nil
+	}
+
+	metadata, err := store.ListRealityMetadata(a.node)
+	if err != nil {
+		return nil, util.Errorf("Could not read the ports allocated on %s: %s", a.node, err)
+	}
+	used := make(map[int]bool)
+	previous := a.allocated[workerID]
+	for _, result := range metadata {
+		if result.PodID == pair.ID && pair.PodUniqueKey == "" {
+			if previous == nil {
+				previous = result.Metadata.Ports
+			}
+			continue
+		}
+		for _, port := range result.Metadata.Ports {
+			used[port] = true
+		}
+	}
+	for otherID, otherPorts := range a.allocated {
+		if otherID == workerID {
+			continue
+		}
+		for _, port := range otherPorts {
+			used[port] = true
+		}
+	}
+
+	for _, name := range requested {
+		launchableID := launch.LaunchableID(name)
+		// the pod's own services may be listening on its previous ports,
+		// so they are kept without checking that they are free
+		if port, ok := previous[launchableID]; ok && !used[port] {
+			ports[launchableID] = port
+			used[port] = true
+			continue
+		}
+		port, err := a.freePort(used)
+		if err != nil {
+			return nil, err
+		}
+		ports[launchableID] = port
+		used[port] = true
+	}
+	a.allocated[workerID] = ports
+	return ports, nil
+}
+
+// release forgets the ports allocated to a pod that was removed from the node
+func (a *portAllocator) release(workerID podWorkerID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.allocated, workerID)
+}
+
+func (a *portAllocator) freePort(used map[int]bool) (int, error) {
+	for port := a.portRange.Min; port <= a.portRange.Max; port++ {
+		if !used[port] && a.portFree(port) {
+			return port, nil
+		}
+	}
+	return 0, util.Errorf("No free ports left in %d-%d", a.portRange.Min, a.portRange.Max)
+}
+
+// portFree returns whether nothing on the node is listening on port
+func portFree(port int) bool {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	_ = listener.Close()
+	return true
+}
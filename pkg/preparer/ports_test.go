@@ -0,0 +1,53 @@
+package preparer
+
+import (
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+)
+
+func autoPortManifest(t *testing.T, launchableIDs ...launch.LaunchableID) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID("app")
+	stanzas := make(map[launch.LaunchableID]launch.LaunchableStanza)
+	for _, launchableID := range launchableIDs {
+		stanzas[launchableID] = launch.LaunchableStanza{
+			LaunchableType: "hoist",
+			Location:       "https://localhost/" + launchableID.String() + "_abc.tar.gz",
+			Port:           launch.AutoPort,
+		}
+	}
+	builder.SetLaunchables(stanzas)
+	return builder.GetManifest()
+}
+
+func TestPortAllocatorKeepsPortsAndAvoidsOtherPods(t *testing.T) {
+	allocator := newPortAllocator("node1", PortRange{Min: 5000, Max: 5003})
+	allocator.portFree = func(port int) bool { return port != 5001 }
+	store := &FakeStore{
+		allRealityMetadata: []consul.RealityMetadataResult{
+			{PodID: "other", Metadata: consul.RealityMetadata{Ports: map[launch.LaunchableID]int{"web": 5000}}},
+			{PodID: "app", Metadata: consul.RealityMetadata{Ports: map[launch.LaunchableID]int{"web": 5003}}},
+		},
+	}
+
+	podManifest := autoPortManifest(t, "web", "admin")
+	pair := ManifestPair{ID: podManifest.ID(), Intent: podManifest}
+	ports, err := allocator.allocate(store, pair)
+	Assert(t).IsNil(err, "should have allocated ports")
+	Assert(t).AreEqual(ports["web"], 5003, "should have kept the port from the previous deploy")
+	Assert(t).AreEqual(ports["admin"], 5002, "should have skipped ports that are used or not free")
+
+	uuidManifest := autoPortManifest(t, "worker")
+	_, err = allocator.allocate(store, ManifestPair{ID: uuidManifest.ID(), Intent: uuidManifest, PodUniqueKey: "abc"})
+	Assert(t).IsNotNil(err, "should have run out of ports")
+
+	allocator.release(podWorkerID{podID: "app"})
+	store.allRealityMetadata = store.allRealityMetadata[:1]
+	ports, err = allocator.allocate(store, ManifestPair{ID: uuidManifest.ID(), Intent: uuidManifest, PodUniqueKey: "abc"})
+	Assert(t).IsNil(err, "should have allocated a released port")
+	Assert(t).AreEqual(ports["worker"], 5002, "should have allocated the first free port")
+}
@@ -0,0 +1,164 @@
+package preparer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+)
+
+const (
+	// Names of the timers that propagation latencies are recorded in. Each
+	// is measured from the time the intent was written, so the timers of
+	// every preparer in a datacenter can be aggregated directly.
+	PropagationObservedMetric = "propagation_observed_latency"
+	PropagationLaunchedMetric = "propagation_launched_latency"
+	PropagationHealthyMetric  = "propagation_healthy_latency"
+
+	// The number of completed traces kept for the status server
+	maxRecentPropagationTraces = 100
+)
+
+// PropagationTrace records when a single deploy (a new intent manifest for a
+// pod) reached each stage on this node: the intent being written to consul,
+// the preparer observing it, the launch completing and the pod's health check
+// first passing after the launch. Healthy is zero for uuid pods, which the
+// preparer does not health check.
+//
+// IntentWritten comes from the clock of whatever wrote the intent, so
+// latencies include any clock skew between that host and this node.
+type PropagationTrace struct {
+	PodID         types.PodID        `json:"pod_id"`
+	PodUniqueKey  types.PodUniqueKey `json:"pod_unique_key,omitempty"`
+	SHA           string             `json:"sha"`
+	IntentWritten time.Time          `json:"intent_written"`
+	Observed      time.Time          `json:"observed"`
+	Launched      time.Time          `json:"launched"`
+	Healthy       time.Time          `json:"healthy"`
+}
+
+func (t PropagationTrace) ObservedLatency() time.Duration {
+	return sinceIntent(t.IntentWritten, t.Observed)
+}
+
+func (t PropagationTrace) LaunchedLatency() time.Duration {
+	return sinceIntent(t.IntentWritten, t.Launched)
+}
+
+func (t PropagationTrace) HealthyLatency() time.Duration {
+	return sinceIntent(t.IntentWritten, t.Healthy)
+}
+
+// Clock skew can put a stage before the intent write, which is reported as
+// zero rather than as a negative latency
+func sinceIntent(written time.Time, stage time.Time) time.Duration {
+	if stage.IsZero() || stage.Before(written) {
+		return 0
+	}
+	return stage.Sub(written)
+}
+
+// PropagationTracker follows deploys through the preparer and records their
+// propagation latency. Every completed trace is logged and its latencies are
+// added to timers in the metrics registry, and the most recent traces are
+// kept for the status server.
+type PropagationTracker struct {
+	registry metrics.Registry
+	logger   logging.Logger
+
+	mu sync.Mutex
+	// Legacy pods that have launched and are waiting for a passing health
+	// check, by pod ID
+	awaitingHealth map[types.PodID]PropagationTrace
+	recent         []PropagationTrace
+}
+
+func NewPropagationTracker(registry metrics.Registry, logger logging.Logger) *PropagationTracker {
+	return &PropagationTracker{
+		registry:       registry,
+		logger:         logger,
+		awaitingHealth: make(map[types.PodID]PropagationTrace),
+	}
+}
+
+// Launched records that the intent in pair finished launching at launched.
+// Pairs without an intent write time (because whatever wrote the intent did
+// not record one) are ignored.
+func (t *PropagationTracker) Launched(pair ManifestPair, launched time.Time) {
+	if pair.Intent == nil || pair.IntentWriteTime.IsZero() {
+		return
+	}
+
+	sha, _ := pair.writtenIntent().SHA()
+	trace := PropagationTrace{
+		PodID:         pair.ID,
+		PodUniqueKey:  pair.PodUniqueKey,
+		SHA:           sha,
+		IntentWritten: pair.IntentWriteTime,
+		Observed:      pair.Observed,
+		Launched:      launched,
+	}
+
+	if pair.PodUniqueKey != "" {
+		t.complete(trace)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.awaitingHealth[pair.ID] = trace
+}
+
+// Healthy records that the health check of the legacy pod podID passed at
+// healthy. It is cheap to call on every passing check; only the first pass
+// after a launch completes the trace.
+func (t *PropagationTracker) Healthy(podID types.PodID, healthy time.Time) {
+	t.mu.Lock()
+	trace, ok := t.awaitingHealth[podID]
+	if !ok || healthy.Before(trace.Launched) {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.awaitingHealth, podID)
+	t.mu.Unlock()
+
+	trace.Healthy = healthy
+	t.complete(trace)
+}
+
+// Recent returns the most recently completed traces, oldest first
+func (t *PropagationTracker) Recent() []PropagationTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	recent := make([]PropagationTrace, len(t.recent))
+	copy(recent, t.recent)
+	return recent
+}
+
+func (t *PropagationTracker) complete(trace PropagationTrace) {
+	metrics.GetOrRegisterTimer(PropagationObservedMetric, t.registry).Update(trace.ObservedLatency())
+	metrics.GetOrRegisterTimer(PropagationLaunchedMetric, t.registry).Update(trace.LaunchedLatency())
+	fields := logrus.Fields{
+		"pod":              trace.PodID,
+		"pod_unique_key":   trace.PodUniqueKey,
+		"sha":              trace.SHA,
+		"observed_latency": trace.ObservedLatency().String(),
+		"launched_latency": trace.LaunchedLatency().String(),
+	}
+	if !trace.Healthy.IsZero() {
+		metrics.GetOrRegisterTimer(PropagationHealthyMetric, t.registry).Update(trace.HealthyLatency())
+		fields["healthy_latency"] = trace.HealthyLatency().String()
+	}
+	t.logger.WithFields(fields).Infoln("Deploy propagated")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recent = append(t.recent, trace)
+	if len(t.recent) > maxRecentPropagationTraces {
+		t.recent = t.recent[len(t.recent)-maxRecentPropagationTraces:]
+	}
+}
@@ -0,0 +1,90 @@
+package preparer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+func testPropagationPair(podUniqueKey types.PodUniqueKey, written time.Time) ManifestPair {
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	return ManifestPair{
+		ID:              "foo",
+		Intent:          builder.GetManifest(),
+		PodUniqueKey:    podUniqueKey,
+		IntentWriteTime: written,
+		Observed:        written.Add(time.Second),
+	}
+}
+
+func TestPropagationTracksLegacyPodUntilHealthy(t *testing.T) {
+	registry := metrics.NewRegistry()
+	tracker := NewPropagationTracker(registry, logging.DefaultLogger)
+
+	written := time.Now().Add(-time.Minute)
+	tracker.Launched(testPropagationPair("", written), written.Add(10*time.Second))
+	if len(tracker.Recent()) != 0 {
+		t.Fatalf("legacy pod trace should not complete until the pod is healthy")
+	}
+
+	// A check that passed before the launch finished doesn't count
+	tracker.Healthy("foo", written.Add(5*time.Second))
+	if len(tracker.Recent()) != 0 {
+		t.Fatalf("health pass from before the launch should be ignored")
+	}
+
+	tracker.Healthy("foo", written.Add(30*time.Second))
+	tracker.Healthy("foo", written.Add(40*time.Second))
+	recent := tracker.Recent()
+	if len(recent) != 1 {
+		t.Fatalf("expected one completed trace, got %d", len(recent))
+	}
+	if recent[0].ObservedLatency() != time.Second {
+		t.Errorf("expected observed latency of 1s, got %s", recent[0].ObservedLatency())
+	}
+	if recent[0].LaunchedLatency() != 10*time.Second {
+		t.Errorf("expected launched latency of 10s, got %s", recent[0].LaunchedLatency())
+	}
+	if recent[0].HealthyLatency() != 30*time.Second {
+		t.Errorf("expected healthy latency of 30s, got %s", recent[0].HealthyLatency())
+	}
+
+	for _, name := range []string{PropagationObservedMetric, PropagationLaunchedMetric, PropagationHealthyMetric} {
+		timer, ok := registry.Get(name).(metrics.Timer)
+		if !ok || timer.Count() != 1 {
+			t.Errorf("expected a single %s sample", name)
+		}
+	}
+}
+
+func TestPropagationCompletesUUIDPodAtLaunch(t *testing.T) {
+	registry := metrics.NewRegistry()
+	tracker := NewPropagationTracker(registry, logging.DefaultLogger)
+
+	written := time.Now()
+	tracker.Launched(testPropagationPair(types.NewPodUUID(), written), written.Add(-time.Second))
+	recent := tracker.Recent()
+	if len(recent) != 1 {
+		t.Fatalf("expected uuid pod trace to complete at launch, got %d traces", len(recent))
+	}
+	if recent[0].LaunchedLatency() != 0 {
+		t.Errorf("expected clock skew to be reported as zero latency, got %s", recent[0].LaunchedLatency())
+	}
+	if registry.Get(PropagationHealthyMetric) != nil {
+		t.Errorf("uuid pods should not record a healthy latency")
+	}
+}
+
+func TestPropagationIgnoresIntentsWithoutWriteTime(t *testing.T) {
+	tracker := NewPropagationTracker(metrics.NewRegistry(), logging.DefaultLogger)
+	tracker.Launched(testPropagationPair(types.NewPodUUID(), time.Time{}), time.Now())
+	if len(tracker.Recent()) != 0 {
+		t.Errorf("intents without a write time should not be traced")
+	}
+}
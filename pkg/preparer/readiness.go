@@ -0,0 +1,133 @@
+package preparer
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// ReadinessTimeoutSec is how long a launched pod has to become ready before
+// its deploy is considered failed and retried.
+var ReadinessTimeoutSec = param.Int("readiness_timeout_sec", 300)
+
+const (
+	// readinessInterval is the time between readiness checks of a launched pod
+	readinessInterval = 1 * time.Second
+	// readinessCheckTimeout is the connection timeout of status checks
+	readinessCheckTimeout = 5 * time.Second
+)
+
+// readinessChecker checks whether a launched pod is ready to serve: by running
+// its readiness command if it has one, otherwise by requesting its status URL
+// if it has a status port and either a readiness stanza or the readiness gate
+// is enabled.
+type readinessChecker struct {
+	node types.NodeName
+
+	// Whether to wait for pods without a readiness command to pass their
+	// status check
+	statusGate bool
+
+	// Used for status checks of pods that are only reachable on localhost,
+	// which don't have a certificate for the node's name
+	localClient *http.Client
+	client      *http.Client
+}
+
+func (c *PreparerConfig) readinessChecker() (readinessChecker, error) {
+	checker := readinessChecker{
+		node:       c.NodeName,
+		statusGate: c.ReadinessGate,
+	}
+	var err error
+	checker.client, err = c.GetClient(readinessCheckTimeout)
+	if err != nil {
+		return readinessChecker{}, util.Errorf("Could not create client for readiness checks: %s", err)
+	}
+	checker.localClient, err = c.GetInsecureClient(readinessCheckTimeout)
+	if err != nil {
+		return readinessChecker{}, util.Errorf("Could not create client for readiness checks: %s", err)
+	}
+	return checker, nil
+}
+
+// waitUntilReady blocks until the pod is ready, returning an error if it isn't
+// within the manifest's readiness timeout or ReadinessTimeoutSec. It returns immediately for pods that have
+// nothing to wait for.
+func (p *Preparer) waitUntilReady(pod Pod, podManifest manifest.Manifest, ports map[launch.LaunchableID]int, logger logging.Logger) error {
+	check := p.readiness.checkFor(pod, podManifest, ports)
+	if check == nil {
+		return nil
+	}
+
+	logger.NoFields().Infoln("Waiting for pod to become ready")
+	timeout := time.Duration(*ReadinessTimeoutSec) * time.Second
+	if readiness := podManifest.GetReadiness(); readiness != nil && readiness.Timeout > 0 {
+		timeout = readiness.Timeout
+	}
+	deadline := time.After(timeout)
+	for {
+		err := check()
+		if err == nil {
+			logger.NoFields().Infoln("Pod is ready")
+			return nil
+		}
+		logger.WithError(err).Debugln("Pod is not ready yet")
+
+		select {
+		case <-deadline:
+			return util.Errorf("pod was not ready after %s: %s", timeout, err)
+		case <-time.After(readinessInterval):
+		}
+	}
+}
+
+// checkFor returns the readiness check of a pod whose launchables were
+// allocated ports, or nil if there is nothing to wait for.
+func (r readinessChecker) checkFor(pod Pod, podManifest manifest.Manifest, ports map[launch.LaunchableID]int) func() error {
+	readiness := podManifest.GetReadiness()
+	if readiness != nil && len(readiness.Command) > 0 {
+		return func() error {
+			out, err := pod.CheckReadiness(podManifest)
+			if err != nil {
+				return util.Errorf("readiness command failed: %s: %s", err, out)
+			}
+			return nil
+		}
+	}
+
+	statusPort := consul.RealityMetadata{Ports: ports}.StatusPort(podManifest)
+	if (!r.statusGate && readiness == nil) || statusPort == 0 {
+		return nil
+	}
+	client := r.client
+	host := string(r.node)
+	if podManifest.GetStatusLocalhostOnly() {
+		client = r.localClient
+		host = "localhost"
+	}
+	scheme := "https"
+	if podManifest.GetStatusHTTP() {
+		scheme = "http"
+	}
+	uri := fmt.Sprintf("%s://%s:%d%s", scheme, host, statusPort, podManifest.GetStatusPath())
+	return func() error {
+		resp, err := client.Head(uri)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return util.Errorf("status check of %s returned %s", uri, resp.Status)
+		}
+		return nil
+	}
+}
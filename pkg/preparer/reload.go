@@ -0,0 +1,410 @@
+package preparer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/p2/pkg/artifact"
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+)
+
+// The level logrus logs at when none is configured
+const defaultLogLevel = "info"
+
+// The fields of the config, by their YAML names, that take effect when it is
+// reloaded. The rest only take effect when the preparer is restarted.
+var reloadableFields = map[string]bool{
+	"auth":                         true,
+	"artifact_auth":                true,
+	"artifact_verification_policy": true,
+	"hooks_artifact_auth":          true,
+	"artifact_registry_url":        true,
+	"artifact_registry_file":       true,
+	"hooks_manifest":               true,
+	"health_check_interval":        true,
+	"log_level":                    true,
+}
+
+// ConfigReload is what changed when the preparer's config was reloaded
+type ConfigReload struct {
+	// The fields that were changed and applied
+	Applied []string
+	// The fields that were changed but only take effect after a restart
+	RequiresRestart []string
+}
+
+// reloadableState is the part of the preparer that is replaced when its
+// config is reloaded
+type reloadableState struct {
+	authPolicy            auth.Policy
+	artifactVerifier      auth.ArtifactVerifier
+	hooksArtifactVerifier auth.ArtifactVerifier
+	artifactRegistry      artifact.Registry
+	verificationPolicy    verificationPolicy
+	hooksManifest         manifest.Manifest
+	hooksPod              *pods.Pod
+}
+
+func (p *Preparer) reloadable() reloadableState {
+	p.configMu.RLock()
+	defer p.configMu.RUnlock()
+	return reloadableState{
+		authPolicy:            p.authPolicy,
+		artifactVerifier:      p.artifactVerifier,
+		hooksArtifactVerifier: p.hooksArtifactVerifier,
+		artifactRegistry:      p.artifactRegistry,
+		verificationPolicy:    p.verificationPolicy,
+		hooksManifest:         p.hooksManifest,
+		hooksPod:              p.hooksPod,
+	}
+}
+
+// CurrentHealthCheckInterval returns the health_check_interval, which can
+// change while the preparer is running
+func (c *PreparerConfig) CurrentHealthCheckInterval() time.Duration {
+	c.reloadMux.Lock()
+	defer c.reloadMux.Unlock()
+	return c.HealthCheckInterval
+}
+
+// LoadConfigWithKey loads the config at configPath, and if it sets
+// config_key, replaces its fields with those set in the key.
+func LoadConfigWithKey(configPath string) (*PreparerConfig, error) {
+	config, err := LoadConfig(configPath)
+	if err != nil || config.ConfigKey == "" {
+		return config, err
+	}
+	client, err := config.GetConsulClient()
+	if err != nil {
+		return nil, err
+	}
+	value, err := readConfigKey(client, config.ConfigKey)
+	if err != nil {
+		return nil, err
+	}
+	return loadConfigWithValue(configPath, value)
+}
+
+func readConfigKey(client consulutil.ConsulClient, key string) ([]byte, error) {
+	pair, _, err := client.KV().Get(key, nil)
+	if err != nil {
+		return nil, util.Errorf("Could not read config_key %s: %s", key, err)
+	}
+	if pair == nil {
+		return nil, nil
+	}
+	return pair.Value, nil
+}
+
+// loadConfigWithValue loads the config at configPath with the fields set in
+// value, the value of its config_key, replacing those of the file
+func loadConfigWithValue(configPath string, value []byte) (*PreparerConfig, error) {
+	configBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, util.Errorf("reading config file: %s", err)
+	}
+	if len(value) == 0 {
+		return UnmarshalConfig(configBytes)
+	}
+	merged, err := mergeConfig(configBytes, value)
+	if err != nil {
+		return nil, err
+	}
+	config, err := UnmarshalConfig(merged)
+	if err != nil {
+		return nil, err
+	}
+	config.configKeyValue = value
+	return config, nil
+}
+
+// mergeConfig returns config with the fields that overlay sets under preparer
+// replacing its own. Fields are replaced whole rather than merged, so that
+// for example an auth in overlay doesn't inherit the keyring of the file's.
+func mergeConfig(config []byte, overlay []byte) ([]byte, error) {
+	var merged, over map[string]interface{}
+	err := yaml.Unmarshal(config, &merged)
+	if err != nil {
+		return nil, util.Errorf("The config file %s was malformatted - %s", config, err)
+	}
+	err = yaml.Unmarshal(overlay, &over)
+	if err != nil {
+		return nil, util.Errorf("The config in config_key was malformatted - %s", err)
+	}
+	fields, ok := over["preparer"].(map[interface{}]interface{})
+	if !ok {
+		return nil, util.Errorf("The config in config_key sets no preparer fields")
+	}
+
+	if merged == nil {
+		merged = make(map[string]interface{})
+	}
+	preparer, _ := merged["preparer"].(map[interface{}]interface{})
+	if preparer == nil {
+		preparer = make(map[interface{}]interface{})
+	}
+	for name, value := range fields {
+		preparer[name] = value
+	}
+	merged["preparer"] = preparer
+	return yaml.Marshal(merged)
+}
+
+// changedFields returns the fields, by their YAML names, whose value in
+// newConfig differs from this config's
+func (c *PreparerConfig) changedFields(newConfig *PreparerConfig) ConfigReload {
+	c.reloadMux.Lock()
+	defer c.reloadMux.Unlock()
+
+	var reload ConfigReload
+	current, changed := reflect.ValueOf(c).Elem(), reflect.ValueOf(newConfig).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if field.PkgPath != "" || name == "" {
+			continue
+		}
+		if reflect.DeepEqual(current.Field(i).Interface(), changed.Field(i).Interface()) {
+			continue
+		}
+		if reloadableFields[name] {
+			reload.Applied = append(reload.Applied, name)
+		} else {
+			reload.RequiresRestart = append(reload.RequiresRestart, name)
+		}
+	}
+	return reload
+}
+
+// ReloadConfig applies the reloadable fields of newConfig (see
+// reloadableFields) without restarting, and reports which fields changed and
+// which of those only take effect after a restart. The deployer auth policy
+// and artifact verifier are rebuilt whether or not their config changed, so
+// that their keyrings are read again, and the hooks are installed again if
+// hooks_manifest changed. If any reloadable field is invalid, none are
+// applied.
+func (p *Preparer) ReloadConfig(newConfig *PreparerConfig) (ConfigReload, error) {
+	if p.config == nil {
+		return ConfigReload{}, util.Errorf("The preparer was not started from a config")
+	}
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	// The observe-only flag can't be told apart from the field, so it is
+	// assumed to still be set
+	newConfig.ObserveOnly = newConfig.ObserveOnly || p.Observations != nil
+	reload := p.config.changedFields(newConfig)
+
+	level := newConfig.LogLevel
+	if level == "" {
+		level = defaultLogLevel
+	}
+	_, err := logrus.ParseLevel(level)
+	if err != nil {
+		return ConfigReload{}, util.Errorf("Invalid log_level %q: %s", level, err)
+	}
+
+	next, err := p.reloadedState(newConfig, reload)
+	if err != nil {
+		return ConfigReload{}, err
+	}
+
+	p.configMu.Lock()
+	previous := p.authPolicy
+	p.authPolicy = next.authPolicy
+	p.artifactVerifier = next.artifactVerifier
+	p.hooksArtifactVerifier = next.hooksArtifactVerifier
+	p.artifactRegistry = next.artifactRegistry
+	p.verificationPolicy = next.verificationPolicy
+	p.hooksManifest = next.hooksManifest
+	p.hooksPod = next.hooksPod
+	p.configMu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+
+	p.config.reloadMux.Lock()
+	p.config.Auth = newConfig.Auth
+	p.config.ArtifactAuth = newConfig.ArtifactAuth
+	p.config.ArtifactVerificationPolicy = newConfig.ArtifactVerificationPolicy
+	p.config.HooksArtifactAuth = newConfig.HooksArtifactAuth
+	p.config.ArtifactRegistryURL = newConfig.ArtifactRegistryURL
+	p.config.ArtifactRegistryFile = newConfig.ArtifactRegistryFile
+	p.config.HooksManifest = newConfig.HooksManifest
+	p.config.HealthCheckInterval = newConfig.HealthCheckInterval
+	p.config.LogLevel = newConfig.LogLevel
+	p.config.reloadMux.Unlock()
+	_ = p.Logger.SetLevel(level)
+	p.auditRecorder.RecordReload(reload.Applied, p.Logger)
+
+	fields := logrus.Fields{
+		"applied":          reload.Applied,
+		"requires_restart": reload.RequiresRestart,
+		"log_level":        level,
+	}
+	if len(reload.RequiresRestart) > 0 {
+		p.Logger.WithFields(fields).Warnln("Reloaded config, but some of the changed fields only take effect after a restart")
+	} else {
+		p.Logger.WithFields(fields).Infoln("Reloaded config")
+	}
+
+	for _, name := range reload.Applied {
+		if name == "hooks_manifest" {
+			err = p.InstallHooks()
+			if err != nil {
+				return reload, util.Errorf("Reloaded hooks_manifest, but could not install the hooks: %s", err)
+			}
+		}
+	}
+	return reload, nil
+}
+
+// reloadedState builds what newConfig's reloadable fields configure
+func (p *Preparer) reloadedState(newConfig *PreparerConfig, reload ConfigReload) (reloadableState, error) {
+	verificationPolicy, err := getVerificationPolicy(newConfig.ArtifactVerificationPolicy)
+	if err != nil {
+		return reloadableState{}, util.Errorf("error configuring artifact verification policy: %s", err)
+	}
+	artifactVerifier, err := getArtifactVerifier(newConfig, &p.Logger)
+	if err != nil {
+		return reloadableState{}, err
+	}
+	hooksArtifactVerifier, err := getHooksArtifactVerifier(newConfig, &p.Logger)
+	if err != nil {
+		return reloadableState{}, err
+	}
+	if p.artifactCache != nil {
+		artifactVerifier = auth.NewMemoizingVerifier(artifactVerifier)
+		if hooksArtifactVerifier != nil {
+			hooksArtifactVerifier = auth.NewMemoizingVerifier(hooksArtifactVerifier)
+		}
+	}
+	artifactRegistry, err := getArtifactRegistry(newConfig)
+	if err != nil {
+		return reloadableState{}, err
+	}
+
+	current := p.reloadable()
+	hooksManifest, hooksPod := current.hooksManifest, current.hooksPod
+	for _, name := range reload.Applied {
+		if name != "hooks_manifest" {
+			continue
+		}
+		// The rest of the hooks pod's config only changes on restart
+		fetcher, err := p.config.ArtifactDownloads.fetcher()
+		if err != nil {
+			return reloadableState{}, err
+		}
+		hooksManifest, hooksPod, err = p.config.hooksPod(newConfig.HooksManifest, p.artifactCache, p.secrets, p.clusterAnnotator, p.placement, fetcher, p.extraction)
+		if err != nil {
+			return reloadableState{}, err
+		}
+	}
+
+	// Built last so that it is never left open by a later error
+	authPolicy, err := getDeployerAuth(newConfig)
+	if err != nil {
+		return reloadableState{}, err
+	}
+	return reloadableState{
+		authPolicy:            authPolicy,
+		artifactVerifier:      artifactVerifier,
+		hooksArtifactVerifier: hooksArtifactVerifier,
+		artifactRegistry:      artifactRegistry,
+		verificationPolicy:    verificationPolicy,
+		hooksManifest:         hooksManifest,
+		hooksPod:              hooksPod,
+	}, nil
+}
+
+// reloadConfigFile reloads the config at configPath, with the fields set in
+// value (the value of config_key) replacing those of the file
+func (p *Preparer) reloadConfigFile(configPath string, value []byte) (ConfigReload, error) {
+	newConfig, err := loadConfigWithValue(configPath, value)
+	if err != nil {
+		return ConfigReload{}, err
+	}
+	return p.ReloadConfig(newConfig)
+}
+
+// reloadConfig reloads the config at configPath and the current value of its
+// config_key
+func (p *Preparer) reloadConfig(configPath string) (ConfigReload, error) {
+	var value []byte
+	if p.config != nil && p.config.ConfigKey != "" {
+		var err error
+		value, err = readConfigKey(p.client, p.config.ConfigKey)
+		if err != nil {
+			return ConfigReload{}, err
+		}
+	}
+	return p.reloadConfigFile(configPath, value)
+}
+
+// ReloadConfigOnChange reloads the config at configPath (see ReloadConfig)
+// each time the process receives SIGHUP, and if config_key is set, each time
+// the key's value changes, until quit is closed. A config that can't be
+// loaded or applied is logged and the current one is kept.
+func (p *Preparer) ReloadConfigOnChange(configPath string, quit <-chan struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	var keyChanges <-chan *api.KVPair
+	var keyErrors <-chan error
+	var lastValue []byte
+	if p.config != nil && p.config.ConfigKey != "" {
+		pairs := make(chan *api.KVPair)
+		errs := make(chan error)
+		watchQuit := make(chan struct{})
+		defer close(watchQuit)
+		go consulutil.WatchSingle(p.config.ConfigKey, p.client.KV(), pairs, watchQuit, errs)
+		keyChanges, keyErrors = pairs, errs
+		lastValue = p.config.configKeyValue
+	}
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-signals:
+			_, err := p.reloadConfig(configPath)
+			if err != nil {
+				p.Logger.WithError(err).Errorln("Could not reload config on SIGHUP, keeping the current one")
+			}
+		case pair, ok := <-keyChanges:
+			if !ok {
+				keyChanges = nil
+				continue
+			}
+			var value []byte
+			if pair != nil {
+				value = pair.Value
+			}
+			if bytes.Equal(value, lastValue) {
+				continue
+			}
+			lastValue = value
+			_, err := p.reloadConfigFile(configPath, value)
+			if err != nil {
+				p.Logger.WithError(err).Errorln("Could not reload config after config_key changed, keeping the current one")
+			}
+		case err := <-keyErrors:
+			p.Logger.WithErrorAndFields(err, logrus.Fields{"config_key": p.config.ConfigKey}).Errorln("Could not watch config_key")
+		}
+	}
+}
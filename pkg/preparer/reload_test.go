@@ -0,0 +1,153 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+const reloadTestFields = `preparer:
+  node_name: node1
+  pod_root: /data/pods
+  hooks_manifest: no_hooks
+`
+
+const reloadTestConfig = reloadTestFields + `  auth:
+    type: none
+`
+
+// reloadablePreparer returns a preparer started from the config it writes
+// to the returned path
+func reloadablePreparer(t *testing.T, config string) (*Preparer, string, func()) {
+	dir, err := ioutil.TempDir("", "reload")
+	Assert(t).IsNil(err, "test setup: could not create temp dir")
+	configPath := filepath.Join(dir, "config.yaml")
+	writeReloadTestConfig(t, configPath, config)
+	preparerConfig, err := LoadConfig(configPath)
+	Assert(t).IsNil(err, "test setup: could not load config")
+
+	logger := logging.NewLogger(logrus.Fields{})
+	logger.SetLogOut(ioutil.Discard)
+	p := &Preparer{
+		Logger:     logger,
+		config:     preparerConfig,
+		authPolicy: auth.NullPolicy{},
+		client:     consulutil.NewFakeClient(),
+	}
+	return p, configPath, func() { os.RemoveAll(dir) }
+}
+
+func writeReloadTestConfig(t *testing.T, configPath string, config string) {
+	err := ioutil.WriteFile(configPath, []byte(config), 0644)
+	Assert(t).IsNil(err, "test setup: could not write config")
+}
+
+func TestReloadConfig(t *testing.T) {
+	p, configPath, cleanup := reloadablePreparer(t, reloadTestConfig)
+	defer cleanup()
+
+	writeReloadTestConfig(t, configPath, `preparer:
+  node_name: node1
+  pod_root: /other/pods
+  hooks_manifest: no_hooks
+  auth:
+    type: none
+  log_level: debug
+  health_check_interval: 5s
+`)
+	reload, err := p.reloadConfig(configPath)
+	Assert(t).IsNil(err, "should have reloaded the config")
+	Assert(t).AreEqual(strings.Join(reload.Applied, ","), "log_level,health_check_interval", "wrong fields applied")
+	Assert(t).AreEqual(strings.Join(reload.RequiresRestart, ","), "pod_root", "wrong fields reported as requiring a restart")
+	Assert(t).AreEqual(p.Logger.GetLevel(), "debug", "should have set the configured level")
+	Assert(t).AreEqual(p.config.CurrentHealthCheckInterval(), 5*time.Second, "should have set the health check interval")
+	Assert(t).AreEqual(p.config.PodRoot, "/data/pods", "should not have changed a field that requires a restart")
+	Assert(t).IsNotNil(p.reloadable().authPolicy, "should have rebuilt the auth policy")
+
+	writeReloadTestConfig(t, configPath, reloadTestConfig)
+	reload, err = p.reloadConfig(configPath)
+	Assert(t).IsNil(err, "should have reloaded the config")
+	Assert(t).AreEqual(len(reload.RequiresRestart), 0, "should have no fields requiring a restart")
+	Assert(t).AreEqual(p.Logger.GetLevel(), defaultLogLevel, "should have gone back to the default level")
+	Assert(t).AreEqual(p.config.CurrentHealthCheckInterval(), time.Duration(0), "should have gone back to the default interval")
+}
+
+func TestReloadConfigKeepsCurrentConfigWhenInvalid(t *testing.T) {
+	p, configPath, cleanup := reloadablePreparer(t, reloadTestConfig)
+	defer cleanup()
+	previous := p.reloadable().authPolicy
+
+	for _, invalid := range []string{
+		"  auth:\n    type: none\n  log_level: loud\n",
+		"  auth:\n    type: none\n  artifact_verification_policy:\n    default: sometimes\n",
+		"  auth:\n    type: nonsense\n",
+	} {
+		writeReloadTestConfig(t, configPath, reloadTestFields+invalid+"  health_check_interval: 5s\n")
+		_, err := p.reloadConfig(configPath)
+		Assert(t).IsNotNil(err, "should have rejected "+invalid)
+		Assert(t).AreEqual(p.Logger.GetLevel(), defaultLogLevel, "should have kept the current level")
+		Assert(t).AreEqual(p.config.CurrentHealthCheckInterval(), time.Duration(0), "should have applied nothing")
+		Assert(t).AreEqual(p.reloadable().authPolicy, previous, "should have kept the auth policy")
+	}
+}
+
+func TestLoadConfigWithValue(t *testing.T) {
+	_, configPath, cleanup := reloadablePreparer(t, reloadTestFields+"  auth:\n    type: keyring\n    keyring: /etc/keyring\n")
+	defer cleanup()
+
+	config, err := loadConfigWithValue(configPath, []byte("preparer:\n  pod_root: /other/pods\n  auth:\n    type: none\n"))
+	Assert(t).IsNil(err, "should have loaded the config")
+	Assert(t).AreEqual(config.PodRoot, "/other/pods", "the key should have replaced the file's field")
+	Assert(t).AreEqual(config.NodeName.String(), "node1", "should have kept the file's field")
+	_, ok := config.Auth["keyring"]
+	Assert(t).IsFalse(ok, "the key's auth should have replaced the file's rather than being merged with it")
+
+	_, err = loadConfigWithValue(configPath, []byte("pod_root: /other/pods\n"))
+	Assert(t).IsNotNil(err, "should have rejected a value without preparer fields")
+
+	config, err = loadConfigWithValue(configPath, nil)
+	Assert(t).IsNil(err, "should have loaded the file alone")
+	Assert(t).AreEqual(config.PodRoot, "/data/pods", "should have used the file's field")
+}
+
+func TestReloadConfigWhenConfigKeyChanges(t *testing.T) {
+	p, configPath, cleanup := reloadablePreparer(t, reloadTestConfig+"  config_key: p2/preparer_config\n")
+	defer cleanup()
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		p.ReloadConfigOnChange(configPath, quit)
+		close(done)
+	}()
+	defer func() {
+		close(quit)
+		<-done
+	}()
+
+	_, err := p.client.KV().Put(&api.KVPair{
+		Key:   "p2/preparer_config",
+		Value: []byte("preparer:\n  health_check_interval: 5s\n"),
+	}, nil)
+	Assert(t).IsNil(err, "test setup: could not write config_key")
+
+	timeout := time.After(5 * time.Second)
+	for p.config.CurrentHealthCheckInterval() != 5*time.Second {
+		select {
+		case <-timeout:
+			t.Fatal("config was not reloaded after config_key changed")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
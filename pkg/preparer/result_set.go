@@ -1,8 +1,11 @@
 package preparer
 
 import (
+	"time"
+
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/tracing"
 	"github.com/square/p2/pkg/types"
 )
 
@@ -17,6 +20,39 @@ type ManifestPair struct {
 	// reality should be written to the /reality tree. If non-nil, status should be
 	// written to the pod status store
 	PodUniqueKey types.PodUniqueKey
+
+	// When the intent was written (zero if the writer didn't record it) and
+	// when the preparer first observed this intent. Used to trace deploy
+	// propagation latency.
+	IntentWriteTime time.Time
+	Observed        time.Time
+
+	// The trace of the deploy of the intent, once one starts. Nil if
+	// tracing isn't configured.
+	Span *tracing.Span
+
+	// Set when an operator forced the pod to be reinstalled: the pod's
+	// launchables are removed and the intent is deployed as if it were new,
+	// even if reality already matches it
+	Reinstall bool
+
+	// The intent as it was written, when the channels of Intent's
+	// launchables have been resolved to versions for its deploy. Reality
+	// records the intent as written, so that the two match once the deploy
+	// completes. Nil if no channels were resolved.
+	WrittenIntent manifest.Manifest
+
+	// The envelope signed by the writer of the intent, if it was written
+	// with a signing key
+	IntentEnvelope *consul.IntentEnvelope
+}
+
+// writtenIntent returns the pair's intent as it was written
+func (m ManifestPair) writtenIntent() manifest.Manifest {
+	if m.WrittenIntent != nil {
+		return m.WrittenIntent
+	}
+	return m.Intent
 }
 
 // Uniquely represents a pod. There can exist no two intent results or two
@@ -41,9 +77,11 @@ func (p *Preparer) ZipResultSets(intent []consul.ManifestResult, reality []consu
 
 	for _, intentResult := range intent {
 		keyToPair[getUniqueKey(intentResult)] = &ManifestPair{
-			Intent:       intentResult.Manifest,
-			ID:           intentResult.Manifest.ID(),
-			PodUniqueKey: intentResult.PodUniqueKey,
+			Intent:          intentResult.Manifest,
+			ID:              intentResult.Manifest.ID(),
+			PodUniqueKey:    intentResult.PodUniqueKey,
+			IntentWriteTime: intentResult.WriteTime,
+			IntentEnvelope:  intentResult.IntentEnvelope,
 		}
 	}
 
@@ -0,0 +1,59 @@
+package preparer
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/util/param"
+)
+
+// SecretsRefreshSec is how often the secrets of the node's pods are fetched
+// again, so that rotated secrets are rewritten.
+var SecretsRefreshSec = param.Int("secrets_refresh_sec", 300)
+
+// RefreshSecrets rewrites the secrets of every pod under the pod root that
+// changed since they were last written. Pods that specify a config_reload
+// command are sent it when their secrets change, so that they can reread them.
+func (p *Preparer) RefreshSecrets() {
+	for _, installed := range p.installedPods() {
+		pod, manifest, logger := installed.pod, installed.manifest, installed.logger
+		if len(manifest.GetSecrets()) == 0 {
+			continue
+		}
+		changed, err := pod.RefreshSecrets(manifest)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not refresh secrets")
+			continue
+		}
+		if !changed {
+			continue
+		}
+		logger.NoFields().Infoln("Secrets changed")
+		if manifest.GetConfigReload() == "" {
+			continue
+		}
+		ok, err := pod.SignalReload(manifest)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not reload pod after its secrets changed")
+		} else if !ok {
+			logger.NoFields().Warningln("Some services could not be reloaded after their secrets changed")
+		}
+	}
+}
+
+// RunSecretsRefresh refreshes the secrets of the node's pods every
+// SecretsRefreshSec until quit is closed. It does nothing if no secrets source
+// is configured or in observe-only mode.
+func (p *Preparer) RunSecretsRefresh(quit <-chan struct{}) {
+	if p.secrets == nil || p.Observations != nil {
+		<-quit
+		return
+	}
+	for {
+		select {
+		case <-quit:
+			return
+		case <-time.After(time.Duration(*SecretsRefreshSec) * time.Second):
+		}
+		p.RefreshSecrets()
+	}
+}
@@ -0,0 +1,426 @@
+package preparer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/podevents"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+)
+
+// SelfUpdateVerifySec bounds how long a new preparer binary may take to pass
+// its --self-check before the running preparer hands over to it.
+var SelfUpdateVerifySec = param.Int("self_update_verify_sec", 30)
+
+// SelfCheckSec is how long a self-updated preparer has to pass its startup
+// self-check before the previous version is restored.
+var SelfCheckSec = param.Int("self_check_sec", 120)
+
+// SelfCheckFlag makes the preparer check that it can load its config and then
+// exit. The running preparer uses it to verify a new build before handing over
+// to it.
+const SelfCheckFlag = "self-check"
+
+// selfUpdateEnvVar is set to the SHA of the manifest a preparer is updating to
+// when it execs the new version of itself
+const selfUpdateEnvVar = "P2_SELF_UPDATE_SHA"
+
+// selfCheckInterval is how often a failing startup self-check is retried
+const selfCheckInterval = 5 * time.Second
+
+// selfUpdateAttempt is recorded in the preparer's pod home before it execs a
+// new version of itself, so that the new version can restore the old one. A
+// preparer that finds an attempt for the manifest it is asked to update to
+// knows that the attempt failed, and doesn't retry it.
+type selfUpdateAttempt struct {
+	SHA string `json:"sha"`
+	// The previous binary and the environment it ran with
+	Binary string   `json:"binary"`
+	Env    []string `json:"env"`
+	// The artifact digests verified while installing the new version,
+	// recorded in reality once the update completes
+	Digests []string `json:"digests"`
+}
+
+func selfUpdateAttemptPath(podHome string) string {
+	return filepath.Join(podHome, "self_update_attempt.json")
+}
+
+func readSelfUpdateAttempt(podHome string) (selfUpdateAttempt, bool, error) {
+	var attempt selfUpdateAttempt
+	data, err := ioutil.ReadFile(selfUpdateAttemptPath(podHome))
+	if os.IsNotExist(err) {
+		return attempt, false, nil
+	} else if err != nil {
+		return attempt, false, util.Errorf("Could not read self-update attempt: %s", err)
+	}
+	err = json.Unmarshal(data, &attempt)
+	if err != nil {
+		return attempt, false, util.Errorf("Could not parse self-update attempt: %s", err)
+	}
+	return attempt, true, nil
+}
+
+func writeSelfUpdateAttempt(podHome string, attempt selfUpdateAttempt) error {
+	data, err := json.Marshal(attempt)
+	if err != nil {
+		return util.Errorf("Could not marshal self-update attempt: %s", err)
+	}
+	// the environment may hold credentials
+	return ioutil.WriteFile(selfUpdateAttemptPath(podHome), data, 0600)
+}
+
+// updateSelf replaces the running preparer with the version in pair's intent,
+// which has already been installed. The new binary is run with --self-check,
+// then the preparer waits for work on other pods to finish and execs it,
+// handing over its health session. The new version is only made current once
+// it passes its startup self-check and processes its own intent, so if it
+// fails, the old version is exec'd again or restarted by runit.
+//
+// Returns false for handled if the preparer can't be updated in place, in
+// which case it should be halted and launched like any other pod. Otherwise
+// ok is whether the update succeeded, and the call only returns in the
+// preparer that is made current, or if the update fails before the exec.
+func (p *Preparer) updateSelf(pair ManifestPair, pod Pod, ports map[launch.LaunchableID]int, digests []string, logger logging.Logger) (handled bool, ok bool) {
+	running, err := os.Readlink("/proc/self/exe")
+	if err != nil {
+		logger.WithError(err).Warnln("Could not find the running preparer binary, restarting instead of updating in place")
+		return false, false
+	}
+	launchable, binary, err := p.newPreparerBinary(pair, pod, running)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not find the new preparer binary, restarting instead of updating in place")
+		return false, false
+	}
+	sha, err := pair.writtenIntent().SHA()
+	if err != nil {
+		logger.WithError(err).Errorln("Could not compute the manifest SHA")
+		return true, false
+	}
+	attempt, attempted, err := readSelfUpdateAttempt(pod.Home())
+	if err != nil {
+		logger.WithError(err).Errorln("Could not check for a previous self-update")
+		return true, false
+	}
+
+	if p.selfUpdatedTo != "" && p.selfUpdatedTo == sha {
+		// this is the new preparer, which was exec'd by the old one
+		return true, p.completeSelfUpdate(pair, pod, ports, attempt, logger)
+	}
+	if attempted && attempt.SHA == sha {
+		logger.WithField("attempt", selfUpdateAttemptPath(pod.Home())).Errorln("A previous self-update to this manifest failed, not retrying. Remove the attempt to retry it.")
+		return true, true
+	}
+
+	err = pod.Preflight(pair.Intent)
+	if err != nil {
+		logger.WithError(err).Errorln("Preflight failed, not updating")
+		return true, false
+	}
+	env, err := selfUpdateEnv(os.Environ(), pod.EnvDir(), launchable.EnvDir())
+	if err != nil {
+		logger.WithError(err).Errorln("Could not set up the environment of the new preparer")
+		return true, false
+	}
+	err = verifyPreparerBinary(binary, env, time.Duration(*SelfUpdateVerifySec)*time.Second)
+	if err != nil {
+		logger.WithError(err).Errorln("The new preparer failed its self-check, not updating")
+		return true, false
+	}
+
+	err = writeSelfUpdateAttempt(pod.Home(), selfUpdateAttempt{
+		SHA:     sha,
+		Binary:  running,
+		Env:     os.Environ(),
+		Digests: digests,
+	})
+	if err != nil {
+		logger.WithError(err).Errorln("Could not record self-update attempt")
+		return true, false
+	}
+
+	// Wait for work on other pods to finish. The lock is held until the
+	// exec so that no more is started.
+	logger.NoFields().Infoln("Waiting for work on other pods to finish before updating")
+	p.workMu.Lock()
+	defer p.workMu.Unlock()
+
+	env = append(env, selfUpdateEnvVar+"="+sha)
+	env = p.handOverHealthSession(env, logger)
+	p.tryRunHooks(hooks.BeforeLaunch, pod, pair.Intent, pair.Span, logger)
+	logger.WithField("binary", binary).Infoln("Handing over to the new preparer")
+	err = syscall.Exec(binary, append([]string{binary}, os.Args[1:]...), env)
+
+	// Exec only returns if it fails
+	logger.WithError(err).Errorln("Could not exec the new preparer")
+	_ = os.Remove(selfUpdateAttemptPath(pod.Home()))
+	return true, false
+}
+
+// completeSelfUpdate is run by the new preparer once it is asked to update to
+// the version it is: it makes itself current and records the update in reality
+func (p *Preparer) completeSelfUpdate(pair ManifestPair, pod Pod, ports map[launch.LaunchableID]int, attempt selfUpdateAttempt, logger logging.Logger) bool {
+	logger.NoFields().Infoln("Making the running preparer current")
+	err := pod.MakeCurrent(pair.Intent)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not make the running preparer current")
+		return false
+	}
+	err = p.waitUntilReady(pod, pair.Intent, ports, logger)
+	if err != nil {
+		logger.WithError(err).Errorln("Preparer did not become ready")
+		p.PodEvents.Record(pair, pair.Intent, podevents.LaunchFailed, err, logger)
+		return false
+	}
+
+	metadata := p.realityMetadata(pair, false, attempt.Digests, logger)
+	metadata.Ports = ports
+	err = p.store.SetRealityWithMetadata(p.node, pair.writtenIntent(), metadata)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not set pod in reality store")
+		return false
+	}
+	err = os.Remove(selfUpdateAttemptPath(pod.Home()))
+	if err != nil && !os.IsNotExist(err) {
+		logger.WithError(err).Warnln("Could not remove self-update attempt")
+	}
+	if p.Propagation != nil {
+		p.Propagation.Launched(pair, time.Now())
+	}
+	p.PodEvents.Record(pair, pair.Intent, podevents.Launched, nil, logger)
+	p.tryRunHooks(hooks.AfterLaunch, pod, pair.Intent, pair.Span, logger)
+	pod.Prune(p.maxLaunchableDiskUsage, pair.Intent)
+	logger.NoFields().Infoln("Preparer updated itself")
+	return true
+}
+
+// newPreparerBinary returns where the new version of the running binary is
+// installed, and the launchable installing it
+func (p *Preparer) newPreparerBinary(pair ManifestPair, pod Pod, running string) (launch.Launchable, string, error) {
+	oldLaunchables, err := pod.Launchables(pair.Reality)
+	if err != nil {
+		return nil, "", err
+	}
+	newLaunchables, err := pod.Launchables(pair.Intent)
+	if err != nil {
+		return nil, "", err
+	}
+	oldDirs := make(map[launch.LaunchableID]string)
+	for _, launchable := range oldLaunchables {
+		oldDirs[launchable.ID()] = launchable.InstallDir()
+	}
+	newDirs := make(map[launch.LaunchableID]string)
+	for _, launchable := range newLaunchables {
+		newDirs[launchable.ID()] = launchable.InstallDir()
+	}
+
+	id, binary, err := newBinaryPath(running, oldDirs, newDirs)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, launchable := range newLaunchables {
+		if launchable.ID() == id {
+			return launchable, binary, nil
+		}
+	}
+	return nil, "", util.Errorf("launchable %s is not in the new manifest", id)
+}
+
+// newBinaryPath returns the path of the binary running from one of the old
+// launchables' install dirs within the same launchable's new install dir
+func newBinaryPath(running string, oldDirs, newDirs map[launch.LaunchableID]string) (launch.LaunchableID, string, error) {
+	for id, dir := range oldDirs {
+		if !isWithin(running, dir) {
+			continue
+		}
+		newDir, ok := newDirs[id]
+		if !ok {
+			return "", "", util.Errorf("launchable %s is not in the new manifest", id)
+		}
+		rel, err := filepath.Rel(dir, running)
+		if err != nil {
+			return "", "", err
+		}
+		binary := filepath.Join(newDir, rel)
+		_, err = os.Stat(binary)
+		if err != nil {
+			return "", "", util.Errorf("new preparer binary is not installed: %s", err)
+		}
+		return id, binary, nil
+	}
+	return "", "", util.Errorf("%s was not installed by the preparer's launchables", running)
+}
+
+func isWithin(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// selfUpdateEnv returns the environment to run the new preparer with: env with
+// the variables of the pod's and launchable's env dirs, as written by Install,
+// in place of the old ones. As with chpst, the first line of each file is the
+// value, and an empty file unsets the variable.
+func selfUpdateEnv(env []string, envDirs ...string) ([]string, error) {
+	vars := make(map[string]string)
+	var names []string
+	for _, entry := range env {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if _, ok := vars[parts[0]]; !ok {
+			names = append(names, parts[0])
+		}
+		vars[parts[0]] = parts[1]
+	}
+
+	for _, dir := range envDirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, util.Errorf("Could not read env dir %s: %s", dir, err)
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			value, err := readEnvFile(filepath.Join(dir, file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			name := file.Name()
+			if _, ok := vars[name]; !ok {
+				names = append(names, name)
+			}
+			vars[name] = value
+		}
+	}
+
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		if vars[name] == "" {
+			continue
+		}
+		result = append(result, name+"="+vars[name])
+	}
+	return result, nil
+}
+
+func readEnvFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", util.Errorf("Could not read env file %s: %s", path, err)
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && line == "" {
+		// empty file
+		return "", nil
+	}
+	return strings.TrimRight(line, " \t\n"), nil
+}
+
+// verifyPreparerBinary runs the binary with --self-check
+func verifyPreparerBinary(binary string, env []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binary, "--"+SelfCheckFlag)
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return util.Errorf("%s --%s failed: %s: %s", binary, SelfCheckFlag, err, out)
+	}
+	return nil
+}
+
+// handOverHealthSession adds the preparer's health session to env, so that
+// the health results it holds aren't deleted while the next preparer starts
+func (p *Preparer) handOverHealthSession(env []string, logger logging.Logger) []string {
+	session, err := consul.FindHealthSession(p.client, p.node)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not find the health session, health results will be rewritten by the new preparer")
+		return env
+	}
+	if session == "" {
+		return env
+	}
+	return append(env, consul.HealthSessionEnvVar+"="+session)
+}
+
+// SelfCheck is run at startup. If the preparer was exec'd by a self-update,
+// it checks that it can read its intent, which must include the preparer,
+// within SelfCheckSec. If the check doesn't pass, the previous preparer is
+// exec'd again and will not retry the update. Otherwise the preparer makes
+// itself current once it processes its own intent.
+func (p *Preparer) SelfCheck() {
+	sha := os.Getenv(selfUpdateEnvVar)
+	if sha == "" {
+		return
+	}
+	_ = os.Unsetenv(selfUpdateEnvVar)
+	logger := p.Logger.SubLogger(logrus.Fields{
+		"pod": constants.PreparerPodID,
+		"sha": sha,
+	})
+
+	window := time.Duration(*SelfCheckSec) * time.Second
+	err := p.selfCheck(window, selfCheckInterval)
+	if err == nil {
+		logger.NoFields().Infoln("Self-updated preparer passed its self-check")
+		p.selfUpdatedTo = sha
+		return
+	}
+	logger.WithError(err).Errorln("Self-updated preparer failed its self-check, rolling back")
+
+	podHome := p.podFactory.NewLegacyPod(constants.PreparerPodID).Home()
+	attempt, attempted, err := readSelfUpdateAttempt(podHome)
+	if err != nil || !attempted {
+		// runit restarts the current preparer, which is still the old one
+		logger.WithError(err).Fatalln("Could not find the previous preparer")
+	}
+	env := p.handOverHealthSession(attempt.Env, logger)
+	err = syscall.Exec(attempt.Binary, append([]string{attempt.Binary}, os.Args[1:]...), env)
+	logger.WithError(err).Fatalln("Could not exec the previous preparer")
+}
+
+func (p *Preparer) selfCheck(window time.Duration, interval time.Duration) error {
+	deadline := time.After(window)
+	for {
+		err := p.checkIntent()
+		if err == nil {
+			return nil
+		}
+		p.Logger.WithError(err).Warnln("Self-check failed, retrying")
+		select {
+		case <-deadline:
+			return util.Errorf("self-check did not pass within %s: %s", window, err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (p *Preparer) checkIntent() error {
+	intent, _, err := p.store.ListPods(consul.INTENT_TREE, p.node)
+	if err != nil {
+		return err
+	}
+	if !checkResultsForID(intent, constants.PreparerPodID) {
+		return util.Errorf("intent for %s does not include %s", p.node, constants.PreparerPodID)
+	}
+	return nil
+}
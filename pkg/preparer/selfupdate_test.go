@@ -0,0 +1,123 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+)
+
+func TestNewBinaryPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "self_update")
+	Assert(t).IsNil(err, "test setup: could not create temp dir")
+	defer os.RemoveAll(root)
+
+	oldDir := filepath.Join(root, "installs", "p2-preparer_old")
+	newDir := filepath.Join(root, "installs", "p2-preparer_new")
+	Assert(t).IsNil(os.MkdirAll(filepath.Join(newDir, "bin"), 0755), "test setup: could not create install dir")
+	Assert(t).IsNil(ioutil.WriteFile(filepath.Join(newDir, "bin", "p2-preparer"), nil, 0755), "test setup: could not write binary")
+
+	oldDirs := map[launch.LaunchableID]string{"p2-preparer": oldDir}
+	newDirs := map[launch.LaunchableID]string{"p2-preparer": newDir}
+	id, binary, err := newBinaryPath(filepath.Join(oldDir, "bin", "p2-preparer"), oldDirs, newDirs)
+	Assert(t).IsNil(err, "should have found the new binary")
+	Assert(t).AreEqual(id, launch.LaunchableID("p2-preparer"), "should have returned the launchable installing the binary")
+	Assert(t).AreEqual(binary, filepath.Join(newDir, "bin", "p2-preparer"), "should have found the binary at the same path in the new install")
+
+	_, _, err = newBinaryPath(filepath.Join(oldDir, "bin", "p2-other"), oldDirs, newDirs)
+	Assert(t).IsNotNil(err, "should have failed if the new version doesn't install the binary")
+
+	_, _, err = newBinaryPath("/usr/bin/p2-preparer", oldDirs, newDirs)
+	Assert(t).IsNotNil(err, "should have failed if the binary wasn't installed by a launchable")
+
+	_, _, err = newBinaryPath(filepath.Join(oldDir, "bin", "p2-preparer"), oldDirs, map[launch.LaunchableID]string{})
+	Assert(t).IsNotNil(err, "should have failed if the launchable was removed")
+}
+
+func TestSelfUpdateEnv(t *testing.T) {
+	envDir, err := ioutil.TempDir("", "env")
+	Assert(t).IsNil(err, "test setup: could not create env dir")
+	defer os.RemoveAll(envDir)
+	Assert(t).IsNil(ioutil.WriteFile(filepath.Join(envDir, "CONFIG_PATH"), []byte("/new/config.yaml\nignored"), 0644), "test setup: could not write env file")
+	Assert(t).IsNil(ioutil.WriteFile(filepath.Join(envDir, "UNSET"), nil, 0644), "test setup: could not write env file")
+	Assert(t).IsNil(ioutil.WriteFile(filepath.Join(envDir, "NEW"), []byte("value "), 0644), "test setup: could not write env file")
+
+	env, err := selfUpdateEnv([]string{"CONFIG_PATH=/old/config.yaml", "UNSET=set", "KEPT=kept"}, envDir)
+	Assert(t).IsNil(err, "should have read the env dir")
+	sort.Strings(env)
+	Assert(t).AreEqual(strings.Join(env, " "), "CONFIG_PATH=/new/config.yaml KEPT=kept NEW=value", "should have overlaid the env dir on the environment")
+}
+
+func TestUpdateSelfRestartsIfItCannotUpdateInPlace(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID(constants.PreparerPodID)
+	oldManifest := builder.GetManifest()
+	builder = manifest.NewBuilder()
+	builder.SetID(constants.PreparerPodID)
+	builder.SetConfig(map[interface{}]interface{}{"new": true})
+	newManifest := builder.GetManifest()
+	newPair := ManifestPair{
+		ID:      constants.PreparerPodID,
+		Intent:  newManifest,
+		Reality: oldManifest,
+	}
+	// the test binary wasn't installed by any of the pod's launchables
+	testPod := &TestPod{
+		launchSuccess: true,
+		haltSuccess:   true,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "The deploy should have succeeded")
+	Assert(t).IsTrue(testPod.halted, "The old version should have been halted")
+	Assert(t).IsTrue(testPod.launched, "The new version should have been launched")
+}
+
+func TestSelfCheck(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("other")
+	store := &FakeStore{currentManifest: builder.GetManifest()}
+	p, _, fakePodRoot := testPreparer(t, store)
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	err := p.selfCheck(10*time.Millisecond, time.Millisecond)
+	Assert(t).IsNotNil(err, "should have failed if the intent doesn't include the preparer")
+
+	builder.SetID(constants.PreparerPodID)
+	store.currentManifest = builder.GetManifest()
+	err = p.selfCheck(10*time.Millisecond, time.Millisecond)
+	Assert(t).IsNil(err, "should have passed once the intent includes the preparer")
+}
+
+func TestSelfUpdateAttempt(t *testing.T) {
+	home, err := ioutil.TempDir("", "preparer_home")
+	Assert(t).IsNil(err, "test setup: could not create pod home")
+	defer os.RemoveAll(home)
+
+	_, attempted, err := readSelfUpdateAttempt(home)
+	Assert(t).IsNil(err, "should not have failed without an attempt")
+	Assert(t).IsFalse(attempted, "should not have found an attempt")
+
+	written := selfUpdateAttempt{SHA: "abc123", Binary: "/old/p2-preparer", Env: []string{"A=b"}}
+	Assert(t).IsNil(writeSelfUpdateAttempt(home, written), "should have recorded the attempt")
+	read, attempted, err := readSelfUpdateAttempt(home)
+	Assert(t).IsNil(err, "should have read the attempt")
+	Assert(t).IsTrue(attempted, "should have found the attempt")
+	Assert(t).AreEqual(read.SHA, written.SHA, "should have read the attempted SHA")
+	Assert(t).AreEqual(read.Binary, written.Binary, "should have read the previous binary")
+}
@@ -19,29 +19,48 @@ import (
 	context "golang.org/x/net/context"
 	"golang.org/x/net/http2"
 	"gopkg.in/yaml.v2"
+	klabels "k8s.io/kubernetes/pkg/labels"
 
+	"github.com/square/p2/pkg/admission"
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/auth/kms"
+	"github.com/square/p2/pkg/cloudlabels"
 	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/freeze"
+	"github.com/square/p2/pkg/gzip"
 	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/logship"
 	"github.com/square/p2/pkg/manifest"
+	p2metrics "github.com/square/p2/pkg/metrics"
 	"github.com/square/p2/pkg/osversion"
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/preparer/podprocess"
 	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/secrets"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/freezestore"
+	"github.com/square/p2/pkg/store/consul/pcstore"
+	"github.com/square/p2/pkg/store/consul/podeventstore"
 	"github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/store/etcd"
+	"github.com/square/p2/pkg/systemd"
+	"github.com/square/p2/pkg/tracing"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
 	netutil "github.com/square/p2/pkg/util/net"
 	"github.com/square/p2/pkg/util/param"
+	"github.com/square/p2/pkg/util/redact"
 	"github.com/square/p2/pkg/util/size"
+	"github.com/square/p2/pkg/winsvc"
 )
 
 // DefaultConsulAddress is the default location for Consul when none is configured.
@@ -52,6 +71,22 @@ const (
 	// Can be provided in place of the hook manifest in config to instruct
 	// the preparer to start without hooks.
 	NoHooksSentinelValue = "no_hooks"
+
+	// The values of store_backend
+	ConsulBackend = "consul"
+	EtcdBackend   = "etcd"
+
+	// The size of the artifact cache when artifact_cache_max_size isn't set
+	DefaultArtifactCacheMaxSize = 5 * size.Gibibyte
+
+	// The values of service_backend
+	RunitServiceBackend   = "runit"
+	SystemdServiceBackend = "systemd"
+	WindowsServiceBackend = "windows"
+
+	// The values of secrets' source
+	ConsulSecretsSource = "consul"
+	VaultSecretsSource  = "vault"
 )
 
 type AppConfig struct {
@@ -77,18 +112,72 @@ type Preparer struct {
 	hooks                  Hooks
 	Logger                 logging.Logger
 	podFactory             pods.Factory
+	confinement            ConfinementConfig
+	admitter               *admission.Admitter
+	intentWriterPolicy     *auth.IntentWriterPolicy
 	authPolicy             auth.Policy
 	maxLaunchableDiskUsage size.ByteCount
 	finishExec             []string
 	logExec                []string
 	logBridgeBlacklist     []string
 	artifactVerifier       auth.ArtifactVerifier
+	hooksArtifactVerifier  auth.ArtifactVerifier
+	artifactCache          *artifact.Cache
+	extraction             gzip.Options
+	secrets                secrets.Source
+	clusterAnnotator       pods.ClusterAnnotator
+	placement              pods.Placement
+	podRoot                string
 	artifactRegistry       artifact.Registry
+	verificationPolicy     verificationPolicy
+	redaction              *redact.Filter
+	readiness              readinessChecker
+	ports                  *portAllocator
+	logForwarder           *logship.Forwarder
+	gc                     *GCConfig
+	deploySlots            *deploySlots
+	freezes                *deployFreezes
+	tracer                 *tracing.Tracer
+	sidecars               map[string]SidecarConfig
 
 	// Exported so it can be checked for nil (it only runs if configured)
 	// and quit channel conditially created
 	PodProcessReporter *podprocess.Reporter
 
+	// Exported so the status server and health monitor can report to it
+	Propagation *PropagationTracker
+
+	// Set in observe-only mode, in which pods are checked and reported on but
+	// never installed, launched, halted or removed. Exported so the status
+	// server can serve what was observed.
+	Observations *ObservationLog
+
+	// Records the lifecycle events of the node's pods. Nil in observe-only
+	// mode. Exported so the pod event stream can be served from it.
+	PodEvents *PodEventRecorder
+
+	// Records security-relevant events to the audit chain. Nil unless
+	// audit_chain is set.
+	auditRecorder *AuditRecorder
+
+	// Records installs, verifications, hook runs and watch loop lag
+	metrics *preparerMetrics
+
+	// Writes the preparer's heartbeat. Exported so it can be run.
+	Heartbeats *HeartbeatWriter
+
+	// Set if node_label_snapshot is configured. Exported so it can be run
+	// and so the health monitor can attach the labels to health results.
+	NodeLabels *NodeLabelSnapshot
+
+	// Set if cloud_labels is configured. Exported so it can be run.
+	CloudLabels *cloudlabels.Syncer
+
+	// Set if termination_notices is configured. Exported so it can be run
+	// and so the health monitor can report pods on a leaving node as
+	// unhealthy.
+	Termination *TerminationHandler
+
 	// The pod manifest to use for hooks
 	hooksManifest manifest.Manifest
 
@@ -97,6 +186,35 @@ type Preparer struct {
 
 	// The directory that will actually be executed by the HookDir
 	hooksExecDir string
+
+	// Held for reading while a pod other than the preparer is worked on, so
+	// that a self-update can wait for that work to finish before handing
+	// over to the new preparer, and garbage collection doesn't remove
+	// installs a deploy is using
+	workMu sync.RWMutex
+
+	// The SHA of the manifest this preparer was exec'd for by a self-update,
+	// once it passes its startup self-check
+	selfUpdatedTo string
+
+	// The queue the node's pods are worked on from, while they are, so that
+	// the admin service can inspect and add to it
+	queueMu sync.Mutex
+	queue   *podWorkQueue
+
+	// The config the preparer was started with, with the reloadable fields
+	// updated each time it is reloaded. Nil if the preparer wasn't made by
+	// New().
+	config *PreparerConfig
+
+	// Held for writing while a reloaded config replaces authPolicy,
+	// artifactVerifier, hooksArtifactVerifier, artifactRegistry,
+	// verificationPolicy, hooksManifest and hooksPod, and for reading while they are read (see reloadable())
+	configMu sync.RWMutex
+
+	// Held while the config is reloaded, so that one reload is applied at a
+	// time
+	reloadMu sync.Mutex
 }
 
 type store interface {
@@ -121,39 +239,370 @@ type ConsulConfig struct {
 	// values mean longer lived requests and therefore lower QPS and bandwidth
 	// usage when there are infrequent changes to the watched data
 	WatchWaitTime time.Duration `yaml:"watch_wait_time"`
+
+	// RequestsPerSecond and Burst rate limit the preparer's requests to
+	// consul, so that a misbehaving loop can't saturate the cluster. Zero
+	// means no limit.
+	RequestsPerSecond float64 `yaml:"requests_per_second,omitempty"`
+	Burst             int     `yaml:"burst,omitempty"`
+	// CircuitBreakerFailures is how many consecutive failures to reach
+	// consul stop the preparer from sending requests for
+	// CircuitBreakerOpenDuration. Zero disables the circuit breaker.
+	CircuitBreakerFailures     int           `yaml:"circuit_breaker_failures,omitempty"`
+	CircuitBreakerOpenDuration time.Duration `yaml:"circuit_breaker_open_duration,omitempty"`
+	// ServeStaleReads serves the last values read from consul while it is
+	// unavailable, instead of failing the reads
+	ServeStaleReads bool `yaml:"serve_stale_reads,omitempty"`
+	// Datacenter is the consul datacenter whose intent the preparer
+	// follows, if it isn't that of the consul agent
+	Datacenter string `yaml:"datacenter,omitempty"`
+}
+
+func (c ConsulConfig) limits() consulutil.LimitConfig {
+	return consulutil.LimitConfig{
+		RequestsPerSecond: c.RequestsPerSecond,
+		Burst:             c.Burst,
+		FailureThreshold:  c.CircuitBreakerFailures,
+		OpenDuration:      c.CircuitBreakerOpenDuration,
+		ServeStale:        c.ServeStaleReads,
+	}
+}
+
+// DownloadConfig configures how the artifacts of pods are fetched over HTTP.
+// Artifact servers must support range requests for downloads to be resumed
+// or parallelized.
+type DownloadConfig struct {
+	// MaxResumes is how many times an interrupted download is resumed
+	// where it left off before failing, each after ResumeDelay
+	MaxResumes  int           `yaml:"max_resumes,omitempty"`
+	ResumeDelay time.Duration `yaml:"resume_delay,omitempty"`
+
+	// ParallelSegments, if greater than 1, is the number of ranges that
+	// artifacts of at least ParallelThreshold (e.g. "1G") are fetched in
+	// at once
+	ParallelSegments  int    `yaml:"parallel_segments,omitempty"`
+	ParallelThreshold string `yaml:"parallel_threshold,omitempty"`
+}
+
+// fetcher returns the fetcher of pods' artifacts, or uri.DefaultFetcher if
+// none of the download options are configured
+func (c DownloadConfig) fetcher() (uri.Fetcher, error) {
+	if c == (DownloadConfig{}) {
+		return uri.DefaultFetcher, nil
+	}
+
+	var threshold size.ByteCount
+	if c.ParallelThreshold != "" {
+		var err error
+		threshold, err = size.Parse(c.ParallelThreshold)
+		if err != nil {
+			return nil, util.Errorf("Unparseable value for parallel_threshold %v, %v", c.ParallelThreshold, err)
+		}
+	}
+	return uri.ResumableFetcher{
+		Client:           http.DefaultClient,
+		MaxResumes:       c.MaxResumes,
+		ResumeDelay:      c.ResumeDelay,
+		Segments:         c.ParallelSegments,
+		SegmentThreshold: int64(threshold),
+	}, nil
+}
+
+// ExtractionConfig controls how strictly artifacts are checked when they are
+// extracted. See gzip.Options.
+type ExtractionConfig struct {
+	Strict bool `yaml:"strict,omitempty"`
+	// MaxSize (e.g. "20G") is the most that an artifact may extract to.
+	// Defaults to gzip.DefaultMaxSize.
+	MaxSize string `yaml:"max_size,omitempty"`
+}
+
+func (c ExtractionConfig) options() (gzip.Options, error) {
+	opts := gzip.Options{Strict: c.Strict}
+	if c.MaxSize != "" {
+		var err error
+		opts.MaxSize, err = size.Parse(c.MaxSize)
+		if err != nil {
+			return gzip.Options{}, util.Errorf("Unparseable value for max_size %v, %v", c.MaxSize, err)
+		}
+	}
+	return opts, nil
+}
+
+// SecretsConfig configures the source of the secrets that pod manifests
+// reference. With the "consul" source, secrets are read from the secrets
+// subtree of the preparer's store, and are expected to be encrypted to one of
+// the private keys of Keyring if it is set. With the "vault" source, they are
+// read from VaultAddress with the token in VaultTokenPath, using the
+// preparer's TLS config.
+type SecretsConfig struct {
+	Source         string `yaml:"source,omitempty"`
+	KeyringPath    string `yaml:"keyring,omitempty"`
+	VaultAddress   string `yaml:"vault_address,omitempty"`
+	VaultTokenPath string `yaml:"vault_token_path,omitempty"`
+}
+
+// secretsSource returns the configured source of pods' secrets, or nil if
+// none is configured
+func (c *PreparerConfig) secretsSource(client consulutil.ConsulClient) (secrets.Source, error) {
+	switch c.Secrets.Source {
+	case "":
+		return nil, nil
+	case ConsulSecretsSource:
+		source := secrets.ConsulSource{KV: client.KV()}
+		if c.Secrets.KeyringPath != "" {
+			keyring, err := auth.LoadKeyring(c.Secrets.KeyringPath)
+			if err != nil {
+				return nil, util.Errorf("Could not load secrets keyring: %s", err)
+			}
+			source.Keyring = keyring
+		}
+		return source, nil
+	case VaultSecretsSource:
+		if c.Secrets.VaultAddress == "" {
+			return nil, util.Errorf("No vault_address given for the vault secrets source")
+		}
+		token, err := ioutil.ReadFile(c.Secrets.VaultTokenPath)
+		if err != nil {
+			return nil, util.Errorf("reading Vault token: %s", err)
+		}
+		httpClient, err := c.GetClient(30 * time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return secrets.VaultSource{
+			Client:  httpClient,
+			Address: c.Secrets.VaultAddress,
+			Token:   strings.TrimSpace(string(token)),
+		}, nil
+	default:
+		return nil, util.Errorf("Unknown secrets source %q, expected %q or %q", c.Secrets.Source, ConsulSecretsSource, VaultSecretsSource)
+	}
+}
+
+// EtcdConfig configures the etcd cluster that the preparer uses when
+// store_backend is "etcd". The cert_file, key_file and ca_file of the
+// preparer are used for HTTPS endpoints.
+type EtcdConfig struct {
+	// The URLs of the cluster's members, e.g. "https://etcd1.example.com:2379"
+	Endpoints []string `yaml:"endpoints"`
 }
 
 type PreparerConfig struct {
-	NodeName               types.NodeName         `yaml:"node_name"`
-	ConsulAddress          string                 `yaml:"consul_address"`
-	ConsulHttps            bool                   `yaml:"consul_https,omitempty"`
-	ConsulTokenPath        string                 `yaml:"consul_token_path,omitempty"`
-	HTTP2                  bool                   `yaml:"http2,omitempty"`
-	HooksDirectory         string                 `yaml:"hooks_directory"`
-	CAFile                 string                 `yaml:"ca_file,omitempty"`
-	CertFile               string                 `yaml:"cert_file,omitempty"`
-	KeyFile                string                 `yaml:"key_file,omitempty"`
-	PodRoot                string                 `yaml:"pod_root,omitempty"`
-	RequireFile            string                 `yaml:"require_file,omitempty"`
-	StatusPort             int                    `yaml:"status_port"`
-	StatusSocket           string                 `yaml:"status_socket"`
-	Auth                   map[string]interface{} `yaml:"auth,omitempty"`
-	ArtifactAuth           map[string]interface{} `yaml:"artifact_auth,omitempty"`
-	ExtraLogDestinations   []LogDestination       `yaml:"extra_log_destinations,omitempty"`
-	LogLevel               string                 `yaml:"log_level,omitempty"`
-	MaxLaunchableDiskUsage string                 `yaml:"max_launchable_disk_usage"`
-	LogExec                []string               `yaml:"log_exec,omitempty"`
-	LogBridgeBlacklist     []string               `yaml:"log_bridge_blacklist,omitempty"`
-	ArtifactRegistryURL    string                 `yaml:"artifact_registry_url,omitempty"`
-	ConsulConfig           ConsulConfig           `yaml:"consul_config,omitempty"`
+	NodeName        types.NodeName         `yaml:"node_name"`
+	ConsulAddress   string                 `yaml:"consul_address"`
+	ConsulHttps     bool                   `yaml:"consul_https,omitempty"`
+	ConsulTokenPath string                 `yaml:"consul_token_path,omitempty"`
+	HTTP2           bool                   `yaml:"http2,omitempty"`
+	HooksDirectory  string                 `yaml:"hooks_directory"`
+	CAFile          string                 `yaml:"ca_file,omitempty"`
+	CertFile        string                 `yaml:"cert_file,omitempty"`
+	KeyFile         string                 `yaml:"key_file,omitempty"`
+	PodRoot         string                 `yaml:"pod_root,omitempty"`
+	RequireFile     string                 `yaml:"require_file,omitempty"`
+	StatusPort      int                    `yaml:"status_port"`
+	StatusSocket    string                 `yaml:"status_socket"`
+	Auth            map[string]interface{} `yaml:"auth,omitempty"`
+	ArtifactAuth    map[string]interface{} `yaml:"artifact_auth,omitempty"`
+
+	// Controls what happens when an artifact fails verification. See
+	// VerificationPolicyConfig.
+	ArtifactVerificationPolicy VerificationPolicyConfig `yaml:"artifact_verification_policy,omitempty"`
+
+	// HooksArtifactAuth, if set, is how the artifacts of the hooks pod are
+	// verified instead of ArtifactAuth, in the same format, usually with a
+	// keyring of its own. Hooks run with more privileges than most pods, so
+	// its verification is always enforced, whatever
+	// ArtifactVerificationPolicy says, and its type may not be "none".
+	HooksArtifactAuth map[string]interface{} `yaml:"hooks_artifact_auth,omitempty"`
+
+	ExtraLogDestinations   []LogDestination `yaml:"extra_log_destinations,omitempty"`
+	LogLevel               string           `yaml:"log_level,omitempty"`
+	MaxLaunchableDiskUsage string           `yaml:"max_launchable_disk_usage"`
+
+	// LogFormat is "text" (the default) or "json", which writes each log
+	// entry as a JSON object with standardized node, pod, operation and
+	// duration fields. log_level is re-read from the config on SIGHUP.
+	LogFormat string `yaml:"log_format,omitempty"`
+
+	// ArtifactCacheDir, if set, is where artifacts are cached so that the
+	// pods and hooks sharing an artifact download and verify it once. The
+	// cache holds at most ArtifactCacheMaxSize (e.g. "10G", default
+	// DefaultArtifactCacheMaxSize) of artifacts. Artifacts for which the
+	// artifact registry lists patches from a cached version are built from
+	// the patch instead of being downloaded whole.
+	ArtifactCacheDir     string `yaml:"artifact_cache_dir,omitempty"`
+	ArtifactCacheMaxSize string `yaml:"artifact_cache_max_size,omitempty"`
+
+	ArtifactDownloads DownloadConfig `yaml:"artifact_downloads,omitempty"`
+
+	// ArtifactExtraction controls how strictly artifacts are checked when
+	// they are extracted
+	ArtifactExtraction ExtractionConfig `yaml:"artifact_extraction,omitempty"`
+
+	// Secrets configures where the secrets referenced by pod manifests are
+	// fetched from. Pods that reference secrets fail to install if it isn't
+	// configured.
+	Secrets SecretsConfig `yaml:"secrets,omitempty"`
+
+	// ArtifactRegistryFile, an alternative to ArtifactRegistryURL, is the
+	// path of an artifact.StaticRegistryFile listing the versions and
+	// channels of the artifacts that launchables may refer to
+	ArtifactRegistryFile string `yaml:"artifact_registry_file,omitempty"`
+
+	LogExec             []string     `yaml:"log_exec,omitempty"`
+	LogBridgeBlacklist  []string     `yaml:"log_bridge_blacklist,omitempty"`
+	ArtifactRegistryURL string       `yaml:"artifact_registry_url,omitempty"`
+	ConsulConfig        ConsulConfig `yaml:"consul_config,omitempty"`
+
+	// StoreBackend selects what stores the intent, reality, hooks and
+	// health trees and the preparer's sessions: "consul" (the default) or
+	// "etcd", configured by EtcdConfig. The consul_* options other than
+	// consul_config's watch_wait_time are ignored when using etcd.
+	StoreBackend string     `yaml:"store_backend,omitempty"`
+	EtcdConfig   EtcdConfig `yaml:"etcd_config,omitempty"`
+
+	// ServiceBackend selects what runs the services of launchables:
+	// "runit" (the default) or "systemd", which writes a unit for each
+	// service under the systemd_unit_root param and sends their output to
+	// the journal instead of the log_exec, or "windows", which registers a
+	// Windows service for each service (see package winsvc).
+	ServiceBackend string `yaml:"service_backend,omitempty"`
+
+	// Unprivileged runs pods without root, for hosts where the preparer
+	// runs as a regular user. Pods must run as that user, and their homes
+	// and services are kept under UnprivilegedRoot (default ~/.p2), whose
+	// "service" directory must be supervised by a runsvdir run by the same
+	// user. Only the runit service backend is supported.
+	Unprivileged     bool   `yaml:"unprivileged,omitempty"`
+	UnprivilegedRoot string `yaml:"unprivileged_root,omitempty"`
+
+	// Confinement controls whether pods may run without an SELinux context
+	// or AppArmor profile
+	Confinement ConfinementConfig `yaml:"confinement,omitempty"`
+
+	// Admission, if set, refuses manifests that fail the admission checks
+	// it selects, which should be those the schedulers run before writing
+	// intent (see package admission), in case intent is written without
+	// them
+	Admission *admission.Config `yaml:"admission,omitempty"`
+
+	// IntentAuth, if set, refuses pods whose intent wasn't written by a
+	// writer allowed to schedule them on the node, see IntentAuthConfig
+	IntentAuth *IntentAuthConfig `yaml:"intent_auth,omitempty"`
+
+	// Namespace, if set, keeps every key the preparer reads and writes
+	// under p2/<namespace>/ in the store, for clusters shared by several p2
+	// installations. Every other component of the installation must be
+	// given the same namespace.
+	Namespace string `yaml:"namespace,omitempty"`
 
 	// The pod manifest to use for hooks. If no hooks are desired, use the
 	// NoHooksSentinelValue constant to indicate that there aren't any
 	HooksManifest string `yaml:"hooks_manifest,omitempty"`
 
+	// HealthCheckInterval is how often the health of each pod is checked.
+	// Defaults to one second.
+	HealthCheckInterval time.Duration `yaml:"health_check_interval,omitempty"`
+
+	// ConfigKey, if set, is a key in the store holding config in the same
+	// format as this file. The fields it sets under preparer replace those
+	// of the file, both at startup and when it changes while the preparer
+	// is running, so that config can be rolled out without touching every
+	// node's file.
+	ConfigKey string `yaml:"config_key,omitempty"`
+
 	// Configures reporting the exit status of processes started by a pod to Consul
 	PodProcessReporterConfig podprocess.ReporterConfig `yaml:"process_result_reporter_config"`
 
+	// ObserveOnly runs the preparer without changing the node: intents are
+	// still watched, authorized and have their artifacts verified, and the
+	// services of existing pods are checked, but what the preparer would
+	// have done is only logged and reported on the status server. Hooks are
+	// not installed or run and pod processes are not reported. This is for
+	// validating config and policy on a node class before enforcing them.
+	// The --observe-only flag of p2-preparer sets it too.
+	ObserveOnly bool `yaml:"observe_only,omitempty"`
+
+	// PodEventsSocket, if set, is a unix socket on which the lifecycle events
+	// of the node's pods are streamed over gRPC (see the podeventstream
+	// package). The events are recorded under /pod_events in Consul either
+	// way.
+	PodEventsSocket string `yaml:"pod_events_socket,omitempty"`
+
+	// AdminSocket, if set, is a unix socket on which the admin gRPC service
+	// (see the admin package) is served, for operators to list the pods and
+	// pending work of the preparer, reverify and reinstall pods, and change
+	// its log level. If AdminPort is set, the service is also served on that
+	// port, over TLS with the cert_file and key_file, to clients presenting
+	// a certificate signed by the ca_file. AdminClients, if set, limits those
+	// clients to the certificate common names it lists. Since the service
+	// can change the preparer, only the user the preparer runs as can
+	// connect to the socket, unless AdminSocketGroup names a group whose
+	// members may connect as well.
+	AdminSocket      string   `yaml:"admin_socket,omitempty"`
+	AdminSocketGroup string   `yaml:"admin_socket_group,omitempty"`
+	AdminPort        int      `yaml:"admin_port,omitempty"`
+	AdminClients     []string `yaml:"admin_clients,omitempty"`
+
+	// NodeLabelSnapshot lists the node label keys (e.g. availability zone,
+	// rack, hardware class) that are copied into the health results and pod
+	// statuses written by the preparer. Keep it short, since the labels are
+	// stored with every record.
+	NodeLabelSnapshot []string `yaml:"node_label_snapshot,omitempty"`
+
+	// CloudLabels, if set, has the preparer sync the node's availability
+	// zone, instance type and lifecycle from its cloud provider's instance
+	// metadata into its node labels. See package cloudlabels.
+	CloudLabels *cloudlabels.Config `yaml:"cloud_labels,omitempty"`
+
+	// TerminationNotices, if set, has the preparer watch the cloud
+	// provider's termination notice, e.g. for spot or preemptible
+	// instances. On notice, the node is labeled as cordoned and leaving so
+	// that RCs replace its pods elsewhere, and its pods are reported
+	// unhealthy and then drained and halted.
+	TerminationNotices *TerminationConfig `yaml:"termination_notices,omitempty"`
+
+	// AuditChain, if set, records manifest authorizations, artifact
+	// verification failures and policy reloads to the tamper-evident audit
+	// chain in consul, which p2-audit-chain checkpoints and verifies
+	AuditChain bool `yaml:"audit_chain,omitempty"`
+
+	// LogRedaction configures patterns and keys that are redacted from the
+	// output of every pod's launchables and hooks before it is logged or
+	// written to Consul. Pod manifests can add their own with log_redaction.
+	LogRedaction redact.Config `yaml:"log_redaction,omitempty"`
+
+	// ReadinessGate makes the preparer wait for a launched pod with a status
+	// port to pass its status check before recording it in reality, so that
+	// rolling updates don't proceed past nodes whose new pods never became
+	// healthy. Pods with a readiness command in their manifest are always
+	// waited for.
+	ReadinessGate bool `yaml:"readiness_gate,omitempty"`
+
+	// LogShipping, if set, configures a destination that the output of
+	// every pod's services is shipped to, with the node and pod attached.
+	// Pods can opt out or add fields with the log_shipping manifest stanza.
+	LogShipping *logship.Config `yaml:"log_shipping,omitempty"`
+
+	// ArtifactGC, if set, has the preparer periodically remove the old
+	// installs of the node's launchables and unused cached artifacts. See
+	// GCConfig.
+	ArtifactGC *GCConfig `yaml:"artifact_gc,omitempty"`
+
+	// TracingEndpoint, if set, is the URL of an OpenTelemetry collector's
+	// OTLP/HTTP traces endpoint (e.g. http://localhost:4318/v1/traces).
+	// Each deploy of a pod is exported to it as a trace of its steps.
+	TracingEndpoint string `yaml:"tracing_endpoint,omitempty"`
+
+	// Sidecars are the sidecar launchables that pods can opt into with the
+	// sidecar manifest stanza, keyed by name. See SidecarConfig.
+	Sidecars map[string]SidecarConfig `yaml:"sidecars,omitempty"`
+
+	// AutoPortRange is the range of ports that launchables requesting an
+	// auto port are allocated from. Defaults to DefaultAutoPortRange.
+	AutoPortRange PortRange `yaml:"auto_port_range,omitempty"`
+
 	// Params defines a collection of miscellaneous runtime parameters defined throughout the
 	// source files.
 	Params param.Values `yaml:"params"`
@@ -161,9 +610,17 @@ type PreparerConfig struct {
 	// Use a single Store so that all requests go through the same HTTP client.
 	consulClientMux sync.Mutex
 	consulClient    consulutil.ConsulClient
+	watchDispatcher *consulutil.WatchDispatcher
 
 	httpClientMux sync.Mutex
 	httpClient    *http.Client
+
+	// Guards the fields that are changed when the config is reloaded and
+	// read after startup
+	reloadMux sync.Mutex
+
+	// The value of config_key that the config was loaded with
+	configKeyValue []byte
 }
 
 // --- Deployer ACL strategies ---
@@ -173,6 +630,36 @@ type KeyringAuth struct {
 	Type                string
 	KeyringPath         string   `yaml:"keyring,omitempty"`
 	AuthorizedDeployers []string `yaml:"authorized_deployers,omitempty"`
+	// SignerQuorums lists the pods whose manifests must be signed by
+	// several of the keys on the keyring, such as production pods
+	SignerQuorums map[types.PodID]auth.SignerQuorum `yaml:"signer_quorums,omitempty"`
+}
+
+// Configuration fields for the "kms" auth type, which authorizes pods like the
+// "keyring" type, but with the signing keys of a KMS instead of a keyring
+type KMSAuth struct {
+	Type                string
+	KMS                 kms.Config                        `yaml:"kms"`
+	AuthorizedDeployers []string                          `yaml:"authorized_deployers,omitempty"`
+	SignerQuorums       map[types.PodID]auth.SignerQuorum `yaml:"signer_quorums,omitempty"`
+}
+
+// DefaultRuleKey is the consul key of the rule document of the "rules" auth
+// type, if rule_key isn't set
+const DefaultRuleKey = "auth/rules"
+
+// Configuration fields for the "rules" auth type. Manifests signed by a key on
+// the keyring are authorized by the rules of the document in the consul key
+// RuleKey, which must be clearsigned by a key on the rule keyring. See
+// auth.RuleDocument.
+type RulesAuth struct {
+	Type            string
+	KeyringPath     string `yaml:"keyring"`
+	RuleKeyringPath string `yaml:"rule_keyring"`
+	RuleKey         string `yaml:"rule_key,omitempty"`
+	// Environment is the environment of the node, e.g. "production",
+	// which rules can be limited to
+	Environment string `yaml:"environment,omitempty"`
 }
 
 // Configuration fields for the "user" auth type
@@ -182,6 +669,56 @@ type UserAuth struct {
 	DeployPolicyPath string `yaml:"deploy_policy"`
 }
 
+// IntentAuthConfig configures the authorization of the writers of the intent
+// of the node's pods, in addition to that of the manifests' signers. Writers
+// sign the intent they write with the key given to --intent-signing-keyring,
+// and the rules, whose signers are writers, list which pods each of them may
+// schedule on which nodes:
+//
+//	intent_auth:
+//	  keyring: /etc/p2/writers.keyring
+//	  environment: production
+//	  rules:
+//	  - signers: [teamx-scheduler@my.org]
+//	    pods: ["teamx-*"]
+//	    node_selector: team=x
+//
+// Intent written without a signing key, such as that of the pod store, is
+// refused.
+type IntentAuthConfig struct {
+	KeyringPath string `yaml:"keyring"`
+	// Environment is the environment of the node, which rules can be
+	// limited to
+	Environment       string `yaml:"environment,omitempty"`
+	auth.RuleDocument `yaml:",inline"`
+}
+
+func (c IntentAuthConfig) policy(labeler labels.Applicator, node types.NodeName) (auth.IntentWriterPolicy, error) {
+	if c.KeyringPath == "" {
+		return auth.IntentWriterPolicy{}, util.Errorf("intent_auth must contain a path to the keyring of the writers")
+	}
+	keyring, err := auth.LoadKeyring(c.KeyringPath)
+	if err != nil {
+		return auth.IntentWriterPolicy{}, err
+	}
+	err = c.RuleDocument.Validate()
+	if err != nil {
+		return auth.IntentWriterPolicy{}, err
+	}
+	return auth.IntentWriterPolicy{
+		Keyring:     keyring,
+		Rules:       c.RuleDocument,
+		Environment: c.Environment,
+		NodeLabels: func() (klabels.Labels, error) {
+			nodeLabels, err := labeler.GetLabels(labels.NODE, node.String())
+			if err != nil {
+				return nil, err
+			}
+			return nodeLabels.Labels, nil
+		},
+	}, nil
+}
+
 // --- Artifact verification strategies ---
 //
 // The type matches one of the auth.Verify* constants
@@ -196,6 +733,55 @@ type ManifestVerification struct {
 	Type           string
 	KeyringPath    string   `yaml:"keyring,omitempty"`
 	AllowedSigners []string `yaml:"allowed_signers"`
+	// KMS, if set instead of the keyring, is the KMS whose keys sign
+	// artifacts
+	KMS *kms.Config `yaml:"kms,omitempty"`
+}
+
+// VerificationPolicyConfig selects an auth.VerificationFailurePolicy
+// ("enforce", "warn" or "audit") for artifact verification failures. Default
+// applies to every pod on the node, so it is usually set per node class in
+// the preparer config that class is deployed with. Pods overrides the
+// default for individual pod IDs. Unset policies are "enforce".
+type VerificationPolicyConfig struct {
+	Default string                 `yaml:"default,omitempty"`
+	Pods    map[types.PodID]string `yaml:"pods,omitempty"`
+}
+
+type verificationPolicy struct {
+	defaultPolicy auth.VerificationFailurePolicy
+	pods          map[types.PodID]auth.VerificationFailurePolicy
+}
+
+func (v verificationPolicy) forPod(podID types.PodID) auth.VerificationFailurePolicy {
+	if policy, ok := v.pods[podID]; ok {
+		return policy
+	}
+	if v.defaultPolicy == "" {
+		return auth.EnforceVerification
+	}
+	return v.defaultPolicy
+}
+
+func getVerificationPolicy(config VerificationPolicyConfig) (verificationPolicy, error) {
+	defaultPolicy, err := auth.AsVerificationFailurePolicy(config.Default)
+	if err != nil {
+		return verificationPolicy{}, err
+	}
+
+	pods := make(map[types.PodID]auth.VerificationFailurePolicy)
+	for podID, value := range config.Pods {
+		policy, err := auth.AsVerificationFailurePolicy(value)
+		if err != nil {
+			return verificationPolicy{}, util.Errorf("pod %s: %s", podID, err)
+		}
+		pods[podID] = policy
+	}
+
+	return verificationPolicy{
+		defaultPolicy: defaultPolicy,
+		pods:          pods,
+	}, nil
 }
 
 // LoadConfig reads the preparer's configuration from a file.
@@ -215,25 +801,56 @@ func UnmarshalConfig(config []byte) (*PreparerConfig, error) {
 	if err != nil {
 		return nil, util.Errorf("The config file %s was malformatted - %s", config, err)
 	}
+	return preparerConfig.withDefaults()
+}
 
-	if preparerConfig.NodeName == "" {
+// withDefaults fills in the fields of an unmarshalled config that have
+// defaults
+func (c *PreparerConfig) withDefaults() (*PreparerConfig, error) {
+	if c.NodeName == "" {
 		hostname, err := os.Hostname()
 		if err != nil {
 			return nil, util.Errorf("Couldn't determine hostname: %s", err)
 		}
 
-		preparerConfig.NodeName = types.NodeName(hostname)
+		c.NodeName = types.NodeName(hostname)
 	}
-	if preparerConfig.ConsulAddress == "" {
-		preparerConfig.ConsulAddress = DefaultConsulAddress
+	if c.ConsulAddress == "" {
+		c.ConsulAddress = DefaultConsulAddress
 	}
-	if preparerConfig.HooksDirectory == "" {
-		preparerConfig.HooksDirectory = hooks.DefaultPath
+	if c.Unprivileged {
+		root, err := c.unprivilegedRoot()
+		if err != nil {
+			return nil, err
+		}
+		c.UnprivilegedRoot = root
+		if c.HooksDirectory == "" {
+			c.HooksDirectory = filepath.Join(root, "hooks.d")
+		}
+		if c.PodRoot == "" {
+			c.PodRoot = filepath.Join(root, "pods")
+		}
 	}
-	if preparerConfig.PodRoot == "" {
-		preparerConfig.PodRoot = pods.DefaultPath
+	if c.HooksDirectory == "" {
+		c.HooksDirectory = hooks.DefaultPath
+	}
+	if c.PodRoot == "" {
+		c.PodRoot = pods.DefaultPath
+	}
+	return c, nil
+}
+
+// unprivilegedRoot returns the directory that an unprivileged preparer keeps
+// its pods and services under
+func (c *PreparerConfig) unprivilegedRoot() (string, error) {
+	if c.UnprivilegedRoot != "" {
+		return c.UnprivilegedRoot, nil
+	}
+	currUser, err := user.Current()
+	if err != nil {
+		return "", util.Errorf("Could not determine the home directory of the current user: %s", err)
 	}
-	return preparerConfig, nil
+	return filepath.Join(currUser.HomeDir, ".p2"), nil
 }
 
 // loadToken reads the file at the given path and trims its contents for use as a Consul
@@ -249,21 +866,81 @@ func loadToken(path string) (string, error) {
 	return strings.TrimSpace(string(token)), nil
 }
 
+// GetConsulClient returns the client of the configured store backend. For
+// etcd, this is an etcd client with the same interface as consul's.
 func (c *PreparerConfig) GetConsulClient() (consulutil.ConsulClient, error) {
 	c.consulClientMux.Lock()
 	defer c.consulClientMux.Unlock()
 	if c.consulClient != nil {
 		return c.consulClient, nil
 	}
-	opts, err := c.getOpts()
-	if err != nil {
-		return nil, err
+
+	var client consulutil.ConsulClient
+	switch c.StoreBackend {
+	case "", ConsulBackend:
+		opts, err := c.getOpts()
+		if err != nil {
+			return nil, err
+		}
+		client = consul.NewConsulClient(opts)
+	case EtcdBackend:
+		opts, err := c.getEtcdOpts()
+		if err != nil {
+			return nil, err
+		}
+		client, err = etcd.NewClient(opts)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, util.Errorf("Unknown store_backend %q, expected %q or %q", c.StoreBackend, ConsulBackend, EtcdBackend)
 	}
-	client := consul.NewConsulClient(opts)
+	client = consulutil.NewLimitedClient(client, c.ConsulConfig.limits())
+	client = consulutil.NewNamespacedClient(client, c.Namespace)
 	c.consulClient = client
+	c.watchDispatcher = consulutil.NewWatchDispatcher(client.KV())
 	return client, nil
 }
 
+// podFactory returns the factory of the preparer's pods, whose services are
+// run by the configured service backend
+func (c *PreparerConfig) podFactory(fetcher uri.Fetcher) (pods.Factory, error) {
+	if c.Unprivileged {
+		if c.ServiceBackend != "" && c.ServiceBackend != RunitServiceBackend {
+			return nil, util.Errorf("Unprivileged mode only supports the %q service_backend", RunitServiceBackend)
+		}
+		root, err := c.unprivilegedRoot()
+		if err != nil {
+			return nil, err
+		}
+		return pods.NewUnprivilegedFactory(c.PodRoot, c.NodeName, fetcher, c.RequireFile, runit.UserBuilder(root)), nil
+	}
+
+	switch c.ServiceBackend {
+	case "", RunitServiceBackend:
+		return pods.NewFactory(c.PodRoot, c.NodeName, fetcher, c.RequireFile), nil
+	case SystemdServiceBackend:
+		return pods.NewFactoryWithServices(c.PodRoot, c.NodeName, fetcher, c.RequireFile, systemd.NewSV(), systemd.NewServiceBuilder(runit.DefaultBuilder)), nil
+	case WindowsServiceBackend:
+		return pods.NewFactoryWithServices(c.PodRoot, c.NodeName, fetcher, c.RequireFile, winsvc.NewSV(), winsvc.NewServiceBuilder(runit.DefaultBuilder)), nil
+	default:
+		return nil, util.Errorf("Unknown service_backend %q, expected %q, %q or %q", c.ServiceBackend, RunitServiceBackend, SystemdServiceBackend, WindowsServiceBackend)
+	}
+}
+
+// GetWatchDispatcher returns the dispatcher of the watches made with the
+// client returned by GetConsulClient(), so that the components of the
+// preparer that watch the same tree share one blocking query
+func (c *PreparerConfig) GetWatchDispatcher() (*consulutil.WatchDispatcher, error) {
+	_, err := c.GetConsulClient()
+	if err != nil {
+		return nil, err
+	}
+	c.consulClientMux.Lock()
+	defer c.consulClientMux.Unlock()
+	return c.watchDispatcher, nil
+}
+
 func (c *PreparerConfig) getOpts() (consul.Options, error) {
 	client := http.DefaultClient
 	token, err := loadToken(c.ConsulTokenPath)
@@ -284,14 +961,32 @@ func (c *PreparerConfig) getOpts() (consul.Options, error) {
 		waitTime = 5 * time.Minute
 	}
 	return consul.Options{
-		Address:  c.ConsulAddress,
-		HTTPS:    c.ConsulHttps,
-		Token:    token,
-		Client:   client,
-		WaitTime: waitTime,
+		Address:    c.ConsulAddress,
+		HTTPS:      c.ConsulHttps,
+		Token:      token,
+		Client:     client,
+		WaitTime:   waitTime,
+		Datacenter: c.ConsulConfig.Datacenter,
 	}, err
 }
 
+func (c *PreparerConfig) getEtcdOpts() (etcd.Options, error) {
+	client, err := c.GetClient(30 * time.Second)
+	if err != nil {
+		return etcd.Options{}, err
+	}
+
+	waitTime := c.ConsulConfig.WatchWaitTime
+	if waitTime < 5*time.Minute {
+		waitTime = 5 * time.Minute
+	}
+	return etcd.Options{
+		Endpoints: c.EtcdConfig.Endpoints,
+		Client:    client,
+		WaitTime:  waitTime,
+	}, nil
+}
+
 func (c *PreparerConfig) getClient(
 	cxnTimeout time.Duration,
 	insecureSkipVerify bool,
@@ -373,11 +1068,14 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 	}
 
 	if preparerConfig.LogLevel != "" {
-		lv, err := logrus.ParseLevel(preparerConfig.LogLevel)
+		err := logger.SetLevel(preparerConfig.LogLevel)
 		if err != nil {
-			return nil, util.Errorf("Received invalid log level %q", preparerConfig.LogLevel)
+			return nil, err
 		}
-		logger.Logger.Level = lv
+	}
+	err := logger.SetFormat(preparerConfig.LogFormat, preparerConfig.NodeName.String())
+	if err != nil {
+		return nil, err
 	}
 
 	authPolicy, err := getDeployerAuth(preparerConfig)
@@ -390,6 +1088,27 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		return nil, err
 	}
 
+	artifactCache, err := getArtifactCache(preparerConfig)
+	if err != nil {
+		return nil, err
+	}
+	if artifactCache != nil {
+		artifactVerifier = auth.NewMemoizingVerifier(artifactVerifier)
+	}
+
+	hooksArtifactVerifier, err := getHooksArtifactVerifier(preparerConfig, &logger)
+	if err != nil {
+		return nil, err
+	}
+	if artifactCache != nil && hooksArtifactVerifier != nil {
+		hooksArtifactVerifier = auth.NewMemoizingVerifier(hooksArtifactVerifier)
+	}
+
+	verificationPolicy, err := getVerificationPolicy(preparerConfig.ArtifactVerificationPolicy)
+	if err != nil {
+		return nil, util.Errorf("error configuring artifact verification policy: %s", err)
+	}
+
 	artifactRegistry, err := getArtifactRegistry(preparerConfig)
 	if err != nil {
 		return nil, err
@@ -404,7 +1123,22 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 	podStatusStore := podstatus.NewConsul(statusStore, consul.PreparerPodStatusNamespace)
 	podStore := podstore.NewConsul(client.KV())
 
-	store := consul.NewConsulStore(client)
+	watchDispatcher, err := preparerConfig.GetWatchDispatcher()
+	if err != nil {
+		return nil, err
+	}
+	store := consul.NewConsulStoreWithWatcher(client, watchDispatcher)
+
+	secretsSource, err := preparerConfig.secretsSource(client)
+	if err != nil {
+		return nil, err
+	}
+
+	applicator := labels.NewConsulApplicator(client, 0)
+	clusterAnnotator := podClusterAnnotator{
+		labeler: applicator,
+		pcStore: pcstore.NewConsul(client, applicator, labels.DefaultAggregationRate, applicator, &logger),
+	}
 
 	maxLaunchableDiskUsage := launch.DefaultAllowableDiskUsage
 	if preparerConfig.MaxLaunchableDiskUsage != "" {
@@ -414,45 +1148,106 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		}
 	}
 
-	err = os.MkdirAll(preparerConfig.PodRoot, 0755)
-	if err != nil {
-		return nil, util.Errorf("Could not create preparer pod directory: %s", err)
+	var observations *ObservationLog
+	var podEvents *PodEventRecorder
+	if preparerConfig.ObserveOnly {
+		logger.NoFields().Warnln("Running in observe-only mode, no pods will be installed, launched or removed")
+		observations = NewObservationLog()
+	} else {
+		podEvents = NewPodEventRecorder(preparerConfig.NodeName, podeventstore.NewConsul(client))
 	}
 
-	// Artifact files are downloaded to os.TempDir().
-	// Since we extract artifact files as target user, we must allow them to access the tmpdir.
-	// We expect that there is no sensitive information in TempDir, so 755 is safe, though 711 could be considered.
-	tmpDirStat, err := os.Stat(os.TempDir())
-	if err != nil {
-		return nil, util.Errorf("Could not stat tmpdir: %s", err)
+	var auditRecorder *AuditRecorder
+	if preparerConfig.AuditChain {
+		auditRecorder = NewAuditRecorder(preparerConfig.NodeName, auditlogstore.NewChainStore(client.KV()))
 	}
-	mode := tmpDirStat.Mode()
-	// We don't chmod if the directory is already 755.
-	// Normally there is no harm in doing so,
-	// but on Travis we don't have permission to do so (we don't run as root).
 
-	currUser, err := user.Current()
+	var admitter *admission.Admitter
+	if preparerConfig.Admission != nil {
+		configured, err := admission.New(*preparerConfig.Admission)
+		if err != nil {
+			return nil, util.Errorf("Invalid admission: %s", err)
+		}
+		admitter = &configured
+	}
+
+	var intentWriterPolicy *auth.IntentWriterPolicy
+	if preparerConfig.IntentAuth != nil {
+		configured, err := preparerConfig.IntentAuth.policy(applicator, preparerConfig.NodeName)
+		if err != nil {
+			return nil, util.Errorf("Invalid intent_auth: %s", err)
+		}
+		intentWriterPolicy = &configured
+	}
+
+	redaction, err := redact.New(preparerConfig.LogRedaction)
 	if err != nil {
-		return nil, err
+		return nil, util.Errorf("Invalid log_redaction: %s", err)
 	}
-	if mode&0755 != 0755 && currUser.Uid == "0" {
-		// keep whatever upper bit is there.
-		err = os.Chmod(os.TempDir(), (mode&07000)|0755)
+
+	var nodeLabels *NodeLabelSnapshot
+	if len(preparerConfig.NodeLabelSnapshot) > 0 {
+		nodeLabels = NewNodeLabelSnapshot(
+			preparerConfig.NodeName,
+			preparerConfig.NodeLabelSnapshot,
+			applicator,
+			logger,
+		)
+		err = nodeLabels.Refresh()
 		if err != nil {
-			return nil, util.Errorf("Could not chmod tmpdir: %s", err)
+			// not fatal, records are written without labels until a refresh succeeds
+			logger.WithError(err).Warnln("Could not read node label snapshot")
 		}
 	}
 
+	var cloudLabels *cloudlabels.Syncer
+	if preparerConfig.CloudLabels != nil {
+		provider, err := cloudlabels.NewProvider(*preparerConfig.CloudLabels)
+		if err != nil {
+			return nil, err
+		}
+		cloudLabels = cloudlabels.NewSyncer(
+			preparerConfig.NodeName,
+			provider,
+			applicator,
+			preparerConfig.CloudLabels.Interval,
+			logger.SubLogger(logrus.Fields{"component": "cloud_labels"}),
+		)
+	}
+
+	var termination *TerminationHandler
+	if preparerConfig.TerminationNotices != nil {
+		notifier, err := cloudlabels.NewTerminationNotifier(preparerConfig.TerminationNotices.Config)
+		if err != nil {
+			return nil, err
+		}
+		termination = NewTerminationHandler(
+			preparerConfig.NodeName,
+			notifier,
+			applicator,
+			preparerConfig.TerminationNotices.Interval,
+			preparerConfig.TerminationNotices.GracePeriod,
+			logger.SubLogger(logrus.Fields{"component": "termination_notices"}),
+		)
+	}
+
+	err = preparerConfig.prepareDirectories()
+	if err != nil {
+		return nil, err
+	}
+
 	var logExec []string
 	if len(preparerConfig.LogExec) > 0 {
 		logExec = preparerConfig.LogExec
+	} else if preparerConfig.Unprivileged {
+		logExec = runit.UnprivilegedLogExec()
 	} else {
 		logExec = runit.DefaultLogExec()
 	}
 
 	finishExec := pods.NopFinishExec
 	var podProcessReporter *podprocess.Reporter
-	if preparerConfig.PodProcessReporterConfig.FullyConfigured() {
+	if preparerConfig.PodProcessReporterConfig.FullyConfigured() && !preparerConfig.ObserveOnly {
 		podProcessReporterLogger := logger.SubLogger(logrus.Fields{
 			"component": "PodProcessReporter",
 		})
@@ -465,23 +1260,26 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		finishExec = preparerConfig.PodProcessReporterConfig.FinishExec()
 	}
 
-	var hooksManifest manifest.Manifest
-	var hooksPod *pods.Pod
+	fetcher, err := preparerConfig.ArtifactDownloads.fetcher()
+	if err != nil {
+		return nil, err
+	}
+	extraction, err := preparerConfig.ArtifactExtraction.options()
+	if err != nil {
+		return nil, util.Errorf("Invalid artifact_extraction: %s", err)
+	}
+
 	var auditLogger hooks.AuditLogger
 	auditLogger = hooks.NewFileAuditLogger(&logger)
-	if preparerConfig.HooksManifest != NoHooksSentinelValue {
-		if preparerConfig.HooksManifest == "" {
-			return nil, util.Errorf("Most provide a hooks_manifest or sentinel value %q to indicate that there are no hooks", NoHooksSentinelValue)
-		}
-
-		hooksManifest, err = manifest.FromBytes([]byte(preparerConfig.HooksManifest))
-		if err != nil {
-			return nil, util.Errorf("Could not parse configured hooks manifest: %s", err)
-		}
-		hooksPodFactory := pods.NewHookFactory(filepath.Join(preparerConfig.PodRoot, "hooks"), preparerConfig.NodeName)
-		hooksPod = hooksPodFactory.NewHookPod(hooksManifest.ID())
+	hooksManifest, hooksPod, err := preparerConfig.hooksPod(preparerConfig.HooksManifest, artifactCache, secretsSource, clusterAnnotator, clusterAnnotator, fetcher, extraction)
+	if err != nil {
+		return nil, err
+	}
+	if hooksManifest != nil {
 		hooksSqlite, ok := hooksManifest.GetConfig()["sqlite_path"]
-		if ok {
+		// Hooks are never run in observe-only mode, so there is nothing to
+		// audit
+		if ok && !preparerConfig.ObserveOnly {
 			sqlitePath := hooksSqlite.(string)
 			if err = os.MkdirAll(path.Dir(sqlitePath), os.ModeDir); err != nil {
 				err = os.Chmod(sqlitePath, 0777)
@@ -501,35 +1299,189 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		}
 	}
 
-	httpClient, err := preparerConfig.GetClient(30 * time.Second)
+	podFactory, err := preparerConfig.podFactory(fetcher)
 	if err != nil {
 		return nil, err
 	}
-	fetcher := uri.BasicFetcher{
-		Client: httpClient,
+
+	autoPorts := preparerConfig.AutoPortRange
+	if autoPorts != (PortRange{}) && (autoPorts.Min < 1 || autoPorts.Max > 65535 || autoPorts.Min > autoPorts.Max) {
+		return nil, util.Errorf("Invalid auto_port_range %d-%d", autoPorts.Min, autoPorts.Max)
+	}
+
+	logForwarder, err := preparerConfig.logForwarder(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateSidecars(preparerConfig.Sidecars)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Preparer{
+	if preparerConfig.ArtifactGC != nil {
+		err = preparerConfig.ArtifactGC.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tracer, err := preparerConfig.tracer(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	readiness, err := preparerConfig.readinessChecker()
+	if err != nil {
+		return nil, err
+	}
+
+	hooksContext := hooks.NewContext(preparerConfig.HooksDirectory, preparerConfig.PodRoot, &logger, auditLogger)
+	hooksContext.SetRedaction(redaction)
+
+	prep := &Preparer{
 		node:                   preparerConfig.NodeName,
 		store:                  store,
-		hooks:                  hooks.NewContext(preparerConfig.HooksDirectory, preparerConfig.PodRoot, &logger, auditLogger),
+		hooks:                  hooksContext,
 		podStatusStore:         podStatusStore,
 		podStore:               podStore,
 		client:                 client,
 		Logger:                 logger,
-		podFactory:             pods.NewFactory(preparerConfig.PodRoot, preparerConfig.NodeName, fetcher, preparerConfig.RequireFile),
+		podFactory:             podFactory,
 		authPolicy:             authPolicy,
+		confinement:            preparerConfig.Confinement,
+		admitter:               admitter,
+		intentWriterPolicy:     intentWriterPolicy,
 		maxLaunchableDiskUsage: maxLaunchableDiskUsage,
 		finishExec:             finishExec,
 		logExec:                logExec,
 		logBridgeBlacklist:     preparerConfig.LogBridgeBlacklist,
 		artifactVerifier:       artifactVerifier,
+		hooksArtifactVerifier:  hooksArtifactVerifier,
+		artifactCache:          artifactCache,
+		extraction:             extraction,
+		secrets:                secretsSource,
+		clusterAnnotator:       clusterAnnotator,
+		placement:              clusterAnnotator,
+		podRoot:                preparerConfig.PodRoot,
 		artifactRegistry:       artifactRegistry,
+		verificationPolicy:     verificationPolicy,
+		redaction:              redaction,
+		readiness:              readiness,
+		ports:                  newPortAllocator(preparerConfig.NodeName, preparerConfig.AutoPortRange),
+		logForwarder:           logForwarder,
+		gc:                     preparerConfig.ArtifactGC,
+		deploySlots:            newDeploySlots(store, preparerConfig.NodeName),
+		freezes:                newDeployFreezes(freeze.NewChecker(freezestore.NewConsul(client)), applicator, preparerConfig.NodeName),
+		tracer:                 tracer,
+		sidecars:               preparerConfig.Sidecars,
 		PodProcessReporter:     podProcessReporter,
+		Propagation:            NewPropagationTracker(p2metrics.Registry, logger),
+		Observations:           observations,
+		PodEvents:              podEvents,
+		auditRecorder:          auditRecorder,
+		metrics:                newPreparerMetrics(p2metrics.Registry),
+		NodeLabels:             nodeLabels,
+		CloudLabels:            cloudLabels,
+		Termination:            termination,
+		Heartbeats:             NewHeartbeatWriter(preparerConfig.NodeName, store, preparerConfig.PodRoot, preparerConfig.ObserveOnly, logger),
 		hooksManifest:          hooksManifest,
 		hooksPod:               hooksPod,
 		hooksExecDir:           preparerConfig.HooksDirectory,
-	}, nil
+		config:                 preparerConfig,
+	}
+	if termination != nil {
+		termination.evacuate = prep.evacuate
+	}
+	return prep, nil
+}
+
+// hooksPod returns the hooks manifest in hooksManifestYAML, which is the
+// hooks_manifest of this config or of one it is being reloaded with, and the
+// pod it is installed as, or nil for both if there are no hooks
+func (c *PreparerConfig) hooksPod(
+	hooksManifestYAML string,
+	artifactCache *artifact.Cache,
+	secretsSource secrets.Source,
+	clusterAnnotator pods.ClusterAnnotator,
+	placement pods.Placement,
+	fetcher uri.Fetcher,
+	extraction gzip.Options,
+) (manifest.Manifest, *pods.Pod, error) {
+	if hooksManifestYAML == NoHooksSentinelValue {
+		return nil, nil, nil
+	}
+	if hooksManifestYAML == "" {
+		return nil, nil, util.Errorf("Most provide a hooks_manifest or sentinel value %q to indicate that there are no hooks", NoHooksSentinelValue)
+	}
+
+	hooksManifest, err := manifest.FromBytes([]byte(hooksManifestYAML))
+	if err != nil {
+		return nil, nil, util.Errorf("Could not parse configured hooks manifest: %s", err)
+	}
+	hooksPodFactory := pods.NewHookFactory(filepath.Join(c.PodRoot, "hooks"), c.NodeName)
+	hooksPod := hooksPodFactory.NewHookPod(hooksManifest.ID())
+	hooksPod.Unprivileged = c.Unprivileged
+	hooksPod.ArtifactCache = artifactCache
+	hooksPod.Secrets = secretsSource
+	hooksPod.ClusterAnnotator = clusterAnnotator
+	hooksPod.Placement = placement
+	hooksPod.Fetcher = fetcher
+	hooksPod.Extraction = extraction
+	return hooksManifest, hooksPod, nil
+}
+
+// prepareDirectories creates the pod root and makes the temp dir accessible to
+// pods. Neither is needed in observe-only mode, which does not touch either
+// directory beyond staging artifacts for verification.
+func (c *PreparerConfig) prepareDirectories() error {
+	if c.ObserveOnly {
+		return nil
+	}
+
+	err := os.MkdirAll(c.PodRoot, 0755)
+	if err != nil {
+		return util.Errorf("Could not create preparer pod directory: %s", err)
+	}
+
+	if c.Unprivileged {
+		root, err := c.unprivilegedRoot()
+		if err != nil {
+			return err
+		}
+		builder := runit.UserBuilder(root)
+		for _, dir := range []string{builder.ConfigRoot, builder.StagingRoot, builder.RunitRoot} {
+			err = os.MkdirAll(dir, 0755)
+			if err != nil {
+				return util.Errorf("Could not create service directory: %s", err)
+			}
+		}
+	}
+
+	// Artifact files are downloaded to os.TempDir().
+	// Since we extract artifact files as target user, we must allow them to access the tmpdir.
+	// We expect that there is no sensitive information in TempDir, so 755 is safe, though 711 could be considered.
+	tmpDirStat, err := os.Stat(os.TempDir())
+	if err != nil {
+		return util.Errorf("Could not stat tmpdir: %s", err)
+	}
+	mode := tmpDirStat.Mode()
+	// We don't chmod if the directory is already 755.
+	// Normally there is no harm in doing so,
+	// but on Travis we don't have permission to do so (we don't run as root).
+
+	currUser, err := user.Current()
+	if err != nil {
+		return err
+	}
+	if mode&0755 != 0755 && currUser.Uid == "0" {
+		// keep whatever upper bit is there.
+		err = os.Chmod(os.TempDir(), (mode&07000)|0755)
+		if err != nil {
+			return util.Errorf("Could not chmod tmpdir: %s", err)
+		}
+	}
+	return nil
 }
 
 func getDeployerAuth(preparerConfig *PreparerConfig) (auth.Policy, error) {
@@ -548,13 +1500,73 @@ func getDeployerAuth(preparerConfig *PreparerConfig) (auth.Policy, error) {
 		if authConfig.KeyringPath == "" {
 			return nil, util.Errorf("keyring auth must contain a path to the keyring")
 		}
+		for podID, quorum := range authConfig.SignerQuorums {
+			if err := quorum.Validate(); err != nil {
+				return nil, util.Errorf("error configuring keyring auth: signer quorum of %s: %s", podID, err)
+			}
+		}
 		authPolicy, err = auth.NewFileKeyringPolicy(
 			authConfig.KeyringPath,
 			map[types.PodID][]string{constants.PreparerPodID: authConfig.AuthorizedDeployers},
+			authConfig.SignerQuorums,
 		)
 		if err != nil {
 			return nil, util.Errorf("error configuring keyring auth: %s", err)
 		}
+	case auth.KMS:
+		var authConfig KMSAuth
+		err := castYaml(preparerConfig.Auth, &authConfig)
+		if err != nil {
+			return nil, util.Errorf("error configuring kms auth: %s", err)
+		}
+		for podID, quorum := range authConfig.SignerQuorums {
+			if err := quorum.Validate(); err != nil {
+				return nil, util.Errorf("error configuring kms auth: signer quorum of %s: %s", podID, err)
+			}
+		}
+		keyring, err := preparerConfig.kmsKeyring(authConfig.KMS)
+		if err != nil {
+			return nil, util.Errorf("error configuring kms auth: %s", err)
+		}
+		authPolicy = auth.FixedKeyringPolicy{
+			Keyring:             keyring,
+			AuthorizedDeployers: map[types.PodID][]string{constants.PreparerPodID: authConfig.AuthorizedDeployers},
+			SignerQuorums:       authConfig.SignerQuorums,
+		}
+	case auth.Rules:
+		var rulesConfig RulesAuth
+		err := castYaml(preparerConfig.Auth, &rulesConfig)
+		if err != nil {
+			return nil, util.Errorf("error configuring rules auth: %s", err)
+		}
+		if rulesConfig.KeyringPath == "" || rulesConfig.RuleKeyringPath == "" {
+			return nil, util.Errorf("rules auth must contain paths to the keyring and the rule keyring")
+		}
+		if rulesConfig.RuleKey == "" {
+			rulesConfig.RuleKey = DefaultRuleKey
+		}
+		client, err := preparerConfig.GetConsulClient()
+		if err != nil {
+			return nil, util.Errorf("error configuring rules auth: %s", err)
+		}
+		applicator := labels.NewConsulApplicator(client, 0)
+		authPolicy, err = auth.NewRulePolicy(
+			rulesConfig.KeyringPath,
+			rulesConfig.RuleKeyringPath,
+			watchRuleDocument(rulesConfig.RuleKey, client),
+			rulesConfig.Environment,
+			func() (klabels.Labels, error) {
+				nodeLabels, err := applicator.GetLabels(labels.NODE, preparerConfig.NodeName.String())
+				if err != nil {
+					return nil, err
+				}
+				return nodeLabels.Labels, nil
+			},
+			logging.DefaultLogger.SubLogger(logrus.Fields{"rule_key": rulesConfig.RuleKey}),
+		)
+		if err != nil {
+			return nil, util.Errorf("error configuring rules auth: %s", err)
+		}
 	case auth.User:
 		var userConfig UserAuth
 		err := castYaml(preparerConfig.Auth, &userConfig)
@@ -585,7 +1597,60 @@ func getDeployerAuth(preparerConfig *PreparerConfig) (auth.Policy, error) {
 	return authPolicy, nil
 }
 
+// watchRuleDocument returns an auth.RuleDocumentWatcher of the rule document
+// in the consul key ruleKey
+func watchRuleDocument(ruleKey string, client consulutil.ConsulClient) auth.RuleDocumentWatcher {
+	return func(documents chan<- []byte, quit <-chan struct{}) {
+		pairs := make(chan *api.KVPair)
+		errs := make(chan error)
+		go consulutil.WatchSingle(ruleKey, client.KV(), pairs, quit, errs)
+		for {
+			select {
+			case <-quit:
+				return
+			case pair, ok := <-pairs:
+				if !ok {
+					return
+				}
+				var document []byte
+				if pair != nil {
+					document = pair.Value
+				}
+				select {
+				case <-quit:
+					return
+				case documents <- document:
+				}
+			case err := <-errs:
+				logging.DefaultLogger.WithErrorAndFields(err, logrus.Fields{"rule_key": ruleKey}).Errorln("Could not watch the rule document")
+			}
+		}
+	}
+}
+
 func getArtifactVerifier(preparerConfig *PreparerConfig, logger *logging.Logger) (auth.ArtifactVerifier, error) {
+	return newArtifactVerifier(preparerConfig, preparerConfig.ArtifactAuth, logger)
+}
+
+// getHooksArtifactVerifier returns the verifier configured by
+// hooks_artifact_auth, or nil if the hooks pod's artifacts are verified like
+// everyone else's
+func getHooksArtifactVerifier(preparerConfig *PreparerConfig, logger *logging.Logger) (auth.ArtifactVerifier, error) {
+	if preparerConfig.HooksArtifactAuth == nil {
+		return nil, nil
+	}
+	switch t, _ := preparerConfig.HooksArtifactAuth["type"].(string); t {
+	case "", auth.VerifyNone:
+		return nil, util.Errorf("hooks_artifact_auth must set a type of verification other than %q", auth.VerifyNone)
+	}
+	verifier, err := newArtifactVerifier(preparerConfig, preparerConfig.HooksArtifactAuth, logger)
+	if err != nil {
+		return nil, util.Errorf("error configuring hooks artifact verification: %s", err)
+	}
+	return verifier, nil
+}
+
+func newArtifactVerifier(preparerConfig *PreparerConfig, artifactAuth map[string]interface{}, logger *logging.Logger) (auth.ArtifactVerifier, error) {
 	httpClient, err := preparerConfig.GetClient(30 * time.Second)
 	if err != nil {
 		return nil, err
@@ -595,30 +1660,61 @@ func getArtifactVerifier(preparerConfig *PreparerConfig, logger *logging.Logger)
 		Client: httpClient,
 	}
 	var verif ManifestVerification
-	switch t, _ := preparerConfig.ArtifactAuth["type"].(string); t {
+	switch t, _ := artifactAuth["type"].(string); t {
 	case "", auth.VerifyNone:
 		return auth.NopVerifier(), nil
-	case auth.VerifyManifest:
-		err = castYaml(preparerConfig.ArtifactAuth, &verif)
-		if err != nil {
-			return nil, util.Errorf("error configuring artifact verification: %v", err)
-		}
-		return auth.NewBuildManifestVerifier(verif.KeyringPath, fetcher, logger)
-	case auth.VerifyBuild:
-		err = castYaml(preparerConfig.ArtifactAuth, &verif)
-		if err != nil {
-			return nil, util.Errorf("error configuring artifact verification: %v", err)
-		}
-		return auth.NewBuildVerifier(verif.KeyringPath, fetcher, logger)
-	case auth.VerifyEither:
-		err = castYaml(preparerConfig.ArtifactAuth, &verif)
+	case auth.VerifyManifest, auth.VerifyBuild, auth.VerifyEither:
+		err = castYaml(artifactAuth, &verif)
 		if err != nil {
 			return nil, util.Errorf("error configuring artifact verification: %v", err)
 		}
-		return auth.NewCompositeVerifier(verif.KeyringPath, fetcher, logger)
 	default:
 		return nil, util.Errorf("Unrecognized artifact verification type: %v", t)
 	}
+
+	if verif.KMS == nil {
+		switch verif.Type {
+		case auth.VerifyManifest:
+			return auth.NewBuildManifestVerifier(verif.KeyringPath, fetcher, logger)
+		case auth.VerifyBuild:
+			return auth.NewBuildVerifier(verif.KeyringPath, fetcher, logger)
+		default:
+			return auth.NewCompositeVerifier(verif.KeyringPath, fetcher, logger)
+		}
+	}
+
+	if verif.KeyringPath != "" {
+		return nil, util.Errorf("error configuring artifact verification: only one of keyring and kms can be set")
+	}
+	keyring, err := preparerConfig.kmsKeyring(*verif.KMS)
+	if err != nil {
+		return nil, util.Errorf("error configuring artifact verification: %v", err)
+	}
+	switch verif.Type {
+	case auth.VerifyManifest:
+		return auth.NewKeyringBuildManifestVerifier(keyring, fetcher, logger), nil
+	case auth.VerifyBuild:
+		return auth.NewKeyringBuildVerifier(keyring, fetcher, logger), nil
+	default:
+		return auth.NewKeyringCompositeVerifier(keyring, fetcher, logger), nil
+	}
+}
+
+// kmsKeyring returns the keyring of the keys of the KMS configured by config,
+// which is reached with the preparer's TLS config
+func (c *PreparerConfig) kmsKeyring(config kms.Config) (*kms.Keyring, error) {
+	if config.URL == "" {
+		return nil, util.Errorf("kms must set the url of the KMS")
+	}
+	httpClient, err := c.GetClient(30 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kms.NewHTTPClient(config.URL, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return kms.NewKeyring(client, config, logging.DefaultLogger), nil
 }
 
 func getArtifactRegistry(preparerConfig *PreparerConfig) (artifact.Registry, error) {
@@ -631,6 +1727,14 @@ func getArtifactRegistry(preparerConfig *PreparerConfig) (artifact.Registry, err
 		Client: httpClient,
 	}
 
+	if preparerConfig.ArtifactRegistryFile != "" {
+		if preparerConfig.ArtifactRegistryURL != "" {
+			return nil, util.Errorf("Only one of 'artifact_registry_url' and 'artifact_registry_file' may be set")
+		}
+		backend := artifact.NewStaticRegistryBackend(preparerConfig.ArtifactRegistryFile)
+		return artifact.NewRegistryWithBackend(backend, osversion.DefaultDetector), nil
+	}
+
 	if preparerConfig.ArtifactRegistryURL == "" {
 		// This will still work as long as all launchables have "location" urls specified.
 		return artifact.NewRegistry(nil, fetcher, osversion.DefaultDetector), nil
@@ -644,38 +1748,75 @@ func getArtifactRegistry(preparerConfig *PreparerConfig) (artifact.Registry, err
 	return artifact.NewRegistry(url, fetcher, osversion.DefaultDetector), nil
 }
 
+// getArtifactCache returns the configured artifact cache, or nil if artifacts
+// aren't cached
+func getArtifactCache(preparerConfig *PreparerConfig) (*artifact.Cache, error) {
+	if preparerConfig.ArtifactCacheDir == "" {
+		return nil, nil
+	}
+
+	maxSize := DefaultArtifactCacheMaxSize
+	if preparerConfig.ArtifactCacheMaxSize != "" {
+		var err error
+		maxSize, err = size.Parse(preparerConfig.ArtifactCacheMaxSize)
+		if err != nil {
+			return nil, util.Errorf("Unparseable value for artifact_cache_max_size %v, %v", preparerConfig.ArtifactCacheMaxSize, err)
+		}
+	}
+	return artifact.NewCache(preparerConfig.ArtifactCacheDir, maxSize)
+}
+
 func (p *Preparer) InstallHooks() error {
-	if p.hooksManifest == nil {
+	if p.Observations != nil {
+		p.Logger.Infoln("Observe-only mode, skipping hook installation")
+		return nil
+	}
+
+	reloadable := p.reloadable()
+	hooksManifest, hooksPod := reloadable.hooksManifest, reloadable.hooksPod
+	if hooksManifest == nil {
 		p.Logger.Infoln("No hooks configured, skipping hook installation")
 		return nil
 	}
 
 	sub := p.Logger.SubLogger(logrus.Fields{
-		"pod": p.hooksManifest.ID(),
+		"pod": hooksManifest.ID(),
 	})
 
 	p.Logger.Infoln("Installing hook manifest")
-	err := p.hooksPod.Install(p.hooksManifest, p.artifactVerifier, p.artifactRegistry)
+	hooksManifest, err := artifact.ResolveChannels(reloadable.artifactRegistry, hooksManifest)
+	if err != nil {
+		sub.WithError(err).Errorln("Could not resolve the channels of the hooks' launchables")
+		return err
+	}
+	// There is nowhere to record verification failures for the hooks pod,
+	// so they are only logged
+	var verificationFailures []podstatus.ArtifactVerificationFailure
+	verifier := p.verifierForPod(hooksManifest.ID(), sub, &verificationFailures)
+	if reloadable.hooksArtifactVerifier != nil {
+		verifier = reloadable.hooksArtifactVerifier
+	}
+	err = hooksPod.Install(hooksManifest, verifier, reloadable.artifactRegistry)
 	if err != nil {
 		sub.WithError(err).Errorln("Could not install hook")
 		return err
 	}
 
-	_, err = p.hooksPod.WriteCurrentManifest(p.hooksManifest)
+	_, err = hooksPod.WriteCurrentManifest(hooksManifest)
 	if err != nil {
 		sub.WithError(err).Errorln("Could not write current manifest")
 		return err
 	}
 
 	// Now that the pod is installed, link it up to the exec dir.
-	err = hooks.InstallHookScripts(p.hooksExecDir, p.hooksPod, p.hooksManifest, sub)
+	err = hooks.InstallHookScripts(p.hooksExecDir, hooksPod, hooksManifest, sub)
 	if err != nil {
 		sub.WithError(err).Errorln("Could not write hook link")
 		return err
 	}
 	sub.NoFields().Infoln("Updated hook")
 
-	p.hooksPod.Prune(p.maxLaunchableDiskUsage, p.hooksManifest)
+	hooksPod.Prune(p.maxLaunchableDiskUsage, hooksManifest)
 
 	return nil
 }
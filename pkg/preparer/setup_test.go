@@ -17,8 +17,12 @@ import (
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/osversion"
 	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
+	"github.com/square/p2/pkg/systemd"
+	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/winsvc"
 )
 
 func TestLoadConfigWillMarshalYaml(t *testing.T) {
@@ -39,6 +43,66 @@ func TestLoadConfigWillMarshalYaml(t *testing.T) {
 	Assert(t).AreEqual("/var/log/p2-socket.out", destination.Path, "should have parsed path correctly")
 }
 
+func TestGetConsulClientSelectsStoreBackend(t *testing.T) {
+	config := &PreparerConfig{StoreBackend: "zookeeper"}
+	_, err := config.GetConsulClient()
+	Assert(t).IsNotNil(err, "should have erred with an unknown store backend")
+
+	config = &PreparerConfig{StoreBackend: EtcdBackend}
+	_, err = config.GetConsulClient()
+	Assert(t).IsNotNil(err, "should have erred without etcd endpoints")
+
+	config = &PreparerConfig{
+		StoreBackend: EtcdBackend,
+		EtcdConfig:   EtcdConfig{Endpoints: []string{"http://127.0.0.1:2379"}},
+	}
+	client, err := config.GetConsulClient()
+	Assert(t).IsNil(err, "should have created an etcd client")
+	Assert(t).IsNotNil(client, "should have created an etcd client")
+}
+
+func TestPodFactorySelectsServiceBackend(t *testing.T) {
+	config := &PreparerConfig{ServiceBackend: "upstart"}
+	_, err := config.podFactory(uri.DefaultFetcher)
+	Assert(t).IsNotNil(err, "should have erred with an unknown service backend")
+
+	config = &PreparerConfig{ServiceBackend: SystemdServiceBackend, NodeName: "testNode"}
+	factory, err := config.podFactory(uri.DefaultFetcher)
+	Assert(t).IsNil(err, "should have created a pod factory")
+	pod := factory.NewLegacyPod("testPod")
+	Assert(t).IsNotNil(pod.ServiceBuilder.Backend, "services should have been built for systemd")
+	_, isSystemd := pod.SV.(systemd.SV)
+	Assert(t).IsTrue(isSystemd, "services should have been controlled by systemd")
+
+	config = &PreparerConfig{ServiceBackend: WindowsServiceBackend, NodeName: "testNode"}
+	factory, err = config.podFactory(uri.DefaultFetcher)
+	Assert(t).IsNil(err, "should have created a pod factory")
+	pod = factory.NewLegacyPod("testPod")
+	_, isWindows := pod.SV.(winsvc.SV)
+	Assert(t).IsTrue(isWindows, "services should have been controlled by the Windows Service Manager")
+}
+
+func TestUnprivilegedConfigKeepsPodsUnderItsRoot(t *testing.T) {
+	config, err := UnmarshalConfig([]byte(`
+preparer:
+  unprivileged: true
+  unprivileged_root: /home/dev/.p2
+`))
+	Assert(t).IsNil(err, "should have read the config")
+	Assert(t).AreEqual(config.PodRoot, "/home/dev/.p2/pods", "pods should have been kept under the unprivileged root")
+	Assert(t).AreEqual(config.HooksDirectory, "/home/dev/.p2/hooks.d", "hooks should have been kept under the unprivileged root")
+
+	factory, err := config.podFactory(uri.DefaultFetcher)
+	Assert(t).IsNil(err, "should have created a pod factory")
+	pod := factory.NewLegacyPod("testPod")
+	Assert(t).IsTrue(pod.Unprivileged, "pods should have been unprivileged")
+	Assert(t).AreEqual(pod.ServiceBuilder.RunitRoot, "/home/dev/.p2/service", "services should have been supervised from the unprivileged root")
+
+	config.ServiceBackend = SystemdServiceBackend
+	_, err = config.podFactory(uri.DefaultFetcher)
+	Assert(t).IsNotNil(err, "unprivileged mode should only support runit")
+}
+
 func TestInstallHooks(t *testing.T) {
 	destDir, _ := ioutil.TempDir("", "pods")
 	defer os.RemoveAll(destDir)
@@ -82,3 +146,101 @@ func TestInstallHooks(t *testing.T) {
 	_, err = os.Stat(hookFile)
 	Assert(t).IsNil(err, "should have created the user launch script")
 }
+
+func TestInstallHooksEnforcesHooksArtifactVerifier(t *testing.T) {
+	destDir, _ := ioutil.TempDir("", "pods")
+	defer os.RemoveAll(destDir)
+	execDir, err := ioutil.TempDir("", "exec")
+	defer os.RemoveAll(execDir)
+	Assert(t).IsNil(err, "should not have erred creating a tempdir")
+
+	current, err := user.Current()
+	Assert(t).IsNil(err, "test setup: could not get the current user")
+	builder := manifest.NewBuilder()
+	builder.SetID("users")
+	builder.SetRunAsUser(current.Username)
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"create": {
+			Location:       util.From(runtime.Caller(0)).ExpandPath("testdata/hoisted-hello_def456.tar.gz"),
+			LaunchableType: "hoist",
+		},
+	})
+	podManifest := builder.GetManifest()
+
+	preparer := Preparer{
+		hooksManifest:         podManifest,
+		hooksPod:              pods.NewHookFactory(destDir, "testNode").NewHookPod(podManifest.ID()),
+		hooksExecDir:          execDir,
+		Logger:                logging.DefaultLogger,
+		artifactRegistry:      artifact.NewRegistry(nil, uri.DefaultFetcher, osversion.DefaultDetector),
+		artifactVerifier:      auth.NopVerifier(),
+		hooksArtifactVerifier: failingVerifier{},
+		verificationPolicy: verificationPolicy{
+			defaultPolicy: auth.AuditVerification,
+		},
+	}
+
+	err = preparer.InstallHooks()
+	Assert(t).IsNotNil(err, "the hooks should have failed their own verification despite the audit policy")
+	_, err = os.Stat(filepath.Join(execDir, "users__create__launch"))
+	Assert(t).IsTrue(os.IsNotExist(err), "should not have created the user launch script")
+}
+
+func TestGetHooksArtifactVerifier(t *testing.T) {
+	verifier, err := getHooksArtifactVerifier(&PreparerConfig{}, &logging.DefaultLogger)
+	Assert(t).IsNil(err, "should have allowed hooks_artifact_auth to be unset")
+	Assert(t).IsNil(verifier, "should have verified hooks like other pods")
+
+	_, err = getHooksArtifactVerifier(&PreparerConfig{
+		HooksArtifactAuth: map[string]interface{}{"type": auth.VerifyNone},
+	}, &logging.DefaultLogger)
+	Assert(t).IsNotNil(err, "should have rejected hooks_artifact_auth that verifies nothing")
+
+	_, err = getHooksArtifactVerifier(&PreparerConfig{
+		HooksArtifactAuth: map[string]interface{}{"keyring": "/etc/p2/hooks.keyring"},
+	}, &logging.DefaultLogger)
+	Assert(t).IsNotNil(err, "should have rejected hooks_artifact_auth without a type")
+}
+
+func TestVerificationPolicyForPod(t *testing.T) {
+	policy, err := getVerificationPolicy(VerificationPolicyConfig{
+		Default: "warn",
+		Pods: map[types.PodID]string{
+			"strict": "enforce",
+			"legacy": "audit",
+		},
+	})
+	Assert(t).IsNil(err, "should have parsed verification policy")
+	Assert(t).AreEqual(auth.WarnVerification, policy.forPod("other"), "should have used the node default")
+	Assert(t).AreEqual(auth.EnforceVerification, policy.forPod("strict"), "should have used the pod override")
+	Assert(t).AreEqual(auth.AuditVerification, policy.forPod("legacy"), "should have used the pod override")
+
+	policy, err = getVerificationPolicy(VerificationPolicyConfig{})
+	Assert(t).IsNil(err, "should have parsed empty verification policy")
+	Assert(t).AreEqual(auth.EnforceVerification, policy.forPod("other"), "should enforce by default")
+
+	_, err = getVerificationPolicy(VerificationPolicyConfig{Pods: map[types.PodID]string{"pod": "lenient"}})
+	Assert(t).IsNotNil(err, "should have rejected an unknown policy")
+}
+
+type failingVerifier struct{}
+
+func (failingVerifier) VerifyHoistArtifact(_ *os.File, _ auth.VerificationData) error {
+	return util.Errorf("bad signature")
+}
+
+func TestVerifierForPodRecordsFailures(t *testing.T) {
+	preparer := Preparer{
+		artifactVerifier: failingVerifier{},
+		verificationPolicy: verificationPolicy{
+			defaultPolicy: auth.AuditVerification,
+		},
+	}
+
+	var failures []podstatus.ArtifactVerificationFailure
+	verifier := preparer.verifierForPod("pod", logging.DefaultLogger, &failures)
+	err := verifier.VerifyHoistArtifact(nil, auth.VerificationData{})
+	Assert(t).IsNil(err, "audit policy should have allowed the artifact")
+	Assert(t).AreEqual(1, len(failures), "should have recorded the failure")
+	Assert(t).AreEqual("audit", failures[0].Policy, "should have recorded the policy")
+}
@@ -0,0 +1,102 @@
+package preparer
+
+import (
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+// SidecarBootstrapEnvVar is exported to a sidecar with the name of its
+// rendered bootstrap in CONFIG_TEMPLATES_DIR
+const SidecarBootstrapEnvVar = "SIDECAR_BOOTSTRAP"
+
+// SidecarConfig is a sidecar launchable, such as a service mesh proxy, that
+// the preparer adds to the pods whose manifests opt into it with a sidecar
+// stanza. The sidecar is added as a launchable named after it, so it is
+// installed, launched and halted with the pod: it is launched before the
+// pod's main launchable and halted after it.
+type SidecarConfig struct {
+	// Launchable is the stanza that the sidecar is added to pods with
+	Launchable launch.LaunchableStanza `yaml:"launchable"`
+
+	// Bootstrap, if set, is a config template (see
+	// manifest.ConfigTemplates) that is rendered for the sidecar as
+	// <name>.bootstrap. Besides the pod's cluster annotations, it can use
+	// {{.Sidecar.AdminPort}} and {{.Sidecar.ListenerPort}}, the ports
+	// allocated to the sidecar, which the pod's own templates can also
+	// use.
+	Bootstrap string `yaml:"bootstrap,omitempty"`
+}
+
+func validateSidecars(sidecars map[string]SidecarConfig) error {
+	for name, sidecar := range sidecars {
+		builder := manifest.NewBuilder()
+		builder.SetID("sidecar")
+		builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+			launch.LaunchableID(name): sidecar.Launchable,
+		})
+		err := manifest.ValidManifest(builder.GetManifest())
+		if err != nil {
+			return util.Errorf("Invalid sidecar %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func sidecarBootstrapName(name string) string {
+	return name + ".bootstrap"
+}
+
+// withSidecar returns podManifest with the sidecar it opts into added to it,
+// or podManifest itself if it has none
+func (p *Preparer) withSidecar(podManifest manifest.Manifest) (manifest.Manifest, error) {
+	stanza := podManifest.GetSidecar()
+	if stanza == nil {
+		return podManifest, nil
+	}
+	sidecar, ok := p.sidecars[stanza.Name]
+	if !ok {
+		return nil, util.Errorf("pod %s has sidecar %q, which is not configured", podManifest.ID(), stanza.Name)
+	}
+	sidecarID := launch.LaunchableID(stanza.Name)
+	if _, ok := podManifest.GetLaunchableStanzas()[sidecarID]; ok {
+		return nil, util.Errorf("pod %s already has a launchable named after its sidecar %q", podManifest.ID(), stanza.Name)
+	}
+
+	launchables := make(map[launch.LaunchableID]launch.LaunchableStanza)
+	for launchableID, launchable := range podManifest.GetLaunchableStanzas() {
+		launchables[launchableID] = launchable
+	}
+	launchable := sidecar.Launchable
+	if sidecar.Bootstrap != "" {
+		env := map[string]string{SidecarBootstrapEnvVar: sidecarBootstrapName(stanza.Name)}
+		for key, value := range launchable.Env {
+			env[key] = value
+		}
+		launchable.Env = env
+	}
+	launchables[sidecarID] = launchable
+
+	builder := podManifest.GetBuilder()
+	builder.SetLaunchables(launchables)
+	if sidecar.Bootstrap != "" {
+		templates := map[string]string{sidecarBootstrapName(stanza.Name): sidecar.Bootstrap}
+		for name, template := range podManifest.GetConfigTemplates() {
+			templates[name] = template
+		}
+		builder.SetConfigTemplates(templates)
+	}
+	return builder.GetManifest(), nil
+}
+
+// haltManifest returns the manifest to halt the pod that reality was
+// launched with, whose sidecar isn't recorded in reality
+func (p *Preparer) haltManifest(reality manifest.Manifest, logger logging.Logger) manifest.Manifest {
+	withSidecar, err := p.withSidecar(reality)
+	if err != nil {
+		logger.WithError(err).Warnln("Could not add the pod's sidecar to halt it")
+		return reality
+	}
+	return withSidecar
+}
@@ -0,0 +1,71 @@
+package preparer
+
+import (
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+)
+
+func TestWithSidecar(t *testing.T) {
+	p := &Preparer{sidecars: map[string]SidecarConfig{
+		"envoy": {
+			Launchable: launch.LaunchableStanza{
+				LaunchableType: "hoist",
+				Location:       "https://localhost/envoy.tar.gz",
+				Env:            map[string]string{"LOG_LEVEL": "info"},
+			},
+			Bootstrap: `admin: {{.Sidecar.AdminPort}}`,
+		},
+	}}
+
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {LaunchableType: "hoist", Location: "https://localhost/app.tar.gz"},
+	})
+	builder.SetConfigTemplates(map[string]string{"app.conf": `upstream: {{.Sidecar.ListenerPort}}`})
+	plain := builder.GetManifest()
+	Assert(t).AreEqual(mustWithSidecar(t, p, plain), plain, "should not change a manifest without a sidecar")
+
+	builder.SetSidecar(&manifest.SidecarStanza{Name: "envoy", Launchable: "app"})
+	written := builder.GetManifest()
+	withSidecar := mustWithSidecar(t, p, written)
+	sidecar, ok := withSidecar.GetLaunchableStanzas()["envoy"]
+	Assert(t).IsTrue(ok, "should have added the sidecar launchable")
+	Assert(t).AreEqual(sidecar.Location, "https://localhost/envoy.tar.gz", "should have added the configured sidecar")
+	Assert(t).AreEqual(sidecar.Env[SidecarBootstrapEnvVar], "envoy.bootstrap", "should have pointed the sidecar at its bootstrap")
+	Assert(t).AreEqual(sidecar.Env["LOG_LEVEL"], "info", "should have kept the sidecar's env")
+	Assert(t).AreEqual(withSidecar.GetConfigTemplates()["envoy.bootstrap"], `admin: {{.Sidecar.AdminPort}}`, "should have added the sidecar's bootstrap")
+	Assert(t).AreEqual(len(withSidecar.GetConfigTemplates()), 2, "should have kept the pod's templates")
+	Assert(t).AreEqual(len(written.GetLaunchableStanzas()), 1, "should not have changed the written manifest")
+	Assert(t).IsNil(manifest.ValidManifest(withSidecar), "should have added a valid sidecar")
+	Assert(t).AreEqual(len(p.haltManifest(written, logging.TestLogger()).GetLaunchableStanzas()), 2, "should halt the sidecar with the pod")
+
+	builder.SetSidecar(&manifest.SidecarStanza{Name: "linkerd", Launchable: "app"})
+	_, err := p.withSidecar(builder.GetManifest())
+	Assert(t).IsNotNil(err, "should not add a sidecar that isn't configured")
+}
+
+func mustWithSidecar(t *testing.T, p *Preparer, podManifest manifest.Manifest) manifest.Manifest {
+	withSidecar, err := p.withSidecar(podManifest)
+	if err != nil {
+		t.Fatalf("could not add sidecar: %s", err)
+	}
+	return withSidecar
+}
+
+func TestValidateSidecars(t *testing.T) {
+	err := validateSidecars(map[string]SidecarConfig{
+		"envoy": {Launchable: launch.LaunchableStanza{LaunchableType: "hoist", Location: "https://localhost/envoy.tar.gz"}},
+	})
+	Assert(t).IsNil(err, "should have accepted a valid sidecar")
+
+	err = validateSidecars(map[string]SidecarConfig{
+		"envoy": {Launchable: launch.LaunchableStanza{LaunchableType: "hoist"}},
+	})
+	Assert(t).IsNotNil(err, "should have refused a sidecar without a location")
+}
@@ -1,12 +1,14 @@
 package preparer
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 
 	"github.com/square/p2/pkg/logging"
+	p2metrics "github.com/square/p2/pkg/metrics"
 )
 
 // StatusServer exposes a unix socket server that can be queried for the health
@@ -16,7 +18,20 @@ type StatusServer struct {
 	listener net.Listener
 	server   *http.Server
 	logger   *logging.Logger
+	onSocket bool
 	Exit     chan error
+
+	// If set, the state of each supervised preparer component is served
+	// from /_status/components
+	supervisor *Supervisor
+
+	// If set, recently completed deploy propagation traces are served from
+	// /_status/propagation
+	propagation *PropagationTracker
+
+	// If set, what an observe-only preparer would have done with each pod
+	// is served from /_status/observations
+	observations *ObservationLog
 }
 
 func (s *StatusServer) Close() error {
@@ -25,12 +40,16 @@ func (s *StatusServer) Close() error {
 
 var NoServerConfigured = fmt.Errorf("No status server was configured")
 
-func NewStatusServer(statusPort int, statusSocket string, logger *logging.Logger) (*StatusServer, error) {
+func NewStatusServer(statusPort int, statusSocket string, supervisor *Supervisor, propagation *PropagationTracker, observations *ObservationLog, logger *logging.Logger) (*StatusServer, error) {
 	server := http.Server{}
 	statusServer := &StatusServer{
-		server: &server,
-		logger: logger,
-		Exit:   make(chan error),
+		server:      &server,
+		logger:      logger,
+		Exit:        make(chan error),
+		supervisor:  supervisor,
+		propagation: propagation,
+
+		observations: observations,
 	}
 	var listener net.Listener
 	var err error
@@ -45,6 +64,7 @@ func NewStatusServer(statusPort int, statusSocket string, logger *logging.Logger
 		if err != nil {
 			return nil, err
 		}
+		statusServer.onSocket = true
 	} else {
 		return nil, NoServerConfigured
 	}
@@ -60,6 +80,25 @@ func (s *StatusServer) Serve() {
 	mux.HandleFunc("/_status", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "p2-preparer OK")
 	})
+	if s.supervisor != nil {
+		mux.HandleFunc("/_status/components", s.serveComponents)
+	}
+	if s.propagation != nil {
+		mux.HandleFunc("/_status/propagation", s.servePropagation)
+	}
+	if s.observations != nil {
+		mux.HandleFunc("/_status/observations", s.serveObservations)
+	}
+	// Propagation latency timers are exported here for aggregation across
+	// preparers
+	mux.Handle("/_status/metrics", p2metrics.ExpHandler)
+	// The same registry for Prometheus to scrape, along with the install,
+	// verification, hook, health check, consul and watch loop metrics
+	mux.Handle("/metrics", p2metrics.PrometheusHandler)
+	// GET reports the log level. PUT or POST with a level form value
+	// changes it, but only over the socket, whose permissions limit who can
+	// reach it.
+	mux.Handle("/_status/log_level", logging.LevelHandler(*s.logger, s.onSocket))
 
 	s.server.Handler = mux
 	err := s.server.Serve(s.listener)
@@ -68,26 +107,82 @@ func (s *StatusServer) Serve() {
 	close(s.Exit)
 }
 
+// serveComponents writes the status of each supervised component as JSON. If
+// any component is not running, the response code is 503 so that simple
+// health checks can detect a degraded preparer.
+func (s *StatusServer) serveComponents(w http.ResponseWriter, r *http.Request) {
+	statuses := s.supervisor.Statuses()
+	bytes, err := json.Marshal(statuses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	for _, status := range statuses {
+		if status.State != ComponentRunning {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			break
+		}
+	}
+	_, _ = w.Write(bytes)
+}
+
+func (s *StatusServer) servePropagation(w http.ResponseWriter, r *http.Request) {
+	bytes, err := json.Marshal(s.propagation.Recent())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(bytes)
+}
+
+func (s *StatusServer) serveObservations(w http.ResponseWriter, r *http.Request) {
+	bytes, err := json.Marshal(s.observations.Observations())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(bytes)
+}
+
 func (s *StatusServer) listenOnPort(statusPort int) (net.Listener, error) {
 	s.logger.WithField("port", statusPort).Infof("Reporting status on port %d", statusPort)
 	return net.Listen("tcp", fmt.Sprintf(":%d", statusPort))
 }
 
 func (s *StatusServer) listenOnSocket(socket string) (net.Listener, error) {
+	s.logger.WithField("socket", socket).Infof("Reporting status on socket %s", socket)
+	return listenOnSocket(socket, s.logger)
+}
+
+// listenOnSocket listens on a unix socket that anyone can connect to,
+// replacing one left behind by a previous preparer
+func listenOnSocket(socket string, logger *logging.Logger) (net.Listener, error) {
+	return listenOnSocketWithMode(socket, 0777, logger)
+}
+
+// listenOnSocketWithMode is like listenOnSocket, but the socket is given mode
+// so that only some users can connect to it
+func listenOnSocketWithMode(socket string, mode os.FileMode, logger *logging.Logger) (net.Listener, error) {
 	if _, err := os.Stat(socket); err == nil {
-		s.logger.WithField("socket", socket).Warningln("Previous socket was not removed, removing")
+		logger.WithField("socket", socket).Warningln("Previous socket was not removed, removing")
 		err = os.Remove(socket)
 		if err != nil {
-			s.logger.WithError(err).Fatalln("Could not remove existing socket!")
+			logger.WithError(err).Fatalln("Could not remove existing socket!")
 		}
 	}
-	s.logger.WithField("socket", socket).Infof("Reporting status on socket %s", socket)
 	listener, err := net.Listen("unix", socket)
 	if err != nil {
 		return nil, err
 	}
-	err = os.Chmod(socket, 0777)
+	err = os.Chmod(socket, mode)
 	if err != nil {
+		listener.Close()
 		return nil, err
 	}
 	return listener, nil
@@ -0,0 +1,168 @@
+package preparer
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+// DefaultRestartDelay is how long the supervisor waits before restarting a
+// component that panicked or failed.
+const DefaultRestartDelay = 5 * time.Second
+
+type ComponentState string
+
+const (
+	ComponentRunning    ComponentState = "running"
+	ComponentRestarting ComponentState = "restarting"
+	ComponentStopped    ComponentState = "stopped"
+)
+
+// ComponentStatus describes the observed state of a single supervised
+// component of the preparer.
+type ComponentStatus struct {
+	Name      string         `json:"name"`
+	State     ComponentState `json:"state"`
+	Restarts  int            `json:"restarts"`
+	LastPanic string         `json:"last_panic,omitempty"`
+	PanicTime time.Time      `json:"panic_time,omitempty"`
+	LastError string         `json:"last_error,omitempty"`
+	ErrorTime time.Time      `json:"error_time,omitempty"`
+}
+
+// Supervisor runs long-lived preparer subcomponents (such as the health
+// monitor) in their own goroutines and restarts them if they panic or fail, so
+// that a bug in one component does not take down intent processing.
+type Supervisor struct {
+	logger       logging.Logger
+	restartDelay time.Duration
+
+	mu         sync.Mutex
+	components map[string]*ComponentStatus
+	wg         sync.WaitGroup
+}
+
+func NewSupervisor(logger logging.Logger, restartDelay time.Duration) *Supervisor {
+	return &Supervisor{
+		logger:       logger,
+		restartDelay: restartDelay,
+		components:   make(map[string]*ComponentStatus),
+	}
+}
+
+// Supervise starts run in a new goroutine under the given component name. run
+// is expected to block until quit is closed. If run panics, the panic is
+// logged and recorded in the component's status and run is started again
+// after the supervisor's restart delay. A run that returns normally is
+// considered stopped and is not restarted.
+func (s *Supervisor) Supervise(name string, quit <-chan struct{}, run func(quit <-chan struct{})) {
+	s.SuperviseWithError(name, quit, func(quit <-chan struct{}) error {
+		run(quit)
+		return nil
+	})
+}
+
+// SuperviseWithError is like Supervise, except that run may also fail by
+// returning an error. The error is logged and recorded in the component's
+// status and run is restarted just as if it had panicked.
+func (s *Supervisor) SuperviseWithError(name string, quit <-chan struct{}, run func(quit <-chan struct{}) error) {
+	s.mu.Lock()
+	s.components[name] = &ComponentStatus{
+		Name:  name,
+		State: ComponentRunning,
+	}
+	s.mu.Unlock()
+
+	logger := s.logger.SubLogger(logrus.Fields{"component": name})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			failed := s.runOnce(name, logger, quit, run)
+			if !failed {
+				s.setState(name, ComponentStopped)
+				return
+			}
+
+			select {
+			case <-quit:
+				s.setState(name, ComponentStopped)
+				return
+			case <-time.After(s.restartDelay):
+			}
+			logger.NoFields().Infoln("Restarting component")
+			s.setState(name, ComponentRunning)
+		}
+	}()
+}
+
+// runOnce runs the component a single time and reports whether it panicked
+// or returned an error.
+func (s *Supervisor) runOnce(name string, logger logging.Logger, quit <-chan struct{}, run func(quit <-chan struct{}) error) (failed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			failed = true
+			logger.WithFields(logrus.Fields{
+				"panic": fmt.Sprint(r),
+				"stack": string(debug.Stack()),
+			}).Errorln("Component panicked")
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			status := s.components[name]
+			status.State = ComponentRestarting
+			status.Restarts++
+			status.LastPanic = fmt.Sprint(r)
+			status.PanicTime = time.Now()
+		}
+	}()
+	err := run(quit)
+	if err == nil {
+		return false
+	}
+
+	logger.WithError(err).Errorln("Component failed")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.components[name]
+	status.State = ComponentRestarting
+	status.Restarts++
+	status.LastError = err.Error()
+	status.ErrorTime = time.Now()
+	return true
+}
+
+func (s *Supervisor) setState(name string, state ComponentState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.components[name].State = state
+}
+
+// Statuses returns a snapshot of the status of every supervised component,
+// sorted by name.
+func (s *Supervisor) Statuses() []ComponentStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.components))
+	for name := range s.components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := make([]ComponentStatus, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, *s.components[name])
+	}
+	return ret
+}
+
+// Wait blocks until every supervised component has stopped.
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
@@ -0,0 +1,130 @@
+package preparer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+func TestSupervisorRestartsPanickedComponent(t *testing.T) {
+	supervisor := NewSupervisor(logging.DefaultLogger, time.Millisecond)
+
+	quit := make(chan struct{})
+	started := make(chan struct{}, 2)
+	runs := 0
+	supervisor.Supervise("flaky", quit, func(quit <-chan struct{}) {
+		runs++
+		started <- struct{}{}
+		if runs == 1 {
+			panic("first run fails")
+		}
+		<-quit
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("component was not restarted after panicking")
+		}
+	}
+
+	statuses := supervisor.Statuses()
+	if len(statuses) != 1 {
+		t.Fatalf("expected 1 component status, got %d", len(statuses))
+	}
+	if statuses[0].Restarts != 1 {
+		t.Errorf("expected 1 restart, got %d", statuses[0].Restarts)
+	}
+	if statuses[0].LastPanic != "first run fails" {
+		t.Errorf("expected last panic to be recorded, got %q", statuses[0].LastPanic)
+	}
+
+	close(quit)
+	supervisor.Wait()
+
+	statuses = supervisor.Statuses()
+	if statuses[0].State != ComponentStopped {
+		t.Errorf("expected component to be %s after quit, got %s", ComponentStopped, statuses[0].State)
+	}
+}
+
+func TestSupervisorRestartsFailedComponent(t *testing.T) {
+	supervisor := NewSupervisor(logging.DefaultLogger, time.Millisecond)
+
+	quit := make(chan struct{})
+	started := make(chan struct{}, 2)
+	runs := 0
+	supervisor.SuperviseWithError("failing", quit, func(quit <-chan struct{}) error {
+		runs++
+		started <- struct{}{}
+		if runs == 1 {
+			return fmt.Errorf("first run fails")
+		}
+		<-quit
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("component was not restarted after failing")
+		}
+	}
+
+	statuses := supervisor.Statuses()
+	if statuses[0].Restarts != 1 {
+		t.Errorf("expected 1 restart, got %d", statuses[0].Restarts)
+	}
+	if statuses[0].LastError != "first run fails" {
+		t.Errorf("expected last error to be recorded, got %q", statuses[0].LastError)
+	}
+
+	close(quit)
+	supervisor.Wait()
+}
+
+func TestSupervisorIsolatesComponents(t *testing.T) {
+	supervisor := NewSupervisor(logging.DefaultLogger, time.Hour)
+
+	quit := make(chan struct{})
+	healthyStarted := make(chan struct{})
+	supervisor.Supervise("healthy", quit, func(quit <-chan struct{}) {
+		close(healthyStarted)
+		<-quit
+	})
+	panicked := make(chan struct{})
+	supervisor.Supervise("broken", quit, func(quit <-chan struct{}) {
+		defer close(panicked)
+		panic("broken component")
+	})
+
+	<-healthyStarted
+	<-panicked
+
+	// Wait for the supervisor to record the panic.
+	deadline := time.After(5 * time.Second)
+	for {
+		statuses := supervisor.Statuses()
+		if statuses[0].Name != "broken" || statuses[1].Name != "healthy" {
+			t.Fatalf("expected statuses sorted by name, got %+v", statuses)
+		}
+		if statuses[0].State == ComponentRestarting {
+			if statuses[1].State != ComponentRunning {
+				t.Fatalf("expected healthy component to keep running, was %s", statuses[1].State)
+			}
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("broken component was never marked as restarting")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	close(quit)
+	supervisor.Wait()
+}
@@ -0,0 +1,179 @@
+package preparer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/cloudlabels"
+	"github.com/square/p2/pkg/constants"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/podevents"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/rc"
+	"github.com/square/p2/pkg/types"
+)
+
+// DefaultTerminationPollInterval is how often the termination notice is
+// checked if TerminationConfig doesn't set Interval. Spot instances get as
+// little as two minutes' notice, so it is checked often.
+const DefaultTerminationPollInterval = 5 * time.Second
+
+// TerminationConfig configures the watch for the node's cloud termination
+// notice
+type TerminationConfig struct {
+	// Provider, MetadataURL and Interval are as for cloud_labels, but
+	// Interval defaults to DefaultTerminationPollInterval
+	cloudlabels.Config `yaml:",inline"`
+
+	// GracePeriod is how long the node's pods are reported unhealthy
+	// before they are halted, so that load balancers can stop sending them
+	// traffic first
+	GracePeriod time.Duration `yaml:"grace_period,omitempty"`
+}
+
+type nodeLabeler interface {
+	SetLabels(labelType labels.Type, id string, labels map[string]string) error
+}
+
+// TerminationHandler watches for notice that the node's instance will be
+// terminated, e.g. a spot interruption or a preemption, and evacuates the
+// node before it disappears: it labels the node as cordoned and leaving, so
+// that RCs schedule replacements for its pods elsewhere, reports the node's
+// pods as unhealthy, and then drains and halts them. Once the node is
+// leaving, the preparer no longer installs or launches pods other than
+// itself.
+//
+// A nil *TerminationHandler is valid and never sees a notice.
+type TerminationHandler struct {
+	node        types.NodeName
+	notifier    cloudlabels.TerminationNotifier
+	labeler     nodeLabeler
+	interval    time.Duration
+	gracePeriod time.Duration
+	logger      logging.Logger
+
+	// Drains and halts the node's pods. Set by the preparer, which owns
+	// them.
+	evacuate func()
+
+	mu      sync.Mutex
+	leaving bool
+}
+
+func NewTerminationHandler(
+	node types.NodeName,
+	notifier cloudlabels.TerminationNotifier,
+	labeler nodeLabeler,
+	interval time.Duration,
+	gracePeriod time.Duration,
+	logger logging.Logger,
+) *TerminationHandler {
+	if interval <= 0 {
+		interval = DefaultTerminationPollInterval
+	}
+	return &TerminationHandler{
+		node:        node,
+		notifier:    notifier,
+		labeler:     labeler,
+		interval:    interval,
+		gracePeriod: gracePeriod,
+		logger:      logger,
+	}
+}
+
+// Leaving returns true once the node has had a termination notice
+func (h *TerminationHandler) Leaving() bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.leaving
+}
+
+// Run checks for a termination notice every interval until quit is closed,
+// and evacuates the node the first time there is one
+func (h *TerminationHandler) Run(quit <-chan struct{}) {
+	for !h.Leaving() {
+		notice, err := h.notifier.TerminationNotice()
+		if err != nil {
+			h.logger.WithError(err).Warnln("Could not check for a termination notice")
+		} else if notice {
+			h.handleNotice(quit)
+			break
+		}
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(h.interval):
+		}
+	}
+	<-quit
+}
+
+func (h *TerminationHandler) handleNotice(quit <-chan struct{}) {
+	h.logger.NoFields().Warnln("Node has a termination notice, evacuating it")
+	err := h.labeler.SetLabels(labels.NODE, h.node.String(), map[string]string{
+		rc.CordonLabel:  "true",
+		rc.LeavingLabel: "true",
+	})
+	if err != nil {
+		// its pods are still halted, they just won't be replaced until
+		// the node is gone
+		h.logger.WithError(err).Errorln("Could not label the node as leaving")
+	}
+
+	h.mu.Lock()
+	h.leaving = true
+	h.mu.Unlock()
+
+	select {
+	case <-quit:
+		return
+	case <-time.After(h.gracePeriod):
+	}
+	if h.evacuate != nil {
+		h.evacuate()
+	}
+	h.logger.NoFields().Infoln("Evacuated the node")
+}
+
+// evacuate drains and halts every installed pod other than the preparer,
+// concurrently since a termination notice gives little time. Work on pods
+// waits for it, and doesn't resume, since the node is leaving.
+func (p *Preparer) evacuate() {
+	p.workMu.Lock()
+	defer p.workMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, installed := range p.installedPods() {
+		if installed.pod.Id == constants.PreparerPodID {
+			continue
+		}
+		wg.Add(1)
+		go func(installed installedPod) {
+			defer wg.Done()
+			p.evacuatePod(installed.pod, installed.manifest, installed.logger)
+		}(installed)
+	}
+	wg.Wait()
+}
+
+func (p *Preparer) evacuatePod(pod *pods.Pod, podManifest manifest.Manifest, logger logging.Logger) {
+	pair := ManifestPair{
+		ID:           pod.Id,
+		Reality:      podManifest,
+		PodUniqueKey: pod.UniqueKey(),
+	}
+	logger.NoFields().Infoln("Halting pod on a leaving node")
+	success, err := pod.Halt(podManifest)
+	if err != nil {
+		logger.WithError(err).Errorln("Pod halt failed")
+	} else if !success {
+		logger.NoFields().Warnln("One or more launchables did not halt successfully")
+	}
+	p.PodEvents.Record(pair, podManifest, podevents.Halted, err, logger)
+}
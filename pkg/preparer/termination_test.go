@@ -0,0 +1,101 @@
+package preparer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/rc"
+)
+
+// fakeNotifier gives a termination notice once it has been checked noticeAt
+// times
+type fakeNotifier struct {
+	mu       sync.Mutex
+	checks   int
+	noticeAt int
+}
+
+func (f *fakeNotifier) TerminationNotice() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checks++
+	return f.checks >= f.noticeAt, nil
+}
+
+func (f *fakeNotifier) Checks() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.checks
+}
+
+func TestTerminationNoticeEvacuatesNode(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	notifier := &fakeNotifier{noticeAt: 3}
+	handler := NewTerminationHandler("node1", notifier, applicator, time.Millisecond, 0, logging.TestLogger())
+	evacuated := make(chan struct{}, 2)
+	handler.evacuate = func() {
+		Assert(t).IsTrue(handler.Leaving(), "should have been leaving before the pods were halted")
+		evacuated <- struct{}{}
+	}
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		handler.Run(quit)
+		close(done)
+	}()
+
+	select {
+	case <-evacuated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the node was not evacuated after a termination notice")
+	}
+	labeled, err := applicator.GetLabels(labels.NODE, "node1")
+	Assert(t).IsNil(err, "should have read the node's labels")
+	Assert(t).IsTrue(labeled.Labels.Has(rc.CordonLabel), "should have cordoned the node")
+	Assert(t).IsTrue(labeled.Labels.Has(rc.LeavingLabel), "should have labeled the node as leaving")
+
+	// the notice stays, but the node is only evacuated once
+	time.Sleep(10 * time.Millisecond)
+	Assert(t).AreEqual(notifier.Checks(), 3, "should have stopped checking for a notice once there was one")
+	Assert(t).AreEqual(len(evacuated), 0, "should only have evacuated the node once")
+
+	close(quit)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler did not quit")
+	}
+}
+
+func TestTerminationHandlerQuitsWithoutNotice(t *testing.T) {
+	notifier := &fakeNotifier{noticeAt: 1 << 30}
+	handler := NewTerminationHandler("node1", notifier, labels.NewFakeApplicator(), time.Millisecond, 0, logging.TestLogger())
+	handler.evacuate = func() {
+		t.Error("should not have evacuated the node without a notice")
+	}
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		handler.Run(quit)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(quit)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler did not quit")
+	}
+	Assert(t).IsFalse(handler.Leaving(), "should not be leaving without a notice")
+}
+
+func TestNilTerminationHandlerIsNotLeaving(t *testing.T) {
+	var handler *TerminationHandler
+	Assert(t).IsFalse(handler.Leaving(), "a nil handler should never be leaving")
+}
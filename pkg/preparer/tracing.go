@@ -0,0 +1,30 @@
+package preparer
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/tracing"
+)
+
+// tracer returns the tracer that deploys are recorded with, which is nil if
+// tracing isn't configured
+func (c *PreparerConfig) tracer(logger logging.Logger) (*tracing.Tracer, error) {
+	if c.TracingEndpoint == "" {
+		return nil, nil
+	}
+	client, err := c.GetClient(30 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	resource := map[string]string{
+		"service.name": "p2-preparer",
+		"host.name":    c.NodeName.String(),
+	}
+	exporter := tracing.NewOTLPExporter(client, c.TracingEndpoint, resource, logger.SubLogger(logrus.Fields{
+		"tracing_endpoint": c.TracingEndpoint,
+	}))
+	return tracing.NewTracer(exporter), nil
+}
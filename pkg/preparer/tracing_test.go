@@ -0,0 +1,130 @@
+package preparer
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/tracing"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *recordingExporter) Export(span tracing.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+func (r *recordingExporter) Close() {}
+
+func (r *recordingExporter) names() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for _, span := range r.spans {
+		names = append(names, span.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestPreparerTracesDeploys(t *testing.T) {
+	testPod := &TestPod{
+		launchSuccess: true,
+	}
+	newManifest := testManifest(t)
+	written := time.Now().Add(-time.Minute)
+	observed := written.Add(time.Second)
+	newPair := ManifestPair{
+		ID:              newManifest.ID(),
+		Intent:          newManifest,
+		IntentWriteTime: written,
+		Observed:        observed,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	exporter := &recordingExporter{}
+	p.tracer = tracing.NewTracer(exporter)
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "should have succeeded")
+
+	expected := strings.Join([]string{
+		"deploy",
+		"hooks_after_install",
+		"hooks_after_launch",
+		"hooks_before_install",
+		"hooks_before_launch",
+		"install",
+		"intent_receipt",
+		"launch",
+		"preflight",
+		"reality_write",
+		"verify_pod",
+		"wait_until_ready",
+	}, ",")
+	Assert(t).AreEqual(exporter.names(), expected, "should have traced each step of the deploy")
+
+	var root tracing.SpanData
+	for _, span := range exporter.spans {
+		if span.Name == "deploy" {
+			root = span
+		}
+	}
+	Assert(t).AreEqual(root.Start, observed, "the deploy should start when the intent was observed")
+	Assert(t).AreEqual(root.Attributes["pod_id"], newManifest.ID().String(), "should have recorded the pod")
+	Assert(t).AreEqual(root.Error, "", "the deploy succeeded")
+	for _, span := range exporter.spans {
+		Assert(t).AreEqual(span.TraceID, root.TraceID, fmt.Sprintf("%s should be part of the deploy's trace", span.Name))
+		if span.Name != "deploy" {
+			Assert(t).AreEqual(span.ParentSpanID, root.SpanID, fmt.Sprintf("%s should be a step of the deploy", span.Name))
+		}
+		if span.Name == "intent_receipt" {
+			Assert(t).AreEqual(span.Start, written, "intent receipt should start when the intent was written")
+			Assert(t).AreEqual(span.End, observed, "intent receipt should end when the intent was observed")
+		}
+	}
+	Assert(t).IsTrue(testPod.traceSpan != nil, "the pod should have been given the deploy's span")
+}
+
+func TestPreparerTracesFailedDeploys(t *testing.T) {
+	testPod := &TestPod{
+		installErr: fmt.Errorf("There was an error installing"),
+	}
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	exporter := &recordingExporter{}
+	p.tracer = tracing.NewTracer(exporter)
+
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsFalse(success, "should have failed")
+	Assert(t).AreEqual(exporter.names(), "deploy,hooks_before_install,install", "should have stopped tracing at the failed install")
+	for _, span := range exporter.spans {
+		if span.Name == "install" {
+			Assert(t).AreEqual(span.Error, testPod.installErr.Error(), "should have recorded why the install failed")
+		}
+		if span.Name == "deploy" {
+			Assert(t).IsTrue(span.Error != "", "the deploy should have failed")
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package preparer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/util/param"
+)
+
+// PodWorkConcurrency is how many pods the preparer works on at once
+var PodWorkConcurrency = param.Int("pod_work_concurrency", 8)
+
+const maximumBackoffTime = 1 * time.Minute
+
+// podWorkQueue hands out work on the node's pods to a pool of workers. A pod
+// is only worked on by one worker at a time, and work added for a pod that
+// already has work pending replaces it, so that a pod is worked on for the
+// latest pair only, however many times the pair was sent.
+//
+// Work that fails is retried with an exponential backoff, unless a pair with
+// a different manifest is added in the meantime, which is worked on right
+// away.
+type podWorkQueue struct {
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// The latest pair of each pod with work pending
+	pending map[podWorkerID]ManifestPair
+
+	// Pods with pending work that can be worked on, in the order their
+	// work was added
+	ready []podWorkerID
+
+	// Pods being worked on, and the pairs they are worked on for. Work
+	// added for them is pending until the work in progress is done.
+	active map[podWorkerID]ManifestPair
+
+	// When each ready pod became ready, and the timer that the wait for a
+	// worker is recorded in
+	readyAt map[podWorkerID]time.Time
+	lag     metrics.Timer
+
+	// The retries scheduled for pods whose work failed, and how long the
+	// next failure of each will wait
+	retries map[podWorkerID]*scheduledRetry
+	backoff map[podWorkerID]time.Duration
+
+	// The SHA of each pod's latest manifest, and when it was first added,
+	// for propagation tracing
+	seen map[podWorkerID]seenSHA
+
+	closed bool
+}
+
+type scheduledRetry struct {
+	timer *time.Timer
+}
+
+type seenSHA struct {
+	sha string
+	at  time.Time
+}
+
+func newPodWorkQueue() *podWorkQueue {
+	q := &podWorkQueue{
+		minBackoff: minimumBackoffTime,
+		maxBackoff: maximumBackoffTime,
+		pending:    make(map[podWorkerID]ManifestPair),
+		active:     make(map[podWorkerID]ManifestPair),
+		readyAt:    make(map[podWorkerID]time.Time),
+		lag:        metrics.NilTimer{},
+		retries:    make(map[podWorkerID]*scheduledRetry),
+		backoff:    make(map[podWorkerID]time.Duration),
+		seen:       make(map[podWorkerID]seenSHA),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Add queues work on the pair's pod, replacing any work pending for it
+func (q *podWorkQueue) Add(pair ManifestPair) {
+	id := pairWorkerID(pair)
+	sha := pairSHA(pair)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+
+	seen, ok := q.seen[id]
+	changed := !ok || seen.sha != sha
+	if changed {
+		seen = seenSHA{sha: sha, at: time.Now()}
+		q.seen[id] = seen
+	}
+	pair.Observed = seen.at
+
+	previous, pending := q.pending[id]
+	if pending && previous.Reinstall && !changed {
+		// a forced reinstall isn't undone by the watch sending the pair
+		// again
+		pair.Reinstall = true
+	}
+	q.pending[id] = pair
+	if _, active := q.active[id]; active {
+		return
+	}
+	if retry, retrying := q.retries[id]; retrying {
+		if !changed {
+			return
+		}
+		// a new manifest isn't held up by the failures of the last one
+		retry.timer.Stop()
+		delete(q.retries, id)
+		delete(q.backoff, id)
+		pending = false
+	}
+	if !pending {
+		q.makeReady(id)
+	}
+}
+
+// Get waits for a pod with work that no other worker is doing, and returns
+// its pair. It returns false once the queue is closed.
+func (q *podWorkQueue) Get() (ManifestPair, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.ready) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return ManifestPair{}, false
+	}
+
+	id := q.ready[0]
+	q.ready = q.ready[1:]
+	q.lag.UpdateSince(q.readyAt[id])
+	delete(q.readyAt, id)
+	pair := q.pending[id]
+	delete(q.pending, id)
+	q.active[id] = pair
+	return pair, true
+}
+
+// Done marks the work on the pair returned by Get as finished. If it failed
+// and no newer work was added for the pod, the pair is retried after a
+// backoff.
+func (q *podWorkQueue) Done(pair ManifestPair, ok bool) {
+	id := pairWorkerID(pair)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.active, id)
+	if q.closed {
+		return
+	}
+
+	newer, pending := q.pending[id]
+	if ok || (pending && pairSHA(newer) != pairSHA(pair)) {
+		delete(q.backoff, id)
+		if ok && pair.Intent == nil && !pending {
+			// the pod was removed
+			delete(q.seen, id)
+		}
+		if pending {
+			q.makeReady(id)
+		}
+		return
+	}
+
+	if !pending {
+		q.pending[id] = pair
+	}
+	backoff, backingOff := q.backoff[id]
+	if !backingOff {
+		backoff = q.minBackoff
+	}
+	next := backoff * 2
+	if next > q.maxBackoff {
+		next = q.maxBackoff
+	}
+	q.backoff[id] = next
+	retry := &scheduledRetry{}
+	retry.timer = time.AfterFunc(backoff, func() {
+		q.retry(id, retry)
+	})
+	q.retries[id] = retry
+}
+
+func (q *podWorkQueue) retry(id podWorkerID, retry *scheduledRetry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.retries[id] != retry || q.closed {
+		// superseded by new work
+		return
+	}
+	delete(q.retries, id)
+	q.makeReady(id)
+}
+
+// makeReady hands the pod's pending work to the next worker to call Get
+func (q *podWorkQueue) makeReady(id podWorkerID) {
+	q.ready = append(q.ready, id)
+	q.readyAt[id] = time.Now()
+	q.cond.Signal()
+}
+
+// The states of work on a pod
+const (
+	WorkInProgress = "in_progress"
+	// Waiting for a worker
+	WorkReady = "ready"
+	// Waiting for the work in progress on the same pod to finish
+	WorkWaiting = "waiting"
+	// Waiting to be retried after a failure
+	WorkRetrying = "retrying"
+)
+
+// queuedWork is a pair that work is in progress or pending for
+type queuedWork struct {
+	pair  ManifestPair
+	state string
+}
+
+// Snapshot returns the work in progress and the work pending, ordered by pod
+func (q *podWorkQueue) Snapshot() []queuedWork {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ready := make(map[podWorkerID]bool, len(q.ready))
+	for _, id := range q.ready {
+		ready[id] = true
+	}
+
+	var work []queuedWork
+	for _, pair := range q.active {
+		work = append(work, queuedWork{pair: pair, state: WorkInProgress})
+	}
+	for id, pair := range q.pending {
+		state := WorkWaiting
+		if ready[id] {
+			state = WorkReady
+		} else if _, retrying := q.retries[id]; retrying {
+			state = WorkRetrying
+		}
+		work = append(work, queuedWork{pair: pair, state: state})
+	}
+	sort.Sort(queuedWorkByPod(work))
+	return work
+}
+
+type queuedWorkByPod []queuedWork
+
+func (w queuedWorkByPod) Len() int      { return len(w) }
+func (w queuedWorkByPod) Swap(i, j int) { w[i], w[j] = w[j], w[i] }
+func (w queuedWorkByPod) Less(i, j int) bool {
+	a, b := pairWorkerID(w[i].pair).String(), pairWorkerID(w[j].pair).String()
+	if a != b {
+		return a < b
+	}
+	// the work in progress on a pod comes before the work waiting for it
+	return w[i].state == WorkInProgress && w[j].state != WorkInProgress
+}
+
+// Close drops all pending work and makes every call to Get return false
+func (q *podWorkQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	for _, retry := range q.retries {
+		retry.timer.Stop()
+	}
+	q.cond.Broadcast()
+}
+
+func pairWorkerID(pair ManifestPair) podWorkerID {
+	return podWorkerID{
+		podID:        pair.ID,
+		podUniqueKey: pair.PodUniqueKey,
+	}
+}
+
+// pairSHA returns the SHA of the manifest that work on the pair deploys, or of
+// the one it removes
+func pairSHA(pair ManifestPair) string {
+	var sha string
+	// TODO: handle errors appropriately from SHA().
+	if pair.Intent != nil {
+		sha, _ = pair.Intent.SHA()
+	} else if pair.Reality != nil {
+		sha, _ = pair.Reality.SHA()
+	}
+	return sha
+}
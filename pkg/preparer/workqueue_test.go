@@ -0,0 +1,199 @@
+package preparer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+func workQueuePair(podID types.PodID, version string) ManifestPair {
+	builder := manifest.NewBuilder()
+	builder.SetID(podID)
+	builder.SetConfig(map[interface{}]interface{}{"version": version})
+	return ManifestPair{ID: podID, Intent: builder.GetManifest()}
+}
+
+// getWithin returns the next pair from the queue, or false if there is none
+// within the timeout
+func getWithin(q *podWorkQueue, timeout time.Duration) (ManifestPair, bool) {
+	got := make(chan ManifestPair, 1)
+	go func() {
+		pair, ok := q.Get()
+		if ok {
+			got <- pair
+		}
+	}()
+	select {
+	case pair := <-got:
+		return pair, true
+	case <-time.After(timeout):
+		// unblock the getter
+		q.Close()
+		return ManifestPair{}, false
+	}
+}
+
+func TestWorkQueueCollapsesPendingWork(t *testing.T) {
+	q := newPodWorkQueue()
+	defer q.Close()
+
+	q.Add(workQueuePair("web", "1"))
+	q.Add(workQueuePair("db", "1"))
+	q.Add(workQueuePair("web", "2"))
+
+	first, _ := q.Get()
+	second, _ := q.Get()
+	Assert(t).AreEqual(first.ID, types.PodID("web"), "pods should be worked on in the order their work was added")
+	Assert(t).AreEqual(pairSHA(first), pairSHA(workQueuePair("web", "2")), "should have worked on the latest pair of the pod")
+	Assert(t).AreEqual(second.ID, types.PodID("db"), "should have handed out the other pod")
+
+	_, ok := getWithin(q, 50*time.Millisecond)
+	Assert(t).IsFalse(ok, "duplicate work should have been collapsed")
+}
+
+func TestWorkQueueSerializesWorkOnAPod(t *testing.T) {
+	q := newPodWorkQueue()
+	defer q.Close()
+
+	q.Add(workQueuePair("web", "1"))
+	working, _ := q.Get()
+	q.Add(workQueuePair("web", "2"))
+	q.Add(workQueuePair("db", "1"))
+
+	other, _ := q.Get()
+	Assert(t).AreEqual(other.ID, types.PodID("db"), "other pods should be worked on while a pod is busy")
+
+	q.Done(working, true)
+	next, ok := getWithin(q, time.Second)
+	Assert(t).IsTrue(ok, "the pod's pending work should have been handed out once its work was done")
+	Assert(t).AreEqual(pairSHA(next), pairSHA(workQueuePair("web", "2")), "should have handed out the pair added while the pod was busy")
+}
+
+func TestWorkQueueRetriesFailedWork(t *testing.T) {
+	q := newPodWorkQueue()
+	q.minBackoff = 10 * time.Millisecond
+	defer q.Close()
+
+	q.Add(workQueuePair("web", "1"))
+	failed, _ := q.Get()
+	q.Done(failed, false)
+	// resent by the watch, it waits for the retry
+	q.Add(workQueuePair("web", "1"))
+
+	start := time.Now()
+	retried, ok := getWithin(q, time.Second)
+	Assert(t).IsTrue(ok, "failed work should have been retried")
+	Assert(t).IsTrue(time.Since(start) >= q.minBackoff, "the retry should have waited for the backoff")
+	Assert(t).AreEqual(pairSHA(retried), pairSHA(failed), "should have retried the same manifest")
+	q.mu.Lock()
+	backoff := q.backoff[pairWorkerID(retried)]
+	q.mu.Unlock()
+	Assert(t).AreEqual(backoff, 2*q.minBackoff, "the next retry should back off for longer")
+}
+
+func TestWorkQueueDoesNotHoldUpNewManifestsOfFailingPods(t *testing.T) {
+	q := newPodWorkQueue()
+	q.minBackoff = time.Hour
+	defer q.Close()
+
+	q.Add(workQueuePair("web", "1"))
+	failed, _ := q.Get()
+	q.Done(failed, false)
+	q.Add(workQueuePair("web", "2"))
+
+	next, ok := getWithin(q, time.Second)
+	Assert(t).IsTrue(ok, "a new manifest should have been handed out without waiting for the retry")
+	Assert(t).AreEqual(pairSHA(next), pairSHA(workQueuePair("web", "2")), "should have handed out the new manifest")
+}
+
+func TestWorkQueueRecordsWhenManifestWasFirstSeen(t *testing.T) {
+	q := newPodWorkQueue()
+	defer q.Close()
+
+	q.Add(workQueuePair("web", "1"))
+	first, _ := q.Get()
+	q.Done(first, true)
+	time.Sleep(time.Millisecond)
+	q.Add(workQueuePair("web", "1"))
+	again, _ := q.Get()
+	Assert(t).AreEqual(again.Observed, first.Observed, "a resent manifest should keep the time it was first seen")
+}
+
+func TestWorkQueueClose(t *testing.T) {
+	q := newPodWorkQueue()
+	closed := make(chan bool)
+	go func() {
+		_, ok := q.Get()
+		closed <- ok
+	}()
+	q.Close()
+	select {
+	case ok := <-closed:
+		Assert(t).IsFalse(ok, "Get should have returned false once the queue was closed")
+	case <-time.After(time.Second):
+		t.Fatal("Get did not return after the queue was closed")
+	}
+}
+
+func TestWorkQueueRecordsLag(t *testing.T) {
+	q := newPodWorkQueue()
+	q.lag = metrics.NewTimer()
+	defer q.Close()
+
+	q.Add(workQueuePair("web", "1"))
+	q.Add(workQueuePair("db", "1"))
+	q.Get()
+	Assert(t).AreEqual(q.lag.Count(), int64(1), "should have recorded how long the work waited for a worker")
+	q.Get()
+	Assert(t).AreEqual(q.lag.Count(), int64(2), "should have recorded the wait of each piece of work")
+}
+
+func TestWorkQueueSnapshot(t *testing.T) {
+	q := newPodWorkQueue()
+	q.minBackoff = time.Hour
+	defer q.Close()
+
+	q.Add(workQueuePair("web", "1"))
+	working, _ := q.Get()
+	q.Add(workQueuePair("web", "2"))
+	q.Add(workQueuePair("db", "1"))
+	failed, _ := q.Get()
+	q.Done(failed, false)
+	q.Add(workQueuePair("cache", "1"))
+
+	var states []string
+	for _, work := range q.Snapshot() {
+		states = append(states, fmt.Sprintf("%s:%s", work.pair.ID, work.state))
+	}
+	Assert(t).AreEqual(
+		strings.Join(states, ","),
+		"cache:ready,db:retrying,web:in_progress,web:waiting",
+		"should have listed the work in progress and pending",
+	)
+	q.Done(working, true)
+}
+
+func TestWorkQueueKeepsRequestedReinstalls(t *testing.T) {
+	q := newPodWorkQueue()
+	defer q.Close()
+
+	q.Add(workQueuePair("web", "1"))
+	working, _ := q.Get()
+	reinstall := workQueuePair("web", "1")
+	reinstall.Reinstall = true
+	q.Add(reinstall)
+	// resent by the watch while the pod is busy
+	q.Add(workQueuePair("web", "1"))
+	q.Done(working, true)
+
+	next, ok := getWithin(q, time.Second)
+	Assert(t).IsTrue(ok, "the reinstall should have been handed out")
+	Assert(t).IsTrue(next.Reinstall, "the pair resent by the watch should not have undone the reinstall")
+}
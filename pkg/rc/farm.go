@@ -12,6 +12,7 @@ import (
 
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/disruption"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	p2metrics "github.com/square/p2/pkg/metrics"
@@ -26,6 +27,14 @@ import (
 	"github.com/rcrowley/go-metrics"
 )
 
+// A newly locked RC is fetched a few times if consul is unavailable before
+// the farm gives it up for another farm to try
+var rcFetchRetryPolicy = consulutil.RetryPolicy{
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	MaxAttempts:    3,
+}
+
 // subset of labels.Applicator
 type Labeler interface {
 	SetLabelsTxn(ctx context.Context, labelType labels.Type, id string, labels map[string]string) error
@@ -88,6 +97,7 @@ type Farm struct {
 
 	logger     logging.Logger
 	alerter    alerting.Alerter
+	budgets    disruption.Enforcer
 	rcSelector klabels.Selector
 
 	// The length of time to wait between a watch returning and initiating
@@ -117,6 +127,7 @@ func NewFarm(
 	rcSelector klabels.Selector,
 	alerter alerting.Alerter,
 	rcWatchPauseTime time.Duration,
+	budgets disruption.Enforcer,
 ) *Farm {
 	if alerter == nil {
 		alerter = alerting.NewNop()
@@ -135,6 +146,7 @@ func NewFarm(
 		logger:           logger,
 		children:         make(map[fields.ID]childRC),
 		alerter:          alerter,
+		budgets:          budgets,
 		rcSelector:       rcSelector,
 		rcWatchPauseTime: rcWatchPauseTime,
 	}
@@ -258,7 +270,12 @@ START_LOOP:
 				// values.  Also it probably doesn't matter
 				// much since we won't actually be doing a
 				// fetch that often (only when lock not held)
-				rc, err := rcf.rcStore.Get(rcKey.ID)
+				var rc fields.RC
+				err = consulutil.Retry(quit, rcFetchRetryPolicy, func() error {
+					var err error
+					rc, err = rcf.rcStore.Get(rcKey.ID)
+					return err
+				})
 				if err != nil {
 					rcLogger.WithError(err).Error("unable to fetch RC to process it")
 
@@ -279,6 +296,7 @@ START_LOOP:
 					rcf.labeler,
 					rcLogger,
 					rcf.alerter,
+					rcf.budgets,
 				)
 				childQuit := make(chan struct{})
 				rcf.children[rcKey.ID] = childRC{
@@ -2,6 +2,7 @@ package fields
 
 import (
 	"encoding/json"
+	"fmt"
 	"sort"
 
 	"k8s.io/kubernetes/pkg/labels"
@@ -49,6 +50,61 @@ type RC struct {
 
 	// When disabled, this controller will not make any scheduling changes
 	Disabled bool
+
+	// Strategy determines which of the eligible nodes are scheduled on, and
+	// which of the current nodes are unscheduled from
+	Strategy Strategy
+}
+
+// The node selection strategies of an RC
+const (
+	// DefaultStrategy schedules on nodes in order of their names
+	DefaultStrategy = ""
+	// SpreadStrategy schedules on the failure domains with the fewest of
+	// the RC's nodes first, and unschedules from those with the most
+	SpreadStrategy = "spread"
+	// PackStrategy schedules on the failure domains with the most of the
+	// RC's nodes first, and unschedules from those with the fewest
+	PackStrategy = "pack"
+	// RandomStrategy schedules on randomly chosen nodes
+	RandomStrategy = "random"
+)
+
+// Strategy is how an RC picks nodes
+type Strategy struct {
+	// Type is one of the strategy constants
+	Type string `json:"type,omitempty"`
+	// Label is the node label whose values are the failure domains for the
+	// spread and pack strategies, e.g. "rack" or "availability_zone". Nodes
+	// without the label are in a failure domain of their own.
+	Label string `json:"label,omitempty"`
+}
+
+// Validate returns an error if the strategy is unknown or is missing its label
+func (s Strategy) Validate() error {
+	switch s.Type {
+	case DefaultStrategy, RandomStrategy:
+		return nil
+	case SpreadStrategy, PackStrategy:
+		if s.Label == "" {
+			return util.Errorf("The %s strategy requires a node label", s.Type)
+		}
+		return nil
+	default:
+		return util.Errorf("Unknown strategy %q, expected one of %q, %q or %q", s.Type, SpreadStrategy, PackStrategy, RandomStrategy)
+	}
+}
+
+// String describes the strategy, e.g. "spread by rack"
+func (s Strategy) String() string {
+	switch {
+	case s.Type == DefaultStrategy:
+		return "default"
+	case s.Label != "":
+		return s.Type + " by " + s.Label
+	default:
+		return s.Type
+	}
 }
 
 // RawRC defines the JSON format used to store data into Consul. It should only be used
@@ -63,8 +119,9 @@ type RawRC struct {
 	// zero-count indicating the RC handler should remove any and all pods
 	// from a case (for instance if the json key was changed) where golang
 	// is defaulting to the 0 value
-	ReplicasDesired *int `json:"replicas_desired"`
-	Disabled        bool `json:"disabled"`
+	ReplicasDesired *int      `json:"replicas_desired"`
+	Disabled        bool      `json:"disabled"`
+	Strategy        *Strategy `json:"strategy,omitempty"`
 }
 
 // MarshalJSON implements the json.Marshaler interface for serializing the RC to JSON
@@ -101,6 +158,11 @@ func (rc RC) ToRaw() (RawRC, error) {
 		nodeSel = rc.NodeSelector.String()
 	}
 
+	var strategy *Strategy
+	if rc.Strategy != (Strategy{}) {
+		strategy = &rc.Strategy
+	}
+
 	return RawRC{
 		ID:              rc.ID,
 		Manifest:        string(manifest),
@@ -108,6 +170,7 @@ func (rc RC) ToRaw() (RawRC, error) {
 		PodLabels:       rc.PodLabels,
 		ReplicasDesired: &rc.ReplicasDesired,
 		Disabled:        rc.Disabled,
+		Strategy:        strategy,
 	}, nil
 }
 
@@ -147,11 +210,57 @@ func (rc *RC) UnmarshalJSON(b []byte) error {
 		ReplicasDesired: *rawRC.ReplicasDesired,
 		Disabled:        rawRC.Disabled,
 	}
+	if rawRC.Strategy != nil {
+		rc.Strategy = *rawRC.Strategy
+	}
 	return nil
 }
 
 var _ json.Unmarshaler = &RC{}
 
+// Diff describes how other differs from rc, one line per field, e.g.
+// "replicas_desired: 3 -> 5". Manifests are compared by their SHAs. Returns
+// nil if they don't differ.
+func (rc RC) Diff(other RC) ([]string, error) {
+	var diff []string
+	change := func(field string, from, to interface{}) {
+		from, to = fmt.Sprint(from), fmt.Sprint(to)
+		if from != to {
+			diff = append(diff, fmt.Sprintf("%s: %q -> %q", field, from, to))
+		}
+	}
+
+	fromSHA, err := manifestSHA(rc.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	toSHA, err := manifestSHA(other.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	change("manifest", fromSHA, toSHA)
+	change("node_selector", selectorString(rc.NodeSelector), selectorString(other.NodeSelector))
+	change("pod_labels", rc.PodLabels.String(), other.PodLabels.String())
+	change("replicas_desired", rc.ReplicasDesired, other.ReplicasDesired)
+	change("disabled", rc.Disabled, other.Disabled)
+	change("strategy", rc.Strategy, other.Strategy)
+	return diff, nil
+}
+
+func manifestSHA(m manifest.Manifest) (string, error) {
+	if m == nil {
+		return "", nil
+	}
+	return m.SHA()
+}
+
+func selectorString(selector labels.Selector) string {
+	if selector == nil {
+		return ""
+	}
+	return selector.String()
+}
+
 // Implements sort.Interface to make a list of ids sortable lexicographically
 type IDs []ID
 
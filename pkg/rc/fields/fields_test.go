@@ -17,6 +17,7 @@ func TestJSONMarshal(t *testing.T) {
 		ID:              "hello",
 		Manifest:        m,
 		ReplicasDesired: 2,
+		Strategy:        Strategy{Type: SpreadStrategy, Label: "rack"},
 	}
 
 	b, err := json.Marshal(&rc1)
@@ -28,6 +29,7 @@ func TestJSONMarshal(t *testing.T) {
 	Assert(t).IsNil(err, "should have unmarshaled")
 	Assert(t).AreEqual(rc1.ID, rc2.ID, "RC ID changed when serialized")
 	Assert(t).AreEqual(rc1.Manifest.ID(), rc2.Manifest.ID(), "Manifest ID changed when serialized")
+	Assert(t).AreEqual(rc1.Strategy, rc2.Strategy, "Strategy changed when serialized")
 }
 
 func TestZeroUnmarshal(t *testing.T) {
@@ -10,6 +10,7 @@ import (
 	klabels "k8s.io/kubernetes/pkg/labels"
 
 	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/disruption"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
@@ -86,6 +87,10 @@ type replicationController struct {
 	scheduler     scheduler.Scheduler
 	podApplicator Labeler
 	alerter       alerting.Alerter
+
+	// budgets limits which pods may be unscheduled when scaling down. It
+	// may be nil, in which case no disruption budgets are enforced.
+	budgets disruption.Enforcer
 }
 
 type ReplicationControllerWatcher interface {
@@ -102,6 +107,7 @@ func New(
 	podApplicator Labeler,
 	logger logging.Logger,
 	alerter alerting.Alerter,
+	budgets disruption.Enforcer,
 ) ReplicationController {
 	if alerter == nil {
 		alerter = alerting.NewNop()
@@ -118,6 +124,7 @@ func New(
 		scheduler:     scheduler,
 		podApplicator: podApplicator,
 		alerter:       alerter,
+		budgets:       budgets,
 	}
 }
 
@@ -184,15 +191,26 @@ func (rc *replicationController) meetDesires() error {
 
 	rc.logger.NoFields().Infof("Currently on nodes %s", current)
 
+	// the pods on leaving nodes will soon be gone with their nodes, so they
+	// are replaced on other nodes and aren't counted
+	leaving, err := rc.leavingNodes(current.Nodes())
+	if err != nil {
+		return err
+	}
+	counted := len(current) - leaving.Len()
+	if leaving.Len() > 0 {
+		rc.logger.NoFields().Infof("Not counting the pods on leaving nodes %s", leaving.ListNodes())
+	}
+
 	nodesChanged := false
-	if rc.ReplicasDesired > len(current) {
-		err := rc.addPods(current)
+	if rc.ReplicasDesired > counted {
+		err := rc.addPods(current, rc.ReplicasDesired-counted)
 		if err != nil {
 			return err
 		}
 		nodesChanged = true
-	} else if len(current) > rc.ReplicasDesired {
-		err := rc.removePods(current)
+	} else if counted > rc.ReplicasDesired {
+		err := rc.removePods(current, leaving)
 		if err != nil {
 			return err
 		}
@@ -211,7 +229,7 @@ func (rc *replicationController) meetDesires() error {
 	return rc.ensureConsistency(current)
 }
 
-func (rc *replicationController) addPods(current types.PodLocations) error {
+func (rc *replicationController) addPods(current types.PodLocations, toSchedule int) error {
 	currentNodes := current.Nodes()
 	eligible, err := rc.eligibleNodes()
 	if err != nil {
@@ -223,10 +241,12 @@ func (rc *replicationController) addPods(current types.PodLocations) error {
 	possible := types.NewNodeSet(eligible...).Difference(types.NewNodeSet(currentNodes...))
 
 	// Users want deterministic ordering of nodes being populated to a new
-	// RC. Move nodes in sorted order by hostname to achieve this
-	possibleSorted := possible.ListNodes()
-	toSchedule := rc.ReplicasDesired - len(currentNodes)
-
+	// RC. Move nodes in sorted order by hostname to achieve this, unless
+	// the RC's strategy orders them otherwise
+	possibleSorted, err := rc.scheduleOrder(possible.ListNodes(), currentNodes)
+	if err != nil {
+		return err
+	}
 	rc.logger.NoFields().Infof("Need to schedule %d nodes out of %s", toSchedule, possible)
 
 	txn, cancelFunc := rc.newAuditingTransaction(context.Background(), currentNodes)
@@ -320,25 +340,45 @@ func (rc *replicationController) alertInfo(msg string) alerting.AlertInfo {
 	}
 }
 
-func (rc *replicationController) removePods(current types.PodLocations) error {
+// removePods unschedules the pods that the RC has more of than it desires,
+// other than those on leaving nodes, which aren't counted
+func (rc *replicationController) removePods(current types.PodLocations, leaving types.NodeSet) error {
 	currentNodes := current.Nodes()
 	eligible, err := rc.eligibleNodes()
 	if err != nil {
 		return err
 	}
+	counted := types.NewNodeSet(currentNodes...).Difference(leaving)
 
 	// If we need to downsize the number of nodes, prefer any in current that are not eligible anymore.
 	// TODO: evaluate changes to 'eligible' more frequently
-	preferred := types.NewNodeSet(currentNodes...).Difference(types.NewNodeSet(eligible...))
-	rest := types.NewNodeSet(currentNodes...).Difference(preferred)
-	toUnschedule := len(current) - rc.ReplicasDesired
+	preferred := counted.Difference(types.NewNodeSet(eligible...))
+	// the rest are unscheduled from in the order of the RC's strategy
+	rest, err := rc.unscheduleOrder(counted.Difference(preferred).ListNodes())
+	if err != nil {
+		return err
+	}
+	toUnschedule := counted.Len() - rc.ReplicasDesired
 	rc.logger.NoFields().Infof("Need to unschedule %d nodes out of %s", toUnschedule, current)
 
+	candidates := preferred.ListNodes()
+	candidates = append(candidates, rest...)
+	// This should be mathematically impossible unless replicasDesired was
+	// negative. Unschedule what we can and then report the shortfall.
+	short := len(candidates) < toUnschedule
+	if short {
+		toUnschedule = len(candidates)
+	}
+	unscheduleFrom, err := rc.withinBudgets(candidates, toUnschedule)
+	if err != nil {
+		return err
+	}
+
 	txn, cancelFunc := rc.newAuditingTransaction(context.Background(), currentNodes)
 	defer func() {
 		cancelFunc()
 	}()
-	for i := 0; i < toUnschedule; i++ {
+	for i, node := range unscheduleFrom {
 		// create a new context for every 5 nodes. This is done to make
 		// sure we're safely under the 64 operation limit imposed by
 		// consul on transactions. This shouldn't be necessary after
@@ -356,28 +396,7 @@ func (rc *replicationController) removePods(current types.PodLocations) error {
 			txn, cancelFunc = rc.newAuditingTransaction(context.Background(), txn.Nodes())
 		}
 
-		unscheduleFrom, ok := preferred.PopAny()
-		if !ok {
-			var ok bool
-			unscheduleFrom, ok = rest.PopAny()
-			if !ok {
-				// This should be mathematically impossible unless replicasDesired was negative
-				// commit any queued operations
-				ok, resp, txnErr := txn.Commit(rc.txner)
-				switch {
-				case txnErr != nil:
-					return txnErr
-				case !ok:
-					return util.Errorf("could not schedule pods due to transaction violation: %s", transaction.TxnErrorsToString(resp.Errors))
-				}
-
-				return util.Errorf(
-					"Unable to unschedule enough nodes to meet replicas desired: %d replicas desired, %d current.",
-					rc.ReplicasDesired, len(current),
-				)
-			}
-		}
-		err := rc.unschedule(txn, unscheduleFrom)
+		err := rc.unschedule(txn, node)
 		if err != nil {
 			return err
 		}
@@ -391,9 +410,41 @@ func (rc *replicationController) removePods(current types.PodLocations) error {
 		return util.Errorf("could not schedule pods due to transaction violation: %s", transaction.TxnErrorsToString(resp.Errors))
 	}
 
+	if short {
+		return util.Errorf(
+			"Unable to unschedule enough nodes to meet replicas desired: %d replicas desired, %d current.",
+			rc.ReplicasDesired, len(current),
+		)
+	}
 	return nil
 }
 
+// withinBudgets returns up to n of the candidate nodes, in order, that can be
+// unscheduled from without violating a disruption budget. The rest are left
+// until the RC next tries to meet its desires, by which time more of its pods
+// may be healthy.
+func (rc *replicationController) withinBudgets(candidates []types.NodeName, n int) ([]types.NodeName, error) {
+	if rc.budgets == nil {
+		return candidates[:n], nil
+	}
+
+	rc.mu.Lock()
+	podID := rc.Manifest.ID()
+	rc.mu.Unlock()
+	pods := make(types.PodLocations, len(candidates))
+	for i, node := range candidates {
+		pods[i] = types.PodLocation{Node: node, PodID: podID}
+	}
+	removable, err := rc.budgets.Removable(pods, n)
+	if err != nil {
+		return nil, util.Errorf("Could not check disruption budgets: %s", err)
+	}
+	if len(removable) < n {
+		rc.logger.NoFields().Infof("Disruption budgets allow unscheduling only %d of %d nodes", len(removable), n)
+	}
+	return removable.Nodes(), nil
+}
+
 func (rc *replicationController) ensureConsistency(current types.PodLocations) error {
 	rc.mu.Lock()
 	manifest := rc.Manifest
@@ -458,13 +509,20 @@ func (rc *replicationController) ensureConsistency(current types.PodLocations) e
 	return nil
 }
 
+// eligibleNodes returns the nodes that the scheduler allows the RC to use,
+// other than cordoned nodes and those with taints that its manifest doesn't
+// tolerate
 func (rc *replicationController) eligibleNodes() ([]types.NodeName, error) {
 	rc.mu.Lock()
 	manifest := rc.Manifest
 	nodeSelector := rc.NodeSelector
 	rc.mu.Unlock()
 
-	return rc.scheduler.EligibleNodes(manifest, nodeSelector)
+	eligible, err := rc.scheduler.EligibleNodes(manifest, nodeSelector)
+	if err != nil {
+		return nil, err
+	}
+	return rc.schedulable(eligible, manifest.GetTolerations())
 }
 
 // CurrentPods returns all pods managed by an RC with the given ID.
@@ -110,6 +110,7 @@ func setup(t *testing.T) (
 		applicator,
 		logging.DefaultLogger,
 		alerter,
+		nil,
 	).(*replicationController)
 
 	return
@@ -502,6 +503,179 @@ func TestPreferUnscheduleIneligible(t *testing.T) {
 	Assert(t).AreEqual(len(alerter.Alerts), 0, "expected no alerts to fire")
 }
 
+func TestStrategiesOrderNodesByFailureDomain(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	racks := map[types.NodeName]string{
+		"a1": "rack-a", "a2": "rack-a", "a3": "rack-a",
+		"b1": "rack-b", "b2": "rack-b",
+		"c1": "rack-c",
+	}
+	for node, rack := range racks {
+		Assert(t).IsNil(applicator.SetLabel(labels.NODE, node.String(), "rack", rack), "test setup: could not label node")
+	}
+	rc := &replicationController{podApplicator: applicator}
+	rc.NodeSelector = klabels.Everything()
+	rc.Strategy = fields.Strategy{Type: fields.SpreadStrategy, Label: "rack"}
+
+	possible := []types.NodeName{"a2", "a3", "b1", "b2", "c1"}
+	ordered, err := rc.scheduleOrder(possible, []types.NodeName{"a1"})
+	Assert(t).IsNil(err, "should have ordered the nodes")
+	Assert(t).AreEqual(fmt.Sprint(ordered), "[b1 c1 a2 b2 a3]", "should have spread the nodes across racks")
+
+	unordered, err := rc.unscheduleOrder([]types.NodeName{"a1", "a2", "b1", "c1"})
+	Assert(t).IsNil(err, "should have ordered the nodes")
+	Assert(t).AreEqual(unordered[0], types.NodeName("a1"), "should have unscheduled from the most crowded rack first")
+
+	rc.Strategy = fields.Strategy{Type: fields.PackStrategy, Label: "rack"}
+	ordered, err = rc.scheduleOrder(possible, []types.NodeName{"a1"})
+	Assert(t).IsNil(err, "should have ordered the nodes")
+	Assert(t).AreEqual(fmt.Sprint(ordered[:3]), "[a2 a3 b1]", "should have packed the nodes into racks")
+
+	rc.Strategy = fields.Strategy{}
+	ordered, err = rc.scheduleOrder(possible, nil)
+	Assert(t).IsNil(err, "should have ordered the nodes")
+	Assert(t).AreEqual(fmt.Sprint(ordered), fmt.Sprint(possible), "should have kept the nodes sorted by default")
+
+	Assert(t).IsNotNil(fields.Strategy{Type: fields.SpreadStrategy}.Validate(), "spreading should require a label")
+}
+
+func TestTaintedNodesNeedTolerations(t *testing.T) {
+	_, _, applicator, rc, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	for _, node := range []string{"node1", "node2", "node3"} {
+		err := applicator.SetLabel(labels.NODE, node, "nodeQuality", "good")
+		Assert(t).IsNil(err, "expected no error labeling node")
+	}
+	err := applicator.SetLabel(labels.NODE, "node2", TaintLabelPrefix+"maintenance", "true")
+	Assert(t).IsNil(err, "expected no error tainting node2")
+	err = applicator.SetLabel(labels.NODE, "node3", TaintLabelPrefix+"dedicated", "db")
+	Assert(t).IsNil(err, "expected no error tainting node3")
+
+	rc.ReplicasDesired = 3
+	err = rc.meetDesires()
+	Assert(t).IsNotNil(err, "expected an error since the tainted nodes aren't eligible")
+	scheduled := scheduledPods(t, applicator)
+	Assert(t).AreEqual(len(scheduled), 1, "expected only the untainted node to be scheduled")
+	Assert(t).AreEqual(scheduled[0].ID, "node1/testPod", "expected the untainted node to be scheduled")
+
+	builder := rc.Manifest.GetBuilder()
+	builder.SetTolerations([]manifest.Toleration{{Key: "dedicated", Value: "db"}})
+	rc.Manifest = builder.GetManifest()
+	err = rc.meetDesires()
+	Assert(t).IsNotNil(err, "expected an error since the node under maintenance isn't eligible")
+	scheduled = scheduledPods(t, applicator)
+	Assert(t).AreEqual(len(scheduled), 2, "expected the tolerated node to be scheduled")
+	for _, pod := range scheduled {
+		Assert(t).AreNotEqual(pod.ID, "node2/testPod", "expected the node under maintenance not to be scheduled")
+	}
+}
+
+func TestCordonedNodesAreUnscheduledFirst(t *testing.T) {
+	_, _, applicator, rc, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	for _, node := range []string{"node1", "node2"} {
+		err := applicator.SetLabel(labels.NODE, node, "nodeQuality", "good")
+		Assert(t).IsNil(err, "expected no error labeling node")
+	}
+	rc.ReplicasDesired = 1
+	err := rc.meetDesires()
+	Assert(t).IsNil(err, "unexpected error scheduling nodes")
+	scheduled := scheduledPods(t, applicator)
+	Assert(t).AreEqual(len(scheduled), 1, "expected a node to be scheduled")
+	cordoned, _, err := labels.NodeAndPodIDFromPodLabel(scheduled[0])
+	Assert(t).IsNil(err, "expected a pod label ID")
+
+	err = applicator.SetLabel(labels.NODE, cordoned.String(), CordonLabel, "true")
+	Assert(t).IsNil(err, "expected no error cordoning node")
+	rc.ReplicasDesired = 2
+	err = rc.meetDesires()
+	Assert(t).IsNil(err, "unexpected error scheduling nodes")
+	Assert(t).AreEqual(len(scheduledPods(t, applicator)), 2, "expected the other node to be scheduled")
+
+	rc.ReplicasDesired = 1
+	err = rc.meetDesires()
+	Assert(t).IsNil(err, "unexpected error unscheduling nodes")
+	scheduled = scheduledPods(t, applicator)
+	Assert(t).AreEqual(len(scheduled), 1, "expected a node to be unscheduled")
+	Assert(t).AreNotEqual(scheduled[0].ID, labels.MakePodLabelKey(cordoned, "testPod"), "expected the leaving node to be unscheduled")
+
+	rc.ReplicasDesired = 2
+	err = rc.meetDesires()
+	Assert(t).IsNotNil(err, "expected an error since the only other node is cordoned")
+}
+
+func TestPodsOnLeavingNodesAreReplaced(t *testing.T) {
+	_, _, applicator, rc, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	for _, node := range []string{"node1", "node2"} {
+		err := applicator.SetLabel(labels.NODE, node, "nodeQuality", "good")
+		Assert(t).IsNil(err, "expected no error labeling node")
+	}
+	rc.ReplicasDesired = 1
+	err := rc.meetDesires()
+	Assert(t).IsNil(err, "unexpected error scheduling nodes")
+	scheduled := scheduledPods(t, applicator)
+	Assert(t).AreEqual(len(scheduled), 1, "expected a node to be scheduled")
+	leaving, _, err := labels.NodeAndPodIDFromPodLabel(scheduled[0])
+	Assert(t).IsNil(err, "expected a pod label ID")
+
+	err = applicator.SetLabels(labels.NODE, leaving.String(), map[string]string{CordonLabel: "true", LeavingLabel: "true"})
+	Assert(t).IsNil(err, "expected no error marking the node as leaving")
+	err = rc.meetDesires()
+	Assert(t).IsNil(err, "unexpected error scheduling nodes")
+	Assert(t).AreEqual(len(scheduledPods(t, applicator)), 2, "expected the pod on the leaving node to be replaced")
+
+	err = rc.meetDesires()
+	Assert(t).IsNil(err, "unexpected error meeting desires")
+	Assert(t).AreEqual(len(scheduledPods(t, applicator)), 2, "expected the leaving node's pod to be left alone")
+
+	err = applicator.RemoveLabel(labels.NODE, leaving.String(), LeavingLabel)
+	Assert(t).IsNil(err, "expected no error removing the leaving label")
+	err = rc.meetDesires()
+	Assert(t).IsNil(err, "unexpected error unscheduling nodes")
+	scheduled = scheduledPods(t, applicator)
+	Assert(t).AreEqual(len(scheduled), 1, "expected the RC to scale back down once the node stayed")
+	Assert(t).AreNotEqual(scheduled[0].ID, labels.MakePodLabelKey(leaving, "testPod"), "expected the leaving node to be unscheduled")
+}
+
+// budgetAllowing is a disruption.Enforcer that allows removing a fixed number
+// of pods
+type budgetAllowing int
+
+func (n budgetAllowing) Removable(candidates types.PodLocations, max int) (types.PodLocations, error) {
+	if max > int(n) {
+		max = int(n)
+	}
+	return candidates[:max], nil
+}
+
+func TestUnscheduleWithinBudgets(t *testing.T) {
+	_, _, applicator, rc, _, _, closeFn := setup(t)
+	defer closeFn()
+
+	for _, node := range []string{"node1", "node2", "node3"} {
+		err := applicator.SetLabel(labels.NODE, node, "nodeQuality", "good")
+		Assert(t).IsNil(err, "expected no error labeling node")
+	}
+	rc.ReplicasDesired = 3
+	err := rc.meetDesires()
+	Assert(t).IsNil(err, "unexpected error scheduling nodes")
+
+	rc.budgets = budgetAllowing(1)
+	rc.ReplicasDesired = 0
+	err = rc.meetDesires()
+	Assert(t).IsNil(err, "unexpected error unscheduling nodes")
+	Assert(t).AreEqual(len(scheduledPods(t, applicator)), 2, "expected the budget to hold back two of the pods")
+
+	rc.budgets = budgetAllowing(2)
+	err = rc.meetDesires()
+	Assert(t).IsNil(err, "unexpected error unscheduling nodes")
+	Assert(t).AreEqual(len(scheduledPods(t, applicator)), 0, "expected the held pods to be unscheduled once the budget allowed it")
+}
+
 func TestConsistencyNoChange(t *testing.T) {
 	_, kvStore, applicator, rc, alerter, _, closeFn := setup(t)
 	defer closeFn()
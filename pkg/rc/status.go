@@ -0,0 +1,241 @@
+package rc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	pc_fields "github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// ReplicaStatus is the state of one scheduled replica of a pod
+type ReplicaStatus struct {
+	Node types.NodeName
+	// The RC that scheduled the replica, if it was scheduled by one
+	RCID fields.ID
+	// Installed is true if the pod is in the node's reality
+	Installed bool
+	// Current is true if the pod in the node's reality is the one in its
+	// intent
+	Current bool
+	// Health is the pod's health on the node, or empty if it has none
+	Health health.HealthState
+}
+
+// Healthy returns true if the replica is installed and passing its health
+// check
+func (r ReplicaStatus) Healthy() bool {
+	return r.Installed && r.Health == health.Passing
+}
+
+// ReplicationStatus is the state of the replicas of an RC or pod cluster, as
+// joined from their pods' intent, reality, labels and health
+type ReplicationStatus struct {
+	PodID types.PodID
+	// ReplicasDesired is that of the RC, or the sum of those of the RCs
+	// whose pods are in the pod cluster
+	ReplicasDesired int
+	// Replicas has one replica for each node the pod is scheduled on,
+	// sorted by node
+	Replicas []ReplicaStatus
+}
+
+// Scheduled returns the nodes the pod is scheduled on
+func (s ReplicationStatus) Scheduled() []types.NodeName {
+	return s.nodes(func(ReplicaStatus) bool { return true })
+}
+
+// Installed returns the nodes whose reality has the pod
+func (s ReplicationStatus) Installed() []types.NodeName {
+	return s.nodes(func(r ReplicaStatus) bool { return r.Installed })
+}
+
+// Healthy returns the nodes the pod is installed on and passing its health
+// check on
+func (s ReplicationStatus) Healthy() []types.NodeName {
+	return s.nodes(ReplicaStatus.Healthy)
+}
+
+func (s ReplicationStatus) nodes(include func(ReplicaStatus) bool) []types.NodeName {
+	nodes := []types.NodeName{}
+	for _, replica := range s.Replicas {
+		if include(replica) {
+			nodes = append(nodes, replica.Node)
+		}
+	}
+	return nodes
+}
+
+type replicasByNode []ReplicaStatus
+
+func (r replicasByNode) Len() int           { return len(r) }
+func (r replicasByNode) Less(i, j int) bool { return r[i].Node < r[j].Node }
+func (r replicasByNode) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// Subset of rcstore.ConsulStore
+type statusRCStore interface {
+	Get(id fields.ID) (fields.RC, error)
+	List() ([]fields.RC, error)
+}
+
+// Subset of pcstore.ConsulStore
+type statusPCStore interface {
+	Get(id pc_fields.ID) (pc_fields.PodCluster, error)
+}
+
+// Subset of consul.Store
+type statusPodStore interface {
+	Pod(podPrefix consul.PodPrefix, nodeName types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
+}
+
+// Subset of checker.ConsulHealthChecker
+type statusHealthChecker interface {
+	Service(serviceID string) (map[types.NodeName]health.Result, error)
+}
+
+// StatusAggregator reports the ReplicationStatus of RCs and pod clusters in a
+// single call, so that its callers don't each have to join the pods' intent,
+// reality, labels and health themselves
+type StatusAggregator struct {
+	rcStore       statusRCStore
+	pcStore       statusPCStore
+	labeler       LabelMatcher
+	podStore      statusPodStore
+	healthChecker statusHealthChecker
+}
+
+func NewStatusAggregator(
+	rcStore statusRCStore,
+	pcStore statusPCStore,
+	labeler LabelMatcher,
+	podStore statusPodStore,
+	healthChecker statusHealthChecker,
+) StatusAggregator {
+	return StatusAggregator{
+		rcStore:       rcStore,
+		pcStore:       pcStore,
+		labeler:       labeler,
+		podStore:      podStore,
+		healthChecker: healthChecker,
+	}
+}
+
+// RCStatus returns the status of the RC's replicas. It returns
+// rcstore.NoReplicationController if the RC doesn't exist.
+func (a StatusAggregator) RCStatus(rcID fields.ID) (ReplicationStatus, error) {
+	rc, err := a.rcStore.Get(rcID)
+	if err != nil {
+		return ReplicationStatus{}, err
+	}
+	selector := klabels.Everything().Add(RCIDLabel, klabels.EqualsOperator, []string{rcID.String()})
+	return a.status(rc.Manifest.ID(), rc.ReplicasDesired, selector)
+}
+
+// PodClusterStatus returns the status of the replicas in the pod cluster. Its
+// replicas desired are summed over the RCs whose pods the pod cluster selects.
+func (a StatusAggregator) PodClusterStatus(pcID pc_fields.ID) (ReplicationStatus, error) {
+	pc, err := a.pcStore.Get(pcID)
+	if err != nil {
+		return ReplicationStatus{}, err
+	}
+	rcs, err := a.rcStore.List()
+	if err != nil {
+		return ReplicationStatus{}, util.Errorf("could not list RCs: %s", err)
+	}
+	desired := 0
+	for _, rc := range rcs {
+		if rc.Manifest.ID() != pc.PodID {
+			continue
+		}
+		// the labels the RC gives its pods, as in computePodLabels()
+		podLabels := klabels.Set{}
+		for k, v := range rc.PodLabels {
+			podLabels[k] = v
+		}
+		podLabels[rcstore.PodIDLabel] = rc.Manifest.ID().String()
+		podLabels[RCIDLabel] = rc.ID.String()
+		if pc.PodSelector.Matches(podLabels) {
+			desired += rc.ReplicasDesired
+		}
+	}
+	return a.status(pc.PodID, desired, pc.PodSelector)
+}
+
+// status joins the intent, reality and health of the pods of podID that
+// selector matches
+func (a StatusAggregator) status(podID types.PodID, desired int, selector klabels.Selector) (ReplicationStatus, error) {
+	matches, err := a.labeler.GetMatches(selector, labels.POD)
+	if err != nil {
+		return ReplicationStatus{}, util.Errorf("could not read pod labels: %s", err)
+	}
+	podHealth, err := a.healthChecker.Service(podID.String())
+	if err != nil {
+		return ReplicationStatus{}, util.Errorf("could not read the health of %s: %s", podID, err)
+	}
+
+	status := ReplicationStatus{
+		PodID:           podID,
+		ReplicasDesired: desired,
+		Replicas:        []ReplicaStatus{},
+	}
+	for _, match := range matches {
+		node, matchedID, err := labels.NodeAndPodIDFromPodLabel(match)
+		if err != nil {
+			return ReplicationStatus{}, err
+		}
+		if matchedID != podID {
+			continue
+		}
+		replica := ReplicaStatus{
+			Node: node,
+			RCID: fields.ID(match.Labels.Get(RCIDLabel)),
+		}
+		if result, ok := podHealth[node]; ok {
+			replica.Health = result.Status
+		}
+
+		reality, _, err := a.podStore.Pod(consul.REALITY_TREE, node, podID)
+		switch {
+		case err == pods.NoCurrentManifest:
+		case err != nil:
+			return ReplicationStatus{}, util.Errorf("could not read the reality of %s on %s: %s", podID, node, err)
+		default:
+			replica.Installed = true
+			intent, _, err := a.podStore.Pod(consul.INTENT_TREE, node, podID)
+			if err != nil && err != pods.NoCurrentManifest {
+				return ReplicationStatus{}, util.Errorf("could not read the intent of %s on %s: %s", podID, node, err)
+			}
+			if err == nil {
+				replica.Current, err = sameSHA(intent, reality)
+				if err != nil {
+					return ReplicationStatus{}, err
+				}
+			}
+		}
+		status.Replicas = append(status.Replicas, replica)
+	}
+	sort.Sort(replicasByNode(status.Replicas))
+	return status, nil
+}
+
+func sameSHA(a manifest.Manifest, b manifest.Manifest) (bool, error) {
+	aSHA, err := a.SHA()
+	if err != nil {
+		return false, util.Errorf("could not hash manifest: %s", err)
+	}
+	bSHA, err := b.SHA()
+	if err != nil {
+		return false, util.Errorf("could not hash manifest: %s", err)
+	}
+	return aSHA == bSHA, nil
+}
@@ -0,0 +1,91 @@
+package rc
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/health"
+	hctest "github.com/square/p2/pkg/health/checker/test"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pc/control"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consultest"
+	"github.com/square/p2/pkg/store/consul/pcstore/pcstoretest"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/types"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+func TestReplicationStatusJoinsIntentRealityAndHealth(t *testing.T) {
+	rcStore := rcstore.NewFake()
+	pcStore := pcstoretest.NewFake()
+	applicator := labels.NewFakeApplicator()
+	podStore := consultest.NewFakePodStore(nil, nil)
+
+	builder := manifest.NewBuilder()
+	builder.SetID("some_pod")
+	podManifest := builder.GetManifest()
+	builder = podManifest.GetBuilder()
+	builder.SetStatusPort(8000)
+	oldManifest := builder.GetManifest()
+
+	rc, err := rcStore.Create(podManifest, klabels.Everything(), "west", "prod", klabels.Set{
+		types.AvailabilityZoneLabel: "west",
+		types.ClusterNameLabel:      "prod",
+	}, nil)
+	Assert(t).IsNil(err, "test setup: could not create RC")
+	err = rcStore.SetDesiredReplicas(rc.ID, 4)
+	Assert(t).IsNil(err, "test setup: could not set replicas desired")
+	pc, err := pcStore.Create("some_pod", "west", "prod", control.DefaultPodSelector("west", "prod", "some_pod"), nil, nil)
+	Assert(t).IsNil(err, "test setup: could not create pod cluster")
+
+	// node1 is installed and healthy, node2 is installed but running an
+	// older manifest and critical, node3 is scheduled but not installed yet
+	for _, node := range []types.NodeName{"node3", "node1", "node2"} {
+		err = applicator.SetLabels(labels.POD, labels.MakePodLabelKey(node, "some_pod"), map[string]string{
+			rcstore.PodIDLabel:          "some_pod",
+			RCIDLabel:                   rc.ID.String(),
+			types.AvailabilityZoneLabel: "west",
+			types.ClusterNameLabel:      "prod",
+		})
+		Assert(t).IsNil(err, "test setup: could not label pod")
+		_, err = podStore.SetPod(consul.INTENT_TREE, node, podManifest)
+		Assert(t).IsNil(err, "test setup: could not write intent")
+	}
+	_, err = podStore.SetPod(consul.REALITY_TREE, "node1", podManifest)
+	Assert(t).IsNil(err, "test setup: could not write reality")
+	_, err = podStore.SetPod(consul.REALITY_TREE, "node2", oldManifest)
+	Assert(t).IsNil(err, "test setup: could not write reality")
+	healthChecker := hctest.NewSingleService("some_pod", map[types.NodeName]health.Result{
+		"node1": {ID: "some_pod", Node: "node1", Status: health.Passing},
+		"node2": {ID: "some_pod", Node: "node2", Status: health.Critical},
+	})
+
+	aggregator := NewStatusAggregator(rcStore, pcStore, applicator, podStore, healthChecker)
+	status, err := aggregator.RCStatus(rc.ID)
+	Assert(t).IsNil(err, "should have aggregated the RC's status")
+	Assert(t).AreEqual(status.PodID, types.PodID("some_pod"), "unexpected pod ID")
+	Assert(t).AreEqual(status.ReplicasDesired, 4, "unexpected replicas desired")
+	Assert(t).AreEqual(fmt.Sprint(status.Scheduled()), "[node1 node2 node3]", "should have been scheduled on every labeled node, in order")
+	Assert(t).AreEqual(fmt.Sprint(status.Installed()), "[node1 node2]", "should have been installed on the nodes with it in reality")
+	Assert(t).AreEqual(fmt.Sprint(status.Healthy()), "[node1]", "should only have been healthy on the passing node")
+	Assert(t).IsTrue(status.Replicas[0].Current, "node1 should be running its intent")
+	Assert(t).IsFalse(status.Replicas[1].Current, "node2 should not be running its intent")
+	Assert(t).AreEqual(status.Replicas[2].Health, health.HealthState(""), "node3 should not have health")
+	Assert(t).AreEqual(status.Replicas[0].RCID, rc.ID, "should have recorded the RC of the replica")
+
+	pcStatus, err := aggregator.PodClusterStatus(pc.ID)
+	Assert(t).IsNil(err, "should have aggregated the pod cluster's status")
+	Assert(t).AreEqual(pcStatus.ReplicasDesired, 4, "should have summed the replicas desired of the pod cluster's RCs")
+	Assert(t).AreEqual(fmt.Sprint(pcStatus.Scheduled()), fmt.Sprint(status.Scheduled()), "should have selected the same pods as the RC")
+	Assert(t).AreEqual(fmt.Sprint(pcStatus.Healthy()), fmt.Sprint(status.Healthy()), "should have found the same healthy pods as the RC")
+}
+
+func TestReplicationStatusOfMissingRC(t *testing.T) {
+	aggregator := NewStatusAggregator(rcstore.NewFake(), pcstoretest.NewFake(), labels.NewFakeApplicator(), consultest.NewFakePodStore(nil, nil), hctest.NewSingleService("some_pod", nil))
+	_, err := aggregator.RCStatus("nonexistent")
+	Assert(t).IsTrue(rcstore.IsNotExist(err), "should have reported that the RC doesn't exist")
+}
@@ -0,0 +1,142 @@
+package rc
+
+import (
+	"math/rand"
+	"sort"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/types"
+)
+
+// scheduleOrder orders the nodes that the RC could schedule on by its strategy,
+// so that scheduling on them in order meets the strategy. possible must be
+// sorted by name.
+func (rc *replicationController) scheduleOrder(possible []types.NodeName, current []types.NodeName) ([]types.NodeName, error) {
+	rc.mu.Lock()
+	strategy := rc.Strategy
+	rc.mu.Unlock()
+
+	switch strategy.Type {
+	case fields.RandomStrategy:
+		shuffled := make([]types.NodeName, len(possible))
+		for i, j := range rand.Perm(len(possible)) {
+			shuffled[i] = possible[j]
+		}
+		return shuffled, nil
+	case fields.SpreadStrategy, fields.PackStrategy:
+		domains, err := rc.failureDomains(strategy.Label, append(append([]types.NodeName{}, possible...), current...))
+		if err != nil {
+			return nil, err
+		}
+		return orderByDomain(possible, current, domains, strategy.Type == fields.SpreadStrategy, 1), nil
+	default:
+		return possible, nil
+	}
+}
+
+// unscheduleOrder orders the nodes that the RC could unschedule from by its
+// strategy, so that unscheduling from them in order meets the strategy
+func (rc *replicationController) unscheduleOrder(current []types.NodeName) ([]types.NodeName, error) {
+	rc.mu.Lock()
+	strategy := rc.Strategy
+	rc.mu.Unlock()
+
+	sorted := types.NewNodeSet(current...).ListNodes()
+	switch strategy.Type {
+	case fields.SpreadStrategy, fields.PackStrategy:
+		domains, err := rc.failureDomains(strategy.Label, sorted)
+		if err != nil {
+			return nil, err
+		}
+		// spreading unschedules from the most crowded domains, packing
+		// from the least crowded
+		return orderByDomain(sorted, sorted, domains, strategy.Type == fields.PackStrategy, -1), nil
+	default:
+		return sorted, nil
+	}
+}
+
+// failureDomains returns the value of the label on each of the nodes
+func (rc *replicationController) failureDomains(label string, nodes []types.NodeName) (map[types.NodeName]string, error) {
+	nodeLabels, err := rc.nodeLabels(nodes)
+	if err != nil {
+		return nil, err
+	}
+	domains := make(map[types.NodeName]string, len(nodes))
+	for _, node := range nodes {
+		domains[node] = nodeLabels[node].Get(label)
+	}
+	return domains, nil
+}
+
+// nodeLabels returns the labels of each of the nodes
+func (rc *replicationController) nodeLabels(nodes []types.NodeName) (map[types.NodeName]klabels.Set, error) {
+	rc.mu.Lock()
+	nodeSelector := rc.NodeSelector
+	rc.mu.Unlock()
+
+	nodeLabels := make(map[types.NodeName]klabels.Set, len(nodes))
+	// most nodes are eligible, so get their labels at once
+	matches, err := rc.podApplicator.GetMatches(nodeSelector, labels.NODE)
+	if err != nil {
+		return nil, err
+	}
+	for _, match := range matches {
+		nodeLabels[types.NodeName(match.ID)] = match.Labels
+	}
+	for _, node := range nodes {
+		if _, ok := nodeLabels[node]; ok {
+			continue
+		}
+		labeled, err := rc.podApplicator.GetLabels(labels.NODE, node.String())
+		if err != nil {
+			return nil, err
+		}
+		nodeLabels[node] = labeled.Labels
+	}
+	return nodeLabels, nil
+}
+
+// orderByDomain orders nodes by repeatedly taking the next node of the failure
+// domain that currently has the fewest (or, if fewest is false, the most) of
+// the RC's nodes, and then adjusting that domain's count by step. The RC's
+// nodes are counted from current. Ties are broken by domain and node name.
+func orderByDomain(nodes []types.NodeName, current []types.NodeName, domains map[types.NodeName]string, fewest bool, step int) []types.NodeName {
+	counts := make(map[string]int)
+	for _, node := range current {
+		counts[domains[node]]++
+	}
+
+	remaining := make(map[string][]types.NodeName)
+	var domainNames []string
+	for _, node := range nodes {
+		domain := domains[node]
+		if _, ok := remaining[domain]; !ok {
+			domainNames = append(domainNames, domain)
+		}
+		remaining[domain] = append(remaining[domain], node)
+	}
+	sort.Strings(domainNames)
+
+	ordered := make([]types.NodeName, 0, len(nodes))
+	for len(ordered) < len(nodes) {
+		best := ""
+		found := false
+		for _, domain := range domainNames {
+			if len(remaining[domain]) == 0 {
+				continue
+			}
+			if !found || (fewest && counts[domain] < counts[best]) || (!fewest && counts[domain] > counts[best]) {
+				best = domain
+				found = true
+			}
+		}
+		ordered = append(ordered, remaining[best][0])
+		remaining[best] = remaining[best][1:]
+		counts[best] += step
+	}
+	return ordered
+}
@@ -0,0 +1,96 @@
+package rc
+
+import (
+	"strings"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// TaintLabelPrefix marks node labels that are taints. A node labeled
+// "taint/dedicated=db" has the taint "dedicated" with the value "db", and RCs
+// won't schedule pods on it unless their manifest tolerates that taint. Pods
+// that are already on the node are left alone, so operators can cordon a node
+// by tainting it without changing its other labels.
+const TaintLabelPrefix = "taint/"
+
+// CordonLabel marks a cordoned node. RCs won't schedule pods on a cordoned
+// node, whatever their manifest tolerates, and unschedule from it before other
+// nodes when scaling down, which is how nodes are drained.
+const CordonLabel = "cordoned"
+
+// LeavingLabel marks a node that is about to go away, such as a spot instance
+// whose termination has been announced. RCs don't count their pods on a
+// leaving node, so they schedule replacements for them on other nodes without
+// waiting for the node to disappear. A leaving node should also be cordoned,
+// so that the replacements aren't scheduled on it. If the label is removed,
+// the pods count again and RCs scale back down to their desired replicas.
+const LeavingLabel = "leaving"
+
+// taints returns the taints in a node's labels, by key
+func taints(nodeLabels klabels.Set) map[string]string {
+	ret := make(map[string]string)
+	for label, value := range nodeLabels {
+		if strings.HasPrefix(label, TaintLabelPrefix) {
+			ret[strings.TrimPrefix(label, TaintLabelPrefix)] = value
+		}
+	}
+	return ret
+}
+
+// tolerated returns whether every taint is tolerated by one of the
+// tolerations
+func tolerated(nodeTaints map[string]string, tolerations []manifest.Toleration) bool {
+	for key, value := range nodeTaints {
+		ok := false
+		for _, toleration := range tolerations {
+			if toleration.Tolerates(key, value) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// leavingNodes returns those of the nodes that are labeled as leaving
+func (rc *replicationController) leavingNodes(nodes []types.NodeName) (types.NodeSet, error) {
+	leaving := types.NewNodeSet()
+	if len(nodes) == 0 {
+		return leaving, nil
+	}
+	nodeLabels, err := rc.nodeLabels(nodes)
+	if err != nil {
+		return types.NodeSet{}, err
+	}
+	for _, node := range nodes {
+		if nodeLabels[node].Has(LeavingLabel) {
+			leaving.InsertNode(node)
+		}
+	}
+	return leaving, nil
+}
+
+// schedulable returns the nodes that aren't cordoned and whose taints are all
+// tolerated by the tolerations
+func (rc *replicationController) schedulable(nodes []types.NodeName, tolerations []manifest.Toleration) ([]types.NodeName, error) {
+	nodeLabels, err := rc.nodeLabels(nodes)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]types.NodeName, 0, len(nodes))
+	for _, node := range nodes {
+		if nodeLabels[node].Has(CordonLabel) {
+			continue
+		}
+		if tolerated(taints(nodeLabels[node]), tolerations) {
+			ret = append(ret, node)
+		}
+	}
+	return ret, nil
+}
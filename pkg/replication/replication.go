@@ -33,6 +33,13 @@ var (
 	ensureHealthyPeriodMillis = param.Int("ensure_healthy_millis", 1000)
 )
 
+// Writing a node's intent is retried until replication is stopped, backing
+// off from a second to a minute
+var intentRetryPolicy = consulutil.RetryPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+}
+
 type nodeUpdated struct {
 	node types.NodeName
 	err  error
@@ -433,8 +440,8 @@ func (r *replication) updateOne(
 		r.manifest,
 	)
 
-	exponentialBackoff := time.Duration(1 * time.Second)
-	timer := time.NewTimer(exponentialBackoff)
+	failures := 1
+	timer := time.NewTimer(intentRetryPolicy.Backoff(failures))
 	for err != nil {
 		nodeLogger.WithError(err).Errorln("Could not write intent store")
 
@@ -455,8 +462,8 @@ func (r *replication) updateOne(
 				node,
 				r.manifest,
 			)
-			exponentialBackoff = exponentialBackoff * 2
-			timer.Reset(exponentialBackoff)
+			failures++
+			timer.Reset(intentRetryPolicy.Backoff(failures))
 		}
 	}
 	err = r.ensureInReality(node, timeoutCh, nodeLogger, targetSHA)
@@ -0,0 +1,71 @@
+package roll
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/roll/fields"
+)
+
+// healthRegressed returns true if the update has an AutoRollback and the new
+// RC's nodes have been less healthy than it allows for longer than its grace
+// period, in which case u.aborted is set and the abort is recorded so that
+// the roll back continues if the update is interrupted
+func (u *update) healthRegressed(newNodes rcNodeCounts, now time.Time) bool {
+	if u.AutoRollback == nil || newNodes.Real == 0 {
+		u.regressedSince = time.Time{}
+		return false
+	}
+
+	fraction := float64(newNodes.Real-newNodes.Unhealthy) / float64(newNodes.Real)
+	if fraction >= u.AutoRollback.MinHealthyFraction {
+		if !u.regressedSince.IsZero() {
+			u.logger.WithField("healthy_fraction", fraction).Infoln("New RC's health recovered")
+		}
+		u.regressedSince = time.Time{}
+		return false
+	}
+
+	logger := u.logger.SubLogger(logrus.Fields{
+		"healthy_fraction":     fraction,
+		"min_healthy_fraction": u.AutoRollback.MinHealthyFraction,
+		"grace_period":         u.AutoRollback.GracePeriod,
+	})
+	if u.regressedSince.IsZero() {
+		logger.NoFields().Warnln("New RC's health regressed")
+		u.regressedSince = now
+	}
+	if now.Sub(u.regressedSince) <= u.AutoRollback.GracePeriod {
+		return false
+	}
+
+	logger.NoFields().Errorln("New RC's health regressed for longer than the grace period, aborting the update")
+	u.aborted = true
+	if u.controls != nil {
+		err := u.controls.SetControl(u.ID(), fields.ControlAbort)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not record that the update was aborted")
+		}
+	}
+	if u.alerter != nil {
+		err := u.alerter.Alert(alerting.AlertInfo{
+			Description: "rolling update was aborted because the new RC's health regressed",
+			IncidentKey: "roll-" + u.ID().String(),
+			Details: struct {
+				OldRCID         string  `json:"old_rc_id"`
+				NewRCID         string  `json:"new_rc_id"`
+				HealthyFraction float64 `json:"healthy_fraction"`
+			}{
+				OldRCID:         u.OldRC.String(),
+				NewRCID:         u.NewRC.String(),
+				HealthyFraction: fraction,
+			},
+		})
+		if err != nil {
+			logger.WithError(err).Errorln("Could not alert that the update was aborted")
+		}
+	}
+	return true
+}
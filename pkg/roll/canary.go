@@ -0,0 +1,118 @@
+package roll
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/util"
+)
+
+// CanaryConfirmations reports whether an operator has confirmed that an
+// update may proceed past its canary phase
+type CanaryConfirmations interface {
+	CanaryConfirmed(id fields.ID) (bool, error)
+}
+
+// canaryMetricTimeout bounds how long a request to a canary's metric URL may
+// take before the metric is considered to have failed
+const canaryMetricTimeout = 10 * time.Second
+
+// canaryHolds returns true if the update must not add any more nodes to the
+// new RC because it is waiting for its canary to soak or to be confirmed
+func (u *update) canaryHolds(newNodes rcNodeCounts) bool {
+	if u.Canary == nil || u.canaryPassed || u.Canary.Replicas <= 0 {
+		return false
+	}
+	if newNodes.Desired < u.Canary.Replicas {
+		// the canary nodes are still being updated
+		return false
+	}
+	if newNodes.Desired > u.Canary.Replicas {
+		// the update was resumed after its canary had already passed
+		u.canaryPassed = true
+		return false
+	}
+
+	logger := u.logger.SubLogger(logrus.Fields{
+		"canary_replicas": u.Canary.Replicas,
+		"soak":            u.Canary.Soak,
+	})
+	err := u.checkCanary(newNodes)
+	if err != nil {
+		if !u.canarySoakStart.IsZero() {
+			logger.WithError(err).Warnln("Canary failed, restarting its soak")
+		} else {
+			logger.WithError(err).Debugln("Waiting for the canary to become healthy")
+		}
+		u.canarySoakStart = time.Time{}
+		return true
+	}
+
+	now := time.Now()
+	if u.canarySoakStart.IsZero() {
+		logger.NoFields().Infoln("Canary is healthy, soaking")
+		u.canarySoakStart = now
+	}
+	if now.Sub(u.canarySoakStart) < u.Canary.Soak {
+		return true
+	}
+
+	if u.Canary.RequireConfirmation {
+		if u.controls == nil {
+			logger.NoFields().Errorln("Canary requires confirmation, but confirmations can't be read")
+			return true
+		}
+		confirmed, err := u.controls.CanaryConfirmed(u.ID())
+		if err != nil {
+			logger.WithError(err).Errorln("Could not check whether the canary was confirmed")
+			return true
+		}
+		if !confirmed {
+			logger.NoFields().Debugln("Canary has soaked, waiting for confirmation")
+			return true
+		}
+	}
+
+	logger.NoFields().Infoln("Canary passed, continuing update")
+	u.canaryPassed = true
+	return false
+}
+
+// checkCanary returns an error if any of the canary nodes aren't healthy, or
+// if the canary's metric URL reports failure
+func (u *update) checkCanary(newNodes rcNodeCounts) error {
+	if newNodes.Healthy < u.Canary.Replicas {
+		return util.Errorf("only %d of %d canary nodes are healthy", newNodes.Healthy, u.Canary.Replicas)
+	}
+	if u.Canary.MetricURL == "" {
+		return nil
+	}
+
+	client := u.metricClient
+	if client == nil {
+		client = &http.Client{Timeout: canaryMetricTimeout}
+	}
+	resp, err := client.Get(u.Canary.MetricURL)
+	if err != nil {
+		return util.Errorf("could not query canary metric: %s", err)
+	}
+	defer resp.Body.Close()
+	_, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return util.Errorf("canary metric %s returned %s", u.Canary.MetricURL, resp.Status)
+	}
+	return nil
+}
+
+// capToCanary reduces the number of nodes to add so that the new RC isn't
+// given more nodes than the canary before it has passed
+func (u *update) capToCanary(newDesired, nextRemove, nextAdd int) (int, int) {
+	if u.Canary == nil || u.canaryPassed || u.Canary.Replicas <= 0 {
+		return nextRemove, nextAdd
+	}
+	return capAdd(nextRemove, nextAdd, u.Canary.Replicas-newDesired)
+}
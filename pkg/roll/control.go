@@ -0,0 +1,108 @@
+package roll
+
+import (
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul/rcstore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// Controls reports how operators have intervened in rolling updates
+type Controls interface {
+	CanaryConfirmations
+	Control(id fields.ID) (fields.Control, error)
+	// SetControl is used to record that an update aborted itself
+	SetControl(id fields.ID, control fields.Control) error
+}
+
+// controlHolds reads the control that operators set on the update, and returns
+// true if no nodes may be transferred because the update is paused or was
+// aborted. If it was aborted, u.aborted is set.
+func (u *update) controlHolds() bool {
+	if u.controls == nil {
+		return false
+	}
+
+	control, err := u.controls.Control(u.ID())
+	if err != nil {
+		// an operator may be trying to stop the update, so don't
+		// proceed without knowing
+		u.logger.WithError(err).Errorln("Could not read the update's control")
+		return true
+	}
+
+	switch control {
+	case fields.ControlAbort:
+		u.logger.NoFields().Warnln("Update was aborted")
+		u.aborted = true
+		return true
+	case fields.ControlPause:
+		if !u.paused {
+			u.logger.NoFields().Infoln("Update was paused")
+		}
+		u.paused = true
+		return true
+	case fields.ControlNone:
+		if u.paused {
+			u.logger.NoFields().Infoln("Update was resumed")
+		}
+		u.paused = false
+		return false
+	default:
+		u.logger.WithField("control", control).Errorln("Unknown update control, holding the update")
+		return true
+	}
+}
+
+// rollBack moves the nodes that an aborted update already gave to the new RC
+// back to the old one, by running the update in reverse. The minimum replicas
+// is respected while doing so. Both RCs are left in place afterwards. Returns
+// true if the roll back completed, false if asked to quit.
+func (u *update) rollBack(podID types.PodID, hChecks <-chan map[types.NodeName]health.Result, hErrs <-chan error, quit <-chan struct{}) bool {
+	var target int
+	if !RetryOrQuit(func() error {
+		oldRC, err := u.rcStore.Get(u.OldRC)
+		if rcstore.IsNotExist(err) {
+			return util.Errorf("Replication controller %s is unexpectedly empty", u.OldRC)
+		} else if err != nil {
+			return err
+		}
+		newRC, err := u.rcStore.Get(u.NewRC)
+		if rcstore.IsNotExist(err) {
+			return util.Errorf("Replication controller %s is unexpectedly empty", u.NewRC)
+		} else if err != nil {
+			return err
+		}
+		target = oldRC.ReplicasDesired + newRC.ReplicasDesired
+		return nil
+	}, quit, u.logger, "Could not read RCs to roll back") {
+		return false
+	}
+
+	reverse := *u
+	reverse.OldRC, reverse.NewRC = u.NewRC, u.OldRC
+	reverse.DesiredReplicas = target
+	reverse.RollDelay = 0
+	reverse.Canary = nil
+	reverse.AutoRollback = nil
+	// the record still says that the update was aborted
+	reverse.controls = nil
+	// rolling back is remediation, which freezes don't hold
+	reverse.freezes = nil
+	reverse.healthySince = nil
+	reverse.recentlyMoved = nil
+	reverse.logger = u.logger.SubLogger(logrus.Fields{"rolling_back": true})
+
+	u.logger.WithField("old_rc_replicas", target).Infoln("Rolling back to the old RC")
+	if !RetryOrQuit(reverse.enable, quit, reverse.logger, "Could not enable/disable RCs") {
+		return false
+	}
+	if !reverse.rollLoop(podID, hChecks, hErrs, quit) {
+		return false
+	}
+	u.logger.NoFields().Infoln("Rolled back to the old RC")
+	return true
+}
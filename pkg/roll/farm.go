@@ -8,6 +8,8 @@ import (
 
 	"github.com/square/p2/pkg/alerting"
 	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/disruption"
+	"github.com/square/p2/pkg/freeze"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/logging"
@@ -41,6 +43,13 @@ type UpdateFactory struct {
 	Labeler       labeler
 	WatchDelay    time.Duration
 	Alerter       alerting.Alerter
+	// Controls are checked for operators pausing or aborting updates and
+	// confirming their canaries
+	Controls Controls
+	// Budgets limit how many nodes may be removed from the old RCs
+	Budgets disruption.Enforcer
+	// Freezes hold updates whose new RC's pods are frozen
+	Freezes freeze.Checker
 }
 
 type labeler interface {
@@ -56,6 +65,9 @@ func NewUpdateFactory(
 	labeler labeler,
 	watchDelay time.Duration,
 	alerter alerting.Alerter,
+	controls Controls,
+	budgets disruption.Enforcer,
+	freezes freeze.Checker,
 ) UpdateFactory {
 	return UpdateFactory{
 		Store:         store,
@@ -65,6 +77,9 @@ func NewUpdateFactory(
 		Labeler:       labeler,
 		WatchDelay:    watchDelay,
 		Alerter:       alerter,
+		Controls:      controls,
+		Budgets:       budgets,
+		Freezes:       freezes,
 	}
 }
 
@@ -80,6 +95,9 @@ func (f UpdateFactory) New(u roll_fields.Update, l logging.Logger, session consu
 		session,
 		f.WatchDelay,
 		f.Alerter,
+		f.Controls,
+		f.Budgets,
+		f.Freezes,
 	)
 }
 
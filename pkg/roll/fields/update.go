@@ -8,6 +8,20 @@ import (
 
 type ID string
 
+// A Control is set on an Update by an operator to interrupt it. The roll farm
+// checks it before each batch of nodes it updates.
+type Control string
+
+const (
+	// ControlNone lets the update proceed
+	ControlNone Control = ""
+	// ControlPause holds the update until its control is cleared
+	ControlPause Control = "pause"
+	// ControlAbort stops the update and rolls the nodes it already updated
+	// back to the old RC. An aborted update can't be resumed.
+	ControlAbort Control = "abort"
+)
+
 // An Update (roll.Update, borrowed from kubectl's "rolling-update" command)
 // represents a transition from one replication controller to another. The IDs
 // represent the two RCs involved in the transition.
@@ -52,6 +66,79 @@ type Update struct {
 	// unhealthy after being healthy for a short duration. Naive implementations like
 	// p2-replicate do not handle such after-the-fact unhealthiness. Default is 0.
 	RollDelay time.Duration
+
+	// MinHealthyDuration is the amount of time a node on the new RC must
+	// remain healthy continuously before it counts toward the progress of
+	// the update. This catches slow-burn failures such as memory leaks or
+	// late crashes before the update proceeds to the next set of nodes. If
+	// zero, the value declared in the new RC's manifest is used instead.
+	MinHealthyDuration time.Duration
+
+	// Pacing limits how quickly the update moves nodes to the new RC
+	Pacing
+
+	// Canary, if set, stops the update once it has updated Canary.Replicas
+	// nodes and holds it there until they have soaked. Updates without a
+	// canary proceed on health alone.
+	Canary *Canary `json:",omitempty"`
+
+	// Control is set by operators to pause or abort the update
+	Control Control `json:",omitempty"`
+
+	// AutoRollback, if set, aborts the update when the new RC's nodes
+	// become unhealthy, rolling them back to the old RC
+	AutoRollback *AutoRollback `json:",omitempty"`
+
+	// Emergency lets the update proceed while its new RC's pods are
+	// frozen
+	Emergency bool `json:",omitempty"`
+}
+
+// AutoRollback aborts an Update, as if an operator had set ControlAbort, when
+// fewer than MinHealthyFraction of the nodes that it has updated are healthy
+// for longer than GracePeriod. Nodes whose health is unknown, e.g. because they
+// are still starting, don't count against the fraction.
+type AutoRollback struct {
+	// MinHealthyFraction is between 0 and 1
+	MinHealthyFraction float64
+	GracePeriod        time.Duration
+}
+
+// Pacing limits how many nodes an Update moves to its new RC at once. The zero
+// value moves as many nodes as MinimumReplicas allows.
+type Pacing struct {
+	// MaxUnavailable, if set, is how many of the DesiredReplicas may be
+	// unhealthy at any point during the update. It can only make the update
+	// more conservative than MinimumReplicas: the update keeps the greater
+	// of MinimumReplicas and DesiredReplicas - MaxUnavailable healthy.
+	MaxUnavailable int `json:",omitempty"`
+	// BatchSize, if set, is the most nodes moved to the new RC at once. The
+	// next batch isn't started until all of the new RC's nodes are healthy.
+	BatchSize int `json:",omitempty"`
+	// NodesPerMinute, if set, is the most nodes moved to the new RC in any
+	// minute
+	NodesPerMinute int `json:",omitempty"`
+}
+
+// A Canary is the first phase of an Update. The update adds nodes to the new
+// RC until it has Replicas of them, and then waits until all of them have
+// been healthy for Soak (and MetricURL, if set, has reported success for as
+// long) before it updates any more nodes. A canary node becoming unhealthy, or
+// the metric failing, restarts the soak.
+type Canary struct {
+	// Replicas is how many nodes the canary phase updates
+	Replicas int
+	// Soak is how long the canary nodes must stay healthy before the update
+	// proceeds
+	Soak time.Duration
+	// MetricURL, if set, is polled during the soak. Any response other than
+	// a 2xx counts as the canary failing.
+	MetricURL string `json:",omitempty"`
+	// RequireConfirmation holds the update after the soak until an operator
+	// confirms that it may proceed, instead of proceeding automatically.
+	RequireConfirmation bool `json:",omitempty"`
+	// Confirmed is set once an operator confirms the canary
+	Confirmed bool `json:",omitempty"`
 }
 
 // Implementation detail: a rolling updates ID matches that of it's NewRC. We may
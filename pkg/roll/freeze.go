@@ -0,0 +1,54 @@
+package roll
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/square/p2/pkg/freeze/fields"
+)
+
+// freezeHolds returns true if no nodes may be transferred because a freeze
+// covers the new RC's pods. Updates marked as emergencies, and those whose new
+// RC has an emergency manifest, are never held. Freezes of node selectors are
+// left to the preparers of the selected nodes.
+func (u *update) freezeHolds() bool {
+	if u.freezes == nil || u.Emergency {
+		return false
+	}
+
+	newRC, err := u.rcStore.Get(u.NewRC)
+	if err != nil {
+		u.logger.WithError(err).Errorln("Could not read the new RC to check for freezes, holding the update")
+		return true
+	}
+	if newRC.Manifest == nil || newRC.Manifest.GetEmergency() {
+		return false
+	}
+
+	frozen, err := u.freezes.Frozen(fields.Target{
+		PodID:     newRC.Manifest.ID(),
+		PodLabels: newRC.PodLabels,
+	}, time.Now())
+	if err != nil {
+		// freezes exist to stop deploys, so don't proceed without
+		// knowing
+		u.logger.WithError(err).Errorln("Could not check for freezes, holding the update")
+		return true
+	}
+	if frozen == nil {
+		if u.frozen {
+			u.logger.NoFields().Infoln("Freeze ended, resuming the update")
+		}
+		u.frozen = false
+		return false
+	}
+	if !u.frozen {
+		u.logger.WithFields(logrus.Fields{
+			"freeze":        frozen.ID,
+			"freeze_reason": frozen.Reason,
+		}).Infoln("Update is held by a freeze")
+	}
+	u.frozen = true
+	return true
+}
@@ -0,0 +1,71 @@
+package roll
+
+import (
+	"time"
+)
+
+// pacingWindow is the period that NodesPerMinute is counted over
+const pacingWindow = time.Minute
+
+// movedNodes records a transfer of nodes to the new RC, for rate limiting
+type movedNodes struct {
+	at    time.Time
+	count int
+}
+
+// minimumHealthy returns how many nodes must stay healthy during the update
+func (u *update) minimumHealthy() int {
+	if u.MaxUnavailable <= 0 {
+		return u.MinimumReplicas
+	}
+	if min := u.DesiredReplicas - u.MaxUnavailable; min > u.MinimumReplicas {
+		return min
+	}
+	return u.MinimumReplicas
+}
+
+// pace reduces the number of nodes to move to the new RC so that batches are
+// no larger than BatchSize, don't start until the previous batch is healthy,
+// and don't exceed NodesPerMinute
+func (u *update) pace(newNodes rcNodeCounts, now time.Time, nextRemove, nextAdd int) (int, int) {
+	if u.BatchSize > 0 {
+		if newNodes.Healthy < newNodes.Desired {
+			// the previous batch hasn't finished
+			return 0, 0
+		}
+		nextRemove, nextAdd = capAdd(nextRemove, nextAdd, u.BatchSize)
+	}
+
+	if u.NodesPerMinute > 0 {
+		moved := 0
+		recent := u.recentlyMoved[:0]
+		for _, m := range u.recentlyMoved {
+			if now.Sub(m.at) < pacingWindow {
+				recent = append(recent, m)
+				moved += m.count
+			}
+		}
+		u.recentlyMoved = recent
+		nextRemove, nextAdd = capAdd(nextRemove, nextAdd, u.NodesPerMinute-moved)
+	}
+	return nextRemove, nextAdd
+}
+
+// recordMoved records that count nodes were moved to the new RC, for limiting
+// NodesPerMinute
+func (u *update) recordMoved(now time.Time, count int) {
+	if u.NodesPerMinute > 0 && count > 0 {
+		u.recentlyMoved = append(u.recentlyMoved, movedNodes{at: now, count: count})
+	}
+}
+
+// capAdd reduces the number of nodes to add to at most limit. The number of
+// nodes to remove is reduced by as many, so that the capacity change is the
+// same.
+func capAdd(nextRemove, nextAdd, limit int) (int, int) {
+	excess := nextAdd - clampToZero(limit)
+	if excess <= 0 {
+		return nextRemove, nextAdd
+	}
+	return clampToZero(nextRemove - excess), nextAdd - excess
+}
@@ -2,12 +2,15 @@ package roll
 
 import (
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 
 	"github.com/square/p2/pkg/alerting"
+	"github.com/square/p2/pkg/disruption"
+	"github.com/square/p2/pkg/freeze"
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/health/checker"
 	"github.com/square/p2/pkg/logging"
@@ -68,6 +71,46 @@ type update struct {
 	// alerter allows the roll farm to page human operators if an
 	// unrecoverable problem occurs
 	alerter alerting.Alerter
+
+	// healthySince tracks when each node on the new RC was first observed
+	// to be continuously healthy, for enforcing the minimum healthy
+	// duration
+	healthySince map[types.NodeName]time.Time
+
+	// controls are checked for an operator pausing or aborting the update,
+	// and for their confirmation once a canary that requires it has soaked
+	controls Controls
+	// metricClient queries the canary's metric URL
+	metricClient *http.Client
+	// canarySoakStart is when the canary nodes were all first observed to
+	// be healthy, and is reset whenever the canary fails
+	canarySoakStart time.Time
+	// canaryPassed is set once the canary has soaked (and been confirmed,
+	// if required), after which the update proceeds on health alone
+	canaryPassed bool
+
+	// paused is set while an operator has paused the update
+	paused bool
+	// aborted is set once an operator has aborted the update
+	aborted bool
+
+	// recentlyMoved records the nodes moved to the new RC recently, for
+	// limiting NodesPerMinute
+	recentlyMoved []movedNodes
+
+	// regressedSince is when the new RC's health was first observed to be
+	// below what AutoRollback allows, and is reset when it recovers
+	regressedSince time.Time
+
+	// budgets limits how many nodes may be removed from the old RC. It may
+	// be nil, in which case no disruption budgets are enforced.
+	budgets disruption.Enforcer
+
+	// freezes hold the update while the new RC's pods are frozen. It may
+	// be nil, in which case freezes are only enforced by the preparers.
+	freezes freeze.Checker
+	// frozen is set while a freeze holds the update
+	frozen bool
 }
 
 // Create a new Update. The consul.Store, rcstore.Store, labels.Applicator and
@@ -85,11 +128,25 @@ func NewUpdate(
 	session consul.Session,
 	watchDelay time.Duration,
 	alerter alerting.Alerter,
+	controls Controls,
+	budgets disruption.Enforcer,
+	freezes freeze.Checker,
 ) Update {
 	logger = logger.SubLogger(logrus.Fields{
-		"desired_replicas": f.DesiredReplicas,
-		"minimum_replicas": f.MinimumReplicas,
+		"desired_replicas":     f.DesiredReplicas,
+		"minimum_replicas":     f.MinimumReplicas,
+		"min_healthy_duration": f.MinHealthyDuration,
+		"max_unavailable":      f.MaxUnavailable,
+		"batch_size":           f.BatchSize,
+		"nodes_per_minute":     f.NodesPerMinute,
 	})
+	if f.Canary != nil {
+		logger = logger.SubLogger(logrus.Fields{
+			"canary_replicas":              f.Canary.Replicas,
+			"canary_soak":                  f.Canary.Soak,
+			"canary_requires_confirmation": f.Canary.RequireConfirmation,
+		})
+	}
 	return &update{
 		Update:     f,
 		consuls:    consuls,
@@ -101,6 +158,11 @@ func NewUpdate(
 		session:    session,
 		watchDelay: watchDelay,
 		alerter:    alerter,
+
+		controls:     controls,
+		metricClient: &http.Client{Timeout: canaryMetricTimeout},
+		budgets:      budgets,
+		freezes:      freezes,
 	}
 }
 
@@ -186,6 +248,12 @@ func (u *update) Run(quit <-chan struct{}) (ret bool) {
 		return false
 	}
 
+	if u.aborted {
+		// an aborted update is finished once its nodes are back on
+		// the old RC, which is kept
+		return u.rollBack(newFields.Manifest.ID(), hChecks, hErrs, quit)
+	}
+
 	// rollout complete, clean up old RC if told to do so
 	if !u.LeaveOld {
 		u.cleanupOldRC(quit)
@@ -244,7 +312,7 @@ func (u *update) cleanupOldRC(quit <-chan struct{}) {
 	}
 }
 
-// returns true if roll succeeded, false if asked to quit.
+// returns true if roll succeeded or was aborted, false if asked to quit.
 func (u *update) rollLoop(podID types.PodID, hChecks <-chan map[types.NodeName]health.Result, hErrs <-chan error, quit <-chan struct{}) bool {
 	for {
 		// Select on just the quit channel before entering the select with both quit and hChecks. This protects against a situation where
@@ -278,13 +346,31 @@ func (u *update) rollLoop(podID types.PodID, hChecks <-chan map[types.NodeName]h
 				break
 			}
 
-			if nextAction := u.shouldStop(oldNodes, newNodes); nextAction == ruShouldTerminate {
+			nextAction := u.shouldStop(oldNodes, newNodes)
+			if nextAction == ruShouldTerminate {
 				u.logger.WithFields(logrus.Fields{
 					"old": oldNodes.ToString(),
 					"new": newNodes.ToString(),
 				}).Debugln("Upgrade complete")
 				return true
-			} else if nextAction == ruShouldBlock {
+			}
+
+			if u.healthRegressed(newNodes, time.Now()) {
+				return true
+			}
+
+			if u.controlHolds() {
+				if u.aborted {
+					return true
+				}
+				break
+			}
+
+			if u.freezeHolds() {
+				break
+			}
+
+			if nextAction == ruShouldBlock {
 				u.logger.WithFields(logrus.Fields{
 					"old": oldNodes.ToString(),
 					"new": newNodes.ToString(),
@@ -292,7 +378,11 @@ func (u *update) rollLoop(podID types.PodID, hChecks <-chan map[types.NodeName]h
 				break
 			}
 
-			nextRemove, nextAdd := rollAlgorithm(u.rollAlgorithmParams(oldNodes, newNodes))
+			if u.canaryHolds(newNodes) {
+				break
+			}
+
+			nextRemove, nextAdd := u.nextTransfer(oldNodes, newNodes)
 			if nextRemove > 0 || nextAdd > 0 {
 				// apply the delay only if we've already added to the new RC, since there's
 				// no value in sitting around doing nothing before anything has happened.
@@ -313,6 +403,18 @@ func (u *update) rollLoop(podID types.PodID, hChecks <-chan map[types.NodeName]h
 						u.logger.NoFields().Errorln(err)
 						break
 					}
+
+					// the update may have been paused or
+					// aborted during the delay
+					if u.controlHolds() {
+						if u.aborted {
+							return true
+						}
+						break
+					}
+					if u.freezeHolds() {
+						break
+					}
 				}
 
 				u.logger.WithFields(logrus.Fields{
@@ -335,6 +437,7 @@ func (u *update) rollLoop(podID types.PodID, hChecks <-chan map[types.NodeName]h
 					u.logger.WithError(err).Errorln("could not update RC replica counts")
 					break
 				}
+				u.recordMoved(time.Now(), nextAdd)
 			} else {
 				u.logger.WithFields(logrus.Fields{
 					"old": oldNodes.ToString(),
@@ -508,6 +611,19 @@ func (u *update) countHealthy(id rcf.ID, checks map[types.NodeName]health.Result
 
 	ret.Desired = rcFields.ReplicasDesired
 
+	// only nodes on the new RC are subject to the minimum healthy
+	// duration, the old RC's nodes are assumed to have proven themselves
+	var minHealthyDuration time.Duration
+	if id == u.NewRC {
+		minHealthyDuration = u.minHealthyDuration(rcFields.Manifest)
+	}
+	now := time.Now()
+	resetHealthySince := func(node types.NodeName) {
+		if minHealthyDuration > 0 {
+			delete(u.healthySince, node)
+		}
+	}
+
 	currentPods, err := rc.CurrentPods(id, u.labeler)
 	if err != nil {
 		return ret, err
@@ -540,23 +656,61 @@ func (u *update) countHealthy(id rcf.ID, checks map[types.NodeName]health.Result
 			ret.Real++
 		} else {
 			// don't check health if the update isn't even done there yet
+			resetHealthySince(node)
 			continue
 		}
 		if hres, ok := checks[node]; ok {
 			if hres.Status == health.Passing {
-				ret.Healthy++
+				if minHealthyDuration > 0 && !u.healthyLongEnough(node, now, minHealthyDuration) {
+					// the node hasn't been healthy for long
+					// enough to be trusted yet
+					ret.Unknown++
+				} else {
+					ret.Healthy++
+				}
 			} else if hres.Status == health.Unknown {
+				resetHealthySince(node)
 				ret.Unknown++
 			} else {
+				resetHealthySince(node)
 				ret.Unhealthy++
 			}
 		} else {
+			resetHealthySince(node)
 			ret.Unknown++
 		}
 	}
 	return ret, err
 }
 
+// minHealthyDuration returns the minimum healthy duration for the update. A
+// value set on the update itself takes precedence over the one declared by
+// the manifest.
+func (u *update) minHealthyDuration(man manifest.Manifest) time.Duration {
+	if u.MinHealthyDuration > 0 {
+		return u.MinHealthyDuration
+	}
+	if man == nil {
+		return 0
+	}
+	return man.GetMinHealthyDuration()
+}
+
+// healthyLongEnough records that the node is currently healthy and returns
+// true if it has been continuously healthy for at least minHealthyDuration
+func (u *update) healthyLongEnough(node types.NodeName, now time.Time, minHealthyDuration time.Duration) bool {
+	if u.healthySince == nil {
+		u.healthySince = make(map[types.NodeName]time.Time)
+	}
+
+	since, ok := u.healthySince[node]
+	if !ok {
+		u.healthySince[node] = now
+		since = now
+	}
+	return now.Sub(since) >= minHealthyDuration
+}
+
 func (u *update) shouldRollAfterDelay(podID types.PodID) (int, int, error) {
 	// Check health again following the roll delay. If things have gotten
 	// worse since we last looked, or there is an error, we break this iteration.
@@ -575,7 +729,7 @@ func (u *update) shouldRollAfterDelay(podID types.PodID) (int, int, error) {
 		return 0, 0, util.Errorf("Could not determine old service health: %v", err)
 	}
 
-	afterDelayRemove, afterDelayAdd := rollAlgorithm(u.rollAlgorithmParams(afterDelayOld, afterDelayNew))
+	afterDelayRemove, afterDelayAdd := u.nextTransfer(afterDelayOld, afterDelayNew)
 
 	if afterDelayRemove <= 0 && afterDelayAdd <= 0 {
 		return 0, 0, util.Errorf("No nodes can be safely updated after %v roll delay, will wait again", u.RollDelay)
@@ -584,6 +738,42 @@ func (u *update) shouldRollAfterDelay(podID types.PodID) (int, int, error) {
 	return afterDelayRemove, afterDelayAdd, nil
 }
 
+// nextTransfer returns the number of nodes to remove from the old RC and to
+// add to the new one, paced according to the update's Pacing, within the
+// disruption budgets and without going past the canary if it hasn't passed yet
+func (u *update) nextTransfer(oldNodes, newNodes rcNodeCounts) (int, int) {
+	nextRemove, nextAdd := rollAlgorithm(u.rollAlgorithmParams(oldNodes, newNodes))
+	nextRemove, nextAdd = u.pace(newNodes, time.Now(), nextRemove, nextAdd)
+	nextRemove, nextAdd = u.withinBudgets(nextRemove, nextAdd)
+	return u.capToCanary(newNodes.Desired, nextRemove, nextAdd)
+}
+
+// withinBudgets reduces the number of nodes to remove from the old RC to as
+// many as the disruption budgets allow, and the number to add to the new RC by
+// as much, so that the update doesn't grow past the nodes it can move. The old
+// RC checks the budgets again when it unschedules, since it picks the nodes.
+func (u *update) withinBudgets(nextRemove, nextAdd int) (int, int) {
+	if u.budgets == nil || nextRemove <= 0 {
+		return nextRemove, nextAdd
+	}
+	oldPods, err := rc.CurrentPods(u.OldRC, u.labeler)
+	if err != nil {
+		u.logger.WithError(err).Errorln("Could not list old RC's pods to check disruption budgets")
+		return 0, 0
+	}
+	removable, err := u.budgets.Removable(oldPods, nextRemove)
+	if err != nil {
+		u.logger.WithError(err).Errorln("Could not check disruption budgets")
+		return 0, 0
+	}
+	if held := nextRemove - len(removable); held > 0 {
+		u.logger.WithField("held", held).Infoln("Disruption budgets are holding back nodes of the old RC")
+		nextRemove -= held
+		nextAdd = clampToZero(nextAdd - held)
+	}
+	return nextRemove, nextAdd
+}
+
 func (u *update) rollAlgorithmParams(oldHealth, newHealth rcNodeCounts) (oldHealthy, newHealthy, oldDesired, newDesired, targetDesired, minHealthy int) {
 	oldHealthy = oldHealth.Healthy
 	if oldHealth.Desired < oldHealthy {
@@ -601,7 +791,7 @@ func (u *update) rollAlgorithmParams(oldHealth, newHealth rcNodeCounts) (oldHeal
 	oldDesired = oldHealth.Desired
 	newDesired = newHealth.Desired
 	targetDesired = u.DesiredReplicas
-	minHealthy = u.MinimumReplicas
+	minHealthy = u.minimumHealthy()
 	return
 }
 
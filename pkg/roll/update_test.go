@@ -3,10 +3,15 @@ package roll
 import (
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/square/p2/pkg/alerting/alertingtest"
+	"github.com/square/p2/pkg/freeze"
+	freeze_fields "github.com/square/p2/pkg/freeze/fields"
 	"github.com/square/p2/pkg/health"
 	checkertest "github.com/square/p2/pkg/health/checker/test"
 	"github.com/square/p2/pkg/labels"
@@ -201,6 +206,9 @@ func TestLockRCs(t *testing.T) {
 		session,
 		0,
 		nil,
+		nil,
+		nil,
+		nil,
 	).(*update)
 	err = update.lockRCs(make(<-chan struct{}))
 	Assert(t).IsNil(err, "should not have erred locking RCs")
@@ -547,6 +555,283 @@ func TestCountHealthNonCurrent(t *testing.T) {
 	Assert(t).AreEqual(counts, expected, "incorrect health counts")
 }
 
+func TestCountHealthMinHealthyDuration(t *testing.T) {
+	newNodes := map[types.NodeName]bool{"node1": true, "node2": true}
+	upd, _, _, _ := updateWithHealth(t, 0, 2, nil, newNodes, nil)
+	upd.MinHealthyDuration = time.Hour
+	checks := map[types.NodeName]health.Result{
+		"node1": {Status: health.Passing},
+		"node2": {Status: health.Passing},
+	}
+
+	counts, err := upd.countHealthy(upd.NewRC, checks)
+	Assert(t).IsNil(err, "expected no error counting health")
+	expected := rcNodeCounts{
+		Desired: 2,
+		Current: 2,
+		Real:    2,
+		Unknown: 2,
+	}
+	Assert(t).AreEqual(counts, expected, "nodes that were just observed healthy should not count as healthy")
+
+	// pretend node1 has been healthy for longer than the minimum
+	upd.healthySince["node1"] = time.Now().Add(-2 * time.Hour)
+	counts, err = upd.countHealthy(upd.NewRC, checks)
+	Assert(t).IsNil(err, "expected no error counting health")
+	expected = rcNodeCounts{
+		Desired: 2,
+		Current: 2,
+		Real:    2,
+		Healthy: 1,
+		Unknown: 1,
+	}
+	Assert(t).AreEqual(counts, expected, "node healthy for the minimum duration should count as healthy")
+
+	// a single failed check resets the clock
+	checks["node1"] = health.Result{Status: health.Critical}
+	_, err = upd.countHealthy(upd.NewRC, checks)
+	Assert(t).IsNil(err, "expected no error counting health")
+	checks["node1"] = health.Result{Status: health.Passing}
+	counts, err = upd.countHealthy(upd.NewRC, checks)
+	Assert(t).IsNil(err, "expected no error counting health")
+	Assert(t).AreEqual(counts.Healthy, 0, "node that became unhealthy should have to prove itself again")
+}
+
+func TestCountHealthMinHealthyDurationIgnoresOldRC(t *testing.T) {
+	upd, checks := updateWithUniformHealth(t, 3, health.Passing)
+	upd.MinHealthyDuration = time.Hour
+	counts, err := upd.countHealthy(upd.OldRC, checks)
+	Assert(t).IsNil(err, "expected no error counting health")
+	Assert(t).AreEqual(counts.Healthy, 3, "old RC nodes should not be subject to the minimum healthy duration")
+}
+
+type fakeControls struct {
+	confirmed bool
+	control   fields.Control
+}
+
+func (f fakeControls) CanaryConfirmed(id fields.ID) (bool, error) {
+	return f.confirmed, nil
+}
+
+func (f fakeControls) Control(id fields.ID) (fields.Control, error) {
+	return f.control, nil
+}
+
+func (f fakeControls) SetControl(id fields.ID, control fields.Control) error {
+	return nil
+}
+
+func TestCanaryHoldsUntilSoaked(t *testing.T) {
+	upd := &update{
+		Update: fields.Update{
+			NewRC:           "new_rc",
+			DesiredReplicas: 10,
+			Canary:          &fields.Canary{Replicas: 2, Soak: time.Hour},
+		},
+		logger: logging.DefaultLogger,
+	}
+
+	remove, add := upd.capToCanary(0, 5, 5)
+	Assert(t).AreEqual(add, 2, "should not add more nodes than the canary")
+	Assert(t).AreEqual(remove, 2, "should remove as many nodes as were added")
+	Assert(t).IsFalse(upd.canaryHolds(rcNodeCounts{Desired: 1, Healthy: 1}), "should not hold while the canary nodes are being updated")
+
+	Assert(t).IsTrue(upd.canaryHolds(rcNodeCounts{Desired: 2, Healthy: 1}), "should hold while the canary is unhealthy")
+	Assert(t).IsTrue(upd.canarySoakStart.IsZero(), "should not soak an unhealthy canary")
+	Assert(t).IsTrue(upd.canaryHolds(rcNodeCounts{Desired: 2, Healthy: 2}), "should hold while the canary soaks")
+	Assert(t).IsFalse(upd.canarySoakStart.IsZero(), "should have started soaking the healthy canary")
+
+	upd.canarySoakStart = time.Now().Add(-2 * time.Hour)
+	Assert(t).IsTrue(upd.canaryHolds(rcNodeCounts{Desired: 2, Healthy: 1}), "should hold if the canary fails during the soak")
+	Assert(t).IsTrue(upd.canarySoakStart.IsZero(), "should restart the soak when the canary fails")
+
+	upd.canarySoakStart = time.Now().Add(-2 * time.Hour)
+	Assert(t).IsFalse(upd.canaryHolds(rcNodeCounts{Desired: 2, Healthy: 2}), "should proceed once the canary has soaked")
+	remove, add = upd.capToCanary(2, 5, 5)
+	Assert(t).AreEqual(add, 5, "should not limit the update after the canary passed")
+	Assert(t).AreEqual(remove, 5, "should not limit the update after the canary passed")
+}
+
+func TestCanaryRequiresConfirmationAndMetric(t *testing.T) {
+	metricStatus := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(metricStatus)
+	}))
+	defer ts.Close()
+
+	upd := &update{
+		Update: fields.Update{
+			NewRC:           "new_rc",
+			DesiredReplicas: 10,
+			Canary:          &fields.Canary{Replicas: 2, MetricURL: ts.URL, RequireConfirmation: true},
+		},
+		logger:   logging.DefaultLogger,
+		controls: fakeControls{},
+	}
+	healthy := rcNodeCounts{Desired: 2, Healthy: 2}
+
+	metricStatus = http.StatusInternalServerError
+	Assert(t).IsTrue(upd.canaryHolds(healthy), "should hold while the canary metric fails")
+	Assert(t).IsTrue(upd.canarySoakStart.IsZero(), "should not soak while the canary metric fails")
+
+	metricStatus = http.StatusOK
+	Assert(t).IsTrue(upd.canaryHolds(healthy), "should hold until the canary is confirmed")
+	upd.controls = fakeControls{confirmed: true}
+	Assert(t).IsFalse(upd.canaryHolds(healthy), "should proceed once the canary is confirmed")
+
+	resumed := &update{
+		Update: fields.Update{Canary: &fields.Canary{Replicas: 2, RequireConfirmation: true}},
+		logger: logging.DefaultLogger,
+	}
+	Assert(t).IsFalse(resumed.canaryHolds(rcNodeCounts{Desired: 3}), "should not hold an update resumed past its canary")
+}
+
+func TestPacing(t *testing.T) {
+	upd := &update{Update: fields.Update{DesiredReplicas: 10, MinimumReplicas: 5}}
+	Assert(t).AreEqual(upd.minimumHealthy(), 5, "should use the minimum replicas without max unavailable")
+	upd.MaxUnavailable = 2
+	Assert(t).AreEqual(upd.minimumHealthy(), 8, "should keep all but max unavailable healthy")
+	upd.MaxUnavailable = 7
+	Assert(t).AreEqual(upd.minimumHealthy(), 5, "should never go below the minimum replicas")
+
+	upd.BatchSize = 3
+	now := time.Now()
+	remove, add := upd.pace(rcNodeCounts{Desired: 3, Healthy: 2}, now, 5, 5)
+	Assert(t).AreEqual(add, 0, "should wait for the previous batch to become healthy")
+	Assert(t).AreEqual(remove, 0, "should wait for the previous batch to become healthy")
+	remove, add = upd.pace(rcNodeCounts{Desired: 3, Healthy: 3}, now, 5, 5)
+	Assert(t).AreEqual(add, 3, "should limit the batch size")
+	Assert(t).AreEqual(remove, 3, "should remove as many nodes as were added")
+
+	upd.BatchSize = 0
+	upd.NodesPerMinute = 4
+	upd.recordMoved(now.Add(-2*time.Minute), 4)
+	upd.recordMoved(now.Add(-30*time.Second), 3)
+	remove, add = upd.pace(rcNodeCounts{}, now, 5, 5)
+	Assert(t).AreEqual(add, 1, "should only count the nodes moved in the last minute")
+	Assert(t).AreEqual(remove, 1, "should remove as many nodes as were added")
+	remove, add = upd.pace(rcNodeCounts{}, now.Add(time.Minute), 5, 5)
+	Assert(t).AreEqual(add, 4, "should allow the full rate once the window has passed")
+}
+
+// budgetAllowing is a disruption.Enforcer that allows removing a fixed number
+// of pods
+type budgetAllowing int
+
+func (n budgetAllowing) Removable(candidates types.PodLocations, max int) (types.PodLocations, error) {
+	if max > int(n) {
+		max = int(n)
+	}
+	return candidates[:max], nil
+}
+
+func TestWithinBudgets(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	for _, node := range []string{"node1", "node2", "node3"} {
+		err := applicator.SetLabel(labels.POD, node+"/some_pod", rc.RCIDLabel, "old_rc")
+		Assert(t).IsNil(err, "test setup: could not label pod")
+	}
+	upd := &update{
+		Update:  fields.Update{OldRC: "old_rc", NewRC: "new_rc"},
+		labeler: applicator,
+		logger:  logging.DefaultLogger,
+	}
+
+	remove, add := upd.withinBudgets(3, 3)
+	Assert(t).AreEqual(remove, 3, "should not limit removals without budgets")
+	Assert(t).AreEqual(add, 3, "should not limit additions without budgets")
+
+	upd.budgets = budgetAllowing(1)
+	remove, add = upd.withinBudgets(3, 3)
+	Assert(t).AreEqual(remove, 1, "should only remove as many nodes as the budgets allow")
+	Assert(t).AreEqual(add, 1, "should add as many nodes as were removed")
+	remove, add = upd.withinBudgets(2, 3)
+	Assert(t).AreEqual(remove, 1, "should only remove as many nodes as the budgets allow")
+	Assert(t).AreEqual(add, 2, "should keep the capacity increase")
+}
+
+func TestHealthRegressedAbortsAfterGracePeriod(t *testing.T) {
+	alerter := alertingtest.NewRecorder()
+	upd := &update{
+		Update: fields.Update{
+			NewRC:        "new_rc",
+			AutoRollback: &fields.AutoRollback{MinHealthyFraction: 0.5, GracePeriod: time.Minute},
+		},
+		logger:  logging.DefaultLogger,
+		alerter: alerter,
+	}
+	now := time.Now()
+
+	Assert(t).IsFalse(upd.healthRegressed(rcNodeCounts{Real: 4, Healthy: 1, Unknown: 3}, now), "nodes of unknown health should not count against the update")
+	Assert(t).IsFalse(upd.healthRegressed(rcNodeCounts{Real: 4, Healthy: 1, Unhealthy: 3}, now), "should wait out the grace period")
+	Assert(t).IsFalse(upd.healthRegressed(rcNodeCounts{Real: 4, Healthy: 2, Unhealthy: 2}, now.Add(2*time.Minute)), "should not abort once the health recovered")
+	Assert(t).IsFalse(upd.healthRegressed(rcNodeCounts{Real: 4, Healthy: 1, Unhealthy: 3}, now.Add(3*time.Minute)), "should restart the grace period after recovering")
+	Assert(t).IsFalse(upd.aborted, "should not have aborted yet")
+
+	Assert(t).IsTrue(upd.healthRegressed(rcNodeCounts{Real: 4, Healthy: 1, Unhealthy: 3}, now.Add(5*time.Minute)), "should abort after the grace period")
+	Assert(t).IsTrue(upd.aborted, "should have recorded that the update was aborted")
+	Assert(t).AreEqual(len(alerter.Alerts), 1, "should have alerted about the roll back")
+}
+
+func TestControlHolds(t *testing.T) {
+	upd := &update{
+		Update: fields.Update{NewRC: "new_rc"},
+		logger: logging.DefaultLogger,
+	}
+	Assert(t).IsFalse(upd.controlHolds(), "should not hold an update without controls")
+
+	upd.controls = fakeControls{control: fields.ControlPause}
+	Assert(t).IsTrue(upd.controlHolds(), "should hold a paused update")
+	Assert(t).IsTrue(upd.paused, "should have recorded that the update is paused")
+
+	upd.controls = fakeControls{}
+	Assert(t).IsFalse(upd.controlHolds(), "should proceed once the update is resumed")
+	Assert(t).IsFalse(upd.paused, "should have recorded that the update was resumed")
+
+	upd.controls = fakeControls{control: fields.ControlAbort}
+	Assert(t).IsTrue(upd.controlHolds(), "should hold an aborted update")
+	Assert(t).IsTrue(upd.aborted, "should have recorded that the update was aborted")
+}
+
+type fakeFreezes []freeze_fields.Freeze
+
+func (f fakeFreezes) List() ([]freeze_fields.Freeze, error) {
+	return f, nil
+}
+
+func TestFreezeHolds(t *testing.T) {
+	rcs := rcstore.NewFake()
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	newRC, err := rcs.Create(builder.GetManifest(), nil, "az1", "prod", klabels.Set{
+		types.AvailabilityZoneLabel: "az1",
+		types.ClusterNameLabel:      "prod",
+	}, nil)
+	Assert(t).IsNil(err, "test setup: could not create RC")
+
+	upd := &update{
+		Update:  fields.Update{NewRC: newRC.ID},
+		rcStore: rcs,
+		logger:  logging.DefaultLogger,
+	}
+	Assert(t).IsFalse(upd.freezeHolds(), "should not hold an update without freezes")
+
+	upd.freezes = freeze.NewChecker(fakeFreezes{
+		{ID: "rack", NodeSelector: "rack=r1"},
+	})
+	Assert(t).IsFalse(upd.freezeHolds(), "should leave node freezes to the preparers")
+
+	upd.freezes = freeze.NewChecker(fakeFreezes{
+		{ID: "web", PodCluster: &freeze_fields.PodCluster{PodID: "web", AvailabilityZone: "az1", ClusterName: "prod"}},
+	})
+	Assert(t).IsTrue(upd.freezeHolds(), "should hold an update of a frozen pod cluster")
+	Assert(t).IsTrue(upd.frozen, "should have recorded that the update is frozen")
+
+	upd.Emergency = true
+	Assert(t).IsFalse(upd.freezeHolds(), "should not hold an emergency update")
+}
+
 func (u *update) uniformShouldRollAfterDelay(t *testing.T, podID types.PodID) (int, error) {
 	remove, add, err := u.shouldRollAfterDelay(podID)
 	Assert(t).AreEqual(remove, add, "expected nodes removed and nodes added to be equal")
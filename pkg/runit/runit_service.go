@@ -21,6 +21,9 @@ type SV interface {
 	Stat(service *Service) (*StatResult, error)
 	Restart(service *Service, timeout time.Duration) (string, error)
 	Once(service *Service) (string, error)
+	// Signal sends one of the control commands in ReloadCommands to the
+	// service's process
+	Signal(service *Service, command string) (string, error)
 }
 
 type sv struct {
@@ -68,6 +71,21 @@ var (
 	Killed                       = errors.New("The process was forcibly killed")
 )
 
+// ReloadCommands are the sv control commands that signal a service's process
+// without stopping it, and so can be used to ask it to reload its
+// configuration. "1" and "2" send USR1 and USR2.
+var ReloadCommands = []string{"hup", "alarm", "interrupt", "quit", "1", "2"}
+
+// IsReloadCommand returns true if command is one of ReloadCommands
+func IsReloadCommand(command string) bool {
+	for _, reloadCommand := range ReloadCommands {
+		if command == reloadCommand {
+			return true
+		}
+	}
+	return false
+}
+
 const DefaultTimeout = 7 * time.Second // This is runit's default wait period for commands that stop a process
 
 func (sv *sv) waitForSupervision(service *Service) error {
@@ -145,6 +163,13 @@ func (sv *sv) Once(service *Service) (string, error) {
 	return sv.execCmd(service, "once")
 }
 
+func (sv *sv) Signal(service *Service, command string) (string, error) {
+	if !IsReloadCommand(command) {
+		return "", util.Errorf("%q is not a signal command, must be one of %v", command, ReloadCommands)
+	}
+	return convertToErr(sv.execOnService(service, command))
+}
+
 func outToStatResult(out string) (*StatResult, error) {
 	matches := statOutput.FindStringSubmatch(out)
 	if matches == nil || len(matches) < 8 {
@@ -41,6 +41,24 @@ func TestRunitServicesCanBeOnced(t *testing.T) {
 	Assert(t).AreEqual(out, fmt.Sprintf("once %s\n", service.Path), "Did not 'once' service with correct arguments")
 }
 
+func TestRunitServicesCanBeSignaled(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "runit_service")
+	os.MkdirAll(filepath.Join(tmpdir, "supervise"), 0644)
+
+	Assert(t).IsNil(err, "test setup should have created a tmpdir")
+
+	defer os.RemoveAll(tmpdir)
+
+	sv := FakeSV()
+	service := &Service{tmpdir, "foo"}
+	out, err := sv.Signal(service, "hup")
+	Assert(t).IsNil(err, "There should not have been an error signaling the service")
+	Assert(t).AreEqual(out, fmt.Sprintf("hup %s\n", service.Path), "Did not signal service with correct arguments")
+
+	_, err = sv.Signal(service, "kill")
+	Assert(t).IsNotNil(err, "Should not have been able to use a command that stops the service as a signal")
+}
+
 func TestErrorReturnedIfRunitServiceBails(t *testing.T) {
 	tmpdir, err := ioutil.TempDir("", "runit_service")
 	os.MkdirAll(filepath.Join(tmpdir, "supervise"), 0644)
@@ -57,6 +57,15 @@ func DefaultLogExec() []string {
 	return append([]string{p2exec.DefaultP2Exec}, args...)
 }
 
+// UnprivilegedLogExec is the log exec of services supervised by a user
+// without root, which can't switch to nobody, so svlogd runs as that user.
+func UnprivilegedLogExec() []string {
+	args := p2exec.P2ExecArgs{
+		Command: []string{"svlogd", "-tt", "./main"},
+	}.CommandLine()
+	return append([]string{p2exec.DefaultP2Exec}, args...)
+}
+
 type ServiceTemplate struct {
 	Run      []string `yaml:"run"`
 	Log      []string `yaml:"log,omitempty"`
@@ -151,12 +160,30 @@ type ServiceBuilder struct {
 	RunitRoot   string // directory of runsvdir
 	Bin         string
 
+	// Backend, if set, runs the services instead of runit. The templates
+	// are still written to ConfigRoot, which records the services that
+	// should exist.
+	Backend ServiceBackend
+
+	// Unprivileged is set for services staged by a user without root,
+	// whose log directories are left owned by that user instead of nobody
+	Unprivileged bool
+
 	// testingNoChown should be set during unit tests to prevent the chown() operation when
 	// staging a service. Unit tests run as normal users, not root, so the chown() will fail
 	// without allowing for any tests to run.
 	testingNoChown bool
 }
 
+// ServiceBackend runs the services described by servicebuilder templates
+// with a supervisor other than runit, such as systemd
+type ServiceBackend interface {
+	// Activate creates or updates the given services
+	Activate(templates map[string]ServiceTemplate) error
+	// Prune removes every service that isn't one of the given services
+	Prune(templates map[string]ServiceTemplate) error
+}
+
 var DefaultBuilder = &ServiceBuilder{
 	ConfigRoot:  "/etc/servicebuilder.d",
 	StagingRoot: "/var/service-stage",
@@ -164,6 +191,18 @@ var DefaultBuilder = &ServiceBuilder{
 	Bin:         "/usr/bin/servicebuilder",
 }
 
+// UserBuilder returns a ServiceBuilder whose directories are all under root,
+// for a runsvdir run by an unprivileged user on root/service.
+func UserBuilder(root string) *ServiceBuilder {
+	return &ServiceBuilder{
+		ConfigRoot:   filepath.Join(root, "servicebuilder.d"),
+		StagingRoot:  filepath.Join(root, "service-stage"),
+		RunitRoot:    filepath.Join(root, "service"),
+		Bin:          DefaultBuilder.Bin,
+		Unprivileged: true,
+	}
+}
+
 // DefaultChpst is the path to the default chpst binary. Specified as a var so you
 // can override at build time.
 var DefaultChpst = "/usr/bin/chpst"
@@ -219,7 +258,7 @@ func (s *ServiceBuilder) stage(templates map[string]ServiceTemplate) error {
 		logMainDir := filepath.Join(logDir, "main")
 		err = os.Mkdir(logMainDir, 0755)
 		if err == nil {
-			if !s.testingNoChown {
+			if !s.testingNoChown && !s.Unprivileged {
 				err = os.Chown(logMainDir, int(nobodyUid), int(nobodyGid))
 				if err != nil {
 					return err
@@ -321,6 +360,9 @@ func (s *ServiceBuilder) Activate(name string, templates map[string]ServiceTempl
 	if err := s.write(filepath.Join(s.ConfigRoot, name+".yaml"), templates); err != nil {
 		return err
 	}
+	if s.Backend != nil {
+		return s.Backend.Activate(templates)
+	}
 	if err := s.stage(templates); err != nil {
 		return err
 	}
@@ -337,6 +379,9 @@ func (s *ServiceBuilder) Prune() error {
 	if err != nil {
 		return err
 	}
+	if s.Backend != nil {
+		return s.Backend.Prune(configs)
+	}
 
 	links, err := ioutil.ReadDir(s.RunitRoot)
 	if err != nil {
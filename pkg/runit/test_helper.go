@@ -51,6 +51,9 @@ func (r *RecordingSV) Restart(service *Service, timeout time.Duration) (string,
 func (r *RecordingSV) Once(service *Service) (string, error) {
 	return r.recordCommand("once")
 }
+func (r *RecordingSV) Signal(service *Service, command string) (string, error) {
+	return r.recordCommand(command)
+}
 
 func FakeChpst() string {
 	return util.From(runtime.Caller(0)).ExpandPath("fake_chpst")
@@ -3,7 +3,15 @@
 package schedule
 
 import (
+	"sort"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
 )
 
 // Defines the JSON structure of the output of p2-schedule
@@ -11,3 +19,93 @@ type Output struct {
 	PodID        types.PodID        `json:"pod_id"`
 	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key"`
 }
+
+// Defines the JSON structure of the output of p2-schedule when scheduling on
+// the nodes matching a node selector
+type BulkOutput struct {
+	PodID    types.PodID   `json:"pod_id"`
+	Selector string        `json:"selector"`
+	Nodes    []NodeOutcome `json:"nodes"`
+}
+
+// NodeOutcome is whether a pod was scheduled on one node
+type NodeOutcome struct {
+	Node types.NodeName `json:"node"`
+	// Empty if the pod was scheduled
+	Error string `json:"error,omitempty"`
+}
+
+// Failed returns the nodes the pod could not be scheduled on
+func (b BulkOutput) Failed() []NodeOutcome {
+	var failed []NodeOutcome
+	for _, outcome := range b.Nodes {
+		if outcome.Error != "" {
+			failed = append(failed, outcome)
+		}
+	}
+	return failed
+}
+
+// NodeMatcher is the part of labels.ApplicatorWithoutWatches used to find the
+// nodes matching a selector
+type NodeMatcher interface {
+	GetMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error)
+}
+
+// PodScheduler is the part of consul.Store used to schedule a pod
+type PodScheduler interface {
+	SchedulePod(
+		labeler consul.PodLabeler,
+		auditLogger consul.AuditLogger,
+		node types.NodeName,
+		manifest manifest.Manifest,
+		podLabels map[string]string,
+		user string,
+	) error
+}
+
+// SelectNodes returns the names of the nodes whose labels match selector, in
+// order
+func SelectNodes(matcher NodeMatcher, selector klabels.Selector) ([]types.NodeName, error) {
+	matches, err := matcher.GetMatches(selector, labels.NODE)
+	if err != nil {
+		return nil, util.Errorf("Could not find the nodes matching %s: %s", selector, err)
+	}
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = match.ID
+	}
+	sort.Strings(names)
+	nodes := make([]types.NodeName, len(names))
+	for i, name := range names {
+		nodes[i] = types.NodeName(name)
+	}
+	return nodes, nil
+}
+
+// ScheduleOnNodes schedules manifest on each of nodes with
+// PodScheduler.SchedulePod, so that on each node the intent, podLabels and the
+// audit record (if auditLogger is not nil) are written in one transaction.
+// Consul transactions are too small to hold every node's, so each node is
+// scheduled in its own transaction, and a node that fails doesn't stop the
+// others from being scheduled. The outcome on each node is returned in the
+// order of nodes.
+func ScheduleOnNodes(
+	scheduler PodScheduler,
+	labeler consul.PodLabeler,
+	auditLogger consul.AuditLogger,
+	nodes []types.NodeName,
+	manifest manifest.Manifest,
+	podLabels map[string]string,
+	user string,
+) []NodeOutcome {
+	outcomes := make([]NodeOutcome, len(nodes))
+	for i, node := range nodes {
+		outcomes[i].Node = node
+		err := scheduler.SchedulePod(labeler, auditLogger, node, manifest, podLabels, user)
+		if err != nil {
+			outcomes[i].Error = err.Error()
+		}
+	}
+	return outcomes
+}
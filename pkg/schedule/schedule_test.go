@@ -0,0 +1,66 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type fakeScheduler struct {
+	scheduled []string
+	failOn    types.NodeName
+}
+
+func (f *fakeScheduler) SchedulePod(
+	_ consul.PodLabeler,
+	_ consul.AuditLogger,
+	node types.NodeName,
+	manifest manifest.Manifest,
+	podLabels map[string]string,
+	_ string,
+) error {
+	if node == f.failOn {
+		return util.Errorf("transaction was rolled back")
+	}
+	f.scheduled = append(f.scheduled, node.String()+"/"+manifest.ID().String()+"/"+podLabels["app"])
+	return nil
+}
+
+func TestScheduleOnSelectedNodes(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	for node, az := range map[string]string{"node3": "a", "node1": "a", "node2": "b", "node4": "a"} {
+		err := applicator.SetLabel(labels.NODE, node, "az", az)
+		Assert(t).IsNil(err, "could not label node")
+	}
+	selector, err := klabels.Parse("az=a")
+	Assert(t).IsNil(err, "could not parse selector")
+
+	nodes, err := SelectNodes(applicator, selector)
+	Assert(t).IsNil(err, "should have selected nodes")
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.String()
+	}
+	Assert(t).AreEqual(strings.Join(names, ","), "node1,node3,node4", "unexpected nodes selected")
+
+	builder := manifest.NewBuilder()
+	builder.SetID("web")
+	scheduler := &fakeScheduler{failOn: "node3"}
+	out := BulkOutput{
+		Nodes: ScheduleOnNodes(scheduler, applicator, nil, nodes, builder.GetManifest(), map[string]string{"app": "web"}, "deployer"),
+	}
+	Assert(t).AreEqual(strings.Join(scheduler.scheduled, ","), "node1/web/web,node4/web/web", "should have scheduled on the other nodes despite the failure")
+	Assert(t).AreEqual(len(out.Nodes), 3, "should have reported every node")
+	Assert(t).AreEqual(out.Nodes[1].Node, types.NodeName("node3"), "should have reported nodes in order")
+	failed := out.Failed()
+	Assert(t).AreEqual(len(failed), 1, "should have reported one failure")
+	Assert(t).AreEqual(failed[0].Node, types.NodeName("node3"), "should have reported the failed node")
+}
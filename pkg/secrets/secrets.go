@@ -0,0 +1,139 @@
+// Package secrets fetches the secrets that pod manifests reference, so that the
+// preparer can give them to pods without them being written into the pods'
+// config in the clear.
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// ConsulTree is the consul subtree that ConsulSource reads secrets from.
+const ConsulTree = "secrets"
+
+// Source fetches secrets by the paths that manifests reference them by.
+type Source interface {
+	Secret(path string) ([]byte, error)
+}
+
+// NotFoundError is returned by a Source when no secret exists at a path.
+type NotFoundError struct {
+	Path string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("no secret found at %q", e.Path)
+}
+
+// ConsulSource reads secrets from the secrets subtree of consul. If Keyring is
+// set, the values are expected to be encrypted to one of its private keys,
+// either binary or ASCII-armored, so that the secrets can't be read by
+// whoever can read the consul cluster.
+type ConsulSource struct {
+	KV      consulutil.ConsulKVClient
+	Keyring openpgp.EntityList
+}
+
+var _ Source = ConsulSource{}
+
+func (s ConsulSource) Secret(secretPath string) ([]byte, error) {
+	pair, _, err := s.KV.Get(path.Join(ConsulTree, secretPath), &api.QueryOptions{RequireConsistent: true})
+	if err != nil {
+		return nil, consulutil.NewKVError("get", path.Join(ConsulTree, secretPath), err)
+	}
+	if pair == nil {
+		return nil, NotFoundError{secretPath}
+	}
+	if s.Keyring == nil {
+		return pair.Value, nil
+	}
+	return decrypt(pair.Value, s.Keyring)
+}
+
+func decrypt(ciphertext []byte, keyring openpgp.EntityList) ([]byte, error) {
+	if block, err := armor.Decode(bytes.NewReader(ciphertext)); err == nil {
+		ciphertext, err = ioutil.ReadAll(block.Body)
+		if err != nil {
+			return nil, util.Errorf("Could not read armored secret: %s", err)
+		}
+	}
+	message, err := openpgp.ReadMessage(bytes.NewReader(ciphertext), keyring, nil, nil)
+	if err != nil {
+		return nil, util.Errorf("Could not decrypt secret: %s", err)
+	}
+	plaintext, err := ioutil.ReadAll(message.UnverifiedBody)
+	if err != nil {
+		return nil, util.Errorf("Could not decrypt secret: %s", err)
+	}
+	return plaintext, nil
+}
+
+// VaultSource reads secrets from a Vault server's key/value secrets engine.
+// Paths name a secret and, after a "#", the key of its data to read, e.g.
+// "secret/myapp/db#password". The key defaults to "value". Secrets of both
+// versions of the engine can be read.
+type VaultSource struct {
+	Client  *http.Client
+	Address string // e.g. https://vault.example.com:8200
+	Token   string
+}
+
+var _ Source = VaultSource{}
+
+func (s VaultSource) Secret(secretPath string) ([]byte, error) {
+	vaultPath, key := secretPath, "value"
+	if i := strings.LastIndex(secretPath, "#"); i >= 0 {
+		vaultPath, key = secretPath[:i], secretPath[i+1:]
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(s.Address, "/")+"/v1/"+strings.TrimPrefix(vaultPath, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, util.Errorf("Could not read secret %q from vault: %s", vaultPath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, NotFoundError{secretPath}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, util.Errorf("Could not read secret %q from vault: server returned status %s", vaultPath, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, util.Errorf("Could not parse secret %q from vault: %s", vaultPath, err)
+	}
+	data := body.Data
+	// version 2 of the engine nests the data with its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+	value, ok := data[key]
+	if !ok {
+		return nil, NotFoundError{secretPath}
+	}
+	if str, ok := value.(string); ok {
+		return []byte(str), nil
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/hashicorp/consul/api"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestConsulSourceDecryptsSecrets(t *testing.T) {
+	entity, err := openpgp.NewEntity("p2", "secrets", "p2@example.com", nil)
+	Assert(t).IsNil(err, "could not create test key")
+	for _, identity := range entity.Identities {
+		// SHA256, since the default candidates include hashes that aren't
+		// compiled in
+		identity.SelfSignature.PreferredHash = []uint8{8}
+	}
+	var ciphertext bytes.Buffer
+	plaintext, err := openpgp.Encrypt(&ciphertext, []*openpgp.Entity{entity}, nil, nil, nil)
+	Assert(t).IsNil(err, "could not encrypt test secret")
+	_, err = plaintext.Write([]byte("hunter2"))
+	Assert(t).IsNil(err, "could not encrypt test secret")
+	Assert(t).IsNil(plaintext.Close(), "could not encrypt test secret")
+
+	kv := consulutil.NewKVWithEntries(map[string]*api.KVPair{
+		"secrets/myapp/plain":     {Key: "secrets/myapp/plain", Value: []byte("swordfish")},
+		"secrets/myapp/encrypted": {Key: "secrets/myapp/encrypted", Value: ciphertext.Bytes()},
+	})
+
+	value, err := ConsulSource{KV: kv}.Secret("myapp/plain")
+	Assert(t).IsNil(err, "should have read the secret")
+	Assert(t).AreEqual(string(value), "swordfish", "unexpected secret")
+
+	value, err = ConsulSource{KV: kv, Keyring: openpgp.EntityList{entity}}.Secret("myapp/encrypted")
+	Assert(t).IsNil(err, "should have decrypted the secret")
+	Assert(t).AreEqual(string(value), "hunter2", "unexpected secret")
+
+	_, err = ConsulSource{KV: kv}.Secret("myapp/missing")
+	_, ok := err.(NotFoundError)
+	Assert(t).IsTrue(ok, "should have returned a NotFoundError")
+}
+
+func TestVaultSourceReadsBothEngineVersions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "the-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/myapp":
+			_, _ = w.Write([]byte(`{"data": {"value": "swordfish", "password": "hunter2"}}`))
+		case "/v1/kv/data/myapp":
+			_, _ = w.Write([]byte(`{"data": {"data": {"value": "v2"}, "metadata": {"version": 3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	source := VaultSource{Client: http.DefaultClient, Address: ts.URL, Token: "the-token"}
+
+	value, err := source.Secret("secret/myapp")
+	Assert(t).IsNil(err, "should have read the secret")
+	Assert(t).AreEqual(string(value), "swordfish", "should have read the value key by default")
+
+	value, err = source.Secret("secret/myapp#password")
+	Assert(t).IsNil(err, "should have read the secret")
+	Assert(t).AreEqual(string(value), "hunter2", "should have read the requested key")
+
+	value, err = source.Secret("kv/data/myapp")
+	Assert(t).IsNil(err, "should have read the versioned secret")
+	Assert(t).AreEqual(string(value), "v2", "should have read the versioned secret's data")
+
+	_, err = source.Secret("secret/other")
+	_, ok := err.(NotFoundError)
+	Assert(t).IsTrue(ok, "should have returned a NotFoundError")
+
+	_, err = VaultSource{Client: http.DefaultClient, Address: ts.URL}.Secret("secret/myapp")
+	Assert(t).IsNotNil(err, "should have failed without a token")
+}
@@ -0,0 +1,239 @@
+package auditlogstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	auditChainTree      string = "audit_chain"
+	chainHeadKey        string = auditChainTree + "/head"
+	chainEntryTree      string = auditChainTree + "/entries"
+	chainCheckpointTree string = auditChainTree + "/checkpoints"
+)
+
+// maxAppendAttempts is how many times an append to the chain is retried when
+// other writers move the head first
+const maxAppendAttempts = 10
+
+// ChainStore keeps an audit.Chain in consul. Entries are stored under
+// audit_chain/entries/ and checkpoints under audit_chain/checkpoints/, keyed
+// by their zero-padded sequence numbers so that they list in order, and the
+// head is at audit_chain/head. Entries are appended in a transaction that
+// checks and sets the head, so that concurrent writers can't fork the chain.
+type ChainStore struct {
+	consulKV ChainKV
+}
+
+var _ audit.Recorder = ChainStore{}
+
+type ChainKV interface {
+	Get(key string, opts *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+	Txn(txn api.KVTxnOps, opts *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error)
+}
+
+func NewChainStore(consulKV ChainKV) ChainStore {
+	return ChainStore{
+		consulKV: consulKV,
+	}
+}
+
+// Record appends an entry of the event to the chain
+func (c ChainStore) Record(eventType audit.EventType, eventDetails json.RawMessage) error {
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		head, headIndex, err := c.head()
+		if err != nil {
+			return err
+		}
+		entry, err := audit.NewChainEntry(head, eventType, eventDetails, time.Now())
+		if err != nil {
+			return err
+		}
+		entryBytes, err := json.Marshal(entry)
+		if err != nil {
+			return util.Errorf("could not marshal audit chain entry: %s", err)
+		}
+		headBytes, err := json.Marshal(entry.Head())
+		if err != nil {
+			return util.Errorf("could not marshal audit chain head: %s", err)
+		}
+
+		ok, _, _, err := c.consulKV.Txn(api.KVTxnOps{
+			{Verb: api.KVCAS, Key: chainHeadKey, Value: headBytes, Index: headIndex},
+			{Verb: api.KVCAS, Key: entryKey(entry.Seq), Value: entryBytes, Index: 0},
+		}, nil)
+		if err != nil {
+			return util.Errorf("could not append %s event to the audit chain: %s", eventType, err)
+		}
+		if ok {
+			return nil
+		}
+		// another writer appended an entry since the head was read
+	}
+	return util.Errorf("could not append %s event to the audit chain: its head kept changing", eventType)
+}
+
+// head returns the head of the chain and the modify index of its key, which
+// are zero if the chain is empty
+func (c ChainStore) head() (audit.ChainHead, uint64, error) {
+	pair, _, err := c.consulKV.Get(chainHeadKey, &api.QueryOptions{RequireConsistent: true})
+	if err != nil {
+		return audit.ChainHead{}, 0, util.Errorf("could not read the audit chain's head: %s", err)
+	}
+	if pair == nil {
+		return audit.ChainHead{}, 0, nil
+	}
+	var head audit.ChainHead
+	err = json.Unmarshal(pair.Value, &head)
+	if err != nil {
+		return audit.ChainHead{}, 0, util.Errorf("could not parse the audit chain's head: %s", err)
+	}
+	return head, pair.ModifyIndex, nil
+}
+
+// Checkpoint signs the chain's head with signer, unless it is already
+// checkpointed or the chain is empty. It returns the new checkpoint, or nil
+// if there was none.
+func (c ChainStore) Checkpoint(signer *openpgp.Entity) (*audit.Checkpoint, error) {
+	head, _, err := c.head()
+	if err != nil {
+		return nil, err
+	}
+	if head.Seq == 0 {
+		return nil, nil
+	}
+	key := checkpointKey(head.Seq)
+	existing, _, err := c.consulKV.Get(key, nil)
+	if err != nil {
+		return nil, util.Errorf("could not read audit checkpoint %d: %s", head.Seq, err)
+	}
+	if existing != nil {
+		return nil, nil
+	}
+
+	checkpoint, err := audit.NewCheckpoint(head, signer)
+	if err != nil {
+		return nil, err
+	}
+	checkpointBytes, err := json.Marshal(checkpoint)
+	if err != nil {
+		return nil, util.Errorf("could not marshal audit checkpoint: %s", err)
+	}
+	ok, _, _, err := c.consulKV.Txn(api.KVTxnOps{
+		{Verb: api.KVCAS, Key: key, Value: checkpointBytes, Index: 0},
+	}, nil)
+	if err != nil {
+		return nil, util.Errorf("could not write audit checkpoint %d: %s", head.Seq, err)
+	}
+	if !ok {
+		// another checkpointer got there first
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+// RunCheckpoints checkpoints the chain every interval until quit is closed
+func (c ChainStore) RunCheckpoints(signer *openpgp.Entity, interval time.Duration, quit <-chan struct{}, logger logging.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		checkpoint, err := c.Checkpoint(signer)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not checkpoint the audit chain")
+		} else if checkpoint != nil {
+			logger.WithField("seq", checkpoint.Seq).Infoln("Checkpointed the audit chain")
+		}
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Read returns the chain as it is stored
+func (c ChainStore) Read() (audit.Chain, error) {
+	pairs, _, err := c.consulKV.List(auditChainTree+"/", &api.QueryOptions{RequireConsistent: true})
+	if err != nil {
+		return audit.Chain{}, util.Errorf("could not list the audit chain: %s", err)
+	}
+
+	var chain audit.Chain
+	for _, pair := range pairs {
+		switch {
+		case pair.Key == chainHeadKey:
+			err = json.Unmarshal(pair.Value, &chain.Head)
+		case strings.HasPrefix(pair.Key, chainEntryTree+"/"):
+			var entry audit.ChainEntry
+			err = json.Unmarshal(pair.Value, &entry)
+			chain.Entries = append(chain.Entries, entry)
+		case strings.HasPrefix(pair.Key, chainCheckpointTree+"/"):
+			var checkpoint audit.Checkpoint
+			err = json.Unmarshal(pair.Value, &checkpoint)
+			chain.Checkpoints = append(chain.Checkpoints, checkpoint)
+		default:
+			err = util.Errorf("unexpected key")
+		}
+		if err != nil {
+			return audit.Chain{}, util.Errorf("could not parse audit chain key %s: %s", pair.Key, err)
+		}
+	}
+	return chain, nil
+}
+
+// Verify reads the chain and verifies it against the checkpoint keys of
+// keyring, see audit.VerifyChain
+func (c ChainStore) Verify(keyring openpgp.KeyRing) (audit.VerifiedChain, error) {
+	chain, err := c.Read()
+	if err != nil {
+		return audit.VerifiedChain{}, err
+	}
+	return audit.VerifyChain(chain, keyring)
+}
+
+func entryKey(seq uint64) string {
+	return fmt.Sprintf("%s/%020d", chainEntryTree, seq)
+}
+
+func checkpointKey(seq uint64) string {
+	return fmt.Sprintf("%s/%020d", chainCheckpointTree, seq)
+}
+
+// ChainingStore creates audit log records like the ConsulStore, and also
+// records their events to an audit chain. Since the records are only created
+// when their transaction commits, the chain also has the events of
+// transactions that failed to commit.
+type ChainingStore struct {
+	ConsulStore
+	chain audit.Recorder
+}
+
+func NewChainingStore(store ConsulStore, chain audit.Recorder) ChainingStore {
+	return ChainingStore{
+		ConsulStore: store,
+		chain:       chain,
+	}
+}
+
+func (c ChainingStore) Create(
+	ctx context.Context,
+	eventType audit.EventType,
+	eventDetails json.RawMessage,
+) error {
+	err := c.ConsulStore.Create(ctx, eventType, eventDetails)
+	if err != nil {
+		return err
+	}
+	return c.chain.Record(eventType, eventDetails)
+}
@@ -0,0 +1,103 @@
+package auditlogstore
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestChainRecordCheckpointAndVerify(t *testing.T) {
+	f := consulutil.NewFixture(t)
+	defer f.Stop()
+
+	signer, err := openpgp.NewEntity("checkpointer", "", "checkpointer@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := openpgp.EntityList{signer}
+	chain := NewChainStore(f.Client.KV())
+
+	// concurrent writers must not fork the chain
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := chain.Record("some_event", json.RawMessage(`{"some":"details"}`))
+			if err != nil {
+				t.Errorf("could not record an event: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	checkpoint, err := chain.Checkpoint(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint == nil || checkpoint.Seq != 4 {
+		t.Fatalf("expected a checkpoint of entry 4, got %+v", checkpoint)
+	}
+	if again, err := chain.Checkpoint(signer); err != nil || again != nil {
+		t.Errorf("expected an unchanged chain not to be checkpointed again, got %+v, %v", again, err)
+	}
+	err = chain.Record("other_event", json.RawMessage(`{"some":"details"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := chain.Verify(keyring)
+	if err != nil {
+		t.Fatalf("chain should verify: %s", err)
+	}
+	if verified.Head.Seq != 5 {
+		t.Errorf("expected 5 entries, got %d", verified.Head.Seq)
+	}
+
+	// truncating the chain and moving its head back is caught by the
+	// checkpoint
+	var truncatedHead struct {
+		Seq  uint64 `json:"seq"`
+		Hash string `json:"hash"`
+	}
+	for _, seq := range []uint64{5, 4, 3} {
+		_, err = f.Client.KV().Delete(entryKey(seq), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry2, _, err := f.Client.KV().Get(entryKey(2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(entry2.Value, &truncatedHead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headBytes, _ := json.Marshal(truncatedHead)
+	_, err = f.Client.KV().Put(&api.KVPair{Key: chainHeadKey, Value: headBytes}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = chain.Verify(keyring)
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("expected truncation to be detected, got %v", err)
+	}
+
+	// so is a modified entry
+	modified := strings.Replace(string(entry2.Value), "some_event", "forged_event", 1)
+	_, err = f.Client.KV().Put(&api.KVPair{Key: entryKey(2), Value: []byte(modified)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = chain.Verify(keyring)
+	if err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("expected a modified entry to be detected, got %v", err)
+	}
+}
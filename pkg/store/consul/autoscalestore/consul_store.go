@@ -0,0 +1,176 @@
+// Package autoscalestore stores the policies that the autoscaler adjusts the
+// replica counts of RCs with
+package autoscalestore
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/autoscale/fields"
+	rc_fields "github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+)
+
+// Policies are stored at /autoscale/<rc id>
+const autoscaleTree = "autoscale"
+
+var NoPolicy error = errors.New("No autoscaling policy found")
+
+func IsNotExist(err error) bool {
+	return err == NoPolicy
+}
+
+type KV interface {
+	Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+	Put(p *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error)
+	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+var _ KV = &api.KV{}
+
+type ConsulStore struct {
+	kv KV
+}
+
+func NewConsul(client consulutil.ConsulClient) ConsulStore {
+	return ConsulStore{
+		kv: client.KV(),
+	}
+}
+
+// Set creates or replaces the autoscaling policy of an RC
+func (s ConsulStore) Set(policy fields.Policy) error {
+	err := policy.Validate()
+	if err != nil {
+		return err
+	}
+	key, err := PolicyPath(policy.RCID)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(policy)
+	if err != nil {
+		return util.Errorf("Could not marshal autoscaling policy as JSON: %s", err)
+	}
+	_, err = s.kv.Put(&api.KVPair{Key: key, Value: value}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+// Get returns the autoscaling policy of an RC. Returns NoPolicy if the RC
+// isn't autoscaled.
+func (s ConsulStore) Get(id rc_fields.ID) (fields.Policy, error) {
+	key, err := PolicyPath(id)
+	if err != nil {
+		return fields.Policy{}, err
+	}
+	kvp, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return fields.Policy{}, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return fields.Policy{}, NoPolicy
+	}
+	return kvpToPolicy(kvp)
+}
+
+// Delete stops an RC from being autoscaled. Its replica count is left as it
+// was.
+func (s ConsulStore) Delete(id rc_fields.ID) error {
+	key, err := PolicyPath(id)
+	if err != nil {
+		return err
+	}
+	_, err = s.kv.Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
+
+// List returns every autoscaling policy
+func (s ConsulStore) List() ([]fields.Policy, error) {
+	listed, _, err := s.kv.List(autoscaleTree+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", autoscaleTree+"/", err)
+	}
+	return kvpsToPolicies(listed)
+}
+
+// Watch sends every autoscaling policy each time any of them changes. Policies
+// that can't be read are reported on the error channel and left out.
+func (s ConsulStore) Watch(quit <-chan struct{}) (<-chan []fields.Policy, <-chan error) {
+	inCh := make(chan api.KVPairs)
+	outCh := make(chan []fields.Policy)
+	errCh := make(chan error)
+	go consulutil.WatchPrefix(autoscaleTree+"/", s.kv, inCh, quit, errCh, 0)
+
+	go func() {
+		defer close(outCh)
+		for listed := range inCh {
+			policies := make([]fields.Policy, 0, len(listed))
+			for _, kvp := range listed {
+				policy, err := kvpToPolicy(kvp)
+				if err != nil {
+					select {
+					case errCh <- err:
+					case <-quit:
+						return
+					}
+					continue
+				}
+				policies = append(policies, policy)
+			}
+			select {
+			case outCh <- policies:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return outCh, errCh
+}
+
+func PolicyPath(id rc_fields.ID) (string, error) {
+	if id == "" {
+		return "", util.Errorf("id not specified when computing autoscaling policy path")
+	}
+	return path.Join(autoscaleTree, id.String()), nil
+}
+
+// PolicyLockPath is locked by the farm autoscaling the RC
+func PolicyLockPath(id rc_fields.ID) (string, error) {
+	policyPath, err := PolicyPath(id)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(consulutil.LOCK_TREE, policyPath), nil
+}
+
+func kvpToPolicy(kvp *api.KVPair) (fields.Policy, error) {
+	var policy fields.Policy
+	err := json.Unmarshal(kvp.Value, &policy)
+	if err != nil {
+		return fields.Policy{}, util.Errorf("Unable to unmarshal %s as an autoscaling policy: %s", kvp.Key, err)
+	}
+	return policy, nil
+}
+
+func kvpsToPolicies(listed api.KVPairs) ([]fields.Policy, error) {
+	policies := make([]fields.Policy, 0, len(listed))
+	for _, kvp := range listed {
+		policy, err := kvpToPolicy(kvp)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
@@ -0,0 +1,142 @@
+// Package budgetstore stores the disruption budgets that limit how many pods
+// may be removed at once
+package budgetstore
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/disruption/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+)
+
+// Budgets are stored at /disruption_budgets/<escaped pod selector>
+const budgetTree = "disruption_budgets"
+
+var NoBudget error = errors.New("No disruption budget found")
+
+func IsNotExist(err error) bool {
+	return err == NoBudget
+}
+
+type KV interface {
+	Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+	Put(p *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error)
+	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+var _ KV = &api.KV{}
+
+type ConsulStore struct {
+	kv KV
+}
+
+func NewConsul(client consulutil.ConsulClient) ConsulStore {
+	return ConsulStore{
+		kv: client.KV(),
+	}
+}
+
+// Set creates or replaces the disruption budget for a pod selector. The
+// selector is stored in its canonical form, so that equivalent selectors
+// identify the same budget.
+func (s ConsulStore) Set(budget fields.Budget) error {
+	err := budget.Validate()
+	if err != nil {
+		return err
+	}
+	selector, err := budget.Selector()
+	if err != nil {
+		return err
+	}
+	budget.PodSelector = selector.String()
+	key, err := BudgetPath(budget.PodSelector)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(budget)
+	if err != nil {
+		return util.Errorf("Could not marshal disruption budget as JSON: %s", err)
+	}
+	_, err = s.kv.Put(&api.KVPair{Key: key, Value: value}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+// Get returns the disruption budget for a pod selector. Returns NoBudget if
+// there isn't one.
+func (s ConsulStore) Get(podSelector string) (fields.Budget, error) {
+	key, err := BudgetPath(podSelector)
+	if err != nil {
+		return fields.Budget{}, err
+	}
+	kvp, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return fields.Budget{}, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return fields.Budget{}, NoBudget
+	}
+	return kvpToBudget(kvp)
+}
+
+// Delete removes the disruption budget for a pod selector, if there is one
+func (s ConsulStore) Delete(podSelector string) error {
+	key, err := BudgetPath(podSelector)
+	if err != nil {
+		return err
+	}
+	_, err = s.kv.Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
+
+// List returns every disruption budget
+func (s ConsulStore) List() ([]fields.Budget, error) {
+	listed, _, err := s.kv.List(budgetTree+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", budgetTree+"/", err)
+	}
+	budgets := make([]fields.Budget, 0, len(listed))
+	for _, kvp := range listed {
+		budget, err := kvpToBudget(kvp)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+	return budgets, nil
+}
+
+// BudgetPath returns the key of the budget for a pod selector, which is
+// escaped since selectors may contain slashes
+func BudgetPath(podSelector string) (string, error) {
+	budget := fields.Budget{PodSelector: podSelector}
+	selector, err := budget.Selector()
+	if err != nil {
+		return "", err
+	}
+	if selector.Empty() {
+		return "", util.Errorf("pod selector not specified when computing disruption budget path")
+	}
+	return path.Join(budgetTree, url.QueryEscape(selector.String())), nil
+}
+
+func kvpToBudget(kvp *api.KVPair) (fields.Budget, error) {
+	var budget fields.Budget
+	err := json.Unmarshal(kvp.Value, &budget)
+	if err != nil {
+		return fields.Budget{}, util.Errorf("Unable to unmarshal %s as a disruption budget: %s", kvp.Key, err)
+	}
+	return budget, nil
+}
@@ -0,0 +1,190 @@
+package consul
+
+import (
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/types"
+)
+
+// PodTreeReader is the part of the store that a CachedStore serves reads of
+// and watches to keep its cache fresh
+type PodTreeReader interface {
+	Pod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
+	ListPods(podPrefix PodPrefix, nodename types.NodeName) ([]ManifestResult, time.Duration, error)
+	AllPods(podPrefix PodPrefix) ([]ManifestResult, time.Duration, error)
+	WatchAllPods(podPrefix PodPrefix, quitChan <-chan struct{}, errChan chan<- error, podChan chan<- []ManifestResult, pauseTime time.Duration)
+}
+
+// CachedStore serves Pod, ListPods and AllPods reads from an in-memory copy
+// of the pod trees, kept fresh by watching them, for dashboards and CLIs
+// that read the same trees frequently. A tree is watched from its first
+// read on, which is served by the underlying store like every read issued
+// while the cache is further behind consul than the caller allows.
+//
+// While its watch succeeds the cache is considered current, since a watch
+// returns as soon as the tree changes. Once the watch fails, the cache is as
+// stale as the time since it last succeeded.
+type CachedStore struct {
+	cache        *podCache
+	maxStaleness time.Duration
+}
+
+type podCache struct {
+	store     PodTreeReader
+	pauseTime time.Duration
+	logger    logging.Logger
+	quit      chan struct{}
+
+	mu    sync.Mutex
+	trees map[PodPrefix]*cachedTree
+}
+
+type cachedTree struct {
+	// pods of every node, or nil until the tree's watch first succeeds
+	byNode map[types.NodeName][]ManifestResult
+	// when the watch last succeeded
+	synced time.Time
+	// whether the watch has failed since it last succeeded
+	failing bool
+}
+
+// NewCachedStore returns a CachedStore that reads from and watches store,
+// waiting pauseTime between watch requests, and serves cached reads that
+// are at most maxStaleness behind consul. Close() stops its watches.
+func NewCachedStore(store PodTreeReader, maxStaleness time.Duration, pauseTime time.Duration, logger logging.Logger) CachedStore {
+	return CachedStore{
+		cache: &podCache{
+			store:     store,
+			pauseTime: pauseTime,
+			logger:    logger,
+			quit:      make(chan struct{}),
+			trees:     make(map[PodPrefix]*cachedTree),
+		},
+		maxStaleness: maxStaleness,
+	}
+}
+
+// WithMaxStaleness returns a CachedStore sharing the cache of s that serves
+// cached reads at most maxStaleness behind consul, for callers that need
+// fresher (or tolerate staler) data than others
+func (s CachedStore) WithMaxStaleness(maxStaleness time.Duration) CachedStore {
+	return CachedStore{
+		cache:        s.cache,
+		maxStaleness: maxStaleness,
+	}
+}
+
+// Close stops the watches of every CachedStore sharing the cache of s
+func (s CachedStore) Close() {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	select {
+	case <-s.cache.quit:
+	default:
+		close(s.cache.quit)
+	}
+}
+
+// Pod reads a legacy pod's manifest like consulStore.Pod. Cached reads
+// report a request time of 0.
+func (s CachedStore) Pod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error) {
+	results, ok := s.cache.read(podPrefix, s.maxStaleness, func(tree *cachedTree) []ManifestResult {
+		return tree.byNode[nodename]
+	})
+	if !ok {
+		return s.cache.store.Pod(podPrefix, nodename, podId)
+	}
+	for _, result := range results {
+		if result.PodUniqueKey == "" && result.PodLocation.PodID == podId {
+			return result.Manifest, 0, nil
+		}
+	}
+	return nil, 0, pods.NoCurrentManifest
+}
+
+// ListPods reads the pods of a node like consulStore.ListPods. Cached reads
+// report a request time of 0.
+func (s CachedStore) ListPods(podPrefix PodPrefix, nodename types.NodeName) ([]ManifestResult, time.Duration, error) {
+	results, ok := s.cache.read(podPrefix, s.maxStaleness, func(tree *cachedTree) []ManifestResult {
+		return tree.byNode[nodename]
+	})
+	if !ok {
+		return s.cache.store.ListPods(podPrefix, nodename)
+	}
+	return results, 0, nil
+}
+
+// AllPods reads the pods of every node like consulStore.AllPods. Cached
+// reads report a request time of 0.
+func (s CachedStore) AllPods(podPrefix PodPrefix) ([]ManifestResult, time.Duration, error) {
+	results, ok := s.cache.read(podPrefix, s.maxStaleness, func(tree *cachedTree) []ManifestResult {
+		var all []ManifestResult
+		for _, nodeResults := range tree.byNode {
+			all = append(all, nodeResults...)
+		}
+		return all
+	})
+	if !ok {
+		return s.cache.store.AllPods(podPrefix)
+	}
+	return results, 0, nil
+}
+
+// read returns a copy of the results selected from the cache of podPrefix,
+// or false if the cache is more than maxStaleness behind consul. The first
+// read of a tree starts watching it.
+func (c *podCache) read(podPrefix PodPrefix, maxStaleness time.Duration, selectResults func(*cachedTree) []ManifestResult) ([]ManifestResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tree, ok := c.trees[podPrefix]
+	if !ok {
+		tree = &cachedTree{}
+		c.trees[podPrefix] = tree
+		go c.watch(podPrefix, tree)
+		return nil, false
+	}
+	if tree.byNode == nil || (tree.failing && time.Since(tree.synced) > maxStaleness) {
+		return nil, false
+	}
+
+	selected := selectResults(tree)
+	results := make([]ManifestResult, len(selected))
+	copy(results, selected)
+	return results, true
+}
+
+func (c *podCache) watch(podPrefix PodPrefix, tree *cachedTree) {
+	podChan := make(chan []ManifestResult)
+	errChan := make(chan error)
+	go c.store.WatchAllPods(podPrefix, c.quit, errChan, podChan, c.pauseTime)
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		case err := <-errChan:
+			c.logger.WithError(err).WithField("tree", podPrefix).Errorln("Error watching pod tree for the cache")
+			c.mu.Lock()
+			tree.failing = true
+			c.mu.Unlock()
+		case results, ok := <-podChan:
+			if !ok {
+				return
+			}
+			byNode := make(map[types.NodeName][]ManifestResult)
+			for _, result := range results {
+				byNode[result.PodLocation.Node] = append(byNode[result.PodLocation.Node], result)
+			}
+			c.mu.Lock()
+			tree.byNode = byNode
+			tree.synced = time.Now()
+			tree.failing = false
+			c.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/types"
+)
+
+func waitForCachedPods(t *testing.T, store CachedStore, node types.NodeName, count int) {
+	timeout := time.After(5 * time.Second)
+	for {
+		results, requestTime, err := store.ListPods(INTENT_TREE, node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if requestTime == 0 && len(results) == count {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("expected the cache to have %d pods on %s, got %v", count, node, results)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestCachedStore(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	_, err := f.Store.SetPod(INTENT_TREE, "node1", testManifest("first_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewCachedStore(f.Store, time.Minute, 0, logging.TestLogger())
+	defer store.Close()
+
+	// the first read is served by consul and starts the watch
+	results, _, err := store.ListPods(INTENT_TREE, "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected to read 1 pod, got %v", results)
+	}
+	waitForCachedPods(t, store, "node1", 1)
+
+	_, err = f.Store.SetPod(INTENT_TREE, "node1", testManifest("second_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForCachedPods(t, store, "node1", 2)
+
+	manifest, _, err := store.Pod(INTENT_TREE, "node1", "second_pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.ID() != "second_pod" {
+		t.Errorf("expected to read second_pod from the cache, got %s", manifest.ID())
+	}
+	_, _, err = store.Pod(INTENT_TREE, "node2", "second_pod")
+	if err != pods.NoCurrentManifest {
+		t.Errorf("expected a pod missing from the cache to be reported as missing, got %v", err)
+	}
+	all, _, err := store.AllPods(INTENT_TREE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected 2 pods in the tree, got %v", all)
+	}
+
+	// a failing watch leaves the cache behind consul, which callers with a
+	// tighter bound than its staleness don't accept
+	store.cache.mu.Lock()
+	tree := store.cache.trees[INTENT_TREE]
+	tree.failing = true
+	tree.synced = time.Now().Add(-time.Hour)
+	store.cache.mu.Unlock()
+	_, requestTime, err := store.WithMaxStaleness(time.Second).ListPods(INTENT_TREE, "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requestTime == 0 {
+		t.Error("expected a read with a tighter staleness bound to be served by consul")
+	}
+	_, requestTime, err = store.WithMaxStaleness(2*time.Hour).ListPods(INTENT_TREE, "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requestTime != 0 {
+		t.Error("expected a read with a looser staleness bound to be served by the cache")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	p2metrics "github.com/square/p2/pkg/metrics"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 
 	"github.com/hashicorp/consul/api"
@@ -24,9 +25,52 @@ type Options struct {
 	// See the "wait" parameter:
 	// https://consul.io/intro/getting-started/kv.html
 	WaitTime time.Duration
+	// If provided, every key is read and written under the prefix of this
+	// namespace (see consulutil.NamespacePrefix), so that several p2
+	// installations can share one consul cluster.
+	Namespace string
+	// If non-zero, requests to Consul are rate limited and stopped while
+	// Consul is failing (see consulutil.NewLimitedClient).
+	Limits consulutil.LimitConfig
+	// The datacenter whose keys are read and written. The empty string
+	// defaults to the datacenter of the agent at Address, which forwards
+	// the requests of any other datacenter to it.
+	Datacenter string
+	// Set to true to allow reads to return stale results (see
+	// consulutil.NewStaleReadClient).
+	StaleReads bool
+}
+
+// InDatacenter returns a copy of opts that reads and writes the keys of
+// datacenter, through the same agent
+func (opts Options) InDatacenter(datacenter string) Options {
+	opts.Datacenter = datacenter
+	return opts
 }
 
 func NewConsulClient(opts Options) consulutil.ConsulClient {
+	// error is always nil
+	client, _ := api.NewClient(apiConfig(opts))
+	raw := consulutil.ConsulClientFromRaw(client)
+	if opts.StaleReads {
+		raw = consulutil.NewStaleReadClient(raw)
+	}
+	// latencies are recorded beneath the limiter so that they don't include
+	// waiting for the rate limit
+	measured := consulutil.NewMetricsClient(raw, p2metrics.Registry)
+	limited := consulutil.NewLimitedClient(measured, opts.Limits)
+	return consulutil.NewNamespacedClient(limited, opts.Namespace)
+}
+
+// NewCatalog returns the client of consul's catalog. Catalog requests aren't
+// rate limited or namespaced, since the catalog isn't p2's.
+func NewCatalog(opts Options) *api.Catalog {
+	// error is always nil
+	client, _ := api.NewClient(apiConfig(opts))
+	return client.Catalog()
+}
+
+func apiConfig(opts Options) *api.Config {
 	conf := api.DefaultConfig()
 	if opts.Address != "" {
 		conf.Address = opts.Address
@@ -38,11 +82,9 @@ func NewConsulClient(opts Options) consulutil.ConsulClient {
 		conf.Scheme = "https"
 	}
 	conf.Token = opts.Token
+	conf.Datacenter = opts.Datacenter
 	if opts.WaitTime != 0 {
 		conf.WaitTime = opts.WaitTime
 	}
-
-	// error is always nil
-	client, _ := api.NewClient(conf)
-	return consulutil.ConsulClientFromRaw(client)
+	return conf
 }
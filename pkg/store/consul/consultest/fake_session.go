@@ -84,6 +84,12 @@ func (f *fakeSession) Lock(key string) (consulutil.Unlocker, error) {
 	}, nil
 }
 
+// StealLock behaves like Lock, since a fake session holding the lock never
+// expires
+func (f *fakeSession) StealLock(key string, _ <-chan struct{}) (consulutil.Unlocker, error) {
+	return f.Lock(key)
+}
+
 // Not currently implemented
 func (f *fakeSession) Renew() error {
 	return nil
@@ -100,6 +106,11 @@ func (f *fakeSession) Destroy() error {
 	return nil
 }
 
+// Lost returns nil since fake sessions are never lost
+func (f *fakeSession) Lost() <-chan struct{} {
+	return nil
+}
+
 func (f *fakeSession) Session() string {
 	return f.session
 }
@@ -10,14 +10,16 @@ import (
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/types"
 )
 
 // In memory consul store useful in tests. Currently does not implement the entire
 // consul.Store interface
 type FakePodStore struct {
-	podResults    map[FakePodStoreKey]manifest.Manifest
-	healthResults map[string]consul.WatchResult
+	podResults      map[FakePodStoreKey]manifest.Manifest
+	healthResults   map[string]consul.WatchResult
+	realityMetadata map[FakePodStoreKey]consul.RealityMetadata
 
 	// represents locks that are held. Will be shared between any
 	// fakeSessions returned by NewSession().  It is the session
@@ -37,9 +39,10 @@ func NewFakePodStore(podResults map[FakePodStoreKey]manifest.Manifest, healthRes
 		healthResults = make(map[string]consul.WatchResult)
 	}
 	return &FakePodStore{
-		podResults:    podResults,
-		healthResults: healthResults,
-		locks:         make(map[string]bool),
+		podResults:      podResults,
+		healthResults:   healthResults,
+		realityMetadata: make(map[FakePodStoreKey]consul.RealityMetadata),
+		locks:           make(map[string]bool),
 	}
 }
 
@@ -130,9 +133,29 @@ func (f *FakePodStore) DeletePod(podPrefix consul.PodPrefix, hostname types.Node
 	f.podLock.Lock()
 	defer f.podLock.Unlock()
 	delete(f.podResults, FakePodStoreKeyFor(podPrefix, hostname, podId))
+	delete(f.realityMetadata, FakePodStoreKeyFor(podPrefix, hostname, podId))
 	return 0, nil
 }
 
+func (f *FakePodStore) SetRealityWithMetadata(hostname types.NodeName, manifest manifest.Manifest, metadata consul.RealityMetadata) error {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
+	key := FakePodStoreKeyFor(consul.REALITY_TREE, hostname, manifest.ID())
+	f.podResults[key] = manifest
+	f.realityMetadata[key] = metadata
+	return nil
+}
+
+func (f *FakePodStore) RealityMetadata(hostname types.NodeName, podId types.PodID) (consul.RealityMetadata, error) {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
+	metadata, ok := f.realityMetadata[FakePodStoreKeyFor(consul.REALITY_TREE, hostname, podId)]
+	if !ok {
+		return consul.RealityMetadata{}, consulutil.NotFoundError{Key: path.Join(consul.REALITY_METADATA_TREE, hostname.String(), podId.String())}
+	}
+	return metadata, nil
+}
+
 func (f *FakePodStore) GetHealth(service string, node types.NodeName) (consul.WatchResult, error) {
 	return f.healthResults[consul.HealthPath(service, node)], nil
 }
@@ -0,0 +1,145 @@
+package consulutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"sync"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// Compressed values are stored as compressionMagic, followed by a single byte
+// identifying the Codec, followed by the compressed data. Every record that
+// can be compressed is otherwise stored as JSON, which can never begin with a
+// NUL byte, so values written before compression was enabled (or by writers
+// that have it disabled) are returned unchanged by DecompressValue.
+var compressionMagic = []byte{0x00, 'p', '2', 'z'}
+
+// Codec compresses and decompresses values stored in consul
+type Codec interface {
+	// Name is the name used to select the codec in configuration
+	Name() string
+	// ID is written after the magic prefix of compressed values. It must
+	// never change once values have been written with it.
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+const (
+	// NoCompression is the configured compression name for storing values
+	// as-is
+	NoCompression = "none"
+
+	// ID 2 is reserved for zstd, which can be added with RegisterCodec
+	// when a zstd implementation is vendored
+	gzipCodecID byte = 1
+)
+
+var (
+	codecsMu     sync.RWMutex
+	codecsByName = make(map[string]Codec)
+	codecsByID   = make(map[byte]Codec)
+)
+
+func init() {
+	RegisterCodec(gzipCodec{})
+}
+
+// RegisterCodec makes a codec available to CompressValue and
+// DecompressValue. It panics if the codec's name or ID is already taken.
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if codec.Name() == NoCompression {
+		panic("consulutil: cannot register a codec named " + NoCompression)
+	}
+	if _, ok := codecsByName[codec.Name()]; ok {
+		panic("consulutil: codec " + codec.Name() + " registered twice")
+	}
+	if _, ok := codecsByID[codec.ID()]; ok {
+		panic("consulutil: codec ID for " + codec.Name() + " registered twice")
+	}
+	codecsByName[codec.Name()] = codec
+	codecsByID[codec.ID()] = codec
+}
+
+// CompressValue compresses data with the named codec and prepends the magic
+// prefix recognized by DecompressValue. If name is NoCompression or the empty
+// string, data is returned unchanged.
+func CompressValue(name string, data []byte) ([]byte, error) {
+	if name == "" || name == NoCompression {
+		return data, nil
+	}
+
+	codecsMu.RLock()
+	codec, ok := codecsByName[name]
+	codecsMu.RUnlock()
+	if !ok {
+		return nil, util.Errorf("unknown consul value compression %q", name)
+	}
+
+	compressed, err := codec.Compress(data)
+	if err != nil {
+		return nil, util.Errorf("could not compress value with %s: %s", name, err)
+	}
+
+	ret := make([]byte, 0, len(compressionMagic)+1+len(compressed))
+	ret = append(ret, compressionMagic...)
+	ret = append(ret, codec.ID())
+	return append(ret, compressed...), nil
+}
+
+// DecompressValue reverses CompressValue. Values without the magic prefix
+// were stored uncompressed and are returned unchanged.
+func DecompressValue(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, compressionMagic) {
+		return data, nil
+	}
+	if len(data) == len(compressionMagic) {
+		return nil, util.Errorf("compressed consul value is missing its codec ID")
+	}
+
+	id := data[len(compressionMagic)]
+	codecsMu.RLock()
+	codec, ok := codecsByID[id]
+	codecsMu.RUnlock()
+	if !ok {
+		return nil, util.Errorf("consul value was compressed with unknown codec ID %d", id)
+	}
+
+	decompressed, err := codec.Decompress(data[len(compressionMagic)+1:])
+	if err != nil {
+		return nil, util.Errorf("could not decompress value with %s: %s", codec.Name(), err)
+	}
+	return decompressed, nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+func (gzipCodec) ID() byte     { return gzipCodecID }
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,62 @@
+package consulutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressValueRoundTrip(t *testing.T) {
+	value := []byte(`{"Status":"passing","Output":"` + string(bytes.Repeat([]byte("ok "), 1000)) + `"}`)
+
+	compressed, err := CompressValue("gzip", value)
+	if err != nil {
+		t.Fatalf("Unable to compress value: %s", err)
+	}
+	if !bytes.HasPrefix(compressed, compressionMagic) {
+		t.Error("Expected compressed value to start with the magic prefix")
+	}
+	if len(compressed) >= len(value) {
+		t.Errorf("Expected compressed value to be smaller than %d bytes, was %d", len(value), len(compressed))
+	}
+
+	decompressed, err := DecompressValue(compressed)
+	if err != nil {
+		t.Fatalf("Unable to decompress value: %s", err)
+	}
+	if !bytes.Equal(decompressed, value) {
+		t.Errorf("Decompressed value did not match the original: '%s'", string(decompressed))
+	}
+}
+
+func TestUncompressedValuesAreUnchanged(t *testing.T) {
+	value := []byte(`{"Status":"passing"}`)
+
+	stored, err := CompressValue(NoCompression, value)
+	if err != nil {
+		t.Fatalf("Unexpected error with no compression: %s", err)
+	}
+	if !bytes.Equal(stored, value) {
+		t.Errorf("Expected value to be stored as-is with no compression, got '%s'", string(stored))
+	}
+
+	read, err := DecompressValue(value)
+	if err != nil {
+		t.Fatalf("Unexpected error reading uncompressed value: %s", err)
+	}
+	if !bytes.Equal(read, value) {
+		t.Errorf("Expected uncompressed value to be read as-is, got '%s'", string(read))
+	}
+}
+
+func TestUnknownCompression(t *testing.T) {
+	_, err := CompressValue("lzma", []byte("value"))
+	if err == nil {
+		t.Error("Expected an error compressing with an unknown codec")
+	}
+
+	value := append(append([]byte{}, compressionMagic...), 0xff, 'x')
+	_, err = DecompressValue(value)
+	if err == nil {
+		t.Error("Expected an error decompressing a value with an unknown codec ID")
+	}
+}
@@ -0,0 +1,210 @@
+package consulutil
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// PrefixWatcher runs watches with the semantics of WatchPrefix
+type PrefixWatcher interface {
+	WatchPrefix(
+		prefix string,
+		outPairs chan<- api.KVPairs,
+		done <-chan struct{},
+		outErrors chan<- error,
+		pause time.Duration,
+	)
+}
+
+type directWatcher struct {
+	clientKV ConsulLister
+}
+
+// NewDirectWatcher returns a PrefixWatcher whose every watch makes its own
+// blocking queries with WatchPrefix
+func NewDirectWatcher(clientKV ConsulLister) PrefixWatcher {
+	return directWatcher{clientKV: clientKV}
+}
+
+func (w directWatcher) WatchPrefix(prefix string, outPairs chan<- api.KVPairs, done <-chan struct{}, outErrors chan<- error, pause time.Duration) {
+	WatchPrefix(prefix, w.clientKV, outPairs, done, outErrors, pause)
+}
+
+// WatchDispatcher is a PrefixWatcher that shares one blocking query per
+// prefix among every watch of the prefix, so that components watching the
+// same keys don't each add to consul's load. The query of a prefix starts
+// with its first watch, using that watch's pause, and stops when the last
+// watch of the prefix is done.
+//
+// A watch that joins a running query immediately receives the query's last
+// result. Results are delivered to each watch independently: a watch that
+// doesn't keep up is only sent the latest result once it is ready, rather
+// than every result, and doesn't hold up the other watches. Every watch
+// receives the same pairs, so they must not be modified.
+type WatchDispatcher struct {
+	clientKV ConsulLister
+
+	mu      sync.Mutex
+	queries map[string]*sharedQuery
+}
+
+// sharedQuery is the blocking query of a prefix and its subscribers
+type sharedQuery struct {
+	subscribers map[*subscriber]struct{}
+	// the last result of the query, if it has returned one
+	lastPairs api.KVPairs
+	hasPairs  bool
+	quit      chan struct{}
+}
+
+// subscriber is one watch of a shared query. It holds the latest result and
+// error that the watch hasn't been sent yet.
+type subscriber struct {
+	mu       sync.Mutex
+	pairs    api.KVPairs
+	hasPairs bool
+	err      error
+	// signaled when there's something to send
+	notify chan struct{}
+}
+
+func NewWatchDispatcher(clientKV ConsulLister) *WatchDispatcher {
+	return &WatchDispatcher{
+		clientKV: clientKV,
+		queries:  make(map[string]*sharedQuery),
+	}
+}
+
+var _ PrefixWatcher = &WatchDispatcher{}
+
+// WatchPrefix has the same semantics as WatchPrefix(), except that the
+// blocking query is shared with the other watches of prefix. pause is only
+// used if this is the first watch of prefix.
+func (d *WatchDispatcher) WatchPrefix(
+	prefix string,
+	outPairs chan<- api.KVPairs,
+	done <-chan struct{},
+	outErrors chan<- error,
+	pause time.Duration,
+) {
+	defer close(outPairs)
+
+	sub := d.subscribe(prefix, pause)
+	defer d.unsubscribe(prefix, sub)
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-sub.notify:
+		}
+
+		sub.mu.Lock()
+		pairs, hasPairs, err := sub.pairs, sub.hasPairs, sub.err
+		sub.pairs, sub.hasPairs, sub.err = nil, false, nil
+		sub.mu.Unlock()
+
+		if err != nil {
+			select {
+			case <-done:
+				return
+			case outErrors <- err:
+			}
+		}
+		if hasPairs {
+			select {
+			case <-done:
+				return
+			case outPairs <- pairs:
+			}
+		}
+	}
+}
+
+// Prefixes returns the number of prefixes with a running query
+func (d *WatchDispatcher) Prefixes() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queries)
+}
+
+func (d *WatchDispatcher) subscribe(prefix string, pause time.Duration) *subscriber {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sub := &subscriber{notify: make(chan struct{}, 1)}
+	query, ok := d.queries[prefix]
+	if !ok {
+		query = &sharedQuery{
+			subscribers: make(map[*subscriber]struct{}),
+			quit:        make(chan struct{}),
+		}
+		d.queries[prefix] = query
+		go d.run(prefix, query, pause)
+	}
+	query.subscribers[sub] = struct{}{}
+	if query.hasPairs {
+		sub.offer(query.lastPairs, nil)
+	}
+	return sub
+}
+
+func (d *WatchDispatcher) unsubscribe(prefix string, sub *subscriber) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	query := d.queries[prefix]
+	delete(query.subscribers, sub)
+	if len(query.subscribers) == 0 {
+		close(query.quit)
+		delete(d.queries, prefix)
+	}
+}
+
+// run performs the query of prefix and fans its results out to the
+// query's subscribers
+func (d *WatchDispatcher) run(prefix string, query *sharedQuery, pause time.Duration) {
+	pairsCh := make(chan api.KVPairs)
+	errCh := make(chan error)
+	go WatchPrefix(prefix, d.clientKV, pairsCh, query.quit, errCh, pause)
+
+	for {
+		select {
+		case pairs, ok := <-pairsCh:
+			if !ok {
+				return
+			}
+			d.mu.Lock()
+			query.lastPairs, query.hasPairs = pairs, true
+			for sub := range query.subscribers {
+				sub.offer(pairs, nil)
+			}
+			d.mu.Unlock()
+		case err := <-errCh:
+			d.mu.Lock()
+			for sub := range query.subscribers {
+				sub.offer(nil, err)
+			}
+			d.mu.Unlock()
+		}
+	}
+}
+
+// offer replaces the subscriber's unsent result with pairs, or its unsent
+// error with err if err isn't nil
+func (s *subscriber) offer(pairs api.KVPairs, err error) {
+	s.mu.Lock()
+	if err != nil {
+		s.err = err
+	} else {
+		s.pairs, s.hasPairs = pairs, true
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
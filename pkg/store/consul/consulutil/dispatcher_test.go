@@ -0,0 +1,135 @@
+package consulutil
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/hashicorp/consul/api"
+)
+
+// blockingLister answers blocking queries once its pairs are set again, and
+// counts the queries that start a watch
+type blockingLister struct {
+	mu           sync.Mutex
+	index        uint64
+	pairs        api.KVPairs
+	changed      chan struct{}
+	initialLists int
+}
+
+func newBlockingLister() *blockingLister {
+	return &blockingLister{index: 1, changed: make(chan struct{})}
+}
+
+func (l *blockingLister) List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	l.mu.Lock()
+	changed := l.changed
+	blocking := opts != nil && opts.WaitIndex >= l.index
+	if opts == nil || opts.WaitIndex == 0 {
+		l.initialLists++
+	}
+	l.mu.Unlock()
+
+	if blocking {
+		<-changed
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pairs, &api.QueryMeta{LastIndex: l.index}, nil
+}
+
+func (l *blockingLister) set(pairs api.KVPairs) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pairs = pairs
+	l.index++
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *blockingLister) getInitialLists() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.initialLists
+}
+
+func receivePairs(t *testing.T, pairsCh <-chan api.KVPairs) api.KVPairs {
+	select {
+	case pairs := <-pairsCh:
+		return pairs
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for pairs")
+	}
+	return nil
+}
+
+func TestWatchDispatcherSharesQueries(t *testing.T) {
+	lister := newBlockingLister()
+	lister.set(api.KVPairs{{Key: "prefix/a"}})
+	dispatcher := NewWatchDispatcher(lister)
+
+	quit1, quit2 := make(chan struct{}), make(chan struct{})
+	pairs1, pairs2 := make(chan api.KVPairs), make(chan api.KVPairs)
+	go dispatcher.WatchPrefix("prefix/", pairs1, quit1, make(chan error), 0)
+	Assert(t).AreEqual(len(receivePairs(t, pairs1)), 1, "first watch should have gotten the initial pairs")
+
+	go dispatcher.WatchPrefix("prefix/", pairs2, quit2, make(chan error), 0)
+	Assert(t).AreEqual(len(receivePairs(t, pairs2)), 1, "joining watch should have gotten the last pairs")
+	Assert(t).AreEqual(dispatcher.Prefixes(), 1, "watches of the same prefix should share a query")
+
+	lister.set(api.KVPairs{{Key: "prefix/a"}, {Key: "prefix/b"}})
+	Assert(t).AreEqual(len(receivePairs(t, pairs1)), 2, "first watch should have gotten the change")
+	Assert(t).AreEqual(len(receivePairs(t, pairs2)), 2, "second watch should have gotten the change")
+	Assert(t).AreEqual(lister.getInitialLists(), 1, "should have only started one query")
+
+	close(quit1)
+	_, ok := <-pairs1
+	Assert(t).IsFalse(ok, "should have closed the output of a finished watch")
+	Assert(t).AreEqual(dispatcher.Prefixes(), 1, "query should run while it has watches")
+
+	close(quit2)
+	_, ok = <-pairs2
+	Assert(t).IsFalse(ok, "should have closed the output of a finished watch")
+	Assert(t).AreEqual(dispatcher.Prefixes(), 0, "query should stop after its last watch")
+}
+
+func TestWatchDispatcherSlowWatchGetsLatest(t *testing.T) {
+	lister := newBlockingLister()
+	lister.set(api.KVPairs{})
+	dispatcher := NewWatchDispatcher(lister)
+
+	quitSlow, quitFast := make(chan struct{}), make(chan struct{})
+	defer close(quitSlow)
+	defer close(quitFast)
+	slow, fast := make(chan api.KVPairs), make(chan api.KVPairs)
+	go dispatcher.WatchPrefix("prefix/", slow, quitSlow, make(chan error), 0)
+	go dispatcher.WatchPrefix("prefix/", fast, quitFast, make(chan error), 0)
+	receivePairs(t, fast)
+
+	// the slow watch isn't read while the prefix changes
+	for i := 1; i <= 3; i++ {
+		var pairs api.KVPairs
+		for j := 0; j < i; j++ {
+			pairs = append(pairs, &api.KVPair{Key: "prefix/key"})
+		}
+		lister.set(pairs)
+		Assert(t).AreEqual(len(receivePairs(t, fast)), i, "fast watch should not have been held up by the slow one")
+	}
+
+	// waits for the pause between queries, since the slow watch may still
+	// be sent the initial pairs first
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case pairs := <-slow:
+			if len(pairs) == 3 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("slow watch should have gotten the latest pairs")
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package consulutil
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// The consul API client only reports the status of a failed request in the
+// text of its error, for example "Unexpected response code: 403 (Permission
+// denied)", so these are what errors from it are classified by.
+const (
+	unexpectedResponse = "Unexpected response code: "
+	permissionDenied   = "Permission denied"
+	noClusterLeader    = "No cluster leader"
+)
+
+// UnavailableError is returned when consul couldn't be reached or couldn't
+// serve a request, for example because the agent is down or the cluster has
+// no leader. Operations that fail this way may succeed if they are retried.
+type UnavailableError struct {
+	Err error
+}
+
+func (err UnavailableError) Error() string {
+	return err.Err.Error()
+}
+
+// PermissionDeniedError is returned when consul's ACLs forbid a request
+type PermissionDeniedError struct {
+	Err error
+}
+
+func (err PermissionDeniedError) Error() string {
+	return err.Err.Error()
+}
+
+// NotFoundError is returned when an operation requires a key that doesn't
+// exist
+type NotFoundError struct {
+	Key string
+}
+
+func (err NotFoundError) Error() string {
+	return fmt.Sprintf("Key %q was not found", err.Key)
+}
+
+// NotFound implements the interface checked by IsNotFound
+func (err NotFoundError) NotFound() bool {
+	return true
+}
+
+// CASConflictError is returned when a check-and-set fails because the key
+// was modified since it was read
+type CASConflictError struct {
+	Key string
+}
+
+func (err CASConflictError) Error() string {
+	return fmt.Sprintf("Could not check-and-set key %q", err.Key)
+}
+
+// CASConflict implements the interface checked by IsCASConflict
+func (err CASConflictError) CASConflict() bool {
+	return true
+}
+
+// Errors of other stores that mean a key doesn't exist or a check-and-set
+// failed can implement these to be recognized by IsNotFound and
+// IsCASConflict, so that callers don't need to know which store they came
+// from.
+type notFound interface {
+	NotFound() bool
+}
+
+type casConflict interface {
+	CASConflict() bool
+}
+
+// classifyError wraps an error returned by the consul API client in
+// UnavailableError or PermissionDeniedError if it is one of those. Other
+// errors are returned unchanged.
+func classifyError(err error) error {
+	switch err.(type) {
+	case nil, UnavailableError, PermissionDeniedError, NotFoundError, CASConflictError:
+		return err
+	case *url.Error, *net.OpError:
+		return UnavailableError{Err: err}
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, permissionDenied), strings.Contains(msg, unexpectedResponse+"403"):
+		return PermissionDeniedError{Err: err}
+	case strings.Contains(msg, unexpectedResponse+"5"), strings.Contains(msg, noClusterLeader):
+		return UnavailableError{Err: err}
+	}
+	return err
+}
+
+// cause returns the error wrapped by a KVError, or err itself
+func cause(err error) error {
+	switch kvErr := err.(type) {
+	case KVError:
+		return kvErr.KVError
+	case *KVError:
+		return kvErr.KVError
+	}
+	return err
+}
+
+// IsUnavailable returns whether err means that consul couldn't be reached or
+// couldn't serve the request
+func IsUnavailable(err error) bool {
+	_, ok := classifyError(cause(err)).(UnavailableError)
+	return ok
+}
+
+// IsPermissionDenied returns whether err means that consul's ACLs forbade
+// the request
+func IsPermissionDenied(err error) bool {
+	_, ok := classifyError(cause(err)).(PermissionDeniedError)
+	return ok
+}
+
+// IsNotFound returns whether err means that a key doesn't exist
+func IsNotFound(err error) bool {
+	nf, ok := cause(err).(notFound)
+	return ok && nf.NotFound()
+}
+
+// IsCASConflict returns whether err means that a check-and-set failed
+// because the key was modified since it was read
+func IsCASConflict(err error) bool {
+	cc, ok := cause(err).(casConflict)
+	return ok && cc.CASConflict()
+}
+
+// IsRetryable returns whether the operation that failed with err may
+// succeed if it is retried unchanged. A CAS conflict is not retryable in this
+// sense, since the key must be read again first.
+func IsRetryable(err error) bool {
+	return IsUnavailable(err)
+}
@@ -0,0 +1,77 @@
+package consulutil
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+func TestErrorClassification(t *testing.T) {
+	denied := NewKVError("get", "some/key", errors.New("Unexpected response code: 403 (Permission denied)"))
+	Assert(t).IsTrue(IsPermissionDenied(denied), "403 should have been classified as permission denied")
+	Assert(t).IsFalse(IsRetryable(denied), "permission denied should not be retryable")
+
+	unavailable := []error{
+		NewKVError("list", "some/key", errors.New("Unexpected response code: 500 (No cluster leader)")),
+		NewKVError("put", "some/key", &url.Error{Op: "Put", URL: "http://localhost:8500", Err: errors.New("connection refused")}),
+	}
+	for _, err := range unavailable {
+		Assert(t).IsTrue(IsUnavailable(err), "should have been classified as unavailable: "+err.Error())
+		Assert(t).IsTrue(IsRetryable(err), "unavailable should be retryable: "+err.Error())
+		Assert(t).IsFalse(IsPermissionDenied(err), "should not have been classified as permission denied: "+err.Error())
+	}
+
+	Assert(t).IsTrue(IsNotFound(NotFoundError{Key: "some/key"}), "NotFoundError should be not found")
+	Assert(t).IsTrue(IsCASConflict(CASConflictError{Key: "some/key"}), "CASConflictError should be a CAS conflict")
+
+	other := NewKVError("get", "some/key", errors.New("invalid character"))
+	Assert(t).IsFalse(IsUnavailable(other) || IsPermissionDenied(other) || IsNotFound(other) || IsCASConflict(other), "unknown errors should not be classified")
+	Assert(t).IsFalse(IsRetryable(nil), "nil should not be retryable")
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond}
+	Assert(t).AreEqual(policy.Backoff(1), time.Millisecond, "first backoff should be the initial backoff")
+	Assert(t).AreEqual(policy.Backoff(3), 4*time.Millisecond, "backoff should double")
+	Assert(t).AreEqual(policy.Backoff(10), 4*time.Millisecond, "backoff should not exceed the maximum")
+
+	calls := 0
+	err := Retry(nil, policy, func() error {
+		calls++
+		if calls < 3 {
+			return UnavailableError{Err: errors.New("agent is down")}
+		}
+		return nil
+	})
+	Assert(t).IsNil(err, "should have succeeded once consul was available")
+	Assert(t).AreEqual(calls, 3, "should have retried while consul was unavailable")
+
+	calls = 0
+	denied := PermissionDeniedError{Err: errors.New("Permission denied")}
+	err = Retry(nil, policy, func() error {
+		calls++
+		return denied
+	})
+	Assert(t).AreEqual(err, error(denied), "should have returned the error that wasn't retryable")
+	Assert(t).AreEqual(calls, 1, "should not have retried permission denied")
+
+	calls = 0
+	policy.MaxAttempts = 2
+	err = Retry(nil, policy, func() error {
+		calls++
+		return UnavailableError{Err: errors.New("agent is down")}
+	})
+	Assert(t).IsTrue(IsUnavailable(err), "should have returned the last error")
+	Assert(t).AreEqual(calls, 2, "should have stopped after the maximum attempts")
+
+	quit := make(chan struct{})
+	close(quit)
+	policy.MaxAttempts = 0
+	err = Retry(quit, policy, func() error {
+		return UnavailableError{Err: errors.New("agent is down")}
+	})
+	Assert(t).AreEqual(err, CanceledError, "should have stopped retrying when quit was closed")
+}
@@ -0,0 +1,332 @@
+package consulutil
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+)
+
+// ErrCircuitOpen is the cause of the UnavailableError returned for requests
+// that a limited client rejected without sending because consul has failed
+// repeatedly
+var ErrCircuitOpen = errors.New("Consul circuit breaker is open after repeated failures")
+
+// LimitConfig configures the client returned by NewLimitedClient. The zero
+// value doesn't limit anything.
+type LimitConfig struct {
+	// RequestsPerSecond is the sustained rate of requests sent to consul.
+	// Requests beyond it wait for their turn. Zero means no limit.
+	RequestsPerSecond float64
+	// Burst is how many requests may be sent at once above
+	// RequestsPerSecond. It defaults to 1.
+	Burst int
+
+	// FailureThreshold is how many consecutive requests must fail because
+	// consul is unavailable for the circuit breaker to open. While it is
+	// open, requests fail immediately without being sent. Zero disables
+	// the circuit breaker.
+	FailureThreshold int
+	// OpenDuration is how long the circuit breaker stays open before
+	// letting requests through again to find out whether consul has
+	// recovered. It defaults to 10 seconds.
+	OpenDuration time.Duration
+
+	// ServeStale makes non-blocking reads (Get, Keys and List without a
+	// WaitIndex) return the last value read for the same key when consul
+	// is unavailable, instead of failing. Every key read is kept in memory
+	// for this, so it should only be enabled for clients that read a
+	// bounded set of keys.
+	ServeStale bool
+}
+
+// NewLimitedClient returns a ConsulClient that rate limits the requests of
+// client and stops sending them while consul is failing, according to
+// config, so that a misbehaving control loop can't saturate consul and
+// callers degrade gracefully during outages. A zero config returns client
+// itself.
+func NewLimitedClient(client ConsulClient, config LimitConfig) ConsulClient {
+	if config == (LimitConfig{}) {
+		return client
+	}
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = 10 * time.Second
+	}
+
+	limiter := &requestLimiter{config: config}
+	if config.RequestsPerSecond > 0 {
+		limiter.rate = rate.NewLimiter(rate.Limit(config.RequestsPerSecond), config.Burst)
+	}
+	if config.ServeStale {
+		limiter.stale = make(map[staleKey]staleValue)
+	}
+	return limitedClient{
+		client: client,
+		kv: limitedKV{
+			kv:      client.KV(),
+			limiter: limiter,
+		},
+		limiter: limiter,
+	}
+}
+
+// requestLimiter holds the rate limiter, circuit breaker and stale reads
+// shared by the KV and session clients of a limited client
+type requestLimiter struct {
+	config LimitConfig
+	rate   *rate.Limiter
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	stale     map[staleKey]staleValue
+}
+
+type staleKey struct {
+	op, key, separator string
+}
+
+type staleValue struct {
+	pair  *api.KVPair
+	pairs api.KVPairs
+	keys  []string
+	meta  *api.QueryMeta
+}
+
+// do sends a request with f, once the rate limit allows it and if the
+// circuit breaker is closed
+func (l *requestLimiter) do(f func() error) error {
+	if l.config.FailureThreshold > 0 {
+		l.mu.Lock()
+		open := time.Now().Before(l.openUntil)
+		l.mu.Unlock()
+		if open {
+			return UnavailableError{Err: ErrCircuitOpen}
+		}
+	}
+	if l.rate != nil {
+		// Wait only fails if the context is canceled
+		_ = l.rate.Wait(context.Background())
+	}
+
+	err := f()
+	if l.config.FailureThreshold > 0 {
+		l.record(err)
+	}
+	return err
+}
+
+func (l *requestLimiter) record(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !IsUnavailable(err) {
+		l.failures = 0
+		return
+	}
+	l.failures++
+	if l.failures >= l.config.FailureThreshold {
+		l.openUntil = time.Now().Add(l.config.OpenDuration)
+	}
+}
+
+// read sends a read with f, which stores its result in value. If the read is
+// not blocking, its result is kept to serve from if a later read of the same
+// key fails because consul is unavailable.
+func (l *requestLimiter) read(key staleKey, q *api.QueryOptions, value *staleValue, f func() error) error {
+	err := l.do(f)
+	if l.stale == nil || (q != nil && q.WaitIndex != 0) {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		l.stale[key] = *value
+		return nil
+	}
+	if stale, ok := l.stale[key]; ok && IsUnavailable(err) {
+		*value = stale
+		return nil
+	}
+	return err
+}
+
+type limitedClient struct {
+	client  ConsulClient
+	kv      limitedKV
+	limiter *requestLimiter
+}
+
+func (c limitedClient) KV() ConsulKVClient {
+	return c.kv
+}
+
+func (c limitedClient) Session() ConsulSessionClient {
+	return limitedSession{
+		session: c.client.Session(),
+		limiter: c.limiter,
+	}
+}
+
+type limitedKV struct {
+	kv      ConsulKVClient
+	limiter *requestLimiter
+}
+
+var _ ConsulKVClient = limitedKV{}
+
+func (l limitedKV) Acquire(p *api.KVPair, q *api.WriteOptions) (ok bool, meta *api.WriteMeta, err error) {
+	err = l.limiter.do(func() error {
+		ok, meta, err = l.kv.Acquire(p, q)
+		return err
+	})
+	return ok, meta, err
+}
+
+func (l limitedKV) CAS(p *api.KVPair, q *api.WriteOptions) (ok bool, meta *api.WriteMeta, err error) {
+	err = l.limiter.do(func() error {
+		ok, meta, err = l.kv.CAS(p, q)
+		return err
+	})
+	return ok, meta, err
+}
+
+func (l limitedKV) Delete(key string, w *api.WriteOptions) (meta *api.WriteMeta, err error) {
+	err = l.limiter.do(func() error {
+		meta, err = l.kv.Delete(key, w)
+		return err
+	})
+	return meta, err
+}
+
+func (l limitedKV) DeleteCAS(p *api.KVPair, q *api.WriteOptions) (ok bool, meta *api.WriteMeta, err error) {
+	err = l.limiter.do(func() error {
+		ok, meta, err = l.kv.DeleteCAS(p, q)
+		return err
+	})
+	return ok, meta, err
+}
+
+func (l limitedKV) DeleteTree(prefix string, w *api.WriteOptions) (meta *api.WriteMeta, err error) {
+	err = l.limiter.do(func() error {
+		meta, err = l.kv.DeleteTree(prefix, w)
+		return err
+	})
+	return meta, err
+}
+
+func (l limitedKV) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	var value staleValue
+	err := l.limiter.read(staleKey{op: "get", key: key}, q, &value, func() (err error) {
+		value.pair, value.meta, err = l.kv.Get(key, q)
+		return err
+	})
+	return value.pair, value.meta, err
+}
+
+func (l limitedKV) Keys(prefix, separator string, q *api.QueryOptions) ([]string, *api.QueryMeta, error) {
+	var value staleValue
+	err := l.limiter.read(staleKey{op: "keys", key: prefix, separator: separator}, q, &value, func() (err error) {
+		value.keys, value.meta, err = l.kv.Keys(prefix, separator, q)
+		return err
+	})
+	return value.keys, value.meta, err
+}
+
+func (l limitedKV) List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	var value staleValue
+	err := l.limiter.read(staleKey{op: "list", key: prefix}, q, &value, func() (err error) {
+		value.pairs, value.meta, err = l.kv.List(prefix, q)
+		return err
+	})
+	return value.pairs, value.meta, err
+}
+
+func (l limitedKV) Put(pair *api.KVPair, w *api.WriteOptions) (meta *api.WriteMeta, err error) {
+	err = l.limiter.do(func() error {
+		meta, err = l.kv.Put(pair, w)
+		return err
+	})
+	return meta, err
+}
+
+func (l limitedKV) Release(p *api.KVPair, q *api.WriteOptions) (ok bool, meta *api.WriteMeta, err error) {
+	err = l.limiter.do(func() error {
+		ok, meta, err = l.kv.Release(p, q)
+		return err
+	})
+	return ok, meta, err
+}
+
+func (l limitedKV) Txn(txn api.KVTxnOps, q *api.QueryOptions) (ok bool, resp *api.KVTxnResponse, meta *api.QueryMeta, err error) {
+	err = l.limiter.do(func() error {
+		ok, resp, meta, err = l.kv.Txn(txn, q)
+		return err
+	})
+	return ok, resp, meta, err
+}
+
+type limitedSession struct {
+	session ConsulSessionClient
+	limiter *requestLimiter
+}
+
+var _ ConsulSessionClient = limitedSession{}
+
+func (l limitedSession) Create(se *api.SessionEntry, q *api.WriteOptions) (id string, meta *api.WriteMeta, err error) {
+	err = l.limiter.do(func() error {
+		id, meta, err = l.session.Create(se, q)
+		return err
+	})
+	return id, meta, err
+}
+
+func (l limitedSession) CreateNoChecks(se *api.SessionEntry, q *api.WriteOptions) (id string, meta *api.WriteMeta, err error) {
+	err = l.limiter.do(func() error {
+		id, meta, err = l.session.CreateNoChecks(se, q)
+		return err
+	})
+	return id, meta, err
+}
+
+func (l limitedSession) Destroy(id string, q *api.WriteOptions) (meta *api.WriteMeta, err error) {
+	err = l.limiter.do(func() error {
+		meta, err = l.session.Destroy(id, q)
+		return err
+	})
+	return meta, err
+}
+
+func (l limitedSession) Info(id string, q *api.QueryOptions) (entry *api.SessionEntry, meta *api.QueryMeta, err error) {
+	err = l.limiter.do(func() error {
+		entry, meta, err = l.session.Info(id, q)
+		return err
+	})
+	return entry, meta, err
+}
+
+func (l limitedSession) List(q *api.QueryOptions) (entries []*api.SessionEntry, meta *api.QueryMeta, err error) {
+	err = l.limiter.do(func() error {
+		entries, meta, err = l.session.List(q)
+		return err
+	})
+	return entries, meta, err
+}
+
+// Renew is neither rate limited nor rejected by the circuit breaker, since
+// a session that isn't renewed in time is lost along with its locks
+func (l limitedSession) Renew(id string, q *api.WriteOptions) (*api.SessionEntry, *api.WriteMeta, error) {
+	return l.session.Renew(id, q)
+}
+
+// RenewPeriodic is neither rate limited nor rejected by the circuit breaker,
+// for the same reason as Renew
+func (l limitedSession) RenewPeriodic(initialTTL string, id string, q *api.WriteOptions, doneCh chan struct{}) error {
+	return l.session.RenewPeriodic(initialTTL, id, q, doneCh)
+}
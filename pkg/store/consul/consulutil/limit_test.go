@@ -0,0 +1,73 @@
+package consulutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/hashicorp/consul/api"
+)
+
+// flakyKV fails every request while down is set, as if the agent were down
+type flakyKV struct {
+	*FakeKV
+	down  bool
+	calls int
+}
+
+func (f *flakyKV) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	f.calls++
+	if f.down {
+		return nil, nil, UnavailableError{Err: errors.New("connection refused")}
+	}
+	return f.FakeKV.Get(key, q)
+}
+
+func TestLimitedClientCircuitBreaker(t *testing.T) {
+	kv := &flakyKV{FakeKV: NewKVWithEntries(nil)}
+	client := NewLimitedClient(FakeConsulClient{KV_: kv}, LimitConfig{
+		FailureThreshold: 2,
+		OpenDuration:     time.Hour,
+		ServeStale:       true,
+	})
+
+	_, err := client.KV().Put(&api.KVPair{Key: "some/key", Value: []byte("value")}, nil)
+	Assert(t).IsNil(err, "put should have succeeded")
+	pair, _, err := client.KV().Get("some/key", nil)
+	Assert(t).IsNil(err, "get should have succeeded")
+
+	kv.down = true
+	pair, _, err = client.KV().Get("some/key", nil)
+	Assert(t).IsNil(err, "should have served the stale value while consul was down")
+	Assert(t).AreEqual(string(pair.Value), "value", "should have served the last value read")
+
+	_, _, err = client.KV().Get("other/key", nil)
+	Assert(t).IsTrue(IsUnavailable(err), "should have failed a key that was never read")
+	calls := kv.calls
+
+	_, _, err = client.KV().Get("other/key", nil)
+	Assert(t).IsTrue(IsUnavailable(err), "should have failed while the circuit was open")
+	Assert(t).AreEqual(kv.calls, calls, "should not have sent requests while the circuit was open")
+	_, err = client.KV().Put(&api.KVPair{Key: "some/key"}, nil)
+	Assert(t).IsTrue(IsUnavailable(err), "writes should fail while the circuit is open")
+
+	_, _, err = client.KV().Get("some/key", &api.QueryOptions{WaitIndex: 5})
+	Assert(t).IsTrue(IsUnavailable(err), "blocking reads should not be served stale values")
+}
+
+func TestLimitedClientRateLimit(t *testing.T) {
+	client := NewLimitedClient(FakeConsulClient{KV_: NewKVWithEntries(nil)}, LimitConfig{
+		RequestsPerSecond: 100,
+	})
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		_, _, err := client.KV().Get("some/key", nil)
+		Assert(t).IsNil(err, "get should have succeeded")
+	}
+	Assert(t).IsTrue(time.Since(start) >= 40*time.Millisecond, "requests should have been rate limited")
+
+	raw := FakeConsulClient{KV_: NewKVWithEntries(nil)}
+	Assert(t).AreEqual(NewLimitedClient(raw, LimitConfig{}), ConsulClient(raw), "a zero config should not wrap the client")
+}
@@ -0,0 +1,136 @@
+package consulutil
+
+import (
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/rcrowley/go-metrics"
+)
+
+// NewMetricsClient returns a ConsulClient that records the latency of the KV
+// requests of client in registry, in a "consul_kv_<op>" timer per operation,
+// and counts the requests that fail in "consul_kv_<op>_errors". Blocking reads
+// are left out, since their latency is how long consul waited for a change;
+// the watches that make them record their own latencies.
+func NewMetricsClient(client ConsulClient, registry metrics.Registry) ConsulClient {
+	return metricsClient{
+		client: client,
+		kv: metricsKV{
+			kv:       client.KV(),
+			registry: registry,
+		},
+	}
+}
+
+type metricsClient struct {
+	client ConsulClient
+	kv     metricsKV
+}
+
+func (c metricsClient) KV() ConsulKVClient {
+	return c.kv
+}
+
+func (c metricsClient) Session() ConsulSessionClient {
+	return c.client.Session()
+}
+
+type metricsKV struct {
+	kv       ConsulKVClient
+	registry metrics.Registry
+}
+
+var _ ConsulKVClient = metricsKV{}
+
+// record records a request of op that started at start
+func (m metricsKV) record(op string, start time.Time, err error) {
+	metrics.GetOrRegisterTimer("consul_kv_"+op, m.registry).UpdateSince(start)
+	if err != nil {
+		metrics.GetOrRegisterCounter("consul_kv_"+op+"_errors", m.registry).Inc(1)
+	}
+}
+
+// recordRead records a read unless it was blocking
+func (m metricsKV) recordRead(op string, q *api.QueryOptions, start time.Time, err error) {
+	if q != nil && q.WaitIndex != 0 {
+		return
+	}
+	m.record(op, start, err)
+}
+
+func (m metricsKV) Acquire(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	start := time.Now()
+	ok, meta, err := m.kv.Acquire(p, q)
+	m.record("acquire", start, err)
+	return ok, meta, err
+}
+
+func (m metricsKV) CAS(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	start := time.Now()
+	ok, meta, err := m.kv.CAS(p, q)
+	m.record("cas", start, err)
+	return ok, meta, err
+}
+
+func (m metricsKV) Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	start := time.Now()
+	meta, err := m.kv.Delete(key, w)
+	m.record("delete", start, err)
+	return meta, err
+}
+
+func (m metricsKV) DeleteCAS(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	start := time.Now()
+	ok, meta, err := m.kv.DeleteCAS(p, q)
+	m.record("delete_cas", start, err)
+	return ok, meta, err
+}
+
+func (m metricsKV) DeleteTree(prefix string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	start := time.Now()
+	meta, err := m.kv.DeleteTree(prefix, w)
+	m.record("delete_tree", start, err)
+	return meta, err
+}
+
+func (m metricsKV) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	start := time.Now()
+	pair, meta, err := m.kv.Get(key, q)
+	m.recordRead("get", q, start, err)
+	return pair, meta, err
+}
+
+func (m metricsKV) Keys(prefix, separator string, q *api.QueryOptions) ([]string, *api.QueryMeta, error) {
+	start := time.Now()
+	keys, meta, err := m.kv.Keys(prefix, separator, q)
+	m.recordRead("keys", q, start, err)
+	return keys, meta, err
+}
+
+func (m metricsKV) List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	start := time.Now()
+	pairs, meta, err := m.kv.List(prefix, q)
+	m.recordRead("list", q, start, err)
+	return pairs, meta, err
+}
+
+func (m metricsKV) Put(pair *api.KVPair, w *api.WriteOptions) (*api.WriteMeta, error) {
+	start := time.Now()
+	meta, err := m.kv.Put(pair, w)
+	m.record("put", start, err)
+	return meta, err
+}
+
+func (m metricsKV) Release(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	start := time.Now()
+	ok, meta, err := m.kv.Release(p, q)
+	m.record("release", start, err)
+	return ok, meta, err
+}
+
+func (m metricsKV) Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	start := time.Now()
+	ok, resp, meta, err := m.kv.Txn(txn, q)
+	m.record("txn", start, err)
+	return ok, resp, meta, err
+}
@@ -0,0 +1,38 @@
+package consulutil
+
+import (
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/hashicorp/consul/api"
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestMetricsClientRecordsLatencies(t *testing.T) {
+	registry := metrics.NewRegistry()
+	kv := &flakyKV{FakeKV: NewKVWithEntries(nil)}
+	client := NewMetricsClient(FakeConsulClient{KV_: kv}, registry)
+
+	_, err := client.KV().Put(&api.KVPair{Key: "some/key", Value: []byte("value")}, nil)
+	Assert(t).IsNil(err, "put should have succeeded")
+	_, _, err = client.KV().Get("some/key", nil)
+	Assert(t).IsNil(err, "get should have succeeded")
+	kv.down = true
+	_, _, err = client.KV().Get("some/key", nil)
+	Assert(t).IsNotNil(err, "get should have failed while consul was down")
+
+	Assert(t).AreEqual(metrics.GetOrRegisterTimer("consul_kv_put", registry).Count(), int64(1), "should have timed the put")
+	Assert(t).AreEqual(metrics.GetOrRegisterTimer("consul_kv_get", registry).Count(), int64(2), "should have timed both gets")
+	Assert(t).AreEqual(metrics.GetOrRegisterCounter("consul_kv_get_errors", registry).Count(), int64(1), "should have counted the failed get")
+	Assert(t).AreEqual(metrics.GetOrRegisterCounter("consul_kv_put_errors", registry).Count(), int64(0), "should not have counted the put as failed")
+}
+
+func TestMetricsClientSkipsBlockingReads(t *testing.T) {
+	registry := metrics.NewRegistry()
+	kv := &flakyKV{FakeKV: NewKVWithEntries(nil), down: true}
+	client := NewMetricsClient(FakeConsulClient{KV_: kv}, registry)
+
+	_, _, err := client.KV().Get("some/key", &api.QueryOptions{WaitIndex: 5})
+	Assert(t).IsTrue(IsUnavailable(err), "get should have failed while consul was down")
+	Assert(t).AreEqual(metrics.GetOrRegisterTimer("consul_kv_get", registry).Count(), int64(0), "should not have timed a blocking read")
+}
@@ -0,0 +1,150 @@
+package consulutil
+
+import (
+	"path"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// NamespacePrefix returns the prefix of the keys of a namespace, e.g.
+// "p2/<namespace>/". The intent, reality, hooks, health and every other tree
+// of a namespace are stored under it.
+func NamespacePrefix(namespace string) string {
+	return path.Join("p2", namespace) + "/"
+}
+
+// NewNamespacedClient returns a ConsulClient that reads and writes the keys
+// of client under the prefix of namespace, so that several independent p2
+// installations can share one consul cluster without colliding. Keys passed
+// to the returned client are relative to the namespace, and so are the keys
+// it returns, which means that the stores built on it don't need to know
+// about namespaces. An empty namespace returns client itself.
+func NewNamespacedClient(client ConsulClient, namespace string) ConsulClient {
+	if namespace == "" {
+		return client
+	}
+	return namespacedClient{
+		client: client,
+		kv: namespacedKV{
+			kv:     client.KV(),
+			prefix: NamespacePrefix(namespace),
+		},
+	}
+}
+
+type namespacedClient struct {
+	client ConsulClient
+	kv     namespacedKV
+}
+
+func (c namespacedClient) KV() ConsulKVClient {
+	return c.kv
+}
+
+// Session returns the session client of the wrapped client, since sessions
+// aren't keys and are only used through the keys they lock
+func (c namespacedClient) Session() ConsulSessionClient {
+	return c.client.Session()
+}
+
+type namespacedKV struct {
+	kv     ConsulKVClient
+	prefix string
+}
+
+var _ ConsulKVClient = namespacedKV{}
+
+// in returns a copy of pair with its key moved into the namespace
+func (n namespacedKV) in(pair *api.KVPair) *api.KVPair {
+	if pair == nil {
+		return nil
+	}
+	namespaced := *pair
+	namespaced.Key = n.prefix + pair.Key
+	return &namespaced
+}
+
+// out returns a copy of pair with its key made relative to the namespace
+func (n namespacedKV) out(pair *api.KVPair) *api.KVPair {
+	if pair == nil {
+		return nil
+	}
+	relative := *pair
+	relative.Key = strings.TrimPrefix(pair.Key, n.prefix)
+	return &relative
+}
+
+func (n namespacedKV) Acquire(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	return n.kv.Acquire(n.in(p), q)
+}
+
+func (n namespacedKV) CAS(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	return n.kv.CAS(n.in(p), q)
+}
+
+func (n namespacedKV) Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	return n.kv.Delete(n.prefix+key, w)
+}
+
+func (n namespacedKV) DeleteCAS(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	return n.kv.DeleteCAS(n.in(p), q)
+}
+
+func (n namespacedKV) DeleteTree(prefix string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	return n.kv.DeleteTree(n.prefix+prefix, w)
+}
+
+func (n namespacedKV) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	pair, meta, err := n.kv.Get(n.prefix+key, q)
+	return n.out(pair), meta, err
+}
+
+func (n namespacedKV) Keys(prefix, separator string, q *api.QueryOptions) ([]string, *api.QueryMeta, error) {
+	keys, meta, err := n.kv.Keys(n.prefix+prefix, separator, q)
+	if err != nil {
+		return nil, meta, err
+	}
+	relative := make([]string, len(keys))
+	for i, key := range keys {
+		relative[i] = strings.TrimPrefix(key, n.prefix)
+	}
+	return relative, meta, nil
+}
+
+func (n namespacedKV) List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	pairs, meta, err := n.kv.List(n.prefix+prefix, q)
+	if err != nil {
+		return nil, meta, err
+	}
+	relative := make(api.KVPairs, len(pairs))
+	for i, pair := range pairs {
+		relative[i] = n.out(pair)
+	}
+	return relative, meta, nil
+}
+
+func (n namespacedKV) Put(pair *api.KVPair, w *api.WriteOptions) (*api.WriteMeta, error) {
+	return n.kv.Put(n.in(pair), w)
+}
+
+func (n namespacedKV) Release(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	return n.kv.Release(n.in(p), q)
+}
+
+func (n namespacedKV) Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	namespaced := make(api.KVTxnOps, len(txn))
+	for i, op := range txn {
+		namespacedOp := *op
+		namespacedOp.Key = n.prefix + op.Key
+		namespaced[i] = &namespacedOp
+	}
+
+	ok, resp, meta, err := n.kv.Txn(namespaced, q)
+	if resp != nil {
+		for i, pair := range resp.Results {
+			resp.Results[i] = n.out(pair)
+		}
+	}
+	return ok, resp, meta, err
+}
@@ -0,0 +1,79 @@
+package consulutil
+
+import (
+	"time"
+)
+
+// RetryPolicy describes how an operation against consul is retried
+type RetryPolicy struct {
+	// InitialBackoff is the time waited before the first retry. It doubles
+	// after every retry, up to MaxBackoff if it isn't zero.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// MaxAttempts is the number of times the operation is tried before its
+	// last error is returned. Zero means there is no limit.
+	MaxAttempts int
+
+	// Retryable returns whether an error should be retried. If it is nil,
+	// IsRetryable is used.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy retries operations for as long as consul is
+// unavailable, backing off from 100ms to a minute
+var DefaultRetryPolicy = RetryPolicy{
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     time.Minute,
+}
+
+// RetryAll can be used as a RetryPolicy's Retryable to retry every error
+func RetryAll(error) bool {
+	return true
+}
+
+// Backoff returns the time to wait after the given number of failed
+// attempts, for loops that can't use Retry because they wait on other
+// channels as well
+func (p RetryPolicy) Backoff(failures int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < failures; i++ {
+		if p.MaxBackoff > 0 && backoff >= p.MaxBackoff {
+			break
+		}
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable == nil {
+		return IsRetryable(err)
+	}
+	return p.Retryable(err)
+}
+
+// Retry calls f until it succeeds, returns an error that the policy doesn't
+// retry, or has been called the policy's maximum number of times, waiting
+// between calls according to the policy. The last error from f is returned.
+// If quit is closed while waiting, CanceledError is returned.
+func Retry(quit <-chan struct{}, policy RetryPolicy, f func() error) error {
+	for failures := 1; ; failures++ {
+		err := f()
+		if err == nil || !policy.retryable(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && failures >= policy.MaxAttempts {
+			return err
+		}
+
+		select {
+		case <-quit:
+			return CanceledError
+		case <-time.After(policy.Backoff(failures)):
+		}
+	}
+}
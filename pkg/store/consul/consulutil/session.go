@@ -7,6 +7,7 @@ import (
 	"github.com/hashicorp/consul/api"
 
 	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/randseed"
 )
 
 const (
@@ -68,23 +69,140 @@ func (u unlocker) Key() string {
 	return u.key
 }
 
+// StealLock acquires the lock on key even if it is held by another session.
+// The holder is given one TTL of its session to release the lock; if it
+// still holds it after that, its session is destroyed, releasing every lock
+// it holds, and the lock is acquired. This is meant for operator tooling
+// that must make progress when a lock holder has hung. Closing quit stops the
+// wait and returns the AlreadyLockedError.
+func (s Session) StealLock(key string, quit <-chan struct{}) (Unlocker, error) {
+	unlocker, err := s.Lock(key)
+	if !IsAlreadyLocked(err) {
+		return unlocker, err
+	}
+
+	kvp, _, err := s.client.KV().Get(key, nil)
+	if err != nil {
+		return nil, NewKVError("get", key, err)
+	}
+	if kvp == nil || kvp.Session == "" {
+		// released between the two requests
+		return s.Lock(key)
+	}
+	holder := kvp.Session
+	entry, _, err := s.client.Session().Info(holder, nil)
+	if err != nil {
+		return nil, util.Errorf("Could not get session %q holding %q: %s", holder, key, err)
+	}
+	if entry != nil && entry.TTL != "" {
+		ttl, err := time.ParseDuration(entry.TTL)
+		if err != nil {
+			return nil, util.Errorf("Session %q holding %q has invalid TTL %q", holder, key, entry.TTL)
+		}
+		select {
+		case <-time.After(ttl):
+		case <-quit:
+			return nil, AlreadyLockedError{Key: key}
+		}
+	}
+
+	kvp, _, err = s.client.KV().Get(key, nil)
+	if err != nil {
+		return nil, NewKVError("get", key, err)
+	}
+	if kvp != nil && kvp.Session == holder {
+		_, err = s.client.Session().Destroy(holder, nil)
+		if err != nil {
+			return nil, util.Errorf("Could not destroy session %q holding %q: %s", holder, key, err)
+		}
+		// the key can't be acquired until the lock delay of the destroyed
+		// session has passed
+		if entry != nil {
+			select {
+			case <-time.After(entry.LockDelay):
+			case <-quit:
+				return nil, AlreadyLockedError{Key: key}
+			}
+		}
+	}
+	return s.Lock(key)
+}
+
+// continuallyRenew renews the session whenever renewalCh fires. A renewal
+// that fails because consul is unavailable is retried with backoff for as
+// long as the session's TTL may not have expired; any other failure, or the
+// session being invalidated, ends the session and closes lostCh.
 func (s Session) continuallyRenew() {
 	defer close(s.renewalErrCh)
+	lastRenewal := time.Now()
+	failures := 0
+	var retryCh <-chan time.Time
 	for {
 		select {
 		case <-s.renewalCh:
-			err := s.Renew()
-			if err != nil {
-				s.renewalErrCh <- err
-				_, _ = s.client.Session().Destroy(s.session, nil)
-				return
-			}
+		case <-retryCh:
 		case <-s.quitCh:
 			return
 		}
+		retryCh = nil
+
+		err := s.Renew()
+		if err == nil {
+			lastRenewal = time.Now()
+			failures = 0
+			continue
+		}
+		failures++
+		if IsRetryable(err) && time.Since(lastRenewal) < s.ttl {
+			backoff := sessionRenewalRetryPolicy.Backoff(failures)
+			if remaining := s.ttl - time.Since(lastRenewal); backoff > remaining {
+				backoff = remaining
+			}
+			retryCh = time.After(backoff)
+			continue
+		}
+
+		close(s.lostCh)
+		s.renewalErrCh <- err
+		_, _ = s.client.Session().Destroy(s.session, nil)
+		return
 	}
 }
 
+var sessionRenewalRetryPolicy = RetryPolicy{
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Retryable:      RetryAll,
+}
+
+// JitteredTicker returns a channel that fires every interval, offset by a
+// random amount of up to jitter in either direction so that many processes
+// started together don't renew their sessions at the same moment. It stops
+// once quit is closed.
+func JitteredTicker(interval time.Duration, jitter time.Duration, quit <-chan struct{}) <-chan time.Time {
+	ticks := make(chan time.Time)
+	go func() {
+		prng := randseed.NewRand()
+		for {
+			wait := interval
+			if jitter > 0 {
+				wait += time.Duration(prng.Int63n(int64(2*jitter))) - jitter
+			}
+			select {
+			case t := <-time.After(wait):
+				select {
+				case ticks <- t:
+				case <-quit:
+					return
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return ticks
+}
+
 type Unlocker interface {
 	Unlock() error
 	Key() string
@@ -113,9 +231,19 @@ type Session struct {
 
 	// signals when a renewal on the consul session should be performed
 	renewalCh <-chan time.Time
+
+	// closed when the session is lost, which means its locks are no longer
+	// held
+	lostCh chan struct{}
+
+	// how long the session lives without being renewed
+	ttl time.Duration
 }
 
-func NewManagedSession(client ConsulClient, session string, name string, quitCh chan struct{}, renewalErrCh chan error, renewalCh <-chan time.Time) *Session {
+// NewManagedSession wraps an existing session, renewing it whenever
+// renewalCh fires until quitCh is closed. ttl is the TTL the session was
+// created with, for which renewals are retried when consul is unavailable.
+func NewManagedSession(client ConsulClient, session string, name string, ttl time.Duration, quitCh chan struct{}, renewalErrCh chan error, renewalCh <-chan time.Time) *Session {
 	sess := &Session{
 		client:       client,
 		session:      session,
@@ -123,6 +251,8 @@ func NewManagedSession(client ConsulClient, session string, name string, quitCh
 		quitCh:       quitCh,
 		renewalErrCh: renewalErrCh,
 		renewalCh:    renewalCh,
+		lostCh:       make(chan struct{}),
+		ttl:          ttl,
 	}
 	// Could explore using c.client.Session().RenewPeriodic() instead, but
 	// specifying a renewalCh is nice for testing
@@ -154,19 +284,42 @@ func IsAlreadyLocked(err error) bool {
 	return ok
 }
 
+// SessionInvalidatedError is returned when a session can't be renewed
+// because consul has already destroyed it, e.g. because its TTL passed
+type SessionInvalidatedError struct {
+	Session string
+}
+
+func (err SessionInvalidatedError) Error() string {
+	return fmt.Sprintf("Could not renew because session %q was destroyed", err.Session)
+}
+
+func IsSessionInvalidated(err error) bool {
+	_, ok := err.(SessionInvalidatedError)
+	return ok
+}
+
 // refresh the TTL on this lock
 func (s Session) Renew() error {
 	entry, _, err := s.client.Session().Renew(s.session, nil)
 	if err != nil {
-		return util.Errorf("Could not renew lock")
+		return classifyError(err)
 	}
 
 	if entry == nil {
-		return util.Errorf("Could not renew because session was destroyed")
+		return SessionInvalidatedError{Session: s.session}
 	}
 	return nil
 }
 
+// Lost returns a channel that is closed when a managed session could not be
+// renewed, which means that the locks it held may have been acquired by
+// others. Work done under the session's locks should stop when it is closed.
+// The channel of an unmanaged session is never closed.
+func (s Session) Lost() <-chan struct{} {
+	return s.lostCh
+}
+
 // destroy a lock, releasing and deleting all the keys it holds
 func (s Session) Destroy() error {
 	if s.quitCh != nil {
@@ -25,6 +25,10 @@ var SessionMaxRetrySeconds = param.Int("session_max_retry_seconds", 300)
 // sessions come and go, the session ID (or "" for an expired session) will be sent on the
 // output channel.
 //
+// If config.ID is set, the session with that ID is adopted instead of creating the first
+// session, so that whatever is held under it survives a handoff from another process. A
+// new session is created if it has already expired.
+//
 // Parameters:
 //   config:  Configuration passed to Consul when creating a new session.
 //   client:  The Consul client to use.
@@ -72,7 +76,14 @@ func SessionManager(
 		default:
 		}
 		// Establish a new session
-		id, _, err := client.Session().CreateNoChecks(&config, nil)
+		id, err := adoptSession(client, config.ID)
+		config.ID = ""
+		if err != nil {
+			logger.WithError(err).Warn("session manager: could not adopt Consul session, creating a new one")
+		}
+		if id == "" {
+			id, _, err = client.Session().CreateNoChecks(&config, nil)
+		}
 		if err != nil {
 			logger.WithError(err).Error("session manager: error creating Consul session")
 			// Exponential backoff
@@ -112,6 +123,22 @@ func SessionManager(
 	}
 }
 
+// adoptSession renews the session with the given ID, returning it if it is still alive.
+// Returns "" if no ID is given or the session has expired.
+func adoptSession(client ConsulClient, id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	entry, _, err := client.Session().Renew(id, nil)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", nil
+	}
+	return id, nil
+}
+
 // WithSession executes the function f when there is an active session. When that session
 // ends, f is signaled to exit. Once f finishes, a new execution will start when a new
 // session begins.
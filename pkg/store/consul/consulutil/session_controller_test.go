@@ -77,6 +77,50 @@ func TestExit(t *testing.T) {
 	}
 }
 
+// TestSessionAdoption checks that a session that was handed over is used instead of
+// creating a new one, and that a new one is created if it has expired.
+func TestSessionAdoption(t *testing.T) {
+	t.Parallel()
+	f := NewFixture(t)
+	defer f.Stop()
+
+	handedOver, _, err := f.Client.Session().CreateNoChecks(&api.SessionEntry{TTL: "10s"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := f.Client.Session().CreateNoChecks(&api.SessionEntry{TTL: "10s"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Client.Session().Destroy(expired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{handedOver, expired} {
+		sessions := make(chan string)
+		done := make(chan struct{})
+		go SessionManager(
+			api.SessionEntry{ID: id, TTL: "10s"},
+			f.Client,
+			sessions,
+			done,
+			logging.TestLogger(),
+		)
+		s := <-sessions
+		close(done)
+		for range sessions {
+		}
+
+		if id == handedOver && s != id {
+			t.Errorf("expected session %s to be adopted, got %s", id, s)
+		}
+		if id == expired && (s == "" || s == id) {
+			t.Errorf("expected a new session instead of expired session %s, got %q", id, s)
+		}
+	}
+}
+
 // A basic test of WithSession: create and destroy sessions
 func TestWithSession(t *testing.T) {
 	t.Parallel()
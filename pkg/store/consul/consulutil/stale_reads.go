@@ -0,0 +1,67 @@
+package consulutil
+
+import (
+	"github.com/hashicorp/consul/api"
+)
+
+// NewStaleReadClient returns a ConsulClient whose reads of client's keys
+// allow stale results, so that any consul server can answer them instead of
+// only the leader. Reads are then cheaper and keep working while the cluster
+// has no leader, but may miss the latest writes. This suits reads of another
+// datacenter in particular, which would otherwise be forwarded to its leader.
+// Writes, and reads that set RequireConsistent, are unchanged.
+func NewStaleReadClient(client ConsulClient) ConsulClient {
+	return staleReadClient{
+		client: client,
+		kv:     staleReadKV{ConsulKVClient: client.KV()},
+	}
+}
+
+type staleReadClient struct {
+	client ConsulClient
+	kv     staleReadKV
+}
+
+func (c staleReadClient) KV() ConsulKVClient {
+	return c.kv
+}
+
+func (c staleReadClient) Session() ConsulSessionClient {
+	return c.client.Session()
+}
+
+// staleReadKV passes every request other than reads through to the wrapped
+// client unchanged, as well as reads whose caller asked for a consistent
+// result
+type staleReadKV struct {
+	ConsulKVClient
+}
+
+var _ ConsulKVClient = staleReadKV{}
+
+// allowStale returns a copy of q that allows stale results, unless q requires
+// a consistent result, in which case q is returned as is
+func allowStale(q *api.QueryOptions) *api.QueryOptions {
+	if q != nil && q.RequireConsistent {
+		return q
+	}
+
+	stale := api.QueryOptions{}
+	if q != nil {
+		stale = *q
+	}
+	stale.AllowStale = true
+	return &stale
+}
+
+func (s staleReadKV) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	return s.ConsulKVClient.Get(key, allowStale(q))
+}
+
+func (s staleReadKV) Keys(prefix, separator string, q *api.QueryOptions) ([]string, *api.QueryMeta, error) {
+	return s.ConsulKVClient.Keys(prefix, separator, allowStale(q))
+}
+
+func (s staleReadKV) List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	return s.ConsulKVClient.List(prefix, allowStale(q))
+}
@@ -0,0 +1,49 @@
+package consulutil
+
+import (
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/hashicorp/consul/api"
+)
+
+// queryRecordingKV records the query options of the last read
+type queryRecordingKV struct {
+	*FakeKV
+	q *api.QueryOptions
+}
+
+func (r *queryRecordingKV) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	r.q = q
+	return r.FakeKV.Get(key, q)
+}
+
+func (r *queryRecordingKV) List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	r.q = q
+	return r.FakeKV.List(prefix, q)
+}
+
+func TestStaleReadClientAllowsStaleReads(t *testing.T) {
+	kv := &queryRecordingKV{FakeKV: NewKVWithEntries(nil)}
+	client := NewStaleReadClient(FakeConsulClient{KV_: kv})
+
+	_, err := client.KV().Put(&api.KVPair{Key: "some/key", Value: []byte("value")}, nil)
+	Assert(t).IsNil(err, "put should have succeeded")
+	pair, _, err := client.KV().Get("some/key", nil)
+	Assert(t).IsNil(err, "get should have succeeded")
+	Assert(t).AreEqual(string(pair.Value), "value", "should have read the value written")
+	Assert(t).IsTrue(kv.q != nil && kv.q.AllowStale, "get should have allowed a stale result")
+
+	q := &api.QueryOptions{WaitIndex: 5}
+	_, _, err = client.KV().List("some/", q)
+	Assert(t).IsNil(err, "list should have succeeded")
+	Assert(t).IsTrue(kv.q.AllowStale, "list should have allowed a stale result")
+	Assert(t).AreEqual(kv.q.WaitIndex, uint64(5), "list should have kept the other query options")
+	Assert(t).IsFalse(q.AllowStale, "the caller's query options should not have been changed")
+
+	consistent := &api.QueryOptions{RequireConsistent: true}
+	_, _, err = client.KV().Get("some/key", consistent)
+	Assert(t).IsNil(err, "get should have succeeded")
+	Assert(t).IsTrue(kv.q == consistent, "a consistent get should have been passed through unchanged")
+	Assert(t).IsFalse(consistent.AllowStale, "a consistent get should not have allowed a stale result")
+}
@@ -0,0 +1,28 @@
+package consulutil
+
+import (
+	"time"
+)
+
+// WriteTimeFlags encodes t for storage in the Flags field of a consul key.
+// Pod intent keys carry the time they were written this way so that the
+// preparer can measure how long a deploy took to reach the node without
+// adding data to the manifest itself. The time is stored as milliseconds
+// since the unix epoch.
+func WriteTimeFlags(t time.Time) uint64 {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	if ms < 0 {
+		return 0
+	}
+	return uint64(ms)
+}
+
+// WriteTimeFromFlags decodes a time encoded by WriteTimeFlags. The zero time
+// is returned for keys written without one.
+func WriteTimeFromFlags(flags uint64) time.Time {
+	if flags == 0 {
+		return time.Time{}
+	}
+	ms := int64(flags)
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
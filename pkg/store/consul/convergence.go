@@ -0,0 +1,152 @@
+package consul
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// The divergence of each node whose reality differs from its intent is
+// written to convergence/<node>. Nodes whose reality matches their intent
+// have no key.
+const CONVERGENCE_TREE = "convergence"
+
+// PodDivergence is a pod whose reality differs from its intent on a node
+type PodDivergence struct {
+	PodID types.PodID `json:"pod_id"`
+	// IntentSHA is the SHA of the pod's manifest in the intent tree, empty
+	// if the pod is not in it
+	IntentSHA string `json:"intent_sha,omitempty"`
+	// RealitySHA is the SHA of the pod's manifest in the reality tree, empty
+	// if the pod is not in it
+	RealitySHA string `json:"reality_sha,omitempty"`
+}
+
+// Divergence is how a node's reality differs from its intent
+type Divergence struct {
+	// Since is when the node was first seen to diverge, by the clock of the
+	// reporter that saw it
+	Since time.Time `json:"since"`
+	// Missing are the pods in the node's intent but not its reality
+	Missing []PodDivergence `json:"missing,omitempty"`
+	// Extra are the pods in the node's reality but not its intent
+	Extra []PodDivergence `json:"extra,omitempty"`
+	// Mismatched are the pods whose manifest in the node's reality is not
+	// the one in its intent
+	Mismatched []PodDivergence `json:"mismatched,omitempty"`
+}
+
+// Converged returns whether the node's reality matches its intent
+func (d Divergence) Converged() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Mismatched) == 0
+}
+
+// DivergenceResult is the divergence of a node
+type DivergenceResult struct {
+	Node       types.NodeName
+	Divergence Divergence
+}
+
+func divergencePath(node types.NodeName) (string, error) {
+	if node == "" {
+		return "", util.Errorf("nodeName not specified when computing divergence path")
+	}
+	return path.Join(CONVERGENCE_TREE, node.String()), nil
+}
+
+// SetDivergence writes the divergence of node
+func (c consulStore) SetDivergence(node types.NodeName, divergence Divergence) error {
+	key, err := divergencePath(node)
+	if err != nil {
+		return err
+	}
+	divergenceBytes, err := json.Marshal(divergence)
+	if err != nil {
+		return util.Errorf("Could not marshal divergence of %s: %s", node, err)
+	}
+	_, err = c.client.KV().Put(&api.KVPair{Key: key, Value: divergenceBytes}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+// DeleteDivergence removes the divergence of node, once it has converged
+func (c consulStore) DeleteDivergence(node types.NodeName) error {
+	key, err := divergencePath(node)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.KV().Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
+
+// Divergence reads the divergence of node. A node that has converged returns
+// consulutil.NotFoundError.
+func (c consulStore) Divergence(node types.NodeName) (Divergence, error) {
+	key, err := divergencePath(node)
+	if err != nil {
+		return Divergence{}, err
+	}
+	pair, _, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return Divergence{}, consulutil.NewKVError("get", key, err)
+	}
+	if pair == nil {
+		return Divergence{}, consulutil.NotFoundError{Key: key}
+	}
+
+	var divergence Divergence
+	err = json.Unmarshal(pair.Value, &divergence)
+	if err != nil {
+		return Divergence{}, util.Errorf("Could not parse divergence at %s: %s", key, err)
+	}
+	return divergence, nil
+}
+
+// ListDivergences reads the divergence of every node that has not converged,
+// sorted by node. The fleet has converged if there are none.
+func (c consulStore) ListDivergences() ([]DivergenceResult, error) {
+	prefix := CONVERGENCE_TREE + "/"
+	pairs, _, err := c.client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+
+	var ret []DivergenceResult
+	for _, pair := range pairs {
+		keyParts := strings.Split(pair.Key, "/")
+		if len(keyParts) != 2 {
+			continue
+		}
+		var divergence Divergence
+		err = json.Unmarshal(pair.Value, &divergence)
+		if err != nil {
+			// Just list all the records that we can
+			continue
+		}
+		ret = append(ret, DivergenceResult{
+			Node:       types.NodeName(keyParts[1]),
+			Divergence: divergence,
+		})
+	}
+	sort.Sort(divergencesByNode(ret))
+	return ret, nil
+}
+
+type divergencesByNode []DivergenceResult
+
+func (d divergencesByNode) Len() int           { return len(d) }
+func (d divergencesByNode) Less(i, j int) bool { return d[i].Node < d[j].Node }
+func (d divergencesByNode) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
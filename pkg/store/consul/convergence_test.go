@@ -0,0 +1,56 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestDivergences(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	now := time.Now().Round(time.Second)
+	err := f.Store.SetDivergence("node2", Divergence{
+		Since:   now,
+		Missing: []PodDivergence{{PodID: "some_pod", IntentSHA: "abc"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Store.SetDivergence("node1", Divergence{
+		Since:      now.Add(-time.Minute),
+		Mismatched: []PodDivergence{{PodID: "some_pod", IntentSHA: "abc", RealitySHA: "def"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	divergence, err := f.Store.Divergence("node2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !divergence.Since.Equal(now) || len(divergence.Missing) != 1 || divergence.Missing[0].IntentSHA != "abc" || divergence.Converged() {
+		t.Errorf("unexpected divergence read back: %+v", divergence)
+	}
+
+	all, err := f.Store.ListDivergences()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].Node != "node1" || all[1].Node != "node2" {
+		t.Fatalf("expected the divergences of node1 and node2, in order, got %+v", all)
+	}
+
+	err = f.Store.DeleteDivergence("node2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Store.Divergence("node2")
+	if !consulutil.IsNotFound(err) {
+		t.Errorf("expected a converged node to not be found, got %v", err)
+	}
+}
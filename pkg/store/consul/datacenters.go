@@ -0,0 +1,59 @@
+package consul
+
+import (
+	"sort"
+
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// Datacenters returns the datacenters known to the consul agent of opts,
+// sorted by name
+func Datacenters(opts Options) ([]string, error) {
+	// error is always nil
+	client, _ := api.NewClient(apiConfig(opts))
+	datacenters, err := client.Catalog().Datacenters()
+	if err != nil {
+		return nil, util.Errorf("Could not list datacenters: %s", err)
+	}
+	sort.Strings(datacenters)
+	return datacenters, nil
+}
+
+// ServiceHealthInDatacenters reads the health of service, as GetServiceHealth
+// does, in each of datacenters, or in every datacenter known to the agent of
+// opts if none are given. The results are keyed by datacenter. Set
+// opts.StaleReads so that each datacenter's servers can answer without
+// forwarding to their leader.
+func ServiceHealthInDatacenters(opts Options, service string, datacenters ...string) (map[string]map[string]WatchResult, error) {
+	if len(datacenters) == 0 {
+		var err error
+		datacenters, err = Datacenters(opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := make(map[string]map[string]WatchResult)
+	for _, datacenter := range datacenters {
+		store := NewConsulStore(NewConsulClient(opts.InDatacenter(datacenter)))
+		health, err := store.GetServiceHealth(service)
+		if err != nil {
+			return nil, util.Errorf("Could not read the health of %s in %s: %s", service, datacenter, err)
+		}
+		ret[datacenter] = health
+	}
+	return ret, nil
+}
+
+// RemoteIntent reads the intent tree of datacenter, as AllPods does, through
+// the agent of opts
+func RemoteIntent(opts Options, datacenter string) ([]ManifestResult, error) {
+	store := NewConsulStore(NewConsulClient(opts.InDatacenter(datacenter)))
+	intent, _, err := store.AllPods(INTENT_TREE)
+	if err != nil {
+		return nil, util.Errorf("Could not read the intent of %s: %s", datacenter, err)
+	}
+	return intent, nil
+}
@@ -0,0 +1,58 @@
+// +build !race
+
+package consul
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestCrossDatacenterReads(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	opts := Options{
+		Address:    fmt.Sprintf("127.0.0.1:%d", fixture.HTTPPort),
+		StaleReads: true,
+	}
+
+	datacenters, err := Datacenters(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datacenters) != 1 || datacenters[0] != "dc1" {
+		t.Fatalf("expected the test agent's datacenter dc1, got %v", datacenters)
+	}
+
+	store := NewConsulStore(NewConsulClient(opts.InDatacenter("dc1")))
+	_, _, err = store.PutHealth(WatchResult{Id: "some_pod", Node: "node1", Service: "some_pod", Status: "passing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.SetPod(INTENT_TREE, "node1", testManifest("some_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	health, err := ServiceHealthInDatacenters(opts, "some_pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(health) != 1 || len(health["dc1"]) != 1 {
+		t.Errorf("expected the health of node1 in dc1, got %+v", health)
+	}
+
+	intent, err := RemoteIntent(opts, "dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intent) != 1 || intent[0].Manifest.ID() != "some_pod" {
+		t.Errorf("expected the intent of dc1 to have some_pod, got %+v", intent)
+	}
+
+	_, err = RemoteIntent(opts, "nonexistent")
+	if err == nil {
+		t.Error("expected an error reading the intent of an unknown datacenter")
+	}
+}
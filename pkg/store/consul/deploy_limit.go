@@ -0,0 +1,249 @@
+package consul
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// The deploy limit of each pod is written to deploy_limits/<pod>
+const DEPLOY_LIMIT_TREE = "deploy_limits"
+
+// How many times a deploy limit is re-read when its compare-and-set fails
+// because another node changed it first
+const deployLimitCASAttempts = 10
+
+// DeployLimit is a semaphore that limits how many nodes may be installing a
+// pod at once, so that a release deployed to thousands of nodes doesn't have
+// them all downloading its artifacts from the artifact servers at the same
+// time. Preparers take one of the limit's slots before installing the pod and
+// give it back afterwards.
+type DeployLimit struct {
+	// Limit is how many nodes may install the pod at once
+	Limit int `json:"limit"`
+	// Holders maps each node holding a slot to the session of its
+	// preparer. The slot of a node whose session has expired, such as one
+	// whose preparer died while installing, is reclaimed by the next node
+	// to take a slot.
+	Holders map[types.NodeName]string `json:"holders,omitempty"`
+}
+
+func deployLimitPath(podID types.PodID) (string, error) {
+	if podID == "" {
+		return "", util.Errorf("pod id not specified when computing deploy limit path")
+	}
+	return path.Join(DEPLOY_LIMIT_TREE, podID.String()), nil
+}
+
+// getDeployLimit reads the deploy limit at key, returning a nil pair if there
+// is none
+func (c consulStore) getDeployLimit(key string) (DeployLimit, *api.KVPair, error) {
+	pair, _, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return DeployLimit{}, nil, consulutil.NewKVError("get", key, err)
+	}
+	if pair == nil {
+		return DeployLimit{}, nil, nil
+	}
+	var limit DeployLimit
+	err = json.Unmarshal(pair.Value, &limit)
+	if err != nil {
+		return DeployLimit{}, nil, util.Errorf("Could not parse deploy limit at %s: %s", key, err)
+	}
+	return limit, pair, nil
+}
+
+// casDeployLimit writes limit to key if it hasn't changed since it was read
+// at modifyIndex (0 if it didn't exist), returning false if it has
+func (c consulStore) casDeployLimit(key string, limit DeployLimit, modifyIndex uint64) (bool, error) {
+	limitBytes, err := json.Marshal(limit)
+	if err != nil {
+		return false, util.Errorf("Could not marshal deploy limit: %s", err)
+	}
+	ok, _, err := c.client.KV().CAS(&api.KVPair{
+		Key:         key,
+		Value:       limitBytes,
+		ModifyIndex: modifyIndex,
+	}, nil)
+	if err != nil {
+		return false, consulutil.NewKVError("cas", key, err)
+	}
+	return ok, nil
+}
+
+// SetDeployLimit limits how many nodes may install podID at once. The slots
+// already held are kept, even if there are more of them than limit.
+func (c consulStore) SetDeployLimit(podID types.PodID, limit int) error {
+	if limit <= 0 {
+		return util.Errorf("A deploy limit must be positive, not %d", limit)
+	}
+	key, err := deployLimitPath(podID)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < deployLimitCASAttempts; i++ {
+		current, pair, err := c.getDeployLimit(key)
+		if err != nil {
+			return err
+		}
+		var modifyIndex uint64
+		if pair != nil {
+			modifyIndex = pair.ModifyIndex
+		}
+		current.Limit = limit
+		ok, err := c.casDeployLimit(key, current, modifyIndex)
+		if err != nil || ok {
+			return err
+		}
+	}
+	return util.Errorf("Could not set the deploy limit of %s: it kept changing", podID)
+}
+
+// DeleteDeployLimit removes the deploy limit of podID, letting any number of
+// nodes install it at once
+func (c consulStore) DeleteDeployLimit(podID types.PodID) error {
+	key, err := deployLimitPath(podID)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.KV().Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
+
+// DeployLimit reads the deploy limit of podID. A pod without one returns
+// consulutil.NotFoundError.
+func (c consulStore) DeployLimit(podID types.PodID) (DeployLimit, error) {
+	key, err := deployLimitPath(podID)
+	if err != nil {
+		return DeployLimit{}, err
+	}
+	limit, pair, err := c.getDeployLimit(key)
+	if err != nil {
+		return DeployLimit{}, err
+	}
+	if pair == nil {
+		return DeployLimit{}, consulutil.NotFoundError{Key: key}
+	}
+	return limit, nil
+}
+
+// ListDeployLimits reads the deploy limit of every pod that has one
+func (c consulStore) ListDeployLimits() (map[types.PodID]DeployLimit, error) {
+	prefix := DEPLOY_LIMIT_TREE + "/"
+	pairs, _, err := c.client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+
+	ret := make(map[types.PodID]DeployLimit)
+	for _, pair := range pairs {
+		keyParts := strings.Split(pair.Key, "/")
+		if len(keyParts) != 2 {
+			continue
+		}
+		var limit DeployLimit
+		err = json.Unmarshal(pair.Value, &limit)
+		if err != nil {
+			// Just list all the limits that we can
+			continue
+		}
+		ret[types.PodID(keyParts[1])] = limit
+	}
+	return ret, nil
+}
+
+// AcquireDeploySlot takes one of the slots of podID's deploy limit for node,
+// whose preparer's session is session. It returns true if the slot was taken,
+// or if node already held one or podID has no deploy limit, and false if
+// every slot is held by other nodes.
+func (c consulStore) AcquireDeploySlot(podID types.PodID, node types.NodeName, session string) (bool, error) {
+	key, err := deployLimitPath(podID)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < deployLimitCASAttempts; i++ {
+		limit, pair, err := c.getDeployLimit(key)
+		if err != nil {
+			return false, err
+		}
+		if pair == nil || limit.Holders[node] == session {
+			return true, nil
+		}
+
+		holders := make(map[types.NodeName]string)
+		for holder, holderSession := range limit.Holders {
+			if holder == node {
+				// held by a previous session of node's
+				// preparer, which is taken over
+				continue
+			}
+			alive, err := c.sessionAlive(holderSession)
+			if err != nil {
+				return false, err
+			}
+			if alive {
+				holders[holder] = holderSession
+			}
+		}
+		acquired := len(holders) < limit.Limit
+		if acquired {
+			holders[node] = session
+		} else if len(holders) == len(limit.Holders) {
+			return false, nil
+		}
+
+		limit.Holders = holders
+		ok, err := c.casDeployLimit(key, limit, pair.ModifyIndex)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return acquired, nil
+		}
+	}
+	return false, util.Errorf("Could not take a deploy slot of %s: its deploy limit kept changing", podID)
+}
+
+// ReleaseDeploySlot gives back the slot of podID's deploy limit held by node,
+// if any
+func (c consulStore) ReleaseDeploySlot(podID types.PodID, node types.NodeName) error {
+	key, err := deployLimitPath(podID)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < deployLimitCASAttempts; i++ {
+		limit, pair, err := c.getDeployLimit(key)
+		if err != nil {
+			return err
+		}
+		if pair == nil {
+			return nil
+		}
+		if _, ok := limit.Holders[node]; !ok {
+			return nil
+		}
+		delete(limit.Holders, node)
+		ok, err := c.casDeployLimit(key, limit, pair.ModifyIndex)
+		if err != nil || ok {
+			return err
+		}
+	}
+	return util.Errorf("Could not give back the deploy slot of %s: its deploy limit kept changing", podID)
+}
+
+func (c consulStore) sessionAlive(session string) (bool, error) {
+	entry, _, err := c.client.Session().Info(session, nil)
+	if err != nil {
+		return false, util.Errorf("Could not check session %s: %s", session, err)
+	}
+	return entry != nil, nil
+}
@@ -0,0 +1,98 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestDeployLimit(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	sessions := make(map[string]Session)
+	for _, node := range []string{"node1", "node2", "node3"} {
+		session, _, err := f.Store.NewSession(node, make(chan time.Time))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions[node] = session
+	}
+
+	defer sessions["node1"].Destroy()
+	defer sessions["node3"].Destroy()
+
+	ok, err := f.Store.AcquireDeploySlot("web", "node1", sessions["node1"].Session())
+	if err != nil || !ok {
+		t.Fatalf("expected a pod without a deploy limit to always have a slot, got %t, %v", ok, err)
+	}
+	_, err = f.Store.DeployLimit("web")
+	if !consulutil.IsNotFound(err) {
+		t.Fatalf("expected acquiring a slot not to create a deploy limit, got %v", err)
+	}
+
+	err = f.Store.SetDeployLimit("web", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// taking a slot again is a no-op
+	for i := 0; i < 2; i++ {
+		ok, err = f.Store.AcquireDeploySlot("web", "node1", sessions["node1"].Session())
+		if err != nil || !ok {
+			t.Fatalf("expected node1 to take a slot, got %t, %v", ok, err)
+		}
+	}
+	ok, err = f.Store.AcquireDeploySlot("web", "node2", sessions["node2"].Session())
+	if err != nil || !ok {
+		t.Fatalf("expected node2 to take the second slot, got %t, %v", ok, err)
+	}
+	ok, err = f.Store.AcquireDeploySlot("web", "node3", sessions["node3"].Session())
+	if err != nil || ok {
+		t.Fatalf("expected node3 to find every slot held, got %t, %v", ok, err)
+	}
+
+	err = f.Store.ReleaseDeploySlot("web", "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = f.Store.AcquireDeploySlot("web", "node3", sessions["node3"].Session())
+	if err != nil || !ok {
+		t.Fatalf("expected node3 to take the released slot, got %t, %v", ok, err)
+	}
+
+	// the slot of a node whose preparer's session expired is reclaimed
+	err = sessions["node2"].Destroy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = f.Store.AcquireDeploySlot("web", "node1", sessions["node1"].Session())
+	if err != nil || !ok {
+		t.Fatalf("expected node1 to reclaim the slot of node2, got %t, %v", ok, err)
+	}
+
+	// raising the limit keeps the slots held
+	err = f.Store.SetDeployLimit("web", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := f.Store.ListDeployLimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := limits["web"]
+	if len(limits) != 1 || limit.Limit != 3 || len(limit.Holders) != 2 || limit.Holders["node3"] != sessions["node3"].Session() {
+		t.Errorf("unexpected deploy limits: %+v", limits)
+	}
+
+	err = f.Store.DeleteDeployLimit("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Store.DeployLimit("web")
+	if !consulutil.IsNotFound(err) {
+		t.Errorf("expected the deploy limit to be deleted, got %v", err)
+	}
+}
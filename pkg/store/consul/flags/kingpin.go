@@ -9,8 +9,10 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/labels"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil"
 	netutil "github.com/square/p2/pkg/util/net"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -26,6 +28,11 @@ func ParseWithConsulOptions() (string, consul.Options, labels.ApplicatorWithoutW
 	caFile := kingpin.Flag("tls-ca-file", "File containing the x509 PEM-encoded CA ").ExistingFile()
 	keyFile := kingpin.Flag("tls-key-file", "File containing the x509 PEM-encoded private key").ExistingFile()
 	certFile := kingpin.Flag("tls-cert-file", "File containing the x509 PEM-encoded public key certificate").ExistingFile()
+	rateLimit := kingpin.Flag("consul-rate-limit", "The maximum number of requests per second to send to consul. Unlimited by default.").Float64()
+	namespace := kingpin.Flag("namespace", "The namespace of the p2 installation to use, if the consul cluster is shared by several. Empty by default.").String()
+	datacenter := kingpin.Flag("datacenter", "The consul datacenter to read and write, through the agent of --consul. Defaults to the agent's datacenter.").String()
+	staleReads := kingpin.Flag("stale-reads", "Allow any consul server to answer reads, which may then miss the latest writes. Useful when reading a remote datacenter.").Bool()
+	intentSigningKeyring := kingpin.Flag("intent-signing-keyring", "A keyring whose first key, which must not be encrypted, signs the intent written, for preparers that authorize intent writers.").ExistingFile()
 
 	cmd := kingpin.Parse()
 
@@ -36,6 +43,16 @@ func ParseWithConsulOptions() (string, consul.Options, labels.ApplicatorWithoutW
 		}
 		*token = strings.TrimSpace(string(tokenBytes))
 	}
+	if *intentSigningKeyring != "" {
+		keyring, err := auth.LoadKeyring(*intentSigningKeyring)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if len(keyring) == 0 || keyring[0].PrivateKey == nil || keyring[0].PrivateKey.Encrypted {
+			log.Fatalf("%s must contain an unencrypted private key", *intentSigningKeyring)
+		}
+		consul.SetIntentSigner(keyring[0])
+	}
 	var transport http.RoundTripper
 	if *caFile != "" || *keyFile != "" || *certFile != "" {
 		tlsConfig, err := netutil.GetTLSConfig(*certFile, *keyFile, *caFile)
@@ -57,11 +74,17 @@ func ParseWithConsulOptions() (string, consul.Options, labels.ApplicatorWithoutW
 	httpClient := netutil.NewHeaderClient(*headers, transport)
 
 	consulOpts := consul.Options{
-		Address:  *consulURL,
-		Token:    *token,
-		Client:   httpClient,
-		HTTPS:    *https,
-		WaitTime: *wait,
+		Address:   *consulURL,
+		Token:     *token,
+		Client:    httpClient,
+		HTTPS:     *https,
+		WaitTime:  *wait,
+		Namespace: *namespace,
+		Limits: consulutil.LimitConfig{
+			RequestsPerSecond: *rateLimit,
+		},
+		Datacenter: *datacenter,
+		StaleReads: *staleReads,
 	}
 
 	var applicator labels.ApplicatorWithoutWatches
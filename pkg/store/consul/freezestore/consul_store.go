@@ -0,0 +1,126 @@
+// Package freezestore stores the freezes that stop deploys during maintenance
+// windows and incidents
+package freezestore
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/freeze/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+)
+
+// Freezes are stored at /freezes/<freeze ID>
+const freezeTree = "freezes"
+
+var NoFreeze error = errors.New("No freeze found")
+
+func IsNotExist(err error) bool {
+	return err == NoFreeze
+}
+
+type KV interface {
+	Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+	Put(p *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error)
+	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+var _ KV = &api.KV{}
+
+type ConsulStore struct {
+	kv KV
+}
+
+func NewConsul(client consulutil.ConsulClient) ConsulStore {
+	return ConsulStore{
+		kv: client.KV(),
+	}
+}
+
+// Set creates or replaces a freeze
+func (s ConsulStore) Set(freeze fields.Freeze) error {
+	err := freeze.Validate()
+	if err != nil {
+		return err
+	}
+	key, err := FreezePath(freeze.ID)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(freeze)
+	if err != nil {
+		return util.Errorf("Could not marshal freeze as JSON: %s", err)
+	}
+	_, err = s.kv.Put(&api.KVPair{Key: key, Value: value}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+// Get returns a freeze. Returns NoFreeze if there isn't one with the ID.
+func (s ConsulStore) Get(id fields.ID) (fields.Freeze, error) {
+	key, err := FreezePath(id)
+	if err != nil {
+		return fields.Freeze{}, err
+	}
+	kvp, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return fields.Freeze{}, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return fields.Freeze{}, NoFreeze
+	}
+	return kvpToFreeze(kvp)
+}
+
+// Delete removes a freeze, if there is one with the ID
+func (s ConsulStore) Delete(id fields.ID) error {
+	key, err := FreezePath(id)
+	if err != nil {
+		return err
+	}
+	_, err = s.kv.Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
+
+// List returns every freeze, ordered by ID
+func (s ConsulStore) List() ([]fields.Freeze, error) {
+	listed, _, err := s.kv.List(freezeTree+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", freezeTree+"/", err)
+	}
+	freezes := make([]fields.Freeze, 0, len(listed))
+	for _, kvp := range listed {
+		freeze, err := kvpToFreeze(kvp)
+		if err != nil {
+			return nil, err
+		}
+		freezes = append(freezes, freeze)
+	}
+	return freezes, nil
+}
+
+func FreezePath(id fields.ID) (string, error) {
+	if id == "" {
+		return "", util.Errorf("freeze ID not specified when computing freeze path")
+	}
+	return path.Join(freezeTree, id.String()), nil
+}
+
+func kvpToFreeze(kvp *api.KVPair) (fields.Freeze, error) {
+	var freeze fields.Freeze
+	err := json.Unmarshal(kvp.Value, &freeze)
+	if err != nil {
+		return fields.Freeze{}, util.Errorf("Unable to unmarshal %s as a freeze: %s", kvp.Key, err)
+	}
+	return freeze, nil
+}
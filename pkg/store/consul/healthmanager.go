@@ -1,9 +1,9 @@
 package consul
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,6 +14,7 @@ import (
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/util/limit"
 	"github.com/square/p2/pkg/util/param"
 	"github.com/square/p2/pkg/util/stream"
@@ -42,8 +43,18 @@ var (
 	// health status to "unknown" with an error message, and further updates will be
 	// throttled until enough tokens have been accumulated.
 	HealthResumeLimit = param.Int64("health_resume_limit", 4)
+
+	// HealthCompression names the codec used to compress health results written to
+	// Consul, or "none". Readers handle both compressed and uncompressed results, so
+	// this should only be enabled once every reader supports compression.
+	HealthCompression = param.String("health_compression", consulutil.NoCompression)
 )
 
+// HealthSessionEnvVar names the environment variable through which a process hands its
+// health session over to the process it execs. The health manager adopts that session,
+// so the node's health results aren't deleted while the new process starts.
+const HealthSessionEnvVar = "P2_HEALTH_SESSION"
+
 // consulHealthManager maintains a Consul session for all the local node's health checks,
 // renews it periodically, and refreshes all health checks if it expires.
 type consulHealthManager struct {
@@ -87,7 +98,8 @@ func (c consulStore) newSessionHealthManager(
 		defer m.wg.Done()
 		consulutil.SessionManager(
 			api.SessionEntry{
-				Name:      fmt.Sprintf("health:%s:%d:%s", node, os.Getpid(), timeStr),
+				ID:        handedOverSession(),
+				Name:      healthSessionPrefix(node, os.Getpid()) + timeStr,
 				LockDelay: 1 * time.Millisecond,
 				Behavior:  api.SessionBehaviorDelete,
 				TTL:       fmt.Sprintf("%ds", *SessionTTLSec),
@@ -105,6 +117,36 @@ func (c consulStore) newSessionHealthManager(
 	return m
 }
 
+// healthSessionPrefix starts the name of every health session created by the process
+func healthSessionPrefix(node types.NodeName, pid int) string {
+	return fmt.Sprintf("health:%s:%d:", node, pid)
+}
+
+// handedOverSession returns the health session handed over by the process that exec'd
+// this one, if any. It is only adopted once, so that the health manager of a later
+// restart doesn't try again.
+func handedOverSession() string {
+	session := os.Getenv(HealthSessionEnvVar)
+	_ = os.Unsetenv(HealthSessionEnvVar)
+	return session
+}
+
+// FindHealthSession returns the ID of the health session held by this process, so that it
+// can be handed over through HealthSessionEnvVar. Returns "" if it holds none.
+func FindHealthSession(client consulutil.ConsulClient, node types.NodeName) (string, error) {
+	sessions, _, err := client.Session().List(nil)
+	if err != nil {
+		return "", util.Errorf("Could not list Consul sessions: %s", err)
+	}
+	prefix := healthSessionPrefix(node, os.Getpid())
+	for _, session := range sessions {
+		if strings.HasPrefix(session.Name, prefix) {
+			return session.ID, nil
+		}
+	}
+	return "", nil
+}
+
 // Close cleans up the HealthManager. New health reports will not be published, and
 // existing reports will be removed. Implements the HealthManager interface.
 func (m *consulHealthManager) Close() {
@@ -402,7 +444,7 @@ func healthToKV(wr WatchResult, session string) (*api.KVPair, error) {
 	wr.Time = now
 	// This health check only expires when the key is removed
 	wr.Expires = now.Add(100 * 365 * 24 * time.Hour)
-	data, err := json.Marshal(wr)
+	data, err := marshalHealth(wr)
 	if err != nil {
 		return nil, err
 	}
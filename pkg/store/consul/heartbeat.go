@@ -0,0 +1,186 @@
+package consul
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// The preparer of each node writes its heartbeat to heartbeat/<node>
+const HEARTBEAT_TREE = "heartbeat"
+
+// Heartbeat is written periodically by a node's preparer to show that it is
+// alive and working, so that schedulers can avoid nodes whose preparer isn't
+type Heartbeat struct {
+	// Time is when the heartbeat was written, by the node's clock
+	Time time.Time `json:"time"`
+	// StartTime is when the preparer started
+	StartTime time.Time `json:"start_time"`
+	// PreparerVersion is the version of the preparer
+	PreparerVersion string `json:"preparer_version"`
+	// ObserveOnly is set if the preparer only observes its pods and will
+	// not install any
+	ObserveOnly bool `json:"observe_only,omitempty"`
+	// LoopTimes is when each of the preparer's loops, by name, last made a
+	// pass. A loop is missing if it has not made one since the preparer
+	// started.
+	LoopTimes map[string]time.Time `json:"loop_times,omitempty"`
+	// DiskAvailable is the space, in bytes, available on the filesystem of
+	// the pod root
+	DiskAvailable int64 `json:"disk_available"`
+	// MemoryAvailable is the memory, in bytes, available for starting new
+	// processes without swapping. It is 0 if it could not be determined.
+	MemoryAvailable int64 `json:"memory_available"`
+}
+
+// Uptime is how long the preparer had been running when it wrote the
+// heartbeat
+func (h Heartbeat) Uptime() time.Duration {
+	return h.Time.Sub(h.StartTime)
+}
+
+// Stale returns whether the heartbeat was written more than maxAge before
+// now. The heartbeat's time is by the node's clock, so maxAge should allow
+// for clock skew as well as a few missed heartbeats.
+func (h Heartbeat) Stale(now time.Time, maxAge time.Duration) bool {
+	return now.Sub(h.Time) > maxAge
+}
+
+// HeartbeatResult is the heartbeat of a node's preparer
+type HeartbeatResult struct {
+	Node      types.NodeName
+	Heartbeat Heartbeat
+}
+
+// StaleNode is a node whose preparer has not written a heartbeat recently
+type StaleNode struct {
+	Node types.NodeName
+	// Nil if the node has pods scheduled on it but its preparer has never
+	// written a heartbeat
+	Heartbeat *Heartbeat
+}
+
+func heartbeatPath(node types.NodeName) (string, error) {
+	if node == "" {
+		return "", util.Errorf("nodeName not specified when computing heartbeat path")
+	}
+	return path.Join(HEARTBEAT_TREE, node.String()), nil
+}
+
+// SetHeartbeat writes the heartbeat of node's preparer
+func (c consulStore) SetHeartbeat(node types.NodeName, heartbeat Heartbeat) error {
+	key, err := heartbeatPath(node)
+	if err != nil {
+		return err
+	}
+	heartbeatBytes, err := json.Marshal(heartbeat)
+	if err != nil {
+		return util.Errorf("Could not marshal heartbeat of %s: %s", node, err)
+	}
+	_, err = c.client.KV().Put(&api.KVPair{Key: key, Value: heartbeatBytes}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+// Heartbeat reads the heartbeat of node's preparer. A node whose preparer has
+// never written one returns consulutil.NotFoundError.
+func (c consulStore) Heartbeat(node types.NodeName) (Heartbeat, error) {
+	key, err := heartbeatPath(node)
+	if err != nil {
+		return Heartbeat{}, err
+	}
+	pair, _, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return Heartbeat{}, consulutil.NewKVError("get", key, err)
+	}
+	if pair == nil {
+		return Heartbeat{}, consulutil.NotFoundError{Key: key}
+	}
+
+	var heartbeat Heartbeat
+	err = json.Unmarshal(pair.Value, &heartbeat)
+	if err != nil {
+		return Heartbeat{}, util.Errorf("Could not parse heartbeat at %s: %s", key, err)
+	}
+	return heartbeat, nil
+}
+
+// ListHeartbeats reads the heartbeat of every node's preparer
+func (c consulStore) ListHeartbeats() ([]HeartbeatResult, error) {
+	prefix := HEARTBEAT_TREE + "/"
+	pairs, _, err := c.client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+
+	var ret []HeartbeatResult
+	for _, pair := range pairs {
+		keyParts := strings.Split(pair.Key, "/")
+		if len(keyParts) != 2 {
+			continue
+		}
+		var heartbeat Heartbeat
+		err = json.Unmarshal(pair.Value, &heartbeat)
+		if err != nil {
+			// Just list all the records that we can
+			continue
+		}
+		ret = append(ret, HeartbeatResult{
+			Node:      types.NodeName(keyParts[1]),
+			Heartbeat: heartbeat,
+		})
+	}
+	return ret, nil
+}
+
+// StaleNodes returns the nodes whose preparer's heartbeat was written more
+// than maxAge before now (see Heartbeat.Stale), along with the nodes that
+// have pods scheduled on them but no heartbeat at all, sorted by name
+func (c consulStore) StaleNodes(now time.Time, maxAge time.Duration) ([]StaleNode, error) {
+	heartbeats, err := c.ListHeartbeats()
+	if err != nil {
+		return nil, err
+	}
+	prefix := INTENT_TREE.String() + "/"
+	intentKeys, _, err := c.client.KV().Keys(prefix, "/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("keys", prefix, err)
+	}
+
+	var stale []StaleNode
+	seen := make(map[types.NodeName]bool)
+	for _, result := range heartbeats {
+		seen[result.Node] = true
+		if result.Heartbeat.Stale(now, maxAge) {
+			heartbeat := result.Heartbeat
+			stale = append(stale, StaleNode{Node: result.Node, Heartbeat: &heartbeat})
+		}
+	}
+	for _, key := range intentKeys {
+		// the keys of nodes' subtrees are returned as intent/<node>/
+		node := types.NodeName(strings.TrimSuffix(strings.TrimPrefix(key, prefix), "/"))
+		if node == "" || seen[node] {
+			continue
+		}
+		seen[node] = true
+		stale = append(stale, StaleNode{Node: node})
+	}
+	sort.Sort(staleNodesByName(stale))
+	return stale, nil
+}
+
+type staleNodesByName []StaleNode
+
+func (s staleNodesByName) Len() int           { return len(s) }
+func (s staleNodesByName) Less(i, j int) bool { return s[i].Node < s[j].Node }
+func (s staleNodesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,70 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestHeartbeats(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	now := time.Now().Round(time.Second)
+	err := f.Store.SetHeartbeat("alive", Heartbeat{
+		Time:            now,
+		StartTime:       now.Add(-time.Hour),
+		PreparerVersion: "1.2.3",
+		LoopTimes:       map[string]time.Time{"pod_watch": now},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Store.SetHeartbeat("dead", Heartbeat{Time: now.Add(-time.Hour), StartTime: now.Add(-2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a node with pods but no preparer running at all
+	_, err = f.Store.SetPod(INTENT_TREE, "never_started", testManifest("some_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Store.SetPod(INTENT_TREE, "alive", testManifest("some_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	heartbeat, err := f.Store.Heartbeat("alive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heartbeat.PreparerVersion != "1.2.3" || heartbeat.Uptime() != time.Hour || !heartbeat.LoopTimes["pod_watch"].Equal(now) {
+		t.Errorf("unexpected heartbeat read back: %+v", heartbeat)
+	}
+	_, err = f.Store.Heartbeat("never_started")
+	if !consulutil.IsNotFound(err) {
+		t.Errorf("expected a node without a heartbeat to not be found, got %v", err)
+	}
+
+	all, err := f.Store.ListHeartbeats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected 2 heartbeats, got %+v", all)
+	}
+
+	stale, err := f.Store.StaleNodes(now, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 2 || stale[0].Node != "dead" || stale[1].Node != "never_started" {
+		t.Fatalf("expected dead and never_started to be stale, got %+v", stale)
+	}
+	if stale[0].Heartbeat == nil || stale[1].Heartbeat != nil {
+		t.Errorf("expected only the node that wrote a heartbeat to have one, got %+v", stale)
+	}
+}
@@ -0,0 +1,125 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// Intent written while an intent signer is set is stored in an envelope,
+// prefixed by intentEnvelopeMagic, that records who wrote it: a sealedIntent
+// holding the stored value of the manifest and the writer's signature of the
+// node and the manifest it was written for. Like compression, this should only
+// be enabled once every reader of the intent tree supports envelopes.
+var intentEnvelopeMagic = []byte{0x00, 'p', '2', 'i'}
+
+var intentSigner struct {
+	sync.RWMutex
+	entity *openpgp.Entity
+}
+
+// SetIntentSigner makes every intent that the process writes be signed by
+// signer, whose private key must be decrypted, so that preparers can check
+// that the writer was authorized to schedule the pod on their node. A nil
+// signer stops signing intent.
+func SetIntentSigner(signer *openpgp.Entity) {
+	intentSigner.Lock()
+	defer intentSigner.Unlock()
+	intentSigner.entity = signer
+}
+
+// An IntentEnvelope is the signature of whoever wrote a pod's intent
+type IntentEnvelope struct {
+	Node        types.NodeName `json:"node"`
+	PodID       types.PodID    `json:"pod_id"`
+	ManifestSHA string         `json:"manifest_sha"`
+	// Signature is the writer's detached signature of SignedBytes()
+	Signature []byte `json:"signature"`
+}
+
+type sealedIntent struct {
+	IntentEnvelope
+	Value []byte `json:"value"`
+}
+
+// SignedBytes returns what the writer signed
+func (e IntentEnvelope) SignedBytes() []byte {
+	return []byte(fmt.Sprintf("p2 intent\nnode: %s\npod_id: %s\nmanifest_sha: %s\n", e.Node, e.PodID, e.ManifestSHA))
+}
+
+// SignatureData returns the signed bytes and signature of the envelope, like
+// auth.Signed
+func (e IntentEnvelope) SignatureData() ([]byte, []byte) {
+	return e.SignedBytes(), e.Signature
+}
+
+// Check returns an error unless the envelope was signed for podManifest on
+// node, so that a signed envelope can't be copied to another node or around
+// another manifest
+func (e IntentEnvelope) Check(node types.NodeName, podManifest manifest.Manifest) error {
+	sha, err := podManifest.SHA()
+	if err != nil {
+		return err
+	}
+	if e.Node != node || e.PodID != podManifest.ID() || e.ManifestSHA != sha {
+		return util.Errorf("intent was signed for %s on %s with manifest %s, not %s on %s with manifest %s", e.PodID, e.Node, e.ManifestSHA, podManifest.ID(), node, sha)
+	}
+	return nil
+}
+
+// sealIntent returns value, the stored value of podManifest, in an envelope
+// signed by the intent signer if one is set and the manifest is intent
+func sealIntent(podPrefix PodPrefix, node types.NodeName, podManifest manifest.Manifest, value []byte) ([]byte, error) {
+	intentSigner.RLock()
+	signer := intentSigner.entity
+	intentSigner.RUnlock()
+	if signer == nil || podPrefix != INTENT_TREE {
+		return value, nil
+	}
+
+	sha, err := podManifest.SHA()
+	if err != nil {
+		return nil, err
+	}
+	sealed := sealedIntent{
+		IntentEnvelope: IntentEnvelope{
+			Node:        node,
+			PodID:       podManifest.ID(),
+			ManifestSHA: sha,
+		},
+		Value: value,
+	}
+	var signature bytes.Buffer
+	err = openpgp.DetachSign(&signature, signer, bytes.NewReader(sealed.SignedBytes()), nil)
+	if err != nil {
+		return nil, util.Errorf("Could not sign intent of %s on %s: %s", podManifest.ID(), node, err)
+	}
+	sealed.Signature = signature.Bytes()
+
+	sealedBytes, err := json.Marshal(sealed)
+	if err != nil {
+		return nil, util.Errorf("Could not marshal intent envelope: %s", err)
+	}
+	return append(append([]byte{}, intentEnvelopeMagic...), sealedBytes...), nil
+}
+
+// unsealIntent returns the value in the envelope of value, and the envelope,
+// which is nil if value isn't in one
+func unsealIntent(key string, value []byte) ([]byte, *IntentEnvelope, error) {
+	if !bytes.HasPrefix(value, intentEnvelopeMagic) {
+		return value, nil, nil
+	}
+	var sealed sealedIntent
+	err := json.Unmarshal(value[len(intentEnvelopeMagic):], &sealed)
+	if err != nil {
+		return nil, nil, util.Errorf("Could not parse intent envelope at %s: %s", key, err)
+	}
+	return sealed.Value, &sealed.IntentEnvelope, nil
+}
@@ -0,0 +1,75 @@
+// +build !race
+
+package consul
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func withIntentSigner(t *testing.T) *openpgp.Entity {
+	signer, err := openpgp.NewEntity("scheduler", "", "scheduler@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetIntentSigner(signer)
+	return signer
+}
+
+func TestSignedIntentRoundTrip(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+	defer withManifestEncoding("gzip", 64)()
+	signer := withIntentSigner(t)
+	defer SetIntentSigner(nil)
+
+	podManifest := largeManifest(t, "abc")
+	_, err := f.Store.SetPod(INTENT_TREE, "node", podManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Store.SetPod(REALITY_TREE, "node", podManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, _, err := f.Store.ListPods(INTENT_TREE, "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].IntentEnvelope == nil {
+		t.Fatalf("expected the intent to be read with its envelope, got %v", results)
+	}
+	envelope := results[0].IntentEnvelope
+	if err = envelope.Check("node", podManifest); err != nil {
+		t.Errorf("envelope should be of the manifest on the node: %s", err)
+	}
+	if envelope.Check("other_node", podManifest) == nil {
+		t.Errorf("envelope should not be of the manifest on another node")
+	}
+	if envelope.Check("node", largeManifest(t, "xyz")) == nil {
+		t.Errorf("envelope should not be of another manifest")
+	}
+	plaintext, signature := envelope.SignatureData()
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{signer}, bytes.NewReader(plaintext), bytes.NewReader(signature))
+	if err != nil {
+		t.Errorf("envelope should be signed by the intent signer: %s", err)
+	}
+
+	reality, _, err := f.Store.ListPods(REALITY_TREE, "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reality) != 1 || reality[0].IntentEnvelope != nil {
+		t.Errorf("expected reality to be written without an envelope, got %v", reality)
+	}
+	read, _, err := f.Store.Pod(INTENT_TREE, "node", "big_pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readSHA, _ := read.SHA(); readSHA != envelope.ManifestSHA {
+		t.Errorf("expected to read back manifest %s, got %s", envelope.ManifestSHA, readSHA)
+	}
+}
@@ -3,7 +3,6 @@
 package consul
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -38,6 +37,14 @@ type ManifestResult struct {
 
 	// This is expected to be nil for "legacy" pods that do not have a uuid, and non-nil for uuid pods.
 	PodUniqueKey types.PodUniqueKey
+
+	// When the key was written, if the writer recorded it. Currently only
+	// intent writes do. This is the writer's clock, not the reader's.
+	WriteTime time.Time
+
+	// The envelope signed by the writer of the intent, if it was written
+	// with an intent signer (see SetIntentSigner)
+	IntentEnvelope *IntentEnvelope
 }
 
 // HealthManager manages a collection of health checks that share configuration and
@@ -69,6 +76,13 @@ type WatchResult struct {
 	Status  string
 	Time    time.Time
 	Expires time.Time `json:"Expires,omitempty"`
+
+	// NodeLabels is the subset of the node's labels that the preparer was
+	// configured to attach to health results, so that results can be grouped
+	// without looking up each node's labels. It is formatted like a label
+	// selector (e.g. "az=us-west-2a,rack=r12") rather than stored as a map so
+	// that results remain comparable.
+	NodeLabels string `json:"NodeLabels,omitempty"`
 }
 
 // ValueEquiv returns true if the value of the WatchResult--everything except the
@@ -77,7 +91,8 @@ func (r WatchResult) ValueEquiv(s WatchResult) bool {
 	return r.Id == s.Id &&
 		r.Node == s.Node &&
 		r.Service == s.Service &&
-		r.Status == s.Status
+		r.Status == s.Status &&
+		r.NodeLabels == s.NodeLabels
 }
 
 // IsStale returns true when the result is stale according to the local clock.
@@ -89,6 +104,26 @@ func (r WatchResult) IsStale() bool {
 	return time.Now().After(expires)
 }
 
+// marshalHealth serializes a health result, compressing it if
+// HealthCompression is set
+func marshalHealth(res WatchResult) ([]byte, error) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return consulutil.CompressValue(*HealthCompression, data)
+}
+
+// UnmarshalHealth parses a health result read from Consul, which may or may
+// not have been compressed
+func UnmarshalHealth(data []byte, res *WatchResult) error {
+	data, err := consulutil.DecompressValue(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, res)
+}
+
 type PodStatusStore interface {
 	GetStatusFromIndex(index podstore.PodIndex) (podstatus.PodStatus, *api.QueryMeta, error)
 }
@@ -105,9 +140,19 @@ type consulStore struct {
 	// The /reality tree can now contain pods that have UUID keys, which
 	// means the reality manifest must be fetched from the pod status store
 	podStatusStore PodStatusStore
+
+	// Runs the watches of pod trees
+	watcher consulutil.PrefixWatcher
 }
 
 func NewConsulStore(client consulutil.ConsulClient) *consulStore {
+	return NewConsulStoreWithWatcher(client, consulutil.NewDirectWatcher(client.KV()))
+}
+
+// NewConsulStoreWithWatcher returns a store whose pod watches are run by
+// watcher, e.g. a consulutil.WatchDispatcher shared by every store of a
+// process so that watches of the same tree share one blocking query
+func NewConsulStoreWithWatcher(client consulutil.ConsulClient, watcher consulutil.PrefixWatcher) *consulStore {
 	statusStore := statusstore.NewConsul(client)
 	podStatusStore := podstatus.NewConsul(statusStore, PreparerPodStatusNamespace)
 	podStore := podstore.NewConsul(client.KV())
@@ -115,6 +160,7 @@ func NewConsulStore(client consulutil.ConsulClient) *consulStore {
 		client:         client,
 		podStore:       podStore,
 		podStatusStore: podStatusStore,
+		watcher:        watcher,
 	}
 }
 
@@ -124,7 +170,7 @@ func (c consulStore) PutHealth(res WatchResult) (time.Time, time.Duration, error
 	now := time.Now()
 	res.Time = now
 	res.Expires = now.Add(TTL)
-	data, err := json.Marshal(res)
+	data, err := marshalHealth(res)
 	if err != nil {
 		return time.Time{}, 0, err
 	}
@@ -153,7 +199,7 @@ func (c consulStore) GetHealth(service string, node types.NodeName) (WatchResult
 	} else if res == nil {
 		return WatchResult{}, nil
 	}
-	err = json.Unmarshal(res.Value, healthRes)
+	err = UnmarshalHealth(res.Value, healthRes)
 	if err != nil {
 		return WatchResult{}, consulutil.NewKVError("get", key, err)
 	}
@@ -174,7 +220,7 @@ func (c consulStore) GetServiceHealth(service string) (map[string]WatchResult, e
 	}
 	for _, kvp := range res {
 		watch := &WatchResult{}
-		err = json.Unmarshal(kvp.Value, watch)
+		err = UnmarshalHealth(kvp.Value, watch)
 		if err != nil {
 			return healthRes, consulutil.NewKVError("get", key, err)
 		}
@@ -185,21 +231,26 @@ func (c consulStore) GetServiceHealth(service string) (map[string]WatchResult, e
 	return healthRes, nil
 }
 
-// SetPod writes a pod manifest into the consul key-value store.
+// SetPod writes a pod manifest into the consul key-value store. The manifest
+// is compressed with ManifestCompression, and split into chunks if it is
+// larger than ManifestChunkBytes.
 func (c consulStore) SetPod(podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) (time.Duration, error) {
-	buf := bytes.Buffer{}
-	err := manifest.Write(&buf)
+	key, err := podPath(podPrefix, nodename, manifest.ID())
 	if err != nil {
 		return 0, err
 	}
-
-	key, err := podPath(podPrefix, nodename, manifest.ID())
+	value, staleChunks, err := c.encodeManifest(key, manifest)
+	if err != nil {
+		return 0, err
+	}
+	value, err = sealIntent(podPrefix, nodename, manifest, value)
 	if err != nil {
 		return 0, err
 	}
 	keyPair := &api.KVPair{
 		Key:   key,
-		Value: buf.Bytes(),
+		Value: value,
+		Flags: writeTimeFlags(podPrefix),
 	}
 
 	writeMeta, err := c.client.KV().Put(keyPair, nil)
@@ -210,25 +261,56 @@ func (c consulStore) SetPod(podPrefix PodPrefix, nodename types.NodeName, manife
 	if err != nil {
 		return retDur, consulutil.NewKVError("put", key, err)
 	}
-	return retDur, nil
+	return retDur, c.deleteStaleChunks(staleChunks)
 }
 
+// SetPodTxn adds writing a pod manifest to the transaction in ctx. If the
+// manifest has to be chunked, the chunks are written immediately, and
+// deleting the chunks of earlier versions is added to the transaction.
 func (c consulStore) SetPodTxn(ctx context.Context, podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) error {
-	manifestBytes, err := manifest.Marshal()
+	key, err := podPath(podPrefix, nodename, manifest.ID())
 	if err != nil {
 		return err
 	}
-
-	key, err := podPath(podPrefix, nodename, manifest.ID())
+	value, staleChunks, err := c.encodeManifest(key, manifest)
+	if err != nil {
+		return err
+	}
+	value, err = sealIntent(podPrefix, nodename, manifest, value)
 	if err != nil {
 		return err
 	}
 
-	return transaction.Add(ctx, api.KVTxnOp{
+	err = transaction.Add(ctx, api.KVTxnOp{
 		Verb:  string(api.KVSet),
 		Key:   key,
-		Value: manifestBytes,
+		Value: value,
+		Flags: writeTimeFlags(podPrefix),
 	})
+	if err != nil {
+		return err
+	}
+	return addTxnOps(ctx, staleChunkOps(staleChunks))
+}
+
+func addTxnOps(ctx context.Context, ops []api.KVTxnOp) error {
+	for _, op := range ops {
+		err := transaction.Add(ctx, op)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTimeFlags returns the flags to store with a pod key. Intent keys record
+// their write time so that propagation latency to the preparer can be
+// measured.
+func writeTimeFlags(podPrefix PodPrefix) uint64 {
+	if podPrefix != INTENT_TREE {
+		return 0
+	}
+	return consulutil.WriteTimeFlags(time.Now())
 }
 
 // DeletePod deletes a pod manifest from the key-value store. No error will be
@@ -243,6 +325,20 @@ func (c consulStore) DeletePod(podPrefix PodPrefix, nodename types.NodeName, pod
 	if err != nil {
 		return 0, consulutil.NewKVError("delete", key, err)
 	}
+	_, err = c.client.KV().DeleteTree(manifestChunkPath(key)+"/", nil)
+	if err != nil {
+		return writeMeta.RequestTime, consulutil.NewKVError("deletetree", manifestChunkPath(key), err)
+	}
+	if podPrefix == REALITY_TREE {
+		metadataKey, err := realityMetadataPath(nodename, podId)
+		if err != nil {
+			return writeMeta.RequestTime, err
+		}
+		_, err = c.client.KV().Delete(metadataKey, nil)
+		if err != nil {
+			return writeMeta.RequestTime, consulutil.NewKVError("delete", metadataKey, err)
+		}
+	}
 	return writeMeta.RequestTime, nil
 }
 
@@ -252,10 +348,27 @@ func (c consulStore) DeletePodTxn(ctx context.Context, podPrefix PodPrefix, node
 		return err
 	}
 
-	return transaction.Add(ctx, api.KVTxnOp{
-		Verb: api.KVDelete,
-		Key:  key,
-	})
+	ops := []api.KVTxnOp{
+		{
+			Verb: api.KVDelete,
+			Key:  key,
+		},
+		{
+			Verb: string(api.KVDeleteTree),
+			Key:  manifestChunkPath(key) + "/",
+		},
+	}
+	if podPrefix == REALITY_TREE {
+		metadataKey, err := realityMetadataPath(nodename, podId)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, api.KVTxnOp{
+			Verb: api.KVDelete,
+			Key:  metadataKey,
+		})
+	}
+	return addTxnOps(ctx, ops)
 }
 
 // MutatePod mutates the input context in such a way
@@ -276,13 +389,13 @@ func (c consulStore) MutatePod(
 
 		kvp, queryMeta, err := c.client.KV().Get(path, nil)
 		if err != nil {
-			return util.Errorf("can't get %s: %s", path, err)
+			return consulutil.NewKVError("get", path, err)
 		}
 		if kvp == nil {
 			continue
 		}
 
-		manifest, err := manifest.FromBytes(kvp.Value)
+		manifest, _, err := c.decodeManifest(path, kvp.Value)
 		if err != nil {
 			return util.Errorf("%s isn't a manifest: %s\n%s", path, err, string(kvp.Value))
 		}
@@ -292,7 +405,10 @@ func (c consulStore) MutatePod(
 			return util.Errorf("Can't mutate %s: %s\n%s", path, err, string(kvp.Value))
 		}
 
-		bytes, err := mutated.Marshal()
+		bytes, staleChunks, err := c.encodeManifest(path, mutated)
+		if err == nil {
+			bytes, err = sealIntent(INTENT_TREE, node, mutated, bytes)
+		}
 		if err != nil {
 			return util.Errorf("can't marshal mutated %s: %s\n%s", path, err, string(kvp.Value))
 		}
@@ -303,6 +419,9 @@ func (c consulStore) MutatePod(
 			Value: bytes,
 			Index: queryMeta.LastIndex,
 		})
+		if err == nil {
+			err = addTxnOps(ctx, staleChunkOps(staleChunks))
+		}
 		if err != nil {
 			return util.Errorf("can't add mutated %s to transaction: %s", path, err)
 		}
@@ -327,7 +446,7 @@ func (c consulStore) Pod(podPrefix PodPrefix, nodename types.NodeName, podId typ
 	if kvPair == nil {
 		return nil, writeMeta.RequestTime, pods.NoCurrentManifest
 	}
-	manifest, err := manifest.FromBytes(kvPair.Value)
+	manifest, _, err := c.decodeManifest(key, kvPair.Value)
 	return manifest, writeMeta.RequestTime, err
 }
 
@@ -416,6 +535,90 @@ func (c consulStore) WatchPod(
 	}
 }
 
+// PodPair holds the intent and reality manifests for a single pod on a single
+// node. Either manifest may be nil if the corresponding key does not exist.
+type PodPair struct {
+	Node    types.NodeName
+	PodID   types.PodID
+	Intent  manifest.Manifest
+	Reality manifest.Manifest
+}
+
+// Converged returns true if the pod exists in both intent and reality and
+// the two manifests are identical.
+func (p PodPair) Converged() (bool, error) {
+	if p.Intent == nil || p.Reality == nil {
+		return false, nil
+	}
+
+	intentSHA, err := p.Intent.SHA()
+	if err != nil {
+		return false, err
+	}
+
+	realitySHA, err := p.Reality.SHA()
+	if err != nil {
+		return false, err
+	}
+
+	return intentSHA == realitySHA, nil
+}
+
+// WatchPodPair watches both the intent and reality keys for a single (node,
+// pod) pair and emits a merged PodPair on pairChan whenever either one
+// changes. The first value is only emitted once both trees have been read,
+// so every emitted PodPair reflects a complete view. This is considerably
+// cheaper than watching a whole node when only a single pod is of interest.
+// Errors are emitted on errChan. To terminate the watch, close quitChan.
+func (c consulStore) WatchPodPair(
+	nodename types.NodeName,
+	podId types.PodID,
+	quitChan <-chan struct{},
+	errChan chan<- error,
+	pairChan chan<- PodPair,
+) {
+	defer close(pairChan)
+
+	intentChan := make(chan ManifestResult)
+	realityChan := make(chan ManifestResult)
+	go c.WatchPod(INTENT_TREE, nodename, podId, quitChan, errChan, intentChan)
+	go c.WatchPod(REALITY_TREE, nodename, podId, quitChan, errChan, realityChan)
+
+	pair := PodPair{
+		Node:  nodename,
+		PodID: podId,
+	}
+	var intentSeen, realitySeen bool
+	for {
+		select {
+		case <-quitChan:
+			return
+		case result, ok := <-intentChan:
+			if !ok {
+				return
+			}
+			pair.Intent = result.Manifest
+			intentSeen = true
+		case result, ok := <-realityChan:
+			if !ok {
+				return
+			}
+			pair.Reality = result.Manifest
+			realitySeen = true
+		}
+
+		if !intentSeen || !realitySeen {
+			continue
+		}
+
+		select {
+		case <-quitChan:
+			return
+		case pairChan <- pair:
+		}
+	}
+}
+
 // WatchPods watches the key-value store for any changes to pods for a given
 // host under a given tree.  The resulting manifests are emitted on podChan.
 // WatchPods does not return in the event of an error, but it will emit the
@@ -443,7 +646,7 @@ func (c consulStore) WatchPods(
 	}
 
 	kvPairsChan := make(chan api.KVPairs)
-	go consulutil.WatchPrefix(keyPrefix, c.client.KV(), kvPairsChan, quitChan, errChan, 0)
+	go c.watcher.WatchPrefix(keyPrefix, kvPairsChan, quitChan, errChan, 0)
 	for kvPairs := range kvPairsChan {
 		manifests := make([]ManifestResult, 0, len(kvPairs))
 		for _, pair := range kvPairs {
@@ -477,7 +680,7 @@ func (c consulStore) WatchAllPods(
 	defer close(podChan)
 
 	kvPairsChan := make(chan api.KVPairs)
-	go consulutil.WatchPrefix(string(podPrefix), c.client.KV(), kvPairsChan, quitChan, errChan, pauseTime)
+	go c.watcher.WatchPrefix(string(podPrefix), kvPairsChan, quitChan, errChan, pauseTime)
 	for kvPairs := range kvPairsChan {
 		manifests := make([]ManifestResult, 0, len(kvPairs))
 		for _, pair := range kvPairs {
@@ -569,6 +772,7 @@ func (c consulStore) manifestResultFromPair(pair *api.KVPair) (ManifestResult, e
 
 	var podManifest manifest.Manifest
 	var node types.NodeName
+	var envelope *IntentEnvelope
 	if podUniqueKey != "" {
 		var podIndex podstore.PodIndex
 		err := json.Unmarshal(pair.Value, &podIndex)
@@ -581,7 +785,7 @@ func (c consulStore) manifestResultFromPair(pair *api.KVPair) (ManifestResult, e
 			return ManifestResult{}, err
 		}
 	} else {
-		podManifest, err = manifest.FromBytes(pair.Value)
+		podManifest, envelope, err = c.decodeManifest(pair.Key, pair.Value)
 		if err != nil {
 			return ManifestResult{}, err
 		}
@@ -598,7 +802,9 @@ func (c consulStore) manifestResultFromPair(pair *api.KVPair) (ManifestResult, e
 			Node:  node,
 			PodID: podManifest.ID(),
 		},
-		PodUniqueKey: podUniqueKey,
+		PodUniqueKey:   podUniqueKey,
+		WriteTime:      consulutil.WriteTimeFromFlags(pair.Flags),
+		IntentEnvelope: envelope,
 	}, nil
 }
 
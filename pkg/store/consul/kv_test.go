@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
@@ -150,6 +151,66 @@ func TestMutateError(t *testing.T) {
 	}
 }
 
+func TestWatchPodPair(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	_, err := f.Store.SetPod(INTENT_TREE, "node1", testManifest("pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	errCh := make(chan error)
+	pairCh := make(chan PodPair)
+	go f.Store.WatchPodPair("node1", "pod", quitCh, errCh, pairCh)
+
+	nextPair := func() PodPair {
+		select {
+		case pair := <-pairCh:
+			return pair
+		case err := <-errCh:
+			t.Fatalf("Unexpected error from pod pair watch: %s", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for pod pair")
+		}
+		return PodPair{}
+	}
+
+	pair := nextPair()
+	if pair.Intent == nil {
+		t.Fatal("Expected intent manifest to be set")
+	}
+	if pair.Reality != nil {
+		t.Fatal("Expected reality manifest to be nil before it is written")
+	}
+	converged, err := pair.Converged()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converged {
+		t.Fatal("Pair should not be converged without a reality manifest")
+	}
+
+	_, err = f.Store.SetPod(REALITY_TREE, "node1", testManifest("pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair = nextPair()
+	if pair.Reality == nil {
+		t.Fatal("Expected reality manifest to be set")
+	}
+	converged, err = pair.Converged()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !converged {
+		t.Fatal("Expected pair to be converged once reality matches intent")
+	}
+}
+
 func TestPodUniqueKeyFromConsulPath(t *testing.T) {
 	type expectation struct {
 		path string
@@ -405,6 +466,37 @@ func TestSetPodTxn(t *testing.T) {
 	}
 }
 
+func TestIntentWriteTime(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	before := time.Now().Add(-time.Second)
+	_, err := f.Store.SetPod(INTENT_TREE, "some_node", testManifest("some_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Store.SetPod(REALITY_TREE, "some_node", testManifest("some_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intent, _, err := f.Store.ListPods(INTENT_TREE, "some_node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intent) != 1 || intent[0].WriteTime.Before(before) || intent[0].WriteTime.After(time.Now()) {
+		t.Errorf("expected intent result to carry its write time, got %+v", intent)
+	}
+
+	reality, _, err := f.Store.ListPods(REALITY_TREE, "some_node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reality) != 1 || !reality[0].WriteTime.IsZero() {
+		t.Errorf("expected reality result to have no write time, got %+v", reality)
+	}
+}
+
 func TestDeletePodTxn(t *testing.T) {
 	f := NewConsulTestFixture(t)
 	defer f.Close()
@@ -444,6 +536,68 @@ func TestDeletePodTxn(t *testing.T) {
 	}
 }
 
+func TestNamespacedStoresDontCollide(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	storeA := NewConsulStore(consulutil.NewNamespacedClient(f.Client, "a"))
+	storeB := NewConsulStore(consulutil.NewNamespacedClient(f.Client, "b"))
+
+	_, err := storeA.SetPod(INTENT_TREE, "node", testManifest("pod_a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err = storeB.SetPodTxn(ctx, INTENT_TREE, "node", testManifest("pod_b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transaction.MustCommit(ctx, consulutil.NewNamespacedClient(f.Client, "b").KV())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = storeB.PutHealth(WatchResult{Service: "pod_b", Node: "node", Status: "passing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, namespaced := range map[string]bool{"p2/a/intent/node/pod_a": true, "intent/node/pod_a": false} {
+		pair, _, err := f.Client.KV().Get(key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (pair != nil) != namespaced {
+			t.Errorf("expected the pod to be written only under its namespace, %s exists: %t", key, pair != nil)
+		}
+	}
+
+	for store, podID := range map[*consulStore]types.PodID{storeA: "pod_a", storeB: "pod_b"} {
+		results, _, err := store.ListPods(INTENT_TREE, "node")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Manifest.ID() != podID {
+			t.Errorf("expected only %s in its namespace, got %v", podID, results)
+		}
+	}
+
+	health, err := storeB.GetHealth("pod_b", "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "passing" {
+		t.Errorf("expected health to be read from its namespace, got %q", health.Status)
+	}
+	health, err = storeA.GetHealth("pod_b", "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "" {
+		t.Errorf("expected health not to be visible from another namespace, got %q", health.Status)
+	}
+}
+
 func testManifest(id types.PodID) manifest.Manifest {
 	builder := manifest.NewBuilder()
 	builder.SetID(id)
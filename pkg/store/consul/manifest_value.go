@@ -0,0 +1,204 @@
+package consul
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+
+	"github.com/hashicorp/consul/api"
+)
+
+var (
+	// ManifestCompression names the codec used to compress pod manifests
+	// written to Consul, or "none". Readers handle both compressed and
+	// uncompressed manifests, so this should only be enabled once every
+	// reader supports compression.
+	ManifestCompression = param.String("manifest_compression", consulutil.NoCompression)
+
+	// ManifestChunkBytes is the largest (compressed) manifest that is
+	// written to a single key. Larger manifests are split into chunks of
+	// this size, to stay under Consul's 512KB value limit.
+	ManifestChunkBytes = param.Int("manifest_chunk_bytes", 400*1024)
+)
+
+// The chunks of a manifest too large for one key are stored under
+// manifest_chunks/<pod key>/<digest>/<index>, where digest is the SHA-256 of
+// the manifest's stored value. The pod key holds a chunkedManifest recording
+// the digest and number of chunks, prefixed by chunkedManifestMagic, which
+// neither a manifest nor a compressed value can begin with.
+const manifestChunkTree = "manifest_chunks"
+
+var chunkedManifestMagic = []byte{0x00, 'p', '2', 'k'}
+
+type chunkedManifest struct {
+	Digest string `json:"digest"`
+	Chunks int    `json:"chunks"`
+}
+
+func manifestChunkPath(key string) string {
+	return path.Join(manifestChunkTree, key)
+}
+
+// encodeManifest returns the value to store at key for manifest, compressed
+// with ManifestCompression. If the value is larger than ManifestChunkBytes,
+// its chunks are written immediately and the returned value refers to them.
+// staleChunks are the prefixes of the chunks of earlier versions of the
+// manifest, which should be deleted once the value has been written. There
+// may be some even if the value is not chunked, when an earlier version was.
+func (c consulStore) encodeManifest(key string, manifest manifest.Manifest) (value []byte, staleChunks []string, err error) {
+	manifestBytes, err := manifest.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err = consulutil.CompressValue(*ManifestCompression, manifestBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	chunkSize := *ManifestChunkBytes
+	if chunkSize <= 0 || len(value) <= chunkSize {
+		staleChunks, err = c.staleManifestChunks(key, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		return value, staleChunks, nil
+	}
+
+	sum := sha256.Sum256(value)
+	digest := hex.EncodeToString(sum[:])
+	digestPath := path.Join(manifestChunkPath(key), digest)
+	header := chunkedManifest{Digest: digest}
+	for start := 0; start < len(value); start += chunkSize {
+		end := start + chunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		chunkKey := path.Join(digestPath, strconv.Itoa(header.Chunks))
+		_, err = c.client.KV().Put(&api.KVPair{Key: chunkKey, Value: value[start:end]}, nil)
+		if err != nil {
+			return nil, nil, consulutil.NewKVError("put", chunkKey, err)
+		}
+		header.Chunks++
+	}
+
+	staleChunks, err = c.staleManifestChunks(key, digest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return nil, nil, util.Errorf("Could not marshal chunked manifest header: %s", err)
+	}
+	return append(append([]byte{}, chunkedManifestMagic...), headerBytes...), staleChunks, nil
+}
+
+// staleManifestChunks returns the prefixes of the chunks stored for the
+// manifest at key other than those of digest, which may be empty
+func (c consulStore) staleManifestChunks(key string, digest string) ([]string, error) {
+	prefixes, _, err := c.client.KV().Keys(manifestChunkPath(key)+"/", "/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("keys", manifestChunkPath(key), err)
+	}
+
+	var staleChunks []string
+	for _, prefix := range prefixes {
+		if digest == "" || prefix != path.Join(manifestChunkPath(key), digest)+"/" {
+			staleChunks = append(staleChunks, prefix)
+		}
+	}
+	return staleChunks, nil
+}
+
+// decodeManifest parses the manifest stored at key, reassembling its chunks
+// if it was chunked and decompressing it if it was compressed. It also returns
+// the envelope of the intent, if it is in one.
+func (c consulStore) decodeManifest(key string, value []byte) (manifest.Manifest, *IntentEnvelope, error) {
+	value, envelope, err := unsealIntent(key, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.HasPrefix(value, chunkedManifestMagic) {
+		value, err = c.readManifestChunks(key, value[len(chunkedManifestMagic):])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	value, err = consulutil.DecompressValue(value)
+	if err != nil {
+		return nil, nil, util.Errorf("Could not decompress manifest at %s: %s", key, err)
+	}
+	podManifest, err := manifest.FromBytes(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return podManifest, envelope, nil
+}
+
+func (c consulStore) readManifestChunks(key string, headerBytes []byte) ([]byte, error) {
+	var header chunkedManifest
+	err := json.Unmarshal(headerBytes, &header)
+	if err != nil {
+		return nil, util.Errorf("Could not parse chunked manifest header at %s: %s", key, err)
+	}
+
+	digestPath := path.Join(manifestChunkPath(key), header.Digest)
+	pairs, _, err := c.client.KV().List(digestPath+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", digestPath, err)
+	}
+	chunks := make([][]byte, header.Chunks)
+	for _, pair := range pairs {
+		index, err := strconv.Atoi(strings.TrimPrefix(pair.Key, digestPath+"/"))
+		if err != nil || index < 0 || index >= header.Chunks {
+			return nil, util.Errorf("Unexpected manifest chunk %s", pair.Key)
+		}
+		chunks[index] = pair.Value
+	}
+	for i, chunk := range chunks {
+		if chunk == nil {
+			return nil, util.Errorf("Chunk %d of the manifest at %s is missing", i, key)
+		}
+	}
+
+	value := bytes.Join(chunks, nil)
+	sum := sha256.Sum256(value)
+	if hex.EncodeToString(sum[:]) != header.Digest {
+		return nil, util.Errorf("The chunks of the manifest at %s don't match its digest %s", key, header.Digest)
+	}
+	return value, nil
+}
+
+// deleteStaleChunks deletes the chunks of earlier versions of a manifest
+// once the new version has been written
+func (c consulStore) deleteStaleChunks(staleChunks []string) error {
+	for _, prefix := range staleChunks {
+		_, err := c.client.KV().DeleteTree(prefix, nil)
+		if err != nil {
+			return consulutil.NewKVError("deletetree", prefix, err)
+		}
+	}
+	return nil
+}
+
+// staleChunkOps returns the transaction operations that delete the chunks of
+// earlier versions of a manifest
+func staleChunkOps(staleChunks []string) []api.KVTxnOp {
+	var ops []api.KVTxnOp
+	for _, prefix := range staleChunks {
+		ops = append(ops, api.KVTxnOp{
+			Verb: string(api.KVDeleteTree),
+			Key:  prefix,
+		})
+	}
+	return ops
+}
@@ -0,0 +1,151 @@
+// +build !race
+
+package consul
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/manifest"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func largeManifest(t *testing.T, value string) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID("big_pod")
+	err := builder.SetConfig(map[interface{}]interface{}{"blob": strings.Repeat(value, 2048)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return builder.GetManifest()
+}
+
+func withManifestEncoding(compression string, chunkBytes int) func() {
+	oldCompression, oldChunkBytes := *ManifestCompression, *ManifestChunkBytes
+	*ManifestCompression, *ManifestChunkBytes = compression, chunkBytes
+	return func() {
+		*ManifestCompression, *ManifestChunkBytes = oldCompression, oldChunkBytes
+	}
+}
+
+func chunkKeys(t *testing.T, f *ConsulTestFixture) []string {
+	keys, _, err := f.Client.KV().Keys(manifestChunkTree+"/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestChunkedManifestRoundTrip(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+	defer withManifestEncoding("gzip", 64)()
+
+	first := largeManifest(t, "abc")
+	_, err := f.Store.SetPod(INTENT_TREE, "node", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstChunks := chunkKeys(t, f)
+	if len(firstChunks) < 2 {
+		t.Fatalf("expected the manifest to be chunked, got chunks %v", firstChunks)
+	}
+
+	read, _, err := f.Store.Pod(INTENT_TREE, "node", "big_pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedSHA, _ := first.SHA()
+	readSHA, _ := read.SHA()
+	if readSHA != expectedSHA {
+		t.Errorf("expected to read back manifest %s, got %s", expectedSHA, readSHA)
+	}
+	results, _, err := f.Store.ListPods(INTENT_TREE, "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Manifest.ID() != "big_pod" {
+		t.Errorf("expected chunks not to be listed as pods, got %v", results)
+	}
+
+	_, err = f.Store.SetPod(INTENT_TREE, "node", largeManifest(t, "xyz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range chunkKeys(t, f) {
+		for _, stale := range firstChunks {
+			if key == stale {
+				t.Errorf("expected the chunks of the first manifest to be deleted, found %s", key)
+			}
+		}
+	}
+
+	// a manifest that shrinks back under the chunk size leaves no chunks
+	*ManifestChunkBytes = 1024 * 1024
+	_, err = f.Store.SetPod(INTENT_TREE, "node", largeManifest(t, "abc"))
+	*ManifestChunkBytes = 64
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := chunkKeys(t, f); len(keys) != 0 {
+		t.Errorf("expected the chunks of the large manifest to be deleted, got %v", keys)
+	}
+
+	_, err = f.Store.SetPod(INTENT_TREE, "node", largeManifest(t, "abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Store.DeletePod(INTENT_TREE, "node", "big_pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := chunkKeys(t, f); len(keys) != 0 {
+		t.Errorf("expected deleting the pod to delete its chunks, got %v", keys)
+	}
+}
+
+func TestChunkedManifestVerifiesDigest(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+	defer withManifestEncoding("none", 64)()
+
+	_, err := f.Store.SetPod(INTENT_TREE, "node", largeManifest(t, "abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := chunkKeys(t, f)
+	if len(keys) == 0 {
+		t.Fatal("expected the manifest to be chunked")
+	}
+	_, err = f.Client.KV().Put(&api.KVPair{Key: keys[0], Value: []byte("corrupted")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = f.Store.Pod(INTENT_TREE, "node", "big_pod")
+	if err == nil || !strings.Contains(err.Error(), "digest") {
+		t.Errorf("expected a corrupted chunk to fail digest verification, got %v", err)
+	}
+}
+
+func TestCompressedManifestIsReadable(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+	defer withManifestEncoding("gzip", 0)()
+
+	_, err := f.Store.SetPod(INTENT_TREE, "node", testManifest("small_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := f.GetKV("intent/node/small_pod"); strings.HasPrefix(string(value), "id:") {
+		t.Errorf("expected the manifest to be stored compressed, got %q", value)
+	}
+	read, _, err := f.Store.Pod(INTENT_TREE, "node", "small_pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.ID() != "small_pod" {
+		t.Errorf("expected to read back small_pod, got %s", read.ID())
+	}
+}
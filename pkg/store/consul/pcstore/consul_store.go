@@ -1,6 +1,7 @@
 package pcstore
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,6 +19,7 @@ import (
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/pc/fields"
 	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 )
@@ -50,10 +52,28 @@ type MetricsRegistry interface {
 	Register(metricName string, metric interface{}) error
 }
 
+// CASError is returned when a pod cluster write fails because the pod
+// cluster was modified since it was read
+type CASError string
+
+func (e CASError) Error() string {
+	return fmt.Sprintf("Could not check-and-set key %q", string(e))
+}
+
+// CASConflict lets consulutil.IsCASConflict recognize the error
+func (e CASError) CASConflict() bool {
+	return true
+}
+
 func IsNotExist(err error) bool {
 	return err == NoPodCluster
 }
 
+func IsCASError(err error) bool {
+	_, ok := err.(CASError)
+	return ok
+}
+
 func IsAlreadyExists(err error) bool {
 	return err == PodClusterAlreadyExists
 }
@@ -123,6 +143,10 @@ func (s *ConsulStore) Create(
 	annotations fields.Annotations,
 	session Session,
 ) (fields.PodCluster, error) {
+	if err := annotations.Validate(); err != nil {
+		return fields.PodCluster{}, err
+	}
+
 	id := fields.ID(uuid.New())
 
 	unlocker, err := s.lockForCreation(podID, availabilityZone, clusterName, session)
@@ -238,6 +262,32 @@ func (s *ConsulStore) List() ([]fields.PodCluster, error) {
 	return kvpsToPC(pairs)
 }
 
+// GetWithIndex returns the pod cluster with the given id along with the
+// consul ModifyIndex of the pod cluster's key. The index can be passed to
+// CASPC to ensure that a mutation only applies if the pod cluster has not
+// changed since it was read.
+func (s *ConsulStore) GetWithIndex(id fields.ID) (fields.PodCluster, uint64, error) {
+	key, err := pcPath(id)
+	if err != nil {
+		return fields.PodCluster{}, 0, err
+	}
+
+	kvp, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return fields.PodCluster{}, 0, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		// ID didn't exist
+		return fields.PodCluster{}, 0, NoPodCluster
+	}
+
+	pc, err := kvpToPC(kvp)
+	if err != nil {
+		return fields.PodCluster{}, 0, err
+	}
+	return pc, kvp.ModifyIndex, nil
+}
+
 // performs a safe (ie check-and-set) mutation of the pc with the given id,
 // using the given function
 // if the mutator returns an error, it will be propagated out
@@ -246,51 +296,128 @@ func (s *ConsulStore) MutatePC(
 	id fields.ID,
 	mutator func(fields.PodCluster) (fields.PodCluster, error),
 ) (fields.PodCluster, error) {
-	pcp, err := pcPath(id)
+	pc, index, err := s.GetWithIndex(id)
 	if err != nil {
 		return fields.PodCluster{}, err
 	}
 
-	kvp, meta, err := s.kv.Get(pcp, nil)
+	return s.writePC(pc, index, mutator)
+}
+
+// CASPC is like MutatePC, but the mutation is only applied if the pod
+// cluster's ModifyIndex matches the passed modifyIndex, which should be
+// obtained from GetWithIndex. A CASError is returned if the pod cluster has
+// been modified since then.
+func (s *ConsulStore) CASPC(
+	id fields.ID,
+	modifyIndex uint64,
+	mutator func(fields.PodCluster) (fields.PodCluster, error),
+) (fields.PodCluster, error) {
+	pc, index, err := s.GetWithIndex(id)
 	if err != nil {
-		return fields.PodCluster{}, consulutil.NewKVError("get", pcp, err)
+		return fields.PodCluster{}, err
 	}
 
-	if kvp == nil {
-		return fields.PodCluster{}, NoPodCluster
+	if index != modifyIndex {
+		pcp, err := pcPath(id)
+		if err != nil {
+			return fields.PodCluster{}, err
+		}
+		return fields.PodCluster{}, CASError(pcp)
 	}
 
-	pc, err := kvpToPC(kvp)
+	return s.writePC(pc, modifyIndex, mutator)
+}
+
+// MutatePCTxn adds a check-and-set operation to the passed transaction to
+// perform the mutation requested via the mutator function. Labels are not
+// part of the transaction, so the mutator may not change the pod ID,
+// availability zone or cluster name of the pod cluster.
+func (s *ConsulStore) MutatePCTxn(
+	ctx context.Context,
+	id fields.ID,
+	mutator func(fields.PodCluster) (fields.PodCluster, error),
+) (fields.PodCluster, error) {
+	pc, index, err := s.GetWithIndex(id)
+	if err != nil {
+		// passed through so callers can check for NoPodCluster
+		return fields.PodCluster{}, err
+	}
+
+	mutated, err := mutator(pc)
 	if err != nil {
 		return fields.PodCluster{}, err
 	}
+	if mutated.ID != pc.ID || mutated.PodID != pc.PodID ||
+		mutated.AvailabilityZone != pc.AvailabilityZone || mutated.Name != pc.Name {
+		return fields.PodCluster{}, util.Errorf("Changing the ID, pod ID, availability zone or name of pod cluster %s in a transaction is not permitted", id)
+	}
+
+	if err := mutated.Annotations.ValidateChanges(pc.Annotations); err != nil {
+		return fields.PodCluster{}, err
+	}
+
+	jsonPC, err := json.Marshal(mutated)
+	if err != nil {
+		return fields.PodCluster{}, util.Errorf("Unable to marshal pod cluster as JSON: %s", err)
+	}
 
+	pcp, err := pcPath(id)
+	if err != nil {
+		return fields.PodCluster{}, err
+	}
+
+	err = transaction.Add(ctx, api.KVTxnOp{
+		Verb:  api.KVCAS,
+		Key:   pcp,
+		Index: index,
+		Value: jsonPC,
+	})
+	if err != nil {
+		return fields.PodCluster{}, err
+	}
+
+	return mutated, nil
+}
+
+func (s *ConsulStore) writePC(
+	pc fields.PodCluster,
+	modifyIndex uint64,
+	mutator func(fields.PodCluster) (fields.PodCluster, error),
+) (fields.PodCluster, error) {
+	pcp, err := pcPath(pc.ID)
+	if err != nil {
+		return fields.PodCluster{}, err
+	}
+
+	old := pc.Annotations
 	pc, err = mutator(pc)
 	if err != nil {
 		return fields.PodCluster{}, err
 	}
 
+	if err := pc.Annotations.ValidateChanges(old); err != nil {
+		return fields.PodCluster{}, err
+	}
+
 	jsonPC, err := json.Marshal(pc)
 	if err != nil {
 		// Probably the annotations don't marshal to JSON
 		return fields.PodCluster{}, util.Errorf("Unable to marshal pod cluster as JSON: %s", err)
 	}
 
-	// the chance of the UUID already existing is vanishingly small, but
-	// technically not impossible, so we should use the CAS index to guard
-	// against duplicate UUIDs
 	var success bool
 	success, _, err = s.kv.CAS(&api.KVPair{
 		Key:         pcp,
 		Value:       jsonPC,
-		ModifyIndex: meta.LastIndex,
+		ModifyIndex: modifyIndex,
 	}, nil)
 	if err != nil {
 		return fields.PodCluster{}, consulutil.NewKVError("cas", pcp, err)
 	}
 
 	if !success {
-		return fields.PodCluster{}, util.Errorf("Could not set pod cluster at path '%s'", pcp)
+		return fields.PodCluster{}, CASError(pcp)
 	}
 
 	err = s.setLabelsForPC(pc)
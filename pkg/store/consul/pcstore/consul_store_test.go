@@ -1,6 +1,7 @@
 package pcstore
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
@@ -11,9 +12,11 @@ import (
 	"github.com/square/p2/pkg/pc/fields"
 	"github.com/square/p2/pkg/store/consul/consultest"
 	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/types"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/hashicorp/consul/api"
 	"github.com/rcrowley/go-metrics"
 	klabels "k8s.io/kubernetes/pkg/labels"
 )
@@ -110,6 +113,95 @@ func TestMutate(t *testing.T) {
 	}
 }
 
+func TestCASPC(t *testing.T) {
+	store := ConsulStoreWithFakeKV()
+	oldPc := createPodCluster(store, t)
+
+	_, index, err := store.GetWithIndex(oldPc.ID)
+	if err != nil {
+		t.Fatalf("Unable to get pod cluster with index: %s", err)
+	}
+
+	mutator := func(pc fields.PodCluster) (fields.PodCluster, error) {
+		pc.Annotations = fields.Annotations{"bar": "foo"}
+		return pc, nil
+	}
+
+	_, err = store.CASPC(oldPc.ID, index+1, mutator)
+	if !IsCASError(err) {
+		t.Fatalf("Expected a CAS error when mutating with a stale index, got %v", err)
+	}
+
+	_, err = store.CASPC(oldPc.ID, index, mutator)
+	if err != nil {
+		t.Fatalf("Unable to CAS pod cluster: %s", err)
+	}
+
+	newPC, err := store.Get(oldPc.ID)
+	if err != nil {
+		t.Fatalf("Unable to find pod cluster: %s", err)
+	}
+
+	if newPC.Annotations["bar"] != "foo" {
+		t.Errorf("Annotations didn't match expected")
+	}
+}
+
+type recordingTxner struct {
+	ops api.KVTxnOps
+}
+
+func (r *recordingTxner) Txn(ops api.KVTxnOps, _ *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	r.ops = ops
+	return true, &api.KVTxnResponse{}, nil, nil
+}
+
+func TestMutatePCTxn(t *testing.T) {
+	store := ConsulStoreWithFakeKV()
+	pc := createPodCluster(store, t)
+	_, index, err := store.GetWithIndex(pc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	mutated, err := store.MutatePCTxn(ctx, pc.ID, func(pc fields.PodCluster) (fields.PodCluster, error) {
+		pc.Annotations = fields.Annotations{"foo": "baz"}
+		return pc, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error adding mutation to transaction: %s", err)
+	}
+	if mutated.Annotations["foo"] != "baz" {
+		t.Errorf("Expected mutated pod cluster to be returned, got %+v", mutated)
+	}
+
+	txner := &recordingTxner{}
+	err = transaction.MustCommit(ctx, txner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txner.ops) != 1 {
+		t.Fatalf("Expected a single transaction operation, got %d", len(txner.ops))
+	}
+	op := txner.ops[0]
+	expectedKey, _ := pcPath(pc.ID)
+	if op.Verb != api.KVCAS || op.Key != expectedKey || op.Index != index {
+		t.Errorf("Expected CAS of %s at index %d, got %+v", expectedKey, index, op)
+	}
+
+	ctx, cancel = transaction.New(context.Background())
+	defer cancel()
+	_, err = store.MutatePCTxn(ctx, pc.ID, func(pc fields.PodCluster) (fields.PodCluster, error) {
+		pc.Name = "renamed"
+		return pc, nil
+	})
+	if err == nil {
+		t.Error("Expected renaming a pod cluster in a transaction to fail")
+	}
+}
+
 func createPodCluster(store *ConsulStore, t *testing.T) fields.PodCluster {
 	podID := types.PodID("pod_id")
 	az := fields.AvailabilityZone("us-west")
@@ -166,6 +258,36 @@ func createPodCluster(store *ConsulStore, t *testing.T) fields.PodCluster {
 	return pc
 }
 
+func TestInvalidAnnotationsRejected(t *testing.T) {
+	store := ConsulStoreWithFakeKV()
+	podID := types.PodID("pod_id")
+	az := fields.AvailabilityZone("us-west")
+	clusterName := fields.ClusterName("cluster_name")
+	selector := klabels.Everything().
+		Add(fields.PodIDLabel, klabels.EqualsOperator, []string{podID.String()})
+
+	session := consultest.NewSession()
+	_, err := store.Create(podID, az, clusterName, selector, fields.Annotations{
+		fields.SLOTierAnnotation: "platinum",
+	}, session)
+	if !fields.IsAnnotationError(err) {
+		t.Fatalf("Expected an annotation error creating a pod cluster with a bad slo tier, got %v", err)
+	}
+
+	pc, err := store.Create(podID, az, clusterName, selector, fields.Annotations{}, session)
+	if err != nil {
+		t.Fatalf("Unable to create pod cluster: %s", err)
+	}
+
+	_, err = store.MutatePC(pc.ID, func(pc fields.PodCluster) (fields.PodCluster, error) {
+		pc.Annotations = fields.Annotations{fields.OwnerAnnotation: map[string]interface{}{"pager": "nobody"}}
+		return pc, nil
+	})
+	if !fields.IsAnnotationError(err) {
+		t.Fatalf("Expected an annotation error updating a pod cluster with a bad owner, got %v", err)
+	}
+}
+
 func TestLabelsOnCreate(t *testing.T) {
 	store := ConsulStoreWithFakeKV()
 	podID := types.PodID("pod_id")
@@ -1,6 +1,7 @@
 package pcstoretest
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/square/p2/pkg/labels"
@@ -18,14 +19,24 @@ import (
 type FakePCStore struct {
 	podClusters map[fields.ID]fields.PodCluster
 	watchers    map[fields.ID]chan pcstore.WatchedPodCluster
+
+	// Imitates the ModifyIndex capability of consul, enabling CAS operations
+	modifyIndices map[fields.ID]uint64
+	lastIndex     uint64
 }
 
 func NewFake() *FakePCStore {
 	return &FakePCStore{
-		podClusters: make(map[fields.ID]fields.PodCluster),
+		podClusters:   make(map[fields.ID]fields.PodCluster),
+		modifyIndices: make(map[fields.ID]uint64),
 	}
 }
 
+func (p *FakePCStore) bumpIndex(id fields.ID) {
+	p.lastIndex++
+	p.modifyIndices[id] = p.lastIndex
+}
+
 func (p *FakePCStore) Create(
 	podID types.PodID,
 	availabilityZone fields.AvailabilityZone,
@@ -34,6 +45,10 @@ func (p *FakePCStore) Create(
 	annotations fields.Annotations,
 	_ pcstore.Session,
 ) (fields.PodCluster, error) {
+	if err := annotations.Validate(); err != nil {
+		return fields.PodCluster{}, err
+	}
+
 	id := fields.ID(uuid.New())
 	pc := fields.PodCluster{
 		ID:               id,
@@ -45,6 +60,7 @@ func (p *FakePCStore) Create(
 	}
 
 	p.podClusters[id] = pc
+	p.bumpIndex(id)
 	if watcher, ok := p.watchers[id]; ok {
 		watcher <- pcstore.WatchedPodCluster{PodCluster: &pc, Err: nil}
 	}
@@ -59,8 +75,18 @@ func (p *FakePCStore) Get(id fields.ID) (fields.PodCluster, error) {
 	return fields.PodCluster{}, pcstore.NoPodCluster
 }
 
+func (p *FakePCStore) GetWithIndex(id fields.ID) (fields.PodCluster, uint64, error) {
+	pc, err := p.Get(id)
+	if err != nil {
+		return fields.PodCluster{}, 0, err
+	}
+
+	return pc, p.modifyIndices[id], nil
+}
+
 func (p *FakePCStore) Delete(id fields.ID) error {
 	delete(p.podClusters, id)
+	delete(p.modifyIndices, id)
 	return nil
 }
 
@@ -81,12 +107,18 @@ func (p *FakePCStore) MutatePC(
 		return fields.PodCluster{}, err
 	}
 
+	old := pc.Annotations
 	pc, err = mutator(pc)
 	if err != nil {
 		return fields.PodCluster{}, err
 	}
 
+	if err := pc.Annotations.ValidateChanges(old); err != nil {
+		return fields.PodCluster{}, err
+	}
+
 	p.podClusters[id] = pc
+	p.bumpIndex(id)
 	if watcher, ok := p.watchers[id]; ok {
 		// In case the user mutates more than once, this prevents a deadlock
 		// while keeping the functionality of the fake watch
@@ -100,6 +132,34 @@ func (p *FakePCStore) MutatePC(
 	return pc, nil
 }
 
+// MutatePCTxn applies the mutation immediately rather than adding it to the
+// passed transaction, so the transaction is never committed or rolled back
+// from the fake's point of view.
+func (p *FakePCStore) MutatePCTxn(
+	_ context.Context,
+	id fields.ID,
+	mutator func(fields.PodCluster) (fields.PodCluster, error),
+) (fields.PodCluster, error) {
+	return p.MutatePC(id, mutator)
+}
+
+func (p *FakePCStore) CASPC(
+	id fields.ID,
+	modifyIndex uint64,
+	mutator func(fields.PodCluster) (fields.PodCluster, error),
+) (fields.PodCluster, error) {
+	_, index, err := p.GetWithIndex(id)
+	if err != nil {
+		return fields.PodCluster{}, err
+	}
+
+	if index != modifyIndex {
+		return fields.PodCluster{}, pcstore.CASError(id.String())
+	}
+
+	return p.MutatePC(id, mutator)
+}
+
 func (p *FakePCStore) FindWhereLabeled(
 	podID types.PodID,
 	availabilityZone fields.AvailabilityZone,
@@ -0,0 +1,175 @@
+package consul
+
+import (
+	"strings"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultPageNodes is how many nodes' pods are in a page of pods if
+// ListPodsOptions doesn't set NodeLimit
+const DefaultPageNodes = 100
+
+// ListPodsOptions selects a page of the pods of a tree. The pods of a tree
+// are paged by node, in the order of the nodes' names, so that each page
+// reads the pods of a bounded number of nodes instead of the whole tree in
+// one response.
+type ListPodsOptions struct {
+	// StartNode is the first node of the page. It is the NextNode of the
+	// previous page, or empty for the first page.
+	StartNode types.NodeName
+	// NodeLimit is how many nodes the page has pods of, DefaultPageNodes
+	// if unset
+	NodeLimit int
+	// PodIDPrefix, if set, only selects the pods whose ID starts with it.
+	// The pods whose key is their pod ID are filtered by consul, but those
+	// whose key is a pod unique key have to be read to be filtered.
+	PodIDPrefix string
+}
+
+// PodPage is a page of the pods of a tree
+type PodPage struct {
+	Pods []ManifestResult
+	// NextNode is the StartNode of the next page, empty if this is the
+	// last page
+	NextNode types.NodeName
+}
+
+// ListPodsPage reads a page of the pods of the intent or reality tree.
+//
+// As with AllPods, values that are not pod manifests are left out.
+func (c consulStore) ListPodsPage(podPrefix PodPrefix, opts ListPodsOptions) (PodPage, error) {
+	if podPrefix == HOOK_TREE {
+		return PodPage{}, util.Errorf("the %s tree is not paged by node", HOOK_TREE)
+	}
+	limit := opts.NodeLimit
+	if limit <= 0 {
+		limit = DefaultPageNodes
+	}
+
+	nodes, err := c.podNodes(podPrefix)
+	if err != nil {
+		return PodPage{}, err
+	}
+
+	var page PodPage
+	for _, node := range nodes {
+		if node < opts.StartNode {
+			continue
+		}
+		if limit == 0 {
+			page.NextNode = node
+			break
+		}
+		limit--
+
+		pods, err := c.nodePods(podPrefix, node, opts.PodIDPrefix)
+		if err != nil {
+			return PodPage{}, err
+		}
+		page.Pods = append(page.Pods, pods...)
+	}
+	return page, nil
+}
+
+// ForEachPod calls f with each pod of the intent or reality tree that opts
+// selects, reading the tree a page at a time, starting with the page of opts
+// and following each page's NextNode. It stops at and returns the first
+// error, either of f or of reading a page.
+func (c consulStore) ForEachPod(podPrefix PodPrefix, opts ListPodsOptions, f func(ManifestResult) error) error {
+	for {
+		page, err := c.ListPodsPage(podPrefix, opts)
+		if err != nil {
+			return err
+		}
+		for _, pod := range page.Pods {
+			err = f(pod)
+			if err != nil {
+				return err
+			}
+		}
+		if page.NextNode == "" {
+			return nil
+		}
+		opts.StartNode = page.NextNode
+	}
+}
+
+// podNodes returns the nodes that have pods in the tree, in the order of
+// their names
+func (c consulStore) podNodes(podPrefix PodPrefix) ([]types.NodeName, error) {
+	prefix := podPrefix.String() + "/"
+	keys, _, err := c.client.KV().Keys(prefix, "/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("keys", prefix, err)
+	}
+
+	var nodes []types.NodeName
+	for _, key := range keys {
+		// the keys of nodes' subtrees are returned as <tree>/<node>/
+		if !strings.HasSuffix(key, "/") {
+			continue
+		}
+		node := types.NodeName(strings.TrimSuffix(strings.TrimPrefix(key, prefix), "/"))
+		if node != "" {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// nodePods reads the pods of node whose ID starts with podIDPrefix
+func (c consulStore) nodePods(podPrefix PodPrefix, node types.NodeName, podIDPrefix string) ([]ManifestResult, error) {
+	keyPrefix, err := nodePath(podPrefix, node)
+	if err != nil {
+		return nil, err
+	}
+	keyPrefix += "/"
+
+	pairs, _, err := c.client.KV().List(keyPrefix+podIDPrefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", keyPrefix+podIDPrefix, err)
+	}
+	if podIDPrefix != "" {
+		// the pods whose key is a pod unique key rather than their pod
+		// ID can't be filtered by their key, so they are read one at
+		// a time
+		keys, _, err := c.client.KV().Keys(keyPrefix, "/", nil)
+		if err != nil {
+			return nil, consulutil.NewKVError("keys", keyPrefix, err)
+		}
+		listed := make(map[string]bool)
+		for _, pair := range pairs {
+			listed[pair.Key] = true
+		}
+		for _, key := range keys {
+			podUniqueKey, err := PodUniqueKeyFromConsulPath(key)
+			if err != nil || podUniqueKey == "" || listed[key] {
+				continue
+			}
+			pair, _, err := c.client.KV().Get(key, nil)
+			if err != nil {
+				return nil, consulutil.NewKVError("get", key, err)
+			}
+			if pair != nil {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+
+	var ret []ManifestResult
+	for _, pair := range pairs {
+		result, err := c.manifestResultFromPair(pair)
+		if err != nil {
+			// Just list all the pods that we can
+			continue
+		}
+		if !strings.HasPrefix(result.Manifest.ID().String(), podIDPrefix) {
+			continue
+		}
+		ret = append(ret, result)
+	}
+	return ret, nil
+}
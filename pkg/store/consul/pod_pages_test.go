@@ -0,0 +1,83 @@
+// +build !race
+
+package consul
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestListPodsPage(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	store := NewConsulStore(fixture.Client)
+
+	for _, node := range []types.NodeName{"node3", "node1", "node2"} {
+		for _, podID := range []types.PodID{"web", "worker", "api"} {
+			_, err := store.SetPod(INTENT_TREE, node, testManifest(podID))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// a uuid pod, whose key is not its pod ID
+	uuidKey, err := store.podStore.Schedule(testManifest("web_uuid"), "node2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := store.ListPodsPage(INTENT_TREE, ListPodsOptions{NodeLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Pods) != 7 || page.NextNode != "node3" {
+		t.Fatalf("expected the 7 pods of node1 and node2 and node3 next, got %d pods and %q next", len(page.Pods), page.NextNode)
+	}
+	for _, pod := range page.Pods {
+		if pod.PodLocation.Node == "node3" {
+			t.Errorf("expected node3's pods to be on the next page, got %+v", pod.PodLocation)
+		}
+	}
+
+	page, err = store.ListPodsPage(INTENT_TREE, ListPodsOptions{NodeLimit: 2, StartNode: page.NextNode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Pods) != 3 || page.NextNode != "" {
+		t.Fatalf("expected the last page to have node3's 3 pods, got %d pods and %q next", len(page.Pods), page.NextNode)
+	}
+
+	var found []string
+	err = store.ForEachPod(INTENT_TREE, ListPodsOptions{NodeLimit: 1, PodIDPrefix: "w"}, func(pod ManifestResult) error {
+		found = append(found, fmt.Sprintf("%s/%s", pod.PodLocation.Node, pod.Manifest.ID()))
+		if pod.Manifest.ID() == "web_uuid" && pod.PodUniqueKey != uuidKey {
+			t.Errorf("expected the uuid pod to have its pod unique key, got %q", pod.PodUniqueKey)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[node1/web node1/worker node2/web node2/worker node2/web_uuid node3/web node3/worker]"
+	if fmt.Sprint(found) != expected {
+		t.Errorf("expected the pods starting with w to be %s, got %v", expected, found)
+	}
+
+	stop := fmt.Errorf("stop")
+	calls := 0
+	err = store.ForEachPod(INTENT_TREE, ListPodsOptions{}, func(ManifestResult) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("expected iteration to stop at the first error, got %v after %d calls", err, calls)
+	}
+
+	_, err = store.ListPodsPage(HOOK_TREE, ListPodsOptions{})
+	if err == nil {
+		t.Error("expected the hook tree to not be paged")
+	}
+}
@@ -0,0 +1,170 @@
+// Package podeventstore stores the lifecycle events that preparers record for
+// the pods on their nodes
+package podeventstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/podevents"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// Events are stored at /pod_events/<node>/<unix nanoseconds>-<pod id>, so
+// that a node's events are listed in the order they happened
+const podEventTree = "pod_events"
+
+type KV interface {
+	List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+	Put(p *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error)
+	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+var _ KV = &api.KV{}
+
+type ConsulStore struct {
+	kv KV
+}
+
+func NewConsul(client consulutil.ConsulClient) ConsulStore {
+	return ConsulStore{
+		kv: client.KV(),
+	}
+}
+
+// Record stores an event
+func (s ConsulStore) Record(event podevents.Event) error {
+	key, err := eventPath(event)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(event)
+	if err != nil {
+		return util.Errorf("Could not marshal pod event as JSON: %s", err)
+	}
+	_, err = s.kv.Put(&api.KVPair{Key: key, Value: value}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+// List returns the events of a node, oldest first
+func (s ConsulStore) List(node types.NodeName) ([]podevents.Event, error) {
+	prefix := nodePath(node) + "/"
+	listed, _, err := s.kv.List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+	sort.Sort(byKey(listed))
+	events := make([]podevents.Event, 0, len(listed))
+	for _, kvp := range listed {
+		event, err := kvpToEvent(kvp)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Watch sends the events of a node, oldest first, each time one is recorded.
+// Events that can't be read are reported on the error channel and left out.
+func (s ConsulStore) Watch(node types.NodeName, quit <-chan struct{}) (<-chan []podevents.Event, <-chan error) {
+	inCh := make(chan api.KVPairs)
+	outCh := make(chan []podevents.Event)
+	errCh := make(chan error)
+	go consulutil.WatchPrefix(nodePath(node)+"/", s.kv, inCh, quit, errCh, 0)
+
+	go func() {
+		defer close(outCh)
+		for listed := range inCh {
+			events := make([]podevents.Event, 0, len(listed))
+			for _, kvp := range listed {
+				event, err := kvpToEvent(kvp)
+				if err != nil {
+					select {
+					case errCh <- err:
+					case <-quit:
+						return
+					}
+					continue
+				}
+				events = append(events, event)
+			}
+			select {
+			case outCh <- events:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return outCh, errCh
+}
+
+// DeleteBefore removes the events of a node that happened before the given
+// time
+func (s ConsulStore) DeleteBefore(node types.NodeName, before time.Time) error {
+	prefix := nodePath(node) + "/"
+	listed, _, err := s.kv.List(prefix, nil)
+	if err != nil {
+		return consulutil.NewKVError("list", prefix, err)
+	}
+	// keys sort by time
+	oldest := prefix + timeKey(before)
+	for _, kvp := range listed {
+		if kvp.Key >= oldest {
+			continue
+		}
+		_, err = s.kv.Delete(kvp.Key, nil)
+		if err != nil {
+			return consulutil.NewKVError("delete", kvp.Key, err)
+		}
+	}
+	return nil
+}
+
+func nodePath(node types.NodeName) string {
+	return path.Join(podEventTree, node.String())
+}
+
+func eventPath(event podevents.Event) (string, error) {
+	if event.Node == "" {
+		return "", util.Errorf("node not specified when computing pod event path")
+	}
+	if event.PodID == "" {
+		return "", util.Errorf("pod ID not specified when computing pod event path")
+	}
+	name := fmt.Sprintf("%s-%s", timeKey(event.Time), event.PodID)
+	if event.PodUniqueKey != "" {
+		name = fmt.Sprintf("%s-%s", name, event.PodUniqueKey)
+	}
+	return path.Join(nodePath(event.Node), name), nil
+}
+
+// timeKey is zero-padded so that keys sort by time
+func timeKey(t time.Time) string {
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+type byKey api.KVPairs
+
+func (b byKey) Len() int           { return len(b) }
+func (b byKey) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byKey) Less(i, j int) bool { return b[i].Key < b[j].Key }
+
+func kvpToEvent(kvp *api.KVPair) (podevents.Event, error) {
+	var event podevents.Event
+	err := json.Unmarshal(kvp.Value, &event)
+	if err != nil {
+		return podevents.Event{}, util.Errorf("Unable to unmarshal %s as a pod event: %s", kvp.Key, err)
+	}
+	return event, nil
+}
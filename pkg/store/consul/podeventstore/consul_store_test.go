@@ -0,0 +1,43 @@
+package podeventstore
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/podevents"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestRecordListAndDeleteBefore(t *testing.T) {
+	store := NewConsul(consulutil.NewFakeClient())
+	start := time.Unix(1500000000, 0)
+	for i, eventType := range []podevents.Type{podevents.InstallStarted, podevents.InstallSucceeded, podevents.Launched} {
+		err := store.Record(podevents.Event{
+			Node:  "node1",
+			PodID: "some_pod",
+			Type:  eventType,
+			Time:  start.Add(time.Duration(i) * time.Second),
+		})
+		Assert(t).IsNil(err, "should have recorded the event")
+	}
+	err := store.Record(podevents.Event{Node: "node2", PodID: "some_pod", Type: podevents.Halted, Time: start})
+	Assert(t).IsNil(err, "should have recorded the event")
+
+	events, err := store.List("node1")
+	Assert(t).IsNil(err, "should have listed events")
+	Assert(t).AreEqual(len(events), 3, "should have only listed the node's events")
+	Assert(t).AreEqual(events[0].Type, podevents.InstallStarted, "events should be listed oldest first")
+	Assert(t).AreEqual(events[2].Type, podevents.Launched, "events should be listed oldest first")
+
+	err = store.DeleteBefore("node1", start.Add(time.Second))
+	Assert(t).IsNil(err, "should have deleted old events")
+	events, err = store.List("node1")
+	Assert(t).IsNil(err, "should have listed events")
+	Assert(t).AreEqual(len(events), 2, "should have deleted the event before the time")
+	Assert(t).AreEqual(events[0].Type, podevents.InstallSucceeded, "should have kept the event at the time")
+
+	err = store.Record(podevents.Event{Node: "node1", Type: podevents.Halted, Time: start})
+	Assert(t).IsNotNil(err, "should have required a pod ID")
+}
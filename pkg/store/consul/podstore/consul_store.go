@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"path"
 	"sync"
+	"time"
 
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/store/consul/consulutil"
@@ -166,6 +167,7 @@ func (c *consulStore) Schedule(manifest manifest.Manifest, node types.NodeName)
 	indexPair := &api.KVPair{
 		Key:   intentIndexPath,
 		Value: indexBytes,
+		Flags: consulutil.WriteTimeFlags(time.Now()),
 	}
 	_, err = c.consulKV.Put(indexPair, nil)
 	if err != nil {
@@ -277,6 +279,11 @@ func (n NoPod) Error() string {
 	return fmt.Sprintf("Pod '%s' does not exist", n.key)
 }
 
+// NotFound lets consulutil.IsNotFound recognize the error
+func (n NoPod) NotFound() bool {
+	return true
+}
+
 func NoPodError(key types.PodUniqueKey) NoPod {
 	return NoPod{
 		key: key,
@@ -81,6 +81,8 @@ type ConsulStore struct {
 	labeler RCLabeler
 	kv      consulKV
 	retries int
+	// recorded in the history of the RCs it changes
+	actor string
 }
 
 // TODO: combine with similar CASError type in pkg/labels
@@ -90,6 +92,11 @@ func (e CASError) Error() string {
 	return fmt.Sprintf("Could not check-and-set key %q", string(e))
 }
 
+// CASConflict lets consulutil.IsCASConflict recognize the error
+func (e CASError) CASConflict() bool {
+	return true
+}
+
 type RCLabeler interface {
 	SetLabels(labelType labels.Type, id string, labels map[string]string) error
 	RemoveAllLabels(labelType labels.Type, id string) error
@@ -101,6 +108,7 @@ func NewConsul(client consulutil.ConsulClient, labeler RCLabeler, retries int) *
 		retries: retries,
 		labeler: labeler,
 		kv:      client.KV(),
+		actor:   labels.DefaultActor(),
 	}
 }
 
@@ -193,17 +201,26 @@ func (s *ConsulStore) innerCreate(manifest manifest.Manifest, nodeSelector klabe
 	if err != nil {
 		return fields.RC{}, util.Errorf("Could not marshal RC as json: %s", err)
 	}
-	success, _, err := s.kv.CAS(&api.KVPair{
-		Key:   rcp,
-		Value: jsonRC,
-		// the chance of the UUID already existing is vanishingly small, but
-		// technically not impossible, so we should use the CAS index to guard
-		// against duplicate UUIDs
-		ModifyIndex: 0,
-	}, nil)
+	revisionOp, err := s.revisionTxnOp(rc, 1, false)
+	if err != nil {
+		return fields.RC{}, err
+	}
+	ops := api.KVTxnOps{
+		{
+			Verb:  api.KVCAS,
+			Key:   rcp,
+			Value: jsonRC,
+			// the chance of the UUID already existing is vanishingly
+			// small, but technically not impossible, so we should use
+			// the CAS index to guard against duplicate UUIDs
+			Index: 0,
+		},
+		revisionOp,
+	}
+	success, _, _, err := s.kv.Txn(ops, nil)
 
 	if err != nil {
-		return fields.RC{}, consulutil.NewKVError("cas", rcp, err)
+		return fields.RC{}, consulutil.NewKVError("txn", rcp, err)
 	}
 	if !success {
 		return fields.RC{}, CASError(rcp)
@@ -246,6 +263,15 @@ func (s *ConsulStore) innerCreateTxn(ctx context.Context, manifest manifest.Mani
 		return fields.RC{}, err
 	}
 
+	revisionOp, err := s.revisionTxnOp(rc, 1, false)
+	if err != nil {
+		return fields.RC{}, err
+	}
+	err = transaction.Add(ctx, *revisionOp)
+	if err != nil {
+		return fields.RC{}, err
+	}
+
 	return rc, nil
 }
 
@@ -659,6 +685,19 @@ func (s *ConsulStore) UpdateManifest(id fields.ID, man manifest.Manifest) error
 	return s.retryMutate(id, manifestUpdater)
 }
 
+// SetStrategy sets the node selection strategy of the RC at the given ID
+func (s *ConsulStore) SetStrategy(id fields.ID, strategy fields.Strategy) error {
+	err := strategy.Validate()
+	if err != nil {
+		return err
+	}
+	strategyUpdater := func(rc fields.RC) (fields.RC, error) {
+		rc.Strategy = strategy
+		return rc, nil
+	}
+	return s.retryMutate(id, strategyUpdater)
+}
+
 // TODO: this function is almost a verbatim copy of pkg/labels retryMutate, can
 // we find some way to combine them?
 func (s *ConsulStore) retryMutate(id fields.ID, mutator func(fields.RC) (fields.RC, error)) error {
@@ -696,12 +735,7 @@ func (s *ConsulStore) mutateRc(id fields.ID, mutator func(fields.RC) (fields.RC,
 	if err != nil {
 		return err
 	}
-	newKVP := &api.KVPair{
-		Key:         rcp,
-		ModifyIndex: meta.LastIndex,
-	}
-
-	var success bool
+	var ops api.KVTxnOps
 	newRC, err := mutator(rc)
 	if err != nil {
 		return err
@@ -718,22 +752,38 @@ func (s *ConsulStore) mutateRc(id fields.ID, mutator func(fields.RC) (fields.RC,
 			return err
 		}
 
-		success, _, err = s.kv.DeleteCAS(newKVP, nil)
+		historyOps, err := s.historyTxnOps(rc, true)
 		if err != nil {
-			return consulutil.NewKVError("delete-cas", newKVP.Key, err)
+			return err
 		}
+		ops = append(api.KVTxnOps{{
+			Verb:  api.KVDeleteCAS,
+			Key:   rcp,
+			Index: meta.LastIndex,
+		}}, historyOps...)
 	} else {
 		b, err := json.Marshal(newRC)
 		if err != nil {
 			return util.Errorf("Could not marshal RC as JSON: %s", err)
 		}
-		newKVP.Value = b
-		success, _, err = s.kv.CAS(newKVP, nil)
+		historyOps, err := s.historyTxnOps(newRC, false)
 		if err != nil {
-			return consulutil.NewKVError("cas", newKVP.Key, err)
+			return err
 		}
+		ops = append(api.KVTxnOps{{
+			Verb:  api.KVCAS,
+			Key:   rcp,
+			Value: b,
+			Index: meta.LastIndex,
+		}}, historyOps...)
 	}
 
+	// the RC and its history are changed together, so that every change
+	// is recorded
+	success, _, _, err := s.kv.Txn(ops, nil)
+	if err != nil {
+		return consulutil.NewKVError("txn", rcp, err)
+	}
 	if !success {
 		return CASError(rcp)
 	}
@@ -991,6 +1041,13 @@ func (s *ConsulStore) TransferReplicaCounts(req TransferReplicaCountsRequest) er
 			Index: toRCIndex,
 		},
 	}
+	for _, changed := range []fields.RC{fromRC, toRC} {
+		historyOps, err := s.historyTxnOps(changed, false)
+		if err != nil {
+			return util.Errorf("couldn't transfer replica counts: %s", err)
+		}
+		ops = append(ops, historyOps...)
+	}
 
 	ok, resp, _, err := s.kv.Txn(ops, nil)
 	if err != nil {
@@ -0,0 +1,216 @@
+package rcstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+)
+
+// The revisions of each RC are stored at /rc_history/<rc id>/<number>,
+// outside of rcTree so that they aren't read when listing RCs. They are kept
+// after the RC is deleted, so that it can still be inspected.
+const rcHistoryTree = "rc_history"
+
+// MaxRevisions is the number of revisions kept for each RC. Older revisions are
+// discarded.
+const MaxRevisions = 100
+
+// Revision records the state of an RC after one change to it
+type Revision struct {
+	// Number counts the changes to the RC, starting from 1 for its creation
+	Number int       `json:"number"`
+	Time   time.Time `json:"time"`
+	// Actor identifies what made the change, see labels.DefaultActor()
+	Actor string `json:"actor"`
+	// Deleted is set on the revision that records the RC's deletion, whose
+	// RC is the last state of the RC
+	Deleted bool      `json:"deleted,omitempty"`
+	RC      fields.RC `json:"rc"`
+}
+
+// NoRevision is returned when an RC has no revision with the requested number
+var NoRevision = fmt.Errorf("No such revision of the replication controller")
+
+// SetActor sets how the changes made through the store are attributed in RC
+// history. It defaults to labels.DefaultActor().
+func (s *ConsulStore) SetActor(actor string) {
+	s.actor = actor
+}
+
+// Revisions returns the last MaxRevisions revisions of the RC, oldest first
+func (s *ConsulStore) Revisions(id fields.ID) ([]Revision, error) {
+	prefix, err := historyPath(id)
+	if err != nil {
+		return nil, err
+	}
+	listed, _, err := s.kv.List(prefix+"/", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+
+	revisions := make([]Revision, 0, len(listed))
+	for _, kvp := range listed {
+		var revision Revision
+		err = json.Unmarshal(kvp.Value, &revision)
+		if err != nil {
+			return nil, util.Errorf("Malformed RC revision at %s: %s", kvp.Key, err)
+		}
+		revisions = append(revisions, revision)
+	}
+	sort.Sort(revisionsByNumber(revisions))
+	return revisions, nil
+}
+
+// GetRevision returns one revision of the RC. Returns NoRevision if it doesn't
+// exist or has been discarded.
+func (s *ConsulStore) GetRevision(id fields.ID, number int) (Revision, error) {
+	key, err := revisionPath(id, number)
+	if err != nil {
+		return Revision{}, err
+	}
+	kvp, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return Revision{}, consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return Revision{}, NoRevision
+	}
+
+	var revision Revision
+	err = json.Unmarshal(kvp.Value, &revision)
+	if err != nil {
+		return Revision{}, util.Errorf("Malformed RC revision at %s: %s", key, err)
+	}
+	return revision, nil
+}
+
+// Restore sets the manifest, node selector, pod labels, replica count and
+// strategy of the RC back to those of one of its revisions, which is recorded
+// as a new revision. The disabled flag is left alone, since it is managed by
+// rolling updates. The RC must not have been deleted.
+func (s *ConsulStore) Restore(id fields.ID, number int) error {
+	revision, err := s.GetRevision(id, number)
+	if err != nil {
+		return err
+	}
+	return s.retryMutate(id, func(rc fields.RC) (fields.RC, error) {
+		restored := revision.RC
+		restored.ID = rc.ID
+		restored.Disabled = rc.Disabled
+		return restored, nil
+	})
+}
+
+// historyTxnOps returns the transaction operations that record rc as the next
+// revision of its history, and discard revisions beyond MaxRevisions. The next
+// revision is created with a check-and-set, so that concurrent changes fail
+// the transaction instead of overwriting each other's revisions.
+func (s *ConsulStore) historyTxnOps(rc fields.RC, deleted bool) (api.KVTxnOps, error) {
+	numbers, err := s.revisionNumbers(rc.ID)
+	if err != nil {
+		return nil, err
+	}
+	next := 1
+	if len(numbers) > 0 {
+		next = numbers[len(numbers)-1] + 1
+	}
+
+	op, err := s.revisionTxnOp(rc, next, deleted)
+	if err != nil {
+		return nil, err
+	}
+	ops := api.KVTxnOps{op}
+	for _, number := range numbers {
+		if number > next-MaxRevisions {
+			break
+		}
+		key, err := revisionPath(rc.ID, number)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, &api.KVTxnOp{
+			Verb: api.KVDelete,
+			Key:  key,
+		})
+	}
+	return ops, nil
+}
+
+// revisionTxnOp returns the transaction operation that creates a revision,
+// failing if it already exists
+func (s *ConsulStore) revisionTxnOp(rc fields.RC, number int, deleted bool) (*api.KVTxnOp, error) {
+	key, err := revisionPath(rc.ID, number)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(Revision{
+		Number:  number,
+		Time:    time.Now(),
+		Actor:   s.actor,
+		Deleted: deleted,
+		RC:      rc,
+	})
+	if err != nil {
+		return nil, util.Errorf("Could not marshal RC revision as JSON: %s", err)
+	}
+	return &api.KVTxnOp{
+		Verb:  api.KVCAS,
+		Key:   key,
+		Value: value,
+		Index: 0,
+	}, nil
+}
+
+// revisionNumbers returns the numbers of the RC's revisions, in order
+func (s *ConsulStore) revisionNumbers(id fields.ID) ([]int, error) {
+	prefix, err := historyPath(id)
+	if err != nil {
+		return nil, err
+	}
+	keys, _, err := s.kv.Keys(prefix+"/", "", nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("keys", prefix, err)
+	}
+
+	numbers := make([]int, 0, len(keys))
+	for _, key := range keys {
+		number, err := strconv.Atoi(path.Base(key))
+		if err != nil {
+			return nil, util.Errorf("Malformed RC revision key %s", key)
+		}
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+func historyPath(id fields.ID) (string, error) {
+	if id == "" {
+		return "", util.Errorf("History path requested for empty RC id")
+	}
+	return path.Join(rcHistoryTree, id.String()), nil
+}
+
+func revisionPath(id fields.ID, number int) (string, error) {
+	prefix, err := historyPath(id)
+	if err != nil {
+		return "", err
+	}
+	// padded so that the revisions sort by number
+	return path.Join(prefix, fmt.Sprintf("%010d", number)), nil
+}
+
+type revisionsByNumber []Revision
+
+func (r revisionsByNumber) Len() int           { return len(r) }
+func (r revisionsByNumber) Less(i, j int) bool { return r[i].Number < r[j].Number }
+func (r revisionsByNumber) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
@@ -81,6 +81,84 @@ func TestCreateTxn(t *testing.T) {
 	}
 }
 
+func TestHistory(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+
+	applicator := labels.NewConsulApplicator(fixture.Client, 0)
+	store := NewConsul(fixture.Client, applicator, 0)
+	store.SetActor("tester")
+
+	rc, err := store.Create(testManifest(), klabels.Everything(), "some_az", "some_cn", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SetDesiredReplicas(rc.ID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SetDesiredReplicas(rc.ID, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revisions, err := store.Revisions(rc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("expected a revision for the creation and each change, got %d", len(revisions))
+	}
+	for i, revision := range revisions {
+		if revision.Number != i+1 {
+			t.Errorf("expected revision %d to be numbered %d, was %d", i, i+1, revision.Number)
+		}
+		if revision.Actor != "tester" {
+			t.Errorf("expected revision to be made by %q, was %q", "tester", revision.Actor)
+		}
+	}
+	if revisions[2].RC.ReplicasDesired != 5 {
+		t.Errorf("expected the last revision to have 5 replicas, had %d", revisions[2].RC.ReplicasDesired)
+	}
+
+	diff, err := revisions[0].RC.Diff(revisions[2].RC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 1 || diff[0] != `replicas_desired: "0" -> "5"` {
+		t.Errorf("expected only the replica count to differ, got %q", diff)
+	}
+
+	err = store.Restore(rc.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := store.Get(rc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.ReplicasDesired != 3 {
+		t.Errorf("expected the restored RC to have 3 replicas, had %d", restored.ReplicasDesired)
+	}
+
+	err = store.Delete(rc.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisions, err = store.Revisions(rc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 5 || !revisions[4].Deleted {
+		t.Errorf("expected the restore and deletion to be recorded, got %d revisions", len(revisions))
+	}
+
+	_, err = store.GetRevision(rc.ID, 6)
+	if err != NoRevision {
+		t.Errorf("expected NoRevision getting a revision that doesn't exist, got %v", err)
+	}
+}
+
 func testManifest() manifest.Manifest {
 	builder := manifest.NewBuilder()
 	builder.SetID("some_pod_id")
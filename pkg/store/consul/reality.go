@@ -0,0 +1,178 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// The deploy metadata of a legacy pod is stored at
+// reality_metadata/<node>/<pod id>, next to the pod's manifest in the reality
+// tree, which must remain a bare manifest for existing readers.
+const REALITY_METADATA_TREE = "reality_metadata"
+
+// RealityMetadata describes how the manifest in the reality tree was deployed
+// by the preparer
+type RealityMetadata struct {
+	// InstallTime is when the preparer installed and launched the manifest
+	InstallTime time.Time `json:"install_time"`
+	// LastRestart is when the pod's services were last restarted. It is
+	// carried over from the previous record when a deploy only reloaded
+	// the pod's config.
+	LastRestart time.Time `json:"last_restart"`
+	// ArtifactDigests are the sha256 digests of the artifacts that were
+	// installed for the manifest
+	ArtifactDigests []string `json:"artifact_digests,omitempty"`
+	// PreparerVersion is the version of the preparer that deployed the
+	// manifest
+	PreparerVersion string `json:"preparer_version"`
+	// Ports are the ports allocated to the manifest's launchables that
+	// requested an auto port
+	Ports map[launch.LaunchableID]int `json:"ports,omitempty"`
+}
+
+// StatusPort returns the port that the status of manifest is checked on,
+// which is the port allocated to its status port launchable if it has one.
+// It returns 0 if the manifest has no status port.
+func (m RealityMetadata) StatusPort(manifest manifest.Manifest) int {
+	if launchableID := manifest.GetStatusPortLaunchable(); launchableID != "" {
+		return m.Ports[launchableID]
+	}
+	return manifest.GetStatusPort()
+}
+
+// HasArtifact returns whether the artifact with the given sha256 digest was
+// installed for the manifest
+func (m RealityMetadata) HasArtifact(digest string) bool {
+	for _, installed := range m.ArtifactDigests {
+		if installed == digest {
+			return true
+		}
+	}
+	return false
+}
+
+// RealityMetadataResult is the deploy metadata of a pod on a node
+type RealityMetadataResult struct {
+	Node     types.NodeName
+	PodID    types.PodID
+	Metadata RealityMetadata
+}
+
+func realityMetadataPath(node types.NodeName, podID types.PodID) (string, error) {
+	podPath, err := podPath(REALITY_TREE, node, podID)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(REALITY_METADATA_TREE, strings.TrimPrefix(podPath, REALITY_TREE.String()+"/")), nil
+}
+
+// SetRealityWithMetadata writes manifest to the reality tree of node along
+// with its deploy metadata, in one transaction
+func (c consulStore) SetRealityWithMetadata(node types.NodeName, manifest manifest.Manifest, metadata RealityMetadata) error {
+	key, err := realityMetadataPath(node, manifest.ID())
+	if err != nil {
+		return err
+	}
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return util.Errorf("Could not marshal reality metadata for %s: %s", manifest.ID(), err)
+	}
+
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err = c.SetPodTxn(ctx, REALITY_TREE, node, manifest)
+	if err != nil {
+		return err
+	}
+	err = transaction.Add(ctx, api.KVTxnOp{
+		Verb:  string(api.KVSet),
+		Key:   key,
+		Value: metadataBytes,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = transaction.MustCommit(ctx, c.client.KV())
+	if err != nil {
+		return util.Errorf("Could not write %s to the reality tree of %s: %s", manifest.ID(), node, err)
+	}
+	return nil
+}
+
+// RealityMetadata reads the deploy metadata of a pod in the reality tree of
+// node. A pod written without metadata returns consulutil.NotFoundError.
+func (c consulStore) RealityMetadata(node types.NodeName, podID types.PodID) (RealityMetadata, error) {
+	key, err := realityMetadataPath(node, podID)
+	if err != nil {
+		return RealityMetadata{}, err
+	}
+	pair, _, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return RealityMetadata{}, consulutil.NewKVError("get", key, err)
+	}
+	if pair == nil {
+		return RealityMetadata{}, consulutil.NotFoundError{Key: key}
+	}
+
+	var metadata RealityMetadata
+	err = json.Unmarshal(pair.Value, &metadata)
+	if err != nil {
+		return RealityMetadata{}, util.Errorf("Could not parse reality metadata at %s: %s", key, err)
+	}
+	return metadata, nil
+}
+
+// ListRealityMetadata reads the deploy metadata of every pod in the reality
+// tree of node
+func (c consulStore) ListRealityMetadata(node types.NodeName) ([]RealityMetadataResult, error) {
+	if node == "" {
+		return nil, util.Errorf("nodeName not specified when listing reality metadata")
+	}
+	return c.listRealityMetadata(path.Join(REALITY_METADATA_TREE, node.String()) + "/")
+}
+
+// AllRealityMetadata reads the deploy metadata of every pod on every node,
+// for fleet-wide queries such as which nodes still run an artifact
+func (c consulStore) AllRealityMetadata() ([]RealityMetadataResult, error) {
+	return c.listRealityMetadata(REALITY_METADATA_TREE + "/")
+}
+
+func (c consulStore) listRealityMetadata(prefix string) ([]RealityMetadataResult, error) {
+	pairs, _, err := c.client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+
+	var ret []RealityMetadataResult
+	for _, pair := range pairs {
+		keyParts := strings.Split(pair.Key, "/")
+		if len(keyParts) != 3 {
+			continue
+		}
+		var metadata RealityMetadata
+		err = json.Unmarshal(pair.Value, &metadata)
+		if err != nil {
+			// Just list all the records that we can
+			continue
+		}
+		ret = append(ret, RealityMetadataResult{
+			Node:     types.NodeName(keyParts[1]),
+			PodID:    types.PodID(keyParts[2]),
+			Metadata: metadata,
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,70 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestRealityMetadata(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	installed := time.Now().Round(time.Second)
+	for node, digest := range map[types.NodeName]string{"node1": "abc", "node2": "def"} {
+		err := f.Store.SetRealityWithMetadata(node, testManifest("some_pod"), RealityMetadata{
+			InstallTime:     installed,
+			LastRestart:     installed,
+			ArtifactDigests: []string{digest},
+			PreparerVersion: "1.2.3",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := f.Store.Pod(REALITY_TREE, "node1", "some_pod"); err != nil {
+		t.Fatalf("expected the manifest to be written to the reality tree: %s", err)
+	}
+	metadata, err := f.Store.RealityMetadata("node1", "some_pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metadata.InstallTime.Equal(installed) || metadata.PreparerVersion != "1.2.3" || !metadata.HasArtifact("abc") {
+		t.Errorf("unexpected metadata read back: %+v", metadata)
+	}
+
+	all, err := f.Store.AllRealityMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var running []types.NodeName
+	for _, result := range all {
+		if result.Metadata.HasArtifact("def") {
+			running = append(running, result.Node)
+		}
+	}
+	if len(running) != 1 || running[0] != "node2" {
+		t.Errorf("expected only node2 to run artifact def, got %v", running)
+	}
+
+	_, err = f.Store.DeletePod(REALITY_TREE, "node1", "some_pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Store.RealityMetadata("node1", "some_pod")
+	if !consulutil.IsNotFound(err) {
+		t.Errorf("expected deleting the pod from reality to delete its metadata, got %v", err)
+	}
+	listed, err := f.Store.ListRealityMetadata("node2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].PodID != "some_pod" {
+		t.Errorf("expected node2's metadata to remain, got %+v", listed)
+	}
+}
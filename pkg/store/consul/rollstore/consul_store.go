@@ -504,6 +504,96 @@ func (s ConsulStore) Delete(ctx context.Context, id roll_fields.ID) error {
 	return nil
 }
 
+// ConfirmCanary records that an operator confirmed that the rolling update may
+// proceed past its canary phase. It is an error if the update has no canary.
+func (s ConsulStore) ConfirmCanary(id roll_fields.ID) error {
+	return s.modify(id, func(ru *roll_fields.Update) error {
+		if ru.Canary == nil {
+			return util.Errorf("Rolling update %s has no canary to confirm", id)
+		}
+		ru.Canary.Confirmed = true
+		return nil
+	})
+}
+
+// SetControl sets the control of the rolling update, which pauses, resumes
+// or aborts it. Once aborted, an update's control can't be changed.
+func (s ConsulStore) SetControl(id roll_fields.ID, control roll_fields.Control) error {
+	switch control {
+	case roll_fields.ControlNone, roll_fields.ControlPause, roll_fields.ControlAbort:
+	default:
+		return util.Errorf("Unknown rolling update control %q", control)
+	}
+	return s.modify(id, func(ru *roll_fields.Update) error {
+		if ru.Control == roll_fields.ControlAbort && control != roll_fields.ControlAbort {
+			return util.Errorf("Rolling update %s was aborted", id)
+		}
+		ru.Control = control
+		return nil
+	})
+}
+
+// modify applies f to the rolling update's record, failing if the record was
+// changed concurrently
+func (s ConsulStore) modify(id roll_fields.ID, f func(*roll_fields.Update) error) error {
+	key, err := RollPath(id)
+	if err != nil {
+		return err
+	}
+
+	kvp, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("get", key, err)
+	}
+	if kvp == nil {
+		return util.Errorf("No rolling update with ID %s", id)
+	}
+	ru, err := kvpToRU(kvp)
+	if err != nil {
+		return err
+	}
+
+	err = f(&ru)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(ru)
+	if err != nil {
+		return err
+	}
+	success, _, err := s.kv.CAS(&api.KVPair{
+		Key:         key,
+		Value:       b,
+		ModifyIndex: kvp.ModifyIndex,
+	}, nil)
+	if err != nil {
+		return consulutil.NewKVError("cas", key, err)
+	}
+	if !success {
+		return util.Errorf("Rolling update %s was modified concurrently, try again", id)
+	}
+	return nil
+}
+
+// CanaryConfirmed returns whether the rolling update's canary was confirmed
+// with ConfirmCanary
+func (s ConsulStore) CanaryConfirmed(id roll_fields.ID) (bool, error) {
+	ru, err := s.Get(id)
+	if err != nil {
+		return false, err
+	}
+	return ru.Canary != nil && ru.Canary.Confirmed, nil
+}
+
+// Control returns the control set on the rolling update with SetControl
+func (s ConsulStore) Control(id roll_fields.ID) (roll_fields.Control, error) {
+	ru, err := s.Get(id)
+	if err != nil {
+		return roll_fields.ControlNone, err
+	}
+	return ru.Control, nil
+}
+
 // Lock takes a lock on a rolling update by ID. Before taking ownership of an
 // Update, its new RC ID, and old RC ID if any, should both be locked. If the
 // error return is nil, then the boolean indicates whether the lock was
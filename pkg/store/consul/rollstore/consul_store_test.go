@@ -134,6 +134,65 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestConfirmCanary(t *testing.T) {
+	u := testRollValue(testRCId)
+	rollstore, _ := newRollStoreWithFakeConsul(t, []fields.Update{u})
+	err := rollstore.ConfirmCanary(fields.ID(testRCId))
+	if err == nil {
+		t.Fatal("Expected an error confirming the canary of an update without one")
+	}
+
+	u.Canary = &fields.Canary{Replicas: 1, RequireConfirmation: true}
+	rollstore, _ = newRollStoreWithFakeConsul(t, []fields.Update{u})
+	confirmed, err := rollstore.CanaryConfirmed(fields.ID(testRCId))
+	if err != nil {
+		t.Fatalf("Unexpected error checking canary confirmation: %s", err)
+	}
+	if confirmed {
+		t.Error("Expected the canary to not be confirmed yet")
+	}
+
+	err = rollstore.ConfirmCanary(fields.ID(testRCId))
+	if err != nil {
+		t.Fatalf("Unexpected error confirming canary: %s", err)
+	}
+	confirmed, err = rollstore.CanaryConfirmed(fields.ID(testRCId))
+	if err != nil {
+		t.Fatalf("Unexpected error checking canary confirmation: %s", err)
+	}
+	if !confirmed {
+		t.Error("Expected the canary to be confirmed")
+	}
+}
+
+func TestSetControl(t *testing.T) {
+	rollstore, _ := newRollStoreWithFakeConsul(t, []fields.Update{testRollValue(testRCId)})
+	id := fields.ID(testRCId)
+
+	for _, control := range []fields.Control{fields.ControlPause, fields.ControlNone, fields.ControlAbort} {
+		err := rollstore.SetControl(id, control)
+		if err != nil {
+			t.Fatalf("Unexpected error setting control %q: %s", control, err)
+		}
+		got, err := rollstore.Control(id)
+		if err != nil {
+			t.Fatalf("Unexpected error reading control: %s", err)
+		}
+		if got != control {
+			t.Errorf("Expected control %q, was %q", control, got)
+		}
+	}
+
+	err := rollstore.SetControl(id, fields.ControlNone)
+	if err == nil {
+		t.Error("Expected an error resuming an aborted update")
+	}
+	err = rollstore.SetControl(id, fields.Control("stop"))
+	if err == nil {
+		t.Error("Expected an error setting an unknown control")
+	}
+}
+
 func TestList(t *testing.T) {
 	entries := []fields.Update{testRollValue(testRCId), testRollValue(testRCId2)}
 	rollstore, _ := newRollStoreWithFakeConsul(t, entries)
@@ -0,0 +1,136 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// PodLabeler is the part of labels.ApplicatorWithoutWatches used to change a
+// pod's labels in the same transaction as its intent
+type PodLabeler interface {
+	SetLabelsTxn(ctx context.Context, labelType labels.Type, id string, labels map[string]string) error
+	RemoveAllLabelsTxn(ctx context.Context, labelType labels.Type, id string) error
+}
+
+// AuditLogger is the part of auditlogstore.ConsulStore used to record a
+// schedule in the same transaction as the pod's intent
+type AuditLogger interface {
+	Create(ctx context.Context, eventType audit.EventType, eventDetails json.RawMessage) error
+}
+
+// SchedulePodTxn adds the operations that write manifest to the intent tree
+// of node and set podLabels on the pod to the transaction in ctx, so that a
+// pod is never in the intent tree without its labels, where it would be
+// invisible to label selectors.
+func (c consulStore) SchedulePodTxn(
+	ctx context.Context,
+	labeler PodLabeler,
+	node types.NodeName,
+	manifest manifest.Manifest,
+	podLabels map[string]string,
+) error {
+	err := c.SetPodTxn(ctx, INTENT_TREE, node, manifest)
+	if err != nil {
+		return err
+	}
+	if len(podLabels) == 0 {
+		return nil
+	}
+	return labeler.SetLabelsTxn(ctx, labels.POD, labels.MakePodLabelKey(node, manifest.ID()), podLabels)
+}
+
+// UnschedulePodTxn adds the operations that delete the pod from the intent
+// tree of node and remove all of its labels to the transaction in ctx
+func (c consulStore) UnschedulePodTxn(
+	ctx context.Context,
+	labeler PodLabeler,
+	node types.NodeName,
+	podID types.PodID,
+) error {
+	err := c.DeletePodTxn(ctx, INTENT_TREE, node, podID)
+	if err != nil {
+		return err
+	}
+	return labeler.RemoveAllLabelsTxn(ctx, labels.POD, labels.MakePodLabelKey(node, podID))
+}
+
+// SchedulePod atomically writes manifest to the intent tree of node and sets
+// podLabels on the pod. If auditLogger is not nil, a PodScheduledEvent
+// record crediting user is written in the same transaction. Either
+// everything is written or nothing is.
+func (c consulStore) SchedulePod(
+	labeler PodLabeler,
+	auditLogger AuditLogger,
+	node types.NodeName,
+	manifest manifest.Manifest,
+	podLabels map[string]string,
+	user string,
+) error {
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+
+	err := c.SchedulePodTxn(ctx, labeler, node, manifest, podLabels)
+	if err != nil {
+		return err
+	}
+
+	if auditLogger != nil {
+		details, err := audit.NewPodScheduledEventDetails(node, manifest, podLabels, user)
+		if err != nil {
+			return err
+		}
+		err = auditLogger.Create(ctx, audit.PodScheduledEvent, details)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = transaction.MustCommit(ctx, c.client.KV())
+	if err != nil {
+		return util.Errorf("Could not schedule %s on %s: %s", manifest.ID(), node, err)
+	}
+	return nil
+}
+
+// UnschedulePod atomically deletes the pod from the intent tree of node and
+// removes its labels, writing a PodUnscheduledEvent record crediting user in
+// the same transaction if auditLogger is not nil
+func (c consulStore) UnschedulePod(
+	labeler PodLabeler,
+	auditLogger AuditLogger,
+	node types.NodeName,
+	podID types.PodID,
+	user string,
+) error {
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+
+	err := c.UnschedulePodTxn(ctx, labeler, node, podID)
+	if err != nil {
+		return err
+	}
+
+	if auditLogger != nil {
+		details, err := audit.NewPodUnscheduledEventDetails(node, podID, user)
+		if err != nil {
+			return err
+		}
+		err = auditLogger.Create(ctx, audit.PodUnscheduledEvent, details)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = transaction.MustCommit(ctx, c.client.KV())
+	if err != nil {
+		return util.Errorf("Could not unschedule %s from %s: %s", podID, node, err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// +build !race
+
+package consul
+
+import (
+	"context"
+	"testing"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/store/consul/transaction"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// failingLabeler adds an operation that rolls back the transaction instead
+// of setting labels
+type failingLabeler struct {
+	PodLabeler
+}
+
+func (failingLabeler) SetLabelsTxn(ctx context.Context, labelType labels.Type, id string, labels map[string]string) error {
+	return transaction.Add(ctx, api.KVTxnOp{
+		Verb:  string(api.KVCheckIndex),
+		Key:   "nonexistent",
+		Index: 1,
+	})
+}
+
+func TestSchedulePod(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	applicator := labels.NewConsulApplicator(f.Client, 0)
+	auditLogStore := auditlogstore.NewConsulStore(f.Client.KV())
+
+	podLabels := map[string]string{"replication_controller_id": "abc"}
+	err := f.Store.SchedulePod(applicator, auditLogStore, "some_node", testManifest("some_pod"), podLabels, "deployer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := f.Store.Pod(INTENT_TREE, "some_node", "some_pod"); err != nil {
+		t.Fatalf("expected the pod to be in the intent tree: %s", err)
+	}
+	labeled, err := applicator.GetLabels(labels.POD, labels.MakePodLabelKey("some_node", "some_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labeled.Labels.Get("replication_controller_id") != "abc" {
+		t.Errorf("expected the pod to be labeled, got %s", labeled.Labels)
+	}
+
+	records, err := auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected one audit record, got %d", len(records))
+	}
+	for _, record := range records {
+		if record.EventType != audit.PodScheduledEvent {
+			t.Errorf("expected a %s record, got %s", audit.PodScheduledEvent, record.EventType)
+		}
+	}
+
+	err = f.Store.UnschedulePod(applicator, nil, "some_node", "some_pod", "deployer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.Store.Pod(INTENT_TREE, "some_node", "some_pod"); err != pods.NoCurrentManifest {
+		t.Errorf("expected the pod to be removed from the intent tree, got %v", err)
+	}
+	labeled, err = applicator.GetLabels(labels.POD, labels.MakePodLabelKey("some_node", "some_pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labeled.Labels) != 0 {
+		t.Errorf("expected the pod's labels to be removed, got %s", labeled.Labels)
+	}
+}
+
+func TestSchedulePodRollsBackTogether(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	auditLogStore := auditlogstore.NewConsulStore(f.Client.KV())
+	err := f.Store.SchedulePod(failingLabeler{}, auditLogStore, "some_node", testManifest("some_pod"), map[string]string{"a": "b"}, "deployer")
+	if err == nil {
+		t.Fatal("expected an error when the labels could not be set")
+	}
+
+	if _, _, err := f.Store.Pod(INTENT_TREE, "some_node", "some_pod"); err != pods.NoCurrentManifest {
+		t.Errorf("expected the pod not to be written without its labels, got %v", err)
+	}
+	records, err := auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no audit records to be written, got %d", len(records))
+	}
+}
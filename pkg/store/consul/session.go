@@ -14,14 +14,23 @@ import (
 // locks on multiple keys, and must be periodically renewed.
 type Session interface {
 	Lock(key string) (consulutil.Unlocker, error)
+	// StealLock acquires the lock on key, destroying the session holding it
+	// if that session doesn't release it within its TTL
+	StealLock(key string, quit <-chan struct{}) (consulutil.Unlocker, error)
 	Renew() error
 	Destroy() error
 	Session() string
+	// Lost is closed if the session can no longer be renewed, meaning its
+	// locks may be held by others
+	Lost() <-chan struct{}
 }
 
 const (
-	lockTTL         = "15s"
+	lockTTL         = 15 * time.Second
 	renewalInterval = 10 * time.Second
+	// Renewals are spread over renewalInterval +/- renewalJitter so that
+	// sessions created together don't all renew at once
+	renewalJitter = 2 * time.Second
 
 	// Consul's minimum lock delay is 1ms. Requesting a lock delay of 0 will be
 	// interpreted as "use the default," which is 15s at this time.
@@ -34,23 +43,24 @@ func (c consulStore) NewSession(name string, renewalCh <-chan time.Time) (Sessio
 		LockDelay: lockDelay,
 		// locks should only be used with ephemeral keys
 		Behavior: api.SessionBehaviorDelete,
-		TTL:      lockTTL,
+		TTL:      lockTTL.String(),
 	}, nil)
 
 	if err != nil {
 		return consulutil.Session{}, nil, util.Errorf("Could not create session")
 	}
 
+	quitCh := make(chan struct{})
 	if renewalCh == nil {
-		renewalCh = time.NewTicker(renewalInterval).C
+		renewalCh = consulutil.JitteredTicker(renewalInterval, renewalJitter, quitCh)
 	}
 
-	quitCh := make(chan struct{})
 	renewalErrCh := make(chan error, 1)
 	consulSession := consulutil.NewManagedSession(
 		c.client,
 		session,
 		name,
+		lockTTL,
 		quitCh,
 		renewalErrCh,
 		renewalCh)
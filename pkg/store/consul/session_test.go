@@ -5,6 +5,10 @@ package consul
 import (
 	"testing"
 	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+
+	"github.com/hashicorp/consul/api"
 )
 
 const (
@@ -90,3 +94,91 @@ func TestRenewalFailsWhen404(t *testing.T) {
 		t.Errorf("Renewing a destroyed session should have failed, but it succeeded")
 	}
 }
+
+func TestLostWhenSessionInvalidated(t *testing.T) {
+	fixture := NewConsulTestFixture(t)
+	defer fixture.Close()
+
+	renewalCh := make(chan time.Time)
+	session, renewalErrCh, err := fixture.Store.NewSession(lockMessage, renewalCh)
+	if err != nil {
+		t.Fatalf("Unable to create session: %s", err)
+	}
+
+	// destroy the session from under the managed session, as consul
+	// would if its TTL passed
+	_, err = fixture.Client.Session().Destroy(session.Session(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewalCh <- time.Now()
+
+	select {
+	case <-session.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lost() should have been closed when the session was invalidated")
+	}
+	if err := <-renewalErrCh; !consulutil.IsSessionInvalidated(err) {
+		t.Errorf("Expected a SessionInvalidatedError, got %v", err)
+	}
+}
+
+func TestStealLock(t *testing.T) {
+	fixture := NewConsulTestFixture(t)
+	defer fixture.Close()
+
+	key := "some_key"
+	holder, _, err := fixture.Client.Session().CreateNoChecks(&api.SessionEntry{
+		LockDelay: time.Millisecond,
+		TTL:       "10s",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fixture.Store.NewUnmanagedSession(holder, "holder").Lock(key)
+	if err != nil {
+		t.Fatalf("Unable to acquire lock: %s", err)
+	}
+
+	session, _, err := fixture.Store.NewSession(lockMessage, make(chan time.Time))
+	if err != nil {
+		t.Fatalf("Unable to create session: %s", err)
+	}
+	defer session.Destroy()
+
+	quit := make(chan struct{})
+	close(quit)
+	_, err = session.StealLock(key, quit)
+	if !consulutil.IsAlreadyLocked(err) {
+		t.Fatalf("Expected StealLock to give up when quit was closed, got %v", err)
+	}
+
+	// a session without a TTL has no time to wait for
+	hung, _, err := fixture.Client.Session().CreateNoChecks(&api.SessionEntry{
+		LockDelay: time.Millisecond,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fixture.Client.Session().Destroy(holder, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	_, err = fixture.Store.NewUnmanagedSession(hung, "hung").Lock(key)
+	if err != nil {
+		t.Fatalf("Unable to acquire lock: %s", err)
+	}
+
+	_, err = session.StealLock(key, nil)
+	if err != nil {
+		t.Fatalf("Expected to steal the lock: %s", err)
+	}
+	holderName, _, err := fixture.Store.LockHolder(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holderName != lockMessage {
+		t.Errorf("Expected the lock to be held by %q, was held by %q", lockMessage, holderName)
+	}
+}
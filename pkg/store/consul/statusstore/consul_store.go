@@ -9,10 +9,16 @@ import (
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/transaction"
 	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
 
 	"github.com/hashicorp/consul/api"
 )
 
+// StatusCompression names the codec used to compress statuses written to
+// Consul, or "none". Statuses are decompressed when read regardless of this
+// setting, so it should only be enabled once every reader supports compression.
+var StatusCompression = param.String("status_compression", consulutil.NoCompression)
+
 type consulKV interface {
 	List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
 	Put(pair *api.KVPair, opts *api.WriteOptions) (*api.WriteMeta, error)
@@ -41,6 +47,11 @@ func (n NoStatusError) Error() string {
 	return fmt.Sprintf("No status record found at %s", n.Key)
 }
 
+// NotFound lets consulutil.IsNotFound recognize the error
+func (n NoStatusError) NotFound() bool {
+	return true
+}
+
 func IsNoStatus(err error) bool {
 	_, ok := err.(NoStatusError)
 	return ok
@@ -52,9 +63,14 @@ func (s *consulStore) SetStatus(t ResourceType, id ResourceID, namespace Namespa
 		return err
 	}
 
+	value, err := consulutil.CompressValue(*StatusCompression, status.Bytes())
+	if err != nil {
+		return err
+	}
+
 	pair := &api.KVPair{
 		Key:   key,
-		Value: status.Bytes(),
+		Value: value,
 	}
 	_, err = s.kv.Put(pair, nil)
 	if err != nil {
@@ -81,6 +97,11 @@ func (s staleIndex) Error() string {
 	return fmt.Sprintf("CAS failed for '%s', index of '%d' was stale", s.key, s.index)
 }
 
+// CASConflict lets consulutil.IsCASConflict recognize the error
+func (s staleIndex) CASConflict() bool {
+	return true
+}
+
 func IsStaleIndex(err error) bool {
 	_, ok := err.(staleIndex)
 	return ok
@@ -92,10 +113,15 @@ func (s *consulStore) CASStatus(ctx context.Context, t ResourceType, id Resource
 		return err
 	}
 
+	value, err := consulutil.CompressValue(*StatusCompression, status.Bytes())
+	if err != nil {
+		return err
+	}
+
 	return transaction.Add(ctx, api.KVTxnOp{
 		Verb:  api.KVCAS,
 		Key:   key,
-		Value: status.Bytes(),
+		Value: value,
 		Index: modifyIndex,
 	})
 }
@@ -125,7 +151,12 @@ func (s *consulStore) getStatus(t ResourceType, id ResourceID, namespace Namespa
 		return nil, queryMeta, NoStatusError{key}
 	}
 
-	return pair.Value, queryMeta, nil
+	status, err := decompressStatus(key, pair.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return status, queryMeta, nil
 }
 
 func (s *consulStore) DeleteStatus(t ResourceType, id ResourceID, namespace Namespace) error {
@@ -156,7 +187,10 @@ func (s *consulStore) GetAllStatusForResource(t ResourceType, id ResourceID) (ma
 
 	for _, pair := range pairs {
 		key := pair.Key
-		status := pair.Value
+		status, err := decompressStatus(key, pair.Value)
+		if err != nil {
+			return nil, err
+		}
 
 		_, _, namespace, err := keyParts(key)
 		if err != nil {
@@ -183,7 +217,10 @@ func (s *consulStore) GetAllStatusForResourceType(t ResourceType) (map[ResourceI
 
 	for _, pair := range pairs {
 		key := pair.Key
-		status := pair.Value
+		status, err := decompressStatus(key, pair.Value)
+		if err != nil {
+			return nil, err
+		}
 
 		_, id, namespace, err := keyParts(key)
 		if err != nil {
@@ -201,6 +238,16 @@ func (s *consulStore) GetAllStatusForResourceType(t ResourceType) (map[ResourceI
 	return ret, nil
 }
 
+// decompressStatus returns the status stored in value. Statuses written
+// before compression was enabled are returned as-is.
+func decompressStatus(key string, value []byte) (Status, error) {
+	status, err := consulutil.DecompressValue(value)
+	if err != nil {
+		return nil, util.Errorf("could not read status at %s: %s", key, err)
+	}
+	return status, nil
+}
+
 func resourceTypePath(t ResourceType) (string, error) {
 	if t == "" {
 		return "", util.Errorf("Resource type cannot be blank")
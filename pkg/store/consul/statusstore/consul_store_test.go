@@ -233,3 +233,35 @@ func storeWithFakeKV() *consulStore {
 		kv: consulutil.NewFakeClient().KV(),
 	}
 }
+
+func TestCompressedStatus(t *testing.T) {
+	status := Status([]byte(`{"some":"status"}`))
+	store := storeWithFakeKV()
+
+	// Write one status before enabling compression to make sure both can be
+	// read back
+	err := store.SetStatus(PC, "some_id", "uncompressed", status)
+	if err != nil {
+		t.Fatalf("Unable to set status: %s", err)
+	}
+
+	oldCompression := *StatusCompression
+	*StatusCompression = "gzip"
+	defer func() { *StatusCompression = oldCompression }()
+
+	err = store.SetStatus(PC, "some_id", "compressed", status)
+	if err != nil {
+		t.Fatalf("Unable to set compressed status: %s", err)
+	}
+
+	statuses, err := store.GetAllStatusForResource(PC, "some_id")
+	if err != nil {
+		t.Fatalf("Unable to get statuses: %s", err)
+	}
+
+	for _, namespace := range []Namespace{"uncompressed", "compressed"} {
+		if !bytes.Equal(statuses[namespace].Bytes(), status.Bytes()) {
+			t.Errorf("Expected %s status to be '%s' but was '%s'", namespace, string(status.Bytes()), string(statuses[namespace].Bytes()))
+		}
+	}
+}
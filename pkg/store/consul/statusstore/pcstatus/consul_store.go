@@ -0,0 +1,90 @@
+package pcstatus
+
+import (
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// The namespace under which the pod cluster status controller records its
+// view of each pod cluster
+const StatusControllerNamespace statusstore.Namespace = "pc_status_controller"
+
+type ConsulStore struct {
+	statusStore statusstore.Store
+
+	// The consul implementation statusstore.Store formats keys like
+	// /status/<resource-type>/<resource-id>/<namespace>. The namespace
+	// portion is useful if multiple subsystems need to record their
+	// own view of a resource.
+	namespace statusstore.Namespace
+}
+
+func NewConsul(statusStore statusstore.Store, namespace statusstore.Namespace) ConsulStore {
+	return ConsulStore{
+		statusStore: statusStore,
+		namespace:   namespace,
+	}
+}
+
+func (c ConsulStore) Get(id fields.ID) (PodClusterStatus, *api.QueryMeta, error) {
+	if id == "" {
+		return PodClusterStatus{}, nil, util.Errorf("Cannot retrieve status for a pod cluster with an empty id")
+	}
+
+	status, queryMeta, err := c.statusStore.GetStatus(statusstore.PC, statusstore.ResourceID(id), c.namespace)
+	if err != nil {
+		return PodClusterStatus{}, queryMeta, err
+	}
+
+	pcStatus, err := statusToPCStatus(status)
+	if err != nil {
+		return PodClusterStatus{}, queryMeta, err
+	}
+
+	return pcStatus, queryMeta, nil
+}
+
+func (c ConsulStore) Set(id fields.ID, status PodClusterStatus) error {
+	if id == "" {
+		return util.Errorf("Could not set status for pod cluster with empty id")
+	}
+
+	rawStatus, err := pcStatusToStatus(status)
+	if err != nil {
+		return err
+	}
+
+	return c.statusStore.SetStatus(statusstore.PC, statusstore.ResourceID(id), c.namespace, rawStatus)
+}
+
+// List lists all of the pod cluster status entries in consul.
+func (c ConsulStore) List() (map[fields.ID]PodClusterStatus, error) {
+	allStatus, err := c.statusStore.GetAllStatusForResourceType(statusstore.PC)
+	if err != nil {
+		return nil, util.Errorf("could not fetch all status for %s resource type: %s", statusstore.PC, err)
+	}
+
+	ret := make(map[fields.ID]PodClusterStatus)
+	for id, statusMap := range allStatus {
+		if status, ok := statusMap[c.namespace]; ok {
+			pcStatus, err := statusToPCStatus(status)
+			if err != nil {
+				return nil, util.Errorf("could not read status for %s: %s", id, err)
+			}
+			ret[fields.ID(id)] = pcStatus
+		}
+	}
+
+	return ret, nil
+}
+
+func (c ConsulStore) Delete(id fields.ID) error {
+	if id == "" {
+		return util.Errorf("pod cluster id cannot be empty")
+	}
+
+	return c.statusStore.DeleteStatus(statusstore.PC, statusstore.ResourceID(id), c.namespace)
+}
@@ -0,0 +1,75 @@
+package pcstatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/pc/fields"
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/store/consul/statusstore/statusstoretest"
+)
+
+func TestSetAndGetStatus(t *testing.T) {
+	store := newFixture()
+
+	testStatus := PodClusterStatus{
+		MatchedNodes:  3,
+		HealthyNodes:  2,
+		LastReconcile: time.Now().UTC().Truncate(time.Second),
+	}
+
+	id := fields.ID("some_pc")
+	err := store.Set(id, testStatus)
+	if err != nil {
+		t.Fatalf("Unexpected error setting status: %s", err)
+	}
+
+	status, _, err := store.Get(id)
+	if err != nil {
+		t.Fatalf("Unexpected error getting status: %s", err)
+	}
+
+	if status.MatchedNodes != testStatus.MatchedNodes || status.HealthyNodes != testStatus.HealthyNodes {
+		t.Errorf("Status expected to be '%+v', was %+v", testStatus, status)
+	}
+
+	if !status.LastReconcile.Equal(testStatus.LastReconcile) {
+		t.Errorf("Expected last reconcile time to be %s, was %s", testStatus.LastReconcile, status.LastReconcile)
+	}
+}
+
+func TestListAndDelete(t *testing.T) {
+	store := newFixture()
+
+	for _, id := range []fields.ID{"pc1", "pc2"} {
+		err := store.Set(id, PodClusterStatus{MatchedNodes: 1})
+		if err != nil {
+			t.Fatalf("Unexpected error setting status: %s", err)
+		}
+	}
+
+	statuses, err := store.List()
+	if err != nil {
+		t.Fatalf("Unexpected error listing statuses: %s", err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 statuses but got %d", len(statuses))
+	}
+
+	err = store.Delete("pc1")
+	if err != nil {
+		t.Fatalf("Unexpected error deleting status: %s", err)
+	}
+
+	_, _, err = store.Get("pc1")
+	if !statusstore.IsNoStatus(err) {
+		t.Fatalf("Expected a no status error after deletion but got %v", err)
+	}
+}
+
+func newFixture() *ConsulStore {
+	return &ConsulStore{
+		statusStore: statusstoretest.NewFake(),
+		namespace:   "test_namespace",
+	}
+}
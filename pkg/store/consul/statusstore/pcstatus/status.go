@@ -0,0 +1,43 @@
+package pcstatus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/statusstore"
+	"github.com/square/p2/pkg/util"
+)
+
+// Encapsulates the observed state of a pod cluster, as opposed to the
+// declared state (e.g. the pod selector) stored in the pod cluster itself.
+type PodClusterStatus struct {
+	// The number of pods currently matched by the pod cluster's pod
+	// selector
+	MatchedNodes int `json:"matched_nodes"`
+
+	// The number of matched pods that are passing their health checks
+	HealthyNodes int `json:"healthy_nodes"`
+
+	// The last time the status controller reconciled this pod cluster
+	LastReconcile time.Time `json:"last_reconcile"`
+}
+
+func statusToPCStatus(rawStatus statusstore.Status) (PodClusterStatus, error) {
+	var pcStatus PodClusterStatus
+
+	err := json.Unmarshal(rawStatus.Bytes(), &pcStatus)
+	if err != nil {
+		return PodClusterStatus{}, util.Errorf("Could not unmarshal raw status as pod cluster status: %s", err)
+	}
+
+	return pcStatus, nil
+}
+
+func pcStatusToStatus(pcStatus PodClusterStatus) (statusstore.Status, error) {
+	bytes, err := json.Marshal(pcStatus)
+	if err != nil {
+		return statusstore.Status{}, util.Errorf("Could not marshal pod cluster status as json bytes: %s", err)
+	}
+
+	return statusstore.Status(bytes), nil
+}
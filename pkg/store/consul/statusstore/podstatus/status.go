@@ -44,6 +44,23 @@ type ProcessStatus struct {
 	LastExit     *ExitStatus         `json:"last_exit"`
 }
 
+// Records an artifact verification failure that was allowed through by a
+// non-enforcing verification failure policy.
+type ArtifactVerificationFailure struct {
+	Policy string    `json:"policy"`
+	Error  string    `json:"error"`
+	Time   time.Time `json:"time"`
+}
+
+// Records the most recent failed preflight check of a pod, which blocked the
+// pod from being launched.
+type PreflightFailure struct {
+	LaunchableID launch.LaunchableID `json:"launchable_id"`
+	Error        string              `json:"error"`
+	Output       string              `json:"output"`
+	Time         time.Time           `json:"time"`
+}
+
 // Encapsulates the state of all processes running in a pod.
 type PodStatus struct {
 	ProcessStatuses []ProcessStatus `json:"process_status"`
@@ -52,6 +69,20 @@ type PodStatus struct {
 	// String representing the pod manifest for the running pod. Will be
 	// empty if it hasn't yet been launched
 	Manifest string `json:"manifest"`
+
+	// Artifact verification failures that were ignored when the running
+	// manifest was installed. Empty if verification passed or failures are
+	// enforced.
+	ArtifactVerificationFailures []ArtifactVerificationFailure `json:"artifact_verification_failures,omitempty"`
+
+	// Set if the most recent attempt to launch the pod was blocked by a
+	// failed preflight check; cleared once the pod launches.
+	PreflightFailure *PreflightFailure `json:"preflight_failure,omitempty"`
+
+	// The configured subset of the node's labels at the time the pod was
+	// launched, so that statuses can be grouped without looking up each
+	// node's labels
+	NodeLabels map[string]string `json:"node_labels,omitempty"`
 }
 
 func statusToPodStatus(rawStatus statusstore.Status) (PodStatus, error) {
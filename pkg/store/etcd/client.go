@@ -0,0 +1,280 @@
+// Package etcd implements consulutil.ConsulClient on top of etcd v3, so that
+// the stores in pkg/store/consul (intent, reality, hooks, health, sessions and
+// locks, and their watches) can be backed by etcd where consul isn't
+// available.
+//
+// It talks to etcd through the JSON gateway that etcd serves alongside its
+// gRPC API (etcd 3.4 and later serve it under /v3). Consul concepts are mapped
+// onto etcd as follows:
+//
+//   - Consul's indexes are etcd revisions. A key's CreateIndex and ModifyIndex
+//     are its create and mod revisions, and the LastIndex of a query is the
+//     mod revision of the key for Get() and the store's revision otherwise.
+//   - Blocking queries watch the queried keys starting after the WaitIndex,
+//     and are then answered with a new read.
+//   - Sessions are leases. Keys acquired by or written with a session are
+//     attached to its lease, so they are deleted when the session expires or
+//     is destroyed, like sessions with the "delete" behavior. Sessions must
+//     have a TTL, and their LockDelay is ignored.
+//
+// A few features of consul are not supported: key flags are not stored,
+// writing a locked key without its session releases the lock, and the "lock"
+// transaction verb can't be expressed as an etcd transaction.
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultWaitTime is how long blocking queries wait for a change when
+// neither the query nor the client set a wait time. It matches consul's.
+const DefaultWaitTime = 5 * time.Minute
+
+type Options struct {
+	// The URLs of the etcd members to use (eg "https://etcd1.example.com:2379").
+	// Requests go to the first member that responds.
+	Endpoints []string
+	// If non-nil, this http.Client will be used for etcd communication.
+	Client *http.Client
+	// The default wait time of blocking queries made with this client.
+	WaitTime time.Duration
+}
+
+type client struct {
+	endpoints []string
+	http      *http.Client
+	waitTime  time.Duration
+
+	// the index in endpoints of the member that last responded
+	mu      sync.Mutex
+	current int
+}
+
+// NewClient returns a client whose KV() and Session() operate on etcd
+func NewClient(opts Options) (consulutil.ConsulClient, error) {
+	if len(opts.Endpoints) == 0 {
+		return nil, util.Errorf("No etcd endpoints were configured")
+	}
+
+	c := &client{
+		http:     opts.Client,
+		waitTime: opts.WaitTime,
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	if c.waitTime == 0 {
+		c.waitTime = DefaultWaitTime
+	}
+	for _, endpoint := range opts.Endpoints {
+		c.endpoints = append(c.endpoints, strings.TrimSuffix(endpoint, "/"))
+	}
+	return c, nil
+}
+
+func (c *client) KV() consulutil.ConsulKVClient {
+	return kv{client: c}
+}
+
+func (c *client) Session() consulutil.ConsulSessionClient {
+	return session{client: c}
+}
+
+// call posts req to the gateway endpoint at path, e.g. "/v3/kv/range", and
+// decodes the response into resp
+func (c *client) call(ctx context.Context, path string, req interface{}, resp interface{}) error {
+	body, err := c.post(ctx, path, req)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	err = json.NewDecoder(body).Decode(resp)
+	if err != nil {
+		return util.Errorf("Could not decode etcd response from %s: %s", path, err)
+	}
+	return nil
+}
+
+// post sends req to the first member that responds. The caller must close
+// the returned body, which is a stream of responses for streaming endpoints
+// like "/v3/watch".
+func (c *client) post(ctx context.Context, path string, req interface{}) (io.ReadCloser, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	start := c.current
+	c.mu.Unlock()
+
+	var lastErr error
+	for i := range c.endpoints {
+		member := (start + i) % len(c.endpoints)
+		httpReq, err := http.NewRequest("POST", c.endpoints[member]+path, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.http.Do(httpReq.WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			// try the next member
+			lastErr = err
+			continue
+		}
+
+		c.mu.Lock()
+		c.current = member
+		c.mu.Unlock()
+
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			msg, _ := ioutil.ReadAll(resp.Body)
+			err = util.Errorf("etcd request to %s failed with status %d: %s", path, resp.StatusCode, bytes.TrimSpace(msg))
+			switch {
+			case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+				return nil, consulutil.PermissionDeniedError{Err: err}
+			case resp.StatusCode >= http.StatusInternalServerError:
+				return nil, consulutil.UnavailableError{Err: err}
+			}
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+	return nil, consulutil.UnavailableError{Err: util.Errorf("No etcd member responded to %s: %s", path, lastErr)}
+}
+
+// int64String is an int64 in the gateway's JSON encoding, which quotes 64
+// bit integers
+type int64String int64
+
+func (i int64String) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatInt(int64(i), 10))), nil
+}
+
+func (i *int64String) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = int64String(n)
+	return nil
+}
+
+type responseHeader struct {
+	Revision int64String `json:"revision"`
+}
+
+type keyValue struct {
+	Key            []byte      `json:"key"`
+	CreateRevision int64String `json:"create_revision"`
+	ModRevision    int64String `json:"mod_revision"`
+	Value          []byte      `json:"value"`
+	Lease          int64String `json:"lease"`
+}
+
+type rangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+	KeysOnly bool   `json:"keys_only,omitempty"`
+}
+
+type rangeResponse struct {
+	Header responseHeader `json:"header"`
+	Kvs    []keyValue     `json:"kvs"`
+}
+
+type putRequest struct {
+	Key   []byte      `json:"key"`
+	Value []byte      `json:"value"`
+	Lease int64String `json:"lease,omitempty"`
+}
+
+type putResponse struct {
+	Header responseHeader `json:"header"`
+}
+
+type deleteRangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+}
+
+type deleteRangeResponse struct {
+	Header  responseHeader `json:"header"`
+	Deleted int64String    `json:"deleted"`
+}
+
+type compare struct {
+	Result string `json:"result"`
+	Target string `json:"target"`
+	Key    []byte `json:"key"`
+
+	CreateRevision *int64String `json:"create_revision,omitempty"`
+	ModRevision    *int64String `json:"mod_revision,omitempty"`
+	Lease          *int64String `json:"lease,omitempty"`
+}
+
+type requestOp struct {
+	RequestRange       *rangeRequest       `json:"request_range,omitempty"`
+	RequestPut         *putRequest         `json:"request_put,omitempty"`
+	RequestDeleteRange *deleteRangeRequest `json:"request_delete_range,omitempty"`
+}
+
+type responseOp struct {
+	ResponseRange       *rangeResponse       `json:"response_range,omitempty"`
+	ResponsePut         *putResponse         `json:"response_put,omitempty"`
+	ResponseDeleteRange *deleteRangeResponse `json:"response_delete_range,omitempty"`
+}
+
+type txnRequest struct {
+	Compare []compare   `json:"compare,omitempty"`
+	Success []requestOp `json:"success,omitempty"`
+	Failure []requestOp `json:"failure,omitempty"`
+}
+
+type txnResponse struct {
+	Header    responseHeader `json:"header"`
+	Succeeded bool           `json:"succeeded"`
+	Responses []responseOp   `json:"responses"`
+}
+
+// prefixEnd returns the range end that selects every key starting with
+// prefix
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// every byte is 0xff (or the prefix is empty), select to the end of
+	// the keyspace
+	return []byte{0}
+}
+
+// prefixRange returns the key and range end that select every key starting
+// with prefix. The empty prefix selects every key.
+func prefixRange(prefix string) ([]byte, []byte) {
+	if prefix == "" {
+		return []byte{0}, []byte{0}
+	}
+	return []byte(prefix), prefixEnd(prefix)
+}
@@ -0,0 +1,203 @@
+package etcd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/hashicorp/consul/api"
+)
+
+func TestKVReadWrite(t *testing.T) {
+	_, client, server := newFakeGateway(t)
+	defer server.Close()
+	kv := client.KV()
+
+	pair, _, err := kv.Get("intent/node1/pod", nil)
+	Assert(t).IsNil(err, "should not have erred getting a missing key")
+	Assert(t).IsTrue(pair == nil, "should not have gotten a missing key")
+
+	for _, key := range []string{"intent/node1/a", "intent/node1/b", "intent/node2/a", "reality/node1/a"} {
+		_, err = kv.Put(&api.KVPair{Key: key, Value: []byte(key)}, nil)
+		Assert(t).IsNil(err, "should not have erred putting a key")
+	}
+
+	pair, meta, err := kv.Get("intent/node1/a", nil)
+	Assert(t).IsNil(err, "should not have erred getting a key")
+	Assert(t).AreEqual(string(pair.Value), "intent/node1/a", "should have gotten the key's value")
+	Assert(t).AreEqual(meta.LastIndex, pair.ModifyIndex, "the index of a key read should be the key's index")
+
+	pairs, _, err := kv.List("intent/node1/", nil)
+	Assert(t).IsNil(err, "should not have erred listing keys")
+	Assert(t).AreEqual(len(pairs), 2, "should have listed the keys with the prefix")
+
+	keys, _, err := kv.Keys("intent/", "/", nil)
+	Assert(t).IsNil(err, "should not have erred listing keys")
+	Assert(t).AreEqual(len(keys), 2, "should have collapsed keys after the separator")
+	Assert(t).AreEqual(keys[0], "intent/node1/", "should have truncated keys after the separator")
+
+	_, err = kv.DeleteTree("intent/", nil)
+	Assert(t).IsNil(err, "should not have erred deleting a tree")
+	pairs, _, err = kv.List("", nil)
+	Assert(t).IsNil(err, "should not have erred listing keys")
+	Assert(t).AreEqual(len(pairs), 1, "should have only deleted the keys with the prefix")
+}
+
+func TestCAS(t *testing.T) {
+	_, client, server := newFakeGateway(t)
+	defer server.Close()
+	kv := client.KV()
+
+	ok, _, err := kv.CAS(&api.KVPair{Key: "key", Value: []byte("1")}, nil)
+	Assert(t).IsNil(err, "should not have erred creating a key")
+	Assert(t).IsTrue(ok, "should have created a missing key with index 0")
+
+	ok, _, err = kv.CAS(&api.KVPair{Key: "key", Value: []byte("2")}, nil)
+	Assert(t).IsNil(err, "should not have erred with an existing key")
+	Assert(t).IsFalse(ok, "should not have overwritten an existing key with index 0")
+
+	pair, _, err := kv.Get("key", nil)
+	Assert(t).IsNil(err, "should not have erred getting a key")
+	pair.Value = []byte("3")
+	ok, _, err = kv.CAS(pair, nil)
+	Assert(t).IsNil(err, "should not have erred setting a key")
+	Assert(t).IsTrue(ok, "should have set a key with its current index")
+
+	ok, _, err = kv.DeleteCAS(pair, nil)
+	Assert(t).IsNil(err, "should not have erred deleting a key")
+	Assert(t).IsFalse(ok, "should not have deleted a key with a stale index")
+}
+
+func TestTxn(t *testing.T) {
+	_, client, server := newFakeGateway(t)
+	defer server.Close()
+	kv := client.KV()
+
+	_, err := kv.Put(&api.KVPair{Key: "a", Value: []byte("a")}, nil)
+	Assert(t).IsNil(err, "test setup: could not put key")
+	pair, _, err := kv.Get("a", nil)
+	Assert(t).IsNil(err, "test setup: could not get key")
+
+	ok, resp, _, err := kv.Txn(api.KVTxnOps{
+		{Verb: string(api.KVCheckIndex), Key: "a", Index: pair.ModifyIndex},
+		{Verb: string(api.KVSet), Key: "b", Value: []byte("b")},
+		{Verb: string(api.KVGet), Key: "a"},
+	}, nil)
+	Assert(t).IsNil(err, "should not have erred committing a transaction")
+	Assert(t).IsTrue(ok, "should have committed a transaction whose checks hold")
+	Assert(t).AreEqual(len(resp.Results), 2, "should have gotten results for the set and get")
+	Assert(t).AreEqual(string(resp.Results[1].Value), "a", "should have gotten the value of the get")
+
+	ok, resp, _, err = kv.Txn(api.KVTxnOps{
+		{Verb: string(api.KVSet), Key: "c", Value: []byte("c")},
+		{Verb: string(api.KVCAS), Key: "b", Value: []byte("b"), Index: 0},
+		{Verb: string(api.KVCheckIndex), Key: "a", Index: pair.ModifyIndex + 100},
+	}, nil)
+	Assert(t).IsNil(err, "should not have erred rolling back a transaction")
+	Assert(t).IsFalse(ok, "should have rolled back a transaction whose checks fail")
+	Assert(t).AreEqual(len(resp.Errors), 1, "should have gotten an error for the failed check")
+	Assert(t).AreEqual(resp.Errors[0].OpIndex, 1, "should have reported the first operation that failed")
+
+	pair, _, err = kv.Get("c", nil)
+	Assert(t).IsNil(err, "should not have erred getting a key")
+	Assert(t).IsTrue(pair == nil, "should not have written keys in a rolled back transaction")
+
+	_, _, _, err = kv.Txn(api.KVTxnOps{{Verb: string(api.KVLock), Key: "a", Session: "1"}}, nil)
+	Assert(t).IsNotNil(err, "should have erred with an unsupported operation")
+}
+
+func TestBlockingList(t *testing.T) {
+	_, client, server := newFakeGateway(t)
+	defer server.Close()
+	kv := client.KV()
+
+	_, meta, err := kv.List("prefix/", nil)
+	Assert(t).IsNil(err, "should not have erred listing keys")
+
+	start := time.Now()
+	_, _, err = kv.List("prefix/", &api.QueryOptions{WaitIndex: meta.LastIndex, WaitTime: 20 * time.Millisecond})
+	Assert(t).IsNil(err, "should not have erred when the wait time passed")
+	Assert(t).IsTrue(time.Since(start) >= 20*time.Millisecond, "should have waited for a change")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = kv.Put(&api.KVPair{Key: "other", Value: []byte("other")}, nil)
+		_, _ = kv.Put(&api.KVPair{Key: "prefix/key", Value: []byte("value")}, nil)
+	}()
+	pairs, newMeta, err := kv.List("prefix/", &api.QueryOptions{WaitIndex: meta.LastIndex, WaitTime: 5 * time.Second})
+	Assert(t).IsNil(err, "should not have erred waiting for a change")
+	Assert(t).AreEqual(len(pairs), 1, "should have returned once a key with the prefix changed")
+	Assert(t).IsTrue(newMeta.LastIndex > meta.LastIndex, "should have returned a newer index")
+}
+
+func TestSessionLocks(t *testing.T) {
+	_, client, server := newFakeGateway(t)
+	defer server.Close()
+	kv := client.KV()
+	sessions := client.Session()
+
+	_, _, err := sessions.Create(&api.SessionEntry{Name: "no ttl"}, nil)
+	Assert(t).IsNotNil(err, "should have erred creating a session without a TTL")
+
+	id, _, err := sessions.Create(&api.SessionEntry{Name: "first", TTL: "15s"}, nil)
+	Assert(t).IsNil(err, "should not have erred creating a session")
+	other, _, err := sessions.Create(&api.SessionEntry{Name: "second", TTL: "15s"}, nil)
+	Assert(t).IsNil(err, "should not have erred creating a session")
+
+	entry, _, err := sessions.Info(id, nil)
+	Assert(t).IsNil(err, "should not have erred getting a session")
+	Assert(t).AreEqual(entry.Name, "first", "should have gotten the session's entry")
+
+	ok, _, err := kv.Acquire(&api.KVPair{Key: "lock/key", Session: id}, nil)
+	Assert(t).IsNil(err, "should not have erred acquiring a lock")
+	Assert(t).IsTrue(ok, "should have acquired an unheld lock")
+	ok, _, err = kv.Acquire(&api.KVPair{Key: "lock/key", Session: other}, nil)
+	Assert(t).IsNil(err, "should not have erred acquiring a held lock")
+	Assert(t).IsFalse(ok, "should not have acquired a lock held by another session")
+	ok, _, err = kv.Acquire(&api.KVPair{Key: "lock/key", Session: id}, nil)
+	Assert(t).IsNil(err, "should not have erred acquiring a lock again")
+	Assert(t).IsTrue(ok, "should have acquired a lock the session holds")
+
+	pair, _, err := kv.Get("lock/key", nil)
+	Assert(t).IsNil(err, "should not have erred getting a lock")
+	Assert(t).AreEqual(pair.Session, id, "the lock should have been held by the session")
+
+	_, err = sessions.Destroy(id, nil)
+	Assert(t).IsNil(err, "should not have erred destroying a session")
+	pair, _, err = kv.Get("lock/key", nil)
+	Assert(t).IsNil(err, "should not have erred getting a lock")
+	Assert(t).IsTrue(pair == nil, "destroying the session should have deleted its keys")
+
+	entry, _, err = sessions.Renew(id, nil)
+	Assert(t).IsNil(err, "should not have erred renewing a destroyed session")
+	Assert(t).IsTrue(entry == nil, "should not have renewed a destroyed session")
+	entry, _, err = sessions.Renew(other, nil)
+	Assert(t).IsNil(err, "should not have erred renewing a session")
+	Assert(t).AreEqual(entry.Name, "second", "should have renewed a live session")
+}
+
+func TestPodStoreOnEtcd(t *testing.T) {
+	_, client, server := newFakeGateway(t)
+	defer server.Close()
+	store := consul.NewConsulStore(client)
+
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	_, err := store.SetPod(consul.INTENT_TREE, "node1", builder.GetManifest())
+	Assert(t).IsNil(err, "should not have erred setting a pod")
+
+	results, _, err := store.ListPods(consul.INTENT_TREE, "node1")
+	Assert(t).IsNil(err, "should not have erred listing pods")
+	Assert(t).AreEqual(len(results), 1, "should have listed the pod")
+	Assert(t).AreEqual(results[0].Manifest.ID(), types.PodID("hello"), "should have listed the pod that was set")
+
+	_, err = store.DeletePod(consul.INTENT_TREE, "node1", "hello")
+	Assert(t).IsNil(err, "should not have erred deleting a pod")
+	results, _, err = store.ListPods(consul.INTENT_TREE, "node1")
+	Assert(t).IsNil(err, "should not have erred listing pods")
+	Assert(t).AreEqual(len(results), 0, "should have deleted the pod")
+}
@@ -0,0 +1,267 @@
+package etcd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// fakeGateway is an in-memory etcd serving the subset of the JSON gateway
+// used by the client
+type fakeGateway struct {
+	mu       sync.Mutex
+	revision int64
+	kvs      map[string]keyValue
+	// the revision and key of every change, in order, for watches
+	history []change
+	leases  map[int64String]int64String
+	// the ID of the last lease granted
+	lastLease int64String
+	// closed and replaced on every change
+	changed chan struct{}
+}
+
+type change struct {
+	revision int64
+	key      string
+}
+
+// newFakeGateway returns a fake and a client of it. Close the server when
+// done.
+func newFakeGateway(t *testing.T) (*fakeGateway, *client, *httptest.Server) {
+	f := &fakeGateway{
+		revision: 1,
+		kvs:      make(map[string]keyValue),
+		leases:   make(map[int64String]int64String),
+		changed:  make(chan struct{}),
+	}
+	server := httptest.NewServer(f)
+
+	c, err := NewClient(Options{Endpoints: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+	return f, c.(*client), server
+}
+
+func inRange(key string, start []byte, end []byte) bool {
+	switch {
+	case len(end) == 0:
+		return key == string(start)
+	case bytes.Equal(end, []byte{0}):
+		return key >= string(start)
+	default:
+		return key >= string(start) && key < string(end)
+	}
+}
+
+func (f *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	decode := func(req interface{}) bool {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+		return true
+	}
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var req rangeRequest
+		if decode(&req) {
+			f.respond(w, func() interface{} { return f.rangeLocked(req) })
+		}
+	case "/v3/kv/put":
+		var req putRequest
+		if decode(&req) {
+			f.respond(w, func() interface{} { return f.putLocked(req) })
+		}
+	case "/v3/kv/deleterange":
+		var req deleteRangeRequest
+		if decode(&req) {
+			f.respond(w, func() interface{} { return f.deleteLocked(req) })
+		}
+	case "/v3/kv/txn":
+		var req txnRequest
+		if decode(&req) {
+			f.respond(w, func() interface{} { return f.txnLocked(req) })
+		}
+	case "/v3/lease/grant":
+		var req leaseGrantRequest
+		if decode(&req) {
+			f.respond(w, func() interface{} {
+				f.lastLease++
+				f.leases[f.lastLease] = req.TTL
+				return leaseResponse{Header: f.header(), ID: f.lastLease, TTL: req.TTL}
+			})
+		}
+	case "/v3/lease/revoke":
+		var req leaseRequest
+		if decode(&req) {
+			f.respond(w, func() interface{} {
+				delete(f.leases, req.ID)
+				for key, kv := range f.kvs {
+					if kv.Lease == req.ID {
+						f.deleteLocked(deleteRangeRequest{Key: []byte(key)})
+					}
+				}
+				return leaseResponse{Header: f.header()}
+			})
+		}
+	case "/v3/lease/keepalive":
+		var req leaseRequest
+		if decode(&req) {
+			f.respond(w, func() interface{} {
+				return leaseKeepAliveResponse{Result: leaseResponse{Header: f.header(), ID: req.ID, TTL: f.leases[req.ID]}}
+			})
+		}
+	case "/v3/watch":
+		var req watchRequest
+		if decode(&req) {
+			f.watch(w, r, req.CreateRequest)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeGateway) respond(w http.ResponseWriter, handle func() interface{}) {
+	f.mu.Lock()
+	resp := handle()
+	f.mu.Unlock()
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeGateway) header() responseHeader {
+	return responseHeader{Revision: int64String(f.revision)}
+}
+
+func (f *fakeGateway) rangeLocked(req rangeRequest) rangeResponse {
+	var keys []string
+	for key := range f.kvs {
+		if inRange(key, req.Key, req.RangeEnd) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	resp := rangeResponse{Header: f.header()}
+	for _, key := range keys {
+		kv := f.kvs[key]
+		if req.KeysOnly {
+			kv.Value = nil
+		}
+		resp.Kvs = append(resp.Kvs, kv)
+	}
+	return resp
+}
+
+func (f *fakeGateway) commitLocked(key string) {
+	f.history = append(f.history, change{revision: f.revision, key: key})
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeGateway) putLocked(req putRequest) putResponse {
+	f.revision++
+	kv, ok := f.kvs[string(req.Key)]
+	if !ok {
+		kv = keyValue{Key: req.Key, CreateRevision: int64String(f.revision)}
+	}
+	kv.ModRevision = int64String(f.revision)
+	kv.Value = req.Value
+	kv.Lease = req.Lease
+	f.kvs[string(req.Key)] = kv
+	f.commitLocked(string(req.Key))
+	return putResponse{Header: f.header()}
+}
+
+func (f *fakeGateway) deleteLocked(req deleteRangeRequest) deleteRangeResponse {
+	var deleted int64String
+	for key := range f.kvs {
+		if inRange(key, req.Key, req.RangeEnd) {
+			f.revision++
+			delete(f.kvs, key)
+			f.commitLocked(key)
+			deleted++
+		}
+	}
+	return deleteRangeResponse{Header: f.header(), Deleted: deleted}
+}
+
+func (f *fakeGateway) txnLocked(req txnRequest) txnResponse {
+	succeeded := true
+	for _, c := range req.Compare {
+		kv := f.kvs[string(c.Key)]
+		var actual, expected int64String
+		switch c.Target {
+		case "CREATE":
+			actual, expected = kv.CreateRevision, *c.CreateRevision
+		case "MOD":
+			actual, expected = kv.ModRevision, *c.ModRevision
+		case "LEASE":
+			actual, expected = kv.Lease, *c.Lease
+		}
+		if (c.Result == "EQUAL" && actual != expected) || (c.Result == "GREATER" && actual <= expected) {
+			succeeded = false
+		}
+	}
+
+	ops := req.Success
+	if !succeeded {
+		ops = req.Failure
+	}
+	resp := txnResponse{Succeeded: succeeded}
+	for _, op := range ops {
+		switch {
+		case op.RequestRange != nil:
+			r := f.rangeLocked(*op.RequestRange)
+			resp.Responses = append(resp.Responses, responseOp{ResponseRange: &r})
+		case op.RequestPut != nil:
+			r := f.putLocked(*op.RequestPut)
+			resp.Responses = append(resp.Responses, responseOp{ResponsePut: &r})
+		case op.RequestDeleteRange != nil:
+			r := f.deleteLocked(*op.RequestDeleteRange)
+			resp.Responses = append(resp.Responses, responseOp{ResponseDeleteRange: &r})
+		}
+	}
+	resp.Header = f.header()
+	return resp
+}
+
+// watch streams a creation message, then one message with the changes in
+// the range at or after the start revision once there are any
+func (f *fakeGateway) watch(w http.ResponseWriter, r *http.Request, req watchCreateRequest) {
+	var created watchResponse
+	created.Result.Created = true
+	_ = json.NewEncoder(w).Encode(created)
+	w.(http.Flusher).Flush()
+
+	for {
+		f.mu.Lock()
+		var resp watchResponse
+		for _, c := range f.history {
+			if c.revision >= int64(req.StartRevision) && inRange(c.key, req.Key, req.RangeEnd) {
+				resp.Result.Events = append(resp.Result.Events, watchEvent{
+					Kv: keyValue{Key: []byte(c.key), ModRevision: int64String(c.revision)},
+				})
+			}
+		}
+		resp.Result.Header = f.header()
+		changed := f.changed
+		f.mu.Unlock()
+
+		if len(resp.Result.Events) > 0 {
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// kv implements the consul KV API with etcd's KV service
+type kv struct {
+	client *client
+}
+
+var _ consulutil.ConsulKVClient = kv{}
+
+func (k kv) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	resp, meta, err := k.read(rangeRequest{Key: []byte(key)}, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, meta, nil
+	}
+	// consul returns the key's own index for single key reads, which
+	// callers use for check-and-set
+	meta.LastIndex = uint64(resp.Kvs[0].ModRevision)
+	return toPair(resp.Kvs[0]), meta, nil
+}
+
+func (k kv) List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	key, end := prefixRange(prefix)
+	resp, meta, err := k.read(rangeRequest{Key: key, RangeEnd: end}, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pairs := make(api.KVPairs, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		pairs = append(pairs, toPair(kv))
+	}
+	return pairs, meta, nil
+}
+
+// Keys lists the keys starting with prefix. If separator isn't empty, keys
+// are truncated after the first separator following the prefix, and
+// duplicates are dropped.
+func (k kv) Keys(prefix, separator string, q *api.QueryOptions) ([]string, *api.QueryMeta, error) {
+	key, end := prefixRange(prefix)
+	resp, meta, err := k.read(rangeRequest{Key: key, RangeEnd: end, KeysOnly: true}, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key := string(kv.Key)
+		if separator != "" {
+			if i := strings.Index(key[len(prefix):], separator); i >= 0 {
+				key = key[:len(prefix)+i+len(separator)]
+			}
+		}
+		// keys are sorted, so truncated duplicates are adjacent
+		if len(keys) > 0 && keys[len(keys)-1] == key {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, meta, nil
+}
+
+// read performs a range request. If q has a WaitIndex, it is a blocking
+// query that returns once a key in the range has changed after the
+// WaitIndex, or once the wait time has passed.
+func (k kv) read(req rangeRequest, q *api.QueryOptions) (rangeResponse, *api.QueryMeta, error) {
+	start := time.Now()
+	if q != nil && q.WaitIndex > 0 {
+		waitTime := q.WaitTime
+		if waitTime == 0 {
+			waitTime = k.client.waitTime
+		}
+		err := k.client.waitForChange(req.Key, req.RangeEnd, int64(q.WaitIndex)+1, waitTime)
+		if err != nil {
+			return rangeResponse{}, nil, err
+		}
+	}
+
+	var resp rangeResponse
+	err := k.client.call(context.Background(), "/v3/kv/range", req, &resp)
+	if err != nil {
+		return rangeResponse{}, nil, err
+	}
+	return resp, &api.QueryMeta{
+		LastIndex:   uint64(resp.Header.Revision),
+		KnownLeader: true,
+		RequestTime: time.Since(start),
+	}, nil
+}
+
+// Put writes pair. If it has a session, the key is attached to the
+// session's lease.
+func (k kv) Put(pair *api.KVPair, w *api.WriteOptions) (*api.WriteMeta, error) {
+	start := time.Now()
+	put, err := putPair(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp putResponse
+	err = k.client.call(context.Background(), "/v3/kv/put", put, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &api.WriteMeta{RequestTime: time.Since(start)}, nil
+}
+
+// CAS writes pair if its key's ModifyIndex hasn't changed, or if the key
+// doesn't exist when the ModifyIndex is 0
+func (k kv) CAS(pair *api.KVPair, w *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	put, err := putPair(pair)
+	if err != nil {
+		return false, nil, err
+	}
+	return k.txn(txnRequest{
+		Compare: []compare{indexCompare(pair.Key, pair.ModifyIndex)},
+		Success: []requestOp{{RequestPut: &put}},
+	})
+}
+
+func (k kv) Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	return k.deleteRange(deleteRangeRequest{Key: []byte(key)})
+}
+
+func (k kv) DeleteTree(prefix string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	key, end := prefixRange(prefix)
+	return k.deleteRange(deleteRangeRequest{Key: key, RangeEnd: end})
+}
+
+func (k kv) deleteRange(req deleteRangeRequest) (*api.WriteMeta, error) {
+	start := time.Now()
+	var resp deleteRangeResponse
+	err := k.client.call(context.Background(), "/v3/kv/deleterange", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &api.WriteMeta{RequestTime: time.Since(start)}, nil
+}
+
+// DeleteCAS deletes pair's key if its ModifyIndex hasn't changed
+func (k kv) DeleteCAS(pair *api.KVPair, w *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	return k.txn(txnRequest{
+		Compare: []compare{modCompare(pair.Key, pair.ModifyIndex)},
+		Success: []requestOp{{RequestDeleteRange: &deleteRangeRequest{Key: []byte(pair.Key)}}},
+	})
+}
+
+// Acquire writes pair if its key isn't locked by another session, attaching
+// the key to the lease of pair's session
+func (k kv) Acquire(pair *api.KVPair, w *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	if pair.Session == "" {
+		return false, nil, util.Errorf("Cannot acquire %s without a session", pair.Key)
+	}
+	put, err := putPair(pair)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// An etcd transaction can't check that a key either doesn't exist or
+	// is attached to a lease, so acquire a key the session already holds
+	// with a second transaction
+	ok, meta, err := k.txn(txnRequest{
+		Compare: []compare{createCompare(pair.Key, 0)},
+		Success: []requestOp{{RequestPut: &put}},
+	})
+	if err != nil || ok {
+		return ok, meta, err
+	}
+	return k.txn(txnRequest{
+		Compare: []compare{leaseCompare(pair.Key, put.Lease)},
+		Success: []requestOp{{RequestPut: &put}},
+	})
+}
+
+// Release detaches pair's key from the lease of pair's session, if the
+// session holds it, and writes pair's value
+func (k kv) Release(pair *api.KVPair, w *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	lease, err := parseSessionID(pair.Session)
+	if err != nil {
+		return false, nil, err
+	}
+	return k.txn(txnRequest{
+		Compare: []compare{leaseCompare(pair.Key, lease)},
+		Success: []requestOp{{RequestPut: &putRequest{Key: []byte(pair.Key), Value: pair.Value}}},
+	})
+}
+
+func (k kv) txn(req txnRequest) (bool, *api.WriteMeta, error) {
+	start := time.Now()
+	var resp txnResponse
+	err := k.client.call(context.Background(), "/v3/kv/txn", req, &resp)
+	if err != nil {
+		return false, nil, err
+	}
+	return resp.Succeeded, &api.WriteMeta{RequestTime: time.Since(start)}, nil
+}
+
+// waitForChange watches the keys from key to end (or just key if end is
+// empty) until one of them changes at or after revision, or until waitTime
+// has passed. It also returns if revision has been compacted, since the
+// changes can't be watched anymore.
+func (c *client) waitForChange(key []byte, end []byte, revision int64, waitTime time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTime)
+	defer cancel()
+
+	body, err := c.post(ctx, "/v3/watch", watchRequest{
+		CreateRequest: watchCreateRequest{
+			Key:           key,
+			RangeEnd:      end,
+			StartRevision: int64String(revision),
+		},
+	})
+	if err == context.DeadlineExceeded {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	decoder := json.NewDecoder(body)
+	for {
+		var resp watchResponse
+		err := decoder.Decode(&resp)
+		if ctx.Err() != nil {
+			// waited as long as we were asked to
+			return nil
+		}
+		if err != nil {
+			return util.Errorf("Could not decode etcd watch response: %s", err)
+		}
+		if resp.Error != nil {
+			return util.Errorf("etcd watch failed: %s", resp.Error.Message)
+		}
+		if len(resp.Result.Events) > 0 || resp.Result.CompactRevision > 0 || resp.Result.Canceled {
+			return nil
+		}
+	}
+}
+
+type watchCreateRequest struct {
+	Key           []byte      `json:"key"`
+	RangeEnd      []byte      `json:"range_end,omitempty"`
+	StartRevision int64String `json:"start_revision,omitempty"`
+}
+
+type watchRequest struct {
+	CreateRequest watchCreateRequest `json:"create_request"`
+}
+
+// watchResponse is one message of the watch stream, which the gateway wraps
+// in a "result", or an "error" if the stream fails
+type watchResponse struct {
+	Result struct {
+		Header          responseHeader `json:"header"`
+		Created         bool           `json:"created"`
+		Canceled        bool           `json:"canceled"`
+		CompactRevision int64String    `json:"compact_revision"`
+		Events          []watchEvent   `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type watchEvent struct {
+	Type string   `json:"type"`
+	Kv   keyValue `json:"kv"`
+}
+
+func toPair(kv keyValue) *api.KVPair {
+	pair := &api.KVPair{
+		Key:         string(kv.Key),
+		CreateIndex: uint64(kv.CreateRevision),
+		ModifyIndex: uint64(kv.ModRevision),
+		Value:       kv.Value,
+	}
+	if kv.Lease != 0 {
+		pair.Session = sessionID(kv.Lease)
+	}
+	return pair
+}
+
+// putPair returns the put request that writes pair, attached to the lease
+// of its session if it has one
+func putPair(pair *api.KVPair) (putRequest, error) {
+	put := putRequest{Key: []byte(pair.Key), Value: pair.Value}
+	if pair.Session != "" {
+		lease, err := parseSessionID(pair.Session)
+		if err != nil {
+			return putRequest{}, err
+		}
+		put.Lease = lease
+	}
+	return put, nil
+}
+
+// indexCompare is the comparison of a consul check-and-set: the key's index
+// is unchanged, or the key doesn't exist when index is 0
+func indexCompare(key string, index uint64) compare {
+	if index == 0 {
+		return createCompare(key, 0)
+	}
+	return modCompare(key, index)
+}
+
+func modCompare(key string, index uint64) compare {
+	revision := int64String(index)
+	return compare{Result: "EQUAL", Target: "MOD", Key: []byte(key), ModRevision: &revision}
+}
+
+func createCompare(key string, index uint64) compare {
+	revision := int64String(index)
+	return compare{Result: "EQUAL", Target: "CREATE", Key: []byte(key), CreateRevision: &revision}
+}
+
+func leaseCompare(key string, lease int64String) compare {
+	return compare{Result: "EQUAL", Target: "LEASE", Key: []byte(key), Lease: &lease}
+}
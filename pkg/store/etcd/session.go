@@ -0,0 +1,219 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// Leases have no name or other metadata, so the entry of each session is
+// stored at /sessions/<id>, attached to the session's lease so that it is
+// deleted along with the session
+const sessionTree = "sessions"
+
+// session implements the consul session API with etcd leases
+type session struct {
+	client *client
+}
+
+var _ consulutil.ConsulSessionClient = session{}
+
+// sessionID formats a lease ID the way etcdctl does
+func sessionID(lease int64String) string {
+	return strconv.FormatInt(int64(lease), 16)
+}
+
+func parseSessionID(id string) (int64String, error) {
+	lease, err := strconv.ParseInt(id, 16, 64)
+	if err != nil {
+		return 0, util.Errorf("%q is not an etcd session ID", id)
+	}
+	return int64String(lease), nil
+}
+
+type leaseGrantRequest struct {
+	TTL int64String `json:"TTL"`
+}
+
+type leaseRequest struct {
+	ID int64String `json:"ID"`
+}
+
+type leaseResponse struct {
+	Header responseHeader `json:"header"`
+	ID     int64String    `json:"ID"`
+	TTL    int64String    `json:"TTL"`
+}
+
+type leaseKeepAliveResponse struct {
+	Result leaseResponse `json:"result"`
+}
+
+// Create grants a lease with the session's TTL and records the session's
+// entry. Sessions are never tied to health checks, so Create is the same as
+// CreateNoChecks.
+func (s session) Create(entry *api.SessionEntry, q *api.WriteOptions) (string, *api.WriteMeta, error) {
+	return s.CreateNoChecks(entry, q)
+}
+
+func (s session) CreateNoChecks(entry *api.SessionEntry, q *api.WriteOptions) (string, *api.WriteMeta, error) {
+	start := time.Now()
+	if entry == nil || entry.TTL == "" {
+		return "", nil, util.Errorf("etcd sessions must have a TTL")
+	}
+	ttl, err := time.ParseDuration(entry.TTL)
+	if err != nil {
+		return "", nil, util.Errorf("Invalid session TTL %q: %s", entry.TTL, err)
+	}
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	var grant leaseResponse
+	err = s.client.call(context.Background(), "/v3/lease/grant", leaseGrantRequest{TTL: int64String(seconds)}, &grant)
+	if err != nil {
+		return "", nil, err
+	}
+
+	id := sessionID(grant.ID)
+	record := *entry
+	record.ID = id
+	record.CreateIndex = uint64(grant.Header.Revision)
+	value, err := json.Marshal(record)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = s.client.KV().Put(&api.KVPair{
+		Key:     path.Join(sessionTree, id),
+		Value:   value,
+		Session: id,
+	}, nil)
+	if err != nil {
+		_, _ = s.Destroy(id, nil)
+		return "", nil, err
+	}
+	return id, &api.WriteMeta{RequestTime: time.Since(start)}, nil
+}
+
+// Destroy revokes the session's lease, which deletes every key attached to
+// it
+func (s session) Destroy(id string, q *api.WriteOptions) (*api.WriteMeta, error) {
+	start := time.Now()
+	lease, err := parseSessionID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp leaseResponse
+	err = s.client.call(context.Background(), "/v3/lease/revoke", leaseRequest{ID: lease}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &api.WriteMeta{RequestTime: time.Since(start)}, nil
+}
+
+// Info returns the session's entry, or nil if the session doesn't exist
+func (s session) Info(id string, q *api.QueryOptions) (*api.SessionEntry, *api.QueryMeta, error) {
+	pair, meta, err := s.client.KV().Get(path.Join(sessionTree, id), q)
+	if err != nil || pair == nil {
+		return nil, meta, err
+	}
+
+	var entry api.SessionEntry
+	err = json.Unmarshal(pair.Value, &entry)
+	if err != nil {
+		return nil, nil, util.Errorf("Could not parse the entry of session %s: %s", id, err)
+	}
+	return &entry, meta, nil
+}
+
+func (s session) List(q *api.QueryOptions) ([]*api.SessionEntry, *api.QueryMeta, error) {
+	pairs, meta, err := s.client.KV().List(sessionTree+"/", q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]*api.SessionEntry, 0, len(pairs))
+	for _, pair := range pairs {
+		var entry api.SessionEntry
+		err = json.Unmarshal(pair.Value, &entry)
+		if err != nil {
+			return nil, nil, util.Errorf("Could not parse the session entry at %s: %s", pair.Key, err)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, meta, nil
+}
+
+// Renew refreshes the session's lease. Like consul, it returns a nil entry if
+// the session doesn't exist anymore.
+func (s session) Renew(id string, q *api.WriteOptions) (*api.SessionEntry, *api.WriteMeta, error) {
+	start := time.Now()
+	lease, err := parseSessionID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the gateway ends the keepalive stream after answering, since the
+	// request body only has one request
+	var resp leaseKeepAliveResponse
+	err = s.client.call(context.Background(), "/v3/lease/keepalive", leaseRequest{ID: lease}, &resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta := &api.WriteMeta{RequestTime: time.Since(start)}
+	if resp.Result.TTL <= 0 {
+		return nil, meta, nil
+	}
+
+	entry, _, err := s.Info(id, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, meta, nil
+}
+
+// RenewPeriodic renews the session every half TTL until doneCh is closed,
+// when the session is destroyed. It returns an error if the session could
+// not be renewed before it expired.
+func (s session) RenewPeriodic(initialTTL string, id string, q *api.WriteOptions, doneCh chan struct{}) error {
+	ttl, err := time.ParseDuration(initialTTL)
+	if err != nil {
+		return err
+	}
+
+	waitDur := ttl / 2
+	lastRenewTime := time.Now()
+	var lastErr error
+	for {
+		if time.Since(lastRenewTime) > ttl {
+			return lastErr
+		}
+		select {
+		case <-time.After(waitDur):
+			entry, _, err := s.Renew(id, q)
+			if err != nil {
+				waitDur = time.Second
+				lastErr = err
+				continue
+			}
+			if entry == nil {
+				return util.Errorf("Session %s expired", id)
+			}
+
+			waitDur = ttl / 2
+			lastRenewTime = time.Now()
+		case <-doneCh:
+			_, _ = s.Destroy(id, q)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// txnCheck is a condition of a consul transaction, which is evaluated again
+// against the keys read by a failed etcd transaction to tell which operation
+// rolled it back
+type txnCheck struct {
+	opIndex int
+	compare compare
+	what    string
+}
+
+// Txn performs consul transaction operations as one etcd transaction. The
+// conditions of the operations (check-and-sets, index and session checks and
+// gets of keys that must exist) become the comparisons of the etcd
+// transaction, and if any of them fail the transaction is rolled back with
+// an error for the first operation whose condition failed.
+func (k kv) Txn(ops api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	start := time.Now()
+	req, checks, err := translateTxn(ops)
+	if err != nil {
+		return false, nil, nil, err
+	}
+
+	var resp txnResponse
+	err = k.client.call(context.Background(), "/v3/kv/txn", req, &resp)
+	if err != nil {
+		return false, nil, nil, err
+	}
+	meta := &api.QueryMeta{
+		LastIndex:   uint64(resp.Header.Revision),
+		KnownLeader: true,
+		RequestTime: time.Since(start),
+	}
+
+	if !resp.Succeeded {
+		return false, &api.KVTxnResponse{Errors: txnErrors(checks, resp.Responses)}, meta, nil
+	}
+	return true, &api.KVTxnResponse{Results: txnResults(ops, resp)}, meta, nil
+}
+
+// translateTxn returns the etcd transaction that performs ops. Its failure
+// branch reads the key of each check, in order.
+func translateTxn(ops api.KVTxnOps) (txnRequest, []txnCheck, error) {
+	var req txnRequest
+	var checks []txnCheck
+	check := func(i int, c compare, what string) {
+		checks = append(checks, txnCheck{opIndex: i, compare: c, what: what})
+		req.Compare = append(req.Compare, c)
+		req.Failure = append(req.Failure, requestOp{RequestRange: &rangeRequest{Key: c.Key}})
+	}
+
+	for i, op := range ops {
+		key := []byte(op.Key)
+		switch api.KVOp(op.Verb) {
+		case api.KVSet:
+			put, err := putPair(&api.KVPair{Key: op.Key, Value: op.Value, Session: op.Session})
+			if err != nil {
+				return txnRequest{}, nil, err
+			}
+			req.Success = append(req.Success, requestOp{RequestPut: &put})
+		case api.KVCAS:
+			check(i, indexCompare(op.Key, op.Index), fmt.Sprintf("failed to set key %q, index is stale", op.Key))
+			req.Success = append(req.Success, requestOp{RequestPut: &putRequest{Key: key, Value: op.Value}})
+		case api.KVDelete:
+			req.Success = append(req.Success, requestOp{RequestDeleteRange: &deleteRangeRequest{Key: key}})
+		case api.KVDeleteCAS:
+			check(i, modCompare(op.Key, op.Index), fmt.Sprintf("failed to delete key %q, index is stale", op.Key))
+			req.Success = append(req.Success, requestOp{RequestDeleteRange: &deleteRangeRequest{Key: key}})
+		case api.KVDeleteTree:
+			start, end := prefixRange(op.Key)
+			req.Success = append(req.Success, requestOp{RequestDeleteRange: &deleteRangeRequest{Key: start, RangeEnd: end}})
+		case api.KVUnlock:
+			lease, err := parseSessionID(op.Session)
+			if err != nil {
+				return txnRequest{}, nil, err
+			}
+			check(i, leaseCompare(op.Key, lease), fmt.Sprintf("failed to unlock key %q, lock wasn't held by session %q", op.Key, op.Session))
+			req.Success = append(req.Success, requestOp{RequestPut: &putRequest{Key: key, Value: op.Value}})
+		case api.KVGet:
+			exists := createCompare(op.Key, 0)
+			exists.Result = "GREATER"
+			check(i, exists, fmt.Sprintf("key %q doesn't exist", op.Key))
+			req.Success = append(req.Success, requestOp{RequestRange: &rangeRequest{Key: key}})
+		case api.KVGetTree:
+			start, end := prefixRange(op.Key)
+			req.Success = append(req.Success, requestOp{RequestRange: &rangeRequest{Key: start, RangeEnd: end}})
+		case api.KVCheckIndex:
+			check(i, modCompare(op.Key, op.Index), fmt.Sprintf("current index of key %q does not match %d", op.Key, op.Index))
+		case api.KVCheckSession:
+			lease, err := parseSessionID(op.Session)
+			if err != nil {
+				return txnRequest{}, nil, err
+			}
+			check(i, leaseCompare(op.Key, lease), fmt.Sprintf("failed session check for key %q, not held by session %q", op.Key, op.Session))
+		default:
+			// "lock" must succeed if the key is unlocked or already held by
+			// the session, which etcd's comparisons can't express
+			return txnRequest{}, nil, util.Errorf("Transaction operation %q is not supported by etcd", op.Verb)
+		}
+	}
+	return req, checks, nil
+}
+
+// txnErrors returns the errors of a rolled back transaction by evaluating its
+// checks against the keys read by its failure branch
+func txnErrors(checks []txnCheck, responses []responseOp) api.TxnErrors {
+	var errors api.TxnErrors
+	for i, check := range checks {
+		var current keyValue
+		if i < len(responses) && responses[i].ResponseRange != nil && len(responses[i].ResponseRange.Kvs) > 0 {
+			current = responses[i].ResponseRange.Kvs[0]
+		}
+		if !check.compare.holds(current) {
+			errors = append(errors, &api.TxnError{OpIndex: check.opIndex, What: check.what})
+			break
+		}
+	}
+	if len(errors) == 0 {
+		// the keys changed again between the transaction and its
+		// failure branch, which are evaluated atomically, so this
+		// shouldn't happen
+		errors = append(errors, &api.TxnError{OpIndex: 0, What: "transaction was rolled back"})
+	}
+	return errors
+}
+
+// holds evaluates c against the current value of its key, which is the zero
+// keyValue if the key doesn't exist
+func (c compare) holds(current keyValue) bool {
+	var actual, expected int64String
+	switch c.Target {
+	case "CREATE":
+		actual, expected = current.CreateRevision, *c.CreateRevision
+	case "MOD":
+		actual, expected = current.ModRevision, *c.ModRevision
+	case "LEASE":
+		actual, expected = current.Lease, *c.Lease
+	}
+
+	if c.Result == "GREATER" {
+		return actual > expected
+	}
+	return actual == expected
+}
+
+// txnResults returns the consul results of a committed transaction: the
+// pairs read by "get" and "get-tree" operations, and the key and index of
+// each write
+func txnResults(ops api.KVTxnOps, resp txnResponse) []*api.KVPair {
+	var results []*api.KVPair
+	responses := resp.Responses
+	for _, op := range ops {
+		switch api.KVOp(op.Verb) {
+		case api.KVCheckIndex, api.KVCheckSession:
+			// checks have no etcd operation
+			continue
+		}
+		if len(responses) == 0 {
+			break
+		}
+		response := responses[0]
+		responses = responses[1:]
+
+		switch {
+		case response.ResponseRange != nil:
+			for _, kv := range response.ResponseRange.Kvs {
+				results = append(results, toPair(kv))
+			}
+		case response.ResponsePut != nil:
+			results = append(results, &api.KVPair{
+				Key:         op.Key,
+				ModifyIndex: uint64(resp.Header.Revision),
+			})
+		}
+	}
+	return results
+}
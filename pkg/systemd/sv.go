@@ -0,0 +1,140 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+)
+
+// SV is a runit.SV that controls the systemd units written by Backend.
+type SV struct {
+	Systemctl string // the path of systemctl
+}
+
+var _ runit.SV = SV{}
+
+// NewSV returns an SV using the configured SystemctlPath.
+func NewSV() SV {
+	return SV{Systemctl: *SystemctlPath}
+}
+
+// signals maps the reload commands of runit.SV to the signals they send
+var signals = map[string]string{
+	"hup":       "SIGHUP",
+	"alarm":     "SIGALRM",
+	"interrupt": "SIGINT",
+	"quit":      "SIGQUIT",
+	"1":         "SIGUSR1",
+	"2":         "SIGUSR2",
+}
+
+// uptimeFile reports the time since boot, which is the clock of systemd's monotonic
+// timestamps
+var uptimeFile = "/proc/uptime"
+
+// isLogAgent returns true for the log services of runit services, which don't exist
+// because systemd collects the output of services itself. Commands sent to them succeed
+// without doing anything.
+func isLogAgent(service *runit.Service) bool {
+	return filepath.Base(service.Path) == "log"
+}
+
+func (sv SV) systemctl(service *runit.Service, args ...string) (string, error) {
+	if isLogAgent(service) {
+		return "", nil
+	}
+	return Backend{Systemctl: sv.Systemctl}.systemctl(append(args, UnitName(service.Name))...)
+}
+
+func (sv SV) Start(service *runit.Service) (string, error) {
+	return sv.systemctl(service, "start")
+}
+
+// Stop stops the service's unit. systemd waits for the unit's own stop timeout before
+// killing it, so timeout is not used.
+func (sv SV) Stop(service *runit.Service, timeout time.Duration) (string, error) {
+	return sv.systemctl(service, "stop")
+}
+
+// Restart restarts the service's unit. Like Stop, it doesn't use timeout.
+func (sv SV) Restart(service *runit.Service, timeout time.Duration) (string, error) {
+	return sv.systemctl(service, "restart")
+}
+
+// Once starts the service's unit. Whether it is restarted when it exits is determined by
+// the restart policy written to the unit by Backend.
+func (sv SV) Once(service *runit.Service) (string, error) {
+	return sv.systemctl(service, "start")
+}
+
+func (sv SV) Signal(service *runit.Service, command string) (string, error) {
+	if !runit.IsReloadCommand(command) {
+		return "", util.Errorf("%q is not a signal command, must be one of %v", command, runit.ReloadCommands)
+	}
+	return sv.systemctl(service, "kill", "--kill-who=main", "--signal="+signals[command])
+}
+
+// Stat reports the status of the service's unit. Since the output of the service is sent
+// to the journal, there is no log process and the log fields are left empty.
+func (sv SV) Stat(service *runit.Service) (*runit.StatResult, error) {
+	if isLogAgent(service) {
+		return &runit.StatResult{ChildStatus: runit.STATUS_DOWN}, nil
+	}
+	out, err := sv.systemctl(service, "show", "--property=ActiveState,MainPID,ExecMainStartTimestampMonotonic")
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			properties[parts[0]] = parts[1]
+		}
+	}
+
+	result := &runit.StatResult{ChildStatus: runit.STATUS_DOWN}
+	if properties["ActiveState"] != "active" {
+		return result, nil
+	}
+	result.ChildStatus = runit.STATUS_RUN
+
+	result.ChildPID, err = strconv.ParseUint(properties["MainPID"], 10, 32)
+	if err != nil {
+		return nil, util.Errorf("Could not parse main PID of %s from %q: %s", service.Name, properties["MainPID"], err)
+	}
+	startedMicros, err := strconv.ParseInt(properties["ExecMainStartTimestampMonotonic"], 10, 64)
+	if err != nil {
+		return nil, util.Errorf("Could not parse start time of %s from %q: %s", service.Name, properties["ExecMainStartTimestampMonotonic"], err)
+	}
+	uptime, err := readUptime()
+	if err != nil {
+		return nil, err
+	}
+	if childTime := uptime - time.Duration(startedMicros)*time.Microsecond; childTime > 0 {
+		// sv reports whole seconds
+		result.ChildTime = childTime - childTime%time.Second
+	}
+	return result, nil
+}
+
+func readUptime() (time.Duration, error) {
+	contents, err := ioutil.ReadFile(uptimeFile)
+	if err != nil {
+		return 0, util.Errorf("Could not read uptime: %s", err)
+	}
+	fields := strings.Fields(string(contents))
+	if len(fields) == 0 {
+		return 0, util.Errorf("Could not parse uptime from %q", contents)
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, util.Errorf("Could not parse uptime from %q: %s", contents, err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,193 @@
+// Package systemd runs the services of p2 launchables as systemd units, for nodes that
+// don't have runit. Backend turns the servicebuilder templates of runit.ServiceBuilder
+// into unit files, and SV controls the resulting units the way runit.SV controls runit
+// services. The services' output goes to the journal instead of svlogd.
+package systemd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+)
+
+var (
+	// SystemctlPath is the full path of the "systemctl" binary.
+	SystemctlPath = param.String("systemctl_path", "/bin/systemctl")
+
+	// UnitRoot is the directory that unit files are written to.
+	UnitRoot = param.String("systemd_unit_root", "/etc/systemd/system")
+)
+
+// The units of p2 services are named p2-<service name>.service, so that they can be told
+// apart from the node's other units when pruning.
+const (
+	unitPrefix = "p2-"
+	unitSuffix = ".service"
+)
+
+// UnitName returns the name of the unit of a runit service.
+func UnitName(serviceName string) string {
+	return unitPrefix + serviceName + unitSuffix
+}
+
+// Backend is a runit.ServiceBackend that writes a unit file for each servicebuilder
+// template.
+type Backend struct {
+	UnitRoot  string // the directory to write unit files to
+	Systemctl string // the path of systemctl
+}
+
+var _ runit.ServiceBackend = Backend{}
+
+// NewBackend returns a Backend using the configured UnitRoot and SystemctlPath.
+func NewBackend() Backend {
+	return Backend{
+		UnitRoot:  *UnitRoot,
+		Systemctl: *SystemctlPath,
+	}
+}
+
+// NewServiceBuilder returns a copy of builder that runs its services with systemd.
+func NewServiceBuilder(builder *runit.ServiceBuilder) *runit.ServiceBuilder {
+	systemdBuilder := *builder
+	systemdBuilder.Backend = NewBackend()
+	return &systemdBuilder
+}
+
+func (b Backend) systemctl(args ...string) (string, error) {
+	output, err := exec.Command(b.Systemctl, args...).CombinedOutput()
+	if err != nil {
+		return string(output), util.Errorf("Could not run systemctl %s: %s, Output: %s", strings.Join(args, " "), err, output)
+	}
+	return string(output), nil
+}
+
+// Activate writes the unit file of each template and reloads systemd if any of them
+// changed. Units of services that should always be running are enabled so that they
+// start on boot; like runit services with a down file, the others are only started by
+// their launchable.
+func (b Backend) Activate(templates map[string]runit.ServiceTemplate) error {
+	changed := false
+	var enable []string
+	for serviceName, template := range templates {
+		unit, err := unitFile(serviceName, template)
+		if err != nil {
+			return err
+		}
+		unitChanged, err := util.WriteIfChanged(filepath.Join(b.UnitRoot, UnitName(serviceName)), unit, 0644)
+		if err != nil {
+			return err
+		}
+		changed = changed || unitChanged
+		if template.RestartPolicy == runit.RestartPolicyAlways {
+			enable = append(enable, UnitName(serviceName))
+		}
+	}
+
+	if changed {
+		if _, err := b.systemctl("daemon-reload"); err != nil {
+			return err
+		}
+	}
+	if len(enable) > 0 {
+		sort.Strings(enable)
+		if _, err := b.systemctl(append([]string{"enable"}, enable...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune stops, disables and removes the units of every p2 service that isn't one of
+// templates.
+func (b Backend) Prune(templates map[string]runit.ServiceTemplate) error {
+	entries, err := ioutil.ReadDir(b.UnitRoot)
+	if err != nil {
+		return err
+	}
+
+	var stale []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, unitPrefix) || !strings.HasSuffix(name, unitSuffix) {
+			continue
+		}
+		serviceName := strings.TrimSuffix(strings.TrimPrefix(name, unitPrefix), unitSuffix)
+		if _, exists := templates[serviceName]; !exists {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	if _, err := b.systemctl(append([]string{"disable", "--now"}, stale...)...); err != nil {
+		return err
+	}
+	for _, name := range stale {
+		if err := os.Remove(filepath.Join(b.UnitRoot, name)); err != nil {
+			return err
+		}
+	}
+	_, err = b.systemctl("daemon-reload")
+	return err
+}
+
+// unitFile returns the contents of the unit file of a servicebuilder template. Its log
+// command is not used, since systemd sends the service's output to the journal.
+func unitFile(serviceName string, template runit.ServiceTemplate) ([]byte, error) {
+	if len(template.Run) == 0 {
+		return nil, util.Errorf("empty run command for %s", serviceName)
+	}
+
+	restart := "no"
+	if template.RestartPolicy == runit.RestartPolicyAlways {
+		restart = "always"
+	}
+	// the same default delay as the run scripts of runit services, to reduce
+	// spinning on a broken service
+	sleep := 2
+	if template.Sleep != nil && *template.Sleep >= 0 {
+		sleep = *template.Sleep
+	}
+
+	unit := fmt.Sprintf(`# Generated by p2, do not edit
+[Unit]
+Description=p2 service %s
+
+[Service]
+ExecStart=%s
+Restart=%s
+RestartSec=%d
+StandardOutput=journal
+StandardError=journal
+SyslogIdentifier=%s
+`, serviceName, quoteCommand(template.Run), restart, sleep, serviceName)
+	if len(template.Finish) > 0 {
+		unit += fmt.Sprintf("ExecStopPost=%s\n", quoteCommand(template.Finish))
+	}
+	unit += `
+[Install]
+WantedBy=multi-user.target
+`
+	return []byte(unit), nil
+}
+
+// quoteCommand formats a command line for a unit file, quoting each argument so that
+// systemd doesn't split it or expand specifiers and variables in it.
+func quoteCommand(command []string) string {
+	quoted := make([]string, len(command))
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`, `$`, `$$`)
+	for i, arg := range command {
+		quoted[i] = `"` + replacer.Replace(arg) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,141 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/runit"
+)
+
+// testSystemctl writes a script that records the arguments of each systemctl
+// command in the returned file and prints output, if any
+func testSystemctl(t *testing.T, root string, output string) (string, string) {
+	argsFile := filepath.Join(root, "systemctl_args")
+	script := filepath.Join(root, "systemctl")
+	contents := "#!/bin/sh\necho \"$@\" >> " + argsFile + "\n"
+	if output != "" {
+		contents += "cat <<'EOF'\n" + output + "\nEOF\n"
+	}
+	err := ioutil.WriteFile(script, []byte(contents), 0755)
+	Assert(t).IsNil(err, "could not write fake systemctl")
+	return script, argsFile
+}
+
+func readCommands(t *testing.T, argsFile string) []string {
+	args, err := ioutil.ReadFile(argsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	Assert(t).IsNil(err, "could not read systemctl commands")
+	return strings.Split(strings.TrimSpace(string(args)), "\n")
+}
+
+func TestQuoteCommand(t *testing.T) {
+	quoted := quoteCommand([]string{"/bin/app", "--name=a b", `say "hi"`, "100%", "$HOME", `C:\`})
+	Assert(t).AreEqual(quoted, `"/bin/app" "--name=a b" "say \"hi\"" "100%%" "$$HOME" "C:\\"`, "unexpected quoting")
+}
+
+func TestBackendActivateAndPrune(t *testing.T) {
+	root, err := ioutil.TempDir("", "systemd_backend")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	defer os.RemoveAll(root)
+	systemctl, argsFile := testSystemctl(t, root, "")
+	unitRoot := filepath.Join(root, "units")
+	Assert(t).IsNil(os.Mkdir(unitRoot, 0755), "could not create unit directory")
+
+	builder := &runit.ServiceBuilder{
+		ConfigRoot:  filepath.Join(root, "config"),
+		StagingRoot: filepath.Join(root, "staging"),
+		RunitRoot:   filepath.Join(root, "service"),
+		Backend:     Backend{UnitRoot: unitRoot, Systemctl: systemctl},
+	}
+	for _, dir := range []string{builder.ConfigRoot, builder.StagingRoot, builder.RunitRoot} {
+		Assert(t).IsNil(os.Mkdir(dir, 0755), "could not create servicebuilder directory")
+	}
+
+	err = builder.Activate("app", map[string]runit.ServiceTemplate{
+		"app__web": {
+			Run:           []string{"/usr/bin/p2-exec", "--", "/data/app/bin/launch"},
+			Finish:        []string{"/data/app/bin/finish"},
+			RestartPolicy: runit.RestartPolicyAlways,
+		},
+		"app__job": {
+			Run:           []string{"/data/app/bin/job"},
+			RestartPolicy: runit.RestartPolicyNever,
+		},
+	})
+	Assert(t).IsNil(err, "activate should have succeeded")
+
+	unit, err := ioutil.ReadFile(filepath.Join(unitRoot, "p2-app__web.service"))
+	Assert(t).IsNil(err, "should have written the unit of app__web")
+	for _, line := range []string{
+		`ExecStart="/usr/bin/p2-exec" "--" "/data/app/bin/launch"`,
+		`ExecStopPost="/data/app/bin/finish"`,
+		"Restart=always",
+		"SyslogIdentifier=app__web",
+	} {
+		Assert(t).IsTrue(strings.Contains(string(unit), line+"\n"), "unit should have contained "+line)
+	}
+	unit, err = ioutil.ReadFile(filepath.Join(unitRoot, "p2-app__job.service"))
+	Assert(t).IsNil(err, "should have written the unit of app__job")
+	Assert(t).IsTrue(strings.Contains(string(unit), "Restart=no\n"), "app__job should not be restarted")
+
+	_, err = os.Stat(filepath.Join(builder.RunitRoot, "app__web"))
+	Assert(t).IsTrue(os.IsNotExist(err), "should not have activated a runit service")
+	Assert(t).AreEqual(strings.Join(readCommands(t, argsFile), "; "), "daemon-reload; enable p2-app__web.service", "unexpected systemctl commands")
+
+	// activating unchanged units doesn't reload systemd again
+	Assert(t).IsNil(os.Remove(argsFile), "could not reset systemctl commands")
+	err = builder.Activate("app", map[string]runit.ServiceTemplate{
+		"app__web": {
+			Run:           []string{"/usr/bin/p2-exec", "--", "/data/app/bin/launch"},
+			Finish:        []string{"/data/app/bin/finish"},
+			RestartPolicy: runit.RestartPolicyAlways,
+		},
+	})
+	Assert(t).IsNil(err, "activate should have succeeded")
+	Assert(t).AreEqual(strings.Join(readCommands(t, argsFile), "; "), "enable p2-app__web.service", "unexpected systemctl commands")
+
+	Assert(t).IsNil(os.Remove(argsFile), "could not reset systemctl commands")
+	Assert(t).IsNil(ioutil.WriteFile(filepath.Join(unitRoot, "sshd.service"), nil, 0644), "could not write unrelated unit")
+	err = builder.Prune()
+	Assert(t).IsNil(err, "prune should have succeeded")
+	Assert(t).AreEqual(strings.Join(readCommands(t, argsFile), "; "), "disable --now p2-app__job.service; daemon-reload", "unexpected systemctl commands")
+	_, err = os.Stat(filepath.Join(unitRoot, "p2-app__job.service"))
+	Assert(t).IsTrue(os.IsNotExist(err), "should have removed the unit of app__job")
+	_, err = os.Stat(filepath.Join(unitRoot, "p2-app__web.service"))
+	Assert(t).IsNil(err, "should have kept the unit of app__web")
+	_, err = os.Stat(filepath.Join(unitRoot, "sshd.service"))
+	Assert(t).IsNil(err, "should have kept units that p2 didn't write")
+}
+
+func TestSVStat(t *testing.T) {
+	root, err := ioutil.TempDir("", "systemd_sv")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	defer os.RemoveAll(root)
+	systemctl, argsFile := testSystemctl(t, root, "ActiveState=active\nMainPID=1234\nExecMainStartTimestampMonotonic=100000000")
+
+	oldUptimeFile := uptimeFile
+	uptimeFile = filepath.Join(root, "uptime")
+	defer func() { uptimeFile = oldUptimeFile }()
+	Assert(t).IsNil(ioutil.WriteFile(uptimeFile, []byte("130.52 400.10\n"), 0644), "could not write uptime")
+
+	sv := SV{Systemctl: systemctl}
+	service := &runit.Service{Name: "app__web"}
+	result, err := sv.Stat(service)
+	Assert(t).IsNil(err, "stat should have succeeded")
+	Assert(t).AreEqual(result.ChildStatus, runit.STATUS_RUN, "unit should have been running")
+	Assert(t).AreEqual(result.ChildPID, uint64(1234), "unexpected main PID")
+	Assert(t).AreEqual(result.ChildTime.String(), "30s", "unexpected time since start")
+
+	_, err = sv.Signal(service, "hup")
+	Assert(t).IsNil(err, "signal should have succeeded")
+	_, err = sv.Signal(service, "term")
+	Assert(t).IsNotNil(err, "should have refused to send a signal that stops the service")
+	commands := readCommands(t, argsFile)
+	Assert(t).AreEqual(commands[len(commands)-1], "kill --kill-who=main --signal=SIGHUP p2-app__web.service", "unexpected signal command")
+}
@@ -0,0 +1,255 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// How many ended spans wait to be exported before new ones are dropped
+	otlpMaxPending = 2048
+	// The most spans sent in one request
+	otlpBatchSize = 512
+	// How often spans are exported when fewer than a batch are pending
+	otlpExportInterval = 5 * time.Second
+)
+
+// OTLPExporter exports spans to an OpenTelemetry collector with OTLP's
+// HTTP/JSON protocol, in batches, from a goroutine of its own. Tracing is best
+// effort: spans are dropped when the collector can't keep up, and failed
+// requests are logged and not retried.
+type OTLPExporter struct {
+	client   *http.Client
+	url      string
+	resource map[string]string
+	logger   logging.Logger
+
+	spans  chan SpanData
+	flush  chan chan struct{}
+	closed chan struct{}
+
+	closeOnce sync.Once
+}
+
+// NewOTLPExporter returns an exporter that POSTs spans to url, which is
+// usually a collector's /v1/traces endpoint. resource holds the attributes
+// of the process the spans are from, such as "service.name".
+func NewOTLPExporter(client *http.Client, url string, resource map[string]string, logger logging.Logger) *OTLPExporter {
+	e := &OTLPExporter{
+		client:   client,
+		url:      url,
+		resource: resource,
+		logger:   logger,
+		spans:    make(chan SpanData, otlpMaxPending),
+		flush:    make(chan chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *OTLPExporter) Export(span SpanData) {
+	select {
+	case e.spans <- span:
+	default:
+		e.logger.WithField("span", span.Name).Debugln("Dropped a trace span, too many spans are waiting to be exported")
+	}
+}
+
+// Flush exports the spans that are waiting to be exported
+func (e *OTLPExporter) Flush() {
+	done := make(chan struct{})
+	select {
+	case e.flush <- done:
+		<-done
+	case <-e.closed:
+	}
+}
+
+// Close exports the spans that are waiting to be exported and stops the
+// exporter. Spans exported afterward are dropped.
+func (e *OTLPExporter) Close() {
+	e.closeOnce.Do(func() {
+		e.Flush()
+		close(e.closed)
+	})
+}
+
+func (e *OTLPExporter) run() {
+	ticker := time.NewTicker(otlpExportInterval)
+	defer ticker.Stop()
+	var batch []SpanData
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = nil
+		case done := <-e.flush:
+			batch = e.drain(batch)
+			e.send(batch)
+			batch = nil
+			close(done)
+		case <-e.closed:
+			return
+		}
+	}
+}
+
+// drain adds the spans waiting in the channel to batch
+func (e *OTLPExporter) drain(batch []SpanData) []SpanData {
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+		default:
+			return batch
+		}
+	}
+}
+
+func (e *OTLPExporter) send(batch []SpanData) {
+	for len(batch) > 0 {
+		n := len(batch)
+		if n > otlpBatchSize {
+			n = otlpBatchSize
+		}
+		err := e.post(batch[:n])
+		if err != nil {
+			e.logger.WithError(err).Warnf("Could not export %d trace spans", n)
+		}
+		batch = batch[n:]
+	}
+}
+
+func (e *OTLPExporter) post(spans []SpanData) error {
+	body, err := json.Marshal(otlpRequest(e.resource, spans))
+	if err != nil {
+		return util.Errorf("Could not marshal trace spans: %s", err)
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the body is read so that the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return util.Errorf("%s responded with %s", e.url, resp.Status)
+	}
+	return nil
+}
+
+// The OTLP JSON encoding of an ExportTraceServiceRequest, with just the fields
+// that p2's spans use. See
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusError      = 2
+)
+
+func otlpRequest(resource map[string]string, spans []SpanData) otlpTraces {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:      span.TraceID,
+			SpanID:       span.SpanID,
+			ParentSpanID: span.ParentSpanID,
+			Name:         span.Name,
+			Kind:         otlpSpanKindInternal,
+			// 64 bit integers are strings in OTLP's JSON encoding
+			Start:      strconv.FormatInt(span.Start.UnixNano(), 10),
+			End:        strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes: otlpAttributes(span.Attributes),
+		}
+		if span.Error != "" {
+			s.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+		encoded = append(encoded, s)
+	}
+	return otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: otlpAttributes(resource)},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/square/p2"},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	encoded := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		encoded = append(encoded, otlpAttribute{Key: key, Value: otlpValue{StringValue: attributes[key]}})
+	}
+	return encoded
+}
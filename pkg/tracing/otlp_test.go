@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan otlpTraces, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Assert(t).AreEqual(r.Header.Get("Content-Type"), "application/json", "should have posted JSON")
+		body, _ := ioutil.ReadAll(r.Body)
+		var traces otlpTraces
+		err := json.Unmarshal(body, &traces)
+		Assert(t).IsNil(err, "should have posted an OTLP request")
+		requests <- traces
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(http.DefaultClient, server.URL+"/v1/traces", map[string]string{"service.name": "p2-preparer"}, logging.DefaultLogger)
+	start := time.Unix(100, 5)
+	exporter.Export(SpanData{
+		TraceID:    "0123456789abcdef0123456789abcdef",
+		SpanID:     "0123456789abcdef",
+		Name:       "deploy",
+		Start:      start,
+		End:        start.Add(time.Second),
+		Attributes: map[string]string{"pod_id": "web"},
+		Error:      "launch failed",
+	})
+	exporter.Close()
+
+	var traces otlpTraces
+	select {
+	case traces = <-requests:
+	default:
+		t.Fatal("the span should have been exported by Close")
+	}
+	Assert(t).AreEqual(len(traces.ResourceSpans), 1, "should have exported one resource")
+	resource := traces.ResourceSpans[0]
+	Assert(t).AreEqual(resource.Resource.Attributes[0].Key, "service.name", "should have exported the resource attributes")
+	span := resource.ScopeSpans[0].Spans[0]
+	Assert(t).AreEqual(span.Name, "deploy", "should have exported the span")
+	Assert(t).AreEqual(span.TraceID, "0123456789abcdef0123456789abcdef", "should have exported the trace ID")
+	Assert(t).AreEqual(span.Start, "100000000005", "times should be nanoseconds since the epoch")
+	Assert(t).AreEqual(span.End, "101000000005", "times should be nanoseconds since the epoch")
+	Assert(t).AreEqual(span.Attributes[0].Value.StringValue, "web", "should have exported the span's attributes")
+	Assert(t).AreEqual(span.Status.Code, otlpStatusError, "a failed span should have an error status")
+	Assert(t).AreEqual(span.Status.Message, "launch failed", "should have exported the failure")
+}
+
+func TestOTLPExporterDropsSpansAfterClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("nothing should have been exported")
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(http.DefaultClient, server.URL, nil, logging.DefaultLogger)
+	exporter.Close()
+	exporter.Export(SpanData{Name: "late"})
+	exporter.Flush()
+	exporter.Close()
+}
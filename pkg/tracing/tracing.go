@@ -0,0 +1,160 @@
+// Package tracing records the steps of deploys as trace spans, so that a
+// slow deploy on a node can be broken down into where its time went. Spans
+// are exported as OpenTelemetry traces by an Exporter such as OTLPExporter.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// SpanData is what is exported of a span once it has ended
+type SpanData struct {
+	// Hex encoded, as in OTLP's JSON encoding
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+
+	// Set if the step the span covers failed
+	Error string
+}
+
+// Exporter sends ended spans to a tracing backend. Export must not block.
+type Exporter interface {
+	Export(span SpanData)
+	Close()
+}
+
+// Tracer starts the traces of a process and hands their spans to an
+// exporter.
+//
+// A nil *Tracer is valid and starts nil spans, which record nothing.
+type Tracer struct {
+	exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Start starts a trace with a root span of the given name
+func (t *Tracer) Start(name string) *Span {
+	return t.StartAt(name, time.Now())
+}
+
+// StartAt starts a trace with a root span that started at start, for traces
+// of work that began before it could be traced
+func (t *Tracer) StartAt(name string, start time.Time) *Span {
+	if t == nil {
+		return nil
+	}
+	return &Span{
+		tracer: t,
+		data: SpanData{
+			TraceID:    newID(16),
+			SpanID:     newID(8),
+			Name:       name,
+			Start:      start,
+			Attributes: make(map[string]string),
+		},
+	}
+}
+
+// Close exports the spans that have ended and stops the exporter
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.exporter.Close()
+}
+
+// Span is a step of a trace. Spans are safe for concurrent use.
+//
+// A nil *Span is valid and records nothing, so that code can be traced
+// without checking whether tracing is enabled.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// Child starts a span for a step of the span's work
+func (s *Span) Child(name string) *Span {
+	return s.ChildAt(name, time.Now())
+}
+
+// ChildAt starts a span for a step of the span's work that started at start
+func (s *Span) ChildAt(name string, start time.Time) *Span {
+	if s == nil {
+		return nil
+	}
+	return &Span{
+		tracer: s.tracer,
+		data: SpanData{
+			TraceID:      s.data.TraceID,
+			SpanID:       newID(8),
+			ParentSpanID: s.data.SpanID,
+			Name:         name,
+			Start:        start,
+			Attributes:   make(map[string]string),
+		},
+	}
+}
+
+// SetAttribute records a property of the span's work
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// End ends the span and exports it. err is the reason the span's work failed,
+// if it did. Only the first call to End has an effect.
+func (s *Span) End(err error) {
+	s.EndAt(time.Now(), err)
+}
+
+// EndAt ends the span as of end
+func (s *Span) EndAt(end time.Time, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = end
+	if err != nil {
+		s.data.Error = err.Error()
+	}
+	data := s.data
+	data.Attributes = make(map[string]string, len(s.data.Attributes))
+	for key, value := range s.data.Attributes {
+		data.Attributes[key] = value
+	}
+	s.mu.Unlock()
+
+	s.tracer.exporter.Export(data)
+}
+
+func newID(size int) string {
+	id := make([]byte, size)
+	// crypto/rand only fails if the system's source of randomness does, in
+	// which case a zero ID just makes for a malformed trace
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+type fakeExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (f *fakeExporter) Export(span SpanData) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.spans = append(f.spans, span)
+}
+
+func (f *fakeExporter) Close() {}
+
+func TestSpansFormATrace(t *testing.T) {
+	exporter := &fakeExporter{}
+	tracer := NewTracer(exporter)
+
+	start := time.Now().Add(-time.Minute)
+	root := tracer.StartAt("deploy", start)
+	root.SetAttribute("pod_id", "web")
+	child := root.Child("install")
+	child.End(errors.New("fetch failed"))
+	root.End(nil)
+
+	Assert(t).AreEqual(len(exporter.spans), 2, "should have exported both spans")
+	install, deploy := exporter.spans[0], exporter.spans[1]
+	Assert(t).AreEqual(install.TraceID, deploy.TraceID, "the child should be in its parent's trace")
+	Assert(t).AreEqual(install.ParentSpanID, deploy.SpanID, "the child's parent should be the root span")
+	Assert(t).AreEqual(deploy.ParentSpanID, "", "the root span should have no parent")
+	Assert(t).AreEqual(len(deploy.TraceID), 32, "trace IDs should be 16 hex encoded bytes")
+	Assert(t).AreEqual(len(deploy.SpanID), 16, "span IDs should be 8 hex encoded bytes")
+	Assert(t).AreEqual(deploy.Start, start, "the root span should have started when it was said to")
+	Assert(t).AreEqual(deploy.Attributes["pod_id"], "web", "should have exported the attribute")
+	Assert(t).AreEqual(install.Error, "fetch failed", "should have recorded the failure")
+	Assert(t).AreEqual(deploy.Error, "", "the root span did not fail")
+}
+
+func TestSpansEndOnce(t *testing.T) {
+	exporter := &fakeExporter{}
+	span := NewTracer(exporter).Start("deploy")
+	span.End(nil)
+	span.End(errors.New("too late"))
+
+	Assert(t).AreEqual(len(exporter.spans), 1, "should have exported the span once")
+	Assert(t).AreEqual(exporter.spans[0].Error, "", "the second End should have had no effect")
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.Start("deploy")
+	Assert(t).IsTrue(span == nil, "a nil tracer should start nil spans")
+	child := span.Child("install")
+	child.SetAttribute("pod_id", "web")
+	child.End(nil)
+	span.End(nil)
+	tracer.Close()
+}
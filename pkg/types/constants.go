@@ -4,4 +4,10 @@ const (
 	AvailabilityZoneLabel = "availability_zone"
 	ClusterNameLabel      = "cluster_name"
 	PodIDLabel            = "pod_id"
+
+	// These labels are synced onto nodes from their cloud provider, see
+	// package cloudlabels
+	InstanceTypeLabel      = "instance_type"
+	InstanceLifecycleLabel = "instance_lifecycle"
+	InstanceStateLabel     = "instance_state"
 )
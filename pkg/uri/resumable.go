@@ -0,0 +1,284 @@
+package uri
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// ResumableFetcher fetches URIs like BasicFetcher, but resumes HTTP downloads
+// that are interrupted with range requests instead of failing them, and can
+// fetch large files in parallel ranges. Servers that don't support range
+// requests are fetched from like BasicFetcher does.
+type ResumableFetcher struct {
+	Client *http.Client
+
+	// MaxResumes is how many times a download (or each of its ranges) may
+	// be resumed after being interrupted
+	MaxResumes int
+	// ResumeDelay is how long to wait before resuming a download
+	ResumeDelay time.Duration
+
+	// Segments, if greater than 1, is the number of ranges that files of at
+	// least SegmentThreshold bytes are fetched in, in parallel. Such files
+	// are fetched to a temporary file before they are read.
+	Segments         int
+	SegmentThreshold int64
+}
+
+var _ Fetcher = ResumableFetcher{}
+var _ Sizer = ResumableFetcher{}
+
+// remoteFile is what is known about a file served over HTTP before fetching
+// its contents
+type remoteFile struct {
+	length       int64
+	acceptRanges bool
+	// an entity tag or modification time, sent in If-Range requests so that
+	// a range of a changed file is not appended to the original's
+	validator string
+}
+
+func remoteFileOf(resp *http.Response) remoteFile {
+	validator := resp.Header.Get("ETag")
+	if validator == "" {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	return remoteFile{
+		length:       resp.ContentLength,
+		acceptRanges: resp.Header.Get("Accept-Ranges") == "bytes" && validator != "",
+		validator:    validator,
+	}
+}
+
+func (f ResumableFetcher) Open(u *url.URL) (io.ReadCloser, error) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return BasicFetcher{Client: f.Client}.Open(u)
+	}
+
+	if f.Segments > 1 {
+		resp, err := f.Client.Head(u.String())
+		if err != nil {
+			return nil, err
+		}
+		_ = resp.Body.Close()
+		file := remoteFileOf(resp)
+		if resp.StatusCode == http.StatusOK && file.acceptRanges && file.length >= f.SegmentThreshold && file.length >= int64(f.Segments) {
+			return f.openSegmented(u, file)
+		}
+	}
+
+	resp, err := f.Client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, util.Errorf(
+			"%q: HTTP server returned status: %s",
+			u.String(),
+			resp.Status,
+		)
+	}
+	file := remoteFileOf(resp)
+	if !file.acceptRanges {
+		return resp.Body, nil
+	}
+	return &resumingBody{
+		fetcher: f,
+		uri:     u,
+		file:    file,
+		body:    resp.Body,
+		end:     file.length - 1,
+	}, nil
+}
+
+func (f ResumableFetcher) Size(u *url.URL) (int64, error) {
+	return BasicFetcher{Client: f.Client}.Size(u)
+}
+
+func (f ResumableFetcher) CopyLocal(srcUri *url.URL, dstPath string) error {
+	return copyLocal(f, srcUri, dstPath)
+}
+
+// openRange requests the bytes of file from start to end inclusive, or to the
+// end of the file if end is negative
+func (f ResumableFetcher) openRange(u *url.URL, file remoteFile, start int64, end int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	byteRange := fmt.Sprintf("bytes=%d-", start)
+	if end >= 0 {
+		byteRange += strconv.FormatInt(end, 10)
+	}
+	req.Header.Set("Range", byteRange)
+	req.Header.Set("If-Range", file.validator)
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		_ = resp.Body.Close()
+		// a full response means that the file changed since it was first
+		// requested
+		return nil, util.Errorf("%q: HTTP server returned status %s for range %s", u.String(), resp.Status, byteRange)
+	}
+	return resp.Body, nil
+}
+
+// resumingBody reads the body of a response, requesting the rest of the file
+// again when the connection is interrupted
+type resumingBody struct {
+	fetcher ResumableFetcher
+	uri     *url.URL
+	file    remoteFile
+
+	body    io.ReadCloser
+	offset  int64
+	end     int64 // the last byte to read, or negative to read to the end
+	resumes int
+}
+
+func (b *resumingBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.offset += int64(n)
+		if err == io.EOF && b.end >= 0 && b.offset <= b.end {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil || err == io.EOF || n > 0 {
+			if err != nil && err != io.EOF {
+				// report the bytes read, and resume on the next Read
+				err = nil
+			}
+			return n, err
+		}
+
+		if b.resumes >= b.fetcher.MaxResumes {
+			return 0, util.Errorf("%q: download interrupted after %d bytes: %s", b.uri.String(), b.offset, err)
+		}
+		b.resumes++
+		_ = b.body.Close()
+		time.Sleep(b.fetcher.ResumeDelay)
+		body, rangeErr := b.fetcher.openRange(b.uri, b.file, b.offset, b.end)
+		if rangeErr != nil {
+			// try again at the next Read, until the resumes run out
+			b.body = errReader{rangeErr}
+			continue
+		}
+		b.body = body
+	}
+}
+
+func (b *resumingBody) Close() error {
+	return b.body.Close()
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func (r errReader) Close() error {
+	return nil
+}
+
+// openSegmented fetches file in parallel ranges to a temporary file, which is
+// removed when the returned reader is closed
+func (f ResumableFetcher) openSegmented(u *url.URL, file remoteFile) (io.ReadCloser, error) {
+	tmpFile, err := ioutil.TempFile("", filepath.Base(u.Path))
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (io.ReadCloser, error) {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+		return nil, err
+	}
+
+	segmentLength := file.length / int64(f.Segments)
+	var wg sync.WaitGroup
+	errs := make(chan error, f.Segments)
+	for i := 0; i < f.Segments; i++ {
+		start := int64(i) * segmentLength
+		end := start + segmentLength - 1
+		if i == f.Segments-1 {
+			end = file.length - 1
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- f.fetchSegment(u, file, tmpFile, start, end)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	_, err = tmpFile.Seek(0, os.SEEK_SET)
+	if err != nil {
+		return fail(err)
+	}
+	return removeOnClose{tmpFile}, nil
+}
+
+func (f ResumableFetcher) fetchSegment(u *url.URL, file remoteFile, dst *os.File, start int64, end int64) error {
+	body, err := f.openRange(u, file, start, end)
+	if err != nil {
+		// retried by the first Read
+		body = errReader{err}
+	}
+	segment := &resumingBody{
+		fetcher: f,
+		uri:     u,
+		file:    file,
+		body:    body,
+		offset:  start,
+		end:     end,
+	}
+	defer segment.Close()
+	_, err = io.Copy(&offsetWriter{file: dst, offset: start}, segment)
+	return err
+}
+
+// offsetWriter writes to a file from an offset, so that the ranges of a file
+// can be written concurrently
+type offsetWriter struct {
+	file   *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.file.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// removeOnClose is a temporary file that is removed when it is closed
+type removeOnClose struct {
+	*os.File
+}
+
+func (r removeOnClose) Close() error {
+	err := r.File.Close()
+	_ = os.Remove(r.File.Name())
+	return err
+}
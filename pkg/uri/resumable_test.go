@@ -0,0 +1,100 @@
+package uri
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+// flakyServer serves content with range support, cutting the connection
+// halfway through the first full response
+type flakyServer struct {
+	content []byte
+
+	mu       sync.Mutex
+	requests []string // the Range header of each GET
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", `"v1"`)
+	if r.Method == "GET" {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Header.Get("Range"))
+		first := len(s.requests) == 1
+		s.mu.Unlock()
+
+		if first && r.Header.Get("Range") == "" {
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				panic(err)
+			}
+			fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nAccept-Ranges: bytes\r\nETag: \"v1\"\r\nContent-Length: %d\r\n\r\n", len(s.content))
+			_, _ = buf.Write(s.content[:len(s.content)/2])
+			_ = buf.Flush()
+			_ = conn.Close()
+			return
+		}
+	}
+	http.ServeContent(w, r, "artifact.tar.gz", time.Time{}, bytes.NewReader(s.content))
+}
+
+func testContent() []byte {
+	content := make([]byte, 100000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func TestResumableFetcherResumesInterruptedDownloads(t *testing.T) {
+	server := &flakyServer{content: testContent()}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	u, err := url.Parse(ts.URL + "/artifact.tar.gz")
+	Assert(t).IsNil(err, "should have parsed server URL")
+
+	fetcher := ResumableFetcher{Client: http.DefaultClient, MaxResumes: 1}
+	body, err := fetcher.Open(u)
+	Assert(t).IsNil(err, "should have opened the artifact")
+	defer body.Close()
+	fetched, err := ioutil.ReadAll(body)
+	Assert(t).IsNil(err, "should have resumed the download")
+	Assert(t).IsTrue(bytes.Equal(fetched, server.content), "should have fetched the whole artifact")
+	Assert(t).AreEqual(len(server.requests), 2, "should have requested the artifact twice")
+	Assert(t).AreEqual(server.requests[1], fmt.Sprintf("bytes=%d-%d", len(server.content)/2, len(server.content)-1), "should have requested the rest of the artifact")
+
+	server.requests = nil
+	fetcher.MaxResumes = 0
+	body, err = fetcher.Open(u)
+	Assert(t).IsNil(err, "should have opened the artifact")
+	defer body.Close()
+	_, err = ioutil.ReadAll(body)
+	Assert(t).IsNotNil(err, "should have failed without resumes")
+}
+
+func TestResumableFetcherFetchesSegmentsInParallel(t *testing.T) {
+	server := &flakyServer{content: testContent()}
+	// no full responses are requested, so none are cut short
+	server.requests = []string{"skip"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	u, err := url.Parse(ts.URL + "/artifact.tar.gz")
+	Assert(t).IsNil(err, "should have parsed server URL")
+
+	fetcher := ResumableFetcher{Client: http.DefaultClient, Segments: 4, SegmentThreshold: 1000}
+	body, err := fetcher.Open(u)
+	Assert(t).IsNil(err, "should have opened the artifact")
+	fetched, err := ioutil.ReadAll(body)
+	Assert(t).IsNil(err, "should have read the artifact")
+	Assert(t).IsNil(body.Close(), "should have removed the fetched artifact")
+	Assert(t).IsTrue(bytes.Equal(fetched, server.content), "should have fetched the whole artifact")
+	Assert(t).AreEqual(len(server.requests), 5, "should have requested each segment")
+}
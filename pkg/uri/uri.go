@@ -22,6 +22,13 @@ type Fetcher interface {
 	CopyLocal(srcUri *url.URL, dstPath string) error
 }
 
+// A Sizer can report the size of the data at a URI without fetching it.
+type Sizer interface {
+	// Returns the size in bytes of the data at the URI, or -1 if it is
+	// unknown.
+	Size(uri *url.URL) (int64, error)
+}
+
 // A default fetcher, if the user doesn't want to set any options.
 var DefaultFetcher Fetcher = BasicFetcher{http.DefaultClient}
 
@@ -69,7 +76,44 @@ func (f BasicFetcher) Open(u *url.URL) (io.ReadCloser, error) {
 	}
 }
 
-func (f BasicFetcher) CopyLocal(srcUri *url.URL, dstPath string) (err error) {
+func (f BasicFetcher) Size(u *url.URL) (int64, error) {
+	switch u.Scheme {
+	case "":
+		info, err := os.Stat(u.String())
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	case "file":
+		info, err := os.Stat(u.Path)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	case "http", "https":
+		resp, err := f.Client.Head(u.String())
+		if err != nil {
+			return 0, err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, util.Errorf(
+				"%q: HTTP server returned status: %s",
+				u.String(),
+				resp.Status,
+			)
+		}
+		return resp.ContentLength, nil
+	default:
+		return 0, util.Errorf("%q: unknown scheme %s", u.String(), u.Scheme)
+	}
+}
+
+func (f BasicFetcher) CopyLocal(srcUri *url.URL, dstPath string) error {
+	return copyLocal(f, srcUri, dstPath)
+}
+
+func copyLocal(f Fetcher, srcUri *url.URL, dstPath string) (err error) {
 	src, err := f.Open(srcUri)
 	if err != nil {
 		return
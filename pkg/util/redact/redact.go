@@ -0,0 +1,88 @@
+// Package redact removes secrets from output that p2 captures from pods and
+// hooks before it is logged or written to Consul.
+package redact
+
+import (
+	"regexp"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// Replacement is substituted for everything a Filter redacts
+const Replacement = "[REDACTED]"
+
+// Config describes what a Filter redacts. It appears as "log_redaction" in
+// both the preparer config, where it applies to every pod, and in pod
+// manifests, where it adds to the preparer's filters for that pod.
+type Config struct {
+	// Patterns are regular expressions. Every match is replaced.
+	Patterns []string `yaml:"patterns,omitempty"`
+
+	// Keys are the names of values to redact wherever they appear as
+	// "key=value", "key: value" or "key": "value", case insensitively.
+	// Only the value is replaced.
+	Keys []string `yaml:"keys,omitempty"`
+}
+
+// Filter redacts text. A nil *Filter is valid and redacts nothing.
+type Filter struct {
+	patterns []*regexp.Regexp
+	keys     []*regexp.Regexp
+}
+
+// New compiles a Filter from config. It returns nil if config has no
+// patterns or keys.
+func New(config Config) (*Filter, error) {
+	if len(config.Patterns) == 0 && len(config.Keys) == 0 {
+		return nil, nil
+	}
+
+	filter := &Filter{}
+	for _, pattern := range config.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, util.Errorf("invalid redaction pattern %q: %s", pattern, err)
+		}
+		filter.patterns = append(filter.patterns, re)
+	}
+	for _, key := range config.Keys {
+		if key == "" {
+			return nil, util.Errorf("redaction keys must not be empty")
+		}
+		// the first group is the key and separator, the second is the
+		// value, which ends at whitespace, a quote or a separator
+		re := regexp.MustCompile(`(?i)(\b` + regexp.QuoteMeta(key) + `["']?\s*[:=]\s*["']?)([^\s"',;&]+)`)
+		filter.keys = append(filter.keys, re)
+	}
+	return filter, nil
+}
+
+// Merge returns a Filter that redacts everything f and other do
+func (f *Filter) Merge(other *Filter) *Filter {
+	switch {
+	case f == nil:
+		return other
+	case other == nil:
+		return f
+	}
+
+	merged := &Filter{}
+	merged.patterns = append(append(merged.patterns, f.patterns...), other.patterns...)
+	merged.keys = append(append(merged.keys, f.keys...), other.keys...)
+	return merged
+}
+
+// Redact returns s with everything matched by the filter replaced
+func (f *Filter) Redact(s string) string {
+	if f == nil || s == "" {
+		return s
+	}
+
+	for _, re := range f.patterns {
+		s = re.ReplaceAllLiteralString(s, Replacement)
+	}
+	for _, re := range f.keys {
+		s = re.ReplaceAllString(s, "${1}"+Replacement)
+	}
+	return s
+}
@@ -0,0 +1,200 @@
+package waitfor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/labels"
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// PodWatcher is the part of consul.Store used by PodInReality
+type PodWatcher interface {
+	WatchPods(
+		podPrefix consul.PodPrefix,
+		nodename types.NodeName,
+		quitChan <-chan struct{},
+		errChan chan<- error,
+		podChan chan<- []consul.ManifestResult,
+	)
+}
+
+// HealthWatcher is the part of checker.ConsulHealthChecker used by
+// HealthPassing
+type HealthWatcher interface {
+	WatchNodeService(
+		nodename types.NodeName,
+		serviceID string,
+		resultCh chan<- health.Result,
+		errCh chan<- error,
+		quitCh <-chan struct{},
+	)
+}
+
+// RollWatcher is the part of rollstore.Store used by RollComplete
+type RollWatcher interface {
+	Watch(quit <-chan struct{}) (<-chan []roll_fields.Update, <-chan error)
+}
+
+// MatchWatcher is the part of labels.Applicator used by LabelApplied
+type MatchWatcher interface {
+	WatchMatches(selector klabels.Selector, labelType labels.Type, aggregationRate time.Duration, quitCh <-chan struct{}) (chan []labels.Labeled, error)
+}
+
+// PodInReality holds while the node's reality has the pod. If sha is not
+// empty, the pod's manifest must also have that SHA, e.g. to wait for a
+// particular deploy to finish.
+func PodInReality(store PodWatcher, node types.NodeName, podID types.PodID, sha string) Condition {
+	description := fmt.Sprintf("%s in reality on %s", podID, node)
+	if sha != "" {
+		description = fmt.Sprintf("%s with sha %s in reality on %s", podID, sha, node)
+	}
+
+	return New(description, func(ctx context.Context, holds chan<- bool) error {
+		podCh := make(chan []consul.ManifestResult)
+		// errors are retried by the watch
+		go store.WatchPods(consul.REALITY_TREE, node, ctx.Done(), discardErrors(ctx), podCh)
+
+		for results := range podCh {
+			found := false
+			for _, result := range results {
+				if result.Manifest.ID() != podID {
+					continue
+				}
+				if sha == "" {
+					found = true
+					break
+				}
+				resultSHA, err := result.Manifest.SHA()
+				if err == nil && resultSHA == sha {
+					found = true
+					break
+				}
+			}
+
+			if !send(ctx, holds, found) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// HealthPassing holds while the pod's health check on the node is passing.
+// Use HeldFor to require it to keep passing.
+func HealthPassing(checker HealthWatcher, node types.NodeName, podID types.PodID) Condition {
+	description := fmt.Sprintf("%s passing its health check on %s", podID, node)
+	return New(description, func(ctx context.Context, holds chan<- bool) error {
+		resultCh := make(chan health.Result)
+		errCh := make(chan error)
+		go func() {
+			checker.WatchNodeService(node, podID.String(), resultCh, errCh, ctx.Done())
+			close(errCh)
+		}()
+
+		// WatchNodeService sends without checking its quit channel, so
+		// both channels are drained until it returns
+		sending := true
+		for {
+			select {
+			case result, ok := <-resultCh:
+				if !ok {
+					return nil
+				}
+				if sending {
+					sending = send(ctx, holds, result.Status == health.Passing)
+				}
+			case _, ok := <-errCh:
+				if !ok {
+					errCh = nil
+				}
+			}
+		}
+	})
+}
+
+// RollComplete holds once the rolling update no longer exists, which is
+// when the roll farm has finished it. It holds immediately for a roll that
+// was never created, so create it before waiting.
+func RollComplete(rolls RollWatcher, id roll_fields.ID) Condition {
+	description := fmt.Sprintf("roll %s to complete", id)
+	return New(description, func(ctx context.Context, holds chan<- bool) error {
+		updateCh, errCh := rolls.Watch(ctx.Done())
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case updates, ok := <-updateCh:
+				if !ok {
+					return nil
+				}
+				complete := true
+				for _, update := range updates {
+					if update.ID() == id {
+						complete = false
+						break
+					}
+				}
+				if !send(ctx, holds, complete) {
+					return nil
+				}
+			case <-errCh:
+				// errors are retried by the watch
+			}
+		}
+	})
+}
+
+// LabelApplied holds while the labeled object has the label name=value
+func LabelApplied(watcher MatchWatcher, labelType labels.Type, id string, name string, value string) Condition {
+	description := fmt.Sprintf("%s %s labeled %s=%s", labelType, id, name, value)
+	return New(description, func(ctx context.Context, holds chan<- bool) error {
+		selector := klabels.Everything().Add(name, klabels.EqualsOperator, []string{value})
+		matchCh, err := watcher.WatchMatches(selector, labelType, 0, ctx.Done())
+		if err != nil {
+			return err
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case matches, ok := <-matchCh:
+				if !ok {
+					return nil
+				}
+				applied := false
+				for _, match := range matches {
+					if match.ID == id {
+						applied = true
+						break
+					}
+				}
+				if !send(ctx, holds, applied) {
+					return nil
+				}
+			}
+		}
+	})
+}
+
+// discardErrors returns a channel whose errors are dropped until ctx is done
+func discardErrors(ctx context.Context) chan<- error {
+	errCh := make(chan error)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-errCh:
+			}
+		}
+	}()
+	return errCh
+}
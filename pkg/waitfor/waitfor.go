@@ -0,0 +1,234 @@
+// Package waitfor waits for things to happen in a p2 cluster, such as a pod
+// appearing in reality or passing its health check, for use by tests and
+// deploy tooling. Conditions are built on the store watch APIs wherever one
+// exists and can be combined with All, Any and HeldFor.
+package waitfor
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// Condition is something to wait for
+type Condition struct {
+	description string
+	watch       func(ctx context.Context, holds chan<- bool) error
+}
+
+// New returns a Condition that is checked by watch. watch must send whether
+// the condition holds every time that may have changed, with the first send
+// as soon as it is known, until ctx is done. If it can no longer tell, it
+// returns an error, which ends the wait.
+func New(description string, watch func(ctx context.Context, holds chan<- bool) error) Condition {
+	return Condition{
+		description: description,
+		watch:       watch,
+	}
+}
+
+// Poll returns a Condition that calls check immediately and then every
+// interval. It is for things that can't be watched, like whether a port is
+// open.
+func Poll(description string, interval time.Duration, check func() bool) Condition {
+	return New(description, func(ctx context.Context, holds chan<- bool) error {
+		for {
+			if !send(ctx, holds, check()) {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(interval):
+			}
+		}
+	})
+}
+
+func (c Condition) String() string {
+	return c.description
+}
+
+// run is watch, with a watch that ends early treated as an error
+func (c Condition) run(ctx context.Context, holds chan<- bool) error {
+	err := c.watch(ctx, holds)
+	if err == nil && ctx.Err() == nil {
+		err = util.Errorf("watch for %s ended unexpectedly", c)
+	}
+	return err
+}
+
+// Wait blocks until cond holds. It returns an error if ctx is done or cond
+// fails first.
+func Wait(ctx context.Context, cond Condition) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	holds := make(chan bool)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- cond.run(ctx, holds)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return util.Errorf("gave up waiting for %s: %s", cond, ctx.Err())
+		case err := <-errCh:
+			if ctx.Err() != nil {
+				return util.Errorf("gave up waiting for %s: %s", cond, ctx.Err())
+			}
+			return util.Errorf("could not wait for %s: %s", cond, err)
+		case ok := <-holds:
+			if ok {
+				return nil
+			}
+		}
+	}
+}
+
+// WaitTimeout is Wait with a timeout
+func WaitTimeout(timeout time.Duration, cond Condition) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return Wait(ctx, cond)
+}
+
+// All returns a Condition that holds while all of conds hold
+func All(conds ...Condition) Condition {
+	return combine(" and ", conds, func(states []bool) bool {
+		for _, state := range states {
+			if !state {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Any returns a Condition that holds while any of conds holds
+func Any(conds ...Condition) Condition {
+	return combine(" or ", conds, func(states []bool) bool {
+		for _, state := range states {
+			if state {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// HeldFor returns a Condition that holds once cond has held continuously for
+// duration, e.g. to make sure a pod stays healthy rather than passing a
+// single check.
+func HeldFor(duration time.Duration, cond Condition) Condition {
+	description := cond.String() + " for " + duration.String()
+	return New(description, func(ctx context.Context, holds chan<- bool) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		condHolds := make(chan bool)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- cond.run(ctx, condHolds)
+		}()
+
+		held := false
+		var heldLongEnough <-chan time.Time
+		for {
+			var state bool
+			select {
+			case <-ctx.Done():
+				return nil
+			case err := <-errCh:
+				return err
+			case ok := <-condHolds:
+				if !ok {
+					held = false
+					heldLongEnough = nil
+				} else if !held && heldLongEnough == nil {
+					heldLongEnough = time.After(duration)
+				}
+				state = held
+			case <-heldLongEnough:
+				held = true
+				heldLongEnough = nil
+				state = true
+			}
+
+			if !send(ctx, holds, state) {
+				return nil
+			}
+		}
+	})
+}
+
+func combine(separator string, conds []Condition, combined func(states []bool) bool) Condition {
+	descriptions := make([]string, len(conds))
+	for i, cond := range conds {
+		descriptions[i] = cond.String()
+	}
+
+	return New("("+strings.Join(descriptions, separator)+")", func(ctx context.Context, holds chan<- bool) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type update struct {
+			index int
+			holds bool
+		}
+		updates := make(chan update)
+		errCh := make(chan error, len(conds))
+		for i, cond := range conds {
+			condHolds := make(chan bool)
+			go func(cond Condition) {
+				errCh <- cond.run(ctx, condHolds)
+			}(cond)
+			go func(index int) {
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case ok := <-condHolds:
+						select {
+						case <-ctx.Done():
+							return
+						case updates <- update{index: index, holds: ok}:
+						}
+					}
+				}
+			}(i)
+		}
+
+		states := make([]bool, len(conds))
+		if !send(ctx, holds, combined(states)) {
+			return nil
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case err := <-errCh:
+				return err
+			case u := <-updates:
+				states[u.index] = u.holds
+				if !send(ctx, holds, combined(states)) {
+					return nil
+				}
+			}
+		}
+	})
+}
+
+// send sends state on holds, returning false if ctx was done first
+func send(ctx context.Context, holds chan<- bool, state bool) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case holds <- state:
+		return true
+	}
+}
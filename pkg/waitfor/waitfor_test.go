@@ -0,0 +1,161 @@
+package waitfor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/labels"
+	roll_fields "github.com/square/p2/pkg/roll/fields"
+
+	. "github.com/anthonybishopric/gotcha"
+)
+
+// switchable is a condition whose state is set by the test
+type switchable struct {
+	mu    sync.Mutex
+	state bool
+}
+
+func (s *switchable) set(state bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+}
+
+func (s *switchable) condition(description string) Condition {
+	return Poll(description, time.Millisecond, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.state
+	})
+}
+
+// counter counts calls to a Poll check, which may still be running after
+// Wait returns
+type counter struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *counter) inc() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return c.calls
+}
+
+func (c *counter) get() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+func TestWaitReturnsOnceConditionHolds(t *testing.T) {
+	calls := &counter{}
+	cond := Poll("third call", time.Millisecond, func() bool {
+		return calls.inc() >= 3
+	})
+
+	err := WaitTimeout(5*time.Second, cond)
+	Assert(t).IsNil(err, "should not have erred waiting for the condition")
+	Assert(t).IsTrue(calls.get() >= 3, "should have polled until the condition held")
+}
+
+func TestWaitTimesOut(t *testing.T) {
+	never := Poll("never", time.Millisecond, func() bool { return false })
+	err := WaitTimeout(10*time.Millisecond, never)
+	Assert(t).IsNotNil(err, "should have erred when the condition never held")
+}
+
+func TestWaitErrsIfWatchEnds(t *testing.T) {
+	ended := New("ended", func(ctx context.Context, holds chan<- bool) error {
+		return nil
+	})
+	err := WaitTimeout(5*time.Second, ended)
+	Assert(t).IsNotNil(err, "should have erred when the watch ended without the condition holding")
+}
+
+func TestAllAndAny(t *testing.T) {
+	a, b := &switchable{}, &switchable{}
+	a.set(true)
+
+	err := WaitTimeout(20*time.Millisecond, All(a.condition("a"), b.condition("b")))
+	Assert(t).IsNotNil(err, "All should not hold while one condition doesn't")
+
+	err = WaitTimeout(5*time.Second, Any(a.condition("a"), b.condition("b")))
+	Assert(t).IsNil(err, "Any should hold while one condition does")
+
+	b.set(true)
+	err = WaitTimeout(5*time.Second, All(a.condition("a"), b.condition("b")))
+	Assert(t).IsNil(err, "All should hold once every condition does")
+
+	err = WaitTimeout(5*time.Second, All())
+	Assert(t).IsNil(err, "All of no conditions should hold")
+}
+
+func TestHeldForRestartsWhenConditionStopsHolding(t *testing.T) {
+	calls := &counter{}
+	// flaps until the tenth call, then keeps holding
+	cond := Poll("flapping", time.Millisecond, func() bool {
+		n := calls.inc()
+		return n >= 10 || n%2 == 0
+	})
+
+	start := time.Now()
+	err := WaitTimeout(5*time.Second, HeldFor(20*time.Millisecond, cond))
+	Assert(t).IsNil(err, "should not have erred waiting for the condition to be held")
+	Assert(t).IsTrue(calls.get() > 10, "should not have held until the condition stopped flapping")
+	Assert(t).IsTrue(time.Since(start) >= 20*time.Millisecond, "should have waited for the duration")
+}
+
+func TestLabelApplied(t *testing.T) {
+	applicator := labels.NewFakeApplicator()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = applicator.SetLabel(labels.NODE, "node1", "test", "yes")
+	}()
+
+	err := WaitTimeout(5*time.Second, LabelApplied(applicator, labels.NODE, "node1", "test", "yes"))
+	Assert(t).IsNil(err, "should not have erred waiting for the label")
+}
+
+type fakeRollWatcher struct {
+	updates [][]roll_fields.Update
+}
+
+func (f fakeRollWatcher) Watch(quit <-chan struct{}) (<-chan []roll_fields.Update, <-chan error) {
+	updateCh := make(chan []roll_fields.Update)
+	go func() {
+		defer close(updateCh)
+		for _, updates := range f.updates {
+			select {
+			case <-quit:
+				return
+			case updateCh <- updates:
+			}
+		}
+		<-quit
+	}()
+	return updateCh, make(chan error)
+}
+
+func TestRollComplete(t *testing.T) {
+	roll := roll_fields.Update{NewRC: "new"}
+	other := roll_fields.Update{NewRC: "other"}
+	rolls := fakeRollWatcher{
+		updates: [][]roll_fields.Update{
+			{roll, other},
+			{roll, other},
+			{other},
+		},
+	}
+
+	err := WaitTimeout(5*time.Second, RollComplete(rolls, roll.ID()))
+	Assert(t).IsNil(err, "should not have erred waiting for the roll to complete")
+
+	rolls = fakeRollWatcher{updates: [][]roll_fields.Update{{roll, other}}}
+	err = WaitTimeout(20*time.Millisecond, RollComplete(rolls, roll.ID()))
+	Assert(t).IsNotNil(err, "should have timed out while the roll exists")
+}
@@ -5,24 +5,37 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/rcrowley/go-metrics"
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	p2metrics "github.com/square/p2/pkg/metrics"
 	"github.com/square/p2/pkg/preparer"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/util/param"
 )
 
 // These constants should probably all be something the p2 user can set
 // in their preparer config...
 
-// Duration between health checks
+// Duration between health checks, unless the preparer config sets a
+// health_check_interval
 const HEALTHCHECK_INTERVAL = 1 * time.Second
 
 // Maximum allowed time for a single check, in seconds
 var HEALTHCHECK_TIMEOUT = param.Int64("healthcheck_timeout", 5)
 
+// Each health check is timed, and counted by its result in a
+// "health_checks_<status>" counter, or in the error counter if it couldn't be
+// run
+const (
+	HealthCheckDurationMetric = "health_check_duration"
+	HealthCheckErrorsMetric   = "health_check_errors"
+)
+
 // Contains method for watching the consul reality store to
 // track services running on a node. A manager method:
 // MonitorPodHealth tracks the reality store and manages
@@ -37,6 +50,24 @@ type PodWatch struct {
 	manifest      manifest.Manifest
 	updater       consul.HealthUpdater
 	statusChecker StatusChecker
+	// The port that the pod's status is checked on, which may have been
+	// allocated by the preparer
+	statusPort int
+
+	// If non-nil, notified of each passing health check
+	observer HealthPassObserver
+
+	// Node labels attached to each health result. May be nil.
+	nodeLabels *preparer.NodeLabelSnapshot
+
+	// Once the node is leaving, the pod is reported as critical so that
+	// traffic moves off it before it is halted. May be nil.
+	termination *preparer.TerminationHandler
+
+	// Returns how long to wait between health checks, which can change
+	// when the preparer's config is reloaded. If nil, or if it returns 0,
+	// HEALTHCHECK_INTERVAL is used.
+	interval func() time.Duration
 
 	// For tracking/controlling the go routine that performs health checks
 	// on the pod associated with this PodWatch
@@ -54,25 +85,47 @@ type StatusChecker struct {
 	Client *http.Client
 }
 
+// HealthPassObserver is notified each time a pod's health check passes. The
+// preparer uses this to measure how long deploys take to become healthy.
+type HealthPassObserver interface {
+	Healthy(podID types.PodID, at time.Time)
+}
+
 // MonitorPodHealth is meant to be a long running go routine.
 // MonitorPodHealth reads from a consul store to determine which
 // services should be running on the host. MonitorPodHealth
 // runs a CheckHealth routine to monitor the health of each
 // service and kills routines for services that should no
 // longer be running.
-func MonitorPodHealth(config *preparer.PreparerConfig, logger *logging.Logger, shutdownCh chan struct{}) {
+//
+// MonitorPodHealth is safe to restart after it panics or returns an error:
+// the reality watch and all per-pod health checking goroutines are shut down
+// as it unwinds. It returns nil once shutdownCh is closed.
+// observer, nodeLabels and termination may be nil.
+func MonitorPodHealth(config *preparer.PreparerConfig, observer HealthPassObserver, nodeLabels *preparer.NodeLabelSnapshot, termination *preparer.TerminationHandler, logger *logging.Logger, shutdownCh <-chan struct{}) error {
 	client, err := config.GetConsulClient()
 	if err != nil {
 		// A bad config should have already produced a nice, user-friendly error message.
-		logger.WithError(err).Fatalln("error creating health monitor KV client")
+		return util.Errorf("error creating health monitor KV client: %s", err)
+	}
+	watchDispatcher, err := config.GetWatchDispatcher()
+	if err != nil {
+		return util.Errorf("error creating health monitor KV client: %s", err)
 	}
-	store := consul.NewConsulStore(client)
+	store := consul.NewConsulStoreWithWatcher(client, watchDispatcher)
 	healthManager := store.NewHealthManager(config.NodeName, *logger)
 
 	node := config.NodeName
 	pods := []PodWatch{}
 
 	watchQuitCh := make(chan struct{})
+	defer func() {
+		for _, pod := range pods {
+			pod.shutdownCh <- true
+		}
+		close(watchQuitCh)
+		healthManager.Close()
+	}()
 	watchErrCh := make(chan error)
 	watchPodCh := make(chan []consul.ManifestResult)
 	go store.WatchPods(
@@ -84,15 +137,15 @@ func MonitorPodHealth(config *preparer.PreparerConfig, logger *logging.Logger, s
 	)
 
 	// if GetClient fails it means the certfile/keyfile/cafile were
-	// invalid or did not exist. It makes sense to throw a fatal error
+	// invalid or did not exist
 	secureClient, err := config.GetClient(time.Duration(*HEALTHCHECK_TIMEOUT) * time.Second)
 	if err != nil {
-		logger.WithError(err).Fatalln("failed to get http client for this preparer")
+		return util.Errorf("failed to get http client for this preparer: %s", err)
 	}
 
 	insecureClient, err := config.GetInsecureClient(time.Duration(*HEALTHCHECK_TIMEOUT) * time.Second)
 	if err != nil {
-		logger.WithError(err).Fatalln("failed to get http client for this preparer")
+		return util.Errorf("failed to get http client for this preparer: %s", err)
 	}
 
 	for {
@@ -101,16 +154,12 @@ func MonitorPodHealth(config *preparer.PreparerConfig, logger *logging.Logger, s
 			// check if pods have been added or removed
 			// starts monitor routine for new pods
 			// kills monitor routine for removed pods
-			pods = updatePods(healthManager, secureClient, insecureClient, pods, results, node, logger)
+			ports := allocatedStatusPorts(store, node, results, logger)
+			pods = updatePods(healthManager, secureClient, insecureClient, observer, nodeLabels, termination, config.CurrentHealthCheckInterval, pods, results, ports, node, logger)
 		case err := <-watchErrCh:
 			logger.WithError(err).Errorln("there was an error reading reality manifests for health monitor")
 		case <-shutdownCh:
-			for _, pod := range pods {
-				pod.shutdownCh <- true
-			}
-			close(watchQuitCh)
-			healthManager.Close()
-			return
+			return nil
 		}
 	}
 }
@@ -121,8 +170,13 @@ func updatePods(
 	healthManager consul.HealthManager,
 	secureClient *http.Client,
 	insecureClient *http.Client,
+	observer HealthPassObserver,
+	nodeLabels *preparer.NodeLabelSnapshot,
+	termination *preparer.TerminationHandler,
+	interval func() time.Duration,
 	current []PodWatch,
 	reality []consul.ManifestResult,
+	allocatedPorts map[types.PodID]int,
 	node types.NodeName,
 	logger *logging.Logger,
 ) []PodWatch {
@@ -139,7 +193,7 @@ func updatePods(
 				man.Manifest.GetStatusHTTP() == pod.manifest.GetStatusHTTP() &&
 				man.Manifest.GetStatusLocalhostOnly() == pod.manifest.GetStatusLocalhostOnly() &&
 				man.Manifest.GetStatusPath() == pod.manifest.GetStatusPath() &&
-				man.Manifest.GetStatusPort() == pod.manifest.GetStatusPort() {
+				statusPort(man.Manifest, allocatedPorts) == pod.statusPort {
 				inReality = true
 				break
 			}
@@ -187,17 +241,23 @@ func updatePods(
 				Node:   node,
 				Client: client,
 			}
-			if man.Manifest.GetStatusPort() == 0 {
+			port := statusPort(man.Manifest, allocatedPorts)
+			if port == 0 {
 				sc.URI = ""
 			} else if man.Manifest.GetStatusHTTP() {
-				sc.URI = fmt.Sprintf("http://%s:%d%s", statusHost, man.Manifest.GetStatusPort(), man.Manifest.GetStatusPath())
+				sc.URI = fmt.Sprintf("http://%s:%d%s", statusHost, port, man.Manifest.GetStatusPath())
 			} else {
-				sc.URI = fmt.Sprintf("https://%s:%d%s", statusHost, man.Manifest.GetStatusPort(), man.Manifest.GetStatusPath())
+				sc.URI = fmt.Sprintf("https://%s:%d%s", statusHost, port, man.Manifest.GetStatusPath())
 			}
 			newPod := PodWatch{
 				manifest:      man.Manifest,
 				updater:       healthManager.NewUpdater(man.Manifest.ID(), string(man.Manifest.ID())),
 				statusChecker: sc,
+				statusPort:    port,
+				observer:      observer,
+				nodeLabels:    nodeLabels,
+				termination:   termination,
+				interval:      interval,
 				shutdownCh:    make(chan bool, 1),
 				logger:        logger,
 			}
@@ -210,15 +270,56 @@ func updatePods(
 	return newCurrent
 }
 
+// realityMetadataReader reads the deploy metadata of pods in the reality tree
+type realityMetadataReader interface {
+	RealityMetadata(node types.NodeName, podID types.PodID) (consul.RealityMetadata, error)
+}
+
+// allocatedStatusPorts returns the status ports that the preparer allocated
+// to the reality pods whose status is checked on a launchable's auto port
+func allocatedStatusPorts(store realityMetadataReader, node types.NodeName, reality []consul.ManifestResult, logger *logging.Logger) map[types.PodID]int {
+	ports := make(map[types.PodID]int)
+	for _, man := range reality {
+		if man.PodUniqueKey != "" || man.Manifest.GetStatusPortLaunchable() == "" {
+			continue
+		}
+		metadata, err := store.RealityMetadata(node, man.Manifest.ID())
+		if err != nil {
+			logger.WithErrorAndFields(err, logrus.Fields{"pod": man.Manifest.ID()}).Warnln("Could not read the allocated status port")
+			continue
+		}
+		ports[man.Manifest.ID()] = metadata.StatusPort(man.Manifest)
+	}
+	return ports
+}
+
+// statusPort returns the port that a reality pod's status is checked on, or 0
+// if it has none
+func statusPort(podManifest manifest.Manifest, allocatedPorts map[types.PodID]int) int {
+	if podManifest.GetStatusPortLaunchable() != "" {
+		return allocatedPorts[podManifest.ID()]
+	}
+	return podManifest.GetStatusPort()
+}
+
+func (p *PodWatch) checkInterval() time.Duration {
+	if p.interval != nil {
+		if interval := p.interval(); interval > 0 {
+			return interval
+		}
+	}
+	return HEALTHCHECK_INTERVAL
+}
+
 // Monitor Health is a go routine that runs as long as the
-// service it is monitoring. Every HEALTHCHECK_INTERVAL it
+// service it is monitoring. Every check interval it
 // performs a health check and writes that information to
 // consul
 func (p *PodWatch) MonitorHealth() {
 	for {
 		select {
-		case <-time.After(HEALTHCHECK_INTERVAL):
-			p.checkHealth()
+		case <-time.After(p.checkInterval()):
+			p.safeCheckHealth()
 		case <-p.shutdownCh:
 			p.updater.Close()
 			return
@@ -226,16 +327,40 @@ func (p *PodWatch) MonitorHealth() {
 	}
 }
 
+// safeCheckHealth runs a single health check, recovering from any panic so
+// that a misbehaving check can't take down the rest of the preparer.
+func (p *PodWatch) safeCheckHealth() {
+	defer func() {
+		if r := recover(); r != nil {
+			p.logger.WithField("panic", fmt.Sprint(r)).Errorln("health check panicked")
+		}
+	}()
+	p.checkHealth()
+}
+
 func (p *PodWatch) checkHealth() {
-	health, err := p.statusChecker.Check()
+	start := time.Now()
+	res, err := p.statusChecker.Check()
+	metrics.GetOrRegisterTimer(HealthCheckDurationMetric, p2metrics.Registry).UpdateSince(start)
 	if err != nil {
+		metrics.GetOrRegisterCounter(HealthCheckErrorsMetric, p2metrics.Registry).Inc(1)
 		p.logger.WithError(err).Warningln("health check failed")
 		return
 	}
+	if p.termination.Leaving() {
+		res.Status = health.Critical
+	}
+	metrics.GetOrRegisterCounter(fmt.Sprintf("health_checks_%s", res.Status), p2metrics.Registry).Inc(1)
 
-	if err = p.updater.PutHealth(resToConsulRes(health)); err != nil {
+	consulRes := resToConsulRes(res)
+	consulRes.NodeLabels = p.nodeLabels.String()
+	if err = p.updater.PutHealth(consulRes); err != nil {
 		p.logger.WithError(err).Warningln("failed to write health")
 	}
+
+	if p.observer != nil && res.Status == health.Passing {
+		p.observer.Healthy(p.manifest.ID(), time.Now())
+	}
 }
 
 // Given the result of a status check this method
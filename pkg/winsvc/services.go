@@ -0,0 +1,210 @@
+// Package winsvc runs the services of p2 launchables as Windows services, for
+// Windows nodes, which have neither runit nor systemd. Backend registers a
+// service with the Windows Service Manager for each servicebuilder template of
+// runit.ServiceBuilder, and SV controls the resulting services the way runit.SV
+// controls runit services. Both drive the Service Manager with sc.exe.
+//
+// Windows services must answer the Service Manager's control requests, which
+// ordinary programs don't, so each service runs its command under
+// ServiceWrapper, a program such as WinSW or NSSM that does so on the command's
+// behalf and is given the command as its arguments.
+package winsvc
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+)
+
+var (
+	// ScPath is the full path of the "sc.exe" binary.
+	ScPath = param.String("sc_path", `C:\Windows\System32\sc.exe`)
+
+	// ServiceWrapper is the full path of the program that runs the commands
+	// of services on behalf of the Service Manager.
+	ServiceWrapper = param.String("windows_service_wrapper", `C:\p2\bin\p2-service-wrapper.exe`)
+
+	// ServiceRoot is the directory that the command line of each service is
+	// recorded in, so that the services p2 registered can be found when
+	// pruning.
+	ServiceRoot = param.String("windows_service_root", `C:\p2\services`)
+)
+
+// The services of p2 are named p2-<service name>, so that they can be told
+// apart from the node's other services. Their command lines are recorded in
+// ServiceRoot in p2-<service name>.cmd.
+const (
+	servicePrefix = "p2-"
+	recordSuffix  = ".cmd"
+)
+
+// ServiceName returns the name of the Windows service of a runit service.
+func ServiceName(serviceName string) string {
+	return servicePrefix + serviceName
+}
+
+// Backend is a runit.ServiceBackend that registers a Windows service for each
+// servicebuilder template.
+type Backend struct {
+	ServiceRoot string // the directory to record the services' command lines in
+	Sc          string // the path of sc.exe
+	Wrapper     string // the path of the service wrapper
+}
+
+var _ runit.ServiceBackend = Backend{}
+
+// NewBackend returns a Backend using the configured ServiceRoot, ScPath and
+// ServiceWrapper.
+func NewBackend() Backend {
+	return Backend{
+		ServiceRoot: *ServiceRoot,
+		Sc:          *ScPath,
+		Wrapper:     *ServiceWrapper,
+	}
+}
+
+// NewServiceBuilder returns a copy of builder that runs its services as Windows
+// services.
+func NewServiceBuilder(builder *runit.ServiceBuilder) *runit.ServiceBuilder {
+	windowsBuilder := *builder
+	windowsBuilder.Backend = NewBackend()
+	return &windowsBuilder
+}
+
+func (b Backend) sc(args ...string) (string, error) {
+	output, err := exec.Command(b.Sc, args...).CombinedOutput()
+	if err != nil {
+		return string(output), util.Errorf("Could not run sc.exe %s: %s, Output: %s", strings.Join(args, " "), err, output)
+	}
+	return string(output), nil
+}
+
+func (b Backend) recordPath(serviceName string) string {
+	return filepath.Join(b.ServiceRoot, ServiceName(serviceName)+recordSuffix)
+}
+
+// Activate registers the service of each template, or updates its command line
+// if it changed. Services that should always be running start on boot and are
+// restarted by the Service Manager when they exit; like runit services with a
+// down file, the others are only started by their launchable.
+func (b Backend) Activate(templates map[string]runit.ServiceTemplate) error {
+	for serviceName, template := range templates {
+		if len(template.Run) == 0 {
+			return util.Errorf("empty run command for %s", serviceName)
+		}
+		binPath := quoteCommand(append([]string{b.Wrapper}, template.Run...))
+
+		recorded, err := ioutil.ReadFile(b.recordPath(serviceName))
+		switch {
+		case err == nil && string(recorded) == binPath:
+			continue
+		case err == nil:
+			err = b.configure("config", serviceName, binPath, template)
+		case os.IsNotExist(err):
+			err = b.configure("create", serviceName, binPath, template)
+		}
+		if err != nil {
+			return err
+		}
+
+		// recorded last, so that a service that failed to register is
+		// registered again by the next activation
+		_, err = util.WriteIfChanged(b.recordPath(serviceName), []byte(binPath), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configure creates or reconfigures (according to verb) the Windows service of
+// a template
+func (b Backend) configure(verb string, serviceName string, binPath string, template runit.ServiceTemplate) error {
+	start := "demand"
+	if template.RestartPolicy == runit.RestartPolicyAlways {
+		start = "auto"
+	}
+	_, err := b.sc(verb, ServiceName(serviceName), "binPath=", binPath, "start=", start, "DisplayName=", "p2 service "+serviceName)
+	if err != nil {
+		return err
+	}
+	if template.RestartPolicy != runit.RestartPolicyAlways {
+		return nil
+	}
+
+	// the same default delay as the run scripts of runit services, to reduce
+	// spinning on a broken service
+	sleep := 2
+	if template.Sleep != nil && *template.Sleep >= 0 {
+		sleep = *template.Sleep
+	}
+	restart := "restart/" + strconv.Itoa(sleep*1000)
+	_, err = b.sc("failure", ServiceName(serviceName), "reset=", "0", "actions=", restart+"/"+restart+"/"+restart)
+	return err
+}
+
+// Prune stops and deletes the Windows service of every p2 service that isn't
+// one of templates.
+func (b Backend) Prune(templates map[string]runit.ServiceTemplate) error {
+	entries, err := ioutil.ReadDir(b.ServiceRoot)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, servicePrefix) || !strings.HasSuffix(name, recordSuffix) {
+			continue
+		}
+		serviceName := strings.TrimSuffix(strings.TrimPrefix(name, servicePrefix), recordSuffix)
+		if _, exists := templates[serviceName]; exists {
+			continue
+		}
+
+		// stopping fails if the service isn't running, which is fine
+		_, _ = b.sc("stop", ServiceName(serviceName))
+		if _, err := b.sc("delete", ServiceName(serviceName)); err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(b.ServiceRoot, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteCommand formats a command line the way Windows programs split it into
+// arguments, quoting each argument and escaping the quotes and the backslashes
+// before them.
+func quoteCommand(command []string) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		var quotedArg []byte
+		backslashes := 0
+		for j := 0; j < len(arg); j++ {
+			switch arg[j] {
+			case '\\':
+				backslashes++
+			case '"':
+				// the backslashes before a quote are escaped, and so
+				// is the quote
+				quotedArg = append(quotedArg, strings.Repeat(`\`, backslashes+1)...)
+				backslashes = 0
+			default:
+				backslashes = 0
+			}
+			quotedArg = append(quotedArg, arg[j])
+		}
+		// as are the backslashes before the closing quote
+		quotedArg = append(quotedArg, strings.Repeat(`\`, backslashes)...)
+		quoted[i] = `"` + string(quotedArg) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
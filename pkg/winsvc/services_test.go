@@ -0,0 +1,126 @@
+package winsvc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/runit"
+)
+
+// testSc writes a script that records the arguments of each sc.exe command in
+// the returned file and prints output, if any
+func testSc(t *testing.T, root string, output string) (string, string) {
+	argsFile := filepath.Join(root, "sc_args")
+	script := filepath.Join(root, "sc")
+	contents := "#!/bin/sh\nprintf '%s\\n' \"$*\" >> " + argsFile + "\n"
+	if output != "" {
+		contents += "cat <<'EOF'\n" + output + "\nEOF\n"
+	}
+	err := ioutil.WriteFile(script, []byte(contents), 0755)
+	Assert(t).IsNil(err, "could not write fake sc.exe")
+	return script, argsFile
+}
+
+func readCommands(t *testing.T, argsFile string) []string {
+	args, err := ioutil.ReadFile(argsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	Assert(t).IsNil(err, "could not read sc.exe commands")
+	return strings.Split(strings.TrimSpace(string(args)), "\n")
+}
+
+func TestQuoteCommand(t *testing.T) {
+	quoted := quoteCommand([]string{`C:\p2\wrapper.exe`, "--name=a b", `say "hi"`, `C:\dir\`, `a\"b`})
+	Assert(t).AreEqual(quoted, `"C:\p2\wrapper.exe" "--name=a b" "say \"hi\"" "C:\dir\\" "a\\\"b"`, "unexpected quoting")
+}
+
+func TestBackendActivateAndPrune(t *testing.T) {
+	root, err := ioutil.TempDir("", "winsvc_backend")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	defer os.RemoveAll(root)
+	sc, argsFile := testSc(t, root, "")
+	serviceRoot := filepath.Join(root, "services")
+	Assert(t).IsNil(os.Mkdir(serviceRoot, 0755), "could not create service directory")
+
+	builder := &runit.ServiceBuilder{
+		ConfigRoot:  filepath.Join(root, "config"),
+		StagingRoot: filepath.Join(root, "staging"),
+		RunitRoot:   filepath.Join(root, "service"),
+		Backend:     Backend{ServiceRoot: serviceRoot, Sc: sc, Wrapper: "wrapper.exe"},
+	}
+	for _, dir := range []string{builder.ConfigRoot, builder.StagingRoot, builder.RunitRoot} {
+		Assert(t).IsNil(os.Mkdir(dir, 0755), "could not create servicebuilder directory")
+	}
+
+	templates := map[string]runit.ServiceTemplate{
+		"app__web": {
+			Run:           []string{`C:\data\app\bin\launch.exe`},
+			RestartPolicy: runit.RestartPolicyAlways,
+		},
+	}
+	err = builder.Activate("app", templates)
+	Assert(t).IsNil(err, "activate should have succeeded")
+	Assert(t).AreEqual(strings.Join(readCommands(t, argsFile), "; "),
+		`create p2-app__web binPath= "wrapper.exe" "C:\data\app\bin\launch.exe" start= auto DisplayName= p2 service app__web; `+
+			`failure p2-app__web reset= 0 actions= restart/2000/restart/2000/restart/2000`,
+		"unexpected sc.exe commands")
+	_, err = os.Stat(filepath.Join(builder.RunitRoot, "app__web"))
+	Assert(t).IsTrue(os.IsNotExist(err), "should not have activated a runit service")
+
+	// activating an unchanged service doesn't reconfigure it
+	Assert(t).IsNil(os.Remove(argsFile), "could not reset sc.exe commands")
+	err = builder.Activate("app", templates)
+	Assert(t).IsNil(err, "activate should have succeeded")
+	Assert(t).AreEqual(len(readCommands(t, argsFile)), 0, "should not have run sc.exe")
+
+	templates["app__web"] = runit.ServiceTemplate{Run: []string{`C:\data\app\bin\launch2.exe`}}
+	err = builder.Activate("app", templates)
+	Assert(t).IsNil(err, "activate should have succeeded")
+	Assert(t).AreEqual(strings.Join(readCommands(t, argsFile), "; "),
+		`config p2-app__web binPath= "wrapper.exe" "C:\data\app\bin\launch2.exe" start= demand DisplayName= p2 service app__web`,
+		"unexpected sc.exe commands")
+
+	Assert(t).IsNil(os.Remove(argsFile), "could not reset sc.exe commands")
+	Assert(t).IsNil(ioutil.WriteFile(filepath.Join(serviceRoot, "p2-app__job.cmd"), []byte("job.exe"), 0644), "could not record app__job")
+	err = builder.Prune()
+	Assert(t).IsNil(err, "prune should have succeeded")
+	Assert(t).AreEqual(strings.Join(readCommands(t, argsFile), "; "), "stop p2-app__job; delete p2-app__job", "unexpected sc.exe commands")
+	_, err = os.Stat(filepath.Join(serviceRoot, "p2-app__job.cmd"))
+	Assert(t).IsTrue(os.IsNotExist(err), "should have removed the record of app__job")
+	_, err = os.Stat(filepath.Join(serviceRoot, "p2-app__web.cmd"))
+	Assert(t).IsNil(err, "should have kept the record of app__web")
+}
+
+func TestSVStat(t *testing.T) {
+	root, err := ioutil.TempDir("", "winsvc_sv")
+	Assert(t).IsNil(err, "could not create temporary directory")
+	defer os.RemoveAll(root)
+	sc, argsFile := testSc(t, root, `
+SERVICE_NAME: p2-app__web
+        TYPE               : 10  WIN32_OWN_PROCESS
+        STATE              : 4  RUNNING
+                                (STOPPABLE, NOT_PAUSABLE, ACCEPTS_SHUTDOWN)
+        WIN32_EXIT_CODE    : 0  (0x0)
+        PID                : 1234
+        FLAGS              :`)
+
+	sv := SV{Sc: sc}
+	service := &runit.Service{Name: "app__web"}
+	result, err := sv.Stat(service)
+	Assert(t).IsNil(err, "stat should have succeeded")
+	Assert(t).AreEqual(result.ChildStatus, runit.STATUS_RUN, "service should have been running")
+	Assert(t).AreEqual(result.ChildPID, uint64(1234), "unexpected PID")
+	Assert(t).AreEqual(strings.Join(readCommands(t, argsFile), "; "), "queryex p2-app__web", "unexpected sc.exe commands")
+
+	_, err = sv.Signal(service, "hup")
+	Assert(t).IsNotNil(err, "should have refused to signal a Windows service")
+
+	result, err = sv.Stat(&runit.Service{Name: "app__web", Path: filepath.Join(root, "app__web", "log")})
+	Assert(t).IsNil(err, "stat of the log service should have succeeded")
+	Assert(t).AreEqual(result.ChildStatus, runit.STATUS_DOWN, "the log service should not exist")
+}
@@ -0,0 +1,130 @@
+package winsvc
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+)
+
+// SV is a runit.SV that controls the Windows services registered by Backend.
+type SV struct {
+	Sc string // the path of sc.exe
+}
+
+var _ runit.SV = SV{}
+
+// NewSV returns an SV using the configured ScPath.
+func NewSV() SV {
+	return SV{Sc: *ScPath}
+}
+
+// How often the state of a stopping service is checked
+var stopPollInterval = 500 * time.Millisecond
+
+// isLogAgent returns true for the log services of runit services, which don't
+// exist because the service wrapper collects the output of services itself.
+// Commands sent to them succeed without doing anything.
+func isLogAgent(service *runit.Service) bool {
+	return filepath.Base(service.Path) == "log"
+}
+
+func (sv SV) sc(service *runit.Service, verb string) (string, error) {
+	if isLogAgent(service) {
+		return "", nil
+	}
+	return Backend{Sc: sv.Sc}.sc(verb, ServiceName(service.Name))
+}
+
+func (sv SV) Start(service *runit.Service) (string, error) {
+	return sv.sc(service, "start")
+}
+
+// Stop asks the Service Manager to stop the service and waits up to timeout
+// for it to stop.
+func (sv SV) Stop(service *runit.Service, timeout time.Duration) (string, error) {
+	out, err := sv.sc(service, "stop")
+	if err != nil || isLogAgent(service) {
+		return out, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		stat, err := sv.Stat(service)
+		if err != nil {
+			return out, err
+		}
+		if stat.ChildStatus == runit.STATUS_DOWN {
+			return out, nil
+		}
+		if time.Now().After(deadline) {
+			return out, util.Errorf("Timed out waiting for %s to stop", ServiceName(service.Name))
+		}
+		time.Sleep(stopPollInterval)
+	}
+}
+
+// Restart stops the service, waiting up to timeout for it to stop, and starts
+// it again.
+func (sv SV) Restart(service *runit.Service, timeout time.Duration) (string, error) {
+	out, err := sv.Stop(service, timeout)
+	if err != nil {
+		return out, err
+	}
+	return sv.Start(service)
+}
+
+// Once starts the service. Whether it is restarted when it exits is determined
+// by the recovery actions registered by Backend.
+func (sv SV) Once(service *runit.Service) (string, error) {
+	return sv.sc(service, "start")
+}
+
+// Signal fails, since Windows processes can't be sent signals.
+func (sv SV) Signal(service *runit.Service, command string) (string, error) {
+	return "", util.Errorf("Windows services can't be sent %q, signals are not supported", command)
+}
+
+// Stat reports the state of the service. The Service Manager doesn't report
+// how long a service has been running, so ChildTime is left empty, as are the
+// log fields since there is no log process.
+func (sv SV) Stat(service *runit.Service) (*runit.StatResult, error) {
+	if isLogAgent(service) {
+		return &runit.StatResult{ChildStatus: runit.STATUS_DOWN}, nil
+	}
+	out, err := sv.sc(service, "queryex")
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string][]string)
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			properties[strings.TrimSpace(parts[0])] = strings.Fields(parts[1])
+		}
+	}
+
+	// e.g. "STATE : 4  RUNNING"
+	state := properties["STATE"]
+	if len(state) < 2 {
+		return nil, util.Errorf("Could not parse the state of %s from %q", ServiceName(service.Name), out)
+	}
+	result := &runit.StatResult{ChildStatus: runit.STATUS_DOWN}
+	if state[1] != "RUNNING" {
+		return result, nil
+	}
+	result.ChildStatus = runit.STATUS_RUN
+
+	pid := properties["PID"]
+	if len(pid) == 0 {
+		return nil, util.Errorf("Could not parse the PID of %s from %q", ServiceName(service.Name), out)
+	}
+	result.ChildPID, err = strconv.ParseUint(pid[0], 10, 32)
+	if err != nil {
+		return nil, util.Errorf("Could not parse the PID of %s from %q: %s", ServiceName(service.Name), pid[0], err)
+	}
+	return result, nil
+}